@@ -0,0 +1,268 @@
+// Package admin provides the operational HTTP API of the events bridge.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/bridge"
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/common/procmon"
+	"github.com/sandrolain/events-bridge/src/common/version"
+	"github.com/sandrolain/events-bridge/src/config"
+)
+
+const (
+	// maxConfigSize limits the size of configurations posted to the API
+	maxConfigSize = 1 << 20
+	// shutdownTimeout bounds the graceful shutdown of the admin server
+	shutdownTimeout = 5 * time.Second
+)
+
+// Controller is the part of the bridge supervisor exposed by the admin API
+type Controller interface {
+	Status() bridge.SupervisorStatus
+	Switchover(ctx context.Context, cfg *config.Config) (bridge.SupervisorStatus, error)
+	Pause() (bridge.SupervisorStatus, error)
+	Resume() (bridge.SupervisorStatus, error)
+}
+
+// Server is the admin HTTP server
+type Server struct {
+	cfg        config.AdminConfig
+	controller Controller
+	logger     *slog.Logger
+	mux        *http.ServeMux
+	// connectorsDir is the directory of the connector plugins described by /version
+	connectorsDir string
+}
+
+// NewServer creates the admin server for the given controller
+func NewServer(cfg config.AdminConfig, controller Controller, logger *slog.Logger) *Server {
+	s := &Server{
+		cfg:        cfg,
+		controller: controller,
+		logger:     logger.With("component", "admin"),
+		mux:        http.NewServeMux(),
+
+		connectorsDir: bridge.ConnectorsDir,
+	}
+	s.mux.HandleFunc("GET /status", s.handleStatus)
+	s.mux.HandleFunc("GET /readyz", s.handleReady)
+	s.mux.HandleFunc("POST /switchover", s.handleSwitchover)
+	s.mux.HandleFunc("POST /pause", s.handlePause)
+	s.mux.HandleFunc("POST /resume", s.handleResume)
+	s.mux.HandleFunc("GET /processes", s.handleProcesses)
+	s.mux.HandleFunc("GET /version", s.handleVersion)
+	s.mux.Handle("GET "+metrics.DefaultPath, metrics.Handler())
+	if cfg.Pprof {
+		s.mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+		s.mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+		s.mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+		s.mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+		s.mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+		s.mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	}
+	return s
+}
+
+// Handler returns the HTTP handler of the admin API, including authentication
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.Token != "" && !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Events Bridge Admin"`)
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		s.mux.ServeHTTP(w, r)
+	})
+}
+
+// Run serves the admin API until the context is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.cfg.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves the admin API on the listener until the context is cancelled.
+// Without a token, it only serves on a loopback address: the API applies configurations,
+// which can run arbitrary commands through the CLI runners.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	if s.cfg.Token == "" && !isLoopback(listener.Addr()) {
+		_ = listener.Close()
+		return fmt.Errorf("a token is required to serve the admin API on %s, a non-loopback address", listener.Addr())
+	}
+
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			s.logger.Warn("failed to shutdown admin server", "error", err)
+		}
+	}()
+
+	s.logger.Info("admin API listening", "addr", listener.Addr().String())
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// isLoopback reports whether the listener address only accepts local connections
+func isLoopback(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	return ok && tcpAddr.IP.IsLoopback()
+}
+
+// authorized checks the Bearer token using constant-time comparison
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) == 1
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.controller.Status())
+}
+
+// readiness is the response of the readiness probe
+type readiness struct {
+	Ready      bool                         `json:"ready"`
+	Connectors []bridge.ConnectorStatusItem `json:"connectors,omitempty"`
+}
+
+// handleReady answers 200 while the active pipeline runs with every connector reporting its
+// status connected, 503 otherwise
+func (s *Server) handleReady(w http.ResponseWriter, _ *http.Request) {
+	active := s.controller.Status().Active
+	res := readiness{Ready: active.Ready()}
+	if active != nil {
+		res.Connectors = active.Connectors
+	}
+	status := http.StatusOK
+	if !res.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, res)
+}
+
+// handleProcesses returns the resource usage of the monitored child processes (CLI commands and plugins)
+func (s *Server) handleProcesses(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, procmon.Snapshot())
+}
+
+// handleVersion returns the build metadata of the bridge and of its connector plugins, with
+// the features enabled by the configuration of the active pipeline
+func (s *Server) handleVersion(w http.ResponseWriter, _ *http.Request) {
+	report := version.Report{Info: version.Get()}
+	connectors, err := version.Connectors(s.connectorsDir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	report.Connectors = connectors
+	if active := s.controller.Status().Active; active != nil {
+		report.Features = active.Features
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleSwitchover applies a new configuration with a blue/green switchover.
+// The configuration is the request body (YAML or JSON, format from the
+// "format" query parameter or auto-detected).
+func (s *Server) handleSwitchover(w http.ResponseWriter, r *http.Request) {
+	cfg, err := readConfig(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.logger.Info("switchover requested", "source", cfg.Source.Type, "runners", len(cfg.Runners))
+	status, err := s.controller.Switchover(r.Context(), cfg)
+	if errors.Is(err, bridge.ErrSwitchoverInProgress) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		s.logger.Error("switchover failed", "error", err)
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handlePause stops the consumption of the source of the active pipeline until it is resumed
+func (s *Server) handlePause(w http.ResponseWriter, _ *http.Request) {
+	s.logger.Warn("pause requested")
+	s.writeControl(w, s.controller.Pause)
+}
+
+// handleResume resumes the active pipeline, paused manually or by the safety valve
+func (s *Server) handleResume(w http.ResponseWriter, _ *http.Request) {
+	s.logger.Info("resume requested")
+	s.writeControl(w, s.controller.Resume)
+}
+
+// writeControl answers with the status after a pause or resume action
+func (s *Server) writeControl(w http.ResponseWriter, action func() (bridge.SupervisorStatus, error)) {
+	status, err := action()
+	if errors.Is(err, bridge.ErrNoActivePipeline) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// readConfig loads the configuration of a switchover request
+func readConfig(r *http.Request) (*config.Config, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxConfigSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	if len(body) > maxConfigSize {
+		return nil, fmt.Errorf("configuration exceeds %d bytes", maxConfigSize)
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil, errors.New("configuration body is required")
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Content-Type"), "json") {
+		format = "json"
+	}
+	return config.ParseContent(string(body), format)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Default().Warn("failed to write admin response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
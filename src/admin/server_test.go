@@ -0,0 +1,339 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/bridge"
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/common/procmon"
+	"github.com/sandrolain/events-bridge/src/common/version"
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/connectors"
+)
+
+type fakeController struct {
+	status  bridge.SupervisorStatus
+	applied *config.Config
+	err     error
+}
+
+func (c *fakeController) Status() bridge.SupervisorStatus {
+	return c.status
+}
+
+func (c *fakeController) Switchover(_ context.Context, cfg *config.Config) (bridge.SupervisorStatus, error) {
+	if c.err != nil {
+		return c.status, c.err
+	}
+	c.applied = cfg
+	c.status.Switchovers++
+	return c.status, nil
+}
+
+func (c *fakeController) Pause() (bridge.SupervisorStatus, error) {
+	if c.status.Active == nil {
+		return c.status, bridge.ErrNoActivePipeline
+	}
+	c.status.Active.Pause = &bridge.PauseStatus{Paused: true, Reason: "manual"}
+	return c.status, nil
+}
+
+func (c *fakeController) Resume() (bridge.SupervisorStatus, error) {
+	if c.status.Active == nil {
+		return c.status, bridge.ErrNoActivePipeline
+	}
+	c.status.Active.Pause = &bridge.PauseStatus{}
+	return c.status, nil
+}
+
+func newTestServer(token string, ctrl Controller) *httptest.Server {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return httptest.NewServer(NewServer(config.AdminConfig{Address: "127.0.0.1:0", Token: token}, ctrl, logger).Handler())
+}
+
+func do(t *testing.T, method, url, token, contentType string, body []byte) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	t.Cleanup(func() { _ = res.Body.Close() })
+	return res
+}
+
+func TestStatus(t *testing.T) {
+	ctrl := &fakeController{status: bridge.SupervisorStatus{Active: &bridge.PipelineStatus{Generation: 3, Source: "nats"}}}
+	srv := newTestServer("", ctrl)
+	defer srv.Close()
+
+	res := do(t, http.MethodGet, srv.URL+"/status", "", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status code = %d, want 200", res.StatusCode)
+	}
+	var status bridge.SupervisorStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		t.Fatalf("invalid status body: %v", err)
+	}
+	if status.Active == nil || status.Active.Generation != 3 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestReady(t *testing.T) {
+	connected := bridge.ConnectorStatusItem{Component: "source", Type: "amqp", ConnectorStatus: connectors.ConnectorStatus{State: connectors.StateConnected}}
+	disconnected := bridge.ConnectorStatusItem{Component: "runner[0]", Type: "amqp", ConnectorStatus: connectors.ConnectorStatus{State: connectors.StateDisconnected, LastError: "connection refused"}}
+	tests := []struct {
+		name   string
+		status bridge.SupervisorStatus
+		want   int
+	}{
+		{"no pipeline", bridge.SupervisorStatus{}, http.StatusServiceUnavailable},
+		{"no reporters", bridge.SupervisorStatus{Active: &bridge.PipelineStatus{}}, http.StatusOK},
+		{"connected", bridge.SupervisorStatus{Active: &bridge.PipelineStatus{Connectors: []bridge.ConnectorStatusItem{connected}}}, http.StatusOK},
+		{"disconnected", bridge.SupervisorStatus{Active: &bridge.PipelineStatus{Connectors: []bridge.ConnectorStatusItem{connected, disconnected}}}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer("", &fakeController{status: tt.status})
+			defer srv.Close()
+
+			res := do(t, http.MethodGet, srv.URL+"/readyz", "", "", nil)
+			if res.StatusCode != tt.want {
+				t.Fatalf("status code = %d, want %d", res.StatusCode, tt.want)
+			}
+			var body readiness
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("invalid readiness body: %v", err)
+			}
+			if body.Ready != (tt.want == http.StatusOK) {
+				t.Errorf("ready = %v", body.Ready)
+			}
+		})
+	}
+}
+
+func TestProcesses(t *testing.T) {
+	m := procmon.NewMonitor("cli:test", procmon.Config{Interval: time.Second}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer m.Close()
+	m.Restarted()
+
+	srv := newTestServer("", &fakeController{})
+	defer srv.Close()
+
+	res := do(t, http.MethodGet, srv.URL+"/processes", "", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status code = %d, want 200", res.StatusCode)
+	}
+	var processes map[string]procmon.Stats
+	if err := json.NewDecoder(res.Body).Decode(&processes); err != nil {
+		t.Fatalf("invalid processes body: %v", err)
+	}
+	if processes[m.Name()].Restarts != 1 {
+		t.Errorf("unexpected processes %+v", processes)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "http.so"), []byte("not a plugin"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctrl := &fakeController{status: bridge.SupervisorStatus{Active: &bridge.PipelineStatus{Features: []string{"admin", "lineage"}}}}
+	server := NewServer(config.AdminConfig{}, ctrl, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	server.connectorsDir = dir
+	srv := httptest.NewServer(server.Handler())
+	defer srv.Close()
+
+	res := do(t, http.MethodGet, srv.URL+"/version", "", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status code = %d, want 200", res.StatusCode)
+	}
+	var report version.Report
+	if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+		t.Fatalf("invalid version body: %v", err)
+	}
+	if report.Version == "" || report.GoVersion == "" || strings.Join(report.Features, ",") != "admin,lineage" {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if len(report.Connectors) != 1 || report.Connectors[0].Name != "http" || report.Connectors[0].SHA256 == "" || report.Connectors[0].Error == "" {
+		t.Errorf("unexpected connectors %+v", report.Connectors)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	metrics.Reconnected("admin-test")
+
+	srv := newTestServer("secret", &fakeController{})
+	defer srv.Close()
+
+	if res := do(t, http.MethodGet, srv.URL+"/metrics", "", "", nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status code without token = %d, want 401", res.StatusCode)
+	}
+	res := do(t, http.MethodGet, srv.URL+"/metrics", "secret", "", nil)
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), `eb_connector_reconnects_total{connector="admin-test"} 1`) {
+		t.Errorf("metrics = %d %s", res.StatusCode, body)
+	}
+}
+
+func TestSwitchover(t *testing.T) {
+	ctrl := &fakeController{}
+	srv := newTestServer("", ctrl)
+	defer srv.Close()
+
+	res := do(t, http.MethodPost, srv.URL+"/switchover", "", "application/json", []byte(`{"source":{"type":"nats"}}`))
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		t.Fatalf("status code = %d, want 200: %s", res.StatusCode, body)
+	}
+	if ctrl.applied == nil || ctrl.applied.Source.Type != "nats" {
+		t.Errorf("configuration not applied: %+v", ctrl.applied)
+	}
+}
+
+func TestSwitchoverInvalidConfig(t *testing.T) {
+	ctrl := &fakeController{}
+	srv := newTestServer("", ctrl)
+	defer srv.Close()
+
+	if res := do(t, http.MethodPost, srv.URL+"/switchover", "", "", nil); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("empty body status code = %d, want 400", res.StatusCode)
+	}
+	if res := do(t, http.MethodPost, srv.URL+"/switchover?format=yaml", "", "", []byte("runners: []")); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid config status code = %d, want 400", res.StatusCode)
+	}
+	if ctrl.applied != nil {
+		t.Error("invalid configuration must not be applied")
+	}
+}
+
+func TestSwitchoverErrors(t *testing.T) {
+	ctrl := &fakeController{err: bridge.ErrSwitchoverInProgress}
+	srv := newTestServer("", ctrl)
+	defer srv.Close()
+
+	body := []byte("source:\n  type: nats\n")
+	if res := do(t, http.MethodPost, srv.URL+"/switchover", "", "", body); res.StatusCode != http.StatusConflict {
+		t.Errorf("in progress status code = %d, want 409", res.StatusCode)
+	}
+
+	ctrl.err = io.ErrUnexpectedEOF
+	if res := do(t, http.MethodPost, srv.URL+"/switchover", "", "", body); res.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("failed switchover status code = %d, want 422", res.StatusCode)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	srv := newTestServer("secret", &fakeController{})
+	defer srv.Close()
+
+	if res := do(t, http.MethodGet, srv.URL+"/status", "", "", nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("missing token status code = %d, want 401", res.StatusCode)
+	}
+	if res := do(t, http.MethodGet, srv.URL+"/status", "wrong", "", nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong token status code = %d, want 401", res.StatusCode)
+	}
+	if res := do(t, http.MethodGet, srv.URL+"/status", "secret", "", nil); res.StatusCode != http.StatusOK {
+		t.Errorf("valid token status code = %d, want 200", res.StatusCode)
+	}
+}
+
+func TestServeRequiresToken(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tests := []struct {
+		name    string
+		address string
+		token   string
+		wantErr bool
+	}{
+		{name: "loopback without token", address: "127.0.0.1:0"},
+		{name: "all interfaces without token", address: "0.0.0.0:0", wantErr: true},
+		{name: "all interfaces with token", address: "0.0.0.0:0", token: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", tt.address)
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err = NewServer(config.AdminConfig{Address: tt.address, Token: tt.token}, &fakeController{}, logger).Serve(ctx, listener)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Serve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPprof(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, enabled := range []bool{false, true} {
+		srv := httptest.NewServer(NewServer(config.AdminConfig{Pprof: enabled, Token: "secret"}, &fakeController{}, logger).Handler())
+
+		want := http.StatusNotFound
+		if enabled {
+			want = http.StatusOK
+		}
+		if res := do(t, http.MethodGet, srv.URL+"/debug/pprof/goroutine?debug=1", "secret", "", nil); res.StatusCode != want {
+			t.Errorf("pprof enabled=%v status code = %d, want %d", enabled, res.StatusCode, want)
+		}
+		if res := do(t, http.MethodGet, srv.URL+"/debug/pprof/goroutine", "", "", nil); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("pprof without token status code = %d, want 401", res.StatusCode)
+		}
+		srv.Close()
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	ctrl := &fakeController{status: bridge.SupervisorStatus{Active: &bridge.PipelineStatus{Generation: 1}}}
+	srv := newTestServer("", ctrl)
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		path   string
+		paused bool
+	}{
+		{"/pause", true},
+		{"/resume", false},
+	} {
+		res := do(t, http.MethodPost, srv.URL+tt.path, "", "", nil)
+		var status bridge.SupervisorStatus
+		if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+			t.Fatalf("failed to decode %s response: %v", tt.path, err)
+		}
+		if res.StatusCode != http.StatusOK || status.Active.Pause == nil || status.Active.Pause.Paused != tt.paused {
+			t.Errorf("%s = %d %+v, want paused %v", tt.path, res.StatusCode, status.Active.Pause, tt.paused)
+		}
+	}
+
+	if res := do(t, http.MethodGet, srv.URL+"/pause", "", "", nil); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /pause status code = %d, want 405", res.StatusCode)
+	}
+	ctrl.status.Active = nil
+	if res := do(t, http.MethodPost, srv.URL+"/resume", "", "", nil); res.StatusCode != http.StatusConflict {
+		t.Errorf("resume without pipeline status code = %d, want 409", res.StatusCode)
+	}
+}
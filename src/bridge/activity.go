@@ -0,0 +1,150 @@
+package bridge
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxRecentErrors is the number of recent errors kept for the live diagnostics
+const maxRecentErrors = 20
+
+// StageActivity is the live activity of a pipeline stage
+type StageActivity struct {
+	Stage     string `json:"stage"`
+	Connector string `json:"connector,omitempty"`
+	// Active is the number of messages the stage is processing
+	Active int64 `json:"active"`
+	// Processed is the number of messages the stage has completed (received, for the source)
+	Processed int64 `json:"processed"`
+	// LastActivity is the last time the stage started or completed a message
+	LastActivity time.Time `json:"lastActivity,omitzero"`
+}
+
+// ErrorRecord is a recent error of the pipeline
+type ErrorRecord struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Error     string    `json:"error"`
+}
+
+// activityTracker counts the messages of the pipeline stages and keeps the recent errors,
+// so that a wedged pipeline can be told apart from an idle one. A nil tracker records nothing.
+type activityTracker struct {
+	mu     sync.Mutex
+	stages []*stageCounter
+	errors []ErrorRecord
+	next   int
+}
+
+// stageCounter is the activity of a stage
+type stageCounter struct {
+	stage     string
+	connector string
+	active    atomic.Int64
+	processed atomic.Int64
+	last      atomic.Int64
+}
+
+func newActivityTracker() *activityTracker {
+	return &activityTracker{}
+}
+
+// stage wraps a pipeline stage with the profiler labels and the activity counters
+func (b *EventsBridge) stage(name, connector string) func(func()) {
+	run := b.profiler.Stage(name, connector)
+	counter := b.activity.stage(name, connector)
+	return func(fn func()) {
+		counter.run(func() { run(fn) })
+	}
+}
+
+// stage returns the counter of the stage, registering it on first use
+func (a *activityTracker) stage(stage, connector string) *stageCounter {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, c := range a.stages {
+		if c.stage == stage {
+			return c
+		}
+	}
+	c := &stageCounter{stage: stage, connector: connector}
+	a.stages = append(a.stages, c)
+	return c
+}
+
+// run counts fn as a message processed by the stage
+func (c *stageCounter) run(fn func()) {
+	if c == nil {
+		fn()
+		return
+	}
+	c.touch()
+	c.active.Add(1)
+	defer func() {
+		c.active.Add(-1)
+		c.processed.Add(1)
+		c.touch()
+	}()
+	fn()
+}
+
+// observe counts a message handled by the stage without a duration, e.g. a received message
+func (c *stageCounter) observe() {
+	if c == nil {
+		return
+	}
+	c.processed.Add(1)
+	c.touch()
+}
+
+func (c *stageCounter) touch() {
+	c.last.Store(time.Now().UnixNano())
+}
+
+// recordError keeps the error among the recent ones, overwriting the oldest
+func (a *activityTracker) recordError(operation string, err error) {
+	if a == nil {
+		return
+	}
+	rec := ErrorRecord{Time: time.Now(), Operation: operation}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.errors) < maxRecentErrors {
+		a.errors = append(a.errors, rec)
+		return
+	}
+	a.errors[a.next] = rec
+	a.next = (a.next + 1) % maxRecentErrors
+}
+
+// snapshot returns the activity of the stages, in registration order, and the recent errors, oldest first
+func (a *activityTracker) snapshot() ([]StageActivity, []ErrorRecord) {
+	if a == nil {
+		return nil, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stages := make([]StageActivity, len(a.stages))
+	for i, c := range a.stages {
+		stages[i] = StageActivity{
+			Stage:     c.stage,
+			Connector: c.connector,
+			Active:    c.active.Load(),
+			Processed: c.processed.Load(),
+		}
+		if last := c.last.Load(); last > 0 {
+			stages[i].LastActivity = time.Unix(0, last)
+		}
+	}
+	errs := make([]ErrorRecord, 0, len(a.errors))
+	errs = append(errs, a.errors[a.next:]...)
+	errs = append(errs, a.errors[:a.next]...)
+	return stages, errs
+}
@@ -0,0 +1,101 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+func TestActivityTracksStages(t *testing.T) {
+	src := newChanSource()
+	release := make(chan struct{})
+	b := &EventsBridge{
+		cfg:      newTestConfig(),
+		logger:   newTestLogger(),
+		source:   src,
+		activity: newActivityTracker(),
+		runners: []RunnerItem{{
+			Config: connectors.RunnerConfig{Type: "blocking"},
+			Runner: &funcRunner{process: func(msg *message.RunnerMessage) error {
+				data, _ := msg.GetData()
+				if string(data) == "bad" {
+					return errors.New("boom")
+				}
+				<-release
+				return nil
+			}},
+		}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+
+	failed := newCountingMessage("bad")
+	src.c <- message.NewRunnerMessage(failed)
+	waitFor(t, func() bool { return failed.naks.Load() == 1 })
+
+	wedged := newCountingMessage("ok")
+	src.c <- message.NewRunnerMessage(wedged)
+	waitFor(t, func() bool {
+		stages, _ := b.Activity()
+		return len(stages) == 3 && stages[1].Active == 1
+	})
+
+	stages, errs := b.Activity()
+	want := []struct {
+		stage, connector  string
+		active, processed int64
+	}{
+		{stageSource, "cli", 0, 2},
+		{"runner[0]", "blocking", 1, 1},
+		{stageAck, "cli", 0, 0},
+	}
+	for i, w := range want {
+		s := stages[i]
+		if s.Stage != w.stage || s.Connector != w.connector || s.Active != w.active || s.Processed != w.processed {
+			t.Errorf("stage %d = %+v, want %+v", i, s, w)
+		}
+	}
+	if stages[0].LastActivity.IsZero() || !stages[2].LastActivity.IsZero() {
+		t.Errorf("unexpected last activity: source %v, ack %v", stages[0].LastActivity, stages[2].LastActivity)
+	}
+	if len(errs) != 1 || errs[0].Operation != "error processing message" || errs[0].Error != "boom" {
+		t.Errorf("recent errors = %+v", errs)
+	}
+
+	close(release)
+	waitFor(t, func() bool { return wedged.acks.Load() == 1 })
+	stages, _ = b.Activity()
+	if stages[1].Active != 0 || stages[2].Processed != 1 {
+		t.Errorf("stages after release = %+v", stages)
+	}
+}
+
+func TestActivityRecentErrorsRing(t *testing.T) {
+	a := newActivityTracker()
+	for i := range maxRecentErrors + 5 {
+		a.recordError("op", fmt.Errorf("error %d", i))
+	}
+	_, errs := a.snapshot()
+	if len(errs) != maxRecentErrors {
+		t.Fatalf("recent errors = %d, want %d", len(errs), maxRecentErrors)
+	}
+	if errs[0].Error != "error 5" || errs[len(errs)-1].Error != fmt.Sprintf("error %d", maxRecentErrors+4) {
+		t.Errorf("oldest = %s, newest = %s", errs[0].Error, errs[len(errs)-1].Error)
+	}
+
+	var nilTracker *activityTracker
+	nilTracker.recordError("op", errors.New("ignored"))
+	ran := false
+	nilTracker.stage("source", "").run(func() { ran = true })
+	if stages, errs := nilTracker.snapshot(); !ran || stages != nil || errs != nil {
+		t.Error("nil tracker must run the stages and record nothing")
+	}
+}
@@ -0,0 +1,323 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/destel/rill"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+	"github.com/sandrolain/events-bridge/src/common/expreval"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// batchRunnerType is the built-in runner type accumulating the messages into batches
+const batchRunnerType = "batch"
+
+const (
+	batchFormatJSON   = "json"
+	batchFormatNDJSON = "ndjson"
+	batchFormatCBOR   = "cbor"
+
+	defaultBatchMaxMessages = 100
+	defaultBatchMaxWait     = time.Second
+)
+
+// Metadata keys set on the batch messages
+const (
+	metaBatchID   = "eb-batch-id"
+	metaBatchSize = "eb-batch-size"
+)
+
+// errBatchNested is returned for a batch runner outside of the main runner chain
+var errBatchNested = errors.New("the batch runner is only supported in the main runner chain")
+
+// batchRunnerConfig holds the options of the batch runner
+type batchRunnerConfig struct {
+	// MaxMessages is the number of messages of a full batch (default: 100)
+	MaxMessages int `mapstructure:"maxMessages" validate:"min=0"`
+	// MaxBytes flushes the batch before its payloads exceed this size (0 = unlimited)
+	MaxBytes int `mapstructure:"maxBytes" validate:"min=0"`
+	// MaxWait is the time a batch waits for more messages after the first one (default: 1s)
+	MaxWait time.Duration `mapstructure:"maxWait" validate:"min=0"`
+	// Format is the payload of the batch: "json" (default, an array of the payloads),
+	// "ndjson" (a line per payload) or "cbor" (a CBOR array of the payloads)
+	Format string `mapstructure:"format" validate:"omitempty,oneof=json ndjson cbor"`
+	// IncludeMetadata wraps every payload into an object with its "metadata" and "data"
+	IncludeMetadata bool `mapstructure:"includeMetadata"`
+	// KeyFrom is the metadata key grouping the messages: every key has its own batch
+	KeyFrom string `mapstructure:"keyFrom"`
+}
+
+// pendingBatch is a batch being filled
+type pendingBatch struct {
+	msgs     []*message.RunnerMessage
+	bytes    int
+	deadline time.Time
+}
+
+// batchMessages accumulates the messages of the stream into batch messages, flushed when
+// full, when the first message waited for MaxWait or when the stream ends. The messages
+// for which the ifExpr of the runner is false are passed on without batching.
+func (b *EventsBridge) batchMessages(stream rill.Stream[*message.RunnerMessage], cfg batchRunnerConfig, ifExpr string, ifEval *expreval.ExprEvaluator) rill.Stream[*message.RunnerMessage] {
+	if cfg.MaxMessages == 0 {
+		cfg.MaxMessages = defaultBatchMaxMessages
+	}
+	if cfg.MaxWait == 0 {
+		cfg.MaxWait = defaultBatchMaxWait
+	}
+	if cfg.Format == "" {
+		cfg.Format = batchFormatJSON
+	}
+
+	out := make(chan rill.Try[*message.RunnerMessage])
+	go func() {
+		defer close(out)
+		batches := map[string]*pendingBatch{}
+		flush := func(key string) {
+			pending := batches[key]
+			delete(batches, key)
+			if msg := b.newBatchMessage(pending.msgs, cfg); msg != nil {
+				out <- rill.Wrap(msg, nil)
+			}
+		}
+
+		timer := time.NewTimer(time.Hour)
+		timer.Stop()
+		for {
+			// The timer fires at the deadline of the oldest batch
+			var next time.Time
+			for _, pending := range batches {
+				if next.IsZero() || pending.deadline.Before(next) {
+					next = pending.deadline
+				}
+			}
+			var expired <-chan time.Time
+			if !next.IsZero() {
+				timer.Reset(time.Until(next))
+				expired = timer.C
+			}
+
+			select {
+			case item, ok := <-stream:
+				timer.Stop()
+				if !ok {
+					for key := range batches {
+						flush(key)
+					}
+					return
+				}
+				if item.Error != nil {
+					out <- item
+					continue
+				}
+				if ifEval != nil {
+					pass, err := ifEval.EvalMessage(item.Value)
+					if err != nil {
+						b.HandleError(item.Value, err, "failed to evaluate ifExpr, skipping runner processing", "ifExpr", ifExpr)
+						continue
+					}
+					if !pass {
+						out <- item
+						continue
+					}
+				}
+				b.addToBatch(item.Value, cfg, batches, flush)
+			case <-expired:
+				now := time.Now()
+				for key, pending := range batches {
+					if !now.Before(pending.deadline) {
+						flush(key)
+					}
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// addToBatch adds the message to the batch of its key, flushing the batch when the message
+// would exceed its size or fills it
+func (b *EventsBridge) addToBatch(msg *message.RunnerMessage, cfg batchRunnerConfig, batches map[string]*pendingBatch, flush func(string)) {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		b.HandleError(msg, err, "failed to get metadata and data of the batched message")
+		return
+	}
+	key := ""
+	if cfg.KeyFrom != "" {
+		key = meta[cfg.KeyFrom]
+	}
+
+	pending := batches[key]
+	if pending != nil && cfg.MaxBytes > 0 && pending.bytes+len(data) > cfg.MaxBytes {
+		flush(key)
+		pending = nil
+	}
+	if pending == nil {
+		pending = &pendingBatch{deadline: time.Now().Add(cfg.MaxWait)}
+		batches[key] = pending
+	}
+	pending.msgs = append(pending.msgs, msg)
+	pending.bytes += len(data)
+	if len(pending.msgs) >= cfg.MaxMessages || (cfg.MaxBytes > 0 && pending.bytes >= cfg.MaxBytes) {
+		flush(key)
+	}
+}
+
+// newBatchMessage encodes the messages into a batch message, with the metadata shared by
+// all the messages. The messages failing to encode are naked and left out.
+func (b *EventsBridge) newBatchMessage(msgs []*message.RunnerMessage, cfg batchRunnerConfig) *message.RunnerMessage {
+	items := make([]any, 0, len(msgs))
+	members := make([]*message.RunnerMessage, 0, len(msgs))
+	var common map[string]string
+	for _, msg := range msgs {
+		meta, data, err := msg.GetMetadataAndData()
+		if err == nil {
+			var item any
+			if item, err = batchItem(meta, data, cfg); err == nil {
+				items = append(items, item)
+				members = append(members, msg)
+				common = commonMetadata(common, meta, len(members) == 1)
+				continue
+			}
+		}
+		b.HandleError(msg, err, "failed to add message to the batch")
+	}
+	if len(members) == 0 {
+		return nil
+	}
+
+	data, err := encodeBatch(items, cfg.Format)
+	if err != nil {
+		for _, msg := range members {
+			b.HandleError(msg, err, "failed to encode the batch")
+		}
+		return nil
+	}
+
+	id := uuid.NewString()
+	common[metaBatchID] = id
+	common[metaBatchSize] = strconv.Itoa(len(members))
+	batch := message.NewRunnerMessage(&batchGroup{id: id, members: members, metadata: maps.Clone(common), data: data})
+	batch.SetIngressTime(members[0].GetIngressTime())
+	batch.SetTraceContext(members[0].GetTraceContext())
+	batch.SetMetadata(common)
+	batch.SetData(data)
+	return batch
+}
+
+// commonMetadata returns the metadata shared by the messages so far and the next message
+func commonMetadata(common, meta map[string]string, first bool) map[string]string {
+	if first {
+		common = maps.Clone(meta)
+		if common == nil {
+			common = make(map[string]string, 2)
+		}
+		return common
+	}
+	for k, v := range common {
+		if meta[k] != v {
+			delete(common, k)
+		}
+	}
+	return common
+}
+
+// batchItem returns the batch element of a message: the JSON payloads as they are, the
+// other payloads as strings, wrapped with their metadata when configured
+func batchItem(meta map[string]string, data []byte, cfg batchRunnerConfig) (any, error) {
+	var item any
+	switch {
+	case json.Valid(data):
+		if cfg.Format == batchFormatCBOR {
+			if err := json.Unmarshal(data, &item); err != nil {
+				return nil, fmt.Errorf("failed to decode payload: %w", err)
+			}
+			break
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, data); err != nil {
+			return nil, fmt.Errorf("failed to compact payload: %w", err)
+		}
+		item = json.RawMessage(compact.Bytes())
+	case cfg.Format == batchFormatCBOR:
+		item = data
+	default:
+		item = string(data)
+	}
+	if cfg.IncludeMetadata {
+		return map[string]any{"metadata": meta, "data": item}, nil
+	}
+	return item, nil
+}
+
+// encodeBatch encodes the batch elements in the format
+func encodeBatch(items []any, format string) ([]byte, error) {
+	switch format {
+	case batchFormatCBOR:
+		return cbor.Marshal(items)
+	case batchFormatNDJSON:
+		var buf bytes.Buffer
+		for _, item := range items {
+			line, err := json.Marshal(item)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+	default:
+		return json.Marshal(items)
+	}
+}
+
+// batchGroup is the source of a batch message: acking or naking it acks or naks every
+// message of the batch, once. Its metadata and data are the ones the batch was created
+// with, e.g. the original payload published to the dead-letter target.
+type batchGroup struct {
+	id       string
+	members  []*message.RunnerMessage
+	metadata map[string]string
+	data     []byte
+	once     sync.Once
+}
+
+func (g *batchGroup) GetID() []byte {
+	return []byte(g.id)
+}
+
+func (g *batchGroup) GetMetadata() (map[string]string, error) {
+	return maps.Clone(g.metadata), nil
+}
+
+func (g *batchGroup) GetData() ([]byte, error) {
+	return g.data, nil
+}
+
+func (g *batchGroup) Ack(d *message.ReplyData) error {
+	var errs []error
+	g.once.Do(func() {
+		for _, msg := range g.members {
+			errs = append(errs, msg.Ack(d))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+func (g *batchGroup) Nak() error {
+	var errs []error
+	g.once.Do(func() {
+		for _, msg := range g.members {
+			errs = append(errs, msg.Nak())
+		}
+	})
+	return errors.Join(errs...)
+}
@@ -0,0 +1,195 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// startBatchBridge starts a bridge batching the messages before the runner, with an
+// optional dead-letter target
+func startBatchBridge(t *testing.T, batch connectors.RunnerConfig, runner connectors.Runner, dl *deadLetter) *chanSource {
+	t.Helper()
+	src := newChanSource()
+	batch.Type = batchRunnerType
+	b := &EventsBridge{
+		cfg:        newTestConfig(),
+		logger:     newTestLogger(),
+		source:     src,
+		activity:   newActivityTracker(),
+		deadLetter: dl,
+		runners: []RunnerItem{
+			{Config: batch},
+			{Config: connectors.RunnerConfig{Type: "test"}, Runner: runner},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	return src
+}
+
+func TestBatchPipeline(t *testing.T) {
+	runner := &recordingRunner{}
+	src := startBatchBridge(t, connectors.RunnerConfig{Options: map[string]any{"maxMessages": 3, "maxWait": time.Hour}}, runner, nil)
+
+	msgs := []*countingMessage{newCountingMessage(`{"n": 1}`), newCountingMessage("plain"), newCountingMessage(`[2]`)}
+	for _, m := range msgs {
+		src.c <- message.NewRunnerMessage(m)
+	}
+	waitFor(t, func() bool {
+		return msgs[0].acks.Load() == 1 && msgs[1].acks.Load() == 1 && msgs[2].acks.Load() == 1
+	})
+
+	if runner.processed() != 1 {
+		t.Fatalf("processed = %d, want 1 batch", runner.processed())
+	}
+	if runner.data[0] != `[{"n":1},"plain",[2]]` {
+		t.Errorf("batch payload = %s", runner.data[0])
+	}
+	if meta := runner.metadata[0]; meta[metaBatchSize] != "3" || meta[metaBatchID] == "" {
+		t.Errorf("batch metadata = %v", meta)
+	}
+}
+
+func TestBatchFlushOnWait(t *testing.T) {
+	runner := &funcRunner{process: func(*message.RunnerMessage) error { return errors.New("write failed") }}
+	src := startBatchBridge(t, connectors.RunnerConfig{Options: map[string]any{"maxMessages": 10, "maxWait": 50 * time.Millisecond}}, runner, nil)
+
+	first, second := newCountingMessage("1"), newCountingMessage("2")
+	start := time.Now()
+	src.c <- message.NewRunnerMessage(first)
+	src.c <- message.NewRunnerMessage(second)
+	// The failed batch naks all its messages
+	waitFor(t, func() bool { return first.naks.Load() == 1 && second.naks.Load() == 1 })
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("batch flushed after %v, before maxWait", elapsed)
+	}
+}
+
+func TestBatchDeadLetter(t *testing.T) {
+	target := &recordingRunner{}
+	failing := &funcRunner{process: func(msg *message.RunnerMessage) error {
+		msg.SetData([]byte("modified"))
+		return errors.New("write failed")
+	}}
+	src := startBatchBridge(t, connectors.RunnerConfig{Options: map[string]any{"maxMessages": 2, "maxWait": time.Hour}},
+		failing, &deadLetter{runner: target})
+
+	first := &countingMessage{Adapter: testutil.NewAdapter([]byte(`{"n":1}`), map[string]string{"table": "t"})}
+	second := &countingMessage{Adapter: testutil.NewAdapter([]byte(`{"n":2}`), map[string]string{"table": "t"})}
+	src.c <- message.NewRunnerMessage(first)
+	src.c <- message.NewRunnerMessage(second)
+	waitFor(t, func() bool { return first.acks.Load() == 1 && second.acks.Load() == 1 })
+
+	// The dead-letter target receives the batch as it was created, not an empty payload
+	if target.processed() != 1 {
+		t.Fatalf("dead-lettered = %d, want 1 batch", target.processed())
+	}
+	if target.data[0] != `[{"n":1},{"n":2}]` {
+		t.Errorf("dead-lettered payload = %q", target.data[0])
+	}
+	if meta := target.metadata[0]; meta["table"] != "t" || meta[metaBatchSize] != "2" || meta[metaBatchID] == "" {
+		t.Errorf("dead-lettered metadata = %v", meta)
+	}
+}
+
+func TestBatchIfExpr(t *testing.T) {
+	runner := &recordingRunner{}
+	src := startBatchBridge(t, connectors.RunnerConfig{
+		IfExpr:  `metadata.table == "orders"`,
+		Options: map[string]any{"maxMessages": 2, "maxWait": time.Hour},
+	}, runner, nil)
+
+	send := func(data, table string) *countingMessage {
+		m := &countingMessage{Adapter: testutil.NewAdapter([]byte(data), map[string]string{"table": table})}
+		src.c <- message.NewRunnerMessage(m)
+		return m
+	}
+	first, skipped, second := send("1", "orders"), send("2", "users"), send("3", "orders")
+	waitFor(t, func() bool { return first.acks.Load() == 1 && skipped.acks.Load() == 1 && second.acks.Load() == 1 })
+
+	// The message not matching the ifExpr passes on alone
+	if runner.processed() != 2 {
+		t.Fatalf("processed = %d, want the skipped message and 1 batch", runner.processed())
+	}
+	if runner.data[0] != "2" || runner.data[1] != `[1,3]` {
+		t.Errorf("processed = %q", runner.data)
+	}
+}
+
+func TestBatchKeysAndBytes(t *testing.T) {
+	runner := &recordingRunner{}
+	src := startBatchBridge(t, connectors.RunnerConfig{Options: map[string]any{
+		"maxBytes":        4,
+		"maxWait":         time.Hour,
+		"keyFrom":         "table",
+		"format":          batchFormatNDJSON,
+		"includeMetadata": true,
+	}}, runner, nil)
+
+	send := func(data, table string) *countingMessage {
+		m := &countingMessage{Adapter: testutil.NewAdapter([]byte(data), map[string]string{"table": table, "id": data})}
+		src.c <- message.NewRunnerMessage(m)
+		return m
+	}
+	a1, b1 := send("aa", "a"), send("bb", "b")
+	// The message exceeding the size flushes the batch of its key
+	a2 := send("aaa", "a")
+	waitFor(t, func() bool { return a1.acks.Load() == 1 })
+	// The message reaching the size flushes its batch
+	send("b", "b")
+	send("bb", "b")
+	waitFor(t, func() bool { return b1.acks.Load() == 1 })
+
+	if runner.processed() != 2 {
+		t.Fatalf("processed = %d, want 2 batches", runner.processed())
+	}
+	if runner.data[0] != `{"data":"aa","metadata":{"id":"aa","table":"a"}}`+"\n" {
+		t.Errorf("first batch = %q", runner.data[0])
+	}
+	if meta := runner.metadata[1]; meta["table"] != "b" || meta["id"] != "" || meta[metaBatchSize] != "2" {
+		t.Errorf("second batch metadata = %v", meta)
+	}
+	if a2.acks.Load() != 0 {
+		t.Error("message of a pending batch acked")
+	}
+}
+
+func TestEncodeBatchCBOR(t *testing.T) {
+	cfg := batchRunnerConfig{Format: batchFormatCBOR}
+	var items []any
+	for _, data := range []string{`{"n":1}`, "raw"} {
+		item, err := batchItem(nil, []byte(data), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	data, err := encodeBatch(items, cfg.Format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []any
+	if err := cbor.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[0].(map[any]any)["n"] != float64(1) || string(decoded[1].([]byte)) != "raw" {
+		t.Errorf("decoded = %#v", decoded)
+	}
+}
+
+func TestBatchRunnerNested(t *testing.T) {
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	if _, err := b.createRunner(connectors.RunnerConfig{Type: batchRunnerType}); !errors.Is(err, errBatchNested) {
+		t.Errorf("createRunner() error = %v, want errBatchNested", err)
+	}
+}
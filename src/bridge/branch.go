@@ -0,0 +1,288 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/sandrolain/events-bridge/src/common/expreval"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	joinMerge   = "merge"
+	joinFirst   = "first"
+	joinCollect = "collect"
+)
+
+// errStageOptionsNested is returned for a runner of a sub-pipeline with the options applied
+// by the main runner chain only
+var errStageOptionsNested = errors.New("throttle, payloadLimit and maxRetryAfter are only supported in the main runner chain")
+
+// Ensure branchRunner implements connectors.Runner
+var _ connectors.Runner = (*branchRunner)(nil)
+
+// branchStage is a runner of a branch together with its optional evaluators
+type branchStage struct {
+	cfg        connectors.RunnerConfig
+	runner     connectors.Runner
+	ifEval     *expreval.ExprEvaluator
+	filterEval *expreval.ExprEvaluator
+}
+
+// branchResult is the outcome of a single branch execution
+type branchResult struct {
+	index  int
+	msg    *message.RunnerMessage
+	passed bool
+	err    error
+}
+
+// branchRunner executes parallel sub-pipelines on copies of the message
+// and joins their results according to the configured policy
+type branchRunner struct {
+	join     string
+	branches [][]branchStage
+	logger   *slog.Logger
+}
+
+// branchRunnerConfig holds the options of the branch runner
+type branchRunnerConfig struct {
+	// Branches are the sub-pipelines, each one a list of runners executed on its own copy of the message
+	Branches [][]connectors.RunnerConfig `mapstructure:"branches" validate:"required,min=1,dive,dive"`
+	// Join selects how the branch results are combined: "merge" (default), "first" or "collect"
+	Join string `mapstructure:"join" validate:"omitempty,oneof=merge first collect"`
+}
+
+// createBranchRunner builds the runners of every branch of a "branch" runner configuration
+func (b *EventsBridge) createBranchRunner(runnerConfig connectors.RunnerConfig) (connectors.Runner, error) {
+	cfg := new(branchRunnerConfig)
+	if err := b.parseRunnerOptions(runnerConfig, cfg); err != nil {
+		return nil, err
+	}
+
+	join := cfg.Join
+	if join == "" {
+		join = joinMerge
+	}
+
+	br := &branchRunner{
+		join:     join,
+		branches: make([][]branchStage, len(cfg.Branches)),
+		logger:   b.logger.With("component", "branch"),
+	}
+
+	for i, branch := range cfg.Branches {
+		stages, err := b.createStages(branch)
+		if err != nil {
+			br.Close() //nolint:errcheck
+			return nil, fmt.Errorf("branch %d: %w", i, err)
+		}
+		br.branches[i] = stages
+	}
+
+	return br, nil
+}
+
+// createStages builds the runners of a sub-pipeline, closing the created ones on failure
+func (b *EventsBridge) createStages(cfgs []connectors.RunnerConfig) ([]branchStage, error) {
+	stages := make([]branchStage, 0, len(cfgs))
+	for j, stageCfg := range cfgs {
+		stage, err := b.createStage(stageCfg)
+		if err != nil {
+			closeStages(stages) //nolint:errcheck
+			return nil, fmt.Errorf("runner %d: %w", j, err)
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// createStage builds a runner of a sub-pipeline together with its evaluators
+func (b *EventsBridge) createStage(cfg connectors.RunnerConfig) (branchStage, error) {
+	if cfg.Throttle != nil || cfg.PayloadLimit != nil || cfg.MaxRetryAfter != 0 {
+		return branchStage{}, errStageOptionsNested
+	}
+	ifEval, err := expreval.NewExprEvaluator(cfg.IfExpr)
+	if err != nil {
+		return branchStage{}, fmt.Errorf("failed to create ifExpr evaluator: %w", err)
+	}
+	filterEval, err := expreval.NewExprEvaluator(cfg.FilterExpr)
+	if err != nil {
+		return branchStage{}, fmt.Errorf("failed to create filterExpr evaluator: %w", err)
+	}
+	runner, err := b.createRunner(cfg)
+	if err != nil {
+		return branchStage{}, fmt.Errorf("failed to create runner: %w", err)
+	}
+	return branchStage{cfg: cfg, runner: runner, ifEval: ifEval, filterEval: filterEval}, nil
+}
+
+// closeStages closes the runners of a sub-pipeline
+func closeStages(stages []branchStage) error {
+	var errs []error
+	for j, stage := range stages {
+		if stage.runner == nil {
+			continue
+		}
+		if err := stage.runner.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close runner %d: %w", j, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Process runs all branches concurrently and joins their results into msg
+func (r *branchRunner) Process(msg *message.RunnerMessage) error {
+	results := make(chan branchResult, len(r.branches))
+	for i, stages := range r.branches {
+		go func(i int, stages []branchStage, clone *message.RunnerMessage) {
+			res, passed, err := runBranch(clone, stages)
+			results <- branchResult{index: i, msg: res, passed: passed, err: err}
+		}(i, stages, msg.Clone())
+	}
+
+	if r.join == joinFirst {
+		return r.joinFirst(msg, results)
+	}
+
+	ordered := make([]branchResult, len(r.branches))
+	for range r.branches {
+		res := <-results
+		ordered[res.index] = res
+	}
+
+	var errs []error
+	for _, res := range ordered {
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("branch %d: %w", res.index, res.err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if r.join == joinCollect {
+		return collectBranches(msg, ordered)
+	}
+	return mergeBranches(msg, ordered)
+}
+
+// joinFirst replaces the message content with the first branch that completes successfully
+func (r *branchRunner) joinFirst(msg *message.RunnerMessage, results <-chan branchResult) error {
+	var errs []error
+	for range r.branches {
+		res := <-results
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("branch %d: %w", res.index, res.err))
+			continue
+		}
+		if !res.passed {
+			continue
+		}
+		meta, data, err := res.msg.GetMetadataAndData()
+		if err != nil {
+			return fmt.Errorf("branch %d: %w", res.index, err)
+		}
+		r.logger.Debug("first branch completed", "branch", res.index)
+		msg.MergeMetadata(meta)
+		msg.SetData(data)
+		return nil
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return fmt.Errorf("all branches filtered out the message")
+}
+
+// mergeBranches merges the metadata of every branch result into msg, in branch order
+func mergeBranches(msg *message.RunnerMessage, results []branchResult) error {
+	for _, res := range results {
+		if !res.passed {
+			continue
+		}
+		meta, err := res.msg.GetMetadata()
+		if err != nil {
+			return fmt.Errorf("branch %d: %w", res.index, err)
+		}
+		msg.MergeMetadata(meta)
+	}
+	return nil
+}
+
+// collectedBranch is the JSON representation of a branch result for the collect join
+type collectedBranch struct {
+	Metadata map[string]string `json:"metadata"`
+	Data     any               `json:"data"`
+}
+
+// collectBranches replaces the payload with a JSON array holding the result of every branch.
+// Branch payloads that are valid JSON are embedded as is, other payloads as strings.
+func collectBranches(msg *message.RunnerMessage, results []branchResult) error {
+	collected := make([]collectedBranch, 0, len(results))
+	for _, res := range results {
+		if !res.passed {
+			continue
+		}
+		meta, data, err := res.msg.GetMetadataAndData()
+		if err != nil {
+			return fmt.Errorf("branch %d: %w", res.index, err)
+		}
+		var value any = string(data)
+		if json.Valid(data) {
+			value = json.RawMessage(data)
+		}
+		collected = append(collected, collectedBranch{Metadata: meta, Data: value})
+	}
+	out, err := json.Marshal(collected)
+	if err != nil {
+		return fmt.Errorf("failed to marshal collected branches: %w", err)
+	}
+	msg.SetData(out)
+	return nil
+}
+
+// runBranch applies the stages of a branch sequentially, honoring ifExpr and filterExpr
+func runBranch(msg *message.RunnerMessage, stages []branchStage) (*message.RunnerMessage, bool, error) {
+	for _, stage := range stages {
+		if stage.ifEval != nil {
+			pass, err := stage.ifEval.EvalMessage(msg)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to evaluate ifExpr: %w", err)
+			}
+			if !pass {
+				continue
+			}
+		}
+		if stage.runner != nil {
+			if err := stage.runner.Process(msg); isFiltered(err) {
+				return msg, false, nil
+			} else if err != nil {
+				return nil, false, err
+			}
+		}
+		if stage.filterEval != nil {
+			pass, err := stage.filterEval.EvalMessage(msg)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to evaluate filterExpr: %w", err)
+			}
+			if !pass {
+				return msg, false, nil
+			}
+		}
+	}
+	return msg, true, nil
+}
+
+// Close closes the runners of all branches
+func (r *branchRunner) Close() error {
+	var errs []error
+	for i, stages := range r.branches {
+		if err := closeStages(stages); err != nil {
+			errs = append(errs, fmt.Errorf("branch %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,217 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// funcRunner is a test runner backed by a function
+type funcRunner struct {
+	process func(*message.RunnerMessage) error
+	closed  bool
+}
+
+func (r *funcRunner) Process(msg *message.RunnerMessage) error {
+	return r.process(msg)
+}
+
+func (r *funcRunner) Close() error {
+	r.closed = true
+	return nil
+}
+
+func metadataRunner(key, value string) *funcRunner {
+	return &funcRunner{process: func(msg *message.RunnerMessage) error {
+		msg.AddMetadata(key, value)
+		return nil
+	}}
+}
+
+func dataRunner(data string, delay time.Duration) *funcRunner {
+	return &funcRunner{process: func(msg *message.RunnerMessage) error {
+		time.Sleep(delay)
+		msg.SetData([]byte(data))
+		return nil
+	}}
+}
+
+func newTestBranchRunner(join string, runners ...connectors.Runner) *branchRunner {
+	br := &branchRunner{join: join, logger: newTestLogger()}
+	for _, r := range runners {
+		br.branches = append(br.branches, []branchStage{{runner: r}})
+	}
+	return br
+}
+
+func TestBranchRunnerMerge(t *testing.T) {
+	br := newTestBranchRunner(joinMerge, metadataRunner("a", "1"), metadataRunner("b", "2"))
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"x":1}`), nil))
+
+	if err := br.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		t.Fatalf("GetMetadataAndData() unexpected error = %v", err)
+	}
+	if meta["a"] != "1" || meta["b"] != "2" {
+		t.Errorf("merged metadata = %v, want a=1 and b=2", meta)
+	}
+	if string(data) != `{"x":1}` {
+		t.Errorf("merge join changed data to %s", data)
+	}
+}
+
+func TestBranchRunnerFirst(t *testing.T) {
+	br := newTestBranchRunner(joinFirst, dataRunner("slow", 200*time.Millisecond), dataRunner("fast", 0))
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil))
+
+	if err := br.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+
+	data, _ := msg.GetData()
+	if string(data) != "fast" {
+		t.Errorf("first join data = %s, want fast", data)
+	}
+}
+
+func TestBranchRunnerFirstAllFailed(t *testing.T) {
+	failing := &funcRunner{process: func(*message.RunnerMessage) error { return errors.New("boom") }}
+	br := newTestBranchRunner(joinFirst, failing, failing)
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil))
+
+	if err := br.Process(msg); err == nil {
+		t.Fatal("Process() expected error when all branches fail")
+	}
+}
+
+func TestBranchRunnerCollect(t *testing.T) {
+	br := newTestBranchRunner(joinCollect, dataRunner(`{"service":"a"}`, 0), dataRunner("plain", 0))
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil))
+
+	if err := br.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+
+	data, _ := msg.GetData()
+	var collected []map[string]any
+	if err := json.Unmarshal(data, &collected); err != nil {
+		t.Fatalf("collect join produced invalid JSON %s: %v", data, err)
+	}
+	if len(collected) != 2 {
+		t.Fatalf("collect join produced %d items, want 2", len(collected))
+	}
+	first, ok := collected[0]["data"].(map[string]any)
+	if !ok || first["service"] != "a" {
+		t.Errorf("collected[0].data = %v, want embedded JSON object", collected[0]["data"])
+	}
+	if collected[1]["data"] != "plain" {
+		t.Errorf("collected[1].data = %v, want plain", collected[1]["data"])
+	}
+}
+
+func TestBranchRunnerError(t *testing.T) {
+	failing := &funcRunner{process: func(*message.RunnerMessage) error { return errors.New("boom") }}
+	br := newTestBranchRunner(joinMerge, metadataRunner("a", "1"), failing)
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil))
+
+	if err := br.Process(msg); err == nil {
+		t.Fatal("Process() expected error when a branch fails")
+	}
+}
+
+func TestBranchRunnerClose(t *testing.T) {
+	r1 := metadataRunner("a", "1")
+	r2 := metadataRunner("b", "2")
+	br := newTestBranchRunner(joinMerge, r1, r2)
+
+	if err := br.Close(); err != nil {
+		t.Fatalf("Close() unexpected error = %v", err)
+	}
+	if !r1.closed || !r2.closed {
+		t.Error("Close() did not close all branch runners")
+	}
+}
+
+func TestCreateBranchRunner(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+
+	runner, err := bridge.createRunner(connectors.RunnerConfig{
+		Type: "branch",
+		Options: map[string]any{"branches": []any{
+			[]any{map[string]any{"type": "pass"}},
+			[]any{map[string]any{"type": "pass", "filterExpr": `metadata.keep == "yes"`}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("createRunner() unexpected error = %v", err)
+	}
+	br, ok := runner.(*branchRunner)
+	if !ok {
+		t.Fatalf("createRunner() returned %T, want *branchRunner", runner)
+	}
+	if br.join != joinMerge {
+		t.Errorf("default join = %s, want %s", br.join, joinMerge)
+	}
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), map[string]string{"keep": "no"}))
+	if err := br.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+}
+
+func TestCreateBranchRunnerNoBranches(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+
+	if _, err := bridge.createRunner(connectors.RunnerConfig{Type: "branch"}); err == nil {
+		t.Fatal("createRunner() expected error for branch runner without branches")
+	}
+}
+
+func TestCreateBranchRunnerStrictOptions(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.StrictConfig = true
+	bridge := &EventsBridge{cfg: cfg, logger: newTestLogger()}
+	branches := []any{[]any{map[string]any{"type": "pass", "filterExpr": "true", "retry": map[string]any{"maxAttempts": 2}}}}
+
+	runner, err := bridge.createRunner(connectors.RunnerConfig{Type: "branch", Options: map[string]any{"branches": branches, "join": joinFirst}})
+	if err != nil {
+		t.Fatalf("createRunner() unexpected error = %v", err)
+	}
+	if err := runner.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+
+	_, err = bridge.createRunner(connectors.RunnerConfig{Type: "branch", Options: map[string]any{"branches": branches, "jion": joinFirst}})
+	if err == nil || !strings.Contains(err.Error(), `unknown option "jion"`) {
+		t.Errorf("createRunner() error = %v, want unknown option", err)
+	}
+}
+
+func TestCreateBranchRunnerNestedOptions(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+
+	for _, opt := range []map[string]any{
+		{"throttle": map[string]any{"rate": 10}},
+		{"payloadLimit": map[string]any{"maxSize": 1024}},
+		{"maxRetryAfter": "10s"},
+	} {
+		runner := map[string]any{"type": "pass"}
+		for k, v := range opt {
+			runner[k] = v
+		}
+		_, err := bridge.createRunner(connectors.RunnerConfig{Type: "branch", Options: map[string]any{"branches": []any{[]any{runner}}}})
+		if !errors.Is(err, errStageOptionsNested) {
+			t.Errorf("createRunner(%v) error = %v, want errStageOptionsNested", opt, err)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/destel/rill"
@@ -15,23 +17,56 @@ import (
 	"github.com/sandrolain/events-bridge/src/utils"
 )
 
+// ConnectorsDir is the directory of the connector plugins
+const ConnectorsDir = "./connectors"
+
 // connectorPath returns the path to a connector plugin
 func connectorPath(connectorType string) string {
-	return fmt.Sprintf("./connectors/%s.so", strings.ToLower(connectorType))
+	return fmt.Sprintf("%s/%s.so", ConnectorsDir, strings.ToLower(connectorType))
 }
 
 // RunnerItem holds a runner configuration and its instance
 type RunnerItem struct {
 	Config connectors.RunnerConfig
 	Runner connectors.Runner
+	// plan holds the expressions and built-in options parsed from Config
+	plan *runnerPlan
+}
+
+// runnerPlan holds the settings of a runner parsed once when the runner is created
+type runnerPlan struct {
+	ifEval     *expreval.ExprEvaluator
+	filterEval *expreval.ExprEvaluator
+	// batch and digest are the options of the batch and digest runners
+	batch  *batchRunnerConfig
+	digest *digester
 }
 
 // EventsBridge encapsulates the full events bridge lifecycle
 type EventsBridge struct {
-	cfg     *config.Config
-	logger  *slog.Logger
-	source  connectors.Source
-	runners []RunnerItem
+	cfg        *config.Config
+	logger     *slog.Logger
+	source     connectors.Source
+	middleware []middlewareItem
+	runners    []RunnerItem
+	slo        *sloMonitor
+	profiler   *stageProfiler
+	activity   *activityTracker
+	replyPlan  *replyPlan
+	deadLetter *deadLetter
+	workDir    *workDir
+	valve      *safetyValve
+	lineage    *lineageTracker
+
+	inFlight     atomic.Int64
+	draining     atomic.Bool
+	stopMu       sync.Mutex
+	stop         context.CancelFunc
+	sourceClosed atomic.Bool
+
+	metricsMu        sync.Mutex
+	removeBuffer     func()
+	removeConnectors []func()
 }
 
 // HandleSuccess acknowledges a message successfully and logs at info level
@@ -50,6 +85,7 @@ func (b *EventsBridge) HandleSuccess(msg *message.RunnerMessage, operation strin
 func (b *EventsBridge) HandleError(msg *message.RunnerMessage, err error, operation string, additionalFields ...any) {
 	logArgs := append([]any{"error", err}, additionalFields...)
 	b.logger.Error(operation, logArgs...)
+	b.activity.recordError(operation, err)
 	if msg == nil {
 		b.logger.Warn("cannot nak nil message in " + operation)
 		return
@@ -75,24 +111,71 @@ func NewEventsBridge(cfg *config.Config, logger *slog.Logger) (*EventsBridge, er
 	}
 
 	bridge := &EventsBridge{
-		cfg:     cfg,
-		logger:  logger,
-		runners: make([]RunnerItem, len(cfg.Runners)),
+		cfg:      cfg,
+		logger:   logger,
+		runners:  make([]RunnerItem, len(cfg.Runners)),
+		activity: newActivityTracker(),
+	}
+
+	if cfg.SLO != nil {
+		bridge.slo = newSLOMonitor(*cfg.SLO, logger)
+	}
+
+	bridge.valve = newSafetyValve(cfg.SafetyValve, cfg.Source.Type, logger)
+	bridge.lineage = newLineageTracker(cfg.Lineage)
+
+	if cfg.Profiling != nil {
+		bridge.profiler = newStageProfiler(*cfg.Profiling, cfg.Source.Type, logger)
 	}
 
 	if err := bridge.initializeSource(); err != nil {
 		return nil, fmt.Errorf("source init: %w", err)
 	}
 
+	if err := bridge.initializeMiddleware(); err != nil {
+		return nil, fmt.Errorf("middleware init: %w", err)
+	}
+
 	if err := bridge.initializeRunners(); err != nil {
 		return nil, fmt.Errorf("runners init: %w", err)
 	}
 
+	if err := bridge.initializeDeadLetter(); err != nil {
+		return nil, fmt.Errorf("dead-letter init: %w", err)
+	}
+
+	if cfg.Source.ReplyPlan != nil {
+		plan, err := newReplyPlan(*cfg.Source.ReplyPlan, len(bridge.runners), logger)
+		if err != nil {
+			return nil, fmt.Errorf("reply plan init: %w", err)
+		}
+		bridge.replyPlan = plan
+	}
+
+	// The work directory is created last, so that no directory is left when initialization fails
+	if cfg.WorkDir != nil {
+		wd, err := newWorkDir(*cfg.WorkDir, logger)
+		if err != nil {
+			return nil, fmt.Errorf("work directory init: %w", err)
+		}
+		bridge.workDir = wd
+	}
+
 	return bridge, nil
 }
 
-// initializeSource creates and configures the source connector
+// initializeSource creates and configures the source connector.
+// A list of sources is merged into a single multi source.
 func (b *EventsBridge) initializeSource() error {
+	if b.cfg.Source.Type == connectors.MultiSourceType {
+		source, err := b.createMultiSource(b.cfg.Sources)
+		if err != nil {
+			return fmt.Errorf("failed to create sources: %w", err)
+		}
+		b.source = source
+		return nil
+	}
+
 	b.logger.Info("creating source", "type", b.cfg.Source.Type, "buffer", b.cfg.Source.Buffer)
 
 	source, err := utils.LoadPluginAndConfig[connectors.Source](
@@ -100,6 +183,7 @@ func (b *EventsBridge) initializeSource() error {
 		connectors.NewSourceMethodName,
 		connectors.NewSourceConfigName,
 		b.cfg.Source.Options,
+		b.cfg.StrictConfig,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create source: %w", err)
@@ -109,8 +193,22 @@ func (b *EventsBridge) initializeSource() error {
 	return nil
 }
 
-// initializeRunners creates and configures all runner connectors
+// initializeRunners creates and configures all runner connectors.
+// A pipeline graph is run as a single runner stage.
 func (b *EventsBridge) initializeRunners() error {
+	if b.cfg.Pipeline != nil {
+		b.logger.Info("creating pipeline graph", "entry", b.cfg.Pipeline.Entry, "stages", len(b.cfg.Pipeline.Stages))
+		runner, err := b.createGraphRunner(*b.cfg.Pipeline)
+		if err != nil {
+			return fmt.Errorf("failed to create pipeline: %w", err)
+		}
+		b.runners = []RunnerItem{{
+			Config: connectors.RunnerConfig{Type: graphRunnerType},
+			Runner: runner,
+		}}
+		return nil
+	}
+
 	if len(b.cfg.Runners) == 0 {
 		b.logger.Info("no runner configured, messages will be passed through without processing")
 		return nil
@@ -121,59 +219,234 @@ func (b *EventsBridge) initializeRunners() error {
 	for i, runnerConfig := range b.cfg.Runners {
 		b.logger.Info("creating runner", "type", runnerConfig.Type)
 
-		var runner connectors.Runner
-		var err error
-
-		if runnerConfig.Type != "pass" {
-			runner, err = utils.LoadPluginAndConfig[connectors.Runner](
-				connectorPath(runnerConfig.Type),
-				connectors.NewRunnerMethodName,
-				connectors.NewRunnerConfigName,
-				runnerConfig.Options,
-			)
+		plan, err := b.planRunner(runnerConfig)
+		if err != nil {
+			return fmt.Errorf("failed to create runner %d: %w", i, err)
+		}
+		// The batches are accumulated and the digests collected by the pipeline itself
+		if runnerConfig.Type == batchRunnerType || runnerConfig.Type == digestRunnerType {
+			b.runners[i] = RunnerItem{Config: runnerConfig, plan: plan}
+			continue
+		}
+		// The duplicates are acked and dropped by the pipeline itself
+		if runnerConfig.Type == dedupRunnerType {
+			runner, err := b.createDedupRunner(runnerConfig)
 			if err != nil {
 				return fmt.Errorf("failed to create runner %d: %w", i, err)
 			}
+			b.runners[i] = RunnerItem{Config: runnerConfig, Runner: runner, plan: plan}
+			continue
+		}
+		runner, err := b.createRunner(runnerConfig)
+		if err != nil {
+			return fmt.Errorf("failed to create runner %d: %w", i, err)
 		}
 
 		b.runners[i] = RunnerItem{
 			Config: runnerConfig,
 			Runner: runner,
+			plan:   plan,
 		}
 	}
 
 	return nil
 }
 
+// planRunner parses the ifExpr and filterExpr of a runner, and the options of the batch
+// and digest runners, applied by the pipeline itself
+func (b *EventsBridge) planRunner(runnerConfig connectors.RunnerConfig) (*runnerPlan, error) {
+	plan := new(runnerPlan)
+	var err error
+	if plan.ifEval, err = expreval.NewExprEvaluator(runnerConfig.IfExpr); err != nil {
+		return nil, fmt.Errorf("invalid ifExpr: %w", err)
+	}
+	if plan.filterEval, err = expreval.NewExprEvaluator(runnerConfig.FilterExpr); err != nil {
+		return nil, fmt.Errorf("invalid filterExpr: %w", err)
+	}
+	switch runnerConfig.Type {
+	case batchRunnerType:
+		plan.batch = new(batchRunnerConfig)
+		if err := b.parseRunnerOptions(runnerConfig, plan.batch); err != nil {
+			return nil, err
+		}
+	case digestRunnerType:
+		if plan.digest, err = b.createDigester(runnerConfig); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// planRunners plans the runners created without a plan, e.g. by the tests
+func (b *EventsBridge) planRunners() error {
+	for i := range b.runners {
+		if b.runners[i].plan != nil {
+			continue
+		}
+		plan, err := b.planRunner(b.runners[i].Config)
+		if err != nil {
+			return fmt.Errorf("failed to create runner %d: %w", i, err)
+		}
+		b.runners[i].plan = plan
+	}
+	return nil
+}
+
+// createRunner instantiates a runner from its configuration, wrapped with its retry policy
+func (b *EventsBridge) createRunner(runnerConfig connectors.RunnerConfig) (connectors.Runner, error) {
+	runner, err := b.loadRunner(runnerConfig)
+	if err != nil || runner == nil || runnerConfig.Retry == nil {
+		return runner, err
+	}
+	rr, err := b.newRetryRunner(runner, *runnerConfig.Retry)
+	if err != nil {
+		runner.Close() //nolint:errcheck
+		return nil, err
+	}
+	return rr, nil
+}
+
+// loadRunner instantiates a runner from its configuration.
+// Built-in types are handled by the bridge, every other type is loaded as a connector plugin.
+func (b *EventsBridge) loadRunner(runnerConfig connectors.RunnerConfig) (connectors.Runner, error) {
+	switch runnerConfig.Type {
+	case "pass":
+		return nil, nil
+	case "branch":
+		return b.createBranchRunner(runnerConfig)
+	case "split":
+		return b.createSplitRunner(runnerConfig)
+	case "group":
+		return b.createGroupRunner(runnerConfig)
+	case "fsdiff":
+		return b.createFSDiffRunner(runnerConfig)
+	case "tenant":
+		return b.createTenantRunner(runnerConfig)
+	case "budget":
+		return b.createBudgetRunner(runnerConfig)
+	case partsRunnerType:
+		return b.createPartsRunner(runnerConfig)
+	case filterRunnerType:
+		return b.createFilterRunner(runnerConfig)
+	case batchRunnerType:
+		return nil, errBatchNested
+	case digestRunnerType:
+		return nil, errDigestNested
+	case dedupRunnerType:
+		return nil, errDedupNested
+	}
+
+	return utils.LoadPluginAndConfig[connectors.Runner](
+		connectorPath(runnerConfig.Type),
+		connectors.NewRunnerMethodName,
+		connectors.NewRunnerConfigName,
+		runnerConfig.Options,
+		b.cfg.StrictConfig,
+	)
+}
+
+// parseRunnerOptions decodes the options of a built-in runner type into cfg, rejecting the
+// unknown options in strict mode as for the connector plugins
+func (b *EventsBridge) parseRunnerOptions(runnerConfig connectors.RunnerConfig, cfg any) error {
+	parse := utils.ParseConfig
+	if b.cfg.StrictConfig {
+		parse = utils.ParseConfigStrict
+	}
+	if err := parse(runnerConfig.Options, cfg); err != nil {
+		return fmt.Errorf("invalid %s options: %w", runnerConfig.Type, err)
+	}
+	return nil
+}
+
 // Run starts the event bridge and processes messages until context is cancelled
 func (b *EventsBridge) Run(ctx context.Context) error {
-	// Start message production from source
-	c, err := b.source.Produce(b.cfg.Source.Buffer)
+	done, err := b.Start(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to produce messages from source: %w", err)
+		return err
 	}
+	return <-done
+}
 
-	out := rill.FromChan(c, nil)
-	defer rill.Drain(out)
+// Start starts message production and the runner pipeline without blocking.
+// The returned channel receives the pipeline result once it terminates, which happens
+// when the source stops producing, the context is cancelled or the bridge is drained.
+func (b *EventsBridge) Start(ctx context.Context) (<-chan error, error) {
+	// Prepare the runners before the first message
+	if err := b.planRunners(); err != nil {
+		return nil, err
+	}
+	if err := b.startRunners(ctx); err != nil {
+		return nil, err
+	}
+
+	// Start message production from source; the goroutines started by the source inherit its labels
+	var c <-chan *message.RunnerMessage
+	var err error
+	b.profiler.Stage(stageSource, b.cfg.Source.Type)(func() {
+		c, err = b.source.Produce(b.cfg.Source.Buffer)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to produce messages from source: %w", err)
+	}
+	b.observeBuffer(c)
+	b.observeConnectors()
+
+	ctx, stop := context.WithCancel(ctx)
+	b.stopMu.Lock()
+	b.stop = stop
+	b.stopMu.Unlock()
+
+	out := rill.FromChan(b.track(ctx, c), nil)
+
+	if b.slo != nil {
+		go b.slo.Run(ctx)
+	}
+
+	if b.profiler != nil {
+		go b.profiler.Run(ctx)
+	}
+
+	if b.workDir != nil {
+		go b.workDir.Run(ctx)
+	}
+
+	go b.valve.Run(ctx)
+
+	// Apply the inbound middleware chain of the source
+	if len(b.middleware) > 0 {
+		out = b.applyMiddleware(ctx, out)
+	}
+
+	// Reply to the source once the message is accepted, if planned
+	if b.replyPlan.at(0) {
+		out = b.replyAt(out)
+	}
 
 	// Apply runner pipeline if configured
 	if len(b.runners) > 0 {
 		b.logger.Info("runner starting to consume messages from source")
-		out = b.applyRunners(out)
+		out = b.applyRunners(ctx, out)
 	} else {
 		b.logger.Info("no runner configured, passing messages through without processing")
 	}
 
-	return b.ackSource(out)
+	done := make(chan error, 1)
+	go func() {
+		defer rill.Drain(out)
+		done <- b.ackSource(out)
+	}()
+	return done, nil
 }
 
 // processRunnerMessage processes a single message with the given runner and evaluators
 func (b *EventsBridge) processRunnerMessage(
+	stage string,
 	msg *message.RunnerMessage,
 	runner connectors.Runner,
 	cfg connectors.RunnerConfig,
 	ifEval *expreval.ExprEvaluator,
 	filterEval *expreval.ExprEvaluator,
+	gate *retryGate,
 ) (*message.RunnerMessage, bool, error) {
 	// Evaluate if condition
 	if ifEval != nil {
@@ -183,14 +456,43 @@ func (b *EventsBridge) processRunnerMessage(
 		}
 		if !pass {
 			b.logger.Debug("ifExpr evaluated to false, skipping runner processing", "ifExpr", cfg.IfExpr)
+			runnerMessages.With(stage, cfg.Type, resultSkipped).Inc()
 			return msg, true, nil
 		}
 	}
 
+	span := traceRunner(msg, stage, cfg.Type)
+	defer span.End()
+
 	// Process message with runner
 	if runner != nil {
-		if err := runner.Process(msg); err != nil {
-			return b.HandleRunnerError(msg, err, "error processing message")
+		// The pipeline graph records the lineage of its own stages
+		var before lineageSnapshot
+		if _, isGraph := runner.(*graphRunner); !isGraph {
+			before = b.lineage.snapshot(msg)
+		}
+		start := time.Now()
+		err := runner.Process(msg)
+		runnerDuration.With(stage, cfg.Type).Observe(time.Since(start).Seconds())
+		b.valve.record(err != nil && !isFiltered(err))
+		if isFiltered(err) {
+			span.SetAttribute("eb.result", resultFiltered)
+			runnerMessages.With(stage, cfg.Type, resultFiltered).Inc()
+			b.HandleSuccess(msg, "message filtered out by filter runner", "runner", cfg.Type)
+			return nil, false, nil
+		}
+		if err != nil {
+			span.SetError(err)
+			runnerMessages.With(stage, cfg.Type, resultError).Inc()
+			// The upstream asked to slow down: the runner is paused for the following messages
+			if delay, ok := gate.observe(err); ok {
+				b.logger.Warn("runner paused on the retry-after hint of the upstream", "runner", cfg.Type, "delay", delay)
+			}
+			msg.AttachError(message.NewErrorRecord(stage, err))
+			return b.handleRunnerFailure(msg, err)
+		}
+		if before != nil {
+			b.lineage.record(msg, stage, before)
 		}
 	}
 
@@ -201,38 +503,72 @@ func (b *EventsBridge) processRunnerMessage(
 			return b.HandleRunnerError(msg, err, "failed to evaluate filterExpr, skipping message", "filterExpr", cfg.FilterExpr)
 		}
 		if !pass {
+			span.SetAttribute("eb.result", resultFiltered)
+			runnerMessages.With(stage, cfg.Type, resultFiltered).Inc()
 			b.HandleSuccess(msg, "message filtered out by filterExpr", "filterExpr", cfg.FilterExpr)
 			return nil, false, nil
 		}
 	}
 
+	runnerMessages.With(stage, cfg.Type, resultOK).Inc()
 	return msg, true, nil
 }
 
 // applyRunners applies all configured runners to the message stream
-func (b *EventsBridge) applyRunners(stream rill.Stream[*message.RunnerMessage]) rill.Stream[*message.RunnerMessage] {
+func (b *EventsBridge) applyRunners(ctx context.Context, stream rill.Stream[*message.RunnerMessage]) rill.Stream[*message.RunnerMessage] {
 	out := stream
 
 	for i, runnerItem := range b.runners {
 		runner := runnerItem.Runner
 		cfg := runnerItem.Config
 		routines := min(cfg.Routines, 1)
+		ifEval, filterEval := runnerItem.plan.ifEval, runnerItem.plan.filterEval
 
-		ifEval, err := expreval.NewExprEvaluator(cfg.IfExpr)
-		if err != nil {
-			b.logger.Error("failed to create ifExpr evaluator", "runner", i, "error", err)
+		if cfg.Type == batchRunnerType {
+			out = b.batchMessages(out, *runnerItem.plan.batch, cfg.IfExpr, ifEval)
+			if b.replyPlan.at(i + 1) {
+				out = b.replyAt(out)
+			}
 			continue
 		}
-
-		filterEval, err := expreval.NewExprEvaluator(cfg.FilterExpr)
-		if err != nil {
-			b.logger.Error("failed to create filterExpr evaluator", "runner", i, "error", err)
+		if cfg.Type == digestRunnerType {
+			out = b.digestMessages(out, runnerItem.plan.digest, cfg, ifEval, filterEval)
+			if b.replyPlan.at(i + 1) {
+				out = b.replyAt(out)
+			}
 			continue
 		}
 
-		out = rill.OrderedFilterMap(out, routines, func(msg *message.RunnerMessage) (*message.RunnerMessage, bool, error) {
-			return b.processRunnerMessage(msg, runner, cfg, ifEval, filterEval)
+		if limit := b.payloadLimit(cfg); limit != nil {
+			out = b.limitPayloads(out, routines, *limit)
+		}
+
+		name := runnerStage(i)
+		if cfg.Throttle != nil {
+			out = b.throttleMessages(ctx, out, routines, name, cfg)
+		}
+		if dedup, ok := runner.(*dedupRunner); ok {
+			out = b.dedupMessages(out, routines, name, cfg, dedup, ifEval)
+			if b.replyPlan.at(i + 1) {
+				out = b.replyAt(out)
+			}
+			continue
+		}
+		stage := b.stage(name, cfg.Type)
+		gate := newRetryGate(cfg.MaxRetryAfter)
+		out = rill.OrderedFilterMap(out, routines, func(msg *message.RunnerMessage) (res *message.RunnerMessage, ok bool, err error) {
+			if err := gate.wait(ctx); err != nil {
+				return b.HandleRunnerError(msg, err, "runner pause interrupted")
+			}
+			stage(func() {
+				res, ok, err = b.processRunnerMessage(name, msg, runner, cfg, ifEval, filterEval, gate)
+			})
+			return res, ok, err
 		})
+
+		if b.replyPlan.at(i + 1) {
+			out = b.replyAt(out)
+		}
 	}
 
 	return out
@@ -240,25 +576,60 @@ func (b *EventsBridge) applyRunners(stream rill.Stream[*message.RunnerMessage])
 
 // ackSource acknowledges messages back to the source
 func (b *EventsBridge) ackSource(stream rill.Stream[*message.RunnerMessage]) error {
+	stage := b.stage(stageAck, b.cfg.Source.Type)
 	return rill.ForEach(stream, 1, func(msg *message.RunnerMessage) error {
-		if err := msg.AckSource(b.cfg.Source.Reply); err != nil {
+		var err error
+		stage(func() {
+			if b.replyPlan != nil {
+				err = b.replyPlan.respond(msg)
+			} else {
+				err = msg.AckSource(b.cfg.Source.Reply)
+			}
+		})
+		if err != nil {
 			b.HandleError(msg, err, "failed to ack message", "reply", b.cfg.Source.Reply)
+			return nil
+		}
+		if b.slo != nil {
+			b.slo.Observe(msg.GetIngressTime())
 		}
 		return nil
 	})
 }
 
+// LatencySnapshot returns the current end-to-end latency percentiles.
+// It returns false when no SLO is configured.
+func (b *EventsBridge) LatencySnapshot() (LatencySnapshot, bool) {
+	if b.slo == nil {
+		return LatencySnapshot{}, false
+	}
+	return b.slo.tracker.Snapshot(), true
+}
+
+// Activity returns the live activity of the pipeline stages and the recent errors
+func (b *EventsBridge) Activity() ([]StageActivity, []ErrorRecord) {
+	return b.activity.snapshot()
+}
+
+// StageProfile returns the most recent per-stage profiling report, or nil
+func (b *EventsBridge) StageProfile() *StageProfile {
+	return b.profiler.Last()
+}
+
 // Close closes all connectors with retry logic
 func (b *EventsBridge) Close() error {
 	var closeErrors []error
+	b.closeMetrics()
 
-	// Close source
-	if b.source != nil {
+	// Close source, unless already closed by Drain
+	if b.source != nil && !b.sourceClosed.Load() {
 		if err := closeWithRetry(b.source.Close, 3, time.Second); err != nil {
 			closeErrors = append(closeErrors, fmt.Errorf("failed to close source: %w", err))
 		}
 	}
 
+	closeErrors = append(closeErrors, b.closeMiddleware()...)
+
 	// Close all runners
 	for i, runnerItem := range b.runners {
 		if runnerItem.Runner != nil {
@@ -268,6 +639,18 @@ func (b *EventsBridge) Close() error {
 		}
 	}
 
+	if b.deadLetter != nil {
+		if err := closeWithRetry(b.deadLetter.runner.Close, 3, time.Second); err != nil {
+			closeErrors = append(closeErrors, fmt.Errorf("failed to close dead-letter target: %w", err))
+		}
+	}
+
+	if b.workDir != nil {
+		if err := b.workDir.close(); err != nil {
+			closeErrors = append(closeErrors, fmt.Errorf("failed to remove work directory: %w", err))
+		}
+	}
+
 	// Log all errors
 	for _, err := range closeErrors {
 		b.logger.Error("close error", "error", err)
@@ -0,0 +1,421 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	budgetPrimary  = "primary"
+	budgetCheap    = "cheap"
+	budgetDeferred = "deferred"
+
+	budgetOverCheap  = "cheap"
+	budgetOverDefer  = "defer"
+	budgetOverReject = "reject"
+
+	defaultBudgetCostKey       = "eb-cost"
+	defaultBudgetPathKey       = "eb-budget-path"
+	defaultBudgetPeriod        = time.Hour
+	defaultBudgetCharsPerToken = 4
+)
+
+// errBudgetClosed fails the messages still deferred when the runner is drained or closed,
+// so that they are redelivered instead of holding the shutdown
+var errBudgetClosed = errors.New("budget runner closed while deferring message")
+
+// Ensure budgetRunner implements connectors.LifecycleRunner
+var _ connectors.LifecycleRunner = (*budgetRunner)(nil)
+
+// budgetRunner estimates the processing cost of every message and routes the messages over
+// budget to the cheap runner chain, or holds them until an off-peak window
+type budgetRunner struct {
+	primary  []branchStage
+	cheap    []branchStage
+	cfg      budgetRunnerConfig
+	offPeak  []budgetWindow
+	loc      *time.Location
+	now      func() time.Time
+	costKey  string
+	pathKey  string
+	logger   *slog.Logger
+	done     chan struct{}
+	doneOnce sync.Once
+
+	mu          sync.Mutex
+	windowStart time.Time
+	spent       float64
+}
+
+// budgetWindow is a daily off-peak window, in minutes from midnight.
+// A window ending before its start spans midnight.
+type budgetWindow struct {
+	start int
+	end   int
+}
+
+// contains reports whether the minute of the day is inside the window
+func (w budgetWindow) contains(minute int) bool {
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// budgetRunnerConfig holds the options of the budget runner
+type budgetRunnerConfig struct {
+	// Primary is the runner chain of the messages within budget (empty = pass through)
+	Primary []connectors.RunnerConfig `mapstructure:"primary" validate:"dive"`
+	// Cheap is the runner chain of the messages over budget (empty = pass through)
+	Cheap []connectors.RunnerConfig `mapstructure:"cheap" validate:"dive"`
+	// Base is the fixed cost of every message
+	Base float64 `mapstructure:"base" validate:"min=0"`
+	// PerKB is the cost of every KiB of payload
+	PerKB float64 `mapstructure:"perKB" validate:"min=0"`
+	// PerToken is the cost of every estimated LLM token of the payload
+	PerToken float64 `mapstructure:"perToken" validate:"min=0"`
+	// CharsPerToken is the number of characters of an estimated token (default: 4)
+	CharsPerToken float64 `mapstructure:"charsPerToken" validate:"min=0"`
+	// Weights add a cost to the messages with matching metadata
+	Weights []budgetWeightConfig `mapstructure:"weights" validate:"dive"`
+	// CostFrom is a metadata key holding the cost of the message, used instead of the estimate when set
+	CostFrom string `mapstructure:"costFrom"`
+	// MaxCost is the budget of a single message (0 = unlimited)
+	MaxCost float64 `mapstructure:"maxCost" validate:"min=0"`
+	// Limit is the total cost of the messages admitted to the primary chain in every Period (0 = unlimited)
+	Limit float64 `mapstructure:"limit" validate:"min=0"`
+	// Period is the window of Limit, aligned to the clock (default: 1h)
+	Period time.Duration `mapstructure:"period" validate:"min=0"`
+	// OverBudget is applied to the messages over budget: "cheap" (default, run the cheap chain),
+	// "defer" (hold the message until the next off-peak window, then run the primary chain)
+	// or "reject" (the message fails)
+	OverBudget string `mapstructure:"overBudget" validate:"omitempty,oneof=cheap defer reject"`
+	// OffPeak are daily windows as "HH:MM-HH:MM" in which the budget is not enforced
+	OffPeak []string `mapstructure:"offPeak" validate:"required_if=OverBudget defer"`
+	// Timezone is the IANA time zone of the off-peak windows (default: local time)
+	Timezone string `mapstructure:"timezone"`
+	// MaxDefer bounds the hold of a deferred message, after which it runs the cheap chain (0 = unlimited)
+	MaxDefer time.Duration `mapstructure:"maxDefer" validate:"min=0"`
+	// CostKey is the metadata key set to the estimated cost (default: "eb-cost")
+	CostKey string `mapstructure:"costKey"`
+	// PathKey is the metadata key set to "primary", "cheap" or "deferred" (default: "eb-budget-path")
+	PathKey string `mapstructure:"pathKey"`
+}
+
+// budgetWeightConfig adds a cost to the messages whose metadata Key has the given Value
+type budgetWeightConfig struct {
+	// Key is the metadata key
+	Key string `mapstructure:"key" validate:"required"`
+	// Value is the matched value (empty = any message with the key)
+	Value string `mapstructure:"value"`
+	// Cost is the added cost
+	Cost float64 `mapstructure:"cost"`
+}
+
+// createBudgetRunner builds the runner chains of a "budget" runner configuration
+func (b *EventsBridge) createBudgetRunner(runnerConfig connectors.RunnerConfig) (connectors.Runner, error) {
+	cfg := new(budgetRunnerConfig)
+	if err := b.parseRunnerOptions(runnerConfig, cfg); err != nil {
+		return nil, err
+	}
+	br, err := newBudgetRunner(*cfg, b.logger.With("component", "budget"))
+	if err != nil {
+		return nil, err
+	}
+
+	if br.primary, err = b.createStages(br.cfg.Primary); err != nil {
+		return nil, fmt.Errorf("primary chain: %w", err)
+	}
+	if br.cheap, err = b.createStages(br.cfg.Cheap); err != nil {
+		closeStages(br.primary) //nolint:errcheck
+		return nil, fmt.Errorf("cheap chain: %w", err)
+	}
+	return br, nil
+}
+
+// newBudgetRunner validates the configuration and applies its defaults, without the chains
+func newBudgetRunner(cfg budgetRunnerConfig, logger *slog.Logger) (*budgetRunner, error) {
+	if cfg.OverBudget == "" {
+		cfg.OverBudget = budgetOverCheap
+	}
+	if cfg.Period == 0 {
+		cfg.Period = defaultBudgetPeriod
+	}
+	if cfg.CharsPerToken == 0 {
+		cfg.CharsPerToken = defaultBudgetCharsPerToken
+	}
+	if cfg.OverBudget == budgetOverDefer && len(cfg.OffPeak) == 0 {
+		return nil, fmt.Errorf("budget overBudget defer requires offPeak windows")
+	}
+
+	br := &budgetRunner{
+		cfg:     cfg,
+		loc:     time.Local,
+		now:     time.Now,
+		costKey: cfg.CostKey,
+		pathKey: cfg.PathKey,
+		logger:  logger,
+		done:    make(chan struct{}),
+	}
+	if br.costKey == "" {
+		br.costKey = defaultBudgetCostKey
+	}
+	if br.pathKey == "" {
+		br.pathKey = defaultBudgetPathKey
+	}
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid budget timezone: %w", err)
+		}
+		br.loc = loc
+	}
+	for _, spec := range cfg.OffPeak {
+		w, err := parseBudgetWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		br.offPeak = append(br.offPeak, w)
+	}
+	return br, nil
+}
+
+// parseBudgetWindow parses a "HH:MM-HH:MM" window
+func parseBudgetWindow(spec string) (budgetWindow, error) {
+	var sh, sm, eh, em int
+	if n, err := fmt.Sscanf(spec, "%d:%d-%d:%d", &sh, &sm, &eh, &em); err != nil || n != 4 {
+		return budgetWindow{}, fmt.Errorf("invalid off-peak window %q: expected HH:MM-HH:MM", spec)
+	}
+	for _, v := range [][2]int{{sh, sm}, {eh, em}} {
+		if v[0] < 0 || v[0] > 24 || v[1] < 0 || v[1] > 59 || (v[0] == 24 && v[1] != 0) {
+			return budgetWindow{}, fmt.Errorf("invalid off-peak window %q: time out of range", spec)
+		}
+	}
+	w := budgetWindow{start: sh*60 + sm, end: (eh*60 + em) % (24 * 60)}
+	if w.start == w.end {
+		return budgetWindow{}, fmt.Errorf("invalid off-peak window %q: empty window", spec)
+	}
+	return w, nil
+}
+
+// Process estimates the cost of the message, tags it and runs it through the selected chain.
+// A filterExpr evaluating to false inside a chain skips the rest of that chain.
+func (r *budgetRunner) Process(msg *message.RunnerMessage) error {
+	cost, err := r.estimate(msg)
+	if err != nil {
+		return err
+	}
+	msg.AddMetadata(r.costKey, strconv.FormatFloat(cost, 'f', -1, 64))
+
+	path, err := r.route(cost)
+	if err != nil {
+		return err
+	}
+	if path == budgetDeferred {
+		if path, err = r.hold(); err != nil {
+			return err
+		}
+	}
+	r.logger.Debug("message routed", "path", path, "cost", cost)
+	msg.AddMetadata(r.pathKey, path)
+
+	stages := r.primary
+	if path == budgetCheap {
+		stages = r.cheap
+	}
+	if _, _, err := runBranch(msg, stages); err != nil {
+		return fmt.Errorf("%s chain: %w", path, err)
+	}
+	return nil
+}
+
+// estimate returns the cost set in the CostFrom metadata, or the cost estimated from the
+// payload size, its token count and the metadata weights
+func (r *budgetRunner) estimate(msg *message.RunnerMessage) (float64, error) {
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get metadata: %w", err)
+	}
+	if v := meta[r.cfg.CostFrom]; r.cfg.CostFrom != "" && v != "" {
+		cost, err := strconv.ParseFloat(v, 64)
+		if err != nil || cost < 0 || math.IsNaN(cost) {
+			return 0, fmt.Errorf("invalid cost %q in metadata %s", v, r.cfg.CostFrom)
+		}
+		return cost, nil
+	}
+
+	data, err := msg.GetData()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get data: %w", err)
+	}
+	cost := r.cfg.Base + r.cfg.PerKB*float64(len(data))/1024
+	if r.cfg.PerToken > 0 {
+		tokens := math.Ceil(float64(utf8.RuneCount(data)) / r.cfg.CharsPerToken)
+		cost += r.cfg.PerToken * tokens
+	}
+	for _, w := range r.cfg.Weights {
+		if v, ok := meta[w.Key]; ok && (w.Value == "" || v == w.Value) {
+			cost += w.Cost
+		}
+	}
+	return cost, nil
+}
+
+// route selects the path of a message: the budget is not enforced in the off-peak windows,
+// otherwise the message must fit both the per-message and the per-period budget
+func (r *budgetRunner) route(cost float64) (string, error) {
+	now := r.now()
+	if r.inOffPeak(now) {
+		return budgetPrimary, nil
+	}
+	if r.admit(cost, now) {
+		return budgetPrimary, nil
+	}
+
+	switch r.cfg.OverBudget {
+	case budgetOverDefer:
+		return budgetDeferred, nil
+	case budgetOverReject:
+		return "", fmt.Errorf("message cost %v exceeds the budget", cost)
+	default:
+		return budgetCheap, nil
+	}
+}
+
+// admit charges the cost to the budget of the current period, when it fits
+func (r *budgetRunner) admit(cost float64, now time.Time) bool {
+	if r.cfg.MaxCost > 0 && cost > r.cfg.MaxCost {
+		return false
+	}
+	if r.cfg.Limit == 0 {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if start := now.Truncate(r.cfg.Period); !start.Equal(r.windowStart) {
+		r.windowStart = start
+		r.spent = 0
+	}
+	if r.spent+cost > r.cfg.Limit {
+		return false
+	}
+	r.spent += cost
+	return true
+}
+
+// hold waits for the next off-peak window, returning the path of the deferred message:
+// the primary chain once the window opens, the cheap chain when MaxDefer elapses first
+func (r *budgetRunner) hold() (string, error) {
+	wait := r.nextOffPeak(r.now())
+	path := budgetDeferred
+	if r.cfg.MaxDefer > 0 && r.cfg.MaxDefer < wait {
+		wait, path = r.cfg.MaxDefer, budgetCheap
+	}
+	r.logger.Debug("message deferred", "wait", wait)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return path, nil
+	case <-r.done:
+		return "", errBudgetClosed
+	}
+}
+
+// inOffPeak reports whether the time is inside an off-peak window
+func (r *budgetRunner) inOffPeak(t time.Time) bool {
+	t = t.In(r.loc)
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range r.offPeak {
+		if w.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOffPeak returns the time until the start of the next off-peak window
+func (r *budgetRunner) nextOffPeak(t time.Time) time.Duration {
+	t = t.In(r.loc)
+	var next time.Time
+	for _, w := range r.offPeak {
+		start := time.Date(t.Year(), t.Month(), t.Day(), w.start/60, w.start%60, 0, 0, r.loc)
+		if !start.After(t) {
+			start = start.AddDate(0, 0, 1)
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next.Sub(t)
+}
+
+// release fails the deferred messages
+func (r *budgetRunner) release() {
+	r.doneOnce.Do(func() { close(r.done) })
+}
+
+// Start calls the Start hook of the chain runners implementing connectors.LifecycleRunner
+func (r *budgetRunner) Start(ctx context.Context) error {
+	for path, stages := range r.chains() {
+		for j, stage := range stages {
+			if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+				if err := lr.Start(ctx); err != nil {
+					return fmt.Errorf("failed to start runner %d of %s chain: %w", j, path, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Drain releases the deferred messages and calls the Drain hook of the chain runners
+// implementing connectors.LifecycleRunner
+func (r *budgetRunner) Drain(ctx context.Context) error {
+	r.release()
+	var errs []error
+	for path, stages := range r.chains() {
+		for j, stage := range stages {
+			if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+				if err := lr.Drain(ctx); err != nil {
+					errs = append(errs, fmt.Errorf("failed to drain runner %d of %s chain: %w", j, path, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close releases the deferred messages and closes the runners of both chains
+func (r *budgetRunner) Close() error {
+	r.release()
+	var errs []error
+	for path, stages := range r.chains() {
+		if err := closeStages(stages); err != nil {
+			errs = append(errs, fmt.Errorf("%s chain: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// chains iterates the chains in order
+func (r *budgetRunner) chains() iter.Seq2[string, []branchStage] {
+	return func(yield func(string, []branchStage) bool) {
+		if yield(budgetPrimary, r.primary) {
+			yield(budgetCheap, r.cheap)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package bridge
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func newTestBudgetRunner(t *testing.T, cfg budgetRunnerConfig, now time.Time) *budgetRunner {
+	t.Helper()
+	br, err := newBudgetRunner(cfg, newTestLogger())
+	if err != nil {
+		t.Fatalf("newBudgetRunner() unexpected error = %v", err)
+	}
+	br.loc = time.UTC
+	br.now = func() time.Time { return now }
+	br.primary = []branchStage{{runner: metadataRunner("model", budgetPrimary)}}
+	br.cheap = []branchStage{{runner: metadataRunner("model", budgetCheap)}}
+	return br
+}
+
+// budgetPath processes a message and returns its metadata
+func budgetPath(t *testing.T, br *budgetRunner, data string, meta map[string]string) map[string]string {
+	t.Helper()
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(data), meta))
+	if err := br.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	out, err := msg.GetMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestBudgetRunnerEstimate(t *testing.T) {
+	br := newTestBudgetRunner(t, budgetRunnerConfig{
+		Base:     1,
+		PerKB:    2,
+		PerToken: 0.5,
+		Weights: []budgetWeightConfig{
+			{Key: "priority", Value: "high", Cost: 10},
+			{Key: "attachment", Cost: 3},
+		},
+		CostFrom: "cost",
+	}, time.Now())
+
+	cases := []struct {
+		data string
+		meta map[string]string
+		want string
+	}{
+		// 1 + 2*1 + 0.5*256 tokens
+		{strings.Repeat("a", 1024), nil, "131"},
+		// 5 runes are 2 tokens
+		{"héllo", map[string]string{"priority": "high", "attachment": ""}, "15.01171875"},
+		{"héllo", map[string]string{"priority": "low", "cost": "7.5"}, "7.5"},
+	}
+	for _, tc := range cases {
+		meta := budgetPath(t, br, tc.data, tc.meta)
+		if meta[defaultBudgetCostKey] != tc.want {
+			t.Errorf("cost of %.10q = %s, want %s", tc.data, meta[defaultBudgetCostKey], tc.want)
+		}
+	}
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("x"), map[string]string{"cost": "many"}))
+	if err := br.Process(msg); err == nil {
+		t.Error("invalid cost metadata: expected error")
+	}
+}
+
+func TestBudgetRunnerLimit(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 15, 0, 0, time.UTC)
+	br := newTestBudgetRunner(t, budgetRunnerConfig{
+		CostFrom: "cost",
+		MaxCost:  50,
+		Limit:    100,
+	}, now)
+	route := func(cost string) string {
+		meta := budgetPath(t, br, "in", map[string]string{"cost": cost})
+		if meta["model"] != meta[defaultBudgetPathKey] {
+			t.Errorf("message tagged %q but processed by the %q chain", meta[defaultBudgetPathKey], meta["model"])
+		}
+		return meta[defaultBudgetPathKey]
+	}
+
+	for i, tc := range []struct{ cost, want string }{
+		{"60", budgetCheap}, // over the per-message budget
+		{"40", budgetPrimary},
+		{"40", budgetPrimary},
+		{"30", budgetCheap}, // over the period budget
+		{"20", budgetPrimary},
+		{"1", budgetCheap},
+	} {
+		if got := route(tc.cost); got != tc.want {
+			t.Errorf("message %d (cost %s) routed to %s, want %s", i, tc.cost, got, tc.want)
+		}
+	}
+
+	// The budget is renewed in the next period
+	br.now = func() time.Time { return now.Add(time.Hour) }
+	if got := route("40"); got != budgetPrimary {
+		t.Errorf("next period routed to %s", got)
+	}
+
+	br.cfg.OverBudget = budgetOverReject
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), map[string]string{"cost": "70"}))
+	if err := br.Process(msg); err == nil {
+		t.Error("reject: expected error")
+	}
+}
+
+func TestBudgetRunnerOffPeak(t *testing.T) {
+	peak := time.Date(2026, 3, 2, 21, 59, 59, 900e6, time.UTC)
+	br := newTestBudgetRunner(t, budgetRunnerConfig{
+		CostFrom:   "cost",
+		MaxCost:    10,
+		OverBudget: budgetOverDefer,
+		OffPeak:    []string{"22:00-06:00", "12:30-13:30"},
+	}, peak)
+
+	for _, tc := range []struct {
+		at   time.Time
+		in   bool
+		wait time.Duration
+	}{
+		{time.Date(2026, 3, 2, 23, 0, 0, 0, time.UTC), true, 0},
+		{time.Date(2026, 3, 3, 5, 59, 0, 0, time.UTC), true, 0},
+		{time.Date(2026, 3, 3, 6, 0, 0, 0, time.UTC), false, 6*time.Hour + 30*time.Minute},
+		{time.Date(2026, 3, 3, 14, 0, 0, 0, time.UTC), false, 8 * time.Hour},
+	} {
+		if got := br.inOffPeak(tc.at); got != tc.in {
+			t.Errorf("inOffPeak(%v) = %v", tc.at, got)
+		}
+		if !tc.in {
+			if got := br.nextOffPeak(tc.at); got != tc.wait {
+				t.Errorf("nextOffPeak(%v) = %v, want %v", tc.at, got, tc.wait)
+			}
+		}
+	}
+
+	// Over budget messages wait for the off-peak window, then run the primary chain
+	start := time.Now()
+	meta := budgetPath(t, br, "in", map[string]string{"cost": "20"})
+	if meta[defaultBudgetPathKey] != budgetDeferred || meta["model"] != budgetPrimary {
+		t.Errorf("deferred message metadata = %v", meta)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("deferred message not held, elapsed %v", elapsed)
+	}
+
+	// Within the window the budget is not enforced
+	br.now = func() time.Time { return peak.Add(time.Hour) }
+	if meta := budgetPath(t, br, "in", map[string]string{"cost": "20"}); meta[defaultBudgetPathKey] != budgetPrimary {
+		t.Errorf("off-peak message routed to %s", meta[defaultBudgetPathKey])
+	}
+
+	// MaxDefer falls back to the cheap chain
+	br.now = func() time.Time { return peak.Add(-time.Hour) }
+	br.cfg.MaxDefer = time.Millisecond
+	if meta := budgetPath(t, br, "in", map[string]string{"cost": "20"}); meta[defaultBudgetPathKey] != budgetCheap {
+		t.Errorf("expired deferral routed to %s", meta[defaultBudgetPathKey])
+	}
+
+	// Closing the runner fails the held messages
+	br.cfg.MaxDefer = 0
+	errc := make(chan error, 1)
+	go func() {
+		errc <- br.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), map[string]string{"cost": "20"})))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := br.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, errBudgetClosed) {
+			t.Errorf("held message error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("held message not released on Close")
+	}
+}
+
+func TestCreateBudgetRunner(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+
+	runner, err := bridge.createRunner(connectors.RunnerConfig{
+		Type: "budget",
+		Options: map[string]any{
+			"maxCost": 1,
+			"perKB":   1024,
+			"cheap":   []any{map[string]any{"type": "pass"}},
+			"pathKey": "path",
+			"costKey": "cost",
+		},
+	})
+	if err != nil {
+		t.Fatalf("createRunner() unexpected error = %v", err)
+	}
+	br, ok := runner.(*budgetRunner)
+	if !ok {
+		t.Fatalf("createRunner() returned %T, want *budgetRunner", runner)
+	}
+	meta := budgetPath(t, br, "in", nil)
+	if meta["path"] != budgetCheap || meta["cost"] != "2" {
+		t.Errorf("metadata = %v", meta)
+	}
+	if err := br.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+
+	invalid := []map[string]any{
+		{"overBudget": "later"},
+		{"overBudget": budgetOverDefer},
+		{"offPeak": []any{"22:00"}},
+		{"offPeak": []any{"25:00-06:00"}},
+		{"offPeak": []any{"06:00-06:00"}},
+		{"timezone": "Mars/Olympus"},
+	}
+	for i, opts := range invalid {
+		if _, err := bridge.createRunner(connectors.RunnerConfig{Type: "budget", Options: opts}); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
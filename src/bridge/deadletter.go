@@ -0,0 +1,109 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	// stageDeadLetter is the stage publishing the failed messages
+	stageDeadLetter = "deadletter"
+	// deadLetterPayloadCurrent publishes the payload as modified by the runners
+	deadLetterPayloadCurrent = "current"
+)
+
+// deadLetter publishes the messages failing in a runner to the dead-letter target
+type deadLetter struct {
+	cfg    config.DeadLetterConfig
+	runner connectors.Runner
+}
+
+// initializeDeadLetter creates the dead-letter target, if configured
+func (b *EventsBridge) initializeDeadLetter() error {
+	if b.cfg.DeadLetter == nil {
+		return nil
+	}
+	cfg := *b.cfg.DeadLetter
+	b.logger.Info("creating dead-letter target", "type", cfg.Target.Type, "payload", cfg.Payload)
+
+	runner, err := b.createRunner(cfg.Target)
+	if err != nil {
+		return fmt.Errorf("failed to create dead-letter target: %w", err)
+	}
+	if runner == nil {
+		return fmt.Errorf("dead-letter target of type %q does not publish messages", cfg.Target.Type)
+	}
+	b.deadLetter = &deadLetter{cfg: cfg, runner: runner}
+	return nil
+}
+
+// publish sends a copy of the failed message to the target, with the original payload
+// unless the current one is configured
+func (d *deadLetter) publish(msg *message.RunnerMessage) error {
+	dl := msg.Clone()
+	if d.cfg.Payload != deadLetterPayloadCurrent {
+		data, err := msg.GetSourceData()
+		if err != nil {
+			return fmt.Errorf("failed to get original payload: %w", err)
+		}
+		dl.SetData(data)
+	}
+	return d.runner.Process(dl)
+}
+
+// handleRunnerFailure settles a message whose processing failed in a runner. With a dead-letter
+// target the message is published to it, then acked, or naked if configured; the message is
+// naked when no target is configured, the target fails too or the runner asked for a nak.
+func (b *EventsBridge) handleRunnerFailure(msg *message.RunnerMessage, cause error) (*message.RunnerMessage, bool, error) {
+	if b.deadLetter == nil {
+		return b.HandleRunnerError(msg, cause, "error processing message")
+	}
+	if connectors.Nak(cause) {
+		return b.HandleRunnerError(msg, cause, "error processing message, naked for redelivery")
+	}
+
+	var err error
+	b.stage(stageDeadLetter, b.deadLetter.cfg.Target.Type)(func() {
+		err = b.deadLetter.publish(msg)
+	})
+	if err != nil {
+		b.logger.Error("failed to publish message to the dead-letter target", "error", err)
+		return b.HandleRunnerError(msg, cause, "error processing message")
+	}
+	if b.deadLetter.cfg.Nak {
+		return b.HandleRunnerError(msg, cause, "error processing message, sent to the dead-letter target")
+	}
+	b.activity.recordError("error processing message", cause)
+	b.HandleSuccess(msg, "error processing message, sent to the dead-letter target", "error", cause)
+	return nil, false, nil
+}
+
+// start calls the Start hook of the target, if it implements connectors.LifecycleRunner
+func (d *deadLetter) start(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	if lr, ok := d.runner.(connectors.LifecycleRunner); ok {
+		if err := lr.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start dead-letter target: %w", err)
+		}
+	}
+	return nil
+}
+
+// drain calls the Drain hook of the target, if it implements connectors.LifecycleRunner
+func (d *deadLetter) drain(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	if lr, ok := d.runner.(connectors.LifecycleRunner); ok {
+		if err := lr.Drain(ctx); err != nil {
+			return fmt.Errorf("failed to drain dead-letter target: %w", err)
+		}
+	}
+	return nil
+}
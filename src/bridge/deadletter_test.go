@@ -0,0 +1,129 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// failDeadLetter runs a message through a runner modifying the payload then failing,
+// with the given dead-letter target
+func failDeadLetter(t *testing.T, cfg config.DeadLetterConfig, target connectors.Runner) (*testutil.Adapter, bool) {
+	t.Helper()
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	if target != nil {
+		b.deadLetter = &deadLetter{cfg: cfg, runner: target}
+	}
+	failing := &funcRunner{process: func(msg *message.RunnerMessage) error {
+		msg.SetData([]byte("modified"))
+		return errors.New("boom")
+	}}
+
+	adapter := testutil.NewAdapter([]byte("original"), map[string]string{"k": "v"})
+	res, ok, err := b.processRunnerMessage("runner[0]", message.NewRunnerMessage(adapter), failing, connectors.RunnerConfig{Type: "http"}, nil, nil, newRetryGate(0))
+	if err != nil {
+		t.Fatalf("processRunnerMessage() unexpected error = %v", err)
+	}
+	return adapter, res != nil || ok
+}
+
+func TestDeadLetterPublishesOriginalPayload(t *testing.T) {
+	var published *message.RunnerMessage
+	target := &funcRunner{process: func(msg *message.RunnerMessage) error {
+		published = msg
+		return nil
+	}}
+
+	adapter, passed := failDeadLetter(t, config.DeadLetterConfig{}, target)
+	if passed {
+		t.Fatal("failed message passed to the next runner")
+	}
+	if adapter.AckCalls != 1 || adapter.NakCalls != 0 {
+		t.Errorf("acks = %d, naks = %d, want the dead-lettered message acked", adapter.AckCalls, adapter.NakCalls)
+	}
+	if published == nil {
+		t.Fatal("message not published to the dead-letter target")
+	}
+	meta, data, _ := published.GetMetadataAndData()
+	if string(data) != "original" || meta["k"] != "v" {
+		t.Errorf("published metadata = %v, data = %s", meta, data)
+	}
+	records, err := published.GetErrors()
+	if err != nil || len(records) != 1 || records[0].Stage != "runner[0]" || records[0].Message != "boom" {
+		t.Errorf("published error records = %+v, %v", records, err)
+	}
+}
+
+func TestDeadLetterCurrentPayloadAndNak(t *testing.T) {
+	var data []byte
+	target := &funcRunner{process: func(msg *message.RunnerMessage) error {
+		data, _ = msg.GetData()
+		return nil
+	}}
+
+	adapter, _ := failDeadLetter(t, config.DeadLetterConfig{Payload: deadLetterPayloadCurrent, Nak: true}, target)
+	if string(data) != "modified" {
+		t.Errorf("published data = %s, want the current payload", data)
+	}
+	if adapter.AckCalls != 0 || adapter.NakCalls != 1 {
+		t.Errorf("acks = %d, naks = %d, want the dead-lettered message naked", adapter.AckCalls, adapter.NakCalls)
+	}
+}
+
+func TestDeadLetterTargetFailure(t *testing.T) {
+	target := &funcRunner{process: func(*message.RunnerMessage) error { return errors.New("unavailable") }}
+	adapter, _ := failDeadLetter(t, config.DeadLetterConfig{}, target)
+	if adapter.AckCalls != 0 || adapter.NakCalls != 1 {
+		t.Errorf("acks = %d, naks = %d, want the message naked", adapter.AckCalls, adapter.NakCalls)
+	}
+
+	adapter, _ = failDeadLetter(t, config.DeadLetterConfig{}, nil)
+	if adapter.NakCalls != 1 {
+		t.Errorf("naks = %d without dead-letter target, want 1", adapter.NakCalls)
+	}
+}
+
+func TestInitializeDeadLetter(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.DeadLetter = &config.DeadLetterConfig{Target: connectors.RunnerConfig{Type: "pass"}}
+	b := &EventsBridge{cfg: cfg, logger: newTestLogger()}
+	if err := b.initializeDeadLetter(); err == nil {
+		t.Error("expected error for a pass dead-letter target")
+	}
+
+	cfg.DeadLetter.Target = connectors.RunnerConfig{Type: "branch", Options: map[string]any{"branches": []any{[]any{map[string]any{"type": "pass"}}}}}
+	if err := b.initializeDeadLetter(); err != nil {
+		t.Fatalf("initializeDeadLetter() unexpected error = %v", err)
+	}
+	if b.deadLetter == nil {
+		t.Fatal("dead-letter target not created")
+	}
+	if err := b.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+}
+
+func TestDeadLetterSkipsNakErrors(t *testing.T) {
+	var published bool
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger(), activity: newActivityTracker()}
+	b.deadLetter = &deadLetter{runner: &funcRunner{process: func(*message.RunnerMessage) error {
+		published = true
+		return nil
+	}}}
+	failing := &funcRunner{process: func(*message.RunnerMessage) error {
+		return fmt.Errorf("failed after 3 attempts: %w", &connectors.NakError{Err: errors.New("upstream unavailable")})
+	}}
+
+	adapter := testutil.NewAdapter([]byte("data"), nil)
+	if _, _, err := b.processRunnerMessage("runner[0]", message.NewRunnerMessage(adapter), failing, connectors.RunnerConfig{Type: "http"}, nil, nil, newRetryGate(0)); err != nil {
+		t.Fatalf("processRunnerMessage() unexpected error = %v", err)
+	}
+	if published || adapter.NakCalls != 1 || adapter.AckCalls != 0 {
+		t.Errorf("published = %v, acks = %d, naks = %d, want the message naked", published, adapter.AckCalls, adapter.NakCalls)
+	}
+}
@@ -0,0 +1,186 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Debugger runs a single message through the configured runners, one stage at a time
+type Debugger struct {
+	bridge  *EventsBridge
+	started bool
+}
+
+// Step is the outcome of a runner stage in a debug session
+type Step struct {
+	Index int
+	Type  string
+	// Skipped is true when the ifExpr evaluated to false and the runner was not called
+	Skipped bool
+	// Filtered is true when the filterExpr evaluated to false: the message would be dropped
+	Filtered bool
+	// Err is the error of the stage, which stops the pipeline
+	Err      error
+	Duration time.Duration
+	Diff     MessageDiff
+}
+
+// MessageDiff is the change of the message state made by a stage
+type MessageDiff struct {
+	Added      map[string]string
+	Changed    map[string][2]string
+	Removed    []string
+	DataBefore []byte
+	DataAfter  []byte
+}
+
+// DataChanged reports whether the payload was changed
+func (d MessageDiff) DataChanged() bool {
+	return !bytes.Equal(d.DataBefore, d.DataAfter)
+}
+
+// Empty reports whether the message was left unchanged
+func (d MessageDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0 && !d.DataChanged()
+}
+
+// NewDebugger creates the runners of the configuration. The source is not created.
+func NewDebugger(cfg *config.Config, logger *slog.Logger) (*Debugger, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+	b := &EventsBridge{
+		cfg:     cfg,
+		logger:  logger,
+		runners: make([]RunnerItem, len(cfg.Runners)),
+	}
+	if err := b.initializeRunners(); err != nil {
+		b.Close() //nolint:errcheck
+		return nil, fmt.Errorf("runners init: %w", err)
+	}
+	return &Debugger{bridge: b}, nil
+}
+
+// Run processes the message through the runners in order, calling onStep after every stage.
+// The run stops after a failed or filtered stage, or when onStep returns false.
+// Payload limits are not applied. The runners are started on the first run only, so that
+// several messages can be run through the same runners.
+func (d *Debugger) Run(ctx context.Context, msg *message.RunnerMessage, onStep func(Step) bool) error {
+	if !d.started {
+		if err := d.bridge.planRunners(); err != nil {
+			return err
+		}
+		if err := d.bridge.startRunners(ctx); err != nil {
+			return err
+		}
+		d.started = true
+	}
+
+	for i, item := range d.bridge.runners {
+		step := d.runStep(i, item, msg)
+		if !onStep(step) || step.Err != nil || step.Filtered {
+			break
+		}
+	}
+	return nil
+}
+
+// runStep runs a single stage, recording the message state before and after it
+func (d *Debugger) runStep(i int, item RunnerItem, msg *message.RunnerMessage) Step {
+	step := Step{Index: i, Type: item.Config.Type}
+	beforeMeta, beforeData, err := msg.GetMetadataAndData()
+	if err != nil {
+		step.Err = fmt.Errorf("failed to get metadata and data: %w", err)
+		return step
+	}
+	beforeMeta = maps.Clone(beforeMeta)
+	beforeData = bytes.Clone(beforeData)
+
+	start := time.Now()
+	step.Skipped, step.Filtered, step.Err = d.process(item, msg)
+	step.Duration = time.Since(start)
+
+	afterMeta, afterData, err := msg.GetMetadataAndData()
+	if err != nil && step.Err == nil {
+		step.Err = fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	step.Diff = diffMessage(beforeMeta, beforeData, afterMeta, afterData)
+	return step
+}
+
+// process evaluates the stage expressions and calls the runner, as the pipeline does
+func (d *Debugger) process(item RunnerItem, msg *message.RunnerMessage) (skipped bool, filtered bool, err error) {
+	ifEval, filterEval := item.plan.ifEval, item.plan.filterEval
+	if ifEval != nil {
+		pass, err := ifEval.EvalMessage(msg)
+		if err != nil {
+			return false, false, fmt.Errorf("failed to evaluate ifExpr: %w", err)
+		}
+		if !pass {
+			return true, false, nil
+		}
+	}
+
+	if item.Runner != nil {
+		if err := item.Runner.Process(msg); isFiltered(err) {
+			return false, true, nil
+		} else if err != nil {
+			return false, false, err
+		}
+	}
+
+	if filterEval != nil {
+		pass, err := filterEval.EvalMessage(msg)
+		if err != nil {
+			return false, false, fmt.Errorf("failed to evaluate filterExpr: %w", err)
+		}
+		if !pass {
+			return false, true, nil
+		}
+	}
+	return false, false, nil
+}
+
+// diffMessage compares the message state before and after a stage
+func diffMessage(beforeMeta map[string]string, beforeData []byte, afterMeta map[string]string, afterData []byte) MessageDiff {
+	diff := MessageDiff{
+		Added:      map[string]string{},
+		Changed:    map[string][2]string{},
+		DataBefore: beforeData,
+		DataAfter:  afterData,
+	}
+	for k, v := range afterMeta {
+		old, ok := beforeMeta[k]
+		switch {
+		case !ok:
+			diff.Added[k] = v
+		case old != v:
+			diff.Changed[k] = [2]string{old, v}
+		}
+	}
+	for k := range beforeMeta {
+		if _, ok := afterMeta[k]; !ok {
+			diff.Removed = append(diff.Removed, k)
+		}
+	}
+	slices.Sort(diff.Removed)
+	return diff
+}
+
+// Close drains and closes the runners
+func (d *Debugger) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := d.bridge.drainRunners(ctx); err != nil {
+		d.bridge.logger.Warn("failed to drain runners", "error", err)
+	}
+	return d.bridge.Close()
+}
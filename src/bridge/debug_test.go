@@ -0,0 +1,107 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func newTestDebugger(items ...RunnerItem) *Debugger {
+	return &Debugger{bridge: &EventsBridge{cfg: newTestConfig(), logger: newTestLogger(), runners: items}}
+}
+
+func runDebugger(t *testing.T, d *Debugger, msg *message.RunnerMessage, stop int) []Step {
+	t.Helper()
+	var steps []Step
+	err := d.Run(context.Background(), msg, func(s Step) bool {
+		steps = append(steps, s)
+		return s.Index != stop
+	})
+	if err != nil {
+		t.Fatalf("Run() unexpected error = %v", err)
+	}
+	return steps
+}
+
+func TestDebuggerSteps(t *testing.T) {
+	enrich := &funcRunner{process: func(msg *message.RunnerMessage) error {
+		msg.AddMetadata("team", "payments")
+		msg.AddMetadata("source", "billing-v2")
+		msg.SetData([]byte(`{"amount":10}`))
+		return nil
+	}}
+	d := newTestDebugger(
+		RunnerItem{Config: connectors.RunnerConfig{Type: "enrich"}, Runner: enrich},
+		RunnerItem{Config: connectors.RunnerConfig{Type: "skipped", IfExpr: `metadata.team == "crm"`}, Runner: &funcRunner{process: func(*message.RunnerMessage) error {
+			t.Error("runner called despite ifExpr")
+			return nil
+		}}},
+		RunnerItem{Config: connectors.RunnerConfig{Type: "pass", FilterExpr: `metadata.team == "crm"`}},
+		RunnerItem{Config: connectors.RunnerConfig{Type: "unreached"}, Runner: &funcRunner{process: func(*message.RunnerMessage) error {
+			t.Error("runner called after filtered stage")
+			return nil
+		}}},
+	)
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{}`), map[string]string{"source": "billing"}))
+	steps := runDebugger(t, d, msg, -1)
+	if len(steps) != 3 {
+		t.Fatalf("expected 3 steps, got %d", len(steps))
+	}
+
+	diff := steps[0].Diff
+	if diff.Added["team"] != "payments" || diff.Changed["source"] != [2]string{"billing", "billing-v2"} || !diff.DataChanged() {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+	if string(diff.DataBefore) != `{}` || string(diff.DataAfter) != `{"amount":10}` {
+		t.Errorf("unexpected data diff %q -> %q", diff.DataBefore, diff.DataAfter)
+	}
+	if !steps[1].Skipped || !steps[1].Diff.Empty() {
+		t.Errorf("expected skipped step without changes, got %+v", steps[1])
+	}
+	if !steps[2].Filtered {
+		t.Errorf("expected filtered step, got %+v", steps[2])
+	}
+}
+
+func TestDebuggerErrorAndBreakpoint(t *testing.T) {
+	failure := errors.New("boom")
+	d := newTestDebugger(
+		RunnerItem{Config: connectors.RunnerConfig{Type: "first"}, Runner: &funcRunner{process: func(*message.RunnerMessage) error { return nil }}},
+		RunnerItem{Config: connectors.RunnerConfig{Type: "failing"}, Runner: &funcRunner{process: func(*message.RunnerMessage) error { return failure }}},
+		RunnerItem{Config: connectors.RunnerConfig{Type: "unreached"}, Runner: &funcRunner{process: func(*message.RunnerMessage) error { return nil }}},
+	)
+
+	steps := runDebugger(t, d, message.NewRunnerMessage(testutil.NewAdapter(nil, nil)), 0)
+	if len(steps) != 1 {
+		t.Fatalf("expected to stop at the breakpoint, got %d steps", len(steps))
+	}
+
+	steps = runDebugger(t, d, message.NewRunnerMessage(testutil.NewAdapter(nil, nil)), -1)
+	if len(steps) != 2 || !errors.Is(steps[1].Err, failure) {
+		t.Fatalf("expected to stop at the failing runner, got %+v", steps)
+	}
+}
+
+func TestDiffMessageRemoved(t *testing.T) {
+	diff := diffMessage(map[string]string{"b": "1", "a": "2", "c": "3"}, []byte("x"), map[string]string{"c": "3"}, []byte("x"))
+	if len(diff.Removed) != 2 || diff.Removed[0] != "a" || diff.Removed[1] != "b" || diff.DataChanged() {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+}
+
+func TestDebuggerStartsRunnersOnce(t *testing.T) {
+	runners, calls := newLifecycleRunners("a")
+	d := newTestDebugger(RunnerItem{Config: connectors.RunnerConfig{Type: "a"}, Runner: runners[0]})
+
+	for range 3 {
+		runDebugger(t, d, message.NewRunnerMessage(testutil.NewAdapter(nil, nil)), -1)
+	}
+	if got := calls(); len(got) != 1 || got[0] != "a:start" {
+		t.Errorf("expected a single start, got %v", got)
+	}
+}
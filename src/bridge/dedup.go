@@ -0,0 +1,220 @@
+package bridge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/destel/rill"
+	"github.com/sandrolain/events-bridge/src/common/expreval"
+	"github.com/sandrolain/events-bridge/src/common/jsonpath"
+	"github.com/sandrolain/events-bridge/src/common/statestore"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// dedupRunnerType is the built-in runner type dropping the duplicate messages
+const dedupRunnerType = "dedup"
+
+const (
+	dedupBackendMemory = "memory"
+	dedupBackendRedis  = "redis"
+
+	dedupFromMetadata = "metadata"
+
+	// dedupKeyPrefix is the default prefix of the Redis deduplication keys
+	dedupKeyPrefix = "eb-dedup:"
+)
+
+// errDedupNested is returned for a dedup runner outside of the main runner chain
+var errDedupNested = errors.New("the dedup runner is only supported in the main runner chain")
+
+// dedupKeyConfig is the deduplication key read from the message, e.g. the event id
+type dedupKeyConfig struct {
+	// From is the message part the key is read from: "data" (JSON payload, default) or "metadata"
+	From string `mapstructure:"from" validate:"omitempty,oneof=data metadata"`
+	// Path is the JSON path into the payload (e.g. "$.order.id" or "order.id") or the metadata
+	// key; without a path the key is the SHA-256 of the payload
+	Path string `mapstructure:"path"`
+}
+
+// dedupRunnerConfig holds the options of the dedup runner
+type dedupRunnerConfig struct {
+	// Key is the deduplication key of every message
+	Key dedupKeyConfig `mapstructure:"key"`
+	// TTL is the window in which a message with a seen key is a duplicate
+	TTL time.Duration `mapstructure:"ttl" default:"5m" validate:"gt=0"`
+	// Backend is the store of the seen keys: "memory" (default) or "redis", shared by the
+	// bridge instances and kept across restarts
+	Backend string `mapstructure:"backend" default:"memory" validate:"oneof=memory redis"`
+	// Timeout bounds the store operations
+	Timeout time.Duration `mapstructure:"timeout" default:"5s" validate:"gt=0"`
+
+	Memory statestore.MemoryConfig `mapstructure:"memory"`
+	Redis  *statestore.RedisConfig `mapstructure:"redis" validate:"required_if=Backend redis"`
+}
+
+// dedupRunner remembers the keys of the accepted messages for the TTL. The key of a naked
+// message is forgotten, so that its redelivery is accepted.
+type dedupRunner struct {
+	cfg    dedupRunnerConfig
+	store  statestore.Store
+	logger *slog.Logger
+}
+
+// createDedupRunner creates the dedup runner of the options, connected to its store
+func (b *EventsBridge) createDedupRunner(runnerConfig connectors.RunnerConfig) (*dedupRunner, error) {
+	cfg := new(dedupRunnerConfig)
+	if err := b.parseRunnerOptions(runnerConfig, cfg); err != nil {
+		return nil, err
+	}
+
+	r, err := newDedupRunner(cfg, b.logger)
+	if err != nil {
+		return nil, err
+	}
+	b.logger.Info("dedup runner created", "backend", cfg.Backend, "key", cfg.Key.Path, "ttl", cfg.TTL)
+	return r, nil
+}
+
+// newDedupRunner creates a dedup runner connected to its store, shared by the dedup runner
+// and the dedup source middleware
+func newDedupRunner(cfg *dedupRunnerConfig, logger *slog.Logger) (*dedupRunner, error) {
+	var store statestore.Store
+	switch cfg.Backend {
+	case dedupBackendRedis:
+		rs, err := statestore.NewRedis(cfg.Redis, cfg.TTL, dedupKeyPrefix)
+		if err != nil {
+			return nil, err
+		}
+		store = rs
+	case dedupBackendMemory:
+		store = statestore.NewMemory(&cfg.Memory, cfg.TTL)
+	default:
+		return nil, fmt.Errorf("unsupported dedup backend: %s", cfg.Backend)
+	}
+	return &dedupRunner{cfg: *cfg, store: store, logger: logger.With("component", "dedup")}, nil
+}
+
+// key returns the deduplication key of the message
+func (r *dedupRunner) key(msg *message.RunnerMessage) (string, error) {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return "", fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	if r.cfg.Key.Path == "" {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	if r.cfg.Key.From == dedupFromMetadata {
+		key, ok := meta[r.cfg.Key.Path]
+		if !ok || key == "" {
+			return "", fmt.Errorf("deduplication key not found in metadata key: %s", r.cfg.Key.Path)
+		}
+		return key, nil
+	}
+
+	var payload any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return "", fmt.Errorf("payload must be JSON: %w", err)
+	}
+	value, ok := jsonpath.Get(payload, r.cfg.Key.Path)
+	if !ok || value == nil {
+		return "", fmt.Errorf("deduplication key not found in payload path: %s", r.cfg.Key.Path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	// Numbers, booleans and structured keys are compared by their JSON encoding
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid deduplication key: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// seen records the key of the message, reporting whether it was already recorded
+func (r *dedupRunner) seen(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+	added, err := r.store.Add(ctx, key, []byte{1})
+	if err != nil {
+		return false, fmt.Errorf("failed to record deduplication key %s: %w", key, err)
+	}
+	return !added, nil
+}
+
+// forget removes the key of a naked message
+func (r *dedupRunner) forget(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+	if err := r.store.Delete(ctx, key); err != nil {
+		r.logger.Warn("failed to forget deduplication key", "key", key, "error", err)
+	}
+}
+
+// Process records the key of the message, failing on the duplicates. In the pipeline the
+// runner is applied by dedupMessages, which acks and drops the duplicates instead.
+func (r *dedupRunner) Process(msg *message.RunnerMessage) error {
+	key, err := r.key(msg)
+	if err != nil {
+		return err
+	}
+	dup, err := r.seen(key)
+	if err != nil {
+		return err
+	}
+	if dup {
+		return fmt.Errorf("duplicate message with key %s", key)
+	}
+	return nil
+}
+
+func (r *dedupRunner) Close() error {
+	return r.store.Close()
+}
+
+// dedupMessages acks and drops the messages whose key was seen within the TTL
+func (b *EventsBridge) dedupMessages(stream rill.Stream[*message.RunnerMessage], routines int, stage string, cfg connectors.RunnerConfig, r *dedupRunner, ifEval *expreval.ExprEvaluator) rill.Stream[*message.RunnerMessage] {
+	return rill.OrderedFilterMap(stream, routines, func(msg *message.RunnerMessage) (*message.RunnerMessage, bool, error) {
+		if ifEval != nil {
+			pass, err := ifEval.EvalMessage(msg)
+			if err != nil {
+				return b.HandleRunnerError(msg, err, "failed to evaluate ifExpr, skipping runner processing", "ifExpr", cfg.IfExpr)
+			}
+			if !pass {
+				runnerMessages.With(stage, cfg.Type, resultSkipped).Inc()
+				return msg, true, nil
+			}
+		}
+
+		key, err := r.key(msg)
+		if err != nil {
+			runnerMessages.With(stage, cfg.Type, resultError).Inc()
+			return b.HandleRunnerError(msg, err, "failed to get the deduplication key")
+		}
+		dup, err := r.seen(key)
+		if err != nil {
+			runnerMessages.With(stage, cfg.Type, resultError).Inc()
+			return b.HandleRunnerError(msg, err, "failed to check the deduplication key")
+		}
+		if dup {
+			runnerDuplicates.With(stage, cfg.Type).Inc()
+			b.HandleSuccess(msg, "duplicate message dropped", "runner", cfg.Type, "key", key)
+			return nil, false, nil
+		}
+
+		wrapped, err := wrapMessage(msg, &dedupMessage{SourceMessage: msg, forget: func() { r.forget(key) }})
+		if err != nil {
+			r.forget(key)
+			return b.HandleRunnerError(msg, err, "failed to wrap the deduplicated message")
+		}
+		runnerMessages.With(stage, cfg.Type, resultOK).Inc()
+		return wrapped, true, nil
+	})
+}
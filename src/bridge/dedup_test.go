@@ -0,0 +1,127 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// startDedupBridge starts a bridge deduplicating the messages before the runner
+func startDedupBridge(t *testing.T, rc connectors.RunnerConfig, runner connectors.Runner) *chanSource {
+	t.Helper()
+	src := newChanSource()
+	b := &EventsBridge{
+		cfg:      newTestConfig(),
+		logger:   newTestLogger(),
+		source:   src,
+		activity: newActivityTracker(),
+	}
+	rc.Type = dedupRunnerType
+	dedup, err := b.createDedupRunner(rc)
+	if err != nil {
+		t.Fatalf("createDedupRunner() unexpected error = %v", err)
+	}
+	t.Cleanup(func() { _ = dedup.Close() })
+	b.runners = []RunnerItem{
+		{Config: rc, Runner: dedup},
+		{Config: connectors.RunnerConfig{Type: "test"}, Runner: runner},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	return src
+}
+
+func TestDedupPipeline(t *testing.T) {
+	var processed atomic.Int32
+	runner := &funcRunner{process: func(msg *message.RunnerMessage) error {
+		// The first delivery of the order 3 fails
+		if processed.Add(1) == 3 {
+			return errors.New("write failed")
+		}
+		return nil
+	}}
+	src := startDedupBridge(t, connectors.RunnerConfig{Options: map[string]any{
+		"key": map[string]any{"path": "$.order.id"},
+	}}, runner)
+
+	send := func(data string) *countingMessage {
+		m := newCountingMessage(data)
+		src.c <- message.NewRunnerMessage(m)
+		return m
+	}
+	first := send(`{"order":{"id":1}}`)
+	dup := send(`{"order":{"id":1},"retry":true}`)
+	other := send(`{"order":{"id":"2"}}`)
+	waitFor(t, func() bool { return first.acks.Load() == 1 && dup.acks.Load() == 1 && other.acks.Load() == 1 })
+	if processed.Load() != 2 {
+		t.Errorf("processed = %d, want 2: the duplicate is dropped", processed.Load())
+	}
+
+	// The key of a naked message is forgotten, so that its redelivery is processed
+	failed := send(`{"order":{"id":3}}`)
+	waitFor(t, func() bool { return failed.naks.Load() == 1 })
+	redelivered := send(`{"order":{"id":3}}`)
+	waitFor(t, func() bool { return redelivered.acks.Load() == 1 })
+	if processed.Load() != 4 {
+		t.Errorf("processed = %d, want 4: the redelivery is processed", processed.Load())
+	}
+
+	// A message without the key fails
+	missing := send(`{"order":{}}`)
+	waitFor(t, func() bool { return missing.naks.Load() == 1 })
+}
+
+func TestDedupMetadataKeyRedis(t *testing.T) {
+	srv, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	t.Cleanup(srv.Close)
+
+	runner := &recordingRunner{}
+	src := startDedupBridge(t, connectors.RunnerConfig{Options: map[string]any{
+		"key":     map[string]any{"from": "metadata", "path": "event-id"},
+		"backend": "redis",
+		"redis":   map[string]any{"address": srv.Addr()},
+		"ttl":     "1h",
+	}}, runner)
+
+	send := func(id string) *countingMessage {
+		m := &countingMessage{Adapter: testutil.NewAdapter([]byte("payload"), map[string]string{"event-id": id})}
+		src.c <- message.NewRunnerMessage(m)
+		return m
+	}
+	a, dup, b := send("a"), send("a"), send("b")
+	waitFor(t, func() bool { return a.acks.Load() == 1 && dup.acks.Load() == 1 && b.acks.Load() == 1 })
+	if runner.processed() != 2 {
+		t.Errorf("processed = %d, want 2", runner.processed())
+	}
+	if !srv.Exists(dedupKeyPrefix + "a") {
+		t.Error("deduplication key not stored in Redis")
+	}
+}
+
+func TestDedupRunnerConfig(t *testing.T) {
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	for name, opts := range map[string]map[string]any{
+		"invalid from":  {"key": map[string]any{"from": "body", "path": "id"}},
+		"missing redis": {"backend": "redis"},
+		"invalid ttl":   {"ttl": "0s"},
+	} {
+		if _, err := b.createDedupRunner(connectors.RunnerConfig{Options: opts}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := b.createRunner(connectors.RunnerConfig{Type: dedupRunnerType}); !errors.Is(err, errDedupNested) {
+		t.Errorf("createRunner() error = %v, want errDedupNested", err)
+	}
+}
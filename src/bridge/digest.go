@@ -0,0 +1,363 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/destel/rill"
+	"github.com/google/uuid"
+	"github.com/sandrolain/events-bridge/src/common/expreval"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// digestRunnerType is the built-in runner type collecting the messages into digests
+const digestRunnerType = "digest"
+
+const (
+	digestFormatJSON = "json"
+	digestFormatText = "text"
+
+	defaultDigestMaxEntries = 100
+	defaultDigestMaxBytes   = 1 << 20
+	defaultDigestMaxKeys    = 1000
+)
+
+// Metadata keys set on the digest messages
+const (
+	metaDigestKey       = "eb-digest-key"
+	metaDigestCount     = "eb-digest-count"
+	metaDigestTruncated = "eb-digest-truncated"
+)
+
+// errDigestNested is returned for a digest runner outside of the main runner chain
+var errDigestNested = errors.New("the digest runner is only supported in the main runner chain")
+
+// digestRunnerConfig holds the options of the digest runner
+type digestRunnerConfig struct {
+	// Window is the time a digest collects messages after its first one
+	Window time.Duration `mapstructure:"window" validate:"required,gt=0"`
+	// KeyFrom is the metadata key grouping the messages: every key has its own digest
+	KeyFrom string `mapstructure:"keyFrom"`
+	// Line is the Go template of the summary line of a message, executed with "data" (the
+	// payload as string), "json" (the decoded JSON payload, if any) and "metadata"
+	// (default: the payload)
+	Line string `mapstructure:"line"`
+	// Format is the payload of the digest: "json" (default, an object with the counts and
+	// the entries) or "text" (a line per entry)
+	Format string `mapstructure:"format" validate:"omitempty,oneof=json text"`
+	// MaxEntries bounds the distinct lines of a digest; the further lines are only counted
+	// as truncated (default: 100)
+	MaxEntries int `mapstructure:"maxEntries" validate:"min=0"`
+	// MaxBytes bounds the size of the lines of a digest, the lines are truncated beyond it
+	// (default: 1MiB)
+	MaxBytes int `mapstructure:"maxBytes" validate:"min=0"`
+	// MaxKeys bounds the open digests; the oldest digest is emitted early when a new key
+	// would exceed it (default: 1000)
+	MaxKeys int `mapstructure:"maxKeys" validate:"min=0"`
+}
+
+// digestEntry is a distinct line of a digest, with the number of its messages
+type digestEntry struct {
+	Line  string `json:"line"`
+	Count int    `json:"count"`
+}
+
+// digestPayload is the JSON payload of a digest message
+type digestPayload struct {
+	Key       string        `json:"key,omitempty"`
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Count     int           `json:"count"`
+	Truncated int           `json:"truncated"`
+	Entries   []digestEntry `json:"entries"`
+}
+
+// pendingDigest is a digest collecting messages
+type pendingDigest struct {
+	key       string
+	start     time.Time
+	deadline  time.Time
+	count     int
+	truncated int
+	bytes     int
+	entries   []digestEntry
+	index     map[string]int
+}
+
+// digester collects the summary lines of the messages into digests
+type digester struct {
+	cfg  digestRunnerConfig
+	line *template.Template
+}
+
+// createDigester creates the digester of the options of a digest runner
+func (b *EventsBridge) createDigester(runnerConfig connectors.RunnerConfig) (*digester, error) {
+	cfg := new(digestRunnerConfig)
+	if err := b.parseRunnerOptions(runnerConfig, cfg); err != nil {
+		return nil, err
+	}
+	return newDigester(*cfg)
+}
+
+// newDigester applies the defaults of the configuration and compiles its line template
+func newDigester(cfg digestRunnerConfig) (*digester, error) {
+	if cfg.Window <= 0 {
+		return nil, errors.New("digest window must be positive")
+	}
+	if cfg.Format == "" {
+		cfg.Format = digestFormatJSON
+	}
+	if cfg.MaxEntries == 0 {
+		cfg.MaxEntries = defaultDigestMaxEntries
+	}
+	if cfg.MaxBytes == 0 {
+		cfg.MaxBytes = defaultDigestMaxBytes
+	}
+	if cfg.MaxKeys == 0 {
+		cfg.MaxKeys = defaultDigestMaxKeys
+	}
+	d := &digester{cfg: cfg}
+	if cfg.Line != "" {
+		line, err := template.New("digest.line").Option("missingkey=zero").Parse(cfg.Line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest line template: %w", err)
+		}
+		d.line = line
+	}
+	return d, nil
+}
+
+// summary returns the summary line of a message
+func (d *digester) summary(meta map[string]string, data []byte) (string, error) {
+	if d.line == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	var decoded any
+	if json.Valid(data) {
+		_ = json.Unmarshal(data, &decoded)
+	}
+	var buf bytes.Buffer
+	if err := d.line.Execute(&buf, map[string]any{"data": string(data), "json": decoded, "metadata": meta}); err != nil {
+		return "", fmt.Errorf("failed to render digest line: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// add counts the message in the digest and collects its line, unless the digest is full
+func (d *digester) add(pending *pendingDigest, line string) {
+	pending.count++
+	if i, ok := pending.index[line]; ok {
+		pending.entries[i].Count++
+		return
+	}
+	if len(pending.entries) >= d.cfg.MaxEntries || pending.bytes+len(line) > d.cfg.MaxBytes {
+		pending.truncated++
+		return
+	}
+	pending.index[line] = len(pending.entries)
+	pending.entries = append(pending.entries, digestEntry{Line: line, Count: 1})
+	pending.bytes += len(line)
+}
+
+// encode returns the payload of the digest
+func (d *digester) encode(pending *pendingDigest, end time.Time) ([]byte, error) {
+	if d.cfg.Format == digestFormatText {
+		var buf bytes.Buffer
+		for _, e := range pending.entries {
+			if e.Count > 1 {
+				fmt.Fprintf(&buf, "%s (x%d)\n", e.Line, e.Count)
+			} else {
+				fmt.Fprintf(&buf, "%s\n", e.Line)
+			}
+		}
+		if pending.truncated > 0 {
+			fmt.Fprintf(&buf, "... %d more messages truncated\n", pending.truncated)
+		}
+		return buf.Bytes(), nil
+	}
+	return json.Marshal(digestPayload{
+		Key:       pending.key,
+		Start:     pending.start,
+		End:       end,
+		Count:     pending.count,
+		Truncated: pending.truncated,
+		Entries:   pending.entries,
+	})
+}
+
+// digestMessages collects the messages of the stream into a digest per key, emitted a window
+// after its first message or when the stream ends. The messages are acked once collected.
+// The messages for which the ifExpr of the runner is false are passed on without being
+// collected, the ones for which its filterExpr is false are filtered out.
+func (b *EventsBridge) digestMessages(stream rill.Stream[*message.RunnerMessage], d *digester, cfg connectors.RunnerConfig, ifEval, filterEval *expreval.ExprEvaluator) rill.Stream[*message.RunnerMessage] {
+	out := make(chan rill.Try[*message.RunnerMessage])
+	go func() {
+		defer close(out)
+		digests := map[string]*pendingDigest{}
+		emit := func(key string) {
+			pending := digests[key]
+			delete(digests, key)
+			if msg := b.newDigestMessage(pending, d); msg != nil {
+				out <- rill.Wrap(msg, nil)
+			}
+		}
+
+		timer := time.NewTimer(time.Hour)
+		timer.Stop()
+		for {
+			// The timer fires at the deadline of the oldest digest
+			var next time.Time
+			for _, pending := range digests {
+				if next.IsZero() || pending.deadline.Before(next) {
+					next = pending.deadline
+				}
+			}
+			var expired <-chan time.Time
+			if !next.IsZero() {
+				timer.Reset(time.Until(next))
+				expired = timer.C
+			}
+
+			select {
+			case item, ok := <-stream:
+				timer.Stop()
+				if !ok {
+					for key := range digests {
+						emit(key)
+					}
+					return
+				}
+				if item.Error != nil {
+					out <- item
+					continue
+				}
+				if ifEval != nil {
+					pass, err := ifEval.EvalMessage(item.Value)
+					if err != nil {
+						b.HandleError(item.Value, err, "failed to evaluate ifExpr, skipping runner processing", "ifExpr", cfg.IfExpr)
+						continue
+					}
+					if !pass {
+						out <- item
+						continue
+					}
+				}
+				if filterEval != nil {
+					pass, err := filterEval.EvalMessage(item.Value)
+					if err != nil {
+						b.HandleError(item.Value, err, "failed to evaluate filterExpr, skipping message", "filterExpr", cfg.FilterExpr)
+						continue
+					}
+					if !pass {
+						b.HandleSuccess(item.Value, "message filtered out by filterExpr", "filterExpr", cfg.FilterExpr)
+						continue
+					}
+				}
+				b.addToDigest(item.Value, d, digests, emit)
+			case <-expired:
+				now := time.Now()
+				for key, pending := range digests {
+					if !now.Before(pending.deadline) {
+						emit(key)
+					}
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// addToDigest collects the line of the message into the digest of its key and acks the
+// message. A new key emits the oldest digest first when the digests are at their limit.
+func (b *EventsBridge) addToDigest(msg *message.RunnerMessage, d *digester, digests map[string]*pendingDigest, emit func(string)) {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		b.HandleError(msg, err, "failed to get metadata and data of the digested message")
+		return
+	}
+	line, err := d.summary(meta, data)
+	if err != nil {
+		b.HandleError(msg, err, "failed to add message to the digest")
+		return
+	}
+	key := ""
+	if d.cfg.KeyFrom != "" {
+		key = meta[d.cfg.KeyFrom]
+	}
+
+	pending := digests[key]
+	if pending == nil {
+		if len(digests) >= d.cfg.MaxKeys {
+			oldest := ""
+			for k, p := range digests {
+				if oldest == "" || p.start.Before(digests[oldest].start) {
+					oldest = k
+				}
+			}
+			emit(oldest)
+		}
+		now := time.Now()
+		pending = &pendingDigest{key: key, start: now, deadline: now.Add(d.cfg.Window), index: map[string]int{}}
+		digests[key] = pending
+	}
+	d.add(pending, line)
+	b.HandleSuccess(msg, "message added to the digest", "key", key)
+}
+
+// newDigestMessage returns the message of the digest
+func (b *EventsBridge) newDigestMessage(pending *pendingDigest, d *digester) *message.RunnerMessage {
+	data, err := d.encode(pending, time.Now())
+	if err != nil {
+		b.logger.Error("failed to encode the digest", "key", pending.key, "error", err)
+		return nil
+	}
+	meta := map[string]string{
+		metaDigestKey:       pending.key,
+		metaDigestCount:     strconv.Itoa(pending.count),
+		metaDigestTruncated: strconv.Itoa(pending.truncated),
+	}
+	if d.cfg.KeyFrom != "" {
+		meta[d.cfg.KeyFrom] = pending.key
+	}
+	msg := message.NewRunnerMessage(&digestSource{id: uuid.NewString(), metadata: maps.Clone(meta), data: data})
+	msg.SetMetadata(meta)
+	msg.SetData(data)
+	return msg
+}
+
+// digestSource is the source of a digest message: its messages are already acked, so
+// acking or naking the digest has no effect. Its metadata and data are the ones the digest
+// was created with, e.g. the original payload published to the dead-letter target.
+type digestSource struct {
+	id       string
+	metadata map[string]string
+	data     []byte
+}
+
+func (s *digestSource) GetID() []byte {
+	return []byte(s.id)
+}
+
+func (s *digestSource) GetMetadata() (map[string]string, error) {
+	return maps.Clone(s.metadata), nil
+}
+
+func (s *digestSource) GetData() ([]byte, error) {
+	return s.data, nil
+}
+
+func (s *digestSource) Ack(*message.ReplyData) error {
+	return nil
+}
+
+func (s *digestSource) Nak() error {
+	return nil
+}
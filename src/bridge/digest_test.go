@@ -0,0 +1,203 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// startDigestBridge starts a bridge collecting the messages into digests before the runner,
+// with an optional dead-letter target
+func startDigestBridge(t *testing.T, digest connectors.RunnerConfig, runner connectors.Runner, dl *deadLetter) *chanSource {
+	t.Helper()
+	src := newChanSource()
+	digest.Type = digestRunnerType
+	b := &EventsBridge{
+		cfg:        newTestConfig(),
+		logger:     newTestLogger(),
+		source:     src,
+		activity:   newActivityTracker(),
+		deadLetter: dl,
+		runners: []RunnerItem{
+			{Config: digest},
+			{Config: connectors.RunnerConfig{Type: "test"}, Runner: runner},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	return src
+}
+
+func TestDigestPipeline(t *testing.T) {
+	runner := &recordingRunner{}
+	src := startDigestBridge(t, connectors.RunnerConfig{Options: map[string]any{
+		"window":     100 * time.Millisecond,
+		"keyFrom":    "service",
+		"line":       "{{.json.level}}: {{.json.msg}}",
+		"maxEntries": 2,
+	}}, runner, nil)
+
+	send := func(service, data string) *countingMessage {
+		m := &countingMessage{Adapter: testutil.NewAdapter([]byte(data), map[string]string{"service": service})}
+		src.c <- message.NewRunnerMessage(m)
+		return m
+	}
+	start := time.Now()
+	msgs := []*countingMessage{
+		send("api", `{"level":"error","msg":"timeout"}`),
+		send("api", `{"level":"error","msg":"timeout"}`),
+		send("api", `{"level":"warn","msg":"slow"}`),
+		send("api", `{"level":"error","msg":"refused"}`),
+		send("db", `{"level":"error","msg":"deadlock"}`),
+	}
+	// The messages are acked once collected
+	waitFor(t, func() bool {
+		for _, m := range msgs {
+			if m.acks.Load() != 1 {
+				return false
+			}
+		}
+		return true
+	})
+	waitFor(t, func() bool { return runner.processed() == 2 })
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("digests emitted after %v, before the window", elapsed)
+	}
+
+	for i, data := range runner.data {
+		var digest digestPayload
+		if err := json.Unmarshal([]byte(data), &digest); err != nil {
+			t.Fatalf("invalid digest %s: %v", data, err)
+		}
+		meta := runner.metadata[i]
+		if meta["service"] != digest.Key || meta[metaDigestKey] != digest.Key {
+			t.Errorf("digest metadata = %v", meta)
+		}
+		switch digest.Key {
+		case "api":
+			if digest.Count != 4 || digest.Truncated != 1 || len(digest.Entries) != 2 ||
+				digest.Entries[0] != (digestEntry{Line: "error: timeout", Count: 2}) || meta[metaDigestTruncated] != "1" {
+				t.Errorf("api digest = %+v", digest)
+			}
+		case "db":
+			if digest.Count != 1 || digest.Entries[0].Line != "error: deadlock" {
+				t.Errorf("db digest = %+v", digest)
+			}
+		default:
+			t.Errorf("unexpected digest key %q", digest.Key)
+		}
+	}
+}
+
+func TestDigestIfAndFilterExpr(t *testing.T) {
+	runner := &recordingRunner{}
+	src := startDigestBridge(t, connectors.RunnerConfig{
+		IfExpr:     `metadata.level != "debug"`,
+		FilterExpr: `metadata.level == "error"`,
+		Options:    map[string]any{"window": 50 * time.Millisecond},
+	}, runner, nil)
+
+	send := func(data, level string) *countingMessage {
+		m := &countingMessage{Adapter: testutil.NewAdapter([]byte(data), map[string]string{"level": level})}
+		src.c <- message.NewRunnerMessage(m)
+		return m
+	}
+	msgs := []*countingMessage{send("timeout", "error"), send("trace", "debug"), send("slow", "warn"), send("refused", "error")}
+	waitFor(t, func() bool { return runner.processed() == 2 })
+	for i, m := range msgs {
+		if m.acks.Load() != 1 {
+			t.Errorf("message %d acks = %d", i, m.acks.Load())
+		}
+	}
+
+	// The message not matching the ifExpr passes on alone, the one not matching the
+	// filterExpr is left out of the digest
+	if runner.data[0] != "trace" {
+		t.Errorf("processed = %q", runner.data)
+	}
+	var digest digestPayload
+	if err := json.Unmarshal([]byte(runner.data[1]), &digest); err != nil {
+		t.Fatalf("invalid digest %s: %v", runner.data[1], err)
+	}
+	if digest.Count != 2 || len(digest.Entries) != 2 || digest.Entries[0].Line != "timeout" || digest.Entries[1].Line != "refused" {
+		t.Errorf("digest = %+v", digest)
+	}
+}
+
+func TestDigestDeadLetter(t *testing.T) {
+	target := &recordingRunner{}
+	failing := &funcRunner{process: func(*message.RunnerMessage) error { return errors.New("send failed") }}
+	src := startDigestBridge(t, connectors.RunnerConfig{Options: map[string]any{"window": 20 * time.Millisecond, "keyFrom": "service"}},
+		failing, &deadLetter{runner: target})
+
+	src.c <- message.NewRunnerMessage(&countingMessage{Adapter: testutil.NewAdapter([]byte("disk full"), map[string]string{"service": "db"})})
+	waitFor(t, func() bool { return target.processed() == 1 })
+
+	// The dead-letter target receives the digest, not an empty payload
+	var digest digestPayload
+	if err := json.Unmarshal([]byte(target.data[0]), &digest); err != nil {
+		t.Fatalf("invalid dead-lettered digest %q: %v", target.data[0], err)
+	}
+	if digest.Key != "db" || digest.Count != 1 || digest.Entries[0].Line != "disk full" {
+		t.Errorf("dead-lettered digest = %+v", digest)
+	}
+	if meta := target.metadata[0]; meta["service"] != "db" || meta[metaDigestCount] != "1" {
+		t.Errorf("dead-lettered metadata = %v", meta)
+	}
+}
+
+func TestDigestTextAndMaxKeys(t *testing.T) {
+	d, err := newDigester(digestRunnerConfig{Window: time.Hour, Format: digestFormatText, MaxBytes: 8, KeyFrom: "k", MaxKeys: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := &pendingDigest{index: map[string]int{}}
+	for _, line := range []string{"disk", "disk", "cpu", "memory"} {
+		d.add(pending, line)
+	}
+	data, err := d.encode(pending, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "disk (x2)\ncpu\n... 1 more messages truncated\n" {
+		t.Errorf("text digest = %q", data)
+	}
+
+	// A new key over maxKeys emits the oldest digest
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger(), activity: newActivityTracker()}
+	digests := map[string]*pendingDigest{}
+	var emitted []string
+	emit := func(key string) {
+		emitted = append(emitted, key)
+		delete(digests, key)
+	}
+	for _, k := range []string{"a", "b"} {
+		m := message.NewRunnerMessage(&countingMessage{Adapter: testutil.NewAdapter([]byte("x"), map[string]string{"k": k})})
+		b.addToDigest(m, d, digests, emit)
+	}
+	if len(emitted) != 1 || emitted[0] != "a" || digests["b"] == nil {
+		t.Errorf("emitted = %v, digests = %v", emitted, digests)
+	}
+}
+
+func TestDigestConfig(t *testing.T) {
+	if _, err := newDigester(digestRunnerConfig{}); err == nil {
+		t.Error("expected missing window error")
+	}
+	if _, err := newDigester(digestRunnerConfig{Window: time.Second, Line: "{{.data"}); err == nil {
+		t.Error("expected invalid template error")
+	}
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	if _, err := b.createRunner(connectors.RunnerConfig{Type: digestRunnerType}); !errors.Is(err, errDigestNested) {
+		t.Errorf("createRunner() error = %v, want errDigestNested", err)
+	}
+}
@@ -0,0 +1,158 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/tracing"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// drainPollInterval is how often Drain checks the number of in-flight messages
+const drainPollInterval = 10 * time.Millisecond
+
+// trackedMessage decrements the in-flight counter of the bridge
+// the first time the message is acked or naked, counting the outcome in the metrics
+// and ending the span of the message
+type trackedMessage struct {
+	message.SourceMessage
+	once     sync.Once
+	inFlight *atomic.Int64
+	source   string
+	ingress  time.Time
+	span     *tracing.Span
+}
+
+func (m *trackedMessage) Ack(d *message.ReplyData) error {
+	defer m.done(outcomeAck)
+	return m.SourceMessage.Ack(d)
+}
+
+func (m *trackedMessage) Nak() error {
+	defer m.done(outcomeNak)
+	return m.SourceMessage.Nak()
+}
+
+func (m *trackedMessage) done(outcome string) {
+	m.once.Do(func() {
+		m.inFlight.Add(-1)
+		settled(m.source, outcome, m.ingress)
+		if outcome == outcomeNak {
+			m.span.SetError(errNaked)
+		}
+		m.span.End()
+	})
+}
+
+// track forwards the source messages to the pipeline, counting them as in flight
+// until they are acked or naked. While draining, new messages are naked so that the
+// source can redeliver them to another consumer. While the pipeline is paused, no message is
+// received from the source. Forwarding stops when the context is cancelled.
+func (b *EventsBridge) track(ctx context.Context, c <-chan *message.RunnerMessage) <-chan *message.RunnerMessage {
+	out := make(chan *message.RunnerMessage)
+	source := b.activity.stage(stageSource, b.cfg.Source.Type)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-c:
+				if !ok {
+					return
+				}
+				// While paused, the message waits before the pipeline and the following ones
+				// in the source, slowing it down through backpressure
+				if err := b.valve.wait(ctx); err != nil {
+					if err := msg.Nak(); err != nil {
+						b.logger.Error("failed to nak message on stop", "error", err)
+					}
+					return
+				}
+				label := b.sourceLabel(msg)
+				sourceMessages.With(label).Inc()
+				if b.draining.Load() {
+					settled(label, outcomeNak, time.Time{})
+					if err := msg.Nak(); err != nil {
+						b.logger.Error("failed to nak message while draining", "error", err)
+					}
+					continue
+				}
+				if b.workDir.overQuota() {
+					settled(label, outcomeNak, time.Time{})
+					b.HandleError(msg, errWorkDirQuota, "message rejected", "workDir", b.workDir.path)
+					continue
+				}
+				source.observe()
+				b.inFlight.Add(1)
+				var src message.SourceMessage = msg
+				if b.replyPlan != nil {
+					src = b.replyPlan.wrap(msg)
+				}
+				span := traceMessage(msg, label)
+				tracked := message.NewRunnerMessage(&trackedMessage{
+					SourceMessage: src,
+					inFlight:      &b.inFlight,
+					source:        label,
+					ingress:       msg.GetIngressTime(),
+					span:          span,
+				})
+				tracked.SetIngressTime(msg.GetIngressTime())
+				tracked.SetTraceContext(span.Context())
+				select {
+				case out <- tracked:
+				case <-ctx.Done():
+					// The pipeline is stopping: give the message back to the source
+					if err := tracked.Nak(); err != nil {
+						b.logger.Error("failed to nak message on stop", "error", err)
+					}
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// InFlight returns the number of messages received from the source
+// that have not been acked or naked yet
+func (b *EventsBridge) InFlight() int64 {
+	return b.inFlight.Load()
+}
+
+// Drain stops accepting new messages and waits for the in-flight messages to complete,
+// drains the lifecycle runners, then closes the source and stops the pipeline.
+// If the context expires first, the pipeline is stopped anyway and an error is returned.
+func (b *EventsBridge) Drain(ctx context.Context) error {
+	b.draining.Store(true)
+
+	defer func() {
+		// The source is closed only once in-flight messages are settled,
+		// as acks may need the source connection
+		if b.source != nil && b.sourceClosed.CompareAndSwap(false, true) {
+			if err := b.source.Close(); err != nil {
+				b.logger.Warn("failed to close source while draining", "error", err)
+			}
+		}
+		b.stopMu.Lock()
+		if b.stop != nil {
+			b.stop()
+		}
+		b.stopMu.Unlock()
+	}()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for b.inFlight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("drain interrupted with %d messages in flight: %w", b.inFlight.Load(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	// Runners flush their state once no message can reach them anymore
+	return b.drainRunners(ctx)
+}
@@ -0,0 +1,138 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/sandrolain/events-bridge/src/common/expreval"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// filterRunnerType is the built-in runner type dropping the messages by their content
+const filterRunnerType = "filter"
+
+const (
+	filterFormatAuto = "auto"
+	filterFormatJSON = "json"
+	filterFormatCBOR = "cbor"
+	filterFormatRaw  = "raw"
+)
+
+// filterRunnerConfig holds the options of the filter runner
+type filterRunnerConfig struct {
+	// Expression is the expr-lang condition of the messages passed on, evaluated with the
+	// decoded payload in data and the metadata in metadata
+	Expression string `mapstructure:"expression" validate:"required"`
+	// Format is the decoding of the payload: "auto" (default: JSON, then CBOR, the raw string
+	// otherwise), "json", "cbor" or "raw" (the payload as a string)
+	Format string `mapstructure:"format" default:"auto" validate:"oneof=auto json cbor raw"`
+	// MaxExpressionLength bounds the length of the expression
+	MaxExpressionLength int `mapstructure:"maxExpressionLength" default:"10000" validate:"gt=0,lte=100000"`
+	// MaxInputSize bounds the size of the decoded payloads
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"gt=0"` // 1MB default
+}
+
+// filteredError reports a message dropped by a filter runner: the message is acked without
+// going on, and the error is not retried
+type filteredError struct {
+	expression string
+}
+
+func (e *filteredError) Error() string {
+	return fmt.Sprintf("message filtered out by expression: %s", e.expression)
+}
+
+func (e *filteredError) Retryable() bool {
+	return false
+}
+
+// isFiltered reports whether the error reports a message dropped by a filter runner
+func isFiltered(err error) bool {
+	var fe *filteredError
+	return errors.As(err, &fe)
+}
+
+// filterRunner passes on the messages matching its expression
+type filterRunner struct {
+	cfg  filterRunnerConfig
+	eval *expreval.ExprEvaluator
+	cbor cbor.DecMode
+}
+
+// createFilterRunner creates the filter runner of the options, compiling its expression
+func (b *EventsBridge) createFilterRunner(runnerConfig connectors.RunnerConfig) (*filterRunner, error) {
+	cfg := new(filterRunnerConfig)
+	if err := b.parseRunnerOptions(runnerConfig, cfg); err != nil {
+		return nil, err
+	}
+	eval, err := expreval.NewExprEvaluatorWithConfig(expreval.Config{
+		Expression:          cfg.Expression,
+		MaxExpressionLength: cfg.MaxExpressionLength,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression: %w", err)
+	}
+	// The CBOR maps are decoded with string keys, as the JSON objects
+	dm, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any{})}.DecMode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CBOR decoder: %w", err)
+	}
+	return &filterRunner{cfg: *cfg, eval: eval, cbor: dm}, nil
+}
+
+// decode returns the payload in the configured format
+func (r *filterRunner) decode(data []byte) (any, error) {
+	var v any
+	switch r.cfg.Format {
+	case filterFormatRaw:
+		return string(data), nil
+	case filterFormatJSON:
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("payload must be JSON: %w", err)
+		}
+		return v, nil
+	case filterFormatCBOR:
+		if err := r.cbor.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("payload must be CBOR: %w", err)
+		}
+		return v, nil
+	}
+	if json.Unmarshal(data, &v) == nil {
+		return v, nil
+	}
+	if r.cbor.Unmarshal(data, &v) == nil {
+		return v, nil
+	}
+	return string(data), nil
+}
+
+// Process evaluates the expression, returning a filteredError when the message does not match
+func (r *filterRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	if len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds maximum %d", len(data), r.cfg.MaxInputSize)
+	}
+	payload, err := r.decode(data)
+	if err != nil {
+		return err
+	}
+	pass, err := r.eval.Eval(map[string]any{"data": payload, "metadata": meta})
+	if err != nil {
+		return fmt.Errorf("failed to evaluate filter expression: %w", err)
+	}
+	if !pass {
+		return &filteredError{expression: r.cfg.Expression}
+	}
+	return nil
+}
+
+func (r *filterRunner) Close() error {
+	return nil
+}
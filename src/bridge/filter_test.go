@@ -0,0 +1,114 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func newTestFilterRunner(t *testing.T, opts map[string]any) *filterRunner {
+	t.Helper()
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	r, err := b.createFilterRunner(connectors.RunnerConfig{Type: filterRunnerType, Options: opts})
+	if err != nil {
+		t.Fatalf("createFilterRunner() unexpected error = %v", err)
+	}
+	return r
+}
+
+func TestFilterRunnerFormats(t *testing.T) {
+	r := newTestFilterRunner(t, map[string]any{"expression": `data.amount > 100 && metadata.region == "eu"`})
+	cborData, err := cbor.Marshal(map[string]any{"amount": 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		data   []byte
+		region string
+		pass   bool
+	}{
+		{[]byte(`{"amount": 150}`), "eu", true},
+		{[]byte(`{"amount": 50}`), "eu", false},
+		{[]byte(`{"amount": 150}`), "us", false},
+		{cborData, "eu", true},
+	} {
+		msg := message.NewRunnerMessage(testutil.NewAdapter(tc.data, map[string]string{"region": tc.region}))
+		err := r.Process(msg)
+		if err != nil && !isFiltered(err) {
+			t.Fatalf("Process(%q) unexpected error = %v", tc.data, err)
+		}
+		if pass := err == nil; pass != tc.pass {
+			t.Errorf("Process(%q, %s) passed = %v, want %v", tc.data, tc.region, pass, tc.pass)
+		}
+	}
+
+	raw := newTestFilterRunner(t, map[string]any{"expression": `data startsWith "ALERT"`, "format": "raw"})
+	if err := raw.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("ALERT disk full"), nil))); err != nil {
+		t.Errorf("raw Process() error = %v", err)
+	}
+	strict := newTestFilterRunner(t, map[string]any{"expression": `data.ok`, "format": "json"})
+	if err := strict.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("not json"), nil))); err == nil || isFiltered(err) {
+		t.Errorf("json Process() error = %v, want a decoding error", err)
+	}
+}
+
+func TestFilterPipeline(t *testing.T) {
+	runner := &recordingRunner{}
+	src := newChanSource()
+	b := &EventsBridge{
+		cfg:      newTestConfig(),
+		logger:   newTestLogger(),
+		source:   src,
+		activity: newActivityTracker(),
+	}
+	filter := newTestFilterRunner(t, map[string]any{"expression": `data.level == "error"`})
+	b.runners = []RunnerItem{
+		{Config: connectors.RunnerConfig{Type: filterRunnerType}, Runner: filter},
+		{Config: connectors.RunnerConfig{Type: "test"}, Runner: runner},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+
+	dropped, passed := newCountingMessage(`{"level":"info"}`), newCountingMessage(`{"level":"error"}`)
+	src.c <- message.NewRunnerMessage(dropped)
+	src.c <- message.NewRunnerMessage(passed)
+	waitFor(t, func() bool { return dropped.acks.Load() == 1 && passed.acks.Load() == 1 })
+	if runner.processed() != 1 || runner.data[0] != `{"level":"error"}` {
+		t.Errorf("processed = %v, want the error message only", runner.data)
+	}
+	if dropped.naks.Load() != 0 {
+		t.Error("filtered message naked")
+	}
+}
+
+func TestFilterInBranch(t *testing.T) {
+	filter := newTestFilterRunner(t, map[string]any{"expression": `data.n > 1`})
+	stages := []branchStage{{runner: filter}, {runner: metadataRunner("reached", "yes")}}
+	for data, want := range map[string]bool{`{"n": 2}`: true, `{"n": 1}`: false} {
+		msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(data), nil))
+		_, passed, err := runBranch(msg, stages)
+		if err != nil || passed != want {
+			t.Errorf("runBranch(%s) = %v, %v, want %v", data, passed, err, want)
+		}
+	}
+}
+
+func TestFilterRunnerConfig(t *testing.T) {
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	for name, opts := range map[string]map[string]any{
+		"missing expression": {},
+		"invalid expression": {"expression": "data.n >"},
+		"invalid format":     {"expression": "true", "format": "xml"},
+	} {
+		if _, err := b.createRunner(connectors.RunnerConfig{Type: filterRunnerType, Options: opts}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
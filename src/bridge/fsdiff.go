@@ -0,0 +1,293 @@
+package bridge
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	fsdiffOutputMetadata = "metadata"
+	fsdiffOutputPayload  = "payload"
+
+	defaultFSDiffManifestKey = "eb-fs-manifest"
+	defaultFSDiffMaxFiles    = 10000
+)
+
+// Ensure fsdiffRunner implements connectors.LifecycleRunner
+var _ connectors.LifecycleRunner = (*fsdiffRunner)(nil)
+
+// fsdiffRunner runs a runner chain between two snapshots of a directory and reports
+// the files the chain changed. Messages are processed one at a time, so that the
+// changes of concurrent executions in the shared directory are not mixed up.
+type fsdiffRunner struct {
+	dir         string
+	stages      []branchStage
+	include     []string
+	exclude     []string
+	output      string
+	manifestKey string
+	maxFiles    int
+	mu          sync.Mutex
+	logger      *slog.Logger
+}
+
+// fsEntry is a regular file of a directory snapshot
+type fsEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// fsModified is a file whose content changed between the snapshots
+type fsModified struct {
+	fsEntry
+	PreviousSize   int64  `json:"previousSize"`
+	PreviousSHA256 string `json:"previousSha256"`
+}
+
+// fsManifest lists the files added, modified and deleted by a runner chain, sorted by path
+type fsManifest struct {
+	Added    []fsEntry    `json:"added"`
+	Modified []fsModified `json:"modified"`
+	Deleted  []fsEntry    `json:"deleted"`
+}
+
+// fsdiffRunnerConfig holds the options of the fsdiff runner
+type fsdiffRunnerConfig struct {
+	// Dir is the directory to snapshot
+	Dir string `mapstructure:"dir" validate:"required"`
+	// Runners is the runner chain executed between the snapshots
+	Runners []connectors.RunnerConfig `mapstructure:"runners" validate:"required,min=1,dive"`
+	// Include are glob patterns of the slash-separated paths relative to Dir to report (all if empty)
+	Include []string `mapstructure:"include"`
+	// Exclude are glob patterns of the paths not to report, e.g. temporary files
+	Exclude []string `mapstructure:"exclude"`
+	// Output is "metadata" (default, the manifest JSON is set in ManifestKey) or
+	// "payload" (the manifest replaces the payload)
+	Output string `mapstructure:"output" validate:"omitempty,oneof=metadata payload"`
+	// ManifestKey is the metadata key of the manifest (default: "eb-fs-manifest")
+	ManifestKey string `mapstructure:"manifestKey"`
+	// MaxFiles fails the message when a snapshot holds more files (default: 10000)
+	MaxFiles int `mapstructure:"maxFiles" validate:"min=0"`
+}
+
+// createFSDiffRunner builds the runner chain of a "fsdiff" runner configuration
+func (b *EventsBridge) createFSDiffRunner(runnerConfig connectors.RunnerConfig) (connectors.Runner, error) {
+	fsd := new(fsdiffRunnerConfig)
+	if err := b.parseRunnerOptions(runnerConfig, fsd); err != nil {
+		return nil, err
+	}
+	for _, pattern := range slices.Concat(fsd.Include, fsd.Exclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid fsdiff pattern %q: %w", pattern, err)
+		}
+	}
+
+	fr := &fsdiffRunner{
+		dir:         fsd.Dir,
+		include:     fsd.Include,
+		exclude:     fsd.Exclude,
+		output:      fsd.Output,
+		manifestKey: fsd.ManifestKey,
+		maxFiles:    fsd.MaxFiles,
+		logger:      b.logger.With("component", "fsdiff"),
+	}
+	if fr.output == "" {
+		fr.output = fsdiffOutputMetadata
+	}
+	if fr.manifestKey == "" {
+		fr.manifestKey = defaultFSDiffManifestKey
+	}
+	if fr.maxFiles == 0 {
+		fr.maxFiles = defaultFSDiffMaxFiles
+	}
+
+	var err error
+	if fr.stages, err = b.createStages(fsd.Runners); err != nil {
+		return nil, fmt.Errorf("fsdiff chain: %w", err)
+	}
+	return fr, nil
+}
+
+// Process runs the chain between two snapshots and sets the manifest of the changes,
+// together with the eb-fs-added, eb-fs-modified and eb-fs-deleted counts.
+// A filterExpr evaluating to false inside the chain skips the rest of the chain.
+func (r *fsdiffRunner) Process(msg *message.RunnerMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, err := r.snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot %s before the chain: %w", r.dir, err)
+	}
+	if _, _, err := runBranch(msg, r.stages); err != nil {
+		return fmt.Errorf("fsdiff chain: %w", err)
+	}
+	after, err := r.snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot %s after the chain: %w", r.dir, err)
+	}
+
+	manifest := diffSnapshots(before, after)
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	r.logger.Debug("directory changes",
+		"added", len(manifest.Added), "modified", len(manifest.Modified), "deleted", len(manifest.Deleted))
+
+	msg.AddMetadata("eb-fs-added", strconv.Itoa(len(manifest.Added)))
+	msg.AddMetadata("eb-fs-modified", strconv.Itoa(len(manifest.Modified)))
+	msg.AddMetadata("eb-fs-deleted", strconv.Itoa(len(manifest.Deleted)))
+	if r.output == fsdiffOutputPayload {
+		msg.SetData(data)
+	} else {
+		msg.AddMetadata(r.manifestKey, string(data))
+	}
+	return nil
+}
+
+// selected reports whether the relative path is reported by the manifest
+func (r *fsdiffRunner) selected(rel string) bool {
+	match := func(patterns []string) bool {
+		return slices.ContainsFunc(patterns, func(p string) bool {
+			ok, _ := path.Match(p, rel)
+			return ok
+		})
+	}
+	if len(r.include) > 0 && !match(r.include) {
+		return false
+	}
+	return !match(r.exclude)
+}
+
+// snapshot returns the selected regular files of the directory by relative path.
+// Symbolic links are not followed; a missing directory is an empty snapshot.
+func (r *fsdiffRunner) snapshot() (map[string]fsEntry, error) {
+	files := map[string]fsEntry{}
+	err := filepath.WalkDir(r.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == r.dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(r.dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !r.selected(rel) {
+			return nil
+		}
+		if len(files) >= r.maxFiles {
+			return fmt.Errorf("more than %d files", r.maxFiles)
+		}
+		entry, err := hashFile(p)
+		if err != nil {
+			// The file was removed while walking the directory
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		entry.Path = rel
+		files[rel] = entry
+		return nil
+	})
+	return files, err
+}
+
+// hashFile returns the size and the SHA-256 hash of the file
+func hashFile(p string) (fsEntry, error) {
+	f, err := os.Open(p) //nolint:gosec // path under the configured directory
+	if err != nil {
+		return fsEntry{}, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return fsEntry{}, err
+	}
+	return fsEntry{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// diffSnapshots compares the snapshots taken before and after the chain
+func diffSnapshots(before, after map[string]fsEntry) fsManifest {
+	manifest := fsManifest{Added: []fsEntry{}, Modified: []fsModified{}, Deleted: []fsEntry{}}
+	for p, entry := range after {
+		prev, ok := before[p]
+		switch {
+		case !ok:
+			manifest.Added = append(manifest.Added, entry)
+		case prev.SHA256 != entry.SHA256:
+			manifest.Modified = append(manifest.Modified, fsModified{
+				fsEntry:        entry,
+				PreviousSize:   prev.Size,
+				PreviousSHA256: prev.SHA256,
+			})
+		}
+	}
+	for p, entry := range before {
+		if _, ok := after[p]; !ok {
+			manifest.Deleted = append(manifest.Deleted, entry)
+		}
+	}
+	byPath := func(a, b fsEntry) int { return cmp.Compare(a.Path, b.Path) }
+	slices.SortFunc(manifest.Added, byPath)
+	slices.SortFunc(manifest.Deleted, byPath)
+	slices.SortFunc(manifest.Modified, func(a, b fsModified) int { return byPath(a.fsEntry, b.fsEntry) })
+	return manifest
+}
+
+// Start calls the Start hook of the chain runners implementing connectors.LifecycleRunner
+func (r *fsdiffRunner) Start(ctx context.Context) error {
+	for j, stage := range r.stages {
+		if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+			if err := lr.Start(ctx); err != nil {
+				return fmt.Errorf("failed to start runner %d of fsdiff chain: %w", j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Drain calls the Drain hook of the chain runners implementing connectors.LifecycleRunner
+func (r *fsdiffRunner) Drain(ctx context.Context) error {
+	var errs []error
+	for j, stage := range r.stages {
+		if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+			if err := lr.Drain(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("failed to drain runner %d of fsdiff chain: %w", j, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the runners of the chain
+func (r *fsdiffRunner) Close() error {
+	return closeStages(r.stages)
+}
@@ -0,0 +1,165 @@
+package bridge
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func newTestFSDiffRunner(dir string, chain connectors.Runner) *fsdiffRunner {
+	return &fsdiffRunner{
+		dir:         dir,
+		stages:      []branchStage{{runner: chain}},
+		output:      fsdiffOutputMetadata,
+		manifestKey: defaultFSDiffManifestKey,
+		maxFiles:    defaultFSDiffMaxFiles,
+		logger:      newTestLogger(),
+	}
+}
+
+func writeTestFile(t *testing.T, p, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSDiffRunnerManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "keep.txt"), "same")
+	writeTestFile(t, filepath.Join(dir, "out", "report.txt"), "v1")
+	writeTestFile(t, filepath.Join(dir, "old.log"), "bye")
+
+	chain := &funcRunner{process: func(msg *message.RunnerMessage) error {
+		writeTestFile(t, filepath.Join(dir, "out", "report.txt"), "version 2")
+		writeTestFile(t, filepath.Join(dir, "out", "new.bin"), "artifact")
+		writeTestFile(t, filepath.Join(dir, "tmp.swp"), "scratch")
+		if err := os.Remove(filepath.Join(dir, "old.log")); err != nil {
+			return err
+		}
+		msg.SetData([]byte("executed"))
+		return nil
+	}}
+	fr := newTestFSDiffRunner(dir, chain)
+	fr.exclude = []string{"*.swp"}
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil))
+	if err := fr.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "executed" {
+		t.Errorf("payload = %q, want the chain result", data)
+	}
+	if meta["eb-fs-added"] != "1" || meta["eb-fs-modified"] != "1" || meta["eb-fs-deleted"] != "1" {
+		t.Errorf("unexpected counts in %v", meta)
+	}
+
+	var manifest fsManifest
+	if err := json.Unmarshal([]byte(meta[defaultFSDiffManifestKey]), &manifest); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	// sha256("artifact")
+	const artifactHash = "c7c5c1d70c5dec4416ab6158afd0b223ef40c29b1dc1f97ed9428b94d4cadb1c"
+	if len(manifest.Added) != 1 || manifest.Added[0].Path != "out/new.bin" || manifest.Added[0].Size != 8 ||
+		manifest.Added[0].SHA256 != artifactHash {
+		t.Errorf("unexpected added files %+v", manifest.Added)
+	}
+	if len(manifest.Modified) != 1 || manifest.Modified[0].Path != "out/report.txt" ||
+		manifest.Modified[0].Size != 9 || manifest.Modified[0].PreviousSize != 2 ||
+		manifest.Modified[0].SHA256 == manifest.Modified[0].PreviousSHA256 {
+		t.Errorf("unexpected modified files %+v", manifest.Modified)
+	}
+	if len(manifest.Deleted) != 1 || manifest.Deleted[0].Path != "old.log" {
+		t.Errorf("unexpected deleted files %+v", manifest.Deleted)
+	}
+}
+
+func TestFSDiffRunnerPayloadOutput(t *testing.T) {
+	dir := t.TempDir()
+	chain := &funcRunner{process: func(msg *message.RunnerMessage) error {
+		writeTestFile(t, filepath.Join(dir, "a.json"), "{}")
+		writeTestFile(t, filepath.Join(dir, "b.txt"), "text")
+		return nil
+	}}
+	fr := newTestFSDiffRunner(dir, chain)
+	fr.output = fsdiffOutputPayload
+	fr.include = []string{"*.json"}
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil))
+	if err := fr.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	data, err := msg.GetData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest fsManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("invalid manifest payload %s: %v", data, err)
+	}
+	if len(manifest.Added) != 1 || manifest.Added[0].Path != "a.json" {
+		t.Errorf("unexpected added files %+v", manifest.Added)
+	}
+}
+
+func TestFSDiffRunnerLimits(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a"), "1")
+	writeTestFile(t, filepath.Join(dir, "b"), "2")
+
+	fr := newTestFSDiffRunner(dir, metadataRunner("k", "v"))
+	fr.maxFiles = 1
+	if err := fr.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil))); err == nil {
+		t.Error("Process() expected error for too many files")
+	}
+
+	// A directory created by the chain starts from an empty snapshot
+	missing := filepath.Join(dir, "missing")
+	fr = newTestFSDiffRunner(missing, &funcRunner{process: func(*message.RunnerMessage) error {
+		writeTestFile(t, filepath.Join(missing, "created"), "x")
+		return nil
+	}})
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil))
+	if err := fr.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if meta, _ := msg.GetMetadata(); meta["eb-fs-added"] != "1" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+}
+
+func TestCreateFSDiffRunnerInvalid(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	chain := []any{map[string]any{"type": "pass"}}
+
+	for _, opts := range []map[string]any{
+		nil,
+		{"dir": t.TempDir()},
+		{"runners": chain},
+		{"dir": t.TempDir(), "runners": chain, "include": []any{"["}},
+	} {
+		if _, err := bridge.createRunner(connectors.RunnerConfig{Type: "fsdiff", Options: opts}); err == nil {
+			t.Errorf("createRunner() expected error for %+v", opts)
+		}
+	}
+
+	r, err := bridge.createRunner(connectors.RunnerConfig{Type: "fsdiff", Options: map[string]any{"dir": t.TempDir(), "runners": chain}})
+	if err != nil {
+		t.Fatalf("createRunner() unexpected error = %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+}
@@ -0,0 +1,346 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/sandrolain/events-bridge/src/common/expreval"
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// graphRunnerType is the runner type reported for the stage running the pipeline graph
+const graphRunnerType = "pipeline"
+
+// Ensure graphRunner implements connectors.LifecycleRunner
+var _ connectors.LifecycleRunner = (*graphRunner)(nil)
+
+// graphEdge is an outgoing edge of a graph node
+type graphEdge struct {
+	to        int
+	when      *expreval.ExprEvaluator
+	isDefault bool
+}
+
+// graphNode is a named stage of the pipeline graph
+type graphNode struct {
+	name   string
+	join   string
+	stages []branchStage
+	next   []graphEdge
+}
+
+// graphRunner runs the messages through a directed acyclic graph of stages.
+// The nodes are in topological order, the entry node first, and grouped in levels:
+// the nodes of a level only depend on the nodes of the previous levels and run concurrently.
+type graphRunner struct {
+	nodes   []graphNode
+	levels  [][]int
+	lineage *lineageTracker
+	logger  *slog.Logger
+}
+
+// createGraphRunner validates the pipeline graph and builds the runners of its stages
+func (b *EventsBridge) createGraphRunner(cfg config.PipelineConfig) (*graphRunner, error) {
+	order, levels, err := sortPipeline(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// position maps the stage names to their node index
+	position := make(map[string]int, len(order))
+	for i, s := range order {
+		position[cfg.Stages[s].Name] = i
+	}
+
+	gr := &graphRunner{
+		nodes:   make([]graphNode, len(order)),
+		lineage: b.lineage,
+		logger:  b.logger.With("component", "pipeline"),
+	}
+	for i, s := range order {
+		stageCfg := cfg.Stages[s]
+		node := graphNode{name: stageCfg.Name, join: stageCfg.Join}
+		if node.join == "" {
+			node.join = joinMerge
+		}
+		for _, edge := range stageCfg.Next {
+			when, err := expreval.NewExprEvaluator(edge.When)
+			if err != nil {
+				gr.Close() //nolint:errcheck
+				return nil, fmt.Errorf("stage %q: edge to %q: failed to create when evaluator: %w", stageCfg.Name, edge.To, err)
+			}
+			node.next = append(node.next, graphEdge{to: position[edge.To], when: when, isDefault: edge.Default})
+		}
+		if node.stages, err = b.createStages(stageCfg.Runners); err != nil {
+			gr.Close() //nolint:errcheck
+			return nil, fmt.Errorf("stage %q: %w", stageCfg.Name, err)
+		}
+		gr.nodes[i] = node
+	}
+
+	gr.levels = make([][]int, slices.Max(levels)+1)
+	for i, level := range levels {
+		gr.levels[level] = append(gr.levels[level], i)
+	}
+	return gr, nil
+}
+
+// sortPipeline checks the stage references of the graph and returns the stage indexes in
+// topological order, the entry first, together with the level of every sorted stage.
+// Cycles and stages not reachable from the entry are rejected.
+func sortPipeline(cfg config.PipelineConfig) ([]int, []int, error) {
+	index := make(map[string]int, len(cfg.Stages))
+	for i, s := range cfg.Stages {
+		if _, ok := index[s.Name]; ok {
+			return nil, nil, fmt.Errorf("duplicate pipeline stage %q", s.Name)
+		}
+		index[s.Name] = i
+	}
+	entry, ok := index[cfg.Entry]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown pipeline entry stage %q", cfg.Entry)
+	}
+
+	reached := make([]bool, len(cfg.Stages))
+	reached[entry] = true
+	queue := []int{entry}
+	indegree := make([]int, len(cfg.Stages))
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for _, edge := range cfg.Stages[s].Next {
+			to, ok := index[edge.To]
+			if !ok {
+				return nil, nil, fmt.Errorf("stage %q: unknown next stage %q", cfg.Stages[s].Name, edge.To)
+			}
+			indegree[to]++
+			if !reached[to] {
+				reached[to] = true
+				queue = append(queue, to)
+			}
+		}
+	}
+	for i, s := range cfg.Stages {
+		if !reached[i] {
+			return nil, nil, fmt.Errorf("stage %q is not reachable from the entry stage", s.Name)
+		}
+	}
+
+	// Kahn's algorithm from the entry: the stages left unsorted are in a cycle
+	level := make([]int, len(cfg.Stages))
+	order := make([]int, 0, len(cfg.Stages))
+	if indegree[entry] == 0 {
+		order = append(order, entry)
+	}
+	for i := 0; i < len(order); i++ {
+		s := order[i]
+		for _, edge := range cfg.Stages[s].Next {
+			to := index[edge.To]
+			level[to] = max(level[to], level[s]+1)
+			if indegree[to]--; indegree[to] == 0 {
+				order = append(order, to)
+			}
+		}
+	}
+	if len(order) < len(cfg.Stages) {
+		for _, s := range order {
+			indegree[s] = -1
+		}
+		for i, s := range cfg.Stages {
+			if indegree[i] >= 0 {
+				return nil, nil, fmt.Errorf("stage %q is in a cycle of the pipeline", s.Name)
+			}
+		}
+	}
+
+	levels := make([]int, len(order))
+	for i, s := range order {
+		levels[i] = level[s]
+	}
+	return order, levels, nil
+}
+
+// graphResult is the outcome of a node execution
+type graphResult struct {
+	node   int
+	msg    *message.RunnerMessage
+	passed bool
+	err    error
+}
+
+// Process runs the message through the graph, level by level. Every matching edge receives
+// its own copy of the stage result. The message takes the result of the reached sink stages:
+// their metadata merged in stage order and the payload of the last one. A message filtered
+// out on every path is left unchanged.
+func (r *graphRunner) Process(msg *message.RunnerMessage) error {
+	inputs := make([][]*message.RunnerMessage, len(r.nodes))
+	inputs[0] = []*message.RunnerMessage{msg}
+
+	var sinks []*message.RunnerMessage
+	for _, level := range r.levels {
+		results := r.runLevel(level, inputs)
+
+		var errs []error
+		for _, res := range results {
+			if res.err != nil {
+				errs = append(errs, fmt.Errorf("stage %q: %w", r.nodes[res.node].name, res.err))
+			}
+		}
+		if len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+
+		for _, res := range results {
+			if !res.passed {
+				continue
+			}
+			node := r.nodes[res.node]
+			if len(node.next) == 0 {
+				sinks = append(sinks, res.msg)
+				continue
+			}
+			targets, err := node.route(res.msg)
+			if err != nil {
+				return fmt.Errorf("stage %q: %w", node.name, err)
+			}
+			for _, to := range targets {
+				inputs[to] = append(inputs[to], res.msg.Clone())
+			}
+		}
+	}
+
+	if len(sinks) == 0 {
+		r.logger.Debug("message filtered out on every pipeline path")
+		return nil
+	}
+	for i, sink := range sinks {
+		meta, data, err := sink.GetMetadataAndData()
+		if err != nil {
+			return fmt.Errorf("pipeline sink %d: %w", i, err)
+		}
+		msg.MergeMetadata(meta)
+		if i == len(sinks)-1 {
+			msg.SetData(data)
+		}
+	}
+	return nil
+}
+
+// runLevel runs concurrently the nodes of a level that received at least an input
+func (r *graphRunner) runLevel(level []int, inputs [][]*message.RunnerMessage) []graphResult {
+	results := make([]graphResult, 0, len(level))
+	for _, n := range level {
+		if len(inputs[n]) > 0 {
+			results = append(results, graphResult{node: n})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(res *graphResult) {
+			defer wg.Done()
+			node := r.nodes[res.node]
+			in, err := node.joinInputs(inputs[res.node])
+			if err != nil {
+				res.err = err
+				return
+			}
+			before := r.lineage.snapshot(in)
+			res.msg, res.passed, res.err = runBranch(in, node.stages)
+			if res.err == nil && res.passed {
+				r.lineage.record(res.msg, node.name, before)
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// joinInputs combines the inputs of a node reached by several edges
+func (n graphNode) joinInputs(inputs []*message.RunnerMessage) (*message.RunnerMessage, error) {
+	msg := inputs[0]
+	if len(inputs) == 1 {
+		return msg, nil
+	}
+	results := make([]branchResult, len(inputs))
+	for i, in := range inputs {
+		results[i] = branchResult{index: i, msg: in, passed: true}
+	}
+	if n.join == joinCollect {
+		return msg, collectBranches(msg, results)
+	}
+	return msg, mergeBranches(msg, results[1:])
+}
+
+// route returns the nodes reached by the stage result: every conditional edge that matches,
+// or the default edges when none does
+func (n graphNode) route(msg *message.RunnerMessage) ([]int, error) {
+	var targets, defaults []int
+	for _, edge := range n.next {
+		if edge.isDefault {
+			defaults = append(defaults, edge.to)
+			continue
+		}
+		if edge.when != nil {
+			pass, err := edge.when.EvalMessage(msg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate when: %w", err)
+			}
+			if !pass {
+				continue
+			}
+		}
+		targets = append(targets, edge.to)
+	}
+	if len(targets) == 0 {
+		return defaults, nil
+	}
+	return targets, nil
+}
+
+// Start calls the Start hook of the stage runners implementing connectors.LifecycleRunner
+func (r *graphRunner) Start(ctx context.Context) error {
+	for _, node := range r.nodes {
+		for j, stage := range node.stages {
+			if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+				if err := lr.Start(ctx); err != nil {
+					return fmt.Errorf("failed to start runner %d of stage %q: %w", j, node.name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Drain calls the Drain hook of the stage runners implementing connectors.LifecycleRunner
+func (r *graphRunner) Drain(ctx context.Context) error {
+	var errs []error
+	for _, node := range r.nodes {
+		for j, stage := range node.stages {
+			if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+				if err := lr.Drain(ctx); err != nil {
+					errs = append(errs, fmt.Errorf("failed to drain runner %d of stage %q: %w", j, node.name, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the runners of every stage
+func (r *graphRunner) Close() error {
+	var errs []error
+	for _, node := range r.nodes {
+		if err := closeStages(node.stages); err != nil {
+			errs = append(errs, fmt.Errorf("stage %q: %w", node.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
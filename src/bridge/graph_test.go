@@ -0,0 +1,204 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// newTestGraphRunner builds the graph of pass-through stages, then replaces the runner of
+// the named stages
+func newTestGraphRunner(t *testing.T, cfg config.PipelineConfig, runners map[string]connectors.Runner) *graphRunner {
+	t.Helper()
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	gr, err := bridge.createGraphRunner(cfg)
+	if err != nil {
+		t.Fatalf("createGraphRunner() unexpected error = %v", err)
+	}
+	for i, node := range gr.nodes {
+		if r, ok := runners[node.name]; ok {
+			gr.nodes[i].stages = []branchStage{{runner: r}}
+		}
+	}
+	return gr
+}
+
+func TestSortPipelineErrors(t *testing.T) {
+	stage := func(name string, next ...string) config.PipelineStageConfig {
+		s := config.PipelineStageConfig{Name: name}
+		for _, to := range next {
+			s.Next = append(s.Next, config.PipelineEdgeConfig{To: to})
+		}
+		return s
+	}
+
+	cases := []struct {
+		cfg  config.PipelineConfig
+		want string
+	}{
+		{config.PipelineConfig{Entry: "in", Stages: []config.PipelineStageConfig{stage("in"), stage("in")}}, "duplicate"},
+		{config.PipelineConfig{Entry: "nope", Stages: []config.PipelineStageConfig{stage("in")}}, "unknown pipeline entry"},
+		{config.PipelineConfig{Entry: "in", Stages: []config.PipelineStageConfig{stage("in", "out")}}, "unknown next stage"},
+		{config.PipelineConfig{Entry: "in", Stages: []config.PipelineStageConfig{stage("in", "a"), stage("a", "b"), stage("b", "a")}}, "cycle"},
+		{config.PipelineConfig{Entry: "in", Stages: []config.PipelineStageConfig{stage("in", "a"), stage("a", "in")}}, "cycle"},
+		{config.PipelineConfig{Entry: "in", Stages: []config.PipelineStageConfig{stage("in"), stage("orphan", "in")}}, "not reachable"},
+	}
+	for i, tc := range cases {
+		if _, _, err := sortPipeline(tc.cfg); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("case %d: error = %v, want %q", i, err, tc.want)
+		}
+	}
+
+	order, levels, err := sortPipeline(config.PipelineConfig{Entry: "in", Stages: []config.PipelineStageConfig{
+		stage("out"), stage("b", "out"), stage("a", "b", "out"), stage("in", "a", "b"),
+	}})
+	if err != nil {
+		t.Fatalf("sortPipeline() unexpected error = %v", err)
+	}
+	if want := []int{3, 2, 1, 0}; !slices.Equal(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	if want := []int{0, 1, 2, 3}; !slices.Equal(levels, want) {
+		t.Errorf("levels = %v, want %v", levels, want)
+	}
+}
+
+func TestGraphRunnerConditionalRouting(t *testing.T) {
+	gr := newTestGraphRunner(t, config.PipelineConfig{
+		Entry: "in",
+		Stages: []config.PipelineStageConfig{
+			{Name: "in", Next: []config.PipelineEdgeConfig{
+				{To: "alerts", When: `metadata.level == "error"`},
+				{To: "archive", Default: true},
+			}},
+			{Name: "alerts", Next: []config.PipelineEdgeConfig{{To: "notify"}}},
+			{Name: "archive"},
+			{Name: "notify"},
+		},
+	}, map[string]connectors.Runner{
+		"alerts":  metadataRunner("alerts", "1"),
+		"archive": dataRunner("archived", 0),
+		"notify":  metadataRunner("notified", "1"),
+	})
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), map[string]string{"level": "error"}))
+	if err := gr.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	meta, data, _ := msg.GetMetadataAndData()
+	if meta["alerts"] != "1" || meta["notified"] != "1" || string(data) != "in" {
+		t.Errorf("error message: metadata = %v, data = %s", meta, data)
+	}
+
+	msg = message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), map[string]string{"level": "info"}))
+	if err := gr.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	meta, data, _ = msg.GetMetadataAndData()
+	if meta["alerts"] != "" || string(data) != "archived" {
+		t.Errorf("info message: metadata = %v, data = %s", meta, data)
+	}
+}
+
+func TestGraphRunnerFanOutFanIn(t *testing.T) {
+	for _, join := range []string{joinMerge, joinCollect} {
+		gr := newTestGraphRunner(t, config.PipelineConfig{
+			Entry: "in",
+			Stages: []config.PipelineStageConfig{
+				{Name: "in", Next: []config.PipelineEdgeConfig{{To: "a"}, {To: "b"}, {To: "join"}}},
+				{Name: "a", Next: []config.PipelineEdgeConfig{{To: "join"}}},
+				{Name: "b", Next: []config.PipelineEdgeConfig{{To: "join"}}},
+				{Name: "join", Join: join},
+			},
+		}, map[string]connectors.Runner{
+			"a": metadataRunner("a", "1"),
+			"b": metadataRunner("b", "2"),
+		})
+
+		msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"x":1}`), nil))
+		if err := gr.Process(msg); err != nil {
+			t.Fatalf("%s: Process() unexpected error = %v", join, err)
+		}
+		meta, data, _ := msg.GetMetadataAndData()
+
+		if join == joinMerge {
+			if meta["a"] != "1" || meta["b"] != "2" || string(data) != `{"x":1}` {
+				t.Errorf("merge: metadata = %v, data = %s", meta, data)
+			}
+			continue
+		}
+		var collected []collectedBranch
+		if err := json.Unmarshal(data, &collected); err != nil {
+			t.Fatalf("collect: invalid payload %s: %v", data, err)
+		}
+		if len(collected) != 3 || collected[1].Metadata["a"] != "1" || collected[2].Metadata["b"] != "2" {
+			t.Errorf("collect: payload = %s", data)
+		}
+	}
+}
+
+func TestGraphRunnerFilterAndError(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	gr, err := bridge.createGraphRunner(config.PipelineConfig{
+		Entry: "in",
+		Stages: []config.PipelineStageConfig{
+			{Name: "in", Runners: []connectors.RunnerConfig{{Type: "pass", FilterExpr: `metadata.keep == "yes"`}}, Next: []config.PipelineEdgeConfig{{To: "out"}}},
+			{Name: "out"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("createGraphRunner() unexpected error = %v", err)
+	}
+	gr.nodes[1].stages = []branchStage{{runner: metadataRunner("out", "1")}}
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), map[string]string{"keep": "no"}))
+	if err := gr.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if meta, _ := msg.GetMetadata(); meta["out"] != "" {
+		t.Errorf("filtered message reached the sink: %v", meta)
+	}
+
+	boom := errors.New("boom")
+	gr.nodes[1].stages = []branchStage{{runner: &funcRunner{process: func(*message.RunnerMessage) error { return boom }}}}
+	err = gr.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), map[string]string{"keep": "yes"})))
+	if !errors.Is(err, boom) || !strings.Contains(err.Error(), `stage "out"`) {
+		t.Errorf("Process() error = %v", err)
+	}
+
+	if _, err := bridge.createGraphRunner(config.PipelineConfig{
+		Entry:  "in",
+		Stages: []config.PipelineStageConfig{{Name: "in", Next: []config.PipelineEdgeConfig{{To: "out", When: "metadata.("}}}, {Name: "out"}},
+	}); err == nil {
+		t.Error("expected error for an invalid when expression")
+	}
+}
+
+func TestInitializeRunnersPipeline(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Runners = nil
+	cfg.Pipeline = &config.PipelineConfig{
+		Entry:  "in",
+		Stages: []config.PipelineStageConfig{{Name: "in", Runners: []connectors.RunnerConfig{{Type: "pass"}}}},
+	}
+	bridge := &EventsBridge{cfg: cfg, logger: newTestLogger()}
+	if err := bridge.initializeRunners(); err != nil {
+		t.Fatalf("initializeRunners() unexpected error = %v", err)
+	}
+	if len(bridge.runners) != 1 || bridge.runners[0].Config.Type != graphRunnerType {
+		t.Fatalf("runners = %+v", bridge.runners)
+	}
+	if _, ok := bridge.runners[0].Runner.(*graphRunner); !ok {
+		t.Errorf("runner = %T, want *graphRunner", bridge.runners[0].Runner)
+	}
+	if err := bridge.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+}
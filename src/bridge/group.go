@@ -0,0 +1,330 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	groupAll          = "all"
+	groupFirstSuccess = "first-success"
+	groupRoundRobin   = "round-robin"
+	groupWeighted     = "weighted"
+
+	defaultGroupRetryBackoff = 100 * time.Millisecond
+	defaultGroupOpenTimeout  = 30 * time.Second
+)
+
+// Metadata keys of the group delivery result
+const (
+	// metaGroupDelivered lists the indexes of the targets that accepted the message
+	metaGroupDelivered = "eb-group-delivered"
+	// metaGroupFailed lists the indexes of the targets that failed or were skipped by an open circuit
+	metaGroupFailed = "eb-group-failed"
+)
+
+var errCircuitOpen = errors.New("circuit open")
+
+// Ensure groupRunner implements connectors.LifecycleRunner
+var _ connectors.LifecycleRunner = (*groupRunner)(nil)
+
+// groupTarget is a child target with its circuit breaker state
+type groupTarget struct {
+	stage     branchStage
+	weight    int
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// groupRunner delivers the message to its child targets according to the strategy
+type groupRunner struct {
+	strategy         string
+	targets          []*groupTarget
+	retries          int
+	retryBackoff     time.Duration
+	failureThreshold int
+	openTimeout      time.Duration
+	next             atomic.Uint64
+	logger           *slog.Logger
+	now              func() time.Time
+}
+
+// groupRunnerConfig holds the options of the group runner
+type groupRunnerConfig struct {
+	// Strategy is "all" (default, deliver to every target), "first-success" (try the targets in order),
+	// "round-robin" (rotate the first target) or "weighted" (pick the first target by weight).
+	// Except for "all", a failed delivery fails over to the next target.
+	Strategy string `mapstructure:"strategy" validate:"omitempty,oneof=all first-success round-robin weighted"`
+	// Targets are the child targets
+	Targets []connectors.RunnerConfig `mapstructure:"targets" validate:"required,min=1,dive"`
+	// Weights are the target weights of the "weighted" strategy, in target order
+	Weights []int `mapstructure:"weights" validate:"omitempty,dive,min=0"`
+	// Retries is the number of retries of a failed delivery to a target
+	Retries int `mapstructure:"retries" validate:"min=0"`
+	// RetryBackoff is the wait before the first retry, doubled on every retry (default: 100ms)
+	RetryBackoff time.Duration `mapstructure:"retryBackoff" validate:"min=0"`
+	// FailureThreshold opens the circuit of a target after this many consecutive failed deliveries (0 disables)
+	FailureThreshold int `mapstructure:"failureThreshold" validate:"min=0"`
+	// OpenTimeout is the time an open circuit skips its target before a trial delivery (default: 30s)
+	OpenTimeout time.Duration `mapstructure:"openTimeout" validate:"min=0"`
+}
+
+// createGroupRunner builds the child targets of a "group" runner configuration
+func (b *EventsBridge) createGroupRunner(runnerConfig connectors.RunnerConfig) (connectors.Runner, error) {
+	group := new(groupRunnerConfig)
+	if err := b.parseRunnerOptions(runnerConfig, group); err != nil {
+		return nil, err
+	}
+
+	gr := &groupRunner{
+		strategy:         group.Strategy,
+		retries:          group.Retries,
+		retryBackoff:     group.RetryBackoff,
+		failureThreshold: group.FailureThreshold,
+		openTimeout:      group.OpenTimeout,
+		logger:           b.logger.With("component", "group"),
+		now:              time.Now,
+	}
+	if gr.strategy == "" {
+		gr.strategy = groupAll
+	}
+	if gr.retryBackoff == 0 {
+		gr.retryBackoff = defaultGroupRetryBackoff
+	}
+	if gr.openTimeout == 0 {
+		gr.openTimeout = defaultGroupOpenTimeout
+	}
+	if gr.strategy == groupWeighted && len(group.Weights) != len(group.Targets) {
+		return nil, fmt.Errorf("weighted group requires one weight per target, got %d for %d targets", len(group.Weights), len(group.Targets))
+	}
+
+	stages, err := b.createStages(group.Targets)
+	if err != nil {
+		return nil, err
+	}
+	for i, stage := range stages {
+		t := &groupTarget{stage: stage, weight: 1}
+		if gr.strategy == groupWeighted {
+			t.weight = group.Weights[i]
+		}
+		gr.targets = append(gr.targets, t)
+	}
+	return gr, nil
+}
+
+// Process delivers the message and sets the delivery result metadata
+func (r *groupRunner) Process(msg *message.RunnerMessage) error {
+	if r.strategy == groupAll {
+		return r.deliverAll(msg)
+	}
+	return r.deliverFailover(msg, r.order())
+}
+
+// deliverAll delivers a copy of the message to every target concurrently.
+// The metadata set by the targets is merged in target order; every target must succeed.
+func (r *groupRunner) deliverAll(msg *message.RunnerMessage) error {
+	results := make([]branchResult, len(r.targets))
+	var wg sync.WaitGroup
+	for i, t := range r.targets {
+		clone := msg.Clone()
+		wg.Go(func() {
+			res, passed, err := r.deliver(t, clone)
+			results[i] = branchResult{index: i, msg: res, passed: passed, err: err}
+		})
+	}
+	wg.Wait()
+
+	var delivered, failed []int
+	var errs []error
+	for _, res := range results {
+		if res.err != nil {
+			failed = append(failed, res.index)
+			errs = append(errs, fmt.Errorf("target %d: %w", res.index, res.err))
+			continue
+		}
+		delivered = append(delivered, res.index)
+	}
+	if err := mergeBranches(msg, results); err != nil {
+		return err
+	}
+	setGroupResult(msg, delivered, failed)
+	return errors.Join(errs...)
+}
+
+// deliverFailover delivers the message to the first target of the order that succeeds,
+// replacing the message content with the result of that target
+func (r *groupRunner) deliverFailover(msg *message.RunnerMessage, order []int) error {
+	var failed []int
+	var errs []error
+	for _, i := range order {
+		res, _, err := r.deliver(r.targets[i], msg)
+		if err != nil {
+			r.logger.Debug("group target failed", "target", i, "error", err)
+			// The next targets, e.g. a dead-letter target, receive the failures of the previous ones
+			msg.AttachError(message.NewErrorRecord(groupTargetStage(i), err))
+			failed = append(failed, i)
+			errs = append(errs, fmt.Errorf("target %d: %w", i, err))
+			continue
+		}
+		meta, data, err := res.GetMetadataAndData()
+		if err != nil {
+			return fmt.Errorf("target %d: %w", i, err)
+		}
+		msg.MergeMetadata(meta)
+		msg.SetData(data)
+		setGroupResult(msg, []int{i}, failed)
+		return nil
+	}
+	setGroupResult(msg, nil, failed)
+	return fmt.Errorf("all group targets failed: %w", errors.Join(errs...))
+}
+
+// groupTargetStage is the stage of the error records of a group target
+func groupTargetStage(i int) string {
+	return fmt.Sprintf("group target[%d]", i)
+}
+
+// order returns the target order of a failover delivery
+func (r *groupRunner) order() []int {
+	n := len(r.targets)
+	first := 0
+	switch r.strategy {
+	case groupRoundRobin:
+		first = int((r.next.Add(1) - 1) % uint64(n)) //nolint:gosec // n is a positive target count
+	case groupWeighted:
+		first = r.pickWeighted()
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = (first + i) % n
+	}
+	return order
+}
+
+// pickWeighted picks a target with a probability proportional to its weight
+func (r *groupRunner) pickWeighted() int {
+	total := 0
+	for _, t := range r.targets {
+		total += t.weight
+	}
+	if total == 0 {
+		return 0
+	}
+	n := rand.IntN(total) //nolint:gosec // load balancing, not security sensitive
+	for i, t := range r.targets {
+		if n < t.weight {
+			return i
+		}
+		n -= t.weight
+	}
+	return 0
+}
+
+// deliver runs the target with retries, honoring its circuit breaker
+func (r *groupRunner) deliver(t *groupTarget, msg *message.RunnerMessage) (*message.RunnerMessage, bool, error) {
+	if !t.allow(r.now()) {
+		return nil, false, errCircuitOpen
+	}
+	backoff := r.retryBackoff
+	var err error
+	for attempt := 0; attempt <= r.retries; attempt++ {
+		if attempt > 0 {
+			// A retry-after hint of the target replaces a shorter backoff
+			time.Sleep(retryDelay(err, backoff))
+			backoff *= 2
+		}
+		// Every attempt runs on a copy, so that a failed attempt does not leak its changes
+		var res *message.RunnerMessage
+		var passed bool
+		res, passed, err = runBranch(msg.Clone(), []branchStage{t.stage})
+		if err == nil {
+			t.record(nil, r.failureThreshold, r.openTimeout, r.now())
+			return res, passed, nil
+		}
+	}
+	t.record(err, r.failureThreshold, r.openTimeout, r.now())
+	return nil, false, err
+}
+
+// allow reports whether the circuit lets a delivery through
+func (t *groupTarget) allow(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !now.Before(t.openUntil)
+}
+
+// record updates the circuit with the delivery outcome; after an open timeout a single
+// failed trial delivery opens the circuit again
+func (t *groupTarget) record(err error, threshold int, openTimeout time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err == nil {
+		t.failures = 0
+		t.openUntil = time.Time{}
+		return
+	}
+	t.failures++
+	if threshold > 0 && t.failures >= threshold {
+		t.openUntil = now.Add(openTimeout)
+	}
+}
+
+// setGroupResult sets the delivery result metadata
+func setGroupResult(msg *message.RunnerMessage, delivered, failed []int) {
+	msg.AddMetadata(metaGroupDelivered, joinIndexes(delivered))
+	msg.AddMetadata(metaGroupFailed, joinIndexes(failed))
+}
+
+func joinIndexes(indexes []int) string {
+	parts := make([]string, len(indexes))
+	for i, idx := range indexes {
+		parts[i] = strconv.Itoa(idx)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Start calls the Start hook of the targets implementing connectors.LifecycleRunner
+func (r *groupRunner) Start(ctx context.Context) error {
+	for i, t := range r.targets {
+		if lr, ok := t.stage.runner.(connectors.LifecycleRunner); ok {
+			if err := lr.Start(ctx); err != nil {
+				return fmt.Errorf("failed to start target %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Drain calls the Drain hook of the targets implementing connectors.LifecycleRunner
+func (r *groupRunner) Drain(ctx context.Context) error {
+	var errs []error
+	for i, t := range r.targets {
+		if lr, ok := t.stage.runner.(connectors.LifecycleRunner); ok {
+			if err := lr.Drain(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("failed to drain target %d: %w", i, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the targets
+func (r *groupRunner) Close() error {
+	stages := make([]branchStage, len(r.targets))
+	for i, t := range r.targets {
+		stages[i] = t.stage
+	}
+	return closeStages(stages)
+}
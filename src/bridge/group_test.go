@@ -0,0 +1,183 @@
+package bridge
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// flakyRunner fails the first failures calls, then tags the message with its name
+type flakyRunner struct {
+	name     string
+	failures int
+	calls    int
+}
+
+func (r *flakyRunner) Process(msg *message.RunnerMessage) error {
+	r.calls++
+	if r.calls <= r.failures {
+		return errors.New(r.name + " unavailable")
+	}
+	msg.AddMetadata("target", r.name)
+	return nil
+}
+
+func (r *flakyRunner) Close() error {
+	return nil
+}
+
+func newTestGroupRunner(strategy string, runners ...connectors.Runner) *groupRunner {
+	gr := &groupRunner{strategy: strategy, retryBackoff: time.Millisecond, openTimeout: time.Minute, logger: newTestLogger(), now: time.Now}
+	for _, r := range runners {
+		gr.targets = append(gr.targets, &groupTarget{stage: branchStage{runner: r}, weight: 1})
+	}
+	return gr
+}
+
+func processGroup(t *testing.T, gr *groupRunner) (map[string]string, error) {
+	t.Helper()
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil))
+	err := gr.Process(msg)
+	meta, metaErr := msg.GetMetadata()
+	if metaErr != nil {
+		t.Fatal(metaErr)
+	}
+	return meta, err
+}
+
+func TestGroupRunnerAll(t *testing.T) {
+	gr := newTestGroupRunner(groupAll, metadataRunner("a", "1"), metadataRunner("b", "2"))
+	meta, err := processGroup(t, gr)
+	if err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if meta["a"] != "1" || meta["b"] != "2" || meta[metaGroupDelivered] != "0,1" || meta[metaGroupFailed] != "" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+
+	gr = newTestGroupRunner(groupAll, metadataRunner("a", "1"), &flakyRunner{name: "down", failures: 100})
+	meta, err = processGroup(t, gr)
+	if err == nil {
+		t.Fatal("expected error when a target fails")
+	}
+	if meta[metaGroupDelivered] != "0" || meta[metaGroupFailed] != "1" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+}
+
+func TestGroupRunnerFailoverWithRetries(t *testing.T) {
+	primary := &flakyRunner{name: "primary", failures: 1}
+	backup := &flakyRunner{name: "backup"}
+	gr := newTestGroupRunner(groupFirstSuccess, primary, backup)
+
+	// Without retries the failed primary fails over to the backup
+	meta, err := processGroup(t, gr)
+	if err != nil || meta["target"] != "backup" || meta[metaGroupDelivered] != "1" || meta[metaGroupFailed] != "0" {
+		t.Fatalf("unexpected failover result %v, %v", meta, err)
+	}
+
+	primary.calls = 0
+	gr.retries = 1
+	meta, err = processGroup(t, gr)
+	if err != nil || meta["target"] != "primary" || primary.calls != 2 {
+		t.Errorf("expected primary delivery on retry, got %v, %v after %d calls", meta, err, primary.calls)
+	}
+}
+
+func TestGroupRunnerCircuitBreaker(t *testing.T) {
+	primary := &flakyRunner{name: "primary", failures: 2}
+	backup := &flakyRunner{name: "backup"}
+	gr := newTestGroupRunner(groupFirstSuccess, primary, backup)
+	gr.failureThreshold = 2
+	now := time.Now()
+	gr.now = func() time.Time { return now }
+
+	for range 4 {
+		if _, err := processGroup(t, gr); err != nil {
+			t.Fatalf("Process() unexpected error = %v", err)
+		}
+	}
+	if primary.calls != 2 {
+		t.Errorf("expected the open circuit to skip the primary, got %d calls", primary.calls)
+	}
+
+	// After the open timeout a trial delivery closes the circuit
+	now = now.Add(time.Minute)
+	meta, err := processGroup(t, gr)
+	if err != nil || meta["target"] != "primary" {
+		t.Errorf("expected trial delivery to the primary, got %v, %v", meta, err)
+	}
+}
+
+func TestGroupRunnerRoundRobin(t *testing.T) {
+	gr := newTestGroupRunner(groupRoundRobin, &flakyRunner{name: "a"}, &flakyRunner{name: "b"})
+	var got []string
+	for range 4 {
+		meta, err := processGroup(t, gr)
+		if err != nil {
+			t.Fatalf("Process() unexpected error = %v", err)
+		}
+		got = append(got, meta["target"])
+	}
+	if got[0] != "a" || got[1] != "b" || got[2] != "a" || got[3] != "b" {
+		t.Errorf("unexpected rotation %v", got)
+	}
+}
+
+func TestGroupRunnerAllFailed(t *testing.T) {
+	gr := newTestGroupRunner(groupWeighted, &flakyRunner{name: "a", failures: 1}, &flakyRunner{name: "b", failures: 1})
+	gr.targets[0].weight = 0
+	meta, err := processGroup(t, gr)
+	if err == nil {
+		t.Fatal("expected error when every target fails")
+	}
+	if meta[metaGroupFailed] != "1,0" {
+		t.Errorf("expected the weighted target tried first, got %v", meta)
+	}
+}
+
+func TestCreateGroupRunner(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+
+	runner, err := bridge.createRunner(connectors.RunnerConfig{
+		Type:    "group",
+		Options: map[string]any{"targets": []any{map[string]any{"type": "pass"}, map[string]any{"type": "pass"}}},
+	})
+	if err != nil {
+		t.Fatalf("createRunner() unexpected error = %v", err)
+	}
+	gr, ok := runner.(*groupRunner)
+	if !ok {
+		t.Fatalf("createRunner() returned %T, want *groupRunner", runner)
+	}
+	if gr.strategy != groupAll || gr.openTimeout != defaultGroupOpenTimeout {
+		t.Errorf("unexpected defaults %+v", gr)
+	}
+
+	if _, err := bridge.createRunner(connectors.RunnerConfig{
+		Type:    "group",
+		Options: map[string]any{"strategy": groupWeighted, "targets": []any{map[string]any{"type": "pass"}}},
+	}); err == nil {
+		t.Error("expected error for weighted group without weights")
+	}
+}
+
+func TestGroupRunnerFailoverCarriesErrorRecords(t *testing.T) {
+	var received []message.ErrorRecord
+	deadLetter := &funcRunner{process: func(msg *message.RunnerMessage) error {
+		var err error
+		received, err = msg.GetErrors()
+		return err
+	}}
+	gr := newTestGroupRunner(groupFirstSuccess, &flakyRunner{name: "primary", failures: 100}, deadLetter)
+	if _, err := processGroup(t, gr); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if len(received) != 1 || received[0].Stage != "group target[0]" || received[0].Message != "primary unavailable" {
+		t.Errorf("error records = %+v", received)
+	}
+}
@@ -0,0 +1,76 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+)
+
+// startRunners calls the Start hook of the runners and of the dead-letter target
+// implementing connectors.LifecycleRunner
+func (b *EventsBridge) startRunners(ctx context.Context) error {
+	for i, item := range b.runners {
+		lr, ok := item.Runner.(connectors.LifecycleRunner)
+		if !ok {
+			continue
+		}
+		b.logger.Info("starting runner", "runner", i, "type", item.Config.Type)
+		if err := lr.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start runner %d: %w", i, err)
+		}
+	}
+	return b.deadLetter.start(ctx)
+}
+
+// drainRunners calls the Drain hook of the runners and of the dead-letter target
+// implementing connectors.LifecycleRunner.
+// Every runner is drained, even if a previous one fails.
+func (b *EventsBridge) drainRunners(ctx context.Context) error {
+	var errs []error
+	for i, item := range b.runners {
+		lr, ok := item.Runner.(connectors.LifecycleRunner)
+		if !ok {
+			continue
+		}
+		b.logger.Info("draining runner", "runner", i, "type", item.Config.Type)
+		if err := lr.Drain(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to drain runner %d: %w", i, err))
+		}
+	}
+	// The dead-letter target is drained last, as the runners may fail while flushing
+	if err := b.deadLetter.drain(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Start calls the Start hook of the branch runners implementing connectors.LifecycleRunner
+func (r *branchRunner) Start(ctx context.Context) error {
+	for i, stages := range r.branches {
+		for j, stage := range stages {
+			if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+				if err := lr.Start(ctx); err != nil {
+					return fmt.Errorf("failed to start runner %d of branch %d: %w", j, i, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Drain calls the Drain hook of the branch runners implementing connectors.LifecycleRunner
+func (r *branchRunner) Drain(ctx context.Context) error {
+	var errs []error
+	for i, stages := range r.branches {
+		for j, stage := range stages {
+			if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+				if err := lr.Drain(ctx); err != nil {
+					errs = append(errs, fmt.Errorf("failed to drain runner %d of branch %d: %w", j, i, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,153 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// lifecycleRunner records the calls of the lifecycle hooks
+type lifecycleRunner struct {
+	recordingRunner
+	name     string
+	calls    *[]string
+	callsMu  *sync.Mutex
+	startErr error
+	drainErr error
+}
+
+func (r *lifecycleRunner) record(call string) {
+	r.callsMu.Lock()
+	defer r.callsMu.Unlock()
+	*r.calls = append(*r.calls, r.name+":"+call)
+}
+
+func (r *lifecycleRunner) Start(context.Context) error {
+	r.record("start")
+	return r.startErr
+}
+
+func (r *lifecycleRunner) Drain(context.Context) error {
+	r.record("drain")
+	return r.drainErr
+}
+
+func newLifecycleRunners(names ...string) ([]*lifecycleRunner, func() []string) {
+	var calls []string
+	var mu sync.Mutex
+	runners := make([]*lifecycleRunner, len(names))
+	for i, name := range names {
+		runners[i] = &lifecycleRunner{name: name, calls: &calls, callsMu: &mu}
+	}
+	return runners, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), calls...)
+	}
+}
+
+func TestLifecycleRunnerHooks(t *testing.T) {
+	src := newChanSource()
+	runners, calls := newLifecycleRunners("a", "b")
+	b := &EventsBridge{
+		cfg:    newTestConfig(),
+		logger: newTestLogger(),
+		source: src,
+		runners: []RunnerItem{
+			{Config: connectors.RunnerConfig{Type: "a"}, Runner: runners[0]},
+			{Config: connectors.RunnerConfig{Type: "plain"}, Runner: &recordingRunner{}},
+			{Config: connectors.RunnerConfig{Type: "b"}, Runner: runners[1]},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	if got := calls(); !slices.Equal(got, []string{"a:start", "b:start"}) {
+		t.Errorf("calls after Start() = %v", got)
+	}
+
+	msg := newCountingMessage("payload")
+	src.c <- message.NewRunnerMessage(msg)
+	waitFor(t, func() bool { return msg.acks.Load() == 1 })
+
+	if err := b.Drain(ctx); err != nil {
+		t.Fatalf("Drain() unexpected error = %v", err)
+	}
+	if got := calls(); !slices.Equal(got, []string{"a:start", "b:start", "a:drain", "b:drain"}) {
+		t.Errorf("calls after Drain() = %v", got)
+	}
+}
+
+func TestLifecycleRunnerStartFailure(t *testing.T) {
+	src := newChanSource()
+	runners, calls := newLifecycleRunners("a", "b")
+	runners[0].startErr = errors.New("model not found")
+	b := &EventsBridge{
+		cfg:    newTestConfig(),
+		logger: newTestLogger(),
+		source: src,
+		runners: []RunnerItem{
+			{Config: connectors.RunnerConfig{Type: "a"}, Runner: runners[0]},
+			{Config: connectors.RunnerConfig{Type: "b"}, Runner: runners[1]},
+		},
+	}
+
+	if _, err := b.Start(context.Background()); err == nil || !errors.Is(err, runners[0].startErr) {
+		t.Fatalf("Start() error = %v, want %v", err, runners[0].startErr)
+	}
+	if got := calls(); !slices.Equal(got, []string{"a:start"}) {
+		t.Errorf("calls after failed Start() = %v", got)
+	}
+}
+
+func TestLifecycleRunnerDrainErrors(t *testing.T) {
+	runners, calls := newLifecycleRunners("a", "b")
+	runners[0].drainErr = errors.New("flush failed")
+	b := &EventsBridge{
+		cfg:    newTestConfig(),
+		logger: newTestLogger(),
+		source: newChanSource(),
+		runners: []RunnerItem{
+			{Config: connectors.RunnerConfig{Type: "a"}, Runner: runners[0]},
+			{Config: connectors.RunnerConfig{Type: "b"}, Runner: runners[1]},
+		},
+	}
+
+	if err := b.Drain(context.Background()); !errors.Is(err, runners[0].drainErr) {
+		t.Errorf("Drain() error = %v, want %v", err, runners[0].drainErr)
+	}
+	// A failing runner does not prevent the others from draining
+	if got := calls(); !slices.Equal(got, []string{"a:drain", "b:drain"}) {
+		t.Errorf("calls after Drain() = %v", got)
+	}
+}
+
+func TestBranchRunnerLifecycle(t *testing.T) {
+	runners, calls := newLifecycleRunners("a", "b")
+	br := &branchRunner{
+		branches: [][]branchStage{
+			{{runner: runners[0]}, {runner: &recordingRunner{}}},
+			{{runner: runners[1]}},
+		},
+		logger: newTestLogger(),
+	}
+
+	var _ connectors.LifecycleRunner = br
+	if err := br.Start(context.Background()); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	if err := br.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() unexpected error = %v", err)
+	}
+	if got := calls(); !slices.Equal(got, []string{"a:start", "b:start", "a:drain", "b:drain"}) {
+		t.Errorf("calls = %v", got)
+	}
+}
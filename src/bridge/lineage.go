@@ -0,0 +1,131 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	defaultLineageMetadataKey = "eb-lineage"
+	// lineageSource is the stage of the fields received from the source
+	lineageSource = "source"
+	// lineageWhole is the field standing for a payload that is not a JSON object
+	lineageWhole = "$"
+)
+
+// lineageSnapshot is the canonical JSON encoding of the top-level fields of a payload
+type lineageSnapshot map[string]string
+
+// lineageTracker records in the message metadata the stage that last modified every
+// top-level field of the payload. A nil tracker records nothing.
+type lineageTracker struct {
+	key    string
+	fields map[string]bool
+}
+
+func newLineageTracker(cfg *config.LineageConfig) *lineageTracker {
+	if cfg == nil {
+		return nil
+	}
+	l := &lineageTracker{key: cfg.MetadataKey}
+	if l.key == "" {
+		l.key = defaultLineageMetadataKey
+	}
+	if len(cfg.Fields) > 0 {
+		l.fields = make(map[string]bool, len(cfg.Fields))
+		for _, f := range cfg.Fields {
+			l.fields[f] = true
+		}
+	}
+	return l
+}
+
+// snapshot returns the fields of the message payload before a stage runs
+func (l *lineageTracker) snapshot(msg *message.RunnerMessage) lineageSnapshot {
+	if l == nil {
+		return nil
+	}
+	data, err := msg.GetData()
+	if err != nil {
+		return lineageSnapshot{}
+	}
+	return l.fieldsOf(data)
+}
+
+// fieldsOf encodes the tracked fields of a payload. The values are decoded and encoded
+// again, so that a runner re-encoding the payload doesn't modify the fields it didn't change.
+// A payload that is not a JSON object is the single field "$".
+func (l *lineageTracker) fieldsOf(data []byte) lineageSnapshot {
+	var fields map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil || fields == nil {
+		if len(data) == 0 {
+			return lineageSnapshot{}
+		}
+		return lineageSnapshot{lineageWhole: string(data)}
+	}
+	snap := make(lineageSnapshot, len(fields))
+	for name, value := range fields {
+		if l.fields != nil && !l.fields[name] {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		snap[name] = string(raw)
+	}
+	return snap
+}
+
+// record sets the stage as the origin of the fields it added or modified, and forgets the
+// fields it removed. The fields without lineage before the stage come from the source.
+func (l *lineageTracker) record(msg *message.RunnerMessage, stage string, before lineageSnapshot) {
+	if l == nil || msg == nil {
+		return
+	}
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return
+	}
+	lineage := map[string]string{}
+	if raw := meta[l.key]; raw != "" {
+		_ = json.Unmarshal([]byte(raw), &lineage)
+	}
+	prev := maps.Clone(lineage)
+
+	after := l.fieldsOf(data)
+	for name := range lineage {
+		if _, ok := after[name]; !ok {
+			delete(lineage, name)
+		}
+	}
+	for name, value := range after {
+		old, existed := before[name]
+		switch {
+		case !existed || old != value:
+			lineage[name] = stage
+		case lineage[name] == "":
+			lineage[name] = lineageSource
+		}
+	}
+	if _, ok := meta[l.key]; ok && maps.Equal(prev, lineage) {
+		return
+	}
+
+	raw, err := json.Marshal(lineage)
+	if err != nil {
+		return
+	}
+	out := maps.Clone(meta)
+	if out == nil {
+		out = make(map[string]string)
+	}
+	out[l.key] = string(raw)
+	msg.SetMetadata(out)
+}
@@ -0,0 +1,106 @@
+package bridge
+
+import (
+	"encoding/json"
+	"maps"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func lineageOf(t *testing.T, msg *message.RunnerMessage, key string) map[string]string {
+	t.Helper()
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineage := map[string]string{}
+	if err := json.Unmarshal([]byte(meta[key]), &lineage); err != nil {
+		t.Fatalf("lineage %q: %v", meta[key], err)
+	}
+	return lineage
+}
+
+func TestLineageTracker(t *testing.T) {
+	l := newLineageTracker(&config.LineageConfig{})
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"id":1,"name":"a","tags":{"x":1,"y":2}}`), map[string]string{"k": "v"}))
+
+	steps := []struct {
+		stage string
+		data  string
+		want  map[string]string
+	}{
+		// Re-encoding with another key order and spacing doesn't modify the fields
+		{"runner[0]", `{"tags":{"y":2,"x":1}, "name":"a", "id":1, "total":3}`,
+			map[string]string{"id": "source", "name": "source", "tags": "source", "total": "runner[0]"}},
+		{"runner[1]", `{"id":1,"name":"b","total":3}`,
+			map[string]string{"id": "source", "name": "runner[1]", "total": "runner[0]"}},
+		{"runner[2]", `{"id":1,"name":"b","total":3}`,
+			map[string]string{"id": "source", "name": "runner[1]", "total": "runner[0]"}},
+		{"runner[3]", `not json`, map[string]string{"$": "runner[3]"}},
+	}
+	for _, step := range steps {
+		before := l.snapshot(msg)
+		msg.SetData([]byte(step.data))
+		l.record(msg, step.stage, before)
+		if got := lineageOf(t, msg, defaultLineageMetadataKey); !maps.Equal(got, step.want) {
+			t.Errorf("%s: lineage = %v, want %v", step.stage, got, step.want)
+		}
+	}
+	if meta, _ := msg.GetMetadata(); meta["k"] != "v" {
+		t.Errorf("source metadata lost: %v", meta)
+	}
+
+	// Selected fields only, and nothing recorded without the tracker
+	l = newLineageTracker(&config.LineageConfig{MetadataKey: "lineage", Fields: []string{"amount"}})
+	msg = message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"amount":1,"note":"a"}`), nil))
+	before := l.snapshot(msg)
+	msg.SetData([]byte(`{"amount":2,"note":"b"}`))
+	l.record(msg, "runner[0]", before)
+	if got := lineageOf(t, msg, "lineage"); !maps.Equal(got, map[string]string{"amount": "runner[0]"}) {
+		t.Errorf("lineage = %v", got)
+	}
+	var none *lineageTracker
+	none.record(msg, "runner[1]", none.snapshot(msg))
+}
+
+func TestLineageRunnerChain(t *testing.T) {
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger(), lineage: newLineageTracker(&config.LineageConfig{})}
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"id":1}`), nil))
+	for i, r := range []connectors.Runner{dataRunner(`{"id":1,"score":0.5}`, 0), metadataRunner("x", "y")} {
+		res, ok, err := b.processRunnerMessage(runnerStage(i), msg, r, connectors.RunnerConfig{Type: "test"}, nil, nil, nil)
+		if err != nil || !ok {
+			t.Fatalf("processRunnerMessage() = %v, %v, %v", res, ok, err)
+		}
+	}
+	if got := lineageOf(t, msg, defaultLineageMetadataKey); !maps.Equal(got, map[string]string{"id": "source", "score": "runner[0]"}) {
+		t.Errorf("lineage = %v", got)
+	}
+}
+
+func TestLineageGraphStages(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger(), lineage: newLineageTracker(&config.LineageConfig{})}
+	gr, err := bridge.createGraphRunner(config.PipelineConfig{
+		Entry: "in",
+		Stages: []config.PipelineStageConfig{
+			{Name: "in", Next: []config.PipelineEdgeConfig{{To: "enrich"}}},
+			{Name: "enrich"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gr.nodes[1].stages = []branchStage{{runner: dataRunner(`{"id":1,"country":"IT"}`, 0)}}
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"id":1}`), nil))
+	res, ok, err := bridge.processRunnerMessage(runnerStage(0), msg, gr, connectors.RunnerConfig{Type: "pipeline"}, nil, nil, nil)
+	if err != nil || !ok {
+		t.Fatalf("processRunnerMessage() = %v, %v, %v", res, ok, err)
+	}
+	if got := lineageOf(t, msg, defaultLineageMetadataKey); !maps.Equal(got, map[string]string{"id": "source", "country": "enrich"}) {
+		t.Errorf("lineage = %v, want the graph stage names", got)
+	}
+}
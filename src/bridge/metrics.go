@@ -0,0 +1,175 @@
+package bridge
+
+import (
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// The metrics of the pipelines are process-wide: the pipelines started by a switchover
+// add to the series of the pipelines they replace
+var (
+	sourceMessages = metrics.NewCounterVec(
+		"eb_source_messages_total",
+		"Messages produced by the sources.",
+		"source",
+	)
+	runnerMessages = metrics.NewCounterVec(
+		"eb_runner_messages_total",
+		"Messages processed by the runners, by result (ok, error, skipped or filtered).",
+		"runner", "type", "result",
+	)
+	runnerDuration = metrics.NewHistogramVec(
+		"eb_runner_duration_seconds",
+		"Processing time of the messages by the runners.",
+		nil,
+		"runner", "type",
+	)
+	runnerThrottled = metrics.NewCounterVec(
+		"eb_runner_throttled_total",
+		"Messages over the throttle rate of the runners, by overflow (block, drop or nak).",
+		"runner", "type", "overflow",
+	)
+	runnerDuplicates = metrics.NewCounterVec(
+		"eb_runner_duplicates_total",
+		"Duplicate messages acked and dropped by the dedup runners.",
+		"runner", "type",
+	)
+	messagesSettled = metrics.NewCounterVec(
+		"eb_messages_settled_total",
+		"Messages acked or naked back to the sources.",
+		"source", "outcome",
+	)
+	messageLatency = metrics.NewHistogramVec(
+		"eb_message_latency_seconds",
+		"End-to-end latency of the messages, from the source to the acknowledgement.",
+		nil,
+		"source",
+	)
+	sourceBuffer = metrics.NewGaugeVec(
+		"eb_source_buffer_messages",
+		"Messages waiting in the buffer of the source channel.",
+		"source",
+	)
+	sourceBufferCapacity = metrics.NewGaugeVec(
+		"eb_source_buffer_capacity",
+		"Capacity of the buffer of the source channel.",
+		"source",
+	)
+	pipelinePaused = metrics.NewGaugeVec(
+		"eb_pipeline_paused",
+		"Whether the consumption of the source is paused (1) or not (0).",
+		"source",
+	)
+	pipelinePauses = metrics.NewCounterVec(
+		"eb_pipeline_pauses_total",
+		"Pauses of the consumption of the source, by reason (error rate or manual).",
+		"source", "reason",
+	)
+	connectorUp = metrics.NewGaugeVec(
+		"eb_connector_up",
+		"Whether the connectors reporting their status are connected (1) or not (0).",
+		"component", "type",
+	)
+	connectorLastMessage = metrics.NewGaugeVec(
+		"eb_connector_last_message_timestamp_seconds",
+		"Time of the last message received or delivered by the connectors reporting their status.",
+		"component", "type",
+	)
+	connectorLag = metrics.NewGaugeVec(
+		"eb_connector_lag",
+		"Backlog reported by the connectors, e.g. the consumer lag, 0 where not applicable.",
+		"component", "type",
+	)
+)
+
+const (
+	resultOK       = "ok"
+	resultError    = "error"
+	resultSkipped  = "skipped"
+	resultFiltered = "filtered"
+
+	outcomeAck = "ack"
+	outcomeNak = "nak"
+)
+
+// sourceLabel is the source of a message: the id of the source of the multi sources,
+// the source type otherwise
+func (b *EventsBridge) sourceLabel(msg *message.RunnerMessage) string {
+	if b.cfg.Source.Type == connectors.MultiSourceType {
+		if meta, err := msg.GetMetadata(); err == nil && meta[sourceIDMetadataKey] != "" {
+			return meta[sourceIDMetadataKey]
+		}
+	}
+	return b.cfg.Source.Type
+}
+
+// observeBuffer exposes the occupancy of the source channel until the bridge is closed
+func (b *EventsBridge) observeBuffer(c <-chan *message.RunnerMessage) {
+	source := b.cfg.Source.Type
+	remove := sourceBuffer.Func(func() float64 { return float64(len(c)) }, source)
+	sourceBufferCapacity.With(source).Set(float64(cap(c)))
+	b.metricsMu.Lock()
+	b.removeBuffer = remove
+	b.metricsMu.Unlock()
+}
+
+// observeConnectors exposes the statuses reported by the connectors until the bridge is closed
+func (b *EventsBridge) observeConnectors() {
+	var removes []func()
+	for _, r := range b.statusReporters() {
+		reporter := r.reporter
+		labels := []string{r.component, r.typ}
+		if r.id != "" {
+			labels[0] = r.component + "[" + r.id + "]"
+		}
+		removes = append(removes,
+			connectorUp.Func(func() float64 {
+				if reporter.ConnectorStatus().State == connectors.StateConnected {
+					return 1
+				}
+				return 0
+			}, labels...),
+			connectorLastMessage.Func(func() float64 {
+				at := reporter.ConnectorStatus().LastMessageAt
+				if at.IsZero() {
+					return 0
+				}
+				return float64(at.UnixNano()) / 1e9
+			}, labels...),
+			connectorLag.Func(func() float64 {
+				if lag := reporter.ConnectorStatus().Lag; lag != nil {
+					return float64(*lag)
+				}
+				return 0
+			}, labels...),
+		)
+	}
+	b.metricsMu.Lock()
+	b.removeConnectors = removes
+	b.metricsMu.Unlock()
+}
+
+// closeMetrics removes the series bound to the channels and the connectors of the bridge
+func (b *EventsBridge) closeMetrics() {
+	b.metricsMu.Lock()
+	defer b.metricsMu.Unlock()
+	if b.removeBuffer != nil {
+		b.removeBuffer()
+		b.removeBuffer = nil
+	}
+	for _, remove := range b.removeConnectors {
+		remove()
+	}
+	b.removeConnectors = nil
+}
+
+// settled counts the outcome of a message and, when acked, its end-to-end latency
+func settled(source, outcome string, ingress time.Time) {
+	messagesSettled.With(source, outcome).Inc()
+	if outcome == outcomeAck && !ingress.IsZero() {
+		messageLatency.With(source).Observe(time.Since(ingress).Seconds())
+	}
+}
@@ -0,0 +1,79 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// scrape returns the metrics in the Prometheus text format
+func scrape(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := metrics.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestBridgeMetrics(t *testing.T) {
+	cfg := newTestConfig()
+	// A source type of its own, the metrics are process-wide
+	cfg.Source.Type = "metricstest"
+	src := newChanSource()
+	b := &EventsBridge{
+		cfg:      cfg,
+		logger:   newTestLogger(),
+		source:   src,
+		activity: newActivityTracker(),
+		runners: []RunnerItem{{
+			Config: connectors.RunnerConfig{Type: "metricsrunner"},
+			Runner: &funcRunner{process: func(msg *message.RunnerMessage) error {
+				if data, _ := msg.GetData(); string(data) == "bad" {
+					return errors.New("boom")
+				}
+				return nil
+			}},
+		}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	ok := newCountingMessage("ok")
+	bad := newCountingMessage("bad")
+	src.c <- message.NewRunnerMessage(ok)
+	src.c <- message.NewRunnerMessage(bad)
+	waitFor(t, func() bool { return ok.acks.Load() == 1 && bad.naks.Load() == 1 })
+
+	out := scrape(t)
+	for _, want := range []string{
+		`eb_source_messages_total{source="metricstest"} 2`,
+		`eb_runner_messages_total{result="ok",runner="runner[0]",type="metricsrunner"} 1`,
+		`eb_runner_messages_total{result="error",runner="runner[0]",type="metricsrunner"} 1`,
+		`eb_runner_duration_seconds_count{runner="runner[0]",type="metricsrunner"} 2`,
+		`eb_messages_settled_total{outcome="ack",source="metricstest"} 1`,
+		`eb_messages_settled_total{outcome="nak",source="metricstest"} 1`,
+		`eb_message_latency_seconds_count{source="metricstest"} 1`,
+		`eb_source_buffer_messages{source="metricstest"} 0`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(scrape(t), `eb_source_buffer_messages{source="metricstest"}`) {
+		t.Error("buffer gauge not removed on close")
+	}
+}
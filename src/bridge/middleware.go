@@ -0,0 +1,246 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/destel/rill"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+	"golang.org/x/time/rate"
+)
+
+// errMiddlewareDrop is returned by a middleware to ack a message without processing it
+var errMiddlewareDrop = errors.New("message dropped by middleware")
+
+// inboundMiddleware is a step of the inbound middleware chain of the source.
+// Handle returns the message to pass on, which may wrap the received one; an error
+// wrapping errMiddlewareDrop acks the message, any other error naks it.
+type inboundMiddleware interface {
+	Handle(ctx context.Context, msg *message.RunnerMessage) (*message.RunnerMessage, error)
+	Close() error
+}
+
+// middlewareItem holds a middleware configuration and its instance
+type middlewareItem struct {
+	Config     connectors.MiddlewareConfig
+	Middleware inboundMiddleware
+}
+
+// initializeMiddleware creates the inbound middleware chain of the source
+func (b *EventsBridge) initializeMiddleware() error {
+	for i, cfg := range b.cfg.Source.Middleware {
+		b.logger.Info("creating source middleware", "type", cfg.Type)
+		mw, err := b.createMiddleware(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to create middleware %d (%s): %w", i, cfg.Type, err)
+		}
+		b.middleware = append(b.middleware, middlewareItem{Config: cfg, Middleware: mw})
+	}
+	return nil
+}
+
+// createMiddleware instantiates a middleware from its configuration
+func (b *EventsBridge) createMiddleware(cfg connectors.MiddlewareConfig) (inboundMiddleware, error) {
+	switch cfg.Type {
+	case "sizeLimit":
+		return newSizeLimitMiddleware(cfg.Options)
+	case "decompress":
+		return newDecompressMiddleware(cfg.Options)
+	case "decrypt":
+		return newDecryptMiddleware(cfg.Options)
+	case "jwt":
+		return newJWTMiddleware(cfg.Options, b.logger)
+	case "hmac":
+		return newHMACMiddleware(cfg.Options)
+	case "dedup":
+		return newDedupMiddleware(cfg.Options, b.logger)
+	case "rateLimit":
+		return newRateLimitMiddleware(cfg.Options)
+	case "remotePayload":
+		return newRemotePayloadMiddleware(cfg.Options)
+	}
+	return nil, fmt.Errorf("unknown middleware type %q", cfg.Type)
+}
+
+// applyMiddleware runs the middleware chain on the source messages, one message at a
+// time and in order, before they are handed to the runners
+func (b *EventsBridge) applyMiddleware(ctx context.Context, stream rill.Stream[*message.RunnerMessage]) rill.Stream[*message.RunnerMessage] {
+	stages := make([]func(func()), len(b.middleware))
+	for i, item := range b.middleware {
+		stages[i] = b.stage(middlewareStage(i), item.Config.Type)
+	}
+	return rill.OrderedFilterMap(stream, 1, func(msg *message.RunnerMessage) (*message.RunnerMessage, bool, error) {
+		for i, item := range b.middleware {
+			var next *message.RunnerMessage
+			var err error
+			stages[i](func() {
+				next, err = item.Middleware.Handle(ctx, msg)
+			})
+			if errors.Is(err, errMiddlewareDrop) {
+				b.HandleSuccess(msg, "message dropped by middleware", "middleware", item.Config.Type, "reason", err)
+				return nil, false, nil
+			}
+			if err != nil {
+				return b.HandleRunnerError(msg, err, "message rejected by middleware", "middleware", item.Config.Type)
+			}
+			msg = next
+		}
+		return msg, true, nil
+	})
+}
+
+// closeMiddleware closes the middleware chain
+func (b *EventsBridge) closeMiddleware() []error {
+	var errs []error
+	for i, item := range b.middleware {
+		if err := item.Middleware.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close middleware %d: %w", i, err))
+		}
+	}
+	return errs
+}
+
+// sizeLimitConfig rejects the messages with a larger payload
+type sizeLimitConfig struct {
+	MaxSize int `mapstructure:"maxSize" validate:"required,gt=0"`
+}
+
+type sizeLimitMiddleware struct {
+	maxSize int
+}
+
+func newSizeLimitMiddleware(opts map[string]any) (*sizeLimitMiddleware, error) {
+	cfg := new(sizeLimitConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		return nil, err
+	}
+	return &sizeLimitMiddleware{maxSize: cfg.MaxSize}, nil
+}
+
+func (m *sizeLimitMiddleware) Handle(_ context.Context, msg *message.RunnerMessage) (*message.RunnerMessage, error) {
+	data, err := msg.GetData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data: %w", err)
+	}
+	if len(data) > m.maxSize {
+		return nil, fmt.Errorf("payload size %d exceeds limit %d", len(data), m.maxSize)
+	}
+	return msg, nil
+}
+
+func (m *sizeLimitMiddleware) Close() error { return nil }
+
+// dedupMiddleware drops the messages whose key was already seen within the TTL. It takes
+// the options of the dedup runner and applies its key and store to the source messages.
+// The key of a naked message is forgotten, so that its redelivery is accepted.
+type dedupMiddleware struct {
+	runner *dedupRunner
+}
+
+func newDedupMiddleware(opts map[string]any, logger *slog.Logger) (*dedupMiddleware, error) {
+	cfg := new(dedupRunnerConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		return nil, err
+	}
+	r, err := newDedupRunner(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &dedupMiddleware{runner: r}, nil
+}
+
+func (m *dedupMiddleware) Handle(_ context.Context, msg *message.RunnerMessage) (*message.RunnerMessage, error) {
+	key, err := m.runner.key(msg)
+	if err != nil {
+		return nil, err
+	}
+	dup, err := m.runner.seen(key)
+	if err != nil {
+		return nil, err
+	}
+	if dup {
+		return nil, fmt.Errorf("%w: duplicate key %s", errMiddlewareDrop, key)
+	}
+	wrapped, err := wrapMessage(msg, &dedupMessage{SourceMessage: msg, forget: func() { m.runner.forget(key) }})
+	if err != nil {
+		m.runner.forget(key)
+		return nil, err
+	}
+	return wrapped, nil
+}
+
+func (m *dedupMiddleware) Close() error {
+	return m.runner.Close()
+}
+
+// dedupMessage forgets the deduplication key when the message is naked
+type dedupMessage struct {
+	message.SourceMessage
+	once   sync.Once
+	forget func()
+}
+
+func (m *dedupMessage) Nak() error {
+	m.once.Do(m.forget)
+	return m.SourceMessage.Nak()
+}
+
+// wrapMessage returns a message of the wrapping source message carrying the
+// metadata, payload and ingress time of the message
+func wrapMessage(msg *message.RunnerMessage, wrapper message.SourceMessage) (*message.RunnerMessage, error) {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	wrapped := message.NewRunnerMessage(wrapper)
+	wrapped.SetIngressTime(msg.GetIngressTime())
+	wrapped.SetTraceContext(msg.GetTraceContext())
+	wrapped.SetMetadata(meta)
+	wrapped.SetData(data)
+	return wrapped, nil
+}
+
+// rateLimitConfig bounds the rate of the messages handed to the runners
+type rateLimitConfig struct {
+	// Rate is the number of messages per second
+	Rate  float64 `mapstructure:"rate" validate:"required,gt=0"`
+	Burst int     `mapstructure:"burst" default:"1" validate:"gt=0"`
+	// Mode is "wait" (the message is delayed) or "reject" (the message is naked)
+	Mode string `mapstructure:"mode" default:"wait" validate:"oneof=wait reject"`
+}
+
+type rateLimitMiddleware struct {
+	limiter *rate.Limiter
+	reject  bool
+}
+
+func newRateLimitMiddleware(opts map[string]any) (*rateLimitMiddleware, error) {
+	cfg := new(rateLimitConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		return nil, err
+	}
+	return &rateLimitMiddleware{
+		limiter: rate.NewLimiter(rate.Limit(cfg.Rate), cfg.Burst),
+		reject:  cfg.Mode == "reject",
+	}, nil
+}
+
+func (m *rateLimitMiddleware) Handle(ctx context.Context, msg *message.RunnerMessage) (*message.RunnerMessage, error) {
+	if m.reject {
+		if !m.limiter.Allow() {
+			return nil, fmt.Errorf("rate limit exceeded")
+		}
+		return msg, nil
+	}
+	if err := m.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limit wait: %w", err)
+	}
+	return msg, nil
+}
+
+func (m *rateLimitMiddleware) Close() error { return nil }
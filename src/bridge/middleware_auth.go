@@ -0,0 +1,135 @@
+package bridge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // supported for legacy webhook signatures
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"log/slog"
+	"maps"
+	"strings"
+
+	"github.com/sandrolain/events-bridge/src/common/jwtauth"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+// jwtMiddleware validates the JWT of the message and adds its claims to the metadata
+type jwtMiddleware struct {
+	auth *jwtauth.Authenticator
+}
+
+func newJWTMiddleware(opts map[string]any, logger *slog.Logger) (*jwtMiddleware, error) {
+	opts = maps.Clone(opts)
+	if opts == nil {
+		opts = map[string]any{}
+	}
+	opts["enabled"] = true
+	cfg := new(jwtauth.Config)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		return nil, err
+	}
+	auth, err := jwtauth.NewAuthenticator(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWT authenticator: %w", err)
+	}
+	return &jwtMiddleware{auth: auth}, nil
+}
+
+// Handle rejects the message with an invalid token when failOnError is set,
+// otherwise the verification outcome is only reported in the metadata
+func (m *jwtMiddleware) Handle(_ context.Context, msg *message.RunnerMessage) (*message.RunnerMessage, error) {
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+	result := m.auth.Authenticate(meta)
+	if !result.Verified && m.auth.ShouldFailOnError() {
+		return nil, result.Error
+	}
+	msg.MergeMetadata(result.Metadata)
+	return msg, nil
+}
+
+func (m *jwtMiddleware) Close() error {
+	return m.auth.Close()
+}
+
+// hmacConfig verifies the HMAC signature of the payload, e.g. of webhook deliveries
+type hmacConfig struct {
+	// Secret is the shared secret; it supports the "env:" and "file:" secret references
+	Secret string `mapstructure:"secret" validate:"required"`
+	// SignatureKey is the metadata key of the signature
+	SignatureKey string `mapstructure:"signatureKey" default:"x-signature"`
+	// Prefix is removed from the signature, e.g. "sha256="
+	Prefix    string `mapstructure:"prefix"`
+	Algorithm string `mapstructure:"algorithm" default:"sha256" validate:"oneof=sha1 sha256 sha512"`
+	Encoding  string `mapstructure:"encoding" default:"hex" validate:"oneof=hex base64"`
+}
+
+type hmacMiddleware struct {
+	cfg    hmacConfig
+	secret []byte
+	hash   func() hash.Hash
+}
+
+func newHMACMiddleware(opts map[string]any) (*hmacMiddleware, error) {
+	cfg := new(hmacConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		return nil, err
+	}
+	secret, err := secrets.Resolve(cfg.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secret: %w", err)
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("hmac secret is empty")
+	}
+	m := &hmacMiddleware{cfg: *cfg, secret: []byte(secret)}
+	switch cfg.Algorithm {
+	case "sha1":
+		m.hash = sha1.New
+	case "sha512":
+		m.hash = sha512.New
+	default:
+		m.hash = sha256.New
+	}
+	return m, nil
+}
+
+func (m *hmacMiddleware) Handle(_ context.Context, msg *message.RunnerMessage) (*message.RunnerMessage, error) {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	signature, ok := meta[m.cfg.SignatureKey]
+	if !ok || signature == "" {
+		return nil, fmt.Errorf("signature not found in metadata key: %s", m.cfg.SignatureKey)
+	}
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), m.cfg.Prefix)
+
+	var got []byte
+	if m.cfg.Encoding == "base64" {
+		got, err = base64.StdEncoding.DecodeString(signature)
+	} else {
+		got, err = hex.DecodeString(signature)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	mac := hmac.New(m.hash, m.secret)
+	mac.Write(data)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	return msg, nil
+}
+
+func (m *hmacMiddleware) Close() error { return nil }
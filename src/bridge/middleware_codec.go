@@ -0,0 +1,207 @@
+package bridge
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+// Compression formats of the decompress middleware
+const (
+	compressionAuto    = "auto"
+	compressionGzip    = "gzip"
+	compressionZlib    = "zlib"
+	compressionDeflate = "deflate"
+	compressionZstd    = "zstd"
+)
+
+// decompressConfig decompresses the payload
+type decompressConfig struct {
+	// Format is "auto" (from EncodingKey, then from the gzip and zstd magic bytes),
+	// "gzip", "zlib", "deflate" (raw) or "zstd"
+	Format string `mapstructure:"format" default:"auto" validate:"oneof=auto gzip zlib deflate zstd"`
+	// EncodingKey is the metadata key of the content encoding, removed once decoded
+	EncodingKey string `mapstructure:"encodingKey" default:"content-encoding"`
+	// MaxSize bounds the decompressed size
+	MaxSize int64 `mapstructure:"maxSize" default:"10485760" validate:"gt=0"` // 10MB default
+}
+
+type decompressMiddleware struct {
+	cfg decompressConfig
+}
+
+func newDecompressMiddleware(opts map[string]any) (*decompressMiddleware, error) {
+	cfg := new(decompressConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		return nil, err
+	}
+	return &decompressMiddleware{cfg: *cfg}, nil
+}
+
+// format returns the compression format of the payload, or "" when it is not compressed.
+// HTTP "deflate" is zlib-wrapped, as per RFC 9110. Only the gzip and zstd magic bytes are
+// detected: the zlib header is too short to tell it apart from plain text.
+func (m *decompressMiddleware) format(meta map[string]string, data []byte) (string, error) {
+	if m.cfg.Format != compressionAuto {
+		return m.cfg.Format, nil
+	}
+	if enc, ok := meta[m.cfg.EncodingKey]; ok && enc != "" {
+		switch strings.ToLower(strings.TrimSpace(enc)) {
+		case "gzip", "x-gzip":
+			return compressionGzip, nil
+		case "deflate", "zlib":
+			return compressionZlib, nil
+		case "zstd":
+			return compressionZstd, nil
+		case "identity":
+			return "", nil
+		default:
+			return "", fmt.Errorf("unsupported content encoding %q", enc)
+		}
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return compressionGzip, nil
+	case bytes.HasPrefix(data, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return compressionZstd, nil
+	}
+	return "", nil
+}
+
+func (m *decompressMiddleware) Handle(_ context.Context, msg *message.RunnerMessage) (*message.RunnerMessage, error) {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	format, err := m.format(meta, data)
+	if err != nil || format == "" {
+		return msg, err
+	}
+
+	var r io.Reader
+	switch format {
+	case compressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip payload: %w", err)
+		}
+		defer zr.Close() //nolint:errcheck
+		r = zr
+	case compressionZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zlib payload: %w", err)
+		}
+		defer zr.Close() //nolint:errcheck
+		r = zr
+	case compressionDeflate:
+		zr := flate.NewReader(bytes.NewReader(data))
+		defer zr.Close() //nolint:errcheck
+		r = zr
+	case compressionZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderMaxMemory(uint64(m.cfg.MaxSize))) //nolint:gosec // positive by validation
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd payload: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	out, err := io.ReadAll(io.LimitReader(r, m.cfg.MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s payload: %w", format, err)
+	}
+	if int64(len(out)) > m.cfg.MaxSize {
+		return nil, fmt.Errorf("decompressed size exceeds limit %d", m.cfg.MaxSize)
+	}
+
+	meta = maps.Clone(meta)
+	delete(meta, m.cfg.EncodingKey)
+	msg.SetMetadata(meta)
+	msg.SetData(out)
+	return msg, nil
+}
+
+func (m *decompressMiddleware) Close() error { return nil }
+
+// decryptConfig decrypts AES-GCM payloads made of the nonce followed by the ciphertext
+type decryptConfig struct {
+	// Key is the base64 AES key of 16, 24 or 32 bytes; it supports the "env:" and "file:" secret references
+	Key string `mapstructure:"key" validate:"required"`
+	// Encoding is the encoding of the payload: "raw" or "base64"
+	Encoding string `mapstructure:"encoding" default:"raw" validate:"oneof=raw base64"`
+	// AADKey is the metadata key of the additional authenticated data (optional)
+	AADKey string `mapstructure:"aadKey"`
+}
+
+type decryptMiddleware struct {
+	aead     cipher.AEAD
+	encoding string
+	aadKey   string
+}
+
+func newDecryptMiddleware(opts map[string]any) (*decryptMiddleware, error) {
+	cfg := new(decryptConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		return nil, err
+	}
+	secret, err := secrets.Resolve(cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptMiddleware{aead: aead, encoding: cfg.Encoding, aadKey: cfg.AADKey}, nil
+}
+
+func (m *decryptMiddleware) Handle(_ context.Context, msg *message.RunnerMessage) (*message.RunnerMessage, error) {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	if m.encoding == "base64" {
+		if data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err != nil {
+			return nil, fmt.Errorf("invalid base64 payload: %w", err)
+		}
+	}
+	size := m.aead.NonceSize()
+	if len(data) < size+m.aead.Overhead() {
+		return nil, fmt.Errorf("encrypted payload too short")
+	}
+	var aad []byte
+	if m.aadKey != "" {
+		aad = []byte(meta[m.aadKey])
+	}
+	plain, err := m.aead.Open(nil, data[:size], data[size:], aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	msg.SetData(plain)
+	return msg, nil
+}
+
+func (m *decryptMiddleware) Close() error { return nil }
@@ -0,0 +1,264 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/awssign"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+// remotePayloadConfig fetches the payload referenced in the metadata from a remote store,
+// on the first read of the payload
+type remotePayloadConfig struct {
+	// RefKey is the metadata key holding the reference: a path relative to BaseURL or to the
+	// S3 prefix, or an absolute URL under them
+	RefKey string `mapstructure:"refKey" default:"eb-payload-ref" validate:"required"`
+	// BaseURL is the HTTP base URL of the payloads
+	BaseURL string `mapstructure:"baseURL" validate:"required_without=S3,excluded_with=S3,omitempty,url"`
+	// Headers are additional HTTP headers (values support env: and file: secrets)
+	Headers map[string]string `mapstructure:"headers"`
+	// S3 is the bucket of the payloads
+	S3 *remoteS3Config `mapstructure:"s3"`
+	// Timeout bounds every fetch
+	Timeout time.Duration `mapstructure:"timeout" default:"30s" validate:"gt=0"`
+	// MaxSize bounds the fetched payload size
+	MaxSize int64             `mapstructure:"maxSize" default:"104857600" validate:"gt=0"` // 100MB default
+	TLS     *tlsconfig.Config `mapstructure:"tls"`
+}
+
+// remoteS3Config is an S3 bucket prefix, read with AWS signature V4 requests
+type remoteS3Config struct {
+	Region string `mapstructure:"region" validate:"required"`
+	Bucket string `mapstructure:"bucket" validate:"required"`
+	Prefix string `mapstructure:"prefix"`
+	// Endpoint is the S3 compatible endpoint (default: https://s3.<region>.amazonaws.com)
+	Endpoint string `mapstructure:"endpoint" validate:"omitempty,url"`
+	// PathStyle addresses the bucket in the path instead of the host, e.g. for MinIO
+	PathStyle bool `mapstructure:"pathStyle"`
+	// AccessKeyID and SecretAccessKey sign the requests (values support env: and file: secrets);
+	// without them the requests are anonymous
+	AccessKeyID     string `mapstructure:"accessKeyId"`
+	SecretAccessKey string `mapstructure:"secretAccessKey" validate:"required_with=AccessKeyID"`
+	SessionToken    string `mapstructure:"sessionToken"`
+}
+
+// remotePayloadMiddleware replaces the payload of the messages carrying a reference with a
+// payload fetched from the remote store when a runner reads it, so that large attachments
+// are only transferred when needed
+type remotePayloadMiddleware struct {
+	cfg     remotePayloadConfig
+	client  *http.Client
+	headers map[string]string
+	s3      *remoteS3Config
+	now     func() time.Time
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func newRemotePayloadMiddleware(opts map[string]any) (*remotePayloadMiddleware, error) {
+	cfg := new(remotePayloadConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &remotePayloadMiddleware{
+		cfg: *cfg,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+		headers: make(map[string]string, len(cfg.Headers)),
+		now:     time.Now,
+	}
+	for k, v := range cfg.Headers {
+		if m.headers[k], err = secrets.Resolve(v); err != nil {
+			return nil, fmt.Errorf("failed to resolve header %s: %w", k, err)
+		}
+	}
+	if cfg.S3 != nil {
+		s3 := *cfg.S3
+		if s3.AccessKeyID, err = secrets.Resolve(s3.AccessKeyID); err != nil {
+			return nil, fmt.Errorf("failed to resolve S3 access key: %w", err)
+		}
+		if s3.SecretAccessKey, err = secrets.Resolve(s3.SecretAccessKey); err != nil {
+			return nil, fmt.Errorf("failed to resolve S3 secret key: %w", err)
+		}
+		if s3.SessionToken, err = secrets.Resolve(s3.SessionToken); err != nil {
+			return nil, fmt.Errorf("failed to resolve S3 session token: %w", err)
+		}
+		if s3.Endpoint == "" {
+			s3.Endpoint = "https://s3." + s3.Region + ".amazonaws.com"
+		}
+		m.s3 = &s3
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m, nil
+}
+
+// Handle wraps the messages carrying a reference so that their payload is fetched on the first read.
+// The messages without reference are passed on unchanged.
+func (m *remotePayloadMiddleware) Handle(_ context.Context, msg *message.RunnerMessage) (*message.RunnerMessage, error) {
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+	ref, ok := meta[m.cfg.RefKey]
+	if !ok || ref == "" {
+		return msg, nil
+	}
+	location, err := m.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := message.NewRunnerMessage(&remotePayloadMessage{
+		SourceMessage: msg,
+		ref:           location,
+		fetch:         func() ([]byte, error) { return m.fetch(location) },
+	})
+	wrapped.SetIngressTime(msg.GetIngressTime())
+	wrapped.SetTraceContext(msg.GetTraceContext())
+	wrapped.SetMetadata(meta)
+	return wrapped, nil
+}
+
+// resolve returns the absolute location of a reference: an HTTP URL under the base URL, or
+// an s3://bucket/key URL under the S3 prefix
+func (m *remotePayloadMiddleware) resolve(ref string) (string, error) {
+	unescaped, err := url.PathUnescape(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid payload reference %q: %w", ref, err)
+	}
+	if slices.Contains(strings.Split(ref, "/"), "..") || slices.Contains(strings.Split(unescaped, "/"), "..") {
+		return "", fmt.Errorf("invalid payload reference %q: parent segments are not allowed", ref)
+	}
+
+	if m.s3 == nil {
+		base := strings.TrimSuffix(m.cfg.BaseURL, "/") + "/"
+		if strings.Contains(ref, "://") {
+			if !strings.HasPrefix(ref, base) {
+				return "", fmt.Errorf("payload reference %q is not under the base URL", ref)
+			}
+			return ref, nil
+		}
+		return base + strings.TrimPrefix(ref, "/"), nil
+	}
+
+	root := "s3://" + m.s3.Bucket + "/" + m.s3.Prefix
+	if strings.Contains(ref, "://") {
+		if !strings.HasPrefix(ref, root) || len(ref) == len(root) {
+			return "", fmt.Errorf("payload reference %q is not under the S3 prefix", ref)
+		}
+		return ref, nil
+	}
+	return root + strings.TrimPrefix(ref, "/"), nil
+}
+
+// fetch reads the payload at the location
+func (m *remotePayloadMiddleware) fetch(location string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(m.ctx, m.cfg.Timeout)
+	defer cancel()
+
+	target := location
+	if m.s3 != nil {
+		target = m.s3URL(strings.TrimPrefix(location, "s3://"+m.s3.Bucket+"/"))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range m.headers {
+		req.Header.Set(k, v)
+	}
+	if m.s3 != nil && m.s3.AccessKeyID != "" {
+		signS3Request(req, m.s3, m.now().UTC())
+	}
+
+	res, err := m.client.Do(req) //nolint:gosec // location under the configured base URL or bucket
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payload %s: %w", location, err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to fetch payload %s: status code %d", location, res.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, m.cfg.MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payload %s: %w", location, err)
+	}
+	if int64(len(data)) > m.cfg.MaxSize {
+		return nil, fmt.Errorf("payload %s exceeds limit %d", location, m.cfg.MaxSize)
+	}
+	return data, nil
+}
+
+// s3URL returns the URL of an object key, in virtual-hosted or path style
+func (m *remotePayloadMiddleware) s3URL(key string) string {
+	u, _ := url.Parse(m.s3.Endpoint) // validated
+	path := "/" + key
+	if m.s3.PathStyle {
+		path = "/" + m.s3.Bucket + path
+	} else {
+		u.Host = m.s3.Bucket + "." + u.Host
+	}
+	u.Path = path
+	u.RawPath = awssign.EscapePath(path)
+	return u.String()
+}
+
+func (m *remotePayloadMiddleware) Close() error {
+	m.cancel()
+	m.client.CloseIdleConnections()
+	return nil
+}
+
+// remotePayloadMessage fetches its payload from the remote store on the first read
+type remotePayloadMessage struct {
+	message.SourceMessage
+	ref    string
+	fetch  func() ([]byte, error)
+	once   sync.Once
+	loaded atomic.Bool
+	data   []byte
+	err    error
+}
+
+func (m *remotePayloadMessage) GetData() ([]byte, error) {
+	m.once.Do(func() {
+		m.data, m.err = m.fetch()
+		m.loaded.Store(true)
+	})
+	return m.data, m.err
+}
+
+// PayloadRef returns the location of the payload until it is fetched
+func (m *remotePayloadMessage) PayloadRef() (string, bool) {
+	if m.loaded.Load() {
+		return "", false
+	}
+	return m.ref, true
+}
+
+// signS3Request signs a GET request with AWS signature V4, leaving the payload unsigned
+func signS3Request(req *http.Request, cfg *remoteS3Config, now time.Time) {
+	req.Header.Set("X-Amz-Content-Sha256", awssign.UnsignedPayload)
+	creds := awssign.Credentials{AccessKeyID: cfg.AccessKeyID, SecretAccessKey: cfg.SecretAccessKey, SessionToken: cfg.SessionToken}
+	awssign.SignRequest(req, creds, cfg.Region, "s3", awssign.UnsignedPayload, now)
+}
@@ -0,0 +1,424 @@
+package bridge
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sandrolain/events-bridge/src/common/jwtauth"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func newTestMiddleware(t *testing.T, typ string, opts map[string]any) inboundMiddleware {
+	t.Helper()
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	mw, err := b.createMiddleware(connectors.MiddlewareConfig{Type: typ, Options: opts})
+	if err != nil {
+		t.Fatalf("createMiddleware(%s) unexpected error = %v", typ, err)
+	}
+	return mw
+}
+
+func gzipData(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCreateMiddlewareInvalid(t *testing.T) {
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	for _, cfg := range []connectors.MiddlewareConfig{
+		{Type: "unknown"},
+		{Type: "sizeLimit"},
+		{Type: "decompress", Options: map[string]any{"format": "brotli"}},
+		{Type: "decrypt", Options: map[string]any{"key": base64.StdEncoding.EncodeToString([]byte("short"))}},
+		{Type: "jwt", Options: map[string]any{"issuer": "iss"}},
+		{Type: "hmac", Options: map[string]any{"secret": "env:EB_TEST_UNSET_SECRET"}},
+		{Type: "rateLimit", Options: map[string]any{"rate": 0}},
+		{Type: "remotePayload"},
+		{Type: "remotePayload", Options: map[string]any{"baseURL": "http://files", "s3": map[string]any{"region": "r", "bucket": "b"}}},
+	} {
+		if _, err := b.createMiddleware(cfg); err == nil {
+			t.Errorf("createMiddleware() expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestSizeLimitMiddleware(t *testing.T) {
+	mw := newTestMiddleware(t, "sizeLimit", map[string]any{"maxSize": 4})
+	if _, err := mw.Handle(context.Background(), message.NewRunnerMessage(testutil.NewAdapter([]byte("1234"), nil))); err != nil {
+		t.Errorf("Handle() unexpected error = %v", err)
+	}
+	if _, err := mw.Handle(context.Background(), message.NewRunnerMessage(testutil.NewAdapter([]byte("12345"), nil))); err == nil {
+		t.Error("Handle() expected error for a larger payload")
+	}
+}
+
+func TestDecompressMiddleware(t *testing.T) {
+	mw := newTestMiddleware(t, "decompress", nil)
+
+	// Detected from the content encoding, which is removed
+	msg := message.NewRunnerMessage(testutil.NewAdapter(gzipData(t, "hello"), map[string]string{"content-encoding": "gzip"}))
+	if _, err := mw.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("Handle() unexpected error = %v", err)
+	}
+	meta, data, _ := msg.GetMetadataAndData()
+	if string(data) != "hello" || meta["content-encoding"] != "" {
+		t.Errorf("unexpected message %q %v", data, meta)
+	}
+
+	// Detected from the magic bytes
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg = message.NewRunnerMessage(testutil.NewAdapter(enc.EncodeAll([]byte("zstd payload"), nil), nil))
+	if _, err := mw.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("Handle() unexpected error = %v", err)
+	}
+	if data, _ := msg.GetData(); string(data) != "zstd payload" {
+		t.Errorf("unexpected payload %q", data)
+	}
+
+	// Plain payloads are passed unchanged
+	msg = message.NewRunnerMessage(testutil.NewAdapter([]byte("x plain"), nil))
+	if _, err := mw.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("Handle() unexpected error = %v", err)
+	}
+	if data, _ := msg.GetData(); string(data) != "x plain" {
+		t.Errorf("unexpected payload %q", data)
+	}
+
+	// Decompression bombs are rejected
+	limited := newTestMiddleware(t, "decompress", map[string]any{"maxSize": 10})
+	msg = message.NewRunnerMessage(testutil.NewAdapter(gzipData(t, string(make([]byte, 1000))), nil))
+	if _, err := limited.Handle(context.Background(), msg); err == nil {
+		t.Error("Handle() expected error for a decompressed size over the limit")
+	}
+	msg = message.NewRunnerMessage(testutil.NewAdapter([]byte("data"), map[string]string{"content-encoding": "br"}))
+	if _, err := mw.Handle(context.Background(), msg); err == nil {
+		t.Error("Handle() expected error for an unsupported encoding")
+	}
+}
+
+func TestDecryptMiddleware(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	sealed := aead.Seal(nonce, nonce, []byte("secret"), []byte("tenant-1"))
+
+	mw := newTestMiddleware(t, "decrypt", map[string]any{
+		"key":      base64.StdEncoding.EncodeToString(key),
+		"encoding": "base64",
+		"aadKey":   "tenant",
+	})
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(base64.StdEncoding.EncodeToString(sealed)), map[string]string{"tenant": "tenant-1"}))
+	if _, err := mw.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("Handle() unexpected error = %v", err)
+	}
+	if data, _ := msg.GetData(); string(data) != "secret" {
+		t.Errorf("unexpected payload %q", data)
+	}
+
+	msg = message.NewRunnerMessage(testutil.NewAdapter([]byte(base64.StdEncoding.EncodeToString(sealed)), map[string]string{"tenant": "tenant-2"}))
+	if _, err := mw.Handle(context.Background(), msg); err == nil {
+		t.Error("Handle() expected error for a different additional data")
+	}
+}
+
+func TestHMACMiddleware(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(`{"event":"push"}`))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	mw := newTestMiddleware(t, "hmac", map[string]any{"secret": "s3cret", "signatureKey": "x-hub-signature-256", "prefix": "sha256="})
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"event":"push"}`), map[string]string{"x-hub-signature-256": signature}))
+	if _, err := mw.Handle(context.Background(), msg); err != nil {
+		t.Errorf("Handle() unexpected error = %v", err)
+	}
+
+	for _, meta := range []map[string]string{nil, {"x-hub-signature-256": "sha256=00"}, {"x-hub-signature-256": "zz"}} {
+		msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"event":"push"}`), meta))
+		if _, err := mw.Handle(context.Background(), msg); err == nil {
+			t.Errorf("Handle() expected error for %v", meta)
+		}
+	}
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	server := jwtauth.SetupMockJWKSServer(t)
+	defer server.Close()
+	token, err := server.CreateValidToken(map[string]any{
+		"sub": "user-1",
+		"iss": "issuer",
+		"aud": "bridge",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := map[string]any{"jwksUrl": server.URL(), "issuer": "issuer", "audience": "bridge", "failOnError": true}
+	mw := newTestMiddleware(t, "jwt", opts)
+	defer mw.Close() //nolint:errcheck
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("data"), map[string]string{"authorization": "Bearer " + token}))
+	if _, err := mw.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("Handle() unexpected error = %v", err)
+	}
+	if meta, _ := msg.GetMetadata(); meta["eb-jwt-sub"] != "user-1" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+
+	msg = message.NewRunnerMessage(testutil.NewAdapter([]byte("data"), map[string]string{"authorization": "Bearer invalid"}))
+	if _, err := mw.Handle(context.Background(), msg); err == nil {
+		t.Error("Handle() expected error for an invalid token")
+	}
+}
+
+func TestDedupMiddleware(t *testing.T) {
+	mw := newTestMiddleware(t, "dedup", map[string]any{
+		"key":    map[string]any{"from": "metadata", "path": "id"},
+		"ttl":    "1m",
+		"memory": map[string]any{"maxKeys": 2},
+	})
+	defer mw.Close() //nolint:errcheck
+
+	handle := func(id string) (*message.RunnerMessage, *countingMessage, error) {
+		src := newCountingMessage("data")
+		src.Metadata = map[string]string{"id": id}
+		msg, err := mw.Handle(context.Background(), message.NewRunnerMessage(src))
+		return msg, src, err
+	}
+
+	if _, _, err := handle("a"); err != nil {
+		t.Fatalf("Handle() unexpected error = %v", err)
+	}
+	if _, _, err := handle("a"); !errors.Is(err, errMiddlewareDrop) {
+		t.Errorf("Handle() error = %v, want a drop of the duplicate", err)
+	}
+
+	// A naked message is accepted again
+	msg, src, err := handle("b")
+	if err != nil {
+		t.Fatalf("Handle() unexpected error = %v", err)
+	}
+	if meta, _ := msg.GetMetadata(); meta["id"] != "b" {
+		t.Errorf("wrapped message lost the metadata: %v", meta)
+	}
+	if err := msg.Nak(); err != nil || src.naks.Load() != 1 {
+		t.Fatalf("Nak() not forwarded to the source: %v", err)
+	}
+	if _, _, err := handle("b"); err != nil {
+		t.Errorf("Handle() unexpected error after nak = %v", err)
+	}
+
+	// Evicted keys are accepted again
+	if _, _, err := handle("c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := handle("a"); err != nil {
+		t.Errorf("Handle() unexpected error after eviction = %v", err)
+	}
+	src = newCountingMessage("data")
+	if _, err := mw.Handle(context.Background(), message.NewRunnerMessage(src)); err == nil || errors.Is(err, errMiddlewareDrop) {
+		t.Errorf("Handle() error = %v, want an error without the key", err)
+	}
+
+	// Same keys as the dedup runner: a JSON path of the payload
+	mw = newTestMiddleware(t, "dedup", map[string]any{"key": map[string]any{"path": "$.order.id"}})
+	defer mw.Close() //nolint:errcheck
+	for i, data := range []string{`{"order":{"id":7},"n":1}`, `{"order":{"id":7},"n":2}`} {
+		_, err := mw.Handle(context.Background(), message.NewRunnerMessage(testutil.NewAdapter([]byte(data), nil)))
+		if dropped := errors.Is(err, errMiddlewareDrop); dropped != (i == 1) {
+			t.Errorf("Handle(%s) error = %v", data, err)
+		}
+	}
+}
+
+func TestRemotePayloadMiddleware(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer srv.Close()
+
+	mw := newTestMiddleware(t, "remotePayload", map[string]any{
+		"baseURL": srv.URL + "/files",
+		"headers": map[string]any{"X-Token": "secret"},
+		"maxSize": 32,
+	})
+	defer mw.Close() //nolint:errcheck
+	handle := func(ref string) (*message.RunnerMessage, error) {
+		return mw.Handle(context.Background(), message.NewRunnerMessage(testutil.NewAdapter([]byte("ref"), map[string]string{"eb-payload-ref": ref})))
+	}
+
+	msg, err := handle("docs/a.pdf")
+	if err != nil {
+		t.Fatalf("Handle() unexpected error = %v", err)
+	}
+	// The payload is fetched on the first read only
+	if ref, ok := message.PayloadRef(msg); !ok || ref != srv.URL+"/files/docs/a.pdf" || hits.Load() != 0 {
+		t.Errorf("PayloadRef() = %q %v, fetches %d", ref, ok, hits.Load())
+	}
+	for range 2 {
+		if data, err := msg.GetData(); err != nil || string(data) != "content of /files/docs/a.pdf" {
+			t.Errorf("GetData() = %q, %v", data, err)
+		}
+	}
+	if _, ok := message.PayloadRef(msg); ok || hits.Load() != 1 {
+		t.Errorf("fetched payload still referenced, fetches %d", hits.Load())
+	}
+
+	if msg, err = handle(srv.URL + "/files/too/large/payload.bin"); err != nil {
+		t.Fatalf("Handle() unexpected error = %v", err)
+	}
+	if _, err := msg.GetData(); err == nil {
+		t.Error("GetData() expected error for a larger payload")
+	}
+	for _, ref := range []string{"../secrets", "docs/%2e%2e/%2e%2e/x", "http://other.local/files/a"} {
+		if _, err := handle(ref); err == nil {
+			t.Errorf("Handle(%s) expected error", ref)
+		}
+	}
+	plain := message.NewRunnerMessage(testutil.NewAdapter([]byte("inline"), nil))
+	if out, err := mw.Handle(context.Background(), plain); err != nil || out != plain {
+		t.Errorf("message without reference changed: %v", err)
+	}
+}
+
+func TestRemotePayloadMiddlewareS3(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if r.URL.EscapedPath() != "/bucket/in/a%20b%3D1.json" || r.Header.Get("X-Amz-Date") != "20260302T101500Z" ||
+			!strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20260302/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	mw := newTestMiddleware(t, "remotePayload", map[string]any{
+		"s3": map[string]any{
+			"region": "eu-west-1", "bucket": "bucket", "prefix": "in/", "endpoint": srv.URL, "pathStyle": true,
+			"accessKeyId": "AKID", "secretAccessKey": "secret",
+		},
+	}).(*remotePayloadMiddleware)
+	mw.now = func() time.Time { return time.Date(2026, 3, 2, 10, 15, 0, 0, time.UTC) }
+	defer mw.Close() //nolint:errcheck
+
+	for _, ref := range []string{"a b=1.json", "s3://bucket/in/a b=1.json"} {
+		msg, err := mw.Handle(context.Background(), message.NewRunnerMessage(testutil.NewAdapter(nil, map[string]string{"eb-payload-ref": ref})))
+		if err != nil {
+			t.Fatalf("Handle() unexpected error = %v", err)
+		}
+		if data, err := msg.GetData(); err != nil || string(data) != "{}" {
+			t.Errorf("GetData() = %q, %v", data, err)
+		}
+	}
+	if _, err := mw.resolve("s3://other/in/a.json"); err == nil {
+		t.Error("resolve() expected error for another bucket")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	mw := newTestMiddleware(t, "rateLimit", map[string]any{"rate": 0.001, "burst": 1, "mode": "reject"})
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("data"), nil))
+	if _, err := mw.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("Handle() unexpected error = %v", err)
+	}
+	if _, err := mw.Handle(context.Background(), msg); err == nil {
+		t.Error("Handle() expected error over the rate")
+	}
+
+	wait := newTestMiddleware(t, "rateLimit", map[string]any{"rate": 0.001})
+	if _, err := wait.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("Handle() unexpected error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := wait.Handle(ctx, msg); err == nil {
+		t.Error("Handle() expected error when the wait exceeds the deadline")
+	}
+}
+
+func TestMiddlewarePipeline(t *testing.T) {
+	src := newChanSource()
+	runner := &recordingRunner{}
+	b := &EventsBridge{
+		cfg:    newTestConfig(),
+		logger: newTestLogger(),
+		source: src,
+		runners: []RunnerItem{{
+			Config: connectors.RunnerConfig{Type: "test"},
+			Runner: runner,
+		}},
+	}
+	b.cfg.Source.Middleware = []connectors.MiddlewareConfig{
+		{Type: "decompress"},
+		{Type: "sizeLimit", Options: map[string]any{"maxSize": 8}},
+		{Type: "dedup"},
+	}
+	if err := b.initializeMiddleware(); err != nil {
+		t.Fatalf("initializeMiddleware() unexpected error = %v", err)
+	}
+	defer b.closeMiddleware()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+
+	accepted := newCountingMessage(string(gzipData(t, "payload")))
+	src.c <- message.NewRunnerMessage(accepted)
+	waitFor(t, func() bool { return accepted.acks.Load() == 1 })
+
+	duplicate := newCountingMessage("payload")
+	src.c <- message.NewRunnerMessage(duplicate)
+	waitFor(t, func() bool { return duplicate.acks.Load() == 1 })
+
+	rejected := newCountingMessage("too large payload")
+	src.c <- message.NewRunnerMessage(rejected)
+	waitFor(t, func() bool { return rejected.naks.Load() == 1 })
+
+	if runner.processed() != 1 || runner.data[0] != "payload" {
+		t.Errorf("unexpected processed payloads %v", runner.data)
+	}
+}
@@ -0,0 +1,116 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sync"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+// sourceIDMetadataKey is the metadata key carrying the id of the source of a message
+// in a bridge with several sources
+const sourceIDMetadataKey = "eb-source"
+
+// Ensure multiSource implements connectors.Source
+var _ connectors.Source = (*multiSource)(nil)
+
+// multiSourceItem is a source merged by a multiSource
+type multiSourceItem struct {
+	id     string
+	typ    string
+	buffer int
+	source connectors.Source
+}
+
+// multiSource merges the messages of several sources into a single channel,
+// tagging every message with the id of its source
+type multiSource struct {
+	items  []multiSourceItem
+	logger *slog.Logger
+}
+
+// createMultiSource creates the sources of the list
+func (b *EventsBridge) createMultiSource(cfgs []connectors.SourceConfig) (*multiSource, error) {
+	if len(cfgs) == 0 {
+		return nil, fmt.Errorf("multi source requires at least one entry in sources")
+	}
+	ms := &multiSource{logger: b.logger.With("component", "multi-source")}
+	for _, cfg := range cfgs {
+		b.logger.Info("creating source", "id", cfg.ID, "type", cfg.Type, "buffer", cfg.Buffer)
+		source, err := utils.LoadPluginAndConfig[connectors.Source](
+			connectorPath(cfg.Type),
+			connectors.NewSourceMethodName,
+			connectors.NewSourceConfigName,
+			cfg.Options,
+			b.cfg.StrictConfig,
+		)
+		if err != nil {
+			ms.Close() //nolint:errcheck
+			return nil, fmt.Errorf("source %q: %w", cfg.ID, err)
+		}
+		ms.items = append(ms.items, multiSourceItem{id: cfg.ID, typ: cfg.Type, buffer: cfg.Buffer, source: source})
+	}
+	return ms, nil
+}
+
+// Produce starts every source, with its own buffer or the shared one, and merges their
+// channels. The merged channel is closed once every source channel is closed.
+func (s *multiSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	out := make(chan *message.RunnerMessage, buffer)
+	var wg sync.WaitGroup
+	for _, item := range s.items {
+		size := item.buffer
+		if size == 0 {
+			size = buffer
+		}
+		c, err := item.source.Produce(size)
+		if err != nil {
+			s.Close() //nolint:errcheck
+			return nil, fmt.Errorf("source %q: %w", item.id, err)
+		}
+		wg.Add(1)
+		go func(id string, c <-chan *message.RunnerMessage) {
+			defer wg.Done()
+			for msg := range c {
+				s.tag(msg, id)
+				out <- msg
+			}
+		}(item.id, c)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out, nil
+}
+
+// tag sets the source id in the metadata of the message
+func (s *multiSource) tag(msg *message.RunnerMessage, id string) {
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		s.logger.Warn("failed to get message metadata, source id not set", "source", id, "error", err)
+		return
+	}
+	meta = maps.Clone(meta)
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	meta[sourceIDMetadataKey] = id
+	msg.SetMetadata(meta)
+}
+
+// Close closes every source
+func (s *multiSource) Close() error {
+	var errs []error
+	for _, item := range s.items {
+		if err := item.source.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("source %q: %w", item.id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package bridge
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func TestMultiSourceMergesAndTags(t *testing.T) {
+	a, b := newChanSource(), newChanSource()
+	ms := &multiSource{
+		items:  []multiSourceItem{{id: "plant-a", source: a}, {id: "plant-b", source: b}},
+		logger: newTestLogger(),
+	}
+	c, err := ms.Produce(4)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+
+	a.c <- message.NewRunnerMessage(testutil.NewAdapter([]byte("a"), map[string]string{"k": "v"}))
+	b.c <- message.NewRunnerMessage(testutil.NewAdapter([]byte("b"), nil))
+
+	got := map[string]map[string]string{}
+	for range 2 {
+		select {
+		case msg := <-c:
+			meta, data, _ := msg.GetMetadataAndData()
+			got[string(data)] = meta
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for merged messages")
+		}
+	}
+	if got["a"][sourceIDMetadataKey] != "plant-a" || got["a"]["k"] != "v" {
+		t.Errorf("message a metadata = %v", got["a"])
+	}
+	if got["b"][sourceIDMetadataKey] != "plant-b" {
+		t.Errorf("message b metadata = %v", got["b"])
+	}
+
+	close(a.c)
+	close(b.c)
+	select {
+	case _, ok := <-c:
+		if ok {
+			t.Error("unexpected message after the sources closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("merged channel not closed after the sources closed")
+	}
+
+	if err := ms.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+	if !a.closed.Load() || !b.closed.Load() {
+		t.Error("sources not closed")
+	}
+}
+
+func TestMultiSourceProduceError(t *testing.T) {
+	a, b := newChanSource(), newChanSource()
+	b.produceErr = errors.New("boom")
+	ms := &multiSource{
+		items:  []multiSourceItem{{id: "a", source: a}, {id: "b", source: b}},
+		logger: newTestLogger(),
+	}
+	if _, err := ms.Produce(1); !errors.Is(err, b.produceErr) {
+		t.Fatalf("Produce() error = %v", err)
+	}
+	if !a.closed.Load() {
+		t.Error("started source not closed after the failure")
+	}
+
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	if _, err := bridge.createMultiSource([]connectors.SourceConfig{}); err == nil {
+		t.Error("expected error without sources")
+	}
+}
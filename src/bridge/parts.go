@@ -0,0 +1,314 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sandrolain/events-bridge/src/common"
+	"github.com/sandrolain/events-bridge/src/common/expreval"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	partsRunnerType = "parts"
+
+	completionAll  = "all"
+	completionAny  = "any"
+	completionNone = "none"
+
+	contentTypeKey = "content-type"
+)
+
+// Metadata keys of the parts and of the part delivery result
+const (
+	metaPartIndex    = "eb-part-index"
+	metaPartCount    = "eb-part-count"
+	metaPartName     = "eb-part-name"
+	metaPartFilename = "eb-part-filename"
+
+	// metaPartsDelivered lists the indexes of the parts accepted by all their routes
+	metaPartsDelivered = "eb-parts-delivered"
+	// metaPartsFailed lists the indexes of the parts failed by one of their routes
+	metaPartsFailed = "eb-parts-failed"
+	// metaPartsSkipped lists the indexes of the parts matching no route or filtered out by a route
+	metaPartsSkipped = "eb-parts-skipped"
+)
+
+// Ensure partsRunner implements connectors.LifecycleRunner
+var _ connectors.LifecycleRunner = (*partsRunner)(nil)
+
+// partRoute is a runner chain receiving the parts matching its when expression
+type partRoute struct {
+	when      *expreval.ExprEvaluator
+	isDefault bool
+	stages    []branchStage
+}
+
+// partsRunner splits a multipart message into its parts and routes every part
+// through the runner chains of the matching routes
+type partsRunner struct {
+	routes     []partRoute
+	completion string
+	logger     *slog.Logger
+}
+
+// partsRunnerConfig holds the options of the parts runner
+type partsRunnerConfig struct {
+	// Routes are the runner chains of the parts. A part is routed to every route whose when
+	// expression matches, or to the default routes when none does.
+	Routes []partRouteConfig `mapstructure:"routes" validate:"required,min=1,dive"`
+	// Completion selects when the message succeeds: "all" (default, no part failed),
+	// "any" (a part was delivered or none failed) or "none" (the failures are only reported)
+	Completion string `mapstructure:"completion" validate:"omitempty,oneof=all any none"`
+}
+
+// partRouteConfig holds the options of a route of the parts runner
+type partRouteConfig struct {
+	// When is the expression selecting the parts of the route (empty = every part)
+	When string `mapstructure:"when" validate:"excluded_with=Default"`
+	// Default routes receive the parts matching no other route
+	Default bool `mapstructure:"default"`
+	// Runners is the runner chain of the parts
+	Runners []connectors.RunnerConfig `mapstructure:"runners" validate:"required,min=1,dive"`
+}
+
+// createPartsRunner builds the routes of a "parts" runner configuration
+func (b *EventsBridge) createPartsRunner(runnerConfig connectors.RunnerConfig) (connectors.Runner, error) {
+	cfg := new(partsRunnerConfig)
+	if err := b.parseRunnerOptions(runnerConfig, cfg); err != nil {
+		return nil, err
+	}
+
+	pr := &partsRunner{
+		completion: cfg.Completion,
+		logger:     b.logger.With("component", "parts"),
+	}
+	if pr.completion == "" {
+		pr.completion = completionAll
+	}
+
+	for i, routeCfg := range cfg.Routes {
+		when, err := expreval.NewExprEvaluator(routeCfg.When)
+		if err != nil {
+			pr.Close() //nolint:errcheck
+			return nil, fmt.Errorf("route %d: failed to create when evaluator: %w", i, err)
+		}
+		stages, err := b.createStages(routeCfg.Runners)
+		if err != nil {
+			pr.Close() //nolint:errcheck
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+		pr.routes = append(pr.routes, partRoute{when: when, isDefault: routeCfg.Default, stages: stages})
+	}
+	return pr, nil
+}
+
+// Process delivers every part of the message to its routes concurrently and sets the
+// delivery result metadata. The error follows the completion policy.
+func (r *partsRunner) Process(msg *message.RunnerMessage) error {
+	parts, err := splitParts(msg)
+	if err != nil {
+		return err
+	}
+
+	routes := make([][]int, len(parts))
+	for i, part := range parts {
+		if routes[i], err = r.route(part); err != nil {
+			return fmt.Errorf("part %d: %w", i, err)
+		}
+	}
+
+	type routeResult struct {
+		part   int
+		passed bool
+		err    error
+	}
+	var results []*routeResult
+	var wg sync.WaitGroup
+	for i, part := range parts {
+		for _, route := range routes[i] {
+			res := &routeResult{part: i}
+			results = append(results, res)
+			clone := part.Clone()
+			wg.Go(func() {
+				_, res.passed, res.err = runBranch(clone, r.routes[route].stages)
+			})
+		}
+	}
+	wg.Wait()
+
+	failures := make([]error, len(parts))
+	filtered := make([]bool, len(parts))
+	for _, res := range results {
+		if res.err != nil {
+			failures[res.part] = errors.Join(failures[res.part], res.err)
+		} else if !res.passed {
+			filtered[res.part] = true
+		}
+	}
+
+	var delivered, failed, skipped []int
+	var errs []error
+	for i := range parts {
+		switch {
+		case failures[i] != nil:
+			failed = append(failed, i)
+			errs = append(errs, fmt.Errorf("part %d: %w", i, failures[i]))
+		case len(routes[i]) == 0 || filtered[i]:
+			skipped = append(skipped, i)
+		default:
+			delivered = append(delivered, i)
+		}
+	}
+	msg.AddMetadata(metaPartsDelivered, joinIndexes(delivered))
+	msg.AddMetadata(metaPartsFailed, joinIndexes(failed))
+	msg.AddMetadata(metaPartsSkipped, joinIndexes(skipped))
+
+	if len(errs) == 0 {
+		return nil
+	}
+	switch r.completion {
+	case completionNone:
+		r.logger.Warn("message parts failed", "failed", len(failed), "parts", len(parts), "error", errors.Join(errs...))
+		return nil
+	case completionAny:
+		if len(delivered) > 0 {
+			r.logger.Warn("message parts failed", "failed", len(failed), "parts", len(parts), "error", errors.Join(errs...))
+			return nil
+		}
+	}
+	return fmt.Errorf("%d of %d parts failed: %w", len(failed), len(parts), errors.Join(errs...))
+}
+
+// route returns the routes of the part: every conditional route that matches,
+// or the default routes when none does
+func (r *partsRunner) route(part *message.RunnerMessage) ([]int, error) {
+	var routes, defaults []int
+	for i, route := range r.routes {
+		if route.isDefault {
+			defaults = append(defaults, i)
+			continue
+		}
+		if route.when != nil {
+			pass, err := route.when.EvalMessage(part)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate when: %w", err)
+			}
+			if !pass {
+				continue
+			}
+		}
+		routes = append(routes, i)
+	}
+	if len(routes) == 0 {
+		return defaults, nil
+	}
+	return routes, nil
+}
+
+// splitParts returns a message for every part of a multipart message, with the data of the
+// part, the metadata of the message and the part metadata. The "content-type" metadata is
+// the content type of the part.
+func splitParts(msg *message.RunnerMessage) ([]*message.RunnerMessage, error) {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return nil, err
+	}
+	mediaType, params, err := mime.ParseMediaType(common.LookupFold(meta, contentTypeKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type: %w", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return nil, fmt.Errorf("message is not multipart: %s", mediaType)
+	}
+
+	var parts []*message.RunnerMessage
+	reader := multipart.NewReader(bytes.NewReader(data), params["boundary"])
+	for {
+		p, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read part %d: %w", len(parts), err)
+		}
+		body, err := io.ReadAll(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read part %d: %w", len(parts), err)
+		}
+
+		partMeta := common.CopyMap(meta, nil)
+		common.DeleteFold(partMeta, contentTypeKey)
+		if ct := p.Header.Get("Content-Type"); ct != "" {
+			partMeta[contentTypeKey] = ct
+		}
+		partMeta[metaPartIndex] = strconv.Itoa(len(parts))
+		if name := p.FormName(); name != "" {
+			partMeta[metaPartName] = name
+		}
+		if filename := p.FileName(); filename != "" {
+			partMeta[metaPartFilename] = filename
+		}
+
+		part := msg.Clone()
+		part.SetMetadata(partMeta)
+		part.SetData(body)
+		parts = append(parts, part)
+	}
+
+	count := strconv.Itoa(len(parts))
+	for _, part := range parts {
+		part.AddMetadata(metaPartCount, count)
+	}
+	return parts, nil
+}
+
+// Start calls the Start hook of the route runners implementing connectors.LifecycleRunner
+func (r *partsRunner) Start(ctx context.Context) error {
+	for i, route := range r.routes {
+		for j, stage := range route.stages {
+			if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+				if err := lr.Start(ctx); err != nil {
+					return fmt.Errorf("failed to start runner %d of route %d: %w", j, i, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Drain calls the Drain hook of the route runners implementing connectors.LifecycleRunner
+func (r *partsRunner) Drain(ctx context.Context) error {
+	var errs []error
+	for i, route := range r.routes {
+		for j, stage := range route.stages {
+			if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+				if err := lr.Drain(ctx); err != nil {
+					errs = append(errs, fmt.Errorf("failed to drain runner %d of route %d: %w", j, i, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the runners of all routes
+func (r *partsRunner) Close() error {
+	var errs []error
+	for i, route := range r.routes {
+		if err := closeStages(route.stages); err != nil {
+			errs = append(errs, fmt.Errorf("route %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,203 @@
+package bridge
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+const testPartsBoundary = "eb-boundary"
+
+// testMultipart is a form with a JSON part and an image part
+var testMultipart = strings.ReplaceAll(`--eb-boundary
+Content-Disposition: form-data; name="event"
+Content-Type: application/json
+
+{"id":1}
+--eb-boundary
+Content-Disposition: form-data; name="photo"; filename="photo.png"
+Content-Type: image/png
+
+PNGDATA
+--eb-boundary--
+`, "\n", "\r\n")
+
+// recordRunner records the parts it receives
+type recordRunner struct {
+	mu    sync.Mutex
+	parts []map[string]string
+	data  []string
+	err   error
+}
+
+func (r *recordRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parts = append(r.parts, meta)
+	r.data = append(r.data, string(data))
+	return r.err
+}
+
+func (r *recordRunner) Close() error {
+	return nil
+}
+
+func newMultipartMessage() *message.RunnerMessage {
+	return message.NewRunnerMessage(testutil.NewAdapter([]byte(testMultipart), map[string]string{
+		"Content-Type": "multipart/form-data; boundary=" + testPartsBoundary,
+		"source":       "upload",
+	}))
+}
+
+func newTestPartsRunner(t *testing.T, completion string, routes ...map[string]any) *partsRunner {
+	t.Helper()
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	list := make([]any, len(routes))
+	for i, route := range routes {
+		route["runners"] = []any{map[string]any{"type": "pass"}}
+		list[i] = route
+	}
+	runner, err := bridge.createRunner(connectors.RunnerConfig{
+		Type:    partsRunnerType,
+		Options: map[string]any{"routes": list, "completion": completion},
+	})
+	if err != nil {
+		t.Fatalf("createRunner() unexpected error = %v", err)
+	}
+	return runner.(*partsRunner)
+}
+
+// setRouteRunner replaces the runner chain of a route with the runner
+func setRouteRunner(pr *partsRunner, route int, runner connectors.Runner) {
+	pr.routes[route].stages = []branchStage{{runner: runner}}
+}
+
+func TestPartsRunnerRoutes(t *testing.T) {
+	pr := newTestPartsRunner(t, "",
+		map[string]any{"when": `metadata["content-type"] startsWith "image/"`},
+		map[string]any{"default": true},
+	)
+	images, others := &recordRunner{}, &recordRunner{}
+	setRouteRunner(pr, 0, images)
+	setRouteRunner(pr, 1, others)
+
+	msg := newMultipartMessage()
+	if err := pr.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+
+	if len(images.parts) != 1 || images.data[0] != "PNGDATA" {
+		t.Fatalf("image route received %v", images.data)
+	}
+	image := images.parts[0]
+	if image["content-type"] != "image/png" || image[metaPartIndex] != "1" || image[metaPartCount] != "2" ||
+		image[metaPartName] != "photo" || image[metaPartFilename] != "photo.png" || image["source"] != "upload" {
+		t.Errorf("unexpected image part metadata %v", image)
+	}
+	if _, ok := image["Content-Type"]; ok {
+		t.Errorf("image part kept the multipart content type: %v", image)
+	}
+	if len(others.parts) != 1 || others.data[0] != `{"id":1}` || others.parts[0]["content-type"] != "application/json" {
+		t.Fatalf("default route received %v", others.data)
+	}
+
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta[metaPartsDelivered] != "0,1" || meta[metaPartsFailed] != "" || meta[metaPartsSkipped] != "" {
+		t.Errorf("unexpected result metadata %v", meta)
+	}
+}
+
+func TestPartsRunnerUnroutedAndFiltered(t *testing.T) {
+	pr := newTestPartsRunner(t, "", map[string]any{"when": `metadata["eb-part-name"] == "event"`})
+	events := &recordRunner{err: &filteredError{expression: "false"}}
+	setRouteRunner(pr, 0, events)
+
+	msg := newMultipartMessage()
+	if err := pr.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta[metaPartsDelivered] != "" || meta[metaPartsSkipped] != "0,1" {
+		t.Errorf("unexpected result metadata %v", meta)
+	}
+}
+
+func TestPartsRunnerCompletion(t *testing.T) {
+	tests := []struct {
+		completion string
+		wantErr    bool
+	}{
+		{completionAll, true},
+		{completionAny, false},
+		{completionNone, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.completion, func(t *testing.T) {
+			pr := newTestPartsRunner(t, tt.completion,
+				map[string]any{"when": `metadata["eb-part-name"] == "photo"`},
+				map[string]any{"default": true},
+			)
+			setRouteRunner(pr, 0, &recordRunner{err: errors.New("store unavailable")})
+			setRouteRunner(pr, 1, &recordRunner{})
+
+			msg := newMultipartMessage()
+			err := pr.Process(msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Process() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			meta, _ := msg.GetMetadata()
+			if meta[metaPartsDelivered] != "0" || meta[metaPartsFailed] != "1" {
+				t.Errorf("unexpected result metadata %v", meta)
+			}
+		})
+	}
+
+	// Without a delivered part, "any" fails too
+	pr := newTestPartsRunner(t, completionAny, map[string]any{})
+	setRouteRunner(pr, 0, &recordRunner{err: errors.New("store unavailable")})
+	if err := pr.Process(newMultipartMessage()); err == nil {
+		t.Error("Process() expected error when no part is delivered")
+	}
+}
+
+func TestPartsRunnerNotMultipart(t *testing.T) {
+	pr := newTestPartsRunner(t, "", map[string]any{})
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{}`), map[string]string{"content-type": "application/json"}))
+	if err := pr.Process(msg); err == nil || !strings.Contains(err.Error(), "not multipart") {
+		t.Errorf("Process() error = %v, want not multipart", err)
+	}
+}
+
+func TestCreatePartsRunnerInvalid(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	tests := map[string]map[string]any{
+		"no routes":       {},
+		"no runners":      {"routes": []any{map[string]any{"when": "true"}}},
+		"default when":    {"routes": []any{map[string]any{"default": true, "when": "true", "runners": []any{map[string]any{"type": "pass"}}}}},
+		"invalid when":    {"routes": []any{map[string]any{"when": "(", "runners": []any{map[string]any{"type": "pass"}}}}},
+		"bad completion":  {"routes": []any{map[string]any{"runners": []any{map[string]any{"type": "pass"}}}}, "completion": "some"},
+		"nested throttle": {"routes": []any{map[string]any{"runners": []any{map[string]any{"type": "pass", "throttle": map[string]any{"rate": 1}}}}}},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := bridge.createRunner(connectors.RunnerConfig{Type: partsRunnerType, Options: opts}); err == nil {
+				t.Error("createRunner() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package bridge
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/destel/rill"
+	"github.com/google/uuid"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	payloadLimitReject   = "reject"
+	payloadLimitTruncate = "truncate"
+	payloadLimitChunk    = "chunk"
+)
+
+// Metadata keys set on truncated and chunked messages
+const (
+	metaTruncated    = "eb-truncated"
+	metaOriginalSize = "eb-original-size"
+	metaChunkID      = "eb-chunk-id"
+	metaChunkIndex   = "eb-chunk-index"
+	metaChunkCount   = "eb-chunk-count"
+)
+
+// payloadLimit returns the payload limit of a runner, falling back to the global one.
+// It returns nil when the runner has no limit.
+func (b *EventsBridge) payloadLimit(cfg connectors.RunnerConfig) *connectors.PayloadLimitConfig {
+	limit := cfg.PayloadLimit
+	if limit == nil {
+		limit = b.cfg.PayloadLimit
+	}
+	if limit == nil || limit.MaxSize <= 0 {
+		return nil
+	}
+	return limit
+}
+
+// limitPayloads applies the payload limit to the stream, before the messages are handed to a runner
+func (b *EventsBridge) limitPayloads(stream rill.Stream[*message.RunnerMessage], routines int, limit connectors.PayloadLimitConfig) rill.Stream[*message.RunnerMessage] {
+	return rill.OrderedFlatMap(stream, routines, func(msg *message.RunnerMessage) rill.Stream[*message.RunnerMessage] {
+		msgs, err := limitPayload(msg, limit)
+		if err != nil {
+			b.HandleError(msg, err, "message rejected by payload limit", "maxSize", limit.MaxSize, "action", limit.Action)
+			return rill.FromSlice[*message.RunnerMessage](nil, nil)
+		}
+		return rill.FromSlice(msgs, nil)
+	})
+}
+
+// limitPayload returns the message unchanged when within the limit, otherwise
+// the truncated message or its chunks. Larger payloads are rejected with an error.
+func limitPayload(msg *message.RunnerMessage, limit connectors.PayloadLimitConfig) ([]*message.RunnerMessage, error) {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	size := len(data)
+	if size <= limit.MaxSize {
+		return []*message.RunnerMessage{msg}, nil
+	}
+
+	switch limit.Action {
+	case payloadLimitTruncate:
+		msg.SetData(data[:limit.MaxSize])
+		msg.AddMetadata(metaTruncated, "true")
+		msg.AddMetadata(metaOriginalSize, strconv.Itoa(size))
+		return []*message.RunnerMessage{msg}, nil
+	case payloadLimitChunk:
+		return chunkMessage(msg, meta, data, limit.MaxSize), nil
+	default:
+		return nil, fmt.Errorf("payload size %d exceeds limit %d", size, limit.MaxSize)
+	}
+}
+
+// chunkMessage splits the payload into messages of at most chunkSize bytes.
+// The chunks share the source message, which is acked once every chunk is acked.
+func chunkMessage(msg *message.RunnerMessage, meta map[string]string, data []byte, chunkSize int) []*message.RunnerMessage {
+	count := (len(data) + chunkSize - 1) / chunkSize
+	group := &chunkGroup{SourceMessage: msg}
+	group.pending.Store(int32(count)) //nolint:gosec // bounded by the payload size
+
+	id := uuid.NewString()
+	chunks := make([]*message.RunnerMessage, count)
+	for i := range chunks {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := message.NewRunnerMessage(group)
+		chunk.SetIngressTime(msg.GetIngressTime())
+		chunk.SetTraceContext(msg.GetTraceContext())
+		chunk.SetMetadata(meta)
+		chunk.MergeMetadata(map[string]string{
+			metaChunkID:      id,
+			metaChunkIndex:   strconv.Itoa(i),
+			metaChunkCount:   strconv.Itoa(count),
+			metaOriginalSize: strconv.Itoa(len(data)),
+		})
+		chunk.SetData(data[i*chunkSize : end])
+		chunks[i] = chunk
+	}
+	return chunks
+}
+
+// chunkGroup acks the chunked message once all the chunks are acked,
+// or naks it as soon as a chunk is naked
+type chunkGroup struct {
+	message.SourceMessage
+	pending atomic.Int32
+	once    sync.Once
+}
+
+func (g *chunkGroup) Ack(d *message.ReplyData) error {
+	if g.pending.Add(-1) > 0 {
+		return nil
+	}
+	var err error
+	g.once.Do(func() {
+		err = g.SourceMessage.Ack(d)
+	})
+	return err
+}
+
+func (g *chunkGroup) Nak() error {
+	var err error
+	g.once.Do(func() {
+		err = g.SourceMessage.Nak()
+	})
+	return err
+}
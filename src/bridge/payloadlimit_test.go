@@ -0,0 +1,187 @@
+package bridge
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// recordingRunner records the payload and metadata of the processed messages
+type recordingRunner struct {
+	mu       sync.Mutex
+	data     []string
+	metadata []map[string]string
+}
+
+func (r *recordingRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data = append(r.data, string(data))
+	r.metadata = append(r.metadata, meta)
+	return nil
+}
+
+func (r *recordingRunner) Close() error { return nil }
+
+func (r *recordingRunner) processed() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.data)
+}
+
+func TestPayloadLimitSelection(t *testing.T) {
+	cfg := newTestConfig()
+	b := &EventsBridge{cfg: cfg, logger: newTestLogger()}
+
+	if b.payloadLimit(connectors.RunnerConfig{}) != nil {
+		t.Error("expected no limit without configuration")
+	}
+
+	cfg.PayloadLimit = &connectors.PayloadLimitConfig{MaxSize: 10}
+	if limit := b.payloadLimit(connectors.RunnerConfig{}); limit == nil || limit.MaxSize != 10 {
+		t.Errorf("expected global limit, got %+v", limit)
+	}
+
+	own := &connectors.PayloadLimitConfig{MaxSize: 5, Action: "chunk"}
+	if limit := b.payloadLimit(connectors.RunnerConfig{PayloadLimit: own}); limit != own {
+		t.Errorf("expected runner limit, got %+v", limit)
+	}
+
+	disabled := &connectors.PayloadLimitConfig{MaxSize: 0}
+	if limit := b.payloadLimit(connectors.RunnerConfig{PayloadLimit: disabled}); limit != nil {
+		t.Errorf("expected disabled limit, got %+v", limit)
+	}
+}
+
+func TestLimitPayload(t *testing.T) {
+	small := message.NewRunnerMessage(testutil.NewAdapter([]byte("tiny"), nil))
+	msgs, err := limitPayload(small, connectors.PayloadLimitConfig{MaxSize: 4})
+	if err != nil || len(msgs) != 1 || msgs[0] != small {
+		t.Errorf("expected message unchanged, got %v, %v", msgs, err)
+	}
+
+	large := message.NewRunnerMessage(testutil.NewAdapter([]byte("too large"), nil))
+	if _, err := limitPayload(large, connectors.PayloadLimitConfig{MaxSize: 4}); err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Errorf("expected reject error, got %v", err)
+	}
+
+	msgs, err = limitPayload(large, connectors.PayloadLimitConfig{MaxSize: 3, Action: "truncate"})
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("expected truncated message, got %v, %v", msgs, err)
+	}
+	meta, data, _ := msgs[0].GetMetadataAndData()
+	if string(data) != "too" || meta[metaTruncated] != "true" || meta[metaOriginalSize] != "9" {
+		t.Errorf("unexpected truncated message: %q %v", data, meta)
+	}
+}
+
+func TestChunkMessageAck(t *testing.T) {
+	source := newCountingMessage("0123456789")
+	msg := message.NewRunnerMessage(source)
+	msg.SetMetadata(map[string]string{"key": "value"})
+
+	chunks, err := limitPayload(msg, connectors.PayloadLimitConfig{MaxSize: 4, Action: "chunk"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"0123", "4567", "89"}
+	if len(chunks) != len(want) {
+		t.Fatalf("expected %d chunks, got %d", len(want), len(chunks))
+	}
+	var id string
+	for i, chunk := range chunks {
+		meta, data, _ := chunk.GetMetadataAndData()
+		if string(data) != want[i] {
+			t.Errorf("chunk %d: data = %q, want %q", i, data, want[i])
+		}
+		if i == 0 {
+			id = meta[metaChunkID]
+		}
+		if meta[metaChunkID] == "" || meta[metaChunkID] != id || meta[metaChunkIndex] != strconv.Itoa(i) ||
+			meta[metaChunkCount] != "3" || meta[metaOriginalSize] != "10" || meta["key"] != "value" {
+			t.Errorf("chunk %d: unexpected metadata %v", i, meta)
+		}
+	}
+
+	for _, chunk := range chunks[:2] {
+		if err := chunk.AckSource(false); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+	}
+	if source.acks.Load() != 0 {
+		t.Error("source acked before all the chunks")
+	}
+	if err := chunks[2].AckSource(false); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if source.acks.Load() != 1 || source.naks.Load() != 0 {
+		t.Errorf("expected a single ack, got %d acks and %d naks", source.acks.Load(), source.naks.Load())
+	}
+}
+
+func TestChunkMessageNak(t *testing.T) {
+	source := newCountingMessage("0123456789")
+	chunks, _ := limitPayload(message.NewRunnerMessage(source), connectors.PayloadLimitConfig{MaxSize: 5, Action: "chunk"})
+
+	if err := chunks[0].Nak(); err != nil {
+		t.Fatalf("nak: %v", err)
+	}
+	if err := chunks[1].AckSource(false); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if source.naks.Load() != 1 || source.acks.Load() != 0 {
+		t.Errorf("expected a single nak, got %d acks and %d naks", source.acks.Load(), source.naks.Load())
+	}
+}
+
+func TestPayloadLimitPipeline(t *testing.T) {
+	src := newChanSource()
+	runner := &recordingRunner{}
+	cfg := newTestConfig()
+	cfg.PayloadLimit = &connectors.PayloadLimitConfig{MaxSize: 4}
+	b := &EventsBridge{
+		cfg:    cfg,
+		logger: newTestLogger(),
+		source: src,
+		runners: []RunnerItem{{
+			Config: connectors.RunnerConfig{Type: "test", PayloadLimit: &connectors.PayloadLimitConfig{MaxSize: 4, Action: "chunk"}},
+			Runner: runner,
+		}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+
+	chunked := newCountingMessage("abcdefghij")
+	src.c <- message.NewRunnerMessage(chunked)
+	waitFor(t, func() bool { return chunked.acks.Load() == 1 })
+	if runner.processed() != 3 {
+		t.Errorf("expected 3 chunks processed, got %d", runner.processed())
+	}
+
+	// The global limit rejects large payloads of runners without their own limit
+	b.runners[0].Config.PayloadLimit = nil
+	other := &EventsBridge{cfg: cfg, logger: newTestLogger(), source: newChanSource(), runners: b.runners}
+	if _, err := other.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	rejected := newCountingMessage("abcdefghij")
+	other.source.(*chanSource).c <- message.NewRunnerMessage(rejected)
+	waitFor(t, func() bool { return rejected.naks.Load() == 1 })
+	if runner.processed() != 3 {
+		t.Errorf("rejected message was processed")
+	}
+}
@@ -0,0 +1,289 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/sandrolain/events-bridge/src/config"
+)
+
+const (
+	defaultCPUSampleDuration = 5 * time.Second
+	defaultAllocSampleEvery  = 100
+
+	// heapAllocsMetric is the cumulative count of bytes allocated in the heap
+	heapAllocsMetric = "/gc/heap/allocs:bytes"
+
+	stageSource = "source"
+	stageAck    = "ack"
+)
+
+// StageReport is the resource usage of a pipeline stage
+type StageReport struct {
+	Stage     string `json:"stage"`
+	Connector string `json:"connector,omitempty"`
+	// CPU is the CPU time sampled for the stage during the CPU profile
+	CPU time.Duration `json:"cpu"`
+	// CPUShare is the fraction of the CPU time of the pipeline spent in the stage
+	CPUShare float64 `json:"cpuShare"`
+	// AllocCalls is the number of stage calls measured for allocations
+	AllocCalls int64 `json:"allocCalls"`
+	// AllocBytesPerCall is the average of the heap bytes allocated during the measured calls.
+	// Allocations of other goroutines running at the same time are included, so the
+	// value is an upper bound when the stages run concurrently.
+	AllocBytesPerCall int64 `json:"allocBytesPerCall"`
+}
+
+// StageProfile is a per-stage profiling report of a pipeline
+type StageProfile struct {
+	Pipeline string        `json:"pipeline"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+	// CPUError is set when the CPU profile could not be collected (e.g., another CPU profile is running)
+	CPUError string        `json:"cpuError,omitempty"`
+	Stages   []StageReport `json:"stages"`
+}
+
+// allocStats accumulates the allocations of the measured calls of a stage
+type allocStats struct {
+	calls int64
+	bytes int64
+}
+
+// stageProfiler labels the goroutines running the pipeline stages and
+// periodically builds the per-stage reports. A nil profiler runs the stages unlabelled.
+type stageProfiler struct {
+	cfg    config.ProfilingConfig
+	logger *slog.Logger
+
+	calls atomic.Uint64
+
+	mu         sync.Mutex
+	connectors map[string]string
+	allocs     map[string]*allocStats
+	last       *StageProfile
+}
+
+func newStageProfiler(cfg config.ProfilingConfig, pipeline string, logger *slog.Logger) *stageProfiler {
+	if cfg.Pipeline == "" {
+		cfg.Pipeline = pipeline
+	}
+	if cfg.CPUSampleDuration <= 0 {
+		cfg.CPUSampleDuration = defaultCPUSampleDuration
+	}
+	if cfg.ReportInterval > 0 && cfg.CPUSampleDuration > cfg.ReportInterval {
+		cfg.CPUSampleDuration = cfg.ReportInterval
+	}
+	if cfg.AllocSampleEvery <= 0 {
+		cfg.AllocSampleEvery = defaultAllocSampleEvery
+	}
+	return &stageProfiler{
+		cfg:        cfg,
+		logger:     logger.With("component", "profiling"),
+		connectors: make(map[string]string),
+		allocs:     make(map[string]*allocStats),
+	}
+}
+
+// Stage registers a stage and returns the function running calls of the stage
+// with its pprof labels
+func (p *stageProfiler) Stage(stage, connector string) func(f func()) {
+	if p == nil {
+		return func(f func()) { f() }
+	}
+	p.mu.Lock()
+	p.connectors[stage] = connector
+	p.mu.Unlock()
+
+	labels := pprof.Labels("pipeline", p.cfg.Pipeline, "stage", stage, "connector", connector)
+	return func(f func()) {
+		pprof.Do(context.Background(), labels, func(context.Context) {
+			if p.cfg.ReportInterval <= 0 || p.calls.Add(1)%uint64(p.cfg.AllocSampleEvery) != 0 {
+				f()
+				return
+			}
+			before := heapAllocs()
+			f()
+			p.recordAllocs(stage, heapAllocs()-before)
+		})
+	}
+}
+
+func heapAllocs() int64 {
+	sample := []metrics.Sample{{Name: heapAllocsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64()) //nolint:gosec // cumulative byte count
+}
+
+func (p *stageProfiler) recordAllocs(stage string, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats, ok := p.allocs[stage]
+	if !ok {
+		stats = &allocStats{}
+		p.allocs[stage] = stats
+	}
+	stats.calls++
+	stats.bytes += bytes
+}
+
+// Last returns the most recent report, or nil
+func (p *stageProfiler) Last() *StageProfile {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last
+}
+
+// Run builds a report on every interval until the context is cancelled
+func (p *stageProfiler) Run(ctx context.Context) {
+	if p.cfg.ReportInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.cfg.ReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report := p.report(ctx)
+			if report == nil {
+				return
+			}
+			p.mu.Lock()
+			p.last = report
+			p.mu.Unlock()
+			p.log(report)
+		}
+	}
+}
+
+// report samples the CPU profile and collects the allocations measured since the last report.
+// It returns nil when the context is cancelled during the CPU profile.
+func (p *stageProfiler) report(ctx context.Context) *StageProfile {
+	report := &StageProfile{Pipeline: p.cfg.Pipeline, Time: time.Now()}
+
+	cpu, err := p.sampleCPU(ctx)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		report.CPUError = err.Error()
+	}
+	report.Duration = time.Since(report.Time)
+
+	p.mu.Lock()
+	allocs := p.allocs
+	p.allocs = make(map[string]*allocStats)
+	stages := make([]StageReport, 0, len(p.connectors))
+	for stage, connector := range p.connectors {
+		stages = append(stages, StageReport{Stage: stage, Connector: connector})
+	}
+	p.mu.Unlock()
+
+	var total time.Duration
+	for _, d := range cpu {
+		total += d
+	}
+	for i := range stages {
+		s := &stages[i]
+		s.CPU = cpu[s.Stage]
+		if total > 0 {
+			s.CPUShare = float64(s.CPU) / float64(total)
+		}
+		if a, ok := allocs[s.Stage]; ok && a.calls > 0 {
+			s.AllocCalls = a.calls
+			s.AllocBytesPerCall = a.bytes / a.calls
+		}
+	}
+	sort.Slice(stages, func(i, j int) bool {
+		if stages[i].CPU != stages[j].CPU {
+			return stages[i].CPU > stages[j].CPU
+		}
+		return stages[i].Stage < stages[j].Stage
+	})
+	report.Stages = stages
+	return report
+}
+
+// sampleCPU runs a CPU profile and returns the CPU time of the labelled stages of the pipeline
+func (p *stageProfiler) sampleCPU(ctx context.Context) (map[string]time.Duration, error) {
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return nil, fmt.Errorf("failed to start CPU profile: %w", err)
+	}
+	timer := time.NewTimer(p.cfg.CPUSampleDuration)
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+	timer.Stop()
+	pprof.StopCPUProfile()
+
+	prof, err := profile.Parse(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CPU profile: %w", err)
+	}
+	return stageCPU(prof, p.cfg.Pipeline), nil
+}
+
+// stageCPU sums the CPU time of the samples of the pipeline by stage label
+func stageCPU(prof *profile.Profile, pipeline string) map[string]time.Duration {
+	index := -1
+	for i, st := range prof.SampleType {
+		if st.Type == "cpu" {
+			index = i
+		}
+	}
+	res := make(map[string]time.Duration)
+	if index < 0 {
+		return res
+	}
+	for _, s := range prof.Sample {
+		if len(s.Label["pipeline"]) == 0 || s.Label["pipeline"][0] != pipeline || len(s.Label["stage"]) == 0 {
+			continue
+		}
+		res[s.Label["stage"][0]] += time.Duration(s.Value[index])
+	}
+	return res
+}
+
+func (p *stageProfiler) log(report *StageProfile) {
+	if report.CPUError != "" {
+		p.logger.Warn("CPU profile not collected", "error", report.CPUError)
+	}
+	for _, s := range report.Stages {
+		p.logger.Info("stage profile",
+			"stage", s.Stage,
+			"connector", s.Connector,
+			"cpu", s.CPU,
+			"cpuShare", fmt.Sprintf("%.1f%%", s.CPUShare*100),
+			"allocCalls", s.AllocCalls,
+			"allocBytesPerCall", s.AllocBytesPerCall)
+	}
+}
+
+// runnerStage is the stage label of a runner
+func runnerStage(i int) string {
+	return fmt.Sprintf("runner[%d]", i)
+}
+
+// middlewareStage is the stage label of an inbound middleware
+func middlewareStage(i int) string {
+	return fmt.Sprintf("middleware[%d]", i)
+}
@@ -0,0 +1,127 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+func TestProfilingLabels(t *testing.T) {
+	src := newChanSource()
+	var labels atomic.Value
+	runner := &funcRunner{process: func(*message.RunnerMessage) error {
+		var buf bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+			return err
+		}
+		labels.Store(buf.String())
+		return nil
+	}}
+	cfg := newTestConfig()
+	cfg.Profiling = &config.ProfilingConfig{Pipeline: "orders"}
+	b := &EventsBridge{
+		cfg:      cfg,
+		logger:   newTestLogger(),
+		source:   src,
+		profiler: newStageProfiler(*cfg.Profiling, cfg.Source.Type, newTestLogger()),
+		runners:  []RunnerItem{{Config: connectors.RunnerConfig{Type: "es5"}, Runner: runner}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done, err := b.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	msg := newCountingMessage("{}")
+	src.c <- message.NewRunnerMessage(msg)
+	waitFor(t, func() bool { return msg.acks.Load() == 1 })
+
+	got, _ := labels.Load().(string)
+	if !strings.Contains(got, `"connector":"es5"`) || !strings.Contains(got, `"pipeline":"orders"`) || !strings.Contains(got, `"stage":"runner[0]"`) {
+		t.Errorf("runner goroutine not labelled:\n%s", got)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestStageProfilerReport(t *testing.T) {
+	p := newStageProfiler(config.ProfilingConfig{
+		ReportInterval:    time.Second,
+		CPUSampleDuration: 300 * time.Millisecond,
+		AllocSampleEvery:  1,
+	}, "test", newTestLogger())
+	busy := p.Stage(runnerStage(0), "busy")
+	idle := p.Stage(runnerStage(1), "idle")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		var sink []byte
+		for ctx.Err() == nil {
+			busy(func() {
+				sink = make([]byte, 1024)
+				for i := range 100000 {
+					sink[i%len(sink)]++
+				}
+			})
+			idle(func() {})
+		}
+		_ = sink
+	}()
+
+	report := p.report(ctx)
+	if report == nil {
+		t.Fatal("report() returned nil")
+	}
+	if report.CPUError != "" {
+		t.Skipf("CPU profile not available: %s", report.CPUError)
+	}
+	if len(report.Stages) != 2 || report.Stages[0].Stage != "runner[0]" || report.Stages[0].Connector != "busy" {
+		t.Fatalf("unexpected stages %+v", report.Stages)
+	}
+	if s := report.Stages[0]; s.CPU <= 0 || s.CPUShare < 0.5 || s.AllocCalls == 0 || s.AllocBytesPerCall < 1024 {
+		t.Errorf("unexpected busy stage report %+v", s)
+	}
+
+	cancel()
+	if report := p.report(ctx); report != nil {
+		t.Errorf("report() after cancellation = %+v, want nil", report)
+	}
+}
+
+func TestStageCPU(t *testing.T) {
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Value: []int64{1, 10}, Label: map[string][]string{"pipeline": {"a"}, "stage": {"runner[0]"}}},
+			{Value: []int64{1, 5}, Label: map[string][]string{"pipeline": {"a"}, "stage": {"runner[0]"}}},
+			{Value: []int64{1, 7}, Label: map[string][]string{"pipeline": {"a"}, "stage": {"ack"}}},
+			{Value: []int64{1, 100}, Label: map[string][]string{"pipeline": {"b"}, "stage": {"ack"}}},
+			{Value: []int64{1, 100}},
+		},
+	}
+	got := stageCPU(prof, "a")
+	if len(got) != 2 || got["runner[0]"] != 15 || got["ack"] != 7 {
+		t.Errorf("stageCPU() = %v", got)
+	}
+}
+
+func TestNilStageProfiler(t *testing.T) {
+	var p *stageProfiler
+	called := false
+	p.Stage(stageAck, "test")(func() { called = true })
+	if !called || p.Last() != nil {
+		t.Error("nil profiler must run the stage without reports")
+	}
+}
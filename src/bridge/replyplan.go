@@ -0,0 +1,305 @@
+package bridge
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/destel/rill"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	replyWhenReceived  = "received"
+	replyWhenRunner    = "runner"
+	replyWhenCompleted = "completed"
+
+	stageReply = "reply"
+)
+
+// Default replies of the plan, valid both as HTTP and CoAP status
+var (
+	defaultTimeoutResponse = connectors.ReplyTemplate{Status: "504"}
+	defaultErrorResponse   = connectors.ReplyTemplate{Status: "500"}
+)
+
+// replyPlan sends the reply of request/response sources at a planned point of the pipeline,
+// e.g. right after validation when the message is then published to a fire-and-forget target
+type replyPlan struct {
+	when         string
+	afterRunners int
+	response     *replyTemplate
+	timeout      time.Duration
+	onTimeout    *replyTemplate
+	onError      *replyTemplate
+	logger       *slog.Logger
+}
+
+// replyTemplate is a compiled connectors.ReplyTemplate
+type replyTemplate struct {
+	status   *template.Template
+	body     *template.Template
+	metadata map[string]*template.Template
+}
+
+// newReplyPlan compiles the reply plan of a pipeline with the given number of runners
+func newReplyPlan(cfg connectors.ReplyPlanConfig, runners int, logger *slog.Logger) (*replyPlan, error) {
+	p := &replyPlan{
+		when:         cfg.When,
+		afterRunners: cfg.AfterRunners,
+		timeout:      cfg.Timeout,
+		logger:       logger,
+	}
+	if p.when == "" {
+		p.when = replyWhenCompleted
+	}
+	if p.when == replyWhenRunner && (p.afterRunners < 0 || p.afterRunners > runners) {
+		return nil, fmt.Errorf("afterRunners must be between 0 and %d", runners)
+	}
+
+	var err error
+	if p.response, err = compileReplyTemplate("response", cfg.Response); err != nil {
+		return nil, err
+	}
+	onTimeout := defaultTimeoutResponse
+	if cfg.TimeoutResponse != nil {
+		onTimeout = *cfg.TimeoutResponse
+	}
+	if p.onTimeout, err = compileReplyTemplate("timeoutResponse", onTimeout); err != nil {
+		return nil, err
+	}
+	onError := defaultErrorResponse
+	if cfg.ErrorResponse != nil {
+		onError = *cfg.ErrorResponse
+	}
+	if p.onError, err = compileReplyTemplate("errorResponse", onError); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func compileReplyTemplate(name string, cfg connectors.ReplyTemplate) (*replyTemplate, error) {
+	parse := func(field, text string) (*template.Template, error) {
+		if text == "" {
+			return nil, nil
+		}
+		t, err := template.New(name + "." + field).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s template: %w", name, field, err)
+		}
+		return t, nil
+	}
+	var err error
+	t := &replyTemplate{metadata: make(map[string]*template.Template, len(cfg.Metadata))}
+	if t.status, err = parse("status", cfg.Status); err != nil {
+		return nil, err
+	}
+	if t.body, err = parse("body", cfg.Body); err != nil {
+		return nil, err
+	}
+	for key, text := range cfg.Metadata {
+		if t.metadata[key], err = parse("metadata "+key, text); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// render executes the templates with the "data" (payload as string) and "metadata" of a message
+func (t *replyTemplate) render(data []byte, metadata map[string]string) (*message.ReplyData, error) {
+	ctx := map[string]any{"data": string(data), "metadata": metadata}
+	exec := func(tpl *template.Template) (string, error) {
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, ctx); err != nil {
+			return "", fmt.Errorf("failed to render %s template: %w", tpl.Name(), err)
+		}
+		return buf.String(), nil
+	}
+
+	reply := &message.ReplyData{Metadata: make(map[string]string, len(t.metadata)+1)}
+	for key, tpl := range t.metadata {
+		v, err := exec(tpl)
+		if err != nil {
+			return nil, err
+		}
+		reply.Metadata[key] = v
+	}
+	if t.status != nil {
+		v, err := exec(t.status)
+		if err != nil {
+			return nil, err
+		}
+		reply.Metadata["eb-status"] = v
+	}
+	if t.body != nil {
+		v, err := exec(t.body)
+		if err != nil {
+			return nil, err
+		}
+		reply.Data = []byte(v)
+	}
+	return reply, nil
+}
+
+// at reports whether the reply is planned after the given number of runners,
+// 0 being right after the inbound middleware
+func (p *replyPlan) at(runners int) bool {
+	if p == nil {
+		return false
+	}
+	switch p.when {
+	case replyWhenReceived:
+		return runners == 0
+	case replyWhenRunner:
+		return runners == p.afterRunners
+	}
+	return false
+}
+
+// wrap makes the source message reply at most once, replying on timeout if the planned point is not reached
+func (p *replyPlan) wrap(msg message.SourceMessage) *plannedMessage {
+	m := &plannedMessage{SourceMessage: msg, plan: p}
+	if p.timeout > 0 {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.timer = time.AfterFunc(p.timeout, func() {
+			if err := m.settle(p.onTimeout); err != nil {
+				p.logger.Error("failed to send reply plan timeout response", "error", err)
+			}
+		})
+	}
+	return m
+}
+
+// render renders the planned response from the message
+func (p *replyPlan) render(msg *message.RunnerMessage) (*message.ReplyData, error) {
+	data, err := msg.GetData()
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := msg.GetAllMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return p.response.render(data, metadata)
+}
+
+// respond acks the message with the planned response, unless the source already got its reply
+func (p *replyPlan) respond(msg *message.RunnerMessage) error {
+	reply, err := p.render(msg)
+	if err != nil {
+		return err
+	}
+	return msg.Ack(reply)
+}
+
+// replyAt sends the planned response of the messages flowing through the stream,
+// which stay in flight until they complete the pipeline
+func (b *EventsBridge) replyAt(stream rill.Stream[*message.RunnerMessage]) rill.Stream[*message.RunnerMessage] {
+	stage := b.stage(stageReply, b.cfg.Source.Type)
+	return rill.OrderedFilterMap(stream, 1, func(msg *message.RunnerMessage) (*message.RunnerMessage, bool, error) {
+		m := plannedOf(msg)
+		if m == nil {
+			return msg, true, nil
+		}
+		var err error
+		stage(func() {
+			var reply *message.ReplyData
+			if reply, err = b.replyPlan.render(msg); err == nil {
+				err = m.reply(reply)
+			}
+		})
+		if err != nil {
+			return b.HandleRunnerError(msg, err, "failed to send planned reply")
+		}
+		return msg, true, nil
+	})
+}
+
+// plannedOf returns the planned source message of a message, if any
+func plannedOf(msg *message.RunnerMessage) *plannedMessage {
+	src := msg.GetOriginal()
+	if tracked, ok := src.(*trackedMessage); ok {
+		src = tracked.SourceMessage
+	}
+	m, _ := src.(*plannedMessage)
+	return m
+}
+
+// plannedMessage forwards a single reply to the source. Acks without reply data and naks
+// reaching the message before the planned point reply with the response or error response
+// rendered from the source message, the ones after the reply are not forwarded.
+type plannedMessage struct {
+	message.SourceMessage
+	plan    *replyPlan
+	timer   *time.Timer
+	mu      sync.Mutex
+	replied bool
+}
+
+func (m *plannedMessage) Ack(d *message.ReplyData) error {
+	if d != nil {
+		return m.reply(d)
+	}
+	return m.settle(m.plan.response)
+}
+
+func (m *plannedMessage) Nak() error {
+	return m.settle(m.plan.onError)
+}
+
+// settle replies with the template rendered from the source message; if it cannot
+// be rendered, the source message is naked
+func (m *plannedMessage) settle(t *replyTemplate) error {
+	m.mu.Lock()
+	replied := m.replied
+	m.mu.Unlock()
+	if replied {
+		return nil
+	}
+	data, err := m.GetData()
+	if err != nil {
+		return m.fail(err)
+	}
+	metadata, err := m.GetMetadata()
+	if err != nil {
+		return m.fail(err)
+	}
+	reply, err := t.render(data, metadata)
+	if err != nil {
+		return m.fail(err)
+	}
+	return m.reply(reply)
+}
+
+// fail naks the source message after a rendering error
+func (m *plannedMessage) fail(err error) error {
+	m.plan.logger.Error("failed to render reply plan response, naking message", "error", err)
+	return m.send(m.SourceMessage.Nak)
+}
+
+func (m *plannedMessage) reply(d *message.ReplyData) error {
+	return m.send(func() error {
+		return m.SourceMessage.Ack(d)
+	})
+}
+
+// send forwards the first reply to the source. The lock is not held while replying,
+// as sources may block until the reply is consumed.
+func (m *plannedMessage) send(fn func() error) error {
+	m.mu.Lock()
+	if m.replied {
+		m.mu.Unlock()
+		return nil
+	}
+	m.replied = true
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.mu.Unlock()
+	return fn()
+}
@@ -0,0 +1,205 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// replyMessage is a source message recording the replies and naks it receives
+type replyMessage struct {
+	*testutil.Adapter
+	mu      sync.Mutex
+	replies []*message.ReplyData
+	naks    int
+}
+
+func newReplyMessage(data string, meta map[string]string) *replyMessage {
+	return &replyMessage{Adapter: testutil.NewAdapter([]byte(data), meta)}
+}
+
+func (m *replyMessage) Ack(d *message.ReplyData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replies = append(m.replies, d)
+	return nil
+}
+
+func (m *replyMessage) Nak() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.naks++
+	return nil
+}
+
+func (m *replyMessage) settled() ([]*message.ReplyData, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*message.ReplyData(nil), m.replies...), m.naks
+}
+
+// startReplyPlanBridge starts a bridge with the reply plan and runners
+func startReplyPlanBridge(t *testing.T, plan connectors.ReplyPlanConfig, runners ...connectors.Runner) (*EventsBridge, *chanSource) {
+	t.Helper()
+	src := newChanSource()
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger(), source: src}
+	for _, r := range runners {
+		b.runners = append(b.runners, RunnerItem{Config: connectors.RunnerConfig{Type: "test"}, Runner: r})
+	}
+	p, err := newReplyPlan(plan, len(runners), b.logger)
+	if err != nil {
+		t.Fatalf("newReplyPlan() unexpected error = %v", err)
+	}
+	b.replyPlan = p
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	return b, src
+}
+
+func TestReplyPlanReceived(t *testing.T) {
+	release := make(chan struct{})
+	b, src := startReplyPlanBridge(t, connectors.ReplyPlanConfig{
+		When: "received",
+		Response: connectors.ReplyTemplate{
+			Status:   "202",
+			Body:     `{"accepted":"{{ index .metadata "id" }}"}`,
+			Metadata: map[string]string{"Location": "/events/{{ index .metadata \"id\" }}"},
+		},
+	}, &funcRunner{process: func(msg *message.RunnerMessage) error {
+		<-release
+		msg.SetData([]byte("published"))
+		return nil
+	}})
+
+	msg := newReplyMessage("in", map[string]string{"id": "42"})
+	src.c <- message.NewRunnerMessage(msg)
+
+	// The source gets its reply while the target is still processing the message
+	waitFor(t, func() bool { replies, _ := msg.settled(); return len(replies) == 1 })
+	replies, _ := msg.settled()
+	if r := replies[0]; string(r.Data) != `{"accepted":"42"}` || r.Metadata["eb-status"] != "202" || r.Metadata["Location"] != "/events/42" {
+		t.Errorf("reply = %s %v", r.Data, r.Metadata)
+	}
+	if n := b.InFlight(); n != 1 {
+		t.Errorf("InFlight() = %d, want 1", n)
+	}
+
+	close(release)
+	waitFor(t, func() bool { return b.InFlight() == 0 })
+	if replies, naks := msg.settled(); len(replies) != 1 || naks != 0 {
+		t.Errorf("replies = %d, naks = %d after completion", len(replies), naks)
+	}
+}
+
+func TestReplyPlanAfterRunner(t *testing.T) {
+	b, src := startReplyPlanBridge(t, connectors.ReplyPlanConfig{
+		When:         "runner",
+		AfterRunners: 1,
+		Response:     connectors.ReplyTemplate{Status: "200", Body: "{{ .data }}"},
+	}, &funcRunner{process: func(msg *message.RunnerMessage) error {
+		msg.SetData([]byte("validated"))
+		return nil
+	}}, &funcRunner{process: func(*message.RunnerMessage) error {
+		return errors.New("broker unavailable")
+	}})
+
+	msg := newReplyMessage("in", nil)
+	src.c <- message.NewRunnerMessage(msg)
+	waitFor(t, func() bool { replies, _ := msg.settled(); return len(replies) == 1 })
+	waitFor(t, func() bool { return b.InFlight() == 0 })
+
+	// The failure after the reply is not forwarded to the source
+	replies, naks := msg.settled()
+	if len(replies) != 1 || naks != 0 || string(replies[0].Data) != "validated" {
+		t.Errorf("replies = %v, naks = %d", replies, naks)
+	}
+}
+
+func TestReplyPlanCompleted(t *testing.T) {
+	_, src := startReplyPlanBridge(t, connectors.ReplyPlanConfig{
+		Response:      connectors.ReplyTemplate{Status: "201"},
+		ErrorResponse: &connectors.ReplyTemplate{Status: "503", Body: "rejected {{ .data }}"},
+	}, &funcRunner{process: func(msg *message.RunnerMessage) error {
+		if data, _ := msg.GetData(); string(data) == "bad" {
+			return errors.New("invalid")
+		}
+		return nil
+	}})
+
+	ok := newReplyMessage("good", nil)
+	src.c <- message.NewRunnerMessage(ok)
+	failed := newReplyMessage("bad", nil)
+	src.c <- message.NewRunnerMessage(failed)
+
+	waitFor(t, func() bool { replies, _ := failed.settled(); return len(replies) == 1 })
+	if replies, _ := ok.settled(); len(replies) != 1 || replies[0].Metadata["eb-status"] != "201" || replies[0].Data != nil {
+		t.Errorf("completed replies = %v", replies)
+	}
+	// Errors before the planned point reply with the error response instead of naking
+	replies, naks := failed.settled()
+	if naks != 0 || replies[0].Metadata["eb-status"] != "503" || string(replies[0].Data) != "rejected bad" {
+		t.Errorf("error reply = %s %v, naks = %d", replies[0].Data, replies[0].Metadata, naks)
+	}
+}
+
+func TestReplyPlanTimeout(t *testing.T) {
+	release := make(chan struct{})
+	b, src := startReplyPlanBridge(t, connectors.ReplyPlanConfig{
+		Timeout: 20 * time.Millisecond,
+	}, &funcRunner{process: func(*message.RunnerMessage) error {
+		<-release
+		return nil
+	}})
+
+	msg := newReplyMessage("in", nil)
+	src.c <- message.NewRunnerMessage(msg)
+	waitFor(t, func() bool { replies, _ := msg.settled(); return len(replies) == 1 })
+	if replies, _ := msg.settled(); replies[0].Metadata["eb-status"] != "504" {
+		t.Errorf("timeout reply = %v", replies[0].Metadata)
+	}
+
+	close(release)
+	waitFor(t, func() bool { return b.InFlight() == 0 })
+	if replies, naks := msg.settled(); len(replies) != 1 || naks != 0 {
+		t.Errorf("replies = %d, naks = %d after completion", len(replies), naks)
+	}
+}
+
+func TestReplyPlanRenderError(t *testing.T) {
+	plan, err := newReplyPlan(connectors.ReplyPlanConfig{
+		Response: connectors.ReplyTemplate{Body: `{{ template "missing" }}`},
+	}, 0, newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := newReplyMessage("in", nil)
+	if err := plan.wrap(msg).Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+	if replies, naks := msg.settled(); len(replies) != 0 || naks != 1 {
+		t.Errorf("replies = %d, naks = %d, want the message naked", len(replies), naks)
+	}
+}
+
+func TestNewReplyPlanInvalid(t *testing.T) {
+	for _, cfg := range []connectors.ReplyPlanConfig{
+		{When: "runner", AfterRunners: 2},
+		{Response: connectors.ReplyTemplate{Body: "{{ .data"}},
+		{TimeoutResponse: &connectors.ReplyTemplate{Status: "{{"}},
+		{ErrorResponse: &connectors.ReplyTemplate{Metadata: map[string]string{"X": "{{ end }}"}}},
+	} {
+		if _, err := newReplyPlan(cfg, 1, newTestLogger()); err == nil {
+			t.Errorf("newReplyPlan(%+v) expected error", cfg)
+		}
+	}
+}
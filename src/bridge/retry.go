@@ -0,0 +1,186 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMultiplier = 2
+	defaultRetryMaxBackoff = 30 * time.Second
+)
+
+// notRetried are the bridge errors never retried, whatever the retry policy: another
+// attempt cannot change their outcome
+var notRetried = []error{errThrottled, errBudgetClosed, errCircuitOpen, errMiddlewareDrop, errBatchNested, errDedupNested, errDigestNested}
+
+// Ensure retryRunner implements connectors.LifecycleRunner
+var _ connectors.LifecycleRunner = (*retryRunner)(nil)
+
+// retryRunner processes the messages with a runner, retrying the failed attempts with
+// exponential backoff according to the retry policy of the runner
+type retryRunner struct {
+	runner     connectors.Runner
+	attempts   int
+	backoff    time.Duration
+	multiplier float64
+	maxBackoff time.Duration
+	jitter     float64
+	retryOn    []*regexp.Regexp
+	codes      []string
+	logger     *slog.Logger
+	sleep      func(context.Context, time.Duration) error
+
+	// ctx is the context of the pipeline, received on Start, interrupting the waits
+	mu  sync.RWMutex
+	ctx context.Context
+}
+
+// newRetryRunner wraps the runner with the retry policy
+func (b *EventsBridge) newRetryRunner(runner connectors.Runner, cfg connectors.RetryConfig) (*retryRunner, error) {
+	r := &retryRunner{
+		runner:     runner,
+		attempts:   cfg.MaxAttempts,
+		backoff:    cfg.Backoff,
+		multiplier: cfg.Multiplier,
+		maxBackoff: cfg.MaxBackoff,
+		jitter:     cfg.Jitter,
+		codes:      cfg.RetryCodes,
+		logger:     b.logger.With("component", "retry"),
+		sleep:      sleepContext,
+		ctx:        context.Background(),
+	}
+	if r.backoff == 0 {
+		r.backoff = defaultRetryBackoff
+	}
+	if r.multiplier == 0 {
+		r.multiplier = defaultRetryMultiplier
+	}
+	if r.maxBackoff == 0 {
+		r.maxBackoff = defaultRetryMaxBackoff
+	}
+	for _, expr := range cfg.RetryOn {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retryOn expression %q: %w", expr, err)
+		}
+		r.retryOn = append(r.retryOn, re)
+	}
+	return r, nil
+}
+
+// Process runs the runner on a copy of the message until an attempt succeeds, the error is not
+// retryable or the attempts are exhausted. The message takes the result of the successful attempt.
+func (r *retryRunner) Process(msg *message.RunnerMessage) error {
+	r.mu.RLock()
+	ctx := r.ctx
+	r.mu.RUnlock()
+
+	backoff := r.backoff
+	for attempt := 1; ; attempt++ {
+		try := msg.Clone()
+		err := r.runner.Process(try)
+		if err == nil {
+			meta, data, err := try.GetMetadataAndData()
+			if err != nil {
+				return fmt.Errorf("failed to get attempt result: %w", err)
+			}
+			msg.SetMetadata(meta)
+			msg.SetData(data)
+			return nil
+		}
+		if attempt >= r.attempts || !r.retryable(err) {
+			if attempt > 1 {
+				return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		// A retry-after hint of the upstream replaces a shorter backoff
+		delay := retryDelay(err, r.withJitter(backoff))
+		r.logger.Warn("runner failed, retrying", "attempt", attempt, "maxAttempts", r.attempts, "delay", delay, "error", err)
+		if sleepErr := r.sleep(ctx, delay); sleepErr != nil {
+			return fmt.Errorf("retry interrupted after %d attempts: %w", attempt, errors.Join(err, sleepErr))
+		}
+		if backoff = time.Duration(float64(backoff) * r.multiplier); backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+	}
+}
+
+// retryable reports whether the error matches the retry policy. The messages dropped by a
+// filter runner and the bridge errors of notRetried are never retried.
+func (r *retryRunner) retryable(err error) bool {
+	if isFiltered(err) || slices.ContainsFunc(notRetried, func(target error) bool { return errors.Is(err, target) }) {
+		return false
+	}
+	if len(r.retryOn) == 0 && len(r.codes) == 0 {
+		var re message.RetryableError
+		return !errors.As(err, &re) || re.Retryable()
+	}
+	var coded message.CodedError
+	if errors.As(err, &coded) && slices.Contains(r.codes, coded.ErrorCode()) {
+		return true
+	}
+	for _, re := range r.retryOn {
+		if re.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// withJitter randomizes the wait by up to the jitter fraction, in both directions
+func (r *retryRunner) withJitter(d time.Duration) time.Duration {
+	if r.jitter == 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + r.jitter*(2*rand.Float64()-1))) //nolint:gosec // jitter does not need a secure source
+}
+
+// sleepContext waits for the duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Start keeps the pipeline context to interrupt the waits, then starts the wrapped runner
+func (r *retryRunner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	r.ctx = ctx
+	r.mu.Unlock()
+	if lr, ok := r.runner.(connectors.LifecycleRunner); ok {
+		return lr.Start(ctx)
+	}
+	return nil
+}
+
+// Drain drains the wrapped runner
+func (r *retryRunner) Drain(ctx context.Context) error {
+	if lr, ok := r.runner.(connectors.LifecycleRunner); ok {
+		return lr.Drain(ctx)
+	}
+	return nil
+}
+
+// Close closes the wrapped runner
+func (r *retryRunner) Close() error {
+	return r.runner.Close()
+}
@@ -0,0 +1,155 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// codedError is a test error with a code and a retryable flag
+type codedError struct {
+	code      string
+	retryable bool
+}
+
+func (e *codedError) Error() string     { return "failure " + e.code }
+func (e *codedError) ErrorCode() string { return e.code }
+func (e *codedError) Retryable() bool   { return e.retryable }
+
+// newTestRetryRunner wraps a runner failing with the errors in order, then succeeding,
+// recording the waits instead of sleeping
+func newTestRetryRunner(t *testing.T, cfg connectors.RetryConfig, errs ...error) (*retryRunner, *int, *[]time.Duration) {
+	t.Helper()
+	calls := 0
+	inner := &funcRunner{process: func(msg *message.RunnerMessage) error {
+		calls++
+		msg.AddMetadata("attempt", strings.Repeat("x", calls))
+		if calls <= len(errs) {
+			return errs[calls-1]
+		}
+		msg.SetData([]byte("done"))
+		return nil
+	}}
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	r, err := b.newRetryRunner(inner, cfg)
+	if err != nil {
+		t.Fatalf("newRetryRunner() unexpected error = %v", err)
+	}
+	var waits []time.Duration
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return r, &calls, &waits
+}
+
+func TestRetryRunnerBackoff(t *testing.T) {
+	boom := errors.New("boom")
+	r, calls, waits := newTestRetryRunner(t, connectors.RetryConfig{MaxAttempts: 5, Backoff: 10 * time.Millisecond, MaxBackoff: 30 * time.Millisecond}, boom, boom, boom)
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if *calls != 4 {
+		t.Errorf("calls = %d, want 4", *calls)
+	}
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}
+	if len(*waits) != len(want) {
+		t.Fatalf("waits = %v, want %v", *waits, want)
+	}
+	for i := range want {
+		if (*waits)[i] != want[i] {
+			t.Errorf("waits = %v, want %v", *waits, want)
+		}
+	}
+	// The message takes the result of the successful attempt only
+	meta, data, _ := msg.GetMetadataAndData()
+	if string(data) != "done" || meta["attempt"] != "xxxx" {
+		t.Errorf("metadata = %v, data = %s", meta, data)
+	}
+}
+
+func TestRetryRunnerExhausted(t *testing.T) {
+	boom := errors.New("boom")
+	r, calls, _ := newTestRetryRunner(t, connectors.RetryConfig{MaxAttempts: 2}, boom, boom, boom)
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil))
+	err := r.Process(msg)
+	if !errors.Is(err, boom) || !strings.Contains(err.Error(), "2 attempts") || *calls != 2 {
+		t.Errorf("Process() error = %v, calls = %d", err, *calls)
+	}
+	if data, _ := msg.GetData(); string(data) != "in" {
+		t.Errorf("failed attempts changed the message: %s", data)
+	}
+}
+
+func TestRetryRunnerMatchers(t *testing.T) {
+	cases := []struct {
+		name  string
+		cfg   connectors.RetryConfig
+		err   error
+		calls int
+	}{
+		{"not retryable", connectors.RetryConfig{MaxAttempts: 3}, &codedError{code: "http_400"}, 1},
+		{"retryable", connectors.RetryConfig{MaxAttempts: 3}, &codedError{code: "http_503", retryable: true}, 2},
+		{"code", connectors.RetryConfig{MaxAttempts: 3, RetryCodes: []string{"http_400"}}, &codedError{code: "http_400"}, 2},
+		{"code mismatch", connectors.RetryConfig{MaxAttempts: 3, RetryCodes: []string{"http_503"}}, errors.New("boom"), 1},
+		{"message", connectors.RetryConfig{MaxAttempts: 3, RetryOn: []string{"timeout$"}}, errors.New("i/o timeout"), 2},
+		{"filtered", connectors.RetryConfig{MaxAttempts: 3, RetryOn: []string{"."}}, &filteredError{expression: "false"}, 1},
+		{"circuit open", connectors.RetryConfig{MaxAttempts: 3, RetryOn: []string{"."}}, fmt.Errorf("group: %w", errCircuitOpen), 1},
+		{"throttled", connectors.RetryConfig{MaxAttempts: 3}, errThrottled, 1},
+		{"config", connectors.RetryConfig{MaxAttempts: 3, RetryOn: []string{"."}}, errDedupNested, 1},
+	}
+	for _, tc := range cases {
+		r, calls, _ := newTestRetryRunner(t, tc.cfg, tc.err)
+		_ = r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil)))
+		if *calls != tc.calls {
+			t.Errorf("%s: calls = %d, want %d", tc.name, *calls, tc.calls)
+		}
+	}
+}
+
+func TestRetryRunnerInterrupted(t *testing.T) {
+	boom := errors.New("boom")
+	r, calls, _ := newTestRetryRunner(t, connectors.RetryConfig{MaxAttempts: 3, Backoff: time.Hour}, boom)
+	r.sleep = sleepContext
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), nil)))
+	if !errors.Is(err, boom) || !errors.Is(err, context.Canceled) || *calls != 1 {
+		t.Errorf("Process() error = %v, calls = %d", err, *calls)
+	}
+}
+
+func TestCreateRunnerRetry(t *testing.T) {
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	branch := connectors.RunnerConfig{Type: "branch", Options: map[string]any{"branches": []any{[]any{map[string]any{"type": "pass"}}}}}
+
+	branch.Retry = &connectors.RetryConfig{MaxAttempts: 3}
+	runner, err := b.createRunner(branch)
+	if err != nil {
+		t.Fatalf("createRunner() unexpected error = %v", err)
+	}
+	if _, ok := runner.(*retryRunner); !ok {
+		t.Errorf("runner = %T, want *retryRunner", runner)
+	}
+
+	branch.Retry = &connectors.RetryConfig{MaxAttempts: 3, RetryOn: []string{"("}}
+	if _, err := b.createRunner(branch); err == nil {
+		t.Error("expected error for an invalid retryOn expression")
+	}
+
+	if runner, err := b.createRunner(connectors.RunnerConfig{Type: "pass", Retry: &connectors.RetryConfig{MaxAttempts: 3}}); err != nil || runner != nil {
+		t.Errorf("createRunner(pass) = %v, %v", runner, err)
+	}
+}
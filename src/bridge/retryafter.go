@@ -0,0 +1,77 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+)
+
+const defaultMaxRetryAfter = time.Minute
+
+// retryGate pauses a runner stage while its upstream asked to slow down.
+// The runner errors carrying a retry-after hint extend the pause; the messages
+// reaching the stage wait for its end, so that the source is throttled by backpressure.
+type retryGate struct {
+	max   time.Duration
+	now   func() time.Time
+	mu    sync.Mutex
+	until time.Time
+}
+
+func newRetryGate(maxDelay time.Duration) *retryGate {
+	if maxDelay == 0 {
+		maxDelay = defaultMaxRetryAfter
+	}
+	return &retryGate{max: maxDelay, now: time.Now}
+}
+
+// observe extends the pause with the retry-after hint of the error, capped to the maximum,
+// returning the applied delay
+func (g *retryGate) observe(err error) (time.Duration, bool) {
+	delay, ok := connectors.RetryAfter(err)
+	if !ok {
+		return 0, false
+	}
+	if delay > g.max {
+		delay = g.max
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if until := g.now().Add(delay); until.After(g.until) {
+		g.until = until
+	}
+	return delay, true
+}
+
+// wait blocks until the pause ends or the context is done
+func (g *retryGate) wait(ctx context.Context) error {
+	for {
+		g.mu.Lock()
+		delay := g.until.Sub(g.now())
+		g.mu.Unlock()
+		if delay <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// retryDelay returns the wait before a retry: the advertised delay of the error if longer
+// than the backoff, capped to the maximum
+func retryDelay(err error, backoff time.Duration) time.Duration {
+	if delay, ok := connectors.RetryAfter(err); ok && delay > backoff {
+		if delay > defaultMaxRetryAfter {
+			return defaultMaxRetryAfter
+		}
+		return delay
+	}
+	return backoff
+}
@@ -0,0 +1,109 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+func TestRetryGateObserve(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	g := newRetryGate(10 * time.Second)
+	g.now = func() time.Time { return now }
+
+	if _, ok := g.observe(errors.New("boom")); ok {
+		t.Error("errors without hint must not pause the runner")
+	}
+	wrapped := fmt.Errorf("target 0: %w", &connectors.RetryAfterError{Delay: 3 * time.Second, Err: errors.New("429")})
+	if delay, ok := g.observe(wrapped); !ok || delay != 3*time.Second || !g.until.Equal(now.Add(3*time.Second)) {
+		t.Errorf("observe() = %v, %v until %v", delay, ok, g.until)
+	}
+	// Longer hints are capped, shorter hints do not shorten the pause
+	if delay, _ := g.observe(&connectors.RetryAfterError{Delay: time.Hour}); delay != 10*time.Second {
+		t.Errorf("capped delay = %v", delay)
+	}
+	g.observe(&connectors.RetryAfterError{Delay: time.Second})
+	if !g.until.Equal(now.Add(10 * time.Second)) {
+		t.Errorf("until = %v", g.until)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait() = %v", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	hint := &connectors.RetryAfterError{Delay: 2 * time.Second, Err: errors.New("429")}
+	if d := retryDelay(hint, 100*time.Millisecond); d != 2*time.Second {
+		t.Errorf("retryDelay() = %v", d)
+	}
+	if d := retryDelay(hint, 5*time.Second); d != 5*time.Second {
+		t.Errorf("retryDelay() = %v", d)
+	}
+	if d := retryDelay(errors.New("boom"), time.Millisecond); d != time.Millisecond {
+		t.Errorf("retryDelay() = %v", d)
+	}
+}
+
+func TestBridgePausesRunnerOnRetryAfter(t *testing.T) {
+	var mu sync.Mutex
+	var calls []time.Time
+	runner := &funcRunner{process: func(*message.RunnerMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, time.Now())
+		if len(calls) == 1 {
+			return &connectors.RetryAfterError{Delay: 200 * time.Millisecond, Err: errors.New("non-2XX status code: 429")}
+		}
+		return nil
+	}}
+
+	src := newChanSource()
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger(), source: src, activity: newActivityTracker()}
+	b.runners = []RunnerItem{{Config: connectors.RunnerConfig{Type: "test"}, Runner: runner}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+
+	first, second := newCountingMessage("1"), newCountingMessage("2")
+	src.c <- message.NewRunnerMessage(first)
+	src.c <- message.NewRunnerMessage(second)
+	waitFor(t, func() bool { return first.naks.Load() == 1 && second.acks.Load() == 1 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 2 || calls[1].Sub(calls[0]) < 200*time.Millisecond {
+		t.Errorf("second message processed %v after the retry-after hint", calls[1].Sub(calls[0]))
+	}
+}
+
+func TestGroupRunnerRetryAfter(t *testing.T) {
+	calls := 0
+	var first time.Time
+	runner := &funcRunner{process: func(*message.RunnerMessage) error {
+		calls++
+		if calls == 1 {
+			first = time.Now()
+			return &connectors.RetryAfterError{Delay: 100 * time.Millisecond, Err: errors.New("503")}
+		}
+		if time.Since(first) < 100*time.Millisecond {
+			return errors.New("retried before the advertised delay")
+		}
+		return nil
+	}}
+	gr := newTestGroupRunner(groupFirstSuccess, runner)
+	gr.retries = 1
+	if _, err := processGroup(t, gr); err != nil || calls != 2 {
+		t.Errorf("Process() = %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,288 @@
+package bridge
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/config"
+)
+
+const (
+	defaultSafetyValveWindow        = time.Minute
+	defaultSafetyValveMinMessages   = 20
+	defaultSafetyValveSustain       = 30 * time.Second
+	defaultSafetyValveCoolDown      = 5 * time.Minute
+	defaultSafetyValveCheckInterval = time.Second
+
+	// safetyValveBuckets is the number of buckets the window is divided into
+	safetyValveBuckets = 60
+
+	pauseReasonErrorRate = "error rate"
+	pauseReasonManual    = "manual"
+)
+
+// PauseStatus describes the pause state of a pipeline
+type PauseStatus struct {
+	Paused bool   `json:"paused"`
+	Reason string `json:"reason,omitempty"`
+	// Since is the time the pipeline was paused
+	Since time.Time `json:"since,omitzero"`
+	// ResumeAt is the time of the automatic resume, zero when the pipeline waits for a manual resume
+	ResumeAt time.Time `json:"resumeAt,omitzero"`
+	// Messages and Failures are the runner results in the window of the safety valve
+	Messages  int     `json:"messages"`
+	Failures  int     `json:"failures"`
+	ErrorRate float64 `json:"errorRate"`
+}
+
+// valveBucket counts the runner results of a slice of the window
+type valveBucket struct {
+	start    time.Time
+	messages int
+	failures int
+}
+
+// safetyValve stops the consumption of the source while the pipeline is paused, either
+// manually or by the monitor of the runner failure rate when a safety valve is configured
+type safetyValve struct {
+	cfg     *config.SafetyValveConfig
+	logger  *slog.Logger
+	now     func() time.Time
+	source  string
+	width   time.Duration
+	mu      sync.Mutex
+	buckets []valveBucket
+	// breachSince is the start of the current period over the threshold
+	breachSince time.Time
+	paused      bool
+	reason      string
+	since       time.Time
+	resumeAt    time.Time
+	// resumed is closed when the pipeline resumes
+	resumed chan struct{}
+}
+
+// newSafetyValve creates the pause control of a pipeline; a nil configuration only allows
+// the manual pauses
+func newSafetyValve(cfg *config.SafetyValveConfig, source string, logger *slog.Logger) *safetyValve {
+	v := &safetyValve{
+		logger: logger.With("component", "safety-valve"),
+		now:    time.Now,
+		source: source,
+	}
+	pipelinePaused.With(source).Set(0)
+	if cfg == nil {
+		return v
+	}
+	c := *cfg
+	if c.Window <= 0 {
+		c.Window = defaultSafetyValveWindow
+	}
+	if c.MinMessages <= 0 {
+		c.MinMessages = defaultSafetyValveMinMessages
+	}
+	if c.Sustain <= 0 {
+		c.Sustain = defaultSafetyValveSustain
+	}
+	if c.CoolDown <= 0 {
+		c.CoolDown = defaultSafetyValveCoolDown
+	}
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = defaultSafetyValveCheckInterval
+	}
+	v.cfg = &c
+	v.width = max(c.Window/safetyValveBuckets, time.Millisecond)
+	v.buckets = make([]valveBucket, int((c.Window+v.width-1)/v.width))
+	return v
+}
+
+// record counts a runner result in the window
+func (v *safetyValve) record(failed bool) {
+	if v == nil || v.cfg == nil {
+		return
+	}
+	now := v.now()
+	start := now.Truncate(v.width)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	b := &v.buckets[int(start.UnixNano()/int64(v.width))%len(v.buckets)]
+	if !b.start.Equal(start) {
+		*b = valveBucket{start: start}
+	}
+	b.messages++
+	if failed {
+		b.failures++
+	}
+}
+
+// rate returns the runner results of the window; the caller holds the lock
+func (v *safetyValve) rate(now time.Time) (messages, failures int) {
+	for _, b := range v.buckets {
+		if !b.start.IsZero() && now.Sub(b.start) < v.cfg.Window {
+			messages += b.messages
+			failures += b.failures
+		}
+	}
+	return messages, failures
+}
+
+// Run evaluates the failure rate on every interval until the context is cancelled
+func (v *safetyValve) Run(ctx context.Context) {
+	if v == nil || v.cfg == nil {
+		return
+	}
+	ticker := time.NewTicker(v.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			v.check()
+		}
+	}
+}
+
+// check pauses the pipeline when the failure rate stayed over the threshold for the sustain
+// period, and resumes it once the cool-down of an automatic pause has elapsed
+func (v *safetyValve) check() {
+	now := v.now()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.paused {
+		if v.reason == pauseReasonErrorRate && !v.resumeAt.IsZero() && !now.Before(v.resumeAt) {
+			v.logger.Info("pipeline resumed after the cool-down", "pausedFor", now.Sub(v.since))
+			v.resume()
+		}
+		return
+	}
+
+	messages, failures := v.rate(now)
+	if messages < v.cfg.MinMessages || float64(failures)/float64(messages) < v.cfg.Threshold {
+		v.breachSince = time.Time{}
+		return
+	}
+	if v.breachSince.IsZero() {
+		v.breachSince = now
+	}
+	if now.Sub(v.breachSince) < v.cfg.Sustain {
+		return
+	}
+
+	var resumeAt time.Time
+	if !v.cfg.ManualResume {
+		resumeAt = now.Add(v.cfg.CoolDown)
+	}
+	v.logger.Warn("pipeline paused on the runner error rate",
+		"messages", messages, "failures", failures, "threshold", v.cfg.Threshold, "resumeAt", resumeAt)
+	v.pause(pauseReasonErrorRate, resumeAt)
+}
+
+// pause stops the consumption of the source; the caller holds the lock
+func (v *safetyValve) pause(reason string, resumeAt time.Time) {
+	if !v.paused {
+		v.paused = true
+		v.since = v.now()
+		v.resumed = make(chan struct{})
+		pipelinePauses.With(v.source, reason).Inc()
+		pipelinePaused.With(v.source).Set(1)
+	}
+	v.reason = reason
+	v.resumeAt = resumeAt
+}
+
+// resume restarts the consumption of the source with an empty window, so that the failures
+// preceding the pause don't pause the pipeline again; the caller holds the lock
+func (v *safetyValve) resume() {
+	if !v.paused {
+		return
+	}
+	v.paused = false
+	v.reason = ""
+	v.since = time.Time{}
+	v.resumeAt = time.Time{}
+	v.breachSince = time.Time{}
+	clear(v.buckets)
+	close(v.resumed)
+	pipelinePaused.With(v.source).Set(0)
+}
+
+// Pause pauses the pipeline until it is resumed manually
+func (v *safetyValve) Pause() {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.pause(pauseReasonManual, time.Time{})
+	v.logger.Warn("pipeline paused manually")
+}
+
+// Resume resumes a paused pipeline
+func (v *safetyValve) Resume() {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.paused {
+		v.logger.Info("pipeline resumed manually", "pausedFor", v.now().Sub(v.since))
+	}
+	v.resume()
+}
+
+// wait blocks while the pipeline is paused or until the context is done
+func (v *safetyValve) wait(ctx context.Context) error {
+	if v == nil {
+		return nil
+	}
+	v.mu.Lock()
+	paused, resumed := v.paused, v.resumed
+	v.mu.Unlock()
+	if !paused {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// status returns the pause state of the pipeline
+func (v *safetyValve) status() PauseStatus {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s := PauseStatus{Paused: v.paused, Reason: v.reason, Since: v.since, ResumeAt: v.resumeAt}
+	if v.cfg != nil {
+		s.Messages, s.Failures = v.rate(v.now())
+		if s.Messages > 0 {
+			s.ErrorRate = float64(s.Failures) / float64(s.Messages)
+		}
+	}
+	return s
+}
+
+// Pause stops the consumption of the source until Resume is called. The in-flight messages
+// are still processed; the new messages wait in the source.
+func (b *EventsBridge) Pause() {
+	b.valve.Pause()
+}
+
+// Resume resumes the consumption of the source, paused manually or by the safety valve
+func (b *EventsBridge) Resume() {
+	b.valve.Resume()
+}
+
+// PauseStatus returns the pause state of the pipeline
+func (b *EventsBridge) PauseStatus() *PauseStatus {
+	if b.valve == nil {
+		return nil
+	}
+	status := b.valve.status()
+	return &status
+}
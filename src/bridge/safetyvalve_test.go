@@ -0,0 +1,207 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+func newTestValve(cfg config.SafetyValveConfig) (*safetyValve, *time.Time) {
+	v := newSafetyValve(&cfg, "test", newTestLogger())
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	v.now = func() time.Time { return now }
+	return v, &now
+}
+
+func TestSafetyValveErrorRate(t *testing.T) {
+	v, now := newTestValve(config.SafetyValveConfig{
+		Threshold:   0.5,
+		Window:      time.Minute,
+		MinMessages: 4,
+		Sustain:     10 * time.Second,
+		CoolDown:    time.Minute,
+	})
+
+	// Too few results to evaluate the rate
+	for range 3 {
+		v.record(true)
+	}
+	v.check()
+	if v.breachSince != (time.Time{}) {
+		t.Fatal("rate evaluated below minMessages")
+	}
+
+	v.record(false)
+	v.check()
+	*now = now.Add(5 * time.Second)
+	v.check()
+	if v.status().Paused {
+		t.Fatal("paused before the sustain period")
+	}
+	*now = now.Add(5 * time.Second)
+	v.check()
+	s := v.status()
+	if !s.Paused || s.Reason != pauseReasonErrorRate || s.Failures != 3 || s.Messages != 4 || s.ErrorRate != 0.75 {
+		t.Fatalf("status = %+v, want paused on the error rate", s)
+	}
+	if !s.ResumeAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("resumeAt = %v", s.ResumeAt)
+	}
+
+	// The cool-down resumes the pipeline with an empty window
+	*now = now.Add(time.Minute)
+	v.check()
+	if s := v.status(); s.Paused || s.Messages != 0 {
+		t.Fatalf("status after the cool-down = %+v", s)
+	}
+}
+
+func TestSafetyValveRecovery(t *testing.T) {
+	v, now := newTestValve(config.SafetyValveConfig{Threshold: 0.5, MinMessages: 2, Sustain: 10 * time.Second})
+	v.record(true)
+	v.record(true)
+	v.check()
+	// The rate falls under the threshold before the end of the sustain period
+	for range 4 {
+		v.record(false)
+	}
+	*now = now.Add(10 * time.Second)
+	v.check()
+	if v.status().Paused {
+		t.Fatal("paused after the recovery")
+	}
+
+	// The results older than the window are forgotten
+	*now = now.Add(time.Minute)
+	if s := v.status(); s.Messages != 0 {
+		t.Errorf("messages after the window = %d", s.Messages)
+	}
+}
+
+func TestSafetyValveManualResume(t *testing.T) {
+	v, now := newTestValve(config.SafetyValveConfig{Threshold: 1, MinMessages: 1, Sustain: time.Second, ManualResume: true})
+	v.record(true)
+	v.check()
+	*now = now.Add(time.Second)
+	v.check()
+	if s := v.status(); !s.Paused || !s.ResumeAt.IsZero() {
+		t.Fatalf("status = %+v, want paused until resumed", s)
+	}
+	*now = now.Add(time.Hour)
+	v.check()
+	if !v.status().Paused {
+		t.Fatal("resumed without the manual action")
+	}
+	v.Resume()
+	if v.status().Paused {
+		t.Fatal("Resume() did not resume")
+	}
+}
+
+func TestSafetyValveWait(t *testing.T) {
+	v := newSafetyValve(nil, "test", newTestLogger())
+	v.Pause()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := v.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait() while paused = %v, want deadline exceeded", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- v.wait(context.Background()) }()
+	v.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("wait() after resume = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait() not released by Resume()")
+	}
+}
+
+func TestSafetyValvePausesSource(t *testing.T) {
+	src := newChanSource()
+	cfg := newTestConfig()
+	cfg.Runners = []connectors.RunnerConfig{{Type: "test"}}
+	cfg.SafetyValve = &config.SafetyValveConfig{
+		Threshold:     1,
+		MinMessages:   2,
+		Sustain:       time.Millisecond,
+		CoolDown:      time.Hour,
+		CheckInterval: 5 * time.Millisecond,
+	}
+	var failing atomic.Bool
+	failing.Store(true)
+	runner := &funcRunner{process: func(*message.RunnerMessage) error {
+		if failing.Load() {
+			return errors.New("target unavailable")
+		}
+		return nil
+	}}
+	b := &EventsBridge{
+		cfg:      cfg,
+		logger:   newTestLogger(),
+		source:   src,
+		runners:  []RunnerItem{{Config: cfg.Runners[0], Runner: runner}},
+		activity: newActivityTracker(),
+		valve:    newSafetyValve(cfg.SafetyValve, cfg.Source.Type, newTestLogger()),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+
+	for range 2 {
+		msg := newCountingMessage("fail")
+		src.c <- message.NewRunnerMessage(msg)
+		waitFor(t, func() bool { return msg.naks.Load() == 1 })
+	}
+	waitFor(t, func() bool { return b.PauseStatus().Paused })
+
+	// The paused pipeline doesn't consume the source
+	failing.Store(false)
+	held := newCountingMessage("held")
+	src.c <- message.NewRunnerMessage(held)
+	time.Sleep(50 * time.Millisecond)
+	if held.acks.Load() != 0 || b.InFlight() != 0 {
+		t.Fatalf("message processed while paused: acks %d, in flight %d", held.acks.Load(), b.InFlight())
+	}
+
+	b.Resume()
+	waitFor(t, func() bool { return held.acks.Load() == 1 })
+	if b.PauseStatus().Paused {
+		t.Error("PauseStatus() still paused after Resume()")
+	}
+}
+
+func TestSupervisorPauseResume(t *testing.T) {
+	s := newTestSupervisor(t, nil, newChanSource())
+	if _, err := s.Pause(); !errors.Is(err, ErrNoActivePipeline) {
+		t.Fatalf("Pause() before start = %v, want ErrNoActivePipeline", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Start(ctx, newTestConfig()); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	status, err := s.Pause()
+	if err != nil || !status.Active.Pause.Paused || status.Active.Pause.Reason != pauseReasonManual {
+		t.Fatalf("Pause() = %+v, %v", status.Active.Pause, err)
+	}
+	if status, err = s.Resume(); err != nil || status.Active.Pause.Paused {
+		t.Fatalf("Resume() = %+v, %v", status.Active.Pause, err)
+	}
+}
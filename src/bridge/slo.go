@@ -0,0 +1,297 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/config"
+)
+
+const (
+	defaultSLOWindow         = 1000
+	defaultSLOMaxAge         = 5 * time.Minute
+	defaultSLOCheckInterval  = 10 * time.Second
+	defaultSLOWebhookTimeout = 5 * time.Second
+
+	// sloBreached and sloRecovered are the statuses of the SLO events
+	sloBreached  = "breached"
+	sloRecovered = "recovered"
+)
+
+// LatencySnapshot holds end-to-end latency percentiles computed over the SLO window
+type LatencySnapshot struct {
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+}
+
+// SLOBreach describes a latency percentile exceeding its configured threshold, or back
+// within it when the status is "recovered"
+type SLOBreach struct {
+	Status     string          `json:"status"`
+	Percentile string          `json:"percentile"`
+	Observed   time.Duration   `json:"observed"`
+	Threshold  time.Duration   `json:"threshold"`
+	Snapshot   LatencySnapshot `json:"snapshot"`
+	Time       time.Time       `json:"time"`
+}
+
+// latencySample is an end-to-end latency and the time it was recorded
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// latencyTracker keeps a ring buffer of the most recent end-to-end latencies,
+// expiring the samples older than maxAge
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples []latencySample
+	next    int
+	full    bool
+	maxAge  time.Duration
+	now     func() time.Time
+}
+
+func newLatencyTracker(window int, maxAge time.Duration) *latencyTracker {
+	if window < 1 {
+		window = defaultSLOWindow
+	}
+	if maxAge <= 0 {
+		maxAge = defaultSLOMaxAge
+	}
+	return &latencyTracker{samples: make([]latencySample, window), maxAge: maxAge, now: time.Now}
+}
+
+// Record adds a latency sample, overwriting the oldest one when the window is full
+func (t *latencyTracker) Record(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[t.next] = latencySample{at: t.now(), latency: d}
+	t.next++
+	if t.next == len(t.samples) {
+		t.next = 0
+		t.full = true
+	}
+}
+
+// Snapshot computes p50/p95/p99 over the samples of the window not older than maxAge
+func (t *latencyTracker) Snapshot() LatencySnapshot {
+	t.mu.Lock()
+	n := t.next
+	if t.full {
+		n = len(t.samples)
+	}
+	since := t.now().Add(-t.maxAge)
+	sorted := make([]time.Duration, 0, n)
+	for _, s := range t.samples[:n] {
+		if !s.at.Before(since) {
+			sorted = append(sorted, s.latency)
+		}
+	}
+	t.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return LatencySnapshot{}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return LatencySnapshot{
+		Count: len(sorted),
+		P50:   percentile(sorted, 0.50),
+		P95:   percentile(sorted, 0.95),
+		P99:   percentile(sorted, 0.99),
+	}
+}
+
+// percentile returns the nearest-rank percentile of an ascending sorted slice
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// sloMonitor periodically compares latency percentiles with the configured thresholds
+// and reports the breaches and the recoveries to the log and, optionally, to a webhook
+type sloMonitor struct {
+	cfg     config.SLOConfig
+	tracker *latencyTracker
+	logger  *slog.Logger
+	client  *http.Client
+	now     func() time.Time
+	// notified holds the last notification time of the ongoing breaches, by percentile;
+	// only the check loop accesses it
+	notified map[string]time.Time
+}
+
+func newSLOMonitor(cfg config.SLOConfig, logger *slog.Logger) *sloMonitor {
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaultSLOCheckInterval
+	}
+	if cfg.WebhookTimeout <= 0 {
+		cfg.WebhookTimeout = defaultSLOWebhookTimeout
+	}
+	return &sloMonitor{
+		cfg:      cfg,
+		tracker:  newLatencyTracker(cfg.Window, cfg.MaxAge),
+		logger:   logger.With("component", "slo"),
+		client:   &http.Client{Timeout: cfg.WebhookTimeout},
+		now:      time.Now,
+		notified: map[string]time.Time{},
+	}
+}
+
+// Observe records the end-to-end latency of a message that left the pipeline
+func (m *sloMonitor) Observe(ingress time.Time) {
+	if ingress.IsZero() {
+		return
+	}
+	m.tracker.Record(time.Since(ingress))
+}
+
+// sloCheck is a percentile of a snapshot and its threshold
+type sloCheck struct {
+	name      string
+	observed  time.Duration
+	threshold time.Duration
+}
+
+// checks returns the percentiles of the snapshot with a threshold
+func (m *sloMonitor) checks(s LatencySnapshot) []sloCheck {
+	var res []sloCheck
+	for _, c := range []sloCheck{
+		{"p50", s.P50, m.cfg.P50},
+		{"p95", s.P95, m.cfg.P95},
+		{"p99", s.P99, m.cfg.P99},
+	} {
+		if c.threshold > 0 {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// Breaches returns the thresholds exceeded by the given snapshot
+func (m *sloMonitor) Breaches(s LatencySnapshot) []SLOBreach {
+	if s.Count == 0 {
+		return nil
+	}
+	now := m.now()
+	var res []SLOBreach
+	for _, c := range m.checks(s) {
+		if c.observed > c.threshold {
+			res = append(res, SLOBreach{
+				Status:     sloBreached,
+				Percentile: c.name,
+				Observed:   c.observed,
+				Threshold:  c.threshold,
+				Snapshot:   s,
+				Time:       now,
+			})
+		}
+	}
+	return res
+}
+
+// Run evaluates the SLO on every check interval until the context is cancelled
+func (m *sloMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.check(ctx)
+		}
+	}
+}
+
+// check notifies the breaches when they start and the recoveries of the notified breaches,
+// repeating the notification of an ongoing breach after the renotify interval
+func (m *sloMonitor) check(ctx context.Context) {
+	snapshot := m.tracker.Snapshot()
+	m.logger.Debug("latency snapshot", "count", snapshot.Count, "p50", snapshot.P50, "p95", snapshot.P95, "p99", snapshot.P99)
+	now := m.now()
+	breached := map[string]bool{}
+	for _, breach := range m.Breaches(snapshot) {
+		breached[breach.Percentile] = true
+		last, ongoing := m.notified[breach.Percentile]
+		if ongoing && (m.cfg.RenotifyInterval <= 0 || now.Sub(last) < m.cfg.RenotifyInterval) {
+			continue
+		}
+		m.notified[breach.Percentile] = now
+		m.logger.Warn("latency SLO breached",
+			"percentile", breach.Percentile,
+			"observed", breach.Observed,
+			"threshold", breach.Threshold,
+			"samples", snapshot.Count)
+		m.deliver(ctx, breach)
+	}
+	if snapshot.Count == 0 {
+		return
+	}
+	for _, c := range m.checks(snapshot) {
+		if _, ongoing := m.notified[c.name]; !ongoing || breached[c.name] {
+			continue
+		}
+		delete(m.notified, c.name)
+		m.logger.Info("latency SLO recovered",
+			"percentile", c.name,
+			"observed", c.observed,
+			"threshold", c.threshold,
+			"samples", snapshot.Count)
+		m.deliver(ctx, SLOBreach{
+			Status:     sloRecovered,
+			Percentile: c.name,
+			Observed:   c.observed,
+			Threshold:  c.threshold,
+			Snapshot:   snapshot,
+			Time:       now,
+		})
+	}
+}
+
+// deliver posts the event to the webhook, when configured
+func (m *sloMonitor) deliver(ctx context.Context, event SLOBreach) {
+	if m.cfg.WebhookURL == "" {
+		return
+	}
+	if err := m.notify(ctx, event); err != nil {
+		m.logger.Error("failed to deliver SLO webhook", "status", event.Status, "error", err)
+	}
+}
+
+// notify posts the breach event as JSON to the configured webhook
+func (m *sloMonitor) notify(ctx context.Context, breach SLOBreach) error {
+	body, err := json.Marshal(breach)
+	if err != nil {
+		return fmt.Errorf("failed to marshal breach event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook request: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+	if res.StatusCode > 299 {
+		return fmt.Errorf("webhook returned non-2XX status code: %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/destel/rill"
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func TestLatencyTrackerSnapshot(t *testing.T) {
+	tracker := newLatencyTracker(100, 0)
+	for i := 1; i <= 100; i++ {
+		tracker.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	s := tracker.Snapshot()
+	if s.Count != 100 {
+		t.Fatalf("Snapshot().Count = %d, want 100", s.Count)
+	}
+	if s.P50 != 50*time.Millisecond {
+		t.Errorf("Snapshot().P50 = %v, want 50ms", s.P50)
+	}
+	if s.P95 != 95*time.Millisecond {
+		t.Errorf("Snapshot().P95 = %v, want 95ms", s.P95)
+	}
+	if s.P99 != 99*time.Millisecond {
+		t.Errorf("Snapshot().P99 = %v, want 99ms", s.P99)
+	}
+}
+
+func TestLatencyTrackerWindowOverwrite(t *testing.T) {
+	tracker := newLatencyTracker(3, 0)
+	tracker.Record(time.Second)
+	tracker.Record(time.Second)
+	tracker.Record(time.Second)
+	for i := 0; i < 3; i++ {
+		tracker.Record(time.Millisecond)
+	}
+
+	s := tracker.Snapshot()
+	if s.Count != 3 {
+		t.Fatalf("Snapshot().Count = %d, want 3", s.Count)
+	}
+	if s.P99 != time.Millisecond {
+		t.Errorf("Snapshot().P99 = %v, want 1ms after window overwrite", s.P99)
+	}
+}
+
+func TestLatencyTrackerEmpty(t *testing.T) {
+	s := newLatencyTracker(0, 0).Snapshot()
+	if s.Count != 0 || s.P99 != 0 {
+		t.Errorf("Snapshot() of empty tracker = %+v, want zero value", s)
+	}
+}
+
+func TestLatencyTrackerMaxAge(t *testing.T) {
+	tracker := newLatencyTracker(10, time.Minute)
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+
+	tracker.Record(time.Second)
+	now = now.Add(30 * time.Second)
+	tracker.Record(time.Millisecond)
+
+	if s := tracker.Snapshot(); s.Count != 2 || s.P99 != time.Second {
+		t.Fatalf("Snapshot() = %+v, want both samples", s)
+	}
+	now = now.Add(45 * time.Second)
+	if s := tracker.Snapshot(); s.Count != 1 || s.P99 != time.Millisecond {
+		t.Errorf("Snapshot() = %+v, want the old sample expired", s)
+	}
+	now = now.Add(time.Minute)
+	if s := tracker.Snapshot(); s.Count != 0 {
+		t.Errorf("Snapshot() = %+v, want every sample expired", s)
+	}
+}
+
+func TestSLOMonitorBreaches(t *testing.T) {
+	m := newSLOMonitor(config.SLOConfig{P50: 10 * time.Millisecond, P99: time.Second}, newTestLogger())
+
+	breaches := m.Breaches(LatencySnapshot{Count: 10, P50: 20 * time.Millisecond, P95: time.Hour, P99: 500 * time.Millisecond})
+	if len(breaches) != 1 {
+		t.Fatalf("Breaches() returned %d breaches, want 1", len(breaches))
+	}
+	if breaches[0].Percentile != "p50" {
+		t.Errorf("Breaches()[0].Percentile = %s, want p50", breaches[0].Percentile)
+	}
+
+	if got := m.Breaches(LatencySnapshot{}); got != nil {
+		t.Errorf("Breaches() with no samples = %v, want nil", got)
+	}
+}
+
+func TestSLOMonitorWebhook(t *testing.T) {
+	received := make(chan SLOBreach, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var breach SLOBreach
+		if err := json.NewDecoder(r.Body).Decode(&breach); err != nil {
+			t.Errorf("failed to decode webhook body: %v", err)
+		}
+		received <- breach
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	m := newSLOMonitor(config.SLOConfig{P95: time.Nanosecond, WebhookURL: ts.URL}, newTestLogger())
+	m.tracker.Record(time.Millisecond)
+	m.check(context.Background())
+
+	select {
+	case breach := <-received:
+		if breach.Percentile != "p95" {
+			t.Errorf("webhook breach percentile = %s, want p95", breach.Percentile)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
+
+func TestSLOMonitorNotifyTransitions(t *testing.T) {
+	var events []SLOBreach
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event SLOBreach
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("failed to decode webhook body: %v", err)
+		}
+		events = append(events, event)
+	}))
+	defer ts.Close()
+
+	m := newSLOMonitor(config.SLOConfig{Window: 1, P95: 10 * time.Millisecond, WebhookURL: ts.URL, RenotifyInterval: time.Minute}, newTestLogger())
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	statuses := func() []string {
+		var res []string
+		for _, e := range events {
+			res = append(res, e.Status)
+		}
+		return res
+	}
+
+	// A sustained breach is notified once, then again after the renotify interval
+	m.tracker.Record(20 * time.Millisecond)
+	for range 3 {
+		m.check(context.Background())
+		now = now.Add(10 * time.Second)
+	}
+	if got := statuses(); !slices.Equal(got, []string{sloBreached}) {
+		t.Fatalf("events = %v, want a single breach", got)
+	}
+	now = now.Add(time.Minute)
+	m.check(context.Background())
+	if got := statuses(); !slices.Equal(got, []string{sloBreached, sloBreached}) {
+		t.Fatalf("events = %v, want the breach notified again", got)
+	}
+
+	// The recovery is notified once
+	m.tracker.Record(time.Millisecond)
+	m.check(context.Background())
+	m.check(context.Background())
+	if got := statuses(); !slices.Equal(got, []string{sloBreached, sloBreached, sloRecovered}) {
+		t.Fatalf("events = %v, want the recovery", got)
+	}
+	if last := events[len(events)-1]; last.Percentile != "p95" || last.Observed != time.Millisecond || last.Threshold != 10*time.Millisecond {
+		t.Errorf("recovery = %+v", last)
+	}
+}
+
+func TestAckSourceObservesLatency(t *testing.T) {
+	bridge := &EventsBridge{
+		cfg:    newTestConfig(),
+		logger: newTestLogger(),
+		slo:    newSLOMonitor(config.SLOConfig{}, newTestLogger()),
+	}
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("test"), nil))
+	msg.SetIngressTime(time.Now().Add(-time.Second))
+
+	ch := make(chan *message.RunnerMessage, 1)
+	ch <- msg
+	close(ch)
+
+	if err := bridge.ackSource(rill.FromChan(ch, nil)); err != nil {
+		t.Fatalf("ackSource() unexpected error = %v", err)
+	}
+
+	s, ok := bridge.LatencySnapshot()
+	if !ok {
+		t.Fatal("LatencySnapshot() reported SLO disabled")
+	}
+	if s.Count != 1 || s.P50 < time.Second {
+		t.Errorf("LatencySnapshot() = %+v, want one sample of at least 1s", s)
+	}
+}
@@ -0,0 +1,181 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"iter"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	splitPrimary = "primary"
+	splitCanary  = "canary"
+
+	defaultSplitPathKey = "eb-split-path"
+
+	// splitBuckets is the resolution of the keyed routing, allowing percentages with two decimals
+	splitBuckets = 10000
+)
+
+// Ensure splitRunner implements connectors.LifecycleRunner
+var _ connectors.LifecycleRunner = (*splitRunner)(nil)
+
+// splitRunner routes every message through either the primary or the canary runner chain
+type splitRunner struct {
+	primary []branchStage
+	canary  []branchStage
+	percent float64
+	keyFrom string
+	keys    []string
+	pathKey string
+	logger  *slog.Logger
+}
+
+// splitRunnerConfig holds the options of the split runner
+type splitRunnerConfig struct {
+	// Primary is the runner chain of the messages not selected for the canary (empty = pass through)
+	Primary []connectors.RunnerConfig `mapstructure:"primary" validate:"dive"`
+	// Canary is the alternative runner chain
+	Canary []connectors.RunnerConfig `mapstructure:"canary" validate:"required,min=1,dive"`
+	// Percent is the share of messages routed to the canary chain (0-100)
+	Percent float64 `mapstructure:"percent" validate:"min=0,max=100"`
+	// KeyFrom is the metadata key holding the routing key: messages with the same key
+	// always take the same path. Without it, messages are routed randomly.
+	KeyFrom string `mapstructure:"keyFrom" validate:"required_with=Keys"`
+	// Keys are routing keys always sent to the canary chain, regardless of Percent
+	Keys []string `mapstructure:"keys" validate:"omitempty,dive,required"`
+	// PathKey is the metadata key set to "primary" or "canary" (default: "eb-split-path")
+	PathKey string `mapstructure:"pathKey"`
+}
+
+// createSplitRunner builds the runner chains of a "split" runner configuration
+func (b *EventsBridge) createSplitRunner(runnerConfig connectors.RunnerConfig) (connectors.Runner, error) {
+	split := new(splitRunnerConfig)
+	if err := b.parseRunnerOptions(runnerConfig, split); err != nil {
+		return nil, err
+	}
+
+	sr := &splitRunner{
+		percent: split.Percent,
+		keyFrom: split.KeyFrom,
+		keys:    split.Keys,
+		pathKey: split.PathKey,
+		logger:  b.logger.With("component", "split"),
+	}
+	if sr.pathKey == "" {
+		sr.pathKey = defaultSplitPathKey
+	}
+
+	var err error
+	if sr.primary, err = b.createStages(split.Primary); err != nil {
+		return nil, fmt.Errorf("primary chain: %w", err)
+	}
+	if sr.canary, err = b.createStages(split.Canary); err != nil {
+		closeStages(sr.primary) //nolint:errcheck
+		return nil, fmt.Errorf("canary chain: %w", err)
+	}
+	return sr, nil
+}
+
+// Process runs the message through the selected chain and tags the path taken.
+// A filterExpr evaluating to false inside a chain skips the rest of that chain.
+func (r *splitRunner) Process(msg *message.RunnerMessage) error {
+	path, err := r.route(msg)
+	if err != nil {
+		return err
+	}
+	r.logger.Debug("message routed", "path", path)
+	msg.AddMetadata(r.pathKey, path)
+
+	stages := r.primary
+	if path == splitCanary {
+		stages = r.canary
+	}
+	if _, _, err := runBranch(msg, stages); err != nil {
+		return fmt.Errorf("%s chain: %w", path, err)
+	}
+	return nil
+}
+
+// route selects the chain of the message
+func (r *splitRunner) route(msg *message.RunnerMessage) (string, error) {
+	if r.keyFrom == "" {
+		if rand.Float64()*100 < r.percent { //nolint:gosec // traffic sampling, not security sensitive
+			return splitCanary, nil
+		}
+		return splitPrimary, nil
+	}
+
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		return "", fmt.Errorf("failed to get metadata: %w", err)
+	}
+	key := meta[r.keyFrom]
+	if slices.Contains(r.keys, key) || splitBucket(key) < r.percent*splitBuckets/100 {
+		return splitCanary, nil
+	}
+	return splitPrimary, nil
+}
+
+// splitBucket maps a routing key to a stable bucket in [0, splitBuckets)
+func splitBucket(key string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return float64(h.Sum32() % splitBuckets)
+}
+
+// Start calls the Start hook of the chain runners implementing connectors.LifecycleRunner
+func (r *splitRunner) Start(ctx context.Context) error {
+	for path, stages := range r.chains() {
+		for j, stage := range stages {
+			if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+				if err := lr.Start(ctx); err != nil {
+					return fmt.Errorf("failed to start runner %d of %s chain: %w", j, path, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Drain calls the Drain hook of the chain runners implementing connectors.LifecycleRunner
+func (r *splitRunner) Drain(ctx context.Context) error {
+	var errs []error
+	for path, stages := range r.chains() {
+		for j, stage := range stages {
+			if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+				if err := lr.Drain(ctx); err != nil {
+					errs = append(errs, fmt.Errorf("failed to drain runner %d of %s chain: %w", j, path, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the runners of both chains
+func (r *splitRunner) Close() error {
+	var errs []error
+	for path, stages := range r.chains() {
+		if err := closeStages(stages); err != nil {
+			errs = append(errs, fmt.Errorf("%s chain: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// chains iterates the chains in order
+func (r *splitRunner) chains() iter.Seq2[string, []branchStage] {
+	return func(yield func(string, []branchStage) bool) {
+		if yield(splitPrimary, r.primary) {
+			yield(splitCanary, r.canary)
+		}
+	}
+}
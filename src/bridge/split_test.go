@@ -0,0 +1,126 @@
+package bridge
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func newTestSplitRunner(split splitRunnerConfig, primary, canary connectors.Runner) *splitRunner {
+	return &splitRunner{
+		primary: []branchStage{{runner: primary}},
+		canary:  []branchStage{{runner: canary}},
+		percent: split.Percent,
+		keyFrom: split.KeyFrom,
+		keys:    split.Keys,
+		pathKey: defaultSplitPathKey,
+		logger:  newTestLogger(),
+	}
+}
+
+// splitPath processes a message with the given tenant and returns the path taken
+func splitPath(t *testing.T, sr *splitRunner, tenant string) string {
+	t.Helper()
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), map[string]string{"tenant": tenant}))
+	if err := sr.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta["version"] != meta[defaultSplitPathKey] {
+		t.Errorf("message tagged %q but processed by the %q chain", meta[defaultSplitPathKey], meta["version"])
+	}
+	return meta[defaultSplitPathKey]
+}
+
+func TestSplitRunnerPercent(t *testing.T) {
+	primary, canary := metadataRunner("version", splitPrimary), metadataRunner("version", splitCanary)
+
+	all := newTestSplitRunner(splitRunnerConfig{Percent: 100}, primary, canary)
+	none := newTestSplitRunner(splitRunnerConfig{Percent: 0}, primary, canary)
+	for range 20 {
+		if path := splitPath(t, all, "a"); path != splitCanary {
+			t.Fatalf("percent 100 routed to %s", path)
+		}
+		if path := splitPath(t, none, "a"); path != splitPrimary {
+			t.Fatalf("percent 0 routed to %s", path)
+		}
+	}
+}
+
+func TestSplitRunnerKeyed(t *testing.T) {
+	sr := newTestSplitRunner(splitRunnerConfig{Percent: 30, KeyFrom: "tenant", Keys: []string{"beta"}},
+		metadataRunner("version", splitPrimary), metadataRunner("version", splitCanary))
+
+	if path := splitPath(t, sr, "beta"); path != splitCanary {
+		t.Errorf("listed key routed to %s", path)
+	}
+
+	canaries := 0
+	for i := range 1000 {
+		tenant := fmt.Sprintf("tenant-%d", i)
+		path := splitPath(t, sr, tenant)
+		if again := splitPath(t, sr, tenant); again != path {
+			t.Fatalf("key %s routed to %s then %s", tenant, path, again)
+		}
+		if path == splitCanary {
+			canaries++
+		}
+	}
+	if canaries < 230 || canaries > 370 {
+		t.Errorf("expected about 30%% of the keys on the canary, got %d/1000", canaries)
+	}
+}
+
+func TestCreateSplitRunner(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+
+	runner, err := bridge.createRunner(connectors.RunnerConfig{
+		Type: "split",
+		Options: map[string]any{
+			"percent": 100,
+			"canary":  []any{map[string]any{"type": "pass", "filterExpr": `metadata.keep == "yes"`}},
+			"pathKey": "path",
+		},
+	})
+	if err != nil {
+		t.Fatalf("createRunner() unexpected error = %v", err)
+	}
+	sr, ok := runner.(*splitRunner)
+	if !ok {
+		t.Fatalf("createRunner() returned %T, want *splitRunner", runner)
+	}
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), map[string]string{"keep": "no"}))
+	if err := sr.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if meta, _ := msg.GetMetadata(); meta["path"] != splitCanary {
+		t.Errorf("expected path metadata %q, got %v", splitCanary, meta)
+	}
+	if err := sr.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+}
+
+func TestCreateSplitRunnerInvalid(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+
+	canary := []any{map[string]any{"type": "pass"}}
+	invalid := []map[string]any{
+		nil,
+		{"percent": 10},
+		{"percent": 120, "canary": canary},
+		{"keys": []any{"beta"}, "canary": canary},
+	}
+	for i, opts := range invalid {
+		if _, err := bridge.createRunner(connectors.RunnerConfig{Type: "split", Options: opts}); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package bridge
+
+import (
+	"github.com/sandrolain/events-bridge/src/connectors"
+)
+
+// Components of the connector statuses
+const (
+	componentSource = "source"
+)
+
+// ConnectorStatusItem is the status reported by a source or a runner of the pipeline
+type ConnectorStatusItem struct {
+	// Component is "source" or the runner stage, e.g. "runner[0]"
+	Component string `json:"component"`
+	// ID is the id of the source of multiple sources
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type"`
+	connectors.ConnectorStatus
+}
+
+// Ready reports whether the connector is connected
+func (i ConnectorStatusItem) Ready() bool {
+	return i.State == connectors.StateConnected
+}
+
+// statusReporter is a connector of the pipeline implementing connectors.StatusReporter
+type statusReporter struct {
+	component string
+	id        string
+	typ       string
+	reporter  connectors.StatusReporter
+}
+
+// statusReporters returns the source and the runners of the main chain reporting their
+// status. The runners wrapped by a retry policy are reported by the wrapped runner.
+func (b *EventsBridge) statusReporters() []statusReporter {
+	var reporters []statusReporter
+	if ms, ok := b.source.(*multiSource); ok {
+		for _, item := range ms.items {
+			if r, ok := item.source.(connectors.StatusReporter); ok {
+				reporters = append(reporters, statusReporter{component: componentSource, id: item.id, typ: item.typ, reporter: r})
+			}
+		}
+	} else if r, ok := b.source.(connectors.StatusReporter); ok {
+		reporters = append(reporters, statusReporter{component: componentSource, typ: b.cfg.Source.Type, reporter: r})
+	}
+
+	for i, item := range b.runners {
+		runner := item.Runner
+		if rr, ok := runner.(*retryRunner); ok {
+			runner = rr.runner
+		}
+		if r, ok := runner.(connectors.StatusReporter); ok {
+			reporters = append(reporters, statusReporter{component: runnerStage(i), typ: item.Config.Type, reporter: r})
+		}
+	}
+	return reporters
+}
+
+// ConnectorStatuses returns the statuses reported by the source and the runners
+func (b *EventsBridge) ConnectorStatuses() []ConnectorStatusItem {
+	reporters := b.statusReporters()
+	if len(reporters) == 0 {
+		return nil
+	}
+	items := make([]ConnectorStatusItem, 0, len(reporters))
+	for _, r := range reporters {
+		items = append(items, ConnectorStatusItem{
+			Component:       r.component,
+			ID:              r.id,
+			Type:            r.typ,
+			ConnectorStatus: r.reporter.ConnectorStatus(),
+		})
+	}
+	return items
+}
+
+// Ready reports whether the pipeline is running with every reporting connector connected
+func (s *PipelineStatus) Ready() bool {
+	if s == nil {
+		return false
+	}
+	for _, c := range s.Connectors {
+		if !c.Ready() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// reportingSource is a chanSource reporting its status
+type reportingSource struct {
+	*chanSource
+	connectors.StatusTracker
+}
+
+// reportingRunner is a runner reporting its status
+type reportingRunner struct {
+	funcRunner
+	connectors.StatusTracker
+}
+
+func TestConnectorStatuses(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Source.Type = "statustest"
+	src := &reportingSource{chanSource: newChanSource()}
+	src.SetState(connectors.StateConnected)
+	runner := &reportingRunner{funcRunner: funcRunner{process: func(*message.RunnerMessage) error { return nil }}}
+	runner.SetState(connectors.StateDisconnected)
+	runner.RecordError(errors.New("connection refused"))
+	b := &EventsBridge{
+		cfg:      cfg,
+		logger:   newTestLogger(),
+		source:   src,
+		activity: newActivityTracker(),
+		runners: []RunnerItem{
+			{Config: connectors.RunnerConfig{Type: "pass"}},
+			{Config: connectors.RunnerConfig{Type: "statusrunner"}, Runner: &retryRunner{runner: runner}},
+		},
+	}
+
+	statuses := b.ConnectorStatuses()
+	if len(statuses) != 2 {
+		t.Fatalf("statuses = %+v, want source and runner", statuses)
+	}
+	if s := statuses[0]; s.Component != "source" || s.Type != "statustest" || !s.Ready() {
+		t.Errorf("source status = %+v", s)
+	}
+	if s := statuses[1]; s.Component != "runner[1]" || s.Type != "statusrunner" || s.Ready() || s.LastError != "connection refused" {
+		t.Errorf("runner status = %+v", s)
+	}
+	if (&PipelineStatus{Connectors: statuses}).Ready() {
+		t.Error("pipeline with a disconnected runner reported ready")
+	}
+	if !(&PipelineStatus{Connectors: statuses[:1]}).Ready() {
+		t.Error("pipeline with connected connectors reported not ready")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	runner.SetLag(7)
+	out := scrape(t)
+	for _, want := range []string{
+		`eb_connector_up{component="source",type="statustest"} 1`,
+		`eb_connector_up{component="runner[1]",type="statusrunner"} 0`,
+		`eb_connector_lag{component="runner[1]",type="statusrunner"} 7`,
+		`eb_connector_last_message_timestamp_seconds{component="source",type="statustest"} 0`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(scrape(t), `type="statustest"`) {
+		t.Error("connector gauges not removed on close")
+	}
+}
+
+func TestMultiSourceStatuses(t *testing.T) {
+	a := &reportingSource{chanSource: newChanSource()}
+	a.SetState(connectors.StateConnected)
+	cfg := newTestConfig()
+	cfg.Source.Type = connectors.MultiSourceType
+	b := &EventsBridge{
+		cfg:    cfg,
+		logger: newTestLogger(),
+		source: &multiSource{items: []multiSourceItem{
+			{id: "plant-a", typ: "mqtt", source: a},
+			{id: "plant-b", typ: "mqtt", source: newChanSource()},
+		}},
+	}
+
+	statuses := b.ConnectorStatuses()
+	if len(statuses) != 1 || statuses[0].ID != "plant-a" || statuses[0].Type != "mqtt" {
+		t.Errorf("statuses = %+v, want the reporting source only", statuses)
+	}
+}
@@ -0,0 +1,293 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/config"
+)
+
+// defaultDrainTimeout is the time the old pipeline has to settle in-flight messages on switchover
+const defaultDrainTimeout = 30 * time.Second
+
+var (
+	// ErrSwitchoverInProgress is returned when a switchover is requested while another one is running
+	ErrSwitchoverInProgress = errors.New("switchover already in progress")
+	// ErrNoActivePipeline is returned when the active pipeline is required but not running
+	ErrNoActivePipeline = errors.New("no active pipeline")
+)
+
+// PipelineStatus describes a running pipeline
+type PipelineStatus struct {
+	Generation int       `json:"generation"`
+	StartedAt  time.Time `json:"startedAt"`
+	InFlight   int64     `json:"inFlight"`
+	Source     string    `json:"source"`
+	Runners    int       `json:"runners"`
+	// Latency holds the end-to-end latency percentiles when an SLO is configured
+	Latency *LatencySnapshot `json:"latency,omitempty"`
+	// Profile holds the most recent per-stage profiling report when profiling reports are enabled
+	Profile *StageProfile `json:"profile,omitempty"`
+	// WorkDir holds the temporary space usage when a work directory is configured
+	WorkDir *WorkDirUsage `json:"workDir,omitempty"`
+	// Stages holds the live activity of the pipeline stages
+	Stages []StageActivity `json:"stages,omitempty"`
+	// RecentErrors holds the most recent errors of the pipeline, oldest first
+	RecentErrors []ErrorRecord `json:"recentErrors,omitempty"`
+	// Connectors holds the statuses reported by the source and the runners
+	Connectors []ConnectorStatusItem `json:"connectors,omitempty"`
+	// Pause holds the pause state of the source consumption and the error rate of the safety valve
+	Pause *PauseStatus `json:"pause,omitempty"`
+	// Features are the optional features enabled by the configuration of the pipeline
+	Features []string `json:"features,omitempty"`
+}
+
+// SupervisorStatus describes the pipelines managed by the supervisor
+type SupervisorStatus struct {
+	Active      *PipelineStatus `json:"active"`
+	Draining    *PipelineStatus `json:"draining,omitempty"`
+	Switchovers int             `json:"switchovers"`
+}
+
+// pipeline is a running bridge instance managed by the supervisor
+type pipeline struct {
+	generation int
+	startedAt  time.Time
+	bridge     *EventsBridge
+	done       <-chan error
+}
+
+func (p *pipeline) status() *PipelineStatus {
+	if p == nil {
+		return nil
+	}
+	status := &PipelineStatus{
+		Generation: p.generation,
+		StartedAt:  p.startedAt,
+		InFlight:   p.bridge.InFlight(),
+		Source:     p.bridge.cfg.Source.Type,
+		Runners:    len(p.bridge.cfg.Runners),
+	}
+	if latency, ok := p.bridge.LatencySnapshot(); ok {
+		status.Latency = &latency
+	}
+	status.Profile = p.bridge.StageProfile()
+	status.WorkDir = p.bridge.workDir.usage()
+	status.Stages, status.RecentErrors = p.bridge.Activity()
+	status.Connectors = p.bridge.ConnectorStatuses()
+	status.Pause = p.bridge.PauseStatus()
+	status.Features = p.bridge.cfg.Features()
+	return status
+}
+
+// Supervisor runs the active bridge pipeline and performs blue/green switchovers:
+// a new pipeline is started alongside the active one, then the old one stops
+// accepting messages, drains its in-flight messages and is closed.
+// Sources that can be shared (consumer groups, queue groups) keep consuming
+// without interruption; exclusive sources (e.g. a listening port) make the
+// new pipeline fail to start, in which case the active one is kept.
+type Supervisor struct {
+	logger       *slog.Logger
+	drainTimeout time.Duration
+	newBridge    func(*config.Config, *slog.Logger) (*EventsBridge, error)
+
+	mu          sync.Mutex
+	switchMu    sync.Mutex
+	ctx         context.Context
+	active      *pipeline
+	draining    *pipeline
+	generation  int
+	switchovers int
+	errCh       chan error
+}
+
+// NewSupervisor creates a supervisor. A zero drain timeout uses the default of 30s.
+func NewSupervisor(logger *slog.Logger, drainTimeout time.Duration) *Supervisor {
+	if drainTimeout <= 0 {
+		drainTimeout = defaultDrainTimeout
+	}
+	return &Supervisor{
+		logger:       logger.With("component", "supervisor"),
+		drainTimeout: drainTimeout,
+		newBridge:    NewEventsBridge,
+		errCh:        make(chan error, 1),
+	}
+}
+
+// Start creates and starts the first pipeline
+func (s *Supervisor) Start(ctx context.Context, cfg *config.Config) error {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	p, err := s.startPipeline(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.active = p
+	s.mu.Unlock()
+	return nil
+}
+
+// startPipeline creates and starts a new bridge for the configuration
+func (s *Supervisor) startPipeline(cfg *config.Config) (*pipeline, error) {
+	s.mu.Lock()
+	ctx := s.ctx
+	s.generation++
+	generation := s.generation
+	s.mu.Unlock()
+
+	if ctx == nil {
+		return nil, fmt.Errorf("supervisor not started")
+	}
+
+	b, err := s.newBridge(cfg, s.logger.With("generation", generation))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bridge: %w", err)
+	}
+
+	done, err := b.Start(ctx)
+	if err != nil {
+		if closeErr := b.Close(); closeErr != nil {
+			s.logger.Error("failed to close bridge after start failure", "error", closeErr)
+		}
+		return nil, fmt.Errorf("failed to start bridge: %w", err)
+	}
+
+	p := &pipeline{generation: generation, startedAt: time.Now(), bridge: b, done: done}
+	go s.watch(p)
+	s.logger.Info("pipeline started", "generation", generation, "source", cfg.Source.Type)
+	return p, nil
+}
+
+// watch reports the failure of a pipeline that is still active
+func (s *Supervisor) watch(p *pipeline) {
+	err := <-p.done
+	s.mu.Lock()
+	active := s.active == p
+	s.mu.Unlock()
+	if !active || err == nil {
+		return
+	}
+	select {
+	case s.errCh <- err:
+	default:
+	}
+}
+
+// Switchover starts a pipeline for the new configuration alongside the active one,
+// then drains and closes the old pipeline. If the new pipeline cannot be started,
+// the active one is kept and the error is returned. The old pipeline is drained for
+// up to the drain timeout even if the caller gives up waiting (e.g. an HTTP client
+// disconnecting), so that its in-flight messages are not cut short.
+func (s *Supervisor) Switchover(_ context.Context, cfg *config.Config) (SupervisorStatus, error) {
+	if !s.switchMu.TryLock() {
+		return s.Status(), ErrSwitchoverInProgress
+	}
+	defer s.switchMu.Unlock()
+
+	next, err := s.startPipeline(cfg)
+	if err != nil {
+		return s.Status(), err
+	}
+
+	s.mu.Lock()
+	old := s.active
+	s.active = next
+	s.draining = old
+	s.switchovers++
+	s.mu.Unlock()
+
+	if old != nil {
+		s.logger.Info("draining previous pipeline", "generation", old.generation, "inFlight", old.bridge.InFlight())
+		drainCtx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+		drainErr := old.bridge.Drain(drainCtx)
+		cancel()
+		if drainErr != nil {
+			s.logger.Warn("previous pipeline not fully drained", "generation", old.generation, "error", drainErr)
+		}
+		if closeErr := old.bridge.Close(); closeErr != nil {
+			s.logger.Error("failed to close previous pipeline", "generation", old.generation, "error", closeErr)
+		}
+		s.mu.Lock()
+		s.draining = nil
+		s.mu.Unlock()
+		s.logger.Info("switchover completed", "from", old.generation, "to", next.generation)
+	}
+
+	return s.Status(), nil
+}
+
+// Status returns the state of the managed pipelines
+func (s *Supervisor) Status() SupervisorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SupervisorStatus{
+		Active:      s.active.status(),
+		Draining:    s.draining.status(),
+		Switchovers: s.switchovers,
+	}
+}
+
+// Pause stops the consumption of the source of the active pipeline until Resume is called
+func (s *Supervisor) Pause() (SupervisorStatus, error) {
+	s.mu.Lock()
+	p := s.active
+	s.mu.Unlock()
+	if p == nil {
+		return s.Status(), ErrNoActivePipeline
+	}
+	p.bridge.Pause()
+	return s.Status(), nil
+}
+
+// Resume resumes the consumption of the source of the active pipeline, paused manually or
+// by the safety valve
+func (s *Supervisor) Resume() (SupervisorStatus, error) {
+	s.mu.Lock()
+	p := s.active
+	s.mu.Unlock()
+	if p == nil {
+		return s.Status(), ErrNoActivePipeline
+	}
+	p.bridge.Resume()
+	return s.Status(), nil
+}
+
+// Wait blocks until the context is cancelled or the active pipeline fails,
+// returning the pipeline error.
+func (s *Supervisor) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-s.errCh:
+		return err
+	}
+}
+
+// Close drains and closes the active pipeline
+func (s *Supervisor) Close() error {
+	s.switchMu.Lock()
+	defer s.switchMu.Unlock()
+
+	s.mu.Lock()
+	p := s.active
+	s.active = nil
+	s.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+	if err := p.bridge.Drain(ctx); err != nil {
+		s.logger.Warn("pipeline not fully drained on close", "error", err)
+	}
+	return p.bridge.Close()
+}
@@ -0,0 +1,242 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// chanSource is a test source backed by a channel
+type chanSource struct {
+	c          chan *message.RunnerMessage
+	produceErr error
+	closed     atomic.Bool
+}
+
+func newChanSource() *chanSource {
+	return &chanSource{c: make(chan *message.RunnerMessage, 10)}
+}
+
+func (s *chanSource) Produce(int) (<-chan *message.RunnerMessage, error) {
+	if s.produceErr != nil {
+		return nil, s.produceErr
+	}
+	return s.c, nil
+}
+
+func (s *chanSource) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+// countingMessage is a source message counting acks and naks safely across goroutines
+type countingMessage struct {
+	*testutil.Adapter
+	acks atomic.Int32
+	naks atomic.Int32
+}
+
+func newCountingMessage(data string) *countingMessage {
+	return &countingMessage{Adapter: testutil.NewAdapter([]byte(data), nil)}
+}
+
+func (m *countingMessage) Ack(*message.ReplyData) error {
+	m.acks.Add(1)
+	return nil
+}
+
+func (m *countingMessage) Nak() error {
+	m.naks.Add(1)
+	return nil
+}
+
+// newTestSupervisor creates a supervisor building bridges around the given sources, in order
+func newTestSupervisor(t *testing.T, runners []connectors.Runner, sources ...*chanSource) *Supervisor {
+	t.Helper()
+	s := NewSupervisor(newTestLogger(), time.Second)
+	var n int
+	s.newBridge = func(cfg *config.Config, logger *slog.Logger) (*EventsBridge, error) {
+		if n >= len(sources) {
+			return nil, errors.New("no source available")
+		}
+		b := &EventsBridge{cfg: cfg, logger: logger, source: sources[n], valve: newSafetyValve(cfg.SafetyValve, cfg.Source.Type, logger)}
+		for i, r := range runners {
+			b.runners = append(b.runners, RunnerItem{Config: cfg.Runners[i], Runner: r})
+		}
+		n++
+		return b, nil
+	}
+	return s
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSupervisorSwitchover(t *testing.T) {
+	blue, green := newChanSource(), newChanSource()
+	s := newTestSupervisor(t, nil, blue, green)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := s.Start(ctx, newTestConfig()); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+
+	blueMsg := newCountingMessage("blue")
+	blue.c <- message.NewRunnerMessage(blueMsg)
+	waitFor(t, func() bool { return blueMsg.acks.Load() == 1 })
+
+	status, err := s.Switchover(ctx, newTestConfig())
+	if err != nil {
+		t.Fatalf("Switchover() unexpected error = %v", err)
+	}
+	if status.Active == nil || status.Active.Generation != 2 || status.Switchovers != 1 {
+		t.Errorf("unexpected status after switchover: %+v", status)
+	}
+	if !blue.closed.Load() {
+		t.Error("previous source was not closed")
+	}
+
+	greenMsg := newCountingMessage("green")
+	green.c <- message.NewRunnerMessage(greenMsg)
+	waitFor(t, func() bool { return greenMsg.acks.Load() == 1 })
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() unexpected error = %v", err)
+	}
+	if !green.closed.Load() {
+		t.Error("active source was not closed")
+	}
+}
+
+func TestSupervisorSwitchoverDrainsInFlight(t *testing.T) {
+	blue, green := newChanSource(), newChanSource()
+	release := make(chan struct{})
+	slow := &funcRunner{process: func(*message.RunnerMessage) error {
+		<-release
+		return nil
+	}}
+	s := newTestSupervisor(t, []connectors.Runner{slow}, blue, green)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Start(ctx, newTestConfig()); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+
+	pending := newCountingMessage("pending")
+	blue.c <- message.NewRunnerMessage(pending)
+	waitFor(t, func() bool { return s.Status().Active.InFlight == 1 })
+
+	// the caller giving up (e.g. the admin client disconnecting) must not cut the drain short
+	reqCtx, reqCancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Switchover(reqCtx, newTestConfig())
+		done <- err
+	}()
+
+	waitFor(t, func() bool { return s.Status().Draining != nil })
+	reqCancel()
+	time.Sleep(50 * time.Millisecond)
+	if blue.closed.Load() {
+		t.Error("source closed before in-flight messages were settled")
+	}
+	if _, err := s.Switchover(ctx, newTestConfig()); !errors.Is(err, ErrSwitchoverInProgress) {
+		t.Errorf("concurrent Switchover() error = %v, want %v", err, ErrSwitchoverInProgress)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Switchover() unexpected error = %v", err)
+	}
+	if n := pending.acks.Load(); n != 1 {
+		t.Errorf("in-flight message acked %d times, want 1", n)
+	}
+	if !blue.closed.Load() {
+		t.Error("previous source was not closed after draining")
+	}
+}
+
+func TestSupervisorSwitchoverStartFailure(t *testing.T) {
+	blue, green := newChanSource(), newChanSource()
+	green.produceErr = errors.New("address already in use")
+	s := newTestSupervisor(t, nil, blue, green)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Start(ctx, newTestConfig()); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+
+	status, err := s.Switchover(ctx, newTestConfig())
+	if err == nil {
+		t.Fatal("Switchover() expected error when the new pipeline fails to start")
+	}
+	if status.Active == nil || status.Active.Generation != 1 {
+		t.Errorf("active pipeline changed after failed switchover: %+v", status)
+	}
+	if blue.closed.Load() {
+		t.Error("active source closed after failed switchover")
+	}
+}
+
+func TestSupervisorWaitCancelled(t *testing.T) {
+	blue := newChanSource()
+	s := newTestSupervisor(t, nil, blue)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.Start(ctx, newTestConfig()); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+
+	// A source that stops producing is not a failure
+	close(blue.c)
+	cancel()
+	if err := s.Wait(ctx); err != nil {
+		t.Errorf("Wait() unexpected error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+}
+
+func TestDrainNaksNewMessages(t *testing.T) {
+	src := newChanSource()
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger(), source: src}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+
+	b.draining.Store(true)
+	rejected := newCountingMessage("late")
+	src.c <- message.NewRunnerMessage(rejected)
+	waitFor(t, func() bool { return rejected.naks.Load() == 1 })
+
+	if err := b.Drain(ctx); err != nil {
+		t.Fatalf("Drain() unexpected error = %v", err)
+	}
+	if b.InFlight() != 0 {
+		t.Errorf("InFlight() = %d, want 0", b.InFlight())
+	}
+}
@@ -0,0 +1,381 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	tenantUnknownBase   = "base"
+	tenantUnknownReject = "reject"
+
+	defaultTenantReloadInterval = 10 * time.Second
+)
+
+// Ensure tenantRunner implements connectors.LifecycleRunner
+var _ connectors.LifecycleRunner = (*tenantRunner)(nil)
+
+// tenantOverrides maps the tenant ids to the options of the chain runners, in runner order
+type tenantOverrides map[string][]map[string]any
+
+// tenantRunner runs a runner chain with the option overrides of the tenant of the message.
+// Every tenant with overrides gets its own instances of the chain runners, built on its first
+// message and replaced when its overrides change, so that state such as rate limits and
+// connections is not shared between tenants. The other messages share the base chain.
+type tenantRunner struct {
+	runners  []connectors.RunnerConfig
+	keyFrom  string
+	inline   tenantOverrides
+	file     string
+	interval time.Duration
+	unknown  string
+	build    func([]connectors.RunnerConfig) ([]branchStage, error)
+	base     *tenantChain
+	logger   *slog.Logger
+
+	mu        sync.Mutex
+	overrides tenantOverrides
+	chains    map[string]*tenantChain
+	fileData  []byte
+	ctx       context.Context
+	closed    bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// tenantChain is the runner chain of a tenant
+type tenantChain struct {
+	// mu is held for reading while processing a message and for writing while closing the chain
+	mu     sync.RWMutex
+	stages []branchStage
+	closed bool
+}
+
+// tenantRunnerConfig holds the options of the tenant runner
+type tenantRunnerConfig struct {
+	// KeyFrom is the metadata key holding the tenant id
+	KeyFrom string `mapstructure:"keyFrom" validate:"required"`
+	// Runners is the runner chain with the base options
+	Runners []connectors.RunnerConfig `mapstructure:"runners" validate:"required,min=1,dive"`
+	// Tenants maps the tenant ids to the options merged over the options of the chain runners,
+	// in runner order (an empty entry leaves the runner options unchanged)
+	Tenants tenantOverrides `mapstructure:"tenants"`
+	// File is a YAML or JSON file with more tenants in the same layout, reloaded when it changes.
+	// Its tenants replace the inline tenants with the same id.
+	File string `mapstructure:"file"`
+	// ReloadInterval is how often File is checked for changes (default: 10s)
+	ReloadInterval time.Duration `mapstructure:"reloadInterval" validate:"min=0"`
+	// Unknown handles the messages of tenants without overrides: "base" (default, run the chain
+	// with the base options) or "reject" (the message fails)
+	Unknown string `mapstructure:"unknown" validate:"omitempty,oneof=base reject"`
+}
+
+// createTenantRunner builds the base runner chain of a "tenant" runner configuration
+func (b *EventsBridge) createTenantRunner(runnerConfig connectors.RunnerConfig) (connectors.Runner, error) {
+	tc := new(tenantRunnerConfig)
+	if err := b.parseRunnerOptions(runnerConfig, tc); err != nil {
+		return nil, err
+	}
+
+	tr := &tenantRunner{
+		runners:  tc.Runners,
+		keyFrom:  tc.KeyFrom,
+		inline:   tc.Tenants,
+		file:     tc.File,
+		interval: tc.ReloadInterval,
+		unknown:  tc.Unknown,
+		build:    b.createStages,
+		logger:   b.logger.With("component", "tenant"),
+		chains:   map[string]*tenantChain{},
+		stop:     make(chan struct{}),
+	}
+	if tr.interval == 0 {
+		tr.interval = defaultTenantReloadInterval
+	}
+	if tr.unknown == "" {
+		tr.unknown = tenantUnknownBase
+	}
+	if err := tr.init(); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// init loads the overrides and builds the base chain
+func (r *tenantRunner) init() error {
+	if err := r.validate(r.inline); err != nil {
+		return err
+	}
+	r.overrides = r.inline
+	if r.file != "" {
+		if _, err := r.reload(); err != nil {
+			return err
+		}
+	}
+	stages, err := r.build(r.runners)
+	if err != nil {
+		return fmt.Errorf("tenant chain: %w", err)
+	}
+	r.base = &tenantChain{stages: stages}
+	return nil
+}
+
+// validate checks that the overrides don't address runners beyond the chain
+func (r *tenantRunner) validate(overrides tenantOverrides) error {
+	for tenant, options := range overrides {
+		if len(options) > len(r.runners) {
+			return fmt.Errorf("tenant %q has overrides for %d runners, the chain has %d", tenant, len(options), len(r.runners))
+		}
+	}
+	return nil
+}
+
+// Process runs the message through the chain of its tenant.
+// A filterExpr evaluating to false inside the chain skips the rest of the chain.
+func (r *tenantRunner) Process(msg *message.RunnerMessage) error {
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata: %w", err)
+	}
+	tenant := meta[r.keyFrom]
+
+	for {
+		chain, err := r.chain(tenant)
+		if err != nil {
+			return err
+		}
+		chain.mu.RLock()
+		if chain.closed {
+			// Replaced by a reload of the overrides in the meantime
+			chain.mu.RUnlock()
+			continue
+		}
+		_, _, err = runBranch(msg, chain.stages)
+		chain.mu.RUnlock()
+		if err != nil {
+			return fmt.Errorf("tenant %q chain: %w", tenant, err)
+		}
+		return nil
+	}
+}
+
+// chain returns the chain of the tenant, building it on the first message of the tenant
+func (r *tenantRunner) chain(tenant string) (*tenantChain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, fmt.Errorf("tenant runner closed")
+	}
+
+	options, ok := r.overrides[tenant]
+	if !ok || tenant == "" {
+		if r.unknown == tenantUnknownReject {
+			return nil, fmt.Errorf("unknown tenant %q", tenant)
+		}
+		return r.base, nil
+	}
+	if chain, ok := r.chains[tenant]; ok {
+		return chain, nil
+	}
+
+	stages, err := r.build(tenantRunners(r.runners, options))
+	if err != nil {
+		return nil, fmt.Errorf("tenant %q chain: %w", tenant, err)
+	}
+	chain := &tenantChain{stages: stages}
+	if r.ctx != nil {
+		// Chains built after the pipeline start get their Start hooks now
+		if err := startStages(r.ctx, stages); err != nil {
+			closeStages(stages) //nolint:errcheck
+			return nil, fmt.Errorf("tenant %q chain: %w", tenant, err)
+		}
+	}
+	r.logger.Debug("tenant chain created", "tenant", tenant)
+	r.chains[tenant] = chain
+	return chain, nil
+}
+
+// tenantRunners merges the tenant options over the options of the chain runners
+func tenantRunners(runners []connectors.RunnerConfig, options []map[string]any) []connectors.RunnerConfig {
+	res := slices.Clone(runners)
+	for i, opts := range options {
+		if len(opts) == 0 {
+			continue
+		}
+		merged, _ := config.MergeOptions(res[i].Options, opts).(map[string]any)
+		res[i].Options = merged
+	}
+	return res
+}
+
+// reload reads the overrides file and replaces the chains of the tenants whose
+// overrides changed. It reports whether the file changed.
+func (r *tenantRunner) reload() (bool, error) {
+	data, err := os.ReadFile(r.file)
+	if err != nil {
+		return false, fmt.Errorf("failed to read tenants file: %w", err)
+	}
+	r.mu.Lock()
+	unchanged := r.fileData != nil && bytes.Equal(data, r.fileData)
+	r.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	var fromFile tenantOverrides
+	if err := yaml.Unmarshal(data, &fromFile); err != nil {
+		return false, fmt.Errorf("failed to parse tenants file: %w", err)
+	}
+	if err := r.validate(fromFile); err != nil {
+		return false, fmt.Errorf("invalid tenants file: %w", err)
+	}
+	overrides := maps.Clone(r.inline)
+	if overrides == nil {
+		overrides = tenantOverrides{}
+	}
+	maps.Copy(overrides, fromFile)
+
+	r.mu.Lock()
+	var stale []*tenantChain
+	for tenant, chain := range r.chains {
+		if !reflect.DeepEqual(r.overrides[tenant], overrides[tenant]) {
+			stale = append(stale, chain)
+			delete(r.chains, tenant)
+		}
+	}
+	r.overrides = overrides
+	r.fileData = data
+	r.mu.Unlock()
+
+	// The in-flight messages of the replaced chains complete before they are closed
+	for _, chain := range stale {
+		if err := chain.close(context.Background()); err != nil {
+			r.logger.Warn("failed to close replaced tenant chain", "error", err)
+		}
+	}
+	r.logger.Info("tenant overrides loaded", "file", r.file, "tenants", len(overrides), "replaced", len(stale))
+	return true, nil
+}
+
+// reloadLoop checks the overrides file for changes until the runner is closed
+func (r *tenantRunner) reloadLoop(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// On failure the previous overrides stay in use
+			if _, err := r.reload(); err != nil {
+				r.logger.Error("tenant overrides reload failed", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// close drains and closes the runners of the chain once its in-flight messages complete
+func (c *tenantChain) close(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return errors.Join(drainStages(ctx, c.stages), closeStages(c.stages))
+}
+
+// startStages calls the Start hook of the chain runners implementing connectors.LifecycleRunner
+func startStages(ctx context.Context, stages []branchStage) error {
+	for j, stage := range stages {
+		if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+			if err := lr.Start(ctx); err != nil {
+				return fmt.Errorf("failed to start runner %d: %w", j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// drainStages calls the Drain hook of the chain runners implementing connectors.LifecycleRunner
+func drainStages(ctx context.Context, stages []branchStage) error {
+	var errs []error
+	for j, stage := range stages {
+		if lr, ok := stage.runner.(connectors.LifecycleRunner); ok {
+			if err := lr.Drain(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("failed to drain runner %d: %w", j, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Start calls the Start hook of the base chain and starts watching the overrides file.
+// The chains of the tenants are started when they are built.
+func (r *tenantRunner) Start(ctx context.Context) error {
+	if err := startStages(ctx, r.base.stages); err != nil {
+		return fmt.Errorf("tenant chain: %w", err)
+	}
+	r.mu.Lock()
+	r.ctx = ctx
+	r.mu.Unlock()
+	if r.file != "" {
+		r.wg.Add(1)
+		go r.reloadLoop(ctx)
+	}
+	return nil
+}
+
+// Drain calls the Drain hook of the runners of every chain
+func (r *tenantRunner) Drain(ctx context.Context) error {
+	r.mu.Lock()
+	chains := slices.Collect(maps.Values(r.chains))
+	r.mu.Unlock()
+
+	errs := []error{drainStages(ctx, r.base.stages)}
+	for _, chain := range chains {
+		errs = append(errs, drainStages(ctx, chain.stages))
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops watching the overrides file and closes the runners of every chain
+func (r *tenantRunner) Close() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	r.wg.Wait()
+
+	r.mu.Lock()
+	r.closed = true
+	chains := slices.Collect(maps.Values(r.chains))
+	r.chains = map[string]*tenantChain{}
+	r.mu.Unlock()
+
+	errs := []error{closeStages(r.base.stages)}
+	for _, chain := range chains {
+		chain.mu.Lock()
+		chain.closed = true
+		errs = append(errs, closeStages(chain.stages))
+		chain.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,250 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// tenantBuilds records the runners built by a tenant runner; every runner sets its
+// "topic" and "llm.prompt" options and its instance number in metadata
+type tenantBuilds struct {
+	mu      sync.Mutex
+	runners []*funcRunner
+}
+
+func (b *tenantBuilds) build(cfgs []connectors.RunnerConfig) ([]branchStage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stages := make([]branchStage, len(cfgs))
+	for i, cfg := range cfgs {
+		instance := strconv.Itoa(len(b.runners))
+		r := &funcRunner{process: func(msg *message.RunnerMessage) error {
+			msg.AddMetadata("topic", fmt.Sprint(cfg.Options["topic"]))
+			if nested, ok := cfg.Options["llm"].(map[string]any); ok {
+				msg.AddMetadata("prompt", fmt.Sprint(nested["prompt"]))
+			}
+			msg.AddMetadata("instance", instance)
+			return nil
+		}}
+		b.runners = append(b.runners, r)
+		stages[i] = branchStage{cfg: cfg, runner: r}
+	}
+	return stages, nil
+}
+
+func (b *tenantBuilds) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.runners)
+}
+
+func newTestTenantRunner(t *testing.T, tenants tenantOverrides, file string) (*tenantRunner, *tenantBuilds) {
+	t.Helper()
+	builds := &tenantBuilds{}
+	r := &tenantRunner{
+		runners: []connectors.RunnerConfig{{
+			Type:    "test",
+			Options: map[string]any{"topic": "events", "llm": map[string]any{"prompt": "base", "model": "m1"}},
+		}},
+		keyFrom:  "tenant",
+		inline:   tenants,
+		file:     file,
+		interval: defaultTenantReloadInterval,
+		unknown:  tenantUnknownBase,
+		build:    builds.build,
+		logger:   newTestLogger(),
+		chains:   map[string]*tenantChain{},
+		stop:     make(chan struct{}),
+	}
+	if err := r.init(); err != nil {
+		t.Fatalf("init() unexpected error = %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r, builds
+}
+
+func processTenant(t *testing.T, r *tenantRunner, tenant string) map[string]string {
+	t.Helper()
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("in"), map[string]string{"tenant": tenant}))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process(%q) unexpected error = %v", tenant, err)
+	}
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return meta
+}
+
+func TestTenantRunnerOverrides(t *testing.T) {
+	r, builds := newTestTenantRunner(t, tenantOverrides{
+		"acme":   {{"topic": "acme-events", "llm": map[string]any{"prompt": "acme prompt"}}},
+		"globex": {{}},
+	}, "")
+
+	meta := processTenant(t, r, "acme")
+	if meta["topic"] != "acme-events" || meta["prompt"] != "acme prompt" {
+		t.Errorf("acme metadata = %v", meta)
+	}
+	// Nested options are merged key by key
+	if opts := r.chains["acme"].stages[0].cfg.Options["llm"].(map[string]any); opts["model"] != "m1" {
+		t.Errorf("merged options = %v", opts)
+	}
+	acme := meta["instance"]
+
+	// Tenants without overrides share the base chain, tenants with empty overrides get their own instances
+	if meta := processTenant(t, r, "initech"); meta["topic"] != "events" || meta["prompt"] != "base" || meta["instance"] != "0" {
+		t.Errorf("unknown tenant metadata = %v", meta)
+	}
+	globex := processTenant(t, r, "globex")
+	if globex["topic"] != "events" || globex["instance"] == "0" || globex["instance"] == acme {
+		t.Errorf("globex metadata = %v", globex)
+	}
+
+	// Chains are built once per tenant
+	if meta := processTenant(t, r, "acme"); meta["instance"] != acme {
+		t.Errorf("acme instance = %s, want %s", meta["instance"], acme)
+	}
+	if n := builds.count(); n != 3 {
+		t.Errorf("built runners = %d, want 3", n)
+	}
+}
+
+func TestTenantRunnerUnknownReject(t *testing.T) {
+	r, _ := newTestTenantRunner(t, tenantOverrides{"acme": {{"topic": "acme-events"}}}, "")
+	r.unknown = tenantUnknownReject
+
+	processTenant(t, r, "acme")
+	for _, tenant := range []string{"initech", ""} {
+		msg := message.NewRunnerMessage(testutil.NewAdapter(nil, map[string]string{"tenant": tenant}))
+		if err := r.Process(msg); err == nil || !strings.Contains(err.Error(), "unknown tenant") {
+			t.Errorf("Process(%q) error = %v, want unknown tenant", tenant, err)
+		}
+	}
+}
+
+func TestTenantRunnerFileReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tenants.yaml")
+	writeTestFile(t, file, "acme:\n  - topic: acme-v1\nglobex:\n  - topic: globex-v1\n")
+	r, builds := newTestTenantRunner(t, tenantOverrides{
+		"acme":    {{"topic": "inline"}},
+		"initech": {{"topic": "initech-events"}},
+	}, file)
+
+	// The file replaces the inline tenants with the same id
+	if meta := processTenant(t, r, "acme"); meta["topic"] != "acme-v1" {
+		t.Errorf("acme topic = %s, want acme-v1", meta["topic"])
+	}
+	if meta := processTenant(t, r, "initech"); meta["topic"] != "initech-events" {
+		t.Errorf("initech topic = %s", meta["topic"])
+	}
+	globex := processTenant(t, r, "globex")
+	acmeChain := r.chains["acme"]
+
+	if changed, err := r.reload(); err != nil || changed {
+		t.Errorf("reload() of an unchanged file = %v, %v", changed, err)
+	}
+
+	writeTestFile(t, file, "acme:\n  - topic: acme-v2\nglobex:\n  - topic: globex-v1\n")
+	if changed, err := r.reload(); err != nil || !changed {
+		t.Fatalf("reload() = %v, %v", changed, err)
+	}
+	if !acmeChain.closed || !acmeChain.stages[0].runner.(*funcRunner).closed {
+		t.Error("replaced acme chain not closed")
+	}
+	if meta := processTenant(t, r, "acme"); meta["topic"] != "acme-v2" {
+		t.Errorf("acme topic after reload = %s, want acme-v2", meta["topic"])
+	}
+	// Unchanged tenants keep their chain
+	if meta := processTenant(t, r, "globex"); meta["instance"] != globex["instance"] {
+		t.Errorf("globex instance = %s, want %s", meta["instance"], globex["instance"])
+	}
+
+	// Invalid files keep the previous overrides
+	writeTestFile(t, file, "acme: [{topic: a}, {topic: b}]\n")
+	if _, err := r.reload(); err == nil {
+		t.Error("reload() expected error for overrides beyond the chain")
+	}
+	writeTestFile(t, file, "acme: {")
+	if _, err := r.reload(); err == nil {
+		t.Error("reload() expected error for invalid YAML")
+	}
+	if meta := processTenant(t, r, "acme"); meta["topic"] != "acme-v2" {
+		t.Errorf("acme topic after failed reload = %s, want acme-v2", meta["topic"])
+	}
+
+	// Removed tenants fall back to the base chain
+	writeTestFile(t, file, "{}")
+	if _, err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if meta := processTenant(t, r, "globex"); meta["topic"] != "events" {
+		t.Errorf("removed tenant topic = %s, want events", meta["topic"])
+	}
+	if n := builds.count(); n != 5 {
+		t.Errorf("built runners = %d, want 5", n)
+	}
+}
+
+func TestTenantRunnerLifecycle(t *testing.T) {
+	r, _ := newTestTenantRunner(t, tenantOverrides{"acme": {{"topic": "acme-events"}}}, "")
+	runners, calls := newLifecycleRunners("base", "acme")
+	r.base.stages[0].runner = runners[0]
+	r.build = func([]connectors.RunnerConfig) ([]branchStage, error) {
+		return []branchStage{{runner: runners[1]}}, nil
+	}
+
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	// Chains built after the start are started before their first message
+	processTenant(t, r, "acme")
+	if err := r.Drain(ctx); err != nil {
+		t.Fatalf("Drain() unexpected error = %v", err)
+	}
+	if got := strings.Join(calls(), ","); got != "base:start,acme:start,base:drain,acme:drain" {
+		t.Errorf("calls = %s", got)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	msg := message.NewRunnerMessage(testutil.NewAdapter(nil, map[string]string{"tenant": "acme"}))
+	if err := r.Process(msg); err == nil {
+		t.Error("Process() expected error after Close")
+	}
+}
+
+func TestCreateTenantRunnerInvalid(t *testing.T) {
+	bridge := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger()}
+	chain := []any{map[string]any{"type": "pass"}}
+	for _, opts := range []map[string]any{
+		nil,
+		{"keyFrom": "tenant"},
+		{"runners": chain},
+		{"keyFrom": "tenant", "runners": chain, "tenants": map[string]any{"acme": []any{map[string]any{}, map[string]any{}}}},
+		{"keyFrom": "tenant", "runners": chain, "file": filepath.Join(t.TempDir(), "missing.yaml")},
+	} {
+		if _, err := bridge.createRunner(connectors.RunnerConfig{Type: "tenant", Options: opts}); err == nil {
+			t.Errorf("createRunner(%+v) expected error", opts)
+		}
+	}
+
+	r, err := bridge.createRunner(connectors.RunnerConfig{Type: "tenant", Options: map[string]any{"keyFrom": "tenant", "runners": chain}})
+	if err != nil {
+		t.Fatalf("createRunner() unexpected error = %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package bridge
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/destel/rill"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"golang.org/x/time/rate"
+)
+
+const (
+	throttleBlock = "block"
+	throttleDrop  = "drop"
+
+	defaultThrottleMaxKeys = 10000
+)
+
+// errThrottled reports a message over the rate of a drop or nak throttle
+var errThrottled = errors.New("throttle rate exceeded")
+
+// throttleEntry is the limiter of a throttling key
+type throttleEntry struct {
+	key     string
+	limiter *rate.Limiter
+}
+
+// throttle caps the rate of the messages handed to a runner. With a key, every key has
+// its own limiter; the limiters are kept in use order and the least recently used are
+// forgotten when full, their key starting again with a full burst.
+type throttle struct {
+	cfg   connectors.ThrottleConfig
+	mu    sync.Mutex
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+func newThrottle(cfg connectors.ThrottleConfig) *throttle {
+	if cfg.Burst == 0 {
+		cfg.Burst = 1
+	}
+	if cfg.MaxKeys == 0 {
+		cfg.MaxKeys = defaultThrottleMaxKeys
+	}
+	if cfg.Overflow == "" {
+		cfg.Overflow = throttleBlock
+	}
+	return &throttle{
+		cfg:   cfg,
+		order: list.New(),
+		keys:  map[string]*list.Element{},
+	}
+}
+
+// limiter returns the limiter of the key of the message
+func (t *throttle) limiter(msg *message.RunnerMessage) (*rate.Limiter, error) {
+	key := ""
+	if t.cfg.KeyFrom != "" {
+		meta, err := msg.GetMetadata()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get metadata: %w", err)
+		}
+		key = meta[t.cfg.KeyFrom]
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if elem, ok := t.keys[key]; ok {
+		t.order.MoveToBack(elem)
+		return elem.Value.(*throttleEntry).limiter, nil //nolint:forcetypeassert // only entries are stored
+	}
+	for t.order.Len() >= t.cfg.MaxKeys {
+		oldest := t.order.Front()
+		t.order.Remove(oldest)
+		delete(t.keys, oldest.Value.(*throttleEntry).key) //nolint:forcetypeassert // only entries are stored
+	}
+	entry := &throttleEntry{key: key, limiter: rate.NewLimiter(rate.Limit(t.cfg.Rate), t.cfg.Burst)}
+	t.keys[key] = t.order.PushBack(entry)
+	return entry.limiter, nil
+}
+
+// admit returns once the message can be handed to the runner. With the block overflow it
+// waits for the turn of the message, reporting whether it was delayed; otherwise a message
+// over the rate is rejected with errThrottled.
+func (t *throttle) admit(ctx context.Context, msg *message.RunnerMessage) (bool, error) {
+	limiter, err := t.limiter(msg)
+	if err != nil {
+		return false, err
+	}
+	if t.cfg.Overflow != throttleBlock {
+		if !limiter.Allow() {
+			return false, errThrottled
+		}
+		return false, nil
+	}
+
+	res := limiter.Reserve()
+	delay := res.Delay()
+	if delay == 0 {
+		return false, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-ctx.Done():
+		res.Cancel()
+		return true, ctx.Err()
+	}
+}
+
+// throttleMessages applies the throttle to the stream, before the messages are handed to a runner
+func (b *EventsBridge) throttleMessages(ctx context.Context, stream rill.Stream[*message.RunnerMessage], routines int, stage string, cfg connectors.RunnerConfig) rill.Stream[*message.RunnerMessage] {
+	t := newThrottle(*cfg.Throttle)
+	return rill.OrderedFilterMap(stream, routines, func(msg *message.RunnerMessage) (*message.RunnerMessage, bool, error) {
+		delayed, err := t.admit(ctx, msg)
+		if delayed || errors.Is(err, errThrottled) {
+			runnerThrottled.With(stage, cfg.Type, t.cfg.Overflow).Inc()
+		}
+		switch {
+		case err == nil:
+			return msg, true, nil
+		case errors.Is(err, errThrottled) && t.cfg.Overflow == throttleDrop:
+			b.HandleSuccess(msg, "message dropped by throttle", "runner", cfg.Type)
+			return nil, false, nil
+		default:
+			return b.HandleRunnerError(msg, err, "message rejected by throttle", "runner", cfg.Type)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func newKeyedMessage(key string) *message.RunnerMessage {
+	return message.NewRunnerMessage(testutil.NewAdapter([]byte("x"), map[string]string{"tenant": key}))
+}
+
+func TestThrottleKeys(t *testing.T) {
+	th := newThrottle(connectors.ThrottleConfig{Rate: 0.001, Burst: 2, KeyFrom: "tenant", MaxKeys: 2, Overflow: "nak"})
+	ctx := context.Background()
+
+	for i, tc := range []struct {
+		key  string
+		want error
+	}{
+		{"a", nil}, {"a", nil}, {"a", errThrottled}, // burst of a exhausted
+		{"b", nil}, {"", nil}, // own limiters, a evicted
+		{"a", nil}, // a forgotten, starting with a full burst
+	} {
+		if _, err := th.admit(ctx, newKeyedMessage(tc.key)); !errors.Is(err, tc.want) {
+			t.Errorf("message %d (%q): admit() error = %v, want %v", i, tc.key, err, tc.want)
+		}
+	}
+	if len(th.keys) != 2 {
+		t.Errorf("tracked keys = %d, want 2", len(th.keys))
+	}
+}
+
+func TestThrottleBlock(t *testing.T) {
+	th := newThrottle(connectors.ThrottleConfig{Rate: 20})
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := range 3 {
+		delayed, err := th.admit(ctx, newKeyedMessage(""))
+		if err != nil || delayed != (i > 0) {
+			t.Fatalf("message %d: admit() = %v, %v", i, delayed, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 messages admitted in %v at 20/s", elapsed)
+	}
+
+	// The wait is interrupted with the pipeline
+	slow := newThrottle(connectors.ThrottleConfig{Rate: 0.001})
+	if _, err := slow.admit(ctx, newKeyedMessage("")); err != nil {
+		t.Fatal(err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := slow.admit(cancelled, newKeyedMessage("")); !errors.Is(err, context.Canceled) {
+		t.Errorf("admit() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestThrottlePipeline(t *testing.T) {
+	for _, tc := range []struct {
+		overflow   string
+		acks, naks int32
+	}{
+		{"drop", 2, 0},
+		{"nak", 1, 1},
+	} {
+		t.Run(tc.overflow, func(t *testing.T) {
+			src := newChanSource()
+			runner := &recordingRunner{}
+			b := &EventsBridge{
+				cfg:      newTestConfig(),
+				logger:   newTestLogger(),
+				source:   src,
+				activity: newActivityTracker(),
+				runners: []RunnerItem{{
+					Config: connectors.RunnerConfig{Type: "test", Throttle: &connectors.ThrottleConfig{Rate: 0.001, Overflow: tc.overflow}},
+					Runner: runner,
+				}},
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if _, err := b.Start(ctx); err != nil {
+				t.Fatalf("Start() unexpected error = %v", err)
+			}
+
+			first, second := newCountingMessage("1"), newCountingMessage("2")
+			src.c <- message.NewRunnerMessage(first)
+			src.c <- message.NewRunnerMessage(second)
+			waitFor(t, func() bool {
+				return first.acks.Load()+second.acks.Load() == tc.acks && first.naks.Load()+second.naks.Load() == tc.naks
+			})
+			if runner.processed() != 1 {
+				t.Errorf("processed = %d, want 1", runner.processed())
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package bridge
+
+import (
+	"errors"
+	"maps"
+
+	"github.com/sandrolain/events-bridge/src/common/tracing"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// errNaked marks the span of a message naked back to the source
+var errNaked = errors.New("message naked")
+
+// traceMessage starts the span of a message received from the source, continuing the
+// trace of its "traceparent" metadata. It returns nil when tracing is disabled.
+func traceMessage(msg *message.RunnerMessage, source string) *tracing.Span {
+	if !tracing.Enabled() {
+		return nil
+	}
+	var parent tracing.SpanContext
+	if meta, err := msg.GetMetadata(); err == nil {
+		parent, _ = tracing.Extract(meta)
+	}
+	span := tracing.Start("message "+source, parent, tracing.KindConsumer)
+	span.SetAttribute("eb.source", source)
+	if id := msg.GetID(); len(id) > 0 {
+		span.SetAttribute("eb.message.id", string(id))
+	}
+	return span
+}
+
+// traceRunner starts the span of a runner processing the message, child of the message
+// span, and sets its context as the "traceparent" metadata so that the targets forwarding
+// the metadata as headers carry the trace downstream. It returns nil for the messages
+// not traced.
+func traceRunner(msg *message.RunnerMessage, stage, runnerType string) *tracing.Span {
+	parent := msg.GetTraceContext()
+	if !parent.IsValid() {
+		return nil
+	}
+	span := tracing.Start(stage+" "+runnerType, parent, tracing.KindInternal)
+	if span == nil {
+		return nil
+	}
+	span.SetAttribute("eb.stage", stage)
+	span.SetAttribute("eb.runner.type", runnerType)
+
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		return span
+	}
+	out := maps.Clone(meta)
+	if out == nil {
+		out = make(map[string]string)
+	}
+	tracing.Inject(out, span.Context())
+	msg.SetMetadata(out)
+	return span
+}
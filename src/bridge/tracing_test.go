@@ -0,0 +1,189 @@
+package bridge
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/common/tracing"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// exportedSpan is the part of the OTLP spans checked by the tests, with hex ids
+type exportedSpan struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Status       struct {
+		Code int
+	}
+}
+
+// startTestTracer sets a process-wide tracer exporting to a test collector; the returned
+// function stops it and returns the exported spans by name
+func startTestTracer(t *testing.T) func() map[string][]exportedSpan {
+	t.Helper()
+	var mu sync.Mutex
+	spans := map[string][]exportedSpan{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := new(coltracepb.ExportTraceServiceRequest)
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Errorf("invalid export request: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					span := exportedSpan{
+						TraceID:      hex.EncodeToString(s.TraceId),
+						SpanID:       hex.EncodeToString(s.SpanId),
+						ParentSpanID: hex.EncodeToString(s.ParentSpanId),
+						Name:         s.Name,
+					}
+					span.Status.Code = int(s.Status.GetCode())
+					spans[s.Name] = append(spans[s.Name], span)
+				}
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	tracer, err := tracing.New(tracing.Config{Endpoint: srv.URL + "/v1/traces", SampleRatio: 1}, newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracing.SetDefault(tracer)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tracer.Run(ctx)
+	}()
+	return func() map[string][]exportedSpan {
+		tracing.SetDefault(nil)
+		cancel()
+		<-done
+		mu.Lock()
+		defer mu.Unlock()
+		return spans
+	}
+}
+
+func TestBridgeTracing(t *testing.T) {
+	stop := startTestTracer(t)
+
+	cfg := newTestConfig()
+	cfg.Source.Type = "tracingtest"
+	src := newChanSource()
+	var seen sync.Map
+	b := &EventsBridge{
+		cfg:      cfg,
+		logger:   newTestLogger(),
+		source:   src,
+		activity: newActivityTracker(),
+		runners: []RunnerItem{
+			{
+				Config: connectors.RunnerConfig{Type: "first"},
+				Runner: &funcRunner{process: func(msg *message.RunnerMessage) error {
+					data, _ := msg.GetData()
+					meta, _ := msg.GetMetadata()
+					seen.Store(string(data), meta[tracing.TraceparentKey])
+					return nil
+				}},
+			},
+			{
+				Config: connectors.RunnerConfig{Type: "second"},
+				Runner: &funcRunner{process: func(msg *message.RunnerMessage) error {
+					if data, _ := msg.GetData(); string(data) == "bad" {
+						return errors.New("boom")
+					}
+					return nil
+				}},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	const upstream = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ok := &countingMessage{Adapter: testutil.NewAdapter([]byte("ok"), map[string]string{"Traceparent": upstream})}
+	bad := newCountingMessage("bad")
+	src.c <- message.NewRunnerMessage(ok)
+	src.c <- message.NewRunnerMessage(bad)
+	waitFor(t, func() bool { return ok.acks.Load() == 1 && bad.naks.Load() == 1 })
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := stop()
+	messages := spans["message tracingtest"]
+	firsts := spans["runner[0] first"]
+	seconds := spans["runner[1] second"]
+	if len(messages) != 2 || len(firsts) != 2 || len(seconds) != 2 {
+		t.Fatalf("spans = %v", spans)
+	}
+
+	byTrace := map[string]exportedSpan{}
+	for _, s := range messages {
+		byTrace[s.TraceID] = s
+	}
+	// The message with an upstream trace context continues its trace
+	continued, found := byTrace["4bf92f3577b34da6a3ce929d0e0e4736"]
+	if !found || continued.ParentSpanID != "00f067aa0ba902b7" || continued.Status.Code != 0 {
+		t.Errorf("continued message span = %+v", continued)
+	}
+
+	// The runner spans are children of their message span, and the runners see their own
+	// span as traceparent
+	for _, s := range append(firsts, seconds...) {
+		parent, found := byTrace[s.TraceID]
+		if !found || s.ParentSpanID != parent.SpanID {
+			t.Errorf("runner span %+v is not a child of a message span", s)
+		}
+	}
+	for _, s := range firsts {
+		data := "bad"
+		if s.TraceID == continued.TraceID {
+			data = "ok"
+		}
+		if got, _ := seen.Load(data); got != "00-"+s.TraceID+"-"+s.SpanID+"-01" {
+			t.Errorf("runner saw traceparent %v for span %+v", got, s)
+		}
+	}
+
+	// The failure marks the runner and the naked message spans
+	for _, s := range seconds {
+		failed := s.TraceID != continued.TraceID
+		if (s.Status.Code == 2) != failed || (byTrace[s.TraceID].Status.Code == 2) != failed {
+			t.Errorf("span %+v of message %+v: failed = %v", s, byTrace[s.TraceID], failed)
+		}
+	}
+}
+
+func TestBridgeTracingDisabled(t *testing.T) {
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("d"), map[string]string{"k": "v"}))
+	if span := traceMessage(msg, "src"); span != nil {
+		t.Error("message traced without a tracer")
+	}
+	if span := traceRunner(msg, "runner[0]", "t"); span != nil {
+		t.Error("runner traced without a trace context")
+	}
+	if meta, _ := msg.GetMetadata(); len(meta) != 1 {
+		t.Errorf("metadata = %v", meta)
+	}
+}
@@ -0,0 +1,205 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/config"
+)
+
+const (
+	// workDirPrefix is the name prefix of the pipeline directories, followed by the process id
+	workDirPrefix = "pipeline-"
+	// defaultWorkDirCheckInterval is how often the usage is measured when not configured
+	defaultWorkDirCheckInterval = 10 * time.Second
+)
+
+// errWorkDirQuota rejects the messages while the work directory exceeds its quota
+var errWorkDirQuota = errors.New("work directory quota exceeded")
+
+// originalTempDir is the temporary directory of the process before the first pipeline set its own
+var originalTempDir = sync.OnceValues(func() (string, bool) {
+	return os.LookupEnv(tempDirEnv)
+})
+
+// WorkDirUsage is the temporary space used by a pipeline
+type WorkDirUsage struct {
+	Path      string    `json:"path"`
+	Bytes     int64     `json:"bytes"`
+	MaxSize   int64     `json:"maxSize,omitempty"`
+	Exceeded  bool      `json:"exceeded"`
+	CheckedAt time.Time `json:"checkedAt,omitzero"`
+}
+
+// workDir is the working directory of a pipeline
+type workDir struct {
+	path     string
+	maxSize  int64
+	interval time.Duration
+	logger   *slog.Logger
+
+	bytes     atomic.Int64
+	exceeded  atomic.Bool
+	checkedAt atomic.Int64
+}
+
+// newWorkDir removes the directories left by terminated processes under the configured path,
+// then creates the pipeline directory and sets it as the temporary directory of the process
+func newWorkDir(cfg config.WorkDirConfig, logger *slog.Logger) (*workDir, error) {
+	if err := os.MkdirAll(cfg.Path, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create work directory: %w", err)
+	}
+	logger = logger.With("component", "workdir")
+	cleanOrphanWorkDirs(cfg.Path, logger)
+
+	path, err := os.MkdirTemp(cfg.Path, workDirPrefix+strconv.Itoa(os.Getpid())+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipeline work directory: %w", err)
+	}
+	originalTempDir()
+	if err := os.Setenv(tempDirEnv, path); err != nil {
+		os.RemoveAll(path) //nolint:errcheck
+		return nil, fmt.Errorf("failed to set the temporary directory: %w", err)
+	}
+
+	w := &workDir{path: path, maxSize: cfg.MaxSize, interval: cfg.CheckInterval, logger: logger}
+	if w.interval == 0 {
+		w.interval = defaultWorkDirCheckInterval
+	}
+	logger.Info("pipeline work directory created", "path", path, "maxSize", cfg.MaxSize)
+	return w, nil
+}
+
+// cleanOrphanWorkDirs removes the pipeline directories of the processes no longer running
+func cleanOrphanWorkDirs(parent string, logger *slog.Logger) {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		logger.Warn("failed to list work directories", "path", parent, "error", err)
+		return
+	}
+	for _, entry := range entries {
+		pidPart, ok := strings.CutPrefix(entry.Name(), workDirPrefix)
+		if !entry.IsDir() || !ok {
+			continue
+		}
+		pidPart, _, _ = strings.Cut(pidPart, "-")
+		pid, err := strconv.Atoi(pidPart)
+		if err != nil || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		path := filepath.Join(parent, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			logger.Warn("failed to remove orphaned work directory", "path", path, "error", err)
+			continue
+		}
+		logger.Info("orphaned work directory removed", "path", path, "pid", pid)
+	}
+}
+
+// Run measures the directory usage on every interval until the context is cancelled
+func (w *workDir) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.measure()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// measure updates the usage and the quota state, logging the quota transitions
+func (w *workDir) measure() {
+	var size int64
+	err := filepath.WalkDir(w.path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files removed during the walk are not counted
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		w.logger.Warn("failed to measure work directory usage", "path", w.path, "error", err)
+		return
+	}
+	w.bytes.Store(size)
+	w.checkedAt.Store(time.Now().UnixNano())
+
+	exceeded := w.maxSize > 0 && size > w.maxSize
+	if w.exceeded.Swap(exceeded) != exceeded {
+		if exceeded {
+			w.logger.Warn("work directory quota exceeded, rejecting new messages", "bytes", size, "maxSize", w.maxSize)
+		} else {
+			w.logger.Info("work directory usage back under quota", "bytes", size, "maxSize", w.maxSize)
+		}
+	}
+}
+
+// overQuota reports whether the directory exceeded its quota at the last measure
+func (w *workDir) overQuota() bool {
+	return w != nil && w.exceeded.Load()
+}
+
+// usage returns the usage measured last
+func (w *workDir) usage() *WorkDirUsage {
+	if w == nil {
+		return nil
+	}
+	u := &WorkDirUsage{
+		Path:     w.path,
+		Bytes:    w.bytes.Load(),
+		MaxSize:  w.maxSize,
+		Exceeded: w.exceeded.Load(),
+	}
+	if at := w.checkedAt.Load(); at > 0 {
+		u.CheckedAt = time.Unix(0, at)
+	}
+	return u
+}
+
+// close removes the directory and restores the original temporary directory,
+// unless another pipeline has set its own meanwhile
+func (w *workDir) close() error {
+	if os.Getenv(tempDirEnv) == w.path {
+		var err error
+		if original, ok := originalTempDir(); ok {
+			err = os.Setenv(tempDirEnv, original)
+		} else {
+			err = os.Unsetenv(tempDirEnv)
+		}
+		if err != nil {
+			w.logger.Warn("failed to restore the temporary directory", "error", err)
+		}
+	}
+	return os.RemoveAll(w.path)
+}
+
+// WorkDirUsage returns the temporary space used by the pipeline.
+// It returns false when no work directory is configured.
+func (b *EventsBridge) WorkDirUsage() (WorkDirUsage, bool) {
+	u := b.workDir.usage()
+	if u == nil {
+		return WorkDirUsage{}, false
+	}
+	return *u, true
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package bridge
+
+import "os"
+
+// tempDirEnv is the environment variable of the temporary directory
+const tempDirEnv = "TMP"
+
+// processAlive reports whether a process with the pid is running
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release() //nolint:errcheck
+	return true
+}
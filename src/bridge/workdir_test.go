@@ -0,0 +1,104 @@
+package bridge
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func TestWorkDirLifecycle(t *testing.T) {
+	parent := t.TempDir()
+	t.Setenv(tempDirEnv, parent)
+
+	own := filepath.Join(parent, workDirPrefix+strconv.Itoa(os.Getpid())+"-live")
+	orphan := filepath.Join(parent, workDirPrefix+"999999999-dead")
+	other := filepath.Join(parent, "data")
+	for _, dir := range []string{own, orphan, other} {
+		if err := os.Mkdir(dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := newWorkDir(config.WorkDirConfig{Path: parent, MaxSize: 10}, newTestLogger())
+	if err != nil {
+		t.Fatalf("newWorkDir() unexpected error = %v", err)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("orphaned work directory not removed")
+	}
+	for _, dir := range []string{own, other} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("directory %s removed: %v", dir, err)
+		}
+	}
+	if filepath.Dir(w.path) != parent || !strings.HasPrefix(filepath.Base(w.path), workDirPrefix+strconv.Itoa(os.Getpid())+"-") {
+		t.Errorf("unexpected pipeline directory %s", w.path)
+	}
+	if os.TempDir() != w.path {
+		t.Errorf("temporary directory = %s, want %s", os.TempDir(), w.path)
+	}
+
+	// Temporary files of the runners count towards the quota
+	tmp, err := os.CreateTemp("", "runner-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmp.WriteString("more than ten bytes"); err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close() //nolint:errcheck
+	w.measure()
+	if u := w.usage(); u.Bytes != 19 || !u.Exceeded || !w.overQuota() {
+		t.Errorf("usage = %+v", u)
+	}
+	if err := os.Remove(tmp.Name()); err != nil {
+		t.Fatal(err)
+	}
+	w.measure()
+	if w.overQuota() {
+		t.Error("quota still exceeded after the cleanup")
+	}
+
+	if err := w.close(); err != nil {
+		t.Fatalf("close() unexpected error = %v", err)
+	}
+	if _, err := os.Stat(w.path); !os.IsNotExist(err) {
+		t.Error("pipeline directory not removed on close")
+	}
+	if os.TempDir() != parent {
+		t.Errorf("temporary directory = %s, want it restored to %s", os.TempDir(), parent)
+	}
+}
+
+func TestTrackRejectsOverQuota(t *testing.T) {
+	b := &EventsBridge{cfg: newTestConfig(), logger: newTestLogger(), workDir: &workDir{path: t.TempDir()}}
+	b.workDir.exceeded.Store(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := make(chan *message.RunnerMessage, 1)
+	out := b.track(ctx, c)
+
+	adapter := testutil.NewAdapter([]byte("x"), nil)
+	c <- message.NewRunnerMessage(adapter)
+	close(c)
+	select {
+	case msg, ok := <-out:
+		if ok {
+			t.Fatalf("message forwarded over quota: %v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the tracked channel")
+	}
+	if adapter.NakCalls != 1 || b.InFlight() != 0 {
+		t.Errorf("naks = %d, in flight = %d", adapter.NakCalls, b.InFlight())
+	}
+}
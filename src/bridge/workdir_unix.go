@@ -0,0 +1,17 @@
+//go:build unix
+
+package bridge
+
+import (
+	"errors"
+	"syscall"
+)
+
+// tempDirEnv is the environment variable of the temporary directory
+const tempDirEnv = "TMPDIR"
+
+// processAlive reports whether a process with the pid is running
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
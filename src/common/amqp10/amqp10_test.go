@@ -0,0 +1,141 @@
+package amqp10
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	created := time.UnixMilli(1767323045123).UTC()
+	in := &Message{
+		Durable:       true,
+		MessageID:     "m-1",
+		To:            "orders",
+		CorrelationID: uint64(42),
+		ContentType:   "application/json",
+		CreationTime:  created,
+		GroupID:       "customer-7",
+		Annotations:   map[any]any{Symbol("x-opt-offset"): "100", Symbol("x-opt-sequence-number"): int64(7)},
+		Properties:    map[string]any{"k": "v", "n": int32(3)},
+		Data:          bytes.Repeat([]byte("x"), 300),
+	}
+	encoded, err := EncodeMessage(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := DecodeMessage(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.MessageID != "m-1" || out.To != in.To || out.CorrelationID != uint64(42) || out.ContentType != in.ContentType {
+		t.Errorf("properties = %+v", out)
+	}
+	if !out.Durable || out.GroupID != "customer-7" {
+		t.Errorf("durable = %v, group id = %q", out.Durable, out.GroupID)
+	}
+	if created2, ok := out.CreationTime.(time.Time); !ok || !created2.Equal(created) {
+		t.Errorf("creation time = %v", out.CreationTime)
+	}
+	if out.Annotation("x-opt-offset") != "100" || out.Annotation("x-opt-sequence-number") != int64(7) {
+		t.Errorf("annotations = %v", out.Annotations)
+	}
+	if out.Properties["k"] != "v" || out.Properties["n"] != int32(3) {
+		t.Errorf("application properties = %v", out.Properties)
+	}
+	if !bytes.Equal(out.Data, in.Data) {
+		t.Errorf("data length = %d", len(out.Data))
+	}
+}
+
+func TestDecodeMessageHeader(t *testing.T) {
+	encoded, err := Marshal(Composite(DescHeader, true, nil, nil, false, uint32(3)), &Described{Descriptor: uint64(DescData), Value: []byte("x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := DecodeMessage(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Durable || m.DeliveryCount != 3 || string(m.Data) != "x" {
+		t.Errorf("message = %+v", m)
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	attach := Composite(DescAttach, "link", uint32(3), true, nil, nil, Composite(DescSource, "addr"), nil)
+	if err := WriteFrame(&buf, FrameAMQP, 0, attach, []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFrame(&buf, FrameAMQP, 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := ReadFrame(&buf, MaxFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := f.Body.Fields(7)
+	if f.Body.Code() != DescAttach || AsString(fields[0]) != "link" || AsUint32(fields[1]) != 3 || !AsBool(fields[2]) || fields[6] != nil {
+		t.Errorf("attach = %v", fields)
+	}
+	if source, ok := fields[5].(*Described); !ok || AsString(source.Fields(1)[0]) != "addr" {
+		t.Errorf("source = %v", fields[5])
+	}
+	if string(f.Payload) != "payload" {
+		t.Errorf("payload = %q", f.Payload)
+	}
+	if f, err = ReadFrame(&buf, MaxFrameSize); err != nil || f.Body != nil {
+		t.Errorf("empty frame = %v, %v", f, err)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	err := ParseError(Composite(DescError, Symbol("amqp:not-found"), "missing"))
+	if err == nil || err.Error() != "amqp: amqp:not-found: missing" {
+		t.Errorf("parseError() = %v", err)
+	}
+	if ParseError(nil) != nil {
+		t.Error("parseError(nil) must be nil")
+	}
+}
+
+func TestParseConnectionString(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want ConnectionString
+	}{
+		{
+			"service bus",
+			"Endpoint=sb://testns.servicebus.windows.net/;SharedAccessKeyName=root;SharedAccessKey=secret;EntityPath=orders",
+			ConnectionString{Host: "testns.servicebus.windows.net", KeyName: "root", Key: "secret", Entity: "orders"},
+		},
+		{
+			"iot hub",
+			"HostName=testhub.azure-devices.net;SharedAccessKeyName=service;SharedAccessKey=c2VjcmV0==",
+			ConnectionString{Host: "testhub.azure-devices.net", KeyName: "service", Key: "c2VjcmV0=="},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs, err := ParseConnectionString(tt.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *cs != tt.want {
+				t.Errorf("ParseConnectionString() = %+v, want %+v", *cs, tt.want)
+			}
+		})
+	}
+
+	for _, s := range []string{
+		"Endpoint=sb://testns.servicebus.windows.net/",
+		"HostName=h;SharedAccessKeyName=k",
+		"Endpoint=:bad;SharedAccessKeyName=k;SharedAccessKey=v",
+	} {
+		if _, err := ParseConnectionString(s); err == nil {
+			t.Errorf("ParseConnectionString(%q) expected error", s)
+		}
+	}
+}
@@ -0,0 +1,801 @@
+package amqp10
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxFrameSize is the largest frame accepted from the peer
+	MaxFrameSize = 256 * 1024
+	// SessionWindow is the incoming and outgoing transfer window of the session
+	SessionWindow = 5000
+	// transferOverhead is reserved in the frames for the transfer performative
+	transferOverhead = 512
+)
+
+var ErrConnClosed = errors.New("amqp: connection closed")
+
+// ConnOptions are the settings of an AMQP connection authenticated with SASL PLAIN, or
+// ANONYMOUS without username
+type ConnOptions struct {
+	// Address is the host:port of the peer
+	Address string
+	// Hostname is the virtual host of the open frame and the TLS server name
+	Hostname string
+	// TLS is the TLS configuration (nil = plain TCP)
+	TLS      *tls.Config
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+// Conn is an AMQP 1.0 connection with a single session
+type Conn struct {
+	conn   net.Conn
+	logger *slog.Logger
+
+	wmu sync.Mutex
+
+	mu             sync.Mutex
+	remoteMaxFrame uint32
+	links          map[uint32]*Link
+	remoteLinks    map[uint32]*Link
+	deliveries     map[uint32]chan error
+	nextHandle     uint32
+	nextOutgoingID uint32
+	nextIncomingID uint32
+	nextDeliveryID uint32
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// Dial connects, authenticates and begins the session
+func Dial(ctx context.Context, opts ConnOptions, logger *slog.Logger) (*Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if opts.TLS != nil {
+		tlsConfig := opts.TLS.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = opts.Hostname
+		}
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", opts.Address)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", opts.Address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", opts.Address, err)
+	}
+
+	c := &Conn{
+		conn:           conn,
+		logger:         logger,
+		remoteMaxFrame: 512,
+		links:          make(map[uint32]*Link),
+		remoteLinks:    make(map[uint32]*Link),
+		deliveries:     make(map[uint32]chan error),
+		done:           make(chan struct{}),
+	}
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	idle, err := c.handshake(opts)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	go c.readLoop()
+	if idle > 0 {
+		go c.keepAlive(idle / 2)
+	}
+	return c, nil
+}
+
+// handshake negotiates SASL PLAIN or ANONYMOUS, opens the connection and begins the session,
+// returning the idle timeout of the peer
+func (c *Conn) handshake(opts ConnOptions) (time.Duration, error) {
+	if err := c.exchangeHeader(HeaderSASL); err != nil {
+		return 0, err
+	}
+	f, err := c.expect(FrameSASL, DescSASLMechanisms)
+	if err != nil {
+		return 0, err
+	}
+	mechanism, response := "ANONYMOUS", []byte{}
+	if opts.Username != "" {
+		mechanism, response = "PLAIN", []byte("\x00"+opts.Username+"\x00"+opts.Password)
+	}
+	mechanisms := AsStrings(f.Body.Fields(1)[0])
+	offered := false
+	for _, m := range mechanisms {
+		offered = offered || m == mechanism
+	}
+	if !offered {
+		return 0, fmt.Errorf("amqp: SASL %s not offered (mechanisms: %v)", mechanism, mechanisms)
+	}
+	if err := WriteFrame(c.conn, FrameSASL, 0, Composite(DescSASLInit, Symbol(mechanism), response, opts.Hostname), nil); err != nil {
+		return 0, err
+	}
+	if f, err = c.expect(FrameSASL, DescSASLOutcome); err != nil {
+		return 0, err
+	}
+	if code, _ := f.Body.Fields(1)[0].(uint8); code != 0 {
+		return 0, fmt.Errorf("amqp: SASL authentication failed (code %d)", code)
+	}
+
+	if err := c.exchangeHeader(HeaderAMQP); err != nil {
+		return 0, err
+	}
+	containerID := make([]byte, 8)
+	_, _ = rand.Read(containerID)
+	open := Composite(DescOpen, "events-bridge-"+hex.EncodeToString(containerID), opts.Hostname, uint32(MaxFrameSize), uint16(0))
+	if err := WriteFrame(c.conn, FrameAMQP, 0, open, nil); err != nil {
+		return 0, err
+	}
+	begin := Composite(DescBegin, nil, uint32(0), uint32(SessionWindow), uint32(SessionWindow))
+	if err := WriteFrame(c.conn, FrameAMQP, 0, begin, nil); err != nil {
+		return 0, err
+	}
+	if f, err = c.expect(FrameAMQP, DescOpen); err != nil {
+		return 0, err
+	}
+	fields := f.Body.Fields(5)
+	if size := AsUint32(fields[2]); size >= 512 {
+		c.remoteMaxFrame = size
+	}
+	idle := time.Duration(AsUint32(fields[4])) * time.Millisecond
+	if f, err = c.expect(FrameAMQP, DescBegin); err != nil {
+		return 0, err
+	}
+	c.nextIncomingID = AsUint32(f.Body.Fields(2)[1])
+	return idle, nil
+}
+
+func (c *Conn) exchangeHeader(header []byte) error {
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	got := make([]byte, len(header))
+	if _, err := io.ReadFull(c.conn, got); err != nil {
+		return err
+	}
+	if !bytes.Equal(got, header) {
+		return fmt.Errorf("amqp: unexpected protocol header %x", got)
+	}
+	return nil
+}
+
+// expect reads the next non-empty frame, which must be the given performative
+func (c *Conn) expect(typ byte, code int64) (*Frame, error) {
+	for {
+		f, err := ReadFrame(c.conn, MaxFrameSize)
+		if err != nil {
+			return nil, err
+		}
+		if f.Body == nil {
+			continue
+		}
+		if f.Type == typ && f.Body.Code() == code {
+			return f, nil
+		}
+		if f.Body.Code() == DescClose {
+			if err := ParseError(f.Body.Fields(1)[0]); err != nil {
+				return nil, err
+			}
+			return nil, ErrConnClosed
+		}
+		return nil, fmt.Errorf("amqp: unexpected frame 0x%02x, want 0x%02x", f.Body.Code(), code)
+	}
+}
+
+// send writes a performative on the session channel
+func (c *Conn) send(body *Described, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return WriteFrame(c.conn, FrameAMQP, 0, body, payload)
+}
+
+func (c *Conn) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.wmu.Lock()
+			err := WriteFrame(c.conn, FrameAMQP, 0, nil, nil)
+			c.wmu.Unlock()
+			if err != nil {
+				c.fail(err)
+				return
+			}
+		}
+	}
+}
+
+// Done is closed when the connection fails or is closed
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that closed the connection
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// fail closes the connection with an error
+func (c *Conn) fail(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		for _, l := range c.links {
+			l.close(err)
+		}
+		for id, ch := range c.deliveries {
+			ch <- err
+			delete(c.deliveries, id)
+		}
+		c.mu.Unlock()
+		_ = c.conn.Close()
+		close(c.done)
+	})
+}
+
+// Close ends the session and closes the connection
+func (c *Conn) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+	_ = c.send(Composite(DescEnd), nil)
+	_ = c.send(Composite(DescClose), nil)
+	c.fail(ErrConnClosed)
+	return nil
+}
+
+func (c *Conn) readLoop() {
+	for {
+		f, err := ReadFrame(c.conn, MaxFrameSize)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		if f.Body == nil {
+			continue
+		}
+		if err := c.dispatch(f); err != nil {
+			c.fail(err)
+			return
+		}
+	}
+}
+
+// dispatch handles a frame received after the handshake
+func (c *Conn) dispatch(f *Frame) error {
+	switch f.Body.Code() {
+	case DescAttach:
+		fields := f.Body.Fields(10)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, l := range c.links {
+			if l.name == AsString(fields[0]) && l.role != AsBool(fields[2]) {
+				l.remoteHandle = AsUint32(fields[1])
+				l.deliveryCount = AsUint32(fields[9])
+				c.remoteLinks[l.remoteHandle] = l
+				l.attach(fields[5], fields[6])
+			}
+		}
+	case DescFlow:
+		c.handleFlow(f.Body.Fields(10))
+	case DescTransfer:
+		return c.handleTransfer(f.Body.Fields(6), f.Payload)
+	case DescDisposition:
+		fields := f.Body.Fields(5)
+		if !AsBool(fields[0]) {
+			return nil
+		}
+		first := AsUint32(fields[1])
+		last := first
+		if fields[2] != nil {
+			last = AsUint32(fields[2])
+		}
+		var err error
+		if state, ok := fields[4].(*Described); ok && state.Code() != DescAccepted {
+			err = &Error{Condition: "delivery not accepted"}
+			if state.Code() == DescRejected {
+				if rejectErr := ParseError(state.Fields(1)[0]); rejectErr != nil {
+					err = rejectErr
+				}
+			}
+		}
+		c.mu.Lock()
+		for id := first; id <= last; id++ {
+			if ch, ok := c.deliveries[id]; ok {
+				ch <- err
+				delete(c.deliveries, id)
+			}
+		}
+		c.mu.Unlock()
+	case DescDetach:
+		fields := f.Body.Fields(3)
+		c.mu.Lock()
+		l, ok := c.remoteLinks[AsUint32(fields[0])]
+		if ok {
+			delete(c.remoteLinks, l.remoteHandle)
+			delete(c.links, l.handle)
+		}
+		c.mu.Unlock()
+		if ok {
+			err := ParseError(fields[2])
+			if err == nil {
+				err = errors.New("amqp: link detached by the peer")
+			}
+			// Acknowledge the detach of the peer
+			_ = c.send(Composite(DescDetach, l.handle, true), nil)
+			l.close(err)
+		}
+	case DescEnd, DescClose:
+		err := ParseError(f.Body.Fields(1)[0])
+		if err == nil {
+			err = ErrConnClosed
+		}
+		return err
+	}
+	return nil
+}
+
+// handleFlow updates the credit of a sender link
+func (c *Conn) handleFlow(fields []any) {
+	if fields[4] == nil {
+		return
+	}
+	c.mu.Lock()
+	l, ok := c.remoteLinks[AsUint32(fields[4])]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	if l.role == RoleSender {
+		l.mu.Lock()
+		// credit = delivery-count(receiver) + link-credit(receiver) - delivery-count(sender)
+		l.credit = AsUint32(fields[5]) + AsUint32(fields[6]) - l.deliveryCount
+		l.mu.Unlock()
+		l.signal()
+	}
+	if AsBool(fields[9]) {
+		_ = l.flow()
+	}
+}
+
+// handleTransfer assembles the deliveries of a receiver link, accepting them unless the
+// link is settled manually
+func (c *Conn) handleTransfer(fields []any, payload []byte) error {
+	c.mu.Lock()
+	c.nextIncomingID++
+	l, ok := c.remoteLinks[AsUint32(fields[0])]
+	c.mu.Unlock()
+	if !ok || l.role != RoleReceiver {
+		return nil
+	}
+	l.mu.Lock()
+	if !l.assembling {
+		l.assembling = true
+		l.deliveryID = AsUint32(fields[1])
+		l.settled = AsBool(fields[4])
+		l.buffer = l.buffer[:0]
+	}
+	l.buffer = append(l.buffer, payload...)
+	if AsBool(fields[5]) {
+		l.mu.Unlock()
+		return nil
+	}
+	l.assembling = false
+	deliveryID, settled := l.deliveryID, l.settled
+	data := append([]byte(nil), l.buffer...)
+	l.deliveryCount++
+	if l.credit > 0 {
+		l.credit--
+	}
+	l.mu.Unlock()
+
+	d := &Delivery{link: l, id: deliveryID, settled: settled}
+	if !settled && !l.manual {
+		if err := d.Settle(Composite(DescAccepted)); err != nil {
+			return err
+		}
+	}
+	msg, err := DecodeMessage(data)
+	if err != nil {
+		c.logger.Warn("invalid AMQP message", "link", l.name, "error", err)
+		// Undecodable messages are never delivered again
+		if !d.settled {
+			return d.Settle(Composite(DescRejected, Composite(DescError, Symbol("amqp:decode-error"), err.Error())))
+		}
+		return nil
+	}
+	d.Message = msg
+	select {
+	case l.messages <- d:
+	default:
+		c.logger.Warn("AMQP message beyond the link credit dropped", "link", l.name)
+	}
+	return nil
+}
+
+// LinkOptions are the terminus settings of a link
+type LinkOptions struct {
+	// Source is the address of the source terminus
+	Source string
+	// Target is the address of the target terminus
+	Target string
+	// Filter is the filter set of the source (receivers)
+	Filter map[any]any
+	// Credit is the number of messages buffered by a receiver
+	Credit uint32
+	// Settled asks the sender to settle the deliveries when sent (at-most-once)
+	Settled bool
+	// Manual leaves the settlement of the unsettled deliveries of a receiver to the caller
+	Manual bool
+}
+
+// AttachSender attaches a link sending to the target address
+func (c *Conn) AttachSender(ctx context.Context, opts LinkOptions) (*Link, error) {
+	return c.attachLink(ctx, RoleSender, opts)
+}
+
+// AttachReceiver attaches a link receiving from the source address
+func (c *Conn) AttachReceiver(ctx context.Context, opts LinkOptions) (*Link, error) {
+	if opts.Credit == 0 {
+		opts.Credit = 100
+	}
+	l, err := c.attachLink(ctx, RoleReceiver, opts)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	l.credit = opts.Credit
+	l.mu.Unlock()
+	if err := l.flow(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (c *Conn) attachLink(ctx context.Context, role bool, opts LinkOptions) (*Link, error) {
+	suffix := make([]byte, 6)
+	_, _ = rand.Read(suffix)
+	l := &Link{
+		c:        c,
+		name:     "events-bridge-" + hex.EncodeToString(suffix),
+		role:     role,
+		capacity: opts.Credit,
+		attached: make(chan struct{}),
+		detached: make(chan struct{}),
+		manual:   opts.Manual,
+		creditCh: make(chan struct{}, 1),
+		messages: make(chan *Delivery, opts.Credit),
+	}
+
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return nil, c.err
+	default:
+	}
+	l.handle = c.nextHandle
+	c.nextHandle++
+	c.links[l.handle] = l
+	c.mu.Unlock()
+
+	var filter any
+	if len(opts.Filter) > 0 {
+		filter = opts.Filter
+	}
+	var source, target any
+	if opts.Source != "" || role == RoleReceiver {
+		source = Composite(DescSource, opts.Source, nil, nil, nil, nil, nil, nil, filter)
+	}
+	if opts.Target != "" || role == RoleSender {
+		target = Composite(DescTarget, opts.Target)
+	}
+	settle := SndSettleUnsettled
+	if opts.Settled {
+		settle = SndSettleSettled
+	}
+	var initialCount any
+	if role == RoleSender {
+		initialCount = uint32(0)
+	}
+	attach := Composite(DescAttach, l.name, l.handle, role, settle, RcvSettleFirst, source, target, nil, nil, initialCount)
+	if err := c.send(attach, nil); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-l.attached:
+		if l.refused {
+			// The peer refuses the link with an attach without terminus, followed by a detach
+			select {
+			case <-l.detached:
+				return nil, l.err
+			case <-ctx.Done():
+				return nil, fmt.Errorf("link to %s refused", opts.Source+opts.Target)
+			}
+		}
+		return l, nil
+	case <-l.detached:
+		return nil, l.err
+	case <-ctx.Done():
+		l.Detach()
+		return nil, fmt.Errorf("timeout attaching link: %w", ctx.Err())
+	}
+}
+
+// Link is a sender or receiver link of the session
+type Link struct {
+	c            *Conn
+	name         string
+	handle       uint32
+	remoteHandle uint32
+	role         bool
+	capacity     uint32
+
+	attached   chan struct{}
+	attachOnce sync.Once
+	refused    bool
+	detached   chan struct{}
+	detachOnce sync.Once
+	err        error
+
+	mu            sync.Mutex
+	deliveryCount uint32
+	credit        uint32
+	creditCh      chan struct{}
+
+	// source is the source terminus attached by the peer
+	source *Described
+	// incoming deliveries of receivers
+	manual     bool
+	messages   chan *Delivery
+	assembling bool
+	deliveryID uint32
+	settled    bool
+	buffer     []byte
+}
+
+// attach records the attach of the peer; a missing terminus refuses the link
+func (l *Link) attach(source, target any) {
+	l.attachOnce.Do(func() {
+		l.refused = (l.role == RoleReceiver && source == nil) || (l.role == RoleSender && target == nil)
+		l.source, _ = source.(*Described)
+		close(l.attached)
+	})
+}
+
+// Detached is closed when the link is detached, by the peer or with the connection
+func (l *Link) Detached() <-chan struct{} {
+	return l.detached
+}
+
+// Err returns the error that detached the link
+func (l *Link) Err() error {
+	return l.err
+}
+
+// Name returns the name of the link, e.g. the associated link of the management requests
+func (l *Link) Name() string {
+	return l.name
+}
+
+// Source returns the source terminus attached by the peer, e.g. with the filters it applied
+func (l *Link) Source() *Described {
+	return l.source
+}
+
+// close marks the link as detached
+func (l *Link) close(err error) {
+	l.detachOnce.Do(func() {
+		l.err = err
+		close(l.detached)
+	})
+}
+
+func (l *Link) signal() {
+	select {
+	case l.creditCh <- struct{}{}:
+	default:
+	}
+}
+
+// flow sends the session window and the link state
+func (l *Link) flow() error {
+	c := l.c
+	c.mu.Lock()
+	nextIncoming, nextOutgoing := c.nextIncomingID, c.nextOutgoingID
+	c.mu.Unlock()
+	l.mu.Lock()
+	deliveryCount, credit := l.deliveryCount, l.credit
+	l.mu.Unlock()
+	return c.send(Composite(DescFlow, nextIncoming, uint32(SessionWindow), nextOutgoing, uint32(SessionWindow),
+		l.handle, deliveryCount, credit), nil)
+}
+
+// Receive returns the next delivery, granting more credit once half of it is used
+func (l *Link) Receive(ctx context.Context) (*Delivery, error) {
+	select {
+	case msg := <-l.messages:
+		l.mu.Lock()
+		refill := l.credit < l.capacity/2
+		if refill {
+			l.credit = l.capacity - uint32(len(l.messages)) //nolint:gosec // bounded by the capacity
+		}
+		l.mu.Unlock()
+		if refill {
+			if err := l.flow(); err != nil {
+				return nil, err
+			}
+		}
+		return msg, nil
+	case <-l.detached:
+		return nil, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Send transfers the message and waits for its disposition
+func (l *Link) Send(ctx context.Context, msg *Message) error {
+	payload, err := EncodeMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	// Wait for credit
+	for {
+		l.mu.Lock()
+		if l.credit > 0 {
+			l.credit--
+			l.deliveryCount++
+			l.mu.Unlock()
+			break
+		}
+		l.mu.Unlock()
+		select {
+		case <-l.creditCh:
+		case <-l.detached:
+			return l.err
+		case <-ctx.Done():
+			return fmt.Errorf("no link credit: %w", ctx.Err())
+		}
+	}
+
+	c := l.c
+	result := make(chan error, 1)
+	c.mu.Lock()
+	deliveryID := c.nextDeliveryID
+	c.nextDeliveryID++
+	c.deliveries[deliveryID] = result
+	chunk := int(c.remoteMaxFrame) - transferOverhead
+	c.mu.Unlock()
+	if chunk < 64 {
+		chunk = 64
+	}
+
+	tag := make([]byte, 4)
+	tag[0], tag[1], tag[2], tag[3] = byte(deliveryID>>24), byte(deliveryID>>16), byte(deliveryID>>8), byte(deliveryID)
+	for first := true; first || len(payload) > 0; first = false {
+		part := payload
+		if len(part) > chunk {
+			part = part[:chunk]
+		}
+		payload = payload[len(part):]
+		more := len(payload) > 0
+		var transfer *Described
+		if first {
+			transfer = Composite(DescTransfer, l.handle, deliveryID, tag, uint32(0), false, more)
+		} else {
+			transfer = Composite(DescTransfer, l.handle, nil, nil, nil, nil, more)
+		}
+		c.mu.Lock()
+		c.nextOutgoingID++
+		c.mu.Unlock()
+		if err := c.send(transfer, part); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-l.detached:
+		return l.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.deliveries, deliveryID)
+		c.mu.Unlock()
+		return fmt.Errorf("timeout waiting for the delivery outcome: %w", ctx.Err())
+	}
+}
+
+// Delivery is a message received on a link
+type Delivery struct {
+	*Message
+	link    *Link
+	id      uint32
+	settled bool
+}
+
+// Settle sends the outcome of an unsettled delivery, e.g. accepted or released
+func (d *Delivery) Settle(state *Described) error {
+	if d.settled {
+		return nil
+	}
+	d.settled = true
+	return d.link.c.send(Composite(DescDisposition, RoleReceiver, d.id, nil, true, state), nil)
+}
+
+// Detach closes the link
+func (l *Link) Detach() {
+	c := l.c
+	c.mu.Lock()
+	delete(c.links, l.handle)
+	delete(c.remoteLinks, l.remoteHandle)
+	c.mu.Unlock()
+	_ = c.send(Composite(DescDetach, l.handle, true), nil)
+	l.close(errors.New("amqp: link detached"))
+}
+
+// Request sends a request to a node, e.g. $management, and waits for the response
+// correlated by message id on a temporary reply link
+func (c *Conn) Request(ctx context.Context, node string, msg *Message) (*Message, error) {
+	suffix := make([]byte, 6)
+	_, _ = rand.Read(suffix)
+	replyTo := node + "-reply-" + hex.EncodeToString(suffix)
+
+	receiver, err := c.AttachReceiver(ctx, LinkOptions{Source: node, Target: replyTo, Credit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach the %s reply link: %w", node, err)
+	}
+	defer receiver.Detach()
+	sender, err := c.AttachSender(ctx, LinkOptions{Target: node})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach the %s link: %w", node, err)
+	}
+	defer sender.Detach()
+
+	msg.MessageID = "req-" + hex.EncodeToString(suffix)
+	msg.ReplyTo = replyTo
+	if err := sender.Send(ctx, msg); err != nil {
+		return nil, err
+	}
+	for {
+		res, err := receiver.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if AsString(res.CorrelationID) == msg.MessageID {
+			return res.Message, nil
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package amqp10
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ConnectionString is a parsed Azure connection string: a Service Bus or Event Hub one
+// ("Endpoint=sb://...;SharedAccessKeyName=...;SharedAccessKey=...[;EntityPath=...]") or
+// an IoT Hub one ("HostName=...;SharedAccessKeyName=...;SharedAccessKey=...")
+type ConnectionString struct {
+	Host    string
+	KeyName string
+	Key     string
+	// Entity is the queue, topic or Event Hub of entity-level connection strings
+	Entity string
+}
+
+// ParseConnectionString parses the Key=Value pairs of a connection string
+func ParseConnectionString(s string) (*ConnectionString, error) {
+	cs := &ConnectionString{}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "HostName":
+			cs.Host = value
+		case "Endpoint":
+			u, err := url.Parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid connection string endpoint: %w", err)
+			}
+			cs.Host = u.Host
+		case "SharedAccessKeyName":
+			cs.KeyName = value
+		case "SharedAccessKey":
+			cs.Key = value
+		case "EntityPath":
+			cs.Entity = value
+		}
+	}
+	if cs.Host == "" || cs.KeyName == "" || cs.Key == "" {
+		return nil, errors.New("connection string must include HostName (or Endpoint), SharedAccessKeyName and SharedAccessKey")
+	}
+	return cs, nil
+}
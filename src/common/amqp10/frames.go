@@ -0,0 +1,274 @@
+package amqp10
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Frame types and protocol headers
+const (
+	FrameAMQP = 0x00
+	FrameSASL = 0x01
+)
+
+var (
+	HeaderAMQP = []byte{'A', 'M', 'Q', 'P', 0, 1, 0, 0}
+	HeaderSASL = []byte{'A', 'M', 'Q', 'P', 3, 1, 0, 0}
+)
+
+// Descriptors of the performatives, SASL frames, delivery states and message sections
+const (
+	DescOpen        = 0x10
+	DescBegin       = 0x11
+	DescAttach      = 0x12
+	DescFlow        = 0x13
+	DescTransfer    = 0x14
+	DescDisposition = 0x15
+	DescDetach      = 0x16
+	DescEnd         = 0x17
+	DescClose       = 0x18
+	DescError       = 0x1d
+
+	DescReceived = 0x23
+	DescAccepted = 0x24
+	DescRejected = 0x25
+	DescReleased = 0x26
+	DescModified = 0x27
+	DescSource   = 0x28
+	DescTarget   = 0x29
+
+	DescSASLMechanisms = 0x40
+	DescSASLInit       = 0x41
+	DescSASLOutcome    = 0x44
+
+	DescHeader                = 0x70
+	DescDeliveryAnnotations   = 0x71
+	DescMessageAnnotations    = 0x72
+	DescProperties            = 0x73
+	DescApplicationProperties = 0x74
+	DescData                  = 0x75
+	DescAMQPValue             = 0x77
+	DescFooter                = 0x78
+)
+
+// Link roles and settlement modes
+const (
+	RoleSender   = false
+	RoleReceiver = true
+
+	SndSettleUnsettled = uint8(0)
+	SndSettleSettled   = uint8(1)
+	RcvSettleFirst     = uint8(0)
+)
+
+// Frame is a decoded frame: a performative and, for transfers, the payload
+type Frame struct {
+	Type    byte
+	Channel uint16
+	Body    *Described
+	Payload []byte
+}
+
+// WriteFrame encodes a frame; a nil body is an empty (keepalive) frame
+func WriteFrame(w io.Writer, typ byte, channel uint16, body *Described, payload []byte) error {
+	var encoded []byte
+	if body != nil {
+		var err error
+		if encoded, err = Marshal(body); err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, 8, 8+len(encoded)+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(8+len(encoded)+len(payload))) //nolint:gosec // bounded by the max frame size
+	buf[4] = 2
+	buf[5] = typ
+	binary.BigEndian.PutUint16(buf[6:], channel)
+	buf = append(buf, encoded...)
+	buf = append(buf, payload...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadFrame reads the next frame; empty frames have a nil body
+func ReadFrame(r io.Reader, maxSize uint32) (*Frame, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	doff := int(header[4]) * 4
+	if size < 8 || size > maxSize || doff < 8 || uint32(doff) > size {
+		return nil, fmt.Errorf("amqp: invalid frame size %d", size)
+	}
+	f := &Frame{Type: header[5], Channel: binary.BigEndian.Uint16(header[6:])}
+	data := make([]byte, size-8)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	data = data[doff-8:]
+	if len(data) == 0 {
+		return f, nil
+	}
+	d := &decoder{buf: data}
+	v, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	body, ok := v.(*Described)
+	if !ok {
+		return nil, errors.New("amqp: frame body is not a performative")
+	}
+	f.Body = body
+	f.Payload = data[d.pos:]
+	return f, nil
+}
+
+// Error is an AMQP error condition received from the peer
+type Error struct {
+	Condition   string
+	Description string
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return "amqp: " + e.Condition
+	}
+	return fmt.Sprintf("amqp: %s: %s", e.Condition, e.Description)
+}
+
+// ParseError returns the error of a detach, end, close or rejected state, if any
+func ParseError(v any) error {
+	d, ok := v.(*Described)
+	if !ok || d.Code() != DescError {
+		return nil
+	}
+	f := d.Fields(2)
+	return &Error{Condition: AsString(f[0]), Description: AsString(f[1])}
+}
+
+// Message is a bare message
+type Message struct {
+	// Durable asks the broker to store the message (header section)
+	Durable bool
+	// DeliveryCount is the number of failed delivery attempts (header section)
+	DeliveryCount uint32
+	MessageID     any
+	To            string
+	Subject       string
+	ReplyTo       string
+	CorrelationID any
+	ContentType   string
+	CreationTime  any
+	// GroupID is the group of the message, the session id of Service Bus
+	GroupID     string
+	Annotations map[any]any
+	Properties  map[string]any
+	// Data is the payload of the data sections, or the string or binary amqp-value
+	Data []byte
+	// Value is the amqp-value section, if any
+	Value any
+}
+
+// EncodeMessage encodes the message sections; the payload is a data section unless Value is set
+func EncodeMessage(m *Message) ([]byte, error) {
+	sections := []any{}
+	if m.Durable {
+		sections = append(sections, Composite(DescHeader, true))
+	}
+	if len(m.Annotations) > 0 {
+		sections = append(sections, &Described{Descriptor: uint64(DescMessageAnnotations), Value: m.Annotations})
+	}
+	var contentType any
+	if m.ContentType != "" {
+		contentType = Symbol(m.ContentType)
+	}
+	var to, subject, replyTo, groupID any
+	if m.To != "" {
+		to = m.To
+	}
+	if m.Subject != "" {
+		subject = m.Subject
+	}
+	if m.ReplyTo != "" {
+		replyTo = m.ReplyTo
+	}
+	if m.GroupID != "" {
+		groupID = m.GroupID
+	}
+	sections = append(sections, Composite(DescProperties, m.MessageID, nil, to, subject, replyTo, m.CorrelationID, contentType, nil, nil, m.CreationTime, groupID))
+	if len(m.Properties) > 0 {
+		sections = append(sections, &Described{Descriptor: uint64(DescApplicationProperties), Value: m.Properties})
+	}
+	if m.Value != nil {
+		sections = append(sections, &Described{Descriptor: uint64(DescAMQPValue), Value: m.Value})
+	} else {
+		data := m.Data
+		if data == nil {
+			data = []byte{}
+		}
+		sections = append(sections, &Described{Descriptor: uint64(DescData), Value: data})
+	}
+	return Marshal(sections...)
+}
+
+// DecodeMessage decodes the sections of a message
+func DecodeMessage(data []byte) (*Message, error) {
+	m := &Message{}
+	d := &decoder{buf: data}
+	for d.remaining() > 0 {
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		section, ok := v.(*Described)
+		if !ok {
+			return nil, errors.New("amqp: invalid message section")
+		}
+		switch section.Code() {
+		case DescHeader:
+			f := section.Fields(5)
+			m.Durable = AsBool(f[0])
+			m.DeliveryCount = AsUint32(f[4])
+		case DescMessageAnnotations:
+			m.Annotations, _ = section.Value.(map[any]any)
+		case DescProperties:
+			f := section.Fields(11)
+			m.MessageID = f[0]
+			m.To = AsString(f[2])
+			m.Subject = AsString(f[3])
+			m.ReplyTo = AsString(f[4])
+			m.CorrelationID = f[5]
+			m.ContentType = AsString(f[6])
+			m.CreationTime = f[9]
+			m.GroupID = AsString(f[10])
+		case DescApplicationProperties:
+			props, _ := section.Value.(map[any]any)
+			m.Properties = make(map[string]any, len(props))
+			for k, v := range props {
+				m.Properties[AsString(k)] = v
+			}
+		case DescData:
+			b, _ := section.Value.([]byte)
+			m.Data = append(m.Data, b...)
+		case DescAMQPValue:
+			m.Value = section.Value
+			switch v := section.Value.(type) {
+			case []byte:
+				m.Data = v
+			case string:
+				m.Data = []byte(v)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Annotation returns a message annotation by its symbolic key
+func (m *Message) Annotation(key string) any {
+	if v, ok := m.Annotations[Symbol(key)]; ok {
+		return v
+	}
+	return m.Annotations[key]
+}
@@ -0,0 +1,638 @@
+// Package amqp10 is the AMQP 1.0 client shared by the connectors speaking AMQP 1.0
+// (Azure Service Bus, Event Hubs and IoT Hub, ActiveMQ Artemis, ...): the type system
+// codec, the frames and a connection with a single session authenticated with SASL PLAIN
+// or ANONYMOUS, with sender and receiver links, and the parser of the Azure connection
+// strings.
+package amqp10
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// AMQP 1.0 type codes
+const (
+	typeDescribed  = 0x00
+	typeNull       = 0x40
+	typeTrue       = 0x41
+	typeFalse      = 0x42
+	typeUint0      = 0x43
+	typeUlong0     = 0x44
+	typeList0      = 0x45
+	typeUbyte      = 0x50
+	typeByte       = 0x51
+	typeSmallUint  = 0x52
+	typeSmallUlong = 0x53
+	typeSmallInt   = 0x54
+	typeSmallLong  = 0x55
+	typeBool       = 0x56
+	typeUshort     = 0x60
+	typeShort      = 0x61
+	typeUint       = 0x70
+	typeInt        = 0x71
+	typeFloat      = 0x72
+	typeChar       = 0x73
+	typeDecimal32  = 0x74
+	typeUlong      = 0x80
+	typeLong       = 0x81
+	typeDouble     = 0x82
+	typeTimestamp  = 0x83
+	typeDecimal64  = 0x84
+	typeUUID       = 0x98
+	typeBinary8    = 0xa0
+	typeString8    = 0xa1
+	typeSymbol8    = 0xa3
+	typeBinary32   = 0xb0
+	typeString32   = 0xb1
+	typeSymbol32   = 0xb3
+	typeList8      = 0xc0
+	typeMap8       = 0xc1
+	typeList32     = 0xd0
+	typeMap32      = 0xd1
+	typeArray8     = 0xe0
+	typeArray32    = 0xf0
+)
+
+var errShortBuffer = errors.New("amqp: unexpected end of data")
+
+// Symbol is an AMQP symbolic value, e.g. an error condition or an annotation key
+type Symbol string
+
+// UUID is an AMQP UUID
+type UUID [16]byte
+
+// Described is a value with its descriptor, e.g. a performative or a message section
+type Described struct {
+	Descriptor any
+	Value      any
+}
+
+// Code returns the numeric descriptor, or -1 for symbolic descriptors
+func (d *Described) Code() int64 {
+	if c, ok := d.Descriptor.(uint64); ok && c <= math.MaxInt64 {
+		return int64(c)
+	}
+	return -1
+}
+
+// Fields returns the fields of a composite value; missing trailing fields are nil
+func (d *Described) Fields(n int) []any {
+	list, _ := d.Value.([]any)
+	out := make([]any, n)
+	copy(out, list)
+	return out
+}
+
+// Composite returns a composite value with trailing nil fields removed
+func Composite(code uint64, fields ...any) *Described {
+	for len(fields) > 0 && fields[len(fields)-1] == nil {
+		fields = fields[:len(fields)-1]
+	}
+	return &Described{Descriptor: code, Value: fields}
+}
+
+// encoder appends AMQP values to a buffer
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) byte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) variable(small, large byte, data []byte) {
+	if len(data) <= math.MaxUint8 {
+		e.byte(small)
+		e.byte(byte(len(data)))
+	} else {
+		e.byte(large)
+		e.uint32(uint32(len(data))) //nolint:gosec // frames are bounded by the max frame size
+	}
+	e.buf = append(e.buf, data...)
+}
+
+// encode appends the value with its constructor
+func (e *encoder) encode(v any) error {
+	switch v := v.(type) {
+	case nil:
+		e.byte(typeNull)
+	case bool:
+		if v {
+			e.byte(typeTrue)
+		} else {
+			e.byte(typeFalse)
+		}
+	case uint8:
+		e.byte(typeUbyte)
+		e.byte(v)
+	case uint16:
+		e.byte(typeUshort)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, v)
+	case uint32:
+		switch {
+		case v == 0:
+			e.byte(typeUint0)
+		case v <= math.MaxUint8:
+			e.byte(typeSmallUint)
+			e.byte(byte(v))
+		default:
+			e.byte(typeUint)
+			e.uint32(v)
+		}
+	case uint64:
+		switch {
+		case v == 0:
+			e.byte(typeUlong0)
+		case v <= math.MaxUint8:
+			e.byte(typeSmallUlong)
+			e.byte(byte(v))
+		default:
+			e.byte(typeUlong)
+			e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+		}
+	case int8:
+		e.byte(typeByte)
+		e.byte(byte(v))
+	case int16:
+		e.byte(typeShort)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v)) //nolint:gosec // two's complement encoding
+	case int32:
+		e.byte(typeInt)
+		e.uint32(uint32(v)) //nolint:gosec // two's complement encoding
+	case int:
+		return e.encode(int64(v))
+	case int64:
+		e.byte(typeLong)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v)) //nolint:gosec // two's complement encoding
+	case float32:
+		e.byte(typeFloat)
+		e.uint32(math.Float32bits(v))
+	case float64:
+		e.byte(typeDouble)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v))
+	case time.Time:
+		e.byte(typeTimestamp)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v.UnixMilli())) //nolint:gosec // two's complement encoding
+	case UUID:
+		e.byte(typeUUID)
+		e.buf = append(e.buf, v[:]...)
+	case []byte:
+		e.variable(typeBinary8, typeBinary32, v)
+	case string:
+		e.variable(typeString8, typeString32, []byte(v))
+	case Symbol:
+		e.variable(typeSymbol8, typeSymbol32, []byte(v))
+	case []Symbol:
+		return e.symbolArray(v)
+	case []any:
+		return e.list(v)
+	case map[any]any:
+		return e.mapValue(v)
+	case map[string]any:
+		m := make(map[any]any, len(v))
+		for k, val := range v {
+			m[k] = val
+		}
+		return e.mapValue(m)
+	case map[Symbol]any:
+		m := make(map[any]any, len(v))
+		for k, val := range v {
+			m[k] = val
+		}
+		return e.mapValue(m)
+	case *Described:
+		e.byte(typeDescribed)
+		if err := e.encode(v.Descriptor); err != nil {
+			return err
+		}
+		return e.encode(v.Value)
+	default:
+		return fmt.Errorf("amqp: unsupported type %T", v)
+	}
+	return nil
+}
+
+// compound encodes the count and the encoded items of a list or map
+func (e *encoder) compound(small, large, empty byte, count int, items []byte) {
+	if count == 0 && empty != 0 {
+		e.byte(empty)
+		return
+	}
+	if len(items)+1 <= math.MaxUint8 && count <= math.MaxUint8 {
+		e.byte(small)
+		e.byte(byte(len(items) + 1))
+		e.byte(byte(count))
+	} else {
+		e.byte(large)
+		e.uint32(uint32(len(items) + 4)) //nolint:gosec // frames are bounded by the max frame size
+		e.uint32(uint32(count))          //nolint:gosec // frames are bounded by the max frame size
+	}
+	e.buf = append(e.buf, items...)
+}
+
+func (e *encoder) list(items []any) error {
+	inner := &encoder{}
+	for _, item := range items {
+		if err := inner.encode(item); err != nil {
+			return err
+		}
+	}
+	e.compound(typeList8, typeList32, typeList0, len(items), inner.buf)
+	return nil
+}
+
+func (e *encoder) mapValue(m map[any]any) error {
+	// Keys are sorted so that the encoding is deterministic
+	keys := make([]any, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+	inner := &encoder{}
+	for _, k := range keys {
+		if err := inner.encode(k); err != nil {
+			return err
+		}
+		if err := inner.encode(m[k]); err != nil {
+			return err
+		}
+	}
+	e.compound(typeMap8, typeMap32, 0, len(m)*2, inner.buf)
+	return nil
+}
+
+// symbolArray encodes an array of symbols, always with the sym32 element constructor
+func (e *encoder) symbolArray(items []Symbol) error {
+	inner := &encoder{}
+	inner.byte(typeSymbol32)
+	for _, item := range items {
+		inner.uint32(uint32(len(item))) //nolint:gosec // frames are bounded by the max frame size
+		inner.buf = append(inner.buf, item...)
+	}
+	e.byte(typeArray32)
+	e.uint32(uint32(len(inner.buf) + 4)) //nolint:gosec // frames are bounded by the max frame size
+	e.uint32(uint32(len(items)))         //nolint:gosec // frames are bounded by the max frame size
+	e.buf = append(e.buf, inner.buf...)
+	return nil
+}
+
+// Marshal encodes the values one after the other
+func Marshal(values ...any) ([]byte, error) {
+	e := &encoder{}
+	for _, v := range values {
+		if err := e.encode(v); err != nil {
+			return nil, err
+		}
+	}
+	return e.buf, nil
+}
+
+// decoder reads AMQP values from a buffer
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *decoder) remaining() int {
+	return len(d.buf) - d.pos
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || d.remaining() < n {
+		return nil, errShortBuffer
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) readByte() (byte, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *decoder) readUint32() (uint32, error) {
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (d *decoder) readUint64() (uint64, error) {
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// decode reads a value with its constructor
+func (d *decoder) decode() (any, error) {
+	code, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if code == typeDescribed {
+		descriptor, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		return &Described{Descriptor: descriptor, Value: value}, nil
+	}
+	return d.decodeValue(code)
+}
+
+// size reads the size of a variable or compound value
+func (d *decoder) size(small bool) (int, error) {
+	if small {
+		b, err := d.readByte()
+		return int(b), err
+	}
+	n, err := d.readUint32()
+	if err != nil {
+		return 0, err
+	}
+	if int64(n) > int64(d.remaining()) {
+		return 0, errShortBuffer
+	}
+	return int(n), nil
+}
+
+// decodeValue reads the value of a constructor
+func (d *decoder) decodeValue(code byte) (any, error) {
+	switch code {
+	case typeNull:
+		return nil, nil
+	case typeTrue:
+		return true, nil
+	case typeFalse:
+		return false, nil
+	case typeBool:
+		b, err := d.readByte()
+		return b != 0, err
+	case typeUint0:
+		return uint32(0), nil
+	case typeUlong0:
+		return uint64(0), nil
+	case typeUbyte:
+		return d.readByte()
+	case typeByte:
+		b, err := d.readByte()
+		return int8(b), err //nolint:gosec // two's complement decoding
+	case typeSmallUint:
+		b, err := d.readByte()
+		return uint32(b), err
+	case typeSmallUlong:
+		b, err := d.readByte()
+		return uint64(b), err
+	case typeSmallInt:
+		b, err := d.readByte()
+		return int32(int8(b)), err //nolint:gosec // two's complement decoding
+	case typeSmallLong:
+		b, err := d.readByte()
+		return int64(int8(b)), err //nolint:gosec // two's complement decoding
+	case typeUshort, typeShort:
+		b, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		v := binary.BigEndian.Uint16(b)
+		if code == typeShort {
+			return int16(v), nil //nolint:gosec // two's complement decoding
+		}
+		return v, nil
+	case typeUint, typeInt, typeFloat, typeChar, typeDecimal32:
+		v, err := d.readUint32()
+		if err != nil {
+			return nil, err
+		}
+		switch code {
+		case typeInt:
+			return int32(v), nil //nolint:gosec // two's complement decoding
+		case typeFloat:
+			return math.Float32frombits(v), nil
+		case typeChar:
+			return rune(v), nil //nolint:gosec // UTF-32 code point
+		}
+		return v, nil
+	case typeUlong, typeLong, typeDouble, typeTimestamp, typeDecimal64:
+		v, err := d.readUint64()
+		if err != nil {
+			return nil, err
+		}
+		switch code {
+		case typeLong:
+			return int64(v), nil //nolint:gosec // two's complement decoding
+		case typeDouble:
+			return math.Float64frombits(v), nil
+		case typeTimestamp:
+			return time.UnixMilli(int64(v)).UTC(), nil //nolint:gosec // two's complement decoding
+		}
+		return v, nil
+	case typeUUID:
+		b, err := d.next(16)
+		if err != nil {
+			return nil, err
+		}
+		var u UUID
+		copy(u[:], b)
+		return u, nil
+	case typeBinary8, typeBinary32, typeString8, typeString32, typeSymbol8, typeSymbol32:
+		n, err := d.size(code&0xf0 == 0xa0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		switch code {
+		case typeString8, typeString32:
+			return string(b), nil
+		case typeSymbol8, typeSymbol32:
+			return Symbol(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case typeList0:
+		return []any{}, nil
+	case typeList8, typeList32, typeMap8, typeMap32:
+		return d.decodeCompound(code)
+	case typeArray8, typeArray32:
+		return d.decodeArray(code == typeArray8)
+	}
+	return nil, fmt.Errorf("amqp: unsupported type code 0x%02x", code)
+}
+
+func (d *decoder) decodeCompound(code byte) (any, error) {
+	small := code == typeList8 || code == typeMap8
+	size, err := d.size(small)
+	if err != nil {
+		return nil, err
+	}
+	body, err := d.next(size)
+	if err != nil {
+		return nil, err
+	}
+	inner := &decoder{buf: body}
+	count, err := inner.size(small)
+	if err != nil {
+		return nil, err
+	}
+	if count > len(body) {
+		return nil, errShortBuffer
+	}
+	items := make([]any, 0, count)
+	for range count {
+		item, err := inner.decode()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if code == typeList8 || code == typeList32 {
+		return items, nil
+	}
+	if count%2 != 0 {
+		return nil, errors.New("amqp: map with an odd number of items")
+	}
+	m := make(map[any]any, count/2)
+	for i := 0; i < count; i += 2 {
+		key := items[i]
+		if b, ok := key.([]byte); ok {
+			key = string(b)
+		}
+		m[key] = items[i+1]
+	}
+	return m, nil
+}
+
+func (d *decoder) decodeArray(small bool) (any, error) {
+	size, err := d.size(small)
+	if err != nil {
+		return nil, err
+	}
+	body, err := d.next(size)
+	if err != nil {
+		return nil, err
+	}
+	inner := &decoder{buf: body}
+	count, err := inner.size(small)
+	if err != nil {
+		return nil, err
+	}
+	if count > len(body) {
+		return nil, errShortBuffer
+	}
+	code, err := inner.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var descriptor any
+	if code == typeDescribed {
+		if descriptor, err = inner.decode(); err != nil {
+			return nil, err
+		}
+		if code, err = inner.readByte(); err != nil {
+			return nil, err
+		}
+	}
+	items := make([]any, 0, count)
+	for range count {
+		item, err := inner.decodeValue(code)
+		if err != nil {
+			return nil, err
+		}
+		if descriptor != nil {
+			item = &Described{Descriptor: descriptor, Value: item}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Unmarshal decodes a single value
+func Unmarshal(data []byte) (any, error) {
+	d := &decoder{buf: data}
+	return d.decode()
+}
+
+// Accessors converting the decoded values of optional fields
+
+func AsString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case Symbol:
+		return string(v)
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+func AsUint32(v any) uint32 {
+	switch v := v.(type) {
+	case uint32:
+		return v
+	case uint16:
+		return uint32(v)
+	case uint8:
+		return uint32(v)
+	}
+	return 0
+}
+
+func AsBool(v any) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+// AsStrings converts arrays and lists of strings or symbols, and single symbols
+func AsStrings(v any) []string {
+	switch v := v.(type) {
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, AsString(item))
+		}
+		return out
+	case Symbol, string:
+		return []string{AsString(v)}
+	}
+	return nil
+}
+
+// Stringify formats a decoded value as metadata
+func Stringify(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case Symbol:
+		return string(v)
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case UUID:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16])
+	}
+	return fmt.Sprint(v)
+}
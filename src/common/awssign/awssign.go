@@ -0,0 +1,223 @@
+// Package awssign signs the requests to the AWS services with Signature Version 4, in the
+// Authorization header (e.g. the S3 requests) or in the query string of presigned URLs
+// (e.g. the WebSocket URL of AWS IoT Core).
+package awssign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Algorithm is the signing algorithm of Signature Version 4
+	Algorithm = "AWS4-HMAC-SHA256"
+	// UnsignedPayload is the payload hash of the requests whose payload is not signed
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+	// EmptyPayloadHash is the SHA-256 of an empty payload
+	EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	dateTimeFormat = "20060102T150405Z"
+	dateFormat     = "20060102"
+)
+
+// Credentials are the AWS credentials signing the requests
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is the token of temporary credentials
+	SessionToken string
+}
+
+// SignRequest signs the request in the Authorization header, with the host and every header
+// set on the request. payloadHash is the hex SHA-256 of the payload or UnsignedPayload; the
+// S3 requests must also send it in X-Amz-Content-Sha256, set before signing.
+func SignRequest(req *http.Request, creds Credentials, region, service, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(dateTimeFormat))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	names := []string{"host"}
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		value := req.URL.Host
+		if name != "host" {
+			value = strings.Join(req.Header.Values(name), ",")
+		}
+		// Sequential spaces are collapsed
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL),
+		CanonicalQuery(req.URL.Query()),
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	signature := sign(creds.SecretAccessKey, now, region, service, canonicalRequest)
+
+	scope := credentialScope(now.Format(dateFormat), region, service)
+	req.Header.Set("Authorization", Algorithm+" Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// PresignOptions are the request parts of a presigned URL
+type PresignOptions struct {
+	Method  string
+	Service string
+	Region  string
+	// Expires is the validity of the URL (0 omits X-Amz-Expires)
+	Expires time.Duration
+	// PayloadHash is the hex SHA-256 of the payload, or UnsignedPayload
+	PayloadHash string
+	// TokenAfterSigning appends the session token after the signature, as required by
+	// AWS IoT Core, instead of signing it
+	TokenAfterSigning bool
+}
+
+// Presign returns the URL with the Signature Version 4 query authentication, signing only
+// the host header
+func Presign(u *url.URL, creds Credentials, opts PresignOptions, now time.Time) *url.URL {
+	now = now.UTC()
+	date := now.Format(dateFormat)
+	scope := credentialScope(date, opts.Region, opts.Service)
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", Algorithm)
+	query.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.Format(dateTimeFormat))
+	if opts.Expires > 0 {
+		query.Set("X-Amz-Expires", strconv.Itoa(int(opts.Expires.Seconds())))
+	}
+	query.Set("X-Amz-SignedHeaders", "host")
+	if creds.SessionToken != "" && !opts.TokenAfterSigning {
+		query.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		opts.Method,
+		canonicalPath(u),
+		CanonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		opts.PayloadHash,
+	}, "\n")
+	signature := sign(creds.SecretAccessKey, now, opts.Region, opts.Service, canonicalRequest)
+
+	rawQuery := CanonicalQuery(query) + "&X-Amz-Signature=" + signature
+	if creds.SessionToken != "" && opts.TokenAfterSigning {
+		rawQuery += "&X-Amz-Security-Token=" + URIEncode(creds.SessionToken)
+	}
+	signed := *u
+	signed.RawQuery = rawQuery
+	return &signed
+}
+
+// sign returns the hex signature of a canonical request
+func sign(secret string, now time.Time, region, service, canonicalRequest string) string {
+	date := now.Format(dateFormat)
+	stringToSign := strings.Join([]string{
+		Algorithm,
+		now.Format(dateTimeFormat),
+		credentialScope(date, region, service),
+		PayloadHash([]byte(canonicalRequest)),
+	}, "\n")
+	return hex.EncodeToString(hmacSHA256(SigningKey(secret, date, region, service), stringToSign))
+}
+
+func credentialScope(date, region, service string) string {
+	return date + "/" + region + "/" + service + "/aws4_request"
+}
+
+// SigningKey derives the Signature Version 4 key of the date (YYYYMMDD), region and service
+func SigningKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// PayloadHash returns the hex SHA-256 of a payload
+func PayloadHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// CanonicalQuery sorts and encodes the query parameters
+func CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, URIEncode(k)+"="+URIEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// canonicalPath returns the escaped path of the URL, "/" when empty
+func canonicalPath(u *url.URL) string {
+	if path := u.EscapedPath(); path != "" {
+		return path
+	}
+	return "/"
+}
+
+// URIEncode percent-encodes every byte except the unreserved characters
+func URIEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+	}
+	return b.String()
+}
+
+// EscapePath escapes every byte of the path but the unreserved characters and the slashes,
+// e.g. to set the RawPath of the S3 object URLs
+func EscapePath(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,151 @@
+// Package checkpoint persists the read positions of sources (journal cursors, event record ids)
+// and commits them in order, once the messages read up to a position are processed.
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// File is a set of named positions saved as a JSON object. With an empty path
+// the positions are only kept in memory.
+type File struct {
+	path      string
+	mu        sync.Mutex
+	positions map[string]string
+	dirty     bool
+}
+
+// Open loads the positions of the file; a missing file has no positions
+func Open(path string) (*File, error) {
+	f := &File{path: path, positions: map[string]string{}}
+	if path == "" {
+		return f, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &f.positions); err != nil {
+			return nil, fmt.Errorf("invalid checkpoint file %s: %w", path, err)
+		}
+	}
+	return f, nil
+}
+
+// Get returns the position of the key
+func (f *File) Get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.positions[key]
+	return value, ok
+}
+
+// Set updates the position of the key; it is saved by the next Flush
+func (f *File) Set(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.positions[key] == value {
+		return
+	}
+	f.positions[key] = value
+	f.dirty = true
+}
+
+// Flush saves the positions when changed. The file is replaced atomically.
+func (f *File) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.dirty || f.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(f.positions, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()           //nolint:errcheck
+		os.Remove(tmp.Name()) //nolint:errcheck
+		return fmt.Errorf("failed to write checkpoint file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name()) //nolint:errcheck
+		return fmt.Errorf("failed to write checkpoint file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		os.Remove(tmp.Name()) //nolint:errcheck
+		return fmt.Errorf("failed to replace checkpoint file: %w", err)
+	}
+	f.dirty = false
+	return nil
+}
+
+// Tracker commits the positions of a stream to the key of a file in order: a position
+// is committed once it and all the positions tracked before it are done, so that a
+// restart resumes after the last position processed without gaps.
+type Tracker struct {
+	file    *File
+	key     string
+	mu      sync.Mutex
+	pending []*Position
+}
+
+// Position is a tracked position of a stream
+type Position struct {
+	tracker *Tracker
+	value   string
+	done    bool
+}
+
+// Tracker returns the tracker committing the positions of the key
+func (f *File) Tracker(key string) *Tracker {
+	return &Tracker{file: f, key: key}
+}
+
+// Track appends the position read from the stream
+func (t *Tracker) Track(value string) *Position {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := &Position{tracker: t, value: value}
+	t.pending = append(t.pending, p)
+	return p
+}
+
+// Pending returns the number of positions not committed yet
+func (t *Tracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+// Done marks the position as processed, committing it and the following done
+// positions when the previous ones are committed. Calling Done again is a no-op.
+func (p *Position) Done() {
+	t := p.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p.done = true
+
+	n := 0
+	for n < len(t.pending) && t.pending[n].done {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	t.file.Set(t.key, t.pending[n-1].value)
+	clear(t.pending[:n])
+	t.pending = t.pending[n:]
+}
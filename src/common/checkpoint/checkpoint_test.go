@@ -0,0 +1,68 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrackerCommitsInOrder(t *testing.T) {
+	f, err := Open("")
+	if err != nil {
+		t.Fatalf("Open() unexpected error = %v", err)
+	}
+	tr := f.Tracker("stream")
+	a, b, c := tr.Track("1"), tr.Track("2"), tr.Track("3")
+
+	b.Done()
+	if _, ok := f.Get("stream"); ok {
+		t.Fatalf("position committed before the previous ones are done")
+	}
+	a.Done()
+	if got, _ := f.Get("stream"); got != "2" {
+		t.Errorf("position = %q, want 2", got)
+	}
+	a.Done()
+	c.Done()
+	if got, _ := f.Get("stream"); got != "3" || tr.Pending() != 0 {
+		t.Errorf("position = %q, pending = %d, want 3 and 0", got, tr.Pending())
+	}
+}
+
+func TestFileFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "positions.json")
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() unexpected error = %v", err)
+	}
+	if err := f.Flush(); err != nil {
+		t.Fatalf("Flush() unexpected error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("unchanged positions written")
+	}
+
+	f.Set("System", "42")
+	f.Set("Application", "7")
+	if err := f.Flush(); err != nil {
+		t.Fatalf("Flush() unexpected error = %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() unexpected error = %v", err)
+	}
+	if got, _ := reopened.Get("System"); got != "42" {
+		t.Errorf("position = %q, want 42", got)
+	}
+	if got, _ := reopened.Get("Application"); got != "7" {
+		t.Errorf("position = %q, want 7", got)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Errorf("Open() expected error for an invalid file")
+	}
+}
@@ -42,3 +42,44 @@ func TestCopyMapWithDest(t *testing.T) {
 		t.Errorf("Expected existing key to remain unchanged with value 'existingValue', got '%s'", result["existingKey"])
 	}
 }
+
+func TestLookupFold(t *testing.T) {
+	meta := map[string]string{"Content-Type": "text/plain", "x-id": "1"}
+
+	if v := LookupFold(meta, "content-type"); v != "text/plain" {
+		t.Errorf("Expected 'text/plain', got '%s'", v)
+	}
+	if v := LookupFold(meta, "x-id"); v != "1" {
+		t.Errorf("Expected '1', got '%s'", v)
+	}
+	if v := LookupFold(meta, "missing"); v != "" {
+		t.Errorf("Expected an empty value, got '%s'", v)
+	}
+}
+
+func TestDeleteFold(t *testing.T) {
+	meta := map[string]string{"Content-Type": "text/plain", "content-type": "application/json", "x-id": "1"}
+
+	DeleteFold(meta, "CONTENT-TYPE")
+	if len(meta) != 1 || meta["x-id"] != "1" {
+		t.Errorf("Expected only 'x-id' to remain, got %v", meta)
+	}
+}
+
+func TestRangeString(t *testing.T) {
+	lo, hi := 0.5, 100.0
+	tests := []struct {
+		minValue, maxValue *float64
+		want               string
+	}{
+		{&lo, &hi, "[0.5, 100]"},
+		{&lo, nil, "[0.5, +inf]"},
+		{nil, &hi, "[-inf, 100]"},
+		{nil, nil, "[-inf, +inf]"},
+	}
+	for _, tt := range tests {
+		if got := RangeString(tt.minValue, tt.maxValue); got != tt.want {
+			t.Errorf("RangeString() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package configmigrate upgrades the options of connectors written for older versions
+// of their configuration. A connector declares the migrations of its options, each
+// upgrading a version to the next by renaming, removing or rewriting options; the
+// options declare the version they were written for in "configVersion", and options
+// without it are upgraded from the oldest version. Every upgraded option is reported
+// as a deprecation naming its new equivalent, so that configuration files keep working
+// across upgrades while their authors are told how to update them.
+package configmigrate
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// VersionKey is the option declaring the configuration version of the options
+const VersionKey = "configVersion"
+
+// Migration upgrades the options of version From to version From+1. The renames are
+// applied first, then the removals and finally Func.
+type Migration struct {
+	// From is the version upgraded
+	From int
+	// Renames maps the dotted paths of the renamed options to their new paths
+	Renames map[string]string
+	// Removed maps the dotted paths of the options no longer supported to the
+	// explanation reported with the deprecation
+	Removed map[string]string
+	// Func rewrites the options in place for the changes that are not renames or
+	// removals (e.g. a value converted to a new format), returning their deprecations
+	Func func(options map[string]any) ([]Deprecation, error)
+}
+
+// Deprecation is an option of an older version upgraded by a migration
+type Deprecation struct {
+	// Option is the dotted path of the deprecated option
+	Option string
+	// Replacement is the dotted path of the new equivalent, empty when removed
+	Replacement string
+	// Version is the version deprecating the option
+	Version int
+	// Message explains the change
+	Message string
+}
+
+func (d Deprecation) String() string {
+	s := fmt.Sprintf("option %q is deprecated since config version %d", d.Option, d.Version)
+	if d.Replacement != "" {
+		s += fmt.Sprintf(", use %q", d.Replacement)
+	}
+	if d.Message != "" {
+		s += ": " + d.Message
+	}
+	return s
+}
+
+// Latest returns the current version of the options upgraded by the migrations,
+// 1 without migrations
+func Latest(migrations []Migration) int {
+	latest := 1
+	for _, m := range migrations {
+		latest = max(latest, m.From+1)
+	}
+	return latest
+}
+
+// Apply upgrades a copy of the options to the latest version, returning it without
+// the version key together with the deprecated options found. The options of a
+// version newer than the latest are rejected.
+func Apply(options map[string]any, migrations []Migration) (map[string]any, []Deprecation, error) {
+	latest := Latest(migrations)
+	sorted := slices.Clone(migrations)
+	slices.SortFunc(sorted, func(a, b Migration) int { return a.From - b.From })
+
+	version := 1
+	if len(sorted) > 0 {
+		version = sorted[0].From
+	}
+	if v, ok := options[VersionKey]; ok {
+		var err error
+		if version, err = parseVersion(v); err != nil {
+			return nil, nil, err
+		}
+	}
+	if version > latest {
+		return nil, nil, fmt.Errorf("config version %d is newer than the supported version %d", version, latest)
+	}
+
+	out := deepCopy(options)
+	delete(out, VersionKey)
+	var deprecations []Deprecation
+	for _, m := range sorted {
+		if m.From < version {
+			continue
+		}
+		found, err := m.apply(out)
+		if err != nil {
+			return nil, nil, fmt.Errorf("config migration from version %d: %w", m.From, err)
+		}
+		deprecations = append(deprecations, found...)
+	}
+	return out, deprecations, nil
+}
+
+func (m Migration) apply(options map[string]any) ([]Deprecation, error) {
+	var deprecations []Deprecation
+	// Sorted for the deprecations to be reported in a stable order
+	for _, from := range slices.Sorted(maps.Keys(m.Renames)) {
+		to := m.Renames[from]
+		v, ok := lookup(options, from)
+		if !ok {
+			continue
+		}
+		if _, ok := lookup(options, to); ok {
+			return nil, fmt.Errorf("options %q and %q are both set, remove the deprecated %q", from, to, from)
+		}
+		remove(options, from)
+		if err := set(options, to, v); err != nil {
+			return nil, err
+		}
+		deprecations = append(deprecations, Deprecation{Option: from, Replacement: to, Version: m.From + 1})
+	}
+	for _, path := range slices.Sorted(maps.Keys(m.Removed)) {
+		if _, ok := lookup(options, path); ok {
+			remove(options, path)
+			deprecations = append(deprecations, Deprecation{Option: path, Version: m.From + 1, Message: m.Removed[path]})
+		}
+	}
+	if m.Func != nil {
+		found, err := m.Func(options)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range found {
+			if d.Version == 0 {
+				d.Version = m.From + 1
+			}
+			deprecations = append(deprecations, d)
+		}
+	}
+	return deprecations, nil
+}
+
+func parseVersion(v any) (int, error) {
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid %s %v: must be an integer", VersionKey, v)
+}
+
+// deepCopy copies the nested option maps, which the migrations modify
+func deepCopy(options map[string]any) map[string]any {
+	out := make(map[string]any, len(options))
+	for k, v := range options {
+		if m, ok := v.(map[string]any); ok {
+			v = deepCopy(m)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// lookup returns the option at the dotted path
+func lookup(options map[string]any, path string) (any, bool) {
+	segs := strings.Split(path, ".")
+	for _, seg := range segs[:len(segs)-1] {
+		next, ok := options[seg].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		options = next
+	}
+	v, ok := options[segs[len(segs)-1]]
+	return v, ok
+}
+
+// remove deletes the option at the dotted path
+func remove(options map[string]any, path string) {
+	segs := strings.Split(path, ".")
+	for _, seg := range segs[:len(segs)-1] {
+		next, ok := options[seg].(map[string]any)
+		if !ok {
+			return
+		}
+		options = next
+	}
+	delete(options, segs[len(segs)-1])
+}
+
+// set sets the option at the dotted path, creating the intermediate maps
+func set(options map[string]any, path string, v any) error {
+	segs := strings.Split(path, ".")
+	for i, seg := range segs[:len(segs)-1] {
+		next, ok := options[seg]
+		if !ok {
+			child := map[string]any{}
+			options[seg] = child
+			options = child
+			continue
+		}
+		child, ok := next.(map[string]any)
+		if !ok {
+			return fmt.Errorf("option %q is not an object", strings.Join(segs[:i+1], "."))
+		}
+		options = child
+	}
+	options[segs[len(segs)-1]] = v
+	return nil
+}
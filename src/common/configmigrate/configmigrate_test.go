@@ -0,0 +1,118 @@
+package configmigrate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var migrations = []Migration{
+	// Declared out of order: Apply sorts them by version
+	{
+		From:    2,
+		Renames: map[string]string{"tls.skipVerify": "tls.insecureSkipVerify"},
+		Func: func(options map[string]any) ([]Deprecation, error) {
+			if v, ok := options["timeoutMs"].(int); ok {
+				delete(options, "timeoutMs")
+				options["timeout"] = v * 1000
+				return []Deprecation{{Option: "timeoutMs", Replacement: "timeout", Message: "now a duration"}}, nil
+			}
+			return nil, nil
+		},
+	},
+	{
+		From:    1,
+		Renames: map[string]string{"addr": "address", "user": "auth.username"},
+		Removed: map[string]string{"legacy": "no longer needed"},
+	},
+}
+
+func TestApply(t *testing.T) {
+	for name, tc := range map[string]struct {
+		options      map[string]any
+		want         map[string]any
+		deprecations []Deprecation
+	}{
+		"unversioned from the oldest version": {
+			options: map[string]any{"addr": "a:1", "user": "u", "legacy": true, "tls": map[string]any{"skipVerify": true}, "timeoutMs": 2},
+			want:    map[string]any{"address": "a:1", "auth": map[string]any{"username": "u"}, "tls": map[string]any{"insecureSkipVerify": true}, "timeout": 2000},
+			deprecations: []Deprecation{
+				{Option: "addr", Replacement: "address", Version: 2},
+				{Option: "user", Replacement: "auth.username", Version: 2},
+				{Option: "legacy", Version: 2, Message: "no longer needed"},
+				{Option: "tls.skipVerify", Replacement: "tls.insecureSkipVerify", Version: 3},
+				{Option: "timeoutMs", Replacement: "timeout", Version: 3, Message: "now a duration"},
+			},
+		},
+		"versioned skips the older migrations": {
+			options: map[string]any{VersionKey: "2", "addr": "kept", "tls": map[string]any{"skipVerify": true}},
+			want:    map[string]any{"addr": "kept", "tls": map[string]any{"insecureSkipVerify": true}},
+			deprecations: []Deprecation{
+				{Option: "tls.skipVerify", Replacement: "tls.insecureSkipVerify", Version: 3},
+			},
+		},
+		"current version": {
+			options: map[string]any{VersionKey: 3.0, "address": "a:1"},
+			want:    map[string]any{"address": "a:1"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, deprecations, err := Apply(tc.options, migrations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Apply() = %v, want %v", got, tc.want)
+			}
+			if !reflect.DeepEqual(deprecations, tc.deprecations) {
+				t.Errorf("deprecations = %v, want %v", deprecations, tc.deprecations)
+			}
+		})
+	}
+}
+
+func TestApplyDoesNotModifyOptions(t *testing.T) {
+	options := map[string]any{"tls": map[string]any{"skipVerify": true}}
+	if _, _, err := Apply(options, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(options, map[string]any{"tls": map[string]any{"skipVerify": true}}) {
+		t.Errorf("options modified: %v", options)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		options map[string]any
+		err     string
+	}{
+		"newer version":   {map[string]any{VersionKey: 4}, "newer than the supported version 3"},
+		"invalid version": {map[string]any{VersionKey: "v2"}, "invalid configVersion"},
+		"old and new set": {map[string]any{"addr": "a", "address": "b"}, `"addr" and "address" are both set`},
+		"not an object":   {map[string]any{"user": "u", "auth": "token"}, `option "auth" is not an object`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := Apply(tc.options, migrations); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Apply() error = %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestApplyWithoutMigrations(t *testing.T) {
+	got, deprecations, err := Apply(map[string]any{VersionKey: 1, "a": 1}, nil)
+	if err != nil || len(deprecations) != 0 || !reflect.DeepEqual(got, map[string]any{"a": 1}) {
+		t.Errorf("Apply() = %v, %v, %v", got, deprecations, err)
+	}
+	if _, _, err := Apply(map[string]any{VersionKey: 2}, nil); err == nil {
+		t.Error("expected error for a version without migrations")
+	}
+}
+
+func TestDeprecationString(t *testing.T) {
+	d := Deprecation{Option: "addr", Replacement: "address", Version: 2, Message: "renamed"}
+	want := `option "addr" is deprecated since config version 2, use "address": renamed`
+	if d.String() != want {
+		t.Errorf("String() = %q, want %q", d.String(), want)
+	}
+}
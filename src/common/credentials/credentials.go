@@ -0,0 +1,260 @@
+// Package credentials provides rotating connector credentials. A Provider fetches
+// the credentials from a static configuration, a watched file, a Vault secret lease
+// or an OAuth2 client-credentials token endpoint, and refreshes them proactively
+// before they expire. Subscribers are notified of the rotated credentials after a
+// random delay, so that the connections of many connectors are re-established
+// gradually instead of all at once.
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	TypeStatic = "static"
+	TypeFile   = "file"
+	TypeVault  = "vault"
+	TypeOAuth2 = "oauth2"
+
+	defaultPollInterval = 30 * time.Second
+	defaultRefreshRatio = 0.8
+	defaultTimeout      = 10 * time.Second
+	minRefreshDelay     = time.Second
+)
+
+// Config defines the credentials source of a connector
+type Config struct {
+	// Type is the credentials source: "static", "file", "vault" or "oauth2"
+	Type string `mapstructure:"type" validate:"required,oneof=static file vault oauth2"`
+
+	// Username, Password and Token are the static credentials (support env: and file: secrets)
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"` //nolint:gosec // user-configured credential field
+	Token    string `mapstructure:"token"`    //nolint:gosec // user-configured credential field
+
+	// Path is the credentials file of the "file" type: a JSON object with username, password,
+	// token and expiry (RFC 3339) fields, or a plain text token
+	Path string `mapstructure:"path" validate:"required_if=Type file"`
+
+	// Vault configures the "vault" type
+	Vault *VaultConfig `mapstructure:"vault" validate:"required_if=Type vault"`
+
+	// OAuth2 configures the "oauth2" type
+	OAuth2 *OAuth2Config `mapstructure:"oauth2" validate:"required_if=Type oauth2"`
+
+	// PollInterval is the refresh interval of credentials without expiry, e.g. the file watch interval
+	PollInterval time.Duration `mapstructure:"pollInterval" default:"30s" validate:"min=0"`
+
+	// RefreshRatio is the fraction of the credentials lifetime after which they are refreshed
+	RefreshRatio float64 `mapstructure:"refreshRatio" default:"0.8" validate:"min=0,max=1"`
+
+	// Jitter is the maximum random spread of the refreshes and of the reconnections of the subscribers
+	Jitter time.Duration `mapstructure:"jitter" default:"10s" validate:"min=0"`
+
+	// Timeout bounds the requests to Vault and to the token endpoint
+	Timeout time.Duration `mapstructure:"timeout" default:"10s" validate:"min=0"`
+}
+
+// Credentials are the credentials fetched by a provider
+type Credentials struct {
+	Username string
+	Password string //nolint:gosec // credential value
+	Token    string //nolint:gosec // credential value
+	// Expiry is the expiration time, zero when the credentials do not expire
+	Expiry time.Time
+}
+
+// HasToken reports whether the credentials hold a token rather than a username and password
+func (c Credentials) HasToken() bool {
+	return c.Token != ""
+}
+
+// fetchFunc fetches the current credentials from the source
+type fetchFunc func(ctx context.Context) (Credentials, error)
+
+// Provider holds the current credentials and refreshes them in the background
+type Provider struct {
+	cfg     *Config
+	slog    *slog.Logger
+	fetch   fetchFunc
+	mu      sync.RWMutex
+	current Credentials
+	subs    []func(Credentials)
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	once    sync.Once
+	now     func() time.Time
+}
+
+// New creates a provider, fetching the initial credentials. The background refresh
+// is started for every type except "static".
+func New(cfg *Config, logger *slog.Logger) (*Provider, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("credentials config cannot be nil")
+	}
+
+	var fetch fetchFunc
+	var err error
+	switch cfg.Type {
+	case TypeStatic:
+		fetch, err = newStaticFetch(cfg)
+	case TypeFile:
+		fetch, err = newFileFetch(cfg)
+	case TypeVault:
+		fetch, err = newVaultFetch(cfg)
+	case TypeOAuth2:
+		fetch, err = newOAuth2Fetch(cfg)
+	default:
+		err = fmt.Errorf("unsupported credentials type: %s", cfg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := newProvider(cfg, logger, fetch)
+	if err := p.refresh(); err != nil {
+		return nil, fmt.Errorf("initial credentials fetch failed: %w", err)
+	}
+	p.slog.Info("credentials provider initialized", "type", cfg.Type, "expiry", p.current.Expiry)
+
+	if cfg.Type != TypeStatic {
+		p.wg.Add(1)
+		go p.refreshLoop()
+	}
+	return p, nil
+}
+
+func newProvider(cfg *Config, logger *slog.Logger, fetch fetchFunc) *Provider {
+	return &Provider{
+		cfg:    cfg,
+		slog:   logger.With("component", "Credentials Provider"),
+		fetch:  fetch,
+		stopCh: make(chan struct{}),
+		now:    time.Now,
+	}
+}
+
+// Current returns the current credentials
+func (p *Provider) Current() Credentials {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.current
+}
+
+// Subscribe registers a callback called with the new credentials after every rotation.
+// Every callback is delayed by a random time up to the configured jitter.
+func (p *Provider) Subscribe(fn func(Credentials)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subs = append(p.subs, fn)
+}
+
+// refresh fetches the credentials and notifies the subscribers when they changed
+func (p *Provider) refresh() error {
+	timeout := p.cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	creds, err := p.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	changed := p.current != creds
+	p.current = creds
+	subs := p.subs
+	p.mu.Unlock()
+
+	if changed && len(subs) > 0 {
+		p.slog.Info("credentials rotated", "type", p.cfg.Type, "expiry", creds.Expiry, "subscribers", len(subs))
+		for _, fn := range subs {
+			p.notify(fn, creds)
+		}
+	}
+	return nil
+}
+
+// notify calls the subscriber after a random delay, unless the provider is closed first
+func (p *Provider) notify(fn func(Credentials), creds Credentials) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		timer := time.NewTimer(p.jitter())
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			fn(creds)
+		case <-p.stopCh:
+		}
+	}()
+}
+
+// refreshLoop refreshes the credentials before they expire, retrying failures with backoff
+func (p *Provider) refreshLoop() {
+	defer p.wg.Done()
+	delay := p.nextRefresh(p.Current())
+	backoff := minRefreshDelay
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-p.stopCh:
+			timer.Stop()
+			return
+		}
+
+		if err := p.refresh(); err != nil {
+			p.slog.Error("credentials refresh failed", "type", p.cfg.Type, "retryIn", backoff, "error", err)
+			delay = backoff
+			backoff = min(backoff*2, p.pollInterval())
+			continue
+		}
+		backoff = minRefreshDelay
+		delay = p.nextRefresh(p.Current())
+	}
+}
+
+// nextRefresh returns the wait before the next refresh: a fraction of the credentials
+// lifetime minus a random jitter, or the poll interval for credentials without expiry
+func (p *Provider) nextRefresh(creds Credentials) time.Duration {
+	if creds.Expiry.IsZero() {
+		return p.pollInterval()
+	}
+	ratio := p.cfg.RefreshRatio
+	if ratio <= 0 || ratio >= 1 {
+		ratio = defaultRefreshRatio
+	}
+	lifetime := creds.Expiry.Sub(p.now())
+	delay := time.Duration(float64(lifetime)*ratio) - p.jitter()
+	return max(delay, minRefreshDelay)
+}
+
+func (p *Provider) pollInterval() time.Duration {
+	if p.cfg.PollInterval > 0 {
+		return p.cfg.PollInterval
+	}
+	return defaultPollInterval
+}
+
+// jitter returns a random duration up to the configured jitter
+func (p *Provider) jitter() time.Duration {
+	if p.cfg.Jitter <= 0 {
+		return 0
+	}
+	return rand.N(p.cfg.Jitter) //nolint:gosec // spreading reconnections, not security sensitive
+}
+
+// Close stops the background refresh and the pending notifications
+func (p *Provider) Close() {
+	p.once.Do(func() { close(p.stopCh) })
+	p.wg.Wait()
+}
@@ -0,0 +1,187 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+func TestStaticProvider(t *testing.T) {
+	t.Setenv("EB_TEST_CREDENTIALS_PASSWORD", "s3cret")
+	p, err := New(&Config{Type: TypeStatic, Username: "user", Password: "env:EB_TEST_CREDENTIALS_PASSWORD"}, newTestLogger())
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	defer p.Close()
+
+	creds := p.Current()
+	if creds.Username != "user" || creds.Password != "s3cret" || creds.HasToken() {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+}
+
+func TestFileProviderRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "creds.json")
+	writeFile := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(`{"username":"user","password":"v1"}`)
+
+	p, err := New(&Config{Type: TypeFile, Path: path, PollInterval: 10 * time.Millisecond}, newTestLogger())
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	defer p.Close()
+
+	rotated := make(chan Credentials, 1)
+	p.Subscribe(func(c Credentials) { rotated <- c })
+
+	writeFile(`{"username":"user","password":"v2"}`)
+	select {
+	case c := <-rotated:
+		if c.Password != "v2" || p.Current().Password != "v2" {
+			t.Errorf("unexpected rotated credentials %+v", c)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber not notified of the rotation")
+	}
+}
+
+func TestParseCredentialsFile(t *testing.T) {
+	creds, err := parseCredentialsFile([]byte("  token-value\n"))
+	if err != nil || creds.Token != "token-value" {
+		t.Errorf("unexpected token file result %+v, %v", creds, err)
+	}
+	creds, err = parseCredentialsFile([]byte(`{"token":"t","expiry":"2030-01-02T03:04:05Z"}`))
+	if err != nil || creds.Token != "t" || creds.Expiry.Year() != 2030 {
+		t.Errorf("unexpected JSON file result %+v, %v", creds, err)
+	}
+	if _, err := parseCredentialsFile([]byte(" ")); err == nil {
+		t.Error("expected error for empty file")
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/rabbitmq/creds/producer" || r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{ //nolint:errcheck
+			"lease_duration": 3600,
+			"data":           map[string]any{"username": "v-user", "password": "v-pass"},
+		})
+	}))
+	defer srv.Close()
+
+	p, err := New(&Config{Type: TypeVault, Vault: &VaultConfig{Address: srv.URL, Token: "root", Path: "rabbitmq/creds/producer"}}, newTestLogger())
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	defer p.Close()
+
+	creds := p.Current()
+	if creds.Username != "v-user" || creds.Password != "v-pass" || time.Until(creds.Expiry) < 59*time.Minute {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+
+	if _, err := New(&Config{Type: TypeVault, Vault: &VaultConfig{Address: srv.URL, Token: "wrong", Path: "rabbitmq/creds/producer"}}, newTestLogger()); err == nil {
+		t.Error("expected error for rejected Vault token")
+	}
+}
+
+func TestOAuth2Provider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "a b" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "at-1", "expires_in": 300}) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	p, err := New(&Config{Type: TypeOAuth2, OAuth2: &OAuth2Config{TokenURL: srv.URL, ClientID: "client", ClientSecret: "secret", Scopes: []string{"a", "b"}}}, newTestLogger())
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	defer p.Close()
+
+	if creds := p.Current(); creds.Token != "at-1" || creds.Expiry.IsZero() {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+}
+
+func TestNextRefresh(t *testing.T) {
+	now := time.Now()
+	p := newProvider(&Config{RefreshRatio: 0.5, Jitter: time.Minute, PollInterval: time.Hour}, newTestLogger(), nil)
+	p.now = func() time.Time { return now }
+
+	if d := p.nextRefresh(Credentials{}); d != time.Hour {
+		t.Errorf("expected poll interval without expiry, got %v", d)
+	}
+	d := p.nextRefresh(Credentials{Expiry: now.Add(time.Hour)})
+	if d > 30*time.Minute || d <= 29*time.Minute {
+		t.Errorf("expected refresh at half of the lifetime minus jitter, got %v", d)
+	}
+	if d := p.nextRefresh(Credentials{Expiry: now.Add(-time.Hour)}); d != minRefreshDelay {
+		t.Errorf("expected minimum delay for expired credentials, got %v", d)
+	}
+}
+
+func TestRefreshNotifiesWithJitter(t *testing.T) {
+	var mu sync.Mutex
+	version := "v1"
+	p := newProvider(&Config{Jitter: 50 * time.Millisecond}, newTestLogger(), func(context.Context) (Credentials, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if version == "" {
+			return Credentials{}, errors.New("unavailable")
+		}
+		return Credentials{Token: version}, nil
+	})
+	if err := p.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for range 3 {
+		p.Subscribe(func(c Credentials) {
+			if c.Token == "v2" {
+				wg.Done()
+			}
+		})
+	}
+
+	mu.Lock()
+	version = "v2"
+	mu.Unlock()
+	if err := p.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	// A failed refresh keeps the current credentials
+	mu.Lock()
+	version = ""
+	mu.Unlock()
+	if err := p.refresh(); err == nil || p.Current().Token != "v2" {
+		t.Errorf("expected failed refresh keeping the credentials, got %v", p.Current())
+	}
+	p.Close()
+}
@@ -0,0 +1,208 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/fetch"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+)
+
+// maxResponseSize bounds the responses of Vault and of the token endpoint
+const maxResponseSize = 1 << 20
+
+// VaultConfig reads the credentials from a Vault secret, e.g. a database or
+// broker dynamic secret with a lease, or a KV secret
+type VaultConfig struct {
+	// Address is the Vault server address (e.g. https://vault.local:8200)
+	Address string `mapstructure:"address" validate:"required,url"`
+	// Token is the Vault token (supports env: and file: secrets)
+	Token string `mapstructure:"token" validate:"required"` //nolint:gosec // user-configured credential field
+	// Path is the secret path (e.g. "rabbitmq/creds/producer" or "secret/data/kafka")
+	Path string `mapstructure:"path" validate:"required"`
+	// UsernameKey, PasswordKey and TokenKey are the secret data keys of the credentials
+	UsernameKey string `mapstructure:"usernameKey" default:"username"`
+	PasswordKey string `mapstructure:"passwordKey" default:"password"`
+	TokenKey    string `mapstructure:"tokenKey" default:"token"`
+}
+
+// OAuth2Config requests access tokens with the OAuth2 client-credentials grant
+type OAuth2Config struct {
+	// TokenURL is the token endpoint
+	TokenURL string `mapstructure:"tokenUrl" validate:"required,url"`
+	// ClientID and ClientSecret are the client credentials (the secret supports env: and file: secrets)
+	ClientID     string `mapstructure:"clientId" validate:"required"`
+	ClientSecret string `mapstructure:"clientSecret" validate:"required"` //nolint:gosec // user-configured credential field
+	// Scopes are the requested scopes
+	Scopes []string `mapstructure:"scopes"`
+	// Audience is the requested audience, for providers requiring it
+	Audience string `mapstructure:"audience"`
+}
+
+// newStaticFetch returns the configured credentials
+func newStaticFetch(cfg *Config) (fetchFunc, error) {
+	password, err := secrets.Resolve(cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve password: %w", err)
+	}
+	token, err := secrets.Resolve(cfg.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve token: %w", err)
+	}
+	creds := Credentials{Username: cfg.Username, Password: password, Token: token}
+	return func(context.Context) (Credentials, error) {
+		return creds, nil
+	}, nil
+}
+
+// newFileFetch reads the credentials file, e.g. a secret mounted by Kubernetes or written by an agent
+func newFileFetch(cfg *Config) (fetchFunc, error) {
+	return fetch.File(cfg.Path, "credentials", parseCredentialsFile)
+}
+
+// parseCredentialsFile parses a JSON credentials object or a plain text token
+func parseCredentialsFile(content []byte) (Credentials, error) {
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 {
+		return Credentials{}, fmt.Errorf("credentials file is empty")
+	}
+	if content[0] != '{' {
+		return Credentials{Token: string(content)}, nil
+	}
+	var file struct {
+		Username string    `json:"username"`
+		Password string    `json:"password"`
+		Token    string    `json:"token"`
+		Expiry   time.Time `json:"expiry"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return Credentials{}, fmt.Errorf("invalid credentials file: %w", err)
+	}
+	return Credentials(file), nil
+}
+
+// newVaultFetch reads the Vault secret; the lease duration sets the credentials expiry
+func newVaultFetch(cfg *Config) (fetchFunc, error) {
+	vc := cfg.Vault
+	if vc == nil {
+		return nil, fmt.Errorf("vault configuration is required")
+	}
+	token, err := secrets.Resolve(vc.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve Vault token: %w", err)
+	}
+	endpoint, err := url.JoinPath(vc.Address, "v1", vc.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Vault address: %w", err)
+	}
+	client := &http.Client{}
+
+	return func(ctx context.Context) (Credentials, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return Credentials{}, err
+		}
+		req.Header.Set("X-Vault-Token", token)
+
+		var secret struct {
+			LeaseDuration int            `json:"lease_duration"`
+			Data          map[string]any `json:"data"`
+		}
+		if err := doJSON(client, req, &secret); err != nil {
+			return Credentials{}, fmt.Errorf("vault read failed: %w", err)
+		}
+
+		data := secret.Data
+		// KV version 2 secrets nest the values in data.data
+		if nested, ok := data["data"].(map[string]any); ok {
+			data = nested
+		}
+		creds := Credentials{
+			Username: stringValue(data, vc.UsernameKey, "username"),
+			Password: stringValue(data, vc.PasswordKey, "password"),
+			Token:    stringValue(data, vc.TokenKey, "token"),
+		}
+		if secret.LeaseDuration > 0 {
+			creds.Expiry = time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+		}
+		return creds, nil
+	}, nil
+}
+
+// newOAuth2Fetch requests an access token with the client-credentials grant
+func newOAuth2Fetch(cfg *Config) (fetchFunc, error) {
+	oc := cfg.OAuth2
+	if oc == nil {
+		return nil, fmt.Errorf("oauth2 configuration is required")
+	}
+	secret, err := secrets.Resolve(oc.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve client secret: %w", err)
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(oc.Scopes) > 0 {
+		form.Set("scope", strings.Join(oc.Scopes, " "))
+	}
+	if oc.Audience != "" {
+		form.Set("audience", oc.Audience)
+	}
+	body := form.Encode()
+	client := &http.Client{}
+
+	return func(ctx context.Context) (Credentials, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, oc.TokenURL, strings.NewReader(body))
+		if err != nil {
+			return Credentials{}, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(url.QueryEscape(oc.ClientID), url.QueryEscape(secret))
+
+		var token struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}
+		if err := doJSON(client, req, &token); err != nil {
+			return Credentials{}, fmt.Errorf("token request failed: %w", err)
+		}
+		if token.AccessToken == "" {
+			return Credentials{}, fmt.Errorf("token response without access_token")
+		}
+		creds := Credentials{Token: token.AccessToken}
+		if token.ExpiresIn > 0 {
+			creds.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+		}
+		return creds, nil
+	}, nil
+}
+
+// doJSON sends the request and decodes the JSON response of a 2xx status
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req) //nolint:gosec // user-configured endpoint
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(out); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// stringValue returns the string value of the key, or of the fallback key when the key is empty
+func stringValue(data map[string]any, key, fallback string) string {
+	if key == "" {
+		key = fallback
+	}
+	s, _ := data[key].(string)
+	return s
+}
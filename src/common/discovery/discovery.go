@@ -0,0 +1,268 @@
+// Package discovery resolves the endpoints of a connector address through DNS: the SRV
+// records of a service, or every A and AAAA record of a host such as a Kubernetes
+// headless service. The endpoints are re-resolved periodically, and every new
+// connection to the address is balanced across them on the client side.
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	TypeSRV = "srv"
+	TypeDNS = "dns"
+
+	StrategyRoundRobin = "round-robin"
+	StrategyRandom     = "random"
+
+	defaultRefresh     = 30 * time.Second
+	defaultDialTimeout = 10 * time.Second
+	lookupTimeout      = 5 * time.Second
+)
+
+// Config configures the DNS discovery of the endpoints of a connector address
+type Config struct {
+	// Type is "dns" (every A/AAAA record of the address host) or "srv" (the SRV records of Name)
+	Type string `mapstructure:"type" default:"dns" validate:"omitempty,oneof=dns srv"`
+	// Name is the SRV record name (e.g. "_client._tcp.nats.default.svc.cluster.local")
+	Name string `mapstructure:"name" validate:"required_if=Type srv"`
+	// Refresh is the re-resolution interval
+	Refresh time.Duration `mapstructure:"refresh" default:"30s" validate:"min=0"`
+	// Strategy selects the endpoint of every new connection: "round-robin" or "random"
+	Strategy string `mapstructure:"strategy" default:"round-robin" validate:"omitempty,oneof=round-robin random"`
+}
+
+// Resolver holds the discovered endpoints of an address and dials them
+type Resolver struct {
+	cfg        *Config
+	host       string
+	port       string
+	slog       *slog.Logger
+	lookupSRV  func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	dialer     net.Dialer
+	mu         sync.RWMutex
+	endpoints  []string
+	next       atomic.Uint64
+	stopCh     chan struct{}
+	wg         sync.WaitGroup
+	once       sync.Once
+}
+
+// New creates a resolver of the address ("host:port"), resolving the initial endpoints
+// and starting the periodic re-resolution. The connections to other addresses, such as
+// the cluster members advertised by a broker, are not affected.
+func New(cfg *Config, address string, logger *slog.Logger) (*Resolver, error) {
+	r, err := newResolver(cfg, address, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.resolve(); err != nil {
+		return nil, fmt.Errorf("initial endpoint discovery failed: %w", err)
+	}
+	r.slog.Info("endpoints discovered", "address", address, "type", r.cfg.Type, "endpoints", r.Endpoints())
+
+	r.wg.Add(1)
+	go r.refreshLoop()
+	return r, nil
+}
+
+func newResolver(cfg *Config, address string, logger *slog.Logger) (*Resolver, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("discovery config cannot be nil")
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil && cfg.Type != TypeSRV {
+		return nil, fmt.Errorf("dns discovery requires a host:port address: %w", err)
+	}
+	if err != nil {
+		host = address
+	}
+	if cfg.Type == TypeSRV && cfg.Name == "" {
+		return nil, fmt.Errorf("srv discovery requires a record name")
+	}
+	return &Resolver{
+		cfg:        cfg,
+		host:       host,
+		port:       port,
+		slog:       logger.With("component", "Endpoint Discovery"),
+		lookupSRV:  net.DefaultResolver.LookupSRV,
+		lookupHost: net.DefaultResolver.LookupHost,
+		dialer:     net.Dialer{Timeout: defaultDialTimeout},
+		stopCh:     make(chan struct{}),
+	}, nil
+}
+
+// Endpoints returns the current endpoints
+func (r *Resolver) Endpoints() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.endpoints)
+}
+
+// Pick returns the endpoint of a new connection according to the strategy
+func (r *Resolver) Pick() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.endpoints[r.start(len(r.endpoints))]
+}
+
+// start returns the index of the first endpoint tried by a new connection
+func (r *Resolver) start(n int) int {
+	if r.cfg.Strategy == StrategyRandom {
+		return rand.IntN(n) //nolint:gosec // load balancing, not security sensitive
+	}
+	return int((r.next.Add(1) - 1) % uint64(n)) //nolint:gosec // n is a positive endpoint count
+}
+
+// Matches reports whether the address ("host:port" or "host") is the discovered one
+func (r *Resolver) Matches(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return strings.EqualFold(host, r.host)
+}
+
+// DialContext connects to the discovered endpoints of the address, trying them in turn
+// from the one picked by the strategy; other addresses are dialed directly
+func (r *Resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if !r.Matches(address) {
+		return r.dialer.DialContext(ctx, network, address)
+	}
+	r.mu.RLock()
+	endpoints := r.endpoints
+	r.mu.RUnlock()
+
+	first := r.start(len(endpoints))
+	var errs []error
+	for i := range endpoints {
+		endpoint := endpoints[(first+i)%len(endpoints)]
+		conn, err := r.dialer.DialContext(ctx, network, endpoint)
+		if err == nil {
+			return conn, nil
+		}
+		r.slog.Debug("endpoint dial failed", "endpoint", endpoint, "error", err)
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("all endpoints of %s failed: %w", address, errors.Join(errs...))
+}
+
+// Dial implements the custom dialer interface of the NATS client
+func (r *Resolver) Dial(network, address string) (net.Conn, error) {
+	return r.DialContext(context.Background(), network, address)
+}
+
+// TLSDialer returns a dial function establishing TLS connections when the config is set,
+// verifying the certificate against the configured address host
+func (r *Resolver) TLSDialer(cfg *tls.Config) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := r.DialContext(ctx, network, address)
+		if err != nil || cfg == nil {
+			return conn, err
+		}
+		tlsCfg := cfg.Clone()
+		if tlsCfg.ServerName == "" {
+			tlsCfg.ServerName, _, _ = net.SplitHostPort(address)
+		}
+		tlsConn := tls.Client(conn, tlsCfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close() //nolint:errcheck,gosec
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+// LookupHost implements the resolver interface of the Kafka client: the discovered host
+// resolves to the endpoint picked by the strategy, other hosts are resolved normally
+func (r *Resolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if !strings.EqualFold(host, r.host) {
+		return nil, nil
+	}
+	return []string{r.Pick()}, nil
+}
+
+// resolve looks up the endpoints, keeping the current ones on failure
+func (r *Resolver) resolve() error {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	var endpoints []string
+	switch r.cfg.Type {
+	case TypeSRV:
+		_, records, err := r.lookupSRV(ctx, "", "", r.cfg.Name)
+		if err != nil {
+			return err
+		}
+		// Only the records of the best (lowest) priority are used, as mandated by RFC 2782
+		for _, rec := range records {
+			if rec.Priority != records[0].Priority {
+				continue
+			}
+			endpoints = append(endpoints, net.JoinHostPort(strings.TrimSuffix(rec.Target, "."), fmt.Sprint(rec.Port)))
+		}
+	default:
+		addrs, err := r.lookupHost(ctx, r.host)
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			endpoints = append(endpoints, net.JoinHostPort(addr, r.port))
+		}
+	}
+	if len(endpoints) == 0 {
+		return fmt.Errorf("no endpoints found for %s", r.host)
+	}
+	slices.Sort(endpoints)
+
+	r.mu.Lock()
+	changed := !slices.Equal(r.endpoints, endpoints)
+	r.endpoints = endpoints
+	r.mu.Unlock()
+	if changed {
+		r.slog.Debug("endpoints updated", "host", r.host, "endpoints", endpoints)
+	}
+	return nil
+}
+
+// refreshLoop re-resolves the endpoints at the refresh interval
+func (r *Resolver) refreshLoop() {
+	defer r.wg.Done()
+	interval := r.cfg.Refresh
+	if interval <= 0 {
+		interval = defaultRefresh
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.resolve(); err != nil {
+				r.slog.Warn("endpoint re-resolution failed, keeping the current endpoints", "host", r.host, "error", err)
+			}
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// Close stops the re-resolution
+func (r *Resolver) Close() {
+	r.once.Do(func() { close(r.stopCh) })
+	r.wg.Wait()
+}
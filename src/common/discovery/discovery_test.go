@@ -0,0 +1,183 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func newTestLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// listen starts a listener answering every connection with its own port
+func listen(t *testing.T) *net.TCPAddr {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() }) //nolint:errcheck
+	addr := ln.Addr().(*net.TCPAddr)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(strconv.Itoa(addr.Port))) //nolint:errcheck
+			conn.Close()                                //nolint:errcheck
+		}
+	}()
+	return addr
+}
+
+func srvResolver(t *testing.T, records func() ([]*net.SRV, error)) *Resolver {
+	t.Helper()
+	r, err := newResolver(&Config{Type: TypeSRV, Name: "_nats._tcp.nats.svc"}, "nats.svc:4222", newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.lookupSRV = func(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+		if name != "_nats._tcp.nats.svc" {
+			return "", nil, errors.New("unexpected name")
+		}
+		recs, err := records()
+		return "", recs, err
+	}
+	if err := r.resolve(); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	return r
+}
+
+func readPort(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	defer conn.Close() //nolint:errcheck
+	buf := make([]byte, 16)
+	n, _ := conn.Read(buf)
+	return string(buf[:n])
+}
+
+func TestSRVRoundRobin(t *testing.T) {
+	a, b := listen(t), listen(t)
+	r := srvResolver(t, func() ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "127.0.0.1.", Port: uint16(a.Port), Priority: 10},
+			{Target: "127.0.0.1.", Port: uint16(b.Port), Priority: 10},
+			{Target: "backup.", Port: 1, Priority: 20},
+		}, nil
+	})
+	defer r.Close()
+
+	if eps := r.Endpoints(); len(eps) != 2 {
+		t.Fatalf("expected the endpoints of the best priority only, got %v", eps)
+	}
+	seen := map[string]bool{}
+	for range 4 {
+		conn, err := r.Dial("tcp", "nats.svc:4222")
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		seen[readPort(t, conn)] = true
+	}
+	if !seen[strconv.Itoa(a.Port)] || !seen[strconv.Itoa(b.Port)] {
+		t.Errorf("expected connections balanced across the endpoints, got %v", seen)
+	}
+}
+
+func TestDialSkipsFailedEndpoints(t *testing.T) {
+	a := listen(t)
+	// A closed listener leaves a port refusing connections
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := ln.Addr().(*net.TCPAddr).Port
+	ln.Close() //nolint:errcheck
+
+	r := srvResolver(t, func() ([]*net.SRV, error) {
+		return []*net.SRV{
+			{Target: "127.0.0.1", Port: uint16(a.Port)},
+			{Target: "127.0.0.1", Port: uint16(down)},
+		}, nil
+	})
+	defer r.Close()
+
+	for range 3 {
+		conn, err := r.DialContext(context.Background(), "tcp", "nats.svc:4222")
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		if port := readPort(t, conn); port != strconv.Itoa(a.Port) {
+			t.Errorf("expected the available endpoint, got %s", port)
+		}
+	}
+}
+
+func TestResolveKeepsEndpointsOnFailure(t *testing.T) {
+	fail := false
+	r := srvResolver(t, func() ([]*net.SRV, error) {
+		if fail {
+			return nil, errors.New("SERVFAIL")
+		}
+		return []*net.SRV{{Target: "nats-0.nats.svc.", Port: 4222}}, nil
+	})
+	defer r.Close()
+
+	fail = true
+	if err := r.resolve(); err == nil {
+		t.Fatal("expected resolve error")
+	}
+	if eps := r.Endpoints(); !slices.Equal(eps, []string{"nats-0.nats.svc:4222"}) {
+		t.Errorf("expected the previous endpoints, got %v", eps)
+	}
+}
+
+func TestDNSResolverIPv6(t *testing.T) {
+	r, err := newResolver(&Config{Type: TypeDNS}, "redis-headless:6379", newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.lookupHost = func(context.Context, string) ([]string, error) {
+		return []string{"fd00::2", "10.0.0.1"}, nil
+	}
+	if err := r.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if eps := r.Endpoints(); !slices.Equal(eps, []string{"10.0.0.1:6379", "[fd00::2]:6379"}) {
+		t.Errorf("unexpected endpoints %v", eps)
+	}
+
+	if addrs, _ := r.LookupHost(context.Background(), "other"); addrs != nil {
+		t.Errorf("expected other hosts to resolve normally, got %v", addrs)
+	}
+	first, _ := r.LookupHost(context.Background(), "redis-headless")
+	second, _ := r.LookupHost(context.Background(), "REDIS-HEADLESS")
+	if len(first) != 1 || len(second) != 1 || first[0] == second[0] {
+		t.Errorf("expected round-robin lookups, got %v %v", first, second)
+	}
+
+	if _, err := newResolver(&Config{Type: TypeDNS}, "redis-headless", newTestLogger()); err == nil {
+		t.Error("expected error for address without port")
+	}
+}
+
+func TestNewLocalhost(t *testing.T) {
+	a := listen(t)
+	r, err := New(&Config{}, net.JoinHostPort("localhost", strconv.Itoa(a.Port)), newTestLogger())
+	if err != nil {
+		t.Skipf("localhost not resolvable: %v", err)
+	}
+	defer r.Close()
+
+	conn, err := r.TLSDialer(nil)(context.Background(), "tcp", net.JoinHostPort("localhost", strconv.Itoa(a.Port)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Close() //nolint:errcheck
+}
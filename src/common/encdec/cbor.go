@@ -13,13 +13,139 @@ import (
 
 var _ MessageDecoder = (*CBORDecoder)(nil)
 
+// CBOR encoding profiles
+const (
+	CBORProfileDefault   = "default"
+	CBORProfileCore      = "core"
+	CBORProfileCTAP2     = "ctap2"
+	CBORProfilePreferred = "preferred"
+)
+
+// CBOROptions selects how a CBORDecoder encodes and decodes. Deterministic profiles
+// produce the same bytes for the same value whatever the producer, as required to
+// sign CBOR payloads and verify their signatures.
+type CBOROptions struct {
+	// Profile is the encoding profile: "default", "core" (RFC 8949 core deterministic
+	// encoding: shortest forms, sorted map keys, no indefinite lengths), "ctap2" (CTAP2
+	// canonical encoding) or "preferred" (shortest forms, map keys unsorted).
+	// Deterministic profiles also reject duplicate map keys when decoding.
+	Profile string `mapstructure:"profile" default:"default" validate:"omitempty,oneof=default core ctap2 preferred"`
+	// ForbidTags rejects CBOR tags when encoding and decoding
+	ForbidTags bool `mapstructure:"forbidTags" default:"false"`
+	// TimeFormat is the encoding of times: "unix", "unix-micro", "unix-dynamic", "rfc3339"
+	// or "rfc3339nano" (defaults to the profile format)
+	TimeFormat string `mapstructure:"timeFormat" validate:"omitempty,oneof=unix unix-micro unix-dynamic rfc3339 rfc3339nano"`
+	// TimeTag encodes times with the tag 0 (text) or 1 (epoch)
+	TimeTag bool `mapstructure:"timeTag" default:"false"`
+}
+
+var cborTimeFormats = map[string]cbor.TimeMode{
+	"unix":         cbor.TimeUnix,
+	"unix-micro":   cbor.TimeUnixMicro,
+	"unix-dynamic": cbor.TimeUnixDynamic,
+	"rfc3339":      cbor.TimeRFC3339,
+	"rfc3339nano":  cbor.TimeRFC3339Nano,
+}
+
+// defaultCBOREncMode and defaultCBORDecMode are used by decoders created without options
+var defaultCBOREncMode, defaultCBORDecMode, _ = (*CBOROptions)(nil).Modes()
+
+// Modes returns the encoding and decoding modes of the options; nil options are the defaults
+func (o *CBOROptions) Modes() (cbor.EncMode, cbor.DecMode, error) {
+	var opts CBOROptions
+	if o != nil {
+		opts = *o
+	}
+
+	var enc cbor.EncOptions
+	dec := cbor.DecOptions{}
+	switch opts.Profile {
+	case "", CBORProfileDefault:
+	case CBORProfileCore:
+		enc = cbor.CoreDetEncOptions()
+	case CBORProfileCTAP2:
+		enc = cbor.CTAP2EncOptions()
+	case CBORProfilePreferred:
+		enc = cbor.PreferredUnsortedEncOptions()
+	default:
+		return nil, nil, fmt.Errorf("unknown CBOR profile: %s", opts.Profile)
+	}
+	if opts.Profile == CBORProfileCore || opts.Profile == CBORProfileCTAP2 {
+		dec.DupMapKey = cbor.DupMapKeyEnforcedAPF
+		dec.IndefLength = cbor.IndefLengthForbidden
+	}
+
+	if opts.TimeFormat != "" {
+		mode, ok := cborTimeFormats[opts.TimeFormat]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown CBOR time format: %s", opts.TimeFormat)
+		}
+		enc.Time = mode
+	}
+	if opts.TimeTag {
+		if opts.ForbidTags {
+			return nil, nil, errors.New("CBOR time tags cannot be used when tags are forbidden")
+		}
+		enc.TimeTag = cbor.EncTagRequired
+	}
+	if opts.ForbidTags {
+		enc.TagsMd = cbor.TagsForbidden
+		dec.TagsMd = cbor.TagsForbidden
+	}
+
+	em, err := enc.EncMode()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CBOR encoding options: %w", err)
+	}
+	dm, err := dec.DecMode()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CBOR decoding options: %w", err)
+	}
+	return em, dm, nil
+}
+
 type CBORDecoder struct {
 	dataKey string
 	metaKey string
+	enc     cbor.EncMode
+	dec     cbor.DecMode
+}
+
+// NewCBORDecoder returns a CBOR decoder encoding with the options (the defaults if nil)
+func NewCBORDecoder(opts *CBOROptions, metaKey string, dataKey string) (*CBORDecoder, error) {
+	enc, dec, err := opts.Modes()
+	if err != nil {
+		return nil, err
+	}
+	return &CBORDecoder{metaKey: metaKey, dataKey: dataKey, enc: enc, dec: dec}, nil
+}
+
+func (e *CBORDecoder) encMode() cbor.EncMode {
+	if e.enc == nil {
+		return defaultCBOREncMode
+	}
+	return e.enc
+}
+
+func (e *CBORDecoder) decMode() cbor.DecMode {
+	if e.dec == nil {
+		return defaultCBORDecMode
+	}
+	return e.dec
 }
 
 func (e *CBORDecoder) Encode(d any) ([]byte, error) {
-	return cbor.Marshal(d)
+	return e.encMode().Marshal(d)
+}
+
+// Canonicalize re-encodes a CBOR data item with the options of the decoder, e.g. to
+// compute or verify the signature of a payload with a deterministic profile
+func (e *CBORDecoder) Canonicalize(data []byte) ([]byte, error) {
+	var v any
+	if err := e.decMode().Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return e.encMode().Marshal(v)
 }
 
 func (e *CBORDecoder) EncodeMessage(m message.SourceMessage) ([]byte, error) {
@@ -27,19 +153,19 @@ func (e *CBORDecoder) EncodeMessage(m message.SourceMessage) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return cbor.Marshal(v)
+	return e.encMode().Marshal(v)
 }
 
 func (e *CBORDecoder) DecodeMessage(data []byte) (message.SourceMessage, error) {
 	var v map[string]any
-	if err := cbor.Unmarshal(data, &v); err != nil {
+	if err := e.decMode().Unmarshal(data, &v); err != nil {
 		return nil, err
 	}
 	return mapToMessage(e, v, e.metaKey, e.dataKey)
 }
 
 func (e *CBORDecoder) DecodeStream(in io.Reader) <-chan rill.Try[message.SourceMessage] {
-	dec := cbor.NewDecoder(in)
+	dec := e.decMode().NewDecoder(in)
 	res := make(chan rill.Try[message.SourceMessage])
 
 	go func() {
@@ -3,6 +3,7 @@ package encdec
 import (
 	"bytes"
 	"testing"
+	"time"
 )
 
 func TestCBORDecoder_Encode(t *testing.T) {
@@ -77,3 +78,90 @@ func TestCBORDecoder_DecodeStream(t *testing.T) {
 		t.Fatalf("Expected 1 message, got %d", count)
 	}
 }
+
+func TestCBORDecoder_CoreDeterministic(t *testing.T) {
+	// {"b": 1, "a": [1, 2]} encoded with unsorted keys and an indefinite-length array
+	unsorted := []byte{0xa2, 0x61, 'b', 0x01, 0x61, 'a', 0x9f, 0x01, 0x02, 0xff}
+	sorted := []byte{0xa2, 0x61, 'a', 0x82, 0x01, 0x02, 0x61, 'b', 0x01}
+
+	def, err := NewCBORDecoder(nil, "meta", "data")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	canonical, err := def.Canonicalize(unsorted)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	core, err := NewCBORDecoder(&CBOROptions{Profile: CBORProfileCore}, "meta", "data")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	canonical, err = core.Canonicalize(canonical)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !bytes.Equal(canonical, sorted) {
+		t.Fatalf("Expected % x, got % x", sorted, canonical)
+	}
+
+	// The same map built in any order encodes to the same bytes
+	for range 10 {
+		encoded, err := core.Encode(map[string]any{"b": 1, "a": []int{1, 2}})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !bytes.Equal(encoded, sorted) {
+			t.Fatalf("Expected % x, got % x", sorted, encoded)
+		}
+	}
+
+	// Indefinite lengths and duplicate keys are not deterministic
+	if _, err := core.Canonicalize(unsorted); err == nil {
+		t.Fatal("Expected error for indefinite-length array")
+	}
+	if _, err := core.Canonicalize([]byte{0xa2, 0x61, 'a', 0x01, 0x61, 'a', 0x02}); err == nil {
+		t.Fatal("Expected error for duplicate map keys")
+	}
+}
+
+func TestCBORDecoder_TimeAndTags(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	dec, err := NewCBORDecoder(&CBOROptions{TimeFormat: "rfc3339"}, "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	encoded, err := dec.Encode(ts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := append([]byte{0x74}, "2024-05-01T12:00:00Z"...); !bytes.Equal(encoded, want) {
+		t.Fatalf("Expected % x, got % x", want, encoded)
+	}
+
+	dec, err = NewCBORDecoder(&CBOROptions{TimeFormat: "unix", TimeTag: true}, "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if encoded, err = dec.Encode(ts); err != nil || encoded[0] != 0xc1 {
+		t.Fatalf("Expected epoch time tag, got % x (%v)", encoded, err)
+	}
+
+	forbid, err := NewCBORDecoder(&CBOROptions{ForbidTags: true}, "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := forbid.Canonicalize(encoded); err == nil {
+		t.Fatal("Expected error for tagged data item")
+	}
+
+	for _, opts := range []*CBOROptions{
+		{Profile: "canonical"},
+		{TimeFormat: "iso"},
+		{ForbidTags: true, TimeTag: true},
+	} {
+		if _, err := NewMessageDecoderWithOptions("cbor", "", "", opts); err == nil {
+			t.Errorf("Expected error for %+v", opts)
+		}
+	}
+}
@@ -17,6 +17,12 @@ type MessageDecoder interface {
 }
 
 func NewMessageDecoder(encType string, metaKey string, dataKey string) (MessageDecoder, error) {
+	return NewMessageDecoderWithOptions(encType, metaKey, dataKey, nil)
+}
+
+// NewMessageDecoderWithOptions returns a decoder of the type; cborOpts selects the
+// CBOR encoding profile (the defaults if nil) and is ignored by the other types
+func NewMessageDecoderWithOptions(encType string, metaKey string, dataKey string, cborOpts *CBOROptions) (MessageDecoder, error) {
 	encType = strings.ToLower(encType)
 	switch encType {
 	case "json":
@@ -25,10 +31,7 @@ func NewMessageDecoder(encType string, metaKey string, dataKey string) (MessageD
 			dataKey: dataKey,
 		}, nil
 	case "cbor":
-		return &CBORDecoder{
-			metaKey: metaKey,
-			dataKey: dataKey,
-		}, nil
+		return NewCBORDecoder(cborOpts, metaKey, dataKey)
 	case "cli", "cliformat":
 		return &CLIDecoder{}, nil
 	}
@@ -0,0 +1,300 @@
+// Package endpoints maintains the dynamic endpoint list of a target, e.g. the instances of
+// an autoscaled downstream consumer. The base URLs of the endpoints are fetched from a
+// static list, a watched file, an HTTP endpoint or DNS records, refreshed periodically and
+// health-checked; every request is balanced across the healthy endpoints.
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	TypeStatic = "static"
+	TypeFile   = "file"
+	TypeHTTP   = "http"
+	TypeDNS    = "dns"
+	TypeSRV    = "srv"
+
+	StrategyRoundRobin = "round-robin"
+	StrategyRandom     = "random"
+
+	defaultRefresh = 30 * time.Second
+	defaultTimeout = 5 * time.Second
+)
+
+// ErrNoHealthyEndpoint is returned by Pick when every endpoint failed its health checks
+var ErrNoHealthyEndpoint = errors.New("no healthy endpoint")
+
+// Config defines the endpoint source of a target and the health checks of the endpoints.
+// The endpoints are base URLs (scheme://host[:port][/path]).
+type Config struct {
+	// Type is the endpoints source: "static", "file", "http", "dns" or "srv"
+	Type string `mapstructure:"type" validate:"required,oneof=static file http dns srv"`
+
+	// Endpoints are the base URLs of the "static" type
+	Endpoints []string `mapstructure:"endpoints" validate:"required_if=Type static,dive,url"`
+
+	// Path is the file of the "file" type: a JSON array of base URLs, or one base URL per
+	// line (# starts a comment). The file is read again at every refresh.
+	Path string `mapstructure:"path" validate:"required_if=Type file"`
+
+	// URL is the endpoint list of the "http" type, answering a JSON array of base URLs
+	// or an object with an "endpoints" array
+	URL string `mapstructure:"url" validate:"required_if=Type http,omitempty,url"`
+
+	// Headers are sent with the requests to URL (values support env: and file: secrets)
+	Headers map[string]string `mapstructure:"headers"`
+
+	// Name is the host name of the "dns" type (every A and AAAA record) or the SRV record
+	// name of the "srv" type
+	Name string `mapstructure:"name" validate:"required_if=Type dns,required_if=Type srv"`
+
+	// Port is the port of the "dns" endpoints; SRV endpoints use the record ports
+	Port int `mapstructure:"port" validate:"required_if=Type dns,omitempty,min=1,max=65535"`
+
+	// Scheme is the URL scheme of the DNS endpoints (default: http)
+	Scheme string `mapstructure:"scheme" validate:"omitempty,oneof=http https"`
+
+	// Refresh is the interval between two fetches of the endpoint list (default: 30s)
+	Refresh time.Duration `mapstructure:"refresh" validate:"min=0"`
+
+	// Timeout bounds the fetches of the endpoint list (default: 5s)
+	Timeout time.Duration `mapstructure:"timeout" validate:"min=0"`
+
+	// Strategy selects the endpoint of every request: "round-robin" (default) or "random"
+	Strategy string `mapstructure:"strategy" validate:"omitempty,oneof=round-robin random"`
+
+	// HealthCheck configures the active health checks of the endpoints (optional)
+	HealthCheck *HealthCheckConfig `mapstructure:"healthCheck"`
+}
+
+// Endpoint is the state of an endpoint
+type Endpoint struct {
+	URL     string
+	Healthy bool
+}
+
+// endpointState tracks the consecutive health check results of an endpoint
+type endpointState struct {
+	url       string
+	healthy   bool
+	failures  int
+	successes int
+}
+
+// fetchFunc fetches the current endpoint list from the source
+type fetchFunc func(ctx context.Context) ([]string, error)
+
+// Registry holds the endpoints of a target, refreshing and health-checking them in the background
+type Registry struct {
+	cfg       *Config
+	slog      *slog.Logger
+	fetch     fetchFunc
+	check     checkFunc
+	mu        sync.RWMutex
+	endpoints []*endpointState
+	next      atomic.Uint64
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	once      sync.Once
+}
+
+// New creates a registry, fetching the initial endpoints and starting the periodic
+// refresh and health checks
+func New(cfg *Config, logger *slog.Logger) (*Registry, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("endpoints config cannot be nil")
+	}
+
+	var fetch fetchFunc
+	var err error
+	switch cfg.Type {
+	case TypeStatic:
+		fetch = newStaticFetch(cfg)
+	case TypeFile:
+		fetch, err = newFileFetch(cfg)
+	case TypeHTTP:
+		fetch, err = newHTTPFetch(cfg)
+	case TypeDNS, TypeSRV:
+		fetch, err = newDNSFetch(cfg, lookups{})
+	default:
+		err = fmt.Errorf("unsupported endpoints type: %s", cfg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var check checkFunc
+	if cfg.HealthCheck != nil {
+		if check, err = newCheck(cfg.HealthCheck); err != nil {
+			return nil, err
+		}
+	}
+
+	r := newRegistry(cfg, logger, fetch, check)
+	if err := r.refresh(); err != nil {
+		return nil, fmt.Errorf("initial endpoints fetch failed: %w", err)
+	}
+	r.slog.Info("endpoints registry initialized", "type", cfg.Type, "endpoints", r.Endpoints())
+	r.start()
+	return r, nil
+}
+
+func newRegistry(cfg *Config, logger *slog.Logger, fetch fetchFunc, check checkFunc) *Registry {
+	return &Registry{
+		cfg:    cfg,
+		slog:   logger.With("component", "Endpoints Registry"),
+		fetch:  fetch,
+		check:  check,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// start runs the refresh loop, except for static lists, and the health check loop
+func (r *Registry) start() {
+	if r.cfg.Type != TypeStatic {
+		r.wg.Add(1)
+		go r.loop(interval(r.cfg.Refresh, defaultRefresh), func() {
+			if err := r.refresh(); err != nil {
+				r.slog.Warn("endpoints refresh failed, keeping the current endpoints", "error", err)
+			}
+		})
+	}
+	if r.check != nil {
+		r.wg.Add(1)
+		go r.loop(interval(r.cfg.HealthCheck.Interval, defaultCheckInterval), r.checkAll)
+	}
+}
+
+// Endpoints returns the current endpoints
+func (r *Registry) Endpoints() []Endpoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]Endpoint, len(r.endpoints))
+	for i, e := range r.endpoints {
+		res[i] = Endpoint{URL: e.url, Healthy: e.healthy}
+	}
+	return res
+}
+
+// Pick returns the base URL of a healthy endpoint according to the strategy
+func (r *Registry) Pick() (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	healthy := make([]string, 0, len(r.endpoints))
+	for _, e := range r.endpoints {
+		if e.healthy {
+			healthy = append(healthy, e.url)
+		}
+	}
+	if len(healthy) == 0 {
+		return "", ErrNoHealthyEndpoint
+	}
+	if r.cfg.Strategy == StrategyRandom {
+		return healthy[rand.IntN(len(healthy))], nil //nolint:gosec // load balancing, not security sensitive
+	}
+	return healthy[(r.next.Add(1)-1)%uint64(len(healthy))], nil //nolint:gosec // positive endpoint count
+}
+
+// refresh fetches the endpoint list and applies the changes. The endpoints kept keep
+// their health state; the new ones are checked before they receive requests.
+func (r *Registry) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), interval(r.cfg.Timeout, defaultTimeout))
+	defer cancel()
+	urls, err := r.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	urls, err = normalize(urls)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("the endpoint list is empty")
+	}
+
+	r.mu.RLock()
+	current := make(map[string]*endpointState, len(r.endpoints))
+	for _, e := range r.endpoints {
+		current[e.url] = e
+	}
+	r.mu.RUnlock()
+
+	var added []*endpointState
+	states := make([]*endpointState, len(urls))
+	for i, u := range urls {
+		if e, ok := current[u]; ok {
+			states[i] = e
+			continue
+		}
+		states[i] = &endpointState{url: u, healthy: true}
+		added = append(added, states[i])
+	}
+	if r.check != nil {
+		r.runChecks(added, true)
+	}
+
+	r.mu.Lock()
+	removed := len(r.endpoints) - (len(urls) - len(added))
+	r.endpoints = states
+	r.mu.Unlock()
+	if len(added) > 0 || removed > 0 {
+		r.slog.Info("endpoints updated", "endpoints", len(urls), "added", len(added), "removed", removed)
+	}
+	return nil
+}
+
+// normalize validates the base URLs, trimming the trailing slashes, and returns them
+// sorted and without duplicates
+func normalize(urls []string) ([]string, error) {
+	res := make([]string, 0, len(urls))
+	for _, raw := range urls {
+		raw = strings.TrimRight(strings.TrimSpace(raw), "/")
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q: expected an http(s) base URL", raw)
+		}
+		res = append(res, raw)
+	}
+	slices.Sort(res)
+	return slices.Compact(res), nil
+}
+
+// loop calls fn at every interval until the registry is closed
+func (r *Registry) loop(every time.Duration, fn func()) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fn()
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// interval returns the configured duration, or the fallback when unset
+func interval(d, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// Close stops the refresh and the health checks
+func (r *Registry) Close() {
+	r.once.Do(func() { close(r.stopCh) })
+	r.wg.Wait()
+}
@@ -0,0 +1,247 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// listFetch serves the endpoint list held by the returned pointer
+func listFetch(urls ...string) (fetchFunc, *atomic.Pointer[[]string]) {
+	var list atomic.Pointer[[]string]
+	list.Store(&urls)
+	return func(context.Context) ([]string, error) {
+		return *list.Load(), nil
+	}, &list
+}
+
+// healthFunc reports the endpoints listed in the returned map as unhealthy
+func healthFunc() (checkFunc, *atomic.Pointer[map[string]bool]) {
+	var down atomic.Pointer[map[string]bool]
+	down.Store(&map[string]bool{})
+	return func(_ context.Context, endpoint string) error {
+		if (*down.Load())[endpoint] {
+			return errors.New("down")
+		}
+		return nil
+	}, &down
+}
+
+func healthy(r *Registry) []string {
+	var res []string
+	for _, e := range r.Endpoints() {
+		if e.Healthy {
+			res = append(res, e.URL)
+		}
+	}
+	return res
+}
+
+func TestRegistryPickRoundRobin(t *testing.T) {
+	fetch, _ := listFetch("http://b:80/", "http://a:80", "http://b:80")
+	r := newRegistry(&Config{Type: TypeStatic}, newTestLogger(), fetch, nil)
+	if err := r.refresh(); err != nil {
+		t.Fatalf("refresh() unexpected error = %v", err)
+	}
+
+	var picks []string
+	for range 4 {
+		u, err := r.Pick()
+		if err != nil {
+			t.Fatalf("Pick() unexpected error = %v", err)
+		}
+		picks = append(picks, u)
+	}
+	want := []string{"http://a:80", "http://b:80", "http://a:80", "http://b:80"}
+	if !slices.Equal(picks, want) {
+		t.Errorf("picks = %v, want %v", picks, want)
+	}
+}
+
+func TestRegistryHealthChecks(t *testing.T) {
+	fetch, list := listFetch("http://a", "http://b")
+	check, down := healthFunc()
+	down.Store(&map[string]bool{"http://b": true})
+	r := newRegistry(&Config{Type: TypeHTTP, HealthCheck: &HealthCheckConfig{}}, newTestLogger(), fetch, check)
+
+	// New endpoints are checked before they receive requests
+	if err := r.refresh(); err != nil {
+		t.Fatalf("refresh() unexpected error = %v", err)
+	}
+	if got := healthy(r); !slices.Equal(got, []string{"http://a"}) {
+		t.Fatalf("healthy = %v, want only a", got)
+	}
+
+	// An endpoint is unhealthy after 2 consecutive failures, healthy again after a success
+	down.Store(&map[string]bool{"http://a": true})
+	r.checkAll()
+	if got := healthy(r); !slices.Equal(got, []string{"http://a", "http://b"}) {
+		t.Errorf("healthy after a single failure = %v", got)
+	}
+	r.checkAll()
+	if got := healthy(r); !slices.Equal(got, []string{"http://b"}) {
+		t.Errorf("healthy after two failures = %v", got)
+	}
+
+	down.Store(&map[string]bool{"http://a": true, "http://b": true})
+	r.checkAll()
+	r.checkAll()
+	if _, err := r.Pick(); !errors.Is(err, ErrNoHealthyEndpoint) {
+		t.Errorf("Pick() error = %v, want ErrNoHealthyEndpoint", err)
+	}
+
+	// The endpoints kept by a refresh keep their health state
+	down.Store(&map[string]bool{})
+	list.Store(&[]string{"http://b", "http://c"})
+	if err := r.refresh(); err != nil {
+		t.Fatalf("refresh() unexpected error = %v", err)
+	}
+	if got := healthy(r); !slices.Equal(got, []string{"http://c"}) {
+		t.Errorf("healthy after refresh = %v, want only c", got)
+	}
+	r.checkAll()
+	if got := healthy(r); !slices.Equal(got, []string{"http://b", "http://c"}) {
+		t.Errorf("healthy after recovery = %v", got)
+	}
+}
+
+func TestRegistryRefreshErrors(t *testing.T) {
+	for name, urls := range map[string][]string{
+		"empty":     {},
+		"no scheme": {"10.0.0.1:8080"},
+		"ftp":       {"ftp://files.local"},
+	} {
+		fetch, _ := listFetch(urls...)
+		r := newRegistry(&Config{Type: TypeHTTP}, newTestLogger(), fetch, nil)
+		if err := r.refresh(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestNewFileRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints.txt")
+	if err := os.WriteFile(path, []byte("# consumers\nhttp://a:8080\nhttp://b:8080 # canary\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(&Config{Type: TypeFile, Path: path}, newTestLogger())
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	t.Cleanup(r.Close)
+	if got := healthy(r); !slices.Equal(got, []string{"http://a:8080", "http://b:8080"}) {
+		t.Fatalf("endpoints = %v", got)
+	}
+
+	if err := os.WriteFile(path, []byte(`["http://c:8080"]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.refresh(); err != nil {
+		t.Fatalf("refresh() unexpected error = %v", err)
+	}
+	if got := healthy(r); !slices.Equal(got, []string{"http://c:8080"}) {
+		t.Errorf("endpoints after the file change = %v", got)
+	}
+}
+
+func TestNewHTTPRegistryWithHealthCheck(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(up.Close)
+	list := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"endpoints": ["` + up.URL + `", "http://127.0.0.1:1"]}`)) //nolint:errcheck
+	}))
+	t.Cleanup(list.Close)
+
+	r, err := New(&Config{
+		Type:        TypeHTTP,
+		URL:         list.URL,
+		Headers:     map[string]string{"Authorization": "Bearer t0k3n"},
+		HealthCheck: &HealthCheckConfig{Path: "/ready"},
+	}, newTestLogger())
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+	t.Cleanup(r.Close)
+	if got := healthy(r); !slices.Equal(got, []string{up.URL}) {
+		t.Errorf("healthy = %v, want %s", got, up.URL)
+	}
+
+	if _, err := New(&Config{Type: TypeHTTP, URL: list.URL}, newTestLogger()); err == nil {
+		t.Error("New() expected error for an unauthorized list request")
+	}
+}
+
+func TestTCPHealthCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() }) //nolint:errcheck
+	check, err := newCheck(&HealthCheckConfig{Type: CheckTCP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check(t.Context(), "http://"+ln.Addr().String()); err != nil {
+		t.Errorf("check of a listening endpoint: %v", err)
+	}
+	if err := check(t.Context(), "http://127.0.0.1:1"); err == nil {
+		t.Error("check of a closed port: expected error")
+	}
+}
+
+func TestDNSFetch(t *testing.T) {
+	l := lookups{
+		host: func(_ context.Context, host string) ([]string, error) {
+			return []string{"10.0.0.2", "fd00::1"}, nil
+		},
+		srv: func(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+			return "", []*net.SRV{
+				{Target: "a.consumers.svc.", Port: 8443, Priority: 1},
+				{Target: "b.consumers.svc.", Port: 8443, Priority: 1},
+				{Target: "backup.consumers.svc.", Port: 8443, Priority: 2},
+			}, nil
+		},
+	}
+
+	fetch, err := newDNSFetch(&Config{Type: TypeDNS, Name: "consumers.svc", Port: 8080}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fetch(t.Context())
+	if err != nil || !slices.Equal(got, []string{"http://10.0.0.2:8080", "http://[fd00::1]:8080"}) {
+		t.Errorf("dns endpoints = %v, %v", got, err)
+	}
+
+	fetch, err = newDNSFetch(&Config{Type: TypeSRV, Name: "_https._tcp.consumers.svc", Scheme: "https"}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = fetch(t.Context())
+	if err != nil || !slices.Equal(got, []string{"https://a.consumers.svc:8443", "https://b.consumers.svc:8443"}) {
+		t.Errorf("srv endpoints = %v, %v", got, err)
+	}
+
+	if _, err := newDNSFetch(&Config{Type: TypeDNS, Name: "consumers.svc"}, l); err == nil {
+		t.Error("dns without port: expected error")
+	}
+}
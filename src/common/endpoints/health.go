@@ -0,0 +1,149 @@
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	CheckHTTP = "http"
+	CheckTCP  = "tcp"
+
+	defaultCheckInterval      = 10 * time.Second
+	defaultCheckTimeout       = 2 * time.Second
+	defaultCheckPath          = "/health"
+	defaultUnhealthyThreshold = 2
+	defaultHealthyThreshold   = 1
+)
+
+// HealthCheckConfig defines the active health checks of the endpoints
+type HealthCheckConfig struct {
+	// Type is "http" (GET of Path, healthy on 2xx, default) or "tcp" (connection to the endpoint)
+	Type string `mapstructure:"type" validate:"omitempty,oneof=http tcp"`
+	// Path is the path of the HTTP check, appended to the base URL (default: /health)
+	Path string `mapstructure:"path"`
+	// Interval is the interval between two checks of every endpoint (default: 10s)
+	Interval time.Duration `mapstructure:"interval" validate:"min=0"`
+	// Timeout bounds every check (default: 2s)
+	Timeout time.Duration `mapstructure:"timeout" validate:"min=0"`
+	// UnhealthyThreshold is the number of consecutive failed checks marking an endpoint unhealthy (default: 2)
+	UnhealthyThreshold int `mapstructure:"unhealthyThreshold" validate:"min=0"`
+	// HealthyThreshold is the number of consecutive passed checks marking an endpoint healthy again (default: 1)
+	HealthyThreshold int `mapstructure:"healthyThreshold" validate:"min=0"`
+}
+
+// checkFunc checks the health of an endpoint
+type checkFunc func(ctx context.Context, endpoint string) error
+
+// newCheck returns the check of the configured type
+func newCheck(cfg *HealthCheckConfig) (checkFunc, error) {
+	switch cfg.Type {
+	case "", CheckHTTP:
+		path := cfg.Path
+		if path == "" {
+			path = defaultCheckPath
+		}
+		client := &http.Client{
+			// The endpoint itself must answer, redirects are not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+		return func(ctx context.Context, endpoint string) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+path, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := client.Do(req) //nolint:gosec // user-configured endpoint
+			if err != nil {
+				return err
+			}
+			resp.Body.Close() //nolint:errcheck,gosec
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+			}
+			return nil
+		}, nil
+	case CheckTCP:
+		var dialer net.Dialer
+		return func(ctx context.Context, endpoint string) error {
+			u, err := url.Parse(endpoint)
+			if err != nil {
+				return err
+			}
+			host := u.Host
+			if u.Port() == "" {
+				port := "80"
+				if u.Scheme == "https" {
+					port = "443"
+				}
+				host = net.JoinHostPort(u.Hostname(), port)
+			}
+			conn, err := dialer.DialContext(ctx, "tcp", host)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported health check type: %s", cfg.Type)
+	}
+}
+
+// checkAll checks every endpoint
+func (r *Registry) checkAll() {
+	r.mu.RLock()
+	states := make([]*endpointState, len(r.endpoints))
+	copy(states, r.endpoints)
+	r.mu.RUnlock()
+	r.runChecks(states, false)
+}
+
+// runChecks checks the endpoints concurrently and updates their health. The first check of
+// a new endpoint sets its health directly, the following ones after the thresholds.
+func (r *Registry) runChecks(states []*endpointState, initial bool) {
+	cfg := r.cfg.HealthCheck
+	timeout := interval(cfg.Timeout, defaultCheckTimeout)
+	unhealthyThreshold := cfg.UnhealthyThreshold
+	if unhealthyThreshold <= 0 {
+		unhealthyThreshold = defaultUnhealthyThreshold
+	}
+	healthyThreshold := cfg.HealthyThreshold
+	if healthyThreshold <= 0 {
+		healthyThreshold = defaultHealthyThreshold
+	}
+
+	var wg sync.WaitGroup
+	for _, e := range states {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err := r.check(ctx, e.url)
+
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			wasHealthy := e.healthy
+			switch {
+			case err != nil:
+				e.failures++
+				e.successes = 0
+				if initial || e.failures >= unhealthyThreshold {
+					e.healthy = false
+				}
+			default:
+				e.successes++
+				e.failures = 0
+				if initial || e.successes >= healthyThreshold {
+					e.healthy = true
+				}
+			}
+			if e.healthy != wasHealthy || (initial && err != nil) {
+				r.slog.Info("endpoint health changed", "endpoint", e.url, "healthy", e.healthy, "error", err)
+			}
+		})
+	}
+	wg.Wait()
+}
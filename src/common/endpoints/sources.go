@@ -0,0 +1,148 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sandrolain/events-bridge/src/common/fetch"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+)
+
+// maxListSize bounds the endpoint lists read from files and HTTP endpoints
+const maxListSize = 1 << 20
+
+// newStaticFetch returns the configured endpoints
+func newStaticFetch(cfg *Config) fetchFunc {
+	return func(context.Context) ([]string, error) {
+		return cfg.Endpoints, nil
+	}
+}
+
+// newFileFetch reads the endpoint list file, e.g. a ConfigMap mounted by Kubernetes
+func newFileFetch(cfg *Config) (fetchFunc, error) {
+	return fetch.File(cfg.Path, "endpoints", parseList)
+}
+
+// parseList parses a JSON list (an array or an object with an "endpoints" array) or
+// one endpoint per line
+func parseList(content []byte) ([]string, error) {
+	trimmed := strings.TrimSpace(string(content))
+	if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		var list []string
+		if strings.HasPrefix(trimmed, "{") {
+			var obj struct {
+				Endpoints []string `json:"endpoints"`
+			}
+			if err := json.Unmarshal([]byte(trimmed), &obj); err != nil {
+				return nil, fmt.Errorf("invalid endpoint list: %w", err)
+			}
+			list = obj.Endpoints
+		} else if err := json.Unmarshal([]byte(trimmed), &list); err != nil {
+			return nil, fmt.Errorf("invalid endpoint list: %w", err)
+		}
+		return list, nil
+	}
+
+	var list []string
+	for line := range strings.Lines(trimmed) {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" {
+			list = append(list, line)
+		}
+	}
+	return list, nil
+}
+
+// newHTTPFetch requests the endpoint list from a registry or control plane endpoint
+func newHTTPFetch(cfg *Config) (fetchFunc, error) {
+	headers := make(map[string]string, len(cfg.Headers))
+	for k, v := range cfg.Headers {
+		value, err := secrets.Resolve(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve header %s: %w", k, err)
+		}
+		headers[k] = value
+	}
+	client := &http.Client{}
+	return func(ctx context.Context) ([]string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req) //nolint:gosec // user-configured endpoint
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close() //nolint:errcheck
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+		content, err := io.ReadAll(io.LimitReader(resp.Body, maxListSize))
+		if err != nil {
+			return nil, err
+		}
+		return parseList(content)
+	}, nil
+}
+
+// lookups are the DNS lookups of the "dns" and "srv" types; nil functions use the default resolver
+type lookups struct {
+	host func(ctx context.Context, host string) ([]string, error)
+	srv  func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// newDNSFetch resolves the endpoints from the A/AAAA records of a host or from SRV records
+func newDNSFetch(cfg *Config, l lookups) (fetchFunc, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("%s endpoints require a name", cfg.Type)
+	}
+	if cfg.Type == TypeDNS && cfg.Port == 0 {
+		return nil, fmt.Errorf("dns endpoints require a port")
+	}
+	if l.host == nil {
+		l.host = net.DefaultResolver.LookupHost
+	}
+	if l.srv == nil {
+		l.srv = net.DefaultResolver.LookupSRV
+	}
+	scheme := cfg.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	return func(ctx context.Context) ([]string, error) {
+		var list []string
+		if cfg.Type == TypeSRV {
+			_, records, err := l.srv(ctx, "", "", cfg.Name)
+			if err != nil {
+				return nil, err
+			}
+			// Only the records of the best (lowest) priority are used, as mandated by RFC 2782
+			for _, rec := range records {
+				if rec.Priority == records[0].Priority {
+					host := net.JoinHostPort(strings.TrimSuffix(rec.Target, "."), strconv.Itoa(int(rec.Port)))
+					list = append(list, scheme+"://"+host)
+				}
+			}
+			return list, nil
+		}
+		addrs, err := l.host(ctx, cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			list = append(list, scheme+"://"+net.JoinHostPort(addr, strconv.Itoa(cfg.Port)))
+		}
+		return list, nil
+	}, nil
+}
@@ -0,0 +1,25 @@
+// Package fetch provides the fetch functions shared by the refreshed providers of the
+// bridge, such as the credentials and the endpoint registries.
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// File returns a function reading the file at every call, e.g. a Secret or a ConfigMap
+// mounted by Kubernetes, and parsing its content. The name describes the file in the errors.
+func File[T any](path, name string, parse func([]byte) (T, error)) (func(context.Context) (T, error), error) {
+	if path == "" {
+		return nil, fmt.Errorf("%s file path is required", name)
+	}
+	return func(context.Context) (T, error) {
+		content, err := os.ReadFile(path) //nolint:gosec // user-configured file
+		if err != nil {
+			var zero T
+			return zero, fmt.Errorf("failed to read %s file: %w", name, err)
+		}
+		return parse(content)
+	}, nil
+}
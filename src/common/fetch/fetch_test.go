@@ -0,0 +1,49 @@
+package fetch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte("a\nb"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fetch, err := File(path, "list", func(content []byte) ([]string, error) {
+		return strings.Split(string(content), "\n"), nil
+	})
+	if err != nil {
+		t.Fatalf("File() unexpected error = %v", err)
+	}
+
+	got, err := fetch(context.Background())
+	if err != nil || len(got) != 2 || got[1] != "b" {
+		t.Fatalf("fetch() = %v, %v, want [a b]", got, err)
+	}
+
+	// The file is read again at every call
+	if err := os.WriteFile(path, []byte("c"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = fetch(context.Background()); err != nil || len(got) != 1 || got[0] != "c" {
+		t.Errorf("fetch() = %v, %v, want [c]", got, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetch(context.Background()); err == nil || !strings.Contains(err.Error(), "failed to read list file") {
+		t.Errorf("fetch() error = %v, want read error", err)
+	}
+}
+
+func TestFileNoPath(t *testing.T) {
+	_, err := File("", "list", func([]byte) (string, error) { return "", nil })
+	if err == nil || err.Error() != "list file path is required" {
+		t.Errorf("File() error = %v, want path required", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Package headermap controls which message metadata keys become the headers of the
+// messages published by targets, so that internal metadata (auth claims, debug tags,
+// routing keys) does not leak to external consumers.
+package headermap
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Config is the mapping policy of the metadata keys to headers. The keys and the
+// patterns are compared case-insensitively.
+type Config struct {
+	// Allow are the metadata keys mapped to headers, as glob patterns (e.g. "x-*"); when
+	// empty every key is allowed
+	Allow []string `mapstructure:"allow"`
+	// Deny are the metadata keys never mapped to headers (glob patterns), taking precedence
+	// over Allow (e.g. "eb-*", "jwt_*")
+	Deny []string `mapstructure:"deny"`
+	// Rename sets the header name of allowed metadata keys
+	Rename map[string]string `mapstructure:"rename"`
+	// Prefix is prepended to the header names of the allowed keys not renamed
+	Prefix string `mapstructure:"prefix"`
+}
+
+// Policy maps the metadata to headers. A nil policy maps every key unchanged.
+type Policy struct {
+	allow  []string
+	deny   []string
+	rename map[string]string
+	prefix string
+}
+
+// New compiles the policy; a nil config returns a nil policy
+func New(cfg *Config) (*Policy, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	p := &Policy{prefix: cfg.Prefix, rename: make(map[string]string, len(cfg.Rename))}
+	var err error
+	if p.allow, err = patterns(cfg.Allow); err != nil {
+		return nil, fmt.Errorf("invalid allow pattern: %w", err)
+	}
+	if p.deny, err = patterns(cfg.Deny); err != nil {
+		return nil, fmt.Errorf("invalid deny pattern: %w", err)
+	}
+	for k, v := range cfg.Rename {
+		if v == "" {
+			return nil, fmt.Errorf("empty header name for metadata key %s", k)
+		}
+		p.rename[strings.ToLower(k)] = v
+	}
+	return p, nil
+}
+
+func patterns(list []string) ([]string, error) {
+	res := make([]string, 0, len(list))
+	for _, p := range list {
+		p = strings.ToLower(p)
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+// Allowed reports whether the metadata key is mapped to a header
+func (p *Policy) Allowed(key string) bool {
+	if p == nil {
+		return true
+	}
+	key = strings.ToLower(key)
+	if matchAny(p.deny, key) {
+		return false
+	}
+	return len(p.allow) == 0 || matchAny(p.allow, key)
+}
+
+// Name returns the header name of an allowed metadata key
+func (p *Policy) Name(key string) string {
+	if p == nil {
+		return key
+	}
+	if name, ok := p.rename[strings.ToLower(key)]; ok {
+		return name
+	}
+	return p.prefix + key
+}
+
+// Apply returns the headers of the metadata
+func (p *Policy) Apply(metadata map[string]string) map[string]string {
+	if p == nil {
+		return metadata
+	}
+	headers := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		if p.Allowed(k) {
+			headers[p.Name(k)] = v
+		}
+	}
+	return headers
+}
+
+func matchAny(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package headermap
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestPolicyApply(t *testing.T) {
+	metadata := map[string]string{
+		"X-Request-Id":  "r1",
+		"x-tenant":      "acme",
+		"eb-status":     "200",
+		"jwt_sub":       "user",
+		"content-type":  "application/json",
+		"correlationId": "c1",
+	}
+
+	for name, tc := range map[string]struct {
+		cfg  *Config
+		want map[string]string
+	}{
+		"nil policy": {nil, metadata},
+		"deny": {
+			&Config{Deny: []string{"eb-*", "JWT_*"}},
+			map[string]string{"X-Request-Id": "r1", "x-tenant": "acme", "content-type": "application/json", "correlationId": "c1"},
+		},
+		"allow with deny precedence": {
+			&Config{Allow: []string{"x-*", "eb-*"}, Deny: []string{"x-tenant"}},
+			map[string]string{"X-Request-Id": "r1", "eb-status": "200"},
+		},
+		"rename and prefix": {
+			&Config{Allow: []string{"x-*", "correlationid"}, Rename: map[string]string{"correlationId": "traceparent"}, Prefix: "eb-"},
+			map[string]string{"eb-X-Request-Id": "r1", "eb-x-tenant": "acme", "traceparent": "c1"},
+		},
+		"rename of a denied key": {
+			&Config{Deny: []string{"*"}, Rename: map[string]string{"jwt_sub": "user"}},
+			map[string]string{},
+		},
+	} {
+		p, err := New(tc.cfg)
+		if err != nil {
+			t.Fatalf("%s: New() unexpected error = %v", name, err)
+		}
+		if got := p.Apply(metadata); !maps.Equal(got, tc.want) {
+			t.Errorf("%s: Apply() = %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for name, cfg := range map[string]*Config{
+		"allow pattern": {Allow: []string{"x-["}},
+		"deny pattern":  {Deny: []string{"[a-"}},
+		"empty rename":  {Rename: map[string]string{"a": ""}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s: New() expected error", name)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Package httpretry holds the helpers shared by the connectors handling the HTTP error
+// responses: the error messages and the Retry-After delays.
+package httpretry
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxErrorBody limits the response body reported in errors
+const MaxErrorBody = 512
+
+// ErrorBody returns the start of an error response body, for the error messages
+func ErrorBody(body io.Reader) string {
+	raw, _ := io.ReadAll(io.LimitReader(body, MaxErrorBody))
+	return strings.TrimSpace(string(raw))
+}
+
+// ParseRetryAfter parses a Retry-After header value: a delay in seconds or an HTTP date
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil || !date.After(now) {
+		return 0, false
+	}
+	return date.Sub(now), true
+}
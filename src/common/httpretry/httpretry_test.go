@@ -0,0 +1,40 @@
+package httpretry
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 1 ", time.Second, true},
+		{"0", 0, false},
+		{"-5", 0, false},
+		{"Fri, 02 Jan 2026 03:04:35 GMT", 30 * time.Second, true},
+		{"Fri, 02 Jan 2026 03:00:00 GMT", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		delay, ok := ParseRetryAfter(tt.value, now)
+		if delay != tt.delay || ok != tt.ok {
+			t.Errorf("ParseRetryAfter(%q) = %v, %v", tt.value, delay, ok)
+		}
+	}
+}
+
+func TestErrorBody(t *testing.T) {
+	if got := ErrorBody(strings.NewReader(" bad request\n")); got != "bad request" {
+		t.Errorf("ErrorBody() = %q", got)
+	}
+	if got := ErrorBody(strings.NewReader(strings.Repeat("x", 2*MaxErrorBody))); len(got) != MaxErrorBody {
+		t.Errorf("ErrorBody() length = %d, want %d", len(got), MaxErrorBody)
+	}
+}
@@ -0,0 +1,92 @@
+// Package jsonpath resolves the paths of the fields in the decoded JSON payloads.
+//
+// A path is a dotted list of object keys, where the numeric segments index the arrays
+// ("items.0.sku"). Get also accepts the JSONPath subset "$.items[0].sku"; Set and Delete
+// only walk the objects.
+package jsonpath
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Get returns the value at the path of a decoded JSON value
+func Get(v any, path string) (any, bool) {
+	if rest, ok := strings.CutPrefix(path, "$"); ok {
+		rest = strings.TrimPrefix(rest, ".")
+		if rest == "" {
+			return v, true
+		}
+		path = strings.ReplaceAll(strings.ReplaceAll(rest, "[", "."), "]", "")
+	}
+	for _, seg := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Set sets the value at a dotted path of an object, creating the missing objects; it
+// reports false, leaving the object unchanged, when a segment is not an object
+func Set(v map[string]any, path string, value any) bool {
+	segs := strings.Split(path, ".")
+	for _, seg := range segs[:len(segs)-1] {
+		next, ok := v[seg].(map[string]any)
+		if !ok {
+			if _, exists := v[seg]; exists {
+				return false
+			}
+			next = map[string]any{}
+			v[seg] = next
+		}
+		v = next
+	}
+	v[segs[len(segs)-1]] = value
+	return true
+}
+
+// Delete removes the value at a dotted path of an object, if present
+func Delete(v map[string]any, path string) {
+	segs := strings.Split(path, ".")
+	for _, seg := range segs[:len(segs)-1] {
+		next, ok := v[seg].(map[string]any)
+		if !ok {
+			return
+		}
+		v = next
+	}
+	delete(v, segs[len(segs)-1])
+}
+
+// ScalarString formats a decoded JSON scalar, e.g. as a lookup key: the integral numbers
+// without exponent or decimals. It reports false for the other values.
+func ScalarString(v any) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, true
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return strconv.FormatInt(int64(val), 10), true
+		}
+		return strconv.FormatFloat(val, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(val), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,96 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(`{"id":1,"user":{"name":"ada","tags":["a","b"]},"items":[{"sku":"x"}],"a.b":true,"0":"zero"}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want any
+		ok   bool
+	}{
+		{"id", 1.0, true},
+		{"user.name", "ada", true},
+		{"user.tags.1", "b", true},
+		{"items.0.sku", "x", true},
+		{"0", "zero", true},
+		{"$.user.tags[0]", "a", true},
+		{"$.items[0].sku", "x", true},
+		{"$items[0].sku", "x", true},
+		{"$", doc, true},
+		{"user", map[string]any{"name": "ada", "tags": []any{"a", "b"}}, true},
+		{"user.missing", nil, false},
+		{"user.tags.2", nil, false},
+		{"user.tags.-1", nil, false},
+		{"user.tags.first", nil, false},
+		{"id.value", nil, false},
+		{"a.b", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := Get(doc, tt.path)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Get(%q) = %v, %v, want %v, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSetDelete(t *testing.T) {
+	doc := map[string]any{"id": 1, "user": map[string]any{"name": "ada"}}
+	for _, path := range []string{"user.email", "meta.source.name", "id2"} {
+		if !Set(doc, path, "x") {
+			t.Errorf("Set(%q) = false", path)
+		}
+		if v, ok := Get(doc, path); !ok || v != "x" {
+			t.Errorf("Get(%q) = %v, %v after Set", path, v, ok)
+		}
+	}
+	if Set(doc, "id.value", "x") {
+		t.Error("Set() through a number = true")
+	}
+	if doc["id"] != 1 {
+		t.Errorf("id = %v, want it unchanged", doc["id"])
+	}
+
+	Delete(doc, "user.name")
+	Delete(doc, "id.value")
+	Delete(doc, "missing.path")
+	want := map[string]any{
+		"id":   1,
+		"id2":  "x",
+		"user": map[string]any{"email": "x"},
+		"meta": map[string]any{"source": map[string]any{"name": "x"}},
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("doc = %v, want %v", doc, want)
+	}
+}
+
+func TestScalarString(t *testing.T) {
+	tests := []struct {
+		v      any
+		want   string
+		wantOK bool
+	}{
+		{"sku-1", "sku-1", true},
+		{float64(42), "42", true},
+		{1e15, "1000000000000000", true},
+		{1.5, "1.5", true},
+		{true, "true", true},
+		{nil, "", false},
+		{map[string]any{}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ScalarString(tt.v)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ScalarString(%v) = %q, %v, want %q, %v", tt.v, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
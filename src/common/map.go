@@ -1,5 +1,7 @@
 package common
 
+import "strings"
+
 func CopyMap(src map[string]string, to map[string]string) map[string]string {
 	if to == nil {
 		to = make(map[string]string)
@@ -9,3 +11,26 @@ func CopyMap(src map[string]string, to map[string]string) map[string]string {
 	}
 	return to
 }
+
+// LookupFold returns the value of the key matched case-insensitively, as the HTTP sources
+// canonicalize the header names of the metadata
+func LookupFold(meta map[string]string, key string) string {
+	if v, ok := meta[key]; ok {
+		return v
+	}
+	for k, v := range meta {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// DeleteFold deletes the keys matching the key case-insensitively
+func DeleteFold(meta map[string]string, key string) {
+	for k := range meta {
+		if strings.EqualFold(k, key) {
+			delete(meta, k)
+		}
+	}
+}
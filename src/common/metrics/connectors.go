@@ -0,0 +1,14 @@
+package metrics
+
+// connectorReconnects counts the reconnections of the connectors
+var connectorReconnects = NewCounterVec(
+	"eb_connector_reconnects_total",
+	"Reconnections of the connectors to their broker or server.",
+	"connector",
+)
+
+// Reconnected counts a reconnection of the connector, e.g. "amqp source", once the
+// connection lost is established again
+func Reconnected(connector string) {
+	connectorReconnects.With(connector).Inc()
+}
@@ -0,0 +1,327 @@
+// Package metrics is the process-wide registry of the bridge metrics, a Prometheus
+// client_golang registry exposed with promhttp. The bridge and the connector plugins
+// register their counters, gauges and histograms by name: registering a name again
+// returns the existing metric, so that the pipelines started by a switchover and the
+// plugins loaded by several connectors add to the same series.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// ContentType is the content type of the Prometheus text format
+const ContentType = string(expfmt.FmtText)
+
+// DefaultPath is the default path of the metrics endpoint
+const DefaultPath = "/metrics"
+
+// DefaultBuckets are the histogram buckets for latencies in seconds, from 1ms to 10s
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	registeredMu sync.Mutex
+	registered   = map[string]*family{}
+)
+
+// family is a registered metric with the collector of its series
+type family struct {
+	kind      string
+	labels    []string
+	buckets   []float64
+	collector prometheus.Collector
+}
+
+// histogramSuffixes are the suffixes of the series written for a histogram
+var histogramSuffixes = []string{"_bucket", "_sum", "_count"}
+
+// register returns the collector registered with the name, creating it on first use.
+// Registering a name with another kind, other labels or other buckets, an invalid name,
+// or a name clashing with the series of a histogram is a programming error and panics.
+func register(name, kind string, buckets []float64, labels []string, create func() prometheus.Collector) prometheus.Collector {
+	validate(name, kind, labels)
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	if f, ok := registered[name]; ok {
+		if f.kind != kind || !slices.Equal(f.labels, labels) || !slices.Equal(f.buckets, buckets) {
+			panic(fmt.Sprintf("metric %s registered as %s %v %v, not %s %v %v", name, f.kind, f.labels, f.buckets, kind, labels, buckets))
+		}
+		return f.collector
+	}
+	for other, f := range registered {
+		if clashes(name, kind, other, f.kind) {
+			panic(fmt.Sprintf("metric %s clashes with the series of %s %s", name, f.kind, other))
+		}
+	}
+	collector := create()
+	registry.MustRegister(collector)
+	registered[name] = &family{kind: kind, labels: slices.Clone(labels), buckets: buckets, collector: collector}
+	return collector
+}
+
+// validate panics when the metric or label names are not valid Prometheus names, in the
+// legacy character set understood by every scraper. The le label is reserved to the
+// buckets of the histograms.
+func validate(name, kind string, labels []string) {
+	if !validName(name, true) {
+		panic(fmt.Sprintf("invalid metric name %q", name))
+	}
+	for i, label := range labels {
+		if !validName(label, false) || strings.HasPrefix(label, "__") || (kind == kindHistogram && label == "le") {
+			panic(fmt.Sprintf("metric %s has an invalid label name %q", name, label))
+		}
+		if slices.Contains(labels[:i], label) {
+			panic(fmt.Sprintf("metric %s has a duplicate label %q", name, label))
+		}
+	}
+}
+
+// validName reports whether the name matches [a-zA-Z_][a-zA-Z0-9_]*, with colons allowed
+// in the metric names
+func validName(name string, colons bool) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		case r >= '0' && r <= '9' && i > 0:
+		case r == ':' && colons:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// clashes reports whether a metric writes a series named as a series of another one, e.g.
+// the counter x_count and the histogram x
+func clashes(name, kind, other, otherKind string) bool {
+	for _, suffix := range histogramSuffixes {
+		if (otherKind == kindHistogram && name == other+suffix) || (kind == kindHistogram && other == name+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validValues replaces the invalid UTF-8 sequences of the label values, which the
+// client rejects
+func validValues(values []string) []string {
+	for i, v := range values {
+		if !utf8.ValidString(v) {
+			values = slices.Clone(values)
+			values[i] = strings.ToValidUTF8(v, "\uFFFD")
+		}
+	}
+	return values
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct{ v *prometheus.CounterVec }
+
+// Counter is a monotonically increasing value
+type Counter struct{ c prometheus.Counter }
+
+// NewCounterVec registers a counter, or returns the one registered with the name
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := register(name, kindCounter, nil, labels, func() prometheus.Collector {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	})
+	return &CounterVec{v: c.(*prometheus.CounterVec)}
+}
+
+// With returns the counter of the label values
+func (v *CounterVec) With(values ...string) Counter {
+	return Counter{c: v.v.WithLabelValues(validValues(values)...)}
+}
+
+// Inc increments the counter by 1
+func (c Counter) Inc() {
+	c.c.Inc()
+}
+
+// Add increments the counter by delta, which must not be negative
+func (c Counter) Add(delta float64) {
+	c.c.Add(delta)
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct{ v *gaugeVec }
+
+// Gauge is a value that can go up and down
+type Gauge struct{ g prometheus.Gauge }
+
+// gaugeVec collects the gauges set by value and the gauges read from a function when
+// scraped
+type gaugeVec struct {
+	*prometheus.GaugeVec
+	name   string
+	desc   *prometheus.Desc
+	labels []string
+
+	mu  sync.Mutex
+	fns map[string]*gaugeFunc
+}
+
+// gaugeFunc is the function of a gauge with its label values
+type gaugeFunc struct {
+	values []string
+	fn     func() float64
+}
+
+func (v *gaugeVec) Collect(ch chan<- prometheus.Metric) {
+	v.GaugeVec.Collect(ch)
+	v.mu.Lock()
+	fns := make([]*gaugeFunc, 0, len(v.fns))
+	for _, f := range v.fns {
+		fns = append(fns, f)
+	}
+	v.mu.Unlock()
+	// The functions are called outside the lock, they may take time
+	for _, f := range fns {
+		ch <- prometheus.MustNewConstMetric(v.desc, prometheus.GaugeValue, f.fn(), f.values...)
+	}
+}
+
+// NewGaugeVec registers a gauge, or returns the one registered with the name
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	c := register(name, kindGauge, nil, labels, func() prometheus.Collector {
+		return &gaugeVec{
+			GaugeVec: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels),
+			name:     name,
+			desc:     prometheus.NewDesc(name, help, labels, nil),
+			labels:   labels,
+			fns:      map[string]*gaugeFunc{},
+		}
+	})
+	return &GaugeVec{v: c.(*gaugeVec)}
+}
+
+// With returns the gauge of the label values
+func (v *GaugeVec) With(values ...string) Gauge {
+	return Gauge{g: v.v.WithLabelValues(validValues(values)...)}
+}
+
+// Func sets the function returning the value of the gauge of the label values when
+// scraped, e.g. the length of a channel. The returned function removes the gauge,
+// unless the function was replaced meanwhile, e.g. by the pipeline of a switchover.
+func (v *GaugeVec) Func(fn func() float64, values ...string) (remove func()) {
+	values = validValues(values)
+	if len(values) != len(v.v.labels) {
+		panic(fmt.Sprintf("metric %s has labels %v, got %d values", v.v.name, v.v.labels, len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f := &gaugeFunc{values: slices.Clone(values), fn: fn}
+	v.v.mu.Lock()
+	v.v.fns[key] = f
+	v.v.mu.Unlock()
+	v.v.DeleteLabelValues(values...)
+	return func() {
+		v.v.mu.Lock()
+		defer v.v.mu.Unlock()
+		if v.v.fns[key] == f {
+			delete(v.v.fns, key)
+		}
+	}
+}
+
+// Set sets the gauge
+func (g Gauge) Set(value float64) {
+	g.g.Set(value)
+}
+
+// Add adds delta, possibly negative, to the gauge
+func (g Gauge) Add(delta float64) {
+	g.g.Add(delta)
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct{ v *prometheus.HistogramVec }
+
+// Histogram counts the observed values in buckets
+type Histogram struct{ o prometheus.Observer }
+
+// NewHistogramVec registers a histogram with the upper bounds of its buckets, strictly
+// increasing, DefaultBuckets when nil, or returns the one registered with the name.
+// A last +Inf bound is implied and may be omitted.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	if n := len(buckets); n > 0 && math.IsInf(buckets[n-1], 1) {
+		buckets = buckets[:n-1]
+	}
+	for i, upper := range buckets {
+		if math.IsNaN(upper) || (i > 0 && upper <= buckets[i-1]) {
+			panic(fmt.Sprintf("metric %s buckets are not strictly increasing: %v", name, buckets))
+		}
+	}
+	buckets = slices.Clone(buckets)
+	c := register(name, kindHistogram, buckets, labels, func() prometheus.Collector {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	})
+	return &HistogramVec{v: c.(*prometheus.HistogramVec)}
+}
+
+// With returns the histogram of the label values
+func (v *HistogramVec) With(values ...string) Histogram {
+	return Histogram{o: v.v.WithLabelValues(validValues(values)...)}
+}
+
+// Observe adds a value to the histogram
+func (h Histogram) Observe(value float64) {
+	h.o.Observe(value)
+}
+
+// gatherer gathers the registered metrics, without the HELP line of the metrics
+// registered without help
+var gatherer = prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+	families, err := registry.Gather()
+	for _, mf := range families {
+		if mf.GetHelp() == "" {
+			mf.Help = nil
+		}
+	}
+	return families, err
+})
+
+// Handler serves the metrics in the format negotiated with the scraper, the Prometheus
+// text format by default
+func Handler() http.Handler {
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
+
+// Write writes the registered metrics in the Prometheus text format, sorted by name and labels
+func Write(w io.Writer) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	enc := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	c := NewCounterVec("test_events_total", "Events.\nCounted.", "kind")
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.With("a").Inc()
+		}()
+	}
+	wg.Wait()
+	c.With(`b"\`).Add(2.5)
+	// Registering the name again returns the same counter
+	NewCounterVec("test_events_total", "ignored", "kind").With("a").Inc()
+
+	g := NewGaugeVec("test_level", "Level.")
+	g.With().Set(3)
+	g.With().Add(-1)
+
+	out := scrape(t)
+	for _, want := range []string{
+		"# HELP test_events_total Events.\\nCounted.\n# TYPE test_events_total counter\n",
+		`test_events_total{kind="a"} 101` + "\n",
+		`test_events_total{kind="b\"\\"} 2.5` + "\n",
+		"# TYPE test_level gauge\ntest_level 2\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestGaugeFunc(t *testing.T) {
+	g := NewGaugeVec("test_queue", "Queue length.", "queue")
+	n := 4.0
+	remove := g.Func(func() float64 { return n }, "q")
+	if !strings.Contains(scrape(t), `test_queue{queue="q"} 4`+"\n") {
+		t.Error("gauge function not scraped")
+	}
+
+	// A replaced function is not removed by the previous owner
+	replace := g.Func(func() float64 { return 7 }, "q")
+	remove()
+	if !strings.Contains(scrape(t), `test_queue{queue="q"} 7`+"\n") {
+		t.Error("replaced gauge function removed")
+	}
+	replace()
+	if strings.Contains(scrape(t), "test_queue") {
+		t.Error("gauge not removed")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Duration.", []float64{0.1, 1}, "op")
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		h.With("read").Observe(v)
+	}
+	want := `test_duration_seconds_bucket{op="read",le="0.1"} 2
+test_duration_seconds_bucket{op="read",le="1"} 3
+test_duration_seconds_bucket{op="read",le="+Inf"} 4
+test_duration_seconds_sum{op="read"} 3.65
+test_duration_seconds_count{op="read"} 4
+`
+	if !strings.Contains(scrape(t), want) {
+		t.Errorf("histogram output:\n%s", scrape(t))
+	}
+
+	// An explicit +Inf bound is not written twice, and registering again keeps the buckets
+	NewHistogramVec("test_size_bytes", "", []float64{10, math.Inf(1)}).With().Observe(20)
+	NewHistogramVec("test_size_bytes", "", []float64{10}).With().Observe(5)
+	want = `# TYPE test_size_bytes histogram
+test_size_bytes_bucket{le="10"} 1
+test_size_bytes_bucket{le="+Inf"} 2
+test_size_bytes_sum 25
+test_size_bytes_count 2
+`
+	if out := scrape(t); !strings.Contains(out, want) || strings.Contains(out, "# HELP test_size_bytes") {
+		t.Errorf("histogram output:\n%s", out)
+	}
+}
+
+func TestLabelValueEscaping(t *testing.T) {
+	NewCounterVec("test_escaped_total", `Help with \ and "quotes".`, "path").With("a\nb\xff\"c").Inc()
+	out := scrape(t)
+	for _, want := range []string{
+		`# HELP test_escaped_total Help with \\ and "quotes".` + "\n",
+		"test_escaped_total{path=\"a\\nb\uFFFD\\\"c\"} 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestRegisterMismatchPanics(t *testing.T) {
+	NewCounterVec("test_mismatch", "Mismatch.", "a")
+	for name, register := range map[string]func(){
+		"kind":   func() { NewGaugeVec("test_mismatch", "Mismatch.", "a") },
+		"labels": func() { NewCounterVec("test_mismatch", "Mismatch.", "b") },
+		"values": func() { NewCounterVec("test_mismatch", "Mismatch.", "a").With("x", "y") },
+		"name":   func() { NewCounterVec("test-invalid", "Invalid.") },
+		"label":  func() { NewCounterVec("test_invalid_label", "Invalid.", "1a") },
+		"reserved label": func() {
+			NewCounterVec("test_reserved_label", "Invalid.", "__name")
+		},
+		"duplicate label": func() { NewCounterVec("test_duplicate_label", "Invalid.", "a", "a") },
+		"le":              func() { NewHistogramVec("test_le_seconds", "Invalid.", nil, "le") },
+		"unsorted":        func() { NewHistogramVec("test_unsorted_seconds", "Invalid.", []float64{1, 1}) },
+		"buckets":         func() { NewHistogramVec("test_size_bytes", "", []float64{100}) },
+		"histogram clash": func() {
+			NewHistogramVec("test_clash_seconds", "Clash.", nil)
+			NewCounterVec("test_clash_seconds_count", "Clash.")
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			register()
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	Reconnected("test-connector")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, listener, DefaultPath, slog.New(slog.DiscardHandler)) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + DefaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), ContentType) || !strings.Contains(string(body), `eb_connector_reconnects_total{connector="test-connector"} 1`) {
+		t.Errorf("response %s: %s", resp.Header.Get("Content-Type"), body)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve() error = %v", err)
+	}
+}
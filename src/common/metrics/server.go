@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout bounds the graceful shutdown of the metrics server
+const shutdownTimeout = 5 * time.Second
+
+// Run serves the metrics on the address and path until the context is cancelled
+func Run(ctx context.Context, address string, path string, logger *slog.Logger) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	return Serve(ctx, listener, path, logger)
+}
+
+// Serve serves the metrics on the listener and path until the context is cancelled
+func Serve(ctx context.Context, listener net.Listener, path string, logger *slog.Logger) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET "+path, Handler())
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("failed to shutdown metrics server", "error", err)
+		}
+	}()
+
+	logger.Info("metrics endpoint listening", "addr", listener.Addr().String(), "path", path)
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
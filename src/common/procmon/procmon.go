@@ -0,0 +1,193 @@
+// Package procmon monitors the resource usage of child processes (CPU, RSS, open files),
+// enforces configurable limits and exposes the samples through a process-wide registry.
+package procmon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUnsupported is returned when resource usage cannot be sampled on the current platform
+var ErrUnsupported = errors.New("process monitoring is not supported on this platform")
+
+// Config configures the monitoring of a child process
+type Config struct {
+	// Interval between samples; 0 disables monitoring
+	Interval time.Duration `mapstructure:"interval" default:"0s" validate:"min=0"`
+	// MaxRSS is the resident memory limit in bytes (0 = unlimited)
+	MaxRSS int64 `mapstructure:"maxRSS" validate:"min=0"`
+	// MaxCPU is the CPU usage limit in percent of a core, averaged over the interval (0 = unlimited)
+	MaxCPU float64 `mapstructure:"maxCPU" validate:"min=0"`
+	// MaxOpenFiles is the open file descriptors limit (0 = unlimited)
+	MaxOpenFiles int `mapstructure:"maxOpenFiles" validate:"min=0"`
+}
+
+// Enabled reports whether the process has to be monitored
+func (c Config) Enabled() bool {
+	return c.Interval > 0
+}
+
+// Usage is a resource usage sample of a process
+type Usage struct {
+	// CPUTime is the total user and system CPU time
+	CPUTime time.Duration
+	// RSS is the resident memory in bytes
+	RSS int64
+	// OpenFiles is the number of open file descriptors
+	OpenFiles int
+}
+
+// Stats are the metrics of a monitored process
+type Stats struct {
+	PID        int       `json:"pid"`
+	CPUPercent float64   `json:"cpuPercent"`
+	RSS        int64     `json:"rss"`
+	OpenFiles  int       `json:"openFiles"`
+	Breaches   int64     `json:"breaches"`
+	Restarts   int64     `json:"restarts"`
+	SampledAt  time.Time `json:"sampledAt"`
+}
+
+// Breach describes a limit exceeded by a process
+type Breach struct {
+	PID    int
+	Reason string
+}
+
+// Monitor samples the processes of a connector and keeps their latest stats
+type Monitor struct {
+	name     string
+	cfg      Config
+	logger   *slog.Logger
+	read     func(pid int) (Usage, error)
+	breaches atomic.Int64
+	restarts atomic.Int64
+	mu       sync.RWMutex
+	stats    Stats
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]*Monitor{}
+)
+
+// NewMonitor creates a monitor and registers it with the given name.
+// A numeric suffix is added to the name when it is already registered.
+func NewMonitor(name string, cfg Config, logger *slog.Logger) *Monitor {
+	m := &Monitor{
+		cfg:    cfg,
+		logger: logger,
+		read:   ReadUsage,
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	m.name = name
+	for i := 2; registry[m.name] != nil; i++ {
+		m.name = name + "-" + strconv.Itoa(i)
+	}
+	registry[m.name] = m
+	return m
+}
+
+// Name returns the name the monitor is registered with
+func (m *Monitor) Name() string {
+	return m.name
+}
+
+// Close removes the monitor from the registry
+func (m *Monitor) Close() {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if registry[m.name] == m {
+		delete(registry, m.name)
+	}
+}
+
+// Restarted records a restart of the monitored process
+func (m *Monitor) Restarted() {
+	m.restarts.Add(1)
+}
+
+// Stats returns the latest stats of the monitored process
+func (m *Monitor) Stats() Stats {
+	m.mu.RLock()
+	s := m.stats
+	m.mu.RUnlock()
+	s.Breaches = m.breaches.Load()
+	s.Restarts = m.restarts.Load()
+	return s
+}
+
+// Watch samples the process until the context is cancelled or the process exits.
+// onBreach is called, at most once, when a limit is exceeded; Watch returns afterwards.
+func (m *Monitor) Watch(ctx context.Context, pid int, onBreach func(Breach)) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	prev, err := m.read(pid)
+	if err != nil {
+		m.logger.Warn("cannot monitor process", "pid", pid, "error", err)
+		return
+	}
+	prevAt := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			usage, err := m.read(pid)
+			if err != nil {
+				// The process has exited
+				return
+			}
+			cpu := 0.0
+			if elapsed := now.Sub(prevAt); elapsed > 0 {
+				cpu = float64(usage.CPUTime-prev.CPUTime) / float64(elapsed) * 100
+			}
+			prev, prevAt = usage, now
+
+			m.mu.Lock()
+			m.stats = Stats{PID: pid, CPUPercent: cpu, RSS: usage.RSS, OpenFiles: usage.OpenFiles, SampledAt: now}
+			m.mu.Unlock()
+
+			if reason := m.checkLimits(usage, cpu); reason != "" {
+				m.breaches.Add(1)
+				m.logger.Warn("process exceeded resource limit", "pid", pid, "reason", reason)
+				onBreach(Breach{PID: pid, Reason: reason})
+				return
+			}
+		}
+	}
+}
+
+// checkLimits returns the reason of the first exceeded limit, if any
+func (m *Monitor) checkLimits(usage Usage, cpu float64) string {
+	switch {
+	case m.cfg.MaxRSS > 0 && usage.RSS > m.cfg.MaxRSS:
+		return fmt.Sprintf("rss %d bytes exceeds limit %d", usage.RSS, m.cfg.MaxRSS)
+	case m.cfg.MaxCPU > 0 && cpu > m.cfg.MaxCPU:
+		return fmt.Sprintf("cpu %.1f%% exceeds limit %.1f%%", cpu, m.cfg.MaxCPU)
+	case m.cfg.MaxOpenFiles > 0 && usage.OpenFiles > m.cfg.MaxOpenFiles:
+		return fmt.Sprintf("open files %d exceed limit %d", usage.OpenFiles, m.cfg.MaxOpenFiles)
+	}
+	return ""
+}
+
+// Snapshot returns the stats of the registered monitors, by name
+func Snapshot() map[string]Stats {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	res := make(map[string]Stats, len(registry))
+	for name, m := range registry {
+		res[name] = m.Stats()
+	}
+	return res
+}
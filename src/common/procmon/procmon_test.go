@@ -0,0 +1,130 @@
+package procmon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestReadUsageSelf(t *testing.T) {
+	usage, err := ReadUsage(os.Getpid())
+	if runtime.GOOS != "linux" {
+		if !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("expected ErrUnsupported, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("ReadUsage() unexpected error = %v", err)
+	}
+	if usage.RSS <= 0 || usage.OpenFiles < 3 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+
+	if _, err := ReadUsage(-1); err == nil {
+		t.Error("expected error for a missing process")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	a := NewMonitor("test:registry", Config{Interval: time.Second}, newTestLogger())
+	b := NewMonitor("test:registry", Config{Interval: time.Second}, newTestLogger())
+	if a.Name() != "test:registry" || b.Name() != "test:registry-2" {
+		t.Errorf("unexpected names %q and %q", a.Name(), b.Name())
+	}
+
+	b.Restarted()
+	snapshot := Snapshot()
+	if _, ok := snapshot[a.Name()]; !ok {
+		t.Errorf("monitor %q not registered", a.Name())
+	}
+	if snapshot[b.Name()].Restarts != 1 {
+		t.Errorf("expected 1 restart, got %+v", snapshot[b.Name()])
+	}
+
+	a.Close()
+	b.Close()
+	if _, ok := Snapshot()[a.Name()]; ok {
+		t.Errorf("monitor %q still registered after Close", a.Name())
+	}
+}
+
+func TestWatchBreach(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		usage  Usage
+		reason string
+	}{
+		{"rss", Config{MaxRSS: 100}, Usage{RSS: 200}, "rss"},
+		{"open files", Config{MaxOpenFiles: 10}, Usage{OpenFiles: 11}, "open files"},
+		{"cpu", Config{MaxCPU: 50}, Usage{CPUTime: time.Hour}, "cpu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Interval = 10 * time.Millisecond
+			m := NewMonitor("test:breach", tt.cfg, newTestLogger())
+			defer m.Close()
+
+			var samples atomic.Int32
+			m.read = func(int) (Usage, error) {
+				// The first sample is the CPU time baseline
+				if samples.Add(1) == 1 {
+					return Usage{}, nil
+				}
+				return tt.usage, nil
+			}
+
+			var breach Breach
+			done := make(chan struct{})
+			go func() {
+				m.Watch(context.Background(), 42, func(b Breach) { breach = b })
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Watch() did not return after a breach")
+			}
+
+			if breach.PID != 42 || !strings.Contains(breach.Reason, tt.reason) {
+				t.Errorf("unexpected breach %+v", breach)
+			}
+			if stats := m.Stats(); stats.Breaches != 1 || stats.PID != 42 {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+		})
+	}
+}
+
+func TestWatchWithinLimits(t *testing.T) {
+	m := NewMonitor("test:limits", Config{Interval: 10 * time.Millisecond, MaxRSS: 1000}, newTestLogger())
+	defer m.Close()
+
+	var samples atomic.Int32
+	m.read = func(int) (Usage, error) {
+		if samples.Add(1) > 3 {
+			// The process has exited
+			return Usage{}, os.ErrNotExist
+		}
+		return Usage{RSS: 500, OpenFiles: 4}, nil
+	}
+
+	m.Watch(context.Background(), 42, func(b Breach) {
+		t.Errorf("unexpected breach %+v", b)
+	})
+	if stats := m.Stats(); stats.RSS != 500 || stats.OpenFiles != 4 || stats.Breaches != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
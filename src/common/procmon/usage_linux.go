@@ -0,0 +1,55 @@
+package procmon
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the USER_HZ of the /proc CPU times, fixed to 100 on Linux
+const clockTicks = 100
+
+// ReadUsage reads the resource usage of a process from /proc
+func ReadUsage(pid int) (Usage, error) {
+	dir := "/proc/" + strconv.Itoa(pid)
+	stat, err := os.ReadFile(dir + "/stat")
+	if err != nil {
+		return Usage{}, fmt.Errorf("failed to read process stat: %w", err)
+	}
+
+	// The command name may contain spaces: fields are counted after its closing parenthesis
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return Usage{}, fmt.Errorf("invalid process stat: %q", stat)
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	// fields[0] is the state (field 3): utime is field 14, stime 15 and rss 24
+	if len(fields) < 22 {
+		return Usage{}, fmt.Errorf("invalid process stat: %q", stat)
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return Usage{}, fmt.Errorf("invalid utime: %w", err)
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return Usage{}, fmt.Errorf("invalid stime: %w", err)
+	}
+	rss, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return Usage{}, fmt.Errorf("invalid rss: %w", err)
+	}
+
+	fds, err := os.ReadDir(dir + "/fd")
+	if err != nil {
+		return Usage{}, fmt.Errorf("failed to read process file descriptors: %w", err)
+	}
+
+	return Usage{
+		CPUTime:   time.Duration(utime+stime) * time.Second / clockTicks,
+		RSS:       rss * int64(os.Getpagesize()),
+		OpenFiles: len(fds),
+	}, nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package procmon
+
+// ReadUsage is not supported on platforms without /proc
+func ReadUsage(int) (Usage, error) {
+	return Usage{}, ErrUnsupported
+}
@@ -0,0 +1,16 @@
+package common
+
+import "strconv"
+
+// RangeString formats the optional bounds of a numeric range as "[min, max]",
+// an open bound being -inf or +inf
+func RangeString(minValue, maxValue *float64) string {
+	lo, hi := "-inf", "+inf"
+	if minValue != nil {
+		lo = strconv.FormatFloat(*minValue, 'g', -1, 64)
+	}
+	if maxValue != nil {
+		hi = strconv.FormatFloat(*maxValue, 'g', -1, 64)
+	}
+	return "[" + lo + ", " + hi + "]"
+}
@@ -0,0 +1,304 @@
+// Package scheduledquery runs the query of a database source on a cron schedule and emits
+// every row (or document) of the result as a message, optionally only the rows new or
+// changed since the previous runs, for report-driven and reconciliation pipelines.
+package scheduledquery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/cron"
+	"github.com/sandrolain/events-bridge/src/common/statestore"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	backendMemory = "memory"
+	backendRedis  = "redis"
+
+	StatusNew       = "new"
+	StatusChanged   = "changed"
+	StatusUnchanged = "unchanged"
+
+	// keyPrefix is the default prefix of the Redis state keys
+	keyPrefix = "eb-query:"
+)
+
+// Config schedules the query of a source; it is embedded in the query configuration of
+// the connectors
+type Config struct {
+	// Schedule is the cron expression of the runs, e.g. "*/5 * * * *", "@hourly" or
+	// "@every 30s"; empty disables the scheduled query
+	Schedule string `mapstructure:"schedule"`
+	// Timezone is the IANA time zone of the schedule
+	Timezone string `mapstructure:"timezone" default:"UTC" validate:"required"`
+	// RunOnStart runs the query when the source starts, besides the schedule
+	RunOnStart bool `mapstructure:"runOnStart" default:"false"`
+	// Timeout bounds every run of the query
+	Timeout time.Duration `mapstructure:"timeout" default:"1m" validate:"gt=0"`
+	// KeyField is the column (or document field) identifying the rows; without it the
+	// rows are identified by the hash of their content
+	KeyField string `mapstructure:"keyField"`
+	// ChangesOnly emits only the rows new or changed since the previous runs
+	ChangesOnly bool `mapstructure:"changesOnly" default:"false"`
+	// StatusKey is the metadata key set to "new", "changed" or "unchanged"
+	StatusKey string `mapstructure:"statusKey" default:"eb-query-status" validate:"required"`
+	// Backend is the store of the rows seen by the previous runs: "memory" (default) or
+	// "redis", to keep them across restarts
+	Backend string `mapstructure:"backend" default:"memory" validate:"oneof=memory redis"`
+	// TTL expires the state of the rows not returned for this long (0 = never)
+	TTL time.Duration `mapstructure:"ttl" default:"0s" validate:"min=0"`
+
+	Memory statestore.MemoryConfig `mapstructure:"memory"`
+	Redis  *statestore.RedisConfig `mapstructure:"redis" validate:"required_if=Backend redis"`
+}
+
+// Enabled reports whether a schedule is configured
+func (c *Config) Enabled() bool {
+	return c.Schedule != ""
+}
+
+// Fetch runs the query and returns its rows
+type Fetch func(ctx context.Context) ([]map[string]any, error)
+
+// Runner runs a query on its schedule and produces the messages of the rows
+type Runner struct {
+	cfg      *Config
+	slog     *slog.Logger
+	schedule *cron.Schedule
+	loc      *time.Location
+	fetch    Fetch
+	store    statestore.Store
+	now      func() time.Time
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	c        chan *message.RunnerMessage
+}
+
+// New creates the runner of a scheduled query
+func New(cfg *Config, fetch Fetch, logger *slog.Logger) (*Runner, error) {
+	var st statestore.Store
+	switch cfg.Backend {
+	case backendMemory:
+		st = statestore.NewMemory(&cfg.Memory, cfg.TTL)
+	case backendRedis:
+		var err error
+		if st, err = statestore.NewRedis(cfg.Redis, cfg.TTL, keyPrefix); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported backend: %s", cfg.Backend)
+	}
+
+	r, err := newRunner(cfg, fetch, st, logger)
+	if err != nil {
+		st.Close() //nolint:errcheck
+		return nil, err
+	}
+	return r, nil
+}
+
+func newRunner(cfg *Config, fetch Fetch, st statestore.Store, logger *slog.Logger) (*Runner, error) {
+	schedule, err := cron.Parse(cfg.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+	return &Runner{
+		cfg:      cfg,
+		slog:     logger,
+		schedule: schedule,
+		loc:      loc,
+		fetch:    fetch,
+		store:    st,
+		now:      time.Now,
+	}, nil
+}
+
+// Produce starts the schedule
+func (r *Runner) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	if r.c != nil {
+		return nil, errors.New("produce already called")
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.c = make(chan *message.RunnerMessage, buffer)
+
+	r.slog.Info("starting scheduled query", "schedule", r.cfg.Schedule, "timezone", r.cfg.Timezone, "changesOnly", r.cfg.ChangesOnly, "backend", r.cfg.Backend)
+
+	r.wg.Add(1)
+	go r.loop()
+	return r.c, nil
+}
+
+// loop runs the query on every activation of the schedule; the runs never overlap, an
+// activation elapsed during a run is skipped
+func (r *Runner) loop() {
+	defer r.wg.Done()
+	if r.cfg.RunOnStart {
+		r.runLogged(r.now())
+	}
+	for {
+		next := r.schedule.Next(r.now().In(r.loc))
+		if next.IsZero() {
+			r.slog.Error("the schedule has no next run", "schedule", r.cfg.Schedule)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-r.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		r.runLogged(next)
+	}
+}
+
+func (r *Runner) runLogged(at time.Time) {
+	if err := r.run(at); err != nil && r.ctx.Err() == nil {
+		r.slog.Error("scheduled query failed", "error", err)
+	}
+}
+
+// run runs the query and emits its rows
+func (r *Runner) run(at time.Time) error {
+	ctx, cancel := context.WithTimeout(r.ctx, r.cfg.Timeout)
+	rows, err := r.fetch(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	r.slog.Debug("scheduled query run", "rows", len(rows))
+
+	runAt := at.UTC().Format(time.RFC3339)
+	for i, row := range rows {
+		if err := r.emit(row, i, runAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emit stores the hash of the row as the state of its key and produces its message, unless
+// unchanged and only the changes are emitted
+func (r *Runner) emit(row map[string]any, index int, runAt string) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("failed to marshal row: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	key := hash
+	if r.cfg.KeyField != "" {
+		if key = rowKey(row[r.cfg.KeyField]); key == "" {
+			r.slog.Debug("row without key skipped", "keyField", r.cfg.KeyField)
+			return nil
+		}
+	}
+
+	prev, err := r.store.Swap(r.ctx, key, []byte(hash))
+	if err != nil {
+		return fmt.Errorf("failed to update state: %w", err)
+	}
+	state := StatusChanged
+	switch {
+	case prev == nil:
+		state = StatusNew
+	case string(prev) == hash:
+		state = StatusUnchanged
+	}
+	if state == StatusUnchanged && r.cfg.ChangesOnly {
+		return nil
+	}
+
+	msg := &QueryMessage{
+		runner: r,
+		key:    key,
+		data:   data,
+		metadata: map[string]string{
+			"key":           key,
+			"row":           strconv.Itoa(index),
+			"runAt":         runAt,
+			r.cfg.StatusKey: state,
+		},
+	}
+	select {
+	case r.c <- message.NewRunnerMessage(msg):
+		return nil
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+}
+
+// rowKey returns the key of a row from the JSON form of its key value, so that e.g. the
+// object ids and the timestamps are keyed by their usual string form
+func rowKey(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		return s
+	}
+	return string(data)
+}
+
+// Close stops the schedule and closes the state store
+func (r *Runner) Close() error {
+	if r.cancel != nil {
+		r.cancel()
+		r.wg.Wait()
+		close(r.c)
+		r.cancel = nil
+	}
+	return r.store.Close()
+}
+
+var _ message.SourceMessage = &QueryMessage{}
+
+// QueryMessage is a row of the result of a scheduled query
+type QueryMessage struct {
+	runner   *Runner
+	key      string
+	data     []byte
+	metadata map[string]string
+}
+
+func (m *QueryMessage) GetID() []byte {
+	return []byte(m.key)
+}
+
+func (m *QueryMessage) GetMetadata() (map[string]string, error) {
+	return m.metadata, nil
+}
+
+func (m *QueryMessage) GetData() ([]byte, error) {
+	return m.data, nil
+}
+
+func (m *QueryMessage) Ack(data *message.ReplyData) error {
+	// Query rows don't support reply
+	return nil
+}
+
+// Nak forgets the state of the row, so that the next run emits it again
+func (m *QueryMessage) Nak() error {
+	return m.runner.store.Delete(context.Background(), m.key)
+}
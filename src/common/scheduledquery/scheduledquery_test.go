@@ -0,0 +1,267 @@
+package scheduledquery
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/statestore"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+// fakeQuery returns the configured rows
+type fakeQuery struct {
+	mu   sync.Mutex
+	rows []map[string]any
+	err  error
+	runs int
+}
+
+func (q *fakeQuery) set(rows ...map[string]any) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rows = rows
+}
+
+func (q *fakeQuery) fetch(ctx context.Context) ([]map[string]any, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.runs++
+	return q.rows, q.err
+}
+
+// produce starts the runner of the query, returning its messages
+func produce(t *testing.T, cfg *Config, q *fakeQuery) (*Runner, <-chan *message.RunnerMessage) {
+	t.Helper()
+	r, err := newRunner(cfg, q.fetch, statestore.NewMemory(&cfg.Memory, cfg.TTL), slog.Default())
+	if err != nil {
+		t.Fatalf("newRunner() unexpected error = %v", err)
+	}
+	c, err := r.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r, c
+}
+
+// drain returns the messages produced so far
+func drain(c <-chan *message.RunnerMessage) []*message.RunnerMessage {
+	var msgs []*message.RunnerMessage
+	for {
+		select {
+		case msg := <-c:
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func statuses(t *testing.T, msgs []*message.RunnerMessage) map[string]string {
+	t.Helper()
+	res := map[string]string{}
+	for _, msg := range msgs {
+		meta, err := msg.GetMetadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[meta["key"]] = meta["eb-query-status"]
+	}
+	return res
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    map[string]any
+		wantErr bool
+	}{
+		{"valid", map[string]any{"schedule": "@hourly"}, false},
+		{"disabled", map[string]any{}, false},
+		{"invalid backend", map[string]any{"schedule": "@hourly", "backend": "etcd"}, true},
+		{"redis without config", map[string]any{"schedule": "@hourly", "backend": "redis"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := utils.ParseConfig(tt.opts, new(Config))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	for _, cfg := range []*Config{
+		{Schedule: "every minute", Timezone: "UTC", Backend: backendMemory, Memory: statestore.MemoryConfig{MaxKeys: 1}},
+		{Schedule: "@hourly", Timezone: "Mars/Olympus", Backend: backendMemory, Memory: statestore.MemoryConfig{MaxKeys: 1}},
+	} {
+		if _, err := New(cfg, (&fakeQuery{}).fetch, slog.Default()); err == nil {
+			t.Errorf("New(%+v) expected error", cfg)
+		}
+	}
+}
+
+func TestRunnerEmitsRows(t *testing.T) {
+	q := &fakeQuery{}
+	q.set(map[string]any{"id": 1, "total": 10}, map[string]any{"id": 2, "total": 20})
+	// A yearly schedule, run by the tests with Runner.run
+	cfg := &Config{
+		Schedule:   "@yearly",
+		Timezone:   "UTC",
+		Timeout:    time.Second,
+		RunOnStart: true,
+		KeyField:   "id",
+		StatusKey:  "eb-query-status",
+		Backend:    backendMemory,
+		Memory:     statestore.MemoryConfig{MaxKeys: 10},
+	}
+	r, c := produce(t, cfg, q)
+
+	var msgs []*message.RunnerMessage
+	for range 2 {
+		select {
+		case msg := <-c:
+			msgs = append(msgs, msg)
+		case <-time.After(time.Second):
+			t.Fatal("rows of the start run not emitted")
+		}
+	}
+	data, _ := msgs[0].GetData()
+	if string(data) != `{"id":1,"total":10}` {
+		t.Errorf("data = %s", data)
+	}
+	meta, _ := msgs[0].GetMetadata()
+	if meta["row"] != "0" || meta["runAt"] == "" {
+		t.Errorf("metadata = %v", meta)
+	}
+	if got := statuses(t, msgs); got["1"] != StatusNew || got["2"] != StatusNew {
+		t.Errorf("statuses = %v", got)
+	}
+
+	// Every row is emitted again, with its status
+	q.set(map[string]any{"id": 1, "total": 10}, map[string]any{"id": 2, "total": 25})
+	if err := r.run(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(t, drain(c)); got["1"] != StatusUnchanged || got["2"] != StatusChanged {
+		t.Errorf("statuses = %v", got)
+	}
+}
+
+func TestRunnerChangesOnly(t *testing.T) {
+	q := &fakeQuery{}
+	cfg := &Config{
+		Schedule:    "@yearly",
+		Timezone:    "UTC",
+		Timeout:     time.Second,
+		KeyField:    "id",
+		ChangesOnly: true,
+		StatusKey:   "eb-query-status",
+		Backend:     backendMemory,
+		Memory:      statestore.MemoryConfig{MaxKeys: 10},
+	}
+	r, c := produce(t, cfg, q)
+
+	q.set(map[string]any{"id": "a", "v": 1}, map[string]any{"id": "b", "v": 1}, map[string]any{"v": 1})
+	if err := r.run(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	// The row without key is skipped
+	if got := statuses(t, drain(c)); len(got) != 2 {
+		t.Errorf("statuses = %v", got)
+	}
+
+	q.set(map[string]any{"id": "a", "v": 1}, map[string]any{"id": "b", "v": 2})
+	if err := r.run(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	msgs := drain(c)
+	if got := statuses(t, msgs); len(got) != 1 || got["b"] != StatusChanged {
+		t.Fatalf("statuses = %v", got)
+	}
+
+	// A failed row is emitted again by the next run
+	if err := msgs[0].Nak(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.run(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(t, drain(c)); len(got) != 1 || got["b"] != StatusNew {
+		t.Errorf("statuses after nak = %v", got)
+	}
+}
+
+func TestRunnerHashKeys(t *testing.T) {
+	q := &fakeQuery{}
+	cfg := &Config{
+		Schedule:    "@yearly",
+		Timezone:    "UTC",
+		Timeout:     time.Second,
+		ChangesOnly: true,
+		StatusKey:   "eb-query-status",
+		Backend:     backendMemory,
+		Memory:      statestore.MemoryConfig{MaxKeys: 10},
+	}
+	r, c := produce(t, cfg, q)
+
+	q.set(map[string]any{"v": 1}, map[string]any{"v": 2})
+	if err := r.run(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := drain(c); len(got) != 2 {
+		t.Fatalf("messages = %d, want 2", len(got))
+	}
+	q.set(map[string]any{"v": 1}, map[string]any{"v": 3})
+	if err := r.run(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	msgs := drain(c)
+	if len(msgs) != 1 {
+		t.Fatalf("messages = %d, want 1", len(msgs))
+	}
+	if data, _ := msgs[0].GetData(); string(data) != `{"v":3}` {
+		t.Errorf("data = %s", data)
+	}
+}
+
+func TestRunnerErrors(t *testing.T) {
+	q := &fakeQuery{err: errors.New("relation does not exist")}
+	cfg := &Config{
+		Schedule:  "@yearly",
+		Timezone:  "UTC",
+		Timeout:   time.Second,
+		StatusKey: "eb-query-status",
+		Backend:   backendMemory,
+		Memory:    statestore.MemoryConfig{MaxKeys: 10},
+	}
+	r, _ := produce(t, cfg, q)
+	if err := r.run(time.Now()); err == nil || err.Error() != "relation does not exist" {
+		t.Errorf("run() error = %v", err)
+	}
+	if _, err := r.Produce(1); err == nil {
+		t.Error("Produce() expected error when called twice")
+	}
+}
+
+func TestRowKey(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{nil, ""},
+		{"abc", "abc"},
+		{42, "42"},
+		{time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), "2024-05-06T07:08:09Z"},
+		{[]int{1, 2}, "[1,2]"},
+	}
+	for _, tt := range tests {
+		if got := rowKey(tt.value); got != tt.want {
+			t.Errorf("rowKey(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
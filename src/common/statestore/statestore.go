@@ -0,0 +1,220 @@
+// Package statestore keeps the last value of every key, in memory or in Redis, for the
+// connectors comparing what they see with what they saw before (diffs, change detection,
+// deduplication).
+package statestore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+)
+
+// Store keeps the last payload of every key
+type Store interface {
+	// Swap stores the payload of the key and returns the previous one (nil when missing or expired)
+	Swap(ctx context.Context, key string, value []byte) ([]byte, error)
+	// Add stores the payload of the key unless the key is already stored and not expired,
+	// reporting whether it was stored. The expiry of a stored key is not extended.
+	Add(ctx context.Context, key string, value []byte) (bool, error)
+	// Delete removes the key
+	Delete(ctx context.Context, key string) error
+	Close() error
+}
+
+// MemoryConfig keeps the state in the process memory; it is lost on restart
+type MemoryConfig struct {
+	// MaxKeys bounds the number of keys, the least recently updated are evicted
+	MaxKeys int `mapstructure:"maxKeys" default:"100000" validate:"gt=0"`
+}
+
+// RedisConfig keeps the state in Redis, shared by the bridge instances and kept across restarts
+type RedisConfig struct {
+	// Redis server address (host:port)
+	Address string `mapstructure:"address" validate:"required"`
+	// Username for Redis ACL authentication (Redis 6+)
+	Username string `mapstructure:"username"`
+	// Password for authentication
+	Password string `mapstructure:"password"` //nolint:gosec // user-configured credential field
+	// Database number (0-15)
+	DB int `mapstructure:"db" default:"0" validate:"min=0,max=15"`
+	// TLS configuration for encrypted connections
+	TLS *tlsconfig.Config `mapstructure:"tls"`
+	// KeyPrefix is prepended to the state keys (default: the prefix of the connector, e.g. "eb-diff:")
+	KeyPrefix string `mapstructure:"keyPrefix"`
+}
+
+// memoryEntry is the state of a key in the memory store
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// memoryStore is an LRU map of the payloads
+type memoryStore struct {
+	mu      sync.Mutex
+	maxKeys int
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// NewMemory creates a memory store; the keys not updated for ttl expire (0 = never)
+func NewMemory(cfg *MemoryConfig, ttl time.Duration) Store {
+	return newMemoryStore(cfg, ttl)
+}
+
+func newMemoryStore(cfg *MemoryConfig, ttl time.Duration) *memoryStore {
+	return &memoryStore{
+		maxKeys: cfg.MaxKeys,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (s *memoryStore) Swap(ctx context.Context, key string, value []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var expires time.Time
+	if s.ttl > 0 {
+		expires = now.Add(s.ttl)
+	}
+
+	if el, ok := s.entries[key]; ok {
+		e := el.Value.(*memoryEntry)
+		prev := e.value
+		if !e.expires.IsZero() && !now.Before(e.expires) {
+			prev = nil
+		}
+		e.value, e.expires = value, expires
+		s.order.MoveToFront(el)
+		return prev, nil
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryEntry{key: key, value: value, expires: expires})
+	for s.order.Len() > s.maxKeys {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) Add(ctx context.Context, key string, value []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if el, ok := s.entries[key]; ok {
+		e := el.Value.(*memoryEntry)
+		if e.expires.IsZero() || now.Before(e.expires) {
+			return false, nil
+		}
+		s.order.Remove(el)
+		delete(s.entries, key)
+	}
+
+	var expires time.Time
+	if s.ttl > 0 {
+		expires = now.Add(s.ttl)
+	}
+	s.entries[key] = s.order.PushFront(&memoryEntry{key: key, value: value, expires: expires})
+	for s.order.Len() > s.maxKeys {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return true, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.order.Remove(el)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// redisStore swaps the payloads atomically with SET ... GET
+type redisStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedis creates a Redis store, prefixing the keys with the configured prefix or with
+// defaultPrefix; the keys not updated for ttl expire (0 = never)
+func NewRedis(cfg *RedisConfig, ttl time.Duration, defaultPrefix string) (Store, error) {
+	opts := &redis.Options{Addr: cfg.Address, DB: cfg.DB, Username: cfg.Username}
+	if cfg.Password != "" {
+		password, err := secrets.Resolve(cfg.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve password: %w", err)
+		}
+		opts.Password = password
+	}
+	tlsConf, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	opts.TLSConfig = tlsConf
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close() //nolint:errcheck
+		return nil, fmt.Errorf("failed to ping Redis: %w", err)
+	}
+	prefix := cfg.KeyPrefix
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+	return &redisStore{client: client, prefix: prefix, ttl: ttl}, nil
+}
+
+func (s *redisStore) Swap(ctx context.Context, key string, value []byte) ([]byte, error) {
+	prev, err := s.client.SetArgs(ctx, s.prefix+key, value, redis.SetArgs{Get: true, TTL: s.ttl}).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return prev, nil
+}
+
+func (s *redisStore) Add(ctx context.Context, key string, value []byte) (bool, error) {
+	err := s.client.SetArgs(ctx, s.prefix+key, value, redis.SetArgs{Mode: "NX", TTL: s.ttl}).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *redisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
+
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,97 @@
+package statestore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := newMemoryStore(&MemoryConfig{MaxKeys: 2}, time.Minute)
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	swap := func(key, value string) string {
+		prev, err := s.Swap(ctx, key, []byte(value))
+		if err != nil {
+			t.Fatalf("Swap() unexpected error = %v", err)
+		}
+		return string(prev)
+	}
+	swap("a", "1")
+	swap("b", "1")
+	if prev := swap("a", "2"); prev != "1" {
+		t.Errorf("previous = %q, want 1", prev)
+	}
+	// b is the least recently updated key
+	swap("c", "1")
+	if prev := swap("b", "2"); prev != "" {
+		t.Errorf("evicted key previous = %q, want none", prev)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if prev := swap("b", "3"); prev != "" {
+		t.Errorf("expired key previous = %q, want none", prev)
+	}
+}
+
+func TestMemoryStoreAdd(t *testing.T) {
+	s := newMemoryStore(&MemoryConfig{MaxKeys: 10}, time.Minute)
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	add := func(key string) bool {
+		added, err := s.Add(ctx, key, []byte("1"))
+		if err != nil {
+			t.Fatalf("Add() unexpected error = %v", err)
+		}
+		return added
+	}
+	if !add("a") || add("a") {
+		t.Fatal("Add() stored an existing key")
+	}
+	// The expiry is not extended by the rejected adds
+	now = now.Add(50 * time.Second)
+	add("a")
+	now = now.Add(20 * time.Second)
+	if !add("a") {
+		t.Error("expired key not added")
+	}
+	if err := s.Delete(ctx, "a"); err != nil || !add("a") {
+		t.Errorf("deleted key not added, error = %v", err)
+	}
+}
+
+func TestRedisStoreAdd(t *testing.T) {
+	srv, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	s, err := NewRedis(&RedisConfig{Address: srv.Addr()}, time.Minute, "test:")
+	if err != nil {
+		t.Fatalf("NewRedis() unexpected error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	ctx := context.Background()
+
+	if added, err := s.Add(ctx, "a", []byte("1")); err != nil || !added {
+		t.Fatalf("Add() = %v, %v", added, err)
+	}
+	if added, err := s.Add(ctx, "a", []byte("2")); err != nil || added {
+		t.Fatalf("Add() of an existing key = %v, %v", added, err)
+	}
+	if ttl := srv.TTL("test:a"); ttl != time.Minute {
+		t.Errorf("TTL = %v", ttl)
+	}
+	if err := s.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if added, _ := s.Add(ctx, "a", []byte("3")); !added {
+		t.Error("deleted key not added")
+	}
+}
@@ -0,0 +1,14 @@
+// Package tmplfuncs holds the functions of the Go templates of the connectors.
+package tmplfuncs
+
+import "github.com/Masterminds/sprig/v3"
+
+// FuncMap returns the sprig functions, for the text and the HTML templates, without env
+// and expandenv: the templates of the configuration must not read the environment of the
+// bridge, where the secrets are
+func FuncMap() map[string]any {
+	fm := sprig.GenericFuncMap()
+	delete(fm, "env")
+	delete(fm, "expandenv")
+	return fm
+}
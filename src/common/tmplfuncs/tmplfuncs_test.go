@@ -0,0 +1,27 @@
+package tmplfuncs
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestFuncMap(t *testing.T) {
+	fm := FuncMap()
+	for _, name := range []string{"env", "expandenv"} {
+		if _, ok := fm[name]; ok {
+			t.Errorf("FuncMap() has %s", name)
+		}
+	}
+	tpl, err := template.New("t").Funcs(fm).Parse(`{{ upper "a" }}{{ default "b" "" }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := tpl.Execute(&out, nil); err != nil || out.String() != "Ab" {
+		t.Errorf("Execute() = %q, %v", out.String(), err)
+	}
+	if _, err := template.New("t").Funcs(fm).Parse(`{{ env "HOME" }}`); err == nil {
+		t.Error("Parse() expected error for env")
+	}
+}
@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/sandrolain/events-bridge/src/common"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TraceparentKey is the W3C trace context header, and metadata key, of the span context
+	TraceparentKey = "traceparent"
+	// TracestateKey is the W3C trace context header, and metadata key, of the vendor state
+	TracestateKey = "tracestate"
+)
+
+// SpanContext is the part of a span propagated to the downstream systems
+type SpanContext = trace.SpanContext
+
+// propagator reads and writes the W3C trace context
+var propagator = propagation.TraceContext{}
+
+// metadataCarrier is the message metadata as carrier of the propagator, matching the keys
+// case-insensitively as the HTTP sources canonicalize the header names
+type metadataCarrier map[string]string
+
+func (c metadataCarrier) Get(key string) string {
+	return common.LookupFold(c, key)
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	common.DeleteFold(c, key)
+	c[key] = value
+}
+
+func (c metadataCarrier) Keys() []string {
+	return slices.Collect(maps.Keys(c))
+}
+
+// Extract returns the span context of the trace context metadata
+func Extract(meta map[string]string) (SpanContext, bool) {
+	c := trace.SpanContextFromContext(propagator.Extract(context.Background(), metadataCarrier(meta)))
+	return c, c.IsValid()
+}
+
+// Inject sets the trace context metadata of the span context, replacing the keys
+// differing only in case
+func Inject(meta map[string]string, c SpanContext) {
+	common.DeleteFold(meta, TraceparentKey)
+	common.DeleteFold(meta, TracestateKey)
+	propagator.Inject(trace.ContextWithSpanContext(context.Background(), c), metadataCarrier(meta))
+}
+
+// IsTraceContextKey reports whether the metadata key is a W3C trace context header
+func IsTraceContextKey(key string) bool {
+	return strings.EqualFold(key, TraceparentKey) || strings.EqualFold(key, TracestateKey)
+}
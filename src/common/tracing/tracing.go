@@ -0,0 +1,235 @@
+// Package tracing traces the messages through the pipeline with the OpenTelemetry SDK,
+// exporting the spans to a collector over OTLP/HTTP. The span contexts are propagated in
+// the message metadata as W3C trace context ("traceparent" and "tracestate"), so that the
+// targets forwarding the metadata as headers carry the trace downstream.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scopeName is the instrumentation scope of the spans of the bridge
+const scopeName = "github.com/sandrolain/events-bridge"
+
+const (
+	// DefaultServiceName is the "service.name" resource attribute of the spans
+	DefaultServiceName = "events-bridge"
+	// DefaultBatchSize is the maximum number of spans of an export request
+	DefaultBatchSize = 512
+	// DefaultInterval is the maximum time a span waits before being exported
+	DefaultInterval = 5 * time.Second
+	// DefaultTimeout bounds an export, retries included
+	DefaultTimeout = 10 * time.Second
+	// DefaultQueueSize is the number of ended spans waiting for the export, the spans
+	// ended while the queue is full being dropped
+	DefaultQueueSize = 2048
+)
+
+// SpanKind is the OpenTelemetry kind of a span
+type SpanKind = trace.SpanKind
+
+const (
+	KindInternal = trace.SpanKindInternal
+	KindServer   = trace.SpanKindServer
+	KindClient   = trace.SpanKindClient
+	KindProducer = trace.SpanKindProducer
+	KindConsumer = trace.SpanKindConsumer
+)
+
+var droppedSpans = metrics.NewCounterVec(
+	"eb_trace_spans_dropped_total",
+	"Spans dropped because the export failed.",
+)
+
+// Config configures the tracer and its OTLP exporter
+type Config struct {
+	// Endpoint is the URL of the OTLP/HTTP traces endpoint (e.g., "http://collector:4318/v1/traces")
+	Endpoint string
+	// ServiceName is the "service.name" resource attribute (default: DefaultServiceName)
+	ServiceName string
+	// SampleRatio is the ratio of the traces started by the bridge that are recorded; the
+	// traces continued from an upstream "traceparent" follow its sampled flag
+	SampleRatio float64
+	// Headers are sent with the export requests, e.g. the API key of a tracing vendor
+	Headers map[string]string
+	// BatchSize, Interval, Timeout and QueueSize tune the exporter (defaults when zero)
+	BatchSize int
+	Interval  time.Duration
+	Timeout   time.Duration
+	QueueSize int
+}
+
+// Tracer starts the spans, exported in batches by the OpenTelemetry SDK once ended
+type Tracer struct {
+	cfg      Config
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	logger   *slog.Logger
+}
+
+// New returns a tracer exporting to the endpoint of the configuration; Run stops the
+// export on shutdown
+func New(cfg Config, logger *slog.Logger) (*Tracer, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: an http or https URL is required", cfg.Endpoint)
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid sample ratio %v: must be between 0 and 1", cfg.SampleRatio)
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = DefaultServiceName
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(cfg.Endpoint),
+		otlptracehttp.WithHeaders(cfg.Headers),
+		otlptracehttp.WithTimeout(cfg.Timeout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	return newTracer(cfg, exporter, logger), nil
+}
+
+// newTracer returns a tracer exporting the spans in batches with the exporter
+func newTracer(cfg Config, exporter sdktrace.SpanExporter, logger *slog.Logger) *Tracer {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(&countingExporter{SpanExporter: exporter},
+			sdktrace.WithMaxExportBatchSize(cfg.BatchSize),
+			sdktrace.WithBatchTimeout(cfg.Interval),
+			sdktrace.WithExportTimeout(cfg.Timeout),
+			sdktrace.WithMaxQueueSize(cfg.QueueSize),
+		),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+		// The sampling decision is taken on the trace id, so that it is the same for every
+		// span of a trace, and the traces continued from upstream follow the parent
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	return &Tracer{
+		cfg:      cfg,
+		provider: provider,
+		tracer:   provider.Tracer(scopeName),
+		logger:   logger,
+	}
+}
+
+// countingExporter counts the spans of the failed exports, dropped by the batch processor;
+// the export errors are reported to the OpenTelemetry error handler
+type countingExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (e *countingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil {
+		droppedSpans.With().Add(float64(len(spans)))
+	}
+	return err
+}
+
+// Start starts a span, child of the parent span context when valid, root of a new trace otherwise
+func (t *Tracer) Start(name string, parent SpanContext, kind SpanKind) *Span {
+	ctx := context.Background()
+	if parent.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, parent)
+	}
+	_, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind))
+	return &Span{span: span}
+}
+
+// Run waits for the context to be cancelled, then exports the spans still queued and
+// stops the exporter
+func (t *Tracer) Run(ctx context.Context) {
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), t.cfg.Timeout)
+	defer cancel()
+	if err := t.provider.Shutdown(shutdownCtx); err != nil {
+		t.logger.Warn("failed to stop the span exporter", "error", err)
+	}
+}
+
+// Span is an operation of a trace. The methods of a nil span do nothing, so that the
+// code tracing the messages runs unchanged when tracing is not configured.
+type Span struct {
+	span trace.Span
+}
+
+// Context returns the span context to propagate, the zero value for a nil span
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.span.SpanContext()
+}
+
+// SetAttribute sets a string attribute of the span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+// SetError marks the span as failed with the error
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End ends the span, queued for the export when sampled; ending it again does nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// current is the process-wide tracer, shared by the pipelines started by a switchover
+var current atomic.Pointer[Tracer]
+
+// SetDefault sets the process-wide tracer used by Start; nil disables tracing
+func SetDefault(t *Tracer) {
+	current.Store(t)
+}
+
+// Enabled reports whether a process-wide tracer is set
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Start starts a span with the process-wide tracer, returning nil when tracing is disabled
+func Start(name string, parent SpanContext, kind SpanKind) *Span {
+	t := current.Load()
+	if t == nil {
+		return nil
+	}
+	return t.Start(name, parent, kind)
+}
@@ -0,0 +1,205 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestExtractInject(t *testing.T) {
+	meta := map[string]string{"Traceparent": testTraceparent, "Tracestate": "vendor=1", "x": "y"}
+	c, ok := Extract(meta)
+	if !ok || c.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || c.SpanID().String() != "00f067aa0ba902b7" ||
+		!c.IsSampled() || c.TraceState().String() != "vendor=1" {
+		t.Fatalf("Extract() = %+v, %v", c, ok)
+	}
+
+	c = c.WithSpanID(trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8})
+	Inject(meta, c)
+	want := map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-0102030405060708-01",
+		"tracestate":  "vendor=1",
+		"x":           "y",
+	}
+	if len(meta) != len(want) {
+		t.Errorf("metadata = %v", meta)
+	}
+	for k, v := range want {
+		if meta[k] != v {
+			t.Errorf("metadata %s = %q, want %q", k, meta[k], v)
+		}
+	}
+}
+
+func TestExtractInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"junk",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902zz-01",
+	} {
+		if c, ok := Extract(map[string]string{TraceparentKey: s}); ok {
+			t.Errorf("Extract(%q) = %+v, want no span context", s, c)
+		}
+	}
+}
+
+func TestSampling(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	never := newTracer(Config{SampleRatio: 0, BatchSize: 1, Interval: time.Second, Timeout: time.Second, QueueSize: 1}, exporter, slog.Default())
+	always := newTracer(Config{SampleRatio: 1, BatchSize: 1, Interval: time.Second, Timeout: time.Second, QueueSize: 1}, exporter, slog.Default())
+
+	if never.Start("s", SpanContext{}, KindInternal).Context().IsSampled() {
+		t.Error("ratio 0 sampled a new trace")
+	}
+	root := always.Start("s", SpanContext{}, KindInternal).Context()
+	if !root.IsSampled() || !root.IsValid() {
+		t.Errorf("ratio 1 root = %+v", root)
+	}
+
+	// The traces continued from upstream follow the sampled flag of the parent
+	parent, _ := Extract(map[string]string{TraceparentKey: testTraceparent})
+	child := never.Start("s", parent, KindInternal).Context()
+	if !child.IsSampled() || child.TraceID() != parent.TraceID() || child.SpanID() == parent.SpanID() {
+		t.Errorf("child = %+v", child)
+	}
+	parent = parent.WithTraceFlags(0)
+	if always.Start("s", parent, KindInternal).Context().IsSampled() {
+		t.Error("unsampled parent sampled")
+	}
+
+	half := newTracer(Config{SampleRatio: 0.5, BatchSize: 1, Interval: time.Second, Timeout: time.Second, QueueSize: 1}, exporter, slog.Default())
+	sampled := 0
+	for range 1000 {
+		if half.Start("s", SpanContext{}, KindInternal).Context().IsSampled() {
+			sampled++
+		}
+	}
+	if sampled < 400 || sampled > 600 {
+		t.Errorf("ratio 0.5 sampled %d of 1000 traces", sampled)
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	for _, cfg := range []Config{
+		{Endpoint: ""},
+		{Endpoint: "localhost:4318"},
+		{Endpoint: "grpc://collector:4317"},
+		{Endpoint: "http://collector:4318/v1/traces", SampleRatio: 1.5},
+	} {
+		if _, err := New(cfg, slog.Default()); err == nil {
+			t.Errorf("New(%+v) expected error", cfg)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	requests := make(chan *coltracepb.ExportTraceServiceRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("X-Api-Key") != "secret" {
+			t.Errorf("request %s, headers = %v", r.URL.Path, r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := new(coltracepb.ExportTraceServiceRequest)
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		requests <- req
+	}))
+	defer srv.Close()
+
+	tracer, err := New(Config{
+		Endpoint:    srv.URL + "/v1/traces",
+		ServiceName: "bridge-test",
+		SampleRatio: 1,
+		Headers:     map[string]string{"X-Api-Key": "secret"},
+		Interval:    time.Hour,
+	}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tracer.Run(ctx)
+		close(done)
+	}()
+
+	root := tracer.Start("message", SpanContext{}, KindConsumer)
+	root.SetAttribute("eb.source", "http")
+	child := tracer.Start("runner[0]", root.Context(), KindInternal)
+	child.SetError(errors.New("boom"))
+	child.End()
+	child.End()
+	root.End()
+
+	// The queued spans are exported on shutdown
+	cancel()
+	<-done
+
+	var spans []*tracepb.Span
+	for len(requests) > 0 {
+		req := <-requests
+		rs := req.ResourceSpans[0]
+		if rs.Resource.Attributes[0].Value.GetStringValue() != "bridge-test" {
+			t.Errorf("resource = %+v", rs.Resource)
+		}
+		spans = append(spans, rs.ScopeSpans[0].Spans...)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	c, r := spans[0], spans[1]
+	if c.Name != "runner[0]" || hex.EncodeToString(c.ParentSpanId) != root.Context().SpanID().String() ||
+		hex.EncodeToString(c.TraceId) != hex.EncodeToString(r.TraceId) || c.Status.Code != tracepb.Status_STATUS_CODE_ERROR ||
+		c.Status.Message != "boom" || c.Kind != tracepb.Span_SPAN_KIND_INTERNAL {
+		t.Errorf("child span = %+v", c)
+	}
+	if r.Name != "message" || len(r.ParentSpanId) != 0 || r.Kind != tracepb.Span_SPAN_KIND_CONSUMER ||
+		r.Status.GetCode() != tracepb.Status_STATUS_CODE_UNSET || len(r.Attributes) != 1 || r.Attributes[0].Key != "eb.source" {
+		t.Errorf("root span = %+v", r)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	if Enabled() || Start("s", SpanContext{}, KindInternal) != nil {
+		t.Fatal("tracing enabled without a tracer")
+	}
+	// The methods of the nil spans do nothing
+	var s *Span
+	s.SetAttribute("k", "v")
+	s.SetError(errors.New("e"))
+	s.End()
+	if s.Context().IsValid() {
+		t.Error("nil span has a valid context")
+	}
+
+	tracer, err := New(Config{Endpoint: "http://localhost:4318/v1/traces"}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDefault(tracer)
+	defer SetDefault(nil)
+	if !Enabled() || Start("s", SpanContext{}, KindInternal) == nil {
+		t.Error("tracing disabled with a tracer")
+	}
+}
@@ -0,0 +1,233 @@
+// Package version describes the build of the events bridge and of its connector plugins.
+//
+// The version, commit and date are injected at build time:
+//
+//	go build -ldflags "-X github.com/sandrolain/events-bridge/src/common/version.Version=v1.4.0 \
+//	  -X github.com/sandrolain/events-bridge/src/common/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/sandrolain/events-bridge/src/common/version.Date=$(date -u +%FT%TZ)"
+//
+// Without them the version control information stamped by the Go toolchain is used.
+// The connector plugins are described from their build information, read from the plugin
+// files without loading them, so that the same flags passed to the plugin builds identify
+// the connector revisions of a deployment.
+package version
+
+import (
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Build metadata set with -ldflags "-X"
+var (
+	Version string
+	Commit  string
+	Date    string
+)
+
+const (
+	// pkgPath is the import path of the package, prefix of the -X flags
+	pkgPath = "github.com/sandrolain/events-bridge/src/common/version"
+	// develVersion is the version of the builds without version
+	develVersion = "devel"
+)
+
+// Info is the build metadata of a binary
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	Date    string `json:"date,omitempty"`
+	// Modified reports a build of a working tree with uncommitted changes
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform,omitempty"`
+}
+
+// Connector is the build metadata of a connector plugin
+type Connector struct {
+	Name string `json:"name"`
+	Info
+	// SHA256 is the hash of the plugin file, identifying the build
+	SHA256 string `json:"sha256,omitempty"`
+	// Error is set when the plugin file can't be read
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the build metadata of a deployment: the binary, its connector plugins and the
+// features enabled by the configuration
+type Report struct {
+	Info
+	Connectors []Connector `json:"connectors"`
+	Features   []string    `json:"features,omitempty"`
+}
+
+// cachedConnector is the metadata of a plugin file, valid while its size and modification
+// time are unchanged
+type cachedConnector struct {
+	size    int64
+	modTime time.Time
+	info    Connector
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = map[string]cachedConnector{}
+)
+
+// Get returns the build metadata of the running binary
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		fromBuildInfo(&info, bi)
+	}
+	if info.Version == "" {
+		info.Version = develVersion
+	}
+	return info
+}
+
+// fromBuildInfo completes the metadata not injected with the version control information
+// and the -X flags of the build
+func fromBuildInfo(info *Info, bi *debug.BuildInfo) {
+	var ldflags, revision, vcsTime, goos, goarch string
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "-ldflags":
+			ldflags = s.Value
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.time":
+			vcsTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		case "GOOS":
+			goos = s.Value
+		case "GOARCH":
+			goarch = s.Value
+		}
+	}
+	if info.Platform == "" && goos != "" && goarch != "" {
+		info.Platform = goos + "/" + goarch
+	}
+	flags := parseLDFlags(ldflags)
+	for _, f := range []struct {
+		value    *string
+		name     string
+		fallback string
+	}{
+		{&info.Version, "Version", bi.Main.Version},
+		{&info.Commit, "Commit", revision},
+		{&info.Date, "Date", vcsTime},
+	} {
+		if *f.value == "" {
+			*f.value = flags[f.name]
+		}
+		if *f.value == "" && f.fallback != "(devel)" {
+			*f.value = f.fallback
+		}
+	}
+	if info.GoVersion == "" {
+		info.GoVersion = bi.GoVersion
+	}
+}
+
+// parseLDFlags returns the values of the -X flags of the package
+func parseLDFlags(ldflags string) map[string]string {
+	values := map[string]string{}
+	fields := strings.Fields(ldflags)
+	for i, f := range fields {
+		var def string
+		switch {
+		case f == "-X" && i+1 < len(fields):
+			def = fields[i+1]
+		case strings.HasPrefix(f, "-X="):
+			def = strings.TrimPrefix(f, "-X=")
+		default:
+			continue
+		}
+		name, value, ok := strings.Cut(strings.Trim(def, `"'`), "=")
+		if name, found := strings.CutPrefix(name, pkgPath+"."); ok && found {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// Connectors returns the build metadata of the connector plugins (*.so) of a directory,
+// sorted by name
+func Connectors(dir string) ([]Connector, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	connectors := make([]Connector, 0, len(paths))
+	for _, path := range paths {
+		connectors = append(connectors, readConnector(path))
+	}
+	return connectors, nil
+}
+
+// readConnector returns the metadata of a plugin file, hashing it only when it changed
+func readConnector(path string) Connector {
+	c := Connector{Name: strings.TrimSuffix(filepath.Base(path), ".so")}
+	stat, err := os.Stat(path)
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	cacheMu.Lock()
+	cached, ok := cache[path]
+	cacheMu.Unlock()
+	if ok && cached.size == stat.Size() && cached.modTime.Equal(stat.ModTime()) {
+		return cached.info
+	}
+
+	c = describeConnector(c, path)
+	cacheMu.Lock()
+	cache[path] = cachedConnector{size: stat.Size(), modTime: stat.ModTime(), info: c}
+	cacheMu.Unlock()
+	return c
+}
+
+func describeConnector(c Connector, path string) Connector {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	c.SHA256 = sum
+	bi, err := buildinfo.ReadFile(path)
+	if err != nil {
+		c.Error = fmt.Sprintf("no build information: %v", err)
+		return c
+	}
+	fromBuildInfo(&c.Info, bi)
+	if c.Version == "" {
+		c.Version = develVersion
+	}
+	return c
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path) //nolint:gosec // plugin files of the connectors directory
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint:errcheck
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,89 @@
+package version
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+)
+
+func TestParseLDFlags(t *testing.T) {
+	flags := parseLDFlags(`-s -w -X ` + pkgPath + `.Version=v1.4.0 -X=` + pkgPath + `.Commit=abc123 -X main.other=x -X "` + pkgPath + `.Date=2026-01-02T03:04:05Z"`)
+	if flags["Version"] != "v1.4.0" || flags["Commit"] != "abc123" || flags["Date"] != "2026-01-02T03:04:05Z" || len(flags) != 3 {
+		t.Errorf("flags = %v", flags)
+	}
+}
+
+func TestFromBuildInfo(t *testing.T) {
+	bi := &debug.BuildInfo{
+		GoVersion: "go1.25.0",
+		Main:      debug.Module{Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "-ldflags", Value: "-X " + pkgPath + ".Version=v2.0.0"},
+			{Key: "vcs.revision", Value: "0123abcd"},
+			{Key: "vcs.time", Value: "2026-01-02T03:04:05Z"},
+			{Key: "vcs.modified", Value: "true"},
+			{Key: "GOOS", Value: "linux"},
+			{Key: "GOARCH", Value: "arm64"},
+		},
+	}
+	var info Info
+	fromBuildInfo(&info, bi)
+	want := Info{Version: "v2.0.0", Commit: "0123abcd", Date: "2026-01-02T03:04:05Z", Modified: true, GoVersion: "go1.25.0", Platform: "linux/arm64"}
+	if info != want {
+		t.Errorf("info = %+v, want %+v", info, want)
+	}
+
+	// The injected values take precedence
+	info = Info{Version: "v3", Commit: "feed"}
+	fromBuildInfo(&info, bi)
+	if info.Version != "v3" || info.Commit != "feed" {
+		t.Errorf("injected values overridden: %+v", info)
+	}
+}
+
+func TestConnectors(t *testing.T) {
+	// The test binary stands for a plugin with build information
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, content := range map[string][]byte{"kafka.so": data, "broken.so": []byte("x"), "README": nil} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	connectors, err := Connectors(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(connectors) != 2 || connectors[0].Name != "broken" || connectors[1].Name != "kafka" {
+		t.Fatalf("connectors = %+v", connectors)
+	}
+	if c := connectors[0]; c.Error == "" || c.SHA256 == "" {
+		t.Errorf("broken connector = %+v", c)
+	}
+	if c := connectors[1]; c.Error != "" || c.Version == "" || c.GoVersion == "" || len(c.SHA256) != 64 {
+		t.Errorf("kafka connector = %+v", c)
+	}
+
+	// The metadata is computed again when the file changes
+	if err := os.WriteFile(filepath.Join(dir, "kafka.so"), []byte("rebuilt"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if connectors, _ = Connectors(dir); connectors[1].Error == "" {
+		t.Errorf("changed connector = %+v", connectors[1])
+	}
+}
+
+func TestGet(t *testing.T) {
+	if info := Get(); info.Version == "" || info.GoVersion == "" || info.Platform == "" {
+		t.Errorf("Get() = %+v", info)
+	}
+}
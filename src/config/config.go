@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
@@ -15,6 +16,8 @@ import (
 	kfile "github.com/knadh/koanf/providers/file"
 	kraw "github.com/knadh/koanf/providers/rawbytes"
 	kfn "github.com/knadh/koanf/v2"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/utils"
 )
 
 func LoadConfig() (cfg *Config, err error) {
@@ -36,12 +39,64 @@ func LoadConfig() (cfg *Config, err error) {
 	}
 
 	if envCfg.ConfigContent != "" {
-		slog.Info("loading configuration from content", "format", envCfg.ConfigFormat)
-		return loadConfigContent(envCfg.ConfigContent, envCfg.ConfigFormat)
+		slog.Info("loading configuration from content", "format", envCfg.ConfigFormat, "profile", envCfg.Profile)
+		return loadConfigContent(envCfg.ConfigContent, envCfg.ConfigFormat, envCfg.Profile)
 	}
 
-	slog.Info("loading configuration file", "path", envCfg.ConfigFilePath)
-	return loadConfigFile(envCfg.ConfigFilePath)
+	slog.Info("loading configuration file", "path", envCfg.ConfigFilePath, "profile", envCfg.Profile)
+	return loadConfigFile(envCfg.ConfigFilePath, envCfg.Profile)
+}
+
+// ParseFile loads a configuration file the same way as the startup configuration,
+// including the selected profile and environment overrides. It is used to apply
+// configurations at runtime.
+func ParseFile(path string) (*Config, error) {
+	profile, err := selectedProfile()
+	if err != nil {
+		return nil, err
+	}
+	return loadConfigFile(path, profile)
+}
+
+// ParseContent loads raw YAML/JSON configuration content the same way as the startup
+// configuration, including the selected profile and environment overrides. An empty
+// format is auto-detected.
+func ParseContent(content string, format string) (*Config, error) {
+	profile, err := selectedProfile()
+	if err != nil {
+		return nil, err
+	}
+	return loadConfigContent(content, format, profile)
+}
+
+// ParseRunnerFile loads a single runner configuration (YAML or JSON) with its includes,
+// e.g. for the runner test harness. Environment overrides are not applied.
+func ParseRunnerFile(path string) (*connectors.RunnerConfig, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	parser, err := parserForExtension(filepath.Ext(absPath))
+	if err != nil {
+		return nil, err
+	}
+
+	k := kfn.New(".")
+	if err := loadWithIncludes(k, kfile.Provider(absPath), parser, filepath.Dir(absPath), map[string]bool{absPath: true}); err != nil {
+		return nil, fmt.Errorf("error loading runner file: %w", err)
+	}
+
+	cfg := &connectors.RunnerConfig{}
+	if err := k.UnmarshalWithConf("", cfg, kfn.UnmarshalConf{Tag: "yaml"}); err != nil {
+		return nil, fmt.Errorf("error unmarshalling runner config: %w", err)
+	}
+	if cfg.Type == "" {
+		return nil, fmt.Errorf("runner type is required")
+	}
+	if err := validator.New().Struct(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
 // parseStringArg extracts a string value from CLI argument
@@ -75,6 +130,7 @@ func parseStringArg(args []string, i int, argName string) (value string, newInde
 //	--config-file-path <path> | --config-file-path=<path>
 //	--config-content <yaml|json string> | --config-content=<...>
 //	--config-format <yaml|yml|json> | --config-format=<yaml|yml|json>
+//	--profile <name> | --profile=<name>
 //
 // CLI values take precedence over environment variables.
 func applyCLIOverrides(cfg *EnvConfig) error {
@@ -110,6 +166,13 @@ func applyCLIOverrides(cfg *EnvConfig) error {
 				return fmt.Errorf("unsupported config format: %s (supported: yaml, yml, json)", value)
 			}
 			cfg.ConfigFormat = value
+
+		case strings.HasPrefix(arg, "--profile="), arg == "--profile":
+			value, i, err = parseStringArg(args, i, "--profile")
+			if err != nil {
+				return err
+			}
+			cfg.Profile = value
 		}
 	}
 	return nil
@@ -135,13 +198,14 @@ func loadEnvConfig() (*EnvConfig, error) {
 	return ec, nil
 }
 
-// LoadConfigFile loads configuration from a file (YAML or JSON) and merges environment overrides.
+// LoadConfigFile loads configuration from a file (YAML or JSON), merges the profile, if any, and
+// the environment overrides.
 // Environment variables use the prefix "EB_" and map to keys by:
 // - trimming the prefix
 // - lowercasing
 // - replacing "__" with "." (double underscore denotes nesting)
 // Arrays can be indexed with segments like "__0".
-func loadConfigFile(path string) (cfg *Config, err error) {
+func loadConfigFile(path string, profile string) (cfg *Config, err error) {
 	absPath, e := filepath.Abs(path)
 	if e != nil {
 		return nil, e
@@ -151,42 +215,31 @@ func loadConfigFile(path string) (cfg *Config, err error) {
 		return nil, fmt.Errorf("error opening config file: %w", e)
 	}
 
-	ext := strings.ToLower(filepath.Ext(absPath))
-	var parser kfn.Parser
-	switch ext {
-	case ".yaml", ".yml":
-		parser = kyaml.Parser()
-	case ".json":
-		parser = kjson.Parser()
-	default:
-		return nil, &UnsupportedExtensionError{Extension: ext}
+	parser, e := parserForExtension(filepath.Ext(absPath))
+	if e != nil {
+		return nil, e
 	}
 
 	k := kfn.New(".")
-	if e = k.Load(kfile.Provider(absPath), parser); e != nil {
+	if e = loadWithIncludes(k, kfile.Provider(absPath), parser, filepath.Dir(absPath), map[string]bool{absPath: true}); e != nil {
 		return nil, fmt.Errorf("error loading config file: %w", e)
 	}
+	if e = applyProfile(k, profile); e != nil {
+		return nil, e
+	}
 
 	// Env overrides (optional, prefix EB_)
 	if e = loadEnv(k); e != nil {
 		return nil, e
 	}
 
-	cfg = &Config{}
-	if e = k.UnmarshalWithConf("", cfg, kfn.UnmarshalConf{Tag: "yaml"}); e != nil {
-		return nil, fmt.Errorf("error unmarshalling config: %w", e)
-	}
-
-	validate := validator.New()
-	if e = validate.Struct(cfg); e != nil {
-		return nil, e
-	}
-	return cfg, nil
+	return unmarshalConfig(k)
 }
 
-// LoadConfigContent loads configuration from raw YAML/JSON content and merges environment overrides.
+// LoadConfigContent loads configuration from raw YAML/JSON content, merges the profile, if any, and
+// the environment overrides.
 // If format is empty, attempts to auto-detect (JSON if trimmed content starts with '{').
-func loadConfigContent(content string, format string) (cfg *Config, err error) {
+func loadConfigContent(content string, format string, profile string) (cfg *Config, err error) {
 	trimmed := strings.TrimSpace(content)
 	f := strings.ToLower(strings.TrimSpace(format))
 	var parser kfn.Parser
@@ -205,28 +258,70 @@ func loadConfigContent(content string, format string) (cfg *Config, err error) {
 		return nil, &UnsupportedExtensionError{Extension: f}
 	}
 
+	// Relative includes in inline content are resolved against the working directory
 	k := kfn.New(".")
-	if err = k.Load(kraw.Provider([]byte(content)), parser); err != nil {
+	if err = loadWithIncludes(k, kraw.Provider([]byte(content)), parser, ".", map[string]bool{}); err != nil {
 		return nil, fmt.Errorf("error loading config content: %w", err)
 	}
+	if err = applyProfile(k, profile); err != nil {
+		return nil, err
+	}
 
 	// Env overrides (optional, prefix EB_)
 	if err = loadEnv(k); err != nil {
 		return nil, err
 	}
 
-	cfg = &Config{}
-	if err = k.UnmarshalWithConf("", cfg, kfn.UnmarshalConf{Tag: "yaml"}); err != nil {
+	return unmarshalConfig(k)
+}
+
+// unmarshalConfig resolves connector definitions, then unmarshals and validates the configuration
+func unmarshalConfig(k *kfn.Koanf) (*Config, error) {
+	raw := k.Raw()
+	if err := resolveDefinitions(raw); err != nil {
+		return nil, fmt.Errorf("error resolving definitions: %w", err)
+	}
+
+	resolved := kfn.New(".")
+	if err := resolved.Load(mapProvider(raw), nil); err != nil {
+		return nil, fmt.Errorf("error loading resolved config: %w", err)
+	}
+
+	cfg := &Config{}
+	if err := resolved.UnmarshalWithConf("", cfg, kfn.UnmarshalConf{Tag: "yaml"}); err != nil {
 		return nil, fmt.Errorf("error unmarshalling config: %w", err)
 	}
+	if cfg.StrictConfig {
+		if err := checkUnknownKeys(raw); err != nil {
+			return nil, fmt.Errorf("error unmarshalling config: %w", err)
+		}
+	}
+	if err := normalizeSources(cfg); err != nil {
+		return nil, err
+	}
 
 	validate := validator.New()
-	if err = validate.Struct(cfg); err != nil {
+	if err := validate.Struct(cfg); err != nil {
 		return nil, err
 	}
 	return cfg, nil
 }
 
+// envConfigKeys are the keys loaded from the EnvConfig variables sharing the "EB_" prefix
+var envConfigKeys = []string{"config_file_path", "config_content", "config_format", "profile"}
+
+// checkUnknownKeys rejects the keys of the configuration matching no field, the options of
+// the connectors aside: they are checked against the connector config when it is loaded
+func checkUnknownKeys(raw map[string]any) error {
+	keys := make(map[string]any, len(raw))
+	for k, v := range raw {
+		if !slices.Contains(envConfigKeys, k) {
+			keys[k] = v
+		}
+	}
+	return utils.CheckUnknownOptions(keys, &Config{}, "yaml")
+}
+
 func loadEnv(k *kfn.Koanf) error {
 	// Allow overriding config via environment variables with prefix EB_.
 	// Example: EB_SOURCE__TYPE=http
@@ -252,3 +347,65 @@ type UnsupportedExtensionError struct {
 func (e *UnsupportedExtensionError) Error() string {
 	return "unsupported config file extension: " + e.Extension
 }
+
+// normalizeSources turns a configuration listing several sources into a "multi" source.
+// The sources entries default their id to their type, and must not set the settings
+// shared by all of them on the source section.
+func normalizeSources(cfg *Config) error {
+	if len(cfg.Sources) == 0 {
+		return nil
+	}
+	if cfg.Source.Type != "" && cfg.Source.Type != connectors.MultiSourceType {
+		return fmt.Errorf("source type %q cannot be combined with sources", cfg.Source.Type)
+	}
+	cfg.Source.Type = connectors.MultiSourceType
+
+	ids := make(map[string]bool, len(cfg.Sources))
+	for i := range cfg.Sources {
+		src := &cfg.Sources[i]
+		if src.Type == connectors.MultiSourceType {
+			return fmt.Errorf("sources %d: nested multi source", i)
+		}
+		if src.Reply || len(src.Middleware) > 0 || src.ReplyPlan != nil {
+			return fmt.Errorf("sources %d: reply, middleware and replyPlan are set on the source section", i)
+		}
+		if src.ID == "" {
+			src.ID = src.Type
+		}
+		if ids[src.ID] {
+			return fmt.Errorf("sources %d: duplicate source id %q, set distinct ids", i, src.ID)
+		}
+		ids[src.ID] = true
+	}
+	return nil
+}
+
+// Features returns the optional features enabled by the configuration, named after their
+// configuration keys
+func (c *Config) Features() []string {
+	var features []string
+	for _, f := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"sources", len(c.Sources) > 0},
+		{"pipeline", c.Pipeline != nil},
+		{"deadLetter", c.DeadLetter != nil},
+		{"slo", c.SLO != nil},
+		{"safetyValve", c.SafetyValve != nil},
+		{"admin", c.Admin != nil},
+		{"diagnostics", c.Diagnostics != nil},
+		{"payloadLimit", c.PayloadLimit != nil},
+		{"workDir", c.WorkDir != nil},
+		{"profiling", c.Profiling != nil},
+		{"metrics", c.Metrics != nil},
+		{"tracing", c.Tracing != nil},
+		{"lineage", c.Lineage != nil},
+		{"strictConfig", c.StrictConfig},
+	} {
+		if f.enabled {
+			features = append(features, f.name)
+		}
+	}
+	return features
+}
@@ -115,7 +115,7 @@ func TestLoadConfigFileYAMLWithEnvOverrides(t *testing.T) {
 	t.Setenv("EB_SOURCE__OPTIONS__SUBJECT", "fromenv")
 	t.Setenv("EB_TARGET__OPTIONS__SUBJECT", "outenv")
 
-	cfg, err := loadConfigFile(cfgPath)
+	cfg, err := loadConfigFile(cfgPath, "")
 	require.NoError(t, err)
 	require.NotNil(t, cfg)
 	require.Equal(t, "nats", string(cfg.Source.Type))
@@ -139,7 +139,7 @@ func TestLoadConfigFileUnsupportedExtension(t *testing.T) {
 	path := filepath.Join(dir, "config.toml")
 	require.NoError(t, os.WriteFile(path, []byte("key='value'"), 0o600))
 
-	_, err := loadConfigFile(path)
+	_, err := loadConfigFile(path, "")
 	require.Error(t, err)
 	var ue *UnsupportedExtensionError
 	require.ErrorAs(t, err, &ue)
@@ -151,7 +151,7 @@ func TestLoadConfigFileInvalidYAML(t *testing.T) {
 	path := filepath.Join(dir, configFileName)
 	require.NoError(t, os.WriteFile(path, []byte("source: [\n  invalid"), 0o600))
 
-	_, err := loadConfigFile(path)
+	_, err := loadConfigFile(path, "")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "error loading config file")
 }
@@ -170,13 +170,13 @@ func TestLoadConfigFileValidationError(t *testing.T) {
 	}, "\n")
 	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o600))
 
-	_, err := loadConfigFile(path)
+	_, err := loadConfigFile(path, "")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "Source.Type")
 }
 
 func TestLoadConfigFileFileNotFound(t *testing.T) {
-	_, err := loadConfigFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	_, err := loadConfigFile(filepath.Join(t.TempDir(), "missing.yaml"), "")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "error opening config file")
 }
@@ -200,7 +200,7 @@ func TestLoadConfigContentYAMLAndJSONAutoDetectAndExplicit(t *testing.T) {
 		"    subject: b",
 	}, "\n")
 
-	cfg, err := loadConfigContent(yaml, "yaml")
+	cfg, err := loadConfigContent(yaml, "yaml", "")
 	require.NoError(t, err)
 	require.Equal(t, "a", cfg.Source.Options["subject"])
 	if len(cfg.Runners) > 0 {
@@ -209,7 +209,7 @@ func TestLoadConfigContentYAMLAndJSONAutoDetectAndExplicit(t *testing.T) {
 
 	// JSON auto-detect
 	json := `{"source":{"type":"nats","options":{"address":"127.0.0.1:4222","subject":"ja"}},"runners":[{"type":"nats","options":{"address":"127.0.0.1:4222","subject":"jb"}}]}`
-	cfg2, err := loadConfigContent(json, "")
+	cfg2, err := loadConfigContent(json, "", "")
 	require.NoError(t, err)
 	require.Equal(t, "ja", cfg2.Source.Options["subject"])
 	if len(cfg2.Runners) > 0 {
@@ -218,7 +218,7 @@ func TestLoadConfigContentYAMLAndJSONAutoDetectAndExplicit(t *testing.T) {
 }
 
 func TestLoadConfigContentUnsupportedFormat(t *testing.T) {
-	_, err := loadConfigContent("key: val", "toml")
+	_, err := loadConfigContent("key: val", "toml", "")
 	require.Error(t, err)
 	var ue *UnsupportedExtensionError
 	require.ErrorAs(t, err, &ue)
@@ -226,7 +226,7 @@ func TestLoadConfigContentUnsupportedFormat(t *testing.T) {
 }
 
 func TestLoadConfigContentInvalidYAML(t *testing.T) {
-	_, err := loadConfigContent("source: [\n  broken", "yaml")
+	_, err := loadConfigContent("source: [\n  broken", "yaml", "")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "error loading config content")
 }
@@ -239,7 +239,7 @@ func TestLoadConfigContentValidationError(t *testing.T) {
 		targetKeyLine,
 		targetTypeNatsLine,
 	}, "\n")
-	_, err := loadConfigContent(yaml, "yaml")
+	_, err := loadConfigContent(yaml, "yaml", "")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "Source.Type")
 }
@@ -305,3 +305,102 @@ func TestUnsupportedExtensionErrorError(t *testing.T) {
 func TestEnvironment(t *testing.T) {
 	require.NotEmpty(t, runtime.GOOS)
 }
+
+func TestParseRunnerFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "shared.yaml", "options:\n  path: ./transform.js\n  timeout: 2s\n")
+	path := writeFile(t, dir, "runner.yaml", strings.Join([]string{
+		"include:",
+		"  - shared.yaml",
+		"type: es5",
+		"filterExpr: metadata.keep == \"true\"",
+		"maxRetryAfter: 30s",
+		"options:",
+		"  timeout: 5s",
+	}, "\n"))
+
+	cfg, err := ParseRunnerFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "es5", cfg.Type)
+	require.Equal(t, `metadata.keep == "true"`, cfg.FilterExpr)
+	require.Equal(t, "./transform.js", cfg.Options["path"])
+	require.Equal(t, "5s", cfg.Options["timeout"])
+	require.Equal(t, "30s", cfg.MaxRetryAfter.String())
+
+	_, err = ParseRunnerFile(writeFile(t, dir, "untyped.yaml", "options:\n  path: x\n"))
+	require.Error(t, err)
+	_, err = ParseRunnerFile(filepath.Join(dir, "missing.yaml"))
+	require.Error(t, err)
+}
+
+func TestLoadConfigContentSources(t *testing.T) {
+	content := `
+source:
+  buffer: 100
+  reply: true
+sources:
+  - type: mqtt
+    id: sensors
+  - type: http
+    buffer: 10
+runners:
+  - type: pass
+`
+	cfg, err := loadConfigContent(content, "yaml", "")
+	require.NoError(t, err)
+	require.Equal(t, "multi", cfg.Source.Type)
+	require.Equal(t, 100, cfg.Source.Buffer)
+	require.Len(t, cfg.Sources, 2)
+	require.Equal(t, "sensors", cfg.Sources[0].ID)
+	require.Equal(t, "http", cfg.Sources[1].ID)
+	require.Equal(t, 10, cfg.Sources[1].Buffer)
+
+	for _, invalid := range []string{
+		"source:\n  type: http\nsources:\n  - type: mqtt\n",
+		"sources:\n  - type: http\n  - type: http\n",
+		"sources:\n  - type: http\n    reply: true\n",
+		"sources:\n  - type: multi\n",
+		"sources:\n  - id: nope\n",
+	} {
+		_, err := loadConfigContent(invalid, "yaml", "")
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestLoadConfigContentStrict(t *testing.T) {
+	content := `
+strictConfig: true
+source:
+  type: http
+  bufer: 10
+  options:
+    anything: goes
+runners:
+  - type: pass
+    retry:
+      maxAtempts: 3
+`
+	_, err := loadConfigContent(content, "yaml", "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unknown option "runners[0].retry.maxAtempts" (did you mean "maxAttempts"?)`)
+	require.Contains(t, err.Error(), `unknown option "source.bufer" (did you mean "buffer"?)`)
+
+	// Without strictConfig the unknown keys are ignored
+	_, err = loadConfigContent(strings.Replace(content, "strictConfig: true", "", 1), "yaml", "")
+	require.NoError(t, err)
+}
+
+func TestConfigFeatures(t *testing.T) {
+	if features := (&Config{}).Features(); len(features) != 0 {
+		t.Errorf("Features() = %v, want none", features)
+	}
+	cfg := &Config{
+		DeadLetter:   &DeadLetterConfig{},
+		Tracing:      &TracingConfig{},
+		Lineage:      &LineageConfig{},
+		StrictConfig: true,
+	}
+	if got := strings.Join(cfg.Features(), ","); got != "deadLetter,tracing,lineage,strictConfig" {
+		t.Errorf("Features() = %s", got)
+	}
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strings"
+
+	kjson "github.com/knadh/koanf/parsers/json"
+	kyaml "github.com/knadh/koanf/parsers/yaml"
+	kfile "github.com/knadh/koanf/providers/file"
+	kfn "github.com/knadh/koanf/v2"
+)
+
+const (
+	includeKey     = "include"
+	definitionsKey = "definitions"
+	useKey         = "use"
+	// maxIncludeDepth prevents runaway include chains
+	maxIncludeDepth = 16
+)
+
+// loadWithIncludes loads a configuration source into k, honoring its "include" directive.
+// Included files are loaded first, in order, so that the including document takes precedence.
+// Relative include paths are resolved against baseDir. The stack tracks the files being
+// loaded to detect include cycles.
+func loadWithIncludes(k *kfn.Koanf, p kfn.Provider, parser kfn.Parser, baseDir string, stack map[string]bool) error {
+	if len(stack) > maxIncludeDepth {
+		return fmt.Errorf("include depth exceeds maximum of %d", maxIncludeDepth)
+	}
+
+	doc := kfn.New(".")
+	if err := doc.Load(p, parser); err != nil {
+		return err
+	}
+
+	for _, inc := range doc.Strings(includeKey) {
+		path := inc
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("invalid include path %q: %w", inc, err)
+		}
+		if stack[absPath] {
+			return fmt.Errorf("include cycle detected at %s", absPath)
+		}
+		incParser, err := parserForExtension(filepath.Ext(absPath))
+		if err != nil {
+			return err
+		}
+		stack[absPath] = true
+		err = loadWithIncludes(k, kfile.Provider(absPath), incParser, filepath.Dir(absPath), stack)
+		delete(stack, absPath)
+		if err != nil {
+			return fmt.Errorf("error loading include %s: %w", inc, err)
+		}
+	}
+
+	return k.Merge(doc)
+}
+
+// parserForExtension returns the koanf parser matching a file extension
+func parserForExtension(ext string) (kfn.Parser, error) {
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		return kyaml.Parser(), nil
+	case ".json":
+		return kjson.Parser(), nil
+	}
+	return nil, &UnsupportedExtensionError{Extension: ext}
+}
+
+// resolveDefinitions replaces "use" references in the source, runners and pipeline stages with the
+// named entries of the "definitions" section. The referencing entry is merged on top
+// of the definition, with options merged key by key.
+func resolveDefinitions(raw map[string]any) error {
+	defs, _ := raw[definitionsKey].(map[string]any)
+
+	if src, ok := raw["source"].(map[string]any); ok {
+		resolved, err := resolveUse(src, defs)
+		if err != nil {
+			return fmt.Errorf("source: %w", err)
+		}
+		raw["source"] = resolved
+	}
+
+	if sources, ok := raw["sources"].([]any); ok {
+		for i, item := range sources {
+			src, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			resolved, err := resolveUse(src, defs)
+			if err != nil {
+				return fmt.Errorf("sources %d: %w", i, err)
+			}
+			sources[i] = resolved
+		}
+	}
+
+	if runners, ok := raw["runners"].([]any); ok {
+		if err := resolveRunnerList(runners, defs); err != nil {
+			return err
+		}
+	}
+
+	if dl, ok := raw["deadLetter"].(map[string]any); ok {
+		if target, ok := dl["target"].(map[string]any); ok {
+			resolved, err := resolveUse(target, defs)
+			if err != nil {
+				return fmt.Errorf("deadLetter target: %w", err)
+			}
+			dl["target"] = resolved
+		}
+	}
+
+	if pipeline, ok := raw["pipeline"].(map[string]any); ok {
+		stages, _ := pipeline["stages"].([]any)
+		for i, item := range stages {
+			stage, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			if runners, ok := stage["runners"].([]any); ok {
+				if err := resolveRunnerList(runners, defs); err != nil {
+					return fmt.Errorf("pipeline stage %d: %w", i, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// nestedRunnerChains are the options holding the runner chains of the built-in runner types
+var nestedRunnerChains = map[string][]string{
+	"split":  {"primary", "canary"},
+	"group":  {"targets"},
+	"fsdiff": {"runners"},
+	"tenant": {"runners"},
+	"budget": {"primary", "cheap"},
+}
+
+// resolveRunnerList resolves references in a list of runners, including the runner chains
+// nested in the options of the built-in runner types
+func resolveRunnerList(runners []any, defs map[string]any) error {
+	for i, item := range runners {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		resolved, err := resolveUse(entry, defs)
+		if err != nil {
+			return fmt.Errorf("runner %d: %w", i, err)
+		}
+		typ, _ := resolved["type"].(string)
+		opts, _ := resolved["options"].(map[string]any)
+		if branches, ok := opts["branches"].([]any); ok && typ == "branch" {
+			for j, branch := range branches {
+				if list, ok := branch.([]any); ok {
+					if err := resolveRunnerList(list, defs); err != nil {
+						return fmt.Errorf("runner %d branch %d: %w", i, j, err)
+					}
+				}
+			}
+		}
+		if routes, ok := opts["routes"].([]any); ok && typ == "parts" {
+			for j, route := range routes {
+				routeOpts, _ := route.(map[string]any)
+				if list, ok := routeOpts["runners"].([]any); ok {
+					if err := resolveRunnerList(list, defs); err != nil {
+						return fmt.Errorf("runner %d route %d: %w", i, j, err)
+					}
+				}
+			}
+		}
+		for _, chain := range nestedRunnerChains[typ] {
+			if list, ok := opts[chain].([]any); ok {
+				if err := resolveRunnerList(list, defs); err != nil {
+					return fmt.Errorf("runner %d %s %s: %w", i, typ, chain, err)
+				}
+			}
+		}
+		runners[i] = resolved
+	}
+	return nil
+}
+
+// resolveUse merges the definition referenced by the entry "use" key below the entry itself
+func resolveUse(entry map[string]any, defs map[string]any) (map[string]any, error) {
+	name, ok := entry[useKey].(string)
+	if !ok || name == "" {
+		return entry, nil
+	}
+	def, ok := defs[name].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unknown definition %q", name)
+	}
+
+	res := maps.Clone(def)
+	for k, v := range entry {
+		if k == useKey {
+			continue
+		}
+		if k == "options" {
+			res[k] = MergeOptions(def[k], v)
+			continue
+		}
+		res[k] = v
+	}
+	return res, nil
+}
+
+// MergeOptions deep merges override options on top of base options
+func MergeOptions(base any, override any) any {
+	baseMap, ok := base.(map[string]any)
+	if !ok {
+		return override
+	}
+	overrideMap, ok := override.(map[string]any)
+	if !ok {
+		return override
+	}
+	res := maps.Clone(baseMap)
+	for k, v := range overrideMap {
+		res[k] = MergeOptions(baseMap[k], v)
+	}
+	return res
+}
+
+// mapProvider is a koanf provider serving an already parsed configuration map
+type mapProvider map[string]any
+
+func (p mapProvider) ReadBytes() ([]byte, error) {
+	return nil, fmt.Errorf("mapProvider does not support ReadBytes")
+}
+
+func (p mapProvider) Read() (map[string]any, error) {
+	return p, nil
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfigFileWithIncludesAndDefinitions(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "shared/kafka.yaml", strings.Join([]string{
+		"definitions:",
+		"  kafka-out:",
+		"    type: kafka",
+		"    routines: 4",
+		"    options:",
+		"      brokers: [\"broker:9092\"]",
+		"      sasl:",
+		"        user: bridge",
+		"        password: secret",
+	}, "\n"))
+	cfgPath := writeFile(t, dir, configFileName, strings.Join([]string{
+		"include:",
+		"  - shared/kafka.yaml",
+		sourceKeyLine,
+		"  type: http",
+		"runners:",
+		"  - use: kafka-out",
+		"    options:",
+		"      topic: orders",
+		"      sasl:",
+		"        user: orders",
+	}, "\n"))
+
+	cfg, err := loadConfigFile(cfgPath, "")
+	require.NoError(t, err)
+	require.Len(t, cfg.Runners, 1)
+
+	runner := cfg.Runners[0]
+	require.Equal(t, "kafka", runner.Type)
+	require.Equal(t, 4, runner.Routines)
+	require.Equal(t, "orders", runner.Options["topic"])
+	require.Equal(t, []any{"broker:9092"}, runner.Options["brokers"])
+	sasl, ok := runner.Options["sasl"].(map[string]any)
+	require.True(t, ok)
+	require.Equal(t, "orders", sasl["user"])
+	require.Equal(t, "secret", sasl["password"])
+}
+
+func TestLoadConfigFileIncludePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "base.yaml", strings.Join([]string{
+		sourceKeyLine,
+		"  type: nats",
+		"  buffer: 10",
+	}, "\n"))
+	cfgPath := writeFile(t, dir, configFileName, strings.Join([]string{
+		"include: [base.yaml]",
+		sourceKeyLine,
+		"  buffer: 50",
+	}, "\n"))
+
+	cfg, err := loadConfigFile(cfgPath, "")
+	require.NoError(t, err)
+	require.Equal(t, "nats", cfg.Source.Type)
+	require.Equal(t, 50, cfg.Source.Buffer)
+}
+
+func TestLoadConfigFileIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.yaml", "include: [b.yaml]\n")
+	writeFile(t, dir, "b.yaml", "include: [a.yaml]\n")
+
+	_, err := loadConfigFile(filepath.Join(dir, "a.yaml"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "include cycle")
+}
+
+func TestLoadConfigFileIncludeMissing(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := writeFile(t, dir, configFileName, "include: [missing.yaml]\nsource:\n  type: nats\n")
+
+	_, err := loadConfigFile(cfgPath, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "missing.yaml")
+}
+
+func TestLoadConfigContentUnknownDefinition(t *testing.T) {
+	_, err := loadConfigContent(`{"source":{"use":"nope"}}`, "json", "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unknown definition "nope"`)
+}
+
+func TestResolveDefinitionsInBranches(t *testing.T) {
+	raw := map[string]any{
+		definitionsKey: map[string]any{
+			"lookup": map[string]any{"type": "http", "options": map[string]any{"url": "http://x"}},
+		},
+		"runners": []any{
+			map[string]any{
+				"type": "branch",
+				"options": map[string]any{
+					"branches": []any{
+						[]any{map[string]any{"use": "lookup"}},
+					},
+				},
+			},
+		},
+	}
+
+	require.NoError(t, resolveDefinitions(raw))
+	branch := raw["runners"].([]any)[0].(map[string]any)["options"].(map[string]any)["branches"].([]any)[0].([]any)[0].(map[string]any)
+	require.Equal(t, "http", branch["type"])
+	require.NotContains(t, branch, useKey)
+}
+
+func TestResolveDefinitionsInSplitChains(t *testing.T) {
+	raw := map[string]any{
+		definitionsKey: map[string]any{
+			"prompt-v2": map[string]any{"type": "gpt", "options": map[string]any{"prompt": "v2"}},
+		},
+		"runners": []any{
+			map[string]any{
+				"type": "split",
+				"options": map[string]any{
+					"canary": []any{map[string]any{"use": "prompt-v2"}},
+				},
+			},
+		},
+	}
+
+	require.NoError(t, resolveDefinitions(raw))
+	canary := raw["runners"].([]any)[0].(map[string]any)["options"].(map[string]any)["canary"].([]any)[0].(map[string]any)
+	require.Equal(t, "gpt", canary["type"])
+	require.NotContains(t, canary, useKey)
+}
+
+func TestResolveDefinitionsInPartRoutes(t *testing.T) {
+	raw := map[string]any{
+		definitionsKey: map[string]any{
+			"store": map[string]any{"type": "s3", "options": map[string]any{"bucket": "images"}},
+		},
+		"runners": []any{
+			map[string]any{
+				"type": "parts",
+				"options": map[string]any{
+					"routes": []any{
+						map[string]any{"default": true, "runners": []any{map[string]any{"use": "store"}}},
+					},
+				},
+			},
+		},
+	}
+
+	require.NoError(t, resolveDefinitions(raw))
+	route := raw["runners"].([]any)[0].(map[string]any)["options"].(map[string]any)["routes"].([]any)[0].(map[string]any)["runners"].([]any)[0].(map[string]any)
+	require.Equal(t, "s3", route["type"])
+	require.NotContains(t, route, useKey)
+}
+
+func TestResolveDefinitionsInPipelineStages(t *testing.T) {
+	raw := map[string]any{
+		definitionsKey: map[string]any{
+			"archive": map[string]any{"type": "http", "options": map[string]any{"url": "http://archive"}},
+		},
+		"pipeline": map[string]any{
+			"entry": "in",
+			"stages": []any{
+				map[string]any{"name": "in", "runners": []any{map[string]any{"use": "archive"}}},
+			},
+		},
+	}
+
+	require.NoError(t, resolveDefinitions(raw))
+	stage := raw["pipeline"].(map[string]any)["stages"].([]any)[0].(map[string]any)["runners"].([]any)[0].(map[string]any)
+	require.Equal(t, "http", stage["type"])
+	require.NotContains(t, stage, useKey)
+}
+
+func TestLoadConfigContentPipeline(t *testing.T) {
+	content := `
+source:
+  type: http
+pipeline:
+  entry: in
+  stages:
+    - name: in
+      next:
+        - to: alerts
+          when: metadata.level == "error"
+        - to: archive
+          default: true
+    - name: alerts
+    - name: archive
+`
+	cfg, err := loadConfigContent(content, "yaml", "")
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Pipeline)
+	require.Len(t, cfg.Pipeline.Stages, 3)
+	require.Equal(t, "alerts", cfg.Pipeline.Stages[0].Next[0].To)
+	require.True(t, cfg.Pipeline.Stages[0].Next[1].Default)
+
+	_, err = loadConfigContent(content+"runners:\n  - type: pass\n", "yaml", "")
+	require.Error(t, err)
+}
+
+func TestResolveDefinitionsInSources(t *testing.T) {
+	content := `
+definitions:
+  broker:
+    type: mqtt
+    options:
+      address: localhost:1883
+sources:
+  - use: broker
+    id: plant-a
+  - use: broker
+    id: plant-b
+`
+	cfg, err := loadConfigContent(content, "yaml", "")
+	require.NoError(t, err)
+	require.Len(t, cfg.Sources, 2)
+	require.Equal(t, "mqtt", cfg.Sources[1].Type)
+	require.Equal(t, "plant-b", cfg.Sources[1].ID)
+	require.Equal(t, "localhost:1883", cfg.Sources[0].Options["address"])
+}
+
+func TestLoadConfigContentDeadLetter(t *testing.T) {
+	content := `
+definitions:
+  dlq:
+    type: kafka
+    options:
+      topic: events.dlq
+source:
+  type: http
+deadLetter:
+  target:
+    use: dlq
+  payload: current
+`
+	cfg, err := loadConfigContent(content, "yaml", "")
+	require.NoError(t, err)
+	require.NotNil(t, cfg.DeadLetter)
+	require.Equal(t, "kafka", cfg.DeadLetter.Target.Type)
+	require.Equal(t, "events.dlq", cfg.DeadLetter.Target.Options["topic"])
+
+	_, err = loadConfigContent(strings.Replace(content, "payload: current", "payload: latest", 1), "yaml", "")
+	require.Error(t, err)
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/sandrolain/events-bridge/src/connectors"
 )
 
@@ -10,9 +12,233 @@ type EnvConfig struct {
 	ConfigContent string `env:"EB_CONFIG_CONTENT" validate:"omitempty"`
 	// Optional: explicit config format when using ConfigContent. One of: yaml, yml, json.
 	ConfigFormat string `env:"EB_CONFIG_FORMAT" validate:"omitempty,oneof=yaml yml json"`
+	// Optional: name of the configuration profile merged on top of the configuration file.
+	Profile string `env:"EB_PROFILE"`
 }
 
 type Config struct {
-	Source  connectors.SourceConfig   `yaml:"source" json:"source" validate:"required"`
+	// Include lists configuration files merged below this one (relative to the including file)
+	Include []string `yaml:"include" json:"include"`
+	// Definitions holds named connector/runner blocks that can be referenced with "use: <name>"
+	Definitions map[string]map[string]any `yaml:"definitions" json:"definitions"`
+
+	Source connectors.SourceConfig `yaml:"source" json:"source" validate:"required"`
+	// Sources lists the sources merged into the pipeline, replacing the type and options of Source.
+	// Source keeps the settings shared by the sources: buffer, reply, middleware and replyPlan.
+	Sources []connectors.SourceConfig `yaml:"sources" json:"sources" validate:"dive"`
 	Runners []connectors.RunnerConfig `yaml:"runners" json:"runners"`
+	// Pipeline defines the runners as a graph of named stages, replacing the linear Runners chain
+	Pipeline *PipelineConfig `yaml:"pipeline" json:"pipeline" validate:"omitempty,excluded_with=Runners"`
+	// DeadLetter routes the messages failing in a runner to a dead-letter target
+	DeadLetter *DeadLetterConfig `yaml:"deadLetter" json:"deadLetter"`
+	SLO        *SLOConfig        `yaml:"slo" json:"slo"`
+	// SafetyValve pauses the source while the runners fail at a sustained high rate
+	SafetyValve *SafetyValveConfig `yaml:"safetyValve" json:"safetyValve"`
+	Admin       *AdminConfig       `yaml:"admin" json:"admin"`
+	// Diagnostics enables the diagnostic bundle written on shutdown and crash
+	Diagnostics *DiagnosticsConfig `yaml:"diagnostics" json:"diagnostics"`
+	// PayloadLimit is the payload limit of the runners that don't set their own
+	PayloadLimit *connectors.PayloadLimitConfig `yaml:"payloadLimit" json:"payloadLimit"`
+	// WorkDir is the working directory of the pipeline, holding the temporary files of the runners
+	WorkDir *WorkDirConfig `yaml:"workDir" json:"workDir"`
+	// Profiling enables pprof labels on the pipeline stages and per-stage profiling reports
+	Profiling *ProfilingConfig `yaml:"profiling" json:"profiling"`
+	// Metrics exposes the Prometheus metrics of the bridge and its connectors
+	Metrics *MetricsConfig `yaml:"metrics" json:"metrics"`
+	// Tracing exports the OpenTelemetry spans of the messages through the pipeline
+	Tracing *TracingConfig `yaml:"tracing" json:"tracing"`
+	// Lineage records the stage that last modified every top-level field of the JSON payloads
+	Lineage *LineageConfig `yaml:"lineage" json:"lineage"`
+	// StrictConfig rejects the unknown configuration keys and connector options instead of
+	// ignoring them
+	StrictConfig bool `yaml:"strictConfig" json:"strictConfig"`
+}
+
+// PipelineConfig defines the runners as a directed acyclic graph of named stages.
+// The source messages enter the Entry stage; every stage runs its runner chain and hands a
+// copy of the result to each matching outgoing edge (fan-out). A stage reached by several
+// edges runs once, on the join of its inputs (fan-in).
+type PipelineConfig struct {
+	// Entry is the name of the stage receiving the source messages
+	Entry string `yaml:"entry" json:"entry" validate:"required"`
+	// Stages are the named stages of the graph
+	Stages []PipelineStageConfig `yaml:"stages" json:"stages" validate:"required,min=1,dive"`
+}
+
+// PipelineStageConfig is a named stage of the pipeline graph
+type PipelineStageConfig struct {
+	// Name identifies the stage in the edges
+	Name string `yaml:"name" json:"name" validate:"required"`
+	// Runners is the runner chain of the stage (empty = pass through)
+	Runners []connectors.RunnerConfig `yaml:"runners" json:"runners" validate:"dive"`
+	// Next are the outgoing edges of the stage; a stage without edges is a sink
+	Next []PipelineEdgeConfig `yaml:"next" json:"next" validate:"dive"`
+	// Join combines the inputs of a stage reached by several edges: "merge" (default, the
+	// metadata of every input is merged on the first input) or "collect" (a JSON array of the inputs)
+	Join string `yaml:"join" json:"join" validate:"omitempty,oneof=merge collect"`
+}
+
+// PipelineEdgeConfig connects a stage to the next one
+type PipelineEdgeConfig struct {
+	// To is the name of the next stage
+	To string `yaml:"to" json:"to" validate:"required"`
+	// When is an expression evaluated on the stage result, e.g. on its metadata;
+	// the edge is taken when it is true (empty = always)
+	When string `yaml:"when" json:"when"`
+	// Default takes the edge only when no conditional edge of the stage matches
+	Default bool `yaml:"default" json:"default" validate:"excluded_with=When"`
+}
+
+// DeadLetterConfig defines the target receiving the messages whose processing failed in a
+// runner, once the runner gave up (e.g. after the retries of a target group). The message is
+// published with the error records of the failure in the eb-errors metadata.
+type DeadLetterConfig struct {
+	// Target is the runner publishing the failed messages, e.g. a Kafka topic or a file
+	Target connectors.RunnerConfig `yaml:"target" json:"target" validate:"required"`
+	// Payload is the published payload: "original" (default, as received from the source)
+	// or "current" (as modified by the runners before the failure)
+	Payload string `yaml:"payload" json:"payload" validate:"omitempty,oneof=original current"`
+	// Nak naks the dead-lettered message to the source, e.g. to reply with an error to an
+	// HTTP client (default: the dead-lettered message is acked)
+	Nak bool `yaml:"nak" json:"nak"`
+}
+
+// SLOConfig defines end-to-end latency objectives for the pipeline.
+// Latency is measured from the moment the source hands a message to the bridge
+// until the message is acknowledged at the end of the runner chain.
+type SLOConfig struct {
+	// Window is the number of most recent latency samples used to compute percentiles (default: 1000)
+	Window int `yaml:"window" json:"window" validate:"omitempty,min=1"`
+	// MaxAge expires the samples older than the age, so that the percentiles of an idle
+	// pipeline do not keep reporting old latencies (default: 5m)
+	MaxAge time.Duration `yaml:"maxAge" json:"maxAge" validate:"omitempty,gt=0"`
+	// CheckInterval is how often percentiles are evaluated against thresholds (default: 10s)
+	CheckInterval time.Duration `yaml:"checkInterval" json:"checkInterval" validate:"omitempty,gt=0"`
+	// P50, P95 and P99 are the latency thresholds; zero disables the corresponding check
+	P50 time.Duration `yaml:"p50" json:"p50"`
+	P95 time.Duration `yaml:"p95" json:"p95"`
+	P99 time.Duration `yaml:"p99" json:"p99"`
+	// WebhookURL receives a JSON POST when a threshold is breached and when it recovers (optional)
+	WebhookURL string `yaml:"webhookUrl" json:"webhookUrl" validate:"omitempty,url"`
+	// RenotifyInterval repeats the notification of a breach still ongoing after the interval
+	// (default: 0, notified once until it recovers)
+	RenotifyInterval time.Duration `yaml:"renotifyInterval" json:"renotifyInterval" validate:"omitempty,gt=0"`
+	// WebhookTimeout is the timeout for webhook delivery (default: 5s)
+	WebhookTimeout time.Duration `yaml:"webhookTimeout" json:"webhookTimeout" validate:"omitempty,gt=0"`
+}
+
+// SafetyValveConfig defines the automatic pause of the pipeline on downstream error storms.
+// The runner results are counted over a rolling window; when the failure rate stays at or
+// above the threshold for the sustain period, the bridge stops consuming the source, so that
+// e.g. a target outage doesn't flood the dead-letter target. The pipeline resumes after the
+// cool-down or through the admin API.
+type SafetyValveConfig struct {
+	// Threshold is the failure rate (0-1] pausing the pipeline, e.g. 0.5 for half of the runner calls
+	Threshold float64 `yaml:"threshold" json:"threshold" validate:"required,gt=0,lte=1"`
+	// Window is the period the failure rate is computed over (default: 1m)
+	Window time.Duration `yaml:"window" json:"window" validate:"omitempty,gt=0"`
+	// MinMessages is the number of runner results in the window below which the rate is not evaluated (default: 20)
+	MinMessages int `yaml:"minMessages" json:"minMessages" validate:"omitempty,min=1"`
+	// Sustain is how long the rate must stay over the threshold before pausing (default: 30s)
+	Sustain time.Duration `yaml:"sustain" json:"sustain" validate:"omitempty,gt=0"`
+	// CoolDown is the pause before the pipeline resumes automatically (default: 5m)
+	CoolDown time.Duration `yaml:"coolDown" json:"coolDown" validate:"omitempty,gt=0"`
+	// ManualResume keeps the pipeline paused until it is resumed through the admin API
+	ManualResume bool `yaml:"manualResume" json:"manualResume"`
+	// CheckInterval is how often the failure rate is evaluated (default: 1s)
+	CheckInterval time.Duration `yaml:"checkInterval" json:"checkInterval" validate:"omitempty,gt=0"`
+}
+
+// LineageConfig defines the field-level lineage of the messages. After every runner the
+// top-level fields of the JSON payload are compared with the payload before the runner, and
+// the runner stage is recorded for the fields it added or modified, so that a value reaching
+// the target can be traced back to the stage that produced it.
+type LineageConfig struct {
+	// MetadataKey is the metadata key holding the lineage, a JSON object mapping the fields to
+	// their stage (default: eb-lineage)
+	MetadataKey string `yaml:"metadataKey" json:"metadataKey"`
+	// Fields restricts the lineage to these top-level fields (default: every field)
+	Fields []string `yaml:"fields" json:"fields"`
+}
+
+// ProfilingConfig defines the profiling mode of the pipeline.
+// The goroutines running the stages (source, middleware, runners, ack) carry the pprof
+// labels "pipeline", "stage" and "connector", so CPU and goroutine profiles can be
+// filtered by stage (e.g., "go tool pprof -tagfocus stage=runner[1]").
+type ProfilingConfig struct {
+	// Pipeline is the value of the "pipeline" label (default: the source type)
+	Pipeline string `yaml:"pipeline" json:"pipeline"`
+	// ReportInterval enables the per-stage CPU/allocation reports, sampled on every interval
+	ReportInterval time.Duration `yaml:"reportInterval" json:"reportInterval" validate:"omitempty,gt=0"`
+	// CPUSampleDuration is the duration of the CPU profile of each report (default: 5s)
+	CPUSampleDuration time.Duration `yaml:"cpuSampleDuration" json:"cpuSampleDuration" validate:"omitempty,gt=0"`
+	// AllocSampleEvery measures the allocations of one stage call in N (default: 100)
+	AllocSampleEvery int `yaml:"allocSampleEvery" json:"allocSampleEvery" validate:"omitempty,min=1"`
+}
+
+// WorkDirConfig defines the working directory of a pipeline. Every pipeline gets its own
+// directory under Path, set as the temporary directory of the process so that the runners
+// and the processes they start create their temporary files in it.
+type WorkDirConfig struct {
+	// Path is the parent directory of the pipeline directories
+	Path string `yaml:"path" json:"path" validate:"required"`
+	// MaxSize is the quota of the pipeline directory in bytes; new messages are rejected
+	// while the usage exceeds it (0 = no quota)
+	MaxSize int64 `yaml:"maxSize" json:"maxSize" validate:"min=0"`
+	// CheckInterval is how often the directory usage is measured (default: 10s)
+	CheckInterval time.Duration `yaml:"checkInterval" json:"checkInterval" validate:"omitempty,gt=0"`
+}
+
+// AdminConfig defines the operational admin API.
+// It is read from the configuration the process starts with; the admin
+// section of configurations applied through the API is ignored.
+type AdminConfig struct {
+	// Address is the TCP address the admin API listens on (e.g., "127.0.0.1:9090")
+	Address string `yaml:"address" json:"address" validate:"required"`
+	// Token, if set, is required as Bearer token on every request; it is mandatory unless
+	// Address is a loopback address
+	Token string `yaml:"token" json:"token"` //nolint:gosec // user-configured credential field
+	// DrainTimeout bounds the time the old pipeline has to settle in-flight messages on switchover (default: 30s)
+	DrainTimeout time.Duration `yaml:"drainTimeout" json:"drainTimeout" validate:"omitempty,gt=0"`
+	// Pprof exposes the runtime profiles of net/http/pprof under /debug/pprof/
+	Pprof bool `yaml:"pprof" json:"pprof"`
+}
+
+// MetricsConfig defines the HTTP endpoint serving the Prometheus metrics
+type MetricsConfig struct {
+	// Address is the TCP address the metrics endpoint listens on (e.g., ":9100")
+	Address string `yaml:"address" json:"address" validate:"required"`
+	// Path is the path of the metrics endpoint (default: "/metrics")
+	Path string `yaml:"path" json:"path" validate:"omitempty,startswith=/"`
+}
+
+// TracingConfig defines the OTLP/HTTP exporter of the OpenTelemetry spans
+type TracingConfig struct {
+	// Endpoint is the URL of the OTLP/HTTP traces endpoint (e.g., "http://otel-collector:4318/v1/traces")
+	Endpoint string `yaml:"endpoint" json:"endpoint" validate:"required,url"`
+	// ServiceName is the "service.name" resource attribute of the spans (default: "events-bridge")
+	ServiceName string `yaml:"serviceName" json:"serviceName"`
+	// SampleRatio is the ratio of the new traces recorded (default: 1); the traces continued
+	// from an upstream "traceparent" follow its sampled flag
+	SampleRatio *float64 `yaml:"sampleRatio" json:"sampleRatio" validate:"omitempty,min=0,max=1"`
+	// Headers are sent with the export requests, e.g. the API key of a tracing vendor
+	Headers map[string]string `yaml:"headers" json:"headers"`
+	// BatchSize is the maximum number of spans of an export request (default: 512)
+	BatchSize int `yaml:"batchSize" json:"batchSize" validate:"omitempty,min=1"`
+	// ExportInterval is the maximum time a span waits before being exported (default: 5s)
+	ExportInterval time.Duration `yaml:"exportInterval" json:"exportInterval" validate:"omitempty,gt=0"`
+	// Timeout bounds an export request (default: 10s)
+	Timeout time.Duration `yaml:"timeout" json:"timeout" validate:"omitempty,gt=0"`
+}
+
+// DiagnosticsConfig defines the diagnostic bundle written on shutdown and crash.
+type DiagnosticsConfig struct {
+	// Dir is the directory the bundles are written to
+	Dir string `yaml:"dir" json:"dir" validate:"required"`
+	// LogLines is the number of most recent log records kept for the bundle (default: 1000)
+	LogLines int `yaml:"logLines" json:"logLines" validate:"omitempty,min=1"`
+	// MaxBundles is the number of bundles kept in Dir, the oldest are removed (default: 10)
+	MaxBundles int `yaml:"maxBundles" json:"maxBundles" validate:"omitempty,min=1"`
+	// OnShutdown also writes a bundle on graceful shutdown, not only on failure
+	OnShutdown bool `yaml:"onShutdown" json:"onShutdown"`
 }
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	kfn "github.com/knadh/koanf/v2"
+)
+
+// profilesKey is the section of the named configuration overlays
+const profilesKey = "profiles"
+
+// applyProfile merges the named entry of the "profiles" section on top of the configuration,
+// before the definitions are resolved and the environment overrides applied. Maps are merged
+// key by key, any other value (lists included) is replaced. The profiles section is removed
+// from the configuration.
+func applyProfile(k *kfn.Koanf, profile string) error {
+	profiles := k.Cut(profilesKey)
+	k.Delete(profilesKey)
+	if profile == "" {
+		return nil
+	}
+
+	names := slices.Sorted(maps.Keys(profiles.Raw()))
+	if !slices.Contains(names, profile) {
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile %q: the configuration has no profiles", profile)
+		}
+		return fmt.Errorf("unknown profile %q (available: %s)", profile, strings.Join(names, ", "))
+	}
+
+	overlay := profiles.Cut(profile)
+	if overlay.Exists(profilesKey) || overlay.Exists(includeKey) {
+		return fmt.Errorf("profile %q cannot contain %s or %s", profile, profilesKey, includeKey)
+	}
+	return k.Merge(overlay)
+}
+
+// selectedProfile returns the profile selected by the EB_PROFILE environment variable or the
+// --profile flag, for the configurations parsed at runtime
+func selectedProfile() (string, error) {
+	envCfg, err := loadEnvConfig()
+	if err != nil {
+		return "", err
+	}
+	if err := applyCLIOverrides(envCfg); err != nil {
+		return "", err
+	}
+	return envCfg.Profile, nil
+}
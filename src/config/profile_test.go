@@ -0,0 +1,93 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const profilesConfig = `
+definitions:
+  out:
+    type: kafka
+    options:
+      brokers: ["localhost:9092"]
+      topic: orders
+source:
+  type: http
+  buffer: 1000
+  options:
+    address: "0.0.0.0:8080"
+runners:
+  - use: out
+profiles:
+  dev:
+    source:
+      buffer: 10
+    runners:
+      - type: console
+  prod:
+    definitions:
+      out:
+        options:
+          brokers: ["kafka-1:9093", "kafka-2:9093"]
+          tls:
+            enabled: true
+`
+
+func TestLoadConfigProfiles(t *testing.T) {
+	base, err := loadConfigContent(profilesConfig, "yaml", "")
+	require.NoError(t, err)
+	require.Equal(t, 1000, base.Source.Buffer)
+	require.Equal(t, "kafka", base.Runners[0].Type)
+
+	dev, err := loadConfigContent(profilesConfig, "yaml", "dev")
+	require.NoError(t, err)
+	require.Equal(t, 10, dev.Source.Buffer)
+	require.Equal(t, "0.0.0.0:8080", dev.Source.Options["address"])
+	require.Len(t, dev.Runners, 1)
+	require.Equal(t, "console", dev.Runners[0].Type)
+
+	prod, err := loadConfigContent(profilesConfig, "yaml", "prod")
+	require.NoError(t, err)
+	require.Equal(t, 1000, prod.Source.Buffer)
+	opts := prod.Runners[0].Options
+	require.Equal(t, "orders", opts["topic"])
+	require.Equal(t, []any{"kafka-1:9093", "kafka-2:9093"}, opts["brokers"])
+	require.Equal(t, map[string]any{"enabled": true}, opts["tls"])
+
+	_, err = loadConfigContent(profilesConfig, "yaml", "qa")
+	require.ErrorContains(t, err, "available: dev, prod")
+}
+
+func TestLoadConfigProfileFromIncludeAndEnv(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "profiles.yaml", strings.Join([]string{
+		"profiles:",
+		"  staging:",
+		"    source:",
+		"      buffer: 50",
+		"      options:",
+		"        address: staging:8080",
+	}, "\n"))
+	path := writeFile(t, dir, configFileName, strings.Join([]string{
+		"include: [profiles.yaml]",
+		sourceKeyLine,
+		"  type: http",
+		"  buffer: 1000",
+	}, "\n"))
+
+	t.Setenv("EB_PROFILE", "staging")
+	t.Setenv("EB_SOURCE__OPTIONS__ADDRESS", "override:8080")
+	withArgs(t, nil)
+	cfg, err := ParseFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 50, cfg.Source.Buffer)
+	// Environment overrides take precedence over the profile
+	require.Equal(t, "override:8080", cfg.Source.Options["address"])
+
+	withArgs(t, []string{"--profile", "missing"})
+	_, err = ParseFile(path)
+	require.ErrorContains(t, err, "unknown profile")
+}
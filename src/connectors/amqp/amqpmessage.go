@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// replyTimeout bounds the publishing of the replies to the reply queues
+const replyTimeout = 5 * time.Second
+
+var _ message.SourceMessage = &AMQPMessage{}
+
+// AMQPMessage is a delivery consumed from a queue
+type AMQPMessage struct {
+	delivery amqp.Delivery
+	// conn publishes the replies of the deliveries with a reply-to queue
+	conn    *connection
+	requeue bool
+}
+
+func (m *AMQPMessage) GetID() []byte {
+	return []byte(m.delivery.MessageId)
+}
+
+// GetMetadata returns the delivery properties and the string representation of the headers
+func (m *AMQPMessage) GetMetadata() (map[string]string, error) {
+	d := m.delivery
+	metadata := make(map[string]string, len(d.Headers)+8)
+	for k, v := range d.Headers {
+		metadata[k] = headerString(v)
+	}
+	metadata["exchange"] = d.Exchange
+	metadata["routingKey"] = d.RoutingKey
+	metadata["redelivered"] = strconv.FormatBool(d.Redelivered)
+	for k, v := range map[string]string{
+		"contentType":   d.ContentType,
+		"messageId":     d.MessageId,
+		"correlationId": d.CorrelationId,
+		"replyTo":       d.ReplyTo,
+		"type":          d.Type,
+		"appId":         d.AppId,
+	} {
+		if v != "" {
+			metadata[k] = v
+		}
+	}
+	if !d.Timestamp.IsZero() {
+		metadata["timestamp"] = d.Timestamp.UTC().Format(time.RFC3339)
+	}
+	return metadata, nil
+}
+
+func (m *AMQPMessage) GetData() ([]byte, error) {
+	return m.delivery.Body, nil
+}
+
+// Ack acknowledges the delivery (basic.ack). Reply data is first published to the reply-to
+// queue of the delivery, if any, with its correlation id.
+func (m *AMQPMessage) Ack(data *message.ReplyData) error {
+	if data != nil && m.delivery.ReplyTo != "" && m.conn != nil {
+		if err := m.reply(data); err != nil {
+			return err
+		}
+	}
+	return m.delivery.Ack(false)
+}
+
+func (m *AMQPMessage) reply(data *message.ReplyData) error {
+	ch, err := m.conn.channel()
+	if err != nil {
+		return fmt.Errorf("failed to send reply: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), replyTimeout)
+	defer cancel()
+	pub := amqp.Publishing{
+		CorrelationId: m.delivery.CorrelationId,
+		ContentType:   data.Metadata["contentType"],
+		Body:          data.Data,
+	}
+	if err := ch.PublishWithContext(ctx, "", m.delivery.ReplyTo, false, false, pub); err != nil {
+		return fmt.Errorf("failed to send reply: %w", err)
+	}
+	return nil
+}
+
+// Nak rejects the delivery (basic.nack), requeuing it if configured
+func (m *AMQPMessage) Nak() error {
+	return m.delivery.Nack(false, m.requeue)
+}
+
+// headerString returns the string representation of a header value
+func headerString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeAcknowledger records the acknowledgements of a delivery
+type fakeAcknowledger struct {
+	acked   bool
+	nacked  bool
+	requeue bool
+}
+
+func (a *fakeAcknowledger) Ack(uint64, bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(_ uint64, _ bool, requeue bool) error {
+	a.nacked = true
+	a.requeue = requeue
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(uint64, bool) error {
+	return nil
+}
+
+func TestAMQPMessageMetadata(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := &AMQPMessage{delivery: amqp.Delivery{
+		Headers:       amqp.Table{"x-tenant": "acme", "x-retries": int32(3), "x-raw": []byte("raw")},
+		ContentType:   "application/json",
+		MessageId:     "m1",
+		CorrelationId: "c1",
+		Timestamp:     ts,
+		Exchange:      "orders",
+		RoutingKey:    "orders.created",
+		Redelivered:   true,
+		Body:          []byte("payload"),
+	}}
+
+	meta, err := m.GetMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"x-tenant":      "acme",
+		"x-retries":     "3",
+		"x-raw":         "raw",
+		"exchange":      "orders",
+		"routingKey":    "orders.created",
+		"redelivered":   "true",
+		"contentType":   "application/json",
+		"messageId":     "m1",
+		"correlationId": "c1",
+		"timestamp":     "2024-01-02T03:04:05Z",
+	}
+	if len(meta) != len(expected) {
+		t.Errorf("metadata = %v", meta)
+	}
+	for k, v := range expected {
+		if meta[k] != v {
+			t.Errorf("metadata %s = %q, want %q", k, meta[k], v)
+		}
+	}
+	if string(m.GetID()) != "m1" {
+		t.Errorf("id = %q", m.GetID())
+	}
+	if data, _ := m.GetData(); string(data) != "payload" {
+		t.Errorf("data = %q", data)
+	}
+}
+
+func TestAMQPMessageAckNak(t *testing.T) {
+	ack := &fakeAcknowledger{}
+	m := &AMQPMessage{delivery: amqp.Delivery{Acknowledger: ack, DeliveryTag: 1}}
+	if err := m.Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !ack.acked {
+		t.Error("expected delivery to be acked")
+	}
+
+	for _, requeue := range []bool{true, false} {
+		ack := &fakeAcknowledger{}
+		m := &AMQPMessage{delivery: amqp.Delivery{Acknowledger: ack, DeliveryTag: 1}, requeue: requeue}
+		if err := m.Nak(); err != nil {
+			t.Fatal(err)
+		}
+		if !ack.nacked || ack.requeue != requeue {
+			t.Errorf("nack = %v, requeue = %v, want requeue %v", ack.nacked, ack.requeue, requeue)
+		}
+	}
+}
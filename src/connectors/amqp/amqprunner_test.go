@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sandrolain/events-bridge/src/common/headermap"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func TestAMQPRunnerConfigValidation(t *testing.T) {
+	if err := utils.ParseConfig(map[string]any{"exchange": "x"}, new(RunnerConfig)); err == nil {
+		t.Fatal("expected error when address is empty")
+	}
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(map[string]any{"address": "amqp://localhost:5672/"}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Confirm || !cfg.Persistent || cfg.RoutingKeyFromMetadataKey != "routingKey" {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestAMQPRunnerConnectionError(t *testing.T) {
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(map[string]any{"address": "amqp://127.0.0.1:1/"}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRunner(cfg); err == nil {
+		t.Fatal("expected connection error")
+	}
+}
+
+func TestAMQPRunnerPublishing(t *testing.T) {
+	metadata := map[string]string{"x-tenant": "acme", "eb-status": "200", "contentType": "text/plain", "messageId": "m1"}
+
+	r := &AMQPRunner{cfg: &RunnerConfig{ContentType: "application/json", Persistent: true}}
+	pub := r.newPublishing(metadata, []byte("d"))
+	if pub.Headers != nil {
+		t.Errorf("headers without policy = %v", pub.Headers)
+	}
+	if pub.ContentType != "text/plain" || pub.MessageId != "m1" || pub.DeliveryMode != amqp.Persistent {
+		t.Errorf("unexpected publishing: %+v", pub)
+	}
+
+	cfg := &headermap.Config{Allow: []string{"x-*"}}
+	policy, err := headermap.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = &AMQPRunner{cfg: &RunnerConfig{Headers: cfg}, headers: policy}
+	pub = r.newPublishing(metadata, []byte("d"))
+	if len(pub.Headers) != 1 || pub.Headers["x-tenant"] != "acme" {
+		t.Errorf("headers = %v", pub.Headers)
+	}
+	if pub.DeliveryMode != amqp.Transient {
+		t.Errorf("delivery mode = %d", pub.DeliveryMode)
+	}
+}
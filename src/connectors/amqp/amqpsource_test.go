@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func TestAMQPSourceConfigValidation(t *testing.T) {
+	if err := utils.ParseConfig(map[string]any{"queue": "q"}, new(SourceConfig)); err == nil {
+		t.Fatal("expected error when address is empty")
+	}
+	if err := utils.ParseConfig(map[string]any{"address": "amqp://localhost:5672/"}, new(SourceConfig)); err == nil {
+		t.Fatal("expected error when queue is empty")
+	}
+	opts := map[string]any{
+		"address": "amqp://localhost:5672/",
+		"queue":   "q",
+		"declare": map[string]any{"bindings": []any{map[string]any{"routingKey": "k"}}},
+	}
+	if err := utils.ParseConfig(opts, new(SourceConfig)); err == nil {
+		t.Fatal("expected error when binding exchange is empty")
+	}
+
+	cfg := new(SourceConfig)
+	if err := utils.ParseConfig(map[string]any{"address": "amqp://localhost:5672/", "queue": "q"}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Prefetch != 10 || !cfg.Requeue || cfg.ReconnectWait != time.Second || cfg.MaxReconnectWait != 30*time.Second {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestAMQPSourceProduceConnectionError(t *testing.T) {
+	cfg := new(SourceConfig)
+	if err := utils.ParseConfig(map[string]any{"address": "amqp://127.0.0.1:1/", "queue": "q"}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := src.(*AMQPSource).ConnectorStatus(); status.State != connectors.StateConnecting {
+		t.Errorf("status before produce = %+v", status)
+	}
+	if _, err := src.Produce(1); err == nil {
+		t.Fatal("expected connection error")
+	}
+	if status := src.(*AMQPSource).ConnectorStatus(); status.State != connectors.StateDisconnected || status.LastError == "" {
+		t.Errorf("status after connection error = %+v", status)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/connectors"
+)
+
+// errNotConnected is returned while the connection is being recovered
+var errNotConnected = errors.New("not connected to the AMQP broker")
+
+// connectionConfig holds the connection settings shared by the source and the runner
+type connectionConfig struct {
+	address       string
+	username      string
+	password      string
+	name          string
+	heartbeat     time.Duration
+	tls           *tls.Config
+	reconnectWait time.Duration
+	maxReconnect  time.Duration
+}
+
+// connection is an AMQP connection with a channel, recovered when the broker closes them.
+// The setup function prepares every new channel (QoS, topology, consumers, confirms).
+type connection struct {
+	cfg    connectionConfig
+	setup  func(*amqp.Channel) error
+	logger *slog.Logger
+	// status is the state of the connection reported to the bridge
+	status connectors.StatusTracker
+
+	mu   sync.RWMutex
+	conn *amqp.Connection
+	ch   *amqp.Channel
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newConnection creates a connection, not yet opened
+func newConnection(cfg connectionConfig, setup func(*amqp.Channel) error, logger *slog.Logger) *connection {
+	return &connection{
+		cfg:    cfg,
+		setup:  setup,
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// open opens the connection and the channel, failing fast if the broker is not reachable,
+// then recovers them in the background until closed
+func (c *connection) open() error {
+	if err := c.connect(); err != nil {
+		c.status.SetState(connectors.StateDisconnected)
+		c.status.RecordError(err)
+		return err
+	}
+	go c.watch()
+	return nil
+}
+
+// connect opens a new connection and channel and runs the setup
+func (c *connection) connect() error {
+	amqpCfg := amqp.Config{
+		Heartbeat:       c.cfg.heartbeat,
+		TLSClientConfig: c.cfg.tls,
+		Properties:      amqp.NewConnectionProperties(),
+	}
+	if c.cfg.name != "" {
+		amqpCfg.Properties.SetClientConnectionName(c.cfg.name)
+	}
+	if c.cfg.username != "" {
+		password, err := secrets.Resolve(c.cfg.password)
+		if err != nil {
+			return fmt.Errorf("failed to resolve password: %w", err)
+		}
+		amqpCfg.SASL = []amqp.Authentication{&amqp.PlainAuth{Username: c.cfg.username, Password: password}}
+	}
+
+	conn, err := amqp.DialConfig(c.cfg.address, amqpCfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to AMQP broker: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close() //nolint:errcheck
+		return fmt.Errorf("failed to open AMQP channel: %w", err)
+	}
+	if err := c.setup(ch); err != nil {
+		conn.Close() //nolint:errcheck
+		return err
+	}
+
+	c.mu.Lock()
+	c.conn, c.ch = conn, ch
+	c.mu.Unlock()
+	c.status.SetState(connectors.StateConnected)
+	return nil
+}
+
+// watch waits for the connection or the channel to close and reconnects, doubling the wait
+// between the failed attempts up to the maximum
+func (c *connection) watch() {
+	defer close(c.done)
+	for {
+		c.mu.RLock()
+		connClosed := c.conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := c.ch.NotifyClose(make(chan *amqp.Error, 1))
+		c.mu.RUnlock()
+
+		var cause *amqp.Error
+		select {
+		case <-c.stop:
+			return
+		case cause = <-connClosed:
+		case cause = <-chClosed:
+		}
+		c.mu.Lock()
+		if !c.conn.IsClosed() {
+			c.conn.Close() //nolint:errcheck
+		}
+		c.conn, c.ch = nil, nil
+		c.mu.Unlock()
+		c.status.SetState(connectors.StateDisconnected)
+		if cause != nil {
+			c.status.RecordError(cause)
+		}
+		c.logger.Warn("AMQP connection lost, reconnecting", "error", cause)
+
+		wait := c.cfg.reconnectWait
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-time.After(wait):
+			}
+			err := c.connect()
+			if err == nil {
+				c.logger.Info("AMQP connection recovered")
+				metrics.Reconnected("amqp")
+				break
+			}
+			c.status.RecordError(err)
+			c.logger.Warn("AMQP reconnection failed", "error", err, "retryIn", wait)
+			if wait *= 2; wait > c.cfg.maxReconnect {
+				wait = c.cfg.maxReconnect
+			}
+		}
+	}
+}
+
+// channel returns the current channel, or errNotConnected while recovering
+func (c *connection) channel() (*amqp.Channel, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.ch == nil {
+		return nil, errNotConnected
+	}
+	return c.ch, nil
+}
+
+// close stops the recovery and closes the connection
+func (c *connection) close() error {
+	if c == nil {
+		return nil
+	}
+	close(c.stop)
+	<-c.done
+	c.status.SetState(connectors.StateDisconnected)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil || c.conn.IsClosed() {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.ch = nil, nil
+	return err
+}
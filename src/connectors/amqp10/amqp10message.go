@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/sandrolain/events-bridge/src/common/amqp10"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &AMQP10Message{}
+
+// AMQP10Message is a delivery received from a queue or a subscription
+type AMQP10Message struct {
+	delivery   *amqp10.Delivery
+	metadata   map[string]string
+	nakOutcome string
+	// done releases the next message of a session
+	done chan message.ResponseStatus
+}
+
+func (m *AMQP10Message) GetID() []byte {
+	return []byte(m.metadata["messageId"])
+}
+
+func (m *AMQP10Message) GetMetadata() (map[string]string, error) {
+	return m.metadata, nil
+}
+
+func (m *AMQP10Message) GetData() ([]byte, error) {
+	return m.delivery.Data, nil
+}
+
+// Ack accepts the delivery, completing the locked message
+func (m *AMQP10Message) Ack(*message.ReplyData) error {
+	defer message.SendResponseStatus(m.done, message.ResponseStatusAck)
+	return m.delivery.Settle(amqp10.Composite(amqp10.DescAccepted))
+}
+
+// Nak settles the delivery with the configured outcome: modified (abandon), released or
+// rejected (dead-letter)
+func (m *AMQP10Message) Nak() error {
+	defer message.SendResponseStatus(m.done, message.ResponseStatusNak)
+	return m.delivery.Settle(nakState(m.nakOutcome))
+}
+
+// nakState returns the delivery state of a Nak outcome
+func nakState(outcome string) *amqp10.Described {
+	switch outcome {
+	case nakRelease:
+		return amqp10.Composite(amqp10.DescReleased)
+	case nakDeadLetter:
+		return amqp10.Composite(amqp10.DescRejected, amqp10.Composite(amqp10.DescError, amqp10.Symbol("amqp:internal-error"), "message processing failed"))
+	default:
+		// delivery-failed increments the delivery count, undeliverable-here is false
+		return amqp10.Composite(amqp10.DescModified, true, false)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/amqp10"
+	"github.com/sandrolain/events-bridge/src/common/headermap"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure AMQP10Runner implements connectors.Runner
+var _ connectors.Runner = &AMQP10Runner{}
+
+type RunnerConfig struct {
+	ConnectionConfig `mapstructure:",squash"`
+	// Queue is the queue to send to
+	Queue string `mapstructure:"queue" validate:"excluded_with=Topic"`
+	// Topic is the topic to send to; when neither the queue nor the topic are set, the
+	// entity of the connection string is used
+	Topic string `mapstructure:"topic"`
+	// Subject is the subject (label) of the messages, unless the metadata sets a "subject"
+	Subject string `mapstructure:"subject"`
+	// ContentType is the content type of the messages, unless the metadata sets a "contentType"
+	ContentType string `mapstructure:"contentType"`
+	// SessionIDFromMetadataKey is the metadata key of the session id (group id) of the
+	// messages, required by session-enabled entities
+	SessionIDFromMetadataKey string `mapstructure:"sessionIdFromMetadataKey" default:"sessionId"`
+	// SessionID is the session id of the messages without one in the metadata
+	SessionID string `mapstructure:"sessionId"`
+	// ScheduleFromMetadataKey is the metadata key of the scheduled enqueue time of the
+	// messages (RFC 3339), delivered by Service Bus at that time
+	ScheduleFromMetadataKey string `mapstructure:"scheduleFromMetadataKey" default:"scheduledEnqueueTime"`
+	// ScheduleDelay schedules the messages without a time in the metadata after this delay
+	ScheduleDelay time.Duration `mapstructure:"scheduleDelay" validate:"min=0"`
+	// Durable asks the broker to store the messages durably. Default: true
+	Durable bool `mapstructure:"durable" default:"true"`
+	// Timeout bounds the send and its outcome
+	Timeout time.Duration `mapstructure:"timeout" default:"10s" validate:"gt=0"`
+	// Headers sends the metadata keys allowed by the policy (allow, deny, rename, prefix)
+	// as application properties. Without it no properties are sent.
+	Headers *headermap.Config `mapstructure:"headers"`
+}
+
+type AMQP10Runner struct {
+	cfg     *RunnerConfig
+	client  *client
+	entity  string
+	headers *headermap.Policy
+	slog    *slog.Logger
+
+	mu     sync.Mutex
+	conn   *amqp10.Conn
+	sender *amqp10.Link
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates the AMQP 1.0 target, attaching the sender of the entity
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	headers, err := headermap.New(cfg.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid headers policy: %w", err)
+	}
+	log := slog.Default().With("context", "AMQP 1.0 Runner")
+	cl, err := newClient(&cfg.ConnectionConfig, log)
+	if err != nil {
+		return nil, err
+	}
+	entity := cfg.Queue
+	if entity == "" {
+		entity = cfg.Topic
+	}
+	if entity == "" {
+		entity = cl.entity
+	}
+	if entity == "" {
+		cl.close()
+		return nil, errors.New("a queue, a topic or a connection string with EntityPath is required")
+	}
+
+	r := &AMQP10Runner{
+		cfg:     cfg,
+		client:  cl,
+		entity:  entity,
+		headers: headers,
+		slog:    log,
+	}
+	if _, err := r.link(); err != nil {
+		cl.close()
+		return nil, err
+	}
+	r.slog.Info("AMQP 1.0 runner connected", "address", cl.opts.Address, "entity", entity)
+	return r, nil
+}
+
+// link returns the sender link of the entity, connecting again when the connection was lost
+func (r *AMQP10Runner) link() (*amqp10.Link, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sender != nil {
+		select {
+		case <-r.sender.Detached():
+		default:
+			return r.sender, nil
+		}
+	}
+	if r.conn != nil {
+		_ = r.conn.Close()
+		r.conn, r.sender = nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.ConnectTimeout)
+	defer cancel()
+	conn, err := r.client.dial(ctx, r.entity)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := conn.AttachSender(ctx, amqp10.LinkOptions{Target: r.entity})
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to attach to %s: %w", r.entity, err)
+	}
+	r.conn, r.sender = conn, sender
+	return sender, nil
+}
+
+// Process sends the message to the entity and waits for the broker to accept it
+func (r *AMQP10Runner) Process(msg *message.RunnerMessage) error {
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("error getting data: %w", err)
+	}
+	out, err := r.newMessage(msg, metadata, data)
+	if err != nil {
+		return err
+	}
+	sender, err := r.link()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+	if err := sender.Send(ctx, out); err != nil {
+		return fmt.Errorf("failed to send the message to %s: %w", r.entity, err)
+	}
+	r.slog.Debug("AMQP 1.0 message sent", "entity", r.entity, "session", out.GroupID, "bodysize", len(data))
+	return nil
+}
+
+// newMessage builds the message to send, with the application properties of the metadata
+// allowed by the policy and the scheduled enqueue time
+func (r *AMQP10Runner) newMessage(msg *message.RunnerMessage, metadata map[string]string, data []byte) (*amqp10.Message, error) {
+	out := &amqp10.Message{
+		Durable:      r.cfg.Durable,
+		MessageID:    metadata["messageId"],
+		Subject:      r.cfg.Subject,
+		ContentType:  r.cfg.ContentType,
+		CreationTime: time.Now(),
+		GroupID:      message.ResolveFromMetadata(msg, r.cfg.SessionIDFromMetadataKey, r.cfg.SessionID),
+		Data:         data,
+	}
+	if out.MessageID == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil, fmt.Errorf("failed to generate message id: %w", err)
+		}
+		out.MessageID = hex.EncodeToString(id)
+	}
+	if id := metadata["correlationId"]; id != "" {
+		out.CorrelationID = id
+	}
+	if subject := metadata["subject"]; subject != "" {
+		out.Subject = subject
+	}
+	if ct := metadata["contentType"]; ct != "" {
+		out.ContentType = ct
+	}
+
+	var scheduled time.Time
+	if v := message.ResolveFromMetadata(msg, r.cfg.ScheduleFromMetadataKey, ""); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scheduled enqueue time %q: %w", v, err)
+		}
+		scheduled = t
+	} else if r.cfg.ScheduleDelay > 0 {
+		scheduled = time.Now().Add(r.cfg.ScheduleDelay)
+	}
+	if !scheduled.IsZero() {
+		out.Annotations = map[any]any{amqp10.Symbol(annotationScheduled): scheduled.UTC()}
+	}
+
+	if r.cfg.Headers == nil {
+		return out, nil
+	}
+	for k, v := range metadata {
+		if r.headers.Allowed(k) {
+			if out.Properties == nil {
+				out.Properties = map[string]any{}
+			}
+			out.Properties[r.headers.Name(k)] = v
+		}
+	}
+	return out, nil
+}
+
+func (r *AMQP10Runner) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn != nil {
+		_ = r.conn.Close()
+		r.conn, r.sender = nil, nil
+	}
+	r.client.close()
+	return nil
+}
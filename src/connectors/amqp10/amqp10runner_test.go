@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/headermap"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func runnerMessage(metadata map[string]string, data string) *message.RunnerMessage {
+	return message.NewRunnerMessage(testutil.NewAdapter([]byte(data), metadata))
+}
+
+func TestAMQP10RunnerSend(t *testing.T) {
+	broker := startBroker(t)
+	cfg := &RunnerConfig{
+		ConnectionConfig: ConnectionConfig{
+			Address:          broker.address(),
+			ConnectTimeout:   time.Second,
+			ReconnectWait:    10 * time.Millisecond,
+			MaxReconnectWait: 100 * time.Millisecond,
+		},
+		Queue:                    "orders",
+		Subject:                  "default",
+		ContentType:              "application/json",
+		Headers:                  &headermap.Config{Allow: []string{"tenant"}},
+		SessionIDFromMetadataKey: "sessionId",
+		ScheduleFromMetadataKey:  "scheduledEnqueueTime",
+		Durable:                  true,
+		Timeout:                  time.Second,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	scheduled := "2026-03-04T05:06:07Z"
+	err = r.Process(runnerMessage(map[string]string{
+		"messageId":            "m-1",
+		"correlationId":        "c-1",
+		"sessionId":            "customer-7",
+		"subject":              "created",
+		"scheduledEnqueueTime": scheduled,
+		"tenant":               "acme",
+		"secret":               "x",
+	}, `{"id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := broker.sent("orders")
+	if len(sent) != 1 {
+		t.Fatalf("sent = %d", len(sent))
+	}
+	m := sent[0]
+	if string(m.Data) != `{"id":1}` || m.MessageID != "m-1" || m.CorrelationID != "c-1" || m.GroupID != "customer-7" ||
+		m.Subject != "created" || m.ContentType != "application/json" || !m.Durable {
+		t.Errorf("message = %+v", m)
+	}
+	if at, ok := m.Annotation(annotationScheduled).(time.Time); !ok || at.UTC().Format(time.RFC3339) != scheduled {
+		t.Errorf("scheduled enqueue time = %v", m.Annotation(annotationScheduled))
+	}
+	if len(m.Properties) != 1 || m.Properties["tenant"] != "acme" {
+		t.Errorf("application properties = %v", m.Properties)
+	}
+}
+
+func TestAMQP10RunnerScheduleDelay(t *testing.T) {
+	broker := startBroker(t)
+	cfg := &RunnerConfig{
+		ConnectionConfig: ConnectionConfig{
+			Address:          broker.address(),
+			ConnectTimeout:   time.Second,
+			ReconnectWait:    10 * time.Millisecond,
+			MaxReconnectWait: 100 * time.Millisecond,
+		},
+		Topic:                    "events",
+		ScheduleDelay:            time.Hour,
+		SessionIDFromMetadataKey: "sessionId",
+		ScheduleFromMetadataKey:  "scheduledEnqueueTime",
+		Timeout:                  time.Second,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	if err := r.Process(runnerMessage(map[string]string{}, "x")); err != nil {
+		t.Fatal(err)
+	}
+	sent := broker.sent("events")
+	if len(sent) != 1 {
+		t.Fatalf("sent = %d", len(sent))
+	}
+	at, ok := sent[0].Annotation(annotationScheduled).(time.Time)
+	if !ok || at.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("scheduled enqueue time = %v", sent[0].Annotation(annotationScheduled))
+	}
+	if sent[0].MessageID == "" || sent[0].Durable || sent[0].GroupID != "" || sent[0].Properties != nil {
+		t.Errorf("message = %+v", sent[0])
+	}
+
+	err = r.Process(runnerMessage(map[string]string{"scheduledEnqueueTime": "tomorrow"}, "x"))
+	if err == nil || !strings.Contains(err.Error(), "invalid scheduled enqueue time") {
+		t.Errorf("Process() error = %v", err)
+	}
+}
+
+func TestAMQP10RunnerRejected(t *testing.T) {
+	broker := startBroker(t)
+	cfg := &RunnerConfig{
+		ConnectionConfig: ConnectionConfig{
+			Address:          broker.address(),
+			ConnectTimeout:   time.Second,
+			ReconnectWait:    10 * time.Millisecond,
+			MaxReconnectWait: 100 * time.Millisecond,
+		},
+		Queue:                    "unknown",
+		SessionIDFromMetadataKey: "sessionId",
+		ScheduleFromMetadataKey:  "scheduledEnqueueTime",
+		Durable:                  true,
+		Timeout:                  time.Second,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	err = r.Process(runnerMessage(nil, "x"))
+	if err == nil || !strings.Contains(err.Error(), "entity not found") {
+		t.Errorf("Process() error = %v", err)
+	}
+}
+
+func TestAMQP10RunnerReconnect(t *testing.T) {
+	broker := startBroker(t)
+	cfg := &RunnerConfig{
+		ConnectionConfig: ConnectionConfig{
+			Address:          broker.address(),
+			ConnectTimeout:   time.Second,
+			ReconnectWait:    10 * time.Millisecond,
+			MaxReconnectWait: 100 * time.Millisecond,
+		},
+		Queue:                    "orders",
+		SessionIDFromMetadataKey: "sessionId",
+		ScheduleFromMetadataKey:  "scheduledEnqueueTime",
+		Durable:                  true,
+		Timeout:                  time.Second,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	broker.drop()
+	waitFor(t, func() bool {
+		return r.Process(runnerMessage(nil, "x")) == nil
+	})
+	if sent := broker.sent("orders"); len(sent) != 1 {
+		t.Errorf("sent = %d", len(sent))
+	}
+}
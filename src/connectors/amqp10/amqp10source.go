@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/amqp10"
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	modePeekLock         = "peekLock"
+	modeReceiveAndDelete = "receiveAndDelete"
+
+	nakRelease    = "release"
+	nakDeadLetter = "deadLetter"
+
+	// sessionFilter is the source filter accepting a Service Bus session, a given one or
+	// the next available (null value)
+	sessionFilter     = "com.microsoft:session-filter"
+	sessionFilterCode = uint64(0x00000137000000c)
+	// Annotations set by Service Bus
+	annotationEnqueued    = "x-opt-enqueued-time"
+	annotationSequence    = "x-opt-sequence-number"
+	annotationLockedUntil = "x-opt-locked-until"
+	annotationScheduled   = "x-opt-scheduled-enqueue-time"
+)
+
+// errSessionIdle ends the receiving of a next-available session without messages
+var errSessionIdle = errors.New("session idle")
+
+// SessionConfig receives from a session-enabled entity, one session at a time in order
+type SessionConfig struct {
+	// ID is the session to receive; empty accepts the next available session, moving to
+	// another one when idle
+	ID string `mapstructure:"id"`
+	// IdleTimeout releases a next-available session without messages for this time
+	IdleTimeout time.Duration `mapstructure:"idleTimeout" default:"30s" validate:"gt=0"`
+	// LockRenewal is the interval of the session lock renewal (0 = disabled)
+	LockRenewal time.Duration `mapstructure:"lockRenewal" default:"20s" validate:"min=0"`
+}
+
+type SourceConfig struct {
+	ConnectionConfig `mapstructure:",squash"`
+	// Queue is the queue to receive from
+	Queue string `mapstructure:"queue" validate:"excluded_with=Topic"`
+	// Topic and Subscription are the topic subscription to receive from; when neither the
+	// queue nor the topic are set, the entity of the connection string is used
+	Topic        string `mapstructure:"topic"`
+	Subscription string `mapstructure:"subscription" validate:"required_with=Topic"`
+	// ReceiveMode is "peekLock" (locked messages settled by Ack/Nak) or "receiveAndDelete"
+	// (removed on delivery, at-most-once)
+	ReceiveMode string `mapstructure:"receiveMode" default:"peekLock" validate:"oneof=peekLock receiveAndDelete"`
+	// NakOutcome is the outcome of the naked messages: "abandon" (delivered again, counting
+	// the attempt), "release" (delivered again) or "deadLetter" (rejected, dead-lettered
+	// by Service Bus)
+	NakOutcome string `mapstructure:"nakOutcome" default:"abandon" validate:"oneof=abandon release deadLetter"`
+	// Credit is the number of messages prefetched
+	Credit int `mapstructure:"credit" default:"10" validate:"min=1,max=5000"`
+	// Session receives from a session-enabled entity
+	Session *SessionConfig `mapstructure:"session"`
+}
+
+type AMQP10Source struct {
+	cfg    *SourceConfig
+	client *client
+	entity string
+	slog   *slog.Logger
+	c      chan *message.RunnerMessage
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	conn *amqp10.Conn
+}
+
+func NewSourceConfig() any {
+	return new(SourceConfig)
+}
+
+// NewSource creates the AMQP 1.0 source
+func NewSource(anyCfg any) (connectors.Source, error) {
+	cfg, ok := anyCfg.(*SourceConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	log := slog.Default().With("context", "AMQP 1.0 Source")
+	cl, err := newClient(&cfg.ConnectionConfig, log)
+	if err != nil {
+		return nil, err
+	}
+	entity, err := sourceEntity(cfg, cl.entity)
+	if err != nil {
+		cl.close()
+		return nil, err
+	}
+	return &AMQP10Source{
+		cfg:    cfg,
+		client: cl,
+		entity: entity,
+		slog:   log,
+	}, nil
+}
+
+// sourceEntity returns the address of the queue or of the topic subscription
+func sourceEntity(cfg *SourceConfig, fallback string) (string, error) {
+	switch {
+	case cfg.Queue != "":
+		return cfg.Queue, nil
+	case cfg.Topic != "":
+		return cfg.Topic + "/Subscriptions/" + cfg.Subscription, nil
+	case fallback != "" && cfg.Subscription != "":
+		return fallback + "/Subscriptions/" + cfg.Subscription, nil
+	case fallback != "":
+		return fallback, nil
+	}
+	return "", errors.New("a queue, a topic subscription or a connection string with EntityPath is required")
+}
+
+func (s *AMQP10Source) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	s.c = make(chan *message.RunnerMessage, buffer)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	s.slog.Info("starting AMQP 1.0 source",
+		"address", s.client.opts.Address,
+		"entity", s.entity,
+		"receiveMode", s.cfg.ReceiveMode,
+		"session", s.cfg.Session != nil,
+	)
+
+	// The first connection is made synchronously to report configuration errors
+	conn, receiver, err := s.connect()
+	if err != nil {
+		s.cancel()
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.run(conn, receiver)
+	return s.c, nil
+}
+
+// connect opens the connection and attaches the receiver
+func (s *AMQP10Source) connect() (*amqp10.Conn, *amqp10.Link, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.cfg.ConnectTimeout)
+	defer cancel()
+	conn, err := s.client.dial(ctx, s.entity)
+	if err != nil {
+		return nil, nil, err
+	}
+	receiver, err := s.attach(ctx, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	return conn, receiver, nil
+}
+
+// attach attaches the receiver of the entity, accepting a session if configured
+func (s *AMQP10Source) attach(ctx context.Context, conn *amqp10.Conn) (*amqp10.Link, error) {
+	opts := amqp10.LinkOptions{
+		Source:  s.entity,
+		Credit:  uint32(s.cfg.Credit), //nolint:gosec // validated to 1-5000 range
+		Settled: s.cfg.ReceiveMode == modeReceiveAndDelete,
+		Manual:  true,
+	}
+	if s.cfg.Session != nil {
+		var id any
+		if s.cfg.Session.ID != "" {
+			id = s.cfg.Session.ID
+		}
+		opts.Filter = map[any]any{
+			amqp10.Symbol(sessionFilter): &amqp10.Described{Descriptor: sessionFilterCode, Value: id},
+		}
+	}
+	receiver, err := conn.AttachReceiver(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to %s: %w", s.entity, err)
+	}
+	return receiver, nil
+}
+
+// run receives the messages and reconnects when the connection is lost
+func (s *AMQP10Source) run(conn *amqp10.Conn, receiver *amqp10.Link) {
+	defer s.wg.Done()
+	for {
+		err := s.receive(conn, receiver)
+		receiver.Detach()
+		if s.ctx.Err() != nil {
+			_ = conn.Close()
+			return
+		}
+		if errors.Is(err, errSessionIdle) {
+			// Move to the next available session on the same connection
+			ctx, cancel := context.WithTimeout(s.ctx, s.cfg.ConnectTimeout)
+			receiver, err = s.attach(ctx, conn)
+			cancel()
+			if err == nil {
+				continue
+			}
+		}
+		s.slog.Warn("AMQP 1.0 receiver lost", "entity", s.entity, "error", err)
+		_ = conn.Close()
+
+		for attempt := 0; ; attempt++ {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(s.client.backoff(attempt)):
+			}
+			if conn, receiver, err = s.connect(); err == nil {
+				metrics.Reconnected("amqp10")
+				break
+			}
+			s.slog.Error("failed to reconnect to the AMQP 1.0 broker", "error", err)
+		}
+	}
+}
+
+// receive produces the messages of the receiver until it fails; the messages of a
+// session are produced one at a time, in order
+func (s *AMQP10Source) receive(conn *amqp10.Conn, receiver *amqp10.Link) error {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	var sessionID string
+	idle := time.Duration(0)
+	if s.cfg.Session != nil {
+		sessionID = acceptedSession(receiver, s.cfg.Session.ID)
+		s.slog.Info("session accepted", "entity", s.entity, "session", sessionID)
+		if s.cfg.Session.ID == "" {
+			idle = s.cfg.Session.IdleTimeout
+		}
+		if s.cfg.Session.LockRenewal > 0 && s.cfg.ReceiveMode == modePeekLock {
+			go s.renewSessionLock(ctx, conn, receiver, sessionID)
+		}
+	}
+
+	for {
+		d, err := nextDelivery(ctx, receiver, idle)
+		if err != nil {
+			if idle > 0 && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				s.slog.Debug("session idle, releasing it", "entity", s.entity, "session", sessionID)
+				return errSessionIdle
+			}
+			return err
+		}
+
+		msg := &AMQP10Message{
+			delivery:   d,
+			metadata:   deliveryMetadata(d),
+			nakOutcome: s.cfg.NakOutcome,
+		}
+		if sessionID != "" && msg.metadata["sessionId"] == "" {
+			msg.metadata["sessionId"] = sessionID
+		}
+		if s.cfg.Session != nil {
+			msg.done = make(chan message.ResponseStatus, 1)
+		}
+		select {
+		case s.c <- message.NewRunnerMessage(msg):
+		case <-ctx.Done():
+			return nil
+		}
+		if msg.done != nil {
+			select {
+			case <-msg.done:
+			case <-receiver.Detached():
+				return receiver.Err()
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// nextDelivery waits for the next delivery, up to the idle time if set
+func nextDelivery(ctx context.Context, receiver *amqp10.Link, idle time.Duration) (*amqp10.Delivery, error) {
+	if idle <= 0 {
+		return receiver.Receive(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, idle)
+	defer cancel()
+	return receiver.Receive(ctx)
+}
+
+// acceptedSession returns the session id of the filter of the attached source
+func acceptedSession(receiver *amqp10.Link, requested string) string {
+	if receiver.Source() == nil {
+		return requested
+	}
+	filters, _ := receiver.Source().Fields(8)[7].(map[any]any)
+	for k, v := range filters {
+		if amqp10.AsString(k) != sessionFilter {
+			continue
+		}
+		if f, ok := v.(*amqp10.Described); ok {
+			if id := amqp10.AsString(f.Value); id != "" {
+				return id
+			}
+		}
+	}
+	return requested
+}
+
+// renewSessionLock renews the lock of the session on the management node of the entity
+// until the receiver is closed
+func (s *AMQP10Source) renewSessionLock(ctx context.Context, conn *amqp10.Conn, receiver *amqp10.Link, sessionID string) {
+	ticker := time.NewTicker(s.cfg.Session.LockRenewal)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-receiver.Detached():
+			return
+		case <-ticker.C:
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, s.cfg.ConnectTimeout)
+		res, err := conn.Request(reqCtx, s.entity+"/$management", &amqp10.Message{
+			Properties: map[string]any{
+				"operation":            "com.microsoft:renew-session-lock",
+				"associated-link-name": receiver.Name(),
+			},
+			Value: map[any]any{"session-id": sessionID},
+		})
+		cancel()
+		if err == nil {
+			err = statusError(res)
+		}
+		if err != nil && ctx.Err() == nil {
+			s.slog.Warn("failed to renew the session lock", "entity", s.entity, "session", sessionID, "error", err)
+		}
+	}
+}
+
+// deliveryMetadata maps the application and the system properties of a message
+func deliveryMetadata(d *amqp10.Delivery) map[string]string {
+	metadata := make(map[string]string, len(d.Properties)+10)
+	for k, v := range d.Properties {
+		metadata[k] = amqp10.Stringify(v)
+	}
+	for k, v := range map[string]string{
+		"messageId":     amqp10.Stringify(d.MessageID),
+		"correlationId": amqp10.Stringify(d.CorrelationID),
+		"subject":       d.Subject,
+		"contentType":   d.ContentType,
+		"to":            d.To,
+		"replyTo":       d.ReplyTo,
+		"sessionId":     d.GroupID,
+	} {
+		if v != "" {
+			metadata[k] = v
+		}
+	}
+	metadata["deliveryCount"] = strconv.FormatUint(uint64(d.DeliveryCount), 10)
+	for key, annotation := range map[string]string{
+		"enqueuedTime":   annotationEnqueued,
+		"sequenceNumber": annotationSequence,
+		"lockedUntil":    annotationLockedUntil,
+	} {
+		switch v := d.Annotation(annotation).(type) {
+		case nil:
+		case time.Time:
+			metadata[key] = v.UTC().Format(time.RFC3339Nano)
+		default:
+			metadata[key] = amqp10.Stringify(v)
+		}
+	}
+	return metadata
+}
+
+func (s *AMQP10Source) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn != nil {
+		_ = conn.Close()
+	}
+	s.wg.Wait()
+	s.client.close()
+	return nil
+}
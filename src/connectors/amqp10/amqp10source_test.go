@@ -0,0 +1,201 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/amqp10"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+func receive(t *testing.T, c <-chan *message.RunnerMessage, timeout time.Duration) *message.RunnerMessage {
+	t.Helper()
+	select {
+	case msg := <-c:
+		return msg
+	case <-time.After(timeout):
+		t.Fatal("timeout waiting for message")
+	}
+	return nil
+}
+
+func startSource(t *testing.T, opts map[string]any) <-chan *message.RunnerMessage {
+	t.Helper()
+	cfg := parseConfig[SourceConfig](t, opts)
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	t.Cleanup(func() { _ = src.Close() })
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+	return c
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAMQP10SourcePeekLock(t *testing.T) {
+	broker := startBroker(t)
+	broker.enqueue("orders", &amqp10.Message{
+		MessageID:   "m-1",
+		Subject:     "created",
+		ContentType: "application/json",
+		Annotations: map[any]any{
+			amqp10.Symbol(annotationSequence): int64(7),
+			amqp10.Symbol(annotationEnqueued): time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		Properties: map[string]any{"tenant": "acme"},
+		Data:       []byte(`{"id":1}`),
+	})
+
+	c := startSource(t, map[string]any{
+		"connectionString": testConnString,
+		"address":          broker.address(),
+		"queue":            "orders",
+	})
+	if login := broker.login(); len(login) == 0 || login[0] != "PLAIN:RootManageSharedAccessKey\x00"+testKey {
+		t.Errorf("SASL login = %q", login)
+	}
+
+	msg := receive(t, c, 3*time.Second)
+	meta, _ := msg.GetMetadata()
+	data, _ := msg.GetData()
+	if string(data) != `{"id":1}` || meta["messageId"] != "m-1" || meta["subject"] != "created" || meta["contentType"] != "application/json" ||
+		meta["tenant"] != "acme" || meta["sequenceNumber"] != "7" || meta["enqueuedTime"] != "2026-01-02T03:04:05Z" || meta["deliveryCount"] != "0" {
+		t.Errorf("metadata = %v, data = %s", meta, data)
+	}
+
+	// Naked messages are abandoned and delivered again
+	if err := msg.Nak(); err != nil {
+		t.Fatal(err)
+	}
+	msg = receive(t, c, 3*time.Second)
+	if meta, _ := msg.GetMetadata(); meta["messageId"] != "m-1" || meta["deliveryCount"] != "1" {
+		t.Errorf("redelivered metadata = %v", meta)
+	}
+	if err := msg.Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(broker.snapshot(&broker.completed)) == 1 })
+}
+
+func TestAMQP10SourceDeadLetter(t *testing.T) {
+	broker := startBroker(t)
+	broker.enqueue("orders", &amqp10.Message{MessageID: "m-1", Data: []byte("x")})
+	c := startSource(t, map[string]any{
+		"connectionString": testConnString + ";EntityPath=orders",
+		"address":          broker.address(),
+		"nakOutcome":       "deadLetter",
+	})
+	if err := receive(t, c, 3*time.Second).Nak(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(broker.snapshot(&broker.deadLetter)) == 1 })
+	if pending := broker.pending("orders"); len(pending) != 0 {
+		t.Errorf("pending = %d", len(pending))
+	}
+}
+
+func TestAMQP10SourceSubscriptionReceiveAndDelete(t *testing.T) {
+	broker := startBroker(t)
+	broker.enqueue("events/Subscriptions/audit", &amqp10.Message{MessageID: "e-1", Data: []byte("x")})
+	c := startSource(t, map[string]any{
+		"address":      broker.address(),
+		"username":     "user",
+		"password":     "pass",
+		"topic":        "events",
+		"subscription": "audit",
+		"receiveMode":  "receiveAndDelete",
+	})
+	if login := broker.login(); len(login) == 0 || login[0] != "PLAIN:user\x00pass" {
+		t.Errorf("SASL login = %q", login)
+	}
+	msg := receive(t, c, 3*time.Second)
+	if meta, _ := msg.GetMetadata(); meta["messageId"] != "e-1" {
+		t.Errorf("metadata = %v", meta)
+	}
+	// The message was settled on delivery
+	if err := msg.Nak(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if pending := broker.pending("events/Subscriptions/audit"); len(pending) != 0 {
+		t.Errorf("pending = %d", len(pending))
+	}
+}
+
+func TestAMQP10SourceSessions(t *testing.T) {
+	broker := startBroker(t)
+	broker.enqueue("jobs", &amqp10.Message{MessageID: "a-1", GroupID: "a", Data: []byte("1")})
+	broker.enqueue("jobs", &amqp10.Message{MessageID: "a-2", GroupID: "a", Data: []byte("2")})
+	broker.enqueue("jobs", &amqp10.Message{MessageID: "b-1", GroupID: "b", Data: []byte("3")})
+
+	c := startSource(t, map[string]any{
+		"address": broker.address(),
+		"queue":   "jobs",
+		"session": map[string]any{"idleTimeout": "200ms", "lockRenewal": "50ms"},
+	})
+
+	msg := receive(t, c, 3*time.Second)
+	if meta, _ := msg.GetMetadata(); meta["messageId"] != "a-1" || meta["sessionId"] != "a" {
+		t.Errorf("metadata = %v", meta)
+	}
+	// The messages of a session are produced one at a time
+	select {
+	case <-c:
+		t.Fatal("next message of the session produced before the outcome")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := msg.Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+	msg = receive(t, c, 3*time.Second)
+	if meta, _ := msg.GetMetadata(); meta["messageId"] != "a-2" {
+		t.Errorf("metadata = %v", meta)
+	}
+	if err := msg.Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The idle session is released for the next available one
+	msg = receive(t, c, 3*time.Second)
+	if meta, _ := msg.GetMetadata(); meta["messageId"] != "b-1" || meta["sessionId"] != "b" {
+		t.Errorf("metadata = %v", meta)
+	}
+	if err := msg.Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	broker.mu.Lock()
+	renewals := append([]string(nil), broker.renewals...)
+	broker.mu.Unlock()
+	if len(renewals) == 0 || renewals[0] != "com.microsoft:renew-session-lock a" {
+		t.Errorf("renewals = %v", renewals)
+	}
+}
+
+func TestAMQP10SourceReconnect(t *testing.T) {
+	broker := startBroker(t)
+	c := startSource(t, map[string]any{
+		"address":       broker.address(),
+		"queue":         "orders",
+		"reconnectWait": "50ms",
+	})
+	broker.drop()
+	waitFor(t, func() bool { return len(broker.login()) == 2 })
+	broker.enqueue("orders", &amqp10.Message{MessageID: "m-1", Data: []byte("x")})
+	if err := receive(t, c, 3*time.Second).Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/amqp10"
+	"github.com/sandrolain/events-bridge/src/common/credentials"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+)
+
+const (
+	amqpPort  = "5672"
+	amqpsPort = "5671"
+
+	// cbsNode is the claims-based security node receiving the tokens of the entities
+	cbsNode = "$cbs"
+	// cbsTokenType is the type of the tokens put to the $cbs node
+	cbsTokenType = "jwt"
+)
+
+// ConnectionConfig is the connection to the broker shared by the source and the target
+type ConnectionConfig struct {
+	// Address is the broker URL: "amqps://host[:5671]" (TLS) or "amqp://host[:5672]";
+	// when empty, the host of the connection string on port 5671
+	Address string `mapstructure:"address" validate:"required_without=ConnectionString,omitempty,url"`
+	// ConnectionString is an Azure Service Bus connection string
+	// ("Endpoint=sb://<namespace>.servicebus.windows.net/;SharedAccessKeyName=...;SharedAccessKey=...[;EntityPath=...]"),
+	// authenticating with the shared access key; supports secret references (env:, file:)
+	ConnectionString string `mapstructure:"connectionString"`
+	// Username and Password authenticate with SASL PLAIN (e.g. Solace, ActiveMQ Artemis);
+	// the password supports secret references
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"` //nolint:gosec // user-configured credential field
+	// Credentials authenticates with tokens put to the claims-based security node ($cbs)
+	// after an anonymous login, e.g. Microsoft Entra ID tokens of the oauth2 type with the
+	// scope "https://servicebus.azure.net/.default"; rotated tokens are put again
+	Credentials *credentials.Config `mapstructure:"credentials"`
+	// ConnectTimeout bounds the connection, the authentication and the link attachment
+	ConnectTimeout time.Duration `mapstructure:"connectTimeout" default:"10s" validate:"gt=0"`
+	// TLS configures the certificates of the TLS connection (amqps or enabled)
+	TLS *tlsconfig.Config `mapstructure:"tls"`
+	// ReconnectWait is the wait before the first reconnection attempt, doubled on
+	// consecutive failures up to MaxReconnectWait
+	ReconnectWait time.Duration `mapstructure:"reconnectWait" default:"1s" validate:"gt=0"`
+	// MaxReconnectWait caps the wait between reconnection attempts
+	MaxReconnectWait time.Duration `mapstructure:"maxReconnectWait" default:"30s" validate:"gtefield=ReconnectWait"`
+}
+
+// client opens the connections to the broker and authorizes them for an entity
+type client struct {
+	cfg    *ConnectionConfig
+	opts   amqp10.ConnOptions
+	creds  *credentials.Provider
+	logger *slog.Logger
+	// entity is the queue or topic of the connection string, if any
+	entity string
+
+	mu sync.Mutex
+	// conn is the last connection, whose token is put again on rotation
+	conn     *amqp10.Conn
+	audience string
+}
+
+// newClient resolves the endpoint and the authentication of the connection
+func newClient(cfg *ConnectionConfig, logger *slog.Logger) (*client, error) {
+	cl := &client{cfg: cfg, logger: logger, opts: amqp10.ConnOptions{Timeout: cfg.ConnectTimeout}}
+
+	scheme, host := "amqps", ""
+	if cfg.ConnectionString != "" {
+		raw, err := secrets.Resolve(cfg.ConnectionString)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve connection string: %w", err)
+		}
+		cs, err := amqp10.ParseConnectionString(raw)
+		if err != nil {
+			return nil, err
+		}
+		host, cl.entity = cs.Host, cs.Entity
+		cl.opts.Username, cl.opts.Password = cs.KeyName, cs.Key
+	}
+	if cfg.Address != "" {
+		u, err := url.Parse(cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address: %w", err)
+		}
+		if u.Scheme != "amqp" && u.Scheme != "amqps" {
+			return nil, fmt.Errorf("unsupported address scheme %q, expected amqp or amqps", u.Scheme)
+		}
+		scheme, host = u.Scheme, u.Host
+	}
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = host, amqpPort
+		if scheme == "amqps" {
+			port = amqpsPort
+		}
+	}
+	cl.opts.Address = net.JoinHostPort(hostname, port)
+	cl.opts.Hostname = hostname
+
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build TLS config: %w", err)
+	}
+	if tlsConfig == nil && scheme == "amqps" {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	cl.opts.TLS = tlsConfig
+
+	if cfg.Username != "" {
+		cl.opts.Username = cfg.Username
+		if cl.opts.Password, err = secrets.Resolve(cfg.Password); err != nil {
+			return nil, fmt.Errorf("failed to resolve password: %w", err)
+		}
+	}
+	if cfg.Credentials != nil {
+		if cl.opts.Username != "" {
+			return nil, errors.New("credentials cannot be combined with a connection string or a username")
+		}
+		if cl.creds, err = credentials.New(cfg.Credentials, logger); err != nil {
+			return nil, fmt.Errorf("failed to create credentials provider: %w", err)
+		}
+		if !cl.creds.Current().HasToken() {
+			cl.creds.Close()
+			return nil, errors.New("credentials must provide a token")
+		}
+		cl.creds.Subscribe(cl.rotate)
+	}
+	return cl, nil
+}
+
+// dial opens a connection authorized to use the entity
+func (cl *client) dial(ctx context.Context, entity string) (*amqp10.Conn, error) {
+	conn, err := amqp10.Dial(ctx, cl.opts, cl.logger)
+	if err != nil {
+		return nil, err
+	}
+	if cl.creds == nil {
+		return conn, nil
+	}
+	audience := fmt.Sprintf("amqp://%s/%s", cl.opts.Hostname, entity)
+	if err := putToken(ctx, conn, audience, cl.creds.Current()); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	cl.mu.Lock()
+	cl.conn, cl.audience = conn, audience
+	cl.mu.Unlock()
+	return conn, nil
+}
+
+// rotate puts the rotated token on the current connection
+func (cl *client) rotate(creds credentials.Credentials) {
+	cl.mu.Lock()
+	conn, audience := cl.conn, cl.audience
+	cl.mu.Unlock()
+	if conn == nil {
+		return
+	}
+	select {
+	case <-conn.Done():
+		return
+	default:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cl.cfg.ConnectTimeout)
+	defer cancel()
+	if err := putToken(ctx, conn, audience, creds); err != nil {
+		cl.logger.Error("failed to put the rotated token, reconnecting", "error", err)
+		_ = conn.Close()
+	}
+}
+
+// backoff returns the wait before the given reconnection attempt (starting at 0)
+func (cl *client) backoff(attempt int) time.Duration {
+	wait := cl.cfg.ReconnectWait
+	for range attempt {
+		if wait *= 2; wait >= cl.cfg.MaxReconnectWait {
+			return cl.cfg.MaxReconnectWait
+		}
+	}
+	return wait
+}
+
+func (cl *client) close() {
+	if cl.creds != nil {
+		cl.creds.Close()
+	}
+}
+
+// putToken authorizes the connection to use the audience with the token
+func putToken(ctx context.Context, conn *amqp10.Conn, audience string, creds credentials.Credentials) error {
+	expiry := creds.Expiry
+	if expiry.IsZero() {
+		expiry = time.Now().Add(time.Hour)
+	}
+	res, err := conn.Request(ctx, cbsNode, &amqp10.Message{
+		Properties: map[string]any{
+			"operation":  "put-token",
+			"type":       cbsTokenType,
+			"name":       audience,
+			"expiration": expiry,
+		},
+		Value: creds.Token,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put the token: %w", err)
+	}
+	if err := statusError(res); err != nil {
+		return fmt.Errorf("token refused: %w", err)
+	}
+	return nil
+}
+
+// statusError returns the error of a response of the $cbs or $management nodes
+func statusError(res *amqp10.Message) error {
+	code := res.Properties["status-code"]
+	if code == nil {
+		code = res.Properties["statusCode"]
+	}
+	var status int64
+	switch v := code.(type) {
+	case int32:
+		status = int64(v)
+	case int64:
+		status = v
+	case uint32:
+		status = int64(v)
+	}
+	if status >= 200 && status < 300 {
+		return nil
+	}
+	description := amqp10.Stringify(res.Properties["status-description"])
+	if description == "" {
+		description = amqp10.Stringify(res.Properties["statusDescription"])
+	}
+	return fmt.Errorf("status %d %s", status, description)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewClientEndpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ConnectionConfig
+		address string
+		tls     bool
+	}{
+		{"connection string", ConnectionConfig{ConnectionString: testConnString}, "testns.servicebus.windows.net:5671", true},
+		{"amqps default port", ConnectionConfig{Address: "amqps://broker.local"}, "broker.local:5671", true},
+		{"amqp default port", ConnectionConfig{Address: "amqp://broker.local"}, "broker.local:5672", false},
+		{"address override", ConnectionConfig{Address: "amqp://127.0.0.1:5673", ConnectionString: testConnString}, "127.0.0.1:5673", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl, err := newClient(&tt.cfg, slog.Default())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cl.opts.Address != tt.address || (cl.opts.TLS != nil) != tt.tls {
+				t.Errorf("address = %s, tls = %v", cl.opts.Address, cl.opts.TLS != nil)
+			}
+		})
+	}
+
+	if _, err := newClient(&ConnectionConfig{Address: "http://broker.local"}, slog.Default()); err == nil {
+		t.Error("expected error for an unsupported scheme")
+	}
+}
+
+func TestCredentialsToken(t *testing.T) {
+	broker := startBroker(t)
+	cfg := parseConfig[SourceConfig](t, map[string]any{
+		"address":     broker.address(),
+		"queue":       "orders",
+		"credentials": map[string]any{"type": "static", "token": "aad-token"},
+	})
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close() //nolint:errcheck
+	if _, err := src.Produce(1); err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+	if login := broker.login(); len(login) == 0 || login[0] != "ANONYMOUS:" {
+		t.Errorf("SASL login = %q", login)
+	}
+	broker.mu.Lock()
+	tokens := broker.tokens
+	broker.mu.Unlock()
+	host := strings.TrimPrefix(broker.address(), "amqp://")
+	host = host[:strings.LastIndex(host, ":")]
+	if len(tokens) != 1 || tokens[0]["token"] != "aad-token" || tokens[0]["type"] != cbsTokenType || tokens[0]["name"] != "amqp://"+host+"/orders" {
+		t.Errorf("tokens = %v", tokens)
+	}
+
+	bad := parseConfig[SourceConfig](t, map[string]any{
+		"address":     broker.address(),
+		"queue":       "orders",
+		"credentials": map[string]any{"type": "static", "token": "bad"},
+	})
+	src, err = NewSource(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close() //nolint:errcheck
+	if _, err := src.Produce(1); err == nil || !strings.Contains(err.Error(), "token refused") {
+		t.Errorf("Produce() error = %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cl := &client{cfg: &ConnectionConfig{ReconnectWait: time.Second, MaxReconnectWait: 5 * time.Second}}
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := cl.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestSourceEntity(t *testing.T) {
+	tests := []struct {
+		cfg      SourceConfig
+		fallback string
+		want     string
+	}{
+		{SourceConfig{Queue: "orders"}, "", "orders"},
+		{SourceConfig{Topic: "events", Subscription: "audit"}, "", "events/Subscriptions/audit"},
+		{SourceConfig{Subscription: "audit"}, "events", "events/Subscriptions/audit"},
+		{SourceConfig{}, "orders", "orders"},
+	}
+	for _, tt := range tests {
+		if got, err := sourceEntity(&tt.cfg, tt.fallback); err != nil || got != tt.want {
+			t.Errorf("sourceEntity(%+v, %q) = %q, %v", tt.cfg, tt.fallback, got, err)
+		}
+	}
+	if _, err := sourceEntity(&SourceConfig{}, ""); err == nil {
+		t.Error("expected error without entity")
+	}
+}
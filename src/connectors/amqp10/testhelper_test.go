@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/common/amqp10"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+var (
+	testKey        = base64.StdEncoding.EncodeToString([]byte("secret"))
+	testConnString = "Endpoint=sb://testns.servicebus.windows.net/;SharedAccessKeyName=RootManageSharedAccessKey;SharedAccessKey=" + testKey
+)
+
+// fakeBroker is a plain AMQP 1.0 server behaving like a Service Bus namespace: it queues
+// messages per entity, filters the sessions of receivers, settles the dispositions of
+// the clients, accepts the tokens of the $cbs node and renews the session locks on the
+// management node of the entities; messages sent to "unknown" are rejected
+type fakeBroker struct {
+	t        *testing.T
+	listener net.Listener
+
+	mu         sync.Mutex
+	logins     []string
+	tokens     []map[string]any
+	renewals   []string
+	queues     map[string][]*amqp10.Message
+	received   map[string][]*amqp10.Message
+	completed  []*amqp10.Message
+	deadLetter []*amqp10.Message
+	conns      map[*brokerConn]struct{}
+}
+
+// brokerConn is a client connection of the fake broker
+type brokerConn struct {
+	broker *fakeBroker
+	conn   net.Conn
+	wmu    sync.Mutex
+	links  map[uint32]*brokerLink
+	// replies are the reply links of the $cbs and management nodes by address
+	replies  map[string]*brokerLink
+	inflight map[uint32]inflight
+	delivery uint32
+}
+
+// brokerLink is a link of a client connection
+type brokerLink struct {
+	handle   uint32
+	receiver bool
+	address  string
+	credit   uint32
+	settled  bool
+	// session is the session accepted by a session receiver
+	session string
+	node    bool
+}
+
+// inflight is an unsettled delivery of a receiver
+type inflight struct {
+	address string
+	msg     *amqp10.Message
+}
+
+func startBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{
+		t:        t,
+		listener: ln,
+		queues:   make(map[string][]*amqp10.Message),
+		received: make(map[string][]*amqp10.Message),
+		conns:    make(map[*brokerConn]struct{}),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c := &brokerConn{
+				broker:   b,
+				conn:     conn,
+				links:    make(map[uint32]*brokerLink),
+				replies:  make(map[string]*brokerLink),
+				inflight: make(map[uint32]inflight),
+			}
+			b.mu.Lock()
+			b.conns[c] = struct{}{}
+			b.mu.Unlock()
+			go c.serve()
+		}
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+		b.drop()
+	})
+	return b
+}
+
+func (b *fakeBroker) address() string {
+	return "amqp://" + b.listener.Addr().String()
+}
+
+// enqueue appends a message to an entity and delivers it to the receivers
+func (b *fakeBroker) enqueue(entity string, msg *amqp10.Message) {
+	b.mu.Lock()
+	b.queues[entity] = append(b.queues[entity], msg)
+	conns := make([]*brokerConn, 0, len(b.conns))
+	for c := range b.conns {
+		conns = append(conns, c)
+	}
+	b.mu.Unlock()
+	for _, c := range conns {
+		c.deliver()
+	}
+}
+
+// drop closes the client connections
+func (b *fakeBroker) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.conns {
+		_ = c.conn.Close()
+		delete(b.conns, c)
+	}
+}
+
+// snapshot returns a copy of the messages under the lock of the broker
+func (b *fakeBroker) snapshot(messages *[]*amqp10.Message) []*amqp10.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*amqp10.Message(nil), *messages...)
+}
+
+func (b *fakeBroker) sent(entity string) []*amqp10.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*amqp10.Message(nil), b.received[entity]...)
+}
+
+func (b *fakeBroker) pending(entity string) []*amqp10.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*amqp10.Message(nil), b.queues[entity]...)
+}
+
+func (b *fakeBroker) login() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.logins...)
+}
+
+func (c *brokerConn) write(body *amqp10.Described, payload []byte) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_ = amqp10.WriteFrame(c.conn, amqp10.FrameAMQP, 0, body, payload)
+}
+
+func (c *brokerConn) serve() {
+	defer c.conn.Close() //nolint:errcheck
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return
+	}
+	_, _ = c.conn.Write(amqp10.HeaderSASL)
+	_ = amqp10.WriteFrame(c.conn, amqp10.FrameSASL, 0, amqp10.Composite(amqp10.DescSASLMechanisms, []amqp10.Symbol{"PLAIN", "ANONYMOUS"}), nil)
+	f, err := amqp10.ReadFrame(c.conn, amqp10.MaxFrameSize)
+	if err != nil {
+		return
+	}
+	fields := f.Body.Fields(2)
+	response, _ := fields[1].([]byte)
+	c.broker.mu.Lock()
+	c.broker.logins = append(c.broker.logins, amqp10.AsString(fields[0])+":"+strings.TrimPrefix(string(response), "\x00"))
+	c.broker.mu.Unlock()
+	_ = amqp10.WriteFrame(c.conn, amqp10.FrameSASL, 0, amqp10.Composite(amqp10.DescSASLOutcome, uint8(0)), nil)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return
+	}
+	_, _ = c.conn.Write(amqp10.HeaderAMQP)
+
+	for {
+		f, err := amqp10.ReadFrame(c.conn, amqp10.MaxFrameSize)
+		if err != nil {
+			return
+		}
+		if f.Body == nil {
+			continue
+		}
+		switch f.Body.Code() {
+		case amqp10.DescOpen:
+			c.write(amqp10.Composite(amqp10.DescOpen, "fake-broker", nil, uint32(4096), uint16(0), uint32(1000)), nil)
+		case amqp10.DescBegin:
+			c.write(amqp10.Composite(amqp10.DescBegin, uint16(0), uint32(0), uint32(amqp10.SessionWindow), uint32(amqp10.SessionWindow)), nil)
+		case amqp10.DescAttach:
+			c.attach(f.Body.Fields(10))
+		case amqp10.DescFlow:
+			fields := f.Body.Fields(7)
+			if fields[4] == nil {
+				continue
+			}
+			c.broker.mu.Lock()
+			if l, ok := c.links[amqp10.AsUint32(fields[4])]; ok {
+				l.credit = amqp10.AsUint32(fields[6])
+			}
+			c.broker.mu.Unlock()
+			c.deliver()
+		case amqp10.DescTransfer:
+			c.transfer(f.Body.Fields(6), f.Payload)
+		case amqp10.DescDisposition:
+			c.disposition(f.Body.Fields(5))
+			c.deliver()
+		case amqp10.DescDetach:
+			fields := f.Body.Fields(1)
+			c.broker.mu.Lock()
+			delete(c.links, amqp10.AsUint32(fields[0]))
+			c.broker.mu.Unlock()
+			c.write(amqp10.Composite(amqp10.DescDetach, fields[0], true), nil)
+		case amqp10.DescClose:
+			c.write(amqp10.Composite(amqp10.DescClose), nil)
+			return
+		}
+	}
+}
+
+// isNode reports whether the address is the $cbs node or a management node
+func isNode(address string) bool {
+	return address == cbsNode || strings.HasSuffix(address, "/$management")
+}
+
+// attach answers the attach of a client link, accepting the session of session receivers
+func (c *brokerConn) attach(fields []any) {
+	name, handle, clientReceiver := fields[0], amqp10.AsUint32(fields[1]), amqp10.AsBool(fields[2])
+	source, _ := fields[5].(*amqp10.Described)
+	target, _ := fields[6].(*amqp10.Described)
+	l := &brokerLink{handle: handle, receiver: clientReceiver, settled: amqp10.AsUint32(fields[3]) == uint32(amqp10.SndSettleSettled)}
+	if clientReceiver {
+		l.address = amqp10.AsString(source.Fields(1)[0])
+	} else {
+		l.address = amqp10.AsString(target.Fields(1)[0])
+	}
+	l.node = isNode(l.address)
+
+	c.broker.mu.Lock()
+	if clientReceiver && l.node {
+		c.replies[amqp10.AsString(target.Fields(1)[0])] = l
+	}
+	remoteSource := fields[5]
+	if clientReceiver && !l.node {
+		filters, _ := source.Fields(8)[7].(map[any]any)
+		if filter, ok := filters[amqp10.Symbol(sessionFilter)].(*amqp10.Described); ok {
+			l.session = amqp10.AsString(filter.Value)
+			if l.session == "" {
+				for _, msg := range c.broker.queues[l.address] {
+					if msg.GroupID != "" {
+						l.session = msg.GroupID
+						break
+					}
+				}
+			}
+			if l.session == "" {
+				c.broker.mu.Unlock()
+				c.write(amqp10.Composite(amqp10.DescAttach, name, handle, !clientReceiver, nil, nil, nil, nil), nil)
+				c.write(amqp10.Composite(amqp10.DescDetach, handle, true, amqp10.Composite(amqp10.DescError, amqp10.Symbol("com.microsoft:timeout"), "no session available")), nil)
+				return
+			}
+			remoteSource = amqp10.Composite(amqp10.DescSource, l.address, nil, nil, nil, nil, nil, nil,
+				map[any]any{amqp10.Symbol(sessionFilter): &amqp10.Described{Descriptor: sessionFilterCode, Value: l.session}})
+		}
+	}
+	c.links[handle] = l
+	c.broker.mu.Unlock()
+
+	var initialCount any
+	if clientReceiver {
+		initialCount = uint32(0)
+	}
+	c.write(amqp10.Composite(amqp10.DescAttach, name, handle, !clientReceiver, nil, nil, remoteSource, fields[6], nil, nil, initialCount), nil)
+	if !clientReceiver {
+		c.write(amqp10.Composite(amqp10.DescFlow, uint32(0), uint32(amqp10.SessionWindow), uint32(0), uint32(amqp10.SessionWindow), handle, uint32(0), uint32(100)), nil)
+	}
+}
+
+// deliver sends the queued messages to the receivers with credit
+func (c *brokerConn) deliver() {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	for _, l := range c.links {
+		if !l.receiver || l.node {
+			continue
+		}
+		queue := c.broker.queues[l.address]
+		kept := queue[:0]
+		for _, msg := range queue {
+			if l.credit == 0 || msg.GroupID != l.session {
+				kept = append(kept, msg)
+				continue
+			}
+			id := c.send(l, msg)
+			if !l.settled {
+				c.inflight[id] = inflight{address: l.address, msg: msg}
+			}
+		}
+		c.broker.queues[l.address] = kept
+	}
+}
+
+// send transfers a message on a link, settled if the link is
+func (c *brokerConn) send(l *brokerLink, msg *amqp10.Message) uint32 {
+	// encodeMessage writes no delivery count: the header section is written here
+	header, _ := amqp10.Marshal(amqp10.Composite(amqp10.DescHeader, msg.Durable, nil, nil, nil, msg.DeliveryCount))
+	bare := *msg
+	bare.Durable = false
+	payload, err := amqp10.EncodeMessage(&bare)
+	if err != nil {
+		c.broker.t.Errorf("encodeMessage() error = %v", err)
+		return 0
+	}
+	payload = append(header, payload...)
+	l.credit--
+	c.delivery++
+	c.write(amqp10.Composite(amqp10.DescTransfer, l.handle, c.delivery, []byte{byte(c.delivery)}, uint32(0), l.settled, false), payload)
+	return c.delivery
+}
+
+// disposition settles the deliveries of the client receivers
+func (c *brokerConn) disposition(fields []any) {
+	if !amqp10.AsBool(fields[0]) {
+		return
+	}
+	state, _ := fields[4].(*amqp10.Described)
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	id := amqp10.AsUint32(fields[1])
+	d, ok := c.inflight[id]
+	if !ok || state == nil {
+		return
+	}
+	delete(c.inflight, id)
+	switch state.Code() {
+	case amqp10.DescAccepted:
+		c.broker.completed = append(c.broker.completed, d.msg)
+	case amqp10.DescModified:
+		if amqp10.AsBool(state.Fields(1)[0]) {
+			d.msg.DeliveryCount++
+		}
+		c.broker.queues[d.address] = append(c.broker.queues[d.address], d.msg)
+	case amqp10.DescReleased:
+		c.broker.queues[d.address] = append(c.broker.queues[d.address], d.msg)
+	case amqp10.DescRejected:
+		c.broker.deadLetter = append(c.broker.deadLetter, d.msg)
+	}
+}
+
+// transfer handles the messages sent by the client
+func (c *brokerConn) transfer(fields []any, payload []byte) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	l, ok := c.links[amqp10.AsUint32(fields[0])]
+	if !ok {
+		return
+	}
+	deliveryID := fields[1]
+	msg, err := amqp10.DecodeMessage(payload)
+	if err != nil {
+		c.broker.t.Errorf("decodeMessage() error = %v", err)
+		return
+	}
+
+	if l.node {
+		c.write(amqp10.Composite(amqp10.DescDisposition, true, deliveryID, nil, true, amqp10.Composite(amqp10.DescAccepted)), nil)
+		status := int32(200)
+		switch l.address {
+		case cbsNode:
+			c.broker.tokens = append(c.broker.tokens, map[string]any{"name": msg.Properties["name"], "type": msg.Properties["type"], "token": msg.Value})
+			if msg.Value == "bad" {
+				status = 401
+			}
+		default:
+			body, _ := msg.Value.(map[any]any)
+			c.broker.renewals = append(c.broker.renewals, amqp10.AsString(msg.Properties["operation"])+" "+amqp10.AsString(body["session-id"]))
+		}
+		reply := c.replies[msg.ReplyTo]
+		if reply == nil || reply.credit == 0 {
+			return
+		}
+		c.send(reply, &amqp10.Message{
+			CorrelationID: msg.MessageID,
+			Properties:    map[string]any{"status-code": status},
+		})
+		return
+	}
+
+	state := amqp10.Composite(amqp10.DescAccepted)
+	if l.address == "unknown" {
+		state = amqp10.Composite(amqp10.DescRejected, amqp10.Composite(amqp10.DescError, amqp10.Symbol("amqp:not-found"), "entity not found"))
+	} else {
+		c.broker.received[l.address] = append(c.broker.received[l.address], msg)
+	}
+	c.write(amqp10.Composite(amqp10.DescDisposition, true, deliveryID, nil, true, state), nil)
+}
+
+func parseConfig[T any](t *testing.T, opts map[string]any) *T {
+	t.Helper()
+	cfg := new(T)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("ParseConfig() unexpected error = %v", err)
+	}
+	return cfg
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure AwaitRunner implements connectors.Runner
+var _ connectors.Runner = &AwaitRunner{}
+
+const (
+	listenerHTTP = "http"
+	listenerNATS = "nats"
+
+	mergeReplace  = "replace"
+	mergeObject   = "merge"
+	mergeMetadata = "metadata"
+
+	onTimeoutFail     = "fail"
+	onTimeoutContinue = "continue"
+
+	statusReceived = "received"
+	statusTimeout  = "timeout"
+)
+
+// errClosed is returned to the messages parked when the runner is closed
+var errClosed = errors.New("await runner closed")
+
+type RunnerConfig struct {
+	// CorrelationKey is the metadata key of the correlation id, e.g. set by the runner
+	// sending the request to the external system and sent back with the callback
+	CorrelationKey string `mapstructure:"correlationKey" default:"eb-correlation-id" validate:"required"`
+	// Timeout is the maximum time a message waits for its callback
+	Timeout time.Duration `mapstructure:"timeout" default:"5m" validate:"gt=0"`
+	// OnTimeout is "fail" (default, the message fails) or "continue" (the message continues
+	// unchanged with the timeout status)
+	OnTimeout string `mapstructure:"onTimeout" default:"fail" validate:"oneof=fail continue"`
+	// Merge applies the callback payload: "replace" (default, the callback replaces the payload),
+	// "merge" (the fields of the callback JSON object are set in the payload JSON object) or
+	// "metadata" (the payload is unchanged, the callback is set in CallbackKey)
+	Merge string `mapstructure:"merge" default:"replace" validate:"oneof=replace merge metadata"`
+	// CallbackKey is the metadata key of the callback payload of the "metadata" merge
+	CallbackKey string `mapstructure:"callbackKey" default:"eb-await-callback" validate:"required"`
+	// StatusKey is the metadata key set to "received" or "timeout"
+	StatusKey string `mapstructure:"statusKey" default:"eb-await-status" validate:"required"`
+	// MaxPending bounds the parked messages plus the callbacks received before their message
+	MaxPending int `mapstructure:"maxPending" default:"10000" validate:"gt=0"`
+	// MaxCallbackSize limits the callback payload size
+	MaxCallbackSize int `mapstructure:"maxCallbackSize" default:"1048576" validate:"gt=0"` // 1MB default
+
+	// Listener is the callback listener: "http" (default) or "nats"
+	Listener string              `mapstructure:"listener" default:"http" validate:"oneof=http nats"`
+	HTTP     *HTTPListenerConfig `mapstructure:"http" validate:"required_if=Listener http"`
+	NATS     *NATSListenerConfig `mapstructure:"nats" validate:"required_if=Listener nats"`
+}
+
+// AwaitRunner parks every message until the callback with its correlation id arrives from
+// an external system, or the timeout elapses, enabling request → external asynchronous
+// processing → continue pipelines. Every parked message holds a runner routine.
+type AwaitRunner struct {
+	cfg      *RunnerConfig
+	slog     *slog.Logger
+	pending  *pending
+	listener callbackListener
+	stopCh   chan struct{}
+	once     sync.Once
+}
+
+// callbackListener receives the callbacks and hands them to the pending messages
+type callbackListener interface {
+	Close() error
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates the runner and starts the callback listener
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	r := newAwaitRunner(cfg)
+	var err error
+	switch cfg.Listener {
+	case listenerHTTP:
+		r.listener, err = newHTTPListener(cfg.HTTP, cfg.MaxCallbackSize, r.pending, r.slog)
+	case listenerNATS:
+		r.listener, err = newNATSListener(cfg.NATS, cfg.MaxCallbackSize, r.pending, r.slog)
+	default:
+		err = fmt.Errorf("unsupported listener: %s", cfg.Listener)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.slog.Info("await runner created", "listener", cfg.Listener, "correlationKey", cfg.CorrelationKey, "timeout", cfg.Timeout)
+	return r, nil
+}
+
+func newAwaitRunner(cfg *RunnerConfig) *AwaitRunner {
+	return &AwaitRunner{
+		cfg:     cfg,
+		slog:    slog.Default().With("context", "Await Runner"),
+		pending: newPending(cfg.MaxPending, cfg.Timeout),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Process waits for the callback of the message and applies its payload
+func (r *AwaitRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	id := meta[r.cfg.CorrelationKey]
+	if id == "" {
+		return fmt.Errorf("missing correlation id in metadata key %s", r.cfg.CorrelationKey)
+	}
+
+	ch, err := r.pending.park(id)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	timer := time.NewTimer(r.cfg.Timeout)
+	defer timer.Stop()
+
+	var callback []byte
+	select {
+	case callback = <-ch:
+	case <-timer.C:
+		if !r.pending.release(id, ch) {
+			// The callback arrived with the timeout
+			callback = <-ch
+			break
+		}
+		r.slog.Debug("callback timeout", "id", id)
+		if r.cfg.OnTimeout == onTimeoutContinue {
+			msg.AddMetadata(r.cfg.StatusKey, statusTimeout)
+			return nil
+		}
+		return fmt.Errorf("timeout waiting for the callback of %s after %s", id, r.cfg.Timeout)
+	case <-r.stopCh:
+		r.pending.release(id, ch)
+		return errClosed
+	}
+	r.slog.Debug("callback received", "id", id, "waited", time.Since(start))
+
+	msg.AddMetadata(r.cfg.StatusKey, statusReceived)
+	switch r.cfg.Merge {
+	case mergeObject:
+		merged, err := mergeObjects(data, callback)
+		if err != nil {
+			return err
+		}
+		msg.SetData(merged)
+	case mergeMetadata:
+		msg.AddMetadata(r.cfg.CallbackKey, string(callback))
+	default:
+		msg.SetData(callback)
+	}
+	return nil
+}
+
+// mergeObjects sets the fields of the callback JSON object in the payload JSON object
+func mergeObjects(data, callback []byte) ([]byte, error) {
+	var payload, fields map[string]any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("payload must be a JSON object: %w", err)
+	}
+	if err := json.Unmarshal(callback, &fields); err != nil {
+		return nil, fmt.Errorf("callback must be a JSON object: %w", err)
+	}
+	if payload == nil {
+		payload = make(map[string]any, len(fields))
+	}
+	for k, v := range fields {
+		payload[k] = v
+	}
+	res, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal merged payload: %w", err)
+	}
+	return res, nil
+}
+
+// Close stops the listener and fails the parked messages
+func (r *AwaitRunner) Close() error {
+	r.slog.Info("closing await runner")
+	r.once.Do(func() { close(r.stopCh) })
+	if r.listener == nil {
+		return nil
+	}
+	return r.listener.Close()
+}
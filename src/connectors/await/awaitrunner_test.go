@@ -0,0 +1,359 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	nats "github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// callbackURL returns the callback URL prefix of the HTTP listener
+func callbackURL(r *AwaitRunner) string {
+	return "http://" + r.listener.(*httpListener).listener.Addr().String() + "/callbacks/"
+}
+
+// processAsync processes the message in the background, returning the result channel
+func processAsync(r *AwaitRunner, payload string, meta map[string]string) (*message.RunnerMessage, chan error) {
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(payload), meta))
+	done := make(chan error, 1)
+	go func() { done <- r.Process(msg) }()
+	return msg, done
+}
+
+func postCallback(t *testing.T, url, token, body string) int {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close() //nolint:errcheck
+	return resp.StatusCode
+}
+
+// waitParked waits until the runner parked the message of the id
+func waitParked(t *testing.T, r *AwaitRunner, id string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		r.pending.mu.Lock()
+		_, ok := r.pending.waiters[id]
+		r.pending.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("message %s not parked", id)
+}
+
+func TestAwaitRunnerHTTPCallback(t *testing.T) {
+	cfg := &RunnerConfig{
+		CorrelationKey:  "eb-correlation-id",
+		Timeout:         5 * time.Second,
+		OnTimeout:       onTimeoutFail,
+		Merge:           mergeObject,
+		CallbackKey:     "eb-await-callback",
+		StatusKey:       "eb-await-status",
+		MaxPending:      10,
+		MaxCallbackSize: 1024,
+		Listener:        listenerHTTP,
+		HTTP:            &HTTPListenerConfig{Address: "127.0.0.1:0", Token: "s3cr3t"},
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*AwaitRunner)
+	url := callbackURL(r)
+
+	msg, done := processAsync(r, `{"order":1,"status":"pending"}`, map[string]string{"eb-correlation-id": "abc"})
+	waitParked(t, r, "abc")
+
+	if code := postCallback(t, url+"abc", "wrong", `{}`); code != http.StatusUnauthorized {
+		t.Errorf("unauthorized callback status = %d", code)
+	}
+	if code := postCallback(t, url+"abc", "s3cr3t", `{"status":"approved"}`); code != http.StatusAccepted {
+		t.Fatalf("callback status = %d", code)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	data, _ := msg.GetData()
+	if string(data) != `{"order":1,"status":"approved"}` {
+		t.Errorf("data = %s", data)
+	}
+	meta, _ := msg.GetMetadata()
+	if meta["eb-await-status"] != statusReceived {
+		t.Errorf("status = %q", meta["eb-await-status"])
+	}
+}
+
+func TestAwaitRunnerEarlyCallback(t *testing.T) {
+	cfg := &RunnerConfig{
+		CorrelationKey:  "eb-correlation-id",
+		Timeout:         5 * time.Second,
+		OnTimeout:       onTimeoutFail,
+		Merge:           mergeReplace,
+		CallbackKey:     "eb-await-callback",
+		StatusKey:       "eb-await-status",
+		MaxPending:      10,
+		MaxCallbackSize: 1024,
+		Listener:        listenerHTTP,
+		HTTP:            &HTTPListenerConfig{Address: "127.0.0.1:0", Token: "s3cr3t"},
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*AwaitRunner)
+	url := callbackURL(r)
+
+	// The external system answers before the message reaches the runner
+	if code := postCallback(t, url+"early", "s3cr3t", `{"done":true}`); code != http.StatusAccepted {
+		t.Fatalf("callback status = %d", code)
+	}
+	msg, done := processAsync(r, `{}`, map[string]string{"eb-correlation-id": "early"})
+	if err := <-done; err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if data, _ := msg.GetData(); string(data) != `{"done":true}` {
+		t.Errorf("data = %s", data)
+	}
+}
+
+func TestAwaitRunnerTimeout(t *testing.T) {
+	cfg := &RunnerConfig{
+		CorrelationKey:  "eb-correlation-id",
+		Timeout:         20 * time.Millisecond,
+		OnTimeout:       onTimeoutFail,
+		Merge:           mergeReplace,
+		CallbackKey:     "eb-await-callback",
+		StatusKey:       "eb-await-status",
+		MaxPending:      10,
+		MaxCallbackSize: 1024,
+		Listener:        listenerHTTP,
+		HTTP:            &HTTPListenerConfig{Address: "127.0.0.1:0", Token: "s3cr3t"},
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*AwaitRunner)
+	_, done := processAsync(r, `{}`, map[string]string{"eb-correlation-id": "late"})
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Process() error = %v, want timeout", err)
+	}
+
+	cfg = &RunnerConfig{
+		CorrelationKey:  "eb-correlation-id",
+		Timeout:         20 * time.Millisecond,
+		OnTimeout:       onTimeoutContinue,
+		Merge:           mergeReplace,
+		CallbackKey:     "eb-await-callback",
+		StatusKey:       "eb-await-status",
+		MaxPending:      10,
+		MaxCallbackSize: 1024,
+		Listener:        listenerHTTP,
+		HTTP:            &HTTPListenerConfig{Address: "127.0.0.1:0", Token: "s3cr3t"},
+	}
+	continuing, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = continuing.Close() }()
+	r = continuing.(*AwaitRunner)
+	msg, done := processAsync(r, `{"a":1}`, map[string]string{"eb-correlation-id": "late"})
+	if err := <-done; err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	meta, _ := msg.GetMetadata()
+	data, _ := msg.GetData()
+	if meta["eb-await-status"] != statusTimeout || string(data) != `{"a":1}` {
+		t.Errorf("status = %q, data = %s", meta["eb-await-status"], data)
+	}
+
+	_, done = processAsync(r, `{}`, nil)
+	if err := <-done; err == nil {
+		t.Error("Process() expected error without correlation id")
+	}
+}
+
+func TestAwaitRunnerClose(t *testing.T) {
+	cfg := &RunnerConfig{
+		CorrelationKey:  "eb-correlation-id",
+		Timeout:         5 * time.Second,
+		OnTimeout:       onTimeoutFail,
+		Merge:           mergeReplace,
+		CallbackKey:     "eb-await-callback",
+		StatusKey:       "eb-await-status",
+		MaxPending:      10,
+		MaxCallbackSize: 1024,
+		Listener:        listenerHTTP,
+		HTTP:            &HTTPListenerConfig{Address: "127.0.0.1:0", Token: "s3cr3t"},
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	r := runner.(*AwaitRunner)
+	_, done := processAsync(r, `{}`, map[string]string{"eb-correlation-id": "x"})
+	waitParked(t, r, "x")
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() unexpected error = %v", err)
+	}
+	if err := <-done; !errors.Is(err, errClosed) {
+		t.Errorf("Process() error = %v, want errClosed", err)
+	}
+}
+
+func TestAwaitRunnerNATSCallback(t *testing.T) {
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoSystemAccount: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+	if !srv.ReadyForConnections(2 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+
+	cfg := &RunnerConfig{
+		CorrelationKey:  "eb-correlation-id",
+		Timeout:         5 * time.Second,
+		OnTimeout:       onTimeoutFail,
+		Merge:           mergeMetadata,
+		CallbackKey:     "eb-await-callback",
+		StatusKey:       "eb-await-status",
+		MaxPending:      10,
+		MaxCallbackSize: 1024,
+		Listener:        listenerNATS,
+		NATS:            &NATSListenerConfig{Address: srv.ClientURL(), Subject: "callbacks.*"},
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*AwaitRunner)
+	msg, done := processAsync(r, `{"a":1}`, map[string]string{"eb-correlation-id": "42"})
+	waitParked(t, r, "42")
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	reply, err := nc.Request("callbacks.42", []byte(`{"result":"ok"}`), 2*time.Second)
+	if err != nil || string(reply.Data) != "ok" {
+		t.Fatalf("callback reply = %v, %v", reply, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	meta, _ := msg.GetMetadata()
+	data, _ := msg.GetData()
+	if meta["eb-await-callback"] != `{"result":"ok"}` || string(data) != `{"a":1}` {
+		t.Errorf("metadata = %v, data = %s", meta, data)
+	}
+}
+
+func TestPending(t *testing.T) {
+	p := newPending(2, time.Minute)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	if _, err := p.park("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.park("a"); err == nil {
+		t.Error("park() expected error for a duplicate id")
+	}
+	if delivered, err := p.deliver("b", []byte("early")); delivered || err != nil {
+		t.Errorf("deliver() = %v, %v", delivered, err)
+	}
+	if _, err := p.deliver("c", nil); !errors.Is(err, errTooManyPending) {
+		t.Errorf("deliver() error = %v, want errTooManyPending", err)
+	}
+
+	// Expired early callbacks make room and are not delivered
+	now = now.Add(2 * time.Minute)
+	ch, err := p.park("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-ch:
+		t.Errorf("expired callback delivered: %s", data)
+	default:
+	}
+
+	// A callback delivered with the timeout is not lost
+	if delivered, _ := p.deliver("b", []byte("late")); !delivered {
+		t.Fatal("deliver() expected a waiting message")
+	}
+	if p.release("b", ch) {
+		t.Error("release() = true after the delivery")
+	}
+	if data := <-ch; string(data) != "late" {
+		t.Errorf("data = %s", data)
+	}
+}
+
+func TestHTTPListenerRequests(t *testing.T) {
+	cfg := &RunnerConfig{
+		CorrelationKey:  "eb-correlation-id",
+		Timeout:         5 * time.Second,
+		OnTimeout:       onTimeoutFail,
+		Merge:           mergeReplace,
+		CallbackKey:     "eb-await-callback",
+		StatusKey:       "eb-await-status",
+		MaxPending:      10,
+		MaxCallbackSize: 4,
+		Listener:        listenerHTTP,
+		HTTP:            &HTTPListenerConfig{Address: "127.0.0.1:0", Token: "s3cr3t"},
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*AwaitRunner)
+	url := callbackURL(r)
+	for _, tc := range []struct {
+		method, url string
+		want        int
+	}{
+		{http.MethodGet, url + "a", http.StatusMethodNotAllowed},
+		{http.MethodPost, url, http.StatusNotFound},
+		{http.MethodPost, url + "a/b", http.StatusNotFound},
+		{http.MethodPost, strings.TrimSuffix(url, "callbacks/") + "other/a", http.StatusNotFound},
+	} {
+		req, _ := http.NewRequestWithContext(t.Context(), tc.method, tc.url, nil)
+		req.Header.Set("Authorization", "Bearer s3cr3t")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close() //nolint:errcheck
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s %s status = %d, want %d", tc.method, tc.url, resp.StatusCode, tc.want)
+		}
+	}
+	if code := postCallback(t, url+"a", "s3cr3t", "too large"); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large callback status = %d", code)
+	}
+}
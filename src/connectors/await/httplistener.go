@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+)
+
+const defaultCallbackPath = "/callbacks"
+
+// HTTPListenerConfig defines the HTTP callback listener: the external system sends the
+// callback payload with POST or PUT to <path>/<correlation id>
+type HTTPListenerConfig struct {
+	// Address is the listen address, e.g. "0.0.0.0:8090"
+	Address string `mapstructure:"address" validate:"required"`
+	// Path is the path prefix of the callbacks (default: /callbacks)
+	Path string `mapstructure:"path"`
+	// Token is the bearer token required in the Authorization header (supports env: and file: secrets)
+	Token string `mapstructure:"token"`
+}
+
+type httpListener struct {
+	server   *http.Server
+	listener net.Listener
+	path     string
+	token    string
+	maxSize  int
+	pending  *pending
+	slog     *slog.Logger
+}
+
+func newHTTPListener(cfg *HTTPListenerConfig, maxSize int, p *pending, logger *slog.Logger) (*httpListener, error) {
+	token, err := secrets.Resolve(cfg.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve token: %w", err)
+	}
+	path := strings.TrimRight(cfg.Path, "/")
+	if path == "" {
+		path = defaultCallbackPath
+	}
+	ln, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", cfg.Address, err)
+	}
+
+	l := &httpListener{
+		listener: ln,
+		path:     path + "/",
+		token:    token,
+		maxSize:  maxSize,
+		pending:  p,
+		slog:     logger,
+	}
+	l.server = &http.Server{
+		Handler:           l,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := l.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("callback listener stopped", "error", err)
+		}
+	}()
+	logger.Info("callback listener started", "address", ln.Addr().String(), "path", l.path)
+	return l, nil
+}
+
+// ServeHTTP accepts the callbacks: 202 when handed to the message or kept for it
+func (l *httpListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := strings.CutPrefix(r.URL.Path, l.path)
+	if !ok || id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if l.token != "" {
+		auth, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte(l.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(l.maxSize)))
+	if err != nil {
+		http.Error(w, "callback too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if _, err := l.pending.deliver(id, data); err != nil {
+		l.slog.Warn("callback rejected", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (l *httpListener) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return l.server.Shutdown(ctx)
+}
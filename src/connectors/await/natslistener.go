@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+)
+
+// NATSListenerConfig defines the NATS callback listener: the correlation id is the last
+// token of the subject of the callback messages
+type NATSListenerConfig struct {
+	// Address is the NATS server address, e.g. "nats://localhost:4222"
+	Address string `mapstructure:"address" validate:"required"`
+	// Subject is the subscribed subject, e.g. "callbacks.*"
+	Subject string `mapstructure:"subject" validate:"required"`
+	// Token is the authentication token (supports env: and file: secrets)
+	Token string `mapstructure:"token"`
+}
+
+type natsListener struct {
+	conn *nats.Conn
+	sub  *nats.Subscription
+}
+
+func newNATSListener(cfg *NATSListenerConfig, maxSize int, p *pending, logger *slog.Logger) (*natsListener, error) {
+	opts := []nats.Option{nats.Name("events-bridge-await")}
+	if cfg.Token != "" {
+		token, err := secrets.Resolve(cfg.Token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve token: %w", err)
+		}
+		opts = append(opts, nats.Token(token))
+	}
+	conn, err := nats.Connect(cfg.Address, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	sub, err := conn.Subscribe(cfg.Subject, func(m *nats.Msg) {
+		id := m.Subject[strings.LastIndex(m.Subject, ".")+1:]
+		var err error
+		if len(m.Data) > maxSize {
+			err = fmt.Errorf("callback size %d exceeds maximum %d", len(m.Data), maxSize)
+		} else {
+			_, err = p.deliver(id, m.Data)
+		}
+		if err != nil {
+			logger.Warn("callback rejected", "id", id, "error", err)
+		}
+		if m.Reply != "" {
+			reply := "ok"
+			if err != nil {
+				reply = err.Error()
+			}
+			if rErr := m.Respond([]byte(reply)); rErr != nil {
+				logger.Warn("failed to reply to callback", "id", id, "error", rErr)
+			}
+		}
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", cfg.Subject, err)
+	}
+	logger.Info("callback listener started", "address", cfg.Address, "subject", cfg.Subject)
+	return &natsListener{conn: conn, sub: sub}, nil
+}
+
+func (l *natsListener) Close() error {
+	if err := l.sub.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+		l.conn.Close()
+		return err
+	}
+	l.conn.Close()
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errTooManyPending is returned when MaxPending is reached
+var errTooManyPending = errors.New("too many pending callbacks")
+
+// earlyCallback is a callback received before its message was parked
+type earlyCallback struct {
+	data    []byte
+	expires time.Time
+}
+
+// pending correlates the parked messages with the callbacks. A callback can arrive before
+// its message is parked, e.g. when the external system answers before the previous runners
+// complete: it is kept for the timeout and handed to the message when it is parked.
+type pending struct {
+	mu      sync.Mutex
+	waiters map[string]chan []byte
+	early   map[string]earlyCallback
+	max     int
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+func newPending(max int, ttl time.Duration) *pending {
+	return &pending{
+		waiters: make(map[string]chan []byte),
+		early:   make(map[string]earlyCallback),
+		max:     max,
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// park registers a message waiting for the callback of the id. The callback is sent on the
+// returned channel, immediately when it was received before.
+func (p *pending) park(id string) (chan []byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch := make(chan []byte, 1)
+	if cb, ok := p.early[id]; ok {
+		delete(p.early, id)
+		if p.now().Before(cb.expires) {
+			ch <- cb.data
+			return ch, nil
+		}
+	}
+	if _, ok := p.waiters[id]; ok {
+		return nil, fmt.Errorf("a message is already waiting for the callback of %s", id)
+	}
+	if !p.hasRoom() {
+		return nil, errTooManyPending
+	}
+	p.waiters[id] = ch
+	return ch, nil
+}
+
+// release removes the message of the id, e.g. on timeout. It returns false when the
+// callback was delivered in the meantime.
+func (p *pending) release(id string, ch chan []byte) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.waiters[id] != ch {
+		return false
+	}
+	delete(p.waiters, id)
+	return true
+}
+
+// deliver hands the callback to the message of the id, or keeps it until the message is
+// parked. It returns true when a message was waiting.
+func (p *pending) deliver(id string, data []byte) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ch, ok := p.waiters[id]; ok {
+		delete(p.waiters, id)
+		ch <- data
+		return true, nil
+	}
+	if _, ok := p.early[id]; !ok && !p.hasRoom() {
+		return false, errTooManyPending
+	}
+	p.early[id] = earlyCallback{data: data, expires: p.now().Add(p.ttl)}
+	return false, nil
+}
+
+// hasRoom reports whether a message or callback can be added, dropping the expired
+// early callbacks when the limit is reached
+func (p *pending) hasRoom() bool {
+	if len(p.waiters)+len(p.early) < p.max {
+		return true
+	}
+	now := p.now()
+	for id, cb := range p.early {
+		if !now.Before(cb.expires) {
+			delete(p.early, id)
+		}
+	}
+	return len(p.waiters)+len(p.early) < p.max
+}
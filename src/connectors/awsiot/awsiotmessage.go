@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &AWSIoTMessage{}
+
+type AWSIoTMessage struct {
+	id       uint16
+	data     []byte
+	metadata map[string]string
+	done     chan message.ResponseStatus
+}
+
+func (m *AWSIoTMessage) GetID() []byte {
+	return []byte(strconv.Itoa(int(m.id)))
+}
+
+func (m *AWSIoTMessage) GetMetadata() (map[string]string, error) {
+	return m.metadata, nil
+}
+
+func (m *AWSIoTMessage) GetData() ([]byte, error) {
+	return m.data, nil
+}
+
+func (m *AWSIoTMessage) Ack(*message.ReplyData) error {
+	message.SendResponseStatus(m.done, message.ResponseStatusAck)
+	return nil
+}
+
+func (m *AWSIoTMessage) Nak() error {
+	message.SendResponseStatus(m.done, message.ResponseStatusNak)
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	modePublish = "publish"
+	modeShadow  = "shadow"
+
+	// devicePlaceholder is replaced by the thing name in the publish topic
+	devicePlaceholder = "{device}"
+)
+
+// Responses of the shadow updates of every thing
+var shadowResponseTopics = []string{
+	"$aws/things/+/shadow/update/accepted",
+	"$aws/things/+/shadow/update/rejected",
+	"$aws/things/+/shadow/name/+/update/accepted",
+	"$aws/things/+/shadow/name/+/update/rejected",
+}
+
+type RunnerConfig struct {
+	ConnectionConfig `mapstructure:",squash"`
+	// Mode is "publish" (cloud-to-device message on a topic) or "shadow" (update of the desired
+	// state of the device shadow with the JSON payload, confirmed by AWS IoT Core)
+	Mode string `mapstructure:"mode" default:"publish" validate:"oneof=publish shadow"`
+	// Topic is the publish topic; "{device}" is replaced by the thing name
+	Topic string `mapstructure:"topic" validate:"required_if=Mode publish"`
+	// TopicFromMetadataKey is the metadata key overriding the publish topic
+	TopicFromMetadataKey string `mapstructure:"topicFromMetadataKey"`
+	// Device is the thing name used when the message has none
+	Device string `mapstructure:"device"`
+	// DeviceFromMetadataKey is the metadata key holding the thing name
+	DeviceFromMetadataKey string `mapstructure:"deviceFromMetadataKey" default:"eb-iot-device"`
+	// Shadow is the named shadow to update (empty = classic shadow)
+	Shadow string `mapstructure:"shadow"`
+	// ShadowFromMetadataKey is the metadata key overriding the named shadow
+	ShadowFromMetadataKey string `mapstructure:"shadowFromMetadataKey"`
+	// Retained publishes retained messages
+	Retained bool `mapstructure:"retained"`
+	// Timeout bounds the publication and the shadow update response
+	Timeout time.Duration `mapstructure:"timeout" default:"10s" validate:"gt=0"`
+}
+
+type AWSIoTRunner struct {
+	cfg    *RunnerConfig
+	slog   *slog.Logger
+	client mqtt.Client
+
+	mu      sync.Mutex
+	pending map[string]chan shadowResponse
+}
+
+// shadowResponse is the accepted or rejected response of a shadow update
+type shadowResponse struct {
+	accepted    bool
+	Version     int64  `json:"version"`
+	ClientToken string `json:"clientToken"`
+	Code        int    `json:"code"`
+	Message     string `json:"message"`
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates the AWS IoT Core target
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	r := &AWSIoTRunner{
+		cfg:     cfg,
+		slog:    slog.Default().With("context", "AWS IoT Runner"),
+		pending: make(map[string]chan shadowResponse),
+	}
+	client, err := connect(&cfg.ConnectionConfig, r.slog, func(c mqtt.Client) {
+		if cfg.Mode != modeShadow {
+			return
+		}
+		filters := make(map[string]byte, len(shadowResponseTopics))
+		for _, topic := range shadowResponseTopics {
+			filters[topic] = cfg.qos()
+		}
+		if token := c.SubscribeMultiple(filters, r.handleShadowResponse); token.Wait() && token.Error() != nil {
+			r.slog.Error("failed to subscribe to the shadow responses", "error", token.Error())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.client = client
+	return r, nil
+}
+
+func (r *AWSIoTRunner) Process(msg *message.RunnerMessage) error {
+	data, err := msg.GetData()
+	if err != nil {
+		return fmt.Errorf("failed to get data: %w", err)
+	}
+	device := message.ResolveFromMetadata(msg, r.cfg.DeviceFromMetadataKey, r.cfg.Device)
+
+	if r.cfg.Mode == modeShadow {
+		if device == "" {
+			return errors.New("missing device for the shadow update")
+		}
+		shadow := message.ResolveFromMetadata(msg, r.cfg.ShadowFromMetadataKey, r.cfg.Shadow)
+		version, err := r.updateShadow(device, shadow, data)
+		if err != nil {
+			return err
+		}
+		msg.AddMetadata(metaShadowVersion, strconv.FormatInt(version, 10))
+		return nil
+	}
+
+	topic := message.ResolveFromMetadata(msg, r.cfg.TopicFromMetadataKey, r.cfg.Topic)
+	if strings.Contains(topic, devicePlaceholder) {
+		if device == "" {
+			return fmt.Errorf("missing device for topic %s", topic)
+		}
+		topic = strings.ReplaceAll(topic, devicePlaceholder, device)
+	}
+	return r.publish(topic, data, r.cfg.Retained)
+}
+
+func (r *AWSIoTRunner) publish(topic string, data []byte, retained bool) error {
+	token := r.client.Publish(topic, r.cfg.qos(), retained, data)
+	if !token.WaitTimeout(r.cfg.Timeout) {
+		return fmt.Errorf("timeout publishing to %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// updateShadow sets the desired state of the shadow and waits for its response,
+// returning the version of the updated document
+func (r *AWSIoTRunner) updateShadow(device, shadow string, desired []byte) (int64, error) {
+	var state map[string]any
+	if err := json.Unmarshal(desired, &state); err != nil {
+		return 0, fmt.Errorf("desired state must be a JSON object: %w", err)
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return 0, fmt.Errorf("failed to generate client token: %w", err)
+	}
+	clientToken := hex.EncodeToString(b)
+	payload, err := json.Marshal(map[string]any{
+		"state":       map[string]any{"desired": state},
+		"clientToken": clientToken,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	res := make(chan shadowResponse, 1)
+	r.mu.Lock()
+	r.pending[clientToken] = res
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, clientToken)
+		r.mu.Unlock()
+	}()
+
+	deadline := time.NewTimer(r.cfg.Timeout)
+	defer deadline.Stop()
+	if err := r.publish(shadowTopic(device, shadow, "update"), payload, false); err != nil {
+		return 0, err
+	}
+	select {
+	case resp := <-res:
+		if !resp.accepted {
+			return 0, fmt.Errorf("shadow update of %s rejected: %d %s", device, resp.Code, resp.Message)
+		}
+		return resp.Version, nil
+	case <-deadline.C:
+		return 0, fmt.Errorf("timeout waiting for the shadow update response of %s", device)
+	}
+}
+
+// handleShadowResponse delivers the shadow update responses to the pending updates
+func (r *AWSIoTRunner) handleShadowResponse(_ mqtt.Client, msg mqtt.Message) {
+	var resp shadowResponse
+	if err := json.Unmarshal(msg.Payload(), &resp); err != nil {
+		r.slog.Warn("invalid shadow response", "topic", msg.Topic(), "error", err)
+		return
+	}
+	resp.accepted = strings.HasSuffix(msg.Topic(), "/accepted")
+	r.mu.Lock()
+	res, ok := r.pending[resp.ClientToken]
+	r.mu.Unlock()
+	if ok {
+		select {
+		case res <- resp:
+		default:
+		}
+	}
+}
+
+// shadowTopic returns the topic of a shadow operation
+func shadowTopic(device, shadow, operation string) string {
+	if shadow == "" {
+		return "$aws/things/" + device + "/shadow/" + operation
+	}
+	return "$aws/things/" + device + "/shadow/name/" + shadow + "/" + operation
+}
+
+func (r *AWSIoTRunner) Close() error {
+	if r.client != nil && r.client.IsConnected() {
+		r.client.Disconnect(250)
+	}
+	return nil
+}
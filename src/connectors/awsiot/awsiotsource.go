@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Shadow update documents of the classic and named shadows of every thing
+var shadowTopics = []string{
+	"$aws/things/+/shadow/update/documents",
+	"$aws/things/+/shadow/name/+/update/documents",
+}
+
+type SourceConfig struct {
+	ConnectionConfig `mapstructure:",squash"`
+	// Topics are the topic filters of the device-to-cloud messages (e.g. "devices/+/telemetry")
+	Topics []string `mapstructure:"topics" validate:"dive,required"`
+	// DeviceLevel is the 1-based level of the message topics holding the thing name (0 = none)
+	DeviceLevel int `mapstructure:"deviceLevel" validate:"min=0"`
+	// Shadows also produces the update documents (previous and current state) of the device shadows
+	Shadows bool `mapstructure:"shadows"`
+	// MessageTimeout is the maximum time to wait for the message Ack/Nak
+	MessageTimeout time.Duration `mapstructure:"messageTimeout" default:"10s" validate:"gt=0"`
+}
+
+type AWSIoTSource struct {
+	cfg    *SourceConfig
+	slog   *slog.Logger
+	c      chan *message.RunnerMessage
+	client mqtt.Client
+}
+
+func NewSourceConfig() any {
+	return new(SourceConfig)
+}
+
+// NewSource creates the AWS IoT Core source
+func NewSource(anyCfg any) (connectors.Source, error) {
+	cfg, ok := anyCfg.(*SourceConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	if len(cfg.Topics) == 0 && !cfg.Shadows {
+		return nil, errors.New("at least one of topics or shadows is required")
+	}
+	return &AWSIoTSource{
+		cfg:  cfg,
+		slog: slog.Default().With("context", "AWS IoT Source"),
+	}, nil
+}
+
+func (s *AWSIoTSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	s.c = make(chan *message.RunnerMessage, buffer)
+
+	s.slog.Info("starting AWS IoT Core source",
+		"endpoint", s.cfg.Endpoint,
+		"region", s.cfg.Region,
+		"topics", s.cfg.Topics,
+		"shadows", s.cfg.Shadows,
+	)
+
+	filters := make(map[string]byte)
+	for _, topic := range s.cfg.Topics {
+		filters[topic] = s.cfg.qos()
+	}
+	if s.cfg.Shadows {
+		for _, topic := range shadowTopics {
+			filters[topic] = s.cfg.qos()
+		}
+	}
+
+	// Subscriptions are renewed on every connection, as clean sessions forget them
+	client, err := connect(&s.cfg.ConnectionConfig, s.slog, func(c mqtt.Client) {
+		if token := c.SubscribeMultiple(filters, s.handle); token.Wait() && token.Error() != nil {
+			s.slog.Error("failed to subscribe", "error", token.Error())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.client = client
+	return s.c, nil
+}
+
+// handle maps a received publication to a message, waiting for its Ack/Nak before the
+// publication is acknowledged to AWS IoT Core
+func (s *AWSIoTSource) handle(_ mqtt.Client, msg mqtt.Message) {
+	metadata := map[string]string{"topic": msg.Topic()}
+	if thing, shadow, ok := parseShadowTopic(msg.Topic()); ok {
+		metadata[metaEvent] = eventShadow
+		metadata[metaDevice] = thing
+		if shadow != "" {
+			metadata[metaShadow] = shadow
+		}
+		var doc struct {
+			Current struct {
+				Version *int64 `json:"version"`
+			} `json:"current"`
+		}
+		if err := json.Unmarshal(msg.Payload(), &doc); err == nil && doc.Current.Version != nil {
+			metadata[metaShadowVersion] = strconv.FormatInt(*doc.Current.Version, 10)
+		}
+	} else {
+		metadata[metaEvent] = eventMessage
+		if thing := topicLevel(msg.Topic(), s.cfg.DeviceLevel); thing != "" {
+			metadata[metaDevice] = thing
+		}
+	}
+
+	done := make(chan message.ResponseStatus, 1)
+	s.c <- message.NewRunnerMessage(&AWSIoTMessage{
+		id:       msg.MessageID(),
+		data:     msg.Payload(),
+		metadata: metadata,
+		done:     done,
+	})
+	select {
+	case <-done:
+	case <-time.After(s.cfg.MessageTimeout):
+		s.slog.Warn("timeout waiting for message processing", "topic", msg.Topic())
+	}
+}
+
+// parseShadowTopic returns the thing and shadow name (empty for the classic shadow)
+// of a shadow update documents topic
+func parseShadowTopic(topic string) (thing, shadow string, ok bool) {
+	levels := strings.Split(topic, "/")
+	switch {
+	case len(levels) == 6 && levels[0] == "$aws" && levels[1] == "things" && levels[3] == "shadow" &&
+		levels[4] == "update" && levels[5] == "documents":
+		return levels[2], "", true
+	case len(levels) == 8 && levels[0] == "$aws" && levels[1] == "things" && levels[3] == "shadow" &&
+		levels[4] == "name" && levels[6] == "update" && levels[7] == "documents":
+		return levels[2], levels[5], true
+	}
+	return "", "", false
+}
+
+// topicLevel returns the 1-based level of the topic, if any
+func topicLevel(topic string, level int) string {
+	if level <= 0 {
+		return ""
+	}
+	levels := strings.Split(topic, "/")
+	if level > len(levels) {
+		return ""
+	}
+	return levels[level-1]
+}
+
+func (s *AWSIoTSource) Close() error {
+	if s.client != nil && s.client.IsConnected() {
+		s.client.Disconnect(250)
+	}
+	return nil
+}
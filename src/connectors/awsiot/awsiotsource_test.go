@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+func receive(t *testing.T, c <-chan *message.RunnerMessage) *message.RunnerMessage {
+	t.Helper()
+	select {
+	case msg := <-c:
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+	return nil
+}
+
+func TestAWSIoTSourceMessagesAndShadows(t *testing.T) {
+	endpoint, server := startBroker(t)
+	cfg := parseConfig[SourceConfig](t, withOptions(testConnection(endpoint, "source"), map[string]any{
+		"topics":      []string{"devices/+/telemetry"},
+		"deviceLevel": 2,
+		"shadows":     true,
+	}))
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close() //nolint:errcheck
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := server.Publish("devices/sensor-1/telemetry", []byte(`{"t":21.5}`), false, 1); err != nil {
+		t.Fatal(err)
+	}
+	msg := receive(t, c)
+	data, _ := msg.GetData()
+	meta, _ := msg.GetMetadata()
+	if string(data) != `{"t":21.5}` || meta[metaDevice] != "sensor-1" || meta[metaEvent] != eventMessage || meta["topic"] != "devices/sensor-1/telemetry" {
+		t.Errorf("message = %s %v", data, meta)
+	}
+	if err := msg.Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := `{"previous":null,"current":{"state":{"desired":{"on":true}},"version":7}}`
+	if err := server.Publish("$aws/things/lamp/shadow/name/config/update/documents", []byte(doc), false, 1); err != nil {
+		t.Fatal(err)
+	}
+	msg = receive(t, c)
+	meta, _ = msg.GetMetadata()
+	if meta[metaEvent] != eventShadow || meta[metaDevice] != "lamp" || meta[metaShadow] != "config" || meta[metaShadowVersion] != "7" {
+		t.Errorf("shadow metadata = %v", meta)
+	}
+	if err := msg.Nak(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseShadowTopic(t *testing.T) {
+	tests := []struct {
+		topic, thing, shadow string
+		ok                   bool
+	}{
+		{"$aws/things/t1/shadow/update/documents", "t1", "", true},
+		{"$aws/things/t1/shadow/name/s1/update/documents", "t1", "s1", true},
+		{"$aws/things/t1/shadow/update/accepted", "", "", false},
+		{"devices/t1/telemetry", "", "", false},
+	}
+	for _, tt := range tests {
+		thing, shadow, ok := parseShadowTopic(tt.topic)
+		if thing != tt.thing || shadow != tt.shadow || ok != tt.ok {
+			t.Errorf("parseShadowTopic(%q) = %q, %q, %v", tt.topic, thing, shadow, ok)
+		}
+	}
+	if got := topicLevel("a/b/c", 2); got != "b" {
+		t.Errorf("topicLevel() = %q", got)
+	}
+	if got := topicLevel("a/b", 3); got != "" {
+		t.Errorf("topicLevel() beyond the topic = %q", got)
+	}
+}
+
+func TestAWSIoTSourceConfig(t *testing.T) {
+	cfg := parseConfig[SourceConfig](t, testConnection("abc-ats.iot.eu-west-1.amazonaws.com", ""))
+	if _, err := NewSource(cfg); err == nil {
+		t.Error("NewSource() expected error without topics and shadows")
+	}
+	if u, err := cfg.endpointURL(); err != nil || u.String() != "wss://abc-ats.iot.eu-west-1.amazonaws.com/mqtt" {
+		t.Errorf("endpointURL() = %v, %v", u, err)
+	}
+	cfg.Endpoint = "https://abc-ats.iot.eu-west-1.amazonaws.com"
+	if _, err := cfg.endpointURL(); err == nil {
+		t.Error("endpointURL() expected error for https scheme")
+	}
+	if cfg.QoS != 1 || cfg.KeepAlive != time.Minute {
+		t.Errorf("defaults = %+v", cfg.ConnectionConfig)
+	}
+}
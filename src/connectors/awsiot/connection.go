@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sandrolain/events-bridge/src/common/awssign"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+)
+
+const (
+	// metaDevice is the metadata key of the thing name
+	metaDevice = "eb-iot-device"
+	// metaEvent is the metadata key of the event kind: "message" or "shadow"
+	metaEvent = "eb-iot-event"
+	// metaShadow is the metadata key of the named shadow
+	metaShadow = "eb-iot-shadow"
+	// metaShadowVersion is the metadata key of the shadow document version
+	metaShadowVersion = "eb-iot-shadow-version"
+
+	// iotService is the signing name of the AWS IoT Core data endpoint
+	iotService = "iotdevicegateway"
+
+	eventMessage = "message"
+	eventShadow  = "shadow"
+
+	// urlValidity is the validity of the presigned URLs, signed again on every connection
+	urlValidity = 5 * time.Minute
+)
+
+// ConnectionConfig is the connection to the AWS IoT Core data endpoint shared by the source and the target
+type ConnectionConfig struct {
+	// Endpoint is the data endpoint of the account (e.g. "abc123-ats.iot.eu-west-1.amazonaws.com"),
+	// or a ws/wss URL of the MQTT path
+	Endpoint string `mapstructure:"endpoint" validate:"required"`
+	// Region is the AWS region of the endpoint
+	Region string `mapstructure:"region" validate:"required"`
+	// AccessKeyID is the access key of the IAM credentials; supports secret references (env:, file:)
+	AccessKeyID string `mapstructure:"accessKeyId" validate:"required"`
+	// SecretAccessKey is the secret key of the IAM credentials; supports secret references (env:, file:)
+	SecretAccessKey string `mapstructure:"secretAccessKey" validate:"required"` //nolint:gosec // user-configured credential field
+	// SessionToken is the token of temporary credentials; supports secret references (env:, file:)
+	SessionToken string `mapstructure:"sessionToken"` //nolint:gosec // user-configured credential field
+	// ClientID is the MQTT client identifier, allowed by the IoT policy of the credentials.
+	// If empty, a random ID is generated.
+	ClientID string `mapstructure:"clientId"`
+	// QoS is the MQTT quality of service, 0 or 1 (AWS IoT Core does not support QoS 2)
+	QoS int `mapstructure:"qos" default:"1" validate:"min=0,max=1"`
+	// CleanSession discards the previous session of the client on connection
+	CleanSession bool `mapstructure:"cleanSession" default:"true"`
+	// KeepAlive is the MQTT keep alive interval (AWS IoT Core allows 30s to 1200s)
+	KeepAlive time.Duration `mapstructure:"keepAlive" default:"60s" validate:"gt=0"`
+	// ConnectTimeout bounds the WebSocket handshake and the MQTT connection
+	ConnectTimeout time.Duration `mapstructure:"connectTimeout" default:"10s" validate:"gt=0"`
+	// TLS configures the certificates of the TLS connection
+	TLS *tlsconfig.Config `mapstructure:"tls"`
+}
+
+// endpointURL returns the WebSocket URL of the MQTT endpoint
+func (c *ConnectionConfig) endpointURL() (*url.URL, error) {
+	endpoint := c.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "wss://" + endpoint + "/mqtt"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	if u.Scheme != "wss" && u.Scheme != "ws" {
+		return nil, fmt.Errorf("invalid endpoint scheme %q, must be wss or ws", u.Scheme)
+	}
+	return u, nil
+}
+
+// credentials resolves the IAM credentials
+func (c *ConnectionConfig) credentials() (awssign.Credentials, error) {
+	var creds awssign.Credentials
+	var err error
+	if creds.AccessKeyID, err = secrets.Resolve(c.AccessKeyID); err != nil {
+		return creds, fmt.Errorf("failed to resolve access key id: %w", err)
+	}
+	if creds.SecretAccessKey, err = secrets.Resolve(c.SecretAccessKey); err != nil {
+		return creds, fmt.Errorf("failed to resolve secret access key: %w", err)
+	}
+	if creds.SessionToken, err = secrets.Resolve(c.SessionToken); err != nil {
+		return creds, fmt.Errorf("failed to resolve session token: %w", err)
+	}
+	return creds, nil
+}
+
+// connect connects an MQTT client over WebSocket, signing the URL of every connection attempt
+// with Signature Version 4. onConnect is called on every (re)connection, e.g. to subscribe.
+func connect(cfg *ConnectionConfig, logger *slog.Logger, onConnect mqtt.OnConnectHandler) (mqtt.Client, error) {
+	endpoint, err := cfg.endpointURL()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := cfg.credentials()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate random client ID: %w", err)
+		}
+		clientID = "events-bridge-" + hex.EncodeToString(b)
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(endpoint.String()).
+		SetClientID(clientID).
+		SetCleanSession(cfg.CleanSession).
+		SetKeepAlive(cfg.KeepAlive).
+		SetConnectTimeout(cfg.ConnectTimeout).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(2 * time.Second).
+		SetOnConnectHandler(onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Warn("connection to AWS IoT Core lost", "error", err)
+		}).
+		SetCustomOpenConnectionFn(func(*url.URL, mqtt.ClientOptions) (net.Conn, error) {
+			signed := awssign.Presign(endpoint, creds, awssign.PresignOptions{
+				Method:            "GET",
+				Service:           iotService,
+				Region:            cfg.Region,
+				Expires:           urlValidity,
+				PayloadHash:       awssign.EmptyPayloadHash,
+				TokenAfterSigning: true,
+			}, time.Now())
+			return mqtt.NewWebsocket(signed.String(), tlsConfig, cfg.ConnectTimeout, nil, nil)
+		})
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(cfg.ConnectTimeout) {
+		client.Disconnect(0)
+		return nil, fmt.Errorf("timeout connecting to AWS IoT Core")
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to AWS IoT Core: %w", err)
+	}
+	return client, nil
+}
+
+// qos returns the validated QoS
+func (c *ConnectionConfig) qos() byte {
+	return byte(c.QoS) //nolint:gosec // QoS is validated to 0-1 range
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &AzureIoTMessage{}
+
+type AzureIoTMessage struct {
+	id       []byte
+	data     []byte
+	metadata map[string]string
+	done     chan message.ResponseStatus
+}
+
+func (m *AzureIoTMessage) GetID() []byte {
+	return m.id
+}
+
+func (m *AzureIoTMessage) GetMetadata() (map[string]string, error) {
+	return m.metadata, nil
+}
+
+func (m *AzureIoTMessage) GetData() ([]byte, error) {
+	return m.data, nil
+}
+
+func (m *AzureIoTMessage) Ack(*message.ReplyData) error {
+	message.SendResponseStatus(m.done, message.ResponseStatusAck)
+	return nil
+}
+
+func (m *AzureIoTMessage) Nak() error {
+	message.SendResponseStatus(m.done, message.ResponseStatusNak)
+	return nil
+}
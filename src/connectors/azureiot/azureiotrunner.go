@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/amqp10"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	modeC2D    = "c2d"
+	modeMethod = "method"
+
+	// c2dNode is the service endpoint of the cloud-to-device messages
+	c2dNode = "/messages/devicebound"
+	// methodsAPIVersion is the API version of the direct methods REST API
+	methodsAPIVersion = "2021-04-12"
+)
+
+type RunnerConfig struct {
+	ConnectionConfig `mapstructure:",squash"`
+	// Mode is "c2d" (cloud-to-device message, confirmed by IoT Hub) or "method" (direct
+	// method invocation, whose response replaces the message data)
+	Mode string `mapstructure:"mode" default:"c2d" validate:"oneof=c2d method"`
+	// Device is the device id used when the message has none
+	Device string `mapstructure:"device"`
+	// DeviceFromMetadataKey is the metadata key holding the device id
+	DeviceFromMetadataKey string `mapstructure:"deviceFromMetadataKey" default:"eb-iot-device"`
+	// Module is the module id of the direct methods (empty = device method)
+	Module string `mapstructure:"module"`
+	// ModuleFromMetadataKey is the metadata key overriding the module id
+	ModuleFromMetadataKey string `mapstructure:"moduleFromMetadataKey"`
+	// Method is the name of the direct method
+	Method string `mapstructure:"method" validate:"required_if=Mode method"`
+	// MethodFromMetadataKey is the metadata key overriding the method name
+	MethodFromMetadataKey string `mapstructure:"methodFromMetadataKey"`
+	// MethodTimeout is the time the device has to answer the direct method
+	MethodTimeout time.Duration `mapstructure:"methodTimeout" default:"30s" validate:"min=5s,max=300s"`
+	// ServiceURL overrides the base URL of the service REST API (default: https:// and the host)
+	ServiceURL string `mapstructure:"serviceUrl" validate:"omitempty,url"`
+	// Timeout bounds the delivery of the cloud-to-device messages
+	Timeout time.Duration `mapstructure:"timeout" default:"10s" validate:"gt=0"`
+}
+
+type AzureIoTRunner struct {
+	cfg  *RunnerConfig
+	cs   *connectionString
+	slog *slog.Logger
+	http *http.Client
+
+	mu     sync.Mutex
+	conn   *amqp10.Conn
+	sender *amqp10.Link
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates the Azure IoT Hub target
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	cs, err := cfg.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if cs.isEventHub() {
+		return nil, errors.New("the target requires an IoT Hub connection string of a policy with the service connect permission")
+	}
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	r := &AzureIoTRunner{
+		cfg:  cfg,
+		cs:   cs,
+		slog: slog.Default().With("context", "Azure IoT Runner"),
+		http: &http.Client{
+			Timeout:   cfg.MethodTimeout + cfg.Timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+	if cfg.Mode == modeC2D {
+		if _, err := r.c2dSender(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *AzureIoTRunner) Process(msg *message.RunnerMessage) error {
+	data, err := msg.GetData()
+	if err != nil {
+		return fmt.Errorf("failed to get data: %w", err)
+	}
+	device := message.ResolveFromMetadata(msg, r.cfg.DeviceFromMetadataKey, r.cfg.Device)
+	if device == "" {
+		return errors.New("missing device id")
+	}
+
+	if r.cfg.Mode == modeMethod {
+		module := message.ResolveFromMetadata(msg, r.cfg.ModuleFromMetadataKey, r.cfg.Module)
+		method := message.ResolveFromMetadata(msg, r.cfg.MethodFromMetadataKey, r.cfg.Method)
+		status, payload, err := r.invoke(device, module, method, data)
+		if err != nil {
+			return err
+		}
+		msg.AddMetadata(metaMethodStatus, strconv.Itoa(status))
+		msg.SetData(payload)
+		return nil
+	}
+	return r.sendC2D(device, msg, data)
+}
+
+// c2dSender returns the sender link of the cloud-to-device messages, connecting again
+// when the connection was lost
+func (r *AzureIoTRunner) c2dSender() (*amqp10.Link, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sender != nil {
+		select {
+		case <-r.sender.Detached():
+		default:
+			return r.sender, nil
+		}
+	}
+	if r.conn != nil {
+		_ = r.conn.Close()
+		r.conn, r.sender = nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.ConnectTimeout)
+	defer cancel()
+	conn, err := r.cfg.dial(ctx, r.cs, r.slog)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := conn.AttachSender(ctx, amqp10.LinkOptions{Target: c2dNode})
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to attach to %s: %w", c2dNode, err)
+	}
+	r.conn, r.sender = conn, sender
+	return sender, nil
+}
+
+// sendC2D sends a cloud-to-device message with the string metadata as application properties
+func (r *AzureIoTRunner) sendC2D(device string, msg *message.RunnerMessage, data []byte) error {
+	sender, err := r.c2dSender()
+	if err != nil {
+		return err
+	}
+	metadata, err := msg.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata: %w", err)
+	}
+	properties := make(map[string]any, len(metadata))
+	for k, v := range metadata {
+		// Keys of the bridge and of IoT Hub are reserved
+		if !strings.HasPrefix(k, "eb-") && !strings.HasPrefix(k, "iothub-") {
+			properties[k] = v
+		}
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Errorf("failed to generate message id: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+	err = sender.Send(ctx, &amqp10.Message{
+		MessageID:  hex.EncodeToString(id),
+		To:         "/devices/" + device + c2dNode,
+		Properties: properties,
+		Data:       data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send the message to %s: %w", device, err)
+	}
+	return nil
+}
+
+// invoke calls a direct method, returning the status and the payload of the device response
+func (r *AzureIoTRunner) invoke(device, module, method string, data []byte) (int, []byte, error) {
+	if method == "" {
+		return 0, nil, errors.New("missing direct method name")
+	}
+	payload := json.RawMessage(data)
+	if !json.Valid(data) {
+		// Non-JSON payloads are sent as a JSON string
+		payload, _ = json.Marshal(string(data))
+	}
+	body, err := json.Marshal(map[string]any{
+		"methodName":               method,
+		"responseTimeoutInSeconds": int(r.cfg.MethodTimeout.Seconds()),
+		"payload":                  payload,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	base := r.cfg.ServiceURL
+	if base == "" {
+		base = "https://" + r.cs.Host
+	}
+	path := "/twins/" + url.PathEscape(device)
+	if module != "" {
+		path += "/modules/" + url.PathEscape(module)
+	}
+	endpoint := strings.TrimSuffix(base, "/") + path + "/methods?api-version=" + methodsAPIVersion
+
+	token, err := sasToken(r.cs.Host, r.cs.KeyName, r.cs.Key, time.Now().Add(tokenValidity))
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := r.http.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to invoke %s on %s: %w", method, device, err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read the response of %s: %w", method, err)
+	}
+	if res.StatusCode > 299 {
+		return 0, nil, fmt.Errorf("direct method %s on %s failed: %d %s", method, device, res.StatusCode, bytes.TrimSpace(resBody))
+	}
+	var result struct {
+		Status  int             `json:"status"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return 0, nil, fmt.Errorf("invalid response of %s: %w", method, err)
+	}
+	return result.Status, result.Payload, nil
+}
+
+func (r *AzureIoTRunner) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn != nil {
+		_ = r.conn.Close()
+		r.conn, r.sender = nil, nil
+	}
+	r.http.CloseIdleConnections()
+	return nil
+}
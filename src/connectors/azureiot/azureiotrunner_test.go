@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func TestAzureIoTRunnerC2D(t *testing.T) {
+	hub := startHub(t)
+	cfg := parseConfig[RunnerConfig](t, testConnection(hub, testIoTHubString))
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close() //nolint:errcheck
+	if login := hub.login(); len(login) == 0 || !strings.HasPrefix(login[0], "service@sas.root.testhub\x00SharedAccessSignature sr=testhub.azure-devices.net&") {
+		t.Errorf("SASL login = %q", login)
+	}
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"on":true}`), map[string]string{metaDevice: "lamp", "kind": "cmd"}))
+	if err := runner.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	sent := hub.sent()
+	if len(sent) != 1 || sent[0].To != "/devices/lamp/messages/devicebound" || string(sent[0].Data) != `{"on":true}` ||
+		sent[0].Properties["kind"] != "cmd" || sent[0].Properties[metaDevice] != nil {
+		t.Errorf("sent = %+v", sent)
+	}
+
+	msg = message.NewRunnerMessage(testutil.NewAdapter([]byte("x"), map[string]string{metaDevice: "unknown"}))
+	if err := runner.Process(msg); err == nil || !strings.Contains(err.Error(), "device-not-found") {
+		t.Errorf("Process() error = %v", err)
+	}
+	msg = message.NewRunnerMessage(testutil.NewAdapter([]byte("x"), nil))
+	if err := runner.Process(msg); err == nil {
+		t.Error("expected error for missing device")
+	}
+}
+
+func TestAzureIoTRunnerMethod(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/twins/lamp/modules/light/methods" || r.URL.Query().Get("api-version") != methodsAPIVersion ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "SharedAccessSignature sr=testhub.azure-devices.net&") {
+			http.Error(w, "bad request "+r.URL.String(), http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			MethodName string          `json:"methodName"`
+			Timeout    int             `json:"responseTimeoutInSeconds"`
+			Payload    json.RawMessage `json:"payload"`
+		}
+		_ = json.Unmarshal(body, &req)
+		if req.MethodName == "missing" {
+			http.Error(w, `{"errorCode":404103}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"status": 201, "payload": map[string]any{"method": req.MethodName, "timeout": req.Timeout, "echo": req.Payload}})
+	}))
+	defer server.Close()
+
+	hub := startHub(t)
+	cfg := parseConfig[RunnerConfig](t, withOptions(testConnection(hub, testIoTHubString), map[string]any{
+		"mode":                  "method",
+		"method":                "reboot",
+		"module":                "light",
+		"methodTimeout":         "15s",
+		"serviceUrl":            server.URL,
+		"methodFromMetadataKey": "method",
+	}))
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close() //nolint:errcheck
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("soft"), map[string]string{metaDevice: "lamp"}))
+	if err := runner.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	data, _ := msg.GetData()
+	meta, _ := msg.GetMetadata()
+	if string(data) != `{"echo":"soft","method":"reboot","timeout":15}` || meta[metaMethodStatus] != "201" {
+		t.Errorf("response = %s %v", data, meta)
+	}
+
+	msg = message.NewRunnerMessage(testutil.NewAdapter([]byte(`{}`), map[string]string{metaDevice: "lamp", "method": "missing"}))
+	if err := runner.Process(msg); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Process() error = %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/amqp10"
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	startLatest   = "latest"
+	startEarliest = "earliest"
+
+	// Annotations and application properties set by IoT Hub and Event Hubs
+	annotationOffset   = "x-opt-offset"
+	annotationSequence = "x-opt-sequence-number"
+	annotationEnqueued = "x-opt-enqueued-time"
+	propDeviceID       = "iothub-connection-device-id"
+	propModuleID       = "iothub-connection-module-id"
+	propMessageSource  = "iothub-message-source"
+
+	selectorFilter = "apache.org:selector-filter:string"
+	// reconnectDelay is the delay between the reconnection attempts
+	reconnectDelay = 2 * time.Second
+)
+
+type SourceConfig struct {
+	ConnectionConfig `mapstructure:",squash"`
+	// ConsumerGroup is the consumer group of the built-in events endpoint
+	ConsumerGroup string `mapstructure:"consumerGroup" default:"$Default" validate:"required"`
+	// Partitions are the partitions to read (empty = all, read from the management node)
+	Partitions []string `mapstructure:"partitions" validate:"dive,required"`
+	// StartPosition is where the partitions are read from at startup: "latest" or "earliest"
+	StartPosition string `mapstructure:"startPosition" default:"latest" validate:"oneof=latest earliest"`
+	// Events are the event kinds to produce (e.g. "telemetry", "twinChange"); empty = all
+	Events []string `mapstructure:"events" validate:"dive,required"`
+	// Credit is the number of events prefetched per partition
+	Credit int `mapstructure:"credit" default:"100" validate:"min=1,max=5000"`
+	// MessageTimeout is the maximum time to wait for the message Ack/Nak
+	MessageTimeout time.Duration `mapstructure:"messageTimeout" default:"10s" validate:"gt=0"`
+}
+
+type AzureIoTSource struct {
+	cfg    *SourceConfig
+	cs     *connectionString
+	slog   *slog.Logger
+	c      chan *message.RunnerMessage
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu sync.Mutex
+	// offsets are the offsets of the last acknowledged events per partition,
+	// where reading resumes after a reconnection
+	offsets map[string]string
+	conn    *amqp10.Conn
+}
+
+func NewSourceConfig() any {
+	return new(SourceConfig)
+}
+
+// NewSource creates the Azure IoT Hub source
+func NewSource(anyCfg any) (connectors.Source, error) {
+	cfg, ok := anyCfg.(*SourceConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	cs, err := cfg.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if !cs.isEventHub() {
+		return nil, errors.New("the source requires the Event Hub-compatible connection string of the built-in events endpoint")
+	}
+	return &AzureIoTSource{
+		cfg:     cfg,
+		cs:      cs,
+		slog:    slog.Default().With("context", "Azure IoT Source"),
+		offsets: make(map[string]string),
+	}, nil
+}
+
+func (s *AzureIoTSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	s.c = make(chan *message.RunnerMessage, buffer)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	s.slog.Info("starting Azure IoT Hub source",
+		"host", s.cs.Host,
+		"entity", s.cs.Entity,
+		"consumerGroup", s.cfg.ConsumerGroup,
+		"startPosition", s.cfg.StartPosition,
+	)
+
+	// The first connection is made synchronously to report configuration errors
+	conn, partitions, err := s.connect()
+	if err != nil {
+		s.cancel()
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.run(conn, partitions)
+	return s.c, nil
+}
+
+// connect opens the connection and resolves the partitions to read
+func (s *AzureIoTSource) connect() (*amqp10.Conn, []string, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.cfg.ConnectTimeout)
+	defer cancel()
+	conn, err := s.cfg.dial(ctx, s.cs, s.slog)
+	if err != nil {
+		return nil, nil, err
+	}
+	partitions := s.cfg.Partitions
+	if len(partitions) == 0 {
+		if partitions, err = s.partitionIDs(ctx, conn); err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	return conn, partitions, nil
+}
+
+// partitionIDs reads the partitions of the Event Hub from the management node
+func (s *AzureIoTSource) partitionIDs(ctx context.Context, conn *amqp10.Conn) ([]string, error) {
+	res, err := conn.Request(ctx, "$management", &amqp10.Message{
+		Properties: map[string]any{
+			"operation": "READ",
+			"name":      s.cs.Entity,
+			"type":      "com.microsoft:eventhub",
+		},
+		Value: map[any]any{},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the partitions: %w", err)
+	}
+	if code, ok := res.Properties["status-code"].(int32); ok && code != 200 {
+		return nil, fmt.Errorf("failed to read the partitions: status %d %s", code, amqp10.Stringify(res.Properties["status-description"]))
+	}
+	info, _ := res.Value.(map[any]any)
+	partitions := amqp10.AsStrings(info["partition_ids"])
+	if len(partitions) == 0 {
+		return nil, errors.New("no partitions returned by the management node")
+	}
+	return partitions, nil
+}
+
+// run reads the partitions and reconnects when the connection is lost
+func (s *AzureIoTSource) run(conn *amqp10.Conn, partitions []string) {
+	defer s.wg.Done()
+	for {
+		ctx, cancel := context.WithCancel(s.ctx)
+		var wg sync.WaitGroup
+		for _, partition := range partitions {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := s.readPartition(ctx, conn, partition); err != nil && ctx.Err() == nil {
+					s.slog.Error("partition receiver failed", "partition", partition, "error", err)
+					_ = conn.Close()
+				}
+			}()
+		}
+		select {
+		case <-conn.Done():
+			s.slog.Warn("connection to Azure IoT Hub lost", "error", conn.Err())
+		case <-s.ctx.Done():
+		}
+		cancel()
+		wg.Wait()
+		_ = conn.Close()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(reconnectDelay):
+			}
+			var err error
+			if conn, partitions, err = s.connect(); err == nil {
+				metrics.Reconnected("azureiot")
+				break
+			}
+			s.slog.Error("failed to reconnect to Azure IoT Hub", "error", err)
+		}
+	}
+}
+
+// readPartition produces the events of a partition, one at a time
+func (s *AzureIoTSource) readPartition(ctx context.Context, conn *amqp10.Conn, partition string) error {
+	address := fmt.Sprintf("%s/ConsumerGroups/%s/Partitions/%s", s.cs.Entity, s.cfg.ConsumerGroup, partition)
+	attachCtx, cancel := context.WithTimeout(ctx, s.cfg.ConnectTimeout)
+	receiver, err := conn.AttachReceiver(attachCtx, amqp10.LinkOptions{
+		Source: address,
+		Filter: map[any]any{
+			amqp10.Symbol(selectorFilter): &amqp10.Described{Descriptor: amqp10.Symbol(selectorFilter), Value: s.selector(partition)},
+		},
+		Credit: uint32(s.cfg.Credit), //nolint:gosec // validated to 1-5000 range
+	})
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to attach to %s: %w", address, err)
+	}
+	defer receiver.Detach()
+
+	for {
+		msg, err := receiver.Receive(ctx)
+		if err != nil {
+			return err
+		}
+		metadata := eventMetadata(msg.Message, partition)
+		if len(s.cfg.Events) > 0 && !slices.Contains(s.cfg.Events, metadata[metaEvent]) {
+			s.commit(partition, metadata[metaOffset])
+			continue
+		}
+
+		done := make(chan message.ResponseStatus, 1)
+		select {
+		case s.c <- message.NewRunnerMessage(&AzureIoTMessage{
+			id:       []byte(metadata[metaPartition] + "/" + metadata[metaSequence]),
+			data:     msg.Data,
+			metadata: metadata,
+			done:     done,
+		}):
+		case <-ctx.Done():
+			return nil
+		}
+		select {
+		case status := <-done:
+			// Naked events are read again after a reconnection
+			if status == message.ResponseStatusAck {
+				s.commit(partition, metadata[metaOffset])
+			}
+		case <-time.After(s.cfg.MessageTimeout):
+			s.slog.Warn("timeout waiting for message processing", "partition", partition, "offset", metadata[metaOffset])
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// selector returns the filter of the start position of the partition
+func (s *AzureIoTSource) selector(partition string) string {
+	s.mu.Lock()
+	offset, ok := s.offsets[partition]
+	s.mu.Unlock()
+	if ok {
+		return fmt.Sprintf("amqp.annotation.x-opt-offset > '%s'", offset)
+	}
+	if s.cfg.StartPosition == startEarliest {
+		return "amqp.annotation.x-opt-offset > '-1'"
+	}
+	return "amqp.annotation.x-opt-offset > '@latest'"
+}
+
+// commit records the offset of a processed event
+func (s *AzureIoTSource) commit(partition, offset string) {
+	if offset == "" {
+		return
+	}
+	s.mu.Lock()
+	s.offsets[partition] = offset
+	s.mu.Unlock()
+}
+
+// eventMetadata maps the system and application properties of an event
+func eventMetadata(msg *amqp10.Message, partition string) map[string]string {
+	metadata := make(map[string]string, len(msg.Properties)+8)
+	for k, v := range msg.Properties {
+		metadata[k] = amqp10.Stringify(v)
+	}
+	for k, v := range msg.Annotations {
+		key := amqp10.AsString(k)
+		if strings.HasPrefix(key, "iothub-") {
+			metadata[key] = amqp10.Stringify(v)
+		}
+	}
+	metadata[metaPartition] = partition
+	metadata[metaOffset] = amqp10.Stringify(msg.Annotation(annotationOffset))
+	metadata[metaSequence] = amqp10.Stringify(msg.Annotation(annotationSequence))
+	if t, ok := msg.Annotation(annotationEnqueued).(time.Time); ok {
+		metadata[metaEnqueued] = t.UTC().Format(time.RFC3339Nano)
+	}
+	if device := metadata[propDeviceID]; device != "" {
+		metadata[metaDevice] = device
+	}
+	if module := metadata[propModuleID]; module != "" {
+		metadata[metaModule] = module
+	}
+	// Twin changes, lifecycle and connection state events are tagged by their source
+	// (e.g. "twinChangeEvents"), telemetry has none
+	event := eventTelemetry
+	if source := metadata[propMessageSource]; source != "" && source != "Telemetry" {
+		event = strings.TrimSuffix(source, "Events")
+	}
+	metadata[metaEvent] = event
+	if msg.ContentType != "" {
+		metadata["content-type"] = msg.ContentType
+	}
+	return metadata
+}
+
+func (s *AzureIoTSource) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn != nil {
+		_ = conn.Close()
+	}
+	s.wg.Wait()
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/amqp10"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+func receive(t *testing.T, c <-chan *message.RunnerMessage, timeout time.Duration) *message.RunnerMessage {
+	t.Helper()
+	select {
+	case msg := <-c:
+		return msg
+	case <-time.After(timeout):
+		t.Fatal("timeout waiting for message")
+	}
+	return nil
+}
+
+func telemetry(device, body string) *amqp10.Message {
+	return &amqp10.Message{
+		ContentType: "application/json",
+		Annotations: map[any]any{amqp10.Symbol(propDeviceID): device},
+		Properties:  map[string]any{"alert": "true"},
+		Data:        []byte(body),
+	}
+}
+
+func TestAzureIoTSourceEvents(t *testing.T) {
+	hub := startHub(t)
+	hub.publish("0", telemetry("sensor-1", `{"t":21.5}`))
+	hub.publish("1", &amqp10.Message{
+		Annotations: map[any]any{amqp10.Symbol(propDeviceID): "sensor-2", amqp10.Symbol(propMessageSource): "twinChangeEvents"},
+		Data:        []byte(`{"properties":{"desired":{"on":true}}}`),
+	})
+
+	cfg := parseConfig[SourceConfig](t, withOptions(testConnection(hub, testEventHubStr), map[string]any{
+		"startPosition": "earliest",
+	}))
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close() //nolint:errcheck
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+	if login := hub.login(); len(login) == 0 || login[0] != "service\x00"+testKey {
+		t.Errorf("SASL login = %q", login)
+	}
+
+	byDevice := map[string]map[string]string{}
+	for range 2 {
+		msg := receive(t, c, 3*time.Second)
+		meta, _ := msg.GetMetadata()
+		byDevice[meta[metaDevice]] = meta
+		if err := msg.Ack(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta := byDevice["sensor-1"]
+	if meta[metaEvent] != eventTelemetry || meta[metaPartition] != "0" || meta[metaOffset] != "0" || meta[metaSequence] != "0" ||
+		meta[metaEnqueued] != "2026-01-02T03:04:05Z" || meta["alert"] != "true" || meta["content-type"] != "application/json" {
+		t.Errorf("telemetry metadata = %v", meta)
+	}
+	if meta := byDevice["sensor-2"]; meta[metaEvent] != "twinChange" || meta[metaPartition] != "1" {
+		t.Errorf("twin change metadata = %v", meta)
+	}
+}
+
+func TestAzureIoTSourceEventsFilterAndResume(t *testing.T) {
+	hub := startHub(t)
+	cfg := parseConfig[SourceConfig](t, withOptions(testConnection(hub, testEventHubStr), map[string]any{
+		"partitions": []string{"0"},
+		"events":     []string{"telemetry"},
+	}))
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close() //nolint:errcheck
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	hub.publish("0", &amqp10.Message{
+		Annotations: map[any]any{amqp10.Symbol(propDeviceID): "d1", amqp10.Symbol(propMessageSource): "deviceLifecycleEvents"},
+		Data:        []byte(`{}`),
+	})
+	hub.publish("0", telemetry("d1", "first"))
+	msg := receive(t, c, 3*time.Second)
+	if data, _ := msg.GetData(); string(data) != "first" {
+		t.Fatalf("data = %s", data)
+	}
+	if err := msg.Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+	hub.publish("0", telemetry("d1", "second"))
+	msg = receive(t, c, 3*time.Second)
+	if err := msg.Nak(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// After the reconnection reading resumes after the last acknowledged event
+	hub.drop()
+	msg = receive(t, c, 5*time.Second)
+	if data, _ := msg.GetData(); string(data) != "second" {
+		t.Errorf("data after reconnection = %s", data)
+	}
+	_ = msg.Ack(nil)
+}
+
+func TestAzureIoTSourceRequiresEventHubString(t *testing.T) {
+	hub := startHub(t)
+	cfg := parseConfig[SourceConfig](t, testConnection(hub, testIoTHubString))
+	if _, err := NewSource(cfg); err == nil {
+		t.Error("expected error for an IoT Hub connection string")
+	}
+}
+
+func TestEventMetadataModule(t *testing.T) {
+	meta := eventMetadata(&amqp10.Message{
+		Annotations: map[any]any{
+			amqp10.Symbol(propDeviceID):      "edge-1",
+			amqp10.Symbol(propModuleID):      "filter",
+			amqp10.Symbol(propMessageSource): "Telemetry",
+		},
+	}, "3")
+	if meta[metaDevice] != "edge-1" || meta[metaModule] != "filter" || meta[metaEvent] != eventTelemetry || meta[metaPartition] != "3" {
+		t.Errorf("metadata = %v", meta)
+	}
+}
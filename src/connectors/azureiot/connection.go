@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/amqp10"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+)
+
+const (
+	// metaDevice is the metadata key of the device id
+	metaDevice = "eb-iot-device"
+	// metaModule is the metadata key of the module id
+	metaModule = "eb-iot-module"
+	// metaEvent is the metadata key of the event kind: "telemetry", "twinChange", "deviceLifecycle", ...
+	metaEvent = "eb-iot-event"
+	// metaPartition is the metadata key of the partition of the event
+	metaPartition = "eb-iot-partition"
+	// metaOffset is the metadata key of the offset of the event in the partition
+	metaOffset = "eb-iot-offset"
+	// metaSequence is the metadata key of the sequence number of the event in the partition
+	metaSequence = "eb-iot-sequence"
+	// metaEnqueued is the metadata key of the enqueued time of the event (RFC 3339)
+	metaEnqueued = "eb-iot-enqueued"
+	// metaMethodStatus is the metadata key of the status returned by a direct method
+	metaMethodStatus = "eb-iot-method-status"
+
+	eventTelemetry = "telemetry"
+
+	amqpsPort = "5671"
+	// tokenValidity is the validity of the SAS tokens, generated on every connection
+	tokenValidity = time.Hour
+)
+
+// ConnectionConfig is the connection to the IoT Hub (or its Event Hub-compatible endpoint)
+// shared by the source and the target
+type ConnectionConfig struct {
+	// ConnectionString is the IoT Hub connection string of a shared access policy
+	// ("HostName=...;SharedAccessKeyName=...;SharedAccessKey=...") or, for the source,
+	// the Event Hub-compatible connection string ("Endpoint=sb://...;...;EntityPath=...");
+	// supports secret references (env:, file:)
+	ConnectionString string `mapstructure:"connectionString" validate:"required"`
+	// Address overrides the host:port of the AMQP connection (default: the host on port 5671)
+	Address string `mapstructure:"address"`
+	// ConnectTimeout bounds the connection and the link attachment
+	ConnectTimeout time.Duration `mapstructure:"connectTimeout" default:"10s" validate:"gt=0"`
+	// TLS configures the certificates of the TLS connection, always encrypted
+	TLS *tlsconfig.Config `mapstructure:"tls"`
+}
+
+// connectionString is a parsed IoT Hub or Event Hub-compatible connection string
+type connectionString struct {
+	*amqp10.ConnectionString
+}
+
+// isEventHub reports whether the connection string is of an Event Hub-compatible endpoint
+func (cs *connectionString) isEventHub() bool {
+	return cs.Entity != ""
+}
+
+// hubName returns the IoT Hub name, the first label of the host name
+func (cs *connectionString) hubName() string {
+	name, _, _ := strings.Cut(cs.Host, ".")
+	return name
+}
+
+// sasToken returns a shared access signature of the resource URI valid until expiry
+func sasToken(resource, keyName, key string, expiry time.Time) (string, error) {
+	secret, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid shared access key: %w", err)
+	}
+	sr := url.QueryEscape(strings.ToLower(resource))
+	se := strconv.FormatInt(expiry.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(sr + "\n" + se))
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s", sr, url.QueryEscape(sig), se, url.QueryEscape(keyName)), nil
+}
+
+// resolve resolves and parses the connection string
+func (c *ConnectionConfig) resolve() (*connectionString, error) {
+	raw, err := secrets.Resolve(c.ConnectionString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve connection string: %w", err)
+	}
+	cs, err := amqp10.ParseConnectionString(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &connectionString{cs}, nil
+}
+
+// dial opens an AMQP connection authenticated with SASL PLAIN: a SAS token of the hub
+// for IoT Hub, the shared access key for Event Hub-compatible endpoints
+func (c *ConnectionConfig) dial(ctx context.Context, cs *connectionString, logger *slog.Logger) (*amqp10.Conn, error) {
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(c.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	opts := amqp10.ConnOptions{
+		Address:  c.Address,
+		Hostname: cs.Host,
+		TLS:      tlsConfig,
+		Username: cs.KeyName,
+		Password: cs.Key,
+		Timeout:  c.ConnectTimeout,
+	}
+	if opts.Address == "" {
+		opts.Address = net.JoinHostPort(cs.Host, amqpsPort)
+	}
+	if !cs.isEventHub() {
+		opts.Username = cs.KeyName + "@sas.root." + cs.hubName()
+		if opts.Password, err = sasToken(cs.Host, cs.KeyName, cs.Key, time.Now().Add(tokenValidity)); err != nil {
+			return nil, err
+		}
+	}
+	return amqp10.Dial(ctx, opts, logger)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveConnectionString(t *testing.T) {
+	cs, err := (&ConnectionConfig{ConnectionString: testIoTHubString}).resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs.Host != "testhub.azure-devices.net" || cs.KeyName != "service" || cs.isEventHub() || cs.hubName() != "testhub" {
+		t.Errorf("IoT Hub connection string = %+v", cs)
+	}
+	cs, err = (&ConnectionConfig{ConnectionString: testEventHubStr}).resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs.Host != "ihsuprod.servicebus.windows.net" || cs.Entity != "testhub" || !cs.isEventHub() {
+		t.Errorf("Event Hub connection string = %+v", cs)
+	}
+	if _, err := (&ConnectionConfig{ConnectionString: "HostName=h;SharedAccessKeyName=k"}).resolve(); err == nil {
+		t.Error("expected error for missing key")
+	}
+}
+
+func TestSASToken(t *testing.T) {
+	expiry := time.Unix(1767323045, 0)
+	token, err := sasToken("TestHub.azure-devices.net", "service", testKey, expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// HMAC-SHA256("secret", "testhub.azure-devices.net\n1767323045")
+	want := "SharedAccessSignature sr=testhub.azure-devices.net&sig=8g6Q4QVNLgupTpbLFtM5BQXFOz69sm0caOnL%2BG4qu%2Fc%3D&se=1767323045&skn=service"
+	if token != want {
+		t.Errorf("sasToken() = %s", token)
+	}
+	if _, err := sasToken("h", "k", "not base64!", expiry); err == nil || !strings.Contains(err.Error(), "shared access key") {
+		t.Errorf("sasToken() error = %v", err)
+	}
+}
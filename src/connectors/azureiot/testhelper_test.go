@@ -0,0 +1,377 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/amqp10"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+var (
+	testKey          = base64.StdEncoding.EncodeToString([]byte("secret"))
+	testIoTHubString = "HostName=testhub.azure-devices.net;SharedAccessKeyName=service;SharedAccessKey=" + testKey
+	testEventHubStr  = "Endpoint=sb://ihsuprod.servicebus.windows.net/;SharedAccessKeyName=service;SharedAccessKey=" + testKey + ";EntityPath=testhub"
+)
+
+// fakeHub is an AMQP server behaving like the IoT Hub service endpoint and its
+// Event Hub-compatible events endpoint: the partitions "0" and "1" are listed by the
+// management node, offset selectors are honored and cloud-to-device messages are
+// rejected for the device "unknown"
+type fakeHub struct {
+	t        *testing.T
+	listener net.Listener
+
+	mu      sync.Mutex
+	logins  []string
+	events  map[string][]*amqp10.Message
+	c2d     []*amqp10.Message
+	conns   map[*hubConn]struct{}
+	attachN int
+}
+
+// hubConn is a client connection of the fake hub
+type hubConn struct {
+	hub   *fakeHub
+	conn  net.Conn
+	wmu   sync.Mutex
+	links map[uint32]*hubLink
+	// replies are the reply links of the management node by address
+	replies  map[string]*hubLink
+	delivery uint32
+}
+
+// hubLink is a link of a client connection
+type hubLink struct {
+	handle    uint32
+	receiver  bool
+	address   string
+	credit    uint32
+	partition string
+	next      int
+}
+
+// startHub starts the fake hub on a TLS listener
+func startHub(t *testing.T) *fakeHub {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &fakeHub{
+		t:        t,
+		listener: ln,
+		events:   make(map[string][]*amqp10.Message),
+		conns:    make(map[*hubConn]struct{}),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c := &hubConn{hub: h, conn: conn, links: make(map[uint32]*hubLink), replies: make(map[string]*hubLink)}
+			h.mu.Lock()
+			h.conns[c] = struct{}{}
+			h.mu.Unlock()
+			go c.serve()
+		}
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+		h.drop()
+	})
+	return h
+}
+
+func (h *fakeHub) address() string {
+	return h.listener.Addr().String()
+}
+
+// publish appends an event to a partition and delivers it to the readers
+func (h *fakeHub) publish(partition string, msg *amqp10.Message) {
+	h.mu.Lock()
+	offset := 0
+	for _, events := range h.events {
+		offset += len(events)
+	}
+	if msg.Annotations == nil {
+		msg.Annotations = map[any]any{}
+	}
+	msg.Annotations[amqp10.Symbol(annotationOffset)] = strconv.Itoa(offset * 100)
+	msg.Annotations[amqp10.Symbol(annotationSequence)] = int64(len(h.events[partition]))
+	msg.Annotations[amqp10.Symbol(annotationEnqueued)] = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	h.events[partition] = append(h.events[partition], msg)
+	conns := make([]*hubConn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+	for _, c := range conns {
+		c.deliver()
+	}
+}
+
+// drop closes the client connections
+func (h *fakeHub) drop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.conns {
+		_ = c.conn.Close()
+		delete(h.conns, c)
+	}
+}
+
+func (h *fakeHub) sent() []*amqp10.Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*amqp10.Message(nil), h.c2d...)
+}
+
+func (h *fakeHub) login() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.logins...)
+}
+
+func (c *hubConn) write(body *amqp10.Described, payload []byte) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_ = amqp10.WriteFrame(c.conn, amqp10.FrameAMQP, 0, body, payload)
+}
+
+func (c *hubConn) serve() {
+	defer c.conn.Close() //nolint:errcheck
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return
+	}
+	_, _ = c.conn.Write(amqp10.HeaderSASL)
+	_ = amqp10.WriteFrame(c.conn, amqp10.FrameSASL, 0, amqp10.Composite(amqp10.DescSASLMechanisms, []amqp10.Symbol{"PLAIN"}), nil)
+	f, err := amqp10.ReadFrame(c.conn, amqp10.MaxFrameSize)
+	if err != nil {
+		return
+	}
+	response, _ := f.Body.Fields(2)[1].([]byte)
+	c.hub.mu.Lock()
+	c.hub.logins = append(c.hub.logins, strings.TrimPrefix(string(response), "\x00"))
+	c.hub.mu.Unlock()
+	_ = amqp10.WriteFrame(c.conn, amqp10.FrameSASL, 0, amqp10.Composite(amqp10.DescSASLOutcome, uint8(0)), nil)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return
+	}
+	_, _ = c.conn.Write(amqp10.HeaderAMQP)
+
+	for {
+		f, err := amqp10.ReadFrame(c.conn, amqp10.MaxFrameSize)
+		if err != nil {
+			return
+		}
+		if f.Body == nil {
+			continue
+		}
+		switch f.Body.Code() {
+		case amqp10.DescOpen:
+			c.write(amqp10.Composite(amqp10.DescOpen, "fake-hub", nil, uint32(4096), uint16(0), uint32(1000)), nil)
+		case amqp10.DescBegin:
+			c.write(amqp10.Composite(amqp10.DescBegin, uint16(0), uint32(0), uint32(amqp10.SessionWindow), uint32(amqp10.SessionWindow)), nil)
+		case amqp10.DescAttach:
+			c.attach(f.Body.Fields(10))
+		case amqp10.DescFlow:
+			fields := f.Body.Fields(7)
+			if fields[4] == nil {
+				continue
+			}
+			c.hub.mu.Lock()
+			if l, ok := c.links[amqp10.AsUint32(fields[4])]; ok {
+				l.credit = amqp10.AsUint32(fields[6])
+			}
+			c.hub.mu.Unlock()
+			c.deliver()
+		case amqp10.DescTransfer:
+			c.transfer(f.Body.Fields(6), f.Payload)
+		case amqp10.DescDetach:
+			fields := f.Body.Fields(1)
+			c.hub.mu.Lock()
+			delete(c.links, amqp10.AsUint32(fields[0]))
+			c.hub.mu.Unlock()
+			c.write(amqp10.Composite(amqp10.DescDetach, fields[0], true), nil)
+		case amqp10.DescClose:
+			c.write(amqp10.Composite(amqp10.DescClose), nil)
+			return
+		}
+	}
+}
+
+// attach answers the attach of a client link
+func (c *hubConn) attach(fields []any) {
+	name, handle, clientReceiver := fields[0], amqp10.AsUint32(fields[1]), amqp10.AsBool(fields[2])
+	source, _ := fields[5].(*amqp10.Described)
+	target, _ := fields[6].(*amqp10.Described)
+	l := &hubLink{handle: handle, receiver: clientReceiver}
+	if clientReceiver {
+		l.address = amqp10.AsString(source.Fields(1)[0])
+	} else {
+		l.address = amqp10.AsString(target.Fields(1)[0])
+	}
+
+	if !clientReceiver && l.address != c2dNode && l.address != "$management" {
+		c.write(amqp10.Composite(amqp10.DescAttach, name, handle, !clientReceiver, nil, nil, fields[5], nil), nil)
+		c.write(amqp10.Composite(amqp10.DescDetach, handle, true, amqp10.Composite(amqp10.DescError, amqp10.Symbol("amqp:not-found"), "unknown node "+l.address)), nil)
+		return
+	}
+
+	c.hub.mu.Lock()
+	c.hub.attachN++
+	if clientReceiver && l.address == "$management" {
+		c.replies[amqp10.AsString(target.Fields(1)[0])] = l
+	}
+	if parts := strings.Split(l.address, "/"); clientReceiver && len(parts) == 5 && parts[3] == "Partitions" {
+		l.partition = parts[4]
+		l.next = len(c.hub.events[l.partition])
+		filters, _ := source.Fields(8)[7].(map[any]any)
+		if filter, ok := filters[amqp10.Symbol(selectorFilter)].(*amqp10.Described); ok {
+			selector := amqp10.AsString(filter.Value)
+			from := selector[strings.Index(selector, "'")+1 : len(selector)-1]
+			switch from {
+			case "@latest":
+			case "-1":
+				l.next = 0
+			default:
+				for i, msg := range c.hub.events[l.partition] {
+					if amqp10.AsString(msg.Annotation(annotationOffset)) == from {
+						l.next = i + 1
+					}
+				}
+			}
+		}
+	}
+	c.links[handle] = l
+	c.hub.mu.Unlock()
+
+	var initialCount any
+	if clientReceiver {
+		initialCount = uint32(0)
+	}
+	c.write(amqp10.Composite(amqp10.DescAttach, name, handle, !clientReceiver, nil, nil, fields[5], fields[6], nil, nil, initialCount), nil)
+	if !clientReceiver {
+		c.write(amqp10.Composite(amqp10.DescFlow, uint32(0), uint32(amqp10.SessionWindow), uint32(0), uint32(amqp10.SessionWindow), handle, uint32(0), uint32(100)), nil)
+	}
+}
+
+// deliver sends the pending events to the partition readers with credit
+func (c *hubConn) deliver() {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	for _, l := range c.links {
+		for l.partition != "" && l.credit > 0 && l.next < len(c.hub.events[l.partition]) {
+			c.send(l, c.hub.events[l.partition][l.next])
+			l.next++
+		}
+	}
+}
+
+// send transfers a message on a link, unsettled
+func (c *hubConn) send(l *hubLink, msg *amqp10.Message) {
+	payload, err := amqp10.EncodeMessage(msg)
+	if err != nil {
+		c.hub.t.Errorf("encodeMessage() error = %v", err)
+		return
+	}
+	l.credit--
+	c.delivery++
+	c.write(amqp10.Composite(amqp10.DescTransfer, l.handle, c.delivery, []byte{byte(c.delivery)}, uint32(0), false, false), payload)
+}
+
+// transfer handles the messages sent by the client
+func (c *hubConn) transfer(fields []any, payload []byte) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	l, ok := c.links[amqp10.AsUint32(fields[0])]
+	if !ok {
+		return
+	}
+	deliveryID := fields[1]
+	msg, err := amqp10.DecodeMessage(payload)
+	if err != nil {
+		c.hub.t.Errorf("decodeMessage() error = %v", err)
+		return
+	}
+
+	if l.address == "$management" {
+		reply := c.replies[msg.ReplyTo]
+		c.write(amqp10.Composite(amqp10.DescDisposition, true, deliveryID, nil, true, amqp10.Composite(amqp10.DescAccepted)), nil)
+		if reply == nil || reply.credit == 0 {
+			return
+		}
+		c.send(reply, &amqp10.Message{
+			CorrelationID: msg.MessageID,
+			Properties:    map[string]any{"status-code": int32(200)},
+			Value:         map[any]any{"partition_ids": []any{"0", "1"}, "name": msg.Properties["name"]},
+		})
+		return
+	}
+
+	var state *amqp10.Described = amqp10.Composite(amqp10.DescAccepted)
+	if strings.HasPrefix(msg.To, "/devices/unknown/") {
+		state = amqp10.Composite(amqp10.DescRejected, amqp10.Composite(amqp10.DescError, amqp10.Symbol("com.microsoft:device-not-found"), "device not found"))
+	} else {
+		c.hub.c2d = append(c.hub.c2d, msg)
+	}
+	c.write(amqp10.Composite(amqp10.DescDisposition, true, deliveryID, nil, true, state), nil)
+}
+
+// testConnection returns the options of a connection to the fake hub
+func testConnection(h *fakeHub, connectionString string) map[string]any {
+	return map[string]any{
+		"connectionString": connectionString,
+		"address":          h.address(),
+		"connectTimeout":   "2s",
+		"tls":              map[string]any{"enabled": true, "insecureSkipVerify": true},
+	}
+}
+
+func withOptions(base map[string]any, extra map[string]any) map[string]any {
+	for k, v := range extra {
+		base[k] = v
+	}
+	return base
+}
+
+func parseConfig[T any](t *testing.T, opts map[string]any) *T {
+	t.Helper()
+	cfg := new(T)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("ParseConfig() unexpected error = %v", err)
+	}
+	return cfg
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Ensure BigQueryRunner implements connectors.Runner
+var _ connectors.Runner = &BigQueryRunner{}
+
+const (
+	deliveryExactlyOnce = "exactlyOnce"
+	deliveryAtLeastOnce = "atLeastOnce"
+)
+
+type RunnerConfig struct {
+	ProjectID string `mapstructure:"projectId" validate:"required"`
+	Dataset   string `mapstructure:"dataset" validate:"required"`
+	Table     string `mapstructure:"table" validate:"required"`
+	// CredentialsFile is the path of a service account JSON file (default: Application Default Credentials)
+	CredentialsFile string `mapstructure:"credentialsFile"`
+	// SchemaFile is the path of the table schema in the JSON format of the bq tool,
+	// used instead of reading the schema from the table metadata
+	SchemaFile string `mapstructure:"schemaFile" validate:"omitempty,filepath"`
+	// Columns maps top-level columns to the dotted path of a payload field
+	// (by default a column is read from the payload key with the same name)
+	Columns map[string]string `mapstructure:"columns"`
+	// Delivery is "exactlyOnce" (a committed stream whose appends are retried at the same offset)
+	// or "atLeastOnce" (the default stream, with automatic retries)
+	Delivery string `mapstructure:"delivery" default:"exactlyOnce" validate:"oneof=exactlyOnce atLeastOnce"`
+	// BatchSize is the maximum number of rows of an append request
+	BatchSize int `mapstructure:"batchSize" default:"500" validate:"gt=0"`
+	// MaxBatchBytes is the maximum size of the rows of an append request (the API limit is 10MB)
+	MaxBatchBytes int `mapstructure:"maxBatchBytes" default:"8388608" validate:"gt=0,max=10000000"`
+	// Retries of a failed append of the exactlyOnce delivery
+	Retries int `mapstructure:"retries" default:"3" validate:"min=0"`
+	// Coerce accepts lenient values: numbers and booleans as strings, more timestamp layouts,
+	// GeoJSON and lat/lon objects for GEOGRAPHY columns, single values for arrays
+	Coerce bool `mapstructure:"coerce"`
+	// EpochUnit is the unit of numeric timestamps: "s", "ms", "us" or "ns"
+	EpochUnit string        `mapstructure:"epochUnit" default:"us" validate:"oneof=s ms us ns"`
+	Timeout   time.Duration `mapstructure:"timeout" default:"30s" validate:"gt=0"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"10485760" validate:"omitempty,gt=0"` // 10MB default
+}
+
+// writeStream is a stream the rows of the table are appended to
+type writeStream interface {
+	// Append writes the rows at the offset (-1 for no offset) and waits for the result
+	Append(ctx context.Context, rows [][]byte, offset int64) error
+	Close() error
+}
+
+type BigQueryRunner struct {
+	cfg     *RunnerConfig
+	slog    *slog.Logger
+	encoder *rowEncoder
+	client  *managedwriter.Client
+	// openStream creates the write stream of the delivery mode
+	openStream func(ctx context.Context) (writeStream, error)
+	mu         sync.Mutex
+	stream     writeStream
+	offset     int64
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a BigQuery runner writing rows with the Storage Write API
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		jsonData, err := os.ReadFile(cfg.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading credentials file: %w", err)
+		}
+		opts = append(opts, option.WithCredentialsJSON(jsonData)) //nolint:staticcheck // WithCredentialsJSON is the non-file alternative; accepted deprecation
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	schema, err := loadSchema(ctx, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	encoder, descriptor, err := newRowEncoder(schema, cfg.Columns, cfg.Coerce, cfg.EpochUnit)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := managedwriter.NewClient(context.Background(), cfg.ProjectID, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating BigQuery write client: %w", err)
+	}
+
+	r := &BigQueryRunner{
+		cfg:     cfg,
+		slog:    slog.Default().With("context", "BigQuery Runner"),
+		encoder: encoder,
+		client:  client,
+		offset:  -1,
+	}
+	r.openStream = func(ctx context.Context) (writeStream, error) {
+		return r.newManagedStream(ctx, descriptor)
+	}
+	if r.stream, err = r.openStream(ctx); err != nil {
+		client.Close() //nolint:errcheck,gosec
+		return nil, err
+	}
+	if cfg.Delivery == deliveryExactlyOnce {
+		r.offset = 0
+	}
+
+	r.slog.Info("BigQuery runner created",
+		"projectID", cfg.ProjectID,
+		"dataset", cfg.Dataset,
+		"table", cfg.Table,
+		"delivery", cfg.Delivery,
+		"columns", len(schema),
+	)
+	return r, nil
+}
+
+// loadSchema reads the schema file, or the schema of the table metadata
+func loadSchema(ctx context.Context, cfg *RunnerConfig, opts []option.ClientOption) (bigquery.Schema, error) {
+	if cfg.SchemaFile != "" {
+		data, err := os.ReadFile(cfg.SchemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema file: %w", err)
+		}
+		schema, err := bigquery.SchemaFromJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema file: %w", err)
+		}
+		return schema, nil
+	}
+
+	client, err := bigquery.NewClient(ctx, cfg.ProjectID, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating BigQuery client: %w", err)
+	}
+	defer client.Close() //nolint:errcheck
+
+	md, err := client.Dataset(cfg.Dataset).Table(cfg.Table).Metadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table metadata: %w", err)
+	}
+	return md.Schema, nil
+}
+
+// managedStream adapts a managedwriter.ManagedStream to writeStream
+type managedStream struct {
+	ms       *managedwriter.ManagedStream
+	finalize bool
+}
+
+func (s *managedStream) Append(ctx context.Context, rows [][]byte, offset int64) error {
+	var opts []managedwriter.AppendOption
+	if offset >= 0 {
+		opts = append(opts, managedwriter.WithOffset(offset))
+	}
+	res, err := s.ms.AppendRows(ctx, rows, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = res.GetResult(ctx)
+	return err
+}
+
+func (s *managedStream) Close() error {
+	if s.finalize {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := s.ms.Finalize(ctx); err != nil {
+			return errors.Join(fmt.Errorf("failed to finalize stream: %w", err), s.ms.Close())
+		}
+	}
+	return s.ms.Close()
+}
+
+// newManagedStream opens a committed stream for the exactlyOnce delivery,
+// otherwise the default stream of the table
+func (r *BigQueryRunner) newManagedStream(ctx context.Context, descriptor *descriptorpb.DescriptorProto) (writeStream, error) {
+	table := managedwriter.TableParentFromParts(r.cfg.ProjectID, r.cfg.Dataset, r.cfg.Table)
+	opts := []managedwriter.WriterOption{
+		managedwriter.WithDestinationTable(table),
+		managedwriter.WithSchemaDescriptor(descriptor),
+	}
+	exactlyOnce := r.cfg.Delivery == deliveryExactlyOnce
+	if exactlyOnce {
+		opts = append(opts, managedwriter.WithType(managedwriter.CommittedStream))
+	} else {
+		opts = append(opts, managedwriter.WithType(managedwriter.DefaultStream), managedwriter.EnableWriteRetries(true))
+	}
+	ms, err := r.client.NewManagedStream(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating write stream: %w", err)
+	}
+	return &managedStream{ms: ms, finalize: exactlyOnce}, nil
+}
+
+// storageErrorCode returns the code of the BigQuery Storage error details, if any
+func storageErrorCode(err error) storagepb.StorageError_StorageErrorCode {
+	if apiErr, ok := apierror.FromError(err); ok {
+		storageErr := &storagepb.StorageError{}
+		if e := apiErr.Details().ExtractProtoMessage(storageErr); e == nil {
+			return storageErr.GetCode()
+		}
+	}
+	return storagepb.StorageError_STORAGE_ERROR_CODE_UNSPECIFIED
+}
+
+// offsetWritten reports whether the append failed because its rows were already written,
+// i.e. a previous attempt succeeded without the response being received
+func offsetWritten(err error) bool {
+	return storageErrorCode(err) == storagepb.StorageError_OFFSET_ALREADY_EXISTS || status.Code(err) == codes.AlreadyExists
+}
+
+// rows decodes the payload, a JSON object or an array of objects, into encoded rows
+func (r *BigQueryRunner) rows(data []byte) ([][]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var payload any
+	if err := dec.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON payload: %w", err)
+	}
+
+	var objects []any
+	switch t := payload.(type) {
+	case map[string]any:
+		objects = []any{t}
+	case []any:
+		objects = t
+	default:
+		return nil, fmt.Errorf("payload must be a JSON object or an array of objects")
+	}
+
+	rows := make([][]byte, len(objects))
+	for i, item := range objects {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("row %d: expected an object, got %T", i, item)
+		}
+		row, err := r.encoder.Encode(obj)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// batches splits the rows by BatchSize and MaxBatchBytes
+func (r *BigQueryRunner) batches(rows [][]byte) [][][]byte {
+	var res [][][]byte
+	start, size := 0, 0
+	for i, row := range rows {
+		if i > start && (i-start >= r.cfg.BatchSize || size+len(row) > r.cfg.MaxBatchBytes) {
+			res = append(res, rows[start:i])
+			start, size = i, 0
+		}
+		size += len(row)
+	}
+	if start < len(rows) {
+		res = append(res, rows[start:])
+	}
+	return res
+}
+
+// append writes a batch. With the exactlyOnce delivery the batch is retried at the same
+// offset; once the retries are exhausted the stream is replaced, as its state is unknown.
+func (r *BigQueryRunner) append(ctx context.Context, batch [][]byte) error {
+	if r.offset < 0 {
+		return r.stream.Append(ctx, batch, -1)
+	}
+
+	var err error
+	for attempt := 0; attempt <= r.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(50<<attempt) * time.Millisecond):
+			}
+		}
+		err = r.stream.Append(ctx, batch, r.offset)
+		if err == nil || offsetWritten(err) {
+			r.offset += int64(len(batch))
+			return nil
+		}
+		if storageErrorCode(err) == storagepb.StorageError_OFFSET_OUT_OF_RANGE {
+			break
+		}
+		r.slog.Warn("append failed", "offset", r.offset, "attempt", attempt, "error", err)
+	}
+
+	r.slog.Warn("replacing write stream after failed append", "offset", r.offset)
+	if cerr := r.stream.Close(); cerr != nil {
+		r.slog.Warn("failed to close write stream", "error", cerr)
+	}
+	stream, serr := r.openStream(ctx)
+	if serr != nil {
+		// The next message retries to open the stream
+		r.stream = failedStream{err: serr}
+		return errors.Join(err, serr)
+	}
+	r.stream, r.offset = stream, 0
+	return err
+}
+
+// failedStream replaces a committed stream that could not be reopened, until the next message
+type failedStream struct {
+	err error
+}
+
+func (s failedStream) Append(context.Context, [][]byte, int64) error { return s.err }
+func (s failedStream) Close() error                                  { return nil }
+
+// Process appends the rows of the payload. Appends are serialized, so that the offsets
+// of the exactlyOnce delivery follow the order of the rows.
+func (r *BigQueryRunner) Process(msg *message.RunnerMessage) error {
+	data, err := msg.GetData()
+	if err != nil {
+		return fmt.Errorf("failed to get data: %w", err)
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds limit %d", len(data), r.cfg.MaxInputSize)
+	}
+	rows, err := r.rows(data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fs, ok := r.stream.(failedStream); ok {
+		stream, err := r.openStream(ctx)
+		if err != nil {
+			return errors.Join(fs.err, err)
+		}
+		r.stream, r.offset = stream, 0
+	}
+
+	firstOffset := r.offset
+	for _, batch := range r.batches(rows) {
+		if err := r.append(ctx, batch); err != nil {
+			return fmt.Errorf("failed to append rows: %w", err)
+		}
+	}
+	msg.AddMetadata("eb-bq-rows", strconv.Itoa(len(rows)))
+	if firstOffset >= 0 {
+		msg.AddMetadata("eb-bq-offset", strconv.FormatInt(firstOffset, 10))
+	}
+	r.slog.Debug("rows appended", "table", r.cfg.Table, "rows", len(rows))
+	return nil
+}
+
+func (r *BigQueryRunner) Close() error {
+	r.slog.Info("closing BigQuery runner")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	if r.stream != nil {
+		errs = append(errs, r.stream.Close())
+	}
+	if r.client != nil {
+		errs = append(errs, r.client.Close())
+	}
+	return errors.Join(errs...)
+}
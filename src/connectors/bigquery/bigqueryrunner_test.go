@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeStream records the appends and fails with the queued errors
+type fakeStream struct {
+	offsets []int64
+	sizes   []int
+	errs    []error
+	closed  bool
+}
+
+func (s *fakeStream) Append(_ context.Context, rows [][]byte, offset int64) error {
+	s.offsets = append(s.offsets, offset)
+	s.sizes = append(s.sizes, len(rows))
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (s *fakeStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestBigQueryRunnerBatches(t *testing.T) {
+	stream := &fakeStream{}
+	cfg := &RunnerConfig{
+		ProjectID:     "project",
+		Dataset:       "dataset",
+		Table:         "table",
+		Delivery:      deliveryExactlyOnce,
+		BatchSize:     2,
+		MaxBatchBytes: 1 << 20,
+		Retries:       3,
+		EpochUnit:     "us",
+		Timeout:       time.Second,
+		MaxInputSize:  1024,
+	}
+	e, _, err := newRowEncoder(testSchema, cfg.Columns, cfg.Coerce, cfg.EpochUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &BigQueryRunner{cfg: cfg, slog: slog.Default(), encoder: e, stream: stream, offset: 0}
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`[{"id":1},{"id":2},{"id":3}]`), nil))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	msg2 := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"id":4}`), nil))
+	if err := r.Process(msg2); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+
+	if len(stream.offsets) != 3 || stream.offsets[0] != 0 || stream.offsets[1] != 2 || stream.offsets[2] != 3 {
+		t.Errorf("unexpected offsets %v", stream.offsets)
+	}
+	if stream.sizes[0] != 2 || stream.sizes[1] != 1 {
+		t.Errorf("unexpected batch sizes %v", stream.sizes)
+	}
+	if meta, _ := msg2.GetMetadata(); meta["eb-bq-rows"] != "1" || meta["eb-bq-offset"] != "3" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+}
+
+func TestBigQueryRunnerExactlyOnceRetries(t *testing.T) {
+	// A retry after a lost response is accepted when the offset already exists
+	stream := &fakeStream{errs: []error{
+		status.Error(codes.Unavailable, "transient"),
+		status.Error(codes.AlreadyExists, "offset already exists"),
+	}}
+	cfg := &RunnerConfig{
+		ProjectID:     "project",
+		Dataset:       "dataset",
+		Table:         "table",
+		Delivery:      deliveryExactlyOnce,
+		BatchSize:     500,
+		MaxBatchBytes: 1 << 20,
+		Retries:       2,
+		EpochUnit:     "us",
+		Timeout:       time.Second,
+		MaxInputSize:  1024,
+	}
+	e, _, err := newRowEncoder(testSchema, cfg.Columns, cfg.Coerce, cfg.EpochUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &BigQueryRunner{cfg: cfg, slog: slog.Default(), encoder: e, stream: stream, offset: 0}
+	if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"id":1}`), nil))); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if len(stream.offsets) != 2 || stream.offsets[0] != 0 || stream.offsets[1] != 0 || r.offset != 1 {
+		t.Errorf("unexpected offsets %v, next %d", stream.offsets, r.offset)
+	}
+
+	// Once the retries are exhausted the stream is replaced
+	failing := &fakeStream{errs: []error{errors.New("down"), errors.New("down")}}
+	next := &fakeStream{}
+	cfg = &RunnerConfig{
+		ProjectID:     "project",
+		Dataset:       "dataset",
+		Table:         "table",
+		Delivery:      deliveryExactlyOnce,
+		BatchSize:     500,
+		MaxBatchBytes: 1 << 20,
+		Retries:       1,
+		EpochUnit:     "us",
+		Timeout:       time.Second,
+		MaxInputSize:  1024,
+	}
+	e, _, err = newRowEncoder(testSchema, cfg.Columns, cfg.Coerce, cfg.EpochUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = &BigQueryRunner{cfg: cfg, slog: slog.Default(), encoder: e, stream: failing, offset: 10}
+	r.openStream = func(context.Context) (writeStream, error) { return next, nil }
+	if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"id":1}`), nil))); err == nil {
+		t.Fatal("Process() expected error")
+	}
+	if !failing.closed || r.stream != next || r.offset != 0 {
+		t.Errorf("stream not replaced")
+	}
+	if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"id":1}`), nil))); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if len(next.offsets) != 1 || next.offsets[0] != 0 {
+		t.Errorf("unexpected offsets of the new stream %v", next.offsets)
+	}
+}
+
+func TestBigQueryRunnerAtLeastOnce(t *testing.T) {
+	stream := &fakeStream{}
+	cfg := &RunnerConfig{
+		ProjectID:     "project",
+		Dataset:       "dataset",
+		Table:         "table",
+		Delivery:      deliveryAtLeastOnce,
+		BatchSize:     500,
+		MaxBatchBytes: 1 << 20,
+		Retries:       3,
+		EpochUnit:     "us",
+		Timeout:       time.Second,
+		MaxInputSize:  1024,
+	}
+	e, _, err := newRowEncoder(testSchema, cfg.Columns, cfg.Coerce, cfg.EpochUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &BigQueryRunner{cfg: cfg, slog: slog.Default(), encoder: e, stream: stream, offset: -1}
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"id":1}`), nil))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if len(stream.offsets) != 1 || stream.offsets[0] != -1 {
+		t.Errorf("unexpected offsets %v", stream.offsets)
+	}
+	if meta, _ := msg.GetMetadata(); meta["eb-bq-offset"] != "" {
+		t.Errorf("unexpected offset metadata %v", meta)
+	}
+}
+
+func TestBigQueryRunnerInvalidPayload(t *testing.T) {
+	stream := &fakeStream{}
+	cfg := &RunnerConfig{
+		ProjectID:     "project",
+		Dataset:       "dataset",
+		Table:         "table",
+		Delivery:      deliveryExactlyOnce,
+		BatchSize:     500,
+		MaxBatchBytes: 1 << 20,
+		Retries:       3,
+		EpochUnit:     "us",
+		Timeout:       time.Second,
+		MaxInputSize:  20,
+	}
+	e, _, err := newRowEncoder(testSchema, cfg.Columns, cfg.Coerce, cfg.EpochUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &BigQueryRunner{cfg: cfg, slog: slog.Default(), encoder: e, stream: stream, offset: 0}
+	for _, payload := range []string{`not json`, `"text"`, `[1]`, `{"name":"no id"}`, `[{"id":1},{"id":2},{"id":3}]`} {
+		if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(payload), nil))); err == nil {
+			t.Errorf("Process(%s) expected error", payload)
+		}
+	}
+	if len(stream.offsets) != 0 {
+		t.Errorf("invalid payloads were appended")
+	}
+}
+
+func TestBigQueryRunnerConfigValidation(t *testing.T) {
+	for _, opts := range []map[string]any{
+		{"dataset": "d", "table": "t"},
+		{"projectId": "p", "dataset": "d", "table": "t", "delivery": "once"},
+		{"projectId": "p", "dataset": "d", "table": "t", "epochUnit": "h"},
+		{"projectId": "p", "dataset": "d", "table": "t", "maxBatchBytes": 20000000},
+	} {
+		if err := utils.ParseConfig(opts, new(RunnerConfig)); err == nil {
+			t.Errorf("ParseConfig(%v) expected error", opts)
+		}
+	}
+}
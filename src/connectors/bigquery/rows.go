@@ -0,0 +1,518 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	epochSeconds      = "s"
+	epochMilliseconds = "ms"
+	epochMicroseconds = "us"
+	epochNanoseconds  = "ns"
+)
+
+// timestampLayouts are the additional layouts of timestamps accepted with coercion
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// rowEncoder converts JSON objects to protobuf rows of the table schema.
+// NUMERIC, BIGNUMERIC, DATETIME and TIME columns are sent as strings.
+type rowEncoder struct {
+	schema     bigquery.Schema
+	descriptor protoreflect.MessageDescriptor
+	// columns maps the top-level columns to the dotted path of their payload field
+	columns   map[string][]string
+	coerce    bool
+	epochUnit string
+}
+
+// newRowEncoder returns the encoder of the schema and the descriptor of its rows
+func newRowEncoder(schema bigquery.Schema, columns map[string]string, coerce bool, epochUnit string) (*rowEncoder, *descriptorpb.DescriptorProto, error) {
+	tableSchema, err := adapt.BQSchemaToStorageTableSchema(schema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to convert table schema: %w", err)
+	}
+	var opts []adapt.ProtoConversionOption
+	for _, typ := range []storagepb.TableFieldSchema_Type{
+		storagepb.TableFieldSchema_NUMERIC,
+		storagepb.TableFieldSchema_BIGNUMERIC,
+		storagepb.TableFieldSchema_DATETIME,
+		storagepb.TableFieldSchema_TIME,
+	} {
+		opts = append(opts, adapt.WithProtoMapping(adapt.ProtoMapping{FieldType: typ, Type: descriptorpb.FieldDescriptorProto_TYPE_STRING}))
+	}
+	d, err := adapt.StorageSchemaToProtoDescriptorWithOptions(tableSchema, "root", opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build row descriptor: %w", err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected row descriptor %T", d)
+	}
+	dp, err := adapt.NormalizeDescriptor(md)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to normalize row descriptor: %w", err)
+	}
+
+	e := &rowEncoder{
+		schema:     schema,
+		descriptor: md,
+		columns:    map[string][]string{},
+		coerce:     coerce,
+		epochUnit:  epochUnit,
+	}
+	for column, path := range columns {
+		if !hasColumn(schema, column) {
+			return nil, nil, fmt.Errorf("mapped column %s is not in the table schema", column)
+		}
+		e.columns[strings.ToLower(column)] = strings.Split(path, ".")
+	}
+	return e, dp, nil
+}
+
+func hasColumn(schema bigquery.Schema, name string) bool {
+	for _, fs := range schema {
+		if strings.EqualFold(fs.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode returns the serialized row of the JSON object
+func (e *rowEncoder) Encode(obj map[string]any) ([]byte, error) {
+	msg := dynamicpb.NewMessage(e.descriptor)
+	if err := e.fill(msg, e.schema, obj, "", true); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+// lookup returns the value of the column: the mapped payload field for top-level
+// columns, otherwise the key with the column name, compared case-insensitively
+func (e *rowEncoder) lookup(obj map[string]any, name string, top bool) (any, bool) {
+	if path, ok := e.columns[strings.ToLower(name)]; ok && top {
+		var cur any = obj
+		for _, key := range path {
+			m, ok := cur.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = m[key]; !ok {
+				return nil, false
+			}
+		}
+		return cur, true
+	}
+	if v, ok := obj[name]; ok {
+		return v, true
+	}
+	for k, v := range obj {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (e *rowEncoder) fill(msg protoreflect.Message, schema bigquery.Schema, obj map[string]any, prefix string, top bool) error {
+	for i, fs := range schema {
+		path := prefix + fs.Name
+		fd := msg.Descriptor().Fields().ByNumber(protoreflect.FieldNumber(i + 1))
+		if fd == nil {
+			return fmt.Errorf("column %s not found in the row descriptor", path)
+		}
+		v, ok := e.lookup(obj, fs.Name, top)
+		if !ok || v == nil {
+			if fs.Required {
+				return fmt.Errorf("missing required column %s", path)
+			}
+			continue
+		}
+
+		if !fs.Repeated {
+			value, err := e.value(fd, fs, v, path)
+			if err != nil {
+				return err
+			}
+			msg.Set(fd, value)
+			continue
+		}
+
+		items, ok := v.([]any)
+		if !ok {
+			if !e.coerce {
+				return fmt.Errorf("column %s: expected an array, got %T", path, v)
+			}
+			items = []any{v}
+		}
+		list := msg.Mutable(fd).List()
+		for j, item := range items {
+			if item == nil {
+				return fmt.Errorf("column %s: null array element %d", path, j)
+			}
+			value, err := e.value(fd, fs, item, fmt.Sprintf("%s[%d]", path, j))
+			if err != nil {
+				return err
+			}
+			list.Append(value)
+		}
+	}
+	return nil
+}
+
+// value converts a JSON value to the protobuf value of the column
+func (e *rowEncoder) value(fd protoreflect.FieldDescriptor, fs *bigquery.FieldSchema, v any, path string) (protoreflect.Value, error) {
+	switch fs.Type {
+	case bigquery.RecordFieldType:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return protoreflect.Value{}, fmt.Errorf("column %s: expected an object, got %T", path, v)
+		}
+		sub := dynamicpb.NewMessage(fd.Message())
+		if err := e.fill(sub, fs.Schema, obj, path+".", false); err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfMessage(sub), nil
+	case bigquery.StringFieldType:
+		s, err := e.str(v, path)
+		return protoreflect.ValueOfString(s), err
+	case bigquery.JSONFieldType:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("column %s: %w", path, err)
+		}
+		return protoreflect.ValueOfString(string(data)), nil
+	case bigquery.GeographyFieldType:
+		if s, ok := v.(string); ok {
+			return protoreflect.ValueOfString(s), nil
+		}
+		if !e.coerce {
+			return protoreflect.Value{}, fmt.Errorf("column %s: expected a WKT string, got %T", path, v)
+		}
+		wkt, err := toWKT(v)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("column %s: %w", path, err)
+		}
+		return protoreflect.ValueOfString(wkt), nil
+	case bigquery.BytesFieldType:
+		s, ok := v.(string)
+		if !ok {
+			return protoreflect.Value{}, fmt.Errorf("column %s: expected a base64 string, got %T", path, v)
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("column %s: invalid base64: %w", path, err)
+		}
+		return protoreflect.ValueOfBytes(data), nil
+	case bigquery.IntegerFieldType:
+		n, err := e.integer(v, path)
+		return protoreflect.ValueOfInt64(n), err
+	case bigquery.FloatFieldType:
+		f, err := e.float(v, path)
+		return protoreflect.ValueOfFloat64(f), err
+	case bigquery.BooleanFieldType:
+		b, err := e.boolean(v, path)
+		return protoreflect.ValueOfBool(b), err
+	case bigquery.TimestampFieldType:
+		t, err := e.timestamp(v, path)
+		return protoreflect.ValueOfInt64(t.UnixMicro()), err
+	case bigquery.DateFieldType:
+		t, err := e.date(v, path)
+		return protoreflect.ValueOfInt32(int32(t.Unix() / 86400)), err //nolint:gosec // days fit in int32
+	case bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		s, err := e.numeric(v, path)
+		return protoreflect.ValueOfString(s), err
+	case bigquery.DateTimeFieldType:
+		s, err := e.datetime(v, path)
+		return protoreflect.ValueOfString(s), err
+	case bigquery.TimeFieldType:
+		s, ok := v.(string)
+		if !ok {
+			return protoreflect.Value{}, fmt.Errorf("column %s: expected a time string, got %T", path, v)
+		}
+		return protoreflect.ValueOfString(s), nil
+	}
+	return protoreflect.Value{}, fmt.Errorf("column %s: unsupported type %s", path, fs.Type)
+}
+
+func (e *rowEncoder) str(v any, path string) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case json.Number:
+		if e.coerce {
+			return t.String(), nil
+		}
+	case bool:
+		if e.coerce {
+			return strconv.FormatBool(t), nil
+		}
+	}
+	return "", fmt.Errorf("column %s: expected a string, got %T", path, v)
+}
+
+func (e *rowEncoder) integer(v any, path string) (int64, error) {
+	var s string
+	switch t := v.(type) {
+	case json.Number:
+		s = t.String()
+	case string:
+		if !e.coerce {
+			return 0, fmt.Errorf("column %s: expected an integer, got a string", path)
+		}
+		s = t
+	default:
+		return 0, fmt.Errorf("column %s: expected an integer, got %T", path, v)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil && e.coerce {
+		// Integral floats, e.g. 3.0 or 1e3
+		if f, ferr := strconv.ParseFloat(s, 64); ferr == nil && f == float64(int64(f)) {
+			return int64(f), nil
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("column %s: invalid integer %q", path, s)
+	}
+	return n, nil
+}
+
+func (e *rowEncoder) float(v any, path string) (float64, error) {
+	var s string
+	switch t := v.(type) {
+	case json.Number:
+		s = t.String()
+	case string:
+		if !e.coerce {
+			return 0, fmt.Errorf("column %s: expected a number, got a string", path)
+		}
+		s = t
+	default:
+		return 0, fmt.Errorf("column %s: expected a number, got %T", path, v)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("column %s: invalid number %q", path, s)
+	}
+	return f, nil
+}
+
+func (e *rowEncoder) boolean(v any, path string) (bool, error) {
+	switch t := v.(type) {
+	case bool:
+		return t, nil
+	case string:
+		if e.coerce {
+			if b, err := strconv.ParseBool(t); err == nil {
+				return b, nil
+			}
+		}
+	case json.Number:
+		if e.coerce && (t == "0" || t == "1") {
+			return t == "1", nil
+		}
+	}
+	return false, fmt.Errorf("column %s: expected a boolean, got %v", path, v)
+}
+
+// timestamp accepts RFC 3339 strings and epoch numbers in the configured unit;
+// with coercion, also numeric strings and the other timestampLayouts (UTC without zone)
+func (e *rowEncoder) timestamp(v any, path string) (time.Time, error) {
+	switch t := v.(type) {
+	case json.Number:
+		return e.epoch(t.String(), path)
+	case string:
+		if ts, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return ts, nil
+		}
+		if e.coerce {
+			for _, layout := range timestampLayouts {
+				if ts, err := time.Parse(layout, t); err == nil {
+					return ts, nil
+				}
+			}
+			if _, err := strconv.ParseFloat(t, 64); err == nil {
+				return e.epoch(t, path)
+			}
+		}
+		return time.Time{}, fmt.Errorf("column %s: invalid timestamp %q", path, t)
+	}
+	return time.Time{}, fmt.Errorf("column %s: expected a timestamp, got %T", path, v)
+}
+
+func (e *rowEncoder) epoch(s string, path string) (time.Time, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		// Fractional seconds or milliseconds
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil || (e.epochUnit != epochSeconds && e.epochUnit != epochMilliseconds) {
+			return time.Time{}, fmt.Errorf("column %s: invalid epoch %q", path, s)
+		}
+		if e.epochUnit == epochSeconds {
+			return time.UnixMicro(int64(f * 1e6)), nil
+		}
+		return time.UnixMicro(int64(f * 1e3)), nil
+	}
+	switch e.epochUnit {
+	case epochSeconds:
+		return time.Unix(n, 0), nil
+	case epochMilliseconds:
+		return time.UnixMilli(n), nil
+	case epochNanoseconds:
+		return time.Unix(0, n), nil
+	default:
+		return time.UnixMicro(n), nil
+	}
+}
+
+// date accepts "YYYY-MM-DD" strings; with coercion, also the dates of timestamps in UTC
+func (e *rowEncoder) date(v any, path string) (time.Time, error) {
+	if s, ok := v.(string); ok {
+		if d, err := time.Parse(time.DateOnly, s); err == nil {
+			return d, nil
+		}
+	}
+	if e.coerce {
+		if ts, err := e.timestamp(v, path); err == nil {
+			y, m, d := ts.UTC().Date()
+			return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("column %s: invalid date %v", path, v)
+}
+
+func (e *rowEncoder) numeric(v any, path string) (string, error) {
+	var s string
+	switch t := v.(type) {
+	case json.Number:
+		s = t.String()
+	case string:
+		s = t
+	default:
+		return "", fmt.Errorf("column %s: expected a number, got %T", path, v)
+	}
+	if _, ok := new(big.Rat).SetString(s); !ok {
+		return "", fmt.Errorf("column %s: invalid numeric %q", path, s)
+	}
+	return s, nil
+}
+
+// datetime accepts civil date-times; with coercion, timestamps with a zone are converted to UTC
+func (e *rowEncoder) datetime(v any, path string) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("column %s: expected a datetime string, got %T", path, v)
+	}
+	if e.coerce {
+		if ts, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return ts.UTC().Format("2006-01-02 15:04:05.999999"), nil
+		}
+	}
+	return s, nil
+}
+
+// toWKT converts GeoJSON geometries and features, and objects with lat/lon (or
+// latitude/longitude, lng) keys, to their Well-Known Text representation
+func toWKT(v any) (string, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("expected a geography, got %T", v)
+	}
+	if typ, ok := obj["type"].(string); ok {
+		if typ == "Feature" {
+			return toWKT(obj["geometry"])
+		}
+		return geoJSONToWKT(typ, obj["coordinates"])
+	}
+
+	lat, latOK := firstKey(obj, "lat", "latitude")
+	lon, lonOK := firstKey(obj, "lon", "lng", "longitude")
+	if !latOK || !lonOK {
+		return "", fmt.Errorf("expected a GeoJSON geometry or lat/lon keys")
+	}
+	return fmt.Sprintf("POINT(%s %s)", lon, lat), nil
+}
+
+func firstKey(obj map[string]any, keys ...string) (string, bool) {
+	for _, k := range keys {
+		if n, ok := obj[k].(json.Number); ok {
+			return n.String(), true
+		}
+	}
+	return "", false
+}
+
+func geoJSONToWKT(typ string, coords any) (string, error) {
+	var body string
+	var err error
+	switch typ {
+	case "Point":
+		body, err = wktPosition(coords)
+	case "MultiPoint", "LineString":
+		body, err = wktList(coords, 1)
+	case "MultiLineString", "Polygon":
+		body, err = wktList(coords, 2)
+	case "MultiPolygon":
+		body, err = wktList(coords, 3)
+	default:
+		return "", fmt.Errorf("unsupported GeoJSON type %q", typ)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(typ) + "(" + body + ")", nil
+}
+
+// wktList formats nested coordinate arrays, depth being the nesting above the positions
+func wktList(coords any, depth int) (string, error) {
+	items, ok := coords.([]any)
+	if !ok || len(items) == 0 {
+		return "", fmt.Errorf("invalid GeoJSON coordinates")
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		var err error
+		if depth == 1 {
+			parts[i], err = wktPosition(item)
+		} else {
+			parts[i], err = wktList(item, depth-1)
+			parts[i] = "(" + parts[i] + ")"
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+func wktPosition(coords any) (string, error) {
+	pos, ok := coords.([]any)
+	if !ok || len(pos) < 2 {
+		return "", fmt.Errorf("invalid GeoJSON position")
+	}
+	lon, lonOK := pos[0].(json.Number)
+	lat, latOK := pos[1].(json.Number)
+	if !lonOK || !latOK {
+		return "", fmt.Errorf("invalid GeoJSON position")
+	}
+	return lon.String() + " " + lat.String(), nil
+}
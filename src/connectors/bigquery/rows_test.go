@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var testSchema = bigquery.Schema{
+	{Name: "id", Type: bigquery.IntegerFieldType, Required: true},
+	{Name: "name", Type: bigquery.StringFieldType},
+	{Name: "score", Type: bigquery.FloatFieldType},
+	{Name: "active", Type: bigquery.BooleanFieldType},
+	{Name: "created", Type: bigquery.TimestampFieldType},
+	{Name: "day", Type: bigquery.DateFieldType},
+	{Name: "amount", Type: bigquery.NumericFieldType},
+	{Name: "location", Type: bigquery.GeographyFieldType},
+	{Name: "attrs", Type: bigquery.JSONFieldType},
+	{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	{Name: "address", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+		{Name: "city", Type: bigquery.StringFieldType},
+		{Name: "zip", Type: bigquery.IntegerFieldType},
+	}},
+}
+
+func decodeObject(t *testing.T, s string) map[string]any {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+// decodeRow returns the fields of an encoded row by column name
+func decodeRow(t *testing.T, e *rowEncoder, row []byte) protoreflect.Message {
+	t.Helper()
+	msg := dynamicpb.NewMessage(e.descriptor)
+	if err := proto.Unmarshal(row, msg); err != nil {
+		t.Fatalf("invalid row: %v", err)
+	}
+	return msg
+}
+
+func field(msg protoreflect.Message, name string) protoreflect.Value {
+	return msg.Get(msg.Descriptor().Fields().ByName(protoreflect.Name(name)))
+}
+
+func TestRowEncoder(t *testing.T) {
+	e, dp, err := newRowEncoder(testSchema, map[string]string{"name": "user.name"}, false, epochMicroseconds)
+	if err != nil {
+		t.Fatalf("newRowEncoder() unexpected error = %v", err)
+	}
+	if len(dp.GetField()) != len(testSchema) {
+		t.Errorf("descriptor has %d fields, want %d", len(dp.GetField()), len(testSchema))
+	}
+
+	row, err := e.Encode(decodeObject(t, `{
+		"ID": 9007199254740993,
+		"user": {"name": "ada"},
+		"score": 1.5,
+		"active": true,
+		"created": "2024-03-01T10:00:00.5Z",
+		"day": "2024-03-01",
+		"amount": 12.345,
+		"location": "POINT(9.19 45.46)",
+		"attrs": {"a": [1, 2]},
+		"tags": ["x", "y"],
+		"address": {"city": "Milan", "zip": 20121}
+	}`))
+	if err != nil {
+		t.Fatalf("Encode() unexpected error = %v", err)
+	}
+	msg := decodeRow(t, e, row)
+
+	created := time.Date(2024, 3, 1, 10, 0, 0, 500000000, time.UTC)
+	if got := field(msg, "id").Int(); got != 9007199254740993 {
+		t.Errorf("id = %d", got)
+	}
+	if got := field(msg, "name").String(); got != "ada" {
+		t.Errorf("mapped name = %q", got)
+	}
+	if got := field(msg, "created").Int(); got != created.UnixMicro() {
+		t.Errorf("created = %d, want %d", got, created.UnixMicro())
+	}
+	if got := field(msg, "day").Int(); got != 19783 {
+		t.Errorf("day = %d, want 19783", got)
+	}
+	if got := field(msg, "amount").String(); got != "12.345" {
+		t.Errorf("amount = %q", got)
+	}
+	if got := field(msg, "attrs").String(); got != `{"a":[1,2]}` {
+		t.Errorf("attrs = %q", got)
+	}
+	if got := field(msg, "tags").List(); got.Len() != 2 || got.Get(1).String() != "y" {
+		t.Errorf("unexpected tags")
+	}
+	if got := field(msg, "address").Message(); field(got, "city").String() != "Milan" || field(got, "zip").Int() != 20121 {
+		t.Errorf("unexpected address")
+	}
+}
+
+func TestRowEncoderErrors(t *testing.T) {
+	e, _, err := newRowEncoder(testSchema, nil, false, epochMicroseconds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{
+		`{"name": "missing id"}`,
+		`{"id": "1"}`,
+		`{"id": 1, "created": "yesterday"}`,
+		`{"id": 1, "amount": "abc"}`,
+		`{"id": 1, "tags": "x"}`,
+		`{"id": 1, "location": {"lat": 1, "lon": 2}}`,
+		`{"id": 1, "address": "Milan"}`,
+	} {
+		if _, err := e.Encode(decodeObject(t, payload)); err == nil {
+			t.Errorf("Encode(%s) expected error", payload)
+		}
+	}
+
+	if _, _, err := newRowEncoder(testSchema, map[string]string{"unknown": "x"}, false, epochMicroseconds); err == nil {
+		t.Error("newRowEncoder() expected error for an unknown mapped column")
+	}
+}
+
+func TestRowEncoderCoerce(t *testing.T) {
+	e, _, err := newRowEncoder(testSchema, nil, true, epochMilliseconds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := e.Encode(decodeObject(t, `{
+		"id": "42",
+		"name": 7,
+		"active": "true",
+		"created": 1709287200000,
+		"day": "2024-03-01T23:30:00Z",
+		"location": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}},
+		"tags": "single"
+	}`))
+	if err != nil {
+		t.Fatalf("Encode() unexpected error = %v", err)
+	}
+	msg := decodeRow(t, e, row)
+	if field(msg, "id").Int() != 42 || field(msg, "name").String() != "7" || !field(msg, "active").Bool() {
+		t.Errorf("unexpected coerced scalars")
+	}
+	if got := field(msg, "created").Int(); got != 1709287200000*1000 {
+		t.Errorf("created = %d", got)
+	}
+	if got := field(msg, "day").Int(); got != 19783 {
+		t.Errorf("day = %d, want 19783", got)
+	}
+	if got := field(msg, "location").String(); got != "POLYGON((0 0, 1 0, 1 1, 0 0))" {
+		t.Errorf("location = %q", got)
+	}
+	if got := field(msg, "tags").List(); got.Len() != 1 {
+		t.Errorf("tags has %d elements", got.Len())
+	}
+
+	for in, want := range map[string]string{
+		`{"lat": 45.46, "lng": 9.19}`:                          "POINT(9.19 45.46)",
+		`{"type": "Point", "coordinates": [9.19, 45.46]}`:      "POINT(9.19 45.46)",
+		`{"type": "LineString", "coordinates": [[0,0],[1,1]]}`: "LINESTRING(0 0, 1 1)",
+	} {
+		if got, err := toWKT(decodeObject(t, in)); err != nil || got != want {
+			t.Errorf("toWKT(%s) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AD structure types of the advertisement data (Bluetooth Assigned Numbers)
+const (
+	adFlags            = 0x01
+	adUUID16Incomplete = 0x02
+	adUUID16Complete   = 0x03
+	adUUID128Incomp    = 0x06
+	adUUID128Complete  = 0x07
+	adNameShort        = 0x08
+	adNameComplete     = 0x09
+	adTxPower          = 0x0A
+	adServiceData16    = 0x16
+	adManufacturerData = 0xFF
+)
+
+// advertisement event types of the LE Advertising Report
+var eventTypes = map[byte]string{
+	0x00: "ADV_IND",
+	0x01: "ADV_DIRECT_IND",
+	0x02: "ADV_SCAN_IND",
+	0x03: "ADV_NONCONN_IND",
+	0x04: "SCAN_RSP",
+}
+
+// Advertisement is a received advertisement frame
+type Advertisement struct {
+	Address          string            `json:"address"`
+	AddressType      string            `json:"addressType"`
+	EventType        string            `json:"eventType"`
+	RSSI             int               `json:"rssi"`
+	Name             string            `json:"name,omitempty"`
+	TxPower          *int              `json:"txPower,omitempty"`
+	Flags            *int              `json:"flags,omitempty"`
+	ServiceUUIDs     []string          `json:"serviceUuids,omitempty"`
+	ManufacturerID   *int              `json:"manufacturerId,omitempty"`
+	ManufacturerData string            `json:"manufacturerData,omitempty"`
+	ServiceData      map[string]string `json:"serviceData,omitempty"`
+	Decoder          string            `json:"decoder,omitempty"`
+	Decoded          map[string]any    `json:"decoded,omitempty"`
+	Timestamp        time.Time         `json:"timestamp"`
+
+	// raw advertisement data, for the deduplication
+	raw []byte
+	// raw manufacturer data (without the company id) and service data, for the decoders
+	manufacturer []byte
+	services     map[string][]byte
+}
+
+// parseAdvertisingReport parses the parameters of an HCI LE Advertising Report event
+// (after the subevent code): one or more reports, each with its advertisement data
+func parseAdvertisingReport(b []byte, now time.Time) ([]*Advertisement, error) {
+	if len(b) < 1 {
+		return nil, errors.New("empty advertising report")
+	}
+	n := int(b[0])
+	b = b[1:]
+	res := make([]*Advertisement, 0, n)
+	for range n {
+		// event type, address type, address, data length
+		if len(b) < 9 {
+			return nil, errors.New("truncated advertising report")
+		}
+		dataLen := int(b[8])
+		if len(b) < 9+dataLen+1 {
+			return nil, errors.New("truncated advertising data")
+		}
+		adv := &Advertisement{
+			Address:     formatAddress(b[2:8]),
+			AddressType: "public",
+			EventType:   eventTypes[b[0]],
+			RSSI:        int(int8(b[9+dataLen])),
+			Timestamp:   now,
+			raw:         append([]byte(nil), b[9:9+dataLen]...),
+		}
+		if b[1] != 0 {
+			adv.AddressType = "random"
+		}
+		// The data is parsed from the copy: the read buffer is reused
+		if err := adv.parseData(adv.raw); err != nil {
+			return nil, fmt.Errorf("invalid advertising data of %s: %w", adv.Address, err)
+		}
+		res = append(res, adv)
+		b = b[9+dataLen+1:]
+	}
+	return res, nil
+}
+
+// formatAddress formats a little-endian device address as AA:BB:CC:DD:EE:FF
+func formatAddress(b []byte) string {
+	parts := make([]string, len(b))
+	for i := range b {
+		parts[len(b)-1-i] = fmt.Sprintf("%02X", b[i])
+	}
+	return strings.Join(parts, ":")
+}
+
+// parseData parses the AD structures of the advertisement data
+func (a *Advertisement) parseData(data []byte) error {
+	for len(data) > 0 {
+		l := int(data[0])
+		if l == 0 {
+			// Significant part terminated, the rest is padding
+			return nil
+		}
+		if len(data) < l+1 {
+			return errors.New("truncated AD structure")
+		}
+		typ, value := data[1], data[2:l+1]
+		data = data[l+1:]
+
+		switch typ {
+		case adFlags:
+			if len(value) > 0 {
+				flags := int(value[0])
+				a.Flags = &flags
+			}
+		case adUUID16Incomplete, adUUID16Complete:
+			for i := 0; i+2 <= len(value); i += 2 {
+				a.ServiceUUIDs = append(a.ServiceUUIDs, uuid16(value[i:i+2]))
+			}
+		case adUUID128Incomp, adUUID128Complete:
+			for i := 0; i+16 <= len(value); i += 16 {
+				a.ServiceUUIDs = append(a.ServiceUUIDs, uuid128(value[i:i+16]))
+			}
+		case adNameShort, adNameComplete:
+			if a.Name == "" || typ == adNameComplete {
+				a.Name = string(value)
+			}
+		case adTxPower:
+			if len(value) > 0 {
+				tx := int(int8(value[0]))
+				a.TxPower = &tx
+			}
+		case adServiceData16:
+			if len(value) >= 2 {
+				if a.services == nil {
+					a.services = map[string][]byte{}
+					a.ServiceData = map[string]string{}
+				}
+				uuid := uuid16(value[:2])
+				a.services[uuid] = value[2:]
+				a.ServiceData[uuid] = hex.EncodeToString(value[2:])
+			}
+		case adManufacturerData:
+			if len(value) >= 2 {
+				id := int(binary.LittleEndian.Uint16(value[:2]))
+				a.ManufacturerID = &id
+				a.manufacturer = value[2:]
+				a.ManufacturerData = hex.EncodeToString(value[2:])
+			}
+		}
+	}
+	return nil
+}
+
+// uuid16 formats a little-endian 16-bit service UUID as 4 hex digits, e.g. "180f"
+func uuid16(b []byte) string {
+	return fmt.Sprintf("%04x", binary.LittleEndian.Uint16(b))
+}
+
+// uuid128 formats a little-endian 128-bit service UUID in the canonical form
+func uuid128(b []byte) string {
+	r := make([]byte, 16)
+	for i := range b {
+		r[15-i] = b[i]
+	}
+	h := hex.EncodeToString(r)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &BLEMessage{}
+
+// BLEMessage is a received advertisement
+type BLEMessage struct {
+	adv *Advertisement
+}
+
+func (m *BLEMessage) GetID() []byte {
+	return []byte(m.adv.Address + "/" + strconv.FormatInt(m.adv.Timestamp.UnixNano(), 10))
+}
+
+func (m *BLEMessage) GetMetadata() (map[string]string, error) {
+	meta := map[string]string{
+		"address":   m.adv.Address,
+		"rssi":      strconv.Itoa(m.adv.RSSI),
+		"eventType": m.adv.EventType,
+	}
+	if m.adv.Name != "" {
+		meta["name"] = m.adv.Name
+	}
+	if m.adv.Decoder != "" {
+		meta["decoder"] = m.adv.Decoder
+	}
+	return meta, nil
+}
+
+func (m *BLEMessage) GetData() ([]byte, error) {
+	return json.Marshal(m.adv)
+}
+
+func (m *BLEMessage) Ack(data *message.ReplyData) error {
+	// Advertisements don't support reply
+	return nil
+}
+
+func (m *BLEMessage) Nak() error {
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	// scanUnit is the unit of the scan interval and window
+	scanUnit = 625 * time.Microsecond
+	// maxDedupEntries bounds the devices tracked by the deduplication
+	maxDedupEntries = 4096
+)
+
+// FilterConfig selects advertisements: every set criterion must match
+type FilterConfig struct {
+	// Addresses are device addresses (AA:BB:CC:DD:EE:FF, case insensitive)
+	Addresses []string `mapstructure:"addresses" validate:"dive,mac"`
+	// NamePrefix matches the start of the advertised local name
+	NamePrefix string `mapstructure:"namePrefix"`
+	// ManufacturerID matches the company id of the manufacturer data
+	ManufacturerID *int `mapstructure:"manufacturerId" validate:"omitempty,min=0,max=65535"`
+	// ServiceUUID matches an advertised service UUID or a service data UUID (e.g. "180f")
+	ServiceUUID string `mapstructure:"serviceUuid"`
+	// MinRSSI drops the advertisements received with a lower signal strength (dBm, 0 = no limit)
+	MinRSSI int `mapstructure:"minRssi" validate:"min=-127,max=0"`
+}
+
+// SourceConfig defines the configuration for the Bluetooth LE scanner source connector
+type SourceConfig struct {
+	// Device is the index of the HCI adapter (0 = hci0)
+	Device int `mapstructure:"device" default:"0" validate:"min=0,max=65535"`
+	// Active enables active scanning: the scan responses, often holding the device name, are requested
+	Active bool `mapstructure:"active"`
+	// Interval is the scan interval (2.5ms to 10.24s)
+	Interval time.Duration `mapstructure:"interval" default:"100ms" validate:"min=2.5ms,max=10.24s"`
+	// Window is the scan duration of every interval (2.5ms to Interval)
+	Window time.Duration `mapstructure:"window" default:"100ms" validate:"min=2.5ms,ltefield=Interval"`
+	// Filters select the advertisements, any filter matching (all advertisements if empty)
+	Filters []FilterConfig `mapstructure:"filters" validate:"dive"`
+	// Decoders decode the manufacturer or service data; the first matching decoder applies
+	Decoders []DecoderConfig `mapstructure:"decoders" validate:"dive"`
+	// Dedup drops the advertisements of a device repeating its previous data within this
+	// interval, RSSI changes aside (0 disables)
+	Dedup time.Duration `mapstructure:"dedup" default:"1s" validate:"min=0"`
+	// RestartDelay is the wait before scanning again after an adapter error
+	RestartDelay time.Duration `mapstructure:"restartDelay" default:"5s" validate:"gt=0"`
+}
+
+// scanParams are the scan settings of the adapter
+type scanParams struct {
+	device   int
+	active   bool
+	interval uint16
+	window   uint16
+	logger   *slog.Logger
+}
+
+// scanFunc scans the advertisements
+type scanFunc func(ctx context.Context, p scanParams, emit func(*Advertisement) bool) error
+
+// seenAdvertisement is the last advertisement data of a device
+type seenAdvertisement struct {
+	data string
+	at   time.Time
+}
+
+type BLESource struct {
+	cfg    *SourceConfig
+	slog   *slog.Logger
+	scan   scanFunc
+	seen   map[string]seenAdvertisement
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	c      chan *message.RunnerMessage
+}
+
+func NewSourceConfig() any {
+	return new(SourceConfig)
+}
+
+// NewSource creates a Bluetooth LE scanner source from config
+func NewSource(anyCfg any) (connectors.Source, error) {
+	cfg, ok := anyCfg.(*SourceConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	if !supported {
+		return nil, errors.New("the BLE source is only supported on Linux")
+	}
+	return newBLESource(cfg, scan)
+}
+
+func newBLESource(cfg *SourceConfig, scan scanFunc) (*BLESource, error) {
+	for i := range cfg.Filters {
+		f := &cfg.Filters[i]
+		for j, addr := range f.Addresses {
+			f.Addresses[j] = strings.ToUpper(addr)
+		}
+		f.ServiceUUID = strings.ToLower(f.ServiceUUID)
+	}
+	for i := range cfg.Decoders {
+		if err := cfg.Decoders[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	return &BLESource{
+		cfg:  cfg,
+		slog: slog.Default().With("context", "BLE Source"),
+		scan: scan,
+		seen: make(map[string]seenAdvertisement),
+	}, nil
+}
+
+func (s *BLESource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	if s.c != nil {
+		return nil, errors.New("produce already called")
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.c = make(chan *message.RunnerMessage, buffer)
+
+	s.slog.Info("starting BLE scanner", "device", s.cfg.Device, "active", s.cfg.Active, "filters", len(s.cfg.Filters), "decoders", len(s.cfg.Decoders))
+
+	s.wg.Add(1)
+	go s.run()
+	return s.c, nil
+}
+
+// run scans the advertisements, scanning again after adapter errors
+func (s *BLESource) run() {
+	defer s.wg.Done()
+	params := scanParams{
+		device:   s.cfg.Device,
+		active:   s.cfg.Active,
+		interval: uint16(s.cfg.Interval / scanUnit), //nolint:gosec // validated range
+		window:   uint16(s.cfg.Window / scanUnit),   //nolint:gosec // validated range
+		logger:   s.slog,
+	}
+
+	for {
+		err := s.scan(s.ctx, params, s.emit)
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.slog.Error("BLE scan failed, scanning again", "device", s.cfg.Device, "error", err, "delay", s.cfg.RestartDelay)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(s.cfg.RestartDelay):
+		}
+	}
+}
+
+// emit filters, deduplicates and decodes an advertisement and produces its message
+func (s *BLESource) emit(adv *Advertisement) bool {
+	if !s.matches(adv) || s.duplicate(adv) {
+		return true
+	}
+	for i := range s.cfg.Decoders {
+		d := &s.cfg.Decoders[i]
+		data, ok := d.data(adv)
+		if !ok {
+			continue
+		}
+		decoded, err := d.decode(data)
+		if err != nil {
+			s.slog.Debug("advertisement not decoded", "address", adv.Address, "decoder", d.Name, "error", err)
+			continue
+		}
+		adv.Decoder = d.Name
+		adv.Decoded = decoded
+		break
+	}
+
+	select {
+	case s.c <- message.NewRunnerMessage(&BLEMessage{adv: adv}):
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// matches reports whether any filter selects the advertisement
+func (s *BLESource) matches(adv *Advertisement) bool {
+	if len(s.cfg.Filters) == 0 {
+		return true
+	}
+	for _, f := range s.cfg.Filters {
+		if f.matches(adv) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FilterConfig) matches(adv *Advertisement) bool {
+	if len(f.Addresses) > 0 && !slices.Contains(f.Addresses, adv.Address) {
+		return false
+	}
+	if f.NamePrefix != "" && !strings.HasPrefix(adv.Name, f.NamePrefix) {
+		return false
+	}
+	if f.ManufacturerID != nil && (adv.ManufacturerID == nil || *adv.ManufacturerID != *f.ManufacturerID) {
+		return false
+	}
+	if f.ServiceUUID != "" {
+		if _, ok := adv.ServiceData[f.ServiceUUID]; !ok && !slices.Contains(adv.ServiceUUIDs, f.ServiceUUID) {
+			return false
+		}
+	}
+	return f.MinRSSI == 0 || adv.RSSI >= f.MinRSSI
+}
+
+// duplicate reports whether the device advertised the same data within the dedup interval
+func (s *BLESource) duplicate(adv *Advertisement) bool {
+	if s.cfg.Dedup <= 0 {
+		return false
+	}
+	key := adv.Address + "/" + adv.EventType
+	data := string(adv.raw)
+	if prev, ok := s.seen[key]; ok && prev.data == data && adv.Timestamp.Sub(prev.at) < s.cfg.Dedup {
+		return true
+	}
+	if len(s.seen) >= maxDedupEntries {
+		for k, v := range s.seen {
+			if adv.Timestamp.Sub(v.at) >= s.cfg.Dedup {
+				delete(s.seen, k)
+			}
+		}
+	}
+	s.seen[key] = seenAdvertisement{data: data, at: adv.Timestamp}
+	return false
+}
+
+func (s *BLESource) Close() error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	s.wg.Wait()
+	close(s.c)
+	s.cancel = nil
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+// ruuviReport is an LE Advertising Report of a RuuviTag (data format 5) named "Ruuvi"
+// with address C8:25:2D:8E:9C:2C and RSSI -70
+const ruuviReport = "01" + "00" + "01" + "2c9c8e2d25c8" + "26" +
+	"020106" +
+	"1bff9904" + "0512fc5394c37c0004fffc040cac364200cdcbb8334c884f" +
+	"06095275757669" +
+	"ba"
+
+func report(t *testing.T, s string) []*Advertisement {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	advs, err := parseAdvertisingReport(b, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatalf("parseAdvertisingReport() unexpected error = %v", err)
+	}
+	return advs
+}
+
+func newTestSource(t *testing.T, opts map[string]any, scan scanFunc) *BLESource {
+	t.Helper()
+	cfg := new(SourceConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("ParseConfig() unexpected error = %v", err)
+	}
+	s, err := newBLESource(cfg, scan)
+	if err != nil {
+		t.Fatalf("newBLESource() unexpected error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestParseAdvertisingReport(t *testing.T) {
+	advs := report(t, ruuviReport)
+	if len(advs) != 1 {
+		t.Fatalf("reports = %d", len(advs))
+	}
+	adv := advs[0]
+	if adv.Address != "C8:25:2D:8E:9C:2C" || adv.AddressType != "random" || adv.EventType != "ADV_IND" || adv.RSSI != -70 {
+		t.Errorf("header = %s %s %s %d", adv.Address, adv.AddressType, adv.EventType, adv.RSSI)
+	}
+	if adv.Name != "Ruuvi" || adv.Flags == nil || *adv.Flags != 6 {
+		t.Errorf("name = %q, flags = %v", adv.Name, adv.Flags)
+	}
+	if adv.ManufacturerID == nil || *adv.ManufacturerID != 0x0499 || adv.ManufacturerData[:6] != "0512fc" {
+		t.Errorf("manufacturer = %v %s", adv.ManufacturerID, adv.ManufacturerData)
+	}
+
+	// Service UUIDs, service data and TX power
+	advs = report(t, "01"+"03"+"00"+"010203040506"+"0d"+"0303aafe"+"0516aafe1000"+"020af4"+"c4")
+	adv = advs[0]
+	if adv.AddressType != "public" || adv.EventType != "ADV_NONCONN_IND" {
+		t.Errorf("header = %s %s", adv.AddressType, adv.EventType)
+	}
+	if len(adv.ServiceUUIDs) != 1 || adv.ServiceUUIDs[0] != "feaa" || adv.ServiceData["feaa"] != "1000" {
+		t.Errorf("services = %v %v", adv.ServiceUUIDs, adv.ServiceData)
+	}
+	if adv.TxPower == nil || *adv.TxPower != -12 {
+		t.Errorf("tx power = %v", adv.TxPower)
+	}
+
+	for _, s := range []string{"", "01", "0100010102030405060a0201"} {
+		b, _ := hex.DecodeString(s)
+		if _, err := parseAdvertisingReport(b, time.Now()); err == nil {
+			t.Errorf("parseAdvertisingReport(%s) expected error", s)
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	id := 0x0499
+	d := DecoderConfig{
+		Name:           "ruuvi",
+		ManufacturerID: &id,
+		Prefix:         "05",
+		Fields: []FieldConfig{
+			{Name: "temperature", Offset: 1, Type: "int16be", Scale: 0.005},
+			{Name: "humidity", Offset: 3, Type: "uint16be", Scale: 0.0025},
+			{Name: "pressure", Offset: 5, Type: "uint16be", Add: 50000},
+			{Name: "mac", Offset: 18, Length: 6, Type: "hex"},
+		},
+	}
+	if err := d.compile(); err != nil {
+		t.Fatal(err)
+	}
+	data, ok := d.data(report(t, ruuviReport)[0])
+	if !ok {
+		t.Fatal("decoder does not apply")
+	}
+	got, err := d.decode(data)
+	if err != nil {
+		t.Fatalf("decode() unexpected error = %v", err)
+	}
+	if math.Abs(got["temperature"].(float64)-24.3) > 1e-9 || math.Abs(got["humidity"].(float64)-53.49) > 1e-9 {
+		t.Errorf("decoded = %v", got)
+	}
+	if got["pressure"] != float64(100044) || got["mac"] != "cbb8334c884f" {
+		t.Errorf("decoded = %v", got)
+	}
+
+	d.Prefix = "03"
+	_ = d.compile()
+	if _, ok := d.data(report(t, ruuviReport)[0]); ok {
+		t.Error("decoder applies with a different prefix")
+	}
+	d.Fields = []FieldConfig{{Name: "x", Offset: 23, Type: "uint16le"}}
+	if _, err := d.decode(data); err == nil {
+		t.Error("decode() expected error for a field out of the data")
+	}
+}
+
+func TestBLESource(t *testing.T) {
+	scan := func(ctx context.Context, p scanParams, emit func(*Advertisement) bool) error {
+		if p.interval != 160 || p.window != 48 || !p.active {
+			t.Errorf("scan params = %+v", p)
+		}
+		for _, r := range []string{ruuviReport, ruuviReport} {
+			adv := report(t, r)[0]
+			if !emit(adv) {
+				return nil
+			}
+		}
+		// Filtered out by the address
+		other := report(t, ruuviReport)[0]
+		other.Address = "00:11:22:33:44:55"
+		emit(other)
+		<-ctx.Done()
+		return nil
+	}
+	s := newTestSource(t, map[string]any{
+		"active":   true,
+		"interval": "100ms",
+		"window":   "30ms",
+		"filters":  []any{map[string]any{"addresses": []any{"c8:25:2d:8e:9c:2c"}, "minRssi": -80}},
+		"decoders": []any{map[string]any{
+			"name":           "ruuvi",
+			"manufacturerId": 0x0499,
+			"fields":         []any{map[string]any{"name": "temperature", "offset": 1, "type": "int16be", "scale": 0.005}},
+		}},
+	}, scan)
+
+	c, err := s.Produce(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg *message.RunnerMessage
+	select {
+	case msg = <-c:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message")
+	}
+	meta, _ := msg.GetMetadata()
+	if meta["address"] != "C8:25:2D:8E:9C:2C" || meta["rssi"] != "-70" || meta["decoder"] != "ruuvi" || meta["name"] != "Ruuvi" {
+		t.Errorf("metadata = %v", meta)
+	}
+	data, _ := msg.GetData()
+	var event map[string]any
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatal(err)
+	}
+	if decoded, _ := event["decoded"].(map[string]any); decoded["temperature"] != 24.3 {
+		t.Errorf("event = %s", data)
+	}
+
+	// The duplicate and the other device are dropped
+	select {
+	case msg := <-c:
+		d, _ := msg.GetData()
+		t.Errorf("unexpected message %s", d)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	adv := report(t, ruuviReport)[0]
+	id, otherID := 0x0499, 0x004c
+	for _, tc := range []struct {
+		filter FilterConfig
+		want   bool
+	}{
+		{FilterConfig{NamePrefix: "Ruu"}, true},
+		{FilterConfig{NamePrefix: "Tile"}, false},
+		{FilterConfig{ManufacturerID: &id}, true},
+		{FilterConfig{ManufacturerID: &otherID}, false},
+		{FilterConfig{ServiceUUID: "180f"}, false},
+		{FilterConfig{MinRSSI: -60}, false},
+		{FilterConfig{ManufacturerID: &id, MinRSSI: -70}, true},
+	} {
+		if got := tc.filter.matches(adv); got != tc.want {
+			t.Errorf("%+v matches() = %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func TestBLESourceDedup(t *testing.T) {
+	s := newTestSource(t, map[string]any{"dedup": "1s"}, nil)
+	adv := report(t, ruuviReport)[0]
+	if s.duplicate(adv) {
+		t.Error("first advertisement reported as duplicate")
+	}
+	again := report(t, ruuviReport)[0]
+	again.RSSI = -50
+	again.Timestamp = adv.Timestamp.Add(500 * time.Millisecond)
+	if !s.duplicate(again) {
+		t.Error("repeated advertisement not reported as duplicate")
+	}
+	again.Timestamp = adv.Timestamp.Add(time.Second)
+	if s.duplicate(again) {
+		t.Error("advertisement after the dedup interval reported as duplicate")
+	}
+	changed := report(t, ruuviReport)[0]
+	changed.raw = []byte{1}
+	changed.Timestamp = again.Timestamp
+	if s.duplicate(changed) {
+		t.Error("changed advertisement reported as duplicate")
+	}
+}
+
+func TestSourceConfigValidation(t *testing.T) {
+	for name, opts := range map[string]map[string]any{
+		"window larger than interval": {"interval": "50ms", "window": "60ms"},
+		"interval too short":          {"interval": "1ms", "window": "1ms"},
+		"invalid address":             {"filters": []any{map[string]any{"addresses": []any{"C8-25"}}}},
+		"decoder without data":        {"decoders": []any{map[string]any{"name": "x", "fields": []any{map[string]any{"name": "a", "type": "uint8"}}}}},
+		"invalid field type":          {"decoders": []any{map[string]any{"name": "x", "serviceUuid": "feaa", "fields": []any{map[string]any{"name": "a", "type": "int64"}}}}},
+	} {
+		if err := utils.ParseConfig(opts, new(SourceConfig)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
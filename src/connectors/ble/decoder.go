@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DecoderConfig is a template decoding the manufacturer or service data of the matching
+// advertisements into named fields, e.g. the temperature and humidity of a sensor beacon
+type DecoderConfig struct {
+	// Name identifies the decoder in the events
+	Name string `mapstructure:"name" validate:"required"`
+	// ManufacturerID selects the manufacturer data of the company id, e.g. 0x0499 (Ruuvi)
+	ManufacturerID *int `mapstructure:"manufacturerId" validate:"required_without=ServiceUUID,omitempty,min=0,max=65535"`
+	// ServiceUUID selects the service data of the 16-bit service UUID, e.g. "feaa" (Eddystone)
+	ServiceUUID string `mapstructure:"serviceUuid" validate:"omitempty,len=4,hexadecimal"`
+	// Prefix are the hex bytes the data must start with, e.g. the frame format "05"
+	Prefix string `mapstructure:"prefix" validate:"omitempty,hexadecimal"`
+	// Fields are the decoded fields
+	Fields []FieldConfig `mapstructure:"fields" validate:"required,min=1,dive"`
+
+	prefix []byte
+}
+
+// FieldConfig is a field at a fixed position of the data. Numeric values are multiplied
+// by Scale, then Add is added.
+type FieldConfig struct {
+	// Name is the field name in the decoded object
+	Name string `mapstructure:"name" validate:"required"`
+	// Offset is the position of the field in the data, in bytes
+	Offset int `mapstructure:"offset" validate:"min=0"`
+	// Type is uint8, int8, uint16le/be, int16le/be, uint32le/be, int32le/be, float32le/be or hex
+	Type string `mapstructure:"type" validate:"required,oneof=uint8 int8 uint16le uint16be int16le int16be uint32le uint32be int32le int32be float32le float32be hex"`
+	// Length is the number of bytes of the hex type (default: to the end of the data)
+	Length int `mapstructure:"length" validate:"min=0"`
+	// Scale multiplies numeric values (default: 1)
+	Scale float64 `mapstructure:"scale"`
+	// Add is added to numeric values after the scale
+	Add float64 `mapstructure:"add"`
+}
+
+// fieldSizes are the sizes of the numeric types
+var fieldSizes = map[string]int{
+	"uint8": 1, "int8": 1,
+	"uint16le": 2, "uint16be": 2, "int16le": 2, "int16be": 2,
+	"uint32le": 4, "uint32be": 4, "int32le": 4, "int32be": 4,
+	"float32le": 4, "float32be": 4,
+}
+
+// compile normalizes the decoder and decodes its prefix
+func (d *DecoderConfig) compile() error {
+	d.ServiceUUID = strings.ToLower(d.ServiceUUID)
+	prefix, err := hex.DecodeString(d.Prefix)
+	if err != nil {
+		return fmt.Errorf("invalid prefix of decoder %s: %w", d.Name, err)
+	}
+	d.prefix = prefix
+	return nil
+}
+
+// data returns the data of the advertisement the decoder applies to
+func (d *DecoderConfig) data(adv *Advertisement) ([]byte, bool) {
+	var data []byte
+	switch {
+	case d.ManufacturerID != nil:
+		if adv.ManufacturerID == nil || *adv.ManufacturerID != *d.ManufacturerID {
+			return nil, false
+		}
+		data = adv.manufacturer
+	default:
+		var ok bool
+		if data, ok = adv.services[d.ServiceUUID]; !ok {
+			return nil, false
+		}
+	}
+	return data, bytes.HasPrefix(data, d.prefix)
+}
+
+// decode decodes the fields of the data
+func (d *DecoderConfig) decode(data []byte) (map[string]any, error) {
+	res := make(map[string]any, len(d.Fields))
+	for _, f := range d.Fields {
+		if f.Type == "hex" {
+			end := len(data)
+			if f.Length > 0 {
+				end = f.Offset + f.Length
+			}
+			if f.Offset > len(data) || end > len(data) {
+				return nil, fmt.Errorf("field %s out of the data (%d bytes)", f.Name, len(data))
+			}
+			res[f.Name] = hex.EncodeToString(data[f.Offset:end])
+			continue
+		}
+
+		size := fieldSizes[f.Type]
+		if f.Offset+size > len(data) {
+			return nil, fmt.Errorf("field %s out of the data (%d bytes)", f.Name, len(data))
+		}
+		b := data[f.Offset : f.Offset+size]
+		var v float64
+		switch f.Type {
+		case "uint8":
+			v = float64(b[0])
+		case "int8":
+			v = float64(int8(b[0]))
+		case "uint16le":
+			v = float64(binary.LittleEndian.Uint16(b))
+		case "uint16be":
+			v = float64(binary.BigEndian.Uint16(b))
+		case "int16le":
+			v = float64(int16(binary.LittleEndian.Uint16(b)))
+		case "int16be":
+			v = float64(int16(binary.BigEndian.Uint16(b)))
+		case "uint32le":
+			v = float64(binary.LittleEndian.Uint32(b))
+		case "uint32be":
+			v = float64(binary.BigEndian.Uint32(b))
+		case "int32le":
+			v = float64(int32(binary.LittleEndian.Uint32(b)))
+		case "int32be":
+			v = float64(int32(binary.BigEndian.Uint32(b)))
+		case "float32le":
+			v = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		case "float32be":
+			v = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+		}
+		if f.Scale != 0 {
+			v *= f.Scale
+		}
+		res[f.Name] = v + f.Add
+	}
+	return res, nil
+}
@@ -0,0 +1,149 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const supported = true
+
+// HCI packets, events and LE controller commands (Bluetooth Core Specification, Vol 4 Part E)
+const (
+	hciCommandPkt       = 0x01
+	hciEventPkt         = 0x04
+	evtCmdComplete      = 0x0E
+	evtCmdStatus        = 0x0F
+	evtLEMeta           = 0x3E
+	leAdvertisingReport = 0x02
+
+	ogfLE                  = 0x08
+	ocfLESetScanParameters = 0x000B
+	ocfLESetScanEnable     = 0x000C
+
+	// hciFilter is the HCI_FILTER socket option of the SOL_HCI level
+	hciFilter = 2
+
+	commandTimeout = 2 * time.Second
+)
+
+// scan opens a raw HCI socket on the adapter, enables LE scanning and passes the received
+// advertisements to emit until ctx is done or emit returns false. It requires the
+// CAP_NET_RAW and CAP_NET_ADMIN capabilities.
+func scan(ctx context.Context, p scanParams, emit func(*Advertisement) bool) error {
+	fd, err := unix.Socket(unix.AF_BLUETOOTH, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.BTPROTO_HCI)
+	if err != nil {
+		return fmt.Errorf("failed to open HCI socket: %w", err)
+	}
+	defer unix.Close(fd) //nolint:errcheck
+
+	if err := unix.Bind(fd, &unix.SockaddrHCI{Dev: uint16(p.device), Channel: unix.HCI_CHANNEL_RAW}); err != nil { //nolint:gosec // validated device index
+		return fmt.Errorf("failed to bind HCI socket to hci%d: %w", p.device, err)
+	}
+
+	// Only the events of the command results and the LE meta events are received
+	var filter [16]byte
+	binary.LittleEndian.PutUint32(filter[0:], 1<<hciEventPkt)
+	binary.LittleEndian.PutUint32(filter[4:], 1<<evtCmdComplete|1<<evtCmdStatus)
+	binary.LittleEndian.PutUint32(filter[8:], 1<<(evtLEMeta-32))
+	if err := unix.SetsockoptString(fd, unix.SOL_HCI, hciFilter, string(filter[:])); err != nil {
+		return fmt.Errorf("failed to set HCI filter: %w", err)
+	}
+	// The reads time out to check ctx
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 1}); err != nil {
+		return fmt.Errorf("failed to set HCI read timeout: %w", err)
+	}
+
+	// Scanning may be left enabled by another process: the disable result is ignored
+	_ = command(fd, ocfLESetScanEnable, []byte{0, 0})
+	params := make([]byte, 7)
+	if p.active {
+		params[0] = 1
+	}
+	binary.LittleEndian.PutUint16(params[1:], p.interval)
+	binary.LittleEndian.PutUint16(params[3:], p.window)
+	if err := command(fd, ocfLESetScanParameters, params); err != nil {
+		return fmt.Errorf("failed to set scan parameters: %w", err)
+	}
+	// The duplicates are not filtered by the controller, so that RSSI updates are received
+	if err := command(fd, ocfLESetScanEnable, []byte{1, 0}); err != nil {
+		return fmt.Errorf("failed to enable scanning: %w", err)
+	}
+	defer command(fd, ocfLESetScanEnable, []byte{0, 0}) //nolint:errcheck
+
+	buf := make([]byte, 512)
+	for ctx.Err() == nil {
+		n, err := unix.Read(fd, buf)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return fmt.Errorf("failed to read HCI socket: %w", err)
+		}
+		if n < 4 || buf[0] != hciEventPkt || buf[1] != evtLEMeta || buf[3] != leAdvertisingReport {
+			continue
+		}
+		advs, err := parseAdvertisingReport(buf[4:n], time.Now())
+		if err != nil {
+			p.logger.Debug("invalid advertising report", "error", err)
+			continue
+		}
+		for _, adv := range advs {
+			if !emit(adv) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// command sends an LE controller command and waits for its completion
+func command(fd int, ocf uint16, params []byte) error {
+	opcode := uint16(ogfLE)<<10 | ocf
+	pkt := make([]byte, 4, 4+len(params))
+	pkt[0] = hciCommandPkt
+	binary.LittleEndian.PutUint16(pkt[1:], opcode)
+	pkt[3] = byte(len(params))
+	pkt = append(pkt, params...)
+	if _, err := unix.Write(fd, pkt); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 260)
+	deadline := time.Now().Add(commandTimeout)
+	for time.Now().Before(deadline) {
+		n, err := unix.Read(fd, buf)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return err
+		}
+		if n < 3 || buf[0] != hciEventPkt {
+			continue
+		}
+		ev := buf[3:n]
+		switch {
+		// Command Complete: number of packets, opcode, status
+		case buf[1] == evtCmdComplete && len(ev) >= 4 && binary.LittleEndian.Uint16(ev[1:]) == opcode:
+			return commandStatus(ev[3])
+		// Command Status: status, number of packets, opcode
+		case buf[1] == evtCmdStatus && len(ev) >= 4 && binary.LittleEndian.Uint16(ev[2:]) == opcode:
+			return commandStatus(ev[0])
+		}
+	}
+	return fmt.Errorf("timeout waiting for the completion of command 0x%04x", opcode)
+}
+
+func commandStatus(status byte) error {
+	if status != 0 {
+		return fmt.Errorf("controller error 0x%02x", status)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+const supported = false
+
+func scan(ctx context.Context, p scanParams, emit func(*Advertisement) bool) error {
+	return errors.New("BLE scanning is not available on this platform")
+}
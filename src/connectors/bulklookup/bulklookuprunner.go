@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/jsonpath"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure BulkLookupRunner implements connectors.Runner
+var _ connectors.Runner = &BulkLookupRunner{}
+
+const (
+	backendSQL   = "sql"
+	backendRedis = "redis"
+	backendHTTP  = "http"
+
+	fromMetadata = "metadata"
+)
+
+// Key is the lookup key read from the message
+type Key struct {
+	// From is the message part the key is read from: "data" (JSON payload, default) or "metadata"
+	From string `mapstructure:"from" validate:"omitempty,oneof=data metadata"`
+	// Path is the dotted JSON path (e.g. "customer.id", "items.0.sku") or the metadata key
+	Path string `mapstructure:"path" validate:"required"`
+}
+
+type RunnerConfig struct {
+	// Backend is the reference data store: "sql", "redis" or "http"
+	Backend string `mapstructure:"backend" validate:"required,oneof=sql redis http"`
+
+	// Key is the lookup key of every message
+	Key Key `mapstructure:"key"`
+
+	// Into is the payload key where the lookup result is joined
+	Into string `mapstructure:"into" default:"lookup" validate:"required"`
+
+	// Required makes the message fail when no value is found for its key
+	Required bool `mapstructure:"required" default:"false"`
+
+	// MaxBatch is the maximum number of messages collected in a batch
+	MaxBatch int `mapstructure:"maxBatch" default:"100" validate:"min=1,max=10000"`
+
+	// MaxWait is the time a batch waits for more messages after the first one
+	MaxWait time.Duration `mapstructure:"maxWait" default:"10ms" validate:"gt=0"`
+
+	// Timeout bounds the bulk query
+	Timeout time.Duration `mapstructure:"timeout" default:"5s" validate:"gt=0"`
+
+	SQL   *SQLConfig   `mapstructure:"sql" validate:"required_if=Backend sql"`
+	Redis *RedisConfig `mapstructure:"redis" validate:"required_if=Backend redis"`
+	HTTP  *HTTPConfig  `mapstructure:"http" validate:"required_if=Backend http"`
+}
+
+var errClosed = errors.New("bulk lookup runner closed")
+
+// fetchFunc fetches the values of the distinct keys of a batch; missing keys are omitted
+type fetchFunc func(ctx context.Context, keys []string) (map[string]any, error)
+
+// lookupRequest is a message waiting for the value of its key
+type lookupRequest struct {
+	key    string
+	result chan lookupResult
+}
+
+type lookupResult struct {
+	value any
+	found bool
+	err   error
+}
+
+// BulkLookupRunner enriches the messages in flight with reference data, collecting
+// their keys in batches and fetching the distinct keys of a batch with one query
+type BulkLookupRunner struct {
+	cfg      *RunnerConfig
+	slog     *slog.Logger
+	fetch    fetchFunc
+	closer   func() error
+	requests chan lookupRequest
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a bulk lookup runner connected to the configured backend
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	var fetch fetchFunc
+	var closer func() error
+	var err error
+	switch cfg.Backend {
+	case backendSQL:
+		fetch, closer, err = newSQLFetcher(cfg.SQL)
+	case backendRedis:
+		fetch, closer, err = newRedisFetcher(cfg.Redis)
+	case backendHTTP:
+		fetch, closer, err = newHTTPFetcher(cfg.HTTP)
+	default:
+		err = fmt.Errorf("unsupported backend: %s", cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := newBulkLookupRunner(cfg, fetch)
+	r.closer = closer
+	r.slog.Info("bulk lookup runner started",
+		"backend", cfg.Backend,
+		"into", cfg.Into,
+		"maxBatch", cfg.MaxBatch,
+		"maxWait", cfg.MaxWait,
+	)
+	return r, nil
+}
+
+func newBulkLookupRunner(cfg *RunnerConfig, fetch fetchFunc) *BulkLookupRunner {
+	r := &BulkLookupRunner{
+		cfg:      cfg,
+		slog:     slog.Default().With("context", "Bulk Lookup Runner"),
+		fetch:    fetch,
+		requests: make(chan lookupRequest, cfg.MaxBatch),
+		stop:     make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.batchLoop()
+	return r
+}
+
+// Process waits for the value of the message key and joins it into the payload
+func (r *BulkLookupRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(data, &payload); err != nil || payload == nil {
+		return fmt.Errorf("payload must be a JSON object")
+	}
+
+	key, err := r.key(payload, meta)
+	if err != nil {
+		return err
+	}
+
+	req := lookupRequest{key: key, result: make(chan lookupResult, 1)}
+	select {
+	case r.requests <- req:
+	case <-r.stop:
+		return errClosed
+	}
+	var res lookupResult
+	select {
+	case res = <-req.result:
+	case <-r.stop:
+		return errClosed
+	}
+	if res.err != nil {
+		return res.err
+	}
+	if !res.found && r.cfg.Required {
+		return fmt.Errorf("lookup returned no value for key %s", key)
+	}
+
+	payload[r.cfg.Into] = res.value
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	msg.SetData(out)
+	return nil
+}
+
+// key extracts the lookup key from the message
+func (r *BulkLookupRunner) key(payload map[string]any, meta map[string]string) (string, error) {
+	if r.cfg.Key.From == fromMetadata {
+		v, ok := meta[r.cfg.Key.Path]
+		if !ok {
+			return "", fmt.Errorf("missing metadata key %s", r.cfg.Key.Path)
+		}
+		return v, nil
+	}
+	v, ok := jsonpath.Get(payload, r.cfg.Key.Path)
+	if !ok || v == nil {
+		return "", fmt.Errorf("missing data key %s", r.cfg.Key.Path)
+	}
+	return keyString(v)
+}
+
+// batchLoop collects the requests in batches of up to MaxBatch messages, waiting
+// at most MaxWait after the first one, and runs the bulk fetch of every batch
+func (r *BulkLookupRunner) batchLoop() {
+	defer r.wg.Done()
+	for {
+		var batch []lookupRequest
+		select {
+		case req := <-r.requests:
+			batch = append(batch, req)
+		case <-r.stop:
+			return
+		}
+
+		timer := time.NewTimer(r.cfg.MaxWait)
+	collect:
+		for len(batch) < r.cfg.MaxBatch {
+			select {
+			case req := <-r.requests:
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			case <-r.stop:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		// Fetches run concurrently so that a slow query does not hold the next batch
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.runBatch(batch)
+		}()
+	}
+}
+
+// runBatch fetches the distinct keys of the batch and answers every request
+func (r *BulkLookupRunner) runBatch(batch []lookupRequest) {
+	seen := make(map[string]struct{}, len(batch))
+	keys := make([]string, 0, len(batch))
+	for _, req := range batch {
+		if _, ok := seen[req.key]; !ok {
+			seen[req.key] = struct{}{}
+			keys = append(keys, req.key)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+
+	values, err := r.fetch(ctx, keys)
+	if err != nil {
+		err = fmt.Errorf("bulk lookup failed: %w", err)
+	}
+	r.slog.Debug("bulk lookup", "messages", len(batch), "keys", len(keys), "found", len(values), "error", err)
+
+	for _, req := range batch {
+		v, found := values[req.key]
+		req.result <- lookupResult{value: v, found: found, err: err}
+	}
+}
+
+// keyString converts a decoded JSON scalar to a lookup key
+func keyString(v any) (string, error) {
+	key, ok := jsonpath.ScalarString(v)
+	if !ok {
+		return "", fmt.Errorf("lookup key must be a scalar, got %T", v)
+	}
+	return key, nil
+}
+
+// Close stops the batching, waiting for the running fetches, and closes the backend
+func (r *BulkLookupRunner) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	r.wg.Wait()
+	if r.closer != nil {
+		return r.closer()
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func mustParseConfig(t *testing.T, opts map[string]any) *RunnerConfig {
+	t.Helper()
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	return cfg
+}
+
+func testConfig(t *testing.T) *RunnerConfig {
+	return mustParseConfig(t, map[string]any{
+		"backend": "http",
+		"http":    map[string]any{"url": "http://localhost/batch"},
+		"key":     map[string]any{"path": "customer.id"},
+		"into":    "customer",
+		"maxWait": "50ms",
+	})
+}
+
+func processJSON(r *BulkLookupRunner, data string) (map[string]any, error) {
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(data), nil))
+	if err := r.Process(msg); err != nil {
+		return nil, err
+	}
+	out, err := msg.GetData()
+	if err != nil {
+		return nil, err
+	}
+	var res map[string]any
+	err = json.Unmarshal(out, &res)
+	return res, err
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg := testConfig(t)
+	if cfg.MaxBatch != 100 || cfg.Timeout != 5*time.Second || cfg.Required {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+
+	if err := utils.ParseConfig(map[string]any{
+		"backend": "redis",
+		"key":     map[string]any{"path": "id"},
+	}, new(RunnerConfig)); err == nil {
+		t.Error("expected validation error without the backend section")
+	}
+}
+
+func TestProcessBatchesDistinctKeys(t *testing.T) {
+	var mu sync.Mutex
+	var calls [][]string
+	r := newBulkLookupRunner(testConfig(t), func(_ context.Context, keys []string) (map[string]any, error) {
+		mu.Lock()
+		calls = append(calls, slices.Sorted(slices.Values(keys)))
+		mu.Unlock()
+		values := map[string]any{}
+		for _, k := range keys {
+			if k != "404" {
+				values[k] = map[string]any{"name": "customer " + k}
+			}
+		}
+		return values, nil
+	})
+	defer r.Close() //nolint:errcheck
+
+	ids := []string{"1", "2", "1", "404", "2", "1"}
+	results := make([]map[string]any, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Go(func() {
+			res, err := processJSON(r, fmt.Sprintf(`{"customer":{"id":%s}}`, id))
+			if err != nil {
+				t.Errorf("process %s: %v", id, err)
+			}
+			results[i] = res
+		})
+	}
+	wg.Wait()
+
+	if len(calls) != 1 || !slices.Equal(calls[0], []string{"1", "2", "404"}) {
+		t.Fatalf("expected one fetch of the distinct keys, got %v", calls)
+	}
+	for i, id := range ids {
+		customer := results[i]["customer"]
+		if id == "404" {
+			if customer != nil {
+				t.Errorf("expected null for missing key, got %v", customer)
+			}
+			continue
+		}
+		if c, ok := customer.(map[string]any); !ok || c["name"] != "customer "+id {
+			t.Errorf("unexpected lookup for %s: %v", id, customer)
+		}
+	}
+}
+
+func TestProcessMaxBatch(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxBatch = 2
+	cfg.MaxWait = time.Hour
+	r := newBulkLookupRunner(cfg, func(_ context.Context, keys []string) (map[string]any, error) {
+		return map[string]any{keys[0]: true}, nil
+	})
+	defer r.Close() //nolint:errcheck
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Go(func() {
+			if _, err := processJSON(r, fmt.Sprintf(`{"customer":{"id":"k%d"}}`, i)); err != nil {
+				t.Errorf("process: %v", err)
+			}
+		})
+	}
+	// Full batches are fetched without waiting for maxWait
+	wg.Wait()
+}
+
+func TestProcessErrors(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Required = true
+	failing := errors.New("connection refused")
+	r := newBulkLookupRunner(cfg, func(_ context.Context, keys []string) (map[string]any, error) {
+		if keys[0] == "down" {
+			return nil, failing
+		}
+		return map[string]any{}, nil
+	})
+
+	if _, err := processJSON(r, `{"customer":{"id":"down"}}`); !errors.Is(err, failing) {
+		t.Errorf("expected fetch error, got %v", err)
+	}
+	if _, err := processJSON(r, `{"customer":{"id":"missing"}}`); err == nil {
+		t.Error("expected error for required missing value")
+	}
+	if _, err := processJSON(r, `{"customer":{}}`); err == nil {
+		t.Error("expected error for missing key")
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := processJSON(r, `{"customer":{"id":"1"}}`); !errors.Is(err, errClosed) {
+		t.Errorf("expected closed error, got %v", err)
+	}
+}
+
+func TestGroupRows(t *testing.T) {
+	rows := []map[string]any{
+		{"key": int64(1), "sku": "a"},
+		{"key": int64(2), "sku": "b"},
+		{"key": int64(1), "sku": "c"},
+	}
+	first, err := groupRows(rows, "key", modeFirst)
+	if err != nil || first["1"].(map[string]any)["sku"] != "a" {
+		t.Errorf("unexpected first rows: %v %v", first, err)
+	}
+	all, err := groupRows(rows, "key", modeAll)
+	if err != nil || len(all["1"].([]map[string]any)) != 2 {
+		t.Errorf("unexpected all rows: %v %v", all, err)
+	}
+	if _, err := groupRows(rows, "id", modeFirst); err == nil {
+		t.Error("expected error for missing key column")
+	}
+}
+
+func TestRedisFetch(t *testing.T) {
+	srv, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	defer srv.Close()
+	srv.Set("customer:1", `{"name":"Acme"}`) //nolint:errcheck
+	srv.Set("customer:2", "plain")           //nolint:errcheck
+
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer client.Close() //nolint:errcheck
+
+	values, err := redisFetch(client, "customer:")(context.Background(), []string{"1", "2", "3"})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(values) != 2 || values["1"].(map[string]any)["name"] != "Acme" || values["2"] != "plain" {
+		t.Errorf("unexpected values: %v", values)
+	}
+}
+
+func TestHTTPFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var keys []string
+		if err := json.NewDecoder(req.Body).Decode(&keys); err != nil || req.Header.Get("Authorization") != "Bearer t" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		res := map[string]any{}
+		for _, k := range keys {
+			res[k] = map[string]any{"id": k}
+		}
+		json.NewEncoder(w).Encode(res) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	fetch := httpFetch(srv.Client(), srv.URL, map[string]string{"Authorization": "Bearer t"})
+	values, err := fetch(context.Background(), []string{"a", "b"})
+	if err != nil || len(values) != 2 {
+		t.Fatalf("unexpected result: %v %v", values, err)
+	}
+
+	if _, err := httpFetch(srv.Client(), srv.URL, nil)(context.Background(), []string{"a"}); err == nil {
+		t.Error("expected error for non 2xx status")
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/common/tmplfuncs"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure CalloutRunner implements connectors.Runner
+var _ connectors.Runner = &CalloutRunner{}
+
+const (
+	mergeReplace  = "replace"
+	mergeObject   = "merge"
+	mergeField    = "field"
+	mergeMetadata = "metadata"
+)
+
+type RunnerConfig struct {
+	// Method is the HTTP method of the call
+	Method string `mapstructure:"method" default:"GET" validate:"oneof=GET POST PUT PATCH DELETE"`
+	// URL is the Go template of the URL (with sprig functions), executed with "data" (decoded
+	// JSON payload, or the payload as string) and "metadata"
+	URL string `mapstructure:"url" validate:"required"`
+	// Headers are additional HTTP headers (values support env: and file: secrets)
+	Headers map[string]string `mapstructure:"headers"`
+	// Body is the Go template of the request body; without it, POST, PUT and PATCH send the payload
+	Body string `mapstructure:"body"`
+	// Auth obtains the bearer token of the calls
+	Auth *AuthConfig `mapstructure:"auth"`
+	// HostAuth overrides Auth for the calls to the given hosts (host or host:port of the URL)
+	HostAuth map[string]*AuthConfig `mapstructure:"hostAuth" validate:"dive"`
+	// Merge applies the response: "field" (default, the response is set in the Into field of the
+	// payload JSON object), "merge" (the fields of the response JSON object are set in the
+	// payload JSON object), "replace" (the response replaces the payload) or "metadata" (the
+	// payload is unchanged, the response is set in ResponseKey)
+	Merge string `mapstructure:"merge" default:"field" validate:"oneof=field merge replace metadata"`
+	// Into is the payload field of the "field" merge
+	Into string `mapstructure:"into" default:"callout" validate:"required"`
+	// ResponseKey is the metadata key of the "metadata" merge
+	ResponseKey string `mapstructure:"responseKey" default:"eb-callout-response" validate:"required"`
+	// StatusKey is the metadata key of the response status
+	StatusKey string            `mapstructure:"statusKey" default:"eb-callout-status" validate:"required"`
+	Timeout   time.Duration     `mapstructure:"timeout" default:"10s" validate:"gt=0"`
+	TLS       *tlsconfig.Config `mapstructure:"tls"`
+	// MaxResponseSize limits the response size
+	MaxResponseSize int64 `mapstructure:"maxResponseSize" default:"10485760" validate:"gt=0"` // 10MB default
+}
+
+// CalloutRunner calls an HTTP API for every message and merges the response into it,
+// authenticating the calls with OAuth2 tokens obtained and renewed automatically
+type CalloutRunner struct {
+	cfg      *RunnerConfig
+	slog     *slog.Logger
+	client   *http.Client
+	url      *template.Template
+	body     *template.Template
+	headers  map[string]string
+	auth     *tokenSource
+	hostAuth map[string]*tokenSource
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a callout runner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	r, err := newCalloutRunner(cfg, client)
+	if err != nil {
+		return nil, err
+	}
+	r.slog.Info("callout runner created", "method", cfg.Method, "merge", cfg.Merge, "auth", cfg.Auth != nil, "hostAuth", len(cfg.HostAuth))
+	return r, nil
+}
+
+func newCalloutRunner(cfg *RunnerConfig, client *http.Client) (*CalloutRunner, error) {
+	r := &CalloutRunner{
+		cfg:      cfg,
+		slog:     slog.Default().With("context", "Callout Runner"),
+		client:   client,
+		headers:  make(map[string]string, len(cfg.Headers)),
+		hostAuth: make(map[string]*tokenSource, len(cfg.HostAuth)),
+	}
+
+	var err error
+	if r.url, err = template.New("url").Option("missingkey=zero").Funcs(tmplfuncs.FuncMap()).Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("failed to parse url template: %w", err)
+	}
+	if cfg.Body != "" {
+		if r.body, err = template.New("body").Option("missingkey=zero").Funcs(tmplfuncs.FuncMap()).Parse(cfg.Body); err != nil {
+			return nil, fmt.Errorf("failed to parse body template: %w", err)
+		}
+	}
+	for k, v := range cfg.Headers {
+		if r.headers[k], err = secrets.Resolve(v); err != nil {
+			return nil, fmt.Errorf("failed to resolve header %s: %w", k, err)
+		}
+	}
+
+	// The token requests share the client of the calls and its TLS configuration
+	if cfg.Auth != nil {
+		if r.auth, err = newTokenSource(cfg.Auth, client); err != nil {
+			return nil, err
+		}
+	}
+	for host, auth := range cfg.HostAuth {
+		if r.hostAuth[strings.ToLower(host)], err = newTokenSource(auth, client); err != nil {
+			return nil, fmt.Errorf("invalid auth of host %s: %w", host, err)
+		}
+	}
+	return r, nil
+}
+
+// Process calls the API and merges the response into the message
+func (r *CalloutRunner) Process(msg *message.RunnerMessage) error {
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+
+	var payload any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		payload = string(data)
+	}
+	vars := map[string]any{"data": payload, "metadata": metadata}
+
+	var buf bytes.Buffer
+	if err := r.url.Execute(&buf, vars); err != nil {
+		return fmt.Errorf("failed to render url: %w", err)
+	}
+	target, err := url.Parse(strings.TrimSpace(buf.String()))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid callout url %q", buf.String())
+	}
+
+	var body []byte
+	switch {
+	case r.body != nil:
+		buf.Reset()
+		if err := r.body.Execute(&buf, vars); err != nil {
+			return fmt.Errorf("failed to render body: %w", err)
+		}
+		body = buf.Bytes()
+	case r.cfg.Method == http.MethodPost || r.cfg.Method == http.MethodPut || r.cfg.Method == http.MethodPatch:
+		body = data
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+
+	auth := r.authFor(target)
+	status, response, err := r.call(ctx, target.String(), body, auth)
+	if err != nil {
+		return err
+	}
+	r.slog.Debug("callout completed", "url", target.Redacted(), "status", status, "size", len(response))
+
+	msg.AddMetadata(r.cfg.StatusKey, strconv.Itoa(status))
+	switch r.cfg.Merge {
+	case mergeReplace:
+		msg.SetData(response)
+	case mergeMetadata:
+		msg.AddMetadata(r.cfg.ResponseKey, string(response))
+	default:
+		merged, err := r.merge(data, response)
+		if err != nil {
+			return err
+		}
+		msg.SetData(merged)
+	}
+	return nil
+}
+
+// authFor returns the token source of the host, or the default one
+func (r *CalloutRunner) authFor(u *url.URL) *tokenSource {
+	if ts, ok := r.hostAuth[strings.ToLower(u.Host)]; ok {
+		return ts
+	}
+	if ts, ok := r.hostAuth[strings.ToLower(u.Hostname())]; ok {
+		return ts
+	}
+	return r.auth
+}
+
+// call sends the request with the current token. A 401 response drops the token and the
+// call is sent once more with a new one, as the token may have been revoked before its expiry.
+func (r *CalloutRunner) call(ctx context.Context, target string, body []byte, auth *tokenSource) (int, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		var token string
+		if auth != nil {
+			var err error
+			if token, err = auth.token(ctx); err != nil {
+				return 0, nil, fmt.Errorf("failed to obtain access token: %w", err)
+			}
+		}
+
+		status, response, err := r.send(ctx, target, body, token)
+		if err != nil {
+			return 0, nil, err
+		}
+		if status == http.StatusUnauthorized && auth != nil && attempt == 0 {
+			r.slog.Debug("token rejected, requesting a new one")
+			auth.invalidate(token)
+			continue
+		}
+		if status < 200 || status > 299 {
+			return status, nil, &statusError{status: status}
+		}
+		return status, response, nil
+	}
+}
+
+func (r *CalloutRunner) send(ctx context.Context, target string, body []byte, token string) (int, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.cfg.Method, target, reader)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range r.headers {
+		req.Header.Set(k, v)
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := r.client.Do(req) //nolint:gosec // user-configured endpoint
+	if err != nil {
+		return 0, nil, fmt.Errorf("callout request failed: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	response, err := io.ReadAll(io.LimitReader(res.Body, r.cfg.MaxResponseSize+1))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(response)) > r.cfg.MaxResponseSize {
+		return 0, nil, fmt.Errorf("response size exceeds limit %d", r.cfg.MaxResponseSize)
+	}
+	return res.StatusCode, response, nil
+}
+
+// merge sets the response in the payload JSON object: in the Into field or, for the "merge"
+// mode, the fields of the response JSON object
+func (r *CalloutRunner) merge(data, response []byte) ([]byte, error) {
+	var payload map[string]any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("payload must be a JSON object: %w", err)
+	}
+	if payload == nil {
+		payload = make(map[string]any)
+	}
+
+	if r.cfg.Merge == mergeObject {
+		var fields map[string]any
+		if err := json.Unmarshal(response, &fields); err != nil {
+			return nil, fmt.Errorf("response must be a JSON object: %w", err)
+		}
+		for k, v := range fields {
+			payload[k] = v
+		}
+	} else {
+		var value any
+		if err := json.Unmarshal(response, &value); err != nil {
+			// Not JSON: the response is set as string
+			value = string(response)
+		}
+		payload[r.cfg.Into] = value
+	}
+
+	res, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal merged payload: %w", err)
+	}
+	return res, nil
+}
+
+// statusError is the error of a non-2XX response, with the status as error code
+type statusError struct {
+	status int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("non-2XX status code: %d", e.status)
+}
+
+// ErrorCode implements message.CodedError
+func (e *statusError) ErrorCode() string {
+	return "http_" + strconv.Itoa(e.status)
+}
+
+// Retryable implements message.RetryableError: timeouts, throttling and server errors are transient
+func (e *statusError) Retryable() bool {
+	return e.status == http.StatusRequestTimeout || e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+// Close releases the idle connections; the cached tokens are kept for the other runners
+func (r *CalloutRunner) Close() error {
+	r.slog.Info("closing callout runner")
+	r.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func newMessage(data string, meta map[string]string) *message.RunnerMessage {
+	return message.NewRunnerMessage(testutil.NewAdapter([]byte(data), meta))
+}
+
+// tokenServer is an OAuth2 token endpoint issuing numbered tokens
+type tokenServer struct {
+	*httptest.Server
+	requests atomic.Int32
+	check    func(r *http.Request) error
+}
+
+func newTokenServer(t *testing.T, check func(r *http.Request) error) *tokenServer {
+	ts := &tokenServer{check: check}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ts.check != nil {
+			if err := ts.check(r); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = fmt.Fprintf(w, `{"error":"invalid_client","error_description":%q}`, err.Error())
+				return
+			}
+		}
+		n := ts.requests.Add(1)
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600}`, n)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestCalloutClientCredentials(t *testing.T) {
+	tokenSrv := newTokenServer(t, func(r *http.Request) error {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "s3cret" || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "read write" {
+			return errors.New("bad client credentials request")
+		}
+		return nil
+	})
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"id":%q,"tier":"gold"}`, strings.TrimPrefix(r.URL.Path, "/customers/"))
+	}))
+	defer api.Close()
+
+	auth := &AuthConfig{
+		Type:         authClientCredentials,
+		TokenURL:     tokenSrv.URL,
+		ClientID:     "client",
+		ClientSecret: "s3cret",
+		Scopes:       []string{"read", "write"},
+	}
+	cfg := &RunnerConfig{
+		Method:          "GET",
+		URL:             api.URL + "/customers/{{ .data.customer }}",
+		Merge:           mergeField,
+		Into:            "callout",
+		Auth:            auth,
+		ResponseKey:     "eb-callout-response",
+		StatusKey:       "eb-callout-status",
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1024,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	// The concurrent routines share one token request
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg := newMessage(fmt.Sprintf(`{"customer":"c%d"}`, i), nil)
+			if err := r.Process(msg); err != nil {
+				t.Errorf("Process() unexpected error = %v", err)
+				return
+			}
+			data, _ := msg.GetData()
+			want := fmt.Sprintf(`{"callout":{"id":"c%d","tier":"gold"},"customer":"c%d"}`, i, i)
+			if string(data) != want {
+				t.Errorf("data = %s, want %s", data, want)
+			}
+			meta, _ := msg.GetMetadata()
+			if meta["eb-callout-status"] != "200" {
+				t.Errorf("metadata = %v", meta)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := tokenSrv.requests.Load(); n != 1 {
+		t.Errorf("token requests = %d, want 1", n)
+	}
+
+	// Another runner with the same client reuses the cached token
+	cfg = &RunnerConfig{
+		Method:          "GET",
+		URL:             api.URL + "/customers/x",
+		Merge:           mergeMetadata,
+		Into:            "callout",
+		Auth:            auth,
+		ResponseKey:     "eb-callout-response",
+		StatusKey:       "eb-callout-status",
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1024,
+	}
+	other, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = other.Close() }()
+	msg := newMessage(`not json`, nil)
+	if err := other.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	meta, _ := msg.GetMetadata()
+	if meta["eb-callout-response"] != `{"id":"x","tier":"gold"}` {
+		t.Errorf("metadata = %v", meta)
+	}
+	if n := tokenSrv.requests.Load(); n != 1 {
+		t.Errorf("token requests = %d, want 1", n)
+	}
+}
+
+func TestCalloutTokenRenewedOnUnauthorized(t *testing.T) {
+	tokenSrv := newTokenServer(t, nil)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first token is revoked
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = fmt.Fprintf(w, `{"echo":%s}`, body)
+	}))
+	defer api.Close()
+
+	cfg := &RunnerConfig{
+		Method:          "POST",
+		URL:             api.URL,
+		Merge:           mergeReplace,
+		Into:            "callout",
+		Auth:            &AuthConfig{Type: authClientCredentials, TokenURL: tokenSrv.URL, ClientID: "a", ClientSecret: "b", ClientAuth: clientAuthBody},
+		ResponseKey:     "eb-callout-response",
+		StatusKey:       "eb-callout-status",
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1024,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	msg := newMessage(`{"a":1}`, nil)
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if data, _ := msg.GetData(); string(data) != `{"echo":{"a":1}}` {
+		t.Errorf("data = %s", data)
+	}
+
+	// A new token rejected again fails the message after one renewal
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer failing.Close()
+	cfg = &RunnerConfig{
+		Method:          "GET",
+		URL:             failing.URL,
+		Merge:           mergeField,
+		Into:            "callout",
+		Auth:            &AuthConfig{Type: authClientCredentials, TokenURL: tokenSrv.URL, ClientID: "c", ClientSecret: "d"},
+		ResponseKey:     "eb-callout-response",
+		StatusKey:       "eb-callout-status",
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1024,
+	}
+	renewed, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = renewed.Close() }()
+	before := tokenSrv.requests.Load()
+	err = renewed.Process(newMessage(`{}`, nil))
+	var se *statusError
+	if !errors.As(err, &se) || se.status != http.StatusUnauthorized || se.Retryable() {
+		t.Errorf("Process() error = %v, want a 401 status error", err)
+	}
+	if n := tokenSrv.requests.Load() - before; n != 2 {
+		t.Errorf("token requests = %d, want 2", n)
+	}
+}
+
+func TestCalloutJWTBearer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	var tokenURL string
+	tokenSrv := newTokenServer(t, func(r *http.Request) error {
+		if r.Form.Get("grant_type") != grantJWTBearer {
+			return errors.New("bad grant type")
+		}
+		claims := jwt.MapClaims{}
+		tok, err := jwt.ParseWithClaims(r.Form.Get("assertion"), claims, func(*jwt.Token) (any, error) { return &key.PublicKey, nil },
+			jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience(tokenURL), jwt.WithIssuer("svc@example.com"))
+		if err != nil {
+			return err
+		}
+		if tok.Header["kid"] != "k1" || claims["sub"] != "user@example.com" || claims["tenant"] != "acme" {
+			return fmt.Errorf("bad assertion %v %v", tok.Header, claims)
+		}
+		return nil
+	})
+	tokenURL = tokenSrv.URL
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"score":0.9}`))
+	}))
+	defer api.Close()
+
+	cfg := &RunnerConfig{
+		Method: "GET",
+		URL:    api.URL,
+		Merge:  mergeObject,
+		Into:   "callout",
+		Auth: &AuthConfig{
+			Type:     authJWTBearer,
+			TokenURL: tokenURL,
+			JWT: &AssertionConfig{
+				Issuer:     "svc@example.com",
+				Subject:    "user@example.com",
+				PrivateKey: string(keyPEM),
+				KeyID:      "k1",
+				Claims:     map[string]any{"tenant": "acme"},
+			},
+		},
+		ResponseKey:     "eb-callout-response",
+		StatusKey:       "eb-callout-status",
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1024,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	msg := newMessage(`{"id":7}`, nil)
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if data, _ := msg.GetData(); string(data) != `{"id":7,"score":0.9}` {
+		t.Errorf("data = %s", data)
+	}
+}
+
+func TestCalloutHostAuth(t *testing.T) {
+	tokenSrv := newTokenServer(t, nil)
+	var got atomic.Value
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Store(r.Header.Get("Authorization") + " " + r.Header.Get("X-Api-Key"))
+		_, _ = w.Write([]byte(`ok`))
+	}))
+	defer api.Close()
+	host := strings.TrimPrefix(api.URL, "http://")
+
+	// The API is reached as 127.0.0.1 with the host auth and as localhost without auth
+	cfg := &RunnerConfig{
+		Method:  "GET",
+		URL:     "{{ .metadata.base }}/x",
+		Headers: map[string]string{"X-Api-Key": "k"},
+		Merge:   mergeField,
+		Into:    "callout",
+		HostAuth: map[string]*AuthConfig{
+			host: {Type: authClientCredentials, TokenURL: tokenSrv.URL, ClientID: "h", ClientSecret: "s"},
+		},
+		ResponseKey:     "eb-callout-response",
+		StatusKey:       "eb-callout-status",
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1024,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	msg := newMessage(`{}`, map[string]string{"base": api.URL})
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if got.Load() != "Bearer token-1 k" {
+		t.Errorf("headers = %v", got.Load())
+	}
+	if data, _ := msg.GetData(); string(data) != `{"callout":"ok"}` {
+		t.Errorf("data = %s", data)
+	}
+
+	msg = newMessage(`{}`, map[string]string{"base": strings.Replace(api.URL, "127.0.0.1", "localhost", 1)})
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if got.Load() != " k" {
+		t.Errorf("headers = %v", got.Load())
+	}
+}
+
+func TestCalloutErrors(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/big" {
+			_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer api.Close()
+
+	cfg := &RunnerConfig{
+		Method:          "GET",
+		URL:             api.URL + "/{{ .metadata.path }}",
+		Merge:           mergeField,
+		Into:            "callout",
+		ResponseKey:     "eb-callout-response",
+		StatusKey:       "eb-callout-status",
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 10,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	err = r.Process(newMessage(`{}`, map[string]string{"path": "down"}))
+	var se *statusError
+	if !errors.As(err, &se) || !se.Retryable() || se.ErrorCode() != "http_503" {
+		t.Errorf("Process() error = %v, want a retryable 503", err)
+	}
+	if err := r.Process(newMessage(`{}`, map[string]string{"path": "big"})); err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Errorf("Process() error = %v, want a size error", err)
+	}
+	if err := r.Process(newMessage(`[1]`, map[string]string{"path": "big"})); err == nil {
+		t.Error("Process() expected error")
+	}
+
+	cfg = &RunnerConfig{
+		Method:          "GET",
+		URL:             "{{ .metadata.url }}",
+		Merge:           mergeField,
+		Into:            "callout",
+		ResponseKey:     "eb-callout-response",
+		StatusKey:       "eb-callout-status",
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1024,
+	}
+	templated, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = templated.Close() }()
+	if err := templated.Process(newMessage(`{}`, map[string]string{"url": "ftp://host/x"})); err == nil {
+		t.Error("Process() expected error for an invalid url")
+	}
+
+	// A failing token endpoint fails the message
+	tokenSrv := newTokenServer(t, func(*http.Request) error { return errors.New("denied") })
+	cfg = &RunnerConfig{
+		Method:          "GET",
+		URL:             api.URL,
+		Merge:           mergeField,
+		Into:            "callout",
+		Auth:            &AuthConfig{Type: authClientCredentials, TokenURL: tokenSrv.URL, ClientID: "x", ClientSecret: "y"},
+		ResponseKey:     "eb-callout-response",
+		StatusKey:       "eb-callout-status",
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1024,
+	}
+	denied, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = denied.Close() }()
+	if err := denied.Process(newMessage(`{}`, nil)); err == nil || !strings.Contains(err.Error(), "invalid_client denied") {
+		t.Errorf("Process() error = %v, want a token error", err)
+	}
+}
+
+func TestCalloutConfigValidation(t *testing.T) {
+	for name, opts := range map[string]map[string]any{
+		"missing url":          {},
+		"invalid merge":        {"url": "http://x", "merge": "append"},
+		"missing client id":    {"url": "http://x", "auth": map[string]any{"type": "client-credentials", "tokenUrl": "http://t"}},
+		"missing jwt":          {"url": "http://x", "auth": map[string]any{"type": "jwt-bearer", "tokenUrl": "http://t"}},
+		"invalid algorithm":    {"url": "http://x", "auth": map[string]any{"type": "jwt-bearer", "tokenUrl": "http://t", "jwt": map[string]any{"issuer": "i", "privateKey": "k", "algorithm": "HS256"}}},
+		"invalid host auth":    {"url": "http://x", "hostAuth": map[string]any{"h": map[string]any{"type": "basic"}}},
+		"unsupported method":   {"url": "http://x", "method": "TRACE"},
+		"invalid response cap": {"url": "http://x", "maxResponseSize": 0},
+	} {
+		if err := utils.ParseConfig(opts, new(RunnerConfig)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	cfg := &RunnerConfig{
+		Method:          "GET",
+		URL:             "http://x",
+		Merge:           mergeField,
+		Into:            "callout",
+		Auth:            &AuthConfig{Type: authJWTBearer, TokenURL: "http://t", JWT: &AssertionConfig{Issuer: "i", PrivateKey: "not a key"}},
+		ResponseKey:     "eb-callout-response",
+		StatusKey:       "eb-callout-status",
+		Timeout:         5 * time.Second,
+		MaxResponseSize: 1024,
+	}
+	if _, err := NewRunner(cfg); err == nil {
+		t.Error("NewRunner() expected error for an invalid private key")
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+)
+
+const (
+	authClientCredentials = "client-credentials"
+	authJWTBearer         = "jwt-bearer"
+
+	clientAuthBasic = "basic"
+	clientAuthBody  = "body"
+
+	grantJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+	defaultExpiryMargin   = 30 * time.Second
+	defaultAssertionTTL   = 5 * time.Minute
+	defaultAssertionAlg   = "RS256"
+	maxTokenResponseSize  = 1 << 20
+	defaultTokenExpiresIn = time.Hour
+)
+
+// AuthConfig obtains the access tokens of the requests from an OAuth2 token endpoint
+type AuthConfig struct {
+	// Type is the grant: "client-credentials" or "jwt-bearer" (RFC 7523, a signed JWT assertion)
+	Type string `mapstructure:"type" validate:"required,oneof=client-credentials jwt-bearer"`
+	// TokenURL is the token endpoint
+	TokenURL string `mapstructure:"tokenUrl" validate:"required,url"`
+	// ClientID and ClientSecret are the client credentials, required by the client-credentials
+	// grant and optional for jwt-bearer (the secret supports env: and file: secrets)
+	ClientID     string `mapstructure:"clientId" validate:"required_if=Type client-credentials"`
+	ClientSecret string `mapstructure:"clientSecret" validate:"required_if=Type client-credentials"` //nolint:gosec // user-configured credential field
+	// ClientAuth sends the client credentials with "basic" auth (default) or in the form "body"
+	ClientAuth string `mapstructure:"clientAuth" validate:"omitempty,oneof=basic body"`
+	// Scopes are the requested scopes
+	Scopes []string `mapstructure:"scopes"`
+	// Audience is the requested audience, for providers requiring it
+	Audience string `mapstructure:"audience"`
+	// JWT configures the assertion of the jwt-bearer grant
+	JWT *AssertionConfig `mapstructure:"jwt" validate:"required_if=Type jwt-bearer"`
+	// ExpiryMargin is the time before the expiry when a token is renewed (default 30s)
+	ExpiryMargin time.Duration `mapstructure:"expiryMargin" validate:"min=0"`
+}
+
+// AssertionConfig defines the JWT assertion signed for every token request of the jwt-bearer grant
+type AssertionConfig struct {
+	// Issuer is the iss claim, e.g. the service account
+	Issuer string `mapstructure:"issuer" validate:"required"`
+	// Subject is the sub claim (defaults to the issuer)
+	Subject string `mapstructure:"subject"`
+	// Audience is the aud claim (defaults to the token URL)
+	Audience string `mapstructure:"audience"`
+	// PrivateKey is the PEM private key (supports env: and file: secrets)
+	PrivateKey string `mapstructure:"privateKey" validate:"required"` //nolint:gosec // user-configured credential field
+	// Algorithm is the signing algorithm (default RS256)
+	Algorithm string `mapstructure:"algorithm" validate:"omitempty,oneof=RS256 RS384 RS512 PS256 PS384 PS512 ES256 ES384 ES512"`
+	// KeyID is the kid header
+	KeyID string `mapstructure:"keyId"`
+	// Lifetime is the validity of the assertion (default 5m)
+	Lifetime time.Duration `mapstructure:"lifetime" validate:"min=0"`
+	// Claims are additional claims
+	Claims map[string]any `mapstructure:"claims"`
+}
+
+// tokens is the token cache of the process: the runners with the same token endpoint and
+// client share the tokens, across their routines and pipelines
+var tokens = newTokenCache()
+
+// tokenFetchFunc requests a token, returning it with its expiry
+type tokenFetchFunc func(ctx context.Context) (string, time.Time, error)
+
+// tokenSource obtains the tokens of an auth config through the cache
+type tokenSource struct {
+	key    string
+	margin time.Duration
+	fetch  tokenFetchFunc
+}
+
+// token returns the cached token, requesting a new one when it is missing or expiring
+func (s *tokenSource) token(ctx context.Context) (string, error) {
+	return tokens.get(ctx, s.key, s.margin, s.fetch)
+}
+
+// invalidate drops the token rejected by the upstream, unless it was already renewed
+func (s *tokenSource) invalidate(token string) {
+	tokens.invalidate(s.key, token)
+}
+
+type cachedToken struct {
+	// mu serializes the token requests of the entry, so that concurrent callers wait for
+	// one request instead of sending their own
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+type tokenCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedToken
+	now     func() time.Time
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{entries: make(map[string]*cachedToken), now: time.Now}
+}
+
+func (c *tokenCache) entry(key string) *cachedToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		e = &cachedToken{}
+		c.entries[key] = e
+	}
+	return e
+}
+
+func (c *tokenCache) get(ctx context.Context, key string, margin time.Duration, fetch tokenFetchFunc) (string, error) {
+	e := c.entry(key)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.token != "" && c.now().Add(margin).Before(e.expiry) {
+		return e.token, nil
+	}
+	token, expiry, err := fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	e.token, e.expiry = token, expiry
+	return token, nil
+}
+
+func (c *tokenCache) invalidate(key, token string) {
+	e := c.entry(key)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.token == token {
+		e.token = ""
+	}
+}
+
+// newTokenSource creates the token source of the auth config
+func newTokenSource(cfg *AuthConfig, client *http.Client) (*tokenSource, error) {
+	secret, err := secrets.Resolve(cfg.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve client secret: %w", err)
+	}
+
+	form := url.Values{}
+	if len(cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	if cfg.Audience != "" {
+		form.Set("audience", cfg.Audience)
+	}
+
+	// The key identifies the token endpoint and the client, without holding the secrets
+	h := sha256.New()
+	for _, part := range []string{cfg.Type, cfg.TokenURL, cfg.ClientID, secret, form.Encode()} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	var assertion func() (string, error)
+	switch cfg.Type {
+	case authClientCredentials:
+		form.Set("grant_type", "client_credentials")
+	case authJWTBearer:
+		if cfg.JWT == nil {
+			return nil, fmt.Errorf("jwt configuration is required")
+		}
+		if assertion, err = newAssertion(cfg.JWT, cfg.TokenURL); err != nil {
+			return nil, err
+		}
+		form.Set("grant_type", grantJWTBearer)
+		h.Write([]byte(cfg.JWT.Issuer + "\x00" + cfg.JWT.Subject + "\x00" + cfg.JWT.PrivateKey))
+	default:
+		return nil, fmt.Errorf("unsupported auth type: %s", cfg.Type)
+	}
+
+	margin := cfg.ExpiryMargin
+	if margin <= 0 {
+		margin = defaultExpiryMargin
+	}
+
+	fetch := func(ctx context.Context) (string, time.Time, error) {
+		values := url.Values{}
+		for k, v := range form {
+			values[k] = v
+		}
+		if assertion != nil {
+			a, err := assertion()
+			if err != nil {
+				return "", time.Time{}, fmt.Errorf("failed to sign assertion: %w", err)
+			}
+			values.Set("assertion", a)
+		}
+		basic := cfg.ClientID != "" && cfg.ClientAuth != clientAuthBody
+		if cfg.ClientID != "" && !basic {
+			values.Set("client_id", cfg.ClientID)
+			values.Set("client_secret", secret)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.TokenURL, strings.NewReader(values.Encode()))
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		if basic {
+			req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(secret))
+		}
+		return requestToken(client, req)
+	}
+
+	return &tokenSource{key: hex.EncodeToString(h.Sum(nil)), margin: margin, fetch: fetch}, nil
+}
+
+// requestToken sends the token request and returns the access token with its expiry
+func requestToken(client *http.Client, req *http.Request) (string, time.Time, error) {
+	res, err := client.Do(req) //nolint:gosec // user-configured endpoint
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("token request failed: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxTokenResponseSize))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read token response: %w", err)
+	}
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	decodeErr := json.Unmarshal(body, &token)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		if decodeErr == nil && token.Error != "" {
+			return "", time.Time{}, fmt.Errorf("token request failed with status %d: %s %s", res.StatusCode, token.Error, token.ErrorDescription)
+		}
+		return "", time.Time{}, fmt.Errorf("token request failed with status %d", res.StatusCode)
+	}
+	if decodeErr != nil {
+		return "", time.Time{}, fmt.Errorf("invalid token response: %w", decodeErr)
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("token response without access_token")
+	}
+	// Tokens without expires_in are renewed after a default lifetime or when rejected
+	expiresIn := defaultTokenExpiresIn
+	if token.ExpiresIn > 0 {
+		expiresIn = time.Duration(token.ExpiresIn) * time.Second
+	}
+	return token.AccessToken, time.Now().Add(expiresIn), nil
+}
+
+// newAssertion returns the function signing a new JWT assertion for every token request
+func newAssertion(cfg *AssertionConfig, tokenURL string) (func() (string, error), error) {
+	pemKey, err := secrets.Resolve(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve private key: %w", err)
+	}
+	alg := cfg.Algorithm
+	if alg == "" {
+		alg = defaultAssertionAlg
+	}
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+	var key any
+	if strings.HasPrefix(alg, "ES") {
+		key, err = jwt.ParseECPrivateKeyFromPEM([]byte(pemKey))
+	} else {
+		key, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(pemKey))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key for %s: %w", alg, err)
+	}
+
+	subject := cfg.Subject
+	if subject == "" {
+		subject = cfg.Issuer
+	}
+	audience := cfg.Audience
+	if audience == "" {
+		audience = tokenURL
+	}
+	lifetime := cfg.Lifetime
+	if lifetime <= 0 {
+		lifetime = defaultAssertionTTL
+	}
+
+	return func() (string, error) {
+		now := time.Now()
+		claims := jwt.MapClaims{}
+		for k, v := range cfg.Claims {
+			claims[k] = v
+		}
+		claims["iss"] = cfg.Issuer
+		claims["sub"] = subject
+		claims["aud"] = audience
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(lifetime).Unix()
+		claims["jti"] = rand.Text()
+
+		t := jwt.NewWithClaims(method, claims)
+		if cfg.KeyID != "" {
+			t.Header["kid"] = cfg.KeyID
+		}
+		return t.SignedString(key)
+	}, nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common"
+	"github.com/sandrolain/events-bridge/src/common/jsonpath"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure CanonicalRunner implements connectors.Runner
+var _ connectors.Runner = &CanonicalRunner{}
+
+const (
+	typeNumber    = "number"
+	typeInteger   = "integer"
+	typeString    = "string"
+	typeBoolean   = "boolean"
+	typeTimestamp = "timestamp"
+
+	rangeClamp = "clamp"
+	rangeDrop  = "drop"
+)
+
+// Issue codes reported in the errors metadata
+const (
+	issueMissing = "missing"
+	issueType    = "type"
+	issueUnit    = "unit"
+	issueRange   = "range"
+)
+
+// Field is an entry of the canonical model dictionary
+type Field struct {
+	// Name is the dotted path of the canonical field (e.g. "temperature", "env.pressure")
+	Name string `mapstructure:"name" validate:"required"`
+	// Aliases are the dotted paths of the vendor fields read when the canonical field is missing;
+	// the alias is removed from the payload once the value is moved to the canonical field
+	Aliases []string `mapstructure:"aliases"`
+	// Type is the canonical type: "number" (default), "integer", "string", "boolean" or "timestamp" (RFC 3339)
+	Type string `mapstructure:"type" validate:"omitempty,oneof=number integer string boolean timestamp"`
+	// Unit is the canonical unit of numeric fields (e.g. "°C", "kPa")
+	Unit string `mapstructure:"unit"`
+	// SourceUnit is the unit of the values that do not carry one (defaults to Unit)
+	SourceUnit string `mapstructure:"sourceUnit"`
+	// Min and Max are the allowed range of numeric fields, in the canonical unit
+	Min *float64 `mapstructure:"min"`
+	Max *float64 `mapstructure:"max"`
+	// Precision rounds numeric values to the number of decimals (unset = no rounding)
+	Precision *int `mapstructure:"precision" validate:"omitempty,min=0,max=15"`
+	// Required reports an issue when the field is missing
+	Required bool `mapstructure:"required"`
+}
+
+type RunnerConfig struct {
+	// Fields is the canonical model dictionary
+	Fields []Field `mapstructure:"fields" validate:"required,min=1,dive"`
+	// OutOfRange is the action on out-of-range values: "flag" (keep the value), "clamp" (to the
+	// nearest bound) or "drop" (remove the field); the issue is reported in every case
+	OutOfRange string `mapstructure:"outOfRange" default:"flag" validate:"oneof=flag clamp drop"`
+	// ErrorsKey is the metadata key of the JSON list of coercion issues
+	ErrorsKey string `mapstructure:"errorsKey" default:"eb-canonical-errors" validate:"required"`
+	// FailOnError makes the message fail when a field cannot be coerced or is missing
+	FailOnError bool `mapstructure:"failOnError" default:"false"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+// issue is a coercion problem of a field
+type issue struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type CanonicalRunner struct {
+	cfg  *RunnerConfig
+	slog *slog.Logger
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a new instance of CanonicalRunner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	for i := range cfg.Fields {
+		f := &cfg.Fields[i]
+		if f.Type == "" {
+			f.Type = typeNumber
+		}
+		if err := validateUnits(*f); err != nil {
+			return nil, fmt.Errorf("invalid field %s: %w", f.Name, err)
+		}
+	}
+
+	log := slog.Default().With("context", "Canonical Runner")
+	log.Info("loading canonical model", "fields", len(cfg.Fields), "outOfRange", cfg.OutOfRange)
+
+	return &CanonicalRunner{
+		cfg:  cfg,
+		slog: log,
+	}, nil
+}
+
+// validateUnits checks that the units of the field are known and convertible
+func validateUnits(f Field) error {
+	if f.Unit == "" {
+		if f.SourceUnit != "" {
+			return fmt.Errorf("sourceUnit requires a canonical unit")
+		}
+		return nil
+	}
+	if f.Type != typeNumber && f.Type != typeInteger {
+		return fmt.Errorf("units require a numeric type, got %s", f.Type)
+	}
+	if _, err := lookupUnit(f.Unit); err != nil {
+		return err
+	}
+	if f.SourceUnit != "" {
+		if _, err := convert(0, f.SourceUnit, f.Unit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Process coerces the payload fields to the canonical model and reports the issues in metadata
+func (r *CanonicalRunner) Process(msg *message.RunnerMessage) error {
+	data, err := msg.GetData()
+	if err != nil {
+		return fmt.Errorf("failed to get data: %w", err)
+	}
+	if len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds max input size %d", len(data), r.cfg.MaxInputSize)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return fmt.Errorf("payload must be a JSON object: %w", err)
+	}
+
+	var issues []issue
+	for _, f := range r.cfg.Fields {
+		issues = append(issues, r.canonicalize(payload, f)...)
+	}
+
+	if len(issues) > 0 {
+		r.slog.Debug("canonicalization issues", "count", len(issues))
+		if r.cfg.FailOnError {
+			for _, is := range issues {
+				if is.Code != issueRange {
+					return fmt.Errorf("field %s: %s", is.Field, is.Message)
+				}
+			}
+		}
+		report, err := json.Marshal(issues)
+		if err != nil {
+			return fmt.Errorf("failed to marshal issues: %w", err)
+		}
+		msg.AddMetadata(r.cfg.ErrorsKey, string(report))
+	}
+
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	msg.SetData(out)
+	return nil
+}
+
+// canonicalize moves the field to its canonical path and coerces its value; a value that
+// cannot be coerced is left untouched at its original path
+func (r *CanonicalRunner) canonicalize(payload map[string]any, f Field) []issue {
+	raw, path, ok := lookup(payload, f)
+	if !ok {
+		if f.Required {
+			return []issue{{Field: f.Name, Code: issueMissing, Message: "field is missing"}}
+		}
+		return nil
+	}
+
+	v, code, err := coerce(raw, f)
+	if err != nil {
+		return []issue{{Field: f.Name, Code: code, Message: err.Error()}}
+	}
+
+	var issues []issue
+	if num, ok := v.(float64); ok {
+		var is *issue
+		num, is = r.checkRange(num, f)
+		if is != nil {
+			issues = append(issues, *is)
+			if r.cfg.OutOfRange == rangeDrop {
+				jsonpath.Delete(payload, path)
+				return issues
+			}
+		}
+		v = num
+		if f.Type == typeInteger {
+			v = int64(math.Round(num))
+		}
+	}
+
+	if path != f.Name {
+		jsonpath.Delete(payload, path)
+	}
+	if !jsonpath.Set(payload, f.Name, v) {
+		jsonpath.Set(payload, path, raw)
+		return append(issues, issue{Field: f.Name, Code: issueType, Message: "canonical path is not in an object"})
+	}
+	return issues
+}
+
+// checkRange checks the allowed range, clamping the value when configured
+func (r *CanonicalRunner) checkRange(v float64, f Field) (float64, *issue) {
+	var bound float64
+	switch {
+	case f.Min != nil && v < *f.Min:
+		bound = *f.Min
+	case f.Max != nil && v > *f.Max:
+		bound = *f.Max
+	default:
+		return v, nil
+	}
+	is := &issue{Field: f.Name, Code: issueRange, Message: fmt.Sprintf("value %v out of range %s", v, common.RangeString(f.Min, f.Max))}
+	if r.cfg.OutOfRange == rangeClamp {
+		is.Message += fmt.Sprintf(", clamped to %v", bound)
+		return bound, is
+	}
+	return v, is
+}
+
+// lookup returns the value of the canonical field or of its first present alias, with its path
+func lookup(payload map[string]any, f Field) (any, string, bool) {
+	for _, path := range append([]string{f.Name}, f.Aliases...) {
+		if v, ok := jsonpath.Get(payload, path); ok && v != nil {
+			return v, path, true
+		}
+	}
+	return nil, "", false
+}
+
+// quantityPattern matches a number with an optional unit suffix, e.g. "72.5 °F" or "30psi"
+var quantityPattern = regexp.MustCompile(`^\s*([-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?)\s*(\S.*?)?\s*$`)
+
+// coerce converts the raw value to the field type and unit, returning the issue code of a failure
+func coerce(raw any, f Field) (any, string, error) {
+	switch f.Type {
+	case typeNumber, typeInteger:
+		num, unit, err := toQuantity(raw)
+		if err != nil {
+			return nil, issueType, err
+		}
+		if f.Unit != "" {
+			if unit == "" {
+				unit = f.SourceUnit
+			}
+			if unit != "" {
+				if num, err = convert(num, unit, f.Unit); err != nil {
+					return nil, issueUnit, err
+				}
+			}
+		}
+		if f.Precision != nil {
+			p := math.Pow10(*f.Precision)
+			num = math.Round(num*p) / p
+		}
+		return num, "", nil
+	case typeString:
+		switch v := raw.(type) {
+		case string:
+			return v, "", nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), "", nil
+		case bool:
+			return strconv.FormatBool(v), "", nil
+		}
+	case typeBoolean:
+		switch v := raw.(type) {
+		case bool:
+			return v, "", nil
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, "", nil
+			}
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "true", "1", "yes", "on":
+				return true, "", nil
+			case "false", "0", "no", "off":
+				return false, "", nil
+			}
+		}
+	case typeTimestamp:
+		if t, ok := toTime(raw); ok {
+			return t.UTC().Format(time.RFC3339Nano), "", nil
+		}
+	}
+	return nil, issueType, fmt.Errorf("cannot coerce %v to %s", raw, f.Type)
+}
+
+// toQuantity reads a number and its unit from a JSON number, a string with a unit
+// suffix or a {"value": ..., "unit": ...} object
+func toQuantity(raw any) (float64, string, error) {
+	switch v := raw.(type) {
+	case float64:
+		return v, "", nil
+	case string:
+		m := quantityPattern.FindStringSubmatch(v)
+		if m == nil {
+			return 0, "", fmt.Errorf("cannot coerce %q to a number", v)
+		}
+		num, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, "", fmt.Errorf("cannot coerce %q to a number", v)
+		}
+		return num, m[2], nil
+	case map[string]any:
+		value, ok := v["value"]
+		if !ok {
+			return 0, "", fmt.Errorf("object without value")
+		}
+		num, unit, err := toQuantity(value)
+		if s, ok := v["unit"].(string); ok && err == nil {
+			unit = s
+		}
+		return num, unit, err
+	}
+	return 0, "", fmt.Errorf("cannot coerce %v to a number", raw)
+}
+
+// toTime reads an RFC 3339 string or a Unix time in seconds or, above 1e12, milliseconds
+func toTime(raw any) (time.Time, bool) {
+	switch v := raw.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(v)); err == nil {
+			return t, true
+		}
+		if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return toTime(n)
+		}
+	case float64:
+		if v > 1e12 {
+			return time.UnixMilli(int64(v)), true
+		}
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)), true
+	}
+	return time.Time{}, false
+}
+
+func (r *CanonicalRunner) Close() error {
+	return nil
+}
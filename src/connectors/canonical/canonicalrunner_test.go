@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+var testFields = []Field{
+	{
+		Name:       "temperature",
+		Aliases:    []string{"temp_f", "sensor.temp"},
+		Unit:       "°C",
+		SourceUnit: "°F",
+		Min:        ptr(-40.0),
+		Max:        ptr(85.0),
+		Precision:  ptr(1),
+	},
+	{Name: "pressure", Unit: "kPa", Precision: ptr(2)},
+	{Name: "battery", Type: typeInteger, Min: ptr(0.0), Max: ptr(100.0)},
+	{Name: "online", Type: typeBoolean},
+	{Name: "ts", Type: typeTimestamp, Required: true},
+}
+
+func TestCanonicalProcess(t *testing.T) {
+	tests := []struct {
+		name        string
+		outOfRange  string
+		data        string
+		want        string
+		wantIssues  map[string]string
+		wantMessage string
+	}{
+		{
+			name: "conversions",
+			data: `{"temp_f":98.6,"pressure":"30 psi","battery":"87.6","online":"on","ts":1700000000}`,
+			want: `{"temperature":37,"pressure":206.84,"battery":88,"online":true,"ts":"2023-11-14T22:13:20Z"}`,
+		},
+		{
+			name: "nested aliases and values carrying their unit",
+			data: `{"sensor":{"temp":{"value":310.15,"unit":"K"}},"pressure":{"value":1,"unit":"bar"},"ts":"2024-01-02T03:04:05+01:00"}`,
+			want: `{"sensor":{},"temperature":37,"pressure":100,"ts":"2024-01-02T02:04:05Z"}`,
+		},
+		{
+			// Values that cannot be coerced are left untouched; out-of-range values are flagged by default
+			name:       "issues",
+			data:       `{"temperature":"hot","pressure":"3 m","battery":120}`,
+			want:       `{"temperature":"hot","pressure":"3 m","battery":120}`,
+			wantIssues: map[string]string{"temperature": issueType, "pressure": issueUnit, "battery": issueRange, "ts": issueMissing},
+		},
+		{
+			name:        "clamp",
+			outOfRange:  rangeClamp,
+			data:        `{"temperature":-60,"ts":0}`,
+			want:        `{"temperature":-40,"ts":"1970-01-01T00:00:00Z"}`,
+			wantIssues:  map[string]string{"temperature": issueRange},
+			wantMessage: "clamped to -40",
+		},
+		{
+			name:       "drop",
+			outOfRange: rangeDrop,
+			data:       `{"temp_f":200,"ts":0}`,
+			want:       `{"ts":"1970-01-01T00:00:00Z"}`,
+			wantIssues: map[string]string{"temperature": issueRange},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(&RunnerConfig{
+				Fields:       testFields,
+				OutOfRange:   tt.outOfRange,
+				ErrorsKey:    "eb-canonical-errors",
+				MaxInputSize: 1024,
+			})
+			if err != nil {
+				t.Fatalf("failed to create runner: %v", err)
+			}
+			msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(tt.data), nil))
+			if err := runner.Process(msg); err != nil {
+				t.Fatalf("process failed: %v", err)
+			}
+			meta, out, err := msg.GetMetadataAndData()
+			if err != nil {
+				t.Fatalf("failed to get message: %v", err)
+			}
+
+			var got, want any
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("invalid output payload: %v", err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("payload = %s, want %s", out, tt.want)
+			}
+
+			var issues []issue
+			if report := meta["eb-canonical-errors"]; report != "" {
+				if err := json.Unmarshal([]byte(report), &issues); err != nil {
+					t.Fatalf("invalid issues report: %v", err)
+				}
+			}
+			codes := map[string]string{}
+			for _, is := range issues {
+				codes[is.Field] = is.Code
+				if tt.wantMessage != "" && !strings.Contains(is.Message, tt.wantMessage) {
+					t.Errorf("issue message = %q, want %q", is.Message, tt.wantMessage)
+				}
+			}
+			if !maps.Equal(codes, tt.wantIssues) {
+				t.Errorf("issues = %v, want %v", issues, tt.wantIssues)
+			}
+		})
+	}
+}
+
+func TestCanonicalFailOnError(t *testing.T) {
+	runner, err := NewRunner(&RunnerConfig{Fields: testFields, ErrorsKey: "eb-canonical-errors", FailOnError: true, MaxInputSize: 1024})
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"battery":120}`), nil))
+	if err := runner.Process(msg); err == nil || !strings.Contains(err.Error(), "ts") {
+		t.Errorf("expected missing field error, got %v", err)
+	}
+}
+
+func TestInvalidUnits(t *testing.T) {
+	for _, field := range []map[string]any{
+		{"name": "t", "unit": "furlong"},
+		{"name": "t", "unit": "°C", "sourceUnit": "psi"},
+		{"name": "t", "type": "string", "unit": "°C"},
+	} {
+		cfg := new(RunnerConfig)
+		if err := utils.ParseConfig(map[string]any{"fields": []any{field}}, cfg); err != nil {
+			t.Fatalf("failed to parse config: %v", err)
+		}
+		if _, err := NewRunner(cfg); err == nil {
+			t.Errorf("expected error for field %v", field)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		v        float64
+		from, to string
+		want     float64
+	}{
+		{212, "°F", "°C", 100},
+		{0, "C", "K", 273.15},
+		{100, "kPa", "psi", 14.503774},
+		{36, "km/h", "m/s", 10},
+		{1, "kWh", "J", 3.6e6},
+	}
+	for _, c := range cases {
+		got, err := convert(c.v, c.from, c.to)
+		if err != nil || math.Abs(got-c.want) > 1e-6 {
+			t.Errorf("convert(%v %s → %s) = %v, %v; want %v", c.v, c.from, c.to, got, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unit is a measurement unit converted to the base unit of its dimension as value*scale + offset
+type unit struct {
+	dimension string
+	scale     float64
+	offset    float64
+}
+
+// units are the known units by lower-case symbol or name; base units are °C, Pa, m, m/s, kg, J, W and s
+var units = map[string]unit{}
+
+func init() {
+	register := func(dimension string, scale, offset float64, names ...string) {
+		for _, n := range names {
+			units[strings.ToLower(n)] = unit{dimension: dimension, scale: scale, offset: offset}
+		}
+	}
+
+	register("temperature", 1, 0, "°C", "C", "degC", "celsius")
+	register("temperature", 5.0/9, -32*5.0/9, "°F", "F", "degF", "fahrenheit")
+	register("temperature", 1, -273.15, "K", "kelvin")
+
+	register("pressure", 1, 0, "Pa", "pascal")
+	register("pressure", 100, 0, "hPa", "mbar")
+	register("pressure", 1000, 0, "kPa")
+	register("pressure", 1e5, 0, "bar")
+	register("pressure", 6894.757293168, 0, "psi")
+	register("pressure", 101325, 0, "atm")
+
+	register("length", 1, 0, "m", "meter", "metre")
+	register("length", 0.001, 0, "mm")
+	register("length", 0.01, 0, "cm")
+	register("length", 1000, 0, "km")
+	register("length", 0.0254, 0, "in", "inch")
+	register("length", 0.3048, 0, "ft", "foot", "feet")
+	register("length", 1609.344, 0, "mi", "mile")
+
+	register("speed", 1, 0, "m/s")
+	register("speed", 1/3.6, 0, "km/h", "kph")
+	register("speed", 0.44704, 0, "mph")
+	register("speed", 1852.0/3600, 0, "kn", "knot")
+
+	register("mass", 1, 0, "kg")
+	register("mass", 0.001, 0, "g")
+	register("mass", 0.45359237, 0, "lb")
+	register("mass", 0.028349523125, 0, "oz")
+
+	register("energy", 1, 0, "J")
+	register("energy", 1000, 0, "kJ")
+	register("energy", 3600, 0, "Wh")
+	register("energy", 3.6e6, 0, "kWh")
+
+	register("power", 1, 0, "W")
+	register("power", 1000, 0, "kW")
+
+	register("duration", 1, 0, "s", "sec")
+	register("duration", 0.001, 0, "ms")
+	register("duration", 60, 0, "min")
+	register("duration", 3600, 0, "h")
+}
+
+// lookupUnit returns the unit of a symbol or name
+func lookupUnit(name string) (unit, error) {
+	u, ok := units[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return unit{}, fmt.Errorf("unknown unit %q", name)
+	}
+	return u, nil
+}
+
+// convert converts the value between units of the same dimension
+func convert(v float64, from, to string) (float64, error) {
+	if from == to {
+		return v, nil
+	}
+	fu, err := lookupUnit(from)
+	if err != nil {
+		return 0, err
+	}
+	tu, err := lookupUnit(to)
+	if err != nil {
+		return 0, err
+	}
+	if fu.dimension != tu.dimension {
+		return 0, fmt.Errorf("cannot convert %s (%s) to %s (%s)", from, fu.dimension, to, tu.dimension)
+	}
+	base := v*fu.scale + fu.offset
+	return (base - tu.offset) / tu.scale, nil
+}
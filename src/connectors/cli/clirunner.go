@@ -9,9 +9,11 @@ import (
 	"log/slog"
 	"os/exec"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sandrolain/events-bridge/src/common/encdec"
+	"github.com/sandrolain/events-bridge/src/common/procmon"
 	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
 )
@@ -33,6 +35,21 @@ type RunnerConfig struct {
 	DenyEnvVars     []string          `mapstructure:"denyEnvVars"`                     // Blacklist of environment variables to filter
 	UseShell        bool              `mapstructure:"useShell" default:"false"`        // Allow shell interpretation (dangerous, disabled by default)
 
+	// CBOR selects the CBOR encoding profile (e.g. core deterministic) of the cbor format
+	CBOR encdec.CBOROptions `mapstructure:"cbor"`
+
+	// Monitor samples CPU, RSS and open files of the command process. On a limit breach the
+	// process is killed: a long-running process is restarted, a per-message execution fails.
+	Monitor procmon.Config `mapstructure:"monitor"`
+
+	// ErrorRules map the exit codes and stderr patterns of the failed per-message executions to
+	// error codes, retryable or permanent, in order: the first matching rule applies
+	ErrorRules []ErrorRuleConfig `mapstructure:"errorRules" validate:"dive"`
+	// ExitCodeKey is the metadata key set to the exit code of a failed execution
+	ExitCodeKey string `mapstructure:"exitCodeKey" default:"eb-cli-exit-code"`
+	// ErrorCodeKey is the metadata key set to the error code of a failed execution
+	ErrorCodeKey string `mapstructure:"errorCodeKey" default:"eb-cli-error-code"`
+
 	// LongRunning enables target-like behavior: start process once and pipe messages to stdin
 	// When false (default), runs command once per message and returns stdout as result
 	LongRunning bool `mapstructure:"longRunning" default:"false"`
@@ -54,11 +71,16 @@ func NewRunner(anyCfg any) (connectors.Runner, error) {
 		return nil, err
 	}
 
-	decoder, err := encdec.NewMessageDecoder(cfg.Format, cfg.MetadataKey, cfg.DataKey)
+	decoder, err := encdec.NewMessageDecoderWithOptions(cfg.Format, cfg.MetadataKey, cfg.DataKey, &cfg.CBOR)
 	if err != nil {
 		return nil, fmt.Errorf("invalid format: %w", err)
 	}
 
+	errs, err := newErrorMapper(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	executor, err := NewCommandExecutor(baseConfig, slog.Default().With("context", "CLI Runner"))
 	if err != nil {
 		return nil, err
@@ -69,52 +91,80 @@ func NewRunner(anyCfg any) (connectors.Runner, error) {
 		slog:     executor.slog,
 		executor: executor,
 		decoder:  decoder,
+		errs:     errs,
 	}
 
 	// If configured as long-running, start the process now and keep pipes
 	if cfg.LongRunning {
-		ctx, cancel := context.WithCancel(context.Background())
+		runner.ctx, runner.cancel = context.WithCancel(context.Background())
+		if err := runner.startProcess(); err != nil {
+			runner.cancel()
+			return nil, err
+		}
+		runner.slog.Info("started CLI runner (long-running)", "command", cfg.Command, "args", cfg.Args, "format", cfg.Format)
+	}
 
-		cmd := executor.CreateCommand(ctx)
+	return runner, nil
+}
 
-		stdin, err := cmd.StdinPipe()
-		if err != nil {
-			cancel()
-			return nil, fmt.Errorf("failed to open stdin: %w", err)
-		}
+// startProcess starts the long-running process and its pipes
+func (c *CLIRunner) startProcess() error {
+	cmd := c.executor.CreateCommand(c.ctx)
 
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			cancel()
-			return nil, fmt.Errorf("failed to open stdout: %w", err)
-		}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdin: %w", err)
+	}
 
-		stderr, err := cmd.StderrPipe()
-		if err != nil {
-			cancel()
-			return nil, fmt.Errorf("failed to open stderr: %w", err)
-		}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdout: %w", err)
+	}
 
-		if err := cmd.Start(); err != nil {
-			cancel()
-			return nil, fmt.Errorf("failed to start command: %w", err)
-		}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stderr: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
 
-		runner.ctx = ctx
-		runner.cancel = cancel
-		runner.cmd = cmd
-		runner.stdin = stdin
-		runner.done = make(chan struct{})
-		runner.waitDone = make(chan error, 1)
+	done := make(chan struct{})
+	waitDone := make(chan error, 1)
+	c.cmd = cmd
+	c.stdin = stdin
+	c.done = done
+	c.waitDone = waitDone
 
-		go runner.waitCommand()
-		go PipeLogger(runner.slog, stdout, "stdout", ctx)
-		go PipeLogger(runner.slog, stderr, "stderr", ctx)
+	go c.waitCommand(cmd, done, waitDone)
+	go PipeLogger(c.slog, stdout, "stdout", c.ctx)
+	go PipeLogger(c.slog, stderr, "stderr", c.ctx)
+	c.executor.Watch(c.ctx, cmd, c.restartProcess)
 
-		runner.slog.Info("started CLI runner (long-running)", "command", cfg.Command, "args", cfg.Args, "format", cfg.Format)
+	return nil
+}
+
+// restartProcess kills the long-running process after a resource limit breach and starts a new one
+func (c *CLIRunner) restartProcess(b procmon.Breach) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.ctx.Err() != nil || c.stdin == nil {
+		// Closing
+		return
 	}
 
-	return runner, nil
+	c.slog.Warn("restarting CLI command after resource limit breach", "pid", b.PID, "reason", b.Reason)
+	if err := c.cmd.Process.Kill(); err != nil {
+		c.slog.Warn("failed to kill process", "error", err)
+	}
+	<-c.done
+
+	if err := c.startProcess(); err != nil {
+		c.slog.Error("failed to restart CLI command", "error", err)
+		return
+	}
+	c.executor.monitor.Restarted()
 }
 
 type CLIRunner struct {
@@ -122,6 +172,7 @@ type CLIRunner struct {
 	slog     *slog.Logger
 	decoder  encdec.MessageDecoder
 	executor *CommandExecutor
+	errs     *errorMapper
 	// Long-running process fields (used when cfg.LongRunning == true)
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -130,7 +181,6 @@ type CLIRunner struct {
 	stdin io.WriteCloser
 	done  chan struct{}
 
-	waitOnce sync.Once
 	waitDone chan error
 
 	exitErrMu sync.RWMutex
@@ -142,6 +192,14 @@ type CLIRunner struct {
 func (c *CLIRunner) Process(msg *message.RunnerMessage) error {
 	// If configured as long-running, write to the already-running process stdin
 	if c.cfg.LongRunning {
+		encoded, err := c.decoder.EncodeMessage(msg)
+		if err != nil {
+			return err
+		}
+
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+
 		// Check process state
 		select {
 		case <-c.done:
@@ -152,18 +210,10 @@ func (c *CLIRunner) Process(msg *message.RunnerMessage) error {
 		default:
 		}
 
-		encoded, err := c.decoder.EncodeMessage(msg)
-		if err != nil {
-			return err
-		}
-
 		if c.stdin == nil {
 			return errors.New("stdin pipe not available")
 		}
 
-		c.writeMu.Lock()
-		defer c.writeMu.Unlock()
-
 		if _, err := c.stdin.Write(encoded); err != nil {
 			return fmt.Errorf("failed to write to CLI stdin: %w", err)
 		}
@@ -189,9 +239,26 @@ func (c *CLIRunner) Process(msg *message.RunnerMessage) error {
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	err = cmd.Run()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("cli execution error: %w", err)
+	}
+
+	var breach atomic.Pointer[procmon.Breach]
+	c.executor.Watch(ctx, cmd, func(b procmon.Breach) {
+		breach.Store(&b)
+		if err := cmd.Process.Kill(); err != nil {
+			c.slog.Warn("failed to kill process", "error", err)
+		}
+	})
+
+	err = cmd.Wait()
+	if b := breach.Load(); b != nil {
+		return fmt.Errorf("cli command killed: %s", b.Reason)
+	}
 	if err != nil {
-		return fmt.Errorf("cli execution error: %w, stderr: %s, stdout: %s", err, stderr.String(), stdout.String())
+		exitErr := c.errs.classify(ctx, err, stderr.Bytes())
+		c.errs.annotate(msg, exitErr)
+		return exitErr
 	}
 
 	res, err := c.decoder.DecodeMessage(stdout.Bytes())
@@ -210,6 +277,9 @@ func (c *CLIRunner) Process(msg *message.RunnerMessage) error {
 func (c *CLIRunner) Close() error {
 	// If long-running, attempt graceful shutdown
 	if c.cfg.LongRunning {
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+
 		if c.cancel == nil {
 			// nothing to do
 		} else {
@@ -272,8 +342,8 @@ func (c *CLIRunner) waitForExit(timeout time.Duration) error {
 	}
 }
 
-func (c *CLIRunner) waitCommand() {
-	err := c.cmd.Wait()
+func (c *CLIRunner) waitCommand(cmd *exec.Cmd, done chan struct{}, waitDone chan error) {
+	err := cmd.Wait()
 	if err != nil && c.ctx.Err() != nil {
 		err = nil
 	}
@@ -282,12 +352,10 @@ func (c *CLIRunner) waitCommand() {
 	c.exitErr = err
 	c.exitErrMu.Unlock()
 
-	c.waitOnce.Do(func() {
-		c.waitDone <- err
-		close(c.waitDone)
-	})
+	waitDone <- err
+	close(waitDone)
 
-	close(c.done)
+	close(done)
 }
 
 func (c *CLIRunner) commandExitError() error {
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/sandrolain/events-bridge/src/common/procmon"
 	"github.com/sandrolain/events-bridge/src/message"
 )
 
@@ -193,3 +196,68 @@ func TestCLIRunnerProcessDecodeError(t *testing.T) {
 		t.Fatal("Expected decode error, but got none")
 	}
 }
+
+func TestCLIRunnerMonitorKillsCommand(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process monitoring requires /proc")
+	}
+	runner, err := NewRunner(&RunnerConfig{
+		Command: "sleep",
+		Args:    []string{"3"},
+		Timeout: 5 * time.Second,
+		Format:  "cli",
+		Monitor: procmon.Config{Interval: 20 * time.Millisecond, MaxOpenFiles: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewRunner error: %v", err)
+	}
+	defer func() {
+		if err := runner.Close(); err != nil {
+			t.Logf("failed to close runner: %v", err)
+		}
+	}()
+
+	msg := message.NewRunnerMessage(&mockSourceMessage{id: []byte("id"), data: []byte("data")})
+	err = runner.Process(msg)
+	if err == nil || !strings.Contains(err.Error(), "open files") {
+		t.Fatalf("expected resource limit error, got %v", err)
+	}
+}
+
+func TestCLIRunnerMonitorRestartsLongRunning(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process monitoring requires /proc")
+	}
+	r, err := NewRunner(&RunnerConfig{
+		Command:     "cat",
+		Timeout:     time.Second,
+		Format:      "cli",
+		LongRunning: true,
+		Monitor:     procmon.Config{Interval: 20 * time.Millisecond, MaxOpenFiles: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewRunner error: %v", err)
+	}
+	runner := r.(*CLIRunner)
+	defer func() {
+		if err := runner.Close(); err != nil {
+			t.Logf("failed to close runner: %v", err)
+		}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runner.executor.monitor.Stats().Restarts == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("long-running command was not restarted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := procmon.Snapshot()[runner.executor.monitor.Name()]; !ok {
+		t.Error("monitor not registered")
+	}
+
+	msg := message.NewRunnerMessage(&mockSourceMessage{id: []byte("id"), data: []byte("data")})
+	if err := runner.Process(msg); err != nil {
+		t.Fatalf("Process error after restart: %v", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/sandrolain/events-bridge/src/common/encdec"
+	"github.com/sandrolain/events-bridge/src/common/procmon"
 	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
 )
@@ -28,6 +29,13 @@ type SourceConfig struct {
 	MaxOutputSize   int64             `mapstructure:"maxOutputSize" default:"1048576"` // Max output size in bytes (default 1MB)
 	DenyEnvVars     []string          `mapstructure:"denyEnvVars"`                     // Blacklist of environment variables to filter
 	UseShell        bool              `mapstructure:"useShell" default:"false"`        // Allow shell interpretation (dangerous, disabled by default)
+
+	// CBOR selects the CBOR encoding profile (e.g. core deterministic) of the cbor format
+	CBOR encdec.CBOROptions `mapstructure:"cbor"`
+
+	// Monitor samples CPU, RSS and open files of the command process.
+	// On a limit breach the process is killed and the source stops producing.
+	Monitor procmon.Config `mapstructure:"monitor"`
 }
 
 func NewSourceConfig() any {
@@ -46,7 +54,7 @@ func NewSource(anyCfg any) (connectors.Source, error) {
 		return nil, err
 	}
 
-	decoder, err := encdec.NewMessageDecoder(cfg.Format, cfg.MetadataKey, cfg.DataKey)
+	decoder, err := encdec.NewMessageDecoderWithOptions(cfg.Format, cfg.MetadataKey, cfg.DataKey, &cfg.CBOR)
 	if err != nil {
 		return nil, fmt.Errorf("invalid format: %w", err)
 	}
@@ -115,6 +123,12 @@ func (s *CLISource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
 
 	go s.waitCommand()
 	go PipeLogger(s.slog, stderr, "stderr", s.ctx)
+	s.executor.Watch(s.ctx, cmd, func(b procmon.Breach) {
+		s.slog.Error("killing CLI command after resource limit breach", "pid", b.PID, "reason", b.Reason)
+		if err := cmd.Process.Kill(); err != nil {
+			s.slog.Warn("failed to kill process", "error", err)
+		}
+	})
 	go func() {
 		err := s.consumeStream(stdout)
 		if err != nil && s.ctx.Err() == nil {
@@ -10,6 +10,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/procmon"
 )
 
 // LimitedReader wraps an io.Reader and limits the total bytes read
@@ -49,6 +51,7 @@ type BaseConfig struct {
 	MaxOutputSize   int64             `mapstructure:"maxOutputSize" default:"1048576"` // Max output size in bytes (default 1MB)
 	DenyEnvVars     []string          `mapstructure:"denyEnvVars"`                     // Blacklist of environment variables to filter
 	UseShell        bool              `mapstructure:"useShell" default:"false"`        // Allow shell interpretation (dangerous, disabled by default)
+	Monitor         procmon.Config    `mapstructure:"monitor"`                         // Resource monitoring and limits of the command process
 }
 
 // validateCommand validates the command and arguments to prevent command injection
@@ -209,9 +212,10 @@ func validateBaseConfig(cfg *BaseConfig) error {
 // CommandExecutor provides common functionality for executing CLI commands
 type CommandExecutor struct {
 	BaseConfig
-	ctx    context.Context
-	cancel context.CancelFunc
-	slog   *slog.Logger
+	ctx     context.Context
+	cancel  context.CancelFunc
+	slog    *slog.Logger
+	monitor *procmon.Monitor
 }
 
 // NewCommandExecutor creates a new command executor with validation
@@ -222,12 +226,16 @@ func NewCommandExecutor(cfg *BaseConfig, logger *slog.Logger) (*CommandExecutor,
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &CommandExecutor{
+	ce := &CommandExecutor{
 		BaseConfig: *cfg,
 		ctx:        ctx,
 		cancel:     cancel,
 		slog:       logger,
-	}, nil
+	}
+	if cfg.Monitor.Enabled() {
+		ce.monitor = procmon.NewMonitor("cli:"+cfg.Command, cfg.Monitor, logger)
+	}
+	return ce, nil
 }
 
 // CreateCommand creates and configures an exec.Cmd with the given context
@@ -252,11 +260,23 @@ func (ce *CommandExecutor) CreateCommand(ctx context.Context) *exec.Cmd {
 	return cmd
 }
 
+// Watch monitors the resource usage of a started command until the context is done or the
+// command exits, calling onBreach when a limit is exceeded. It is a no-op when monitoring is disabled.
+func (ce *CommandExecutor) Watch(ctx context.Context, cmd *exec.Cmd, onBreach func(procmon.Breach)) {
+	if ce.monitor == nil || cmd.Process == nil {
+		return
+	}
+	go ce.monitor.Watch(ctx, cmd.Process.Pid, onBreach)
+}
+
 // Close cancels the command context
 func (ce *CommandExecutor) Close() error {
 	if ce.cancel != nil {
 		ce.cancel()
 	}
+	if ce.monitor != nil {
+		ce.monitor.Close()
+	}
 	return nil
 }
 
@@ -291,6 +311,7 @@ func sourceToBaseConfig(cfg *SourceConfig) *BaseConfig {
 		MaxOutputSize:   cfg.MaxOutputSize,
 		DenyEnvVars:     cfg.DenyEnvVars,
 		UseShell:        cfg.UseShell,
+		Monitor:         cfg.Monitor,
 	}
 }
 
@@ -305,5 +326,6 @@ func runnerToBaseConfig(cfg *RunnerConfig) *BaseConfig {
 		MaxOutputSize:   cfg.MaxOutputSize,
 		DenyEnvVars:     cfg.DenyEnvVars,
 		UseShell:        cfg.UseShell,
+		Monitor:         cfg.Monitor,
 	}
 }
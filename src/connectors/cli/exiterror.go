@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	// codeTimeout is the error code of the executions exceeding the timeout
+	codeTimeout = "cli_timeout"
+	// codeError is the error code of the executions failing without an exit code
+	codeError = "cli_error"
+	// maxStderrLen bounds the stderr reported in the error message
+	maxStderrLen = 1024
+)
+
+// ErrorRuleConfig maps the failed executions with a matching exit code and stderr to an error code
+type ErrorRuleConfig struct {
+	// ExitCodes are the matched exit codes (any if empty)
+	ExitCodes []int `mapstructure:"exitCodes"`
+	// Stderr is a regular expression matched against the stderr output (any if empty).
+	// Its named groups are set in the metadata.
+	Stderr string `mapstructure:"stderr"`
+	// Code is the error code of the matching executions
+	Code string `mapstructure:"code" validate:"required"`
+	// Retryable reports that executing the message again may succeed, e.g. a lock held by another process
+	Retryable bool `mapstructure:"retryable"`
+}
+
+// ExitError is the error of a failed execution, typed by the first matching error rule
+type ExitError struct {
+	// ExitCode is the exit code of the process, -1 when killed or not started
+	ExitCode int
+	// Code is the error code of the matching rule, or "cli_exit_<exit code>"
+	Code string
+	// Stderr is the stderr output of the process
+	Stderr    string
+	groups    map[string]string
+	retryable bool
+	err       error
+}
+
+func (e *ExitError) Error() string {
+	stderr := strings.TrimSpace(e.Stderr)
+	if len(stderr) > maxStderrLen {
+		stderr = stderr[:maxStderrLen] + "..."
+	}
+	return fmt.Sprintf("cli execution error (%s): %v, stderr: %s", e.Code, e.err, stderr)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.err
+}
+
+// ErrorCode implements message.CodedError
+func (e *ExitError) ErrorCode() string {
+	return e.Code
+}
+
+// Retryable implements message.RetryableError
+func (e *ExitError) Retryable() bool {
+	return e.retryable
+}
+
+// errorRule is a compiled ErrorRuleConfig
+type errorRule struct {
+	cfg    ErrorRuleConfig
+	stderr *regexp.Regexp
+}
+
+// errorMapper types the failed executions and reports them in the metadata
+type errorMapper struct {
+	rules        []errorRule
+	exitCodeKey  string
+	errorCodeKey string
+}
+
+func newErrorMapper(cfg *RunnerConfig) (*errorMapper, error) {
+	m := &errorMapper{exitCodeKey: cfg.ExitCodeKey, errorCodeKey: cfg.ErrorCodeKey}
+	for i, rule := range cfg.ErrorRules {
+		r := errorRule{cfg: rule}
+		if rule.Stderr != "" {
+			re, err := regexp.Compile(rule.Stderr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid stderr pattern of error rule %d: %w", i, err)
+			}
+			r.stderr = re
+		}
+		m.rules = append(m.rules, r)
+	}
+	return m, nil
+}
+
+// classify returns the typed error of a failed execution. The executions exceeding the
+// timeout are retryable, the others are typed by the first matching rule.
+func (m *errorMapper) classify(ctx context.Context, err error, stderr []byte) *ExitError {
+	e := &ExitError{ExitCode: -1, Code: codeError, Stderr: string(stderr), err: err}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		e.Code, e.retryable = codeTimeout, true
+		return e
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return e
+	}
+	e.ExitCode = exitErr.ExitCode()
+	e.Code = "cli_exit_" + strconv.Itoa(e.ExitCode)
+
+	for _, r := range m.rules {
+		if len(r.cfg.ExitCodes) > 0 && !slices.Contains(r.cfg.ExitCodes, e.ExitCode) {
+			continue
+		}
+		if r.stderr != nil {
+			match := r.stderr.FindSubmatch(stderr)
+			if match == nil {
+				continue
+			}
+			for i, name := range r.stderr.SubexpNames() {
+				if name != "" && match[i] != nil {
+					if e.groups == nil {
+						e.groups = map[string]string{}
+					}
+					e.groups[name] = string(match[i])
+				}
+			}
+		}
+		e.Code, e.retryable = r.cfg.Code, r.cfg.Retryable
+		break
+	}
+	return e
+}
+
+// annotate sets the exit code, the error code and the named stderr groups in the metadata,
+// keeping the metadata of the message for the dead-letter targets
+func (m *errorMapper) annotate(msg *message.RunnerMessage, e *ExitError) {
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		return
+	}
+	meta = maps.Clone(meta)
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	if m.exitCodeKey != "" {
+		meta[m.exitCodeKey] = strconv.Itoa(e.ExitCode)
+	}
+	if m.errorCodeKey != "" {
+		meta[m.errorCodeKey] = e.Code
+	}
+	maps.Copy(meta, e.groups)
+	msg.SetMetadata(meta)
+}
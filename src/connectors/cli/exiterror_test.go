@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func newShellRunner(t *testing.T, script string, opts map[string]any) *CLIRunner {
+	t.Helper()
+	if opts == nil {
+		opts = map[string]any{}
+	}
+	opts["command"] = "sh"
+	opts["args"] = []string{"-c", script}
+	opts["useShell"] = true
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner error: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r.(*CLIRunner)
+}
+
+// processError processes a message expected to fail, returning the typed error and the metadata
+func processError(t *testing.T, r *CLIRunner) (*ExitError, map[string]string) {
+	t.Helper()
+	msg := message.NewRunnerMessage(&mockSourceMessage{id: []byte("id"), metadata: map[string]string{"source": "s"}, data: []byte("data")})
+	err := r.Process(msg)
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected *ExitError, got %T: %v", err, err)
+	}
+	meta, _ := msg.GetMetadata()
+	return exitErr, meta
+}
+
+func TestCLIRunnerErrorRules(t *testing.T) {
+	rules := []any{
+		map[string]any{"exitCodes": []int{75}, "stderr": `lock held by pid (?P<lockPid>\d+)`, "code": "lock_held", "retryable": true},
+		map[string]any{"exitCodes": []int{65, 66}, "code": "invalid_input"},
+		map[string]any{"stderr": "(?i)connection refused", "code": "unavailable", "retryable": true},
+	}
+
+	cases := []struct {
+		script    string
+		exitCode  int
+		code      string
+		retryable bool
+	}{
+		{"echo 'lock held by pid 42' >&2; exit 75", 75, "lock_held", true},
+		{"echo 'busy' >&2; exit 75", 75, "cli_exit_75", false},
+		{"exit 66", 66, "invalid_input", false},
+		{"echo 'Connection refused' >&2; exit 1", 1, "unavailable", true},
+		{"exit 3", 3, "cli_exit_3", false},
+	}
+	for _, tc := range cases {
+		r := newShellRunner(t, tc.script, map[string]any{"errorRules": rules})
+		exitErr, meta := processError(t, r)
+		if exitErr.ExitCode != tc.exitCode || exitErr.Code != tc.code || exitErr.Retryable() != tc.retryable {
+			t.Errorf("%s: got exit code %d, code %s, retryable %v", tc.script, exitErr.ExitCode, exitErr.Code, exitErr.Retryable())
+		}
+		if meta["eb-cli-exit-code"] != strconv.Itoa(tc.exitCode) ||
+			meta["eb-cli-error-code"] != tc.code || meta["source"] != "s" {
+			t.Errorf("%s: metadata = %v", tc.script, meta)
+		}
+		if rec := message.NewErrorRecord("runner[0]", exitErr); rec.Code != tc.code || rec.Retryable != tc.retryable {
+			t.Errorf("%s: error record = %+v", tc.script, rec)
+		}
+	}
+
+	exitErr, meta := processError(t, newShellRunner(t, "echo 'lock held by pid 42' >&2; exit 75", map[string]any{"errorRules": rules}))
+	if meta["lockPid"] != "42" || !strings.Contains(exitErr.Error(), "lock held by pid 42") {
+		t.Errorf("stderr group not reported: %v, %v", meta, exitErr)
+	}
+}
+
+func TestCLIRunnerTimeoutError(t *testing.T) {
+	r := newShellRunner(t, "exec sleep 2", map[string]any{"timeout": 50 * time.Millisecond})
+	exitErr, _ := processError(t, r)
+	if exitErr.Code != codeTimeout || !exitErr.Retryable() {
+		t.Errorf("expected retryable timeout, got %s (retryable %v)", exitErr.Code, exitErr.Retryable())
+	}
+}
+
+func TestCLIRunnerInvalidErrorRule(t *testing.T) {
+	cfg := &RunnerConfig{
+		Command:    "cat",
+		Timeout:    time.Second,
+		Format:     "cli",
+		ErrorRules: []ErrorRuleConfig{{Stderr: "lock (", Code: "lock"}},
+	}
+	if _, err := NewRunner(cfg); err == nil {
+		t.Error("expected error for an invalid stderr pattern")
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	cloudtasks "google.golang.org/api/cloudtasks/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// Ensure CloudTasksRunner implements connectors.Runner
+var _ connectors.Runner = &CloudTasksRunner{}
+
+const (
+	// taskNameKey is the metadata key of the name of the created task
+	taskNameKey = "eb-task-name"
+	// taskDuplicateKey is set to "true" when the task id was already used
+	taskDuplicateKey = "eb-task-duplicate"
+)
+
+// taskIDRe is the format of the task ids
+var taskIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,500}$`)
+
+type RunnerConfig struct {
+	ProjectID string `mapstructure:"projectId" validate:"required"`
+	// Location is the region of the queue, e.g. "europe-west1"
+	Location string `mapstructure:"location" validate:"required"`
+	// Queue is the id of the queue the tasks are created in
+	Queue string `mapstructure:"queue"`
+	// QueueFromMetadataKey is the metadata key of the queue, overriding Queue
+	QueueFromMetadataKey string `mapstructure:"queueFromMetadataKey"`
+	// URL is the URL the tasks are dispatched to
+	URL string `mapstructure:"url" validate:"omitempty,url"`
+	// URLFromMetadataKey is the metadata key of the URL, overriding URL
+	URLFromMetadataKey string `mapstructure:"urlFromMetadataKey"`
+	// Method is the HTTP method of the dispatched requests; the payload is the body
+	Method string `mapstructure:"method" default:"POST" validate:"oneof=POST GET HEAD PUT DELETE PATCH OPTIONS"`
+	// Headers are the headers of the dispatched requests
+	Headers map[string]string `mapstructure:"headers"`
+	// HeadersFromMetadata are the metadata keys sent as headers of the dispatched requests
+	HeadersFromMetadata []string `mapstructure:"headersFromMetadata" validate:"dive,required"`
+	// ScheduleTimeFromMetadataKey is the metadata key of the time the task is dispatched at
+	// (RFC3339 or epoch seconds); missing or past times dispatch the task immediately
+	ScheduleTimeFromMetadataKey string `mapstructure:"scheduleTimeFromMetadataKey"`
+	// ScheduleDelay delays the dispatch of the tasks without a schedule time metadata
+	ScheduleDelay time.Duration `mapstructure:"scheduleDelay" validate:"min=0"`
+	// TaskIDFromMetadataKey is the metadata key of the task id, deduplicating the tasks:
+	// a task id already used is acknowledged without creating a task. Cloud Tasks
+	// generates the ids when not set or missing.
+	TaskIDFromMetadataKey string `mapstructure:"taskIdFromMetadataKey"`
+	// DispatchDeadline bounds the dispatched requests (Cloud Tasks default: 10m)
+	DispatchDeadline time.Duration `mapstructure:"dispatchDeadline" validate:"omitempty,min=15s,max=30m"`
+	// OIDC adds an OIDC token of the service account to the dispatched requests, for the
+	// endpoints verifying the tokens such as Cloud Run and Cloud Functions
+	OIDC *OIDCConfig `mapstructure:"oidc"`
+	// OAuth adds an OAuth access token of the service account to the dispatched requests,
+	// for the Google APIs
+	OAuth *OAuthConfig `mapstructure:"oauth"`
+	// CredentialsFile is the path of a service account JSON file (default: Application Default Credentials)
+	CredentialsFile string `mapstructure:"credentialsFile"`
+	// Endpoint overrides the Cloud Tasks API endpoint
+	Endpoint string        `mapstructure:"endpoint" validate:"omitempty,url"`
+	Timeout  time.Duration `mapstructure:"timeout" default:"10s" validate:"gt=0"`
+}
+
+type OIDCConfig struct {
+	// ServiceAccountEmail is the service account the token is generated for; the
+	// Cloud Tasks service agent must be allowed to act as it
+	ServiceAccountEmail string `mapstructure:"serviceAccountEmail" validate:"required,email"`
+	// Audience of the token (default: the URL of the task)
+	Audience string `mapstructure:"audience"`
+}
+
+type OAuthConfig struct {
+	// ServiceAccountEmail is the service account the token is generated for
+	ServiceAccountEmail string `mapstructure:"serviceAccountEmail" validate:"required,email"`
+	// Scope of the token (default: "https://www.googleapis.com/auth/cloud-platform")
+	Scope string `mapstructure:"scope"`
+}
+
+type CloudTasksRunner struct {
+	cfg     *RunnerConfig
+	slog    *slog.Logger
+	service *cloudtasks.Service
+	now     func() time.Time
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a runner creating HTTP tasks in Cloud Tasks queues
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		jsonData, err := os.ReadFile(cfg.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading credentials file: %w", err)
+		}
+		opts = append(opts, option.WithCredentialsJSON(jsonData)) //nolint:staticcheck // WithCredentialsJSON is the non-file alternative; accepted deprecation
+	}
+	return newRunner(cfg, opts...)
+}
+
+func newRunner(cfg *RunnerConfig, opts ...option.ClientOption) (*CloudTasksRunner, error) {
+	if cfg.Queue == "" && cfg.QueueFromMetadataKey == "" {
+		return nil, errors.New("queue or queueFromMetadataKey is required")
+	}
+	if cfg.URL == "" && cfg.URLFromMetadataKey == "" {
+		return nil, errors.New("url or urlFromMetadataKey is required")
+	}
+	if cfg.OIDC != nil && cfg.OAuth != nil {
+		return nil, errors.New("oidc and oauth are mutually exclusive")
+	}
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	service, err := cloudtasks.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Cloud Tasks client: %w", err)
+	}
+
+	r := &CloudTasksRunner{
+		cfg:     cfg,
+		slog:    slog.Default().With("context", "Cloud Tasks Runner"),
+		service: service,
+		now:     time.Now,
+	}
+	r.slog.Info("Cloud Tasks runner created",
+		"projectID", cfg.ProjectID,
+		"location", cfg.Location,
+		"queue", cfg.Queue,
+		"url", cfg.URL,
+		"oidc", cfg.OIDC != nil,
+	)
+	return r, nil
+}
+
+// Process creates a task dispatching the payload to the URL, and sets the name of the task
+// as "eb-task-name" metadata
+func (r *CloudTasksRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+
+	queue := message.ResolveFromMetadata(msg, r.cfg.QueueFromMetadataKey, r.cfg.Queue)
+	if queue == "" {
+		return errors.New("no queue for the message")
+	}
+	parent := fmt.Sprintf("projects/%s/locations/%s/queues/%s", r.cfg.ProjectID, r.cfg.Location, queue)
+	task, err := r.newTask(msg, meta, data, parent)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+	created, err := r.service.Projects.Locations.Queues.Tasks.Create(parent, &cloudtasks.CreateTaskRequest{Task: task}).Context(ctx).Do()
+
+	out := maps.Clone(meta)
+	if out == nil {
+		out = make(map[string]string)
+	}
+	var apiErr *googleapi.Error
+	switch {
+	case err == nil:
+		out[taskNameKey] = created.Name
+	case task.Name != "" && errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict:
+		// The task id was used by a task created before, possibly already dispatched
+		r.slog.Debug("task already exists", "task", task.Name)
+		out[taskNameKey] = task.Name
+		out[taskDuplicateKey] = "true"
+	default:
+		return fmt.Errorf("error creating task in %s: %w", parent, err)
+	}
+	msg.SetMetadata(out)
+	return nil
+}
+
+// newTask maps the message to the HTTP task
+func (r *CloudTasksRunner) newTask(msg *message.RunnerMessage, meta map[string]string, data []byte, parent string) (*cloudtasks.Task, error) {
+	url := message.ResolveFromMetadata(msg, r.cfg.URLFromMetadataKey, r.cfg.URL)
+	if url == "" {
+		return nil, errors.New("no url for the message")
+	}
+
+	headers := maps.Clone(r.cfg.Headers)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	for _, key := range r.cfg.HeadersFromMetadata {
+		if v, ok := meta[key]; ok {
+			headers[key] = v
+		}
+	}
+
+	req := &cloudtasks.HttpRequest{
+		Url:        url,
+		HttpMethod: r.cfg.Method,
+		Headers:    headers,
+	}
+	if len(data) > 0 {
+		req.Body = base64.StdEncoding.EncodeToString(data)
+	}
+	if r.cfg.OIDC != nil {
+		audience := r.cfg.OIDC.Audience
+		if audience == "" {
+			audience = url
+		}
+		req.OidcToken = &cloudtasks.OidcToken{ServiceAccountEmail: r.cfg.OIDC.ServiceAccountEmail, Audience: audience}
+	} else if r.cfg.OAuth != nil {
+		req.OauthToken = &cloudtasks.OAuthToken{ServiceAccountEmail: r.cfg.OAuth.ServiceAccountEmail, Scope: r.cfg.OAuth.Scope}
+	}
+
+	task := &cloudtasks.Task{HttpRequest: req}
+	if id := message.ResolveFromMetadata(msg, r.cfg.TaskIDFromMetadataKey, ""); id != "" {
+		if !taskIDRe.MatchString(id) {
+			return nil, fmt.Errorf("invalid task id %q: letters, digits, hyphens and underscores only", id)
+		}
+		task.Name = parent + "/tasks/" + id
+	}
+
+	schedule, err := r.scheduleTime(meta)
+	if err != nil {
+		return nil, err
+	}
+	if !schedule.IsZero() {
+		task.ScheduleTime = schedule.UTC().Format(time.RFC3339Nano)
+	}
+	if r.cfg.DispatchDeadline > 0 {
+		task.DispatchDeadline = strconv.FormatFloat(r.cfg.DispatchDeadline.Seconds(), 'f', -1, 64) + "s"
+	}
+	return task, nil
+}
+
+// scheduleTime returns the dispatch time of the task, zero to dispatch it immediately
+func (r *CloudTasksRunner) scheduleTime(meta map[string]string) (time.Time, error) {
+	if key := r.cfg.ScheduleTimeFromMetadataKey; key != "" {
+		if v := meta[key]; v != "" {
+			if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return time.Unix(seconds, 0), nil
+			}
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid schedule time metadata %q: %w", key, err)
+			}
+			return t, nil
+		}
+	}
+	if r.cfg.ScheduleDelay > 0 {
+		return r.now().Add(r.cfg.ScheduleDelay), nil
+	}
+	return time.Time{}, nil
+}
+
+func (r *CloudTasksRunner) Close() error {
+	return nil
+}
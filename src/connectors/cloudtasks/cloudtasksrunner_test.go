@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+	cloudtasks "google.golang.org/api/cloudtasks/v2"
+	"google.golang.org/api/option"
+)
+
+// created is a create request received by the test API
+type created struct {
+	path string
+	task cloudtasks.Task
+}
+
+// newTestAPI returns a Cloud Tasks API answering the create requests with the status,
+// the created task being echoed back with a generated name when not named
+func newTestAPI(t *testing.T, status int) (*httptest.Server, func() []created) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []created
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req cloudtasks.CreateTaskRequest
+		if err := json.Unmarshal(body, &req); err != nil || req.Task == nil {
+			t.Errorf("invalid create request %s: %v", body, err)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, created{path: r.URL.Path, task: *req.Task})
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			_, _ = fmt.Fprintf(w, `{"error":{"code":%d,"message":"task exists"}}`, status)
+			return
+		}
+		task := req.Task
+		if task.Name == "" {
+			task.Name = strings.TrimPrefix(r.URL.Path, "/v2/") + "/123"
+		}
+		_ = json.NewEncoder(w).Encode(task)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []created {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]created(nil), requests...)
+	}
+}
+
+func TestCreateTask(t *testing.T) {
+	srv, requests := newTestAPI(t, http.StatusOK)
+	cfg := &RunnerConfig{
+		ProjectID:                   "p",
+		Location:                    "europe-west1",
+		Queue:                       "jobs",
+		URL:                         "https://worker.example.com/jobs",
+		Method:                      "POST",
+		Headers:                     map[string]string{"Content-Type": "application/json"},
+		HeadersFromMetadata:         []string{"x-tenant", "x-missing"},
+		ScheduleTimeFromMetadataKey: "runAt",
+		DispatchDeadline:            90 * time.Second,
+		OIDC:                        &OIDCConfig{ServiceAccountEmail: "tasks@p.iam.gserviceaccount.com"},
+		Timeout:                     time.Second,
+	}
+	r, err := newRunner(cfg, option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("newRunner() unexpected error = %v", err)
+	}
+	r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"job":1}`), map[string]string{
+		"x-tenant": "acme",
+		"runAt":    "2024-06-01T08:00:00+02:00",
+	}))
+	if err := r.Process(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := requests()
+	if len(reqs) != 1 || reqs[0].path != "/v2/projects/p/locations/europe-west1/queues/jobs/tasks" {
+		t.Fatalf("requests = %+v", reqs)
+	}
+	task := reqs[0].task
+	req := task.HttpRequest
+	body, _ := base64.StdEncoding.DecodeString(req.Body)
+	if req.Url != "https://worker.example.com/jobs" || req.HttpMethod != "POST" || string(body) != `{"job":1}` {
+		t.Errorf("request = %+v", req)
+	}
+	if len(req.Headers) != 2 || req.Headers["x-tenant"] != "acme" || req.Headers["Content-Type"] != "application/json" {
+		t.Errorf("headers = %v", req.Headers)
+	}
+	if req.OidcToken == nil || req.OidcToken.Audience != "https://worker.example.com/jobs" ||
+		req.OidcToken.ServiceAccountEmail != "tasks@p.iam.gserviceaccount.com" {
+		t.Errorf("oidc token = %+v", req.OidcToken)
+	}
+	if task.ScheduleTime != "2024-06-01T06:00:00Z" || task.DispatchDeadline != "90s" || task.Name != "" {
+		t.Errorf("task = %+v", task)
+	}
+
+	meta, _ := msg.GetMetadata()
+	if meta[taskNameKey] != "projects/p/locations/europe-west1/queues/jobs/tasks/123" || meta["x-tenant"] != "acme" {
+		t.Errorf("metadata = %v", meta)
+	}
+}
+
+func TestScheduleAndRouting(t *testing.T) {
+	srv, requests := newTestAPI(t, http.StatusOK)
+	cfg := &RunnerConfig{
+		ProjectID:                   "p",
+		Location:                    "europe-west1",
+		Queue:                       "jobs",
+		QueueFromMetadataKey:        "queue",
+		URL:                         "https://worker.example.com/a",
+		URLFromMetadataKey:          "target",
+		Method:                      "PUT",
+		ScheduleTimeFromMetadataKey: "runAt",
+		ScheduleDelay:               5 * time.Minute,
+		OAuth:                       &OAuthConfig{ServiceAccountEmail: "tasks@p.iam.gserviceaccount.com", Scope: "s"},
+		Timeout:                     time.Second,
+	}
+	r, err := newRunner(cfg, option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("newRunner() unexpected error = %v", err)
+	}
+	r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+
+	for _, meta := range []map[string]string{
+		nil,
+		{"runAt": "1717228800", "target": "https://worker.example.com/b", "queue": "urgent"},
+	} {
+		if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter(nil, meta))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reqs := requests()
+	if len(reqs) != 2 {
+		t.Fatalf("requests = %d", len(reqs))
+	}
+	delayed, routed := reqs[0], reqs[1]
+	if delayed.task.ScheduleTime != "2024-05-01T10:05:00Z" || delayed.task.HttpRequest.Url != "https://worker.example.com/a" ||
+		delayed.task.HttpRequest.Body != "" || delayed.task.HttpRequest.HttpMethod != "PUT" {
+		t.Errorf("delayed task = %+v", delayed.task)
+	}
+	if token := delayed.task.HttpRequest.OauthToken; token == nil || token.Scope != "s" || delayed.task.HttpRequest.OidcToken != nil {
+		t.Errorf("oauth token = %+v", token)
+	}
+	if routed.path != "/v2/projects/p/locations/europe-west1/queues/urgent/tasks" ||
+		routed.task.ScheduleTime != "2024-06-01T08:00:00Z" || routed.task.HttpRequest.Url != "https://worker.example.com/b" {
+		t.Errorf("routed task = %+v %+v", routed.path, routed.task)
+	}
+
+	err = r.Process(message.NewRunnerMessage(testutil.NewAdapter(nil, map[string]string{"runAt": "tomorrow"})))
+	if err == nil || !strings.Contains(err.Error(), "invalid schedule time") {
+		t.Errorf("invalid schedule error = %v", err)
+	}
+}
+
+func TestTaskDeduplication(t *testing.T) {
+	srv, requests := newTestAPI(t, http.StatusConflict)
+	cfg := &RunnerConfig{
+		ProjectID:             "p",
+		Location:              "europe-west1",
+		Queue:                 "jobs",
+		URL:                   "https://worker.example.com/jobs",
+		Method:                "POST",
+		TaskIDFromMetadataKey: "orderId",
+		Timeout:               time.Second,
+	}
+	r, err := newRunner(cfg, option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("newRunner() unexpected error = %v", err)
+	}
+	r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("x"), map[string]string{"orderId": "order-42"}))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("duplicate task error = %v", err)
+	}
+	name := "projects/p/locations/europe-west1/queues/jobs/tasks/order-42"
+	if reqs := requests(); len(reqs) != 1 || reqs[0].task.Name != name {
+		t.Errorf("requests = %+v", reqs)
+	}
+	meta, _ := msg.GetMetadata()
+	if meta[taskNameKey] != name || meta[taskDuplicateKey] != "true" {
+		t.Errorf("metadata = %v", meta)
+	}
+
+	// Without a task id the conflict is an error
+	err = r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("x"), nil)))
+	if err == nil || !strings.Contains(err.Error(), "error creating task") {
+		t.Errorf("unnamed conflict error = %v", err)
+	}
+
+	err = r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("x"), map[string]string{"orderId": "order/42"})))
+	if err == nil || !strings.Contains(err.Error(), "invalid task id") {
+		t.Errorf("invalid task id error = %v", err)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	base := map[string]any{"projectId": "p", "location": "l", "queue": "q", "url": "https://w"}
+	for name, override := range map[string]map[string]any{
+		"missing queue":     {"queue": ""},
+		"missing url":       {"url": ""},
+		"oidc and oauth":    {"oidc": map[string]any{"serviceAccountEmail": "a@b.c"}, "oauth": map[string]any{"serviceAccountEmail": "a@b.c"}},
+		"oidc without sa":   {"oidc": map[string]any{"audience": "x"}},
+		"deadline too long": {"dispatchDeadline": "1h"},
+		"invalid method":    {"method": "TRACE"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts := map[string]any{}
+			for k, v := range base {
+				opts[k] = v
+			}
+			for k, v := range override {
+				opts[k] = v
+			}
+			cfg := new(RunnerConfig)
+			if err := utils.ParseConfig(opts, cfg); err != nil {
+				return
+			}
+			if _, err := newRunner(cfg, option.WithoutAuthentication()); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"io"
 	"log"
 	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/plgd-dev/go-coap/v3"
@@ -221,7 +223,15 @@ func (s *CoAPSource) sendCoAPResponse(w coapmux.ResponseWriter, msg *CoAPMessage
 		err = w.SetResponse(coapcodes.GatewayTimeout, coapmessage.TextPlain, nil)
 	} else if r != nil {
 		contentFormat := coapTypeFromMetadata(r.Metadata)
-		err = w.SetResponse(coapcodes.Content, contentFormat, bytes.NewReader(r.Data))
+		code := coapcodes.Content
+		if v, ok := r.Metadata["eb-status"]; ok {
+			if c, valid := coapCodeFromStatus(v); valid {
+				code = c
+			} else {
+				s.slog.Warn("invalid eb-status metadata value, must be a CoAP response code", "value", v)
+			}
+		}
+		err = w.SetResponse(code, contentFormat, bytes.NewReader(r.Data))
 	} else if status != nil {
 		err = s.setStatusResponse(w, *status)
 	}
@@ -291,6 +301,21 @@ func coapTypeFromContentType(ct string) coapmessage.MediaType {
 	}
 }
 
+// coapCodeFromStatus parses a response code given by name ("Changed"), in dotted
+// notation ("2.04") or as its HTTP-like number ("204", "504")
+func coapCodeFromStatus(v string) (coapcodes.Code, bool) {
+	v = strings.TrimSpace(v)
+	if c, err := coapcodes.ToCode(v); err == nil {
+		return c, c >= coapcodes.Created && c <= coapcodes.ProxyingNotSupported
+	}
+	v = strings.Replace(v, ".", "", 1)
+	n, err := strconv.Atoi(v)
+	if err != nil || len(v) != 3 || n < 200 || n > 599 || n%100 > 31 {
+		return 0, false
+	}
+	return coapcodes.Code(n/100<<5 | n%100), true
+}
+
 func coapTypeFromMetadata(md map[string]string) coapmessage.MediaType {
 	for k, v := range md {
 		if bytes.EqualFold([]byte(k), []byte("Content-Type")) {
@@ -358,3 +358,27 @@ func TestCoAPSourceTCPTimeoutGatewayTimeout(t *testing.T) {
 		t.Fatal("timeout waiting for client response")
 	}
 }
+
+func TestCoAPCodeFromStatus(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  coapcodes.Code
+		valid bool
+	}{
+		{"Changed", coapcodes.Changed, true},
+		{"2.01", coapcodes.Created, true},
+		{"204", coapcodes.Changed, true},
+		{"504", coapcodes.GatewayTimeout, true},
+		{" 4.04 ", coapcodes.NotFound, true},
+		{"GET", 0, false},
+		{"100", 0, false},
+		{"2.40", 0, false},
+		{"abc", 0, false},
+	}
+	for _, tt := range tests {
+		got, valid := coapCodeFromStatus(tt.in)
+		if valid != tt.valid || (valid && got != tt.want) {
+			t.Errorf("coapCodeFromStatus(%q) = %v, %v, want %v, %v", tt.in, got, valid, tt.want, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"golang.org/x/time/rate"
+)
+
+// Ensure ConsoleRunner implements connectors.Runner
+var _ connectors.Runner = (*ConsoleRunner)(nil)
+
+const (
+	ansiReset  = "\033[0m"
+	ansiBold   = "\033[1m"
+	ansiDim    = "\033[2m"
+	ansiCyan   = "\033[36m"
+	ansiYellow = "\033[33m"
+	ansiGreen  = "\033[32m"
+)
+
+// RunnerConfig defines the configuration for the console debug target.
+type RunnerConfig struct {
+	// Output is "stdout", "stderr" or a file path the messages are appended to
+	Output string `mapstructure:"output" default:"stdout" validate:"required"`
+
+	// Format selects how the payload is decoded: "auto" (JSON, then CBOR, then text/hex), "json", "cbor", "text" or "hex"
+	Format string `mapstructure:"format" default:"auto" validate:"oneof=auto json cbor text hex"`
+
+	// Color enables ANSI colors (ignored when writing to a file)
+	Color bool `mapstructure:"color" default:"true"`
+
+	// Metadata prints the message metadata
+	Metadata bool `mapstructure:"metadata" default:"true"`
+
+	// MaxPayloadSize truncates printed payloads larger than this number of bytes (0 = unlimited)
+	MaxPayloadSize int `mapstructure:"maxPayloadSize" default:"65536" validate:"min=0"`
+
+	// SampleRate is the fraction of messages printed, between 0 and 1 (default: 1, every message)
+	SampleRate float64 `mapstructure:"sampleRate" default:"1" validate:"gt=0,lte=1"`
+
+	// MaxPerSecond limits the number of printed messages per second (0 = unlimited)
+	MaxPerSecond float64 `mapstructure:"maxPerSecond" default:"0" validate:"min=0"`
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates the console debug target.
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	r := &ConsoleRunner{
+		cfg:  cfg,
+		slog: slog.Default().With("context", "Console Runner"),
+	}
+
+	switch cfg.Output {
+	case "stdout":
+		r.out = os.Stdout
+	case "stderr":
+		r.out = os.Stderr
+	default:
+		f, err := os.OpenFile(filepath.Clean(cfg.Output), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open output file: %w", err)
+		}
+		r.out = f
+		r.closer = f
+		// Never write escape sequences into files
+		r.cfg.Color = false
+	}
+
+	if cfg.MaxPerSecond > 0 {
+		r.limiter = rate.NewLimiter(rate.Limit(cfg.MaxPerSecond), 1)
+	}
+
+	return r, nil
+}
+
+// ConsoleRunner pretty-prints messages for pipeline development.
+// Messages are never modified.
+type ConsoleRunner struct {
+	cfg     *RunnerConfig
+	slog    *slog.Logger
+	mu      sync.Mutex
+	out     io.Writer
+	closer  io.Closer
+	limiter *rate.Limiter
+	skipped int
+}
+
+// Process prints the message if it is selected by sampling and rate limiting.
+func (r *ConsoleRunner) Process(msg *message.RunnerMessage) error {
+	if !r.sample() {
+		r.mu.Lock()
+		r.skipped++
+		r.mu.Unlock()
+		return nil
+	}
+
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var buf bytes.Buffer
+	r.writeHeader(&buf, msg.GetID())
+	if r.cfg.Metadata {
+		r.writeMetadata(&buf, metadata)
+	}
+	r.writePayload(&buf, data)
+	r.skipped = 0
+
+	if _, err := r.out.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
+
+// sample decides whether a message must be printed
+func (r *ConsoleRunner) sample() bool {
+	if r.cfg.SampleRate < 1 && rand.Float64() >= r.cfg.SampleRate { //nolint:gosec // sampling does not need a secure source
+		return false
+	}
+	if r.limiter != nil && !r.limiter.Allow() {
+		return false
+	}
+	return true
+}
+
+func (r *ConsoleRunner) color(code string, s string) string {
+	if !r.cfg.Color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+func (r *ConsoleRunner) writeHeader(buf *bytes.Buffer, id []byte) {
+	header := fmt.Sprintf("── message %s @ %s", string(id), time.Now().Format(time.RFC3339Nano))
+	if r.skipped > 0 {
+		header += fmt.Sprintf(" (%d skipped)", r.skipped)
+	}
+	buf.WriteString(r.color(ansiBold+ansiCyan, header))
+	buf.WriteByte('\n')
+}
+
+func (r *ConsoleRunner) writeMetadata(buf *bytes.Buffer, metadata map[string]string) {
+	buf.WriteString(r.color(ansiBold, "metadata:"))
+	buf.WriteByte('\n')
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "  %s: %s\n", r.color(ansiYellow, k), metadata[k])
+	}
+}
+
+func (r *ConsoleRunner) writePayload(buf *bytes.Buffer, data []byte) {
+	truncated := false
+	if r.cfg.MaxPayloadSize > 0 && len(data) > r.cfg.MaxPayloadSize {
+		data = data[:r.cfg.MaxPayloadSize]
+		truncated = true
+	}
+
+	kind, body := formatPayload(r.cfg.Format, data)
+	title := fmt.Sprintf("data (%s, %d bytes):", kind, len(data))
+	if truncated {
+		title = fmt.Sprintf("data (%s, truncated to %d bytes):", kind, len(data))
+	}
+	buf.WriteString(r.color(ansiBold, title))
+	buf.WriteByte('\n')
+	if kind == "json" || kind == "cbor" {
+		buf.WriteString(r.color(ansiGreen, body))
+	} else {
+		buf.WriteString(body)
+	}
+	buf.WriteString("\n\n")
+	if truncated {
+		buf.WriteString(r.color(ansiDim, "…"))
+		buf.WriteString("\n")
+	}
+}
+
+// formatPayload renders the payload according to the format and returns the detected kind
+func formatPayload(format string, data []byte) (string, string) {
+	switch format {
+	case "json":
+		if s, ok := prettyJSON(data); ok {
+			return "json", s
+		}
+	case "cbor":
+		if s, ok := prettyCBOR(data); ok {
+			return "cbor", s
+		}
+	case "text":
+		return "text", string(data)
+	case "hex":
+		return "hex", hex.Dump(data)
+	default:
+		if s, ok := prettyJSON(data); ok {
+			return "json", s
+		}
+		if s, ok := prettyCBOR(data); ok {
+			return "cbor", s
+		}
+		if utf8.Valid(data) {
+			return "text", string(data)
+		}
+	}
+	return "hex", hex.Dump(data)
+}
+
+func prettyJSON(data []byte) (string, bool) {
+	if !json.Valid(data) {
+		return "", false
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return "", false
+	}
+	return out.String(), true
+}
+
+var cborDecMode, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]any(nil)),
+}.DecMode()
+
+func prettyCBOR(data []byte) (string, bool) {
+	if len(data) == 0 {
+		return "", false
+	}
+	var v any
+	if err := cborDecMode.Unmarshal(data, &v); err != nil {
+		return "", false
+	}
+	// Plain text is also valid CBOR in a few corner cases: only accept structured values
+	switch v.(type) {
+	case map[string]any, []any:
+	default:
+		return "", false
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(out)), true
+}
+
+// Close closes the output file, if any.
+func (r *ConsoleRunner) Close() error {
+	r.slog.Info("closing console runner")
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func newFileRunner(t *testing.T, cfg *RunnerConfig) (*ConsoleRunner, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "out.log")
+	cfg.Output = path
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := r.Close(); err != nil {
+			t.Logf("failed to close runner: %v", err)
+		}
+	})
+	return r.(*ConsoleRunner), path
+}
+
+func readOutput(t *testing.T, path string) string {
+	t.Helper()
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	return string(out)
+}
+
+func TestConsoleProcessJSON(t *testing.T) {
+	r, path := newFileRunner(t, &RunnerConfig{Format: "auto", Metadata: true, SampleRate: 1, Color: true})
+
+	stub := testutil.NewAdapter([]byte(`{"value":42}`), map[string]string{"b": "2", "a": "1"})
+	stub.ID = []byte("test-id")
+	msg := message.NewRunnerMessage(stub)
+
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+
+	out := readOutput(t, path)
+	if !strings.Contains(out, "test-id") {
+		t.Errorf("output does not contain message id: %s", out)
+	}
+	if !strings.Contains(out, "data (json") || !strings.Contains(out, "\"value\": 42") {
+		t.Errorf("expected pretty-printed JSON, got: %s", out)
+	}
+	if strings.Index(out, "a: 1") > strings.Index(out, "b: 2") {
+		t.Errorf("expected sorted metadata, got: %s", out)
+	}
+	if strings.Contains(out, "\033[") {
+		t.Errorf("expected no color escapes in file output, got: %q", out)
+	}
+
+	data, _ := msg.GetData()
+	if string(data) != `{"value":42}` {
+		t.Errorf("message data was modified: %s", data)
+	}
+}
+
+func TestConsoleProcessCBORAndBinary(t *testing.T) {
+	r, path := newFileRunner(t, &RunnerConfig{Format: "auto", SampleRate: 1})
+
+	payload, err := cbor.Marshal(map[string]any{"name": "sensor"})
+	if err != nil {
+		t.Fatalf("failed to marshal cbor: %v", err)
+	}
+	if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter(payload, nil))); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte{0xff, 0xfe, 0x00}, nil))); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+
+	out := readOutput(t, path)
+	if !strings.Contains(out, "data (cbor") || !strings.Contains(out, "\"name\": \"sensor\"") {
+		t.Errorf("expected decoded CBOR, got: %s", out)
+	}
+	if !strings.Contains(out, "data (hex") {
+		t.Errorf("expected hex dump for binary payload, got: %s", out)
+	}
+	if strings.Contains(out, "metadata:") {
+		t.Errorf("expected metadata to be hidden, got: %s", out)
+	}
+}
+
+func TestConsoleTruncate(t *testing.T) {
+	r, path := newFileRunner(t, &RunnerConfig{Format: "text", SampleRate: 1, MaxPayloadSize: 4})
+
+	if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("abcdefgh"), nil))); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+
+	out := readOutput(t, path)
+	if !strings.Contains(out, "truncated to 4 bytes") || strings.Contains(out, "efgh") {
+		t.Errorf("expected truncated payload, got: %s", out)
+	}
+}
+
+func TestConsoleRateLimit(t *testing.T) {
+	r, path := newFileRunner(t, &RunnerConfig{Format: "text", SampleRate: 1, MaxPerSecond: 0.001})
+
+	for i := 0; i < 5; i++ {
+		if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("hello"), nil))); err != nil {
+			t.Fatalf("process failed: %v", err)
+		}
+	}
+
+	out := readOutput(t, path)
+	if n := strings.Count(out, "── message"); n != 1 {
+		t.Errorf("expected 1 printed message, got %d", n)
+	}
+	if r.skipped != 4 {
+		t.Errorf("expected 4 skipped messages, got %d", r.skipped)
+	}
+}
+
+func TestNewRunnerInvalidConfig(t *testing.T) {
+	if _, err := NewRunner(struct{}{}); err == nil {
+		t.Fatal("expected error for invalid config type")
+	}
+}
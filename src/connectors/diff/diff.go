@@ -0,0 +1,133 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	opAdd     = "add"
+	opRemove  = "remove"
+	opReplace = "replace"
+)
+
+// change is a difference between the previous and the current payload at a path.
+// Objects are compared field by field, arrays and scalars as a whole.
+type change struct {
+	op   string
+	path []string
+	old  any
+	new  any
+}
+
+// patchOp is an RFC 6902 JSON Patch operation
+type patchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// diffValues returns the changes from the previous to the current value, skipping the ignored paths
+func diffValues(prev, curr any, ignored map[string]bool) []change {
+	var changes []change
+	diffAt(nil, prev, curr, ignored, &changes)
+	return changes
+}
+
+func diffAt(path []string, prev, curr any, ignored map[string]bool, changes *[]change) {
+	if len(path) > 0 && ignored[strings.Join(path, ".")] {
+		return
+	}
+	prevMap, prevIsMap := prev.(map[string]any)
+	currMap, currIsMap := curr.(map[string]any)
+	if !prevIsMap || !currIsMap {
+		if !reflect.DeepEqual(prev, curr) {
+			*changes = append(*changes, change{op: opReplace, path: path, old: prev, new: curr})
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(prevMap)+len(currMap))
+	for k := range prevMap {
+		keys = append(keys, k)
+	}
+	for k := range currMap {
+		if _, ok := prevMap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		child := append(path[:len(path):len(path)], k)
+		prevVal, inPrev := prevMap[k]
+		currVal, inCurr := currMap[k]
+		switch {
+		case !inPrev:
+			if !ignored[strings.Join(child, ".")] {
+				*changes = append(*changes, change{op: opAdd, path: child, new: currVal})
+			}
+		case !inCurr:
+			if !ignored[strings.Join(child, ".")] {
+				*changes = append(*changes, change{op: opRemove, path: child, old: prevVal})
+			}
+		default:
+			diffAt(child, prevVal, currVal, ignored, changes)
+		}
+	}
+}
+
+// changedFields returns the current value reduced to the changed fields: nested objects
+// keep only their changed fields and removed fields are null. A change of the whole
+// value (e.g. an array payload) returns the current value.
+func changedFields(changes []change, curr any) any {
+	out := map[string]any{}
+	for _, c := range changes {
+		if len(c.path) == 0 {
+			return curr
+		}
+		node := out
+		for _, seg := range c.path[:len(c.path)-1] {
+			next, ok := node[seg].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				node[seg] = next
+			}
+			node = next
+		}
+		node[c.path[len(c.path)-1]] = c.new
+	}
+	return out
+}
+
+// jsonPatch returns the changes as JSON Patch operations
+func jsonPatch(changes []change) []patchOp {
+	ops := make([]patchOp, len(changes))
+	for i, c := range changes {
+		ops[i] = patchOp{Op: c.op, Path: jsonPointer(c.path)}
+		if c.op != opRemove {
+			ops[i].Value = c.new
+		}
+	}
+	return ops
+}
+
+// changedPaths returns the dotted paths of the changes
+func changedPaths(changes []change) []string {
+	paths := make([]string, len(changes))
+	for i, c := range changes {
+		paths[i] = strings.Join(c.path, ".")
+	}
+	return paths
+}
+
+// jsonPointer returns the JSON pointer of a path
+func jsonPointer(path []string) string {
+	var b strings.Builder
+	for _, seg := range path {
+		b.WriteByte('/')
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(seg, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
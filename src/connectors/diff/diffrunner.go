@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/jsonpath"
+	"github.com/sandrolain/events-bridge/src/common/statestore"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure DiffRunner implements connectors.Runner
+var _ connectors.Runner = &DiffRunner{}
+
+const (
+	backendMemory = "memory"
+	backendRedis  = "redis"
+
+	outputChanges = "changes"
+	outputPatch   = "patch"
+	outputFull    = "full"
+
+	fromMetadata = "metadata"
+
+	statusNew       = "new"
+	statusChanged   = "changed"
+	statusUnchanged = "unchanged"
+
+	// keyPrefix is the default prefix of the Redis state keys
+	keyPrefix = "eb-diff:"
+)
+
+// Key is the state key read from the message, e.g. the device id
+type Key struct {
+	// From is the message part the key is read from: "data" (JSON payload, default) or "metadata"
+	From string `mapstructure:"from" validate:"omitempty,oneof=data metadata"`
+	// Path is the dotted JSON path (e.g. "device.id") or the metadata key
+	Path string `mapstructure:"path" validate:"required"`
+}
+
+type RunnerConfig struct {
+	// Key is the state key of every message
+	Key Key `mapstructure:"key"`
+	// Backend is the state store: "memory" (default) or "redis"
+	Backend string `mapstructure:"backend" default:"memory" validate:"oneof=memory redis"`
+	// Output is the payload of the message: "changes" (default, the changed fields only, removed
+	// fields as null), "patch" (RFC 6902 JSON Patch from the previous payload) or "full" (unchanged)
+	Output string `mapstructure:"output" default:"changes" validate:"oneof=changes patch full"`
+	// Ignore are dotted paths left out of the comparison, e.g. report timestamps or counters
+	Ignore []string `mapstructure:"ignore" validate:"dive,required"`
+	// TTL expires the state of the keys not updated for this long (0 = never)
+	TTL time.Duration `mapstructure:"ttl" default:"0s" validate:"min=0"`
+	// StatusKey is the metadata key set to "new" (no previous payload), "changed" or "unchanged",
+	// e.g. for a filterExpr dropping the unchanged messages
+	StatusKey string `mapstructure:"statusKey" default:"eb-diff-status" validate:"required"`
+	// PathsKey is the metadata key of the comma separated dotted paths of the changed fields
+	PathsKey string `mapstructure:"pathsKey" default:"eb-diff-paths" validate:"required"`
+	// Timeout bounds the state store operations
+	Timeout time.Duration `mapstructure:"timeout" default:"5s" validate:"gt=0"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+
+	Memory statestore.MemoryConfig `mapstructure:"memory"`
+	Redis  *statestore.RedisConfig `mapstructure:"redis" validate:"required_if=Backend redis"`
+}
+
+// DiffRunner compares every payload with the previous payload of its key, replacing
+// repetitive full-state reports with the changes since the last report
+type DiffRunner struct {
+	cfg     *RunnerConfig
+	slog    *slog.Logger
+	store   statestore.Store
+	ignored map[string]bool
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a diff runner connected to the configured state backend
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	var st statestore.Store
+	switch cfg.Backend {
+	case backendMemory:
+		st = statestore.NewMemory(&cfg.Memory, cfg.TTL)
+	case backendRedis:
+		rs, err := statestore.NewRedis(cfg.Redis, cfg.TTL, keyPrefix)
+		if err != nil {
+			return nil, err
+		}
+		st = rs
+	default:
+		return nil, fmt.Errorf("unsupported backend: %s", cfg.Backend)
+	}
+
+	r := newDiffRunner(cfg, st)
+	r.slog.Info("diff runner created", "backend", cfg.Backend, "key", cfg.Key.Path, "output", cfg.Output, "ttl", cfg.TTL)
+	return r, nil
+}
+
+func newDiffRunner(cfg *RunnerConfig, st statestore.Store) *DiffRunner {
+	ignored := make(map[string]bool, len(cfg.Ignore))
+	for _, path := range cfg.Ignore {
+		ignored[path] = true
+	}
+	return &DiffRunner{
+		cfg:     cfg,
+		slog:    slog.Default().With("context", "Diff Runner"),
+		store:   st,
+		ignored: ignored,
+	}
+}
+
+// Process stores the payload as the state of its key and replaces it with the changes
+// from the previous state, setting the status and the changed paths in metadata
+func (r *DiffRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds maximum %d", len(data), r.cfg.MaxInputSize)
+	}
+
+	var curr any
+	if err := json.Unmarshal(data, &curr); err != nil {
+		return fmt.Errorf("payload must be JSON: %w", err)
+	}
+	key, err := r.key(curr, meta)
+	if err != nil {
+		return err
+	}
+	// The state is stored compacted, so that formatting differences are not changes
+	state, err := json.Marshal(curr)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+	prevData, err := r.store.Swap(ctx, key, state)
+	if err != nil {
+		return fmt.Errorf("failed to update the state of key %s: %w", key, err)
+	}
+
+	var changes []change
+	status := statusNew
+	if prevData != nil {
+		var prev any
+		if err := json.Unmarshal(prevData, &prev); err != nil {
+			return fmt.Errorf("invalid state of key %s: %w", key, err)
+		}
+		changes = diffValues(prev, curr, r.ignored)
+		status = statusChanged
+		if len(changes) == 0 {
+			status = statusUnchanged
+		}
+	} else {
+		changes = []change{{op: opAdd, new: curr}}
+	}
+
+	msg.AddMetadata(r.cfg.StatusKey, status)
+	msg.AddMetadata(r.cfg.PathsKey, strings.Join(changedPaths(changes), ","))
+	r.slog.Debug("payload compared", "key", key, "status", status, "changes", len(changes))
+
+	var out any
+	switch r.cfg.Output {
+	case outputChanges:
+		out = changedFields(changes, curr)
+	case outputPatch:
+		out = jsonPatch(changes)
+	default:
+		return nil
+	}
+	res, err := json.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("failed to marshal changes: %w", err)
+	}
+	msg.SetData(res)
+	return nil
+}
+
+// key extracts the state key from the message
+func (r *DiffRunner) key(payload any, meta map[string]string) (string, error) {
+	if r.cfg.Key.From == fromMetadata {
+		v, ok := meta[r.cfg.Key.Path]
+		if !ok {
+			return "", fmt.Errorf("missing metadata key %s", r.cfg.Key.Path)
+		}
+		return v, nil
+	}
+	v, ok := jsonpath.Get(payload, r.cfg.Key.Path)
+	if !ok || v == nil {
+		return "", fmt.Errorf("missing data key %s", r.cfg.Key.Path)
+	}
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return strconv.FormatInt(int64(val), 10), nil
+		}
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	default:
+		return "", fmt.Errorf("state key must be a scalar, got %T", v)
+	}
+}
+
+func (r *DiffRunner) Close() error {
+	r.slog.Info("closing diff runner")
+	return r.store.Close()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/sandrolain/events-bridge/src/common/statestore"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// step is a message processed by the runner of a test, with its expected output
+type step struct {
+	payload    string
+	meta       map[string]string
+	want       string
+	wantStatus string
+	wantPaths  string
+}
+
+// run processes the steps in order with the runner
+func run(t *testing.T, r connectors.Runner, steps []step) {
+	t.Helper()
+	for i, s := range steps {
+		msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(s.payload), s.meta))
+		if err := r.Process(msg); err != nil {
+			t.Fatalf("step %d: Process(%s) unexpected error = %v", i, s.payload, err)
+		}
+		meta, data, _ := msg.GetMetadataAndData()
+		if !reflect.DeepEqual(decode(t, string(data)), decode(t, s.want)) {
+			t.Errorf("step %d: output = %s, want %s", i, data, s.want)
+		}
+		if s.wantStatus != "" && (meta["eb-diff-status"] != s.wantStatus || meta["eb-diff-paths"] != s.wantPaths) {
+			t.Errorf("step %d: metadata = %v, want status %q and paths %q", i, meta, s.wantStatus, s.wantPaths)
+		}
+	}
+}
+
+func TestDiffRunnerProcess(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   *RunnerConfig
+		steps []step
+	}{
+		{
+			name: "changes",
+			cfg: &RunnerConfig{
+				Key: Key{Path: "device.id"}, Ignore: []string{"ts"}, Output: outputChanges, Backend: backendMemory,
+				Memory: statestore.MemoryConfig{MaxKeys: 10}, StatusKey: "eb-diff-status", PathsKey: "eb-diff-paths", Timeout: time.Second,
+			},
+			steps: []step{
+				{payload: `{"device": {"id": "a"}, "temp": 21, "ts": 1}`, want: `{"device": {"id": "a"}, "temp": 21, "ts": 1}`, wantStatus: "new"},
+				{payload: `{"device": {"id": "a"},  "temp": 21, "ts": 2}`, want: `{}`, wantStatus: "unchanged"},
+				{
+					payload:    `{"device": {"id": "a", "fw": "1.2"}, "temp": 22.5, "ts": 3}`,
+					want:       `{"device": {"fw": "1.2"}, "temp": 22.5}`,
+					wantStatus: "changed",
+					wantPaths:  "device.fw,temp",
+				},
+				// Another key has its own state
+				{payload: `{"device": {"id": "b"}, "temp": 22.5}`, want: `{"device": {"id": "b"}, "temp": 22.5}`, wantStatus: "new"},
+				{payload: `{"device": {"id": "a", "fw": "1.2"}, "ts": 4}`, want: `{"temp": null}`, wantStatus: "changed", wantPaths: "temp"},
+			},
+		},
+		{
+			name: "patch",
+			cfg: &RunnerConfig{
+				Key: Key{From: "metadata", Path: "device"}, Output: outputPatch, Backend: backendMemory,
+				Memory: statestore.MemoryConfig{MaxKeys: 10}, StatusKey: "eb-diff-status", PathsKey: "eb-diff-paths", Timeout: time.Second,
+			},
+			steps: []step{
+				{
+					payload: `{"state": {"on": true}, "tags": ["x"], "a/b": 1}`,
+					meta:    map[string]string{"device": "a"},
+					want:    `[{"op": "add", "path": "", "value": {"state": {"on": true}, "tags": ["x"], "a/b": 1}}]`,
+				},
+				{
+					payload: `{"state": {"on": false, "level": 3}, "tags": ["x", "y"]}`,
+					meta:    map[string]string{"device": "a"},
+					want: `[
+						{"op": "remove", "path": "/a~1b"},
+						{"op": "add", "path": "/state/level", "value": 3},
+						{"op": "replace", "path": "/state/on", "value": false},
+						{"op": "replace", "path": "/tags", "value": ["x", "y"]}
+					]`,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRunner(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewRunner() unexpected error = %v", err)
+			}
+			t.Cleanup(func() { _ = r.Close() })
+			run(t, r, tt.steps)
+		})
+	}
+}
+
+func TestDiffRunnerFullOutputWithRedis(t *testing.T) {
+	srv, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	t.Cleanup(srv.Close)
+
+	cfg := &RunnerConfig{
+		Key: Key{Path: "id"}, Backend: backendRedis, Output: outputFull, TTL: time.Hour,
+		Redis: &statestore.RedisConfig{Address: srv.Addr()}, StatusKey: "eb-diff-status", PathsKey: "eb-diff-paths", Timeout: time.Second,
+	}
+	var runners [2]connectors.Runner
+	for i := range runners {
+		if runners[i], err = NewRunner(cfg); err != nil {
+			t.Fatalf("NewRunner() unexpected error = %v", err)
+		}
+		t.Cleanup(func() { _ = runners[i].Close() })
+	}
+
+	run(t, runners[0], []step{{payload: `{"id": 7, "v": 1}`, want: `{"id": 7, "v": 1}`, wantStatus: "new"}})
+	// The state is shared with the other instances
+	run(t, runners[1], []step{{payload: `{"id": 7, "v": 2}`, want: `{"id": 7, "v": 2}`, wantStatus: "changed", wantPaths: "v"}})
+	if !srv.Exists("eb-diff:7") || srv.TTL("eb-diff:7") != time.Hour {
+		t.Errorf("state key missing or without TTL")
+	}
+
+	srv.FastForward(2 * time.Hour)
+	run(t, runners[0], []step{{payload: `{"id": 7, "v": 2}`, want: `{"id": 7, "v": 2}`, wantStatus: "new"}})
+}
+
+func TestDiffRunnerErrors(t *testing.T) {
+	r, err := NewRunner(&RunnerConfig{
+		Key: Key{Path: "id"}, Backend: backendMemory, Output: outputChanges, Memory: statestore.MemoryConfig{MaxKeys: 10},
+		StatusKey: "eb-diff-status", PathsKey: "eb-diff-paths", Timeout: time.Second, MaxInputSize: 50,
+	})
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	for _, payload := range []string{
+		`not json`,
+		`{"v": 1}`,
+		`{"id": {"nested": true}}`,
+		`{"id": 1, "padding": "` + string(make([]byte, 50)) + `"}`,
+	} {
+		if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(payload), nil))); err == nil {
+			t.Errorf("Process(%s) expected error", payload)
+		}
+	}
+
+	for _, opts := range []map[string]any{
+		{},
+		{"key": map[string]any{"path": "id"}, "backend": "redis"},
+		{"key": map[string]any{"path": "id"}, "output": "merge"},
+		{"key": map[string]any{"path": "id", "from": "header"}},
+	} {
+		if err := utils.ParseConfig(opts, new(RunnerConfig)); err == nil {
+			t.Errorf("ParseConfig(%v) expected error", opts)
+		}
+	}
+}
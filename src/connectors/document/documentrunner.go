@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/sandrolain/events-bridge/src/common/jsonpath"
+	"github.com/sandrolain/events-bridge/src/common/tmplfuncs"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure DocumentRunner implements connectors.Runner
+var _ connectors.Runner = &DocumentRunner{}
+
+const (
+	formatPDF  = "pdf"
+	formatXLSX = "xlsx"
+
+	outputDir = "dir"
+)
+
+// contentTypes are the content types of the documents of each format
+var contentTypes = map[string]string{
+	formatPDF:  "application/pdf",
+	formatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// ColumnConfig is a column of the document table
+type ColumnConfig struct {
+	// Path is the dotted JSON path of the cell value in the row object (e.g. "customer.name")
+	Path string `mapstructure:"path" validate:"required"`
+	// Header is the column header (default: Path)
+	Header string `mapstructure:"header"`
+	// Width is the column width, in millimeters for PDF and in characters for XLSX
+	// (0 = the PDF columns share the free width, default XLSX width)
+	Width float64 `mapstructure:"width" validate:"min=0"`
+}
+
+// header returns the column header
+func (c *ColumnConfig) header() string {
+	if c.Header != "" {
+		return c.Header
+	}
+	return c.Path
+}
+
+// PDFConfig is the page setup of the PDF documents
+type PDFConfig struct {
+	// PageSize is "A3", "A4" (default), "A5", "Letter" or "Legal"
+	PageSize string `mapstructure:"pageSize" default:"A4" validate:"oneof=A3 A4 A5 Letter Legal"`
+	// Orientation is "portrait" (default) or "landscape"
+	Orientation string `mapstructure:"orientation" default:"portrait" validate:"oneof=portrait landscape"`
+	// FontSize is the font size of the text and the table, in points
+	FontSize float64 `mapstructure:"fontSize" default:"10" validate:"min=4,max=72"`
+	// PageNumbers prints "page/pages" in the footer
+	PageNumbers bool `mapstructure:"pageNumbers" default:"true"`
+}
+
+// XLSXConfig is the sheet setup of the XLSX documents
+type XLSXConfig struct {
+	// Sheet is the worksheet name
+	Sheet string `mapstructure:"sheet" default:"Sheet1" validate:"required,max=31"`
+	// FreezeHeader keeps the header row visible when scrolling
+	FreezeHeader bool `mapstructure:"freezeHeader" default:"true"`
+	// AutoFilter adds filter buttons to the header row
+	AutoFilter bool `mapstructure:"autoFilter"`
+}
+
+type RunnerConfig struct {
+	// Format is "pdf" or "xlsx"
+	Format string `mapstructure:"format" validate:"required,oneof=pdf xlsx"`
+	// Title is the Go template of the document title (with sprig functions), executed with
+	// "data" (decoded JSON payload) and "metadata": the PDF heading and the document property
+	Title string `mapstructure:"title"`
+	// Text is the Go template of the text printed before the table of PDF documents, with
+	// basic HTML formatting (<b>, <i>, <u>, <a href>, <br>, <center>, <right>)
+	Text string `mapstructure:"text"`
+	// Rows is the dotted JSON path of the array of row objects (empty = the payload is an
+	// array of objects, or an object printed as a single row)
+	Rows string `mapstructure:"rows"`
+	// Columns are the table columns (default: the fields of the first row, sorted)
+	Columns []ColumnConfig `mapstructure:"columns" validate:"dive"`
+	PDF     PDFConfig      `mapstructure:"pdf"`
+	XLSX    XLSXConfig     `mapstructure:"xlsx"`
+	// Output is "payload" (default, the document replaces the payload, e.g. for a target
+	// uploading it) or "dir" (the document is written to Dir and the payload is unchanged)
+	Output string `mapstructure:"output" default:"payload" validate:"oneof=payload dir"`
+	// Dir is the directory of the "dir" output
+	Dir string `mapstructure:"dir" validate:"required_if=Output dir"`
+	// FileName is the Go template of the file name; the extension of the format is added
+	// when missing
+	FileName string `mapstructure:"fileName" default:"{{ uuidv4 }}" validate:"required"`
+	// NameKey is the metadata key set to the file name
+	NameKey string `mapstructure:"nameKey" default:"eb-document-name" validate:"required"`
+	// PathKey is the metadata key set to the file path by the "dir" output
+	PathKey string `mapstructure:"pathKey" default:"eb-document-path" validate:"required"`
+	// ContentTypeKey is the metadata key set to the document content type by the "payload"
+	// output (empty = disabled). The default is forwarded as header by the HTTP runner.
+	ContentTypeKey string `mapstructure:"contentTypeKey" default:"Content-Type"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+// DocumentRunner renders the JSON payloads into PDF or XLSX documents, e.g. for report
+// generation pipelines
+type DocumentRunner struct {
+	cfg      *RunnerConfig
+	slog     *slog.Logger
+	title    *template.Template
+	text     *template.Template
+	fileName *template.Template
+	render   func(doc *document) ([]byte, error)
+}
+
+// document is the content of a rendered document
+type document struct {
+	title   string
+	text    string
+	columns []ColumnConfig
+	rows    [][]any
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a document runner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	r := &DocumentRunner{
+		cfg:  cfg,
+		slog: slog.Default().With("context", "Document Runner"),
+	}
+	var err error
+	for name, t := range map[string]struct {
+		src string
+		dst **template.Template
+	}{
+		"title":    {cfg.Title, &r.title},
+		"text":     {cfg.Text, &r.text},
+		"fileName": {cfg.FileName, &r.fileName},
+	} {
+		if t.src == "" {
+			continue
+		}
+		if *t.dst, err = template.New(name).Option("missingkey=zero").Funcs(tmplfuncs.FuncMap()).Parse(t.src); err != nil {
+			return nil, fmt.Errorf("failed to parse %s template: %w", name, err)
+		}
+	}
+
+	switch cfg.Format {
+	case formatPDF:
+		r.render = func(doc *document) ([]byte, error) { return renderPDF(&cfg.PDF, doc) }
+	case formatXLSX:
+		r.render = func(doc *document) ([]byte, error) { return renderXLSX(&cfg.XLSX, doc) }
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", cfg.Format)
+	}
+
+	if cfg.Output == outputDir {
+		if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	r.slog.Info("document runner created", "format", cfg.Format, "output", cfg.Output, "columns", len(cfg.Columns))
+	return r, nil
+}
+
+// Process renders the payload into a document and stores it in the payload or the directory
+func (r *DocumentRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds limit %d", len(data), r.cfg.MaxInputSize)
+	}
+
+	var payload any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return fmt.Errorf("failed to decode JSON payload: %w", err)
+	}
+	vars := map[string]any{"data": payload, "metadata": meta}
+
+	doc := &document{}
+	if doc.title, err = execute(r.title, vars); err != nil {
+		return fmt.Errorf("failed to render title: %w", err)
+	}
+	if doc.text, err = execute(r.text, vars); err != nil {
+		return fmt.Errorf("failed to render text: %w", err)
+	}
+	if err := r.table(doc, payload); err != nil {
+		return err
+	}
+
+	content, err := r.render(doc)
+	if err != nil {
+		return fmt.Errorf("failed to render %s document: %w", r.cfg.Format, err)
+	}
+
+	name, err := r.name(vars)
+	if err != nil {
+		return err
+	}
+	msg.AddMetadata(r.cfg.NameKey, name)
+
+	if r.cfg.Output == outputDir {
+		path, err := writeFile(r.cfg.Dir, name, content)
+		if err != nil {
+			return err
+		}
+		msg.AddMetadata(r.cfg.PathKey, path)
+		r.slog.Debug("document written", "path", path, "size", len(content))
+		return nil
+	}
+
+	msg.SetData(content)
+	if r.cfg.ContentTypeKey != "" {
+		msg.AddMetadata(r.cfg.ContentTypeKey, contentTypes[r.cfg.Format])
+	}
+	return nil
+}
+
+func execute(t *template.Template, vars map[string]any) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// table sets the columns and the cell values of the rows of the payload
+func (r *DocumentRunner) table(doc *document, payload any) error {
+	rows := payload
+	if r.cfg.Rows != "" {
+		var ok bool
+		if rows, ok = jsonpath.Get(payload, r.cfg.Rows); !ok {
+			return fmt.Errorf("rows path %s not found in payload", r.cfg.Rows)
+		}
+	}
+
+	var objects []any
+	switch v := rows.(type) {
+	case []any:
+		objects = v
+	case map[string]any:
+		objects = []any{v}
+	case nil:
+	default:
+		return errors.New("rows must be a JSON array of objects or an object")
+	}
+
+	doc.columns = r.cfg.Columns
+	if len(doc.columns) == 0 && len(objects) > 0 {
+		if first, ok := objects[0].(map[string]any); ok {
+			for k := range first {
+				doc.columns = append(doc.columns, ColumnConfig{Path: k})
+			}
+			slices.SortFunc(doc.columns, func(a, b ColumnConfig) int { return strings.Compare(a.Path, b.Path) })
+		}
+	}
+
+	doc.rows = make([][]any, len(objects))
+	for i, obj := range objects {
+		if _, ok := obj.(map[string]any); !ok {
+			return fmt.Errorf("row %d is not a JSON object", i)
+		}
+		cells := make([]any, len(doc.columns))
+		for j, col := range doc.columns {
+			if v, ok := jsonpath.Get(obj, col.Path); ok {
+				cells[j] = v
+			}
+		}
+		doc.rows[i] = cells
+	}
+	return nil
+}
+
+// name renders the file name, adding the extension of the format
+func (r *DocumentRunner) name(vars map[string]any) (string, error) {
+	name, err := execute(r.fileName, vars)
+	if err != nil {
+		return "", fmt.Errorf("failed to render file name: %w", err)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	if ext := "." + r.cfg.Format; !strings.EqualFold(filepath.Ext(name), ext) {
+		name += ext
+	}
+	return name, nil
+}
+
+// writeFile writes the document through a temporary file renamed once complete, so that the
+// directory watchers never read partial documents
+func writeFile(dir, name string, content []byte) (string, error) {
+	tmp, err := os.CreateTemp(dir, ".document-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // removed once renamed
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close() //nolint:errcheck
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	return path, nil
+}
+
+// cellString converts a decoded JSON value to the text of a cell
+func cellString(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case map[string]any, []any:
+		b, _ := json.Marshal(val)
+		return string(b)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func (r *DocumentRunner) Close() error {
+	r.slog.Info("closing document runner")
+	return nil
+}
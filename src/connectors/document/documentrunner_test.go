@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+	"github.com/xuri/excelize/v2"
+)
+
+const orderPayload = `{
+	"id": "A-42",
+	"customer": {"name": "Zoë Müller"},
+	"lines": [
+		{"sku": "LAMP", "qty": 2, "price": 19.9, "gift": true},
+		{"sku": "DESK", "qty": 1, "price": 120, "notes": {"color": "oak"}}
+	]
+}`
+
+func TestDocumentRunner(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "reports")
+	lines := make([]string, 200)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(`{"sku": "SKU-%d", "description": "%s"}`, i, strings.Repeat("long text ", i%10))
+	}
+	pdf := map[string]any{
+		"format": "pdf",
+		"title":  "Order {{ .data.id }}",
+		"text":   "Customer: <b>{{ .data.customer.name }}</b>",
+		"rows":   "lines",
+		"pdf":    map[string]any{"orientation": "landscape"},
+	}
+
+	tests := []struct {
+		name  string
+		opts  map[string]any
+		data  string
+		check func(t *testing.T, meta map[string]string, data []byte)
+	}{
+		{
+			name: "xlsx",
+			opts: map[string]any{
+				"format":   "xlsx",
+				"title":    "Order {{ .data.id }}",
+				"rows":     "lines",
+				"fileName": "order-{{ .metadata.order }}",
+				"columns": []any{
+					map[string]any{"path": "sku", "header": "SKU", "width": 20},
+					map[string]any{"path": "qty"},
+					map[string]any{"path": "price", "header": "Price"},
+					map[string]any{"path": "gift"},
+					map[string]any{"path": "notes.color", "header": "Color"},
+				},
+				"xlsx": map[string]any{"sheet": "Lines", "autoFilter": true},
+			},
+			data: orderPayload,
+			check: func(t *testing.T, meta map[string]string, data []byte) {
+				if meta["eb-document-name"] != "order-A-42.xlsx" || meta["Content-Type"] != contentTypes[formatXLSX] {
+					t.Errorf("metadata = %v", meta)
+				}
+				f, err := excelize.OpenReader(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("OpenReader() unexpected error = %v", err)
+				}
+				defer f.Close() //nolint:errcheck
+				rows, err := f.GetRows("Lines")
+				if err != nil {
+					t.Fatalf("GetRows() unexpected error = %v", err)
+				}
+				want := [][]string{
+					{"SKU", "qty", "Price", "gift", "Color"},
+					{"LAMP", "2", "19.9", "TRUE"},
+					{"DESK", "1", "120", "", "oak"},
+				}
+				if fmt.Sprint(rows) != fmt.Sprint(want) {
+					t.Errorf("rows = %q, want %q", rows, want)
+				}
+				// Numbers are not written as strings
+				if typ, _ := f.GetCellType("Lines", "A2"); typ != excelize.CellTypeSharedString {
+					t.Errorf("sku cell type = %v, want string", typ)
+				}
+				if typ, _ := f.GetCellType("Lines", "C2"); typ == excelize.CellTypeSharedString || typ == excelize.CellTypeInlineString {
+					t.Errorf("price cell type = %v, want number", typ)
+				}
+				if props, err := f.GetDocProps(); err != nil || props.Title != "Order A-42" {
+					t.Errorf("title = %v (%v)", props, err)
+				}
+			},
+		},
+		{
+			name: "pdf",
+			opts: pdf,
+			data: orderPayload,
+			check: func(t *testing.T, meta map[string]string, data []byte) {
+				if !bytes.HasPrefix(data, []byte("%PDF-")) || meta["Content-Type"] != "application/pdf" || !strings.HasSuffix(meta["eb-document-name"], ".pdf") {
+					t.Errorf("document = %.20q, metadata = %v", data, meta)
+				}
+			},
+		},
+		{
+			// Long tables continue on the next pages
+			name: "pdf pages",
+			opts: pdf,
+			data: `{"id": "B", "customer": {"name": "B"}, "lines": [` + strings.Join(lines, ",") + `]}`,
+			check: func(t *testing.T, _ map[string]string, data []byte) {
+				if pages := bytes.Count(data, []byte("/Type /Page\n")); pages < 3 {
+					t.Errorf("pages = %d, want at least 3", pages)
+				}
+			},
+		},
+		{
+			name: "dir",
+			opts: map[string]any{
+				"format":   "xlsx",
+				"output":   "dir",
+				"dir":      dir,
+				"fileName": "{{ (index .data 0).id }}.XLSX",
+			},
+			data: `[{"id": "r1", "total": 3}]`,
+			check: func(t *testing.T, meta map[string]string, data []byte) {
+				path := filepath.Join(dir, "r1.XLSX")
+				if meta["eb-document-path"] != path || meta["eb-document-name"] != "r1.XLSX" {
+					t.Errorf("metadata = %v", meta)
+				}
+				if string(data) != `[{"id": "r1", "total": 3}]` {
+					t.Errorf("payload changed: %s", data)
+				}
+				f, err := excelize.OpenFile(path)
+				if err != nil {
+					t.Fatalf("OpenFile() unexpected error = %v", err)
+				}
+				defer f.Close() //nolint:errcheck
+				// The columns default to the sorted fields of the first row
+				if v, _ := f.GetCellValue("Sheet1", "B1"); v != "total" {
+					t.Errorf("B1 = %q, want total", v)
+				}
+				entries, _ := os.ReadDir(dir)
+				if len(entries) != 1 {
+					t.Errorf("directory entries = %d, want 1", len(entries))
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewRunnerConfig().(*RunnerConfig)
+			if err := utils.ParseConfig(tt.opts, cfg); err != nil {
+				t.Fatalf("ParseConfig() unexpected error = %v", err)
+			}
+			r, err := NewRunner(cfg)
+			if err != nil {
+				t.Fatalf("NewRunner() unexpected error = %v", err)
+			}
+			msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(tt.data), map[string]string{"order": "A-42"}))
+			if err := r.Process(msg); err != nil {
+				t.Fatalf("Process() unexpected error = %v", err)
+			}
+			meta, data, err := msg.GetMetadataAndData()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, meta, data)
+		})
+	}
+}
+
+func TestDocumentErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts map[string]any
+		data string
+	}{
+		"not JSON":          {map[string]any{"format": "pdf"}, "report"},
+		"missing rows path": {map[string]any{"format": "pdf", "rows": "items"}, `{"lines": []}`},
+		"scalar rows":       {map[string]any{"format": "xlsx", "rows": "id"}, `{"id": "x"}`},
+		"row not an object": {map[string]any{"format": "xlsx"}, `[{"a": 1}, 2]`},
+		"file name path":    {map[string]any{"format": "xlsx", "fileName": "../{{ .data.a }}"}, `{"a": 1}`},
+		"input size":        {map[string]any{"format": "xlsx", "maxInputSize": 4}, `{"a": 1}`},
+	} {
+		cfg := NewRunnerConfig().(*RunnerConfig)
+		if err := utils.ParseConfig(tc.opts, cfg); err != nil {
+			t.Fatalf("%s: ParseConfig() unexpected error = %v", name, err)
+		}
+		r, err := NewRunner(cfg)
+		if err != nil {
+			t.Fatalf("%s: NewRunner() unexpected error = %v", name, err)
+		}
+		msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(tc.data), nil))
+		if err := r.Process(msg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(map[string]any{"format": "pdf", "title": "{{ .data"}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRunner(cfg); err == nil {
+		t.Error("invalid template: expected error")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	// fontFamily is the core font of the documents, encoded in cp1252
+	fontFamily = "Helvetica"
+	// cellPadding is the horizontal padding of the table cells, in millimeters
+	cellPadding = 1.5
+)
+
+// renderPDF renders the title, the text and the table of the document into a PDF
+func renderPDF(cfg *PDFConfig, doc *document) ([]byte, error) {
+	orientation := "P"
+	if cfg.Orientation == "landscape" {
+		orientation = "L"
+	}
+	pdf := gofpdf.New(orientation, "mm", cfg.PageSize, "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	lineHeight := cfg.FontSize * 0.5
+
+	pdf.SetCreator("events-bridge", true)
+	if doc.title != "" {
+		pdf.SetTitle(doc.title, true)
+	}
+	if cfg.PageNumbers {
+		pdf.AliasNbPages("")
+		pdf.SetFooterFunc(func() {
+			pdf.SetY(-12)
+			pdf.SetFont(fontFamily, "I", 8)
+			pdf.CellFormat(0, 8, fmt.Sprintf("%d/{nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+		})
+	}
+	pdf.AddPage()
+
+	if doc.title != "" {
+		pdf.SetFont(fontFamily, "B", cfg.FontSize*1.6)
+		pdf.MultiCell(0, cfg.FontSize*0.8, tr(doc.title), "", "L", false)
+		pdf.Ln(lineHeight)
+	}
+	if doc.text != "" {
+		pdf.SetFont(fontFamily, "", cfg.FontSize)
+		html := pdf.HTMLBasicNew()
+		html.Write(lineHeight, tr(doc.text))
+		pdf.Ln(lineHeight * 2)
+	}
+	if len(doc.columns) > 0 {
+		pdfTable(pdf, cfg, doc, tr, lineHeight)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tableWriter prints the rows of a document, wrapping the cell text
+type tableWriter struct {
+	pdf        *gofpdf.Fpdf
+	tr         func(string) string
+	fontSize   float64
+	lineHeight float64
+	widths     []float64
+	headers    []string
+}
+
+// pdfTable prints the table, repeating the header on every page
+func pdfTable(pdf *gofpdf.Fpdf, cfg *PDFConfig, doc *document, tr func(string) string, lineHeight float64) {
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+
+	t := &tableWriter{
+		pdf:        pdf,
+		tr:         tr,
+		fontSize:   cfg.FontSize,
+		lineHeight: lineHeight,
+		widths:     make([]float64, len(doc.columns)),
+		headers:    make([]string, len(doc.columns)),
+	}
+	// The columns without width share the free width
+	free, auto := pageWidth-left-right, 0
+	for i, col := range doc.columns {
+		t.headers[i] = col.header()
+		t.widths[i] = col.Width
+		if col.Width > 0 {
+			free -= col.Width
+		} else {
+			auto++
+		}
+	}
+	for i := range t.widths {
+		if t.widths[i] == 0 {
+			t.widths[i] = max(free/float64(auto), 10)
+		}
+	}
+
+	pdf.SetFillColor(230, 230, 230)
+	pdf.SetDrawColor(160, 160, 160)
+	t.row(t.headers, true)
+	for _, cells := range doc.rows {
+		texts := make([]string, len(cells))
+		for i, v := range cells {
+			texts[i] = cellString(v)
+		}
+		t.row(texts, false)
+	}
+}
+
+// row prints a row, on a new page with the header when it does not fit
+func (t *tableWriter) row(cells []string, header bool) {
+	style := ""
+	if header {
+		style = "B"
+	}
+	t.pdf.SetFont(fontFamily, style, t.fontSize)
+
+	lines := make([][]string, len(cells))
+	height := t.lineHeight
+	for i, text := range cells {
+		for _, l := range t.pdf.SplitLines([]byte(t.tr(text)), t.widths[i]-2*cellPadding) {
+			lines[i] = append(lines[i], string(l))
+		}
+		height = max(height, float64(len(lines[i]))*t.lineHeight)
+	}
+	height += cellPadding
+
+	_, pageHeight := t.pdf.GetPageSize()
+	left, _, _, bottom := t.pdf.GetMargins()
+	if t.pdf.GetY()+height > pageHeight-bottom {
+		t.pdf.AddPage()
+		if !header {
+			t.row(t.headers, true)
+			t.pdf.SetFont(fontFamily, style, t.fontSize)
+		}
+	}
+
+	x, y := t.pdf.GetXY()
+	border := "D"
+	if header {
+		border = "FD"
+	}
+	for i := range cells {
+		t.pdf.Rect(x, y, t.widths[i], height, border)
+		for j, l := range lines[i] {
+			t.pdf.SetXY(x+cellPadding, y+cellPadding/2+float64(j)*t.lineHeight)
+			t.pdf.CellFormat(t.widths[i]-2*cellPadding, t.lineHeight, l, "", 0, "L", false, 0, "")
+		}
+		x += t.widths[i]
+	}
+	t.pdf.SetXY(left, y+height)
+}
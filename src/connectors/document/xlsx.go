@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// renderXLSX renders the table of the document into a worksheet, the header in the first row
+func renderXLSX(cfg *XLSXConfig, doc *document) ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close() //nolint:errcheck
+
+	if err := f.SetSheetName("Sheet1", cfg.Sheet); err != nil {
+		return nil, fmt.Errorf("invalid sheet name: %w", err)
+	}
+	if err := f.SetDocProps(&excelize.DocProperties{Creator: "events-bridge", Title: doc.title}); err != nil {
+		return nil, err
+	}
+
+	if len(doc.columns) > 0 {
+		headers := make([]any, len(doc.columns))
+		for i := range doc.columns {
+			headers[i] = doc.columns[i].header()
+		}
+		if err := f.SetSheetRow(cfg.Sheet, "A1", &headers); err != nil {
+			return nil, err
+		}
+		last, err := excelize.CoordinatesToCellName(len(doc.columns), 1)
+		if err != nil {
+			return nil, err
+		}
+		bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+		if err != nil {
+			return nil, err
+		}
+		if err := f.SetCellStyle(cfg.Sheet, "A1", last, bold); err != nil {
+			return nil, err
+		}
+
+		for i, col := range doc.columns {
+			if col.Width == 0 {
+				continue
+			}
+			name, err := excelize.ColumnNumberToName(i + 1)
+			if err != nil {
+				return nil, err
+			}
+			if err := f.SetColWidth(cfg.Sheet, name, name, col.Width); err != nil {
+				return nil, err
+			}
+		}
+		if cfg.FreezeHeader {
+			if err := f.SetPanes(cfg.Sheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+				return nil, err
+			}
+		}
+		if cfg.AutoFilter {
+			end, err := excelize.CoordinatesToCellName(len(doc.columns), len(doc.rows)+1)
+			if err != nil {
+				return nil, err
+			}
+			if err := f.AutoFilter(cfg.Sheet, "A1:"+end, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i, cells := range doc.rows {
+		values := make([]any, len(cells))
+		for j, v := range cells {
+			values[j] = cellValue(v)
+		}
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.SetSheetRow(cfg.Sheet, cell, &values); err != nil {
+			return nil, err
+		}
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cellValue converts a decoded JSON value to a typed cell value: numbers and booleans are
+// kept as such, so that the spreadsheet formulas work on them
+func cellValue(v any) any {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case bool:
+		return val
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		if f, err := val.Float64(); err == nil {
+			return f
+		}
+		return val.String()
+	default:
+		return cellString(val)
+	}
+}
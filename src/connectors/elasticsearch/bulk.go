@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/httpretry"
+	"github.com/sandrolain/events-bridge/src/connectors"
+)
+
+// errConflict marks the documents rejected with a version conflict
+var errConflict = errors.New("version conflict")
+
+// document is a bulk operation with its JSON source
+type document struct {
+	op       string
+	index    string
+	id       string
+	routing  string
+	pipeline string
+	version  *int64
+	source   []byte
+}
+
+// newDocument maps the message to the bulk operation of the runner
+func (r *ElasticsearchRunner) newDocument(metadata map[string]string, data []byte) (document, error) {
+	d := document{
+		op:       r.operation,
+		index:    fromMetadata(metadata, r.cfg.IndexFromMetadataKey, r.cfg.Index),
+		id:       fromMetadata(metadata, r.cfg.IDFromMetadataKey, ""),
+		routing:  fromMetadata(metadata, r.cfg.RoutingFromMetadataKey, ""),
+		pipeline: fromMetadata(metadata, r.cfg.PipelineFromMetadataKey, r.cfg.Pipeline),
+	}
+	if d.index == "" {
+		return document{}, errors.New("no index for the message")
+	}
+	if d.op == opUpdate && d.id == "" {
+		return document{}, errors.New("the update operation requires the document id")
+	}
+	if v := fromMetadata(metadata, r.cfg.VersionFromMetadataKey, ""); v != "" {
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || version < 0 {
+			return document{}, fmt.Errorf("invalid version metadata %q: %q", r.cfg.VersionFromMetadataKey, v)
+		}
+		d.version = &version
+	}
+
+	// The bulk body is newline delimited: the source must fit in a line
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return document{}, fmt.Errorf("payload is not valid JSON: %w", err)
+	}
+	d.source = buf.Bytes()
+	if len(d.source) == 0 || d.source[0] != '{' {
+		return document{}, errors.New("payload must be a JSON object")
+	}
+
+	if r.cfg.DataStream {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(d.source, &fields); err != nil {
+			return document{}, fmt.Errorf("payload is not valid JSON: %w", err)
+		}
+		if _, ok := fields[timestampField]; !ok {
+			ts, err := r.timestamp(metadata)
+			if err != nil {
+				return document{}, err
+			}
+			d.source = addField(d.source, timestampField, ts.UTC().Format(time.RFC3339Nano))
+		}
+	}
+	return d, nil
+}
+
+// timestamp returns the "@timestamp" of a data stream document
+func (r *ElasticsearchRunner) timestamp(metadata map[string]string) (time.Time, error) {
+	v := fromMetadata(metadata, r.cfg.TimestampFromMetadataKey, "")
+	if v == "" {
+		return r.now(), nil
+	}
+	ts, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp metadata %q: %w", r.cfg.TimestampFromMetadataKey, err)
+	}
+	return ts, nil
+}
+
+// addField prepends a string field to the compact JSON object, keeping the order of the others
+func addField(object []byte, name, value string) []byte {
+	field, _ := json.Marshal(map[string]string{name: value})
+	out := append([]byte{}, field[:len(field)-1]...)
+	if len(object) > 2 {
+		out = append(out, ',')
+	}
+	return append(out, object[1:]...)
+}
+
+func fromMetadata(metadata map[string]string, key, fallback string) string {
+	if key != "" {
+		if v := metadata[key]; v != "" {
+			return v
+		}
+	}
+	return fallback
+}
+
+// bulkAction is the action line of a bulk operation
+type bulkAction struct {
+	Index        string `json:"_index"`
+	ID           string `json:"_id,omitempty"`
+	Routing      string `json:"routing,omitempty"`
+	Pipeline     string `json:"pipeline,omitempty"`
+	RequireAlias bool   `json:"require_alias,omitempty"`
+	Version      *int64 `json:"version,omitempty"`
+	VersionType  string `json:"version_type,omitempty"`
+}
+
+// encode returns the newline delimited body of the bulk request
+func (r *ElasticsearchRunner) encode(docs []document) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, d := range docs {
+		action := bulkAction{
+			Index:        d.index,
+			ID:           d.id,
+			Routing:      d.routing,
+			Pipeline:     d.pipeline,
+			RequireAlias: r.cfg.RequireAlias,
+			Version:      d.version,
+		}
+		if d.version != nil {
+			action.VersionType = r.cfg.VersionType
+		}
+		line, err := json.Marshal(map[string]bulkAction{d.op: action})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode bulk action: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		if d.op == opUpdate {
+			buf.WriteString(`{"doc":`)
+			buf.Write(d.source)
+			buf.WriteString(`,"doc_as_upsert":true}`)
+		} else {
+			buf.Write(d.source)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// bulkItem is the result of a bulk operation
+type bulkItem struct {
+	Index  string `json:"_index"`
+	ID     string `json:"_id"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+func (i bulkItem) err() error {
+	var reason string
+	if i.Error != nil {
+		reason = i.Error.Type + ": " + i.Error.Reason
+	}
+	err := fmt.Errorf("document %q of %q rejected with status %d: %s", i.ID, i.Index, i.Status, reason)
+	if i.Status == http.StatusConflict {
+		return fmt.Errorf("%w: %w", errConflict, err)
+	}
+	return err
+}
+
+// write sends the documents, applying the conflict strategy to the documents rejected with
+// a version conflict, and returns the result of every document
+func (r *ElasticsearchRunner) write(docs []document) []error {
+	results := make([]error, len(docs))
+	todo := make([]int, len(docs))
+	for i := range docs {
+		todo[i] = i
+	}
+
+	for attempt := 0; len(todo) > 0; attempt++ {
+		batch := make([]document, len(todo))
+		for j, i := range todo {
+			batch[j] = docs[i]
+		}
+		items, err := r.bulk(batch)
+		if err != nil {
+			for _, i := range todo {
+				results[i] = err
+			}
+			break
+		}
+
+		var again []int
+		for j, i := range todo {
+			item := items[j]
+			switch {
+			case item.Status < 300:
+				results[i] = nil
+			case item.Status != http.StatusConflict:
+				results[i] = item.err()
+			case r.cfg.OnConflict == conflictIgnore:
+				r.slog.Debug("version conflict ignored", "index", item.Index, "id", item.ID)
+				results[i] = nil
+			case r.cfg.OnConflict == conflictRetry && attempt < r.cfg.ConflictRetries:
+				again = append(again, i)
+			case r.cfg.OnConflict == conflictOverwrite && (docs[i].op != opIndex || docs[i].version != nil):
+				// The document replaces the existing one whatever its version
+				docs[i].op = opIndex
+				docs[i].version = nil
+				again = append(again, i)
+			default:
+				results[i] = item.err()
+			}
+		}
+		if len(again) > 0 && r.cfg.OnConflict == conflictRetry && r.cfg.ConflictRetryDelay > 0 {
+			r.sleep(r.cfg.ConflictRetryDelay)
+		}
+		todo = again
+	}
+	return results
+}
+
+// bulk sends the documents in a bulk request and returns their results, in order
+func (r *ElasticsearchRunner) bulk(docs []document) ([]bulkItem, error) {
+	body, err := r.encode(docs)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.do(context.Background(), http.MethodPost, "/_bulk", "application/x-ndjson", body)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close() //nolint:errcheck
+	if err := r.checkStatus(res); err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Items []map[string]bulkItem `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid bulk response: %w", err)
+	}
+	if len(out.Items) != len(docs) {
+		return nil, fmt.Errorf("invalid bulk response: %d items for %d documents", len(out.Items), len(docs))
+	}
+	items := make([]bulkItem, len(docs))
+	for i, item := range out.Items {
+		for _, result := range item {
+			items[i] = result
+		}
+	}
+	return items, nil
+}
+
+// bootstrapAlias creates the first index of the rollover alias, as its write index,
+// unless the alias exists
+func (r *ElasticsearchRunner) bootstrapAlias(ctx context.Context) error {
+	alias := r.cfg.Index
+	res, err := r.do(ctx, http.MethodGet, "/_alias/"+url.PathEscape(alias), "", nil)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		r.slog.Debug("rollover alias exists", "alias", alias)
+		return nil
+	}
+	if res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to check alias %q: status %d", alias, res.StatusCode)
+	}
+
+	index := alias + "-000001"
+	body, err := json.Marshal(map[string]any{
+		"aliases": map[string]any{alias: map[string]bool{"is_write_index": true}},
+	})
+	if err != nil {
+		return err
+	}
+	res, err = r.do(ctx, http.MethodPut, "/"+url.PathEscape(index), "application/json", body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close() //nolint:errcheck
+	if res.StatusCode == http.StatusBadRequest {
+		// Created meanwhile by another instance
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, httpretry.MaxErrorBody))
+		if bytes.Contains(msg, []byte("resource_already_exists_exception")) {
+			return nil
+		}
+		return fmt.Errorf("failed to create index %q: status %d: %s", index, res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if err := r.checkStatus(res); err != nil {
+		return fmt.Errorf("failed to create index %q: %w", index, err)
+	}
+	r.slog.Info("rollover alias created", "alias", alias, "index", index)
+	return nil
+}
+
+// do sends a request to the cluster
+func (r *ElasticsearchRunner) do(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range r.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if r.cfg.Username != "" {
+		req.SetBasicAuth(r.cfg.Username, r.password)
+	} else if r.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+r.apiKey)
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	return res, nil
+}
+
+// checkStatus returns the error of a non-2XX response, with the delay of the upstream
+// when it asked to slow down
+func (r *ElasticsearchRunner) checkStatus(res *http.Response) error {
+	if res.StatusCode <= 299 {
+		return nil
+	}
+	err := fmt.Errorf("non-2XX status code: %d: %s", res.StatusCode, httpretry.ErrorBody(res.Body))
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+		if delay, ok := httpretry.ParseRetryAfter(res.Header.Get("Retry-After"), r.now()); ok {
+			return &connectors.RetryAfterError{Delay: delay, Err: err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure ElasticsearchRunner implements connectors.LifecycleRunner
+var _ connectors.LifecycleRunner = &ElasticsearchRunner{}
+
+const (
+	opIndex  = "index"
+	opCreate = "create"
+	opUpdate = "update"
+
+	conflictFail      = "fail"
+	conflictIgnore    = "ignore"
+	conflictRetry     = "retry"
+	conflictOverwrite = "overwrite"
+
+	// timestampField is the field required in the documents of the data streams
+	timestampField = "@timestamp"
+)
+
+type RunnerConfig struct {
+	// URL is the base URL of the cluster, e.g. http://elasticsearch:9200
+	URL string `mapstructure:"url" validate:"required,url"`
+	// Index is the index, alias or data stream the documents are written to
+	Index string `mapstructure:"index"`
+	// IndexFromMetadataKey is the metadata key of the index, overriding Index
+	IndexFromMetadataKey string `mapstructure:"indexFromMetadataKey"`
+	// Operation is the bulk operation: "index", "create" (fails on existing ids) or "update"
+	// (partial update, upserting missing documents); "create" for the data streams, "index"
+	// otherwise when empty
+	Operation string `mapstructure:"operation" validate:"omitempty,oneof=index create update"`
+	// IDFromMetadataKey is the metadata key of the document id; the cluster generates the
+	// ids when not set or missing
+	IDFromMetadataKey string `mapstructure:"idFromMetadataKey"`
+	// RoutingFromMetadataKey is the metadata key of the shard routing value
+	RoutingFromMetadataKey string `mapstructure:"routingFromMetadataKey"`
+	// DataStream writes to data streams: the documents are created, with the "@timestamp"
+	// field added when missing
+	DataStream bool `mapstructure:"dataStream"`
+	// TimestampFromMetadataKey is the metadata key of the "@timestamp" of the data stream
+	// documents (RFC3339); the current time is used when not set or missing
+	TimestampFromMetadataKey string `mapstructure:"timestampFromMetadataKey"`
+	// Pipeline is the ingest pipeline processing the documents
+	Pipeline string `mapstructure:"pipeline"`
+	// PipelineFromMetadataKey is the metadata key of the ingest pipeline, overriding Pipeline
+	PipelineFromMetadataKey string `mapstructure:"pipelineFromMetadataKey"`
+	// RequireAlias rejects the documents whose index is not an alias, instead of creating a
+	// concrete index named like the rollover alias of an index lifecycle policy
+	RequireAlias bool `mapstructure:"requireAlias"`
+	// BootstrapAlias creates the first index of the rollover alias Index ("<index>-000001",
+	// as its write index) on start when the alias does not exist
+	BootstrapAlias bool `mapstructure:"bootstrapAlias"`
+	// VersionFromMetadataKey is the metadata key of the external version of the document,
+	// older versions being rejected as conflicts
+	VersionFromMetadataKey string `mapstructure:"versionFromMetadataKey"`
+	// VersionType is the type of the external versions: "external" or "external_gte"
+	VersionType string `mapstructure:"versionType" default:"external" validate:"oneof=external external_gte"`
+	// OnConflict is the strategy for the documents rejected with a 409 version conflict:
+	// "fail" the message, "ignore" the conflict, "retry" the document or "overwrite" it
+	// with an index operation without version
+	OnConflict string `mapstructure:"onConflict" default:"fail" validate:"oneof=fail ignore retry overwrite"`
+	// ConflictRetries is the number of retries of the conflicting documents with "retry"
+	ConflictRetries int `mapstructure:"conflictRetries" default:"3" validate:"min=1"`
+	// ConflictRetryDelay is waited before retrying the conflicting documents
+	ConflictRetryDelay time.Duration `mapstructure:"conflictRetryDelay" default:"100ms" validate:"min=0"`
+	// BatchSize is the maximum number of documents sent in one bulk request
+	BatchSize int `mapstructure:"batchSize" default:"100" validate:"min=1"`
+	// BatchWait is the maximum time a document waits for the batch to fill
+	BatchWait time.Duration `mapstructure:"batchWait" default:"1s" validate:"gt=0"`
+	// Async acknowledges the messages once the document is batched instead of once the batch is sent.
+	// WARNING: the documents of failed requests are lost.
+	Async bool `mapstructure:"async" default:"false"`
+	// Headers are additional HTTP headers
+	Headers map[string]string `mapstructure:"headers"`
+	// Username enables basic authentication
+	Username string `mapstructure:"username"`
+	// Password supports secret references (env:, file:)
+	Password string `mapstructure:"password"`
+	// APIKey is the encoded API key sent as "Authorization: ApiKey"; supports secret references
+	APIKey  string            `mapstructure:"apiKey" validate:"excluded_with=Username"`
+	Timeout time.Duration     `mapstructure:"timeout" default:"10s" validate:"gt=0"`
+	TLS     *tlsconfig.Config `mapstructure:"tls"`
+}
+
+// pending is a document waiting in the batch, with the channel notified of its result
+type pending struct {
+	doc  document
+	done chan error
+}
+
+// batch holds the pending documents
+type batch struct {
+	docs  []pending
+	timer *time.Timer
+}
+
+type ElasticsearchRunner struct {
+	cfg       *RunnerConfig
+	slog      *slog.Logger
+	client    *http.Client
+	baseURL   string
+	operation string
+	password  string
+	apiKey    string
+	now       func() time.Time
+	sleep     func(time.Duration)
+
+	mu     sync.Mutex
+	batch  *batch
+	pushes sync.WaitGroup
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a new instance of ElasticsearchRunner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	if cfg.Index == "" && cfg.IndexFromMetadataKey == "" {
+		return nil, errors.New("index or indexFromMetadataKey is required")
+	}
+
+	operation := cfg.Operation
+	if cfg.DataStream {
+		// The data streams are append-only
+		if operation != "" && operation != opCreate {
+			return nil, fmt.Errorf("operation %q is not supported by data streams, only %q", operation, opCreate)
+		}
+		if cfg.OnConflict == conflictOverwrite {
+			return nil, errors.New("onConflict overwrite is not supported by data streams")
+		}
+		if cfg.BootstrapAlias {
+			return nil, errors.New("bootstrapAlias is not supported by data streams")
+		}
+		operation = opCreate
+	}
+	if operation == "" {
+		operation = opIndex
+	}
+	if cfg.BootstrapAlias && cfg.Index == "" {
+		return nil, errors.New("bootstrapAlias requires the index of the alias")
+	}
+	if operation == opUpdate {
+		if cfg.VersionFromMetadataKey != "" {
+			return nil, errors.New("versionFromMetadataKey is not supported by the update operation")
+		}
+		if cfg.Pipeline != "" || cfg.PipelineFromMetadataKey != "" {
+			return nil, errors.New("ingest pipelines are not supported by the update operation")
+		}
+	}
+
+	r := &ElasticsearchRunner{
+		cfg:       cfg,
+		slog:      slog.Default().With("context", "Elasticsearch Runner"),
+		baseURL:   strings.TrimSuffix(cfg.URL, "/"),
+		operation: operation,
+		now:       time.Now,
+		sleep:     time.Sleep,
+	}
+
+	var err error
+	if cfg.Username != "" {
+		if r.password, err = secrets.Resolve(cfg.Password); err != nil {
+			return nil, fmt.Errorf("failed to resolve password: %w", err)
+		}
+	}
+	if cfg.APIKey != "" {
+		if r.apiKey, err = secrets.Resolve(cfg.APIKey); err != nil {
+			return nil, fmt.Errorf("failed to resolve api key: %w", err)
+		}
+	}
+
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	r.client = &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	r.slog.Info("elasticsearch runner created",
+		"url", cfg.URL,
+		"index", cfg.Index,
+		"operation", operation,
+		"dataStream", cfg.DataStream,
+		"onConflict", cfg.OnConflict,
+		"batchSize", cfg.BatchSize,
+	)
+	return r, nil
+}
+
+// Process adds the JSON payload as a document to the batch. Unless Async is set, it
+// returns once the batch is sent, with the result of the document. The message is unchanged.
+func (r *ElasticsearchRunner) Process(msg *message.RunnerMessage) error {
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	doc, err := r.newDocument(metadata, data)
+	if err != nil {
+		return err
+	}
+
+	p := pending{doc: doc}
+	if !r.cfg.Async {
+		p.done = make(chan error, 1)
+	}
+	if full := r.add(p); full != nil {
+		r.push(full)
+	}
+	if p.done == nil {
+		return nil
+	}
+	return <-p.done
+}
+
+// add appends the document to the batch, returning the batch when full
+func (r *ElasticsearchRunner) add(p pending) *batch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := r.batch
+	if b == nil {
+		b = &batch{}
+		r.batch = b
+		b.timer = time.AfterFunc(r.cfg.BatchWait, func() {
+			if r.take(b) {
+				r.push(b)
+			}
+		})
+	}
+	b.docs = append(b.docs, p)
+	if len(b.docs) < r.cfg.BatchSize {
+		return nil
+	}
+	b.timer.Stop()
+	r.batch = nil
+	r.pushes.Add(1)
+	return b
+}
+
+// take removes the batch from the pending batch, reporting whether it was still pending
+func (r *ElasticsearchRunner) take(b *batch) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.batch != b {
+		return false
+	}
+	r.batch = nil
+	r.pushes.Add(1)
+	return true
+}
+
+// push sends the batch taken from the pending batch and notifies its documents of their result
+func (r *ElasticsearchRunner) push(b *batch) {
+	defer r.pushes.Done()
+
+	docs := make([]document, len(b.docs))
+	for i, p := range b.docs {
+		docs[i] = p.doc
+	}
+	results := r.write(docs)
+	failed := 0
+	for i, p := range b.docs {
+		if results[i] != nil {
+			failed++
+		}
+		if p.done != nil {
+			p.done <- results[i]
+		}
+	}
+	if failed > 0 {
+		r.slog.Error("error writing documents", "documents", len(docs), "failed", failed, "error", errors.Join(results...))
+	} else {
+		r.slog.Debug("documents written", "documents", len(docs))
+	}
+}
+
+// Start creates the first index of the rollover alias, if configured
+func (r *ElasticsearchRunner) Start(ctx context.Context) error {
+	if !r.cfg.BootstrapAlias {
+		return nil
+	}
+	return r.bootstrapAlias(ctx)
+}
+
+// Drain sends the pending batch and waits for the requests in progress
+func (r *ElasticsearchRunner) Drain(ctx context.Context) error {
+	r.mu.Lock()
+	b := r.batch
+	if b != nil {
+		b.timer.Stop()
+		r.batch = nil
+		r.pushes.Add(1)
+	}
+	r.mu.Unlock()
+	if b != nil {
+		r.push(b)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.pushes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *ElasticsearchRunner) Close() error {
+	r.slog.Info("closing elasticsearch runner")
+	if err := r.Drain(context.Background()); err != nil {
+		return err
+	}
+	r.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+// operation is a bulk operation received by the test cluster
+type operation struct {
+	op     string
+	action map[string]any
+	source map[string]any
+}
+
+// request is a request received by the test cluster
+type request struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+	ops    []operation
+}
+
+// cluster is a test server recording the requests, the responses of the bulk operations
+// being returned by the status function
+type cluster struct {
+	mu       sync.Mutex
+	requests []request
+	status   func(n int, op operation) int
+	handler  func(w http.ResponseWriter, req request) bool
+}
+
+func (c *cluster) all() []request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]request(nil), c.requests...)
+}
+
+func newCluster(t *testing.T) (*httptest.Server, *cluster) {
+	t.Helper()
+	c := &cluster{status: func(int, operation) int { return http.StatusCreated }}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := request{method: r.Method, path: r.URL.Path, header: r.Header.Clone(), body: body}
+		if r.URL.Path == "/_bulk" {
+			req.ops = parseBulk(t, body)
+		}
+		c.mu.Lock()
+		c.requests = append(c.requests, req)
+		n := len(c.requests)
+		c.mu.Unlock()
+		if c.handler != nil && c.handler(w, req) {
+			return
+		}
+
+		items := make([]map[string]any, len(req.ops))
+		for i, op := range req.ops {
+			status := c.status(n, op)
+			item := map[string]any{"_index": op.action["_index"], "_id": fmt.Sprint(op.action["_id"]), "status": status}
+			if status > 299 {
+				item["error"] = map[string]any{"type": "version_conflict_engine_exception", "reason": "conflict"}
+			}
+			items[i] = map[string]any{op.op: item}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"errors": false, "items": items})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, c
+}
+
+// parseBulk decodes the newline delimited body of a bulk request
+func parseBulk(t *testing.T, body []byte) []operation {
+	t.Helper()
+	var ops []operation
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var action map[string]map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+			t.Errorf("invalid action line %s: %v", scanner.Bytes(), err)
+			return nil
+		}
+		if !scanner.Scan() {
+			t.Error("missing source line")
+			return nil
+		}
+		var source map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &source); err != nil {
+			t.Errorf("invalid source line %s: %v", scanner.Bytes(), err)
+		}
+		for op, a := range action {
+			ops = append(ops, operation{op: op, action: a, source: source})
+		}
+	}
+	return ops
+}
+
+func newMessage(data string, meta map[string]string) *message.RunnerMessage {
+	return message.NewRunnerMessage(testutil.NewAdapter([]byte(data), meta))
+}
+
+func TestBulkIndex(t *testing.T) {
+	srv, c := newCluster(t)
+	cfg := &RunnerConfig{
+		URL:                    srv.URL,
+		Index:                  "orders",
+		IDFromMetadataKey:      "id",
+		RoutingFromMetadataKey: "tenant",
+		Pipeline:               "enrich",
+		APIKey:                 "a2V5",
+		VersionType:            "external",
+		OnConflict:             conflictFail,
+		ConflictRetries:        3,
+		ConflictRetryDelay:     time.Millisecond,
+		BatchSize:              2,
+		BatchWait:              time.Second,
+		Timeout:                time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*ElasticsearchRunner)
+	r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+	r.sleep = func(time.Duration) {}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, data := range []string{"{\n  \"n\": 1\n}", `{"n":2}`} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = r.Process(newMessage(data, map[string]string{"id": fmt.Sprint(i), "tenant": "acme"}))
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := c.all()
+	if len(reqs) != 1 || len(reqs[0].ops) != 2 {
+		t.Fatalf("requests = %+v", reqs)
+	}
+	req := reqs[0]
+	if req.header.Get("Content-Type") != "application/x-ndjson" || req.header.Get("Authorization") != "ApiKey a2V5" {
+		t.Errorf("headers = %v", req.header)
+	}
+	// The sources are compacted to single lines
+	if lines := bytes.Count(req.body, []byte("\n")); lines != 4 {
+		t.Errorf("body has %d lines: %s", lines, req.body)
+	}
+	for _, op := range req.ops {
+		if op.op != opIndex || op.action["_index"] != "orders" || op.action["routing"] != "acme" ||
+			op.action["pipeline"] != "enrich" || op.action["_id"] == nil || op.source["n"] == nil {
+			t.Errorf("operation = %+v", op)
+		}
+	}
+}
+
+func TestDataStream(t *testing.T) {
+	srv, c := newCluster(t)
+	cfg := &RunnerConfig{
+		URL:                      srv.URL,
+		Index:                    "logs-app-default",
+		IndexFromMetadataKey:     "stream",
+		DataStream:               true,
+		TimestampFromMetadataKey: "ts",
+		PipelineFromMetadataKey:  "pipeline",
+		VersionType:              "external",
+		OnConflict:               conflictFail,
+		ConflictRetries:          3,
+		ConflictRetryDelay:       time.Millisecond,
+		BatchSize:                1,
+		BatchWait:                time.Second,
+		Timeout:                  time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*ElasticsearchRunner)
+	r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+	r.sleep = func(time.Duration) {}
+
+	for _, tt := range []struct {
+		data string
+		meta map[string]string
+	}{
+		{`{"msg":"a"}`, nil},
+		{`{}`, map[string]string{"ts": "2024-01-02T03:04:05Z", "stream": "logs-other-default", "pipeline": "p1"}},
+		{`{"@timestamp":"2020-01-01T00:00:00Z"}`, map[string]string{"ts": "2024-01-02T03:04:05Z"}},
+	} {
+		if err := r.Process(newMessage(tt.data, tt.meta)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reqs := c.all()
+	if len(reqs) != 3 {
+		t.Fatalf("requests = %d", len(reqs))
+	}
+	want := []struct{ index, timestamp, pipeline string }{
+		{"logs-app-default", "2024-05-01T10:00:00Z", ""},
+		{"logs-other-default", "2024-01-02T03:04:05Z", "p1"},
+		{"logs-app-default", "2020-01-01T00:00:00Z", ""},
+	}
+	for i, w := range want {
+		op := reqs[i].ops[0]
+		pipeline, _ := op.action["pipeline"].(string)
+		if op.op != opCreate || op.action["_index"] != w.index || op.source[timestampField] != w.timestamp || pipeline != w.pipeline {
+			t.Errorf("operation %d = %+v", i, op)
+		}
+	}
+	// The timestamp is added before the other fields
+	if !bytes.Contains(reqs[0].body, []byte(`{"@timestamp":"2024-05-01T10:00:00Z","msg":"a"}`)) {
+		t.Errorf("body = %s", reqs[0].body)
+	}
+}
+
+func TestConflictStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		// conflicts is the number of requests rejected with a conflict
+		conflicts int
+		requests  int
+		wantErr   bool
+	}{
+		{"fail", conflictFail, 1, 1, true},
+		{"ignore", conflictIgnore, 1, 1, false},
+		{"retry", conflictRetry, 2, 3, false},
+		{"retry exhausted", conflictRetry, 10, 4, true},
+		{"overwrite", conflictOverwrite, 1, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, c := newCluster(t)
+			c.status = func(n int, op operation) int {
+				if n <= tt.conflicts {
+					return http.StatusConflict
+				}
+				return http.StatusOK
+			}
+			cfg := &RunnerConfig{
+				URL:                    srv.URL,
+				Index:                  "orders",
+				IDFromMetadataKey:      "id",
+				VersionFromMetadataKey: "version",
+				VersionType:            "external",
+				OnConflict:             tt.strategy,
+				ConflictRetries:        3,
+				ConflictRetryDelay:     time.Millisecond,
+				BatchSize:              1,
+				BatchWait:              time.Second,
+				Timeout:                time.Second,
+			}
+			runner, err := NewRunner(cfg)
+			if err != nil {
+				t.Fatalf("NewRunner() unexpected error = %v", err)
+			}
+			defer func() { _ = runner.Close() }()
+			r := runner.(*ElasticsearchRunner)
+			r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+			r.sleep = func(time.Duration) {}
+
+			err = r.Process(newMessage(`{"n":1}`, map[string]string{"id": "o1", "version": "7"}))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Process() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, errConflict) {
+				t.Errorf("error %v is not a conflict", err)
+			}
+			reqs := c.all()
+			if len(reqs) != tt.requests {
+				t.Fatalf("requests = %d, want %d", len(reqs), tt.requests)
+			}
+			first := reqs[0].ops[0]
+			if first.action["version"] != float64(7) || first.action["version_type"] != "external" {
+				t.Errorf("first operation = %+v", first)
+			}
+			if tt.strategy == conflictOverwrite {
+				last := reqs[len(reqs)-1].ops[0]
+				if last.op != opIndex || last.action["version"] != nil {
+					t.Errorf("overwrite operation = %+v", last)
+				}
+			}
+		})
+	}
+}
+
+func TestConflictRetryOnlyConflicting(t *testing.T) {
+	srv, c := newCluster(t)
+	c.status = func(n int, op operation) int {
+		if n == 1 && op.action["_id"] == "b" {
+			return http.StatusConflict
+		}
+		return http.StatusCreated
+	}
+	cfg := &RunnerConfig{
+		URL:                srv.URL,
+		Index:              "orders",
+		Operation:          opCreate,
+		IDFromMetadataKey:  "id",
+		VersionType:        "external",
+		OnConflict:         conflictRetry,
+		ConflictRetries:    3,
+		ConflictRetryDelay: time.Millisecond,
+		BatchSize:          2,
+		BatchWait:          time.Second,
+		Timeout:            time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*ElasticsearchRunner)
+	r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+	r.sleep = func(time.Duration) {}
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Process(newMessage(`{}`, map[string]string{"id": id})); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	reqs := c.all()
+	if len(reqs) != 2 || len(reqs[1].ops) != 1 || reqs[1].ops[0].action["_id"] != "b" {
+		t.Errorf("requests = %+v", reqs)
+	}
+}
+
+func TestUpdateAndRequireAlias(t *testing.T) {
+	srv, c := newCluster(t)
+	cfg := &RunnerConfig{
+		URL:                srv.URL,
+		Index:              "orders",
+		Operation:          opUpdate,
+		IDFromMetadataKey:  "id",
+		RequireAlias:       true,
+		VersionType:        "external",
+		OnConflict:         conflictFail,
+		ConflictRetries:    3,
+		ConflictRetryDelay: time.Millisecond,
+		BatchSize:          1,
+		BatchWait:          time.Second,
+		Timeout:            time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*ElasticsearchRunner)
+	r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+	r.sleep = func(time.Duration) {}
+	if err := r.Process(newMessage(`{"status":"paid"}`, map[string]string{"id": "o1"})); err != nil {
+		t.Fatal(err)
+	}
+	op := c.all()[0].ops[0]
+	doc, _ := op.source["doc"].(map[string]any)
+	if op.op != opUpdate || op.action["require_alias"] != true || doc["status"] != "paid" || op.source["doc_as_upsert"] != true {
+		t.Errorf("operation = %+v", op)
+	}
+
+	if err := r.Process(newMessage(`{}`, nil)); err == nil || !strings.Contains(err.Error(), "requires the document id") {
+		t.Errorf("update without id error = %v", err)
+	}
+}
+
+func TestBootstrapAlias(t *testing.T) {
+	tests := []struct {
+		name       string
+		aliasFound bool
+		create     int
+		createBody string
+		wantPut    bool
+		wantErr    bool
+	}{
+		{"created", false, http.StatusOK, `{"acknowledged":true}`, true, false},
+		{"exists", true, 0, "", false, false},
+		{"created meanwhile", false, http.StatusBadRequest, `{"error":{"type":"resource_already_exists_exception"}}`, true, false},
+		{"rejected", false, http.StatusForbidden, `{"error":"forbidden"}`, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, c := newCluster(t)
+			c.handler = func(w http.ResponseWriter, req request) bool {
+				switch req.method {
+				case http.MethodGet:
+					if !tt.aliasFound {
+						w.WriteHeader(http.StatusNotFound)
+					}
+				case http.MethodPut:
+					w.WriteHeader(tt.create)
+					_, _ = w.Write([]byte(tt.createBody))
+				}
+				return true
+			}
+			cfg := &RunnerConfig{
+				URL:                srv.URL,
+				Index:              "logs",
+				RequireAlias:       true,
+				BootstrapAlias:     true,
+				VersionType:        "external",
+				OnConflict:         conflictFail,
+				ConflictRetries:    3,
+				ConflictRetryDelay: time.Millisecond,
+				BatchSize:          1,
+				BatchWait:          time.Second,
+				Timeout:            time.Second,
+			}
+			runner, err := NewRunner(cfg)
+			if err != nil {
+				t.Fatalf("NewRunner() unexpected error = %v", err)
+			}
+			defer func() { _ = runner.Close() }()
+			r := runner.(*ElasticsearchRunner)
+			r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+			r.sleep = func(time.Duration) {}
+			err = r.Start(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Start() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			reqs := c.all()
+			if reqs[0].method != http.MethodGet || reqs[0].path != "/_alias/logs" {
+				t.Errorf("first request = %s %s", reqs[0].method, reqs[0].path)
+			}
+			if !tt.wantPut {
+				if len(reqs) != 1 {
+					t.Errorf("requests = %d", len(reqs))
+				}
+				return
+			}
+			put := reqs[1]
+			if put.method != http.MethodPut || put.path != "/logs-000001" ||
+				string(put.body) != `{"aliases":{"logs":{"is_write_index":true}}}` {
+				t.Errorf("create request = %s %s %s", put.method, put.path, put.body)
+			}
+		})
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	srv, c := newCluster(t)
+	c.handler = func(w http.ResponseWriter, req request) bool {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("rejected execution"))
+		return true
+	}
+	cfg := &RunnerConfig{
+		URL:                srv.URL,
+		Index:              "orders",
+		Username:           "u",
+		Password:           "p",
+		VersionType:        "external",
+		OnConflict:         conflictFail,
+		ConflictRetries:    3,
+		ConflictRetryDelay: time.Millisecond,
+		BatchSize:          1,
+		BatchWait:          time.Second,
+		Timeout:            time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*ElasticsearchRunner)
+	r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+	r.sleep = func(time.Duration) {}
+
+	err = r.Process(newMessage(`{"n":1}`, nil))
+	var retryErr *connectors.RetryAfterError
+	if !errors.As(err, &retryErr) || retryErr.Delay != 3*time.Second || !strings.Contains(err.Error(), "rejected execution") {
+		t.Errorf("Process() error = %v", err)
+	}
+	if user, pass, ok := (&http.Request{Header: c.all()[0].header}).BasicAuth(); !ok || user != "u" || pass != "p" {
+		t.Errorf("basic auth = %s %s %v", user, pass, ok)
+	}
+
+	for _, data := range []string{`{`, `[1]`, `"text"`} {
+		if err := r.Process(newMessage(data, nil)); err == nil {
+			t.Errorf("Process(%s) expected error", data)
+		}
+	}
+}
+
+func TestAsyncAndDrain(t *testing.T) {
+	srv, c := newCluster(t)
+	cfg := &RunnerConfig{
+		URL:                srv.URL,
+		Index:              "orders",
+		Async:              true,
+		VersionType:        "external",
+		OnConflict:         conflictFail,
+		ConflictRetries:    3,
+		ConflictRetryDelay: time.Millisecond,
+		BatchSize:          10,
+		BatchWait:          time.Hour,
+		Timeout:            time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*ElasticsearchRunner)
+	r.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+	r.sleep = func(time.Duration) {}
+	for range 3 {
+		if err := r.Process(newMessage(`{}`, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.all()) != 0 {
+		t.Fatal("batch sent before being full")
+	}
+	if err := r.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if reqs := c.all(); len(reqs) != 1 || len(reqs[0].ops) != 3 {
+		t.Errorf("requests = %+v", reqs)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	for name, opts := range map[string]map[string]any{
+		"missing index":          {"url": "http://es:9200"},
+		"data stream operation":  {"url": "http://es:9200", "index": "logs", "dataStream": true, "operation": "index"},
+		"data stream overwrite":  {"url": "http://es:9200", "index": "logs", "dataStream": true, "onConflict": "overwrite"},
+		"data stream bootstrap":  {"url": "http://es:9200", "index": "logs", "dataStream": true, "bootstrapAlias": true},
+		"bootstrap without name": {"url": "http://es:9200", "indexFromMetadataKey": "index", "bootstrapAlias": true},
+		"update version":         {"url": "http://es:9200", "index": "o", "operation": "update", "versionFromMetadataKey": "v"},
+		"update pipeline":        {"url": "http://es:9200", "index": "o", "operation": "update", "pipeline": "p"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := new(RunnerConfig)
+			if err := utils.ParseConfig(opts, cfg); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewRunner(cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(map[string]any{"url": "http://es:9200", "index": "o", "onConflict": "merge"}, cfg); err == nil {
+		t.Error("invalid onConflict accepted")
+	}
+}
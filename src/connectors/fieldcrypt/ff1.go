@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// ff1Rounds is the number of Feistel rounds of FF1
+	ff1Rounds = 10
+	// ff1MinDomain is the minimum domain size (radix^length) of FF1 inputs
+	ff1MinDomain = 1_000_000
+)
+
+// ff1 is the FF1 format-preserving cipher of NIST SP 800-38G: numeral strings of a radix are
+// encrypted to numeral strings of the same radix and length.
+type ff1 struct {
+	block cipher.Block
+	radix int
+}
+
+func newFF1(key []byte, radix int) (*ff1, error) {
+	if radix < 2 || radix > 1<<16 {
+		return nil, fmt.Errorf("invalid FF1 radix %d", radix)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &ff1{block: block, radix: radix}, nil
+}
+
+// encrypt returns the encryption of the numeral string x under the tweak
+func (f *ff1) encrypt(x []uint16, tweak []byte) ([]uint16, error) {
+	return f.cipher(x, tweak, true)
+}
+
+// decrypt returns the decryption of the numeral string x under the tweak
+func (f *ff1) decrypt(x []uint16, tweak []byte) ([]uint16, error) {
+	return f.cipher(x, tweak, false)
+}
+
+func (f *ff1) cipher(x []uint16, tweak []byte, encrypt bool) ([]uint16, error) {
+	n := len(x)
+	radix := big.NewInt(int64(f.radix))
+	domain := new(big.Int).Exp(radix, big.NewInt(int64(n)), nil)
+	if n < 2 || domain.Cmp(big.NewInt(ff1MinDomain)) < 0 {
+		return nil, fmt.Errorf("value too short for format-preserving encryption: %d characters", n)
+	}
+
+	u := n / 2
+	v := n - u
+	a := append([]uint16(nil), x[:u]...)
+	b := append([]uint16(nil), x[u:]...)
+
+	// b bytes hold the numbers of v numerals, d bytes the round output
+	maxV := new(big.Int).Exp(radix, big.NewInt(int64(v)), nil)
+	bLen := (maxV.Sub(maxV, big.NewInt(1)).BitLen() + 7) / 8
+	dLen := 4*((bLen+3)/4) + 4
+
+	p := make([]byte, aes.BlockSize)
+	p[0], p[1], p[2] = 1, 2, 1
+	p[3] = byte(f.radix >> 16)
+	p[4] = byte(f.radix >> 8)
+	p[5] = byte(f.radix)
+	p[6] = ff1Rounds
+	p[7] = byte(u % 256)
+	binary.BigEndian.PutUint32(p[8:], uint32(n))
+	binary.BigEndian.PutUint32(p[12:], uint32(len(tweak)))
+
+	pad := (16 - (len(tweak)+bLen+1)%16) % 16
+	q := make([]byte, len(tweak)+pad+1+bLen)
+	copy(q, tweak)
+
+	modU := new(big.Int).Exp(radix, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(radix, big.NewInt(int64(v)), nil)
+
+	for k := 0; k < ff1Rounds; k++ {
+		i := k
+		if !encrypt {
+			i = ff1Rounds - 1 - k
+		}
+		m, mod := u, modU
+		if i%2 == 1 {
+			m, mod = v, modV
+		}
+
+		// The round function reads B when encrypting and A when decrypting
+		in := b
+		if !encrypt {
+			in = a
+		}
+		q[len(tweak)+pad] = byte(i)
+		clear(q[len(q)-bLen:])
+		f.num(in).FillBytes(q[len(q)-bLen:])
+		y := new(big.Int).SetBytes(f.roundOutput(p, q, dLen))
+
+		if encrypt {
+			c := f.num(a)
+			c.Add(c, y).Mod(c, mod)
+			a, b = b, f.str(c, m)
+		} else {
+			c := f.num(b)
+			c.Sub(c, y).Mod(c, mod)
+			a, b = f.str(c, m), a
+		}
+	}
+	return append(a, b...), nil
+}
+
+// roundOutput returns the first d bytes of R || CIPH(R ^ [1]) || CIPH(R ^ [2]) ...,
+// where R is the CBC-MAC of P || Q
+func (f *ff1) roundOutput(p, q []byte, d int) []byte {
+	r := make([]byte, aes.BlockSize)
+	for _, data := range [][]byte{p, q} {
+		for j := 0; j < len(data); j += aes.BlockSize {
+			for k := range aes.BlockSize {
+				r[k] ^= data[j+k]
+			}
+			f.block.Encrypt(r, r)
+		}
+	}
+
+	s := append([]byte(nil), r...)
+	for j := uint64(1); len(s) < d; j++ {
+		block := append([]byte(nil), r...)
+		var counter [8]byte
+		binary.BigEndian.PutUint64(counter[:], j)
+		for k := range counter {
+			block[aes.BlockSize-8+k] ^= counter[k]
+		}
+		f.block.Encrypt(block, block)
+		s = append(s, block...)
+	}
+	return s[:d]
+}
+
+// num returns the number represented by the numeral string, most significant numeral first
+func (f *ff1) num(x []uint16) *big.Int {
+	radix := big.NewInt(int64(f.radix))
+	res := new(big.Int)
+	for _, d := range x {
+		res.Mul(res, radix)
+		res.Add(res, big.NewInt(int64(d)))
+	}
+	return res
+}
+
+// str returns the numeral string of m numerals representing x
+func (f *ff1) str(x *big.Int, m int) []uint16 {
+	radix := big.NewInt(int64(f.radix))
+	res := make([]uint16, m)
+	x = new(big.Int).Set(x)
+	d := new(big.Int)
+	for i := m - 1; i >= 0; i-- {
+		x.DivMod(x, radix, d)
+		res[i] = uint16(d.Uint64())
+	}
+	return res
+}
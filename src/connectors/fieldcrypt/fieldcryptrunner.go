@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+
+	"github.com/sandrolain/events-bridge/src/common/jsonpath"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure FieldCryptRunner implements connectors.Runner
+var _ connectors.Runner = &FieldCryptRunner{}
+
+const (
+	modeEncrypt = "encrypt"
+	modeDecrypt = "decrypt"
+
+	algorithmAESGCM = "aes-gcm"
+	algorithmFPE    = "fpe"
+
+	// defaultAlphabet is the FPE alphabet of the fields that don't set one
+	defaultAlphabet = "0123456789"
+)
+
+// Field is a payload field encrypted by the runner
+type Field struct {
+	// Path is the dotted path of the field (e.g. "card.number")
+	Path string `mapstructure:"path" validate:"required"`
+	// Algorithm is "aes-gcm" (default), replacing the value with a base64 token, or "fpe",
+	// encrypting a string with FF1 so that it keeps its length and format
+	Algorithm string `mapstructure:"algorithm" validate:"omitempty,oneof=aes-gcm fpe"`
+	// Alphabet is the set of characters encrypted by "fpe" (default: digits); the other
+	// characters, e.g. the dashes of a card number, are left in place
+	Alphabet string `mapstructure:"alphabet"`
+}
+
+type RunnerConfig struct {
+	// Mode is "encrypt" or "decrypt"
+	Mode string `mapstructure:"mode" validate:"required,oneof=encrypt decrypt"`
+	// Fields are the encrypted fields; missing and null fields are skipped
+	Fields []Field `mapstructure:"fields" validate:"required,min=1,dive"`
+	// Keys maps the key ids to base64 AES keys of 16, 24 or 32 bytes; supports env: and file: secrets
+	Keys map[string]string `mapstructure:"keys" validate:"required,min=1"`
+	// KeyID is the id of the key encrypting the fields, and of the key decrypting the messages
+	// without key id metadata
+	KeyID string `mapstructure:"keyId" validate:"required_if=Mode encrypt"`
+	// KeyIDKey is the metadata key recording the id of the key of the encrypted fields
+	KeyIDKey string `mapstructure:"keyIdKey" default:"eb-fieldcrypt-key" validate:"required"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+// fieldCipher encrypts the fields with a key
+type fieldCipher struct {
+	gcm cipher.AEAD
+	key []byte
+}
+
+type FieldCryptRunner struct {
+	cfg     *RunnerConfig
+	ciphers map[string]*fieldCipher
+	// fpe holds the FF1 ciphers by key id and alphabet
+	fpe  map[string]*ff1
+	slog *slog.Logger
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a new instance of FieldCryptRunner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	r := &FieldCryptRunner{
+		cfg:     cfg,
+		ciphers: make(map[string]*fieldCipher, len(cfg.Keys)),
+		fpe:     map[string]*ff1{},
+		slog:    slog.Default().With("context", "FieldCrypt Runner"),
+	}
+	for id, value := range cfg.Keys {
+		c, err := newFieldCipher(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", id, err)
+		}
+		r.ciphers[id] = c
+	}
+	if cfg.KeyID != "" && r.ciphers[cfg.KeyID] == nil {
+		return nil, fmt.Errorf("unknown key id %q", cfg.KeyID)
+	}
+
+	for i := range cfg.Fields {
+		f := &cfg.Fields[i]
+		if f.Algorithm == "" {
+			f.Algorithm = algorithmAESGCM
+		}
+		if f.Algorithm != algorithmFPE {
+			continue
+		}
+		if f.Alphabet == "" {
+			f.Alphabet = defaultAlphabet
+		}
+		if err := checkAlphabet(f.Alphabet); err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Path, err)
+		}
+		for id, c := range r.ciphers {
+			if _, ok := r.fpe[id+"/"+f.Alphabet]; ok {
+				continue
+			}
+			fc, err := newFF1(c.key, len([]rune(f.Alphabet)))
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Path, err)
+			}
+			r.fpe[id+"/"+f.Alphabet] = fc
+		}
+	}
+
+	r.slog.Info("field encryption ready", "mode", cfg.Mode, "fields", len(cfg.Fields), "keys", len(cfg.Keys), "keyId", cfg.KeyID)
+	return r, nil
+}
+
+func newFieldCipher(value string) (*fieldCipher, error) {
+	resolved, err := secrets.Resolve(value)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(resolved))
+	if err != nil {
+		return nil, fmt.Errorf("key must be base64 encoded: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &fieldCipher{gcm: gcm, key: key}, nil
+}
+
+// checkAlphabet checks that the FPE alphabet has at least two distinct characters
+func checkAlphabet(alphabet string) error {
+	seen := map[rune]bool{}
+	for _, c := range alphabet {
+		if seen[c] {
+			return fmt.Errorf("duplicate character %q in alphabet", c)
+		}
+		seen[c] = true
+	}
+	if len(seen) < 2 {
+		return fmt.Errorf("alphabet must have at least 2 characters")
+	}
+	return nil
+}
+
+// Process encrypts or decrypts the configured fields of the JSON payload. Encrypting records
+// the key id in metadata; decrypting uses the key id of the metadata, or the configured one.
+func (r *FieldCryptRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+	if len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds max input size %d", len(data), r.cfg.MaxInputSize)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return fmt.Errorf("payload must be a JSON object: %w", err)
+	}
+
+	keyID := r.cfg.KeyID
+	if r.cfg.Mode == modeDecrypt && meta[r.cfg.KeyIDKey] != "" {
+		keyID = meta[r.cfg.KeyIDKey]
+	}
+	c, ok := r.ciphers[keyID]
+	if !ok {
+		return fmt.Errorf("unknown key id %q", keyID)
+	}
+
+	for _, f := range r.cfg.Fields {
+		value, ok := jsonpath.Get(payload, f.Path)
+		if !ok || value == nil {
+			continue
+		}
+		var res any
+		if r.cfg.Mode == modeEncrypt {
+			res, err = r.encrypt(c, keyID, f, value)
+		} else {
+			res, err = r.decrypt(c, keyID, f, value)
+		}
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Path, err)
+		}
+		if !jsonpath.Set(payload, f.Path, res) {
+			return fmt.Errorf("field %s: path is not in an object", f.Path)
+		}
+	}
+
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	msg.SetData(out)
+	if r.cfg.Mode == modeEncrypt {
+		meta = maps.Clone(meta)
+		if meta == nil {
+			meta = map[string]string{}
+		}
+		meta[r.cfg.KeyIDKey] = keyID
+		msg.SetMetadata(meta)
+	}
+	return nil
+}
+
+// encrypt returns the encrypted value of a field. The field path is authenticated (AES-GCM)
+// or used as tweak (FPE), so that encrypted values cannot be moved between fields.
+func (r *FieldCryptRunner) encrypt(c *fieldCipher, keyID string, f Field, value any) (any, error) {
+	if f.Algorithm == algorithmFPE {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("format-preserving encryption requires a string, got %T", value)
+		}
+		return r.fpeApply(keyID, f, s, true)
+	}
+
+	plain, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, c.gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := c.gcm.Seal(nonce, nonce, plain, []byte(f.Path))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt returns the decrypted value of a field
+func (r *FieldCryptRunner) decrypt(c *fieldCipher, keyID string, f Field, value any) (any, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("encrypted value must be a string, got %T", value)
+	}
+	if f.Algorithm == algorithmFPE {
+		return r.fpeApply(keyID, f, s, false)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	size := c.gcm.NonceSize()
+	if len(sealed) < size {
+		return nil, fmt.Errorf("invalid encrypted value: too short")
+	}
+	plain, err := c.gcm.Open(nil, sealed[:size], sealed[size:], []byte(f.Path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	var res any
+	if err := json.Unmarshal(plain, &res); err != nil {
+		return nil, fmt.Errorf("invalid decrypted value: %w", err)
+	}
+	return res, nil
+}
+
+// fpeApply encrypts or decrypts the characters of the string in the field alphabet,
+// leaving the other characters in place
+func (r *FieldCryptRunner) fpeApply(keyID string, f Field, s string, encrypt bool) (string, error) {
+	alphabet := []rune(f.Alphabet)
+	index := make(map[rune]uint16, len(alphabet))
+	for i, c := range alphabet {
+		index[c] = uint16(i)
+	}
+
+	chars := []rune(s)
+	var positions []int
+	var numerals []uint16
+	for i, c := range chars {
+		if n, ok := index[c]; ok {
+			positions = append(positions, i)
+			numerals = append(numerals, n)
+		}
+	}
+
+	fc := r.fpe[keyID+"/"+f.Alphabet]
+	var res []uint16
+	var err error
+	if encrypt {
+		res, err = fc.encrypt(numerals, []byte(f.Path))
+	} else {
+		res, err = fc.decrypt(numerals, []byte(f.Path))
+	}
+	if err != nil {
+		return "", err
+	}
+	for i, pos := range positions {
+		chars[pos] = alphabet[res[i]]
+	}
+	return string(chars), nil
+}
+
+func (r *FieldCryptRunner) Close() error {
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+var (
+	testKeyA = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	testKeyB = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210"))
+)
+
+func TestFF1Vectors(t *testing.T) {
+	// NIST SP 800-38G FF1 samples 1 and 2
+	key, _ := hex.DecodeString("2B7E151628AED2A6ABF7158809CF4F3C")
+	f, err := newFF1(key, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []uint16{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	for _, tc := range []struct {
+		tweak string
+		want  string
+	}{
+		{"", "2433477484"},
+		{"39383736353433323130", "6124200773"},
+	} {
+		tweak, _ := hex.DecodeString(tc.tweak)
+		enc, err := f.encrypt(plain, tweak)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got strings.Builder
+		for _, d := range enc {
+			got.WriteByte(byte('0' + d))
+		}
+		if got.String() != tc.want {
+			t.Errorf("tweak %q: ciphertext = %s, want %s", tc.tweak, got.String(), tc.want)
+		}
+		dec, err := f.decrypt(enc, tweak)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range plain {
+			if dec[i] != plain[i] {
+				t.Fatalf("tweak %q: decrypted = %v", tc.tweak, dec)
+			}
+		}
+	}
+}
+
+// encrypt runs the payload through the runner, returning the output payload and metadata
+func encrypt(t *testing.T, r connectors.Runner, data string, meta map[string]string) ([]byte, map[string]string) {
+	t.Helper()
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(data), meta))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	outMeta, out, err := msg.GetMetadataAndData()
+	if err != nil {
+		t.Fatalf("failed to get message: %v", err)
+	}
+	return out, outMeta
+}
+
+func TestFieldCryptRoundTrip(t *testing.T) {
+	fields := []Field{
+		{Path: "card", Algorithm: algorithmFPE},
+		{Path: "customer.name"},
+		{Path: "customer.address"},
+		{Path: "missing"},
+	}
+	keys := map[string]string{"k1": testKeyA, "k2": testKeyB}
+	enc, err := NewRunner(&RunnerConfig{Mode: modeEncrypt, Fields: fields, Keys: keys, KeyID: "k2", KeyIDKey: "eb-fieldcrypt-key", MaxInputSize: 1024})
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	dec, err := NewRunner(&RunnerConfig{Mode: modeDecrypt, Fields: fields, Keys: keys, KeyIDKey: "eb-fieldcrypt-key", MaxInputSize: 1024})
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+
+	in := `{"card":"4111-1111-1111-1111","customer":{"name":"Ada","address":{"city":"London"}},"amount":42}`
+	data, meta := encrypt(t, enc, in, map[string]string{"source": "pos"})
+	if meta["eb-fieldcrypt-key"] != "k2" || meta["source"] != "pos" {
+		t.Errorf("metadata = %v", meta)
+	}
+	var encrypted map[string]any
+	if err := json.Unmarshal(data, &encrypted); err != nil {
+		t.Fatalf("invalid output payload: %v", err)
+	}
+	card := encrypted["card"].(string)
+	if card == "4111-1111-1111-1111" || len(card) != 19 || strings.Count(card, "-") != 3 || card[4] != '-' {
+		t.Errorf("card not format-preserved: %s", card)
+	}
+	if name, _ := encrypted["customer"].(map[string]any)["name"].(string); name == "" || name == "Ada" {
+		t.Errorf("name not encrypted: %v", encrypted["customer"])
+	}
+	if encrypted["amount"] != float64(42) {
+		t.Errorf("untouched field changed: %v", encrypted["amount"])
+	}
+
+	out, _ := encrypt(t, dec, string(data), meta)
+	var got, want any
+	_ = json.Unmarshal(out, &got)
+	_ = json.Unmarshal([]byte(in), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decrypted = %s, want %s", out, in)
+	}
+}
+
+func TestFieldCryptErrors(t *testing.T) {
+	keys := map[string]string{"k1": testKeyA}
+	enc, err := NewRunner(&RunnerConfig{Mode: modeEncrypt, Fields: []Field{{Path: "a"}}, Keys: keys, KeyID: "k1", KeyIDKey: "eb-fieldcrypt-key", MaxInputSize: 1024})
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	encrypted, _ := encrypt(t, enc, `{"a":"secret"}`, nil)
+
+	tests := []struct {
+		name string
+		cfg  *RunnerConfig
+		data string
+		meta map[string]string
+	}{
+		{
+			name: "value moved to another field",
+			cfg:  &RunnerConfig{Mode: modeDecrypt, Fields: []Field{{Path: "b"}}, Keys: keys, KeyIDKey: "eb-fieldcrypt-key", MaxInputSize: 1024},
+			data: strings.Replace(string(encrypted), `"a"`, `"b"`, 1),
+		},
+		{
+			name: "unknown key id in metadata",
+			cfg:  &RunnerConfig{Mode: modeDecrypt, Fields: []Field{{Path: "a"}}, Keys: keys, KeyIDKey: "eb-fieldcrypt-key", MaxInputSize: 1024},
+			data: string(encrypted),
+			meta: map[string]string{"eb-fieldcrypt-key": "old"},
+		},
+		{
+			name: "too short for FPE",
+			cfg:  &RunnerConfig{Mode: modeEncrypt, Fields: []Field{{Path: "pin", Algorithm: algorithmFPE}}, Keys: keys, KeyID: "k1", KeyIDKey: "eb-fieldcrypt-key", MaxInputSize: 1024},
+			data: `{"pin":"1234"}`,
+		},
+		{
+			// A field in an array is not left in clear
+			name: "field in an array",
+			cfg:  &RunnerConfig{Mode: modeEncrypt, Fields: []Field{{Path: "cards.0"}}, Keys: keys, KeyID: "k1", KeyIDKey: "eb-fieldcrypt-key", MaxInputSize: 1024},
+			data: `{"cards":["4111"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRunner(tt.cfg)
+			if err != nil {
+				t.Fatalf("failed to create runner: %v", err)
+			}
+			if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(tt.data), tt.meta))); err == nil {
+				t.Error("expected process error")
+			}
+		})
+	}
+
+	for _, opts := range []map[string]any{
+		{"mode": "encrypt", "fields": []any{map[string]any{"path": "a"}}, "keys": keys},
+		{"mode": "encrypt", "fields": []any{map[string]any{"path": "a"}}, "keys": keys, "keyId": "nope"},
+		{"mode": "decrypt", "fields": []any{map[string]any{"path": "a"}}, "keys": map[string]any{"k": "c2hvcnQ="}},
+		{"mode": "decrypt", "fields": []any{map[string]any{"path": "a", "algorithm": "fpe", "alphabet": "aa"}}, "keys": keys},
+	} {
+		cfg := new(RunnerConfig)
+		if err := utils.ParseConfig(opts, cfg); err != nil {
+			continue
+		}
+		if _, err := NewRunner(cfg); err == nil {
+			t.Errorf("expected error for %v", opts)
+		}
+	}
+}
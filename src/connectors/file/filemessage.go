@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/sandrolain/events-bridge/src/common/checkpoint"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &FileMessage{}
+
+// FileMessage is a line of a file; its ack or nak marks the offset as processed
+type FileMessage struct {
+	path     string
+	offset   int64
+	data     []byte
+	position *checkpoint.Position
+}
+
+// newFileMessage decodes a line according to the mode of the source
+func newFileMessage(t *tailer, l line, cfg *SourceConfig) (*FileMessage, error) {
+	data := l.data
+	switch cfg.Mode {
+	case modeNDJSON:
+		if !json.Valid(data) {
+			return nil, errors.New("invalid JSON")
+		}
+	case modeCSV:
+		record, err := parseCSV(data, cfg.CSV.Delimiter)
+		if err != nil {
+			return nil, err
+		}
+		columns := cfg.CSV.Columns
+		if cfg.CSV.Header {
+			columns = t.header
+		}
+		if data, err = csvJSON(record, columns); err != nil {
+			return nil, err
+		}
+	}
+	return &FileMessage{path: t.path, offset: l.offset, data: data, position: l.position}, nil
+}
+
+// parseCSV parses the record of a csv line
+func parseCSV(data []byte, delimiter string) ([]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = rune(delimiter[0])
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	record, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv record: %w", err)
+	}
+	return record, nil
+}
+
+// csvJSON returns the JSON object of a record by column name, or the JSON array of the
+// record without columns. The fields beyond the columns are named by position
+// ("column4"), the missing fields are omitted.
+func csvJSON(record, columns []string) ([]byte, error) {
+	if len(columns) == 0 {
+		return json.Marshal(record)
+	}
+	obj := make(map[string]string, len(record))
+	for i, value := range record {
+		name := "column" + strconv.Itoa(i+1)
+		if i < len(columns) {
+			name = columns[i]
+		}
+		obj[name] = value
+	}
+	return json.Marshal(obj)
+}
+
+func (m *FileMessage) GetID() []byte {
+	return []byte(m.path + ":" + strconv.FormatInt(m.offset, 10))
+}
+
+func (m *FileMessage) GetMetadata() (map[string]string, error) {
+	return map[string]string{
+		"path":   m.path,
+		"file":   filepath.Base(m.path),
+		"offset": strconv.FormatInt(m.offset, 10),
+	}, nil
+}
+
+func (m *FileMessage) GetData() ([]byte, error) {
+	return m.data, nil
+}
+
+func (m *FileMessage) Ack(data *message.ReplyData) error {
+	// Files don't support reply
+	m.position.Done()
+	return nil
+}
+
+// Nak marks the offset as processed too: a failed line must not block the checkpoint of
+// the following ones
+func (m *FileMessage) Nak() error {
+	m.position.Done()
+	return nil
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/tmplfuncs"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure FileRunner implements connectors.Runner
+var _ connectors.Runner = &FileRunner{}
+
+// rotatedSuffix is the time layout of the suffix of the rotated files
+const rotatedSuffix = "20060102T150405.000000000"
+
+type RunnerConfig struct {
+	// Path is the Go template (with sprig functions) of the file the payload is appended
+	// to, executed for every message with "metadata" and "time" (the current time), e.g.
+	// /var/log/events/{{ .metadata.service }}/{{ date "2006-01-02" .time }}.log
+	Path string `mapstructure:"path" validate:"required"`
+	// Root confines the files to a directory: relative paths are resolved in it and the
+	// paths outside of it are rejected (recommended when the path depends on metadata)
+	Root string `mapstructure:"root"`
+	// Separator is written after every payload, e.g. for NDJSON
+	Separator string `mapstructure:"separator" default:"\n"`
+	// MaxSize rotates a file when the payload would make it larger, in bytes (0 = never):
+	// the file is renamed with the time of the rotation as suffix (app.log.20240102T150405.000000000)
+	MaxSize int64 `mapstructure:"maxSize" default:"0" validate:"min=0"`
+	// MaxBackups is the number of rotated files kept per file, the oldest are removed (0 = all)
+	MaxBackups int `mapstructure:"maxBackups" default:"0" validate:"min=0"`
+	// FileMode is the octal permission of the created files
+	FileMode string `mapstructure:"fileMode" default:"0644" validate:"required"`
+	// DirMode is the octal permission of the created directories
+	DirMode string `mapstructure:"dirMode" default:"0755" validate:"required"`
+	// Sync flushes every write to the disk (fsync), slower but surviving a host crash
+	Sync bool `mapstructure:"sync" default:"false"`
+	// MaxOpenFiles bounds the open files, the least recently written are closed
+	MaxOpenFiles int `mapstructure:"maxOpenFiles" default:"64" validate:"min=1"`
+	// PathMetadataKey is the metadata key set to the path of the file of the message
+	PathMetadataKey string `mapstructure:"pathMetadataKey" default:"eb-file-path"`
+}
+
+// openFile is a file open for appending
+type openFile struct {
+	path string
+	f    *os.File
+	size int64
+}
+
+// FileRunner appends the payloads to files with templated paths, rotating them by size
+type FileRunner struct {
+	cfg      *RunnerConfig
+	slog     *slog.Logger
+	path     *template.Template
+	root     string
+	fileMode os.FileMode
+	dirMode  os.FileMode
+	now      func() time.Time
+	mu       sync.Mutex
+	files    map[string]*list.Element
+	order    *list.List
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a file runner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	tmpl, err := template.New("path").Option("missingkey=zero").Funcs(tmplfuncs.FuncMap()).Parse(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path template: %w", err)
+	}
+	fileMode, err := parseMode(cfg.FileMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fileMode: %w", err)
+	}
+	dirMode, err := parseMode(cfg.DirMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dirMode: %w", err)
+	}
+	root := ""
+	if cfg.Root != "" {
+		if root, err = filepath.Abs(cfg.Root); err != nil {
+			return nil, fmt.Errorf("invalid root: %w", err)
+		}
+	}
+
+	return &FileRunner{
+		cfg:      cfg,
+		slog:     slog.Default().With("context", "File Runner"),
+		path:     tmpl,
+		root:     root,
+		fileMode: fileMode,
+		dirMode:  dirMode,
+		now:      time.Now,
+		files:    map[string]*list.Element{},
+		order:    list.New(),
+	}, nil
+}
+
+func parseMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("expected an octal permission, got %q", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// Process appends the payload to its file
+func (r *FileRunner) Process(msg *message.RunnerMessage) error {
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	path, err := r.resolvePath(metadata)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	of, err := r.open(path)
+	if err != nil {
+		return err
+	}
+	size := int64(len(data) + len(r.cfg.Separator))
+	if r.cfg.MaxSize > 0 && of.size > 0 && of.size+size > r.cfg.MaxSize {
+		if of, err = r.rotate(of); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, 0, size)
+	buf = append(append(buf, data...), r.cfg.Separator...)
+	n, err := of.f.Write(buf)
+	of.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if r.cfg.Sync {
+		if err := of.f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync %s: %w", path, err)
+		}
+	}
+
+	if r.cfg.PathMetadataKey != "" {
+		msg.AddMetadata(r.cfg.PathMetadataKey, path)
+	}
+	return nil
+}
+
+// resolvePath executes the path template, confining the path to the root
+func (r *FileRunner) resolvePath(metadata map[string]string) (string, error) {
+	var b strings.Builder
+	if err := r.path.Execute(&b, map[string]any{"metadata": metadata, "time": r.now()}); err != nil {
+		return "", fmt.Errorf("failed to execute path template: %w", err)
+	}
+	path := strings.TrimSpace(b.String())
+	if path == "" {
+		return "", errors.New("empty file path")
+	}
+	if r.root == "" {
+		return filepath.Clean(path), nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.root, path)
+	}
+	path = filepath.Clean(path)
+	if rel, err := filepath.Rel(r.root, path); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file path %s is outside of the root %s", path, r.root)
+	}
+	return path, nil
+}
+
+// open returns the open file of the path, opening it and closing the least recently
+// written file beyond MaxOpenFiles
+func (r *FileRunner) open(path string) (*openFile, error) {
+	if el, ok := r.files[path]; ok {
+		r.order.MoveToFront(el)
+		return el.Value.(*openFile), nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), r.dirMode); err != nil {
+		return nil, fmt.Errorf("failed to create directory of %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, r.fileMode) //nolint:gosec // path confined to the root when configured
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close() //nolint:errcheck
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	of := &openFile{path: path, f: f, size: info.Size()}
+	r.files[path] = r.order.PushFront(of)
+	for r.order.Len() > r.cfg.MaxOpenFiles {
+		r.closeFile(r.order.Back())
+	}
+	return of, nil
+}
+
+func (r *FileRunner) closeFile(el *list.Element) {
+	of := el.Value.(*openFile)
+	r.order.Remove(el)
+	delete(r.files, of.path)
+	if err := of.f.Close(); err != nil {
+		r.slog.Warn("failed to close file", "path", of.path, "error", err)
+	}
+}
+
+// rotate renames the file with the rotation time as suffix, removes the oldest rotated
+// files beyond MaxBackups and opens a new file
+func (r *FileRunner) rotate(of *openFile) (*openFile, error) {
+	r.closeFile(r.files[of.path])
+	rotated := of.path + "." + r.now().UTC().Format(rotatedSuffix)
+	if err := os.Rename(of.path, rotated); err != nil {
+		return nil, fmt.Errorf("failed to rotate %s: %w", of.path, err)
+	}
+	r.slog.Debug("file rotated", "path", of.path, "rotated", rotated)
+	if r.cfg.MaxBackups > 0 {
+		r.prune(of.path)
+	}
+	return r.open(of.path)
+}
+
+// prune removes the oldest rotated files of the path beyond MaxBackups
+func (r *FileRunner) prune(path string) {
+	matches, err := filepath.Glob(escapeGlob(path) + ".*")
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, m := range matches {
+		if _, err := time.Parse(rotatedSuffix, strings.TrimPrefix(m, path+".")); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	// The suffixes sort by time
+	sort.Strings(backups)
+	for len(backups) > r.cfg.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			r.slog.Warn("failed to remove rotated file", "path", backups[0], "error", err)
+		}
+		backups = backups[1:]
+	}
+}
+
+// escapeGlob escapes the glob characters of a path
+func escapeGlob(path string) string {
+	var b strings.Builder
+	for _, c := range path {
+		if strings.ContainsRune(`*?[`, c) {
+			b.WriteByte('[')
+			b.WriteRune(c)
+			b.WriteByte(']')
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Close closes the open files
+func (r *FileRunner) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for el := r.order.Front(); el != nil; el = r.order.Front() {
+		of := el.Value.(*openFile)
+		r.order.Remove(el)
+		delete(r.files, of.path)
+		errs = append(errs, of.f.Close())
+	}
+	return errors.Join(errs...)
+}
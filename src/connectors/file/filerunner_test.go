@@ -0,0 +1,197 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func newMessage(data string, meta map[string]string) *message.RunnerMessage {
+	return message.NewRunnerMessage(testutil.NewAdapter([]byte(data), meta))
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRunnerConfigValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *RunnerConfig
+	}{
+		{"invalid path template", &RunnerConfig{Path: "{{ .metadata.service", FileMode: "0644", DirMode: "0755", MaxOpenFiles: 1}},
+		{"invalid file mode", &RunnerConfig{Path: "out.log", FileMode: "rw-r--r--", DirMode: "0755", MaxOpenFiles: 1}},
+		{"invalid dir mode", &RunnerConfig{Path: "out.log", FileMode: "0644", DirMode: "1777", MaxOpenFiles: 1}},
+	}
+	for _, tt := range tests {
+		if _, err := NewRunner(tt.cfg); err == nil {
+			t.Errorf("%s: NewRunner() expected error", tt.name)
+		}
+	}
+	if err := utils.ParseConfig(map[string]any{}, new(RunnerConfig)); err == nil {
+		t.Error("ParseConfig() expected missing path error")
+	}
+}
+
+func TestFileRunnerAppend(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &RunnerConfig{
+		Path:            filepath.Join(dir, `{{ .metadata.service }}/{{ date "2006-01-02" .time }}.ndjson`),
+		Separator:       "\n",
+		FileMode:        "0644",
+		DirMode:         "0755",
+		MaxOpenFiles:    64,
+		PathMetadataKey: "eb-file-path",
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*FileRunner)
+	r.now = func() time.Time { return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC) }
+
+	msgs := []*message.RunnerMessage{
+		newMessage(`{"n":1}`, map[string]string{"service": "api"}),
+		newMessage(`{"n":2}`, map[string]string{"service": "web"}),
+		newMessage(`{"n":3}`, map[string]string{"service": "api"}),
+	}
+	for _, msg := range msgs {
+		if err := r.Process(msg); err != nil {
+			t.Fatalf("Process() unexpected error = %v", err)
+		}
+	}
+
+	api := filepath.Join(dir, "api", "2024-05-06.ndjson")
+	if got := readFile(t, api); got != "{\"n\":1}\n{\"n\":3}\n" {
+		t.Errorf("api file = %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "web", "2024-05-06.ndjson")); got != "{\"n\":2}\n" {
+		t.Errorf("web file = %q", got)
+	}
+	meta, _ := msgs[0].GetMetadata()
+	if meta["eb-file-path"] != api {
+		t.Errorf("path metadata = %q", meta["eb-file-path"])
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(api)
+		if err != nil || info.Mode().Perm() != 0o644 {
+			t.Errorf("file mode = %v, %v", info.Mode(), err)
+		}
+	}
+}
+
+func TestFileRunnerRoot(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &RunnerConfig{
+		Path:            "{{ .metadata.name }}.log",
+		Root:            dir,
+		Separator:       "\n",
+		FileMode:        "0644",
+		DirMode:         "0755",
+		MaxOpenFiles:    64,
+		PathMetadataKey: "eb-file-path",
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	if err := r.Process(newMessage("ok", map[string]string{"name": "sub/app"})); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if got := readFile(t, filepath.Join(dir, "sub", "app.log")); got != "ok\n" {
+		t.Errorf("file = %q", got)
+	}
+	for _, name := range []string{"../escape", "/etc/passwd"} {
+		if err := r.Process(newMessage("x", map[string]string{"name": name})); err == nil || !strings.Contains(err.Error(), "outside of the root") {
+			t.Errorf("Process(%s) error = %v, want outside of the root", name, err)
+		}
+	}
+}
+
+func TestFileRunnerRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.log")
+	cfg := &RunnerConfig{
+		Path:            path,
+		MaxSize:         10,
+		MaxBackups:      2,
+		Separator:       "\n",
+		FileMode:        "0644",
+		DirMode:         "0755",
+		MaxOpenFiles:    64,
+		PathMetadataKey: "eb-file-path",
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*FileRunner)
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	r.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, data := range []string{"aaaa", "bbbb", "cccc", "dddd", "eeee", "ffff", "gggg"} {
+		if err := r.Process(newMessage(data, nil)); err != nil {
+			t.Fatalf("Process() unexpected error = %v", err)
+		}
+	}
+	if got := readFile(t, path); got != "gggg\n" {
+		t.Errorf("current file = %q", got)
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	sort.Strings(backups)
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want 2", backups)
+	}
+	if got := readFile(t, backups[0]) + readFile(t, backups[1]); got != "cccc\ndddd\neeee\nffff\n" {
+		t.Errorf("backups content = %q", got)
+	}
+}
+
+func TestFileRunnerMaxOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &RunnerConfig{
+		Path:            filepath.Join(dir, "{{ .metadata.n }}.log"),
+		Separator:       "\n",
+		FileMode:        "0644",
+		DirMode:         "0755",
+		MaxOpenFiles:    2,
+		PathMetadataKey: "eb-file-path",
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*FileRunner)
+	for _, n := range []string{"1", "2", "3", "1"} {
+		if err := r.Process(newMessage("x"+n, map[string]string{"n": n})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.order.Len() != 2 || len(r.files) != 2 {
+		t.Errorf("open files = %d", r.order.Len())
+	}
+	if got := readFile(t, filepath.Join(dir, "1.log")); got != "x1\nx1\n" {
+		t.Errorf("reopened file = %q", got)
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sandrolain/events-bridge/src/common/checkpoint"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	modeLine   = "line"
+	modeNDJSON = "ndjson"
+	modeCSV    = "csv"
+
+	startAtEnd       = "end"
+	startAtBeginning = "beginning"
+)
+
+// SourceConfig defines the configuration for the file source connector.
+// The files matching the paths are tailed, one message per line.
+type SourceConfig struct {
+	// Paths are the glob patterns of the tailed files (e.g. "/var/log/app/*.log")
+	Paths []string `mapstructure:"paths" validate:"required,min=1,dive,required"`
+	// Exclude are glob patterns matched against the base name of the files to skip
+	// (e.g. "*.gz")
+	Exclude []string `mapstructure:"exclude" validate:"dive,required"`
+	// Mode is the format of the lines: "line" (raw text), "ndjson" (a JSON document per
+	// line, invalid lines are skipped) or "csv" (a record per line, as a JSON object)
+	Mode string `mapstructure:"mode" default:"line" validate:"oneof=line ndjson csv"`
+	// CSV configures the csv mode
+	CSV CSVConfig `mapstructure:"csv"`
+	// StartAt is the position read from in the files found at startup without checkpoint:
+	// "end" (new lines only) or "beginning". The files created later are read from the beginning.
+	StartAt string `mapstructure:"startAt" default:"end" validate:"oneof=end beginning"`
+	// CheckpointFile stores the offsets of the processed lines, to resume after them on restart
+	CheckpointFile string `mapstructure:"checkpointFile"`
+	// CheckpointInterval is the interval between checkpoint file writes
+	CheckpointInterval time.Duration `mapstructure:"checkpointInterval" default:"5s" validate:"gt=0"`
+	// PollInterval is the interval between the scans of the paths, finding the new, rotated
+	// and truncated files and the writes missed by the file system notifications
+	PollInterval time.Duration `mapstructure:"pollInterval" default:"1s" validate:"gt=0"`
+	// MaxLineSize is the maximum size in bytes of a line, longer lines are skipped
+	MaxLineSize int `mapstructure:"maxLineSize" default:"1048576" validate:"gt=0"`
+}
+
+// CSVConfig configures the decoding of the csv lines
+type CSVConfig struct {
+	// Delimiter is the field delimiter
+	Delimiter string `mapstructure:"delimiter" default:"," validate:"len=1"`
+	// Header takes the column names from the first line of every file
+	Header bool `mapstructure:"header" default:"true"`
+	// Columns are the column names, when the files have no header; without header and
+	// columns the records are JSON arrays
+	Columns []string `mapstructure:"columns" validate:"dive,required"`
+}
+
+// FileSource tails the files matching glob patterns and emits their lines, watching the
+// directories with the file system notifications
+type FileSource struct {
+	cfg        *SourceConfig
+	slog       *slog.Logger
+	checkpoint *checkpoint.File
+	tailers    map[string]*tailer
+	// trackers commit the offsets of the files, kept across rotations so that the offsets
+	// of the rotated file are committed before the ones of the new file
+	trackers map[string]*checkpoint.Tracker
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	c        chan *message.RunnerMessage
+}
+
+func NewSourceConfig() any {
+	return new(SourceConfig)
+}
+
+// NewSource creates a file source from config
+func NewSource(anyCfg any) (connectors.Source, error) {
+	cfg, ok := anyCfg.(*SourceConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	for _, pattern := range append(append([]string{}, cfg.Paths...), cfg.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if cfg.Mode == modeCSV && cfg.CSV.Header && len(cfg.CSV.Columns) > 0 {
+		return nil, errors.New("csv header and columns are mutually exclusive")
+	}
+
+	file, err := checkpoint.Open(cfg.CheckpointFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSource{
+		cfg:        cfg,
+		slog:       slog.Default().With("context", "File Source"),
+		checkpoint: file,
+		tailers:    map[string]*tailer{},
+		trackers:   map[string]*checkpoint.Tracker{},
+	}, nil
+}
+
+func (s *FileSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	if s.c != nil {
+		return nil, errors.New("produce already called")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	for _, dir := range s.watchedDirs() {
+		if err := watcher.Add(dir); err != nil {
+			// The directory may be created later: the scans find its files
+			s.slog.Warn("cannot watch directory, polling it", "dir", dir, "error", err)
+		}
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.c = make(chan *message.RunnerMessage, buffer)
+
+	s.slog.Info("starting file source", "paths", s.cfg.Paths, "mode", s.cfg.Mode, "startAt", s.cfg.StartAt)
+
+	s.wg.Add(2)
+	go s.run(watcher)
+	go s.flushLoop()
+	return s.c, nil
+}
+
+// watchedDirs returns the directories of the patterns, up to the first one with glob
+// characters
+func (s *FileSource) watchedDirs() []string {
+	seen := map[string]bool{}
+	var dirs []string
+	for _, pattern := range s.cfg.Paths {
+		dir := filepath.Dir(pattern)
+		for hasMeta(dir) && filepath.Dir(dir) != dir {
+			dir = filepath.Dir(dir)
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// hasMeta reports whether the path holds glob characters (backslash escapes them except
+// on Windows)
+func hasMeta(path string) bool {
+	magic := `*?[\`
+	if runtime.GOOS == "windows" {
+		magic = `*?[`
+	}
+	return strings.ContainsAny(path, magic)
+}
+
+// run reads the files on every notification of their directories and on every poll
+func (s *FileSource) run(watcher *fsnotify.Watcher) {
+	defer s.wg.Done()
+	defer watcher.Close() //nolint:errcheck
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	s.scan(true)
+	for s.ctx.Err() == nil {
+		select {
+		case <-s.ctx.Done():
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			s.handleEvent(ev)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			s.slog.Warn("file watcher error", "error", err)
+		case <-ticker.C:
+			s.scan(false)
+		}
+	}
+}
+
+// handleEvent reads the written file; the creations, renames and removals are handled by
+// a scan
+func (s *FileSource) handleEvent(ev fsnotify.Event) {
+	if ev.Op&(fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+		s.scan(false)
+		return
+	}
+	if t, ok := s.tailers[ev.Name]; ok && ev.Op&fsnotify.Write != 0 {
+		s.read(t)
+	}
+}
+
+// scan finds the files matching the patterns, opening the new ones, handling the rotated,
+// truncated and removed ones, and reads every file
+func (s *FileSource) scan(initial bool) {
+	paths := s.match()
+	for _, path := range paths {
+		if _, ok := s.tailers[path]; ok {
+			continue
+		}
+		if s.renamed(path) {
+			continue
+		}
+		t, err := s.open(path, s.startOffset(path, initial))
+		if err != nil {
+			s.slog.Warn("cannot open file", "path", path, "error", err)
+			continue
+		}
+		s.tailers[path] = t
+	}
+
+	for _, path := range sortedKeys(s.tailers) {
+		t := s.tailers[path]
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			// Removed or renamed: the remaining lines are read and the file is forgotten
+			s.read(t)
+			s.slog.Debug("file removed", "path", path)
+			t.close()
+			delete(s.tailers, path)
+			continue
+		case !os.SameFile(info, t.info):
+			// Rotated: the remaining lines are read and the new file is read from the beginning
+			s.read(t)
+			s.slog.Debug("file rotated", "path", path)
+			t.close()
+			nt, err := s.open(path, 0)
+			if err != nil {
+				s.slog.Warn("cannot open file", "path", path, "error", err)
+				delete(s.tailers, path)
+				continue
+			}
+			s.tailers[path] = nt
+			t = nt
+		case info.Size() < t.read:
+			s.slog.Debug("file truncated", "path", path)
+			if err := t.reset(); err != nil {
+				s.slog.Warn("cannot read truncated file", "path", path, "error", err)
+				continue
+			}
+		}
+		s.read(t)
+	}
+}
+
+// renamed moves the tailer of a file renamed to a matching path (e.g. app.log rotated to
+// app.log.1), which is read on from its offset under the new path
+func (s *FileSource) renamed(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	for prev, t := range s.tailers {
+		if !os.SameFile(info, t.info) {
+			continue
+		}
+		if current, err := os.Stat(prev); err == nil && os.SameFile(current, t.info) {
+			// A hard link: both paths are tailed
+			return false
+		}
+		s.slog.Debug("file renamed", "path", prev, "to", path)
+		delete(s.tailers, prev)
+		t.path = path
+		t.tracker = s.tracker(path)
+		s.tailers[path] = t
+		return true
+	}
+	return false
+}
+
+// match returns the regular files matching the patterns and no exclusion
+func (s *FileSource) match() []string {
+	var paths []string
+	for _, pattern := range s.cfg.Paths {
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			if s.excluded(path) {
+				continue
+			}
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+func (s *FileSource) excluded(path string) bool {
+	base := filepath.Base(path)
+	for _, pattern := range s.cfg.Exclude {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// startOffset returns the offset a file is read from: the files found at startup are
+// read from their checkpoint or the start position, the files created later from the
+// beginning. A negative offset is the end of the file.
+func (s *FileSource) startOffset(path string, initial bool) int64 {
+	if !initial {
+		return 0
+	}
+	if pos, ok := s.checkpoint.Get(path); ok {
+		if offset, err := strconv.ParseInt(pos, 10, 64); err == nil {
+			return offset
+		}
+	}
+	if s.cfg.StartAt == startAtEnd {
+		return -1
+	}
+	return 0
+}
+
+// open opens a file at an offset
+func (s *FileSource) open(path string, offset int64) (*tailer, error) {
+	return openTailer(path, offset, s.cfg, s.tracker(path), s.slog)
+}
+
+// tracker returns the tracker of the offsets of the path
+func (s *FileSource) tracker(path string) *checkpoint.Tracker {
+	tracker, ok := s.trackers[path]
+	if !ok {
+		tracker = s.checkpoint.Tracker(path)
+		s.trackers[path] = tracker
+	}
+	return tracker
+}
+
+// read emits the complete lines appended to the file
+func (s *FileSource) read(t *tailer) {
+	err := t.lines(func(l line) bool {
+		msg, err := newFileMessage(t, l, s.cfg)
+		if err != nil {
+			s.slog.Warn("skipping line", "path", t.path, "offset", l.offset, "error", err)
+			l.position.Done()
+			return true
+		}
+		select {
+		case s.c <- message.NewRunnerMessage(msg):
+			return true
+		case <-s.ctx.Done():
+			return false
+		}
+	})
+	if err != nil {
+		s.slog.Warn("error reading file", "path", t.path, "error", err)
+	}
+}
+
+// flushLoop writes the checkpoint file periodically
+func (s *FileSource) flushLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.checkpoint.Flush(); err != nil {
+				s.slog.Error("failed to write checkpoint", "error", err)
+			}
+		}
+	}
+}
+
+func (s *FileSource) Close() error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	s.wg.Wait()
+	close(s.c)
+	s.cancel = nil
+	for path, t := range s.tailers {
+		t.close()
+		delete(s.tailers, path)
+	}
+
+	if err := s.checkpoint.Flush(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
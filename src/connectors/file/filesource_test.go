@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func receive(t *testing.T, c <-chan *message.RunnerMessage) *message.RunnerMessage {
+	t.Helper()
+	select {
+	case msg := <-c:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a message")
+		return nil
+	}
+}
+
+func expectNone(t *testing.T, c <-chan *message.RunnerMessage) {
+	t.Helper()
+	select {
+	case msg := <-c:
+		data, _ := msg.GetData()
+		t.Fatalf("unexpected message %q", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// receiveData returns the payload of the next message, acknowledging it
+func receiveData(t *testing.T, c <-chan *message.RunnerMessage) string {
+	t.Helper()
+	msg := receive(t, c)
+	data, err := msg.GetData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close() //nolint:errcheck
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSourceConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    map[string]any
+		wantErr bool
+	}{
+		{"valid", map[string]any{"paths": []any{"/var/log/*.log"}}, false},
+		{"missing paths", map[string]any{}, true},
+		{"invalid mode", map[string]any{"paths": []any{"/var/log/*.log"}, "mode": "xml"}, true},
+		{"invalid delimiter", map[string]any{"paths": []any{"/var/log/*.csv"}, "mode": "csv", "csv": map[string]any{"delimiter": ";;"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := utils.ParseConfig(tt.opts, new(SourceConfig))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	for name, cfg := range map[string]*SourceConfig{
+		"invalid pattern": {
+			Paths: []string{"/var/log/[.log"}, Mode: "line", StartAt: "end",
+			CheckpointInterval: 5 * time.Second, PollInterval: time.Second, MaxLineSize: 1024,
+		},
+		"columns with header": {
+			Paths: []string{"/var/log/*.csv"}, Mode: "csv", CSV: CSVConfig{Delimiter: ",", Header: true, Columns: []string{"a"}}, StartAt: "end",
+			CheckpointInterval: 5 * time.Second, PollInterval: time.Second, MaxLineSize: 1024,
+		},
+	} {
+		if _, err := NewSource(cfg); err == nil {
+			t.Errorf("NewSource() expected %s error", name)
+		}
+	}
+}
+
+func TestFileSourceTail(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "app.log")
+	writeFile(t, existing, "old line\n")
+	writeFile(t, filepath.Join(dir, "app.log.gz"), "compressed\n")
+
+	cfg := &SourceConfig{
+		Paths:              []string{filepath.Join(dir, "*.log*")},
+		Exclude:            []string{"*.gz"},
+		Mode:               "line",
+		StartAt:            "end",
+		CheckpointInterval: 5 * time.Second,
+		PollInterval:       20 * time.Millisecond,
+		MaxLineSize:        1024,
+	}
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+	defer src.Close() //nolint:errcheck
+
+	// The existing content is skipped, the appended lines are read once complete
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, existing, "first\r\nsec")
+	if got := receiveData(t, c); got != "first" {
+		t.Errorf("line = %q", got)
+	}
+	expectNone(t, c)
+	appendFile(t, existing, "ond\n\n")
+	msg := receive(t, c)
+	data, _ := msg.GetData()
+	meta, _ := msg.GetMetadata()
+	if string(data) != "second" || meta["path"] != existing || meta["file"] != "app.log" || meta["offset"] != "16" {
+		t.Errorf("message = %q %v", data, meta)
+	}
+
+	// New files are read from the beginning
+	writeFile(t, filepath.Join(dir, "other.log"), "new file\n")
+	if got := receiveData(t, c); got != "new file" {
+		t.Errorf("line = %q", got)
+	}
+
+	// Rotation: the renamed file is read on from its offset, the new file from the beginning
+	if err := os.Rename(existing, existing+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, existing+".1", "late\n")
+	writeFile(t, existing, "rotated\n")
+	got := map[string]string{}
+	for range 2 {
+		msg := receive(t, c)
+		data, _ := msg.GetData()
+		meta, _ := msg.GetMetadata()
+		got[string(data)] = meta["file"]
+	}
+	if got["late"] != "app.log.1" || got["rotated"] != "app.log" {
+		t.Errorf("lines after rotation = %v", got)
+	}
+	expectNone(t, c)
+}
+
+func TestFileSourceTruncate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "a\nb\n")
+
+	cfg := &SourceConfig{
+		Paths:              []string{path},
+		Mode:               "line",
+		StartAt:            "beginning",
+		CheckpointInterval: 5 * time.Second,
+		PollInterval:       20 * time.Millisecond,
+		MaxLineSize:        1024,
+	}
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close() //nolint:errcheck
+
+	for _, want := range []string{"a", "b"} {
+		if got := receiveData(t, c); got != want {
+			t.Errorf("line = %q, want %q", got, want)
+		}
+	}
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, path, "c\n")
+	if got := receiveData(t, c); got != "c" {
+		t.Errorf("line after truncation = %q", got)
+	}
+}
+
+func TestFileSourceCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.ndjson")
+	checkpointFile := filepath.Join(dir, "checkpoint.json")
+	writeFile(t, path, "{\"n\":1}\nnot json\n{\"n\":2}\n")
+	cfg := &SourceConfig{
+		Paths:              []string{path},
+		Mode:               "ndjson",
+		StartAt:            "beginning",
+		CheckpointFile:     checkpointFile,
+		CheckpointInterval: time.Hour,
+		PollInterval:       20 * time.Millisecond,
+		MaxLineSize:        1024,
+	}
+
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The invalid line is skipped
+	if got := receiveData(t, c); got != `{"n":1}` {
+		t.Errorf("line = %q", got)
+	}
+	second := receive(t, c)
+	if data, _ := second.GetData(); string(data) != `{"n":2}` {
+		t.Errorf("line = %q", data)
+	}
+	// The unacknowledged line is not committed
+	if err := src.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var positions map[string]string
+	data, err := os.ReadFile(checkpointFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &positions); err != nil || positions[path] != "17" {
+		t.Fatalf("checkpoint = %s", data)
+	}
+
+	appendFile(t, path, "{\"n\":3}\n")
+	if src, err = NewSource(cfg); err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	if c, err = src.Produce(10); err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close() //nolint:errcheck
+	for _, want := range []string{`{"n":2}`, `{"n":3}`} {
+		if got := receiveData(t, c); got != want {
+			t.Errorf("line after restart = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestFileSourceCSV(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "orders.csv")
+	checkpointFile := filepath.Join(dir, "checkpoint.json")
+	writeFile(t, path, "id;customer\n1;\"Acme; Inc\"\n")
+	cfg := &SourceConfig{
+		Paths:              []string{path},
+		Mode:               "csv",
+		CSV:                CSVConfig{Delimiter: ";", Header: true},
+		StartAt:            "beginning",
+		CheckpointFile:     checkpointFile,
+		CheckpointInterval: time.Hour,
+		PollInterval:       20 * time.Millisecond,
+		MaxLineSize:        1024,
+	}
+
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := receiveData(t, c); got != `{"customer":"Acme; Inc","id":"1"}` {
+		t.Errorf("record = %s", got)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The header is read again when resuming after it
+	appendFile(t, path, "2;Globex;extra\n")
+	if src, err = NewSource(cfg); err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	if c, err = src.Produce(10); err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close() //nolint:errcheck
+	if got := receiveData(t, c); got != `{"column3":"extra","customer":"Globex","id":"2"}` {
+		t.Errorf("record after restart = %s", got)
+	}
+}
+
+func TestFileSourceMaxLineSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "0123456789abcdef\nok\n")
+
+	cfg := &SourceConfig{
+		Paths:              []string{path},
+		Mode:               "line",
+		StartAt:            "beginning",
+		CheckpointInterval: 5 * time.Second,
+		PollInterval:       20 * time.Millisecond,
+		MaxLineSize:        8,
+	}
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close() //nolint:errcheck
+	if got := receiveData(t, c); got != "ok" {
+		t.Errorf("line = %q", got)
+	}
+}
+
+func TestCSVJSON(t *testing.T) {
+	data, err := csvJSON([]string{"a", "b"}, nil)
+	if err != nil || string(data) != `["a","b"]` {
+		t.Errorf("csvJSON() = %s, %v", data, err)
+	}
+	data, err = csvJSON([]string{"1"}, []string{"id", "name"})
+	if err != nil || string(data) != `{"id":"1"}` {
+		t.Errorf("csvJSON() = %s, %v", data, err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/sandrolain/events-bridge/src/common/checkpoint"
+)
+
+// line is a complete line read from a file
+type line struct {
+	data     []byte
+	offset   int64
+	position *checkpoint.Position
+}
+
+// tailer reads the lines appended to a file
+type tailer struct {
+	path    string
+	cfg     *SourceConfig
+	slog    *slog.Logger
+	f       *os.File
+	info    os.FileInfo
+	reader  *bufio.Reader
+	tracker *checkpoint.Tracker
+	// read is the offset of the bytes read, including the partial line
+	read    int64
+	partial []byte
+	// skipping discards the rest of a line longer than MaxLineSize
+	skipping bool
+	// header holds the column names of a csv file with header
+	header []string
+}
+
+// openTailer opens a file at an offset; a negative offset is the end of the file, an offset
+// beyond the end (a file truncated since the checkpoint) is the beginning
+func openTailer(path string, offset int64, cfg *SourceConfig, tracker *checkpoint.Tracker, logger *slog.Logger) (*tailer, error) {
+	f, err := os.Open(path) //nolint:gosec // user-configured paths
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close() //nolint:errcheck
+		return nil, err
+	}
+	if offset < 0 {
+		offset = info.Size()
+	}
+	if offset > info.Size() {
+		offset = 0
+	}
+
+	t := &tailer{
+		path:    path,
+		cfg:     cfg,
+		slog:    logger,
+		f:       f,
+		info:    info,
+		reader:  bufio.NewReaderSize(f, 64*1024),
+		tracker: tracker,
+		read:    offset,
+	}
+	if offset > 0 && cfg.Mode == modeCSV && cfg.CSV.Header {
+		if err := t.readHeader(); err != nil {
+			f.Close() //nolint:errcheck
+			return nil, err
+		}
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close() //nolint:errcheck
+		return nil, err
+	}
+	return t, nil
+}
+
+// readHeader reads the csv header of a file opened after its first line
+func (t *tailer) readHeader() error {
+	r := bufio.NewReader(io.NewSectionReader(t.f, 0, int64(t.cfg.MaxLineSize)+1))
+	data, err := r.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read csv header: %w", err)
+	}
+	t.header, err = parseCSV(trimLine(data), t.cfg.CSV.Delimiter)
+	return err
+}
+
+// reset reads a truncated file from the beginning
+func (t *tailer) reset() error {
+	if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	t.reader.Reset(t.f)
+	t.read = 0
+	t.partial = nil
+	t.skipping = false
+	t.header = nil
+	return nil
+}
+
+// lines calls fn for every complete line read, until the end of the file or fn returns
+// false. The positions of the skipped lines are done at once.
+func (t *tailer) lines(fn func(line) bool) error {
+	for {
+		chunk, err := t.reader.ReadSlice('\n')
+		t.read += int64(len(chunk))
+		complete := err == nil
+
+		switch {
+		case t.skipping:
+			if complete {
+				t.skipping = false
+				t.tracker.Track(strconv.FormatInt(t.read, 10)).Done()
+			}
+		case len(t.partial)+len(chunk) > t.cfg.MaxLineSize+2:
+			t.slog.Warn("skipping line longer than maxLineSize", "path", t.path, "offset", t.read-int64(len(t.partial)+len(chunk)))
+			t.partial = nil
+			t.skipping = !complete
+			if complete {
+				t.tracker.Track(strconv.FormatInt(t.read, 10)).Done()
+			}
+		default:
+			t.partial = append(t.partial, chunk...)
+		}
+
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+		if t.partial == nil {
+			continue
+		}
+
+		data := trimLine(t.partial)
+		start := t.read - int64(len(t.partial))
+		t.partial = nil
+		position := t.tracker.Track(strconv.FormatInt(t.read, 10))
+
+		if start == 0 && t.cfg.Mode == modeCSV && t.cfg.CSV.Header {
+			if t.header, err = parseCSV(data, t.cfg.CSV.Delimiter); err != nil {
+				t.slog.Warn("invalid csv header", "path", t.path, "error", err)
+			}
+			position.Done()
+			continue
+		}
+		if len(data) == 0 {
+			position.Done()
+			continue
+		}
+		if !fn(line{data: data, offset: start, position: position}) {
+			return nil
+		}
+	}
+}
+
+func (t *tailer) close() {
+	t.f.Close() //nolint:errcheck
+}
+
+// trimLine removes the line terminator
+func trimLine(data []byte) []byte {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	return bytes.TrimSuffix(data, []byte("\r"))
+}
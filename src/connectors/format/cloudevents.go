@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/sandrolain/events-bridge/src/common"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	ceSpecVersion = "1.0"
+	// cePrefix prefixes the attributes in the metadata, as the headers of the HTTP and
+	// Kafka binary modes
+	cePrefix = "ce-"
+	// ceContentType is the content type of the structured events
+	ceContentType = "application/cloudevents+json"
+
+	ceModeStructured = "structured"
+	ceModeBinary     = "binary"
+
+	contentTypeKey = "content-type"
+)
+
+// ceRequired are the attributes every event must have
+var ceRequired = []string{"specversion", "id", "source", "type"}
+
+type CloudEventsConfig struct {
+	// Mode of the wrapped events: "structured" (the payload is the JSON event with the
+	// data inside) or "binary" (the payload is the data, the attributes are "ce-" metadata)
+	Mode string `mapstructure:"mode" default:"structured" validate:"oneof=structured binary"`
+	// Source is the source attribute of the wrapped events
+	Source string `mapstructure:"source"`
+	// SourceFromMetadataKey is the metadata key overriding Source
+	SourceFromMetadataKey string `mapstructure:"sourceFromMetadataKey"`
+	// Type is the type attribute of the wrapped events
+	Type string `mapstructure:"type"`
+	// TypeFromMetadataKey is the metadata key overriding Type
+	TypeFromMetadataKey string `mapstructure:"typeFromMetadataKey"`
+	// IDFromMetadataKey is the metadata key of the event id; the message id or a random
+	// UUID is used when not set or missing
+	IDFromMetadataKey string `mapstructure:"idFromMetadataKey"`
+	// Subject is the optional subject attribute of the wrapped events
+	Subject string `mapstructure:"subject"`
+	// SubjectFromMetadataKey is the metadata key overriding Subject
+	SubjectFromMetadataKey string `mapstructure:"subjectFromMetadataKey"`
+	// TimeFromMetadataKey is the metadata key of the event time (RFC3339); the current
+	// time is used when not set or missing
+	TimeFromMetadataKey string `mapstructure:"timeFromMetadataKey"`
+	// DataSchema is the optional dataschema attribute of the wrapped events
+	DataSchema string `mapstructure:"dataSchema" validate:"omitempty,uri"`
+	// DataContentType is the content type of the data, the "content-type" metadata
+	// being used when not set
+	DataContentType string `mapstructure:"dataContentType" default:"application/json"`
+	// Extensions maps the extension attributes of the wrapped events to the metadata
+	// keys of their values, missing keys omitting the extension
+	Extensions map[string]string `mapstructure:"extensions"`
+}
+
+// validateWrap checks the attributes that the wrapped events cannot miss
+func (c *CloudEventsConfig) validateWrap() error {
+	if c.Source == "" && c.SourceFromMetadataKey == "" {
+		return errors.New("cloudEvents.source or cloudEvents.sourceFromMetadataKey is required")
+	}
+	if c.Type == "" && c.TypeFromMetadataKey == "" {
+		return errors.New("cloudEvents.type or cloudEvents.typeFromMetadataKey is required")
+	}
+	for name := range c.Extensions {
+		if !validAttributeName(name) {
+			return fmt.Errorf("invalid extension attribute name %q: lowercase letters and digits only", name)
+		}
+	}
+	return nil
+}
+
+// validAttributeName checks the CloudEvents attribute naming rule
+func validAttributeName(name string) bool {
+	if name == "" || len(name) > 20 {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// wrapCloudEvent wraps the message into a CloudEvent, the attributes being resolved from
+// the configuration and the metadata
+func (r *FormatRunner) wrapCloudEvent(msg *message.RunnerMessage) error {
+	cfg := r.cfg.CloudEvents
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return err
+	}
+
+	attrs := map[string]string{
+		"specversion": ceSpecVersion,
+		"id":          message.ResolveFromMetadata(msg, cfg.IDFromMetadataKey, ""),
+		"source":      message.ResolveFromMetadata(msg, cfg.SourceFromMetadataKey, cfg.Source),
+		"type":        message.ResolveFromMetadata(msg, cfg.TypeFromMetadataKey, cfg.Type),
+		"time":        message.ResolveFromMetadata(msg, cfg.TimeFromMetadataKey, ""),
+	}
+	if attrs["id"] == "" {
+		if id := msg.GetID(); len(id) > 0 {
+			attrs["id"] = string(id)
+		} else {
+			attrs["id"] = uuid.NewString()
+		}
+	}
+	if attrs["source"] == "" || attrs["type"] == "" {
+		return errors.New("cloudEvents source and type must not be empty")
+	}
+	if attrs["time"] == "" {
+		attrs["time"] = r.now().UTC().Format(time.RFC3339Nano)
+	} else if _, err := time.Parse(time.RFC3339Nano, attrs["time"]); err != nil {
+		return fmt.Errorf("invalid event time %q: %w", attrs["time"], err)
+	}
+	if subject := message.ResolveFromMetadata(msg, cfg.SubjectFromMetadataKey, cfg.Subject); subject != "" {
+		attrs["subject"] = subject
+	}
+	if cfg.DataSchema != "" {
+		attrs["dataschema"] = cfg.DataSchema
+	}
+	contentType := cfg.DataContentType
+	if v := common.LookupFold(meta, contentTypeKey); v != "" {
+		contentType = v
+	}
+	for name, key := range cfg.Extensions {
+		if v, ok := meta[key]; ok {
+			attrs[name] = v
+		}
+	}
+
+	out := maps.Clone(meta)
+	if out == nil {
+		out = make(map[string]string)
+	}
+	common.DeleteFold(out, contentTypeKey)
+	if cfg.Mode == ceModeBinary {
+		// The data is the payload, the content type stays the "content-type" metadata
+		for name, v := range attrs {
+			out[cePrefix+name] = v
+		}
+		out[contentTypeKey] = contentType
+		msg.SetMetadata(out)
+		return nil
+	}
+
+	event := make(map[string]any, len(attrs)+2)
+	for name, v := range attrs {
+		event[name] = v
+	}
+	event["datacontenttype"] = contentType
+	switch {
+	case isJSONContentType(contentType):
+		if !json.Valid(data) {
+			return fmt.Errorf("payload is not valid JSON for the content type %s", contentType)
+		}
+		event["data"] = json.RawMessage(data)
+	case isTextContentType(contentType) && utf8.Valid(data):
+		event["data"] = string(data)
+	default:
+		event["data_base64"] = base64.StdEncoding.EncodeToString(data)
+	}
+
+	res, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	out[contentTypeKey] = ceContentType
+	msg.SetMetadata(out)
+	msg.SetData(res)
+	return nil
+}
+
+// unwrapCloudEvent replaces the event with its data, the attributes becoming "ce-" metadata
+// and the data content type the "content-type" metadata. The binary events are detected by
+// their "ce-specversion" metadata, the others are parsed as structured events.
+func (r *FormatRunner) unwrapCloudEvent(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return err
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds maximum %d", len(data), r.cfg.MaxInputSize)
+	}
+
+	if common.LookupFold(meta, cePrefix+"specversion") != "" {
+		// Binary mode: the metadata keys are normalized, e.g. the "Ce-Id" HTTP headers
+		attrs := make(map[string]string)
+		for k, v := range meta {
+			if len(k) > len(cePrefix) && strings.EqualFold(k[:len(cePrefix)], cePrefix) {
+				attrs[strings.ToLower(k[len(cePrefix):])] = v
+			}
+		}
+		if err := checkAttributes(attrs); err != nil {
+			return err
+		}
+		out := maps.Clone(meta)
+		for k := range meta {
+			if strings.HasPrefix(strings.ToLower(k), cePrefix) {
+				delete(out, k)
+			}
+		}
+		for name, v := range attrs {
+			out[cePrefix+name] = v
+		}
+		msg.SetMetadata(out)
+		return nil
+	}
+
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("payload must be a structured CloudEvent: %w", err)
+	}
+	attrs := make(map[string]string, len(event))
+	for name, raw := range event {
+		if name == "data" || name == "data_base64" {
+			continue
+		}
+		var v any
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fmt.Errorf("invalid attribute %q: %w", name, err)
+		}
+		switch v := v.(type) {
+		case string:
+			attrs[name] = v
+		case nil:
+		case map[string]any, []any:
+			return fmt.Errorf("invalid attribute %q: must be a scalar", name)
+		default:
+			attrs[name] = fmt.Sprint(v)
+		}
+	}
+	if err := checkAttributes(attrs); err != nil {
+		return err
+	}
+
+	// Without datacontenttype the data is JSON
+	contentType := attrs["datacontenttype"]
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	// Not nil, that would restore the source data
+	payload := []byte{}
+	if raw, ok := event["data_base64"]; ok {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return fmt.Errorf("invalid data_base64: %w", err)
+		}
+		if payload, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return fmt.Errorf("invalid data_base64: %w", err)
+		}
+	} else if raw, ok := event["data"]; ok {
+		var s string
+		// A string is the data itself unless the data is JSON
+		if !isJSONContentType(contentType) && json.Unmarshal(raw, &s) == nil {
+			payload = []byte(s)
+		} else {
+			payload = raw
+		}
+	}
+
+	delete(attrs, "datacontenttype")
+	out := maps.Clone(meta)
+	if out == nil {
+		out = make(map[string]string)
+	}
+	common.DeleteFold(out, contentTypeKey)
+	for name, v := range attrs {
+		out[cePrefix+name] = v
+	}
+	out[contentTypeKey] = contentType
+	msg.SetMetadata(out)
+	msg.SetData(payload)
+	return nil
+}
+
+// checkAttributes checks the attributes required by the specification
+func checkAttributes(attrs map[string]string) error {
+	for _, name := range ceRequired {
+		if attrs[name] == "" {
+			return fmt.Errorf("CloudEvent attribute %q is missing", name)
+		}
+	}
+	if attrs["specversion"] != ceSpecVersion {
+		return fmt.Errorf("unsupported CloudEvents specversion %q", attrs["specversion"])
+	}
+	return nil
+}
+
+func isJSONContentType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json")
+}
+
+func isTextContentType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mt, "text/") || mt == "application/xml" || strings.HasSuffix(mt, "+xml")
+}
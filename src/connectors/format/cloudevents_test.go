@@ -0,0 +1,190 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func newCERunner(t *testing.T, operation string, ce CloudEventsConfig) *FormatRunner {
+	t.Helper()
+	if ce.Mode == "" {
+		ce.Mode = ceModeStructured
+	}
+	if ce.DataContentType == "" {
+		ce.DataContentType = "application/json"
+	}
+	r, err := NewRunner(&RunnerConfig{Operation: operation, CloudEvents: ce})
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	fr := r.(*FormatRunner)
+	fr.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+	return fr
+}
+
+func TestWrapCloudEventStructured(t *testing.T) {
+	r := newCERunner(t, opWrapCE, CloudEventsConfig{
+		Source:              "/orders",
+		TypeFromMetadataKey: "event",
+		Subject:             "order",
+		Extensions:          map[string]string{"tenant": "x-tenant"},
+	})
+
+	meta, out, err := processMsg(t, r, `{"id":1}`, map[string]string{"event": "order.created", "x-tenant": "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, out, `{"specversion":"1.0","id":"test-id","source":"/orders","type":"order.created","subject":"order",
+		"time":"2024-05-01T10:00:00Z","tenant":"acme","datacontenttype":"application/json","data":{"id":1}}`)
+	if meta["content-type"] != "application/cloudevents+json" || meta["x-tenant"] != "acme" {
+		t.Errorf("metadata = %v", meta)
+	}
+
+	// Text data is a string, binary data is base64 encoded
+	_, out, err = processMsg(t, r, "hello", map[string]string{"event": "e", "Content-Type": "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `"data":"hello"`) || !strings.Contains(out, `"datacontenttype":"text/plain"`) {
+		t.Errorf("event = %s", out)
+	}
+	_, out, err = processMsg(t, r, "\xff\x00", map[string]string{"event": "e", "content-type": "application/octet-stream"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `"data_base64":"/wA="`) {
+		t.Errorf("event = %s", out)
+	}
+}
+
+func TestWrapCloudEventBinary(t *testing.T) {
+	r := newCERunner(t, opWrapCE, CloudEventsConfig{
+		Mode:              ceModeBinary,
+		Source:            "/orders",
+		Type:              "order.created",
+		IDFromMetadataKey: "rid",
+	})
+	meta, out, err := processMsg(t, r, `{"id":1}`, map[string]string{"rid": "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != `{"id":1}` {
+		t.Errorf("data = %s", out)
+	}
+	want := map[string]string{
+		"rid": "r1", "ce-specversion": "1.0", "ce-id": "r1", "ce-source": "/orders", "ce-type": "order.created",
+		"ce-time": "2024-05-01T10:00:00Z", "content-type": "application/json",
+	}
+	for k, v := range want {
+		if meta[k] != v {
+			t.Errorf("metadata %s = %q, want %q", k, meta[k], v)
+		}
+	}
+}
+
+func TestUnwrapCloudEvent(t *testing.T) {
+	r := newCERunner(t, opUnwrapCE, CloudEventsConfig{})
+
+	meta, out, err := processMsg(t, r,
+		`{"specversion":"1.0","id":"e1","source":"/s","type":"t","tenant":"acme","sequence":7,"data":{"a":1}}`,
+		map[string]string{"content-type": "application/cloudevents+json", "keep": "yes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, out, `{"a":1}`)
+	want := map[string]string{
+		"keep": "yes", "ce-specversion": "1.0", "ce-id": "e1", "ce-source": "/s", "ce-type": "t",
+		"ce-tenant": "acme", "ce-sequence": "7", "content-type": "application/json",
+	}
+	for k, v := range want {
+		if meta[k] != v {
+			t.Errorf("metadata %s = %q, want %q", k, meta[k], v)
+		}
+	}
+
+	_, out, err = processMsg(t, r, `{"specversion":"1.0","id":"e1","source":"/s","type":"t","datacontenttype":"text/plain","data":"hi"}`, nil)
+	if err != nil || out != "hi" {
+		t.Errorf("text data = %q, %v", out, err)
+	}
+	_, out, err = processMsg(t, r, `{"specversion":"1.0","id":"e1","source":"/s","type":"t","data_base64":"/wA="}`, nil)
+	if err != nil || out != "\xff\x00" {
+		t.Errorf("base64 data = %q, %v", out, err)
+	}
+
+	// Binary mode: the HTTP headers are normalized, the data is unchanged
+	meta, out, err = processMsg(t, r, "raw", map[string]string{
+		"Ce-Specversion": "1.0", "Ce-Id": "e2", "Ce-Source": "/s", "Ce-Type": "t", "Content-Type": "text/plain",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "raw" || meta["ce-id"] != "e2" || meta["Ce-Id"] != "" || meta["Content-Type"] != "text/plain" {
+		t.Errorf("binary = %q, %v", out, meta)
+	}
+}
+
+func TestWrapUnwrapRoundTrip(t *testing.T) {
+	wrap := newCERunner(t, opWrapCE, CloudEventsConfig{Source: "/s", Type: "t"})
+	unwrap := newCERunner(t, opUnwrapCE, CloudEventsConfig{})
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"v":[1,2]}`), map[string]string{"k": "v"}))
+	if err := wrap.Process(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := unwrap.Process(msg); err != nil {
+		t.Fatal(err)
+	}
+	meta, data, _ := msg.GetMetadataAndData()
+	assertJSON(t, string(data), `{"v":[1,2]}`)
+	if meta["k"] != "v" || meta["ce-type"] != "t" {
+		t.Errorf("metadata = %v", meta)
+	}
+}
+
+func TestCloudEventErrors(t *testing.T) {
+	unwrap := newCERunner(t, opUnwrapCE, CloudEventsConfig{})
+	wrap := newCERunner(t, opWrapCE, CloudEventsConfig{Source: "/s", Type: "t", TimeFromMetadataKey: "ts"})
+	tests := []struct {
+		name string
+		r    *FormatRunner
+		data string
+		meta map[string]string
+		err  string
+	}{
+		{"not an event", unwrap, `[1]`, nil, "must be a structured CloudEvent"},
+		{"missing type", unwrap, `{"specversion":"1.0","id":"e","source":"/s"}`, nil, `"type" is missing`},
+		{"specversion", unwrap, `{"specversion":"0.3","id":"e","source":"/s","type":"t"}`, nil, "unsupported CloudEvents specversion"},
+		{"binary missing id", unwrap, ``, map[string]string{"ce-specversion": "1.0", "ce-source": "/s", "ce-type": "t"}, `"id" is missing`},
+		{"invalid JSON data", wrap, `{`, nil, "not valid JSON"},
+		{"invalid time", wrap, `{}`, map[string]string{"ts": "yesterday"}, "invalid event time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := processMsg(t, tt.r, tt.data, tt.meta); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Process() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCloudEventConfigValidation(t *testing.T) {
+	for name, opts := range map[string]map[string]any{
+		"missing source": {"operation": "wrapCloudEvent", "cloudEvents": map[string]any{"type": "t"}},
+		"missing type":   {"operation": "wrapCloudEvent", "cloudEvents": map[string]any{"source": "/s"}},
+		"extension name": {"operation": "wrapCloudEvent", "cloudEvents": map[string]any{"source": "/s", "type": "t", "extensions": map[string]any{"Tenant-Id": "t"}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := new(RunnerConfig)
+			if err := utils.ParseConfig(opts, cfg); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewRunner(cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// flattener collects the leaves of a nested object under their delimited keys
+type flattener struct {
+	delimiter string
+	arrays    string
+	separator string
+	maxDepth  int
+	out       map[string]any
+}
+
+// object flattens the fields of an object found at the key, depth levels deep
+func (f *flattener) object(key string, obj map[string]any, depth int) error {
+	for k, v := range obj {
+		if err := f.value(f.join(key, k), v, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value flattens a value; the empty objects and arrays and the values below the maximum
+// depth are kept as they are
+func (f *flattener) value(key string, v any, depth int) error {
+	if f.maxDepth > 0 && depth >= f.maxDepth {
+		return f.set(key, v)
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			return f.set(key, v)
+		}
+		return f.object(key, v, depth)
+	case []any:
+		if len(v) == 0 || f.arrays == arraysKeep {
+			return f.set(key, v)
+		}
+		if f.arrays == arraysJoin {
+			if joined, ok := joinScalars(v, f.separator); ok {
+				return f.set(key, joined)
+			}
+		}
+		for i, item := range v {
+			if err := f.value(f.join(key, strconv.Itoa(i)), item, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return f.set(key, v)
+	}
+}
+
+func (f *flattener) join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + f.delimiter + key
+}
+
+// set stores a flattened value, rejecting the keys produced twice, e.g. by a key
+// containing the delimiter
+func (f *flattener) set(key string, v any) error {
+	if _, ok := f.out[key]; ok {
+		return fmt.Errorf("duplicate flattened key %q", key)
+	}
+	f.out[key] = v
+	return nil
+}
+
+// joinScalars joins the elements of an array of scalars, null being an empty string
+func joinScalars(items []any, separator string) (string, bool) {
+	parts := make([]string, len(items))
+	for i, item := range items {
+		switch v := item.(type) {
+		case map[string]any, []any:
+			return "", false
+		case nil:
+		default:
+			parts[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(parts, separator), true
+}
+
+// unflatten nests the values of the delimited keys; with indexes, the objects whose keys
+// are the indexes 0..n-1 are rebuilt as arrays
+func unflatten(flat map[string]any, delimiter string, indexes bool) (map[string]any, error) {
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	// A key is sorted before the keys it prefixes
+	slices.Sort(keys)
+
+	root := make(map[string]any, len(flat))
+	for _, key := range keys {
+		segs := strings.Split(key, delimiter)
+		node := root
+		for i, seg := range segs[:len(segs)-1] {
+			next, ok := node[seg]
+			if !ok {
+				child := map[string]any{}
+				node[seg] = child
+				node = child
+				continue
+			}
+			child, ok := next.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("key %q conflicts with the value of %q", key, strings.Join(segs[:i+1], delimiter))
+			}
+			node = child
+		}
+		last := segs[len(segs)-1]
+		if _, ok := node[last]; ok {
+			return nil, fmt.Errorf("duplicate key %q", key)
+		}
+		node[last] = flat[key]
+	}
+
+	if indexes {
+		for k, v := range root {
+			root[k] = toArrays(v)
+		}
+	}
+	return root, nil
+}
+
+// toArrays replaces the nested objects keyed by the indexes 0..n-1 with arrays
+func toArrays(v any) any {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	for k, item := range obj {
+		obj[k] = toArrays(item)
+	}
+	if len(obj) == 0 {
+		return obj
+	}
+	items := make([]any, len(obj))
+	for k, item := range obj {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || i >= len(obj) || strconv.Itoa(i) != k {
+			return obj
+		}
+		items[i] = item
+	}
+	return items
+}
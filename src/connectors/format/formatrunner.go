@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure FormatRunner implements connectors.Runner
+var _ connectors.Runner = &FormatRunner{}
+
+const (
+	opFlatten   = "flatten"
+	opUnflatten = "unflatten"
+	opWrapCE    = "wrapCloudEvent"
+	opUnwrapCE  = "unwrapCloudEvent"
+
+	arraysIndex = "index"
+	arraysKeep  = "keep"
+	arraysJoin  = "join"
+)
+
+type RunnerConfig struct {
+	// Operation is "flatten" (nested objects to a single level of delimited keys),
+	// "unflatten" (delimited keys to nested objects), "wrapCloudEvent" (the message to a
+	// CloudEvent) or "unwrapCloudEvent" (a CloudEvent to its data and metadata)
+	Operation string `mapstructure:"operation" default:"flatten" validate:"oneof=flatten unflatten wrapCloudEvent unwrapCloudEvent"`
+	// Delimiter separates the keys of the nesting levels
+	Delimiter string `mapstructure:"delimiter" default:"." validate:"required"`
+	// Arrays is the handling of arrays: "index" (a key per element with its index, e.g.
+	// "tags.0", rebuilt as arrays by unflatten), "keep" (arrays are values) or "join"
+	// (flatten only: arrays of scalars joined into a string, other arrays indexed)
+	Arrays string `mapstructure:"arrays" default:"index" validate:"oneof=index keep join"`
+	// ArraySeparator separates the joined elements of the "join" arrays
+	ArraySeparator string `mapstructure:"arraySeparator" default:","`
+	// MaxDepth is the maximum number of levels joined into a key by flatten, the deeper
+	// values being kept as they are (0 = unlimited)
+	MaxDepth int `mapstructure:"maxDepth" validate:"min=0"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+	// CloudEvents configures the CloudEvents operations
+	CloudEvents CloudEventsConfig `mapstructure:"cloudEvents"`
+}
+
+type FormatRunner struct {
+	cfg  *RunnerConfig
+	slog *slog.Logger
+	now  func() time.Time
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a new instance of FormatRunner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	if cfg.Operation == opWrapCE {
+		if err := cfg.CloudEvents.validateWrap(); err != nil {
+			return nil, err
+		}
+	}
+	log := slog.Default().With("context", "Format Runner")
+	log.Info("format runner created", "operation", cfg.Operation, "delimiter", cfg.Delimiter, "arrays", cfg.Arrays)
+	return &FormatRunner{cfg: cfg, slog: log, now: time.Now}, nil
+}
+
+// Process flattens or unflattens the JSON payload, an object or an array of objects
+// transformed one by one, or wraps or unwraps a CloudEvent
+func (r *FormatRunner) Process(msg *message.RunnerMessage) error {
+	switch r.cfg.Operation {
+	case opWrapCE:
+		return r.wrapCloudEvent(msg)
+	case opUnwrapCE:
+		return r.unwrapCloudEvent(msg)
+	}
+
+	data, err := msg.GetData()
+	if err != nil {
+		return fmt.Errorf("failed to get data: %w", err)
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds maximum %d", len(data), r.cfg.MaxInputSize)
+	}
+
+	// Numbers are kept as written, large integers included
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var payload any
+	if err := dec.Decode(&payload); err != nil {
+		return fmt.Errorf("payload must be JSON: %w", err)
+	}
+
+	var out any
+	switch v := payload.(type) {
+	case map[string]any:
+		if out, err = r.transform(v); err != nil {
+			return err
+		}
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			obj, ok := item.(map[string]any)
+			if !ok {
+				return fmt.Errorf("payload item %d must be a JSON object, got %T", i, item)
+			}
+			if items[i], err = r.transform(obj); err != nil {
+				return fmt.Errorf("payload item %d: %w", i, err)
+			}
+		}
+		out = items
+	default:
+		return fmt.Errorf("payload must be a JSON object or an array of objects, got %T", payload)
+	}
+
+	res, err := json.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	msg.SetData(res)
+	return nil
+}
+
+func (r *FormatRunner) transform(obj map[string]any) (map[string]any, error) {
+	if r.cfg.Operation == opUnflatten {
+		return unflatten(obj, r.cfg.Delimiter, r.cfg.Arrays == arraysIndex)
+	}
+	f := &flattener{
+		delimiter: r.cfg.Delimiter,
+		arrays:    r.cfg.Arrays,
+		separator: r.cfg.ArraySeparator,
+		maxDepth:  r.cfg.MaxDepth,
+		out:       make(map[string]any, len(obj)),
+	}
+	if err := f.object("", obj, 0); err != nil {
+		return nil, err
+	}
+	return f.out, nil
+}
+
+func (r *FormatRunner) Close() error {
+	return nil
+}
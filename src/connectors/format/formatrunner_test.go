@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+// processMsg runs the message through the runner and returns its metadata and data
+func processMsg(t *testing.T, r connectors.Runner, data string, meta map[string]string) (map[string]string, string, error) {
+	t.Helper()
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(data), meta))
+	if err := r.Process(msg); err != nil {
+		return nil, "", err
+	}
+	outMeta, outData, err := msg.GetMetadataAndData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outMeta, string(outData), nil
+}
+
+func assertJSON(t *testing.T, got, want string) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal([]byte(got), &g); err != nil {
+		t.Fatalf("invalid output %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("output = %s, want %s", got, want)
+	}
+}
+
+const nested = `{"id":12345678901234567890,"device":{"name":"s1","loc":{"lat":45.1,"lon":9.2}},"tags":["a","b"],"readings":[{"t":1},{"t":2}],"empty":{},"none":[],"n":null}`
+
+func TestFormatRunner(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *RunnerConfig
+		payload string
+		want    string
+	}{
+		{
+			name:    "flatten index arrays",
+			cfg:     &RunnerConfig{Operation: opFlatten, Delimiter: ".", Arrays: arraysIndex},
+			payload: nested,
+			want:    `{"id":12345678901234567890,"device.name":"s1","device.loc.lat":45.1,"device.loc.lon":9.2,"tags.0":"a","tags.1":"b","readings.0.t":1,"readings.1.t":2,"empty":{},"none":[],"n":null}`,
+		},
+		{
+			name:    "flatten keep arrays with delimiter",
+			cfg:     &RunnerConfig{Operation: opFlatten, Delimiter: "_", Arrays: arraysKeep},
+			payload: nested,
+			want:    `{"id":12345678901234567890,"device_name":"s1","device_loc_lat":45.1,"device_loc_lon":9.2,"tags":["a","b"],"readings":[{"t":1},{"t":2}],"empty":{},"none":[],"n":null}`,
+		},
+		{
+			name:    "flatten join scalar arrays",
+			cfg:     &RunnerConfig{Operation: opFlatten, Delimiter: ".", Arrays: arraysJoin, ArraySeparator: "|"},
+			payload: nested,
+			want:    `{"id":12345678901234567890,"device.name":"s1","device.loc.lat":45.1,"device.loc.lon":9.2,"tags":"a|b","readings.0.t":1,"readings.1.t":2,"empty":{},"none":[],"n":null}`,
+		},
+		{
+			name:    "flatten max depth",
+			cfg:     &RunnerConfig{Operation: opFlatten, Delimiter: ".", Arrays: arraysIndex, MaxDepth: 2},
+			payload: nested,
+			want:    `{"id":12345678901234567890,"device.name":"s1","device.loc":{"lat":45.1,"lon":9.2},"tags.0":"a","tags.1":"b","readings.0":{"t":1},"readings.1":{"t":2},"empty":{},"none":[],"n":null}`,
+		},
+		{
+			name:    "unflatten round trip",
+			cfg:     &RunnerConfig{Operation: opUnflatten, Delimiter: ".", Arrays: arraysIndex},
+			payload: `{"id":12345678901234567890,"device.name":"s1","device.loc.lat":45.1,"device.loc.lon":9.2,"tags.0":"a","tags.1":"b","readings.0.t":1,"readings.1.t":2,"empty":{},"none":[],"n":null}`,
+			want:    nested,
+		},
+		{
+			// Keys that are not the indexes 0..n-1 stay object keys
+			name:    "unflatten arrays",
+			cfg:     &RunnerConfig{Operation: opUnflatten, Delimiter: "__", Arrays: arraysIndex},
+			payload: `[{"a__b":1,"a__c__0":"x","a__c__1":"y","m__0":1,"m__2":2},{"k":true}]`,
+			want:    `[{"a":{"b":1,"c":["x","y"]},"m":{"0":1,"2":2}},{"k":true}]`,
+		},
+		{
+			name:    "unflatten keep arrays",
+			cfg:     &RunnerConfig{Operation: opUnflatten, Delimiter: ".", Arrays: arraysKeep},
+			payload: `{"a.0":"x","a.1":"y"}`,
+			want:    `{"a":{"0":"x","1":"y"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRunner(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewRunner() unexpected error = %v", err)
+			}
+			_, out, err := processMsg(t, r, tt.payload, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, out, tt.want)
+			// Large integers are not rounded
+			if strings.Contains(tt.want, "12345678901234567890") && !strings.Contains(out, "12345678901234567890") {
+				t.Errorf("integer rounded: %s", out)
+			}
+		})
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	flatten := &RunnerConfig{Operation: opFlatten, Delimiter: ".", Arrays: arraysIndex}
+	unflatten := &RunnerConfig{Operation: opUnflatten, Delimiter: ".", Arrays: arraysIndex}
+	tests := []struct {
+		name    string
+		cfg     *RunnerConfig
+		payload string
+		err     string
+	}{
+		{"not JSON", flatten, `{`, "payload must be JSON"},
+		{"scalar", flatten, `42`, "must be a JSON object"},
+		{"array item", flatten, `[{"a":1},2]`, "payload item 1"},
+		{"duplicate flattened key", flatten, `{"a.b":1,"a":{"b":2}}`, `duplicate flattened key "a.b"`},
+		{"conflict", unflatten, `{"a":1,"a.b":2}`, `key "a.b" conflicts with the value of "a"`},
+		{"max input size", &RunnerConfig{Operation: opFlatten, Delimiter: ".", MaxInputSize: 4}, `{"a":1}`, "exceeds maximum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRunner(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewRunner() unexpected error = %v", err)
+			}
+			if _, _, err := processMsg(t, r, tt.payload, nil); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Process() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// minHedgeSamples is the number of latency samples required before the percentile is used
+const minHedgeSamples = 10
+
+// hedgeCost is the budget cost of a hedge, in percent of a request
+const hedgeCost = 100
+
+// maxHedgeBudget bounds the hedge budget accumulated while requests are fast
+const maxHedgeBudget = 10 * hedgeCost
+
+// HedgeConfig configures hedged requests: when a request has not completed within the
+// recent latency percentile, a second identical request is sent and the first response wins.
+// Hedging duplicates requests, so it should be enabled only for idempotent endpoints.
+type HedgeConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Percentile of the recent latencies used as hedge delay
+	Percentile float64 `mapstructure:"percentile" default:"95" validate:"gt=0,lt=100"`
+	// MinDelay is the lower bound of the hedge delay, and the delay used until enough latencies are sampled
+	MinDelay time.Duration `mapstructure:"minDelay" default:"50ms" validate:"min=0"`
+	// MaxDelay is the upper bound of the hedge delay (0 means unbounded)
+	MaxDelay time.Duration `mapstructure:"maxDelay" validate:"min=0"`
+	// Window is the number of recent latencies the percentile is computed on
+	Window int `mapstructure:"window" default:"100" validate:"min=1"`
+	// MaxExtraPercent caps the hedged requests as a percentage of the requests
+	MaxExtraPercent float64 `mapstructure:"maxExtraPercent" default:"10" validate:"min=0,max=100"`
+}
+
+// hedger tracks the recent latencies and the budget of extra requests
+type hedger struct {
+	cfg     HedgeConfig
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	budget  float64
+}
+
+func newHedger(cfg HedgeConfig) *hedger {
+	h := &hedger{cfg: cfg, samples: make([]time.Duration, 0, cfg.Window)}
+	// Start with a single hedge, so that a slow upstream is hedged from the first requests
+	if cfg.MaxExtraPercent > 0 {
+		h.budget = hedgeCost
+	}
+	return h
+}
+
+// observe records the latency of a completed request
+func (h *hedger) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < h.cfg.Window {
+		h.samples = append(h.samples, d)
+		return
+	}
+	h.samples[h.next] = d
+	h.next = (h.next + 1) % h.cfg.Window
+}
+
+// delay returns the percentile of the recent latencies, bounded by the configured delays
+func (h *hedger) delay() time.Duration {
+	h.mu.Lock()
+	if len(h.samples) < minHedgeSamples {
+		h.mu.Unlock()
+		return h.cfg.MinDelay
+	}
+	sorted := slices.Sorted(slices.Values(h.samples))
+	h.mu.Unlock()
+
+	idx := int(math.Ceil(h.cfg.Percentile/100*float64(len(sorted)))) - 1
+	d := max(sorted[max(idx, 0)], h.cfg.MinDelay)
+	if h.cfg.MaxDelay > 0 {
+		d = min(d, h.cfg.MaxDelay)
+	}
+	return d
+}
+
+// request credits the budget for a new request: every request earns its percentage of a hedge
+func (h *hedger) request() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.budget = min(h.budget+h.cfg.MaxExtraPercent, maxHedgeBudget)
+}
+
+// allow reports whether the budget allows a hedged request, consuming it
+func (h *hedger) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.budget < hedgeCost {
+		return false
+	}
+	h.budget -= hedgeCost
+	return true
+}
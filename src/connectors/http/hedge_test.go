@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func TestHedgerDelay(t *testing.T) {
+	h := newHedger(HedgeConfig{Percentile: 90, MinDelay: 5 * time.Millisecond, MaxDelay: 80 * time.Millisecond, Window: 10})
+	if d := h.delay(); d != 5*time.Millisecond {
+		t.Errorf("expected min delay without samples, got %v", d)
+	}
+	for i := 1; i <= 10; i++ {
+		h.observe(time.Duration(i) * 10 * time.Millisecond)
+	}
+	if d := h.delay(); d != 80*time.Millisecond {
+		t.Errorf("expected delay bounded by max delay, got %v", d)
+	}
+	// The window keeps the most recent samples only
+	for range 10 {
+		h.observe(20 * time.Millisecond)
+	}
+	if d := h.delay(); d != 20*time.Millisecond {
+		t.Errorf("expected p90 of the recent samples, got %v", d)
+	}
+}
+
+func TestHedgerBudget(t *testing.T) {
+	h := newHedger(HedgeConfig{Window: 10, MaxExtraPercent: 10})
+	if !h.allow() {
+		t.Fatal("expected the initial hedge to be allowed")
+	}
+	if h.allow() {
+		t.Fatal("expected the budget to be exhausted")
+	}
+	for range 9 {
+		h.request()
+		if h.allow() {
+			t.Fatal("expected no hedge before 10 requests")
+		}
+	}
+	h.request()
+	if !h.allow() {
+		t.Error("expected a hedge every 10 requests")
+	}
+
+	if newHedger(HedgeConfig{Window: 10}).allow() {
+		t.Error("expected no hedges with a zero budget")
+	}
+}
+
+func TestHTTPRunnerHedgedRequest(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			time.Sleep(500 * time.Millisecond)
+			w.Write([]byte("slow")) //nolint:errcheck
+			return
+		}
+		w.Write([]byte("fast")) //nolint:errcheck
+	}))
+	defer ts.Close()
+
+	cfg := mustParseRunnerConfig(t, map[string]any{
+		"method":  "GET",
+		"url":     ts.URL,
+		"timeout": "1s",
+		"hedge":   map[string]any{"enabled": true, "minDelay": "20ms"},
+	})
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf(httpRunnerErrCreate, err)
+	}
+	defer r.Close() //nolint:errcheck
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter(nil, nil))
+	start := time.Now()
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("unexpected error processing: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("expected the hedged response before the slow one, took %v", elapsed)
+	}
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		t.Fatalf("unexpected error getting message data: %v", err)
+	}
+	if string(data) != "fast" || meta["eb-hedged"] != "true" {
+		t.Errorf("expected hedged fast response, got %q %v", data, meta)
+	}
+
+	// The budget is exhausted: the next slow request is not hedged
+	calls.Store(0)
+	msg = message.NewRunnerMessage(testutil.NewAdapter(nil, nil))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("unexpected error processing: %v", err)
+	}
+	if meta, data, _ := msg.GetMetadataAndData(); string(data) != "slow" || meta["eb-hedged"] != "" {
+		t.Errorf("expected unhedged slow response, got %q %v", data, meta)
+	}
+}
@@ -12,6 +12,8 @@ type HTTPMessage struct {
 	done     chan message.ResponseStatus
 	reply    chan *message.ReplyData
 	metadata map[string]string
+	// data replaces the request body, e.g. with the unwrapped webhook event
+	data []byte
 }
 
 func (m *HTTPMessage) GetID() []byte {
@@ -24,6 +26,9 @@ func (m HTTPMessage) GetMetadata() (map[string]string, error) {
 }
 
 func (m HTTPMessage) GetData() ([]byte, error) {
+	if m.data != nil {
+		return m.data, nil
+	}
 	return m.httpCtx.Request.Body(), nil
 }
 
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
+	neturl "net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/sandrolain/events-bridge/src/common/credentials"
+	"github.com/sandrolain/events-bridge/src/common/endpoints"
+	"github.com/sandrolain/events-bridge/src/common/httpretry"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
 	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
@@ -17,12 +24,29 @@ var _ connectors.Runner = (*HTTPRunner)(nil)
 
 // HTTPRunnerConfig holds configuration for the HTTP runner.
 // It mirrors the style of the HTTP source/runner configs.
+// Method, URL and the header values are Go templates (with sprig functions) when they contain
+// "{{", executed for every message with "metadata" and "data" (the decoded JSON payload, or
+// the payload string).
 type HTTPRunnerConfig struct {
-	Method  string            `mapstructure:"method" default:"POST" validate:"required,oneof=GET POST PUT DELETE PATCH HEAD OPTIONS"`
-	URL     string            `mapstructure:"url" validate:"required,url"`
+	// Method is one of GET, POST, PUT, DELETE, PATCH, HEAD and OPTIONS
+	Method  string            `mapstructure:"method" default:"POST" validate:"required"`
+	URL     string            `mapstructure:"url" validate:"required"`
 	Headers map[string]string `mapstructure:"headers"`
 	Timeout time.Duration     `mapstructure:"timeout" default:"5s" validate:"gt=0"`
 	TLS     tlsconfig.Config  `mapstructure:"tls"`
+	// Status maps the response status codes to success, retryable or permanent failures
+	Status StatusConfig `mapstructure:"status"`
+	// Credentials configures rotating credentials (static, file, vault or oauth2) sent in the
+	// Authorization header of every request: a bearer token, or basic auth for username and password
+	Credentials *credentials.Config `mapstructure:"credentials"`
+	// Hedge configures hedged requests against the tail latency of the upstream
+	Hedge HedgeConfig `mapstructure:"hedge"`
+	// Endpoints balances the requests across a dynamic, health-checked endpoint list: the
+	// scheme and host of URL are replaced by the base URL of the picked endpoint
+	Endpoints *endpoints.Config `mapstructure:"endpoints"`
+	// RefHeader sends the reference of a remote payload not fetched yet in this header, with an
+	// empty body, instead of fetching the payload, for receivers reading the same store
+	RefHeader string `mapstructure:"refHeader"`
 }
 
 // NewRunnerConfig returns a new HTTPRunnerConfig instance (exported for plugin loading conventions).
@@ -41,6 +65,15 @@ func NewRunner(anyCfg any) (connectors.Runner, error) { //nolint:revive
 		cfg.Method = "POST"
 	}
 
+	request, err := newRequestTemplate(cfg)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := newStatusMap(cfg.Status)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build TLS config if enabled
 	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(&cfg.TLS)
 	if err != nil {
@@ -60,44 +93,104 @@ func NewRunner(anyCfg any) (connectors.Runner, error) { //nolint:revive
 		}).Dial,
 	}
 
-	return &HTTPRunner{
-		cfg:    cfg,
-		slog:   slog.Default().With("context", "HTTP Runner"),
-		client: client,
-	}, nil
+	l := slog.Default().With("context", "HTTP Runner")
+	var creds *credentials.Provider
+	if cfg.Credentials != nil {
+		creds, err = credentials.New(cfg.Credentials, l)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create credentials provider: %w", err)
+		}
+	}
+
+	var h *hedger
+	if cfg.Hedge.Enabled {
+		h = newHedger(cfg.Hedge)
+	}
+
+	var registry *endpoints.Registry
+	if cfg.Endpoints != nil {
+		registry, err = endpoints.New(cfg.Endpoints, l)
+		if err != nil {
+			if creds != nil {
+				creds.Close()
+			}
+			return nil, fmt.Errorf("failed to create endpoints registry: %w", err)
+		}
+	}
+
+	runner := &HTTPRunner{
+		cfg:       cfg,
+		slog:      l,
+		client:    client,
+		creds:     creds,
+		hedger:    h,
+		endpoints: registry,
+		request:   request,
+		statuses:  statuses,
+	}
+	// There is no connection to establish: the state follows the outcome of the requests
+	runner.SetState(connectors.StateConnected)
+	return runner, nil
 }
 
+// Ensure HTTPRunner implements connectors.StatusReporter
+var _ connectors.StatusReporter = &HTTPRunner{}
+
 // HTTPRunner implements a simple HTTP request transformation step.
 // It sends the current message payload as the request body (for all methods) and, if successful,
 // optionally overwrites the payload with the response body.
 type HTTPRunner struct {
-	cfg    *HTTPRunnerConfig
-	slog   *slog.Logger
-	client *fasthttp.Client
+	connectors.StatusTracker
+
+	cfg       *HTTPRunnerConfig
+	slog      *slog.Logger
+	client    *fasthttp.Client
+	creds     *credentials.Provider
+	hedger    *hedger
+	endpoints *endpoints.Registry
+	request   *requestTemplate
+	statuses  *statusMap
 }
 
 // Process executes the configured HTTP request.
 func (r *HTTPRunner) Process(msg *message.RunnerMessage) error {
-	metadata, data, err := msg.GetMetadataAndData()
+	metadata, err := msg.GetMetadata()
 	if err != nil {
-		return fmt.Errorf("error getting metadata and data: %w", err)
+		return fmt.Errorf("error getting metadata: %w", err)
+	}
+	var data []byte
+	ref, isRef := "", false
+	if r.cfg.RefHeader != "" {
+		ref, isRef = message.PayloadRef(msg)
+	}
+	if !isRef {
+		if data, err = msg.GetData(); err != nil {
+			return fmt.Errorf("error getting data: %w", err)
+		}
 	}
 
-	method := strings.ToUpper(r.cfg.Method)
-	url := r.cfg.URL
+	method, url, headers, err := r.request.render(r.cfg, metadata, data)
+	if err != nil {
+		return err
+	}
+	var endpoint string
+	if r.endpoints != nil {
+		if endpoint, err = r.endpoints.Pick(); err != nil {
+			return fmt.Errorf("error picking endpoint: %w", err)
+		}
+		url = endpointURL(endpoint, url)
+	}
 
 	r.slog.Debug("executing HTTP runner request", "method", method, "url", url, "metadata", metadata, "bodysize", len(data))
 
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
-	res := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(res)
 
 	req.Header.SetMethod(method)
 	req.SetRequestURI(url)
 
 	// Add custom headers from config first
-	for k, v := range r.cfg.Headers {
+	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
 
@@ -106,24 +199,45 @@ func (r *HTTPRunner) Process(msg *message.RunnerMessage) error {
 		req.Header.Add(k, v)
 	}
 
+	if isRef {
+		req.Header.Set(r.cfg.RefHeader, ref)
+	}
+
+	// Set the current credentials last, so that they cannot be overridden by metadata
+	if r.creds != nil {
+		setAuthorization(&req.Header, r.creds.Current())
+	}
+
 	// Set body (even for GET etc., mirroring runner behavior; caller controls method semantics)
 	if len(data) > 0 {
 		req.SetBody(data)
 	}
 
-	if r.cfg.Timeout > 0 {
-		err = r.client.DoTimeout(req, res, r.cfg.Timeout)
-	} else {
-		err = r.client.Do(req, res)
-	}
+	res, hedged, err := r.do(req)
 	if err != nil {
+		r.SetState(connectors.StateDisconnected)
+		r.RecordError(err)
 		return fmt.Errorf("error performing HTTP request: %w", err)
 	}
+	defer fasthttp.ReleaseResponse(res)
+	r.SetState(connectors.StateConnected)
 
 	status := res.StatusCode()
-	if status > 299 { // treat non 2xx as failure (similar to runner)
-		return fmt.Errorf("non-2XX status code: %d", status)
+	if outcome := r.statuses.outcome(status); outcome != statusSuccess {
+		var err error = &statusError{status: status, outcome: outcome}
+		// Throttled or unavailable upstreams advertise when to come back: the hint pauses the runner
+		if outcome != statusPermanent && (status == fasthttp.StatusTooManyRequests || status == fasthttp.StatusServiceUnavailable) {
+			if delay, ok := httpretry.ParseRetryAfter(string(res.Header.Peek(fasthttp.HeaderRetryAfter)), time.Now()); ok {
+				err = &connectors.RetryAfterError{Delay: delay, Err: err}
+			}
+		}
+		r.RecordError(err)
+		if outcome == statusRetryable {
+			return &connectors.NakError{Err: err}
+		}
+		return err
 	}
+	r.RecordMessage()
 
 	r.slog.Debug("HTTP runner request completed", "status", status, "resbodysize", len(res.Body()))
 
@@ -136,6 +250,12 @@ func (r *HTTPRunner) Process(msg *message.RunnerMessage) error {
 		respHeaders[key] = string(v)
 	}
 	respHeaders["eb-status"] = fmt.Sprintf("%d", status)
+	if hedged {
+		respHeaders["eb-hedged"] = "true"
+	}
+	if endpoint != "" {
+		respHeaders["eb-endpoint"] = endpoint
+	}
 	msg.MergeMetadata(respHeaders)
 
 	bodyCopy := append([]byte(nil), res.Body()...) // copy to detach from fasthttp buffer
@@ -144,8 +264,154 @@ func (r *HTTPRunner) Process(msg *message.RunnerMessage) error {
 	return nil
 }
 
+// statusError is the error of a failed response, with the status as error code
+type statusError struct {
+	status  int
+	outcome string
+}
+
+func (e *statusError) Error() string {
+	if e.status >= 200 && e.status <= 299 {
+		return fmt.Sprintf("unexpected status code: %d", e.status)
+	}
+	return fmt.Sprintf("non-2XX status code: %d", e.status)
+}
+
+// ErrorCode implements message.CodedError
+func (e *statusError) ErrorCode() string {
+	return "http_" + strconv.Itoa(e.status)
+}
+
+// Retryable implements message.RetryableError: the mapped statuses follow their mapping,
+// otherwise timeouts, throttling and server errors are transient
+func (e *statusError) Retryable() bool {
+	switch e.outcome {
+	case statusRetryable:
+		return true
+	case statusPermanent:
+		return false
+	}
+	return e.status == fasthttp.StatusRequestTimeout || e.status == fasthttp.StatusTooManyRequests || e.status >= 500
+}
+
+// do performs the request, hedging it when enabled; the caller releases the returned response
+func (r *HTTPRunner) do(req *fasthttp.Request) (*fasthttp.Response, bool, error) {
+	if r.hedger != nil {
+		return r.doHedged(req)
+	}
+	res := fasthttp.AcquireResponse()
+	if err := r.send(req, res); err != nil {
+		fasthttp.ReleaseResponse(res)
+		return nil, false, err
+	}
+	return res, false, nil
+}
+
+func (r *HTTPRunner) send(req *fasthttp.Request, res *fasthttp.Response) error {
+	if r.cfg.Timeout > 0 {
+		return r.client.DoTimeout(req, res, r.cfg.Timeout)
+	}
+	return r.client.Do(req, res)
+}
+
+type attemptResult struct {
+	res *fasthttp.Response
+	err error
+}
+
+// doHedged sends the request and, if it has not completed within the hedge delay and the
+// budget allows it, a second copy of it. The first response wins; a failed attempt waits
+// for the other one. It reports whether the request was hedged.
+func (r *HTTPRunner) doHedged(req *fasthttp.Request) (*fasthttp.Response, bool, error) {
+	r.hedger.request()
+	results := make(chan attemptResult, 2)
+	launch := func() {
+		// Every attempt sends its own copy, as the caller releases the request on return
+		attemptReq := fasthttp.AcquireRequest()
+		req.CopyTo(attemptReq)
+		go func() {
+			defer fasthttp.ReleaseRequest(attemptReq)
+			start := time.Now()
+			res := fasthttp.AcquireResponse()
+			err := r.send(attemptReq, res)
+			if err == nil {
+				r.hedger.observe(time.Since(start))
+			}
+			results <- attemptResult{res: res, err: err}
+		}()
+	}
+
+	launch()
+	pending, hedged := 1, false
+	timer := time.NewTimer(r.hedger.delay())
+	defer timer.Stop()
+	var errs []error
+	for {
+		select {
+		case <-timer.C:
+			if !r.hedger.allow() {
+				r.slog.Debug("hedge budget exhausted, waiting for the request")
+				continue
+			}
+			r.slog.Debug("sending hedged request")
+			launch()
+			pending++
+			hedged = true
+		case a := <-results:
+			pending--
+			if a.err == nil {
+				if pending > 0 {
+					go releaseResults(results, pending)
+				}
+				return a.res, hedged, nil
+			}
+			fasthttp.ReleaseResponse(a.res)
+			errs = append(errs, a.err)
+			if pending == 0 {
+				return nil, hedged, errors.Join(errs...)
+			}
+		}
+	}
+}
+
+// releaseResults releases the responses of the attempts that lost the race
+func releaseResults(results <-chan attemptResult, n int) {
+	for range n {
+		fasthttp.ReleaseResponse((<-results).res)
+	}
+}
+
+// endpointURL replaces the scheme and host of the request URL with the endpoint base URL,
+// keeping the path and the query of the request URL after the base URL path
+func endpointURL(endpoint, rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return endpoint
+	}
+	res := endpoint + u.EscapedPath()
+	if u.RawQuery != "" {
+		res += "?" + u.RawQuery
+	}
+	return res
+}
+
+// setAuthorization sets the Authorization header from the credentials
+func setAuthorization(h *fasthttp.RequestHeader, c credentials.Credentials) {
+	if c.HasToken() {
+		h.Set(fasthttp.HeaderAuthorization, "Bearer "+c.Token)
+		return
+	}
+	h.Set(fasthttp.HeaderAuthorization, "Basic "+base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password)))
+}
+
 // Close releases underlying resources (currently no-op besides future extensibility).
 func (r *HTTPRunner) Close() error { //nolint:revive
 	r.slog.Info("closing http runner")
+	if r.creds != nil {
+		r.creds.Close()
+	}
+	if r.endpoints != nil {
+		r.endpoints.Close()
+	}
 	return nil
 }
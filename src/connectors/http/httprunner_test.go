@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
 	"github.com/sandrolain/events-bridge/src/testutil"
 	"github.com/sandrolain/events-bridge/src/utils"
@@ -144,3 +146,343 @@ func TestHTTPRunnerTimeout(t *testing.T) {
 		t.Fatalf("expected timeout error")
 	}
 }
+
+func TestHTTPRunnerCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer rotated-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	t.Setenv("EB_TEST_HTTP_TOKEN", "rotated-token")
+	cfg := mustParseRunnerConfig(t, map[string]any{
+		"url":         ts.URL,
+		"credentials": map[string]any{"type": "static", "token": "env:EB_TEST_HTTP_TOKEN"},
+	})
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf(httpRunnerErrCreate, err)
+	}
+	defer r.Close() //nolint:errcheck
+
+	// Metadata cannot override the credentials
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{}`), map[string]string{"Authorization": "Bearer forged"}))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("unexpected error processing: %v", err)
+	}
+}
+
+func TestHTTPRunnerRetryAfter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/unavailable" {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Retry-After", "3")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		path  string
+		delay time.Duration
+		ok    bool
+	}{
+		{"/throttled", 3 * time.Second, true},
+		{"/unavailable", 0, false},
+	}
+	for _, tt := range tests {
+		r, err := NewRunner(mustParseRunnerConfig(t, map[string]any{"url": ts.URL + tt.path, "timeout": "1s"}))
+		if err != nil {
+			t.Fatalf(httpRunnerErrCreate, err)
+		}
+		err = r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("x"), nil)))
+		if err == nil {
+			t.Fatalf("%s: expected error", tt.path)
+		}
+		delay, ok := connectors.RetryAfter(err)
+		if delay != tt.delay || ok != tt.ok {
+			t.Errorf("%s: RetryAfter() = %v, %v (error %v)", tt.path, delay, ok, err)
+		}
+		if rec := message.NewErrorRecord("runner[0]", err); !rec.Retryable || !strings.HasPrefix(rec.Code, "http_") {
+			t.Errorf("%s: error record = %+v", tt.path, rec)
+		}
+	}
+}
+
+func TestHTTPRunnerEndpoints(t *testing.T) {
+	newServer := func(name string, healthy bool) *httptest.Server {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" {
+				if !healthy {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+				return
+			}
+			fmt.Fprintf(w, "%s %s?%s", name, r.URL.Path, r.URL.RawQuery)
+		}))
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	a, b, down := newServer("a", true), newServer("b", true), newServer("down", false)
+
+	cfg := mustParseRunnerConfig(t, map[string]any{
+		"url": "http://consumers.local/ingest?v=1",
+		"endpoints": map[string]any{
+			"type":        "static",
+			"endpoints":   []string{a.URL, b.URL, down.URL},
+			"healthCheck": map[string]any{"interval": "1h"},
+		},
+	})
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf(httpRunnerErrCreate, err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	seen := map[string]string{}
+	for range 4 {
+		msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("x"), nil))
+		if err := r.Process(msg); err != nil {
+			t.Fatalf("Process() unexpected error = %v", err)
+		}
+		data, _ := msg.GetData()
+		meta, _ := msg.GetMetadata()
+		seen[string(data)] = meta["eb-endpoint"]
+	}
+	if len(seen) != 2 || seen["a /ingest?v=1"] != a.URL || seen["b /ingest?v=1"] != b.URL {
+		t.Errorf("unexpected responses %v", seen)
+	}
+}
+
+func TestHTTPRunnerConnectorStatus(t *testing.T) {
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	r, err := NewRunner(mustParseRunnerConfig(t, map[string]any{"url": ts.URL, "timeout": "1s"}))
+	if err != nil {
+		t.Fatalf(httpRunnerErrCreate, err)
+	}
+	runner := r.(*HTTPRunner)
+	process := func() error {
+		return runner.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("x"), nil)))
+	}
+
+	steps := []struct {
+		name    string
+		setup   func()
+		wantErr bool
+		want    connectors.ConnectionState
+	}{
+		{"delivered", func() {}, false, connectors.StateConnected},
+		{"error status", func() { status = http.StatusBadRequest }, true, connectors.StateConnected},
+		{"unreachable", ts.Close, true, connectors.StateDisconnected},
+	}
+	for _, step := range steps {
+		step.setup()
+		if err := process(); (err != nil) != step.wantErr {
+			t.Fatalf("%s: Process() error = %v", step.name, err)
+		}
+		got := runner.ConnectorStatus()
+		if got.State != step.want || got.LastMessageAt.IsZero() || (step.wantErr && got.LastError == "") {
+			t.Errorf("%s: status = %+v, want %s", step.name, got, step.want)
+		}
+	}
+}
+
+func TestEndpointURL(t *testing.T) {
+	for raw, want := range map[string]string{
+		"http://svc.local/ingest?v=1": "https://10.0.0.1:8443/api/ingest?v=1",
+		"http://svc.local":            "https://10.0.0.1:8443/api",
+		"http://svc.local/a%2Fb":      "https://10.0.0.1:8443/api/a%2Fb",
+	} {
+		if got := endpointURL("https://10.0.0.1:8443/api", raw); got != want {
+			t.Errorf("endpointURL(%s) = %s, want %s", raw, got, want)
+		}
+	}
+}
+
+// refMessage is a source message whose payload is kept in a remote store
+type refMessage struct {
+	*testutil.Adapter
+	ref string
+}
+
+func (m *refMessage) GetData() ([]byte, error) {
+	return nil, fmt.Errorf("payload fetched")
+}
+
+func (m *refMessage) PayloadRef() (string, bool) {
+	return m.ref, true
+}
+
+func TestHTTPRunnerRefHeader(t *testing.T) {
+	var gotRef string
+	var gotLength int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRef, gotLength = r.Header.Get("X-Payload-Ref"), r.ContentLength
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	r, err := NewRunner(mustParseRunnerConfig(t, map[string]any{"url": ts.URL, "refHeader": "X-Payload-Ref"}))
+	if err != nil {
+		t.Fatalf(httpRunnerErrCreate, err)
+	}
+	msg := message.NewRunnerMessage(&refMessage{Adapter: testutil.NewAdapter(nil, nil), ref: "s3://bucket/in/a.pdf"})
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("unexpected error processing: %v", err)
+	}
+	if gotRef != "s3://bucket/in/a.pdf" || gotLength != 0 {
+		t.Errorf("expected the reference without body, got ref %q and content length %d", gotRef, gotLength)
+	}
+}
+
+func TestHTTPRunnerTemplates(t *testing.T) {
+	type request struct{ method, path, tenant, auth string }
+	var got []request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, request{r.Method, r.URL.RequestURI(), r.Header.Get("X-Tenant"), r.Header.Get("X-Static")})
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	r, err := NewRunner(mustParseRunnerConfig(t, map[string]any{
+		"method": `{{ if .data.deleted }}DELETE{{ else }}put{{ end }}`,
+		"url":    ts.URL + `/orders/{{ .data.id | urlquery }}?source={{ .metadata.source }}`,
+		"headers": map[string]any{
+			"X-Tenant": "{{ .metadata.tenant | upper }}",
+			"X-Static": "fixed",
+		},
+	}))
+	if err != nil {
+		t.Fatalf(httpRunnerErrCreate, err)
+	}
+	for _, data := range []string{`{"id":"a 1"}`, `{"id":7,"deleted":true}`} {
+		msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(data), map[string]string{"tenant": "acme", "source": "erp"}))
+		if err := r.Process(msg); err != nil {
+			t.Fatalf("Process() unexpected error = %v", err)
+		}
+	}
+	want := []request{
+		{"PUT", "/orders/a+1?source=erp", "ACME", "fixed"},
+		{"DELETE", "/orders/7?source=erp", "ACME", "fixed"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+
+	// The rendered values are validated
+	r, err = NewRunner(mustParseRunnerConfig(t, map[string]any{"method": "{{ .metadata.method }}", "url": "{{ .metadata.url }}"}))
+	if err != nil {
+		t.Fatalf(httpRunnerErrCreate, err)
+	}
+	for _, meta := range []map[string]string{
+		{"method": "TRACE", "url": ts.URL},
+		{"method": "GET", "url": "ftp://files.local/x"},
+	} {
+		if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter(nil, meta))); err == nil {
+			t.Errorf("Process(%v) expected error", meta)
+		}
+	}
+}
+
+func TestHTTPRunnerConfigValidation(t *testing.T) {
+	for _, opts := range []map[string]any{
+		{"url": "not a url"},
+		{"url": "http://localhost", "method": "TRACE"},
+		{"url": "http://localhost/{{ .metadata.id"},
+		{"url": "http://localhost", "headers": map[string]any{"X-Id": "{{ .data"}},
+		{"url": "http://localhost", "status": map[string]any{"retryable": []any{"6xx"}}},
+		{"url": "http://localhost", "status": map[string]any{"permanent": []any{"504-500"}}},
+	} {
+		if _, err := NewRunner(mustParseRunnerConfig(t, opts)); err == nil {
+			t.Errorf("NewRunner(%v) expected error", opts)
+		}
+	}
+}
+
+func TestHTTPRunnerStatusMapping(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := 200
+		fmt.Sscan(strings.TrimPrefix(r.URL.Path, "/"), &code) //nolint:errcheck
+		if code == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "3")
+		}
+		w.WriteHeader(code)
+		fmt.Fprint(w, "body") //nolint:errcheck
+	}))
+	defer ts.Close()
+
+	r, err := NewRunner(mustParseRunnerConfig(t, map[string]any{
+		"url": ts.URL + "/{{ .metadata.code }}",
+		"status": map[string]any{
+			"success":   []any{"2xx", 404},
+			"retryable": []any{"500-503", "409"},
+			"permanent": []any{"5xx", "429"},
+		},
+	}))
+	if err != nil {
+		t.Fatalf(httpRunnerErrCreate, err)
+	}
+	tests := []struct {
+		code      string
+		wantErr   bool
+		nak       bool
+		retryable bool
+		delay     time.Duration
+	}{
+		{"202", false, false, false, 0},
+		{"404", false, false, false, 0},
+		{"409", true, true, true, 0},
+		{"503", true, true, true, 3 * time.Second},
+		{"504", true, false, false, 0},
+		{"429", true, false, false, 0},
+		{"400", true, false, false, 0},
+		{"408", true, false, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			msg := message.NewRunnerMessage(testutil.NewAdapter(nil, map[string]string{"code": tt.code}))
+			err := r.Process(msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Process() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				meta, _ := msg.GetMetadata()
+				if meta["eb-status"] != tt.code {
+					t.Errorf("eb-status = %q", meta["eb-status"])
+				}
+				return
+			}
+			if connectors.Nak(err) != tt.nak {
+				t.Errorf("Nak(%v) = %v, want %v", err, !tt.nak, tt.nak)
+			}
+			if rec := message.NewErrorRecord("runner[0]", err); rec.Retryable != tt.retryable || rec.Code != "http_"+tt.code {
+				t.Errorf("error record = %+v", rec)
+			}
+			if delay, _ := connectors.RetryAfter(err); delay != tt.delay {
+				t.Errorf("retry after = %v, want %v", delay, tt.delay)
+			}
+		})
+	}
+}
+
+func TestParseStatusRanges(t *testing.T) {
+	ranges, err := parseStatusRanges([]string{"4XX", " 500 - 502 ", "201"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ranges) != "[{400 499} {500 502} {201 201}]" {
+		t.Errorf("ranges = %v", ranges)
+	}
+	for _, v := range []string{"abc", "99", "600", "2x", "x00"} {
+		if _, err := parseStatusRanges([]string{v}); err == nil {
+			t.Errorf("parseStatusRanges(%q) expected error", v)
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"crypto/subtle"
 	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
 	"strconv"
 	"strings"
@@ -13,6 +15,7 @@ import (
 	"time"
 
 	"github.com/sandrolain/events-bridge/src/common/jwtauth"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
 	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
@@ -35,9 +38,16 @@ type SourceConfig struct {
 	// Timeout is the maximum duration for request processing
 	Timeout time.Duration `mapstructure:"timeout" default:"5s" validate:"required"`
 
-	// TLS configuration
+	// TLS configuration; with clientAuth VerifyClientCertIfGiven or RequireAndVerifyClientCert
+	// the client certificates are verified against caCertFile (mTLS)
 	TLS tlsconfig.Config `mapstructure:"tls"`
 
+	// Listener timeouts and limits
+	Listener ListenerConfig `mapstructure:"listener"`
+
+	// CORS policy for browser clients (optional)
+	CORS CORSConfig `mapstructure:"cors"`
+
 	// MaxBodySize limits the maximum request body size in bytes (default: 10MB)
 	MaxBodySize int64 `mapstructure:"maxBodySize" default:"10485760" validate:"gt=0"`
 
@@ -49,6 +59,13 @@ type SourceConfig struct {
 
 	// JWT authentication configuration (optional)
 	JWT *jwtauth.Config `mapstructure:"jwt"`
+
+	// Replay protection configuration for webhooks (optional)
+	Replay ReplayConfig `mapstructure:"replay"`
+
+	// Webhook provider preset (optional): signature scheme and event envelope of Stripe, GitHub or Shopify.
+	// With replay protection enabled, the provider delivery id is used as idempotency key.
+	Webhook WebhookConfig `mapstructure:"webhook"`
 }
 
 // AuthConfig defines authentication settings for the HTTP source.
@@ -94,6 +111,9 @@ func NewSource(anyCfg any) (connectors.Source, error) {
 	if !ok {
 		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
 	}
+	if err := validateListener(cfg); err != nil {
+		return nil, err
+	}
 
 	var limiter *rate.Limiter
 	if cfg.RateLimit.Enabled {
@@ -108,16 +128,52 @@ func NewSource(anyCfg any) (connectors.Source, error) {
 		return nil, fmt.Errorf("failed to create JWT authenticator: %w", err)
 	}
 
+	var dedup *dedupStore
+	var signatureSecret []byte
+	if cfg.Replay.Enabled {
+		dedup = newDedupStore(cfg.Replay.TTL, cfg.Replay.MaxEntries)
+		if cfg.Replay.Signature.Header != "" {
+			secret, err := secrets.Resolve(cfg.Replay.Signature.Secret)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve signature secret: %w", err)
+			}
+			if secret == "" {
+				return nil, errors.New("signature secret is required with the signature header")
+			}
+			signatureSecret = []byte(secret)
+		}
+	}
+
+	var webhookSecret []byte
+	if cfg.Webhook.Provider != "" {
+		secret, err := secrets.Resolve(cfg.Webhook.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve webhook secret: %w", err)
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("webhook secret is required for provider %s", cfg.Webhook.Provider)
+		}
+		webhookSecret = []byte(secret)
+	}
+
 	return &HTTPSource{
-		cfg:     cfg,
-		slog:    logger,
-		limiter: limiter,
-		jwtAuth: jwtAuth,
+		cfg:             cfg,
+		slog:            logger,
+		limiter:         limiter,
+		jwtAuth:         jwtAuth,
+		dedup:           dedup,
+		webhookSecret:   webhookSecret,
+		signatureSecret: signatureSecret,
 	}, nil
 }
 
+// Ensure HTTPSource implements connectors.StatusReporter
+var _ connectors.StatusReporter = &HTTPSource{}
+
 // HTTPSource implements the HTTP source connector.
 type HTTPSource struct {
+	connectors.StatusTracker
+
 	cfg      *SourceConfig
 	slog     *slog.Logger
 	c        chan *message.RunnerMessage
@@ -125,6 +181,10 @@ type HTTPSource struct {
 	limiter  *rate.Limiter
 	authMu   sync.RWMutex
 	jwtAuth  *jwtauth.Authenticator
+	dedup    *dedupStore
+
+	webhookSecret   []byte
+	signatureSecret []byte
 }
 
 // Produce starts the HTTP server and returns a channel for incoming messages.
@@ -153,9 +213,12 @@ func (s *HTTPSource) Produce(buffer int) (res <-chan *message.RunnerMessage, err
 		s.listener = listener
 	}
 
+	s.SetState(connectors.StateConnected)
 	go func() {
-		e = fasthttp.Serve(s.listener, s.handleRequest)
-		if e != nil {
+		e := s.newServer().Serve(s.listener)
+		s.SetState(connectors.StateDisconnected)
+		if e != nil && !errors.Is(e, net.ErrClosed) {
+			s.RecordError(e)
 			s.slog.Error("HTTP server error", "error", e)
 		}
 	}()
@@ -171,6 +234,11 @@ func (s *HTTPSource) handleRequest(ctx *fasthttp.RequestCtx) {
 
 	s.slog.Debug("received HTTP request", "method", method, "path", path)
 
+	// Apply the CORS policy, answering preflight requests
+	if s.cfg.CORS.Enabled && !s.handleCORS(ctx) {
+		return
+	}
+
 	// Check rate limit
 	if s.limiter != nil && !s.limiter.Allow() {
 		ctx.SetStatusCode(fasthttp.StatusTooManyRequests)
@@ -224,6 +292,31 @@ func (s *HTTPSource) handleRequest(ctx *fasthttp.RequestCtx) {
 		}
 	}
 
+	// Verify and unwrap provider webhooks if configured
+	var data []byte
+	var deliveryKey string
+	if s.cfg.Webhook.Provider != "" {
+		event := s.checkWebhook(ctx)
+		if event == nil {
+			return
+		}
+		maps.Copy(metadata, event.metadata(s.cfg.Webhook.Provider))
+		data = event.Payload
+		if event.Delivery != "" {
+			deliveryKey = s.cfg.Webhook.Provider + ":" + event.Delivery
+		}
+	}
+
+	// Verify signature and reject replays if configured
+	var replayKey string
+	if s.dedup != nil {
+		key, ok := s.checkReplay(ctx, deliveryKey)
+		if !ok {
+			return
+		}
+		replayKey = key
+	}
+
 	done := make(chan message.ResponseStatus, 1)
 	reply := make(chan *message.ReplyData, 1)
 
@@ -232,12 +325,18 @@ func (s *HTTPSource) handleRequest(ctx *fasthttp.RequestCtx) {
 		done:     done,
 		reply:    reply,
 		metadata: metadata,
+		data:     data,
 	}
 
+	s.RecordMessage()
 	s.c <- message.NewRunnerMessage(msg)
 
 	// Wait for Ack/Nak or reply
 	s.processResponse(ctx, done, reply)
+
+	if replayKey != "" {
+		s.completeReplay(ctx, replayKey)
+	}
 }
 
 // extractMetadata extracts HTTP headers and request info as metadata.
@@ -257,6 +356,7 @@ func (s *HTTPSource) extractMetadata(ctx *fasthttp.RequestCtx) map[string]string
 	}
 	metadata["method"] = string(ctx.Method())
 	metadata["path"] = string(ctx.Path())
+	tlsClientMetadata(ctx.TLSConnectionState(), metadata)
 	return metadata
 }
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/utils"
 )
 
@@ -37,10 +38,21 @@ func TestHTTPSourceProduceAndClose(t *testing.T) {
 	if ch == nil {
 		t.Fatal("expected non-nil channel")
 	}
+	if status := httpSrc.ConnectorStatus(); status.State != connectors.StateConnected {
+		t.Errorf("status = %+v, want connected while listening", status)
+	}
 	time.Sleep(10 * time.Millisecond)
 	if err := httpSrc.Close(); err != nil {
 		t.Fatalf(httpErrUnexpectedClose, err)
 	}
+	// The listener closed by Close is not an error
+	deadline := time.Now().Add(time.Second)
+	for httpSrc.ConnectorStatus().State != connectors.StateDisconnected && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if status := httpSrc.ConnectorStatus(); status.State != connectors.StateDisconnected || status.LastError != "" {
+		t.Errorf("status = %+v, want disconnected without error after Close", status)
+	}
 }
 
 func TestHTTPSourceProduceErrorOnListen(t *testing.T) {
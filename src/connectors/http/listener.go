@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// metaTLSClientSubject and metaTLSClientCN hold the verified client certificate of mTLS requests
+	metaTLSClientSubject = "eb-tls-client-subject"
+	metaTLSClientCN      = "eb-tls-client-cn"
+)
+
+// ListenerConfig hardens the HTTP server for direct exposure on the internet.
+type ListenerConfig struct {
+	// ReadTimeout bounds the time to read a whole request, headers and body included,
+	// so that slow clients (slow-loris) cannot hold connections (default: 30s, 0 = unlimited)
+	ReadTimeout time.Duration `mapstructure:"readTimeout" default:"30s" validate:"min=0"`
+
+	// WriteTimeout bounds the time to write a response (default: 30s, 0 = unlimited)
+	WriteTimeout time.Duration `mapstructure:"writeTimeout" default:"30s" validate:"min=0"`
+
+	// IdleTimeout closes keep-alive connections idle for this long (default: 60s)
+	IdleTimeout time.Duration `mapstructure:"idleTimeout" default:"60s" validate:"min=0"`
+
+	// MaxHeaderSize limits the size in bytes of the request line and headers (default: 4096)
+	MaxHeaderSize int `mapstructure:"maxHeaderSize" default:"4096" validate:"gt=0"`
+
+	// MaxConns caps the connections served concurrently; further connections are refused (0 = 262144)
+	MaxConns int `mapstructure:"maxConns" default:"0" validate:"min=0"`
+
+	// MaxConnsPerIP caps the concurrent connections of a client IP (0 = unlimited)
+	MaxConnsPerIP int `mapstructure:"maxConnsPerIP" default:"0" validate:"min=0"`
+
+	// MaxRequestsPerConn closes connections after serving this many requests (0 = unlimited)
+	MaxRequestsPerConn int `mapstructure:"maxRequestsPerConn" default:"0" validate:"min=0"`
+
+	// DisableKeepalive closes the connection after every response
+	DisableKeepalive bool `mapstructure:"disableKeepalive" default:"false"`
+}
+
+// CORSConfig defines the CORS policy for browser clients.
+type CORSConfig struct {
+	// Enabled answers preflight requests and checks the Origin of requests
+	Enabled bool `mapstructure:"enabled" default:"false"`
+
+	// AllowOrigins are the allowed origins: exact ("https://app.example.com"),
+	// subdomain wildcards ("https://*.example.com") or "*" for any origin
+	AllowOrigins []string `mapstructure:"allowOrigins" validate:"required_if=Enabled true,dive,required"`
+
+	// AllowMethods are the methods allowed to cross-origin requests (default: the source method, or POST)
+	AllowMethods []string `mapstructure:"allowMethods" validate:"dive,required"`
+
+	// AllowHeaders are the request headers allowed to cross-origin requests
+	AllowHeaders []string `mapstructure:"allowHeaders" validate:"dive,required"`
+
+	// ExposeHeaders are the response headers readable by the browser
+	ExposeHeaders []string `mapstructure:"exposeHeaders" validate:"dive,required"`
+
+	// AllowCredentials allows cookies and authorization headers; not allowed with the "*" origin
+	AllowCredentials bool `mapstructure:"allowCredentials" default:"false"`
+
+	// MaxAge is how long browsers cache the preflight response (default: 10m)
+	MaxAge time.Duration `mapstructure:"maxAge" default:"10m" validate:"min=0"`
+}
+
+// newServer returns the HTTP server with the listener limits
+func (s *HTTPSource) newServer() *fasthttp.Server {
+	l := s.cfg.Listener
+	return &fasthttp.Server{
+		Handler:               s.handleRequest,
+		ReadTimeout:           l.ReadTimeout,
+		WriteTimeout:          l.WriteTimeout,
+		IdleTimeout:           l.IdleTimeout,
+		ReadBufferSize:        l.MaxHeaderSize,
+		Concurrency:           l.MaxConns,
+		MaxConnsPerIP:         l.MaxConnsPerIP,
+		MaxRequestsPerConn:    l.MaxRequestsPerConn,
+		DisableKeepalive:      l.DisableKeepalive,
+		MaxRequestBodySize:    int(s.cfg.MaxBodySize),
+		NoDefaultServerHeader: true,
+		Logger:                fasthttpLogger{s},
+	}
+}
+
+// fasthttpLogger forwards the server errors (e.g. timeouts, refused connections) to the source logger
+type fasthttpLogger struct {
+	s *HTTPSource
+}
+
+func (l fasthttpLogger) Printf(format string, args ...any) {
+	l.s.slog.Debug("HTTP server", "message", fmt.Sprintf(format, args...))
+}
+
+// validateListener checks the TLS and CORS settings that would be silently ineffective
+func validateListener(cfg *SourceConfig) error {
+	if cfg.TLS.Enabled && cfg.TLS.CACertFile == "" {
+		switch cfg.TLS.ClientAuth {
+		case "VerifyClientCertIfGiven", "RequireAndVerifyClientCert":
+			return errors.New("tls.caCertFile is required to verify client certificates")
+		}
+	}
+	if cfg.CORS.Enabled && cfg.CORS.AllowCredentials && slices.Contains(cfg.CORS.AllowOrigins, "*") {
+		return errors.New("cors.allowCredentials is not allowed with the \"*\" origin")
+	}
+	for _, origin := range cfg.CORS.AllowOrigins {
+		if origin != "*" && !strings.Contains(origin, "://") {
+			return fmt.Errorf("invalid CORS origin %q: expected scheme://host[:port]", origin)
+		}
+	}
+	return nil
+}
+
+// tlsClientMetadata adds the subject of the verified client certificate of mTLS requests
+func tlsClientMetadata(state *tls.ConnectionState, metadata map[string]string) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return
+	}
+	cert := state.PeerCertificates[0]
+	metadata[metaTLSClientSubject] = cert.Subject.String()
+	metadata[metaTLSClientCN] = cert.Subject.CommonName
+}
+
+// handleCORS applies the CORS policy, returning false when the request is answered:
+// preflight requests and requests of disallowed origins are not produced as messages
+func (s *HTTPSource) handleCORS(ctx *fasthttp.RequestCtx) bool {
+	cors := &s.cfg.CORS
+	origin := string(ctx.Request.Header.Peek(fasthttp.HeaderOrigin))
+	if origin == "" {
+		return true
+	}
+	ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderOrigin)
+
+	if !cors.allowsOrigin(origin) {
+		s.slog.Warn("request from disallowed origin rejected", "origin", origin)
+		ctx.SetStatusCode(fasthttp.StatusForbidden)
+		ctx.SetBodyString("Origin not allowed")
+		return false
+	}
+
+	allowOrigin := origin
+	if slices.Contains(cors.AllowOrigins, "*") {
+		allowOrigin = "*"
+	}
+	ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowOrigin, allowOrigin)
+	if cors.AllowCredentials {
+		ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowCredentials, "true")
+	}
+
+	requestMethod := string(ctx.Request.Header.Peek(fasthttp.HeaderAccessControlRequestMethod))
+	if !ctx.IsOptions() || requestMethod == "" {
+		if len(cors.ExposeHeaders) > 0 {
+			ctx.Response.Header.Set(fasthttp.HeaderAccessControlExposeHeaders, strings.Join(cors.ExposeHeaders, ", "))
+		}
+		return true
+	}
+
+	// Preflight request
+	methods := s.corsMethods()
+	if !slices.Contains(methods, requestMethod) {
+		ctx.SetStatusCode(fasthttp.StatusForbidden)
+		ctx.SetBodyString("Method not allowed")
+		return false
+	}
+	ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowMethods, strings.Join(methods, ", "))
+	if len(cors.AllowHeaders) > 0 {
+		ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowHeaders, strings.Join(cors.AllowHeaders, ", "))
+	}
+	if cors.MaxAge > 0 {
+		ctx.Response.Header.Set(fasthttp.HeaderAccessControlMaxAge, strconv.Itoa(int(cors.MaxAge.Seconds())))
+	}
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+	return false
+}
+
+// corsMethods returns the methods allowed to cross-origin requests
+func (s *HTTPSource) corsMethods() []string {
+	if len(s.cfg.CORS.AllowMethods) > 0 {
+		return s.cfg.CORS.AllowMethods
+	}
+	if s.cfg.Method != "" {
+		return []string{s.cfg.Method}
+	}
+	return []string{fasthttp.MethodPost}
+}
+
+// allowsOrigin reports whether the origin matches an allowed origin
+func (c *CORSConfig) allowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// Subdomain wildcard, e.g. https://*.example.com
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if !ok {
+			continue
+		}
+		prefix := scheme + "://"
+		if len(origin) > len(prefix) && strings.EqualFold(origin[:len(prefix)], prefix) &&
+			strings.HasSuffix(strings.ToLower(origin), "."+strings.ToLower(host)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/utils"
+	"github.com/valyala/fasthttp"
+)
+
+func newCORSSource(t *testing.T, cors map[string]any) *HTTPSource {
+	t.Helper()
+	return mustNewHTTPSource(t, map[string]any{
+		"address": httpTestAddr,
+		"method":  "POST",
+		"cors":    cors,
+	})
+}
+
+func TestHTTPSourceCORSPreflight(t *testing.T) {
+	src := newCORSSource(t, map[string]any{
+		"enabled":          true,
+		"allowOrigins":     []any{"https://app.example.com"},
+		"allowHeaders":     []any{"Content-Type", "Authorization"},
+		"allowCredentials": true,
+		"maxAge":           "1h",
+	})
+
+	ctx := newReplayRequest("", map[string]string{
+		"Origin":                        "https://app.example.com",
+		"Access-Control-Request-Method": "POST",
+	})
+	ctx.Request.Header.SetMethod("OPTIONS")
+	src.handleRequest(ctx)
+
+	h := &ctx.Response.Header
+	if ctx.Response.StatusCode() != fasthttp.StatusNoContent {
+		t.Fatalf("expected 204, got %d", ctx.Response.StatusCode())
+	}
+	for key, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Methods":     "POST",
+		"Access-Control-Allow-Headers":     "Content-Type, Authorization",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "3600",
+		"Vary":                             "Origin",
+	} {
+		if got := string(h.Peek(key)); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	ctx = newReplayRequest("", map[string]string{
+		"Origin":                        "https://app.example.com",
+		"Access-Control-Request-Method": "DELETE",
+	})
+	ctx.Request.Header.SetMethod("OPTIONS")
+	src.handleRequest(ctx)
+	if ctx.Response.StatusCode() != fasthttp.StatusForbidden {
+		t.Errorf("preflight of a disallowed method: expected 403, got %d", ctx.Response.StatusCode())
+	}
+}
+
+func TestHTTPSourceCORSRequests(t *testing.T) {
+	src := newCORSSource(t, map[string]any{
+		"enabled":       true,
+		"allowOrigins":  []any{"https://*.example.com"},
+		"exposeHeaders": []any{"X-Request-Id"},
+	})
+
+	ctx := newReplayRequest(`{}`, map[string]string{"Origin": "https://app.example.com"})
+	serve(src, ctx, "ok")
+	if ctx.Response.StatusCode() != fasthttp.StatusOK {
+		t.Fatalf("expected 200, got %d", ctx.Response.StatusCode())
+	}
+	if got := string(ctx.Response.Header.Peek("Access-Control-Allow-Origin")); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := string(ctx.Response.Header.Peek("Access-Control-Expose-Headers")); got != "X-Request-Id" {
+		t.Errorf("Access-Control-Expose-Headers = %q", got)
+	}
+
+	for _, origin := range []string{"https://example.com", "http://app.example.com", "https://evil-example.com"} {
+		ctx = newReplayRequest(`{}`, map[string]string{"Origin": origin})
+		src.handleRequest(ctx)
+		if ctx.Response.StatusCode() != fasthttp.StatusForbidden {
+			t.Errorf("origin %s: expected 403, got %d", origin, ctx.Response.StatusCode())
+		}
+	}
+
+	// Requests without Origin are not cross-origin
+	ctx = newReplayRequest(`{}`, nil)
+	serve(src, ctx, "ok")
+	if ctx.Response.StatusCode() != fasthttp.StatusOK || len(ctx.Response.Header.Peek("Access-Control-Allow-Origin")) != 0 {
+		t.Errorf("same-origin request: unexpected response %d", ctx.Response.StatusCode())
+	}
+}
+
+func TestHTTPSourceListenerConfigErrors(t *testing.T) {
+	for name, opts := range map[string]map[string]any{
+		"credentials with any origin": {"cors": map[string]any{"enabled": true, "allowOrigins": []any{"*"}, "allowCredentials": true}},
+		"origin without scheme":       {"cors": map[string]any{"enabled": true, "allowOrigins": []any{"app.example.com"}}},
+		"mTLS without CA": {"tls": map[string]any{
+			"enabled": true, "certFile": "cert.pem", "keyFile": "key.pem", "clientAuth": "RequireAndVerifyClientCert",
+		}},
+	} {
+		opts["address"] = httpTestAddr
+		if _, err := NewSource(mustParseSourceConfig(t, opts)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	cfg := new(SourceConfig)
+	if err := utils.ParseConfig(map[string]any{"address": httpTestAddr, "cors": map[string]any{"enabled": true}}, cfg); err == nil {
+		t.Error("CORS without allowOrigins: expected error")
+	}
+}
+
+func TestHTTPSourceListenerLimits(t *testing.T) {
+	src := mustNewHTTPSource(t, map[string]any{
+		"address":  httpTestAddr,
+		"listener": map[string]any{"readTimeout": "200ms", "maxHeaderSize": 1024},
+	})
+	if _, err := src.Produce(1); err != nil {
+		t.Fatalf(httpErrUnexpected, err)
+	}
+	t.Cleanup(func() { _ = src.Close() })
+	addr := src.listener.Addr().String()
+
+	// Oversized headers are rejected
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf(httpErrFailedDial, err)
+	}
+	defer conn.Close() //nolint:errcheck
+	req := "POST / HTTP/1.1\r\nHost: test\r\nX-Big: " + strings.Repeat("a", 2048) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatalf(httpErrWriteConn, err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	status, _ := bufio.NewReader(conn).ReadString('\n')
+	if !strings.Contains(status, "431") {
+		t.Errorf("oversized headers: unexpected status line %q", status)
+	}
+
+	// Slow clients are disconnected after the read timeout
+	slow, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf(httpErrFailedDial, err)
+	}
+	defer slow.Close() //nolint:errcheck
+	if _, err := slow.Write([]byte("POST / HTTP/1.1\r\nHost: test\r\n")); err != nil {
+		t.Fatalf(httpErrWriteConn, err)
+	}
+	_ = slow.SetReadDeadline(time.Now().Add(2 * time.Second))
+	start := time.Now()
+	_, _ = io.ReadAll(slow)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("slow connection held for %s", elapsed)
+	}
+}
+
+func TestTLSClientMetadata(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "device-1", Organization: []string{"Acme"}}}
+	metadata := map[string]string{}
+
+	tlsClientMetadata(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, metadata)
+	if len(metadata) != 0 {
+		t.Errorf("unverified certificate added metadata %v", metadata)
+	}
+
+	tlsClientMetadata(&tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}, metadata)
+	if metadata[metaTLSClientCN] != "device-1" || metadata[metaTLSClientSubject] != "CN=device-1,O=Acme" {
+		t.Errorf("unexpected metadata %v", metadata)
+	}
+}
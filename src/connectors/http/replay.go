@@ -0,0 +1,295 @@
+package main
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // required by providers still signing with HMAC-SHA1
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	replayModeCached   = "cached"
+	replayModeConflict = "conflict"
+
+	// replayedHeader marks responses served from the idempotency cache
+	replayedHeader = "Idempotent-Replayed"
+)
+
+// ReplayConfig defines webhook replay protection settings.
+type ReplayConfig struct {
+	// Enabled activates replay protection
+	Enabled bool `mapstructure:"enabled" default:"false"`
+
+	// Signature verifies the provider signature of the request body (optional)
+	Signature SignatureConfig `mapstructure:"signature"`
+
+	// IdempotencyHeader is the request header holding the idempotency key (default: "Idempotency-Key")
+	IdempotencyHeader string `mapstructure:"idempotencyHeader" default:"Idempotency-Key"`
+
+	// KeyFromBody uses the SHA-256 of the body as key when the idempotency header is missing
+	KeyFromBody bool `mapstructure:"keyFromBody" default:"false"`
+
+	// Mode is the answer to replayed requests: "cached" returns the stored response, "conflict" returns 409
+	Mode string `mapstructure:"mode" default:"cached" validate:"oneof=cached conflict"`
+
+	// TTL is how long processed keys are remembered (default: 24h)
+	TTL time.Duration `mapstructure:"ttl" default:"24h" validate:"gt=0"`
+
+	// MaxEntries bounds the number of remembered keys, the oldest are evicted first (default: 100000)
+	MaxEntries int `mapstructure:"maxEntries" default:"100000" validate:"gt=0"`
+}
+
+// SignatureConfig defines HMAC signature verification settings.
+type SignatureConfig struct {
+	// Header is the request header holding the signature (e.g., "X-Hub-Signature-256"); empty disables verification
+	Header string `mapstructure:"header"`
+
+	// Secret is the shared HMAC secret (supports env: and file: secrets)
+	Secret string `mapstructure:"secret" validate:"required_with=Header"` //nolint:gosec // user-configured credential field
+
+	// Algorithm is the HMAC hash: "sha256", "sha1" or "sha512" (default: "sha256")
+	Algorithm string `mapstructure:"algorithm" default:"sha256" validate:"oneof=sha256 sha1 sha512"`
+
+	// Encoding of the signature: "hex" or "base64" (default: "hex")
+	Encoding string `mapstructure:"encoding" default:"hex" validate:"oneof=hex base64"`
+
+	// Prefix is stripped from the header value before decoding (e.g., "sha256=")
+	Prefix string `mapstructure:"prefix"`
+
+	// TimestampHeader holds the Unix timestamp of the request (optional).
+	// When set, the signed content is "<timestamp>.<body>" and stale requests are rejected.
+	TimestampHeader string `mapstructure:"timestampHeader"`
+
+	// Tolerance is the maximum accepted age of the timestamp (default: 5m)
+	Tolerance time.Duration `mapstructure:"tolerance" default:"5m" validate:"gt=0"`
+}
+
+// verifySignature checks the HMAC signature of the request with the resolved secret
+func (c *SignatureConfig) verifySignature(req *fasthttp.Request, secret []byte, now time.Time) error {
+	sigValue := strings.TrimSpace(string(req.Header.Peek(c.Header)))
+	if sigValue == "" {
+		return fmt.Errorf("missing signature header %s", c.Header)
+	}
+	sigValue = strings.TrimPrefix(sigValue, c.Prefix)
+
+	var signature []byte
+	var err error
+	if c.Encoding == "base64" {
+		signature, err = base64.StdEncoding.DecodeString(sigValue)
+	} else {
+		signature, err = hex.DecodeString(sigValue)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	var newHash func() hash.Hash
+	switch c.Algorithm {
+	case "sha1":
+		newHash = sha1.New
+	case "sha512":
+		newHash = sha512.New
+	default:
+		newHash = sha256.New
+	}
+	mac := hmac.New(newHash, secret)
+
+	if c.TimestampHeader != "" {
+		ts := string(req.Header.Peek(c.TimestampHeader))
+		sec, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp header %s", c.TimestampHeader)
+		}
+		if age := now.Sub(time.Unix(sec, 0)); math.Abs(float64(age)) > float64(c.Tolerance) {
+			return fmt.Errorf("timestamp outside tolerance of %v", c.Tolerance)
+		}
+		mac.Write([]byte(ts + "."))
+	}
+	mac.Write(req.Body())
+
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// idempotencyKey returns the idempotency key of the request, falling back to
+// the webhook delivery key, or an empty string
+func (c *ReplayConfig) idempotencyKey(req *fasthttp.Request, deliveryKey string) string {
+	if key := strings.TrimSpace(string(req.Header.Peek(c.IdempotencyHeader))); key != "" {
+		return key
+	}
+	if deliveryKey != "" {
+		return deliveryKey
+	}
+	if c.KeyFromBody {
+		sum := sha256.Sum256(req.Body())
+		return "body:" + hex.EncodeToString(sum[:])
+	}
+	return ""
+}
+
+// cachedResponse is the response stored for a processed idempotency key
+type cachedResponse struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+// dedupEntry is the state of an idempotency key
+type dedupEntry struct {
+	key      string
+	inFlight bool
+	response *cachedResponse
+	expires  time.Time
+}
+
+// dedupStore is an in-memory idempotency key store with TTL and bounded size
+type dedupStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+}
+
+func newDedupStore(ttl time.Duration, maxEntries int) *dedupStore {
+	return &dedupStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// acquire reserves a key for processing. If the key is already known it returns
+// its entry and false: the request is a replay.
+func (s *dedupStore) acquire(key string, now time.Time) (dedupEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*dedupEntry)
+		if entry.inFlight || now.Before(entry.expires) {
+			return *entry, false
+		}
+		s.remove(el)
+	}
+
+	s.evict(now)
+	entry := &dedupEntry{key: key, inFlight: true, expires: now.Add(s.ttl)}
+	s.entries[key] = s.order.PushBack(entry)
+	return *entry, true
+}
+
+// complete stores the response of a processed key
+func (s *dedupStore) complete(key string, resp *cachedResponse, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	entry := el.Value.(*dedupEntry)
+	entry.inFlight = false
+	entry.response = resp
+	entry.expires = now.Add(s.ttl)
+	s.order.MoveToBack(el)
+}
+
+// release forgets a key whose processing failed, so that retries are accepted
+func (s *dedupStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+}
+
+// evict drops expired entries and the oldest ones above the size limit
+func (s *dedupStore) evict(now time.Time) {
+	for el := s.order.Front(); el != nil; {
+		next := el.Next()
+		entry := el.Value.(*dedupEntry)
+		if !entry.inFlight && !now.Before(entry.expires) {
+			s.remove(el)
+		}
+		el = next
+	}
+	for s.order.Len() >= s.maxEntries {
+		s.remove(s.order.Front())
+	}
+}
+
+func (s *dedupStore) remove(el *list.Element) {
+	delete(s.entries, el.Value.(*dedupEntry).key)
+	s.order.Remove(el)
+}
+
+// checkReplay verifies the signature and the idempotency key of the request.
+// It returns the reserved key (empty when deduplication does not apply) and false
+// when the response has already been written.
+func (s *HTTPSource) checkReplay(ctx *fasthttp.RequestCtx, deliveryKey string) (string, bool) {
+	cfg := &s.cfg.Replay
+	now := time.Now()
+
+	if cfg.Signature.Header != "" {
+		if err := cfg.Signature.verifySignature(&ctx.Request, s.signatureSecret, now); err != nil {
+			s.slog.Warn("webhook signature verification failed", "error", err)
+			ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+			ctx.SetBodyString("Invalid signature")
+			return "", false
+		}
+	}
+
+	key := cfg.idempotencyKey(&ctx.Request, deliveryKey)
+	if key == "" {
+		return "", true
+	}
+
+	entry, ok := s.dedup.acquire(key, now)
+	if ok {
+		return key, true
+	}
+
+	s.slog.Debug("replayed request", "key", key, "inFlight", entry.inFlight)
+	if entry.inFlight || cfg.Mode == replayModeConflict || entry.response == nil {
+		ctx.SetStatusCode(fasthttp.StatusConflict)
+		ctx.SetBodyString("Duplicate request")
+		return "", false
+	}
+
+	ctx.Response.Header.Set(replayedHeader, "true")
+	if entry.response.contentType != "" {
+		ctx.SetContentType(entry.response.contentType)
+	}
+	ctx.SetStatusCode(entry.response.status)
+	ctx.SetBody(entry.response.body)
+	return "", false
+}
+
+// completeReplay stores the response of a successful request, or releases the key on failure
+func (s *HTTPSource) completeReplay(ctx *fasthttp.RequestCtx, key string) {
+	status := ctx.Response.StatusCode()
+	if status < 200 || status >= 300 {
+		s.dedup.release(key)
+		return
+	}
+	s.dedup.complete(key, &cachedResponse{
+		status:      status,
+		contentType: string(ctx.Response.Header.ContentType()),
+		body:        append([]byte(nil), ctx.Response.Body()...),
+	}, time.Now())
+}
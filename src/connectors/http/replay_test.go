@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/valyala/fasthttp"
+)
+
+const replaySecret = "s3cr3t"
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(replaySecret))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newReplayRequest(body string, headers map[string]string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.SetRequestURI("/hook")
+	ctx.Request.SetBodyString(body)
+	for k, v := range headers {
+		ctx.Request.Header.Set(k, v)
+	}
+	return ctx
+}
+
+// serve runs the request through the source, replying with the given data
+func serve(s *HTTPSource, ctx *fasthttp.RequestCtx, reply string) {
+	s.c = make(chan *message.RunnerMessage, 1)
+	go func() {
+		select {
+		case msg := <-s.c:
+			_ = msg.Ack(&message.ReplyData{Data: []byte(reply)})
+		case <-time.After(time.Second):
+		}
+	}()
+	s.handleRequest(ctx)
+}
+
+func TestHTTPSourceReplayCached(t *testing.T) {
+	src := mustNewHTTPSource(t, map[string]any{
+		"address": httpTestAddr,
+		"replay":  map[string]any{"enabled": true},
+	})
+
+	first := newReplayRequest(`{"id":1}`, map[string]string{"Idempotency-Key": "evt-1"})
+	serve(src, first, "processed")
+	if first.Response.StatusCode() != fasthttp.StatusOK {
+		t.Fatalf("expected 200, got %d", first.Response.StatusCode())
+	}
+
+	second := newReplayRequest(`{"id":1}`, map[string]string{"Idempotency-Key": "evt-1"})
+	serve(src, second, "processed again")
+	if second.Response.StatusCode() != fasthttp.StatusOK {
+		t.Fatalf("expected cached 200, got %d", second.Response.StatusCode())
+	}
+	if string(second.Response.Body()) != "processed" {
+		t.Errorf("expected cached body, got %s", second.Response.Body())
+	}
+	if string(second.Response.Header.Peek(replayedHeader)) != "true" {
+		t.Error("expected replayed header on cached response")
+	}
+}
+
+func TestHTTPSourceReplayConflict(t *testing.T) {
+	src := mustNewHTTPSource(t, map[string]any{
+		"address": httpTestAddr,
+		"replay":  map[string]any{"enabled": true, "mode": "conflict", "keyFromBody": true},
+	})
+
+	serve(src, newReplayRequest(`{"id":2}`, nil), "ok")
+
+	second := newReplayRequest(`{"id":2}`, nil)
+	serve(src, second, "ok")
+	if second.Response.StatusCode() != fasthttp.StatusConflict {
+		t.Fatalf("expected 409, got %d", second.Response.StatusCode())
+	}
+}
+
+func TestHTTPSourceReplayReleasedOnFailure(t *testing.T) {
+	src := mustNewHTTPSource(t, map[string]any{
+		"address": httpTestAddr,
+		"replay":  map[string]any{"enabled": true},
+	})
+
+	failed := newReplayRequest(`{}`, map[string]string{"Idempotency-Key": "evt-3"})
+	src.c = make(chan *message.RunnerMessage, 1)
+	go func() {
+		msg := <-src.c
+		_ = msg.Nak()
+	}()
+	src.handleRequest(failed)
+	if failed.Response.StatusCode() != fasthttp.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", failed.Response.StatusCode())
+	}
+
+	retry := newReplayRequest(`{}`, map[string]string{"Idempotency-Key": "evt-3"})
+	serve(src, retry, "ok")
+	if retry.Response.StatusCode() != fasthttp.StatusOK || len(retry.Response.Header.Peek(replayedHeader)) != 0 {
+		t.Fatalf("expected retry to be processed, got %d", retry.Response.StatusCode())
+	}
+}
+
+func TestHTTPSourceReplaySignature(t *testing.T) {
+	src := mustNewHTTPSource(t, map[string]any{
+		"address": httpTestAddr,
+		"replay": map[string]any{
+			"enabled": true,
+			"signature": map[string]any{
+				"header": "X-Signature",
+				"secret": replaySecret,
+				"prefix": "sha256=",
+			},
+		},
+	})
+
+	valid := newReplayRequest(`{"id":4}`, map[string]string{"X-Signature": sign(`{"id":4}`)})
+	serve(src, valid, "ok")
+	if valid.Response.StatusCode() != fasthttp.StatusOK {
+		t.Fatalf("expected 200 for valid signature, got %d", valid.Response.StatusCode())
+	}
+
+	tampered := newReplayRequest(`{"id":5}`, map[string]string{"X-Signature": sign(`{"id":4}`)})
+	serve(src, tampered, "ok")
+	if tampered.Response.StatusCode() != fasthttp.StatusUnauthorized {
+		t.Fatalf("expected 401 for invalid signature, got %d", tampered.Response.StatusCode())
+	}
+}
+
+func TestHTTPSourceReplaySignatureSecretRef(t *testing.T) {
+	t.Setenv("EB_TEST_REPLAY_SECRET", replaySecret)
+	src := mustNewHTTPSource(t, map[string]any{
+		"address": httpTestAddr,
+		"replay": map[string]any{
+			"enabled":   true,
+			"signature": map[string]any{"header": "X-Signature", "secret": "env:EB_TEST_REPLAY_SECRET", "prefix": "sha256="},
+		},
+	})
+
+	valid := newReplayRequest(`{"id":6}`, map[string]string{"X-Signature": sign(`{"id":6}`)})
+	serve(src, valid, "ok")
+	if valid.Response.StatusCode() != fasthttp.StatusOK {
+		t.Fatalf("expected 200 for valid signature, got %d", valid.Response.StatusCode())
+	}
+
+	cfg := new(SourceConfig)
+	cfg.Address = httpTestAddr
+	cfg.Replay = ReplayConfig{Enabled: true, Signature: SignatureConfig{Header: "X-Signature", Secret: "env:EB_TEST_MISSING_REPLAY_SECRET"}}
+	if _, err := NewSource(cfg); err == nil {
+		t.Error("expected error with an empty signature secret")
+	}
+}
+
+func TestVerifySignatureTimestamp(t *testing.T) {
+	cfg := mustParseSourceConfig(t, map[string]any{
+		"address": httpTestAddr,
+		"replay": map[string]any{
+			"enabled": true,
+			"signature": map[string]any{
+				"header":          "X-Signature",
+				"secret":          replaySecret,
+				"prefix":          "sha256=",
+				"timestampHeader": "X-Timestamp",
+				"tolerance":       "1m",
+			},
+		},
+	}).Replay.Signature
+
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+	ctx := newReplayRequest("body", map[string]string{"X-Timestamp": ts, "X-Signature": sign(ts + ".body")})
+	if err := cfg.verifySignature(&ctx.Request, []byte(replaySecret), now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cfg.verifySignature(&ctx.Request, []byte(replaySecret), now.Add(2*time.Minute)); err == nil {
+		t.Fatal("expected error for stale timestamp")
+	}
+}
+
+func TestDedupStoreExpiryAndEviction(t *testing.T) {
+	store := newDedupStore(time.Minute, 2)
+	now := time.Now()
+
+	if _, ok := store.acquire("a", now); !ok {
+		t.Fatal("expected first acquire to succeed")
+	}
+	if entry, ok := store.acquire("a", now); ok || !entry.inFlight {
+		t.Fatal("expected in-flight duplicate to be rejected")
+	}
+	store.complete("a", &cachedResponse{status: 200}, now)
+	if _, ok := store.acquire("a", now.Add(2*time.Minute)); !ok {
+		t.Fatal("expected expired key to be accepted again")
+	}
+
+	store.acquire("b", now)
+	store.acquire("c", now)
+	if _, ok := store.entries["a"]; ok {
+		t.Error("expected oldest key to be evicted")
+	}
+	if store.order.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", store.order.Len())
+	}
+}
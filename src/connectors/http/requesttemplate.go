@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/sandrolain/events-bridge/src/common/tmplfuncs"
+)
+
+// methods are the HTTP methods of the runner requests
+var methods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"}
+
+// requestTemplate renders the method, URL and headers of the requests from the messages.
+// The static values are used as they are.
+type requestTemplate struct {
+	method  *template.Template
+	url     *template.Template
+	headers map[string]*template.Template
+}
+
+// isTemplate reports whether a value is a Go template
+func isTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	if !isTemplate(text) {
+		return nil, nil
+	}
+	return template.New(name).Option("missingkey=zero").Funcs(tmplfuncs.FuncMap()).Parse(text)
+}
+
+// newRequestTemplate parses the templated values of the configuration and validates the static ones
+func newRequestTemplate(cfg *HTTPRunnerConfig) (*requestTemplate, error) {
+	t := &requestTemplate{headers: map[string]*template.Template{}}
+	var err error
+	if t.method, err = parseTemplate("method", cfg.Method); err != nil {
+		return nil, fmt.Errorf("invalid method template: %w", err)
+	}
+	if t.method == nil {
+		if err := checkMethod(cfg.Method); err != nil {
+			return nil, err
+		}
+	}
+	if t.url, err = parseTemplate("url", cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid url template: %w", err)
+	}
+	if t.url == nil {
+		if err := checkURL(cfg.URL); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range cfg.Headers {
+		tmpl, err := parseTemplate(name, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template of header %s: %w", name, err)
+		}
+		if tmpl != nil {
+			t.headers[name] = tmpl
+		}
+	}
+	return t, nil
+}
+
+// static reports whether no value is templated
+func (t *requestTemplate) static() bool {
+	return t.method == nil && t.url == nil && len(t.headers) == 0
+}
+
+func checkMethod(method string) error {
+	if !slices.Contains(methods, strings.ToUpper(method)) {
+		return fmt.Errorf("invalid method %q, expected one of %s", method, strings.Join(methods, ", "))
+	}
+	return nil
+}
+
+func checkURL(rawURL string) error {
+	u, err := neturl.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", rawURL)
+	}
+	return nil
+}
+
+// render returns the method, URL and headers of the request of a message, with "metadata"
+// and "data" (the decoded JSON payload, or the payload string) in the templates
+func (t *requestTemplate) render(cfg *HTTPRunnerConfig, metadata map[string]string, data []byte) (string, string, map[string]string, error) {
+	method, url, headers := cfg.Method, cfg.URL, cfg.Headers
+	if t.static() {
+		return strings.ToUpper(method), url, headers, nil
+	}
+
+	var payload any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		payload = string(data)
+	}
+	vars := map[string]any{"data": payload, "metadata": metadata}
+	execute := func(tmpl *template.Template) (string, error) {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, vars); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(b.String()), nil
+	}
+
+	var err error
+	if t.method != nil {
+		if method, err = execute(t.method); err != nil {
+			return "", "", nil, fmt.Errorf("failed to render method: %w", err)
+		}
+		if err := checkMethod(method); err != nil {
+			return "", "", nil, err
+		}
+	}
+	if t.url != nil {
+		if url, err = execute(t.url); err != nil {
+			return "", "", nil, fmt.Errorf("failed to render url: %w", err)
+		}
+		if err := checkURL(url); err != nil {
+			return "", "", nil, err
+		}
+	}
+	if len(t.headers) > 0 {
+		headers = make(map[string]string, len(cfg.Headers))
+		for name, value := range cfg.Headers {
+			if tmpl, ok := t.headers[name]; ok {
+				if value, err = execute(tmpl); err != nil {
+					return "", "", nil, fmt.Errorf("failed to render header %s: %w", name, err)
+				}
+			}
+			headers[name] = value
+		}
+	}
+	return strings.ToUpper(method), url, headers, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Outcomes of a response status
+const (
+	statusSuccess   = "success"
+	statusRetryable = "retryable"
+	statusPermanent = "permanent"
+	// statusDefault fails the message with the default classification of the status
+	statusDefault = ""
+)
+
+// StatusConfig maps the response status codes to the outcome of the message. The codes are
+// exact ("404"), classes ("5xx") or ranges ("500-504"); the first matching list wins in the
+// order success, retryable, permanent.
+type StatusConfig struct {
+	// Success are the status codes processed as success: the response replaces the payload
+	// and the message is acked at the end of the pipeline (default: 2xx)
+	Success []string `mapstructure:"success"`
+	// Retryable are the status codes failing with a retryable error: the retry policy of the
+	// runner retries the request, then the message is naked for a redelivery by the source,
+	// bypassing the dead-letter target
+	Retryable []string `mapstructure:"retryable"`
+	// Permanent are the status codes failing with a non retryable error: the request is not
+	// retried and the message goes to the dead-letter target
+	Permanent []string `mapstructure:"permanent"`
+}
+
+// statusRange is an inclusive range of status codes
+type statusRange struct {
+	from, to int
+}
+
+// statusMap classifies the response status codes
+type statusMap struct {
+	success, retryable, permanent []statusRange
+}
+
+func newStatusMap(cfg StatusConfig) (*statusMap, error) {
+	success := cfg.Success
+	if len(success) == 0 {
+		success = []string{"2xx"}
+	}
+	m := &statusMap{}
+	var err error
+	if m.success, err = parseStatusRanges(success); err != nil {
+		return nil, fmt.Errorf("invalid success status: %w", err)
+	}
+	if m.retryable, err = parseStatusRanges(cfg.Retryable); err != nil {
+		return nil, fmt.Errorf("invalid retryable status: %w", err)
+	}
+	if m.permanent, err = parseStatusRanges(cfg.Permanent); err != nil {
+		return nil, fmt.Errorf("invalid permanent status: %w", err)
+	}
+	return m, nil
+}
+
+// parseStatusRanges parses status codes, classes and ranges
+func parseStatusRanges(values []string) ([]statusRange, error) {
+	ranges := make([]statusRange, 0, len(values))
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		var r statusRange
+		var err error
+		switch {
+		case len(v) == 3 && strings.HasSuffix(v, "xx"):
+			var class int
+			class, err = strconv.Atoi(v[:1])
+			r = statusRange{class * 100, class*100 + 99}
+		case strings.Contains(v, "-"):
+			from, to, _ := strings.Cut(v, "-")
+			if r.from, err = strconv.Atoi(strings.TrimSpace(from)); err == nil {
+				r.to, err = strconv.Atoi(strings.TrimSpace(to))
+			}
+		default:
+			r.from, err = strconv.Atoi(v)
+			r.to = r.from
+		}
+		if err != nil || r.from < 100 || r.to > 599 || r.from > r.to {
+			return nil, fmt.Errorf("%q is not a status code, class (5xx) or range (500-504)", v)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func matchStatus(ranges []statusRange, status int) bool {
+	for _, r := range ranges {
+		if status >= r.from && status <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// outcome returns the outcome of the status
+func (m *statusMap) outcome(status int) string {
+	switch {
+	case matchStatus(m.success, status):
+		return statusSuccess
+	case matchStatus(m.retryable, status):
+		return statusRetryable
+	case matchStatus(m.permanent, status):
+		return statusPermanent
+	}
+	return statusDefault
+}
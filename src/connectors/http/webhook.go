@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	webhookStripe  = "stripe"
+	webhookGitHub  = "github"
+	webhookShopify = "shopify"
+)
+
+// Metadata keys set from the webhook envelope
+const (
+	metaWebhookProvider = "eb-webhook-provider"
+	metaWebhookEvent    = "eb-webhook-event"
+	metaWebhookDelivery = "eb-webhook-delivery"
+	metaWebhookAction   = "eb-webhook-action"
+)
+
+// errInvalidSignature marks webhook requests rejected by the signature verification
+var errInvalidSignature = errors.New("invalid signature")
+
+// WebhookConfig defines a webhook provider preset, with the provider signature scheme and event envelope.
+type WebhookConfig struct {
+	// Provider is the webhook provider: "stripe", "github" or "shopify" (empty disables the preset)
+	Provider string `mapstructure:"provider" validate:"omitempty,oneof=stripe github shopify"`
+
+	// Secret is the webhook signing secret (supports env: and file: secrets)
+	Secret string `mapstructure:"secret" validate:"required_with=Provider"` //nolint:gosec // user-configured credential field
+
+	// Tolerance is the maximum accepted age of timestamped signatures (Stripe, default: 5m)
+	Tolerance time.Duration `mapstructure:"tolerance" default:"5m" validate:"gt=0"`
+
+	// Unwrap replaces the payload with the event object of enveloped events (Stripe "data.object")
+	Unwrap bool `mapstructure:"unwrap" default:"true"`
+
+	// EventTypes accepts only these event types (e.g., "payment_intent.succeeded", "push", "orders/create").
+	// Other events are acknowledged with 200, so that the provider does not retry them, and dropped.
+	EventTypes []string `mapstructure:"eventTypes"`
+}
+
+// webhookEvent is a verified and unwrapped webhook event
+type webhookEvent struct {
+	Type     string
+	Delivery string
+	Action   string
+	Payload  []byte
+}
+
+// metadata returns the event metadata
+func (e *webhookEvent) metadata(provider string) map[string]string {
+	meta := map[string]string{
+		metaWebhookProvider: provider,
+		metaWebhookEvent:    e.Type,
+		metaWebhookDelivery: e.Delivery,
+	}
+	if e.Action != "" {
+		meta[metaWebhookAction] = e.Action
+	}
+	return meta
+}
+
+// accepts reports whether the event type is accepted
+func (c *WebhookConfig) accepts(eventType string) bool {
+	return len(c.EventTypes) == 0 || slices.Contains(c.EventTypes, eventType)
+}
+
+// parseWebhook verifies the provider signature and extracts the event from the request
+func (c *WebhookConfig) parseWebhook(req *fasthttp.Request, secret []byte, now time.Time) (*webhookEvent, error) {
+	switch c.Provider {
+	case webhookStripe:
+		return c.parseStripe(req, secret, now)
+	case webhookGitHub:
+		return parseGitHub(req, secret)
+	case webhookShopify:
+		return parseShopify(req, secret)
+	default:
+		return nil, fmt.Errorf("unsupported webhook provider: %s", c.Provider)
+	}
+}
+
+// parseStripe handles Stripe events: the "Stripe-Signature" header holds the timestamp and the
+// hex HMAC-SHA256 signatures of "<timestamp>.<body>"; the event object is in "data.object".
+// Stripe retries failed deliveries for up to three days.
+func (c *WebhookConfig) parseStripe(req *fasthttp.Request, secret []byte, now time.Time) (*webhookEvent, error) {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(string(req.Header.Peek("Stripe-Signature")), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			if sig, err := hex.DecodeString(v); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return nil, fmt.Errorf("%w: malformed Stripe-Signature header", errInvalidSignature)
+	}
+	if age := now.Sub(time.Unix(sec, 0)); math.Abs(float64(age)) > float64(c.Tolerance) {
+		return nil, fmt.Errorf("%w: timestamp outside tolerance of %v", errInvalidSignature, c.Tolerance)
+	}
+	expected := hmacSHA256(secret, []byte(timestamp+"."), req.Body())
+	if !slices.ContainsFunc(signatures, func(sig []byte) bool { return hmac.Equal(sig, expected) }) {
+		return nil, fmt.Errorf("%w: signature mismatch", errInvalidSignature)
+	}
+
+	var envelope struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(req.Body(), &envelope); err != nil {
+		return nil, fmt.Errorf("invalid Stripe event: %w", err)
+	}
+	event := &webhookEvent{Type: envelope.Type, Delivery: envelope.ID, Payload: req.Body()}
+	if c.Unwrap && len(envelope.Data.Object) > 0 {
+		event.Payload = envelope.Data.Object
+	}
+	return event, nil
+}
+
+// parseGitHub handles GitHub events: the "X-Hub-Signature-256" header holds the hex HMAC-SHA256
+// of the body; event type and delivery id are headers. GitHub does not retry failed deliveries.
+func parseGitHub(req *fasthttp.Request, secret []byte) (*webhookEvent, error) {
+	sig, ok := strings.CutPrefix(string(req.Header.Peek("X-Hub-Signature-256")), "sha256=")
+	signature, err := hex.DecodeString(sig)
+	if !ok || err != nil {
+		return nil, fmt.Errorf("%w: malformed X-Hub-Signature-256 header", errInvalidSignature)
+	}
+	if !hmac.Equal(signature, hmacSHA256(secret, req.Body())) {
+		return nil, fmt.Errorf("%w: signature mismatch", errInvalidSignature)
+	}
+
+	event := &webhookEvent{
+		Type:     string(req.Header.Peek("X-GitHub-Event")),
+		Delivery: string(req.Header.Peek("X-GitHub-Delivery")),
+		Payload:  req.Body(),
+	}
+	var body struct {
+		Action string `json:"action"`
+	}
+	if json.Unmarshal(req.Body(), &body) == nil {
+		event.Action = body.Action
+	}
+	return event, nil
+}
+
+// parseShopify handles Shopify events: the "X-Shopify-Hmac-Sha256" header holds the base64
+// HMAC-SHA256 of the body; topic and webhook id are headers. Shopify retries failed
+// deliveries 8 times over 4 hours and expects an answer within 5 seconds.
+func parseShopify(req *fasthttp.Request, secret []byte) (*webhookEvent, error) {
+	signature, err := base64.StdEncoding.DecodeString(string(req.Header.Peek("X-Shopify-Hmac-Sha256")))
+	if err != nil || len(signature) == 0 {
+		return nil, fmt.Errorf("%w: malformed X-Shopify-Hmac-Sha256 header", errInvalidSignature)
+	}
+	if !hmac.Equal(signature, hmacSHA256(secret, req.Body())) {
+		return nil, fmt.Errorf("%w: signature mismatch", errInvalidSignature)
+	}
+
+	return &webhookEvent{
+		Type:     string(req.Header.Peek("X-Shopify-Topic")),
+		Delivery: string(req.Header.Peek("X-Shopify-Webhook-Id")),
+		Payload:  req.Body(),
+	}, nil
+}
+
+func hmacSHA256(secret []byte, parts ...[]byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
+
+// checkWebhook verifies and unwraps the provider event. It returns nil when the
+// response has already been written: invalid request or ignored event type.
+func (s *HTTPSource) checkWebhook(ctx *fasthttp.RequestCtx) *webhookEvent {
+	cfg := &s.cfg.Webhook
+	event, err := cfg.parseWebhook(&ctx.Request, s.webhookSecret, time.Now())
+	if err != nil {
+		s.slog.Warn("webhook verification failed", "provider", cfg.Provider, "error", err)
+		if errors.Is(err, errInvalidSignature) {
+			ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+			ctx.SetBodyString("Invalid signature")
+		} else {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.SetBodyString("Invalid webhook event")
+		}
+		return nil
+	}
+
+	if !cfg.accepts(event.Type) {
+		s.slog.Debug("webhook event type ignored", "provider", cfg.Provider, "event", event.Type)
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.SetBodyString("Event ignored")
+		return nil
+	}
+	return event
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/valyala/fasthttp"
+)
+
+const webhookSecret = "whsec_test"
+
+func webhookMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(webhookSecret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func stripeSignature(body string, ts time.Time) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(webhookMAC(t+"."+body))
+}
+
+// serveWebhook runs the request through the source and returns the message received by the pipeline, if any
+func serveWebhook(s *HTTPSource, ctx *fasthttp.RequestCtx) (meta map[string]string, data []byte) {
+	s.c = make(chan *message.RunnerMessage, 1)
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		select {
+		case msg := <-s.c:
+			meta, data, _ = msg.GetMetadataAndData()
+			_ = msg.Ack(nil)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}()
+	s.handleRequest(ctx)
+	<-received
+	return meta, data
+}
+
+func TestWebhookStripe(t *testing.T) {
+	src := mustNewHTTPSource(t, map[string]any{
+		"address": httpTestAddr,
+		"webhook": map[string]any{"provider": "stripe", "secret": webhookSecret},
+	})
+
+	body := `{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount":100}}}`
+	ctx := newReplayRequest(body, map[string]string{"Stripe-Signature": stripeSignature(body, time.Now())})
+	meta, data := serveWebhook(src, ctx)
+	if ctx.Response.StatusCode() != fasthttp.StatusAccepted {
+		t.Fatalf("expected 202, got %d", ctx.Response.StatusCode())
+	}
+	if meta[metaWebhookProvider] != "stripe" || meta[metaWebhookEvent] != "payment_intent.succeeded" || meta[metaWebhookDelivery] != "evt_1" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+	if string(data) != `{"id":"pi_1","amount":100}` {
+		t.Errorf("expected unwrapped object, got %s", data)
+	}
+
+	stale := newReplayRequest(body, map[string]string{"Stripe-Signature": stripeSignature(body, time.Now().Add(-time.Hour))})
+	if _, data := serveWebhook(src, stale); data != nil || stale.Response.StatusCode() != fasthttp.StatusUnauthorized {
+		t.Errorf("expected stale signature rejected, got %d", stale.Response.StatusCode())
+	}
+
+	tampered := newReplayRequest(`{"id":"evt_2"}`, map[string]string{"Stripe-Signature": stripeSignature(body, time.Now())})
+	if _, data := serveWebhook(src, tampered); data != nil || tampered.Response.StatusCode() != fasthttp.StatusUnauthorized {
+		t.Errorf("expected tampered body rejected, got %d", tampered.Response.StatusCode())
+	}
+}
+
+func TestWebhookGitHub(t *testing.T) {
+	src := mustNewHTTPSource(t, map[string]any{
+		"address": httpTestAddr,
+		"webhook": map[string]any{"provider": "github", "secret": webhookSecret, "eventTypes": []string{"issues"}},
+	})
+
+	body := `{"action":"opened","issue":{"number":1}}`
+	headers := map[string]string{
+		"X-Hub-Signature-256": "sha256=" + hex.EncodeToString(webhookMAC(body)),
+		"X-GitHub-Event":      "issues",
+		"X-GitHub-Delivery":   "d-1",
+	}
+	meta, data := serveWebhook(src, newReplayRequest(body, headers))
+	if meta[metaWebhookEvent] != "issues" || meta[metaWebhookDelivery] != "d-1" || meta[metaWebhookAction] != "opened" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+	if string(data) != body {
+		t.Errorf("expected body as payload, got %s", data)
+	}
+
+	// Other event types are acknowledged without reaching the pipeline
+	headers["X-GitHub-Event"] = "push"
+	ignored := newReplayRequest(body, headers)
+	if _, data := serveWebhook(src, ignored); data != nil || ignored.Response.StatusCode() != fasthttp.StatusOK {
+		t.Errorf("expected ignored event answered with 200, got %d", ignored.Response.StatusCode())
+	}
+}
+
+func TestWebhookShopifyDeduplication(t *testing.T) {
+	src := mustNewHTTPSource(t, map[string]any{
+		"address": httpTestAddr,
+		"webhook": map[string]any{"provider": "shopify", "secret": webhookSecret},
+		"replay":  map[string]any{"enabled": true, "mode": "conflict"},
+	})
+
+	body := `{"id":42}`
+	headers := map[string]string{
+		"X-Shopify-Hmac-Sha256": base64.StdEncoding.EncodeToString(webhookMAC(body)),
+		"X-Shopify-Topic":       "orders/create",
+		"X-Shopify-Webhook-Id":  "w-1",
+	}
+	meta, _ := serveWebhook(src, newReplayRequest(body, headers))
+	if meta[metaWebhookEvent] != "orders/create" || meta[metaWebhookDelivery] != "w-1" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+
+	// A retry of the same delivery is deduplicated by its webhook id
+	retry := newReplayRequest(body, headers)
+	if _, data := serveWebhook(src, retry); data != nil || retry.Response.StatusCode() != fasthttp.StatusConflict {
+		t.Errorf("expected retry rejected as duplicate, got %d", retry.Response.StatusCode())
+	}
+
+	headers["X-Shopify-Hmac-Sha256"] = base64.StdEncoding.EncodeToString([]byte("wrong"))
+	invalid := newReplayRequest(body, headers)
+	if _, data := serveWebhook(src, invalid); data != nil || invalid.Response.StatusCode() != fasthttp.StatusUnauthorized {
+		t.Errorf("expected invalid signature rejected, got %d", invalid.Response.StatusCode())
+	}
+}
+
+func TestWebhookConfigValidation(t *testing.T) {
+	cfg := new(SourceConfig)
+	cfg.Address = httpTestAddr
+	cfg.Webhook = WebhookConfig{Provider: "stripe", Secret: "env:EB_TEST_MISSING_WEBHOOK_SECRET"}
+	if _, err := NewSource(cfg); err == nil {
+		t.Error("expected error with an empty webhook secret")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// priorityNames are the syslog priority names, indexed by priority
+var priorityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// Entry is the JSON payload of a journal entry. Fields holds all the entry fields;
+// binary values are converted to strings and multi-valued fields to arrays.
+type Entry struct {
+	Timestamp    time.Time      `json:"timestamp"`
+	Cursor       string         `json:"cursor"`
+	Message      string         `json:"message"`
+	Priority     int            `json:"priority"`
+	PriorityName string         `json:"priorityName"`
+	Unit         string         `json:"unit,omitempty"`
+	Identifier   string         `json:"identifier,omitempty"`
+	PID          int            `json:"pid,omitempty"`
+	Hostname     string         `json:"hostname,omitempty"`
+	BootID       string         `json:"bootId,omitempty"`
+	Fields       map[string]any `json:"fields"`
+}
+
+// parseEntry parses a line of the journalctl JSON output
+func parseEntry(line []byte) (*Entry, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return nil, fmt.Errorf("invalid journal entry: %w", err)
+	}
+
+	e := &Entry{Priority: 6, Fields: make(map[string]any, len(raw))}
+	for name, value := range raw {
+		if value = fieldValue(value); value != nil {
+			e.Fields[name] = value
+		}
+	}
+
+	e.Cursor = e.field("__CURSOR")
+	if e.Cursor == "" {
+		return nil, errors.New("journal entry without cursor")
+	}
+	if us, err := strconv.ParseInt(e.field("__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		e.Timestamp = time.UnixMicro(us).UTC()
+	}
+	if p, err := strconv.Atoi(e.field("PRIORITY")); err == nil && p >= 0 && p < len(priorityNames) {
+		e.Priority = p
+	}
+	e.PriorityName = priorityNames[e.Priority]
+	e.Message = e.field("MESSAGE")
+	e.Unit = e.field("_SYSTEMD_UNIT")
+	if e.Unit == "" {
+		e.Unit = e.field("_SYSTEMD_USER_UNIT")
+	}
+	e.Identifier = e.field("SYSLOG_IDENTIFIER")
+	e.PID, _ = strconv.Atoi(e.field("_PID"))
+	e.Hostname = e.field("_HOSTNAME")
+	e.BootID = e.field("_BOOT_ID")
+	return e, nil
+}
+
+// field returns the value of a single-valued field
+func (e *Entry) field(name string) string {
+	value, _ := e.Fields[name].(string)
+	return value
+}
+
+// fieldValue converts a field value of the JSON output: strings are kept, binary values
+// (arrays of bytes) are converted to strings, and multi-valued fields to arrays of values.
+// Null values, used for fields too large to show, are dropped.
+func fieldValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []any:
+		if b, ok := byteValue(v); ok {
+			return string(b)
+		}
+		values := make([]any, 0, len(v))
+		for _, item := range v {
+			if item = fieldValue(item); item != nil {
+				values = append(values, item)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// byteValue returns the bytes of a binary field value
+func byteValue(values []any) ([]byte, bool) {
+	b := make([]byte, len(values))
+	for i, item := range values {
+		n, ok := item.(float64)
+		if !ok || n < 0 || n > 255 || n != float64(int(n)) {
+			return nil, false
+		}
+		b[i] = byte(n)
+	}
+	return b, true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/sandrolain/events-bridge/src/common/checkpoint"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &JournaldMessage{}
+
+// JournaldMessage is a journal entry; its ack or nak marks the cursor as processed
+type JournaldMessage struct {
+	entry    *Entry
+	position *checkpoint.Position
+}
+
+func (m *JournaldMessage) GetID() []byte {
+	return []byte(m.entry.Cursor)
+}
+
+func (m *JournaldMessage) GetMetadata() (map[string]string, error) {
+	metadata := map[string]string{
+		"cursor":       m.entry.Cursor,
+		"priority":     strconv.Itoa(m.entry.Priority),
+		"priorityName": m.entry.PriorityName,
+		"timestamp":    m.entry.Timestamp.Format("2006-01-02T15:04:05.000000Z07:00"),
+	}
+	if m.entry.Unit != "" {
+		metadata["unit"] = m.entry.Unit
+	}
+	if m.entry.Identifier != "" {
+		metadata["identifier"] = m.entry.Identifier
+	}
+	if m.entry.Hostname != "" {
+		metadata["hostname"] = m.entry.Hostname
+	}
+	if m.entry.PID != 0 {
+		metadata["pid"] = strconv.Itoa(m.entry.PID)
+	}
+	return metadata, nil
+}
+
+func (m *JournaldMessage) GetData() ([]byte, error) {
+	return json.Marshal(m.entry)
+}
+
+func (m *JournaldMessage) Ack(data *message.ReplyData) error {
+	// The journal doesn't support reply
+	m.position.Done()
+	return nil
+}
+
+// Nak marks the cursor as processed too: the journal can't redeliver an entry,
+// and a failed entry must not block the checkpoint of the following ones
+func (m *JournaldMessage) Nak() error {
+	m.position.Done()
+	return nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/checkpoint"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	startAtEnd       = "end"
+	startAtBeginning = "beginning"
+
+	// checkpointKey is the key of the cursor in the checkpoint file
+	checkpointKey = "cursor"
+)
+
+var (
+	priorityRe = regexp.MustCompile(`^(emerg|alert|crit|err|warning|notice|info|debug|[0-7])(\.\.(emerg|alert|crit|err|warning|notice|info|debug|[0-7]))?$`)
+	matchRe    = regexp.MustCompile(`^([A-Z0-9_]+=.*|\+)$`)
+)
+
+// SourceConfig defines the configuration for the journald source connector.
+// Entries are read by following the journalctl JSON output.
+type SourceConfig struct {
+	// Command is the journalctl executable
+	Command string `mapstructure:"command" default:"journalctl" validate:"required"`
+	// Directory reads the journal files of a directory instead of the system journal
+	Directory string `mapstructure:"directory"`
+	// Units filters the entries of the system units (e.g. "nginx.service", globs allowed)
+	Units []string `mapstructure:"units" validate:"dive,required"`
+	// UserUnits filters the entries of the user units
+	UserUnits []string `mapstructure:"userUnits" validate:"dive,required"`
+	// Identifiers filters the entries by syslog identifier
+	Identifiers []string `mapstructure:"identifiers" validate:"dive,required"`
+	// Priority filters the entries by priority: a maximum ("warning") or a range ("emerg..err")
+	Priority string `mapstructure:"priority"`
+	// Matches are additional journal matches ("FIELD=value"; "+" separates disjunctions)
+	Matches []string `mapstructure:"matches" validate:"dive,required"`
+	// StartAt is the position read from without checkpoint: "end" (new entries only) or "beginning"
+	StartAt string `mapstructure:"startAt" default:"end" validate:"oneof=end beginning"`
+	// Since reads from a time without checkpoint, in the journalctl format (e.g. "-1h", "2024-01-01 00:00:00")
+	Since string `mapstructure:"since"`
+	// CheckpointFile stores the cursor of the last processed entry, to resume after it on restart
+	CheckpointFile string `mapstructure:"checkpointFile"`
+	// CheckpointInterval is the interval between checkpoint file writes
+	CheckpointInterval time.Duration `mapstructure:"checkpointInterval" default:"5s" validate:"gt=0"`
+	// RestartDelay is the wait before restarting journalctl after it exits
+	RestartDelay time.Duration `mapstructure:"restartDelay" default:"5s" validate:"gt=0"`
+	// MaxEntrySize is the maximum size in bytes of an entry in the JSON output
+	MaxEntrySize int `mapstructure:"maxEntrySize" default:"1048576" validate:"gt=0"`
+}
+
+type JournaldSource struct {
+	cfg        *SourceConfig
+	slog       *slog.Logger
+	checkpoint *checkpoint.File
+	tracker    *checkpoint.Tracker
+	// cursor is the cursor of the last emitted entry, journalctl restarts after it
+	cursor string
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	c      chan *message.RunnerMessage
+}
+
+func NewSourceConfig() any {
+	return new(SourceConfig)
+}
+
+// NewSource creates a journald source from config
+func NewSource(anyCfg any) (connectors.Source, error) {
+	cfg, ok := anyCfg.(*SourceConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	if cfg.Priority != "" && !priorityRe.MatchString(cfg.Priority) {
+		return nil, fmt.Errorf("invalid priority %q", cfg.Priority)
+	}
+	for _, m := range cfg.Matches {
+		if !matchRe.MatchString(m) {
+			return nil, fmt.Errorf("invalid match %q: expected FIELD=value or +", m)
+		}
+	}
+
+	file, err := checkpoint.Open(cfg.CheckpointFile)
+	if err != nil {
+		return nil, err
+	}
+	cursor, _ := file.Get(checkpointKey)
+
+	return &JournaldSource{
+		cfg:        cfg,
+		slog:       slog.Default().With("context", "Journald Source"),
+		checkpoint: file,
+		tracker:    file.Tracker(checkpointKey),
+		cursor:     cursor,
+	}, nil
+}
+
+func (s *JournaldSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	if s.c != nil {
+		return nil, errors.New("produce already called")
+	}
+	if _, err := exec.LookPath(s.cfg.Command); err != nil {
+		return nil, fmt.Errorf("journalctl not found: %w", err)
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.c = make(chan *message.RunnerMessage, buffer)
+
+	s.slog.Info("starting journald source",
+		"units", s.cfg.Units,
+		"identifiers", s.cfg.Identifiers,
+		"priority", s.cfg.Priority,
+		"cursor", s.cursor != "",
+	)
+
+	s.wg.Add(2)
+	go s.run()
+	go s.flushLoop()
+	return s.c, nil
+}
+
+// args returns the journalctl arguments, following the journal after the cursor if set
+func (s *JournaldSource) args(cursor string) []string {
+	args := []string{"--output=json", "--follow", "--all", "--no-pager", "--quiet"}
+	if s.cfg.Directory != "" {
+		args = append(args, "--directory="+s.cfg.Directory)
+	}
+	for _, unit := range s.cfg.Units {
+		args = append(args, "--unit="+unit)
+	}
+	for _, unit := range s.cfg.UserUnits {
+		args = append(args, "--user-unit="+unit)
+	}
+	for _, id := range s.cfg.Identifiers {
+		args = append(args, "--identifier="+id)
+	}
+	if s.cfg.Priority != "" {
+		args = append(args, "--priority="+s.cfg.Priority)
+	}
+	switch {
+	case cursor != "":
+		args = append(args, "--after-cursor="+cursor)
+	case s.cfg.Since != "":
+		args = append(args, "--since="+s.cfg.Since)
+	case s.cfg.StartAt == startAtBeginning:
+		args = append(args, "--no-tail")
+	default:
+		args = append(args, "--lines=0")
+	}
+	return append(args, s.cfg.Matches...)
+}
+
+// run follows the journal, restarting journalctl when it exits
+func (s *JournaldSource) run() {
+	defer s.wg.Done()
+	for {
+		err := s.follow()
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.slog.Error("journalctl exited, restarting", "error", err, "delay", s.cfg.RestartDelay)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(s.cfg.RestartDelay):
+		}
+	}
+}
+
+// follow runs journalctl and emits its entries until it exits
+func (s *JournaldSource) follow() error {
+	cmd := exec.CommandContext(s.ctx, s.cfg.Command, s.args(s.cursor)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdout: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stderr: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start journalctl: %w", err)
+	}
+	go s.logStderr(stderr)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), s.cfg.MaxEntrySize)
+	for scanner.Scan() {
+		entry, err := parseEntry(scanner.Bytes())
+		if err != nil {
+			s.slog.Warn("skipping journal entry", "error", err)
+			continue
+		}
+		msg := &JournaldMessage{entry: entry, position: s.tracker.Track(entry.Cursor)}
+		select {
+		case s.c <- message.NewRunnerMessage(msg):
+			s.cursor = entry.Cursor
+		case <-s.ctx.Done():
+			return cmd.Wait()
+		}
+	}
+
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		_ = cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+	if scanErr != nil {
+		return fmt.Errorf("error reading journal entries: %w", scanErr)
+	}
+	if waitErr != nil {
+		return waitErr
+	}
+	return errors.New("journalctl exited")
+}
+
+func (s *JournaldSource) logStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		s.slog.Warn("journalctl", "stderr", scanner.Text())
+	}
+}
+
+// flushLoop writes the checkpoint file periodically
+func (s *JournaldSource) flushLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.checkpoint.Flush(); err != nil {
+				s.slog.Error("failed to write checkpoint", "error", err)
+			}
+		}
+	}
+}
+
+func (s *JournaldSource) Close() error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	s.wg.Wait()
+	close(s.c)
+	s.cancel = nil
+
+	if err := s.checkpoint.Flush(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+const testEntries = `{"__CURSOR":"s=1;i=1","__REALTIME_TIMESTAMP":"1700000000123456","PRIORITY":"3","MESSAGE":"failed to bind","_SYSTEMD_UNIT":"nginx.service","SYSLOG_IDENTIFIER":"nginx","_PID":"42","_HOSTNAME":"web-1","BINARY":[104,105],"TAG":["a","b"],"LARGE":null}
+not json
+{"__CURSOR":"s=1;i=2","__REALTIME_TIMESTAMP":"1700000001000000","MESSAGE":"started","_SYSTEMD_USER_UNIT":"app.service"}
+`
+
+// newFakeJournalctl writes a journalctl stand-in that logs its arguments, prints the
+// entries of the first run and then keeps following
+func newFakeJournalctl(t *testing.T) (command string, argsLog string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on windows")
+	}
+	dir := t.TempDir()
+	argsLog = filepath.Join(dir, "args.log")
+	entries := filepath.Join(dir, "entries.json")
+	if err := os.WriteFile(entries, []byte(testEntries), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\n" +
+		"echo \"$*\" >> " + argsLog + "\n" +
+		"if [ ! -f " + dir + "/started ]; then touch " + dir + "/started; cat " + entries + "; exit 1; fi\n" +
+		"exec sleep 60\n"
+	command = filepath.Join(dir, "journalctl")
+	if err := os.WriteFile(command, []byte(script), 0o700); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+	return command, argsLog
+}
+
+func newTestSource(t *testing.T, opts map[string]any) *JournaldSource {
+	t.Helper()
+	cfg := new(SourceConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("ParseConfig() unexpected error = %v", err)
+	}
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	return src.(*JournaldSource)
+}
+
+func receive(t *testing.T, c <-chan *message.RunnerMessage) *message.RunnerMessage {
+	t.Helper()
+	select {
+	case msg := <-c:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a message")
+		return nil
+	}
+}
+
+func TestJournaldSource(t *testing.T) {
+	command, argsLog := newFakeJournalctl(t)
+	checkpointFile := filepath.Join(t.TempDir(), "journald.json")
+	src := newTestSource(t, map[string]any{
+		"command":            command,
+		"units":              []any{"nginx.service"},
+		"priority":           "err",
+		"matches":            []any{"_TRANSPORT=journal"},
+		"checkpointFile":     checkpointFile,
+		"checkpointInterval": "1h",
+		"restartDelay":       "10ms",
+	})
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+
+	first, second := receive(t, c), receive(t, c)
+
+	meta, _ := first.GetMetadata()
+	if meta["cursor"] != "s=1;i=1" || meta["unit"] != "nginx.service" || meta["priorityName"] != "err" || meta["pid"] != "42" || meta["hostname"] != "web-1" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+	data, _ := first.GetData()
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if entry.Message != "failed to bind" || entry.Priority != 3 || entry.Identifier != "nginx" || !entry.Timestamp.Equal(time.UnixMicro(1700000000123456)) {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if entry.Fields["BINARY"] != "hi" || len(entry.Fields["TAG"].([]any)) != 2 {
+		t.Errorf("unexpected fields %v", entry.Fields)
+	}
+	if _, ok := entry.Fields["LARGE"]; ok {
+		t.Errorf("null field not dropped")
+	}
+
+	meta, _ = second.GetMetadata()
+	if meta["unit"] != "app.service" || meta["priority"] != "6" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+
+	// journalctl restarts after the last emitted entry
+	deadline := time.Now().Add(5 * time.Second)
+	var runs []string
+	for len(runs) < 2 && time.Now().Before(deadline) {
+		data, _ := os.ReadFile(argsLog)
+		runs = strings.Split(strings.TrimSpace(string(data)), "\n")
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(runs) < 2 {
+		t.Fatalf("journalctl not restarted")
+	}
+	args := strings.Fields(runs[0])
+	for _, want := range []string{"--output=json", "--follow", "--unit=nginx.service", "--priority=err", "--lines=0", "_TRANSPORT=journal"} {
+		if !slices.Contains(args, want) {
+			t.Errorf("args %v missing %s", args, want)
+		}
+	}
+	if !strings.Contains(runs[1], "--after-cursor=s=1;i=2") {
+		t.Errorf("restart args = %s, want the cursor of the last entry", runs[1])
+	}
+
+	// The checkpoint advances only once the previous entries are processed
+	if err := second.Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := src.checkpoint.Get(checkpointKey); ok {
+		t.Errorf("cursor committed before the previous entry is processed")
+	}
+	if err := first.Nak(); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatalf("Close() unexpected error = %v", err)
+	}
+
+	resumed := newTestSource(t, map[string]any{"command": command, "checkpointFile": checkpointFile})
+	if resumed.cursor != "s=1;i=2" {
+		t.Errorf("resumed cursor = %q, want s=1;i=2", resumed.cursor)
+	}
+}
+
+func TestJournaldSourceArgs(t *testing.T) {
+	src := newTestSource(t, map[string]any{"startAt": "beginning", "userUnits": []any{"app.service"}, "identifiers": []any{"sshd"}})
+	args := src.args("")
+	if !slices.Contains(args, "--no-tail") || !slices.Contains(args, "--user-unit=app.service") || !slices.Contains(args, "--identifier=sshd") {
+		t.Errorf("unexpected args %v", args)
+	}
+	src = newTestSource(t, map[string]any{"since": "-1h", "directory": "/var/log/journal/remote"})
+	args = src.args("")
+	if !slices.Contains(args, "--since=-1h") || !slices.Contains(args, "--directory=/var/log/journal/remote") {
+		t.Errorf("unexpected args %v", args)
+	}
+}
+
+func TestJournaldSourceConfigValidation(t *testing.T) {
+	for _, opts := range []map[string]any{
+		{"startAt": "middle"},
+		{"priority": "loud"},
+		{"priority": "err..9"},
+		{"matches": []any{"lowercase=x"}},
+	} {
+		cfg := new(SourceConfig)
+		if err := utils.ParseConfig(opts, cfg); err != nil {
+			continue
+		}
+		if _, err := NewSource(cfg); err == nil {
+			t.Errorf("NewSource(%v) expected error", opts)
+		}
+	}
+	for _, opts := range []map[string]any{
+		{"priority": "0..warning"},
+		{"matches": []any{"_PID=1", "+", "_COMM=sshd"}},
+	} {
+		newTestSource(t, opts)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &K8sMessage{}
+
+// Change is a difference between the previous and the current object.
+// Path is a JSON pointer; arrays are compared as a whole.
+type Change struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+// K8sMessage is an add/update/delete notification of a watched object
+type K8sMessage struct {
+	eventType string
+	gvr       schema.GroupVersionResource
+	object    *unstructured.Unstructured
+	diff      []Change
+}
+
+func (m *K8sMessage) GetID() []byte {
+	return []byte(string(m.object.GetUID()) + "/" + m.object.GetResourceVersion() + "/" + m.eventType)
+}
+
+func (m *K8sMessage) GetMetadata() (map[string]string, error) {
+	return map[string]string{
+		"type":            m.eventType,
+		"group":           m.gvr.Group,
+		"version":         m.gvr.Version,
+		"resource":        m.gvr.Resource,
+		"kind":            m.object.GetKind(),
+		"namespace":       m.object.GetNamespace(),
+		"name":            m.object.GetName(),
+		"uid":             string(m.object.GetUID()),
+		"resourceVersion": m.object.GetResourceVersion(),
+	}, nil
+}
+
+func (m *K8sMessage) GetData() ([]byte, error) {
+	data := map[string]any{
+		"type":      m.eventType,
+		"resource":  m.gvr.Resource,
+		"namespace": m.object.GetNamespace(),
+		"name":      m.object.GetName(),
+		"object":    m.object.Object,
+	}
+	if m.eventType == eventUpdate {
+		data["diff"] = m.diff
+	}
+	return json.Marshal(data)
+}
+
+func (m *K8sMessage) Ack(data *message.ReplyData) error {
+	// Kubernetes watches don't support reply
+	return nil
+}
+
+func (m *K8sMessage) Nak() error {
+	return nil
+}
+
+// ignoredPaths change on every update and are left out of the diff
+var ignoredPaths = map[string]bool{
+	"/metadata/resourceVersion": true,
+	"/metadata/managedFields":   true,
+}
+
+// diffObjects returns the changes from the old to the new object
+func diffObjects(oldObj, newObj map[string]any) []Change {
+	changes := []Change{}
+	diffMaps("", oldObj, newObj, &changes)
+	return changes
+}
+
+func diffMaps(prefix string, oldMap, newMap map[string]any, changes *[]Change) {
+	keys := make([]string, 0, len(oldMap)+len(newMap))
+	for k := range oldMap {
+		keys = append(keys, k)
+	}
+	for k := range newMap {
+		if _, ok := oldMap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path := prefix + "/" + escapePointer(k)
+		if ignoredPaths[path] {
+			continue
+		}
+		oldVal, inOld := oldMap[k]
+		newVal, inNew := newMap[k]
+		switch {
+		case !inOld:
+			*changes = append(*changes, Change{Op: "add", Path: path, New: newVal})
+		case !inNew:
+			*changes = append(*changes, Change{Op: "remove", Path: path, Old: oldVal})
+		default:
+			oldChild, oldIsMap := oldVal.(map[string]any)
+			newChild, newIsMap := newVal.(map[string]any)
+			if oldIsMap && newIsMap {
+				diffMaps(path, oldChild, newChild, changes)
+			} else if !reflect.DeepEqual(oldVal, newVal) {
+				*changes = append(*changes, Change{Op: "replace", Path: path, Old: oldVal, New: newVal})
+			}
+		}
+	}
+}
+
+// escapePointer escapes a key as a JSON pointer token
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/yaml"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure K8sRunner implements connectors.Runner
+var _ connectors.Runner = &K8sRunner{}
+
+const (
+	operationApply = "apply"
+	operationPatch = "patch"
+)
+
+// patchTypes maps the configured patch type to the Kubernetes patch type
+var patchTypes = map[string]types.PatchType{
+	"merge":     types.MergePatchType,
+	"json":      types.JSONPatchType,
+	"strategic": types.StrategicMergePatchType,
+}
+
+// RunnerConfig defines the configuration for the Kubernetes runner connector
+type RunnerConfig struct {
+	// Kubeconfig is the path of the kubeconfig file (empty = in-cluster configuration,
+	// falling back to the default kubeconfig loading rules). Access is limited by the RBAC
+	// rules bound to its credentials or to the pod service account.
+	Kubeconfig string `mapstructure:"kubeconfig"`
+	// Context is the kubeconfig context to use (empty = current context)
+	Context string `mapstructure:"context"`
+	// Operation is "apply" (server-side apply of the payload manifest) or "patch" (the payload
+	// is the patch of a named resource)
+	Operation string `mapstructure:"operation" default:"apply" validate:"oneof=apply patch"`
+	// Namespace is the namespace of namespaced objects not declaring one
+	Namespace string `mapstructure:"namespace" default:"default"`
+	// FieldManager is the field manager name recorded by server-side apply and patches
+	FieldManager string `mapstructure:"fieldManager" default:"events-bridge" validate:"required"`
+	// Force takes ownership of the fields conflicting with other managers on apply
+	Force bool `mapstructure:"force" default:"false"`
+	// DryRun validates the request on the server without persisting it
+	DryRun bool `mapstructure:"dryRun" default:"false"`
+
+	// Group of the patched resource (empty for the core group)
+	Group string `mapstructure:"group"`
+	// Version of the patched resource (e.g., "v1")
+	Version string `mapstructure:"version" validate:"required_if=Operation patch"`
+	// Resource is the plural name of the patched resource (e.g., "deployments")
+	Resource string `mapstructure:"resource" validate:"required_if=Operation patch"`
+	// Name of the patched object
+	Name string `mapstructure:"name"`
+	// NameFromMetadataKey reads the patched object name from message metadata, overriding Name
+	NameFromMetadataKey string `mapstructure:"nameFromMetadataKey"`
+	// NamespaceFromMetadataKey reads the namespace from message metadata, overriding Namespace
+	NamespaceFromMetadataKey string `mapstructure:"namespaceFromMetadataKey"`
+	// PatchType is "merge" (JSON merge patch), "json" (JSON patch) or "strategic" (strategic merge patch)
+	PatchType string `mapstructure:"patchType" default:"merge" validate:"oneof=merge json strategic"`
+
+	// MetadataPrefix is the prefix of the metadata keys set with the result
+	MetadataPrefix string `mapstructure:"metadataPrefix" default:"k8s-"`
+	// Timeout of each request
+	Timeout time.Duration `mapstructure:"timeout" default:"10s" validate:"gt=0"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+type K8sRunner struct {
+	cfg    *RunnerConfig
+	slog   *slog.Logger
+	client dynamic.Interface
+	mapper meta.ResettableRESTMapper
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a Kubernetes runner from config
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	restCfg, err := buildRestConfig(cfg.Kubeconfig, cfg.Context)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Kubernetes client config: %w", err)
+	}
+	client, err := dynamic.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes discovery client: %w", err)
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	return newK8sRunner(cfg, client, mapper)
+}
+
+func newK8sRunner(cfg *RunnerConfig, client dynamic.Interface, mapper meta.ResettableRESTMapper) (*K8sRunner, error) {
+	if cfg.Operation == operationPatch && cfg.Name == "" && cfg.NameFromMetadataKey == "" {
+		return nil, fmt.Errorf("name or nameFromMetadataKey is required for the patch operation")
+	}
+
+	r := &K8sRunner{
+		cfg:    cfg,
+		slog:   slog.Default().With("context", "K8s Runner"),
+		client: client,
+		mapper: mapper,
+	}
+	r.slog.Info("Kubernetes runner created",
+		"operation", cfg.Operation,
+		"namespace", cfg.Namespace,
+		"fieldManager", cfg.FieldManager,
+		"dryRun", cfg.DryRun,
+	)
+	return r, nil
+}
+
+// Process applies or patches the resource and writes the result to the metadata
+func (r *K8sRunner) Process(msg *message.RunnerMessage) error {
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds limit %d", len(data), r.cfg.MaxInputSize)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+
+	var result *unstructured.Unstructured
+	switch r.cfg.Operation {
+	case operationPatch:
+		result, err = r.patch(ctx, metadata, data)
+	default:
+		result, err = r.apply(ctx, data)
+	}
+	if err != nil {
+		msg.AddMetadata(r.cfg.MetadataPrefix+"status", "failed")
+		return err
+	}
+
+	status := "applied"
+	if r.cfg.Operation == operationPatch {
+		status = "patched"
+	}
+	msg.MergeMetadata(map[string]string{
+		r.cfg.MetadataPrefix + "status":          status,
+		r.cfg.MetadataPrefix + "dryRun":          strconv.FormatBool(r.cfg.DryRun),
+		r.cfg.MetadataPrefix + "kind":            result.GetKind(),
+		r.cfg.MetadataPrefix + "namespace":       result.GetNamespace(),
+		r.cfg.MetadataPrefix + "name":            result.GetName(),
+		r.cfg.MetadataPrefix + "uid":             string(result.GetUID()),
+		r.cfg.MetadataPrefix + "resourceVersion": result.GetResourceVersion(),
+		r.cfg.MetadataPrefix + "generation":      strconv.FormatInt(result.GetGeneration(), 10),
+	})
+
+	r.slog.Debug("Kubernetes resource "+status,
+		"kind", result.GetKind(),
+		"namespace", result.GetNamespace(),
+		"name", result.GetName(),
+		"dryRun", r.cfg.DryRun,
+	)
+	return nil
+}
+
+// apply server-side applies the manifest (JSON or YAML) of the payload
+func (r *K8sRunner) apply(ctx context.Context, data []byte) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	gvk := obj.GroupVersionKind()
+	if gvk.Version == "" || gvk.Kind == "" {
+		return nil, fmt.Errorf("manifest must declare apiVersion and kind")
+	}
+	if obj.GetName() == "" {
+		return nil, fmt.Errorf("manifest must declare metadata.name")
+	}
+
+	mapping, err := r.restMapping(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace && obj.GetNamespace() == "" {
+		obj.SetNamespace(r.cfg.Namespace)
+	}
+
+	opts := metav1.ApplyOptions{FieldManager: r.cfg.FieldManager, Force: r.cfg.Force}
+	if r.cfg.DryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	result, err := r.resourceInterface(mapping, obj.GetNamespace()).Apply(ctx, obj.GetName(), obj, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply %s %s: %w", gvk.Kind, obj.GetName(), err)
+	}
+	return result, nil
+}
+
+// restMapping resolves the resource of the kind, refreshing the discovery cache once
+// for kinds registered after startup (e.g., new CRDs)
+func (r *K8sRunner) restMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		r.mapper.Reset()
+		mapping, err = r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve resource of %s: %w", gvk, err)
+	}
+	return mapping, nil
+}
+
+// resourceInterface returns the client of the mapped resource, scoped to the namespace
+// when the resource is namespaced
+func (r *K8sRunner) resourceInterface(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	resource := r.client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return resource.Namespace(namespace)
+	}
+	return resource
+}
+
+// patch applies the payload as patch of the named resource
+func (r *K8sRunner) patch(ctx context.Context, metadata map[string]string, data []byte) (*unstructured.Unstructured, error) {
+	name := r.cfg.Name
+	if r.cfg.NameFromMetadataKey != "" {
+		if v := metadata[r.cfg.NameFromMetadataKey]; v != "" {
+			name = v
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("missing resource name in metadata key %s", r.cfg.NameFromMetadataKey)
+	}
+	namespace := r.cfg.Namespace
+	if r.cfg.NamespaceFromMetadataKey != "" {
+		if v := metadata[r.cfg.NamespaceFromMetadataKey]; v != "" {
+			namespace = v
+		}
+	}
+
+	gvr := schema.GroupVersionResource{Group: r.cfg.Group, Version: r.cfg.Version, Resource: r.cfg.Resource}
+	gvk, err := r.mapper.KindFor(gvr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve kind of %s: %w", gvr, err)
+	}
+	mapping, err := r.restMapping(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := metav1.PatchOptions{FieldManager: r.cfg.FieldManager}
+	if r.cfg.DryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	result, err := r.resourceInterface(mapping, namespace).Patch(ctx, name, patchTypes[r.cfg.PatchType], data, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch %s %s: %w", gvr.Resource, name, err)
+	}
+	return result, nil
+}
+
+func (r *K8sRunner) Close() error {
+	r.slog.Info("closing Kubernetes runner")
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+var configMapsGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+// testMapper is a static REST mapper of the resources used by the tests
+type testMapper struct {
+	*meta.DefaultRESTMapper
+}
+
+func (testMapper) Reset() {}
+
+func newTestMapper() testMapper {
+	m := meta.NewDefaultRESTMapper(nil)
+	m.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	m.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	return testMapper{m}
+}
+
+func newConfigMap(name, namespace string, data map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": name, "namespace": namespace, "uid": "uid-" + name},
+		"data":       data,
+	}}
+}
+
+func mustNewK8sRunner(t *testing.T, opts map[string]any, objects ...runtime.Object) (*K8sRunner, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configMapsGVR: "ConfigMapList"}, objects...)
+	r, err := newK8sRunner(cfg, client, newTestMapper())
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	return r, client
+}
+
+func newRunnerMessage(data []byte, metadata map[string]string) *message.RunnerMessage {
+	return message.NewRunnerMessage(testutil.NewAdapter(data, metadata))
+}
+
+func lastPatch(t *testing.T, client *dynamicfake.FakeDynamicClient) k8stesting.PatchActionImpl {
+	t.Helper()
+	actions := client.Actions()
+	if len(actions) == 0 {
+		t.Fatal("no actions recorded")
+	}
+	action, ok := actions[len(actions)-1].(k8stesting.PatchActionImpl)
+	if !ok {
+		t.Fatalf("expected patch action, got %T", actions[len(actions)-1])
+	}
+	return action
+}
+
+func TestK8sRunnerConfig(t *testing.T) {
+	if err := utils.ParseConfig(map[string]any{"operation": "patch"}, new(RunnerConfig)); err == nil {
+		t.Error("expected validation error for patch without resource")
+	}
+	if err := utils.ParseConfig(map[string]any{"patchType": "xml"}, new(RunnerConfig)); err == nil {
+		t.Error("expected validation error for invalid patch type")
+	}
+
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(map[string]any{"operation": "patch", "version": "v1", "resource": "configmaps"}, cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	if _, err := newK8sRunner(cfg, nil, newTestMapper()); err == nil {
+		t.Error("expected error for patch without name")
+	}
+}
+
+func TestK8sRunnerApply(t *testing.T) {
+	r, client := mustNewK8sRunner(t, map[string]any{"namespace": "apps", "dryRun": true, "force": true},
+		newConfigMap("settings", "apps", map[string]any{"mode": "old"}))
+
+	// The fake tracker can't merge applied unstructured objects: the reactor returns the manifest
+	client.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		applied := &unstructured.Unstructured{}
+		if err := applied.UnmarshalJSON(action.(k8stesting.PatchActionImpl).GetPatch()); err != nil {
+			return true, nil, err
+		}
+		applied.SetUID("uid-settings")
+		return true, applied, nil
+	})
+
+	manifest := []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  mode: new\n")
+	msg := newRunnerMessage(manifest, nil)
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	action := lastPatch(t, client)
+	if action.GetNamespace() != "apps" || action.GetName() != "settings" {
+		t.Errorf("unexpected target %s/%s", action.GetNamespace(), action.GetName())
+	}
+	opts := action.PatchOptions
+	if opts.FieldManager != "events-bridge" || opts.Force == nil || !*opts.Force {
+		t.Errorf("unexpected apply options: %+v", opts)
+	}
+	if len(opts.DryRun) != 1 || opts.DryRun[0] != metav1.DryRunAll {
+		t.Errorf("expected dry-run, got %v", opts.DryRun)
+	}
+
+	meta, _ := msg.GetMetadata()
+	if meta["k8s-status"] != "applied" || meta["k8s-dryRun"] != "true" || meta["k8s-kind"] != "ConfigMap" ||
+		meta["k8s-namespace"] != "apps" || meta["k8s-uid"] != "uid-settings" {
+		t.Errorf("unexpected result metadata: %v", meta)
+	}
+}
+
+func TestK8sRunnerApplyErrors(t *testing.T) {
+	r, _ := mustNewK8sRunner(t, map[string]any{})
+
+	tests := map[string]string{
+		"invalid manifest": `{"apiVersion":`,
+		"missing kind":     `{"apiVersion":"v1","metadata":{"name":"x"}}`,
+		"missing name":     `{"apiVersion":"v1","kind":"ConfigMap"}`,
+		"unknown kind":     `{"apiVersion":"v1","kind":"Unknown","metadata":{"name":"x"}}`,
+	}
+	for name, manifest := range tests {
+		t.Run(name, func(t *testing.T) {
+			msg := newRunnerMessage([]byte(manifest), nil)
+			if err := r.Process(msg); err == nil {
+				t.Fatal("expected error")
+			}
+			meta, _ := msg.GetMetadata()
+			if meta["k8s-status"] != "failed" {
+				t.Errorf("expected failed status, got %v", meta)
+			}
+		})
+	}
+}
+
+func TestK8sRunnerPatch(t *testing.T) {
+	r, client := mustNewK8sRunner(t, map[string]any{
+		"operation":                "patch",
+		"version":                  "v1",
+		"resource":                 "configmaps",
+		"nameFromMetadataKey":      "target",
+		"namespaceFromMetadataKey": "ns",
+		"metadataPrefix":           "res-",
+	}, newConfigMap("settings", "apps", map[string]any{"mode": "old", "keep": "yes"}))
+
+	msg := newRunnerMessage([]byte(`{"data":{"mode":"new"}}`), map[string]string{"target": "settings", "ns": "apps"})
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	action := lastPatch(t, client)
+	if action.GetPatchType() != patchTypes["merge"] || len(action.PatchOptions.DryRun) != 0 {
+		t.Errorf("unexpected patch action: %+v", action)
+	}
+	meta, _ := msg.GetMetadata()
+	if meta["res-status"] != "patched" || meta["res-name"] != "settings" || meta["res-dryRun"] != "false" {
+		t.Errorf("unexpected result metadata: %v", meta)
+	}
+
+	obj, err := client.Tracker().Get(configMapsGVR, "apps", "settings")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, _, _ := unstructured.NestedStringMap(obj.(*unstructured.Unstructured).Object, "data")
+	if data["mode"] != "new" || data["keep"] != "yes" {
+		t.Errorf("unexpected patched data: %v", data)
+	}
+
+	missing := newRunnerMessage([]byte(`{}`), map[string]string{"ns": "apps"})
+	if err := r.Process(missing); err == nil {
+		t.Error("expected error without resource name")
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	eventAdd    = "add"
+	eventUpdate = "update"
+	eventDelete = "delete"
+)
+
+// ResourceConfig identifies a watched resource (GVR) and the objects to watch
+type ResourceConfig struct {
+	// Group of the resource (empty for the core group)
+	Group string `mapstructure:"group"`
+	// Version of the resource (e.g., "v1")
+	Version string `mapstructure:"version" validate:"required"`
+	// Resource is the plural resource name (e.g., "pods", "deployments")
+	Resource string `mapstructure:"resource" validate:"required"`
+	// Namespace overrides the source namespace for this resource
+	Namespace string `mapstructure:"namespace"`
+	// LabelSelector filters the watched objects (e.g., "app=web,tier!=cache")
+	LabelSelector string `mapstructure:"labelSelector"`
+	// FieldSelector filters the watched objects (e.g., "status.phase=Running")
+	FieldSelector string `mapstructure:"fieldSelector"`
+}
+
+// SourceConfig defines the configuration for the Kubernetes source connector
+type SourceConfig struct {
+	// Kubeconfig is the path of the kubeconfig file (empty = in-cluster configuration,
+	// falling back to the default kubeconfig loading rules)
+	Kubeconfig string `mapstructure:"kubeconfig"`
+	// Context is the kubeconfig context to use (empty = current context)
+	Context string `mapstructure:"context"`
+	// Namespace restricts the watch to a namespace (empty = all namespaces)
+	Namespace string `mapstructure:"namespace"`
+	// Events watches core/v1 Events
+	Events bool `mapstructure:"events" default:"false"`
+	// Resources are the watched resources
+	Resources []ResourceConfig `mapstructure:"resources" validate:"dive"`
+	// EventTypes are the notifications emitted: add, update, delete (empty = all)
+	EventTypes []string `mapstructure:"eventTypes" validate:"dive,oneof=add update delete"`
+	// EmitInitial emits an add notification for the objects existing at startup
+	EmitInitial bool `mapstructure:"emitInitial" default:"false"`
+	// ResyncPeriod is the informer resync period (0 = disabled); resyncs without changes are not emitted
+	ResyncPeriod time.Duration `mapstructure:"resyncPeriod" default:"0s" validate:"min=0"`
+	// SyncTimeout bounds the wait for the initial cache sync
+	SyncTimeout time.Duration `mapstructure:"syncTimeout" default:"30s" validate:"gt=0"`
+}
+
+type K8sSource struct {
+	cfg       *SourceConfig
+	slog      *slog.Logger
+	client    dynamic.Interface
+	resources []ResourceConfig
+	c         chan *message.RunnerMessage
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+func NewSourceConfig() any {
+	return new(SourceConfig)
+}
+
+// NewSource creates a Kubernetes source from config
+func NewSource(anyCfg any) (connectors.Source, error) {
+	cfg, ok := anyCfg.(*SourceConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	restCfg, err := buildRestConfig(cfg.Kubeconfig, cfg.Context)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Kubernetes client config: %w", err)
+	}
+	client, err := dynamic.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return newK8sSource(cfg, client)
+}
+
+func newK8sSource(cfg *SourceConfig, client dynamic.Interface) (*K8sSource, error) {
+	resources := slices.Clone(cfg.Resources)
+	if cfg.Events {
+		resources = append(resources, ResourceConfig{Version: "v1", Resource: "events"})
+	}
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("at least one resource or events must be watched")
+	}
+
+	return &K8sSource{
+		cfg:       cfg,
+		slog:      slog.Default().With("context", "K8s Source"),
+		client:    client,
+		resources: resources,
+		stop:      make(chan struct{}),
+	}, nil
+}
+
+func (s *K8sSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	s.c = make(chan *message.RunnerMessage, buffer)
+
+	s.slog.Info("starting Kubernetes source",
+		"namespace", s.cfg.Namespace,
+		"resources", len(s.resources),
+		"eventTypes", s.cfg.EventTypes,
+		"emitInitial", s.cfg.EmitInitial,
+	)
+
+	var synced []cache.InformerSynced
+	for _, res := range s.resources {
+		informer, err := s.informer(res)
+		if err != nil {
+			s.Close() //nolint:errcheck
+			return nil, err
+		}
+		go informer.Run(s.stop)
+		synced = append(synced, informer.HasSynced)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.SyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		s.Close() //nolint:errcheck
+		return nil, fmt.Errorf("timeout waiting for the Kubernetes informers to sync")
+	}
+
+	return s.c, nil
+}
+
+// informer creates the informer of a watched resource
+func (s *K8sSource) informer(res ResourceConfig) (cache.SharedIndexInformer, error) {
+	gvr := schema.GroupVersionResource{Group: res.Group, Version: res.Version, Resource: res.Resource}
+	namespace := res.Namespace
+	if namespace == "" {
+		namespace = s.cfg.Namespace
+	}
+
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(s.client, s.cfg.ResyncPeriod, namespace, func(opts *metav1.ListOptions) {
+		opts.LabelSelector = res.LabelSelector
+		opts.FieldSelector = res.FieldSelector
+	})
+	informer := factory.ForResource(gvr).Informer()
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj any, isInInitialList bool) {
+			if isInInitialList && !s.cfg.EmitInitial {
+				return
+			}
+			s.emit(gvr, eventAdd, nil, obj)
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			s.emit(gvr, eventUpdate, oldObj, newObj)
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			s.emit(gvr, eventDelete, nil, obj)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add event handler for %s: %w", gvr, err)
+	}
+	return informer, nil
+}
+
+// emit sends a notification for the object, unless filtered out
+func (s *K8sSource) emit(gvr schema.GroupVersionResource, eventType string, oldObj, newObj any) {
+	if len(s.cfg.EventTypes) > 0 && !slices.Contains(s.cfg.EventTypes, eventType) {
+		return
+	}
+	obj, ok := newObj.(*unstructured.Unstructured)
+	if !ok {
+		s.slog.Warn("unexpected object type", "type", fmt.Sprintf("%T", newObj))
+		return
+	}
+
+	var diff []Change
+	if old, ok := oldObj.(*unstructured.Unstructured); ok {
+		// Periodic resyncs deliver updates without changes
+		if old.GetResourceVersion() == obj.GetResourceVersion() {
+			return
+		}
+		diff = diffObjects(old.Object, obj.Object)
+	}
+
+	msg := &K8sMessage{
+		eventType: eventType,
+		gvr:       gvr,
+		object:    obj,
+		diff:      diff,
+	}
+	select {
+	case s.c <- message.NewRunnerMessage(msg):
+	case <-s.stop:
+	}
+}
+
+func (s *K8sSource) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+var podsGVR = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+func newPod(name, rv string, labels map[string]string, phase string) *unstructured.Unstructured {
+	pod := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]any{
+			"name":            name,
+			"namespace":       "default",
+			"uid":             "uid-" + name,
+			"resourceVersion": rv,
+		},
+		"status": map[string]any{"phase": phase},
+	}}
+	pod.SetLabels(labels)
+	return pod
+}
+
+func newFakeClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			podsGVR:                             "PodList",
+			{Version: "v1", Resource: "events"}: "EventList",
+		}, objects...)
+}
+
+func mustNewK8sSource(t *testing.T, opts map[string]any, objects ...runtime.Object) (*K8sSource, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	cfg := new(SourceConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	client := newFakeClient(objects...)
+	src, err := newK8sSource(cfg, client)
+	if err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := src.Close(); err != nil {
+			t.Errorf("close: %v", err)
+		}
+	})
+	return src, client
+}
+
+func receive(t *testing.T, ch <-chan *message.RunnerMessage) (map[string]string, map[string]any) {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		meta, err := msg.GetSourceMetadata()
+		if err != nil {
+			t.Fatalf("metadata: %v", err)
+		}
+		raw, err := msg.GetSourceData()
+		if err != nil {
+			t.Fatalf("data: %v", err)
+		}
+		var data map[string]any
+		if err := json.Unmarshal(raw, &data); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return meta, data
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for notification")
+	}
+	return nil, nil
+}
+
+func TestK8sSourceConfig(t *testing.T) {
+	cfg := new(SourceConfig)
+	if err := utils.ParseConfig(map[string]any{"eventTypes": []any{"create"}}, new(SourceConfig)); err == nil {
+		t.Error("expected validation error for invalid event type")
+	}
+	if err := utils.ParseConfig(map[string]any{}, cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	if _, err := newK8sSource(cfg, newFakeClient()); err == nil {
+		t.Error("expected error without watched resources")
+	}
+}
+
+func TestK8sSourceWatchesResource(t *testing.T) {
+	existing := newPod("existing", "1", map[string]string{"app": "web"}, "Running")
+	src, client := mustNewK8sSource(t, map[string]any{
+		"resources": []any{map[string]any{"version": "v1", "resource": "pods", "labelSelector": "app=web"}},
+	}, existing)
+
+	ch, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("produce: %v", err)
+	}
+	pods := client.Resource(podsGVR).Namespace("default")
+	ctx := context.Background()
+
+	// Existing objects are not emitted
+	if _, err := pods.Create(ctx, newPod("web-1", "3", map[string]string{"app": "web"}, "Pending"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	meta, data := receive(t, ch)
+	if meta["type"] != eventAdd || meta["name"] != "web-1" || meta["kind"] != "Pod" || meta["resource"] != "pods" {
+		t.Errorf("unexpected add metadata: %v", meta)
+	}
+	if _, ok := data["diff"]; ok {
+		t.Error("add notification should not have a diff")
+	}
+
+	if _, err := pods.Update(ctx, newPod("web-1", "4", map[string]string{"app": "web"}, "Running"), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	meta, data = receive(t, ch)
+	if meta["type"] != eventUpdate {
+		t.Fatalf("expected update, got %v", meta)
+	}
+	diff, _ := data["diff"].([]any)
+	if len(diff) != 1 {
+		t.Fatalf("expected a single change, got %v", data["diff"])
+	}
+	change := diff[0].(map[string]any)
+	if change["path"] != "/status/phase" || change["old"] != "Pending" || change["new"] != "Running" {
+		t.Errorf("unexpected change: %v", change)
+	}
+
+	if err := pods.Delete(ctx, "web-1", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	meta, _ = receive(t, ch)
+	if meta["type"] != eventDelete || meta["name"] != "web-1" {
+		t.Errorf("unexpected delete metadata: %v", meta)
+	}
+}
+
+func TestK8sSourceEmitInitialAndEventTypes(t *testing.T) {
+	src, client := mustNewK8sSource(t, map[string]any{
+		"resources":   []any{map[string]any{"version": "v1", "resource": "pods"}},
+		"emitInitial": true,
+		"eventTypes":  []any{"add"},
+	}, newPod("existing", "1", nil, "Running"))
+
+	ch, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("produce: %v", err)
+	}
+	meta, _ := receive(t, ch)
+	if meta["type"] != eventAdd || meta["name"] != "existing" {
+		t.Errorf("expected initial add, got %v", meta)
+	}
+
+	ctx := context.Background()
+	pods := client.Resource(podsGVR).Namespace("default")
+	if err := pods.Delete(ctx, "existing", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := pods.Create(ctx, newPod("new", "2", nil, "Pending"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// The delete notification is filtered out
+	meta, _ = receive(t, ch)
+	if meta["type"] != eventAdd || meta["name"] != "new" {
+		t.Errorf("expected add of new pod, got %v", meta)
+	}
+}
+
+func TestDiffObjects(t *testing.T) {
+	oldObj := map[string]any{
+		"metadata": map[string]any{"resourceVersion": "1", "labels": map[string]any{"a/b": "x"}},
+		"spec":     map[string]any{"replicas": int64(1), "paused": true},
+	}
+	newObj := map[string]any{
+		"metadata": map[string]any{"resourceVersion": "2", "labels": map[string]any{"a/b": "y"}},
+		"spec":     map[string]any{"replicas": int64(3), "image": "nginx"},
+	}
+	changes := diffObjects(oldObj, newObj)
+	want := []Change{
+		{Op: "replace", Path: "/metadata/labels/a~1b", Old: "x", New: "y"},
+		{Op: "add", Path: "/spec/image", New: "nginx"},
+		{Op: "remove", Path: "/spec/paused", Old: true},
+		{Op: "replace", Path: "/spec/replicas", Old: int64(1), New: int64(3)},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d: got %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+}
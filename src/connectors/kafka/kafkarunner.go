@@ -6,6 +6,8 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/sandrolain/events-bridge/src/common/discovery"
+	"github.com/sandrolain/events-bridge/src/common/headermap"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
 	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
@@ -60,6 +62,14 @@ type RunnerConfig struct {
 
 	// SASL holds SASL authentication configuration.
 	SASL *SASLConfig `mapstructure:"sasl"`
+
+	// Discovery resolves the endpoints of the first broker address through DNS (SRV or
+	// every A/AAAA record of the host), balancing the bootstrap connections across them.
+	Discovery *discovery.Config `mapstructure:"discovery"`
+
+	// Headers is the policy of the metadata keys sent as record headers (allow, deny,
+	// rename, prefix). Without it every metadata key is sent.
+	Headers *headermap.Config `mapstructure:"headers"`
 }
 
 func NewRunnerConfig() any {
@@ -75,15 +85,27 @@ func NewRunner(anyCfg any) (connectors.Runner, error) {
 
 	l := slog.Default().With("context", "Kafka Runner")
 
+	headers, err := headermap.New(cfg.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid headers policy: %w", err)
+	}
+
 	// Build dialer with TLS and SASL if configured
 	dialer, err := buildRunnerDialer(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build dialer: %w", err)
 	}
+	if cfg.Discovery != nil {
+		if err := withDiscovery(dialer, cfg.Discovery, cfg.Brokers, l); err != nil {
+			closeDialer(dialer)
+			return nil, err
+		}
+	}
 
 	// Create the topic if it does not exist
 	err = ensureKafkaTopicWithDialer(l, dialer, cfg.Brokers, cfg.Topic, cfg.Partitions, cfg.ReplicationFactor)
 	if err != nil {
+		closeDialer(dialer)
 		return nil, fmt.Errorf("error creating/verifying topic: %w", err)
 	}
 
@@ -113,11 +135,16 @@ func NewRunner(anyCfg any) (connectors.Runner, error) {
 		"async", cfg.Async,
 	)
 
-	return &KafkaRunner{
-		cfg:    cfg,
-		slog:   l,
-		writer: writer,
-	}, nil
+	runner := &KafkaRunner{
+		cfg:     cfg,
+		slog:    l,
+		writer:  writer,
+		dialer:  dialer,
+		headers: headers,
+	}
+	// The brokers were reached to verify the topic
+	runner.SetState(connectors.StateConnected)
+	return runner, nil
 }
 
 // buildRunnerDialer creates a Kafka dialer with TLS and SASL configuration for runners.
@@ -148,10 +175,18 @@ func buildRunnerDialer(cfg *RunnerConfig) (*kafka.Dialer, error) {
 	return dialer, nil
 }
 
+// Ensure KafkaRunner implements connectors.StatusReporter
+var _ connectors.StatusReporter = &KafkaRunner{}
+
 type KafkaRunner struct {
-	cfg    *RunnerConfig
-	slog   *slog.Logger
-	writer *kafka.Writer
+	connectors.StatusTracker
+
+	cfg        *RunnerConfig
+	slog       *slog.Logger
+	writer     *kafka.Writer
+	dialer     *kafka.Dialer
+	headers    *headermap.Policy
+	reconnects reconnects
 }
 
 func (r *KafkaRunner) Process(msg *message.RunnerMessage) error {
@@ -163,19 +198,9 @@ func (r *KafkaRunner) Process(msg *message.RunnerMessage) error {
 	r.slog.Debug("publishing Kafka message", "topic", r.cfg.Topic, "bodysize", len(data))
 
 	kmsg := kafka.Message{
-		Key:   msg.GetID(),
-		Value: data,
-	}
-
-	metaLen := len(metadata)
-	if metaLen > 0 {
-		kmsg.Headers = make([]kafka.Header, 0, metaLen)
-		for k, v := range metadata {
-			kmsg.Headers = append(kmsg.Headers, kafka.Header{
-				Key:   k,
-				Value: []byte(v),
-			})
-		}
+		Key:     msg.GetID(),
+		Value:   data,
+		Headers: kafkaHeaders(r.headers, metadata),
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -183,8 +208,17 @@ func (r *KafkaRunner) Process(msg *message.RunnerMessage) error {
 
 	err = r.writer.WriteMessages(ctx, kmsg)
 	if err != nil {
+		state := writeState(err)
+		if state == connectors.StateDisconnected {
+			r.reconnects.failed()
+		}
+		r.SetState(state)
+		r.RecordError(err)
 		return fmt.Errorf("error publishing to Kafka: %w", err)
 	}
+	r.reconnects.connected()
+	r.SetState(connectors.StateConnected)
+	r.RecordMessage()
 	r.slog.Debug("Kafka message published", "topic", r.cfg.Topic)
 	return nil
 }
@@ -196,5 +230,6 @@ func (r *KafkaRunner) Close() error {
 			r.slog.Error("error closing Kafka writer", "err", err)
 		}
 	}
+	closeDialer(r.dialer)
 	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/sandrolain/events-bridge/src/common/discovery"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
 	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
@@ -53,17 +54,27 @@ type SourceConfig struct {
 	// SASL holds SASL authentication configuration.
 	SASL *SASLConfig `mapstructure:"sasl"`
 
+	// Discovery resolves the endpoints of the first broker address through DNS (SRV or
+	// every A/AAAA record of the host), balancing the bootstrap connections across them.
+	Discovery *discovery.Config `mapstructure:"discovery"`
+
 	// StartOffset determines where to start reading when no offset is committed.
 	// Values: "earliest" (from beginning), "latest" (from end)
 	// Default: "latest"
 	StartOffset string `mapstructure:"startOffset" default:"latest" validate:"omitempty,oneof=earliest latest"`
 }
 
+// Ensure KafkaSource implements connectors.StatusReporter
+var _ connectors.StatusReporter = &KafkaSource{}
+
 type KafkaSource struct {
+	connectors.StatusTracker
+
 	cfg    *SourceConfig
 	slog   *slog.Logger
 	c      chan *message.RunnerMessage
 	reader *kafka.Reader
+	dialer *kafka.Dialer
 }
 
 func NewSourceConfig() any {
@@ -89,13 +100,23 @@ func (s *KafkaSource) Produce(buffer int) (<-chan *message.RunnerMessage, error)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build dialer: %w", err)
 	}
+	s.dialer = dialer
+	countReconnects(dialer, new(reconnects))
+	if s.cfg.Discovery != nil {
+		if err := withDiscovery(dialer, s.cfg.Discovery, s.cfg.Brokers, s.slog); err != nil {
+			return nil, err
+		}
+	}
 
 	// Create the topic if it does not exist
 	err = ensureKafkaTopicWithDialer(s.slog, dialer, s.cfg.Brokers, s.cfg.Topic, s.cfg.Partitions, s.cfg.ReplicationFactor)
 	if err != nil {
+		s.SetState(connectors.StateDisconnected)
+		s.RecordError(err)
 		s.slog.Error("error creating/verifying topic", "err", err)
 		return nil, err
 	}
+	s.SetState(connectors.StateConnected)
 
 	s.c = make(chan *message.RunnerMessage, buffer)
 
@@ -134,9 +155,14 @@ func (s *KafkaSource) Produce(buffer int) (<-chan *message.RunnerMessage, error)
 		for {
 			m, err := r.FetchMessage(context.Background())
 			if err != nil {
+				s.SetState(connectors.StateDisconnected)
+				s.RecordError(err)
 				s.slog.Error("error fetching from Kafka, stopping consumer", "err", err)
 				break
 			}
+			s.RecordMessage()
+			// The messages of the partition after this one
+			s.SetLag(max(m.HighWaterMark-m.Offset-1, 0))
 			msg := &KafkaMessage{
 				msg:    &m,
 				reader: r,
@@ -177,6 +203,7 @@ func (s *KafkaSource) buildDialer() (*kafka.Dialer, error) {
 }
 
 func (s *KafkaSource) Close() error {
+	defer closeDialer(s.dialer)
 	if s.reader != nil {
 		err := s.reader.Close()
 		if err != nil {
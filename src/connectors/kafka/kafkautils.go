@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"sync/atomic"
 
+	"github.com/sandrolain/events-bridge/src/common/discovery"
+	"github.com/sandrolain/events-bridge/src/common/headermap"
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -67,3 +75,99 @@ func ensureKafkaTopicWithDialer(s *slog.Logger, dialer *kafka.Dialer, brokers []
 	}
 	return nil
 }
+
+// withDiscovery resolves the endpoints of the first broker address through DNS. Every
+// connection to that address, such as the bootstrap connection, dials the endpoint picked
+// by the resolver, keeping the port of the broker address; the brokers advertised in the
+// cluster metadata are resolved normally.
+func withDiscovery(dialer *kafka.Dialer, cfg *discovery.Config, brokers []string, logger *slog.Logger) error {
+	resolver, err := discovery.New(cfg, brokers[0], logger)
+	if err != nil {
+		return fmt.Errorf("failed to discover Kafka endpoints: %w", err)
+	}
+	dialer.Resolver = resolver
+	return nil
+}
+
+// reconnects counts the reconnections of a Kafka client: a connection established after
+// the brokers were not reached
+type reconnects struct {
+	lost atomic.Bool
+}
+
+// failed records that the brokers were not reached
+func (r *reconnects) failed() {
+	r.lost.Store(true)
+}
+
+// connected counts a reconnection when the brokers were not reached before
+func (r *reconnects) connected() {
+	if r.lost.Swap(false) {
+		metrics.Reconnected("kafka")
+	}
+}
+
+// countReconnects counts the reconnections of the connections opened by the dialer, the
+// readers dialing the brokers again after a lost connection
+func countReconnects(dialer *kafka.Dialer, r *reconnects) {
+	netDialer := &net.Dialer{
+		LocalAddr:     dialer.LocalAddr,
+		DualStack:     dialer.DualStack,
+		FallbackDelay: dialer.FallbackDelay,
+		KeepAlive:     dialer.KeepAlive,
+	}
+	dialer.DialFunc = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := netDialer.DialContext(ctx, network, address)
+		if err != nil {
+			r.failed()
+			return nil, err
+		}
+		r.connected()
+		return conn, nil
+	}
+}
+
+// closeDialer stops the credentials refresh and the endpoint discovery of the dialer
+func closeDialer(dialer *kafka.Dialer) {
+	closeSASL(dialer)
+	if dialer == nil {
+		return
+	}
+	if resolver, ok := dialer.Resolver.(*discovery.Resolver); ok {
+		resolver.Close()
+	}
+}
+
+// kafkaHeaders returns the record headers of the metadata allowed by the policy
+func kafkaHeaders(policy *headermap.Policy, metadata map[string]string) []kafka.Header {
+	if len(metadata) == 0 {
+		return nil
+	}
+	headers := make([]kafka.Header, 0, len(metadata))
+	for k, v := range metadata {
+		if policy.Allowed(k) {
+			headers = append(headers, kafka.Header{Key: policy.Name(k), Value: []byte(v)})
+		}
+	}
+	return headers
+}
+
+// writeState returns the state of the connection after a failed write: connected when the
+// brokers answered every failed message with an error, disconnected when they were not
+// reached
+func writeState(err error) connectors.ConnectionState {
+	var errs kafka.WriteErrors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			if e != nil && writeState(e) == connectors.StateDisconnected {
+				return connectors.StateDisconnected
+			}
+		}
+		return connectors.StateConnected
+	}
+	var brokerErr kafka.Error
+	if errors.As(err, &brokerErr) {
+		return connectors.StateConnected
+	}
+	return connectors.StateDisconnected
+}
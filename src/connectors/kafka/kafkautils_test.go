@@ -1,10 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
-	"log/slog"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
+	"github.com/sandrolain/events-bridge/src/common/headermap"
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/segmentio/kafka-go"
 )
 
 func TestEnsureKafkaTopicDialError(t *testing.T) {
@@ -18,3 +30,121 @@ func TestEnsureKafkaTopicDialError(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestWithDiscovery(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close() //nolint:errcheck
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close() //nolint:errcheck
+		}
+	}()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	dialer := &kafka.Dialer{Timeout: time.Second}
+	defer closeDialer(dialer)
+	if err := withDiscovery(dialer, &discovery.Config{Type: discovery.TypeDNS}, []string{"localhost:" + port}, slog.Default()); err != nil {
+		t.Fatalf("withDiscovery() unexpected error = %v", err)
+	}
+	addrs, err := dialer.Resolver.LookupHost(context.Background(), "localhost")
+	if err != nil || len(addrs) != 1 || !strings.HasSuffix(addrs[0], ":"+port) {
+		t.Errorf("expected a discovered endpoint, got %v %v", addrs, err)
+	}
+
+	if err := withDiscovery(&kafka.Dialer{}, &discovery.Config{Type: discovery.TypeDNS}, []string{"localhost"}, slog.Default()); err == nil {
+		t.Error("expected error for broker address without port")
+	}
+}
+
+func TestCountReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close() //nolint:errcheck
+
+	dialer := &kafka.Dialer{Timeout: time.Second}
+	countReconnects(dialer, new(reconnects))
+	dial := func() error {
+		conn, err := dialer.DialFunc(context.Background(), "tcp", addr)
+		if err == nil {
+			conn.Close() //nolint:errcheck
+		}
+		return err
+	}
+	if err := dial(); err == nil {
+		t.Fatal("expected error when dialing a closed port")
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("port %s taken again: %v", addr, err)
+	}
+	defer ln.Close() //nolint:errcheck
+	// The second successful dial is not a reconnection
+	for range 2 {
+		if err := dial(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `eb_connector_reconnects_total{connector="kafka"} 1`) {
+		t.Errorf("metrics = %s", buf.String())
+	}
+}
+
+func TestKafkaHeaders(t *testing.T) {
+	metadata := map[string]string{"x-tenant": "acme", "eb-status": "200", "traceId": "t1"}
+
+	if got := kafkaHeaders(nil, metadata); len(got) != 3 {
+		t.Errorf("kafkaHeaders() without policy = %v", got)
+	}
+	if got := kafkaHeaders(nil, nil); got != nil {
+		t.Errorf("kafkaHeaders() without metadata = %v", got)
+	}
+
+	policy, err := headermap.New(&headermap.Config{Deny: []string{"eb-*"}, Rename: map[string]string{"traceId": "traceparent"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, h := range kafkaHeaders(policy, metadata) {
+		got[h.Key] = string(h.Value)
+	}
+	if len(got) != 2 || got["x-tenant"] != "acme" || got["traceparent"] != "t1" {
+		t.Errorf("kafkaHeaders() = %v", got)
+	}
+}
+
+func TestWriteState(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want connectors.ConnectionState
+	}{
+		{"broker error", fmt.Errorf("write: %w", kafka.MessageSizeTooLarge), connectors.StateConnected},
+		{"unreachable", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, connectors.StateDisconnected},
+		{"timeout", context.DeadlineExceeded, connectors.StateDisconnected},
+		{"broker errors", kafka.WriteErrors{nil, kafka.NotLeaderForPartition}, connectors.StateConnected},
+		{"unreachable partition", kafka.WriteErrors{kafka.NotLeaderForPartition, context.DeadlineExceeded}, connectors.StateDisconnected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := writeState(tt.err); got != tt.want {
+				t.Errorf("writeState(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
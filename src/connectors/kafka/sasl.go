@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"slices"
 
+	"github.com/sandrolain/events-bridge/src/common/credentials"
 	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/sasl"
 	"github.com/segmentio/kafka-go/sasl/plain"
 	"github.com/segmentio/kafka-go/sasl/scram"
 )
 
+// supportedMechanisms are the supported SASL mechanisms
+var supportedMechanisms = []string{"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"}
+
 // SASLConfig holds SASL authentication configuration for Kafka.
 // Supports PLAIN, SCRAM-SHA-256, and SCRAM-SHA-512 mechanisms.
 type SASLConfig struct {
@@ -23,20 +32,37 @@ type SASLConfig struct {
 	Mechanism string `mapstructure:"mechanism" validate:"required_if=Enabled true,omitempty,oneof=PLAIN SCRAM-SHA-256 SCRAM-SHA-512"`
 
 	// Username for SASL authentication.
-	Username string `mapstructure:"username" validate:"required_if=Enabled true"`
+	// Required unless Credentials is set.
+	Username string `mapstructure:"username"`
 
 	// Password for SASL authentication.
 	// WARNING: Consider using environment variables or secret managers for production.
-	Password string `mapstructure:"password" validate:"required_if=Enabled true"` //nolint:gosec // user-configured credential field
+	Password string `mapstructure:"password"` //nolint:gosec // user-configured credential field
+
+	// Credentials configures rotating credentials (static, file, vault or oauth2) used instead of
+	// username and password. Every new broker connection authenticates with the current credentials.
+	Credentials *credentials.Config `mapstructure:"credentials"`
 }
 
 // BuildSASLMechanism creates a SASL mechanism for Kafka authentication.
-// Returns nil if SASL is not enabled.
+// Returns nil if SASL is not enabled. With rotating credentials the mechanism
+// implements io.Closer, to stop the credentials refresh.
 func (c *SASLConfig) BuildSASLMechanism() (sasl.Mechanism, error) {
 	if !c.Enabled {
 		return nil, nil
 	}
 
+	if c.Credentials != nil {
+		if !slices.Contains(supportedMechanisms, c.Mechanism) {
+			return nil, fmt.Errorf("unsupported SASL mechanism: %s", c.Mechanism)
+		}
+		creds, err := credentials.New(c.Credentials, slog.Default().With("context", "Kafka SASL"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create credentials provider: %w", err)
+		}
+		return &rotatingMechanism{name: c.Mechanism, creds: creds}, nil
+	}
+
 	if c.Username == "" || c.Password == "" {
 		return nil, fmt.Errorf("username and password are required for SASL authentication")
 	}
@@ -47,28 +73,68 @@ func (c *SASLConfig) BuildSASLMechanism() (sasl.Mechanism, error) {
 		return nil, fmt.Errorf("failed to resolve password: %w", err)
 	}
 
-	switch c.Mechanism {
+	return buildMechanism(c.Mechanism, c.Username, resolvedPassword)
+}
+
+// buildMechanism creates the SASL mechanism with the given credentials
+func buildMechanism(name, username, password string) (sasl.Mechanism, error) {
+	switch name {
 	case "PLAIN":
 		return plain.Mechanism{
-			Username: c.Username,
-			Password: resolvedPassword,
+			Username: username,
+			Password: password,
 		}, nil
 
 	case "SCRAM-SHA-256":
-		mechanism, err := scram.Mechanism(scram.SHA256, c.Username, resolvedPassword)
+		mechanism, err := scram.Mechanism(scram.SHA256, username, password)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create SCRAM-SHA-256 mechanism: %w", err)
 		}
 		return mechanism, nil
 
 	case "SCRAM-SHA-512":
-		mechanism, err := scram.Mechanism(scram.SHA512, c.Username, resolvedPassword)
+		mechanism, err := scram.Mechanism(scram.SHA512, username, password)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create SCRAM-SHA-512 mechanism: %w", err)
 		}
 		return mechanism, nil
 
 	default:
-		return nil, fmt.Errorf("unsupported SASL mechanism: %s", c.Mechanism)
+		return nil, fmt.Errorf("unsupported SASL mechanism: %s", name)
+	}
+}
+
+// rotatingMechanism authenticates every new connection with the current credentials
+type rotatingMechanism struct {
+	name  string
+	creds *credentials.Provider
+}
+
+func (m *rotatingMechanism) Name() string {
+	return m.name
+}
+
+func (m *rotatingMechanism) Start(ctx context.Context) (sasl.StateMachine, []byte, error) {
+	c := m.creds.Current()
+	mechanism, err := buildMechanism(m.name, c.Username, c.Password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mechanism.Start(ctx)
+}
+
+// Close stops the credentials refresh
+func (m *rotatingMechanism) Close() error {
+	m.creds.Close()
+	return nil
+}
+
+// closeSASL stops the credentials refresh of a rotating SASL mechanism
+func closeSASL(dialer *kafka.Dialer) {
+	if dialer == nil {
+		return
+	}
+	if closer, ok := dialer.SASLMechanism.(io.Closer); ok {
+		closer.Close() //nolint:errcheck
 	}
 }
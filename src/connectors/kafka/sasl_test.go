@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/sandrolain/events-bridge/src/common/credentials"
+	"github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/sasl/plain"
 )
 
@@ -134,3 +140,49 @@ func TestSASLConfigMissingCredentials(t *testing.T) {
 		})
 	}
 }
+
+func TestSASLConfigRotatingCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "creds.json")
+	if err := os.WriteFile(path, []byte(`{"username":"v1","password":"p1"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &SASLConfig{
+		Enabled:     true,
+		Mechanism:   "PLAIN",
+		Credentials: &credentials.Config{Type: credentials.TypeFile, Path: path, PollInterval: 10 * time.Millisecond},
+	}
+
+	mechanism, err := cfg.BuildSASLMechanism()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dialer := &kafka.Dialer{SASLMechanism: mechanism}
+	defer closeSASL(dialer)
+	if mechanism.Name() != "PLAIN" {
+		t.Errorf("expected PLAIN mechanism, got %s", mechanism.Name())
+	}
+
+	// Every new connection authenticates with the current credentials
+	if err := os.WriteFile(path, []byte(`{"username":"v2","password":"p2"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, ir, err := mechanism.Start(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected start error: %v", err)
+		}
+		if string(ir) == "\x00v2\x00p2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rotated credentials not used, initial response %q", ir)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cfg.Mechanism = "GSSAPI"
+	if _, err := cfg.BuildSASLMechanism(); err == nil {
+		t.Error("expected error for unsupported mechanism")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// label is a label pair of a stream or a structured metadata pair of an entry
+type label struct {
+	name  string
+	value string
+}
+
+// entry is a log line of a stream
+type entry struct {
+	stream     string // label set in the Loki selector format
+	timestamp  time.Time
+	line       []byte
+	structured []label
+}
+
+// formatLabels returns the label set in the selector format Loki expects in the
+// push request, e.g. {app="api", env="prod"}, with the label names sorted
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// encodePushRequest encodes the entries as a snappy compressed logproto PushRequest.
+// The entries of a stream are grouped in one Stream, in arrival order.
+func encodePushRequest(entries []entry) []byte {
+	var order []string
+	byStream := map[string][]*entry{}
+	for i := range entries {
+		e := &entries[i]
+		if _, ok := byStream[e.stream]; !ok {
+			order = append(order, e.stream)
+		}
+		byStream[e.stream] = append(byStream[e.stream], e)
+	}
+
+	var req []byte
+	for _, stream := range order {
+		var buf []byte
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendString(buf, stream)
+		for _, e := range byStream[stream] {
+			buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+			buf = protowire.AppendBytes(buf, encodeEntry(e))
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, buf)
+	}
+	return snappy.Encode(nil, req)
+}
+
+func encodeEntry(e *entry) []byte {
+	var ts []byte
+	ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(e.timestamp.Unix()))
+	ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(e.timestamp.Nanosecond()))
+
+	var buf []byte
+	buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, ts)
+	buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, e.line)
+	for _, l := range e.structured {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.name)
+		lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.value)
+		buf = protowire.AppendTag(buf, 3, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, lb)
+	}
+	return buf
+}
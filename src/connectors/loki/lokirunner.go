@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/configmigrate"
+	"github.com/sandrolain/events-bridge/src/common/httpretry"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure LokiRunner implements connectors.LifecycleRunner
+var _ connectors.LifecycleRunner = &LokiRunner{}
+
+const (
+	tenantHeader = "X-Scope-OrgID"
+)
+
+var (
+	labelNameRe    = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	invalidLabelRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+type RunnerConfig struct {
+	// URL is the push endpoint, e.g. http://loki:3100/loki/api/v1/push
+	URL string `mapstructure:"url" validate:"required,url"`
+	// Labels are static stream labels
+	Labels map[string]string `mapstructure:"labels"`
+	// LabelsFromMetadata are the metadata keys copied to stream labels; the label names are the
+	// keys with the invalid characters replaced by "_", and missing keys omit the label.
+	// Keep them low-cardinality: every label combination is a separate stream in Loki.
+	LabelsFromMetadata []string `mapstructure:"labelsFromMetadata" validate:"dive,required"`
+	// StructuredMetadata are the metadata keys attached to the log lines as structured
+	// metadata, for high-cardinality values such as trace or request ids
+	StructuredMetadata []string `mapstructure:"structuredMetadata" validate:"dive,required"`
+	// TimestampFromMetadataKey is the metadata key of the line timestamp (RFC3339 or epoch
+	// nanoseconds); the current time is used when not set or missing
+	TimestampFromMetadataKey string `mapstructure:"timestampFromMetadataKey"`
+	// TenantID is sent in the X-Scope-OrgID header of multi-tenant Loki deployments
+	TenantID string `mapstructure:"tenantId"`
+	// TenantFromMetadataKey is the metadata key of the tenant id, overriding TenantID;
+	// the lines of each tenant are pushed in separate batches
+	TenantFromMetadataKey string `mapstructure:"tenantFromMetadataKey"`
+	// BatchSize is the maximum number of lines pushed in one request
+	BatchSize int `mapstructure:"batchSize" default:"100" validate:"min=1"`
+	// BatchWait is the maximum time a line waits for the batch to fill
+	BatchWait time.Duration `mapstructure:"batchWait" default:"1s" validate:"gt=0"`
+	// Async acknowledges the messages once the line is batched instead of once the batch is pushed.
+	// WARNING: the lines of failed pushes are lost.
+	Async bool `mapstructure:"async" default:"false"`
+	// Headers are additional HTTP headers
+	Headers map[string]string `mapstructure:"headers"`
+	// Username enables basic authentication
+	Username string `mapstructure:"username"`
+	// Password supports secret references (env:, file:)
+	Password string `mapstructure:"password"`
+	// BearerToken supports secret references (env:, file:)
+	BearerToken string            `mapstructure:"bearerToken" validate:"excluded_with=Username"`
+	Timeout     time.Duration     `mapstructure:"timeout" default:"10s" validate:"gt=0"`
+	TLS         *tlsconfig.Config `mapstructure:"tls"`
+}
+
+// pending is a line waiting in a batch, with the channel notified of the push result
+type pending struct {
+	entry entry
+	done  chan error
+}
+
+// batch holds the pending lines of a tenant
+type batch struct {
+	tenant string
+	lines  []pending
+	timer  *time.Timer
+}
+
+type LokiRunner struct {
+	cfg         *RunnerConfig
+	slog        *slog.Logger
+	client      *http.Client
+	labels      map[string]string
+	password    string
+	bearerToken string
+	now         func() time.Time
+
+	mu      sync.Mutex
+	batches map[string]*batch
+	pushes  sync.WaitGroup
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// RunnerConfigMigrations upgrades the options of the older config versions: version 2
+// renamed the metadata key options after the "...FromMetadataKey" options of the other
+// connectors
+func RunnerConfigMigrations() []configmigrate.Migration {
+	return []configmigrate.Migration{{
+		From: 1,
+		Renames: map[string]string{
+			"timestampFromMetadata": "timestampFromMetadataKey",
+			"tenantFromMetadata":    "tenantFromMetadataKey",
+		},
+	}}
+}
+
+// NewRunner creates a new instance of LokiRunner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	if len(cfg.Labels) == 0 && len(cfg.LabelsFromMetadata) == 0 {
+		return nil, errors.New("at least one of labels and labelsFromMetadata must be set")
+	}
+	for name := range cfg.Labels {
+		if !labelNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+	}
+
+	r := &LokiRunner{
+		cfg:     cfg,
+		slog:    slog.Default().With("context", "Loki Runner"),
+		labels:  cfg.Labels,
+		now:     time.Now,
+		batches: map[string]*batch{},
+	}
+
+	var err error
+	if cfg.Username != "" {
+		if r.password, err = secrets.Resolve(cfg.Password); err != nil {
+			return nil, fmt.Errorf("failed to resolve password: %w", err)
+		}
+	}
+	if cfg.BearerToken != "" {
+		if r.bearerToken, err = secrets.Resolve(cfg.BearerToken); err != nil {
+			return nil, fmt.Errorf("failed to resolve bearer token: %w", err)
+		}
+	}
+
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	r.client = &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	r.slog.Info("loki runner created",
+		"url", cfg.URL,
+		"batchSize", cfg.BatchSize,
+		"batchWait", cfg.BatchWait,
+		"async", cfg.Async,
+	)
+	return r, nil
+}
+
+// sanitizeLabelName maps a metadata key to a valid label name
+func sanitizeLabelName(key string) string {
+	name := invalidLabelRe.ReplaceAllString(key, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// newEntry maps the message to a log line of its stream
+func (r *LokiRunner) newEntry(metadata map[string]string, data []byte) (entry, error) {
+	labels := make(map[string]string, len(r.labels)+len(r.cfg.LabelsFromMetadata))
+	for name, value := range r.labels {
+		labels[name] = value
+	}
+	for _, key := range r.cfg.LabelsFromMetadata {
+		if value, ok := metadata[key]; ok && value != "" {
+			labels[sanitizeLabelName(key)] = value
+		}
+	}
+	if len(labels) == 0 {
+		return entry{}, errors.New("no stream labels in message")
+	}
+
+	e := entry{stream: formatLabels(labels), timestamp: r.now(), line: data}
+	if key := r.cfg.TimestampFromMetadataKey; key != "" {
+		if value, ok := metadata[key]; ok && value != "" {
+			ts, err := parseTimestamp(value)
+			if err != nil {
+				return entry{}, fmt.Errorf("invalid timestamp metadata %q: %w", key, err)
+			}
+			e.timestamp = ts
+		}
+	}
+	for _, key := range r.cfg.StructuredMetadata {
+		if value, ok := metadata[key]; ok {
+			e.structured = append(e.structured, label{name: sanitizeLabelName(key), value: value})
+		}
+	}
+	return e, nil
+}
+
+// parseTimestamp parses an RFC3339 timestamp or epoch nanoseconds
+func parseTimestamp(value string) (time.Time, error) {
+	if ns, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, ns), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// tenant returns the tenant id of the message
+func (r *LokiRunner) tenant(metadata map[string]string) string {
+	if key := r.cfg.TenantFromMetadataKey; key != "" {
+		if value := metadata[key]; value != "" {
+			return value
+		}
+	}
+	return r.cfg.TenantID
+}
+
+// Process adds the payload as a log line to the batch of the tenant. Unless Async is set,
+// it returns once the batch is pushed, with the push error. The message is unchanged.
+func (r *LokiRunner) Process(msg *message.RunnerMessage) error {
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	e, err := r.newEntry(metadata, data)
+	if err != nil {
+		return err
+	}
+
+	p := pending{entry: e}
+	if !r.cfg.Async {
+		p.done = make(chan error, 1)
+	}
+	if full := r.add(r.tenant(metadata), p); full != nil {
+		r.push(full)
+	}
+	if p.done == nil {
+		return nil
+	}
+	return <-p.done
+}
+
+// add appends the line to the batch of the tenant, returning the batch when full
+func (r *LokiRunner) add(tenant string, p pending) *batch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.batches[tenant]
+	if !ok {
+		b = &batch{tenant: tenant}
+		r.batches[tenant] = b
+		b.timer = time.AfterFunc(r.cfg.BatchWait, func() {
+			if r.take(b) {
+				r.push(b)
+			}
+		})
+	}
+	b.lines = append(b.lines, p)
+	if len(b.lines) < r.cfg.BatchSize {
+		return nil
+	}
+	b.timer.Stop()
+	delete(r.batches, tenant)
+	r.pushes.Add(1)
+	return b
+}
+
+// take removes the batch from the pending batches, reporting whether it was still pending
+func (r *LokiRunner) take(b *batch) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.batches[b.tenant] != b {
+		return false
+	}
+	delete(r.batches, b.tenant)
+	r.pushes.Add(1)
+	return true
+}
+
+// push sends the batch taken from the pending batches and notifies its lines of the result
+func (r *LokiRunner) push(b *batch) {
+	defer r.pushes.Done()
+
+	entries := make([]entry, len(b.lines))
+	for i, p := range b.lines {
+		entries[i] = p.entry
+	}
+	err := r.send(b.tenant, entries)
+	if err != nil {
+		r.slog.Error("error pushing lines", "tenant", b.tenant, "lines", len(entries), "error", err)
+	} else {
+		r.slog.Debug("lines pushed", "tenant", b.tenant, "lines", len(entries))
+	}
+	for _, p := range b.lines {
+		if p.done != nil {
+			p.done <- err
+		}
+	}
+}
+
+// send pushes the entries to Loki
+func (r *LokiRunner) send(tenant string, entries []entry) error {
+	req, err := http.NewRequest(http.MethodPost, r.cfg.URL, bytes.NewReader(encodePushRequest(entries)))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range r.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	if tenant != "" {
+		req.Header.Set(tenantHeader, tenant)
+	}
+	if r.cfg.Username != "" {
+		req.SetBasicAuth(r.cfg.Username, r.password)
+	} else if r.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+r.bearerToken)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending lines: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode > 299 {
+		err := fmt.Errorf("non-2XX status code: %d: %s", res.StatusCode, httpretry.ErrorBody(res.Body))
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+			if delay, ok := httpretry.ParseRetryAfter(res.Header.Get("Retry-After"), r.now()); ok {
+				return &connectors.RetryAfterError{Delay: delay, Err: err}
+			}
+		}
+		return err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
+
+func (r *LokiRunner) Start(ctx context.Context) error {
+	return nil
+}
+
+// Drain pushes the pending batches and waits for the pushes in progress
+func (r *LokiRunner) Drain(ctx context.Context) error {
+	r.mu.Lock()
+	batches := make([]*batch, 0, len(r.batches))
+	for tenant, b := range r.batches {
+		b.timer.Stop()
+		delete(r.batches, tenant)
+		r.pushes.Add(1)
+		batches = append(batches, b)
+	}
+	r.mu.Unlock()
+	sort.Slice(batches, func(i, j int) bool { return batches[i].tenant < batches[j].tenant })
+
+	for _, b := range batches {
+		r.push(b)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.pushes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *LokiRunner) Close() error {
+	r.slog.Info("closing loki runner")
+	if err := r.Drain(context.Background()); err != nil {
+		return err
+	}
+	r.client.CloseIdleConnections()
+	return nil
+}
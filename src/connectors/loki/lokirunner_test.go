@@ -0,0 +1,378 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/sandrolain/events-bridge/src/common/configmigrate"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// push is a request received by a test server
+type push struct {
+	headers http.Header
+	body    []byte
+}
+
+// capture records the requests received by a test server
+type capture struct {
+	mu     sync.Mutex
+	pushes []push
+}
+
+func (c *capture) all() []push {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]push(nil), c.pushes...)
+}
+
+func newTestServer(t *testing.T, status int, headers map[string]string) (*httptest.Server, *capture) {
+	t.Helper()
+	c := &capture{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		c.mu.Lock()
+		c.pushes = append(c.pushes, push{headers: req.Header.Clone(), body: body})
+		c.mu.Unlock()
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(status)
+		if status > 299 {
+			_, _ = w.Write([]byte("entry too far behind"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, c
+}
+
+// decodedEntry is a log line decoded from a push request
+type decodedEntry struct {
+	stream     string
+	timestamp  time.Time
+	line       string
+	structured map[string]string
+}
+
+func decodePushRequest(t *testing.T, body []byte) []decodedEntry {
+	t.Helper()
+	raw, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("invalid snappy body: %v", err)
+	}
+	var out []decodedEntry
+	for len(raw) > 0 {
+		_, _, n := protowire.ConsumeTag(raw)
+		stream, m := protowire.ConsumeBytes(raw[n:])
+		raw = raw[n+m:]
+
+		var labels string
+		for len(stream) > 0 {
+			num, _, n := protowire.ConsumeTag(stream)
+			field, m := protowire.ConsumeBytes(stream[n:])
+			stream = stream[n+m:]
+			if num == 1 {
+				labels = string(field)
+				continue
+			}
+			e := decodedEntry{stream: labels, structured: map[string]string{}}
+			for len(field) > 0 {
+				num, _, n := protowire.ConsumeTag(field)
+				value, m := protowire.ConsumeBytes(field[n:])
+				field = field[n+m:]
+				switch num {
+				case 1:
+					_, _, n := protowire.ConsumeTag(value)
+					sec, m := protowire.ConsumeVarint(value[n:])
+					_, _, n2 := protowire.ConsumeTag(value[n+m:])
+					nsec, _ := protowire.ConsumeVarint(value[n+m+n2:])
+					e.timestamp = time.Unix(int64(sec), int64(nsec))
+				case 2:
+					e.line = string(value)
+				case 3:
+					_, _, n := protowire.ConsumeTag(value)
+					name, m := protowire.ConsumeString(value[n:])
+					_, _, n2 := protowire.ConsumeTag(value[n+m:])
+					v, _ := protowire.ConsumeString(value[n+m+n2:])
+					e.structured[name] = v
+				}
+			}
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func TestLokiRunnerPush(t *testing.T) {
+	srv, c := newTestServer(t, http.StatusNoContent, nil)
+	cfg := &RunnerConfig{
+		URL:                      srv.URL + "/loki/api/v1/push",
+		Labels:                   map[string]string{"job": "events"},
+		LabelsFromMetadata:       []string{"app", "k8s.namespace"},
+		StructuredMetadata:       []string{"trace-id"},
+		TimestampFromMetadataKey: "ts",
+		TenantID:                 "team-a",
+		BearerToken:              "secret",
+		BatchSize:                3,
+		BatchWait:                time.Minute,
+		Timeout:                  time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*LokiRunner)
+	r.now = func() time.Time { return time.Unix(1700000000, 500) }
+
+	msgs := []*message.RunnerMessage{
+		message.NewRunnerMessage(testutil.NewAdapter([]byte("first"), map[string]string{
+			"app": "api", "k8s.namespace": "prod", "trace-id": "abc", "ts": "1700000001000000000",
+		})),
+		message.NewRunnerMessage(testutil.NewAdapter([]byte("second"), map[string]string{"app": "worker"})),
+		message.NewRunnerMessage(testutil.NewAdapter([]byte("third"), map[string]string{
+			"app": "api", "k8s.namespace": "prod", "ts": "2023-11-14T22:13:22Z",
+		})),
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = r.Process(msg)
+		}()
+		// Keep the arrival order deterministic
+		time.Sleep(20 * time.Millisecond)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Process(%d) unexpected error = %v", i, err)
+		}
+	}
+
+	pushes := c.all()
+	if len(pushes) != 1 {
+		t.Fatalf("got %d pushes, want 1", len(pushes))
+	}
+	h := pushes[0].headers
+	if h.Get("Content-Encoding") != "snappy" || h.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("unexpected headers %v", h)
+	}
+	if h.Get("X-Scope-OrgID") != "team-a" || h.Get("Authorization") != "Bearer secret" {
+		t.Errorf("unexpected headers %v", h)
+	}
+
+	entries := decodePushRequest(t, pushes[0].body)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	api := `{app="api", job="events", k8s_namespace="prod"}`
+	if e := entries[0]; e.stream != api || e.line != "first" || e.structured["trace_id"] != "abc" || !e.timestamp.Equal(time.Unix(1700000001, 0)) {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	// The lines of a stream are grouped in arrival order
+	if e := entries[1]; e.stream != api || e.line != "third" || !e.timestamp.Equal(time.Unix(1700000002, 0)) {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if e := entries[2]; e.stream != `{app="worker", job="events"}` || e.line != "second" || !e.timestamp.Equal(time.Unix(1700000000, 500)) || len(e.structured) != 0 {
+		t.Errorf("unexpected entry %+v", e)
+	}
+}
+
+func TestLokiRunnerTenantBatches(t *testing.T) {
+	srv, c := newTestServer(t, http.StatusNoContent, nil)
+	cfg := &RunnerConfig{
+		URL:                   srv.URL,
+		Labels:                map[string]string{"job": "events"},
+		TenantID:              "default",
+		TenantFromMetadataKey: "tenant",
+		BatchSize:             100,
+		BatchWait:             time.Minute,
+		Timeout:               time.Second,
+		Async:                 true,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	for _, tenant := range []string{"b", "", "b"} {
+		msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("line"), map[string]string{"tenant": tenant}))
+		if err := r.Process(msg); err != nil {
+			t.Fatalf("Process() unexpected error = %v", err)
+		}
+	}
+	if pushes := c.all(); len(pushes) != 0 {
+		t.Fatalf("got %d pushes before drain, want 0", len(pushes))
+	}
+	if err := r.(*LokiRunner).Drain(t.Context()); err != nil {
+		t.Fatalf("Drain() unexpected error = %v", err)
+	}
+
+	pushes := c.all()
+	if len(pushes) != 2 {
+		t.Fatalf("got %d pushes, want 2", len(pushes))
+	}
+	if pushes[0].headers.Get("X-Scope-OrgID") != "b" || len(decodePushRequest(t, pushes[0].body)) != 2 {
+		t.Errorf("unexpected push for tenant b")
+	}
+	if pushes[1].headers.Get("X-Scope-OrgID") != "default" || len(decodePushRequest(t, pushes[1].body)) != 1 {
+		t.Errorf("unexpected push for the default tenant")
+	}
+}
+
+func TestLokiRunnerBatchWait(t *testing.T) {
+	srv, c := newTestServer(t, http.StatusNoContent, nil)
+	cfg := &RunnerConfig{
+		URL:       srv.URL,
+		Labels:    map[string]string{"job": "events"},
+		BatchSize: 100,
+		BatchWait: 20 * time.Millisecond,
+		Timeout:   time.Second,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte("line"), nil))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if pushes := c.all(); len(pushes) != 1 {
+		t.Fatalf("got %d pushes, want 1", len(pushes))
+	}
+}
+
+func TestLokiRunnerErrors(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusBadRequest, nil)
+	cfg := &RunnerConfig{
+		URL:                      srv.URL,
+		LabelsFromMetadata:       []string{"app"},
+		TimestampFromMetadataKey: "ts",
+		BatchSize:                1,
+		BatchWait:                time.Second,
+		Timeout:                  time.Second,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	for _, metadata := range []map[string]string{
+		nil,
+		{"app": ""},
+		{"app": "api", "ts": "yesterday"},
+	} {
+		if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("line"), metadata))); err == nil {
+			t.Errorf("Process(%v) expected error", metadata)
+		}
+	}
+
+	err = r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("line"), map[string]string{"app": "api"})))
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "too far behind") {
+		t.Errorf("Process() error = %v, want the status and response", err)
+	}
+
+	srv, _ = newTestServer(t, http.StatusTooManyRequests, map[string]string{"Retry-After": "3"})
+	limited, err := NewRunner(&RunnerConfig{
+		URL:       srv.URL,
+		Labels:    map[string]string{"job": "events"},
+		BatchSize: 1,
+		BatchWait: time.Second,
+		Timeout:   time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = limited.Close() }()
+	err = limited.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte("line"), nil)))
+	var retryErr *connectors.RetryAfterError
+	if !errors.As(err, &retryErr) || retryErr.Delay != 3*time.Second {
+		t.Errorf("Process() error = %v, want a retry after 3s", err)
+	}
+}
+
+func TestLokiRunnerConfigValidation(t *testing.T) {
+	for _, opts := range []map[string]any{
+		{"labels": map[string]any{"job": "events"}},
+		{"url": "http://localhost", "labels": map[string]any{"job": "events"}, "batchSize": 0},
+		{"url": "http://localhost", "labels": map[string]any{"job": "events"}, "username": "u", "bearerToken": "t"},
+	} {
+		if err := utils.ParseConfig(opts, new(RunnerConfig)); err == nil {
+			t.Errorf("ParseConfig(%v) expected error", opts)
+		}
+	}
+
+	for _, labels := range []map[string]string{nil, {"a-b": "c"}} {
+		cfg := &RunnerConfig{
+			URL:       "http://localhost",
+			Labels:    labels,
+			BatchSize: 100,
+			BatchWait: time.Second,
+			Timeout:   time.Second,
+		}
+		if _, err := NewRunner(cfg); err == nil {
+			t.Errorf("NewRunner(%v) expected error", labels)
+		}
+	}
+}
+
+func TestLokiRunnerConfigMigrations(t *testing.T) {
+	opts, deprecations, err := configmigrate.Apply(map[string]any{
+		"url":                "http://loki",
+		"tenantFromMetadata": "tenant",
+	}, RunnerConfigMigrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts["tenantFromMetadataKey"] != "tenant" || len(deprecations) != 1 || deprecations[0].Replacement != "tenantFromMetadataKey" {
+		t.Errorf("Apply() = %v, %v", opts, deprecations)
+	}
+
+	// The options of the current version are not migrated
+	opts, deprecations, err = configmigrate.Apply(map[string]any{
+		"configVersion":      2,
+		"tenantFromMetadata": "tenant",
+	}, RunnerConfigMigrations())
+	if err != nil || len(deprecations) != 0 || opts["tenantFromMetadata"] != "tenant" {
+		t.Errorf("Apply() = %v, %v, %v", opts, deprecations, err)
+	}
+
+	if _, _, err := configmigrate.Apply(map[string]any{
+		"tenantFromMetadata":    "a",
+		"tenantFromMetadataKey": "b",
+	}, RunnerConfigMigrations()); err == nil {
+		t.Error("expected error for both the old and new option")
+	}
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	for key, want := range map[string]string{
+		"app":         "app",
+		"k8s.pod-id":  "k8s_pod_id",
+		"1st":         "_1st",
+		"trace id":    "trace_id",
+		"_under_ok_1": "_under_ok_1",
+	} {
+		if got := sanitizeLabelName(key); got != want {
+			t.Errorf("sanitizeLabelName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -10,11 +10,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/sandrolain/events-bridge/src/integrationtest"
 	"github.com/sandrolain/events-bridge/src/message"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"github.com/testcontainers/testcontainers-go"
-	"github.com/testcontainers/testcontainers-go/wait"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -24,169 +23,31 @@ import (
 const (
 	testDatabase   = "testdb"
 	testCollection = "testcollection"
-	mongoImage     = "mongo:7"
-	replicaSetName = "rs0"
 )
 
-var (
-	mongoContainer testcontainers.Container
-	mongoURI       string
-)
+var mongoURI string
 
 func TestMain(m *testing.M) {
 	ctx := context.Background()
 
-	// Setup MongoDB container with replica set (required for change streams)
-	req := testcontainers.ContainerRequest{
-		Image:        mongoImage,
-		ExposedPorts: []string{"27017/tcp"},
-		Cmd: []string{
-			"--replSet", replicaSetName,
-			"--bind_ip_all",
-		},
-		WaitingFor: wait.ForLog("Waiting for connections").WithStartupTimeout(60 * time.Second),
-	}
-
-	mongoC, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
-		ContainerRequest: req,
-		Started:          true,
-	})
-	if err != nil {
-		panic(fmt.Sprintf("failed to start MongoDB container: %v", err))
-	}
-	mongoContainer = mongoC
-
-	// Get MongoDB URI
-	host, err := mongoC.Host(ctx)
-	if err != nil {
-		panic(fmt.Sprintf("failed to get MongoDB host: %v", err))
-	}
-	port, err := mongoC.MappedPort(ctx, "27017/tcp")
+	// Setup MongoDB replica set (required for change streams)
+	mongoC, err := integrationtest.StartMongo(ctx)
 	if err != nil {
-		panic(fmt.Sprintf("failed to get MongoDB port: %v", err))
-	}
-
-	// Wait a bit for MongoDB to be fully ready
-	time.Sleep(2 * time.Second)
-
-	// Initialize replica set using direct connection
-	if err := initializeReplicaSet(ctx, host, port.Port()); err != nil {
-		panic(fmt.Sprintf("failed to initialize replica set: %v", err))
+		panic(err.Error())
 	}
-
-	// Now connect with replica set URI - use directConnection to avoid DNS resolution
-	mongoURI = fmt.Sprintf("mongodb://%s:%s/?directConnection=true&replicaSet=%s", host, port.Port(), replicaSetName)
-
-	// Wait additional time for replica set to stabilize
-	time.Sleep(3 * time.Second)
-
-	// Verify connectivity
-	verifyCtx, verifyCancel := context.WithTimeout(ctx, 10*time.Second)
-	defer verifyCancel()
-	testClient, err := mongo.Connect(verifyCtx, options.Client().ApplyURI(mongoURI))
-	if err != nil {
-		panic(fmt.Sprintf("failed to connect to MongoDB for verification: %v", err))
-	}
-	if err := testClient.Ping(verifyCtx, nil); err != nil {
-		testClient.Disconnect(verifyCtx)
-		panic(fmt.Sprintf("failed to ping MongoDB after replica set init: %v", err))
-	}
-	testClient.Disconnect(verifyCtx)
-	fmt.Println("✓ MongoDB replica set is ready and accessible")
+	mongoURI = mongoC.Endpoint
 
 	// Run tests
 	code := m.Run()
 
 	// Cleanup
-	if err := mongoContainer.Terminate(ctx); err != nil {
+	if err := mongoC.Terminate(ctx); err != nil {
 		fmt.Printf("failed to terminate MongoDB container: %v\n", err)
 	}
 
 	os.Exit(code)
 }
 
-func initializeReplicaSet(ctx context.Context, host, port string) error {
-	// Connect with direct connection to initialize replica set
-	directURI := fmt.Sprintf("mongodb://%s:%s/?directConnection=true", host, port)
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(directURI))
-	if err != nil {
-		return fmt.Errorf("failed to connect to MongoDB: %w", err)
-	}
-	defer client.Disconnect(ctx)
-
-	// Check if replica set is already initialized
-	var status bson.M
-	err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(&status)
-	if err == nil {
-		// Replica set already initialized, check if primary exists
-		if members, ok := status["members"].(primitive.A); ok {
-			for _, m := range members {
-				if member, ok := m.(bson.M); ok {
-					if stateStr, ok := member["stateStr"].(string); ok && stateStr == "PRIMARY" {
-						fmt.Println("Replica set already initialized with primary")
-						return nil
-					}
-				}
-			}
-		}
-	}
-
-	// Initialize replica set with localhost (internal hostname)
-	// MongoDB replica set must use the hostname that the server knows itself as
-	config := bson.D{
-		{Key: "replSetInitiate", Value: bson.D{
-			{Key: "_id", Value: replicaSetName},
-			{Key: "members", Value: bson.A{
-				bson.D{
-					{Key: "_id", Value: 0},
-					{Key: "host", Value: "localhost:27017"},
-				},
-			}},
-		}},
-	}
-
-	var result bson.M
-	err = client.Database("admin").RunCommand(ctx, config).Decode(&result)
-	if err != nil {
-		// Check if error is because replica set already initiated
-		if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == 23 { // AlreadyInitialized
-			fmt.Println("Replica set already initiated")
-			return nil
-		}
-		return fmt.Errorf("failed to initialize replica set: %w", err)
-	}
-
-	fmt.Println("Replica set initiation command sent, waiting for primary election...")
-
-	// Wait for replica set to elect a primary
-	maxRetries := 30
-	for i := 0; i < maxRetries; i++ {
-		time.Sleep(1 * time.Second)
-
-		// Check replica set status
-		status = bson.M{}
-		err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(&status)
-		if err != nil {
-			// Might still be initializing
-			continue
-		}
-
-		// Check if there's a primary
-		if members, ok := status["members"].(primitive.A); ok {
-			for _, m := range members {
-				if member, ok := m.(bson.M); ok {
-					if stateStr, ok := member["stateStr"].(string); ok && stateStr == "PRIMARY" {
-						fmt.Printf("✓ Replica set initialized and primary elected after %d seconds\n", i+1)
-						return nil
-					}
-				}
-			}
-		}
-	}
-
-	return fmt.Errorf("replica set initialization timeout - no primary elected after %d seconds", maxRetries)
-}
-
 func TestMongoDBInsertIntegration(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
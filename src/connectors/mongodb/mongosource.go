@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"time"
 
+	"github.com/sandrolain/events-bridge/src/common/scheduledquery"
 	"github.com/sandrolain/events-bridge/src/common/secrets"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
 	"github.com/sandrolain/events-bridge/src/connectors"
@@ -58,6 +59,19 @@ type SourceConfig struct {
 
 	// Enable strict identifier validation (recommended: true)
 	StrictValidation bool `mapstructure:"strictValidation" default:"true"`
+
+	// Scheduled aggregation run instead of watching the change stream
+	Query QueryConfig `mapstructure:"query"`
+}
+
+// QueryConfig runs an aggregation on the collection on a cron schedule, emitting every
+// result document as a JSON message
+type QueryConfig struct {
+	// Pipeline is the aggregation pipeline
+	// Example: [{"$match": {"status": "open"}}, {"$group": {"_id": "$customer", "total": {"$sum": "$amount"}}}]
+	Pipeline []bson.M `mapstructure:"pipeline" validate:"required_with=Schedule"`
+
+	scheduledquery.Config `mapstructure:",squash"`
 }
 
 type MongoSource struct {
@@ -66,6 +80,7 @@ type MongoSource struct {
 	c      chan *message.RunnerMessage
 	client *mongo.Client
 	stream *mongo.ChangeStream
+	query  *scheduledquery.Runner
 	cancel context.CancelFunc
 }
 
@@ -141,10 +156,18 @@ func NewSource(anyCfg any) (connectors.Source, error) {
 		return nil, fmt.Errorf("invalid collection name: %w", err)
 	}
 
-	return &MongoSource{
+	s := &MongoSource{
 		cfg:  cfg,
 		slog: slog.Default().With("context", "MongoDB Source"),
-	}, nil
+	}
+	if cfg.Query.Enabled() {
+		query, err := scheduledquery.New(&cfg.Query.Config, s.fetch, s.slog)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query: %w", err)
+		}
+		s.query = query
+	}
+	return s, nil
 }
 
 func (s *MongoSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
@@ -187,6 +210,11 @@ func (s *MongoSource) Produce(buffer int) (<-chan *message.RunnerMessage, error)
 		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
+	if s.query != nil {
+		s.slog.Info("MongoDB scheduled aggregation started", "database", s.cfg.Database, "collection", s.cfg.Collection, "schedule", s.cfg.Query.Schedule)
+		return s.query.Produce(buffer)
+	}
+
 	// Get collection
 	collection := client.Database(s.cfg.Database).Collection(s.cfg.Collection)
 
@@ -202,21 +230,8 @@ func (s *MongoSource) Produce(buffer int) (<-chan *message.RunnerMessage, error)
 		changeOpts.SetStartAtOperationTime(s.cfg.StartAtOperationTime)
 	}
 
-	// Create pipeline
-	var pipeline mongo.Pipeline
-	if len(s.cfg.Pipeline) > 0 {
-		for _, stage := range s.cfg.Pipeline {
-			// Convert bson.M to bson.D for pipeline
-			var doc bson.D
-			for k, v := range stage {
-				doc = append(doc, bson.E{Key: k, Value: v})
-			}
-			pipeline = append(pipeline, doc)
-		}
-	}
-
 	// Watch collection for changes
-	stream, err := collection.Watch(ctx, pipeline, changeOpts)
+	stream, err := collection.Watch(ctx, toPipeline(s.cfg.Pipeline), changeOpts)
 	if err != nil {
 		// Disconnect on error
 		if disconnectErr := client.Disconnect(ctx); disconnectErr != nil {
@@ -233,6 +248,38 @@ func (s *MongoSource) Produce(buffer int) (<-chan *message.RunnerMessage, error)
 	return s.c, nil
 }
 
+// toPipeline converts the configured stages to a pipeline
+func toPipeline(stages []bson.M) mongo.Pipeline {
+	var pipeline mongo.Pipeline
+	for _, stage := range stages {
+		// Convert bson.M to bson.D for pipeline
+		var doc bson.D
+		for k, v := range stage {
+			doc = append(doc, bson.E{Key: k, Value: v})
+		}
+		pipeline = append(pipeline, doc)
+	}
+	return pipeline
+}
+
+// fetch runs the scheduled aggregation, returning the result documents
+func (s *MongoSource) fetch(ctx context.Context) ([]map[string]any, error) {
+	collection := s.client.Database(s.cfg.Database).Collection(s.cfg.Collection)
+	cursor, err := collection.Aggregate(ctx, toPipeline(s.cfg.Query.Pipeline))
+	if err != nil {
+		return nil, fmt.Errorf("aggregate failed: %w", err)
+	}
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to read documents: %w", err)
+	}
+	rows := make([]map[string]any, len(docs))
+	for i, doc := range docs {
+		rows[i] = doc
+	}
+	return rows, nil
+}
+
 func (s *MongoSource) watchLoop(ctx context.Context) {
 	defer close(s.c)
 
@@ -261,6 +308,12 @@ func (s *MongoSource) Close() error {
 		s.cancel()
 	}
 
+	if s.query != nil {
+		if err := s.query.Close(); err != nil {
+			s.slog.Error("error closing scheduled aggregation", "err", err)
+		}
+	}
+
 	if s.stream != nil {
 		if err := s.stream.Close(context.Background()); err != nil {
 			s.slog.Error("error closing change stream", "err", err)
@@ -3,6 +3,7 @@ package main
 import (
 	"testing"
 
+	"github.com/sandrolain/events-bridge/src/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson"
@@ -195,3 +196,40 @@ func TestSourceConfig_WithResumeToken(t *testing.T) {
 	assert.Equal(t, resumeToken, mongoSource.cfg.ResumeAfter)
 	assert.Equal(t, &timestamp, mongoSource.cfg.StartAtOperationTime)
 }
+
+func TestSourceConfig_WithQuery(t *testing.T) {
+	cfg := new(SourceConfig)
+	err := utils.ParseConfig(map[string]any{
+		"uri":        "mongodb://localhost:27017",
+		"database":   "testdb",
+		"collection": "orders",
+		"query": map[string]any{
+			"schedule": "0 6 * * *",
+			"pipeline": []any{
+				map[string]any{"$group": map[string]any{"_id": "$customer", "total": map[string]any{"$sum": "$amount"}}},
+			},
+			"keyField":    "_id",
+			"changesOnly": true,
+		},
+	}, cfg)
+	require.NoError(t, err)
+	assert.Len(t, cfg.Query.Pipeline, 1)
+	assert.Equal(t, "eb-query-status", cfg.Query.StatusKey)
+
+	source, err := NewSource(cfg)
+	require.NoError(t, err)
+	assert.NotNil(t, source.(*MongoSource).query)
+	assert.NoError(t, source.Close())
+
+	cfg.Query.Schedule = "daily at six"
+	_, err = NewSource(cfg)
+	assert.Error(t, err)
+
+	err = utils.ParseConfig(map[string]any{
+		"uri":        "mongodb://localhost:27017",
+		"database":   "testdb",
+		"collection": "orders",
+		"query":      map[string]any{"schedule": "@hourly"},
+	}, new(SourceConfig))
+	assert.Error(t, err, "schedule without pipeline")
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mmqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const defaultBrokerAddress = ":1883"
+
+// BrokerConfig configures an MQTT broker embedded in the bridge, so that devices connect
+// directly to the bridge without a separate broker. The source and the runners configuring
+// a broker with the same address share it: the first configuration starting it applies.
+type BrokerConfig struct {
+	// Address is the TCP listen address (default: ":1883")
+	Address string `mapstructure:"address"`
+	// WSAddress is the optional WebSocket listen address
+	WSAddress string `mapstructure:"wsAddress"`
+	// TLS enables TLS on the listeners
+	TLS *tlsconfig.Config `mapstructure:"tls"`
+	// Users are the accepted credentials; without users any client can connect
+	Users []BrokerUserConfig `mapstructure:"users" validate:"dive"`
+}
+
+// BrokerUserConfig is a client credential of the embedded broker
+type BrokerUserConfig struct {
+	Username string `mapstructure:"username" validate:"required"`
+	// Password supports env: and file: secrets
+	Password string `mapstructure:"password" validate:"required"` //nolint:gosec // user-configured credential field
+}
+
+// embeddedBroker is a running broker, shared by the connectors with the same address
+type embeddedBroker struct {
+	address string
+	server  *mmqtt.Server
+	hook    *publishHook
+	refs    int
+}
+
+var brokers = struct {
+	sync.Mutex
+	running map[string]*embeddedBroker
+}{running: map[string]*embeddedBroker{}}
+
+// acquireBroker returns the broker listening on the address of the configuration, starting it
+// on the first call. Every acquired broker must be released.
+func acquireBroker(cfg *BrokerConfig, logger *slog.Logger) (*embeddedBroker, error) {
+	address := cfg.Address
+	if address == "" {
+		address = defaultBrokerAddress
+	}
+
+	brokers.Lock()
+	defer brokers.Unlock()
+	if b, ok := brokers.running[address]; ok {
+		b.refs++
+		return b, nil
+	}
+
+	b, err := startBroker(cfg, address, logger)
+	if err != nil {
+		return nil, err
+	}
+	brokers.running[address] = b
+	return b, nil
+}
+
+func startBroker(cfg *BrokerConfig, address string, logger *slog.Logger) (*embeddedBroker, error) {
+	tlsConfig, err := tlsconfig.BuildServerConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	server := mmqtt.New(&mmqtt.Options{InlineClient: true, Logger: logger})
+	if len(cfg.Users) == 0 {
+		err = server.AddHook(new(auth.AllowHook), nil)
+	} else {
+		rules := make(auth.AuthRules, 0, len(cfg.Users))
+		for _, u := range cfg.Users {
+			password, err := secrets.Resolve(u.Password)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve password of user %s: %w", u.Username, err)
+			}
+			rules = append(rules, auth.AuthRule{Username: auth.RString(u.Username), Password: auth.RString(password), Allow: true})
+		}
+		err = server.AddHook(new(auth.Hook), &auth.Options{Ledger: &auth.Ledger{Auth: rules}})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to add auth hook: %w", err)
+	}
+
+	hook := &publishHook{}
+	if err := server.AddHook(hook, nil); err != nil {
+		return nil, fmt.Errorf("failed to add publish hook: %w", err)
+	}
+
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: address, TLSConfig: tlsConfig})); err != nil {
+		server.Close() //nolint:errcheck
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	if cfg.WSAddress != "" {
+		if err := server.AddListener(listeners.NewWebsocket(listeners.Config{ID: "ws", Address: cfg.WSAddress, TLSConfig: tlsConfig})); err != nil {
+			server.Close() //nolint:errcheck
+			return nil, fmt.Errorf("failed to listen on %s: %w", cfg.WSAddress, err)
+		}
+	}
+	if err := server.Serve(); err != nil {
+		server.Close() //nolint:errcheck
+		return nil, fmt.Errorf("failed to start MQTT broker: %w", err)
+	}
+
+	logger.Info("embedded MQTT broker started", "address", address, "wsAddress", cfg.WSAddress, "tls", tlsConfig != nil, "users", len(cfg.Users))
+	return &embeddedBroker{address: address, server: server, hook: hook, refs: 1}, nil
+}
+
+// release stops the broker when no connector uses it anymore
+func (b *embeddedBroker) release() error {
+	brokers.Lock()
+	defer brokers.Unlock()
+	b.refs--
+	if b.refs > 0 {
+		return nil
+	}
+	delete(brokers.running, b.address)
+	return b.server.Close()
+}
+
+// publish delivers a message to the subscribed clients
+func (b *embeddedBroker) publish(topic string, payload []byte, retain bool, qos byte) error {
+	return b.server.Publish(topic, payload, retain, qos)
+}
+
+// subscription forwards the messages published by the clients on matching topics
+type subscription struct {
+	filter  string
+	handler func(cl *mmqtt.Client, pk packets.Packet)
+}
+
+// publishHook hands the messages published by the clients to the subscriptions of the bridge
+type publishHook struct {
+	mmqtt.HookBase
+	mu   sync.RWMutex
+	subs []*subscription
+}
+
+func (h *publishHook) ID() string {
+	return "events-bridge-publish"
+}
+
+func (h *publishHook) Provides(b byte) bool {
+	return b == mmqtt.OnPublished
+}
+
+// OnPublished runs the handlers of the matching subscriptions. The messages published by the
+// bridge itself are skipped, so that a runner publishing back does not loop into the source.
+func (h *publishHook) OnPublished(cl *mmqtt.Client, pk packets.Packet) {
+	if cl == nil || cl.Net.Inline {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, sub := range h.subs {
+		if topicMatches(sub.filter, pk.TopicName) {
+			sub.handler(cl, pk)
+		}
+	}
+}
+
+func (h *publishHook) subscribe(sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs = append(h.subs, sub)
+}
+
+func (h *publishHook) unsubscribe(sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, s := range h.subs {
+		if s == sub {
+			h.subs = append(h.subs[:i], h.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// topicMatches reports whether the topic matches the filter, with the + and # wildcards.
+// Topics starting with $ only match filters starting with the same level.
+func topicMatches(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && !strings.HasPrefix(filter, "$") {
+		return false
+	}
+	fl, tl := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fl {
+		if f == "#" {
+			return true
+		}
+		if i >= len(tl) || (f != "+" && f != tl[i]) {
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
+
+// brokerMetadata returns the metadata of a message published by a client
+func brokerMetadata(cl *mmqtt.Client, pk packets.Packet) map[string]string {
+	metadata := map[string]string{
+		"topic":    pk.TopicName,
+		"clientId": cl.ID,
+		"qos":      strconv.Itoa(int(pk.FixedHeader.Qos)),
+		"retain":   strconv.FormatBool(pk.FixedHeader.Retain),
+	}
+	if len(cl.Properties.Username) > 0 {
+		metadata["username"] = string(cl.Properties.Username)
+	}
+	for _, p := range pk.Properties.User {
+		if _, ok := metadata[p.Key]; !ok {
+			metadata[p.Key] = p.Val
+		}
+	}
+	return metadata
+}
+
+// produceEmbedded subscribes the source to the embedded broker
+func (s *MQTTSource) produceEmbedded() (<-chan *message.RunnerMessage, error) {
+	b, err := acquireBroker(s.cfg.Broker, s.slog)
+	if err != nil {
+		return nil, err
+	}
+	s.broker = b
+	// The embedded broker runs in the process
+	s.SetState(connectors.StateConnected)
+
+	s.slog.Info("subscribing to embedded broker", "address", b.address, "topic", s.cfg.Topic)
+	s.sub = &subscription{filter: s.cfg.Topic, handler: func(cl *mmqtt.Client, pk packets.Packet) {
+		metadata := brokerMetadata(cl, pk)
+		if s.jwtAuth != nil {
+			authResult := s.jwtAuth.Authenticate(metadata)
+			if !authResult.Verified {
+				s.slog.Warn("JWT validation failed, rejecting message", "topic", pk.TopicName, "error", authResult.Error)
+				return
+			}
+			for k, v := range authResult.Metadata {
+				metadata[k] = v
+			}
+		}
+
+		done := make(chan message.ResponseStatus, 1)
+		s.RecordMessage()
+		s.c <- message.NewRunnerMessage(&BrokerMessage{
+			id:       pk.PacketID,
+			data:     bytes.Clone(pk.Payload),
+			metadata: metadata,
+			done:     done,
+		})
+		// The publishing client waits for the message to be processed, as backpressure
+		select {
+		case <-done:
+		case <-time.After(s.cfg.MessageTimeout):
+		}
+	}}
+	b.hook.subscribe(s.sub)
+	return s.c, nil
+}
+
+// closeEmbedded unsubscribes the source and releases the embedded broker
+func (s *MQTTSource) closeEmbedded() error {
+	if s.broker == nil {
+		return nil
+	}
+	s.broker.hook.unsubscribe(s.sub)
+	err := s.broker.release()
+	s.broker = nil
+	return err
+}
+
+var _ message.SourceMessage = &BrokerMessage{}
+
+// BrokerMessage is a message published by a client of the embedded broker
+type BrokerMessage struct {
+	id       uint16
+	data     []byte
+	metadata map[string]string
+	done     chan message.ResponseStatus
+}
+
+func (m *BrokerMessage) GetID() []byte {
+	return []byte{byte(m.id >> 8), byte(m.id & 0xff)}
+}
+
+func (m *BrokerMessage) GetMetadata() (map[string]string, error) {
+	return m.metadata, nil
+}
+
+func (m *BrokerMessage) GetData() ([]byte, error) {
+	return m.data, nil
+}
+
+func (m *BrokerMessage) Ack(data *message.ReplyData) error {
+	message.SendResponseStatus(m.done, message.ResponseStatusAck)
+	return nil
+}
+
+func (m *BrokerMessage) Nak() error {
+	message.SendResponseStatus(m.done, message.ResponseStatusNak)
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot get free port: %v", err)
+	}
+	addr := ln.Addr().String()
+	if err := ln.Close(); err != nil {
+		t.Logf("failed to close listener: %v", err)
+	}
+	return addr
+}
+
+func connectClient(t *testing.T, addr, clientID, username, password string) (mqtt.Client, error) {
+	t.Helper()
+	opts := mqtt.NewClientOptions().AddBroker("tcp://" + addr).SetClientID(clientID)
+	if username != "" {
+		opts.SetUsername(username).SetPassword(password)
+	}
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(3 * time.Second) {
+		t.Fatal("timeout connecting to the embedded broker")
+	}
+	return client, token.Error()
+}
+
+func TestTopicMatches(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"#", "a/b", true},
+		{"#", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+		{"+/b", "a/b", true},
+		{"a/b/c", "a/b", false},
+	}
+	for _, tc := range cases {
+		if got := topicMatches(tc.filter, tc.topic); got != tc.want {
+			t.Errorf("topicMatches(%q, %q) = %v", tc.filter, tc.topic, got)
+		}
+	}
+}
+
+func TestMQTTEmbeddedBrokerIntegration(t *testing.T) {
+	addr := freeAddress(t)
+	broker := map[string]any{
+		"address": addr,
+		"users":   []any{map[string]any{"username": "device", "password": "secret"}},
+	}
+
+	src := mustNewMQTTSource(t, map[string]any{"topic": "devices/+/telemetry", "broker": broker})
+	ch, err := src.Produce(1)
+	if err != nil {
+		t.Fatalf("Produce: %v", err)
+	}
+	defer src.Close() //nolint:errcheck
+
+	// The runner shares the broker started by the source
+	tgt := mustNewMQTTRunner(t, map[string]any{"topic": "devices/d1/commands", "topicFromMetadataKey": "replyTopic", "qos": 1, "broker": broker})
+	defer tgt.Close() //nolint:errcheck
+	if tgt.broker != src.broker || src.broker.refs != 2 {
+		t.Fatal("runner and source do not share the embedded broker")
+	}
+
+	if _, err := connectClient(t, addr, "intruder", "device", "wrong"); err == nil {
+		t.Error("expected connection error with invalid credentials")
+	}
+
+	client, err := connectClient(t, addr, "d1", "device", "secret")
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Disconnect(100)
+
+	commands := make(chan string, 1)
+	if token := client.Subscribe("devices/d1/commands", 1, func(_ mqtt.Client, m mqtt.Message) {
+		commands <- string(m.Payload())
+	}); token.Wait() && token.Error() != nil {
+		t.Fatalf("subscribe: %v", token.Error())
+	}
+
+	client.Publish("devices/d1/status", 1, false, "ignored")
+	client.Publish("devices/d1/telemetry", 1, false, "21.5")
+
+	select {
+	case msg := <-ch:
+		data, _ := msg.GetData()
+		meta, _ := msg.GetMetadata()
+		if string(data) != "21.5" {
+			t.Errorf("unexpected payload: %s", data)
+		}
+		if meta["topic"] != "devices/d1/telemetry" || meta["clientId"] != "d1" || meta["username"] != "device" || meta["qos"] != "1" {
+			t.Errorf("unexpected metadata: %v", meta)
+		}
+		if err := msg.Ack(nil); err != nil {
+			t.Errorf("ack: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for the published message")
+	}
+
+	// The runner publishes back to the connected clients, without looping into the source
+	if err := tgt.Process(message.NewRunnerMessage(&testSrcMsg{data: []byte("reboot"), meta: map[string]string{}})); err != nil {
+		t.Fatalf("runner process: %v", err)
+	}
+	select {
+	case got := <-commands:
+		if got != "reboot" {
+			t.Errorf("unexpected command: %s", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for the command")
+	}
+	select {
+	case msg := <-ch:
+		t.Errorf("unexpected message on the source: %v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMQTTEmbeddedBrokerRelease(t *testing.T) {
+	addr := freeAddress(t)
+	tgt := mustNewMQTTRunner(t, map[string]any{"topic": "t", "topicFromMetadataKey": "topic", "qos": 1, "broker": map[string]any{"address": addr}})
+	if err := tgt.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	brokers.Lock()
+	_, running := brokers.running[addr]
+	brokers.Unlock()
+	if running {
+		t.Error("broker still registered after the last release")
+	}
+}
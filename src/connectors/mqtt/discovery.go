@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/url"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
+)
+
+// setDiscovery resolves the endpoints of the broker address through DNS and makes the
+// client connect through the resolver on every connection and reconnection
+func setDiscovery(opts *mqtt.ClientOptions, cfg *discovery.Config, address string, logger *slog.Logger) (*discovery.Resolver, error) {
+	resolver, err := discovery.New(cfg, address, logger)
+	if err != nil {
+		return nil, err
+	}
+	opts.SetCustomOpenConnectionFn(func(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+		var tlsConfig *tls.Config
+		if uri.Scheme == "ssl" {
+			tlsConfig = options.TLSConfig
+		}
+		ctx := context.Background()
+		if options.ConnectTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, options.ConnectTimeout)
+			defer cancel()
+		}
+		return resolver.TLSDialer(tlsConfig)(ctx, "tcp", uri.Host)
+	})
+	return resolver, nil
+}
+
+// closeDiscovery stops the endpoint resolver, if any
+func closeDiscovery(r *discovery.Resolver) {
+	if r != nil {
+		r.Close()
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"log/slog"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
 	"github.com/sandrolain/events-bridge/src/common/secrets"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
 	"github.com/sandrolain/events-bridge/src/connectors"
@@ -19,7 +20,12 @@ import (
 type RunnerConfig struct {
 	// Address is the MQTT broker address (host:port).
 	// Example: "localhost:1883" for plain TCP, "localhost:8883" for TLS.
-	Address string `mapstructure:"address" validate:"required"`
+	// Not used with an embedded Broker.
+	Address string `mapstructure:"address" validate:"required_without=Broker"`
+
+	// Broker embeds an MQTT broker in the bridge: the runner publishes to the connected
+	// clients. A source with a broker on the same address shares it.
+	Broker *BrokerConfig `mapstructure:"broker"`
 
 	// Topic is the default MQTT topic to publish to.
 	// Can be overridden by TopicFromMetadataKey.
@@ -58,6 +64,10 @@ type RunnerConfig struct {
 	// TLS holds TLS/SSL configuration for secure connections.
 	TLS *tlsconfig.Config `mapstructure:"tls"`
 
+	// Discovery resolves the broker endpoints through DNS (SRV or every A/AAAA record of
+	// the address host), balancing the connections and re-resolving them periodically.
+	Discovery *discovery.Config `mapstructure:"discovery"`
+
 	// KeepAlive is the keep alive interval in seconds.
 	// The client will send PINGREQ messages to keep the connection alive.
 	// Default: 60 seconds
@@ -81,6 +91,18 @@ func NewRunner(anyCfg any) (connectors.Runner, error) {
 		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
 	}
 
+	if cfg.Broker != nil {
+		b, err := acquireBroker(cfg.Broker, slog.Default().With("context", "MQTT Broker"))
+		if err != nil {
+			return nil, err
+		}
+		runner := &MQTTRunner{cfg: cfg, slog: slog.Default(), broker: b}
+		// The embedded broker runs in the process
+		runner.SetState(connectors.StateConnected)
+		return runner, nil
+	}
+	runner := &MQTTRunner{cfg: cfg, slog: slog.Default()}
+
 	useTLS := tlsconfig.IsEnabled(cfg.TLS)
 	protocol := "tcp"
 	if useTLS {
@@ -128,17 +150,26 @@ func NewRunner(anyCfg any) (connectors.Runner, error) {
 	copts.SetAutoReconnect(true)
 	copts.SetConnectRetry(true)
 	copts.SetConnectRetryInterval(2 * time.Second)
+	setStatusHandlers(copts, &runner.StatusTracker, runner.slog)
+
+	var resolver *discovery.Resolver
+	if cfg.Discovery != nil {
+		var err error
+		resolver, err = setDiscovery(copts, cfg.Discovery, cfg.Address, slog.Default())
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover MQTT endpoints: %w", err)
+		}
+	}
 
 	client := mqtt.NewClient(copts)
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		closeDiscovery(resolver)
 		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
 	}
 
-	return &MQTTRunner{
-		cfg:    cfg,
-		slog:   slog.Default(),
-		client: client,
-	}, nil
+	runner.client = client
+	runner.discovery = resolver
+	return runner, nil
 }
 
 // generateRunnerSecureClientID creates a cryptographically secure random client ID for runners.
@@ -150,11 +181,19 @@ func generateRunnerSecureClientID() (string, error) {
 	return "events-bridge-runner-" + hex.EncodeToString(bytes), nil
 }
 
+// Ensure MQTTRunner implements connectors.StatusReporter
+var _ connectors.StatusReporter = &MQTTRunner{}
+
 type MQTTRunner struct {
-	cfg    *RunnerConfig
-	slog   *slog.Logger
-	client mqtt.Client
-	stopCh chan struct{}
+	connectors.StatusTracker
+
+	cfg       *RunnerConfig
+	slog      *slog.Logger
+	client    mqtt.Client
+	stopCh    chan struct{}
+	discovery *discovery.Resolver
+	// broker is the embedded broker, if enabled
+	broker *embeddedBroker
 }
 
 func (t *MQTTRunner) Process(msg *message.RunnerMessage) error {
@@ -180,11 +219,23 @@ func (t *MQTTRunner) Process(msg *message.RunnerMessage) error {
 		"bodysize", len(data),
 	)
 
+	if t.broker != nil {
+		if err := t.broker.publish(topic, data, retained, qos); err != nil {
+			t.RecordError(err)
+			return fmt.Errorf("error publishing to embedded broker: %w", err)
+		}
+		t.RecordMessage()
+		t.slog.Debug("MQTT message published", "topic", topic)
+		return nil
+	}
+
 	token := t.client.Publish(topic, qos, retained, data)
 	token.Wait()
 	if token.Error() != nil {
+		t.RecordError(token.Error())
 		return fmt.Errorf("error publishing to MQTT: %w", token.Error())
 	}
+	t.RecordMessage()
 
 	t.slog.Debug("MQTT message published", "topic", topic)
 
@@ -198,5 +249,9 @@ func (t *MQTTRunner) Close() error {
 	if t.client != nil && t.client.IsConnected() {
 		t.client.Disconnect(250)
 	}
+	closeDiscovery(t.discovery)
+	if t.broker != nil {
+		return t.broker.release()
+	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -118,3 +119,33 @@ func mustNewMQTTRunner(t *testing.T, opts map[string]any) *MQTTRunner {
 	}
 	return mqttTgt
 }
+
+func TestMQTTDiscoveryIntegration(t *testing.T) {
+	addr, cleanup := startMochi(t)
+	defer cleanup()
+	// The host is resolved through DNS by the discovery
+	addr = "localhost" + addr[strings.LastIndex(addr, ":"):]
+	discovery := map[string]any{"type": "dns", "refresh": "1s"}
+
+	sIface := mustNewMQTTSource(t, map[string]any{"address": addr, "topic": "disc/#", "clientId": "src3", "discovery": discovery})
+	ch, err := sIface.Produce(1)
+	if err != nil {
+		t.Fatalf("Produce: %v", err)
+	}
+	defer sIface.Close() //nolint:errcheck
+
+	tIface := mustNewMQTTRunner(t, map[string]any{"address": addr, "topic": "disc/a", "clientId": "tgt3", "topicFromMetadataKey": "topic", "qos": 1, "discovery": discovery})
+	defer tIface.Close() //nolint:errcheck
+
+	if err := tIface.Process(message.NewRunnerMessage(&testSrcMsg{data: []byte("found"), meta: map[string]string{}})); err != nil {
+		t.Fatalf("runner process: %v", err)
+	}
+	select {
+	case got := <-ch:
+		if data, _ := got.GetData(); string(data) != "found" {
+			t.Fatalf("unexpected payload: %s", string(data))
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
 	"github.com/sandrolain/events-bridge/src/common/jwtauth"
 	"github.com/sandrolain/events-bridge/src/common/secrets"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
@@ -19,7 +20,12 @@ import (
 type SourceConfig struct {
 	// Address is the MQTT broker address (host:port).
 	// Example: "localhost:1883" for plain TCP, "localhost:8883" for TLS.
-	Address string `mapstructure:"address" validate:"required"`
+	// Not used with an embedded Broker.
+	Address string `mapstructure:"address" validate:"required_without=Broker"`
+
+	// Broker embeds an MQTT broker in the bridge: the source receives the messages
+	// published by the connected clients instead of connecting to an external broker.
+	Broker *BrokerConfig `mapstructure:"broker"`
 
 	// Topic is the MQTT topic to subscribe to.
 	// Supports MQTT wildcards: + (single level), # (multi-level).
@@ -63,6 +69,10 @@ type SourceConfig struct {
 	// TLS holds TLS/SSL configuration for secure connections.
 	TLS *tlsconfig.Config `mapstructure:"tls"`
 
+	// Discovery resolves the broker endpoints through DNS (SRV or every A/AAAA record of
+	// the address host), balancing the connections and re-resolving them periodically.
+	Discovery *discovery.Config `mapstructure:"discovery"`
+
 	// MessageTimeout is the maximum time to wait for message Ack/Nak.
 	// Default: 10 seconds
 	MessageTimeout time.Duration `mapstructure:"messageTimeout" default:"10s"`
@@ -71,12 +81,22 @@ type SourceConfig struct {
 	JWT *jwtauth.Config `mapstructure:"jwt"`
 }
 
+// Ensure MQTTSource implements connectors.StatusReporter
+var _ connectors.StatusReporter = &MQTTSource{}
+
 type MQTTSource struct {
+	connectors.StatusTracker
+
 	cfg     *SourceConfig
 	slog    *slog.Logger
 	c       chan *message.RunnerMessage
 	client  mqtt.Client
 	jwtAuth *jwtauth.Authenticator
+	// discovery is the endpoint resolver of the broker address, if enabled
+	discovery *discovery.Resolver
+	// broker is the embedded broker, if enabled
+	broker *embeddedBroker
+	sub    *subscription
 }
 
 func NewSourceConfig() any {
@@ -117,6 +137,10 @@ func generateSecureClientID() (string, error) {
 func (s *MQTTSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
 	s.c = make(chan *message.RunnerMessage, buffer)
 
+	if s.cfg.Broker != nil {
+		return s.produceEmbedded()
+	}
+
 	useTLS := tlsconfig.IsEnabled(s.cfg.TLS)
 	protocol := "tcp"
 	if useTLS {
@@ -172,6 +196,15 @@ func (s *MQTTSource) Produce(buffer int) (<-chan *message.RunnerMessage, error)
 	opts.SetAutoReconnect(true)
 	opts.SetConnectRetry(true)
 	opts.SetConnectRetryInterval(2 * time.Second)
+	setStatusHandlers(opts, &s.StatusTracker, s.slog)
+
+	if s.cfg.Discovery != nil {
+		resolver, err := setDiscovery(opts, s.cfg.Discovery, s.cfg.Address, s.slog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover MQTT endpoints: %w", err)
+		}
+		s.discovery = resolver
+	}
 
 	// Create and connect client
 	client := mqtt.NewClient(opts)
@@ -212,6 +245,7 @@ func (s *MQTTSource) Produce(buffer int) (<-chan *message.RunnerMessage, error)
 		}
 
 		done := make(chan message.ResponseStatus)
+		s.RecordMessage()
 		s.c <- message.NewRunnerMessage(&MQTTMessage{
 			orig:     msg,
 			done:     done,
@@ -242,5 +276,6 @@ func (s *MQTTSource) Close() error {
 	if s.client != nil && s.client.IsConnected() {
 		s.client.Disconnect(250)
 	}
-	return nil
+	closeDiscovery(s.discovery)
+	return s.closeEmbedded()
 }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log/slog"
+	"sync/atomic"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/connectors"
+)
+
+// setStatusHandlers records the state of the connection to the broker in the status of
+// the connector, logging the lost connections and counting the reconnections
+func setStatusHandlers(opts *mqtt.ClientOptions, status *connectors.StatusTracker, logger *slog.Logger) {
+	var lost atomic.Bool
+	opts.SetOnConnectHandler(func(mqtt.Client) {
+		status.SetState(connectors.StateConnected)
+		if lost.Swap(false) {
+			metrics.Reconnected("mqtt")
+		}
+	})
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		lost.Store(true)
+		status.SetState(connectors.StateConnecting)
+		status.RecordError(err)
+		logger.Warn("MQTT connection lost", "error", err)
+	})
+	opts.SetReconnectingHandler(func(mqtt.Client, *mqtt.ClientOptions) {
+		status.SetState(connectors.StateConnecting)
+	})
+}
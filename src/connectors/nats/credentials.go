@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/common/credentials"
+)
+
+// credentialOptions returns the authentication options reading the rotating
+// credentials on every connection and reconnection
+func credentialOptions(p *credentials.Provider) []nats.Option {
+	if p.Current().HasToken() {
+		return []nats.Option{nats.TokenHandler(func() string {
+			return p.Current().Token
+		})}
+	}
+	return []nats.Option{nats.UserInfoHandler(func() (string, string) {
+		c := p.Current()
+		return c.Username, c.Password
+	})}
+}
+
+// reconnectOnRotation re-establishes the connection after every credentials rotation,
+// before the server expires the previous credentials. The provider delays every
+// notification by a random jitter, so that the connections do not reconnect all at once.
+func reconnectOnRotation(p *credentials.Provider, conn *nats.Conn, logger *slog.Logger) {
+	p.Subscribe(func(credentials.Credentials) {
+		logger.Info("credentials rotated, reconnecting to NATS")
+		if err := conn.ForceReconnect(); err != nil {
+			logger.Warn("failed to reconnect with the rotated credentials", "error", err)
+		}
+	})
+}
+
+// closeCredentials stops the credentials provider, if any
+func closeCredentials(p *credentials.Provider) {
+	if p != nil {
+		p.Close()
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/sandrolain/events-bridge/src/common/credentials"
+)
+
+func TestRunnerRotatingCredentials(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot get free port: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close() //nolint:errcheck
+
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: port, NoSystemAccount: true, Username: "bridge", Password: "s3cret"})
+	if err != nil {
+		t.Fatalf("failed creating nats server: %v", err)
+	}
+	go srv.Start()
+	defer srv.Shutdown()
+	if !srv.ReadyForConnections(2 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+
+	path := filepath.Join(t.TempDir(), "creds.json")
+	if err := os.WriteFile(path, []byte(`{"username":"bridge","password":"s3cret"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &RunnerConfig{
+		Address:       "127.0.0.1:" + strconv.Itoa(port),
+		Subject:       "test.creds",
+		Mode:          modePublish,
+		MaxReconnects: 5,
+		ReconnectWait: 10 * time.Millisecond,
+		Credentials:   &credentials.Config{Type: credentials.TypeFile, Path: path, PollInterval: 10 * time.Millisecond},
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer r.Close() //nolint:errcheck
+	conn := r.(*NATSRunner).conn
+
+	// A rotation re-establishes the connection with the new credentials
+	if err := os.WriteFile(path, []byte(`{"username":"bridge","password":"s3cret","expiry":"2099-01-01T00:00:00Z"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for conn.Stats().Reconnects == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("connection not re-established after the rotation")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !conn.IsConnected() && !conn.IsReconnecting() {
+		t.Errorf("unexpected connection status %v", conn.Status())
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
+)
+
+// newDiscovery creates the endpoint resolver of the first server URL of the address
+// and the option dialing the connections through it
+func newDiscovery(cfg *discovery.Config, address string, logger *slog.Logger) (*discovery.Resolver, nats.Option, error) {
+	u, err := url.Parse(strings.TrimSpace(strings.Split(address, ",")[0]))
+	if err != nil || u.Hostname() == "" {
+		return nil, nil, fmt.Errorf("invalid NATS address for discovery: %s", address)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "4222"
+	}
+	r, err := discovery.New(cfg, net.JoinHostPort(u.Hostname(), port), logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, nats.SetCustomDialer(r), nil
+}
+
+// closeDiscovery stops the endpoint resolver, if any
+func closeDiscovery(r *discovery.Resolver) {
+	if r != nil {
+		r.Close()
+	}
+}
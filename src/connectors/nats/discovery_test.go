@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
+)
+
+func TestRunnerDNSDiscovery(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot get free port: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close() //nolint:errcheck
+
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: port, NoSystemAccount: true})
+	if err != nil {
+		t.Fatalf("failed creating nats server: %v", err)
+	}
+	go srv.Start()
+	defer srv.Shutdown()
+	if !srv.ReadyForConnections(2 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+
+	cfg := &RunnerConfig{
+		Address:   "nats://localhost:" + strconv.Itoa(port),
+		Subject:   "test.discovery",
+		Mode:      modePublish,
+		Timeout:   time.Second,
+		Discovery: &discovery.Config{Type: discovery.TypeDNS},
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer r.Close() //nolint:errcheck
+
+	runner := r.(*NATSRunner)
+	if eps := runner.discovery.Endpoints(); len(eps) == 0 {
+		t.Fatal("expected discovered endpoints")
+	}
+	if !runner.conn.IsConnected() {
+		t.Error("expected the connection through the discovered endpoints")
+	}
+
+	if _, _, err := newDiscovery(&discovery.Config{}, "://", slog.Default()); err == nil {
+		t.Error("expected error for invalid address")
+	}
+}
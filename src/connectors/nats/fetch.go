@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// fetchStats holds the JetStream fetch counters of a source.
+type fetchStats struct {
+	fetches  atomic.Int64
+	messages atomic.Int64
+	timeouts atomic.Int64
+	errors   atomic.Int64
+}
+
+// FetchStats is a snapshot of the JetStream fetch counters.
+type FetchStats struct {
+	Fetches  int64
+	Messages int64
+	Timeouts int64
+	Errors   int64
+}
+
+// FetchStats returns the JetStream fetch counters since the source started.
+func (s *NATSSource) FetchStats() FetchStats {
+	return FetchStats{
+		Fetches:  s.stats.fetches.Load(),
+		Messages: s.stats.messages.Load(),
+		Timeouts: s.stats.timeouts.Load(),
+		Errors:   s.stats.errors.Load(),
+	}
+}
+
+// jetStreamFetchLoop fetches batches of messages from the JetStream subscription
+// and dispatches them to the runner channel until stop is closed.
+// Fetch errors (e.g. while the connection is reconnecting) are retried with an
+// exponential backoff; the loop only ends when the connection is closed for good.
+func (s *NATSSource) jetStreamFetchLoop(sub *nats.Subscription, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	backoff := s.cfg.FetchErrorBackoff
+	var ticker <-chan time.Time
+	if s.cfg.FetchStatsInterval > 0 {
+		t := time.NewTicker(s.cfg.FetchStatsInterval)
+		defer t.Stop()
+		ticker = t.C
+	}
+	last := s.FetchStats()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker:
+			last = s.logFetchStats(last)
+		default:
+		}
+
+		msgs, err := sub.Fetch(s.cfg.FetchBatch, nats.MaxWait(s.cfg.FetchMaxWait))
+		if err != nil {
+			if errors.Is(err, nats.ErrTimeout) {
+				s.stats.timeouts.Add(1)
+				backoff = s.cfg.FetchErrorBackoff
+				continue
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if errors.Is(err, nats.ErrConnectionClosed) {
+				s.slog.Error("JetStream fetch loop stopped, connection closed", "err", err)
+				return
+			}
+			s.stats.errors.Add(1)
+			s.RecordError(err)
+			s.slog.Warn("error fetching from JetStream, retrying", "err", err, "backoff", backoff)
+			select {
+			case <-stop:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, s.cfg.FetchMaxBackoff)
+			continue
+		}
+
+		backoff = s.cfg.FetchErrorBackoff
+		s.stats.fetches.Add(1)
+		s.stats.messages.Add(int64(len(msgs)))
+		if len(msgs) > 0 {
+			s.RecordMessage()
+			// The messages still pending for the consumer after the last one fetched
+			if meta, err := msgs[len(msgs)-1].Metadata(); err == nil {
+				s.SetLag(int64(meta.NumPending)) //nolint:gosec // pending counts fit in int64
+			}
+		}
+
+		for i, msg := range msgs {
+			metadata, ok := s.processBase(msg)
+			if !ok {
+				continue
+			}
+			m := &NATSMessage{
+				msg:      msg,
+				conn:     s.nc,
+				metadata: metadata,
+			}
+			select {
+			case s.c <- message.NewRunnerMessage(m):
+			case <-stop:
+				// Give back the messages not dispatched yet
+				for _, pending := range msgs[i:] {
+					if err := pending.Nak(); err != nil {
+						s.slog.Warn("failed to NAK message on close", "error", err)
+					}
+				}
+				return
+			}
+		}
+	}
+}
+
+// logFetchStats logs the fetch throughput since the previous snapshot and returns the current one.
+func (s *NATSSource) logFetchStats(prev FetchStats) FetchStats {
+	cur := s.FetchStats()
+	secs := s.cfg.FetchStatsInterval.Seconds()
+	s.slog.Info("JetStream fetch throughput",
+		"messagesPerSecond", float64(cur.Messages-prev.Messages)/secs,
+		"fetches", cur.Fetches-prev.Fetches,
+		"timeouts", cur.Timeouts-prev.Timeouts,
+		"errors", cur.Errors-prev.Errors)
+	return cur
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	natsc "github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func TestFetchConfigValidation(t *testing.T) {
+	cfg := new(SourceConfig)
+	if err := utils.ParseConfig(map[string]any{"address": testAddress, "subject": "s"}, cfg); err != nil {
+		t.Fatalf(errUnexpected, err)
+	}
+	if cfg.FetchBatch != 1 || cfg.FetchMaxWait != 5*time.Second || cfg.FetchErrorBackoff != time.Second || cfg.FetchMaxBackoff != 30*time.Second {
+		t.Errorf("unexpected fetch defaults: %+v", cfg)
+	}
+
+	if err := utils.ParseConfig(map[string]any{"address": testAddress, "subject": "s", "fetchBatch": 0}, new(SourceConfig)); err == nil {
+		t.Error("expected validation error for zero fetch batch")
+	}
+	if err := utils.ParseConfig(map[string]any{
+		"address":           testAddress,
+		"subject":           "s",
+		"fetchErrorBackoff": "10s",
+		"fetchMaxBackoff":   "1s",
+	}, new(SourceConfig)); err == nil {
+		t.Error("expected validation error for max backoff lower than initial backoff")
+	}
+}
+
+func TestJetStreamFetchBatch(t *testing.T) {
+	addr := startJetStreamServer(t)
+
+	src := mustNewNATSSource(t, map[string]any{
+		"address":      addr,
+		"subject":      "batch.*",
+		"stream":       "BATCH",
+		"consumer":     "bridge",
+		"fetchBatch":   5,
+		"fetchMaxWait": "200ms",
+		"provision": map[string]any{
+			"enabled": true,
+			"stream":  map[string]any{"storage": "memory"},
+		},
+	})
+	ch, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("produce: %v", err)
+	}
+
+	nc, err := natsc.Connect(addr)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("jetstream: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := js.Publish("batch.x", []byte("m")); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		select {
+		case msg := <-ch:
+			if err := msg.Ack(nil); err != nil {
+				t.Errorf("ack: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for message %d", i)
+		}
+	}
+
+	stats := src.FetchStats()
+	if stats.Messages != 5 {
+		t.Errorf("expected 5 fetched messages, got %d", stats.Messages)
+	}
+	if stats.Fetches == 0 || stats.Fetches > 5 {
+		t.Errorf("unexpected number of fetches %d", stats.Fetches)
+	}
+
+	// Let at least one fetch time out, then close while the loop is running
+	time.Sleep(300 * time.Millisecond)
+	if src.FetchStats().Timeouts == 0 {
+		t.Error("expected fetch timeouts to be counted")
+	}
+	if err := src.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
@@ -6,8 +6,12 @@ import (
 	"time"
 
 	nats "github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/common/credentials"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
+	"github.com/sandrolain/events-bridge/src/common/headermap"
 	"github.com/sandrolain/events-bridge/src/common/secrets"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/common/tracing"
 	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
 )
@@ -23,7 +27,12 @@ const (
 type RunnerConfig struct {
 	// Address is the NATS server address.
 	// Example: "nats://localhost:4222" or "tls://localhost:4222"
-	Address string `mapstructure:"address" validate:"required"`
+	// Not used with an embedded Server.
+	Address string `mapstructure:"address" validate:"required_without=Server"`
+
+	// Server embeds a NATS server in the bridge, connected in-process, instead of
+	// connecting to the Address (optional). A source with a server on the same port shares it.
+	Server *ServerConfig `mapstructure:"server"`
 
 	// Subject is the default NATS subject to publish to.
 	// Can be overridden by SubjectFromMetadataKey.
@@ -42,6 +51,10 @@ type RunnerConfig struct {
 	// Stream is the JetStream stream name (required for jetstream mode).
 	Stream string `mapstructure:"stream" validate:"required_if=Mode jetstream"`
 
+	// Provision creates or updates the JetStream stream at startup (jetstream mode, optional).
+	// Consumer settings are ignored by the runner.
+	Provision ProvisionConfig `mapstructure:"provision"`
+
 	// KVBucket is the name of the KV bucket (required for kv-set mode).
 	KVBucket string `mapstructure:"kvBucket" validate:"required_if=Mode kv-set"`
 
@@ -90,6 +103,18 @@ type RunnerConfig struct {
 
 	// Name is a client name for identification in NATS server logs.
 	Name string `mapstructure:"name"`
+
+	// Credentials configures rotating credentials (static, file, vault or oauth2),
+	// taking precedence over the other authentication methods.
+	Credentials *credentials.Config `mapstructure:"credentials"`
+
+	// Discovery resolves the server endpoints through DNS (SRV or every A/AAAA record of
+	// the address host), balancing the connections and re-resolving them periodically.
+	Discovery *discovery.Config `mapstructure:"discovery"`
+
+	// Headers sends the metadata keys allowed by the policy (allow, deny, rename, prefix)
+	// as message headers in publish and jetstream modes. Without it no headers are sent.
+	Headers *headermap.Config `mapstructure:"headers"`
 }
 
 func NewRunnerConfig() any {
@@ -105,47 +130,106 @@ func NewRunner(anyCfg any) (connectors.Runner, error) {
 
 	l := slog.Default().With("context", "NATS Runner")
 
+	headers, err := headermap.New(cfg.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid headers policy: %w", err)
+	}
+
+	var creds *credentials.Provider
+	if cfg.Credentials != nil {
+		p, err := credentials.New(cfg.Credentials, l)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create credentials provider: %w", err)
+		}
+		creds = p
+	}
+
 	// Build NATS connection options
-	opts, err := buildRunnerConnectionOptions(cfg, l)
+	opts, err := buildRunnerConnectionOptions(cfg, creds)
 	if err != nil {
+		closeCredentials(creds)
 		return nil, fmt.Errorf("failed to build connection options: %w", err)
 	}
+	runner := &NATSRunner{
+		cfg:     cfg,
+		slog:    l,
+		creds:   creds,
+		headers: headers,
+	}
+	opts = append(opts, statusOptions(&runner.StatusTracker, l)...)
 
-	conn, err := nats.Connect(cfg.Address, opts...)
+	address := cfg.Address
+	var srv *embeddedServer
+	var resolver *discovery.Resolver
+	if cfg.Server != nil {
+		srv, err = acquireServer(cfg.Server, l)
+		if err != nil {
+			closeCredentials(creds)
+			return nil, fmt.Errorf("failed to start embedded NATS server: %w", err)
+		}
+		address = srv.srv.ClientURL()
+		opts = append(opts, srv.connectOptions()...)
+	} else if cfg.Discovery != nil {
+		var dialOpt nats.Option
+		resolver, dialOpt, err = newDiscovery(cfg.Discovery, cfg.Address, l)
+		if err != nil {
+			closeCredentials(creds)
+			return nil, fmt.Errorf("failed to discover NATS endpoints: %w", err)
+		}
+		opts = append(opts, dialOpt)
+	}
+
+	conn, err := nats.Connect(address, opts...)
 	if err != nil {
+		closeCredentials(creds)
+		closeDiscovery(resolver)
+		if srv != nil {
+			srv.release()
+		}
 		return nil, fmt.Errorf("failed to connect to NATS server: %w", err)
 	}
-
-	runner := &NATSRunner{
-		cfg:  cfg,
-		slog: l,
-		conn: conn,
+	if creds != nil {
+		reconnectOnRotation(creds, conn, l)
 	}
 
+	runner.conn = conn
+	runner.discovery = resolver
+	runner.server = srv
+
 	// Initialize JetStream if needed
 	if cfg.Mode == modeJetStream {
 		js, err := conn.JetStream()
 		if err != nil {
+			runner.Close() //nolint:errcheck
 			return nil, fmt.Errorf("failed to get JetStream context: %w", err)
 		}
 		runner.js = js
+
+		if cfg.Provision.Enabled {
+			if err := provisionStream(js, cfg.Provision.Stream.streamConfig(cfg.Stream, cfg.Subject), l); err != nil {
+				runner.Close() //nolint:errcheck
+				return nil, fmt.Errorf("failed to provision JetStream: %w", err)
+			}
+		}
 	}
 
 	// Initialize KV if needed
 	if cfg.Mode == modeKVSet {
 		js, err := conn.JetStream()
 		if err != nil {
+			runner.Close() //nolint:errcheck
 			return nil, fmt.Errorf("failed to get JetStream context: %w", err)
 		}
 		kv, err := js.KeyValue(cfg.KVBucket)
 		if err != nil {
+			runner.Close() //nolint:errcheck
 			return nil, fmt.Errorf("failed to get KV bucket: %w", err)
 		}
 		runner.kv = kv
 	}
 
 	l.Info("NATS runner connected",
-		"address", cfg.Address,
+		"address", address,
 		"mode", cfg.Mode,
 		"subject", cfg.Subject,
 		"stream", cfg.Stream,
@@ -157,7 +241,7 @@ func NewRunner(anyCfg any) (connectors.Runner, error) {
 }
 
 // buildRunnerConnectionOptions creates NATS connection options with authentication and TLS.
-func buildRunnerConnectionOptions(cfg *RunnerConfig, logger *slog.Logger) ([]nats.Option, error) {
+func buildRunnerConnectionOptions(cfg *RunnerConfig, creds *credentials.Provider) ([]nats.Option, error) {
 	opts := []nats.Option{}
 
 	// Set client name if provided
@@ -172,7 +256,9 @@ func buildRunnerConnectionOptions(cfg *RunnerConfig, logger *slog.Logger) ([]nat
 	)
 
 	// Configure authentication
-	if cfg.CredentialsFile != "" {
+	if creds != nil {
+		opts = append(opts, credentialOptions(creds)...)
+	} else if cfg.CredentialsFile != "" {
 		opts = append(opts, nats.UserCredentials(cfg.CredentialsFile))
 	} else if cfg.NKeyFile != "" {
 		opt, err := nats.NkeyOptionFromSeed(cfg.NKeyFile)
@@ -205,26 +291,14 @@ func buildRunnerConnectionOptions(cfg *RunnerConfig, logger *slog.Logger) ([]nat
 		}
 	}
 
-	// Add connection event handlers
-	opts = append(opts,
-		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
-			if err != nil {
-				logger.Warn("NATS disconnected", "error", err)
-			}
-		}),
-		nats.ReconnectHandler(func(nc *nats.Conn) {
-			logger.Info("NATS reconnected", "url", nc.ConnectedUrl())
-		}),
-		nats.ClosedHandler(func(nc *nats.Conn) {
-			logger.Info("NATS connection closed")
-		}),
-	)
-
 	return opts, nil
 }
 
 // hasRunnerAuthentication checks if any authentication method is configured.
 func hasRunnerAuthentication(cfg *RunnerConfig) string {
+	if cfg.Credentials != nil {
+		return "rotating"
+	}
 	if cfg.CredentialsFile != "" {
 		return "credentials"
 	}
@@ -240,12 +314,22 @@ func hasRunnerAuthentication(cfg *RunnerConfig) string {
 	return "none"
 }
 
+// Ensure NATSRunner implements connectors.StatusReporter
+var _ connectors.StatusReporter = &NATSRunner{}
+
 type NATSRunner struct {
-	cfg  *RunnerConfig
-	slog *slog.Logger
-	conn *nats.Conn
-	js   nats.JetStreamContext
-	kv   nats.KeyValue
+	connectors.StatusTracker
+
+	cfg       *RunnerConfig
+	slog      *slog.Logger
+	conn      *nats.Conn
+	js        nats.JetStreamContext
+	kv        nats.KeyValue
+	creds     *credentials.Provider
+	discovery *discovery.Resolver
+	// server is the embedded server, if enabled
+	server  *embeddedServer
+	headers *headermap.Policy
 }
 
 func (r *NATSRunner) Process(msg *message.RunnerMessage) error {
@@ -256,12 +340,18 @@ func (r *NATSRunner) Process(msg *message.RunnerMessage) error {
 
 	switch r.cfg.Mode {
 	case modeKVSet:
-		return r.processKVSet(msg, metadata, data)
+		err = r.processKVSet(msg, metadata, data)
 	case modeJetStream:
-		return r.processJetStream(msg, metadata, data)
+		err = r.processJetStream(msg, metadata, data)
 	default: // "publish"
-		return r.processPublish(msg, metadata, data)
+		err = r.processPublish(msg, metadata, data)
+	}
+	if err != nil {
+		r.RecordError(err)
+		return err
 	}
+	r.RecordMessage()
+	return nil
 }
 
 // processPublish handles standard NATS pub/sub publishing.
@@ -275,7 +365,7 @@ func (r *NATSRunner) processPublish(msg *message.RunnerMessage, metadata map[str
 		"metadata", metadata,
 	)
 
-	if err := r.conn.Publish(subject, data); err != nil {
+	if err := r.conn.PublishMsg(r.newMsg(subject, metadata, data)); err != nil {
 		return fmt.Errorf("error publishing to NATS: %w", err)
 	}
 
@@ -298,7 +388,7 @@ func (r *NATSRunner) processJetStream(msg *message.RunnerMessage, metadata map[s
 		"bodysize", len(data),
 	)
 
-	pubAck, err := r.js.Publish(subject, data)
+	pubAck, err := r.js.PublishMsg(r.newMsg(subject, metadata, data))
 	if err != nil {
 		return fmt.Errorf("error publishing to JetStream: %w", err)
 	}
@@ -311,6 +401,29 @@ func (r *NATSRunner) processJetStream(msg *message.RunnerMessage, metadata map[s
 	return nil
 }
 
+// newMsg builds the message to publish, with the headers of the metadata allowed by the policy.
+// Without a policy only the W3C trace context is sent, to carry the trace downstream.
+func (r *NATSRunner) newMsg(subject string, metadata map[string]string, data []byte) *nats.Msg {
+	msg := &nats.Msg{Subject: subject, Data: data}
+	for k, v := range metadata {
+		name := k
+		if r.cfg.Headers == nil {
+			if !tracing.IsTraceContextKey(k) {
+				continue
+			}
+		} else if r.headers.Allowed(k) {
+			name = r.headers.Name(k)
+		} else {
+			continue
+		}
+		if msg.Header == nil {
+			msg.Header = nats.Header{}
+		}
+		msg.Header.Set(name, v)
+	}
+	return msg
+}
+
 // processKVSet handles NATS KV bucket operations.
 func (r *NATSRunner) processKVSet(msg *message.RunnerMessage, metadata map[string]string, data []byte) error {
 	key := r.cfg.KVKey
@@ -332,8 +445,14 @@ func (r *NATSRunner) processKVSet(msg *message.RunnerMessage, metadata map[strin
 }
 
 func (r *NATSRunner) Close() error {
+	closeCredentials(r.creds)
 	if r.conn != nil && !r.conn.IsClosed() {
 		r.conn.Close()
 	}
+	closeDiscovery(r.discovery)
+	if r.server != nil {
+		r.server.release()
+		r.server = nil
+	}
 	return nil
 }
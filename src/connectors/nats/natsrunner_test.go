@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/sandrolain/events-bridge/src/common/headermap"
 	"github.com/sandrolain/events-bridge/src/message"
 	"github.com/sandrolain/events-bridge/src/utils"
 )
@@ -24,6 +25,32 @@ func TestNATSRunnerCloseWithoutStart(t *testing.T) {
 	}
 }
 
+func TestNATSRunnerHeaders(t *testing.T) {
+	metadata := map[string]string{"x-tenant": "acme", "eb-status": "200", "jwt_sub": "user"}
+
+	r := &NATSRunner{cfg: &RunnerConfig{}}
+	if msg := r.newMsg("s", metadata, []byte("d")); msg.Header != nil {
+		t.Errorf("headers without policy = %v", msg.Header)
+	}
+
+	// Without a policy the trace context is sent anyway
+	traced := map[string]string{"x-tenant": "acme", "traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	if msg := r.newMsg("s", traced, []byte("d")); len(msg.Header) != 1 || msg.Header.Get("traceparent") != traced["traceparent"] {
+		t.Errorf("trace context without policy = %v", msg.Header)
+	}
+
+	cfg := &headermap.Config{Deny: []string{"eb-*", "jwt_*"}, Prefix: "eb-"}
+	policy, err := headermap.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = &NATSRunner{cfg: &RunnerConfig{Headers: cfg}, headers: policy}
+	msg := r.newMsg("s", metadata, []byte("d"))
+	if len(msg.Header) != 1 || msg.Header.Get("eb-x-tenant") != "acme" || msg.Subject != "s" || string(msg.Data) != "d" {
+		t.Errorf("message = %+v", msg)
+	}
+}
+
 func TestNATSEndToEndTargetToSourceIntegration(t *testing.T) {
 	addr, cleanup := startNATSServer(t)
 	defer cleanup()
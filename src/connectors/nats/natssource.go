@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/common/credentials"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
 	"github.com/sandrolain/events-bridge/src/common/jwtauth"
 	"github.com/sandrolain/events-bridge/src/common/secrets"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
@@ -17,7 +19,12 @@ import (
 type SourceConfig struct {
 	// Address is the NATS server address.
 	// Example: "nats://localhost:4222" or "tls://localhost:4222"
-	Address string `mapstructure:"address" validate:"required"`
+	// Not used with an embedded Server.
+	Address string `mapstructure:"address" validate:"required_without=Server"`
+
+	// Server embeds a NATS server in the bridge, connected in-process, instead of
+	// connecting to the Address (optional).
+	Server *ServerConfig `mapstructure:"server"`
 
 	// Subject is the NATS subject to subscribe to.
 	// Supports wildcards: * (single token), > (multiple tokens).
@@ -29,6 +36,29 @@ type SourceConfig struct {
 	// Consumer is the JetStream consumer name (optional, for JetStream).
 	Consumer string `mapstructure:"consumer"`
 
+	// Provision creates or updates the JetStream stream and durable consumer at startup (optional).
+	Provision ProvisionConfig `mapstructure:"provision"`
+
+	// FetchBatch is the maximum number of JetStream messages fetched per request.
+	// Default: 1
+	FetchBatch int `mapstructure:"fetchBatch" default:"1" validate:"min=1,max=10000"`
+
+	// FetchMaxWait is how long a JetStream fetch waits for messages.
+	// Default: 5 seconds
+	FetchMaxWait time.Duration `mapstructure:"fetchMaxWait" default:"5s" validate:"gt=0"`
+
+	// FetchErrorBackoff is the initial wait after a failed JetStream fetch, doubled on
+	// consecutive failures up to FetchMaxBackoff. Default: 1 second
+	FetchErrorBackoff time.Duration `mapstructure:"fetchErrorBackoff" default:"1s" validate:"gt=0"`
+
+	// FetchMaxBackoff caps the wait between failed JetStream fetches.
+	// Default: 30 seconds
+	FetchMaxBackoff time.Duration `mapstructure:"fetchMaxBackoff" default:"30s" validate:"gtefield=FetchErrorBackoff"`
+
+	// FetchStatsInterval is how often JetStream fetch throughput is logged (0 = disabled).
+	// Default: 1 minute
+	FetchStatsInterval time.Duration `mapstructure:"fetchStatsInterval" default:"1m" validate:"min=0"`
+
 	// QueueGroup enables load balancing across multiple consumers (optional).
 	// Messages are distributed among queue group members.
 	QueueGroup string `mapstructure:"queueGroup"`
@@ -84,11 +114,24 @@ type SourceConfig struct {
 	// Name is a client name for identification in NATS server logs.
 	Name string `mapstructure:"name"`
 
+	// Credentials configures rotating credentials (static, file, vault or oauth2),
+	// taking precedence over the other authentication methods.
+	Credentials *credentials.Config `mapstructure:"credentials"`
+
+	// Discovery resolves the server endpoints through DNS (SRV or every A/AAAA record of
+	// the address host), balancing the connections and re-resolving them periodically.
+	Discovery *discovery.Config `mapstructure:"discovery"`
+
 	// JWT authentication configuration (optional)
 	JWT *jwtauth.Config `mapstructure:"jwt"`
 }
 
+// Ensure NATSSource implements connectors.StatusReporter
+var _ connectors.StatusReporter = &NATSSource{}
+
 type NATSSource struct {
+	connectors.StatusTracker
+
 	cfg     *SourceConfig
 	slog    *slog.Logger
 	c       chan *message.RunnerMessage
@@ -98,6 +141,14 @@ type NATSSource struct {
 	kv      nats.KeyValue
 	watcher nats.KeyWatcher
 	jwtAuth *jwtauth.Authenticator
+	creds   *credentials.Provider
+	stop    chan struct{}
+	// discovery is the endpoint resolver of the server address, if enabled
+	discovery *discovery.Resolver
+	// server is the embedded server, if enabled
+	server *embeddedServer
+	done   chan struct{}
+	stats  fetchStats
 }
 
 func NewSourceConfig() any {
@@ -139,17 +190,49 @@ func (s *NATSSource) Produce(buffer int) (<-chan *message.RunnerMessage, error)
 		"tls", s.cfg.TLS != nil && s.cfg.TLS.Enabled,
 		"auth", s.hasAuthentication())
 
+	if s.cfg.Credentials != nil {
+		creds, err := credentials.New(s.cfg.Credentials, s.slog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create credentials provider: %w", err)
+		}
+		s.creds = creds
+	}
+
 	// Build NATS connection options
 	opts, err := s.buildConnectionOptions()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build connection options: %w", err)
 	}
+	opts = append(opts, statusOptions(&s.StatusTracker, s.slog)...)
+
+	address := s.cfg.Address
+	if s.cfg.Server != nil {
+		srv, err := acquireServer(s.cfg.Server, s.slog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start embedded NATS server: %w", err)
+		}
+		s.server = srv
+		address = srv.srv.ClientURL()
+		opts = append(opts, srv.connectOptions()...)
+	} else if s.cfg.Discovery != nil {
+		resolver, dialOpt, err := newDiscovery(s.cfg.Discovery, s.cfg.Address, s.slog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover NATS endpoints: %w", err)
+		}
+		s.discovery = resolver
+		opts = append(opts, dialOpt)
+	}
 
-	nc, err := nats.Connect(s.cfg.Address, opts...)
+	nc, err := nats.Connect(address, opts...)
 	if err != nil {
+		s.SetState(connectors.StateDisconnected)
+		s.RecordError(err)
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 	s.nc = nc
+	if s.creds != nil {
+		reconnectOnRotation(s.creds, nc, s.slog)
+	}
 
 	// Route to appropriate consumption mode
 	switch s.cfg.Mode {
@@ -171,6 +254,12 @@ func (s *NATSSource) Produce(buffer int) (<-chan *message.RunnerMessage, error)
 			s.js = js
 			s.slog.Info("using JetStream", "stream", s.cfg.Stream, "consumer", s.cfg.Consumer)
 
+			if s.cfg.Provision.Enabled {
+				if err := s.provision(); err != nil {
+					return nil, fmt.Errorf("failed to provision JetStream: %w", err)
+				}
+			}
+
 			if err := s.consumeJetStream(); err != nil {
 				return nil, fmt.Errorf("failed to start JetStream consumer: %w", err)
 			}
@@ -202,8 +291,12 @@ func (s *NATSSource) buildConnectionOptions() ([]nats.Option, error) {
 	)
 
 	// Configure authentication (in order of precedence)
-	if s.cfg.CredentialsFile != "" {
-		// JWT-based authentication (highest precedence)
+	if s.creds != nil {
+		// Rotating credentials (highest precedence)
+		opts = append(opts, credentialOptions(s.creds)...)
+		s.slog.Debug("using rotating credentials", "type", s.cfg.Credentials.Type)
+	} else if s.cfg.CredentialsFile != "" {
+		// JWT-based authentication
 		// Resolve credentials file path
 		resolvedCredsFile, err := secrets.Resolve(s.cfg.CredentialsFile)
 		if err != nil {
@@ -281,7 +374,8 @@ func (s *NATSSource) extractMetadata(msg *nats.Msg) map[string]string {
 
 // hasAuthentication checks if any authentication method is configured.
 func (s *NATSSource) hasAuthentication() bool {
-	return s.cfg.Username != "" ||
+	return s.cfg.Credentials != nil ||
+		s.cfg.Username != "" ||
 		s.cfg.Token != "" ||
 		s.cfg.NKeyFile != "" ||
 		s.cfg.CredentialsFile != ""
@@ -315,6 +409,7 @@ func (s *NATSSource) consumeCore(queue string) (err error) {
 			conn:     s.nc,
 			metadata: metadata,
 		}
+		s.RecordMessage()
 		s.c <- message.NewRunnerMessage(m)
 	}
 	var e error
@@ -378,6 +473,7 @@ func (s *NATSSource) consumeRequest() error {
 			timeout:    s.cfg.RequestTimeout,
 			metadata:   metadata,
 		}
+		s.RecordMessage()
 		s.c <- message.NewRunnerMessage(m)
 	}
 
@@ -442,6 +538,7 @@ func (s *NATSSource) consumeKVWatch() error {
 			m := &NATSKVMessage{
 				entry: entry,
 			}
+			s.RecordMessage()
 			s.c <- message.NewRunnerMessage(m)
 		}
 	}()
@@ -449,6 +546,15 @@ func (s *NATSSource) consumeKVWatch() error {
 	return nil
 }
 
+// provision creates or updates the configured stream and durable consumer.
+func (s *NATSSource) provision() error {
+	p := &s.cfg.Provision
+	if err := provisionStream(s.js, p.Stream.streamConfig(s.cfg.Stream, s.cfg.Subject), s.slog); err != nil {
+		return err
+	}
+	return provisionConsumer(s.js, s.cfg.Stream, p.Consumer.consumerConfig(s.cfg.Consumer, s.cfg.Subject), s.slog)
+}
+
 func (s *NATSSource) consumeJetStream() (err error) {
 	js := s.js
 	stream := s.cfg.Stream
@@ -459,8 +565,10 @@ func (s *NATSSource) consumeJetStream() (err error) {
 		return
 	}
 	s.sub = sub
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
 	// Start background fetch loop for JetStream messages
-	go s.jetStreamFetchLoop()
+	go s.jetStreamFetchLoop(sub, s.stop, s.done)
 	return
 }
 
@@ -488,34 +596,6 @@ func (s *NATSSource) processBase(msg *nats.Msg) (map[string]string, bool) {
 	return metadata, true
 }
 
-// jetStreamFetchLoop runs indefinitely fetching messages from the JetStream
-// subscription and dispatching them to the runner channel.
-func (s *NATSSource) jetStreamFetchLoop() {
-	for {
-		msgs, err := s.sub.Fetch(1, nats.MaxWait(5*time.Second))
-		if err != nil {
-			if err == nats.ErrTimeout {
-				s.slog.Warn("JetStream fetch timeout")
-				continue
-			}
-			s.slog.Error("error fetching from JetStream", "err", err)
-			break
-		}
-		for _, msg := range msgs {
-			metadata, ok := s.processBase(msg)
-			if !ok {
-				continue
-			}
-			m := &NATSMessage{
-				msg:      msg,
-				conn:     s.nc,
-				metadata: metadata,
-			}
-			s.c <- message.NewRunnerMessage(m)
-		}
-	}
-}
-
 func (s *NATSSource) Close() error {
 	// Stop KV watcher if active
 	if s.watcher != nil {
@@ -532,6 +612,16 @@ func (s *NATSSource) Close() error {
 		}
 	}
 
+	// Stop the credentials rotation before closing the connection
+	closeCredentials(s.creds)
+	s.creds = nil
+
+	// Signal the JetStream fetch loop to stop
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+
 	// Unsubscribe/Drain subscription before closing channel to avoid send-on-closed-channel
 	if s.sub != nil {
 		if err := s.sub.Drain(); err != nil {
@@ -541,13 +631,31 @@ func (s *NATSSource) Close() error {
 		}
 		s.sub = nil
 	}
+
+	// Wait for the fetch loop, which may be blocked in a fetch, before closing the channel
+	loopStopped := true
+	if s.done != nil {
+		select {
+		case <-s.done:
+		case <-time.After(s.cfg.FetchMaxWait + time.Second):
+			s.slog.Warn("timeout waiting for JetStream fetch loop to stop, leaving channel open")
+			loopStopped = false
+		}
+		s.done = nil
+	}
 	if s.nc != nil {
 		s.nc.Close()
 		s.nc = nil
 	}
-	if s.c != nil {
+	closeDiscovery(s.discovery)
+	s.discovery = nil
+	if s.server != nil {
+		s.server.release()
+		s.server = nil
+	}
+	if s.c != nil && loopStopped {
 		close(s.c)
-		s.c = nil
 	}
+	s.c = nil
 	return nil
 }
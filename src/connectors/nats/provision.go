@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// ProvisionConfig declares the JetStream stream (and, for the source, the durable
+// consumer) that must exist. They are created when missing and updated otherwise,
+// so that no separate provisioning step with the nats CLI is required.
+type ProvisionConfig struct {
+	// Enabled turns on provisioning at startup.
+	Enabled bool `mapstructure:"enabled" default:"false"`
+
+	// Stream holds the stream settings.
+	Stream StreamProvisionConfig `mapstructure:"stream"`
+
+	// Consumer holds the durable consumer settings (source only).
+	Consumer ConsumerProvisionConfig `mapstructure:"consumer"`
+}
+
+// StreamProvisionConfig defines the provisioned stream.
+type StreamProvisionConfig struct {
+	// Subjects captured by the stream. Default: the connector subject.
+	Subjects []string `mapstructure:"subjects"`
+
+	// Retention policy: "limits" (default), "interest" or "workqueue".
+	Retention string `mapstructure:"retention" default:"limits" validate:"oneof=limits interest workqueue"`
+
+	// Storage backend: "file" (default) or "memory".
+	Storage string `mapstructure:"storage" default:"file" validate:"oneof=file memory"`
+
+	// Replicas is the number of stream replicas in a cluster.
+	Replicas int `mapstructure:"replicas" default:"1" validate:"min=1,max=5"`
+
+	// MaxAge is the maximum age of stored messages (0 = unlimited).
+	MaxAge time.Duration `mapstructure:"maxAge" validate:"min=0"`
+
+	// MaxMsgs is the maximum number of stored messages (0 = unlimited).
+	MaxMsgs int64 `mapstructure:"maxMsgs" validate:"min=0"`
+
+	// MaxBytes is the maximum size of the stream in bytes (0 = unlimited).
+	MaxBytes int64 `mapstructure:"maxBytes" validate:"min=0"`
+}
+
+// ConsumerProvisionConfig defines the provisioned durable pull consumer.
+type ConsumerProvisionConfig struct {
+	// FilterSubject restricts the consumer to a subject. Default: the source subject.
+	FilterSubject string `mapstructure:"filterSubject"`
+
+	// AckWait is the time the server waits for an ack before redelivering.
+	// Default: 30 seconds
+	AckWait time.Duration `mapstructure:"ackWait" default:"30s" validate:"gt=0"`
+
+	// MaxDeliver is the maximum number of delivery attempts (-1 = unlimited).
+	MaxDeliver int `mapstructure:"maxDeliver" default:"-1" validate:"min=-1"`
+
+	// MaxAckPending limits the unacknowledged messages outstanding (0 = server default).
+	MaxAckPending int `mapstructure:"maxAckPending" validate:"min=0"`
+
+	// DeliverPolicy is where a new consumer starts: "all" (default), "new" or "last".
+	DeliverPolicy string `mapstructure:"deliverPolicy" default:"all" validate:"oneof=all new last"`
+}
+
+// streamConfig builds the JetStream stream configuration.
+func (c *StreamProvisionConfig) streamConfig(name string, defaultSubject string) *nats.StreamConfig {
+	subjects := c.Subjects
+	if len(subjects) == 0 {
+		subjects = []string{defaultSubject}
+	}
+
+	retention := nats.LimitsPolicy
+	switch c.Retention {
+	case "interest":
+		retention = nats.InterestPolicy
+	case "workqueue":
+		retention = nats.WorkQueuePolicy
+	}
+
+	storage := nats.FileStorage
+	if c.Storage == "memory" {
+		storage = nats.MemoryStorage
+	}
+
+	return &nats.StreamConfig{
+		Name:      name,
+		Subjects:  subjects,
+		Retention: retention,
+		Storage:   storage,
+		Replicas:  c.Replicas,
+		MaxAge:    c.MaxAge,
+		MaxMsgs:   zeroAsUnlimited(c.MaxMsgs),
+		MaxBytes:  zeroAsUnlimited(c.MaxBytes),
+	}
+}
+
+// consumerConfig builds the JetStream durable pull consumer configuration.
+func (c *ConsumerProvisionConfig) consumerConfig(name string, defaultSubject string) *nats.ConsumerConfig {
+	filter := c.FilterSubject
+	if filter == "" {
+		filter = defaultSubject
+	}
+
+	deliver := nats.DeliverAllPolicy
+	switch c.DeliverPolicy {
+	case "new":
+		deliver = nats.DeliverNewPolicy
+	case "last":
+		deliver = nats.DeliverLastPolicy
+	}
+
+	return &nats.ConsumerConfig{
+		Durable:       name,
+		FilterSubject: filter,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       c.AckWait,
+		MaxDeliver:    c.MaxDeliver,
+		MaxAckPending: c.MaxAckPending,
+		DeliverPolicy: deliver,
+	}
+}
+
+// provisionStream creates the stream if missing, otherwise updates it.
+func provisionStream(js nats.JetStreamContext, cfg *nats.StreamConfig, logger *slog.Logger) error {
+	_, err := js.StreamInfo(cfg.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		if _, err := js.AddStream(cfg); err != nil {
+			return fmt.Errorf("failed to create stream %s: %w", cfg.Name, err)
+		}
+		logger.Info("JetStream stream created", "stream", cfg.Name, "subjects", cfg.Subjects)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get stream %s: %w", cfg.Name, err)
+	}
+	if _, err := js.UpdateStream(cfg); err != nil {
+		return fmt.Errorf("failed to update stream %s: %w", cfg.Name, err)
+	}
+	logger.Info("JetStream stream updated", "stream", cfg.Name, "subjects", cfg.Subjects)
+	return nil
+}
+
+// provisionConsumer creates the durable consumer if missing, otherwise updates it.
+// Note that the server rejects updates of immutable fields (e.g. the deliver policy).
+func provisionConsumer(js nats.JetStreamContext, stream string, cfg *nats.ConsumerConfig, logger *slog.Logger) error {
+	_, err := js.ConsumerInfo(stream, cfg.Durable)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		if _, err := js.AddConsumer(stream, cfg); err != nil {
+			return fmt.Errorf("failed to create consumer %s: %w", cfg.Durable, err)
+		}
+		logger.Info("JetStream consumer created", "stream", stream, "consumer", cfg.Durable)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get consumer %s: %w", cfg.Durable, err)
+	}
+	if _, err := js.UpdateConsumer(stream, cfg); err != nil {
+		return fmt.Errorf("failed to update consumer %s: %w", cfg.Durable, err)
+	}
+	logger.Info("JetStream consumer updated", "stream", stream, "consumer", cfg.Durable)
+	return nil
+}
+
+// zeroAsUnlimited maps the zero value of a limit to the JetStream "unlimited" value.
+func zeroAsUnlimited(v int64) int64 {
+	if v == 0 {
+		return -1
+	}
+	return v
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsc "github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+// startJetStreamServer starts an embedded NATS server with JetStream enabled.
+func startJetStreamServer(t *testing.T) string {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:            "127.0.0.1",
+		Port:            -1,
+		NoSystemAccount: true,
+		JetStream:       true,
+		StoreDir:        t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("failed creating nats server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(func() {
+		srv.Shutdown()
+		srv.WaitForShutdown()
+	})
+	return srv.ClientURL()
+}
+
+func TestProvisionConfigDefaults(t *testing.T) {
+	cfg := new(SourceConfig)
+	err := utils.ParseConfig(map[string]any{
+		"address":  testAddress,
+		"subject":  "orders.*",
+		"stream":   "ORDERS",
+		"consumer": "bridge",
+		"provision": map[string]any{
+			"enabled": true,
+			"stream":  map[string]any{"retention": "workqueue", "maxAge": "1h"},
+		},
+	}, cfg)
+	if err != nil {
+		t.Fatalf(errUnexpected, err)
+	}
+
+	sc := cfg.Provision.Stream.streamConfig(cfg.Stream, cfg.Subject)
+	if sc.Retention != natsc.WorkQueuePolicy || sc.MaxAge != time.Hour || sc.Subjects[0] != "orders.*" {
+		t.Errorf("unexpected stream config: %+v", sc)
+	}
+	if sc.MaxMsgs != -1 || sc.MaxBytes != -1 {
+		t.Errorf("expected unlimited limits, got maxMsgs=%d maxBytes=%d", sc.MaxMsgs, sc.MaxBytes)
+	}
+
+	cc := cfg.Provision.Consumer.consumerConfig(cfg.Consumer, cfg.Subject)
+	if cc.Durable != "bridge" || cc.AckWait != 30*time.Second || cc.MaxDeliver != -1 || cc.FilterSubject != "orders.*" {
+		t.Errorf("unexpected consumer config: %+v", cc)
+	}
+
+	if err := utils.ParseConfig(map[string]any{
+		"address":   testAddress,
+		"subject":   "s",
+		"provision": map[string]any{"stream": map[string]any{"storage": "disk"}},
+	}, new(SourceConfig)); err == nil {
+		t.Error("expected validation error for invalid storage")
+	}
+}
+
+func TestSourceProvisionAndConsume(t *testing.T) {
+	addr := startJetStreamServer(t)
+
+	src := mustNewNATSSource(t, map[string]any{
+		"address":  addr,
+		"subject":  "orders.*",
+		"stream":   "ORDERS",
+		"consumer": "bridge",
+		"provision": map[string]any{
+			"enabled":  true,
+			"stream":   map[string]any{"storage": "memory"},
+			"consumer": map[string]any{"ackWait": "10s", "maxDeliver": 3},
+		},
+	})
+	ch, err := src.Produce(1)
+	if err != nil {
+		t.Fatalf("produce: %v", err)
+	}
+	defer src.Close() //nolint:errcheck
+
+	nc, err := natsc.Connect(addr)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("jetstream: %v", err)
+	}
+
+	info, err := js.ConsumerInfo("ORDERS", "bridge")
+	if err != nil {
+		t.Fatalf("consumer not provisioned: %v", err)
+	}
+	if info.Config.AckWait != 10*time.Second || info.Config.MaxDeliver != 3 {
+		t.Errorf("unexpected consumer config: %+v", info.Config)
+	}
+
+	if _, err := js.Publish("orders.new", []byte("o1")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case msg := <-ch:
+		data, _ := msg.GetData()
+		if string(data) != "o1" {
+			t.Errorf("unexpected data %s", data)
+		}
+		if err := msg.Ack(nil); err != nil {
+			t.Errorf("ack: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+}
+
+func TestProvisionUpdatesExistingStream(t *testing.T) {
+	addr := startJetStreamServer(t)
+
+	nc, err := natsc.Connect(addr)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("jetstream: %v", err)
+	}
+	if _, err := js.AddStream(&natsc.StreamConfig{Name: "EVENTS", Subjects: []string{"events.a"}, Storage: natsc.MemoryStorage}); err != nil {
+		t.Fatalf("add stream: %v", err)
+	}
+
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(map[string]any{
+		"address": addr,
+		"subject": "events.a",
+		"mode":    "jetstream",
+		"stream":  "EVENTS",
+		"provision": map[string]any{
+			"enabled": true,
+			"stream":  map[string]any{"subjects": []any{"events.a", "events.b"}, "storage": "memory"},
+		},
+	}, cfg); err != nil {
+		t.Fatalf(errUnexpected, err)
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+	defer runner.Close() //nolint:errcheck
+
+	info, err := js.StreamInfo("EVENTS")
+	if err != nil {
+		t.Fatalf("stream info: %v", err)
+	}
+	if len(info.Config.Subjects) != 2 {
+		t.Errorf("expected stream subjects to be updated, got %v", info.Config.Subjects)
+	}
+
+	msg := message.NewRunnerMessage(&testSrcMsg{data: []byte("x"), meta: map[string]string{}})
+	if err := runner.Process(msg); err != nil {
+		t.Errorf("process: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+)
+
+const (
+	defaultServerHost = "0.0.0.0"
+	defaultServerPort = 4222
+	// serverReadyTimeout bounds the wait for the embedded server to accept connections
+	serverReadyTimeout = 10 * time.Second
+)
+
+// ServerConfig configures a NATS server embedded in the bridge, with optional JetStream
+// on local disk, so that a single binary is a durable event hub for small edge sites.
+// The connectors configuring a server with the same host and port share it: the first
+// configuration starting it applies. The connectors reach it through an in-process connection.
+type ServerConfig struct {
+	// Name is the server name (default: generated)
+	Name string `mapstructure:"name"`
+	// Host is the listen host (default: "0.0.0.0")
+	Host string `mapstructure:"host"`
+	// Port is the client port (default: 4222, -1 for a random port)
+	Port int `mapstructure:"port" validate:"min=-1,max=65535"`
+	// JetStream enables JetStream persistence
+	JetStream bool `mapstructure:"jetStream"`
+	// StoreDir is the JetStream storage directory
+	StoreDir string `mapstructure:"storeDir" validate:"required_if=JetStream true"`
+	// MaxMemory bounds the JetStream memory storage in bytes (0 = server default)
+	MaxMemory int64 `mapstructure:"maxMemory" validate:"min=0"`
+	// MaxStore bounds the JetStream disk storage in bytes (0 = server default)
+	MaxStore int64 `mapstructure:"maxStore" validate:"min=0"`
+	// Username and Password are required from the clients, if set
+	Username string `mapstructure:"username" validate:"required_with=Password"`
+	// Password supports env: and file: secrets
+	Password string `mapstructure:"password" validate:"required_with=Username"` //nolint:gosec // user-configured credential field
+	// Token is required from the clients, if set; it supports env: and file: secrets
+	Token string `mapstructure:"token" validate:"excluded_with=Username"`
+	// TLS enables TLS on the client port
+	TLS *tlsconfig.Config `mapstructure:"tls"`
+}
+
+// embeddedServer is a running server, shared by the connectors with the same listen address
+type embeddedServer struct {
+	address  string
+	srv      *server.Server
+	user     string
+	password string
+	token    string
+	refs     int
+}
+
+var servers = struct {
+	sync.Mutex
+	running map[string]*embeddedServer
+}{running: map[string]*embeddedServer{}}
+
+// acquireServer returns the server listening on the address of the configuration, starting it
+// on the first call. Every acquired server must be released.
+func acquireServer(cfg *ServerConfig, logger *slog.Logger) (*embeddedServer, error) {
+	host := cfg.Host
+	if host == "" {
+		host = defaultServerHost
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = defaultServerPort
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+
+	servers.Lock()
+	defer servers.Unlock()
+	// A server on a random port is registered with its actual address, so it is never shared
+	if s, ok := servers.running[address]; ok {
+		s.refs++
+		return s, nil
+	}
+
+	s, err := startServer(cfg, host, port, logger)
+	if err != nil {
+		return nil, err
+	}
+	s.address = address
+	if port == server.RANDOM_PORT {
+		s.address = s.srv.Addr().String()
+	}
+	servers.running[s.address] = s
+	return s, nil
+}
+
+func startServer(cfg *ServerConfig, host string, port int, logger *slog.Logger) (*embeddedServer, error) {
+	s := &embeddedServer{user: cfg.Username, refs: 1}
+	var err error
+	if s.password, err = secrets.Resolve(cfg.Password); err != nil {
+		return nil, fmt.Errorf("failed to resolve server password: %w", err)
+	}
+	if s.token, err = secrets.Resolve(cfg.Token); err != nil {
+		return nil, fmt.Errorf("failed to resolve server token: %w", err)
+	}
+
+	opts := &server.Options{
+		ServerName:         cfg.Name,
+		Host:               host,
+		Port:               port,
+		NoSigs:             true,
+		JetStream:          cfg.JetStream,
+		StoreDir:           cfg.StoreDir,
+		JetStreamMaxMemory: cfg.MaxMemory,
+		JetStreamMaxStore:  cfg.MaxStore,
+		Username:           s.user,
+		Password:           s.password,
+		Authorization:      s.token,
+	}
+	tlsConfig, err := tlsconfig.BuildServerConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts.TLS = true
+		opts.TLSConfig = tlsConfig
+		opts.TLSVerify = cfg.TLS.CACertFile != ""
+	}
+
+	srv, err := server.NewServer(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create NATS server: %w", err)
+	}
+	srv.SetLogger(&serverLogger{logger: logger}, false, false)
+	srv.Start()
+	if !srv.ReadyForConnections(serverReadyTimeout) {
+		srv.Shutdown()
+		return nil, fmt.Errorf("embedded NATS server not ready on %s", net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	s.srv = srv
+
+	logger.Info("embedded NATS server started", "url", srv.ClientURL(), "jetStream", cfg.JetStream, "storeDir", cfg.StoreDir, "tls", tlsConfig != nil)
+	return s, nil
+}
+
+// release shuts the server down when no connector uses it anymore
+func (s *embeddedServer) release() {
+	servers.Lock()
+	defer servers.Unlock()
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+	delete(servers.running, s.address)
+	s.srv.Shutdown()
+	s.srv.WaitForShutdown()
+}
+
+// connectOptions returns the options connecting in-process to the server, with its credentials
+func (s *embeddedServer) connectOptions() []nats.Option {
+	opts := []nats.Option{nats.InProcessServer(s.srv)}
+	if s.user != "" {
+		opts = append(opts, nats.UserInfo(s.user, s.password))
+	}
+	if s.token != "" {
+		opts = append(opts, nats.Token(s.token))
+	}
+	return opts
+}
+
+// serverLogger writes the logs of the embedded server to slog
+type serverLogger struct {
+	logger *slog.Logger
+}
+
+func (l *serverLogger) Noticef(format string, v ...any) {
+	l.logger.Info(fmt.Sprintf(format, v...))
+}
+
+func (l *serverLogger) Warnf(format string, v ...any) {
+	l.logger.Warn(fmt.Sprintf(format, v...))
+}
+
+func (l *serverLogger) Fatalf(format string, v ...any) {
+	l.logger.Error(fmt.Sprintf(format, v...))
+}
+
+func (l *serverLogger) Errorf(format string, v ...any) {
+	l.logger.Error(fmt.Sprintf(format, v...))
+}
+
+func (l *serverLogger) Debugf(format string, v ...any) {
+	l.logger.Debug(fmt.Sprintf(format, v...))
+}
+
+func (l *serverLogger) Tracef(format string, v ...any) {
+	l.logger.Debug(fmt.Sprintf(format, v...))
+}
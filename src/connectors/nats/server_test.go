@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot get free port: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	if err := ln.Close(); err != nil {
+		t.Logf("failed to close listener: %v", err)
+	}
+	return port
+}
+
+func TestNATSEmbeddedServerIntegration(t *testing.T) {
+	port := freePort(t)
+	srvCfg := map[string]any{
+		"host":      "127.0.0.1",
+		"port":      port,
+		"jetStream": true,
+		"storeDir":  t.TempDir(),
+		"username":  "edge",
+		"password":  "secret",
+	}
+
+	src := mustNewNATSSource(t, map[string]any{"subject": "sensors.*", "server": srvCfg})
+	ch, err := src.Produce(1)
+	if err != nil {
+		t.Fatalf("Produce: %v", err)
+	}
+	defer src.Close() //nolint:errcheck
+
+	// The runner shares the server started by the source and publishes to JetStream
+	tgt := mustNewNATSRunner(t, map[string]any{
+		"subject":   "events.out",
+		"mode":      "jetstream",
+		"stream":    "EVENTS",
+		"provision": map[string]any{"enabled": true},
+		"server":    srvCfg,
+	})
+	defer tgt.Close() //nolint:errcheck
+	if tgt.server != src.server || src.server.refs != 2 {
+		t.Fatal("runner and source do not share the embedded server")
+	}
+
+	// External clients connect on the exposed port with the server credentials
+	url := "nats://127.0.0.1:" + strconv.Itoa(port)
+	if _, err := nats.Connect(url, nats.UserInfo("edge", "wrong")); err == nil {
+		t.Error("expected connection error with invalid credentials")
+	}
+	nc, err := nats.Connect(url, nats.UserInfo("edge", "secret"))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer nc.Close()
+
+	if err := nc.Publish("sensors.t1", []byte("21.5")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case msg := <-ch:
+		data, _ := msg.GetData()
+		if string(data) != "21.5" {
+			t.Errorf("unexpected payload: %s", data)
+		}
+		if err := msg.Ack(nil); err != nil {
+			t.Errorf("ack: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for the published message")
+	}
+
+	if err := tgt.Process(message.NewRunnerMessage(&testSrcMsg{data: []byte("stored"), meta: map[string]string{}})); err != nil {
+		t.Fatalf("runner process: %v", err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("jetstream: %v", err)
+	}
+	info, err := js.StreamInfo("EVENTS")
+	if err != nil {
+		t.Fatalf("stream info: %v", err)
+	}
+	if info.State.Msgs != 1 {
+		t.Errorf("stream messages = %d, want 1", info.State.Msgs)
+	}
+}
+
+func TestNATSEmbeddedServerRelease(t *testing.T) {
+	port := freePort(t)
+	tgt := mustNewNATSRunner(t, map[string]any{"subject": "s", "server": map[string]any{"host": "127.0.0.1", "port": port}})
+	if err := tgt.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	servers.Lock()
+	running := len(servers.running)
+	servers.Unlock()
+	if running != 0 {
+		t.Errorf("%d servers still registered after the last release", running)
+	}
+	if conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Second); err == nil {
+		conn.Close() //nolint:errcheck
+		t.Error("server still listening after the last release")
+	}
+}
+
+func TestNATSServerConfigValidation(t *testing.T) {
+	for _, opts := range []map[string]any{
+		{"subject": "s"},
+		{"subject": "s", "server": map[string]any{"jetStream": true}},
+		{"subject": "s", "server": map[string]any{"username": "u"}},
+		{"subject": "s", "server": map[string]any{"username": "u", "password": "p", "token": "t"}},
+	} {
+		if err := utils.ParseConfig(opts, new(RunnerConfig)); err == nil {
+			t.Errorf("expected error for %v", opts)
+		}
+	}
+	if err := utils.ParseConfig(map[string]any{"subject": "s", "server": map[string]any{}}, new(RunnerConfig)); err != nil {
+		t.Errorf("embedded server without address: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/connectors"
+)
+
+// statusOptions records the state of the connection and its asynchronous errors in the
+// status of the connector, logging the disconnections and reconnections
+func statusOptions(status *connectors.StatusTracker, logger *slog.Logger) []nats.Option {
+	return []nats.Option{
+		nats.ConnectHandler(func(*nats.Conn) {
+			status.SetState(connectors.StateConnected)
+		}),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			status.SetState(connectors.StateConnecting)
+			status.RecordError(err)
+			if err != nil {
+				logger.Warn("NATS disconnected", "error", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			status.SetState(connectors.StateConnected)
+			metrics.Reconnected("nats")
+			logger.Info("NATS reconnected", "url", nc.ConnectedUrl())
+		}),
+		nats.ClosedHandler(func(*nats.Conn) {
+			status.SetState(connectors.StateDisconnected)
+			logger.Info("NATS connection closed")
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			status.RecordError(err)
+			logger.Warn("NATS asynchronous error", "error", err)
+		}),
+	}
+}
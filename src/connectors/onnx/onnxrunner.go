@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// Ensure ONNXRunner implements connectors.Runner
+var _ connectors.Runner = &ONNXRunner{}
+
+// Input maps payload fields to an input tensor of the model
+type Input struct {
+	// Name is the name of the model input
+	Name string `mapstructure:"name" validate:"required"`
+	// Fields are the dotted paths of the values of the tensor, concatenated in order; the
+	// values are numbers, booleans (1 or 0) or arrays of numbers, flattened
+	Fields []string `mapstructure:"fields" validate:"required,min=1"`
+	// Type is the element type of the tensor: "float32", "float64", "int64" or "int32"
+	// (default: the type of the model input)
+	Type string `mapstructure:"type" validate:"omitempty,oneof=float32 float64 int64 int32"`
+	// Shape is the shape of the values of a row, after the batch dimension
+	// (default: [number of values])
+	Shape []int64 `mapstructure:"shape" validate:"omitempty,dive,gt=0"`
+}
+
+// Output maps an output tensor of the model to a payload field
+type Output struct {
+	// Name is the name of the model output
+	Name string `mapstructure:"name" validate:"required"`
+	// Path is the dotted path of the payload field receiving the output: a single value
+	// per row is written as a number, more values as an array
+	Path string `mapstructure:"path" validate:"required"`
+	// Labels replace the class indexes of integer outputs with their names
+	Labels []string `mapstructure:"labels"`
+}
+
+// GPUConfig runs the inference on an NVIDIA GPU with the CUDA execution provider
+type GPUConfig struct {
+	Enabled  bool `mapstructure:"enabled"`
+	DeviceID int  `mapstructure:"deviceId" validate:"min=0"`
+}
+
+type RunnerConfig struct {
+	// Model is the path of the ONNX model file
+	Model string `mapstructure:"model" validate:"required"`
+	// Library is the path of the ONNX Runtime shared library (default: "onnxruntime.so",
+	// resolved by the system loader)
+	Library string `mapstructure:"library"`
+	// Inputs map the payload fields to the model inputs
+	Inputs []Input `mapstructure:"inputs" validate:"required,min=1,dive"`
+	// Outputs map the model outputs to payload fields
+	Outputs []Output `mapstructure:"outputs" validate:"required,min=1,dive"`
+	// Threads is the number of threads of an inference (0 = ONNX Runtime default)
+	Threads int `mapstructure:"threads" validate:"min=0"`
+	// GPU enables the CUDA execution provider
+	GPU *GPUConfig `mapstructure:"gpu"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+type ONNXRunner struct {
+	cfg     *RunnerConfig
+	session *ort.DynamicAdvancedSession
+	// types are the element types of the inputs
+	types []string
+	slog  *slog.Logger
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner loads the model in a new inference session
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	if err := acquireEnvironment(cfg.Library); err != nil {
+		return nil, err
+	}
+	session, types, err := newSession(cfg)
+	if err != nil {
+		releaseEnvironment() //nolint:errcheck
+		return nil, err
+	}
+
+	log := slog.Default().With("context", "ONNX Runner")
+	log.Info("model loaded", "model", cfg.Model, "inputs", len(cfg.Inputs), "outputs", len(cfg.Outputs), "gpu", cfg.GPU != nil && cfg.GPU.Enabled)
+
+	return &ONNXRunner{
+		cfg:     cfg,
+		session: session,
+		types:   types,
+		slog:    log,
+	}, nil
+}
+
+func newSession(cfg *RunnerConfig) (*ort.DynamicAdvancedSession, []string, error) {
+	types, err := inputTypes(cfg.Model, cfg.Inputs, cfg.Outputs)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts, err := newSessionOptions(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer opts.Destroy() //nolint:errcheck
+
+	inputNames := make([]string, len(cfg.Inputs))
+	for i, in := range cfg.Inputs {
+		inputNames[i] = in.Name
+	}
+	outputNames := make([]string, len(cfg.Outputs))
+	for i, out := range cfg.Outputs {
+		outputNames[i] = out.Name
+	}
+	session, err := ort.NewDynamicAdvancedSession(cfg.Model, inputNames, outputNames, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create inference session: %w", err)
+	}
+	return session, types, nil
+}
+
+// Process runs the inference on the JSON payload, an object or an array of objects run as
+// one batch, and writes the outputs into it
+func (r *ONNXRunner) Process(msg *message.RunnerMessage) error {
+	data, err := msg.GetData()
+	if err != nil {
+		return fmt.Errorf("failed to get data: %w", err)
+	}
+	if len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds max input size %d", len(data), r.cfg.MaxInputSize)
+	}
+	rows, batch, err := parseRows(data)
+	if err != nil {
+		return err
+	}
+
+	inputs := make([]ort.Value, len(r.cfg.Inputs))
+	outputs := make([]ort.Value, len(r.cfg.Outputs))
+	defer destroyValues(inputs)
+	defer destroyValues(outputs)
+	for i, in := range r.cfg.Inputs {
+		values, perRow, err := inputValues(rows, in)
+		if err != nil {
+			return fmt.Errorf("input %s: %w", in.Name, err)
+		}
+		shape, err := inputShape(in, len(rows), perRow)
+		if err != nil {
+			return err
+		}
+		if inputs[i], err = newTensor(r.types[i], shape, values); err != nil {
+			return fmt.Errorf("input %s: failed to create tensor: %w", in.Name, err)
+		}
+	}
+
+	// The nil outputs are allocated by ONNX Runtime with the shapes computed by the model
+	if err := r.session.Run(inputs, outputs); err != nil {
+		return fmt.Errorf("inference failed: %w", err)
+	}
+
+	for i, out := range r.cfg.Outputs {
+		values, err := tensorValues(outputs[i])
+		if err != nil {
+			return fmt.Errorf("output %s: %w", out.Name, err)
+		}
+		if err := writeOutput(rows, out, values); err != nil {
+			return err
+		}
+	}
+
+	var res any = rows[0]
+	if batch {
+		res = rows
+	}
+	out, err := json.Marshal(res)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	msg.SetData(out)
+	return nil
+}
+
+func destroyValues(values []ort.Value) {
+	for _, v := range values {
+		if v != nil {
+			v.Destroy() //nolint:errcheck
+		}
+	}
+}
+
+func (r *ONNXRunner) Close() error {
+	if r.session == nil {
+		return nil
+	}
+	err := r.session.Destroy()
+	r.session = nil
+	if releaseErr := releaseEnvironment(); err == nil {
+		err = releaseErr
+	}
+	return err
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+const (
+	typeFloat32 = "float32"
+	typeFloat64 = "float64"
+	typeInt64   = "int64"
+	typeInt32   = "int32"
+)
+
+// environment is the ONNX Runtime environment of the process, shared by the runners and
+// destroyed with the last of them
+var environment struct {
+	sync.Mutex
+	refs    int
+	library string
+}
+
+// acquireEnvironment initializes the environment with the shared library on first use
+func acquireEnvironment(library string) error {
+	environment.Lock()
+	defer environment.Unlock()
+	if environment.refs == 0 {
+		if library != "" {
+			ort.SetSharedLibraryPath(library)
+		}
+		if err := ort.InitializeEnvironment(); err != nil {
+			return fmt.Errorf("failed to initialize ONNX Runtime: %w", err)
+		}
+		environment.library = library
+	} else if library != environment.library {
+		return fmt.Errorf("ONNX Runtime already loaded from %q", environment.library)
+	}
+	environment.refs++
+	return nil
+}
+
+// releaseEnvironment destroys the environment when no runner uses it
+func releaseEnvironment() error {
+	environment.Lock()
+	defer environment.Unlock()
+	if environment.refs--; environment.refs > 0 {
+		return nil
+	}
+	return ort.DestroyEnvironment()
+}
+
+// newSessionOptions sets the threads and the CUDA execution provider of the sessions
+func newSessionOptions(cfg *RunnerConfig) (*ort.SessionOptions, error) {
+	opts, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Threads > 0 {
+		if err := opts.SetIntraOpNumThreads(cfg.Threads); err != nil {
+			opts.Destroy() //nolint:errcheck
+			return nil, fmt.Errorf("failed to set threads: %w", err)
+		}
+	}
+	if cfg.GPU != nil && cfg.GPU.Enabled {
+		if err := appendCUDA(opts, cfg.GPU.DeviceID); err != nil {
+			opts.Destroy() //nolint:errcheck
+			return nil, fmt.Errorf("failed to enable the CUDA execution provider: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+func appendCUDA(opts *ort.SessionOptions, deviceID int) error {
+	cuda, err := ort.NewCUDAProviderOptions()
+	if err != nil {
+		return err
+	}
+	defer cuda.Destroy() //nolint:errcheck
+	if err := cuda.Update(map[string]string{"device_id": strconv.Itoa(deviceID)}); err != nil {
+		return err
+	}
+	return opts.AppendExecutionProviderCUDA(cuda)
+}
+
+// inputTypes returns the element type of the configured inputs, read from the model when
+// not configured, checking that the inputs and the outputs exist
+func inputTypes(model string, inputs []Input, outputs []Output) ([]string, error) {
+	modelInputs, modelOutputs, err := ort.GetInputOutputInfo(model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the model: %w", err)
+	}
+	dataTypes := make(map[string]ort.TensorElementDataType, len(modelInputs))
+	for _, info := range modelInputs {
+		dataTypes[info.Name] = info.DataType
+	}
+	types := make([]string, len(inputs))
+	for i, in := range inputs {
+		dataType, ok := dataTypes[in.Name]
+		if !ok {
+			return nil, fmt.Errorf("model has no input %q", in.Name)
+		}
+		types[i] = in.Type
+		if types[i] == "" {
+			if types[i], err = elementType(dataType); err != nil {
+				return nil, fmt.Errorf("input %s: %w", in.Name, err)
+			}
+		}
+	}
+
+	names := make(map[string]bool, len(modelOutputs))
+	for _, info := range modelOutputs {
+		names[info.Name] = info.OrtValueType == ort.ONNXTypeTensor
+	}
+	for _, out := range outputs {
+		tensor, ok := names[out.Name]
+		if !ok {
+			return nil, fmt.Errorf("model has no output %q", out.Name)
+		}
+		if !tensor {
+			return nil, fmt.Errorf("output %s is not a tensor", out.Name)
+		}
+	}
+	return types, nil
+}
+
+// elementType maps the supported tensor element types of the model inputs
+func elementType(t ort.TensorElementDataType) (string, error) {
+	switch t {
+	case ort.TensorElementDataTypeFloat:
+		return typeFloat32, nil
+	case ort.TensorElementDataTypeDouble:
+		return typeFloat64, nil
+	case ort.TensorElementDataTypeInt64:
+		return typeInt64, nil
+	case ort.TensorElementDataTypeInt32:
+		return typeInt32, nil
+	default:
+		return "", fmt.Errorf("unsupported element type %v", t)
+	}
+}
+
+// newTensor creates the input tensor with the values converted to the element type
+func newTensor(elemType string, shape []int64, values []float64) (ort.Value, error) {
+	switch elemType {
+	case typeFloat64:
+		return tensorOf(shape, values)
+	case typeInt64:
+		return tensorOf(shape, convert[int64](values))
+	case typeInt32:
+		return tensorOf(shape, convert[int32](values))
+	default:
+		return tensorOf(shape, convert[float32](values))
+	}
+}
+
+// tensorOf creates a tensor, returning a nil value on failure
+func tensorOf[T float64 | float32 | int64 | int32](shape []int64, data []T) (ort.Value, error) {
+	t, err := ort.NewTensor(ort.NewShape(shape...), data)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func convert[T float32 | int64 | int32](values []float64) []T {
+	res := make([]T, len(values))
+	for i, v := range values {
+		res[i] = T(v)
+	}
+	return res
+}
+
+// tensorValues returns the values of an output tensor as JSON numbers: float64 for the
+// floating point tensors, int64 for the integer ones
+func tensorValues(v ort.Value) ([]any, error) {
+	switch t := v.(type) {
+	case *ort.Tensor[float32]:
+		return toAny(t.GetData(), func(x float32) any { return float64(x) }), nil
+	case *ort.Tensor[float64]:
+		return toAny(t.GetData(), func(x float64) any { return x }), nil
+	case *ort.Tensor[int64]:
+		return toAny(t.GetData(), func(x int64) any { return x }), nil
+	case *ort.Tensor[int32]:
+		return toAny(t.GetData(), func(x int32) any { return int64(x) }), nil
+	case *ort.Tensor[int16]:
+		return toAny(t.GetData(), func(x int16) any { return int64(x) }), nil
+	case *ort.Tensor[int8]:
+		return toAny(t.GetData(), func(x int8) any { return int64(x) }), nil
+	case *ort.Tensor[uint8]:
+		return toAny(t.GetData(), func(x uint8) any { return int64(x) }), nil
+	default:
+		return nil, fmt.Errorf("unsupported output type %T", v)
+	}
+}
+
+func toAny[T any](data []T, f func(T) any) []any {
+	res := make([]any, len(data))
+	for i, x := range data {
+		res[i] = f(x)
+	}
+	return res
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/sandrolain/events-bridge/src/common/jsonpath"
+)
+
+// parseRows decodes the payload into the rows of the batch: a JSON object is a batch of
+// one row, an array of objects a batch of one row per object
+func parseRows(data []byte) ([]map[string]any, bool, error) {
+	var payload any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, false, fmt.Errorf("payload must be JSON: %w", err)
+	}
+	switch v := payload.(type) {
+	case map[string]any:
+		return []map[string]any{v}, false, nil
+	case []any:
+		if len(v) == 0 {
+			return nil, false, fmt.Errorf("payload array is empty")
+		}
+		rows := make([]map[string]any, len(v))
+		for i, item := range v {
+			row, ok := item.(map[string]any)
+			if !ok {
+				return nil, false, fmt.Errorf("payload item %d must be a JSON object, got %T", i, item)
+			}
+			rows[i] = row
+		}
+		return rows, true, nil
+	default:
+		return nil, false, fmt.Errorf("payload must be a JSON object or an array of objects, got %T", payload)
+	}
+}
+
+// inputValues concatenates the values of the input fields of every row, returning them
+// with the number of values per row
+func inputValues(rows []map[string]any, in Input) ([]float64, int, error) {
+	var values []float64
+	perRow := -1
+	for i, row := range rows {
+		start := len(values)
+		for _, path := range in.Fields {
+			v, ok := jsonpath.Get(row, path)
+			if !ok || v == nil {
+				return nil, 0, fmt.Errorf("row %d: missing field %s", i, path)
+			}
+			var err error
+			if values, err = appendNumbers(values, v); err != nil {
+				return nil, 0, fmt.Errorf("row %d: field %s: %w", i, path, err)
+			}
+		}
+		n := len(values) - start
+		if perRow >= 0 && n != perRow {
+			return nil, 0, fmt.Errorf("row %d has %d values, expected %d", i, n, perRow)
+		}
+		perRow = n
+	}
+	return values, perRow, nil
+}
+
+// appendNumbers appends a number, a boolean (1 or 0) or the flattened numbers of an array
+func appendNumbers(values []float64, v any) ([]float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return append(values, v), nil
+	case bool:
+		if v {
+			return append(values, 1), nil
+		}
+		return append(values, 0), nil
+	case []any:
+		for _, item := range v {
+			var err error
+			if values, err = appendNumbers(values, item); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("value must be a number, a boolean or an array of numbers, got %T", v)
+	}
+}
+
+// inputShape returns the tensor shape of a batch: the number of rows followed by the
+// configured shape of a row, or by the number of values per row
+func inputShape(in Input, rows, perRow int) ([]int64, error) {
+	if len(in.Shape) == 0 {
+		return []int64{int64(rows), int64(perRow)}, nil
+	}
+	size := int64(1)
+	for _, d := range in.Shape {
+		size *= d
+	}
+	if size != int64(perRow) {
+		return nil, fmt.Errorf("input %s: shape %v holds %d values, got %d per row", in.Name, in.Shape, size, perRow)
+	}
+	return append([]int64{int64(rows)}, in.Shape...), nil
+}
+
+// writeOutput splits the values of an output tensor between the rows and sets them at the
+// output path: a single value per row is written as a scalar, more values as an array
+func writeOutput(rows []map[string]any, out Output, values []any) error {
+	if len(values)%len(rows) != 0 {
+		return fmt.Errorf("output %s has %d values, not divisible by the %d rows", out.Name, len(values), len(rows))
+	}
+	perRow := len(values) / len(rows)
+	for i, row := range rows {
+		chunk := values[i*perRow : (i+1)*perRow]
+		for j, v := range chunk {
+			label, err := outputLabel(out, v)
+			if err != nil {
+				return err
+			}
+			chunk[j] = label
+		}
+		var value any = chunk
+		if perRow == 1 {
+			value = chunk[0]
+		}
+		if !jsonpath.Set(row, out.Path, value) {
+			return fmt.Errorf("output %s: path %s is not in an object", out.Name, out.Path)
+		}
+	}
+	return nil
+}
+
+// outputLabel replaces an integer output with its label, when labels are configured, and
+// rejects the values that cannot be encoded in JSON
+func outputLabel(out Output, v any) (any, error) {
+	if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return nil, fmt.Errorf("output %s has a non-finite value", out.Name)
+	}
+	if len(out.Labels) == 0 {
+		return v, nil
+	}
+	i, ok := v.(int64)
+	if !ok {
+		return nil, fmt.Errorf("output %s: labels require an integer output, got %T", out.Name, v)
+	}
+	if i < 0 || i >= int64(len(out.Labels)) {
+		return nil, fmt.Errorf("output %s: class %d has no label", out.Name, i)
+	}
+	return out.Labels[i], nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestONNXParseRows(t *testing.T) {
+	rows, batch, err := parseRows([]byte(`{"a":1}`))
+	if err != nil || batch || len(rows) != 1 {
+		t.Fatalf("object: rows=%v batch=%v err=%v", rows, batch, err)
+	}
+	rows, batch, err = parseRows([]byte(`[{"a":1},{"a":2}]`))
+	if err != nil || !batch || len(rows) != 2 {
+		t.Fatalf("array: rows=%v batch=%v err=%v", rows, batch, err)
+	}
+	for _, payload := range []string{`[]`, `[1]`, `"x"`, `{`} {
+		if _, _, err := parseRows([]byte(payload)); err == nil {
+			t.Errorf("expected error for %s", payload)
+		}
+	}
+}
+
+func TestONNXInputValues(t *testing.T) {
+	rows, _, err := parseRows([]byte(`[
+		{"temp": 21.5, "flags": {"on": true}, "vec": [1, 2]},
+		{"temp": 22, "flags": {"on": false}, "vec": [3, 4]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := Input{Name: "x", Fields: []string{"temp", "flags.on", "vec"}}
+	values, perRow, err := inputValues(rows, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{21.5, 1, 1, 2, 22, 0, 3, 4}; !reflect.DeepEqual(values, want) || perRow != 4 {
+		t.Errorf("values = %v (%d per row), want %v", values, perRow, want)
+	}
+
+	shape, err := inputShape(in, len(rows), perRow)
+	if err != nil || !reflect.DeepEqual(shape, []int64{2, 4}) {
+		t.Errorf("shape = %v, err = %v", shape, err)
+	}
+	in.Shape = []int64{2, 2}
+	shape, err = inputShape(in, len(rows), perRow)
+	if err != nil || !reflect.DeepEqual(shape, []int64{2, 2, 2}) {
+		t.Errorf("configured shape = %v, err = %v", shape, err)
+	}
+	in.Shape = []int64{3}
+	if _, err := inputShape(in, len(rows), perRow); err == nil {
+		t.Error("expected error for a shape not matching the values")
+	}
+}
+
+func TestONNXInputValuesErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing":  `{"a": 1}`,
+		"type":     `{"a": 1, "b": "x"}`,
+		"null":     `{"a": 1, "b": null}`,
+		"mismatch": `[{"a": 1, "b": [1]}, {"a": 1, "b": [1, 2]}]`,
+	}
+	for name, payload := range tests {
+		rows, _, err := parseRows([]byte(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := inputValues(rows, Input{Name: "x", Fields: []string{"a", "b"}}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestONNXWriteOutput(t *testing.T) {
+	rows, _, err := parseRows([]byte(`[{"id": 1}, {"id": 2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeOutput(rows, Output{Name: "score", Path: "result.score"}, []any{0.25, 0.75}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeOutput(rows, Output{Name: "probs", Path: "probs"}, []any{0.1, 0.9, 0.6, 0.4}); err != nil {
+		t.Fatal(err)
+	}
+	labels := Output{Name: "label", Path: "label", Labels: []string{"normal", "anomaly"}}
+	if err := writeOutput(rows, labels, []any{int64(1), int64(0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := json.Marshal(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"id":1,"label":"anomaly","probs":[0.1,0.9],"result":{"score":0.25}},{"id":2,"label":"normal","probs":[0.6,0.4],"result":{"score":0.75}}]`
+	if string(out) != want {
+		t.Errorf("payload = %s\nwant %s", out, want)
+	}
+}
+
+func TestONNXWriteOutputErrors(t *testing.T) {
+	rows := []map[string]any{{}, {}}
+	if err := writeOutput(rows, Output{Name: "o", Path: "o"}, []any{1.0, 2.0, 3.0}); err == nil {
+		t.Error("expected error for values not divisible by the rows")
+	}
+	labels := Output{Name: "o", Path: "o", Labels: []string{"a"}}
+	if err := writeOutput(rows, labels, []any{int64(0), int64(1)}); err == nil {
+		t.Error("expected error for a class without label")
+	}
+	if err := writeOutput(rows, labels, []any{0.5, 0.5}); err == nil {
+		t.Error("expected error for labels of a float output")
+	}
+}
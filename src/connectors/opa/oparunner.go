@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/bundle"
+	"github.com/open-policy-agent/opa/v1/rego"
+
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure OPARunner implements connectors.Runner
+var _ connectors.Runner = &OPARunner{}
+
+const (
+	onDenyError    = "error"
+	onDenyAnnotate = "annotate"
+)
+
+type RunnerConfig struct {
+	// Query is the Rego query of the decision (e.g., "data.eventsbridge.routing.decision").
+	// The decision is a boolean (allow) or an object with "allow", "reason" and "metadata".
+	Query string `mapstructure:"query" validate:"required"`
+	// Policy is an inline Rego module
+	Policy string `mapstructure:"policy" validate:"required_without_all=PolicyFile BundlePath BundleURL"`
+	// PolicyFile is the path of a Rego module
+	PolicyFile string `mapstructure:"policyFile" validate:"omitempty,filepath"`
+	// BundlePath is the path of a bundle directory or .tar.gz archive
+	BundlePath string `mapstructure:"bundlePath"`
+	// BundleURL is the URL of a bundle .tar.gz archive served by an OPA bundle server
+	BundleURL string `mapstructure:"bundleURL" validate:"omitempty,url"`
+	// BundleToken is the bearer token of the bundle server (supports env: and file: secrets)
+	BundleToken string `mapstructure:"bundleToken"`
+	// RefreshInterval reloads the policy or bundle periodically (0 = disabled)
+	RefreshInterval time.Duration `mapstructure:"refreshInterval" default:"0s" validate:"min=0"`
+	// OnDeny is "error" (the message fails and is nacked) or "annotate" (only the metadata is set,
+	// e.g. to drop the message with a filterExpr)
+	OnDeny string `mapstructure:"onDeny" default:"error" validate:"oneof=error annotate"`
+	// AllowKey is the metadata key set to the decision ("true" or "false")
+	AllowKey string `mapstructure:"allowKey" default:"eb-opa-allow" validate:"required"`
+	// ReasonKey is the metadata key set to the decision reason, if any
+	ReasonKey string `mapstructure:"reasonKey" default:"eb-opa-reason" validate:"required"`
+	// Timeout of the policy evaluation
+	Timeout time.Duration `mapstructure:"timeout" default:"5s" validate:"gt=0"`
+	// MaxInputSize limits the payload size decoded for the policy input
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+// decision is the result of the policy evaluation
+type decision struct {
+	Allow    bool
+	Reason   string
+	Metadata map[string]string
+}
+
+type OPARunner struct {
+	cfg        *RunnerConfig
+	slog       *slog.Logger
+	httpClient *http.Client
+	mu         sync.RWMutex
+	query      rego.PreparedEvalQuery
+	etag       string
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a new instance of OPARunner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	if countSources(cfg) != 1 {
+		return nil, fmt.Errorf("exactly one of policy, policyFile, bundlePath or bundleURL is required")
+	}
+	if cfg.BundleURL != "" {
+		parsed, err := url.Parse(cfg.BundleURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle URL: %w", err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, fmt.Errorf("bundle URL must use http or https scheme, got %q", parsed.Scheme)
+		}
+	}
+
+	r := &OPARunner{
+		cfg:        cfg,
+		slog:       slog.Default().With("context", "OPA Runner"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		stopCh:     make(chan struct{}),
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshInterval > 0 && cfg.Policy == "" {
+		go r.refreshLoop()
+	}
+
+	r.slog.Info("OPA runner created",
+		"query", cfg.Query,
+		"policyFile", cfg.PolicyFile,
+		"bundlePath", cfg.BundlePath,
+		"bundleURL", cfg.BundleURL,
+		"refreshInterval", cfg.RefreshInterval,
+		"onDeny", cfg.OnDeny,
+	)
+	return r, nil
+}
+
+// countSources returns the number of configured policy sources
+func countSources(cfg *RunnerConfig) int {
+	n := 0
+	for _, v := range []string{cfg.Policy, cfg.PolicyFile, cfg.BundlePath, cfg.BundleURL} {
+		if v != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// load compiles the policy from its source and replaces the prepared query
+func (r *OPARunner) load() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.httpClient.Timeout)
+	defer cancel()
+
+	opts := []func(*rego.Rego){rego.Query(r.cfg.Query)}
+	etag := ""
+	switch {
+	case r.cfg.Policy != "":
+		opts = append(opts, rego.Module("policy.rego", r.cfg.Policy))
+	case r.cfg.PolicyFile != "":
+		content, err := os.ReadFile(r.cfg.PolicyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read policy file: %w", err)
+		}
+		opts = append(opts, rego.Module(r.cfg.PolicyFile, string(content)))
+	case r.cfg.BundlePath != "":
+		opts = append(opts, rego.LoadBundle(r.cfg.BundlePath))
+	default:
+		b, newETag, err := r.fetchBundle(ctx)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			// Not modified since the last fetch
+			return nil
+		}
+		opts = append(opts, rego.ParsedBundle("remote", b))
+		etag = newETag
+	}
+
+	query, err := rego.New(opts...).PrepareForEval(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to compile policy: %w", err)
+	}
+
+	r.mu.Lock()
+	r.query = query
+	r.etag = etag
+	r.mu.Unlock()
+	return nil
+}
+
+// fetchBundle downloads the bundle archive, returning nil when not modified
+func (r *OPARunner) fetchBundle(ctx context.Context) (*bundle.Bundle, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.cfg.BundleURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create bundle request: %w", err)
+	}
+	token, err := secrets.Resolve(r.cfg.BundleToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve bundle token: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	r.mu.RLock()
+	if r.etag != "" {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	r.mu.RUnlock()
+
+	// URL scheme is validated in NewRunner; SSRF risk is accepted as this is a user-configured endpoint.
+	resp, err := r.httpClient.Do(req) //nolint:gosec
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch bundle: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			r.slog.Warn("failed to close response body", "error", closeErr)
+		}
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, "", nil
+	default:
+		return nil, "", fmt.Errorf("unexpected bundle status code: %d", resp.StatusCode)
+	}
+
+	b, err := bundle.NewReader(resp.Body).Read()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read bundle: %w", err)
+	}
+	return &b, resp.Header.Get("ETag"), nil
+}
+
+// refreshLoop periodically reloads the policy in the background
+func (r *OPARunner) refreshLoop() {
+	ticker := time.NewTicker(r.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// On failure the previous policy stays in use
+			if err := r.load(); err != nil {
+				r.slog.Error("policy refresh failed", "error", err)
+			}
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// Process evaluates the policy with the message and applies the decision
+func (r *OPARunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds limit %d", len(data), r.cfg.MaxInputSize)
+	}
+
+	var payload any
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &payload); err != nil {
+			// Non-JSON payloads are exposed as string
+			payload = string(data)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+
+	r.mu.RLock()
+	query := r.query
+	r.mu.RUnlock()
+
+	rs, err := query.Eval(ctx, rego.EvalInput(map[string]any{"data": payload, "metadata": meta}))
+	if err != nil {
+		return fmt.Errorf("failed to evaluate policy: %w", err)
+	}
+
+	var d decision
+	if len(rs) > 0 && len(rs[0].Expressions) > 0 {
+		d, err = parseDecision(rs[0].Expressions[0].Value)
+		if err != nil {
+			return err
+		}
+	}
+	// An undefined decision denies the message
+
+	for k, v := range d.Metadata {
+		msg.AddMetadata(k, v)
+	}
+	msg.AddMetadata(r.cfg.AllowKey, fmt.Sprint(d.Allow))
+	if d.Reason != "" {
+		msg.AddMetadata(r.cfg.ReasonKey, d.Reason)
+	}
+
+	if !d.Allow {
+		r.slog.Debug("message denied by policy", "reason", d.Reason)
+		if r.cfg.OnDeny == onDenyError {
+			if d.Reason != "" {
+				return fmt.Errorf("message denied by policy: %s", d.Reason)
+			}
+			return errors.New("message denied by policy")
+		}
+	}
+	return nil
+}
+
+// parseDecision converts the query result to a decision
+func parseDecision(value any) (decision, error) {
+	switch v := value.(type) {
+	case bool:
+		return decision{Allow: v}, nil
+	case map[string]any:
+		d := decision{}
+		if allow, ok := v["allow"].(bool); ok {
+			d.Allow = allow
+		}
+		if reason, ok := v["reason"].(string); ok {
+			d.Reason = reason
+		}
+		if meta, ok := v["metadata"].(map[string]any); ok {
+			d.Metadata = make(map[string]string, len(meta))
+			for k, val := range meta {
+				if s, ok := val.(string); ok {
+					d.Metadata[k] = s
+					continue
+				}
+				encoded, err := json.Marshal(val)
+				if err != nil {
+					return decision{}, fmt.Errorf("failed to encode decision metadata %s: %w", k, err)
+				}
+				d.Metadata[k] = string(encoded)
+			}
+		}
+		return d, nil
+	default:
+		return decision{}, fmt.Errorf("unsupported decision type %T: expected boolean or object", value)
+	}
+}
+
+func (r *OPARunner) Close() error {
+	r.slog.Info("closing OPA runner")
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+	return nil
+}
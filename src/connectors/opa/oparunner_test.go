@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/bundle"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+const routingPolicy = `package eventsbridge.routing
+
+default decision := {"allow": false, "reason": "unknown source"}
+
+decision := {"allow": true, "metadata": {"team": input.data.team, "level": input.data.level}} if {
+	input.metadata.source == "billing"
+}
+`
+
+func mustNewOPARunner(t *testing.T, opts map[string]any) *OPARunner {
+	t.Helper()
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := r.Close(); err != nil {
+			t.Errorf("close: %v", err)
+		}
+	})
+	return r.(*OPARunner)
+}
+
+func newRunnerMessage(data string, metadata map[string]string) *message.RunnerMessage {
+	return message.NewRunnerMessage(testutil.NewAdapter([]byte(data), metadata))
+}
+
+func bundleArchive(t *testing.T, policy string) []byte {
+	t.Helper()
+	b := bundle.Bundle{
+		Data: map[string]any{},
+		Modules: []bundle.ModuleFile{{
+			URL:    "/policy.rego",
+			Path:   "/policy.rego",
+			Raw:    []byte(policy),
+			Parsed: ast.MustParseModule(policy),
+		}},
+	}
+	var buf bytes.Buffer
+	if err := bundle.NewWriter(&buf).Write(b); err != nil {
+		t.Fatalf("failed to write bundle: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestOPARunnerConfig(t *testing.T) {
+	if err := utils.ParseConfig(map[string]any{"policy": routingPolicy}, new(RunnerConfig)); err == nil {
+		t.Error("expected validation error without query")
+	}
+	if err := utils.ParseConfig(map[string]any{"query": "data.x"}, new(RunnerConfig)); err == nil {
+		t.Error("expected validation error without policy source")
+	}
+
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(map[string]any{"query": "data.x", "policy": routingPolicy, "bundlePath": "/tmp"}, cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	if _, err := NewRunner(cfg); err == nil {
+		t.Error("expected error with multiple policy sources")
+	}
+
+	cfg = new(RunnerConfig)
+	if err := utils.ParseConfig(map[string]any{"query": "data.x", "policy": "package x\nallow if {"}, cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	if _, err := NewRunner(cfg); err == nil {
+		t.Error("expected error for invalid policy")
+	}
+}
+
+func TestOPARunnerAllowAndAnnotate(t *testing.T) {
+	r := mustNewOPARunner(t, map[string]any{"query": "data.eventsbridge.routing.decision", "policy": routingPolicy})
+
+	msg := newRunnerMessage(`{"team":"payments","level":3}`, map[string]string{"source": "billing"})
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	meta, _ := msg.GetMetadata()
+	if meta["eb-opa-allow"] != "true" || meta["team"] != "payments" || meta["level"] != "3" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+	if _, ok := meta["eb-opa-reason"]; ok {
+		t.Error("reason should not be set without a decision reason")
+	}
+}
+
+func TestOPARunnerDeny(t *testing.T) {
+	r := mustNewOPARunner(t, map[string]any{"query": "data.eventsbridge.routing.decision", "policy": routingPolicy})
+
+	msg := newRunnerMessage(`{}`, map[string]string{"source": "crm"})
+	err := r.Process(msg)
+	if err == nil || !strings.Contains(err.Error(), "unknown source") {
+		t.Fatalf("expected deny error, got %v", err)
+	}
+
+	annotating := mustNewOPARunner(t, map[string]any{
+		"query":     "data.eventsbridge.routing.decision",
+		"policy":    routingPolicy,
+		"onDeny":    "annotate",
+		"allowKey":  "allowed",
+		"reasonKey": "why",
+	})
+	msg = newRunnerMessage(`not json`, map[string]string{"source": "crm"})
+	if err := annotating.Process(msg); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	meta, _ := msg.GetMetadata()
+	if meta["allowed"] != "false" || meta["why"] != "unknown source" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+}
+
+func TestOPARunnerBooleanAndUndefinedDecision(t *testing.T) {
+	policy := "package gate\n\nallow if input.data.ok\n"
+	r := mustNewOPARunner(t, map[string]any{"query": "data.gate.allow", "policy": policy, "onDeny": "annotate"})
+
+	msg := newRunnerMessage(`{"ok":true}`, nil)
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if meta, _ := msg.GetMetadata(); meta["eb-opa-allow"] != "true" {
+		t.Errorf("expected allow, got %v", meta)
+	}
+
+	// allow is undefined when the condition is not met
+	msg = newRunnerMessage(`{"ok":false}`, nil)
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if meta, _ := msg.GetMetadata(); meta["eb-opa-allow"] != "false" {
+		t.Errorf("expected deny, got %v", meta)
+	}
+
+	invalid := mustNewOPARunner(t, map[string]any{"query": "data.gate.level", "policy": "package gate\n\nlevel := 3\n"})
+	if err := invalid.Process(newRunnerMessage(`{}`, nil)); err == nil {
+		t.Error("expected error for unsupported decision type")
+	}
+}
+
+func TestOPARunnerBundleURLRefresh(t *testing.T) {
+	var version atomic.Int32
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		if req.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		allow := "false"
+		if version.Load() > 0 {
+			allow = "true"
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write(bundleArchive(t, "package gate\n\nallow := "+allow+"\n"))
+	}))
+	defer server.Close()
+
+	r := mustNewOPARunner(t, map[string]any{
+		"query":           "data.gate.allow",
+		"bundleURL":       server.URL + "/bundle.tar.gz",
+		"bundleToken":     "secret",
+		"refreshInterval": "20ms",
+		"onDeny":          "annotate",
+	})
+
+	msg := newRunnerMessage(`{}`, nil)
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if meta, _ := msg.GetMetadata(); meta["eb-opa-allow"] != "false" {
+		t.Fatalf("expected deny with the first bundle, got %v", meta)
+	}
+
+	version.Store(1)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		msg = newRunnerMessage(`{}`, nil)
+		if err := r.Process(msg); err != nil {
+			t.Fatalf("process: %v", err)
+		}
+		if meta, _ := msg.GetMetadata(); meta["eb-opa-allow"] == "true" {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("bundle was not refreshed after %d requests", requests.Load())
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sandrolain/events-bridge/src/common/scheduledquery"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
 	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
@@ -27,7 +28,11 @@ type SourceConfig struct {
 
 	// Table name to monitor for changes
 	// Must be a valid PostgreSQL identifier (alphanumeric + underscore)
-	Table string `mapstructure:"table" validate:"required"`
+	// Not used when the scheduled query is enabled
+	Table string `mapstructure:"table"`
+
+	// Scheduled query run instead of listening to the table changes
+	Query QueryConfig `mapstructure:"query"`
 
 	// TLS configuration for encrypted connections
 	TLS *tlsconfig.Config `mapstructure:"tls"`
@@ -43,11 +48,23 @@ type SourceConfig struct {
 	StrictValidation bool `mapstructure:"strictValidation" default:"true"`
 }
 
+// QueryConfig runs a SQL query on a cron schedule, emitting every row as a JSON message
+type QueryConfig struct {
+	// SQL is the query, with $1, $2... placeholders for the arguments
+	SQL string `mapstructure:"sql" validate:"required_with=Schedule"`
+	// Args are the arguments of the query
+	Args []any `mapstructure:"args"`
+
+	scheduledquery.Config `mapstructure:",squash"`
+}
+
 type PGSQLSource struct {
-	cfg  *SourceConfig
-	slog *slog.Logger
-	c    chan *message.RunnerMessage
-	conn *pgx.Conn
+	cfg   *SourceConfig
+	slog  *slog.Logger
+	c     chan *message.RunnerMessage
+	conn  *pgx.Conn
+	pool  *pgxpool.Pool
+	query *scheduledquery.Runner
 }
 
 func NewSourceConfig() any {
@@ -105,18 +122,33 @@ func NewSource(anyCfg any) (connectors.Source, error) {
 		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
 	}
 
+	s := &PGSQLSource{
+		cfg:  cfg,
+		slog: slog.Default().With("context", "PGSQL Source"),
+	}
+
+	if cfg.Query.Enabled() {
+		query, err := scheduledquery.New(&cfg.Query.Config, s.fetch, s.slog)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query: %w", err)
+		}
+		s.query = query
+		return s, nil
+	}
+
 	// Validate table name to prevent SQL injection
 	if err := validateIdentifier(cfg.Table, cfg.StrictValidation); err != nil {
 		return nil, fmt.Errorf("invalid table name: %w", err)
 	}
 
-	return &PGSQLSource{
-		cfg:  cfg,
-		slog: slog.Default().With("context", "PGSQL Source"),
-	}, nil
+	return s, nil
 }
 
 func (s *PGSQLSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	if s.query != nil {
+		return s.produceQuery(buffer)
+	}
+
 	s.c = make(chan *message.RunnerMessage, buffer)
 
 	tlsEnabled := s.cfg.TLS != nil && s.cfg.TLS.Enabled
@@ -173,6 +205,42 @@ func (s *PGSQLSource) Produce(buffer int) (<-chan *message.RunnerMessage, error)
 	return s.c, nil
 }
 
+// produceQuery connects the pool of the scheduled query and starts its schedule
+func (s *PGSQLSource) produceQuery(buffer int) (<-chan *message.RunnerMessage, error) {
+	tlsEnabled := s.cfg.TLS != nil && s.cfg.TLS.Enabled
+	s.slog.Info("starting PGSQL scheduled query", "schedule", s.cfg.Query.Schedule, "tls", tlsEnabled)
+
+	ctx := context.Background()
+	poolConfig, err := s.buildPoolConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build pool config: %w", err)
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	s.pool = pool
+
+	return s.query.Produce(buffer)
+}
+
+// fetch runs the scheduled query, returning its rows by column name
+func (s *PGSQLSource) fetch(ctx context.Context) ([]map[string]any, error) {
+	rows, err := s.pool.Query(ctx, s.cfg.Query.SQL, s.cfg.Query.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	res, err := pgx.CollectRows(rows, pgx.RowToMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+	return res, nil
+}
+
 func (s *PGSQLSource) listenLoop() {
 	ctx := context.Background()
 	for {
@@ -192,6 +260,13 @@ func (s *PGSQLSource) listenLoop() {
 }
 
 func (s *PGSQLSource) Close() error {
+	if s.query != nil {
+		err := s.query.Close()
+		if s.pool != nil {
+			s.pool.Close()
+		}
+		return err
+	}
 	if s.conn != nil {
 		return s.conn.Close(context.Background())
 	}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"testing"
+	"time"
 
+	"github.com/sandrolain/events-bridge/src/common/scheduledquery"
+	"github.com/sandrolain/events-bridge/src/common/statestore"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/utils"
 )
 
 const (
@@ -105,6 +109,49 @@ func TestValidateIdentifier(t *testing.T) {
 	}
 }
 
+// testQueryConfig returns a scheduled query configuration with the default options
+func testQueryConfig(schedule string) QueryConfig {
+	return QueryConfig{
+		SQL: "SELECT id, total FROM orders WHERE status = $1",
+		Config: scheduledquery.Config{
+			Schedule: schedule,
+			Timezone: "UTC",
+			Timeout:  time.Minute,
+			Backend:  "memory",
+			Memory:   statestore.MemoryConfig{MaxKeys: 100},
+		},
+	}
+}
+
+// TestQueryConfigOptions tests the decoding of the scheduled query options
+func TestQueryConfigOptions(t *testing.T) {
+	cfg := new(SourceConfig)
+	err := utils.ParseConfig(map[string]any{
+		"connString": testConnString,
+		"query": map[string]any{
+			"schedule":    "@hourly",
+			"sql":         "SELECT id FROM orders WHERE status = $1",
+			"args":        []any{"open"},
+			"keyField":    "id",
+			"changesOnly": true,
+		},
+	}, cfg)
+	if err != nil {
+		t.Fatalf(errUnexpectedError, err)
+	}
+	if !cfg.Query.Enabled() || cfg.Query.KeyField != "id" || !cfg.Query.ChangesOnly || cfg.Query.StatusKey != "eb-query-status" || len(cfg.Query.Args) != 1 {
+		t.Errorf("query = %+v", cfg.Query)
+	}
+
+	err = utils.ParseConfig(map[string]any{
+		"connString": testConnString,
+		"query":      map[string]any{"schedule": "@hourly"},
+	}, new(SourceConfig))
+	if err == nil {
+		t.Errorf(errExpectedError, "schedule without sql")
+	}
+}
+
 // TestSourceConfigValidation tests source config validation
 func TestSourceConfigValidation(t *testing.T) {
 	tests := []struct {
@@ -161,6 +208,24 @@ func TestSourceConfigValidation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "scheduled query without table",
+			config: &SourceConfig{
+				ConnString:       testConnString,
+				StrictValidation: true,
+				Query:            testQueryConfig("*/5 * * * *"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid query schedule",
+			config: &SourceConfig{
+				ConnString:       testConnString,
+				StrictValidation: true,
+				Query:            testQueryConfig("every 5 minutes"),
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
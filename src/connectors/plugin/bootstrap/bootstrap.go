@@ -11,6 +11,8 @@ import (
 
 	"github.com/caarlos0/env/v11"
 	"github.com/go-playground/validator/v10"
+	// Registers the zstd compressor of the payloads sent by the bridge
+	_ "github.com/sandrolain/events-bridge/src/connectors/plugin/compression"
 	"github.com/sandrolain/events-bridge/src/connectors/plugin/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -0,0 +1,131 @@
+// Package compression registers the zstd gRPC compressor used between the bridge and the
+// plugins, and holds the policy selecting the payloads worth compressing. It is imported
+// by the plugin manager and by the plugin bootstrap, so that both sides can decompress
+// the messages and the responses are compressed like the requests.
+package compression
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// Name is the gRPC encoding name of the compressor
+const Name = "zstd"
+
+// magics are the leading bytes of already compressed payloads (gzip, zstd, zip, bzip2,
+// xz, PNG, JPEG, WebP/RIFF, 7z), not compressed again
+var magics = [][]byte{
+	{0x1f, 0x8b},
+	{0x28, 0xb5, 0x2f, 0xfd},
+	{'P', 'K', 0x03, 0x04},
+	{'B', 'Z', 'h'},
+	{0xfd, '7', 'z', 'X', 'Z', 0x00},
+	{0x89, 'P', 'N', 'G'},
+	{0xff, 0xd8, 0xff},
+	{'R', 'I', 'F', 'F'},
+	{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c},
+}
+
+// Config is the compression policy of the payloads sent to a plugin
+type Config struct {
+	// Enabled compresses the payloads of the runner and target calls; the plugin must be
+	// built with a bootstrap supporting zstd
+	Enabled bool `mapstructure:"enabled"`
+	// Threshold is the minimum payload size compressed, in bytes
+	Threshold int `mapstructure:"threshold" default:"65536" validate:"min=0"`
+}
+
+// Compress reports whether the payload is compressed: it is enabled, the payload reaches
+// the threshold and is not already compressed
+func (c *Config) Compress(data []byte) bool {
+	return c.Enabled && len(data) >= c.Threshold && !Compressed(data)
+}
+
+// Compressed reports whether the payload starts with the magic bytes of a compressed format
+func Compressed(data []byte) bool {
+	for _, m := range magics {
+		if bytes.HasPrefix(data, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	encoding.RegisterCompressor(&compressor{})
+}
+
+// compressor implements encoding.Compressor with pooled zstd encoders and decoders
+type compressor struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+func (c *compressor) Name() string {
+	return Name
+}
+
+func (c *compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	if enc, ok := c.encoders.Get().(*zstd.Encoder); ok {
+		enc.Reset(w)
+		return &writer{enc: enc, pool: &c.encoders}, nil
+	}
+	enc, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &writer{enc: enc, pool: &c.encoders}, nil
+}
+
+func (c *compressor) Decompress(r io.Reader) (io.Reader, error) {
+	if dec, ok := c.decoders.Get().(*zstd.Decoder); ok {
+		if err := dec.Reset(r); err != nil {
+			c.decoders.Put(dec)
+			return nil, err
+		}
+		return &reader{dec: dec, pool: &c.decoders}, nil
+	}
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &reader{dec: dec, pool: &c.decoders}, nil
+}
+
+// writer returns the encoder to the pool once closed
+type writer struct {
+	enc  *zstd.Encoder
+	pool *sync.Pool
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	return w.enc.Write(p)
+}
+
+func (w *writer) Close() error {
+	err := w.enc.Close()
+	w.pool.Put(w.enc)
+	return err
+}
+
+// reader returns the decoder to the pool at the end of the message
+type reader struct {
+	dec  *zstd.Decoder
+	pool *sync.Pool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.dec == nil {
+		return 0, io.EOF
+	}
+	n, err := r.dec.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r.dec)
+		r.dec = nil
+	}
+	return n, err
+}
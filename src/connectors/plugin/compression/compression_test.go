@@ -0,0 +1,73 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/encoding"
+)
+
+func TestCompressorRoundTrip(t *testing.T) {
+	c := encoding.GetCompressor(Name)
+	if c == nil {
+		t.Fatal("zstd compressor not registered")
+	}
+	payload := []byte(strings.Repeat(`{"sensor":"a1","value":21.5}`, 4096))
+
+	// The pooled encoders and decoders are reused across messages
+	for range 3 {
+		var buf bytes.Buffer
+		w, err := c.Compress(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(payload); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() >= len(payload)/10 || !Compressed(buf.Bytes()) {
+			t.Errorf("compressed size = %d of %d", buf.Len(), len(payload))
+		}
+
+		r, err := c.Decompress(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("decompressed %d bytes, want %d", len(got), len(payload))
+		}
+	}
+
+	if r, err := c.Decompress(strings.NewReader("not zstd")); err == nil {
+		if _, err := io.ReadAll(r); err == nil {
+			t.Error("expected error decompressing invalid data")
+		}
+	}
+}
+
+func TestConfigCompress(t *testing.T) {
+	large := bytes.Repeat([]byte("a"), 100)
+	gzipped := append([]byte{0x1f, 0x8b, 0x08}, large...)
+	for name, tc := range map[string]struct {
+		cfg  Config
+		data []byte
+		want bool
+	}{
+		"disabled":           {Config{Threshold: 10}, large, false},
+		"above threshold":    {Config{Enabled: true, Threshold: 100}, large, true},
+		"below threshold":    {Config{Enabled: true, Threshold: 101}, large, false},
+		"already compressed": {Config{Enabled: true}, gzipped, false},
+	} {
+		if got := tc.cfg.Compress(tc.data); got != tc.want {
+			t.Errorf("%s: Compress() = %v, want %v", name, got, tc.want)
+		}
+	}
+}
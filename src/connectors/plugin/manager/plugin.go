@@ -14,6 +14,8 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/eapache/go-resiliency/retrier"
+	"github.com/sandrolain/events-bridge/src/common/procmon"
+	"github.com/sandrolain/events-bridge/src/connectors/plugin/compression"
 	"github.com/sandrolain/events-bridge/src/connectors/plugin/proto"
 )
 
@@ -33,6 +35,11 @@ type PluginConfig struct {
 	ExpectedSHA256    string `mapstructure:"expectedSHA256" validate:"omitempty"`    // Expected SHA256 hash of plugin binary
 	VerifyHash        bool   `mapstructure:"verifyHash" default:"false"`             // Whether to verify plugin hash
 	StrictValidation  bool   `mapstructure:"strictValidation" default:"true"`        // Enable strict security validation
+	// Monitor samples CPU, RSS and open files of the plugin process, restarting it on a limit breach
+	Monitor procmon.Config `mapstructure:"monitor"`
+	// Compression compresses with zstd the large payloads sent to the plugin; the responses
+	// are compressed like the requests
+	Compression compression.Config `mapstructure:"compression"`
 }
 
 type Plugin struct {
@@ -48,6 +55,7 @@ type Plugin struct {
 	slog    *slog.Logger
 	ctx     context.Context
 	cancel  context.CancelFunc
+	monitor *procmon.Monitor
 }
 
 // setupAddress configures the plugin address based on protocol
@@ -163,6 +171,7 @@ func (p *Plugin) Start() (err error) {
 
 	// Initialize context for goroutine management
 	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.stopped = false
 
 	p.slog.Info("Starting plugin", "name", cfg.Name, "retries", cfg.Retry, "delay", cfg.Delay)
 
@@ -189,22 +198,40 @@ func (p *Plugin) Start() (err error) {
 	err = p.cmd.Start()
 	if err != nil {
 		p.slog.Error("Cannot start plugin", "name", cfg.Name, "err", err)
-		p.Stop()
+		p.stop()
 		return
 	}
 
 	err = p.connect()
 	if err != nil {
 		p.slog.Error("Cannot connect to plugin", "name", cfg.Name, "err", err, "retries", cfg.Retry, "delay", cfg.Delay)
-		p.Stop()
+		p.stop()
 		return
 	}
 
 	go p.startCheckStatus()
 
+	if cfg.Monitor.Enabled() {
+		if p.monitor == nil {
+			p.monitor = procmon.NewMonitor("plugin:"+cfg.Name, cfg.Monitor, p.slog)
+		}
+		go p.monitor.Watch(p.ctx, p.cmd.Process.Pid, p.restart)
+	}
+
 	return
 }
 
+// restart stops the plugin after a resource limit breach and starts it again
+func (p *Plugin) restart(b procmon.Breach) {
+	p.slog.Warn("Restarting plugin after resource limit breach", "name", p.Config.Name, "pid", b.PID, "reason", b.Reason)
+	p.stop()
+	if err := p.Start(); err != nil {
+		p.slog.Error("Cannot restart plugin", "name", p.Config.Name, "err", err)
+		return
+	}
+	p.monitor.Restarted()
+}
+
 func (p *Plugin) connect() (err error) {
 	cfg := p.Config
 
@@ -309,7 +336,15 @@ func (p *Plugin) validateSecurity() error {
 	return nil
 }
 
+// Stop stops the plugin process and removes it from the monitored processes
 func (p *Plugin) Stop() {
+	p.stop()
+	if p.monitor != nil {
+		p.monitor.Close()
+	}
+}
+
+func (p *Plugin) stop() {
 	cfg := p.Config
 
 	// Cancel context to stop all goroutines
@@ -344,3 +379,12 @@ func (p *Plugin) Stop() {
 		}
 	}
 }
+
+// callOptions returns the options of a runner or target call, compressing the payload
+// when the compression policy selects it
+func (p *Plugin) callOptions(data []byte) []grpc.CallOption {
+	if p.Config.Compression.Compress(data) {
+		return []grpc.CallOption{grpc.UseCompressor(compression.Name)}
+	}
+	return nil
+}
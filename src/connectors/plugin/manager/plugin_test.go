@@ -12,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/sandrolain/events-bridge/src/connectors/plugin/compression"
 	"github.com/sandrolain/events-bridge/src/connectors/plugin/proto"
 	"github.com/sandrolain/events-bridge/src/message"
 
@@ -493,3 +494,62 @@ func TestGetFreePort(t *testing.T) {
 		t.Fatalf("expected positive port, got %d", port)
 	}
 }
+
+// echoPluginServer returns the runner requests as responses
+type echoPluginServer struct {
+	proto.UnimplementedPluginServiceServer
+}
+
+func (echoPluginServer) Runner(_ context.Context, msg *proto.PluginMessage) (*proto.PluginMessage, error) {
+	return msg, nil
+}
+
+func TestPluginRunnerCompression(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	proto.RegisterPluginServiceServer(srv, echoPluginServer{})
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(func() {
+		srv.Stop()
+		listener.Close() //nolint:errcheck
+	})
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() }) //nolint:errcheck
+
+	p := &Plugin{
+		Config: PluginConfig{Name: "zstd", Compression: compression.Config{Enabled: true, Threshold: 1024}},
+		client: proto.NewPluginServiceClient(conn),
+		slog:   newTestLogger(io.Discard),
+	}
+
+	small := []byte(`{"a":1}`)
+	large := bytes.Repeat([]byte(`{"sensor":"a1","value":21.5}`), 1024)
+	if opts := p.callOptions(small); len(opts) != 0 {
+		t.Errorf("small payload call options = %v", opts)
+	}
+	if opts := p.callOptions(large); len(opts) != 1 {
+		t.Errorf("large payload call options = %v", opts)
+	}
+
+	for _, data := range [][]byte{small, large} {
+		res, err := p.Runner(context.Background(), []byte("id"), map[string]string{"k": "v"}, data)
+		if err != nil {
+			t.Fatalf("Runner() unexpected error = %v", err)
+		}
+		got, err := res.GetData()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Runner() data = %d bytes, want %d (err %v)", len(got), len(data), err)
+		}
+	}
+}
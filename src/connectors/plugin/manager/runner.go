@@ -12,7 +12,7 @@ func (p *Plugin) Runner(ctx context.Context, id []byte, metadata map[string]stri
 		Uuid:     id,
 		Metadata: metadata,
 		Data:     data,
-	})
+	}, p.callOptions(data)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute command: %w", err)
 	}
@@ -11,7 +11,7 @@ func (p *Plugin) Target(ctx context.Context, id []byte, metadata map[string]stri
 		Uuid:     id,
 		Data:     data,
 		Metadata: metadata,
-	})
+	}, p.callOptions(data)...)
 
 	return
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/base64"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const nameLabel = "__name__"
+
+// label is a label pair of a series
+type label struct {
+	name  string
+	value string
+}
+
+// sample is a value of a series, with the type used in the text exposition format
+type sample struct {
+	name      string
+	kind      string
+	labels    []label // sorted by name, without __name__
+	value     float64
+	timestamp int64 // milliseconds
+}
+
+// seriesKey identifies the series of a sample
+func (s *sample) seriesKey() string {
+	var b strings.Builder
+	b.WriteString(s.name)
+	for _, l := range s.labels {
+		b.WriteByte(0xff)
+		b.WriteString(l.name)
+		b.WriteByte(0xfe)
+		b.WriteString(l.value)
+	}
+	return b.String()
+}
+
+// encodeWriteRequest encodes the samples as a snappy compressed remote-write 1.0 WriteRequest.
+// The samples of a series are grouped in one TimeSeries, ordered by timestamp.
+func encodeWriteRequest(samples []sample) []byte {
+	type series struct {
+		first   *sample
+		samples []*sample
+	}
+	var order []string
+	byKey := map[string]*series{}
+	for i := range samples {
+		s := &samples[i]
+		key := s.seriesKey()
+		ts, ok := byKey[key]
+		if !ok {
+			ts = &series{first: s}
+			byKey[key] = ts
+			order = append(order, key)
+		}
+		ts.samples = append(ts.samples, s)
+	}
+
+	var req []byte
+	for _, key := range order {
+		ts := byKey[key]
+		sort.SliceStable(ts.samples, func(i, j int) bool { return ts.samples[i].timestamp < ts.samples[j].timestamp })
+
+		var buf []byte
+		// __name__ sorts before the other label names
+		buf = appendLabel(buf, nameLabel, ts.first.name)
+		for _, l := range ts.first.labels {
+			buf = appendLabel(buf, l.name, l.value)
+		}
+		for _, s := range ts.samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(s.value))
+			sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(s.timestamp))
+			buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+			buf = protowire.AppendBytes(buf, sb)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, buf)
+	}
+	return snappy.Encode(nil, req)
+}
+
+func appendLabel(buf []byte, name, value string) []byte {
+	var lb []byte
+	lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+	lb = protowire.AppendString(lb, name)
+	lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+	lb = protowire.AppendString(lb, value)
+	buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+	return protowire.AppendBytes(buf, lb)
+}
+
+// encodeText encodes the samples in the text exposition format, without timestamps
+// (rejected by the Pushgateway). The samples of a metric are written together and
+// the last value of a series wins.
+func encodeText(samples []sample) []byte {
+	var names []string
+	kinds := map[string]string{}
+	series := map[string][]*sample{}
+	seen := map[string]int{}
+	for i := range samples {
+		s := &samples[i]
+		if _, ok := kinds[s.name]; !ok {
+			kinds[s.name] = s.kind
+			names = append(names, s.name)
+		}
+		key := s.seriesKey()
+		if idx, ok := seen[key]; ok {
+			series[s.name][idx] = s
+			continue
+		}
+		seen[key] = len(series[s.name])
+		series[s.name] = append(series[s.name], s)
+	}
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString("# TYPE ")
+		b.WriteString(name)
+		b.WriteByte(' ')
+		b.WriteString(kinds[name])
+		b.WriteByte('\n')
+		for _, s := range series[name] {
+			b.WriteString(name)
+			if len(s.labels) > 0 {
+				b.WriteByte('{')
+				for i, l := range s.labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					b.WriteString(l.name)
+					b.WriteString(`="`)
+					b.WriteString(escapeLabelValue(l.value))
+					b.WriteByte('"')
+				}
+				b.WriteByte('}')
+			}
+			b.WriteByte(' ')
+			b.WriteString(formatValue(s.value))
+			b.WriteByte('\n')
+		}
+	}
+	return []byte(b.String())
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// groupingPath returns the Pushgateway path of the job and grouping labels;
+// values that are empty or contain a slash are base64 encoded
+func groupingPath(job string, grouping []label) string {
+	var b strings.Builder
+	b.WriteString("/metrics")
+	writeSegment(&b, "job", job)
+	for _, l := range grouping {
+		writeSegment(&b, l.name, l.value)
+	}
+	return b.String()
+}
+
+func writeSegment(b *strings.Builder, name, value string) {
+	b.WriteByte('/')
+	b.WriteString(name)
+	if value == "" || strings.Contains(value, "/") {
+		b.WriteString("@base64/")
+		if value == "" {
+			// The empty value is encoded as a single padding character
+			b.WriteByte('=')
+			return
+		}
+		b.WriteString(base64.RawURLEncoding.EncodeToString([]byte(value)))
+		return
+	}
+	b.WriteByte('/')
+	b.WriteString(url.PathEscape(value))
+}
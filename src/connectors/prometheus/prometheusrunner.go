@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/httpretry"
+	"github.com/sandrolain/events-bridge/src/common/jsonpath"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure PrometheusRunner implements connectors.Runner
+var _ connectors.Runner = &PrometheusRunner{}
+
+const (
+	modeRemoteWrite = "remoteWrite"
+	modePushgateway = "pushgateway"
+
+	fromMetadata = "metadata"
+
+	kindGauge = "gauge"
+)
+
+var (
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Source is a value read from the message
+type Source struct {
+	// From is the message part the value is read from: "data" (JSON payload, default) or "metadata"
+	From string `mapstructure:"from" validate:"omitempty,oneof=data metadata"`
+	// Path is the dotted JSON path (e.g. "device.id", "readings.0.value") or the metadata key
+	Path string `mapstructure:"path" validate:"required"`
+}
+
+// MetricConfig maps the payload to the sample of a metric
+type MetricConfig struct {
+	// Name is the metric name
+	Name string `mapstructure:"name"`
+	// NameFrom reads the metric name from the message (alternative to Name)
+	NameFrom *Source `mapstructure:"nameFrom"`
+	// Type is the metric type pushed to the Pushgateway: "gauge" (default), "counter" or "untyped"
+	Type string `mapstructure:"type" validate:"omitempty,oneof=gauge counter untyped"`
+	// Value is the sample value (a number, a numeric string or a boolean)
+	Value Source `mapstructure:"value"`
+	// Labels are the label names and the values read from the message; missing values omit the label
+	Labels map[string]Source `mapstructure:"labels" validate:"dive"`
+	// Optional skips the metric when the value is missing instead of failing the message
+	Optional bool `mapstructure:"optional"`
+}
+
+type RunnerConfig struct {
+	// Mode is "remoteWrite" (remote-write 1.0 protobuf) or "pushgateway" (text format)
+	Mode string `mapstructure:"mode" default:"remoteWrite" validate:"oneof=remoteWrite pushgateway"`
+	// URL is the remote-write endpoint or the Pushgateway base URL
+	URL string `mapstructure:"url" validate:"required,url"`
+	// Metrics are the samples produced by each payload object
+	Metrics []MetricConfig `mapstructure:"metrics" validate:"required,min=1,dive"`
+	// ConstLabels are added to all the samples (metric labels take precedence)
+	ConstLabels map[string]string `mapstructure:"constLabels"`
+	// Timestamp reads the sample timestamp from the message (epoch number or RFC3339 string);
+	// the current time is used when not set. Ignored by the Pushgateway.
+	Timestamp *Source `mapstructure:"timestamp"`
+	// TimestampUnit is the unit of epoch timestamps: "s", "ms", "us" or "ns"
+	TimestampUnit string `mapstructure:"timestampUnit" default:"ms" validate:"oneof=s ms us ns"`
+	// Job is the Pushgateway job
+	Job string `mapstructure:"job" validate:"required_if=Mode pushgateway"`
+	// Grouping are the additional Pushgateway grouping labels
+	Grouping map[string]string `mapstructure:"grouping"`
+	// Method is the Pushgateway method: "post" replaces the pushed metrics of the group,
+	// "put" replaces the whole group
+	Method string `mapstructure:"method" default:"post" validate:"oneof=post put"`
+	// Headers are additional HTTP headers
+	Headers map[string]string `mapstructure:"headers"`
+	// Username enables basic authentication
+	Username string `mapstructure:"username"`
+	// Password supports secret references (env:, file:)
+	Password string `mapstructure:"password"`
+	// BearerToken supports secret references (env:, file:)
+	BearerToken string            `mapstructure:"bearerToken" validate:"excluded_with=Username"`
+	Timeout     time.Duration     `mapstructure:"timeout" default:"10s" validate:"gt=0"`
+	TLS         *tlsconfig.Config `mapstructure:"tls"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+type PrometheusRunner struct {
+	cfg         *RunnerConfig
+	slog        *slog.Logger
+	client      *http.Client
+	url         string
+	constLabels []label
+	password    string
+	bearerToken string
+	now         func() time.Time
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a new instance of PrometheusRunner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	for i, m := range cfg.Metrics {
+		if (m.Name == "") == (m.NameFrom == nil) {
+			return nil, fmt.Errorf("metric %d: exactly one of name and nameFrom must be set", i)
+		}
+		if m.Name != "" && !metricNameRe.MatchString(m.Name) {
+			return nil, fmt.Errorf("metric %d: invalid metric name %q", i, m.Name)
+		}
+		for name := range m.Labels {
+			if err := checkLabelName(name); err != nil {
+				return nil, fmt.Errorf("metric %d: %w", i, err)
+			}
+		}
+	}
+
+	r := &PrometheusRunner{
+		cfg:  cfg,
+		slog: slog.Default().With("context", "Prometheus Runner"),
+		url:  strings.TrimSuffix(cfg.URL, "/"),
+		now:  time.Now,
+	}
+
+	for name, value := range cfg.ConstLabels {
+		if err := checkLabelName(name); err != nil {
+			return nil, fmt.Errorf("const labels: %w", err)
+		}
+		r.constLabels = append(r.constLabels, label{name: name, value: value})
+	}
+
+	if cfg.Mode == modePushgateway {
+		grouping := make([]label, 0, len(cfg.Grouping))
+		for name, value := range cfg.Grouping {
+			if err := checkLabelName(name); err != nil {
+				return nil, fmt.Errorf("grouping: %w", err)
+			}
+			grouping = append(grouping, label{name: name, value: value})
+		}
+		sortLabels(grouping)
+		r.url += groupingPath(cfg.Job, grouping)
+	}
+
+	var err error
+	if cfg.Username != "" {
+		if r.password, err = secrets.Resolve(cfg.Password); err != nil {
+			return nil, fmt.Errorf("failed to resolve password: %w", err)
+		}
+	}
+	if cfg.BearerToken != "" {
+		if r.bearerToken, err = secrets.Resolve(cfg.BearerToken); err != nil {
+			return nil, fmt.Errorf("failed to resolve bearer token: %w", err)
+		}
+	}
+
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	r.client = &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	r.slog.Info("prometheus runner created",
+		"mode", cfg.Mode,
+		"url", r.url,
+		"metrics", len(cfg.Metrics),
+	)
+	return r, nil
+}
+
+func checkLabelName(name string) error {
+	if !labelNameRe.MatchString(name) || strings.HasPrefix(name, "__") {
+		return fmt.Errorf("invalid label name %q", name)
+	}
+	return nil
+}
+
+func sortLabels(labels []label) {
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+}
+
+// samples maps the payload objects to the samples of the configured metrics
+func (r *PrometheusRunner) samples(metadata map[string]string, data []byte) ([]sample, error) {
+	var payload any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON payload: %w", err)
+	}
+
+	var objects []any
+	switch p := payload.(type) {
+	case map[string]any:
+		objects = []any{p}
+	case []any:
+		objects = p
+	default:
+		return nil, fmt.Errorf("payload must be a JSON object or an array of objects")
+	}
+
+	now := r.now()
+	var samples []sample
+	for i, obj := range objects {
+		if _, ok := obj.(map[string]any); !ok {
+			return nil, fmt.Errorf("element %d is not a JSON object", i)
+		}
+
+		ts := now.UnixMilli()
+		if r.cfg.Timestamp != nil {
+			if v, ok := lookup(*r.cfg.Timestamp, metadata, obj); ok {
+				t, err := toTimestamp(v, r.cfg.TimestampUnit)
+				if err != nil {
+					return nil, fmt.Errorf("element %d: invalid timestamp: %w", i, err)
+				}
+				ts = t
+			}
+		}
+
+		for _, m := range r.cfg.Metrics {
+			s, ok, err := r.sample(&m, metadata, obj)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			if ok {
+				s.timestamp = ts
+				samples = append(samples, s)
+			}
+		}
+	}
+	return samples, nil
+}
+
+// sample maps an object to the sample of a metric; false is returned for missing optional values
+func (r *PrometheusRunner) sample(m *MetricConfig, metadata map[string]string, obj any) (sample, bool, error) {
+	name := m.Name
+	if m.NameFrom != nil {
+		v, ok := lookup(*m.NameFrom, metadata, obj)
+		if !ok {
+			return sample{}, false, fmt.Errorf("metric name %q not found", m.NameFrom.Path)
+		}
+		name = fmt.Sprint(v)
+		if !metricNameRe.MatchString(name) {
+			return sample{}, false, fmt.Errorf("invalid metric name %q", name)
+		}
+	}
+
+	raw, ok := lookup(m.Value, metadata, obj)
+	if !ok {
+		if m.Optional {
+			return sample{}, false, nil
+		}
+		return sample{}, false, fmt.Errorf("value %q of metric %s not found", m.Value.Path, name)
+	}
+	value, err := toFloat(raw)
+	if err != nil {
+		return sample{}, false, fmt.Errorf("value of metric %s: %w", name, err)
+	}
+
+	labels := make(map[string]string, len(r.constLabels)+len(m.Labels))
+	for _, l := range r.constLabels {
+		labels[l.name] = l.value
+	}
+	for lname, src := range m.Labels {
+		v, ok := lookup(src, metadata, obj)
+		if !ok || v == nil {
+			delete(labels, lname)
+			continue
+		}
+		labels[lname] = labelString(v)
+	}
+
+	s := sample{name: name, kind: m.Type, value: value}
+	if s.kind == "" {
+		s.kind = kindGauge
+	}
+	for lname, v := range labels {
+		if v != "" {
+			s.labels = append(s.labels, label{name: lname, value: v})
+		}
+	}
+	sortLabels(s.labels)
+	return s, true, nil
+}
+
+// lookup reads a value from the metadata or the payload object
+func lookup(src Source, metadata map[string]string, obj any) (any, bool) {
+	if src.From == fromMetadata {
+		v, ok := metadata[src.Path]
+		return v, ok
+	}
+	return jsonpath.Get(obj, src.Path)
+}
+
+// toFloat converts a decoded JSON value to a sample value
+func toFloat(v any) (float64, error) {
+	switch val := v.(type) {
+	case json.Number:
+		return val.Float64()
+	case bool:
+		if val {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", val)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("must be a number, got %T", v)
+	}
+}
+
+// toTimestamp converts an epoch number in the unit, or an RFC3339 string, to milliseconds
+func toTimestamp(v any, unit string) (int64, error) {
+	var n json.Number
+	switch val := v.(type) {
+	case json.Number:
+		n = val
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+			return t.UnixMilli(), nil
+		}
+		n = json.Number(strings.TrimSpace(val))
+	default:
+		return 0, fmt.Errorf("must be a number or an RFC3339 string, got %T", v)
+	}
+	f, err := n.Float64()
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid timestamp %q", n)
+	}
+	switch unit {
+	case "s":
+		return int64(f * 1e3), nil
+	case "us":
+		return int64(f / 1e3), nil
+	case "ns":
+		return int64(f / 1e6), nil
+	default:
+		return int64(f), nil
+	}
+}
+
+// labelString converts a decoded JSON scalar to a label value
+func labelString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case map[string]any, []any:
+		b, _ := json.Marshal(val)
+		return string(b)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// newRequest builds the HTTP request of the encoded samples
+func (r *PrometheusRunner) newRequest(samples []sample) (*http.Request, error) {
+	method := http.MethodPost
+	var body []byte
+	if r.cfg.Mode == modePushgateway {
+		if r.cfg.Method == "put" {
+			method = http.MethodPut
+		}
+		body = encodeText(samples)
+	} else {
+		body = encodeWriteRequest(samples)
+	}
+
+	req, err := http.NewRequest(method, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range r.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if r.cfg.Mode == modePushgateway {
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	}
+	if r.cfg.Username != "" {
+		req.SetBasicAuth(r.cfg.Username, r.password)
+	} else if r.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+r.bearerToken)
+	}
+	return req, nil
+}
+
+// Process maps the JSON payload to samples and sends them to the remote-write
+// endpoint or the Pushgateway. The message is unchanged.
+func (r *PrometheusRunner) Process(msg *message.RunnerMessage) error {
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds limit %d", len(data), r.cfg.MaxInputSize)
+	}
+
+	samples, err := r.samples(metadata, data)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		r.slog.Debug("no samples in message")
+		msg.AddMetadata("eb-prom-samples", "0")
+		return nil
+	}
+
+	req, err := r.newRequest(samples)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r.slog.Debug("sending samples", "url", r.url, "samples", len(samples))
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending samples: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode > 299 {
+		return fmt.Errorf("non-2XX status code: %d: %s", res.StatusCode, httpretry.ErrorBody(res.Body))
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	msg.AddMetadata("eb-prom-samples", strconv.Itoa(len(samples)))
+	msg.AddMetadata("eb-status", strconv.Itoa(res.StatusCode))
+	return nil
+}
+
+func (r *PrometheusRunner) Close() error {
+	r.slog.Info("closing prometheus runner")
+	r.client.CloseIdleConnections()
+	return nil
+}
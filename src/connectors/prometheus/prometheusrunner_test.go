@@ -0,0 +1,314 @@
+package main
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// capture records the requests received by a test server
+type capture struct {
+	mu      sync.Mutex
+	method  string
+	path    string
+	headers http.Header
+	body    []byte
+}
+
+func newTestServer(t *testing.T, status int) (*httptest.Server, *capture) {
+	t.Helper()
+	c := &capture{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		c.mu.Lock()
+		c.method, c.path, c.headers, c.body = req.Method, req.URL.EscapedPath(), req.Header.Clone(), body
+		c.mu.Unlock()
+		w.WriteHeader(status)
+		if status > 299 {
+			_, _ = w.Write([]byte("out of order sample"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, c
+}
+
+// decodedSeries is a series decoded from a remote-write request
+type decodedSeries struct {
+	labels  map[string]string
+	values  []float64
+	stamps  []int64
+	ordered []string // label names in encoded order
+}
+
+func decodeWriteRequest(t *testing.T, body []byte) []decodedSeries {
+	t.Helper()
+	raw, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("invalid snappy body: %v", err)
+	}
+	var out []decodedSeries
+	for len(raw) > 0 {
+		_, _, n := protowire.ConsumeTag(raw)
+		ts, m := protowire.ConsumeBytes(raw[n:])
+		raw = raw[n+m:]
+
+		s := decodedSeries{labels: map[string]string{}}
+		for len(ts) > 0 {
+			num, _, n := protowire.ConsumeTag(ts)
+			field, m := protowire.ConsumeBytes(ts[n:])
+			ts = ts[n+m:]
+			switch num {
+			case 1:
+				_, _, n := protowire.ConsumeTag(field)
+				name, m := protowire.ConsumeString(field[n:])
+				field = field[n+m:]
+				_, _, n = protowire.ConsumeTag(field)
+				value, _ := protowire.ConsumeString(field[n:])
+				s.labels[name] = value
+				s.ordered = append(s.ordered, name)
+			case 2:
+				_, _, n := protowire.ConsumeTag(field)
+				v, m := protowire.ConsumeFixed64(field[n:])
+				field = field[n+m:]
+				_, _, n = protowire.ConsumeTag(field)
+				stamp, _ := protowire.ConsumeVarint(field[n:])
+				s.values = append(s.values, math.Float64frombits(v))
+				s.stamps = append(s.stamps, int64(stamp))
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestPrometheusRunnerRemoteWrite(t *testing.T) {
+	srv, c := newTestServer(t, http.StatusNoContent)
+	cfg := &RunnerConfig{
+		Mode:   modeRemoteWrite,
+		URL:    srv.URL + "/api/v1/write",
+		Method: "post",
+		Metrics: []MetricConfig{
+			{
+				Name:  "device_temperature_celsius",
+				Value: Source{Path: "temp"},
+				Labels: map[string]Source{
+					"device": {Path: "device.id"},
+					"site":   {Path: "site", From: fromMetadata},
+				},
+			},
+			{Name: "device_online", Value: Source{Path: "online"}, Optional: true},
+		},
+		ConstLabels:   map[string]string{"env": "prod"},
+		Timestamp:     &Source{Path: "ts", From: "data"},
+		TimestampUnit: "ms",
+		BearerToken:   "secret",
+		Timeout:       time.Second,
+		MaxInputSize:  1024,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*PrometheusRunner)
+	r.now = func() time.Time { return time.UnixMilli(1700000000000) }
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`[
+		{"device": {"id": "a"}, "temp": 21.5, "ts": 1700000002000, "online": true},
+		{"device": {"id": "a"}, "temp": "22", "ts": 1700000001000},
+		{"device": {"id": "b"}, "temp": 19}
+	]`), map[string]string{"site": "milan"}))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+
+	if c.headers.Get("Content-Encoding") != "snappy" || c.headers.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("unexpected headers %v", c.headers)
+	}
+	if c.headers.Get("Authorization") != "Bearer secret" || c.headers.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+		t.Errorf("unexpected headers %v", c.headers)
+	}
+
+	series := decodeWriteRequest(t, c.body)
+	if len(series) != 3 {
+		t.Fatalf("got %d series, want 3", len(series))
+	}
+	a := series[0]
+	if a.labels["__name__"] != "device_temperature_celsius" || a.labels["device"] != "a" || a.labels["site"] != "milan" || a.labels["env"] != "prod" {
+		t.Errorf("unexpected labels %v", a.labels)
+	}
+	if strings.Join(a.ordered, ",") != "__name__,device,env,site" {
+		t.Errorf("labels not sorted: %v", a.ordered)
+	}
+	// The samples of a series are ordered by timestamp
+	if len(a.values) != 2 || a.stamps[0] != 1700000001000 || a.values[0] != 22 || a.values[1] != 21.5 {
+		t.Errorf("unexpected samples %v %v", a.values, a.stamps)
+	}
+	if online := series[1]; online.labels["__name__"] != "device_online" || online.values[0] != 1 || online.labels["device"] != "" {
+		t.Errorf("unexpected series %v", online)
+	}
+	if b := series[2]; b.labels["device"] != "b" || b.stamps[0] != 1700000000000 {
+		t.Errorf("unexpected series %v", b)
+	}
+
+	if meta, _ := msg.GetMetadata(); meta["eb-prom-samples"] != "4" || meta["eb-status"] != "204" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+}
+
+func TestPrometheusRunnerPushgateway(t *testing.T) {
+	srv, c := newTestServer(t, http.StatusOK)
+	cfg := &RunnerConfig{
+		Mode:     modePushgateway,
+		URL:      srv.URL,
+		Job:      "events",
+		Grouping: map[string]string{"instance": "host/1", "zone": "eu"},
+		Method:   "put",
+		Metrics: []MetricConfig{{
+			NameFrom: &Source{Path: "metric"},
+			Type:     "counter",
+			Value:    Source{Path: "count"},
+			Labels:   map[string]Source{"path": {Path: "path"}},
+		}},
+		TimestampUnit: "ms",
+		Username:      "user",
+		Password:      "pass",
+		Timeout:       time.Second,
+		MaxInputSize:  1024,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`[
+		{"metric": "http_requests_total", "count": 3, "path": "/a\"b"},
+		{"metric": "http_requests_total", "count": 5, "path": "/a\"b"},
+		{"metric": "http_errors_total", "count": 1}
+	]`), nil))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+
+	if c.method != http.MethodPut || c.path != "/metrics/job/events/instance@base64/aG9zdC8x/zone/eu" {
+		t.Errorf("unexpected request %s %s", c.method, c.path)
+	}
+	if user, pass, ok := (&http.Request{Header: c.headers}).BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("unexpected basic auth")
+	}
+	want := "# TYPE http_requests_total counter\n" +
+		"http_requests_total{path=\"/a\\\"b\"} 5\n" +
+		"# TYPE http_errors_total counter\n" +
+		"http_errors_total 1\n"
+	if string(c.body) != want {
+		t.Errorf("body = %q, want %q", c.body, want)
+	}
+}
+
+func TestPrometheusRunnerErrors(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusBadRequest)
+	cfg := &RunnerConfig{
+		Mode:          modeRemoteWrite,
+		URL:           srv.URL,
+		Method:        "post",
+		Metrics:       []MetricConfig{{NameFrom: &Source{Path: "name"}, Value: Source{Path: "v"}}},
+		Timestamp:     &Source{Path: "ts"},
+		TimestampUnit: "s",
+		Timeout:       time.Second,
+		MaxInputSize:  100,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	for _, payload := range []string{
+		`not json`,
+		`"text"`,
+		`[1]`,
+		`{"name": "m"}`,
+		`{"name": "m", "v": "abc"}`,
+		`{"name": "bad-name", "v": 1}`,
+		`{"name": "m", "v": 1, "ts": "yesterday"}`,
+		`{"name": "m", "v": 1, "padding": "` + strings.Repeat("x", 100) + `"}`,
+	} {
+		if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(payload), nil))); err == nil {
+			t.Errorf("Process(%s) expected error", payload)
+		}
+	}
+
+	err = r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"name": "m", "v": 1, "ts": 1700000000}`), nil)))
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "out of order") {
+		t.Errorf("Process() error = %v, want the status and response", err)
+	}
+}
+
+func TestPrometheusRunnerConfigValidation(t *testing.T) {
+	metric := map[string]any{"name": "m", "value": map[string]any{"path": "v"}}
+	for _, opts := range []map[string]any{
+		{"metrics": []any{metric}},
+		{"url": "http://localhost"},
+		{"url": "http://localhost", "mode": "pushgateway", "metrics": []any{metric}},
+		{"url": "http://localhost", "metrics": []any{map[string]any{"name": "m"}}},
+		{"url": "http://localhost", "timestampUnit": "h", "metrics": []any{metric}},
+		{"url": "http://localhost", "username": "u", "bearerToken": "t", "metrics": []any{metric}},
+	} {
+		if err := utils.ParseConfig(opts, new(RunnerConfig)); err == nil {
+			t.Errorf("ParseConfig(%v) expected error", opts)
+		}
+	}
+
+	tests := []struct {
+		name string
+		cfg  *RunnerConfig
+	}{
+		{"missing name", &RunnerConfig{
+			Mode: modeRemoteWrite, URL: "http://localhost", Method: "post", TimestampUnit: "ms", Timeout: time.Second,
+			Metrics: []MetricConfig{{Value: Source{Path: "v"}}},
+		}},
+		{"invalid name", &RunnerConfig{
+			Mode: modeRemoteWrite, URL: "http://localhost", Method: "post", TimestampUnit: "ms", Timeout: time.Second,
+			Metrics: []MetricConfig{{Name: "1m", Value: Source{Path: "v"}}},
+		}},
+		{"reserved const label", &RunnerConfig{
+			Mode: modeRemoteWrite, URL: "http://localhost", Method: "post", TimestampUnit: "ms", Timeout: time.Second,
+			Metrics:     []MetricConfig{{Name: "m", Value: Source{Path: "v"}}},
+			ConstLabels: map[string]string{"__x": "y"},
+		}},
+		{"invalid label", &RunnerConfig{
+			Mode: modeRemoteWrite, URL: "http://localhost", Method: "post", TimestampUnit: "ms", Timeout: time.Second,
+			Metrics: []MetricConfig{{Name: "m", Value: Source{Path: "v"}, Labels: map[string]Source{"a-b": {Path: "x"}}}},
+		}},
+	}
+	for _, tt := range tests {
+		if _, err := NewRunner(tt.cfg); err == nil {
+			t.Errorf("%s: NewRunner() expected error", tt.name)
+		}
+	}
+}
+
+func TestEncodeText(t *testing.T) {
+	got := string(encodeText([]sample{
+		{name: "m", kind: "gauge", value: math.Inf(1), labels: []label{{name: "a", value: "x\ny\\"}}},
+		{name: "m", kind: "gauge", value: math.NaN()},
+	}))
+	want := "# TYPE m gauge\nm{a=\"x\\ny\\\\\"} +Inf\nm NaN\n"
+	if got != want {
+		t.Errorf("encodeText() = %q, want %q", got, want)
+	}
+	if got := groupingPath("a b", []label{{name: "x", value: ""}}); got != "/metrics/job/a%20b/x@base64/=" {
+		t.Errorf("groupingPath() = %q", got)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
+)
+
+// setDiscovery resolves the endpoints of the server address through DNS and makes the
+// client dial them, with TLS when configured; it returns nil when discovery is disabled
+func setDiscovery(opts *redis.Options, cfg *discovery.Config, logger *slog.Logger) (*discovery.Resolver, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	resolver, err := discovery.New(cfg, opts.Addr, logger)
+	if err != nil {
+		return nil, err
+	}
+	opts.Dialer = resolver.TLSDialer(opts.TLSConfig)
+	return resolver, nil
+}
+
+// closeDiscovery stops the endpoint resolver, if any
+func closeDiscovery(r *discovery.Resolver) {
+	if r != nil {
+		r.Close()
+	}
+}
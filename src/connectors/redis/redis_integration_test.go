@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/sandrolain/events-bridge/src/message"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -130,6 +131,41 @@ func TestRedisPubSubIntegration(t *testing.T) {
 	source.Close()
 }
 
+func TestRedisInvalidationIntegration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sourceCfg := &SourceConfig{
+		Address: redisAddress,
+		Invalidation: InvalidationConfig{
+			Enabled:  true,
+			Prefixes: []string{"cache:"},
+		},
+	}
+
+	source, err := NewSource(sourceCfg)
+	require.NoError(t, err)
+	defer source.Close()
+
+	msgChan, err := source.Produce(10)
+	require.NoError(t, err)
+
+	client := redis.NewClient(&redis.Options{Addr: redisAddress})
+	defer client.Close()
+	require.NoError(t, client.Set(ctx, "other:1", "v", 0).Err())
+	require.NoError(t, client.Set(ctx, "cache:user:1", "v", 0).Err())
+
+	select {
+	case receivedMsg := <-msgChan:
+		metadata, err := receivedMsg.GetSourceMetadata()
+		require.NoError(t, err)
+		assert.Equal(t, "cache:user:1", metadata["key"])
+		assert.Equal(t, "invalidate", metadata["event"])
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for invalidation message")
+	}
+}
+
 func TestRedisChannelFromMetadataIntegration(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
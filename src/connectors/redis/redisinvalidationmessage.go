@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &RedisInvalidationMessage{}
+
+// RedisInvalidationMessage is emitted for every key invalidated by the server
+type RedisInvalidationMessage struct {
+	key string
+}
+
+func (m *RedisInvalidationMessage) GetID() []byte {
+	return []byte(m.key)
+}
+
+func (m *RedisInvalidationMessage) GetMetadata() (map[string]string, error) {
+	return map[string]string{"key": m.key, "event": "invalidate"}, nil
+}
+
+func (m *RedisInvalidationMessage) GetData() ([]byte, error) {
+	return []byte(m.key), nil
+}
+
+func (m *RedisInvalidationMessage) Ack(data *message.ReplyData) error {
+	// Invalidation messages don't support reply
+	return nil
+}
+
+func (m *RedisInvalidationMessage) Nak() error {
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
 	"github.com/sandrolain/events-bridge/src/common/secrets"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
 	"github.com/sandrolain/events-bridge/src/connectors"
@@ -31,6 +32,10 @@ type RunnerConfig struct {
 	// TLS configuration for encrypted connections
 	TLS *tlsconfig.Config `mapstructure:"tls"`
 
+	// Discovery resolves the server endpoints through DNS (SRV or every A/AAAA record of
+	// the address host), balancing the connections and re-resolving them periodically.
+	Discovery *discovery.Config `mapstructure:"discovery"`
+
 	// PubSub mode
 	// Channel name for publishing messages
 	Channel string `mapstructure:"channel"`
@@ -125,10 +130,16 @@ func NewChannelRunner(cfg *RunnerConfig) (connectors.Runner, error) {
 		return nil, fmt.Errorf("failed to build Redis options: %w", err)
 	}
 
+	resolver, err := setDiscovery(opts, cfg.Discovery, l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover Redis endpoints: %w", err)
+	}
+
 	client := redis.NewClient(opts)
 
 	// Test connection
 	if err := client.Ping(context.Background()).Err(); err != nil {
+		closeDiscovery(resolver)
 		return nil, fmt.Errorf("failed to ping Redis: %w", err)
 	}
 
@@ -144,17 +155,27 @@ func NewChannelRunner(cfg *RunnerConfig) (connectors.Runner, error) {
 		"strictValidation", cfg.StrictValidation,
 	)
 
-	return &RedisRunner{
-		cfg:    cfg,
-		slog:   l,
-		client: client,
-	}, nil
+	runner := &RedisRunner{
+		cfg:       cfg,
+		slog:      l,
+		client:    client,
+		discovery: resolver,
+	}
+	runner.SetState(connectors.StateConnected)
+	trackStatus(client, &runner.StatusTracker)
+	return runner, nil
 }
 
+// Ensure RedisRunner implements connectors.StatusReporter
+var _ connectors.StatusReporter = &RedisRunner{}
+
 type RedisRunner struct {
-	cfg    *RunnerConfig
-	slog   *slog.Logger
-	client *redis.Client
+	connectors.StatusTracker
+
+	cfg       *RunnerConfig
+	slog      *slog.Logger
+	client    *redis.Client
+	discovery *discovery.Resolver
 }
 
 func (r *RedisRunner) Process(msg *message.RunnerMessage) error {
@@ -176,13 +197,16 @@ func (r *RedisRunner) Process(msg *message.RunnerMessage) error {
 
 	err = r.client.Publish(context.Background(), channel, data).Err()
 	if err != nil {
+		r.RecordError(err)
 		return fmt.Errorf("error publishing to Redis: %w", err)
 	}
+	r.RecordMessage()
 	r.slog.Debug("Redis message published", "channel", channel)
 	return nil
 }
 
 func (r *RedisRunner) Close() error {
+	defer closeDiscovery(r.discovery)
 	if r.client != nil {
 		if err := r.client.Close(); err != nil {
 			return fmt.Errorf("error closing Redis client: %w", err)
@@ -6,11 +6,13 @@ import (
 	"log/slog"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
 	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
 )
 
 var _ connectors.Runner = (*RedisStreamRunner)(nil)
+var _ connectors.StatusReporter = (*RedisStreamRunner)(nil)
 
 func NewStreamRunner(cfg *RunnerConfig) (connectors.Runner, error) {
 	l := slog.Default().With("context", "RedisStream Runner")
@@ -20,10 +22,16 @@ func NewStreamRunner(cfg *RunnerConfig) (connectors.Runner, error) {
 		return nil, fmt.Errorf("failed to build Redis options: %w", err)
 	}
 
+	resolver, err := setDiscovery(opts, cfg.Discovery, l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover Redis endpoints: %w", err)
+	}
+
 	client := redis.NewClient(opts)
 
 	// Test connection
 	if err := client.Ping(context.Background()).Err(); err != nil {
+		closeDiscovery(resolver)
 		return nil, fmt.Errorf("failed to ping Redis: %w", err)
 	}
 
@@ -39,17 +47,24 @@ func NewStreamRunner(cfg *RunnerConfig) (connectors.Runner, error) {
 		"strictValidation", cfg.StrictValidation,
 	)
 
-	return &RedisStreamRunner{
-		cfg:    cfg,
-		slog:   l,
-		client: client,
-	}, nil
+	runner := &RedisStreamRunner{
+		cfg:       cfg,
+		slog:      l,
+		client:    client,
+		discovery: resolver,
+	}
+	runner.SetState(connectors.StateConnected)
+	trackStatus(client, &runner.StatusTracker)
+	return runner, nil
 }
 
 type RedisStreamRunner struct {
-	cfg    *RunnerConfig
-	slog   *slog.Logger
-	client *redis.Client
+	connectors.StatusTracker
+
+	cfg       *RunnerConfig
+	slog      *slog.Logger
+	client    *redis.Client
+	discovery *discovery.Resolver
 }
 
 func (r *RedisStreamRunner) Process(msg *message.RunnerMessage) error {
@@ -84,13 +99,16 @@ func (r *RedisStreamRunner) Process(msg *message.RunnerMessage) error {
 		Values: fields,
 	}).Err()
 	if err != nil {
+		r.RecordError(err)
 		return fmt.Errorf("error publishing to Redis stream: %w", err)
 	}
+	r.RecordMessage()
 	r.slog.Debug("Redis stream message published", "stream", stream)
 	return nil
 }
 
 func (r *RedisStreamRunner) Close() error {
+	defer closeDiscovery(r.discovery)
 	if r.client != nil {
 		if err := r.client.Close(); err != nil {
 			return fmt.Errorf("error closing Redis client: %w", err)
@@ -8,6 +8,8 @@ import (
 	miniredis "github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
 
+	"github.com/sandrolain/events-bridge/src/common/discovery"
+	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
 	"github.com/sandrolain/events-bridge/src/testutil"
 )
@@ -309,3 +311,67 @@ func TestRedisChannelTargetMetadataOverride(t *testing.T) {
 		t.Fatalf("expected payload 'notify', got %q", received.Payload)
 	}
 }
+
+func TestRedisStreamRunnerDiscovery(t *testing.T) {
+	srv := newMiniredis(t)
+	cfg := &RunnerConfig{
+		Address:   "localhost:" + srv.Port(),
+		Stream:    "discovered",
+		Discovery: &discovery.Config{Type: discovery.TypeDNS},
+	}
+
+	targetAny, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf(errFmtNewRunner, err)
+	}
+	target := targetAny.(*RedisStreamRunner)
+	t.Cleanup(func() {
+		if err := target.Close(); err != nil {
+			t.Fatalf(errFmtCloseRunner, err)
+		}
+	})
+	if len(target.discovery.Endpoints()) == 0 {
+		t.Fatal("expected discovered endpoints")
+	}
+
+	if err := target.Process(newStubRunnerMessage("hello", nil)); err != nil {
+		t.Fatalf(errFmtConsume, err)
+	}
+	entries, err := newRedisClient(t, srv.Addr()).XRange(context.Background(), "discovered", "-", "+").Result()
+	if err != nil {
+		t.Fatalf(errFmtXRangeFailed, err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 stream entry, got %d", len(entries))
+	}
+}
+
+func TestRedisRunnerStatus(t *testing.T) {
+	srv := newMiniredis(t)
+	targetAny, err := NewRunner(&RunnerConfig{Address: srv.Addr(), Channel: "notifications"})
+	if err != nil {
+		t.Fatalf(errFmtNewRunner, err)
+	}
+	target := targetAny.(*RedisRunner)
+	t.Cleanup(func() {
+		if err := target.Close(); err != nil {
+			t.Fatalf(errFmtCloseRunner, err)
+		}
+	})
+
+	if err := target.Process(newStubRunnerMessage("notify", nil)); err != nil {
+		t.Fatalf(errFmtConsume, err)
+	}
+	if status := target.ConnectorStatus(); status.State != connectors.StateConnected || status.LastMessageAt.IsZero() {
+		t.Errorf("status = %+v, want connected with a message", status)
+	}
+
+	// The server is gone: the client fails to dial again
+	srv.Close()
+	if err := target.Process(newStubRunnerMessage("notify", nil)); err == nil {
+		t.Fatal("Process() expected error")
+	}
+	if status := target.ConnectorStatus(); status.State != connectors.StateDisconnected || status.LastError == "" {
+		t.Errorf("status = %+v, want disconnected with the error", status)
+	}
+}
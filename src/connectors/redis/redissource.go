@@ -8,6 +8,7 @@ import (
 	"regexp"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
 	"github.com/sandrolain/events-bridge/src/common/secrets"
 	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
 	"github.com/sandrolain/events-bridge/src/connectors"
@@ -34,6 +35,10 @@ type SourceConfig struct {
 	// TLS configuration for encrypted connections
 	TLS *tlsconfig.Config `mapstructure:"tls"`
 
+	// Discovery resolves the server endpoints through DNS (SRV or every A/AAAA record of
+	// the address host), balancing the connections and re-resolving them periodically.
+	Discovery *discovery.Config `mapstructure:"discovery"`
+
 	// PubSub mode
 	// Channel name for PubSub subscription
 	Channel string `mapstructure:"channel"`
@@ -47,17 +52,27 @@ type SourceConfig struct {
 	// Stream starting position: "0" (beginning), "$" (newest), ">" (consumer group), "+" (end), "-" (start), or specific ID
 	LastID string `mapstructure:"lastID" default:"$" validate:"oneof=0 $ > + -"`
 
+	// Invalidation mode
+	// Emits the keys invalidated by server-assisted client-side caching
+	Invalidation InvalidationConfig `mapstructure:"invalidation"`
+
 	// Enable strict key validation (recommended: true)
 	// When true, channel/stream names are validated against a strict pattern
 	StrictValidation bool `mapstructure:"strictValidation" default:"true"`
 }
 
+// Ensure RedisSource implements connectors.StatusReporter
+var _ connectors.StatusReporter = &RedisSource{}
+
 type RedisSource struct {
-	cfg    *SourceConfig
-	slog   *slog.Logger
-	c      chan *message.RunnerMessage
-	client *redis.Client
-	pubsub *redis.PubSub
+	connectors.StatusTracker
+
+	cfg       *SourceConfig
+	slog      *slog.Logger
+	c         chan *message.RunnerMessage
+	client    *redis.Client
+	pubsub    *redis.PubSub
+	discovery *discovery.Resolver
 }
 
 func NewSourceConfig() any {
@@ -147,6 +162,9 @@ func NewSource(anyCfg any) (connectors.Source, error) {
 		}
 	}
 
+	if cfg.Invalidation.Enabled {
+		return NewInvalidationSource(cfg)
+	}
 	if cfg.Stream != "" {
 		return NewStreamSource(cfg)
 	}
@@ -183,7 +201,12 @@ func (s *RedisSource) Produce(buffer int) (<-chan *message.RunnerMessage, error)
 		return nil, fmt.Errorf("failed to build Redis options: %w", err)
 	}
 
+	if s.discovery, err = setDiscovery(opts, s.cfg.Discovery, s.slog); err != nil {
+		return nil, fmt.Errorf("failed to discover Redis endpoints: %w", err)
+	}
+
 	s.client = redis.NewClient(opts)
+	trackStatus(s.client, &s.StatusTracker)
 
 	// Test connection
 	if err := s.client.Ping(context.Background()).Err(); err != nil {
@@ -200,11 +223,13 @@ func (s *RedisSource) consume() {
 	ch := s.pubsub.Channel()
 	for msg := range ch {
 		m := &RedisMessage{msg: msg}
+		s.RecordMessage()
 		s.c <- message.NewRunnerMessage(m)
 	}
 }
 
 func (s *RedisSource) Close() error {
+	defer closeDiscovery(s.discovery)
 	if s.pubsub != nil {
 		if err := s.pubsub.Close(); err != nil {
 			return fmt.Errorf("error closing Redis pubsub: %w", err)
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// invalidationChannel is the channel where Redis publishes redirected invalidation messages
+const invalidationChannel = "__redis__:invalidate"
+
+// InvalidationConfig configures the client-side caching invalidation mode.
+// The source enables CLIENT TRACKING in broadcast mode and emits an event for
+// every key changed on the server that matches one of the tracked prefixes.
+type InvalidationConfig struct {
+	// Enabled turns on the invalidation mode
+	Enabled bool `mapstructure:"enabled" default:"false"`
+	// Prefixes of the tracked keys (empty = all keys)
+	Prefixes []string `mapstructure:"prefixes"`
+}
+
+// Ensure RedisInvalidationSource implements connectors.StatusReporter
+var _ connectors.StatusReporter = &RedisInvalidationSource{}
+
+// RedisInvalidationSource emits the keys invalidated by Redis server-assisted client-side caching.
+// The invalidation messages are redirected to a dedicated Pub/Sub connection, so this
+// works both with RESP2 and RESP3 servers (Redis 6+). Database flushes are not reported.
+type RedisInvalidationSource struct {
+	connectors.StatusTracker
+
+	cfg       *SourceConfig
+	slog      *slog.Logger
+	c         chan *message.RunnerMessage
+	client    *redis.Client
+	subClient *redis.Client
+	pubsub    *redis.PubSub
+	trackMu   sync.Mutex
+	trackConn *redis.Conn
+	discovery *discovery.Resolver
+}
+
+func NewInvalidationSource(cfg *SourceConfig) (connectors.Source, error) {
+	for _, prefix := range cfg.Invalidation.Prefixes {
+		if err := validateRedisKey(prefix, cfg.StrictValidation); err != nil {
+			return nil, fmt.Errorf("invalid tracking prefix: %w", err)
+		}
+	}
+	return &RedisInvalidationSource{
+		cfg:  cfg,
+		slog: slog.Default().With("context", "RedisInvalidation Source"),
+	}, nil
+}
+
+// trackingArgs builds the CLIENT TRACKING command redirecting the invalidations to the client ID
+func trackingArgs(redirectID int64, prefixes []string) []any {
+	args := []any{"CLIENT", "TRACKING", "ON", "REDIRECT", redirectID, "BCAST"}
+	for _, prefix := range prefixes {
+		args = append(args, "PREFIX", prefix)
+	}
+	return args
+}
+
+func (s *RedisInvalidationSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	s.c = make(chan *message.RunnerMessage, buffer)
+
+	s.slog.Info("starting Redis invalidation source",
+		"address", s.cfg.Address,
+		"prefixes", s.cfg.Invalidation.Prefixes,
+		"db", s.cfg.DB,
+		"tls", s.cfg.TLS != nil && s.cfg.TLS.Enabled,
+		"auth", s.cfg.Username != "" || s.cfg.Password != "",
+	)
+
+	base := &RedisSource{cfg: s.cfg}
+	opts, err := base.buildRedisOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Redis options: %w", err)
+	}
+
+	// The subscriber client copies the options, sharing the resolver
+	if s.discovery, err = setDiscovery(opts, s.cfg.Discovery, s.slog); err != nil {
+		return nil, fmt.Errorf("failed to discover Redis endpoints: %w", err)
+	}
+
+	s.client = redis.NewClient(opts)
+	trackStatus(s.client, &s.StatusTracker)
+	ctx := context.Background()
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to ping Redis: %w", err)
+	}
+
+	// The tracking state belongs to a single connection that must stay open
+	s.trackConn = s.client.Conn()
+
+	// The subscriber client only holds the Pub/Sub connection: every time it
+	// (re)connects, tracking is redirected to its new client ID.
+	subOpts := *opts
+	subOpts.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+		id, err := cn.ClientID(ctx).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get subscriber client ID: %w", err)
+		}
+		return s.enableTracking(ctx, id)
+	}
+	s.subClient = redis.NewClient(&subOpts)
+	trackStatus(s.subClient, &s.StatusTracker)
+
+	s.pubsub = s.subClient.Subscribe(ctx, invalidationChannel)
+	if _, err := s.pubsub.Receive(ctx); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to invalidation channel: %w", err)
+	}
+	go s.consume()
+
+	return s.c, nil
+}
+
+// enableTracking (re)enables tracking on the tracking connection, redirected to the subscriber
+func (s *RedisInvalidationSource) enableTracking(ctx context.Context, redirectID int64) error {
+	s.trackMu.Lock()
+	defer s.trackMu.Unlock()
+
+	// Broadcast options cannot be changed while tracking is on
+	if err := s.trackConn.Do(ctx, "CLIENT", "TRACKING", "OFF").Err(); err != nil {
+		return fmt.Errorf("failed to reset client tracking: %w", err)
+	}
+	if err := s.trackConn.Do(ctx, trackingArgs(redirectID, s.cfg.Invalidation.Prefixes)...).Err(); err != nil {
+		return fmt.Errorf("failed to enable client tracking: %w", err)
+	}
+	s.slog.Debug("client tracking enabled", "redirect", redirectID)
+	return nil
+}
+
+func (s *RedisInvalidationSource) consume() {
+	for msg := range s.pubsub.Channel() {
+		for _, key := range invalidatedKeys(msg) {
+			s.RecordMessage()
+			s.c <- message.NewRunnerMessage(&RedisInvalidationMessage{key: key})
+		}
+	}
+}
+
+// invalidatedKeys returns the keys reported by an invalidation message
+func invalidatedKeys(msg *redis.Message) []string {
+	if len(msg.PayloadSlice) > 0 {
+		return msg.PayloadSlice
+	}
+	if msg.Payload != "" {
+		return []string{msg.Payload}
+	}
+	return nil
+}
+
+func (s *RedisInvalidationSource) Close() error {
+	defer closeDiscovery(s.discovery)
+	if s.pubsub != nil {
+		if err := s.pubsub.Close(); err != nil {
+			return fmt.Errorf("error closing Redis pubsub: %w", err)
+		}
+	}
+	if s.subClient != nil {
+		if err := s.subClient.Close(); err != nil {
+			return fmt.Errorf("error closing Redis subscriber client: %w", err)
+		}
+	}
+	if s.trackConn != nil {
+		s.trackMu.Lock()
+		err := s.trackConn.Close()
+		s.trackMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("error closing Redis tracking connection: %w", err)
+		}
+	}
+	if s.client != nil {
+		if err := s.client.Close(); err != nil {
+			return fmt.Errorf("error closing Redis client: %w", err)
+		}
+	}
+	return nil
+}
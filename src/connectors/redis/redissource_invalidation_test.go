@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func TestInvalidationSourceConfig(t *testing.T) {
+	cfg := new(SourceConfig)
+	err := utils.ParseConfig(map[string]any{
+		"address": "localhost:6379",
+		"invalidation": map[string]any{
+			"enabled":  true,
+			"prefixes": []any{"user:", "session:"},
+		},
+	}, cfg)
+	if err != nil {
+		t.Fatalf("ParseConfig returned error: %v", err)
+	}
+
+	source, err := NewSource(cfg)
+	if err != nil {
+		t.Fatalf(errFmtNewSource, err)
+	}
+	if _, ok := source.(*RedisInvalidationSource); !ok {
+		t.Fatalf("expected RedisInvalidationSource, got %T", source)
+	}
+
+	cfg.Invalidation.Prefixes = []string{"bad prefix"}
+	if _, err := NewSource(cfg); err == nil {
+		t.Fatal("expected error for invalid tracking prefix")
+	}
+}
+
+func TestTrackingArgs(t *testing.T) {
+	got := trackingArgs(42, []string{"user:", "session:"})
+	want := []any{"CLIENT", "TRACKING", "ON", "REDIRECT", int64(42), "BCAST", "PREFIX", "user:", "PREFIX", "session:"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected tracking args: %v", got)
+	}
+}
+
+func TestInvalidatedKeys(t *testing.T) {
+	keys := invalidatedKeys(&redis.Message{Channel: invalidationChannel, PayloadSlice: []string{"user:1", "user:2"}})
+	if !reflect.DeepEqual(keys, []string{"user:1", "user:2"}) {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	if keys := invalidatedKeys(&redis.Message{Channel: invalidationChannel}); keys != nil {
+		t.Fatalf("expected no keys, got %v", keys)
+	}
+
+	msg := &RedisInvalidationMessage{key: "user:1"}
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		t.Fatalf(errFmtGetMetadata, err)
+	}
+	if meta["key"] != "user:1" || meta["event"] != "invalidate" {
+		t.Fatalf("unexpected metadata: %v", meta)
+	}
+	data, err := msg.GetData()
+	if err != nil {
+		t.Fatalf(errFmtGetData, err)
+	}
+	if string(data) != "user:1" {
+		t.Fatalf("unexpected data: %s", data)
+	}
+}
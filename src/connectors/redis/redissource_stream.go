@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/sandrolain/events-bridge/src/common/discovery"
 	"github.com/sandrolain/events-bridge/src/common/secrets"
 	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/message"
@@ -60,7 +62,12 @@ func validateStreamConfig(cfg *SourceConfig) error {
 	return nil
 }
 
+// Ensure RedisStreamSource implements connectors.StatusReporter
+var _ connectors.StatusReporter = &RedisStreamSource{}
+
 type RedisStreamSource struct {
+	connectors.StatusTracker
+
 	config         *SourceConfig
 	slog           *slog.Logger
 	c              chan *message.RunnerMessage
@@ -69,6 +76,7 @@ type RedisStreamSource struct {
 	useConsumerGrp bool
 	ctx            context.Context
 	cancel         context.CancelFunc
+	discovery      *discovery.Resolver
 }
 
 func (s *RedisStreamSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
@@ -92,7 +100,12 @@ func (s *RedisStreamSource) Produce(buffer int) (<-chan *message.RunnerMessage,
 		return nil, fmt.Errorf("failed to build Redis options: %w", err)
 	}
 
+	if s.discovery, err = setDiscovery(opts, s.config.Discovery, s.slog); err != nil {
+		return nil, fmt.Errorf("failed to discover Redis endpoints: %w", err)
+	}
+
 	s.client = redis.NewClient(opts)
+	trackStatus(s.client, &s.StatusTracker)
 
 	// Test connection
 	if err := s.client.Ping(s.ctx).Err(); err != nil {
@@ -171,6 +184,7 @@ func (s *RedisStreamSource) consume() {
 				close(s.c)
 				return
 			}
+			s.RecordError(err)
 			s.slog.Error("error reading from Redis stream", "err", err)
 			continue
 		}
@@ -198,6 +212,10 @@ func (s *RedisStreamSource) readAndProcessMessages(stream, dataKey string) error
 		}).Result()
 	}
 
+	if errors.Is(err, redis.Nil) {
+		// No messages within the block time
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -205,6 +223,7 @@ func (s *RedisStreamSource) readAndProcessMessages(stream, dataKey string) error
 	for _, xstream := range res {
 		for _, xmsg := range xstream.Messages {
 			m := &RedisStreamMessage{msg: xmsg, dataKey: dataKey}
+			s.RecordMessage()
 
 			select {
 			case s.c <- message.NewRunnerMessage(m):
@@ -224,6 +243,7 @@ func (s *RedisStreamSource) readAndProcessMessages(stream, dataKey string) error
 }
 
 func (s *RedisStreamSource) Close() error {
+	defer closeDiscovery(s.discovery)
 	// Cancel the context to stop the consumer goroutine
 	if s.cancel != nil {
 		s.cancel()
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/connectors"
+)
+
+// statusHook records the state of the connections of a client in the status of the
+// connector: the clients dial again after a lost connection, Pub/Sub included, so a
+// failed dial reports the connector disconnected and a successful one connected, counted
+// as a reconnection after a failed one
+type statusHook struct {
+	status *connectors.StatusTracker
+	failed atomic.Bool
+}
+
+// trackStatus adds the status hook to a client
+func trackStatus(client *redis.Client, status *connectors.StatusTracker) {
+	client.AddHook(&statusHook{status: status})
+}
+
+func (h *statusHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			h.failed.Store(true)
+			h.status.SetState(connectors.StateDisconnected)
+			h.status.RecordError(err)
+			return nil, err
+		}
+		h.status.SetState(connectors.StateConnected)
+		if h.failed.Swap(false) {
+			metrics.Reconnected("redis")
+		}
+		return conn, nil
+	}
+}
+
+func (h *statusHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h *statusHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
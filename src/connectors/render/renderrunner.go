@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"os"
+	texttemplate "text/template"
+
+	"github.com/sandrolain/events-bridge/src/common/tmplfuncs"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure RenderRunner implements connectors.Runner
+var _ connectors.Runner = &RenderRunner{}
+
+const (
+	formatHTML     = "html"
+	formatMarkdown = "markdown"
+)
+
+// defaultContentTypes are the content types set for the rendered document of each format
+var defaultContentTypes = map[string]string{
+	formatHTML:     "text/html; charset=utf-8",
+	formatMarkdown: "text/markdown; charset=utf-8",
+}
+
+type RunnerConfig struct {
+	// Format is "html" (contextual auto-escaping) or "markdown" (plain text template)
+	Format string `mapstructure:"format" default:"html" validate:"oneof=html markdown"`
+	// Template is the inline Go template, executed with "data" (decoded JSON payload) and "metadata"
+	Template string `mapstructure:"template" validate:"required_without=TemplateFile"`
+	// TemplateFile is the path of the template (alternative to Template)
+	TemplateFile string `mapstructure:"templateFile" validate:"required_without=Template,omitempty,filepath"`
+	// Into is the JSON payload key where the document is stored (empty = replace the payload)
+	Into string `mapstructure:"into"`
+	// ContentTypeKey is the metadata key set to the document content type when it replaces
+	// the payload (empty = disabled). The default is forwarded as header by the HTTP runner.
+	ContentTypeKey string `mapstructure:"contentTypeKey" default:"Content-Type"`
+	// ContentType overrides the content type of the format
+	ContentType string `mapstructure:"contentType"`
+	// MaxInputSize limits the payload size decoded for the template
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+type RenderRunner struct {
+	cfg         *RunnerConfig
+	slog        *slog.Logger
+	execute     func(buf *bytes.Buffer, data any) error
+	contentType string
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a new instance of RenderRunner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	src := cfg.Template
+	if cfg.TemplateFile != "" {
+		content, err := os.ReadFile(cfg.TemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template file: %w", err)
+		}
+		src = string(content)
+	}
+
+	r := &RenderRunner{
+		cfg:         cfg,
+		slog:        slog.Default().With("context", "Render Runner"),
+		contentType: cfg.ContentType,
+	}
+	if r.contentType == "" {
+		r.contentType = defaultContentTypes[cfg.Format]
+	}
+
+	switch cfg.Format {
+	case formatMarkdown:
+		tpl, err := texttemplate.New("render").Option("missingkey=zero").Funcs(tmplfuncs.FuncMap()).Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
+		r.execute = func(buf *bytes.Buffer, data any) error { return tpl.Execute(buf, data) }
+	default:
+		tpl, err := htmltemplate.New("render").Option("missingkey=zero").Funcs(tmplfuncs.FuncMap()).Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
+		r.execute = func(buf *bytes.Buffer, data any) error { return tpl.Execute(buf, data) }
+	}
+
+	r.slog.Info("render runner created", "format", cfg.Format, "into", cfg.Into, "contentType", r.contentType)
+	return r, nil
+}
+
+// Process renders the template with the message and stores the document
+func (r *RenderRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds limit %d", len(data), r.cfg.MaxInputSize)
+	}
+
+	var payload any
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return fmt.Errorf("failed to decode JSON payload: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := r.execute(&buf, map[string]any{"data": payload, "metadata": meta}); err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	if r.cfg.Into == "" {
+		msg.SetData(buf.Bytes())
+	} else {
+		obj, ok := payload.(map[string]any)
+		if !ok {
+			return fmt.Errorf("payload must be a JSON object to store the document into %s", r.cfg.Into)
+		}
+		obj[r.cfg.Into] = buf.String()
+		res, err := json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		msg.SetData(res)
+	}
+
+	if r.cfg.ContentTypeKey != "" && r.cfg.Into == "" {
+		msg.AddMetadata(r.cfg.ContentTypeKey, r.contentType)
+	}
+	return nil
+}
+
+func (r *RenderRunner) Close() error {
+	r.slog.Info("closing render runner")
+	return nil
+}
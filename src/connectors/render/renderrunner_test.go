@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func mustNewRenderRunner(t *testing.T, opts map[string]any) *RenderRunner {
+	t.Helper()
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	return r.(*RenderRunner)
+}
+
+func TestRenderHTMLEscapesPayload(t *testing.T) {
+	r := mustNewRenderRunner(t, map[string]any{
+		"template": `<p>Hello {{ .data.name | title }} from {{ .metadata.source }}: {{ .data.note }}</p>`,
+	})
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"name":"ada","note":"<script>"}`), map[string]string{"source": "orders"}))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	data, _ := msg.GetData()
+	if string(data) != `<p>Hello Ada from orders: &lt;script&gt;</p>` {
+		t.Errorf("unexpected document: %s", data)
+	}
+	meta, _ := msg.GetMetadata()
+	if meta["Content-Type"] != "text/html; charset=utf-8" {
+		t.Errorf("unexpected content type: %q", meta["Content-Type"])
+	}
+}
+
+func TestRenderMarkdownInto(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "alert.md")
+	tpl := "# {{ .data.title }}\n{{ range .data.items }}- {{ . | upper }}\n{{ end }}"
+	if err := os.WriteFile(file, []byte(tpl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mustNewRenderRunner(t, map[string]any{
+		"format":       "markdown",
+		"templateFile": file,
+		"into":         "text",
+	})
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"title":"Disk full","items":["a","b"]}`), nil))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	data, _ := msg.GetData()
+	var res map[string]any
+	if err := json.Unmarshal(data, &res); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if res["text"] != "# Disk full\n- A\n- B\n" || res["title"] != "Disk full" {
+		t.Errorf("unexpected payload: %v", res)
+	}
+	meta, _ := msg.GetMetadata()
+	if _, ok := meta["Content-Type"]; ok {
+		t.Error("content type should not be set when the document is stored into the payload")
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	cfg := new(RunnerConfig)
+	if err := utils.ParseConfig(map[string]any{}, cfg); err == nil {
+		t.Error("expected validation error without template")
+	}
+
+	if err := utils.ParseConfig(map[string]any{"template": "{{ .data"}, cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	if _, err := NewRunner(cfg); err == nil {
+		t.Error("expected template parse error")
+	}
+
+	if err := utils.ParseConfig(map[string]any{"template": `{{ env "HOME" }}`}, cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	if _, err := NewRunner(cfg); err == nil || !strings.Contains(err.Error(), "env") {
+		t.Errorf("expected env function to be unavailable, got %v", err)
+	}
+
+	r := mustNewRenderRunner(t, map[string]any{"template": "{{ .data }}", "into": "doc"})
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`not json`), nil))
+	if err := r.Process(msg); err == nil {
+		t.Error("expected error for non JSON payload")
+	}
+	msg = message.NewRunnerMessage(testutil.NewAdapter([]byte(`[1,2]`), nil))
+	if err := r.Process(msg); err == nil {
+		t.Error("expected error storing into a non object payload")
+	}
+}
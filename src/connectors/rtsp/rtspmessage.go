@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"image/jpeg"
+	"strconv"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &FrameMessage{}
+
+// FrameMessage is a JPEG frame sampled from the stream. A live stream can't redeliver
+// a frame, so its ack and nak do nothing.
+type FrameMessage struct {
+	frame    []byte
+	metadata map[string]string
+}
+
+func newFrameMessage(frame []byte, sequence uint64, camera string, t time.Time) *FrameMessage {
+	metadata := map[string]string{
+		"contentType": "image/jpeg",
+		"sequence":    strconv.FormatUint(sequence, 10),
+		"timestamp":   t.UTC().Format(time.RFC3339Nano),
+	}
+	if camera != "" {
+		metadata["camera"] = camera
+	}
+	if cfg, err := jpeg.DecodeConfig(bytes.NewReader(frame)); err == nil {
+		metadata["width"] = strconv.Itoa(cfg.Width)
+		metadata["height"] = strconv.Itoa(cfg.Height)
+	}
+	return &FrameMessage{frame: frame, metadata: metadata}
+}
+
+func (m *FrameMessage) GetID() []byte {
+	return []byte(m.metadata["sequence"])
+}
+
+func (m *FrameMessage) GetMetadata() (map[string]string, error) {
+	return m.metadata, nil
+}
+
+func (m *FrameMessage) GetData() ([]byte, error) {
+	return m.frame, nil
+}
+
+func (m *FrameMessage) Ack(data *message.ReplyData) error {
+	// The stream doesn't support reply
+	return nil
+}
+
+func (m *FrameMessage) Nak() error {
+	return nil
+}
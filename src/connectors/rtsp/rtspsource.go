@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var (
+	// jpegStart and jpegEnd are the start and end of image markers of a JPEG frame
+	jpegStart = []byte{0xFF, 0xD8}
+	jpegEnd   = []byte{0xFF, 0xD9}
+)
+
+// SourceConfig defines the configuration for the RTSP source connector.
+// Frames are sampled from the stream by ffmpeg and emitted as JPEG images.
+type SourceConfig struct {
+	// URL is the RTSP stream (rtsp:// or rtsps://), credentials included
+	URL string `mapstructure:"url" validate:"required"`
+	// Command is the ffmpeg executable
+	Command string `mapstructure:"command" default:"ffmpeg" validate:"required"`
+	// Transport is the RTP transport: "tcp" (interleaved in the RTSP connection) or "udp"
+	Transport string `mapstructure:"transport" default:"tcp" validate:"oneof=tcp udp"`
+	// FPS is the rate of the sampled frames, e.g. 0.2 for a frame every 5 seconds
+	FPS float64 `mapstructure:"fps" default:"1" validate:"gt=0,lte=60"`
+	// Width scales the frames to a width in pixels, keeping the aspect ratio (0 = original size)
+	Width int `mapstructure:"width" validate:"min=0"`
+	// Quality is the JPEG quality scale, from 2 (best) to 31 (smallest)
+	Quality int `mapstructure:"quality" default:"5" validate:"min=2,max=31"`
+	// Camera is set in the camera metadata of the frames, e.g. to tell apart several sources
+	Camera string `mapstructure:"camera"`
+	// DropWhenBusy drops the frames while the pipeline is busy instead of waiting, so that
+	// the emitted frames are always the latest ones
+	DropWhenBusy bool `mapstructure:"dropWhenBusy" default:"true"`
+	// Timeout is the connection and read timeout of the stream
+	Timeout time.Duration `mapstructure:"timeout" default:"10s" validate:"gt=0"`
+	// RestartDelay is the wait before connecting again after the stream ends or fails
+	RestartDelay time.Duration `mapstructure:"restartDelay" default:"5s" validate:"gt=0"`
+	// MaxFrameSize is the maximum size in bytes of a JPEG frame
+	MaxFrameSize int `mapstructure:"maxFrameSize" default:"10485760" validate:"gt=0"`
+}
+
+type RTSPSource struct {
+	connectors.StatusTracker
+
+	cfg  *SourceConfig
+	slog *slog.Logger
+	// stream is the URL of the stream without its credentials, for the logs
+	stream   string
+	sequence uint64
+	dropped  uint64
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	c        chan *message.RunnerMessage
+}
+
+func NewSourceConfig() any {
+	return new(SourceConfig)
+}
+
+// NewSource creates an RTSP source from config
+func NewSource(anyCfg any) (connectors.Source, error) {
+	cfg, ok := anyCfg.(*SourceConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "rtsp" && u.Scheme != "rtsps") || u.Host == "" {
+		return nil, errors.New("invalid url: expected rtsp://host/path or rtsps://host/path")
+	}
+
+	return &RTSPSource{
+		cfg:    cfg,
+		slog:   slog.Default().With("context", "RTSP Source"),
+		stream: u.Redacted(),
+	}, nil
+}
+
+func (s *RTSPSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	if s.c != nil {
+		return nil, errors.New("produce already called")
+	}
+	if _, err := exec.LookPath(s.cfg.Command); err != nil {
+		return nil, fmt.Errorf("ffmpeg not found: %w", err)
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.c = make(chan *message.RunnerMessage, buffer)
+
+	s.slog.Info("starting RTSP source", "stream", s.stream, "fps", s.cfg.FPS, "width", s.cfg.Width)
+
+	s.wg.Add(1)
+	go s.run()
+	return s.c, nil
+}
+
+// args returns the ffmpeg arguments, writing the sampled frames as concatenated JPEG
+// images to the standard output
+func (s *RTSPSource) args() []string {
+	filter := "fps=" + strconv.FormatFloat(s.cfg.FPS, 'f', -1, 64)
+	if s.cfg.Width > 0 {
+		filter += ",scale=" + strconv.Itoa(s.cfg.Width) + ":-2"
+	}
+	return []string{
+		"-hide_banner", "-nostdin", "-loglevel", "error",
+		"-rtsp_transport", s.cfg.Transport,
+		"-timeout", strconv.FormatInt(s.cfg.Timeout.Microseconds(), 10),
+		"-i", s.cfg.URL,
+		"-an", "-vf", filter,
+		"-c:v", "mjpeg", "-q:v", strconv.Itoa(s.cfg.Quality),
+		"-f", "image2pipe", "-",
+	}
+}
+
+// run reads the stream, connecting again when it ends
+func (s *RTSPSource) run() {
+	defer s.wg.Done()
+	for {
+		err := s.read()
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.SetState(connectors.StateDisconnected)
+		s.RecordError(err)
+		s.slog.Error("RTSP stream ended, reconnecting", "stream", s.stream, "error", err, "delay", s.cfg.RestartDelay)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(s.cfg.RestartDelay):
+		}
+	}
+}
+
+// read runs ffmpeg and emits the frames until the stream ends
+func (s *RTSPSource) read() error {
+	s.SetState(connectors.StateConnecting)
+	cmd := exec.CommandContext(s.ctx, s.cfg.Command, s.args()...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdout: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stderr: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	go s.logStderr(stderr)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 256*1024), s.cfg.MaxFrameSize)
+	scanner.Split(splitJPEG)
+	for scanner.Scan() {
+		s.SetState(connectors.StateConnected)
+		s.RecordMessage()
+		s.sequence++
+		frame := bytes.Clone(scanner.Bytes())
+		msg := message.NewRunnerMessage(newFrameMessage(frame, s.sequence, s.cfg.Camera, time.Now()))
+		if s.cfg.DropWhenBusy {
+			select {
+			case s.c <- msg:
+			default:
+				s.dropped++
+				s.slog.Debug("pipeline busy, frame dropped", "sequence", s.sequence, "dropped", s.dropped)
+			}
+			continue
+		}
+		select {
+		case s.c <- msg:
+		case <-s.ctx.Done():
+			return cmd.Wait()
+		}
+	}
+
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		_ = cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+	if scanErr != nil {
+		return fmt.Errorf("error reading frames: %w", scanErr)
+	}
+	if waitErr != nil {
+		return waitErr
+	}
+	return errors.New("ffmpeg exited")
+}
+
+// splitJPEG is a bufio.SplitFunc returning the JPEG images of a stream, from the start to
+// the end of image marker. The bytes before a start marker are skipped.
+func splitJPEG(data []byte, atEOF bool) (int, []byte, error) {
+	start := bytes.Index(data, jpegStart)
+	if start < 0 {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		// The last byte may be the first one of a start marker
+		return len(data) - 1, nil, nil
+	}
+	end := bytes.Index(data[start+len(jpegStart):], jpegEnd)
+	if end < 0 {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		return start, nil, nil
+	}
+	end += start + len(jpegStart) + len(jpegEnd)
+	return end, data[start:end], nil
+}
+
+func (s *RTSPSource) logStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// ffmpeg reports the errors with the stream URL, credentials included
+		line := strings.ReplaceAll(scanner.Text(), s.cfg.URL, s.stream)
+		s.slog.Warn("ffmpeg", "stream", s.stream, "stderr", line)
+	}
+}
+
+func (s *RTSPSource) Close() error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	s.wg.Wait()
+	close(s.c)
+	s.cancel = nil
+	return nil
+}
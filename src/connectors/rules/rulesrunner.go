@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/sandrolain/events-bridge/src/common"
+	"github.com/sandrolain/events-bridge/src/common/expreval"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure RulesRunner implements connectors.Runner
+var _ connectors.Runner = &RulesRunner{}
+
+const (
+	modeFirst = "first"
+	modeAll   = "all"
+)
+
+// Rule is a condition→action entry of the rules runner
+type Rule struct {
+	// Name identifies the rule in logs and in the matched rules metadata
+	Name string `mapstructure:"name"`
+	// When is an expr condition evaluated against "metadata" and "data" (empty = always match)
+	When string `mapstructure:"when"`
+	// Set adds or replaces metadata entries
+	Set map[string]string `mapstructure:"set"`
+	// Remove deletes metadata entries
+	Remove []string `mapstructure:"remove"`
+	// Priority sets the priority metadata entry
+	Priority string `mapstructure:"priority"`
+	// RoutingKey sets the routing key metadata entry, read by targets through their *FromMetadataKey options
+	RoutingKey string `mapstructure:"routingKey"`
+}
+
+type RunnerConfig struct {
+	// Mode is "first" (stop at the first matching rule) or "all" (apply every matching rule in order)
+	Mode string `mapstructure:"mode" default:"first" validate:"oneof=first all"`
+	// Rules are evaluated in order
+	Rules []Rule `mapstructure:"rules" validate:"required,min=1,dive"`
+	// PriorityKey is the metadata key written by the rule priority action
+	PriorityKey string `mapstructure:"priorityKey" default:"eb-priority" validate:"required"`
+	// RoutingKeyKey is the metadata key written by the rule routingKey action
+	RoutingKeyKey string `mapstructure:"routingKeyKey" default:"eb-routing-key" validate:"required"`
+	// MatchedKey is the metadata key listing the names of the matched rules (empty = disabled)
+	MatchedKey string `mapstructure:"matchedKey" default:"eb-rules-matched"`
+	// MaxInputSize limits the payload size parsed for conditions on data
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+// compiledRule is a rule with its compiled condition
+type compiledRule struct {
+	Rule
+	eval *expreval.ExprEvaluator
+}
+
+type RulesRunner struct {
+	cfg   *RunnerConfig
+	slog  *slog.Logger
+	rules []compiledRule
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a new instance of RulesRunner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	log := slog.Default().With("context", "Rules Runner")
+	log.Info("loading rules", "count", len(cfg.Rules), "mode", cfg.Mode)
+
+	rules := make([]compiledRule, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i)
+		}
+		eval, err := expreval.NewExprEvaluator(rule.When)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition for rule %s: %w", rule.Name, err)
+		}
+		rules[i] = compiledRule{Rule: rule, eval: eval}
+	}
+
+	return &RulesRunner{
+		cfg:   cfg,
+		slog:  log,
+		rules: rules,
+	}, nil
+}
+
+// Process evaluates the rules in order and applies the actions of the matching ones
+func (r *RulesRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	// Actions are applied on a copy, so that the following conditions see the
+	// changes of the previous rules and the message is updated only once
+	metadata := common.CopyMap(meta, nil)
+
+	input := map[string]any{
+		"metadata": metadata,
+		"data":     r.parseData(data),
+	}
+
+	var matched []string
+	for _, rule := range r.rules {
+		if rule.eval != nil {
+			pass, err := rule.eval.Eval(input)
+			if err != nil {
+				return fmt.Errorf("failed to evaluate rule %s: %w", rule.Name, err)
+			}
+			if !pass {
+				continue
+			}
+		}
+
+		r.apply(metadata, rule.Rule)
+		matched = append(matched, rule.Name)
+		r.slog.Debug("rule matched", "rule", rule.Name)
+
+		if r.cfg.Mode == modeFirst {
+			break
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil
+	}
+
+	if r.cfg.MatchedKey != "" {
+		names, err := json.Marshal(matched)
+		if err != nil {
+			return fmt.Errorf("failed to marshal matched rules: %w", err)
+		}
+		metadata[r.cfg.MatchedKey] = string(names)
+	}
+
+	msg.SetMetadata(metadata)
+	return nil
+}
+
+// apply executes the actions of a rule on the metadata
+func (r *RulesRunner) apply(metadata map[string]string, rule Rule) {
+	for _, key := range rule.Remove {
+		delete(metadata, key)
+	}
+	for key, value := range rule.Set {
+		metadata[key] = value
+	}
+	if rule.Priority != "" {
+		metadata[r.cfg.PriorityKey] = rule.Priority
+	}
+	if rule.RoutingKey != "" {
+		metadata[r.cfg.RoutingKeyKey] = rule.RoutingKey
+	}
+}
+
+// parseData decodes a JSON payload for conditions on data.
+// Non-JSON or oversized payloads are exposed as an empty object.
+func (r *RulesRunner) parseData(data []byte) any {
+	empty := map[string]any{}
+	if len(data) == 0 || (r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize) {
+		return empty
+	}
+	var res any
+	if err := json.Unmarshal(data, &res); err != nil {
+		return empty
+	}
+	return res
+}
+
+func (r *RulesRunner) Close() error {
+	r.slog.Info("closing rules runner")
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+var testRules = []Rule{
+	{
+		Name:       "critical",
+		When:       `data.level == "critical"`,
+		Priority:   "high",
+		RoutingKey: "alerts.critical",
+		Set:        map[string]string{"team": "oncall"},
+	},
+	{
+		Name:   "internal",
+		When:   `metadata.source == "internal"`,
+		Remove: []string{"secret"},
+		Set:    map[string]string{"team": "platform"},
+	},
+}
+
+func TestRulesRunnerProcess(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *RunnerConfig
+		data string
+		meta map[string]string
+		want map[string]string
+	}{
+		{
+			name: "first match",
+			cfg:  &RunnerConfig{Mode: modeFirst, Rules: testRules, PriorityKey: "eb-priority", RoutingKeyKey: "eb-routing-key", MatchedKey: "eb-rules-matched"},
+			data: `{"level":"critical"}`,
+			meta: map[string]string{"source": "internal", "secret": "x"},
+			want: map[string]string{
+				"source": "internal", "secret": "x", "team": "oncall",
+				"eb-priority": "high", "eb-routing-key": "alerts.critical", "eb-rules-matched": `["critical"]`,
+			},
+		},
+		{
+			name: "all match, the last matching rule wins",
+			cfg:  &RunnerConfig{Mode: modeAll, Rules: testRules, PriorityKey: "eb-priority", RoutingKeyKey: "eb-routing-key", MatchedKey: "eb-rules-matched"},
+			data: `{"level":"critical"}`,
+			meta: map[string]string{"source": "internal", "secret": "x"},
+			want: map[string]string{
+				"source": "internal", "team": "platform",
+				"eb-priority": "high", "eb-routing-key": "alerts.critical", "eb-rules-matched": `["critical","internal"]`,
+			},
+		},
+		{
+			name: "no match",
+			cfg:  &RunnerConfig{Mode: modeFirst, Rules: testRules, PriorityKey: "eb-priority", RoutingKeyKey: "eb-routing-key", MatchedKey: "eb-rules-matched"},
+			data: "not json",
+			meta: map[string]string{"source": "external"},
+			want: map[string]string{"source": "external"},
+		},
+		{
+			name: "rules see the previous actions",
+			cfg: &RunnerConfig{Mode: modeAll, PriorityKey: "eb-priority", RoutingKeyKey: "eb-routing-key", Rules: []Rule{
+				{Set: map[string]string{"stage": "tagged"}},
+				{When: `metadata.stage == "tagged"`, Priority: "low"},
+			}},
+			data: `{}`,
+			want: map[string]string{"stage": "tagged", "eb-priority": "low"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(tt.cfg)
+			if err != nil {
+				t.Fatalf("failed to create runner: %v", err)
+			}
+			msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(tt.data), tt.meta))
+			if err := runner.Process(msg); err != nil {
+				t.Fatalf("process failed: %v", err)
+			}
+			meta, err := msg.GetMetadata()
+			if err != nil {
+				t.Fatalf("failed to get metadata: %v", err)
+			}
+			if !reflect.DeepEqual(meta, tt.want) {
+				t.Errorf("metadata = %v, want %v", meta, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesInvalidConfig(t *testing.T) {
+	rules := []any{map[string]any{"name": "critical", "when": `data.level == "critical"`}}
+	if err := utils.ParseConfig(map[string]any{"mode": "any", "rules": rules}, new(RunnerConfig)); err == nil {
+		t.Error("expected validation error for invalid mode")
+	}
+	if err := utils.ParseConfig(map[string]any{}, new(RunnerConfig)); err == nil {
+		t.Error("expected validation error for missing rules")
+	}
+
+	_, err := NewRunner(&RunnerConfig{Mode: modeFirst, Rules: []Rule{{When: "metadata.("}}})
+	if err == nil {
+		t.Error("expected error for invalid condition")
+	}
+	if _, err := NewRunner(struct{}{}); err == nil {
+		t.Error("expected error for invalid config type")
+	}
+}
@@ -1,21 +1,151 @@
 package connectors
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/sandrolain/events-bridge/src/message"
 )
 
 const NewRunnerMethodName = "NewRunner"
 const NewRunnerConfigName = "NewRunnerConfig"
 
+// RunnerConfigMigrationsName is the optional plugin function, of type
+// func() []configmigrate.Migration, upgrading the runner options of older config versions
+const RunnerConfigMigrationsName = "RunnerConfigMigrations"
+
 type Runner interface {
 	Process(*message.RunnerMessage) error
 	Close() error
 }
 
+// LifecycleRunner is optionally implemented by runners that prepare resources before
+// the first message (e.g., warm up pools, load models) or flush internal state on shutdown.
+type LifecycleRunner interface {
+	Runner
+	// Start is called before the source starts producing messages; an error aborts the pipeline start
+	Start(ctx context.Context) error
+	// Drain is called on shutdown once the in-flight messages are settled, before Close
+	Drain(ctx context.Context) error
+}
+
+// RetryAfterError is returned by runners when the upstream asks to slow down, e.g. an HTTP
+// 429 or 503 response with Retry-After. The bridge pauses the runner for Delay, so that the
+// whole pipeline slows down to the advertised rate instead of retrying message by message.
+type RetryAfterError struct {
+	Delay time.Duration
+	Err   error
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.Delay)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports that the message can be processed again once the delay has elapsed
+func (e *RetryAfterError) Retryable() bool {
+	return true
+}
+
+// RetryAfter returns the delay advertised by the upstream in the error chain, if any
+func RetryAfter(err error) (time.Duration, bool) {
+	var ra *RetryAfterError
+	if errors.As(err, &ra) && ra.Delay > 0 {
+		return ra.Delay, true
+	}
+	return 0, false
+}
+
+// NakError is returned by runners to give a failed message back to the source for a
+// redelivery instead of publishing it to the dead-letter target, e.g. on a temporary failure
+// of the upstream. The retry policy of the runner applies first.
+type NakError struct {
+	Err error
+}
+
+func (e *NakError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NakError) Unwrap() error {
+	return e.Err
+}
+
+// Nak reports whether a runner asked to nak the failed message in the error chain
+func Nak(err error) bool {
+	var ne *NakError
+	return errors.As(err, &ne)
+}
+
 type RunnerConfig struct {
 	Type       string         `yaml:"type" json:"type"`
 	Routines   int            `yaml:"routines" json:"routines" validate:"omitempty,min=1"`
 	Options    map[string]any `yaml:"options" json:"options"`
 	IfExpr     string         `yaml:"ifExpr" json:"ifExpr" validate:"omitempty"`
 	FilterExpr string         `yaml:"filterExpr" json:"filterExpr" validate:"omitempty"`
+	// PayloadLimit bounds the payload size handed to the runner, overriding the global payloadLimit.
+	// A maxSize of 0 disables the global limit for this runner.
+	PayloadLimit *PayloadLimitConfig `yaml:"payloadLimit" json:"payloadLimit"`
+	// MaxRetryAfter caps the pause of the runner when it reports a retry-after hint of the
+	// upstream (default: 1m)
+	MaxRetryAfter time.Duration `yaml:"maxRetryAfter" json:"maxRetryAfter" validate:"min=0"`
+	// Retry processes the message again with exponential backoff when the runner fails
+	Retry *RetryConfig `yaml:"retry" json:"retry"`
+	// Throttle caps the rate of the messages handed to the runner
+	Throttle *ThrottleConfig `yaml:"throttle" json:"throttle"`
+}
+
+// ThrottleConfig caps the rate of the messages handed to a runner with a token bucket,
+// e.g. to protect a slow downstream target.
+type ThrottleConfig struct {
+	// Rate is the number of messages per second
+	Rate float64 `yaml:"rate" json:"rate" validate:"required,gt=0"`
+	// Burst is the number of messages admitted at once after an idle period (default: 1)
+	Burst int `yaml:"burst" json:"burst" validate:"min=0"`
+	// KeyFrom is the metadata key of the throttling key: every key has its own rate, the
+	// messages without the key sharing one
+	KeyFrom string `yaml:"keyFrom" json:"keyFrom"`
+	// MaxKeys bounds the tracked keys, the least recently used being forgotten (default: 10000)
+	MaxKeys int `yaml:"maxKeys" json:"maxKeys" validate:"min=0"`
+	// Overflow is applied to the messages over the rate: "block" (default, the message waits
+	// for its turn, slowing down the source), "drop" (the message is acked without being
+	// processed) or "nak" (the message is naked)
+	Overflow string `yaml:"overflow" json:"overflow" validate:"omitempty,oneof=block drop nak"`
+}
+
+// RetryConfig retries a failed processing before the message fails, so that transient
+// failures of a target do not lose events. Every attempt runs on a copy of the message.
+// Without RetryOn and RetryCodes, every error is retried except the ones reporting that
+// a retry cannot succeed (e.g. an HTTP 400).
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts, the first one included
+	MaxAttempts int `yaml:"maxAttempts" json:"maxAttempts" validate:"required,min=1"`
+	// Backoff is the wait before the first retry (default: 100ms)
+	Backoff time.Duration `yaml:"backoff" json:"backoff" validate:"min=0"`
+	// Multiplier grows the wait on every retry (default: 2)
+	Multiplier float64 `yaml:"multiplier" json:"multiplier" validate:"omitempty,gte=1"`
+	// MaxBackoff caps the wait between attempts (default: 30s)
+	MaxBackoff time.Duration `yaml:"maxBackoff" json:"maxBackoff" validate:"min=0"`
+	// Jitter randomizes every wait by up to this fraction of it (0-1)
+	Jitter float64 `yaml:"jitter" json:"jitter" validate:"min=0,max=1"`
+	// RetryOn are regular expressions matching the messages of the retried errors
+	RetryOn []string `yaml:"retryOn" json:"retryOn"`
+	// RetryCodes are the codes of the retried errors (e.g. "http_503")
+	RetryCodes []string `yaml:"retryCodes" json:"retryCodes"`
+}
+
+// PayloadLimitConfig bounds the payload size of the messages handed to a runner,
+// e.g. to fit the message size limit of the broker written by a target.
+type PayloadLimitConfig struct {
+	// MaxSize is the maximum payload size in bytes (0 = unlimited)
+	MaxSize int `yaml:"maxSize" json:"maxSize" validate:"min=0"`
+	// Action is applied to larger payloads: "reject" (default, the message is naked),
+	// "truncate" (the payload is cut and marked in metadata) or "chunk" (the payload is
+	// split into multiple messages with sequence metadata for reassembly)
+	Action string `yaml:"action" json:"action" validate:"omitempty,oneof=reject truncate chunk"`
 }
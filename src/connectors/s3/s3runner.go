@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sandrolain/events-bridge/src/common/awssign"
+	"github.com/sandrolain/events-bridge/src/common/httpretry"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/common/tmplfuncs"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure S3Runner implements connectors.LifecycleRunner and connectors.StatusReporter
+var _ connectors.LifecycleRunner = &S3Runner{}
+var _ connectors.StatusReporter = &S3Runner{}
+
+const (
+	// s3Service is the service name of the signed requests
+	s3Service = "s3"
+
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+
+	// defaultKey is the object key template when none is configured: the prefix, the hour
+	// of the object creation and a random id
+	defaultKey = `{{ .prefix }}{{ date "2006/01/02/15" .time }}/{{ uuidv4 }}`
+)
+
+// extensions are the file extensions added to the keys of the compressed objects
+var extensions = map[string]string{
+	compressionGzip: ".gz",
+	compressionZstd: ".zst",
+}
+
+type RunnerConfig struct {
+	// Bucket is the bucket the objects are written to
+	Bucket string `mapstructure:"bucket" validate:"required"`
+	// Region is the region of the bucket, used to sign the requests
+	Region string `mapstructure:"region" default:"us-east-1" validate:"required"`
+	// Endpoint is the S3 compatible endpoint, e.g. http://minio:9000 (default:
+	// https://s3.<region>.amazonaws.com)
+	Endpoint string `mapstructure:"endpoint" validate:"omitempty,url"`
+	// PathStyle addresses the bucket in the path instead of the host, e.g. for MinIO
+	PathStyle bool `mapstructure:"pathStyle"`
+	// AccessKeyID and SecretAccessKey sign the requests (values support env: and file: secrets);
+	// without them the requests are anonymous
+	AccessKeyID     string `mapstructure:"accessKeyId"`
+	SecretAccessKey string `mapstructure:"secretAccessKey" validate:"required_with=AccessKeyID"` //nolint:gosec // user-configured credential field
+	// SessionToken is the token of temporary credentials; supports secret references (env:, file:)
+	SessionToken string `mapstructure:"sessionToken"` //nolint:gosec // user-configured credential field
+	// Prefix is the Go template (with sprig functions) executed for every message with
+	// "metadata" and "time" (the current time): the messages with the same prefix are
+	// buffered into the same objects
+	Prefix string `mapstructure:"prefix"`
+	// Key is the Go template (with sprig functions) of the object key, executed when the
+	// object is written with "prefix", "time" (the time of its first message), "count" and
+	// "metadata" (of its first message); the extension of the compression is added when missing
+	Key string `mapstructure:"key"`
+	// ContentType is the content type of the objects
+	ContentType string `mapstructure:"contentType" default:"application/octet-stream" validate:"required"`
+	// Compression compresses the objects: "none", "gzip" or "zstd"
+	Compression string `mapstructure:"compression" default:"none" validate:"oneof=none gzip zstd"`
+	// Separator is written between the payloads of an object, e.g. for NDJSON
+	Separator string `mapstructure:"separator" default:"\n"`
+	// MaxMessages is the maximum number of messages of an object
+	MaxMessages int `mapstructure:"maxMessages" default:"100" validate:"min=1"`
+	// MaxBytes is the maximum size of an object before compression
+	MaxBytes int `mapstructure:"maxBytes" default:"5242880" validate:"min=1"` // 5MB default
+	// MaxWait is the maximum time a message waits for its object to fill
+	MaxWait time.Duration `mapstructure:"maxWait" default:"10s" validate:"gt=0"`
+	// Async acknowledges the messages once buffered instead of once their object is written.
+	// WARNING: the messages of failed writes are lost.
+	Async bool `mapstructure:"async" default:"false"`
+	// KeyMetadataKey is the metadata key set to the key of the object of the message, unless Async
+	KeyMetadataKey string `mapstructure:"keyMetadataKey" default:"eb-s3-key"`
+	// PresignMetadataKey is the metadata key set to a presigned download URL of the object
+	// of the message, so that the following runners can deliver a link instead of the
+	// payload; it requires the credentials and can't be used with Async
+	PresignMetadataKey string `mapstructure:"presignMetadataKey"`
+	// PresignPayload replaces the payload of the message with the presigned download URL
+	PresignPayload bool `mapstructure:"presignPayload"`
+	// PresignTTL is the validity of the presigned URLs (at most 7 days)
+	PresignTTL time.Duration `mapstructure:"presignTtl" default:"1h" validate:"gt=0,max=168h"`
+	// PresignEndpoint is the endpoint of the presigned URLs when the clients reach the
+	// storage at another address than Endpoint, e.g. https://files.example.com
+	PresignEndpoint string `mapstructure:"presignEndpoint" validate:"omitempty,url"`
+	// Headers are additional HTTP headers of the uploads, e.g. x-amz-storage-class
+	Headers map[string]string `mapstructure:"headers"`
+	Timeout time.Duration     `mapstructure:"timeout" default:"30s" validate:"gt=0"`
+	TLS     *tlsconfig.Config `mapstructure:"tls"`
+}
+
+// result is the outcome of the write of an object
+type result struct {
+	key string
+	err error
+}
+
+// pending is a payload waiting in an object, with the channel notified of the write result
+type pending struct {
+	data     []byte
+	metadata map[string]string
+	done     chan result
+}
+
+// object holds the pending payloads of a prefix
+type object struct {
+	prefix   string
+	start    time.Time
+	payloads []pending
+	size     int
+	timer    *time.Timer
+}
+
+// S3Runner writes the payloads to objects of an S3 compatible storage, buffering the
+// messages of a prefix into objects by size and time
+type S3Runner struct {
+	cfg      *RunnerConfig
+	slog     *slog.Logger
+	client   *http.Client
+	endpoint *url.URL
+	// presignEndpoint is the endpoint of the presigned URLs, nil when they are disabled
+	presignEndpoint *url.URL
+	creds           awssign.Credentials
+	prefix          *template.Template
+	key             *template.Template
+	now             func() time.Time
+	connectors.StatusTracker
+
+	mu       sync.Mutex
+	objects  map[string]*object
+	buffered int
+	writes   sync.WaitGroup
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates an S3 runner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	r := &S3Runner{
+		cfg:     cfg,
+		slog:    slog.Default().With("context", "S3 Runner"),
+		now:     time.Now,
+		objects: map[string]*object{},
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	var err error
+	if r.endpoint, err = url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+
+	if r.creds.AccessKeyID, err = secrets.Resolve(cfg.AccessKeyID); err != nil {
+		return nil, fmt.Errorf("failed to resolve access key: %w", err)
+	}
+	if r.creds.SecretAccessKey, err = secrets.Resolve(cfg.SecretAccessKey); err != nil {
+		return nil, fmt.Errorf("failed to resolve secret key: %w", err)
+	}
+	if r.creds.SessionToken, err = secrets.Resolve(cfg.SessionToken); err != nil {
+		return nil, fmt.Errorf("failed to resolve session token: %w", err)
+	}
+
+	if cfg.PresignMetadataKey != "" || cfg.PresignPayload {
+		if cfg.Async {
+			return nil, fmt.Errorf("presigned URLs can't be used with async")
+		}
+		if r.creds.AccessKeyID == "" {
+			return nil, fmt.Errorf("presigned URLs require the credentials")
+		}
+		r.presignEndpoint = r.endpoint
+		if cfg.PresignEndpoint != "" {
+			if r.presignEndpoint, err = url.Parse(cfg.PresignEndpoint); err != nil {
+				return nil, fmt.Errorf("invalid presign endpoint: %w", err)
+			}
+		}
+	}
+
+	key := cfg.Key
+	if key == "" {
+		key = defaultKey
+	}
+	if r.key, err = template.New("key").Option("missingkey=zero").Funcs(tmplfuncs.FuncMap()).Parse(key); err != nil {
+		return nil, fmt.Errorf("failed to parse key template: %w", err)
+	}
+	if cfg.Prefix != "" {
+		if r.prefix, err = template.New("prefix").Option("missingkey=zero").Funcs(tmplfuncs.FuncMap()).Parse(cfg.Prefix); err != nil {
+			return nil, fmt.Errorf("failed to parse prefix template: %w", err)
+		}
+	}
+
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	r.client = &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	r.slog.Info("s3 runner created",
+		"endpoint", endpoint,
+		"bucket", cfg.Bucket,
+		"compression", cfg.Compression,
+		"maxMessages", cfg.MaxMessages,
+		"maxWait", cfg.MaxWait,
+		"async", cfg.Async,
+		"presign", r.presignEndpoint != nil,
+	)
+	return r, nil
+}
+
+// Process adds the payload to the object of its prefix. Unless Async is set, it returns
+// once the object is written, with the write error, and sets the object key in the metadata
+// and, when enabled, the presigned download URL of the object.
+func (r *S3Runner) Process(msg *message.RunnerMessage) error {
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	prefix, err := execute(r.prefix, map[string]any{"metadata": metadata, "time": r.now()})
+	if err != nil {
+		return fmt.Errorf("failed to render prefix: %w", err)
+	}
+
+	p := pending{data: data, metadata: metadata}
+	if !r.cfg.Async {
+		p.done = make(chan result, 1)
+	}
+	for _, full := range r.add(prefix, p) {
+		r.write(full)
+	}
+	if p.done == nil {
+		return nil
+	}
+	res := <-p.done
+	if res.err != nil {
+		return res.err
+	}
+	if r.cfg.KeyMetadataKey != "" {
+		msg.AddMetadata(r.cfg.KeyMetadataKey, res.key)
+	}
+	if r.presignEndpoint != nil {
+		signed := r.presign(res.key)
+		if r.cfg.PresignMetadataKey != "" {
+			msg.AddMetadata(r.cfg.PresignMetadataKey, signed)
+		}
+		if r.cfg.PresignPayload {
+			msg.SetData([]byte(signed))
+		}
+	}
+	return nil
+}
+
+// presign returns the presigned download URL of an object, valid for PresignTTL
+func (r *S3Runner) presign(key string) string {
+	return awssign.Presign(r.bucketURL(r.presignEndpoint, key), r.creds, awssign.PresignOptions{
+		Method:      http.MethodGet,
+		Service:     s3Service,
+		Region:      r.cfg.Region,
+		Expires:     r.cfg.PresignTTL,
+		PayloadHash: awssign.UnsignedPayload,
+	}, r.now()).String()
+}
+
+// execute runs the template, returning an empty string without template
+func execute(t *template.Template, vars map[string]any) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// add appends the payload to the object of the prefix, returning the objects to write: the
+// previous object when the payload does not fit in its size, and the object once full
+func (r *S3Runner) add(prefix string, p pending) []*object {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var full []*object
+	o, ok := r.objects[prefix]
+	if ok && o.size+len(r.cfg.Separator)+len(p.data) > r.cfg.MaxBytes {
+		full = append(full, r.detach(o))
+		ok = false
+	}
+	if !ok {
+		o = &object{prefix: prefix, start: r.now()}
+		r.objects[prefix] = o
+		o.timer = time.AfterFunc(r.cfg.MaxWait, func() {
+			if r.take(o) {
+				r.write(o)
+			}
+		})
+	}
+	if len(o.payloads) > 0 {
+		o.size += len(r.cfg.Separator)
+	}
+	o.payloads = append(o.payloads, p)
+	o.size += len(p.data)
+	r.buffered++
+	r.SetLag(int64(r.buffered))
+
+	if len(o.payloads) >= r.cfg.MaxMessages || o.size >= r.cfg.MaxBytes {
+		full = append(full, r.detach(o))
+	}
+	return full
+}
+
+// detach removes the object from the pending objects for its write; the caller holds the lock
+func (r *S3Runner) detach(o *object) *object {
+	o.timer.Stop()
+	delete(r.objects, o.prefix)
+	r.buffered -= len(o.payloads)
+	r.SetLag(int64(r.buffered))
+	r.writes.Add(1)
+	return o
+}
+
+// take removes the object from the pending objects, reporting whether it was still pending
+func (r *S3Runner) take(o *object) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.objects[o.prefix] != o {
+		return false
+	}
+	r.detach(o)
+	return true
+}
+
+// write uploads the object taken from the pending objects and notifies its payloads of the result
+func (r *S3Runner) write(o *object) {
+	defer r.writes.Done()
+
+	key, err := r.upload(o)
+	if err != nil {
+		r.RecordError(err)
+		r.slog.Error("error writing object", "prefix", o.prefix, "messages", len(o.payloads), "error", err)
+	} else {
+		r.RecordMessage()
+		r.slog.Debug("object written", "key", key, "messages", len(o.payloads), "size", o.size)
+	}
+	for _, p := range o.payloads {
+		if p.done != nil {
+			p.done <- result{key: key, err: err}
+		}
+	}
+}
+
+// upload encodes the object and puts it in the bucket, returning its key
+func (r *S3Runner) upload(o *object) (string, error) {
+	key, err := execute(r.key, map[string]any{
+		"prefix":   o.prefix,
+		"time":     o.start,
+		"count":    len(o.payloads),
+		"metadata": o.payloads[0].metadata,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render key: %w", err)
+	}
+	key = strings.TrimPrefix(key, "/")
+	if key == "" {
+		return "", fmt.Errorf("empty object key")
+	}
+	if ext := extensions[r.cfg.Compression]; ext != "" && !strings.HasSuffix(key, ext) {
+		key += ext
+	}
+
+	body, err := r.encode(o)
+	if err != nil {
+		return "", err
+	}
+	return key, r.put(key, body)
+}
+
+// encode joins the payloads of the object and compresses them
+func (r *S3Runner) encode(o *object) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var closer io.Closer
+	switch r.cfg.Compression {
+	case compressionGzip:
+		gz := gzip.NewWriter(&buf)
+		w, closer = gz, gz
+	case compressionZstd:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		w, closer = zw, zw
+	}
+	for i, p := range o.payloads {
+		if i > 0 {
+			if _, err := io.WriteString(w, r.cfg.Separator); err != nil {
+				return nil, fmt.Errorf("failed to encode object: %w", err)
+			}
+		}
+		if _, err := w.Write(p.data); err != nil {
+			return nil, fmt.Errorf("failed to encode object: %w", err)
+		}
+	}
+	if closer != nil {
+		if err := closer.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress object: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// objectURL returns the URL of an object key, in virtual-hosted or path style
+func (r *S3Runner) objectURL(key string) *url.URL {
+	return r.bucketURL(r.endpoint, key)
+}
+
+// bucketURL returns the URL of an object key at the endpoint
+func (r *S3Runner) bucketURL(endpoint *url.URL, key string) *url.URL {
+	u := *endpoint
+	path := "/" + key
+	if r.cfg.PathStyle {
+		path = "/" + r.cfg.Bucket + path
+	} else {
+		u.Host = r.cfg.Bucket + "." + u.Host
+	}
+	u.Path = path
+	u.RawPath = awssign.EscapePath(path)
+	return &u
+}
+
+// put uploads the object
+func (r *S3Runner) put(key string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, r.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range r.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", r.cfg.ContentType)
+	res, err := r.do(req, awssign.PayloadHash(body))
+	if err != nil {
+		return fmt.Errorf("error writing object %s: %w", key, err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode > 299 {
+		err := fmt.Errorf("error writing object %s: status code %d: %s", key, res.StatusCode, httpretry.ErrorBody(res.Body))
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+			if delay, ok := httpretry.ParseRetryAfter(res.Header.Get("Retry-After"), r.now()); ok {
+				return &connectors.RetryAfterError{Delay: delay, Err: err}
+			}
+		}
+		return err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
+
+// do signs and sends the request, recording the state of the connection: the storage is
+// reachable when it responds, whatever the status
+func (r *S3Runner) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	if r.creds.AccessKeyID != "" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+		awssign.SignRequest(req, r.creds, r.cfg.Region, s3Service, payloadHash, r.now())
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		r.SetState(connectors.StateDisconnected)
+		return nil, err
+	}
+	r.SetState(connectors.StateConnected)
+	return res, nil
+}
+
+// Start checks that the storage is reachable with a HEAD request on the bucket. The check
+// only sets the reported state: a bucket not readable with the credentials is not an error.
+func (r *S3Runner) Start(ctx context.Context) error {
+	u := r.objectURL("")
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	res, err := r.do(req, awssign.EmptyPayloadHash)
+	if err != nil {
+		r.RecordError(err)
+		r.slog.Warn("s3 storage not reachable", "bucket", r.cfg.Bucket, "error", err)
+		return nil
+	}
+	_ = res.Body.Close()
+	if res.StatusCode > 299 {
+		r.slog.Warn("s3 bucket check failed", "bucket", r.cfg.Bucket, "status", res.StatusCode)
+	}
+	return nil
+}
+
+// Drain writes the pending objects and waits for the writes in progress
+func (r *S3Runner) Drain(ctx context.Context) error {
+	r.mu.Lock()
+	objects := make([]*object, 0, len(r.objects))
+	for _, o := range r.objects {
+		objects = append(objects, r.detach(o))
+	}
+	r.mu.Unlock()
+	sort.Slice(objects, func(i, j int) bool { return objects[i].prefix < objects[j].prefix })
+
+	for _, o := range objects {
+		r.write(o)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.writes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *S3Runner) Close() error {
+	r.slog.Info("closing s3 runner")
+	if err := r.Drain(context.Background()); err != nil {
+		return err
+	}
+	r.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sandrolain/events-bridge/src/common/awssign"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+// upload is a request received by a test server
+type upload struct {
+	method  string
+	path    string
+	headers http.Header
+	body    []byte
+}
+
+// capture records the requests received by a test server
+type capture struct {
+	mu      sync.Mutex
+	uploads []upload
+}
+
+func (c *capture) puts() []upload {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var puts []upload
+	for _, u := range c.uploads {
+		if u.method == http.MethodPut {
+			puts = append(puts, u)
+		}
+	}
+	return puts
+}
+
+func newTestServer(t *testing.T, status int, headers map[string]string) (*httptest.Server, *capture) {
+	t.Helper()
+	c := &capture{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		c.mu.Lock()
+		c.uploads = append(c.uploads, upload{method: req.Method, path: req.URL.EscapedPath(), headers: req.Header.Clone(), body: body})
+		c.mu.Unlock()
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(status)
+		if status > 299 {
+			_, _ = w.Write([]byte("<Error><Code>SlowDown</Code></Error>"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, c
+}
+
+func newMessage(data string, meta map[string]string) *message.RunnerMessage {
+	return message.NewRunnerMessage(testutil.NewAdapter([]byte(data), meta))
+}
+
+// processAll processes the messages concurrently, returning their errors
+func processAll(r *S3Runner, msgs ...*message.RunnerMessage) []error {
+	errs := make([]error, len(msgs))
+	var wg sync.WaitGroup
+	for i, msg := range msgs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = r.Process(msg)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestS3RunnerConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    map[string]any
+		wantErr bool
+	}{
+		{"valid", map[string]any{"bucket": "archive"}, false},
+		{"missing bucket", map[string]any{}, true},
+		{"secret without access key", map[string]any{"bucket": "archive", "accessKeyId": "AKID"}, true},
+		{"invalid compression", map[string]any{"bucket": "archive", "compression": "brotli"}, true},
+		{"invalid endpoint", map[string]any{"bucket": "archive", "endpoint": "not a url"}, true},
+		{"presign ttl over 7 days", map[string]any{"bucket": "archive", "presignTtl": "169h"}, true},
+		{"invalid presign endpoint", map[string]any{"bucket": "archive", "presignEndpoint": "not a url"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := utils.ParseConfig(tt.opts, new(RunnerConfig))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	for name, cfg := range map[string]*RunnerConfig{
+		"key template": {
+			Bucket: "archive", Region: "us-east-1", Compression: "none", MaxMessages: 1, MaxBytes: 1024,
+			MaxWait: time.Second, PresignTTL: time.Hour, Timeout: time.Second,
+			Key: "{{ .prefix",
+		},
+		"presign without creds": {
+			Bucket: "archive", Region: "us-east-1", Compression: "none", MaxMessages: 1, MaxBytes: 1024,
+			MaxWait: time.Second, PresignTTL: time.Hour, Timeout: time.Second,
+			PresignMetadataKey: "url",
+		},
+		"presign with async": {
+			Bucket: "archive", Region: "us-east-1", Compression: "none", MaxMessages: 1, MaxBytes: 1024,
+			MaxWait: time.Second, PresignTTL: time.Hour, Timeout: time.Second,
+			AccessKeyID: "AKID", SecretAccessKey: "secret", PresignPayload: true, Async: true,
+		},
+	} {
+		if _, err := NewRunner(cfg); err == nil {
+			t.Errorf("NewRunner() expected %s error", name)
+		}
+	}
+}
+
+func TestS3RunnerBuffersByPrefix(t *testing.T) {
+	srv, c := newTestServer(t, http.StatusOK, nil)
+	cfg := &RunnerConfig{
+		Bucket:          "archive",
+		Region:          "us-east-1",
+		Endpoint:        srv.URL,
+		PathStyle:       true,
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		Prefix:          "tenants/{{ .metadata.tenant }}/",
+		Key:             `{{ .prefix }}{{ date "2006/01/02" .time }}/{{ .count }}.ndjson`,
+		ContentType:     "application/x-ndjson",
+		Compression:     "none",
+		Separator:       "\n",
+		MaxMessages:     2,
+		MaxBytes:        1024,
+		MaxWait:         50 * time.Millisecond,
+		KeyMetadataKey:  "eb-s3-key",
+		PresignTTL:      time.Hour,
+		Timeout:         5 * time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*S3Runner)
+	r.now = func() time.Time { return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC) }
+
+	msgs := []*message.RunnerMessage{
+		newMessage(`{"n":1}`, map[string]string{"tenant": "acme"}),
+		newMessage(`{"n":2}`, map[string]string{"tenant": "acme"}),
+		newMessage(`{"n":3}`, map[string]string{"tenant": "globex"}),
+	}
+	for i, err := range processAll(r, msgs...) {
+		if err != nil {
+			t.Fatalf("Process(%d) unexpected error = %v", i, err)
+		}
+	}
+
+	puts := c.puts()
+	if len(puts) != 2 {
+		t.Fatalf("uploads = %d, want 2", len(puts))
+	}
+	objects := map[string]upload{}
+	for _, u := range puts {
+		objects[u.path] = u
+	}
+	acme, ok := objects["/archive/tenants/acme/2024/05/06/2.ndjson"]
+	if !ok {
+		t.Fatalf("acme object missing in %v", objects)
+	}
+	if body := string(acme.body); body != "{\"n\":1}\n{\"n\":2}" && body != "{\"n\":2}\n{\"n\":1}" {
+		t.Errorf("acme body = %q", body)
+	}
+	if got := acme.headers.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if auth := acme.headers.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20240506/us-east-1/s3/aws4_request") {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if got := acme.headers.Get("X-Amz-Content-Sha256"); got != awssign.PayloadHash(acme.body) {
+		t.Errorf("payload hash = %q", got)
+	}
+	if string(objects["/archive/tenants/globex/2024/05/06/1.ndjson"].body) != `{"n":3}` {
+		t.Errorf("globex object missing in %v", objects)
+	}
+
+	meta, _ := msgs[2].GetMetadata()
+	if meta["eb-s3-key"] != "tenants/globex/2024/05/06/1.ndjson" {
+		t.Errorf("key metadata = %q", meta["eb-s3-key"])
+	}
+	status := r.ConnectorStatus()
+	if status.State != connectors.StateConnected || status.LastMessageAt.IsZero() || status.Lag == nil || *status.Lag != 0 {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestS3RunnerMaxBytes(t *testing.T) {
+	srv, c := newTestServer(t, http.StatusOK, nil)
+	cfg := &RunnerConfig{
+		Bucket:      "archive",
+		Region:      "us-east-1",
+		Endpoint:    srv.URL,
+		PathStyle:   true,
+		Compression: "none",
+		Separator:   "\n",
+		MaxMessages: 100,
+		MaxBytes:    10,
+		MaxWait:     50 * time.Millisecond,
+		Async:       true,
+		PresignTTL:  time.Hour,
+		Timeout:     5 * time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*S3Runner)
+	r.now = func() time.Time { return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC) }
+
+	for _, data := range []string{"12345", "6789", "abcdef"} {
+		if err := r.Process(newMessage(data, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	puts := c.puts()
+	if len(puts) != 2 {
+		t.Fatalf("uploads = %d, want 2", len(puts))
+	}
+	var bodies []string
+	for _, u := range puts {
+		bodies = append(bodies, string(u.body))
+		// The default key: the hour of the object and a random id
+		if !strings.HasPrefix(u.path, "/archive/2024/05/06/07/") {
+			t.Errorf("path = %q", u.path)
+		}
+	}
+	if strings.Join(bodies, "|") != "12345\n6789|abcdef" {
+		t.Errorf("bodies = %q", bodies)
+	}
+}
+
+func TestS3RunnerCompression(t *testing.T) {
+	tests := []struct {
+		compression string
+		ext         string
+		decode      func([]byte) ([]byte, error)
+	}{
+		{"gzip", ".gz", func(b []byte) ([]byte, error) {
+			zr, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(zr)
+		}},
+		{"zstd", ".zst", func(b []byte) ([]byte, error) {
+			zr, err := zstd.NewReader(nil)
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+			return zr.DecodeAll(b, nil)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.compression, func(t *testing.T) {
+			srv, c := newTestServer(t, http.StatusOK, nil)
+			cfg := &RunnerConfig{
+				Bucket:      "archive",
+				Region:      "us-east-1",
+				Endpoint:    srv.URL,
+				PathStyle:   true,
+				Key:         "events",
+				Compression: tt.compression,
+				MaxMessages: 1,
+				MaxBytes:    1024,
+				MaxWait:     time.Second,
+				PresignTTL:  time.Hour,
+				Timeout:     5 * time.Second,
+			}
+			r, err := NewRunner(cfg)
+			if err != nil {
+				t.Fatalf("NewRunner() unexpected error = %v", err)
+			}
+			defer func() { _ = r.Close() }()
+			if err := r.Process(newMessage("hello", nil)); err != nil {
+				t.Fatal(err)
+			}
+			puts := c.puts()
+			if len(puts) != 1 || puts[0].path != "/archive/events"+tt.ext {
+				t.Fatalf("uploads = %+v", puts)
+			}
+			data, err := tt.decode(puts[0].body)
+			if err != nil || string(data) != "hello" {
+				t.Errorf("decoded = %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestS3RunnerErrors(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusServiceUnavailable, map[string]string{"Retry-After": "2"})
+	cfg := &RunnerConfig{
+		Bucket:      "archive",
+		Region:      "us-east-1",
+		Endpoint:    srv.URL,
+		PathStyle:   true,
+		Compression: "none",
+		MaxMessages: 1,
+		MaxBytes:    1024,
+		MaxWait:     time.Second,
+		PresignTTL:  time.Hour,
+		Timeout:     5 * time.Second,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	err = r.Process(newMessage("x", nil))
+	var ra *connectors.RetryAfterError
+	if !errors.As(err, &ra) || ra.Delay != 2*time.Second {
+		t.Fatalf("Process() error = %v, want RetryAfterError of 2s", err)
+	}
+	if status := r.(*S3Runner).ConnectorStatus(); status.State != connectors.StateConnected || status.LastError == "" {
+		t.Errorf("status = %+v", status)
+	}
+
+	srv.Close()
+	if err := r.Process(newMessage("x", nil)); err == nil {
+		t.Fatal("Process() expected connection error")
+	}
+	if status := r.(*S3Runner).ConnectorStatus(); status.State != connectors.StateDisconnected {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestS3RunnerObjectURL(t *testing.T) {
+	cfg := &RunnerConfig{
+		Bucket:      "archive",
+		Region:      "eu-west-1",
+		Compression: "none",
+		MaxMessages: 100,
+		MaxBytes:    1024,
+		MaxWait:     time.Second,
+		PresignTTL:  time.Hour,
+		Timeout:     5 * time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*S3Runner)
+	r.now = func() time.Time { return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC) }
+	if got := r.objectURL("logs/a b.json").String(); got != "https://archive.s3.eu-west-1.amazonaws.com/logs/a%20b.json" {
+		t.Errorf("objectURL() = %q", got)
+	}
+}
+
+func TestS3RunnerStart(t *testing.T) {
+	srv, c := newTestServer(t, http.StatusForbidden, nil)
+	cfg := &RunnerConfig{
+		Bucket:      "archive",
+		Region:      "us-east-1",
+		Endpoint:    srv.URL,
+		PathStyle:   true,
+		Compression: "none",
+		MaxMessages: 100,
+		MaxBytes:    1024,
+		MaxWait:     time.Second,
+		PresignTTL:  time.Hour,
+		Timeout:     5 * time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*S3Runner)
+	r.now = func() time.Time { return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC) }
+	if status := r.ConnectorStatus(); status.State != connectors.StateConnecting {
+		t.Errorf("status before start = %+v", status)
+	}
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatalf("Start() unexpected error = %v", err)
+	}
+	if len(c.uploads) != 1 || c.uploads[0].method != http.MethodHead || c.uploads[0].path != "/archive/" {
+		t.Errorf("requests = %+v", c.uploads)
+	}
+	if status := r.ConnectorStatus(); status.State != connectors.StateConnected {
+		t.Errorf("status after start = %+v", status)
+	}
+}
+
+func TestS3RunnerPresign(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusOK, nil)
+	cfg := &RunnerConfig{
+		Bucket:             "archive",
+		Region:             "us-east-1",
+		Endpoint:           srv.URL,
+		PathStyle:          true,
+		AccessKeyID:        "AKID",
+		SecretAccessKey:    "secret",
+		Key:                "reports/{{ .count }}.pdf",
+		Compression:        "none",
+		MaxMessages:        1,
+		MaxBytes:           1024,
+		MaxWait:            time.Second,
+		PresignMetadataKey: "download-url",
+		PresignPayload:     true,
+		PresignTTL:         15 * time.Minute,
+		PresignEndpoint:    "https://files.example.com",
+		Timeout:            5 * time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*S3Runner)
+	r.now = func() time.Time { return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC) }
+
+	msg := newMessage("large attachment", nil)
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := awssign.Presign(r.bucketURL(r.presignEndpoint, "reports/1.pdf"), r.creds, awssign.PresignOptions{
+		Method: http.MethodGet, Service: "s3", Region: "us-east-1", Expires: 15 * time.Minute, PayloadHash: awssign.UnsignedPayload,
+	}, r.now()).String()
+	if meta["download-url"] != want || string(data) != want {
+		t.Errorf("metadata = %q, data = %q, want %q", meta["download-url"], data, want)
+	}
+	if !strings.HasPrefix(want, "https://files.example.com/archive/reports/1.pdf?") || !strings.Contains(want, "X-Amz-Expires=900") {
+		t.Errorf("presigned URL = %q", want)
+	}
+}
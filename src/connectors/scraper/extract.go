@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+)
+
+// SelectorConfig selects the nodes of a page with a CSS selector or an XPath expression
+type SelectorConfig struct {
+	// CSS is a CSS selector (e.g. "article h2 > a")
+	CSS string `mapstructure:"css"`
+	// XPath is an XPath 1.0 expression (e.g. "//article/h2/a/@href")
+	XPath string `mapstructure:"xpath"`
+}
+
+// FieldConfig extracts a field of the JSON payload
+type FieldConfig struct {
+	// Name is the JSON field name
+	Name string `mapstructure:"name" validate:"required"`
+	// CSS or XPath select the nodes of the field; XPath expressions may also return a string,
+	// a number or a boolean (e.g. "count(//li)")
+	SelectorConfig `mapstructure:",squash"`
+	// Attr is the attribute read from the nodes (e.g. "href"); the text content when empty
+	Attr string `mapstructure:"attr"`
+	// Multiple extracts the values of every node as an array instead of the first one
+	Multiple bool `mapstructure:"multiple"`
+}
+
+// selector is a compiled CSS selector or XPath expression
+type selector struct {
+	css   cascadia.Selector
+	xpath *xpath.Expr
+}
+
+func compileSelector(cfg *SelectorConfig) (*selector, error) {
+	switch {
+	case cfg.CSS != "" && cfg.XPath != "":
+		return nil, errors.New("css and xpath are mutually exclusive")
+	case cfg.CSS != "":
+		sel, err := cascadia.Compile(cfg.CSS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid css selector %q: %w", cfg.CSS, err)
+		}
+		return &selector{css: sel}, nil
+	case cfg.XPath != "":
+		expr, err := xpath.Compile(cfg.XPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid xpath expression %q: %w", cfg.XPath, err)
+		}
+		return &selector{xpath: expr}, nil
+	default:
+		return nil, errors.New("css or xpath is required")
+	}
+}
+
+// nodes returns the nodes selected under n
+func (s *selector) nodes(n *html.Node) []*html.Node {
+	if s.css != nil {
+		return cascadia.QueryAll(n, s.css)
+	}
+	return htmlquery.QuerySelectorAll(n, s.xpath)
+}
+
+// field is a compiled FieldConfig
+type field struct {
+	cfg *FieldConfig
+	sel *selector
+}
+
+func compileFields(cfgs []FieldConfig) ([]field, error) {
+	fields := make([]field, len(cfgs))
+	for i := range cfgs {
+		sel, err := compileSelector(&cfgs[i].SelectorConfig)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", cfgs[i].Name, err)
+		}
+		fields[i] = field{cfg: &cfgs[i], sel: sel}
+	}
+	return fields, nil
+}
+
+// value extracts the field under n: the value of the first node (nil if none), the values of
+// every node if multiple, or the result of a non node-set XPath expression
+func (f *field) value(n *html.Node) any {
+	if f.sel.xpath != nil {
+		switch v := f.sel.xpath.Evaluate(htmlquery.CreateXPathNavigator(n)).(type) {
+		case *xpath.NodeIterator:
+		case string:
+			return normalize(v)
+		default:
+			return v
+		}
+	}
+
+	nodes := f.sel.nodes(n)
+	if !f.cfg.Multiple {
+		if len(nodes) == 0 {
+			return nil
+		}
+		return f.text(nodes[0])
+	}
+	values := make([]any, len(nodes))
+	for i, node := range nodes {
+		values[i] = f.text(node)
+	}
+	return values
+}
+
+// text returns the attribute or the whitespace-normalized text content of the node
+func (f *field) text(n *html.Node) string {
+	if f.cfg.Attr != "" {
+		return htmlquery.SelectAttr(n, f.cfg.Attr)
+	}
+	return normalize(htmlquery.InnerText(n))
+}
+
+// normalize collapses the whitespace sequences, as rendered by the browsers
+func normalize(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// extract returns the fields extracted under n
+func extract(n *html.Node, fields []field) map[string]any {
+	res := make(map[string]any, len(fields))
+	for i := range fields {
+		res[fields[i].cfg.Name] = fields[i].value(n)
+	}
+	return res
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &ScraperMessage{}
+
+// ScraperMessage is the data extracted from a page, or from an item of a page
+type ScraperMessage struct {
+	key      string
+	data     []byte
+	metadata map[string]string
+}
+
+func (m *ScraperMessage) GetID() []byte {
+	return []byte(m.key)
+}
+
+func (m *ScraperMessage) GetMetadata() (map[string]string, error) {
+	return m.metadata, nil
+}
+
+func (m *ScraperMessage) GetData() ([]byte, error) {
+	return m.data, nil
+}
+
+func (m *ScraperMessage) Ack(data *message.ReplyData) error {
+	// Scraped pages don't support reply
+	return nil
+}
+
+func (m *ScraperMessage) Nak() error {
+	return nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/statestore"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"golang.org/x/net/html"
+)
+
+const (
+	backendMemory = "memory"
+	backendRedis  = "redis"
+
+	statusNew       = "new"
+	statusChanged   = "changed"
+	statusUnchanged = "unchanged"
+
+	// keyPrefix is the default prefix of the Redis state keys
+	keyPrefix = "eb-scraper:"
+)
+
+// TargetConfig is a scraped page
+type TargetConfig struct {
+	// Name identifies the target in the metadata and the state keys (default: the URL)
+	Name string `mapstructure:"name"`
+	// URL is the page URL
+	URL string `mapstructure:"url" validate:"required,url"`
+	// Headers are additional HTTP headers (values support env: and file: secrets)
+	Headers map[string]string `mapstructure:"headers"`
+	// Items selects repeated elements (e.g. the rows of a table): the fields are extracted
+	// under every item and the payload is an array of objects
+	Items *SelectorConfig `mapstructure:"items"`
+	// ItemKey is the field identifying the items: every item is emitted as its own message,
+	// only when new or changed
+	ItemKey string `mapstructure:"itemKey"`
+	// Fields are the extracted fields
+	Fields []FieldConfig `mapstructure:"fields" validate:"required,min=1,dive"`
+}
+
+type SourceConfig struct {
+	// Targets are the scraped pages
+	Targets []TargetConfig `mapstructure:"targets" validate:"required,min=1,dive"`
+	// Interval is the time between two scrapes of the targets
+	Interval time.Duration `mapstructure:"interval" default:"5m" validate:"min=1s"`
+	// Timeout bounds every page request
+	Timeout time.Duration `mapstructure:"timeout" default:"30s" validate:"gt=0"`
+	// UserAgent is the User-Agent header of the requests
+	UserAgent string            `mapstructure:"userAgent" default:"events-bridge-scraper" validate:"required"`
+	TLS       *tlsconfig.Config `mapstructure:"tls"`
+	// MaxBodySize limits the page size
+	MaxBodySize int64 `mapstructure:"maxBodySize" default:"10485760" validate:"gt=0"` // 10MB default
+	// ChangesOnly emits the extracted data only when it differs from the previous scrape
+	ChangesOnly bool `mapstructure:"changesOnly" default:"true"`
+	// StatusKey is the metadata key set to "new", "changed" or "unchanged"
+	StatusKey string `mapstructure:"statusKey" default:"eb-scraper-status" validate:"required"`
+	// Backend is the store of the previous scrapes: "memory" (default) or "redis", to keep
+	// them across restarts
+	Backend string `mapstructure:"backend" default:"memory" validate:"oneof=memory redis"`
+	// TTL expires the state of the keys not scraped for this long (0 = never), e.g. the
+	// items no longer listed
+	TTL time.Duration `mapstructure:"ttl" default:"0s" validate:"min=0"`
+
+	Memory statestore.MemoryConfig `mapstructure:"memory"`
+	Redis  *statestore.RedisConfig `mapstructure:"redis" validate:"required_if=Backend redis"`
+}
+
+// target is a compiled TargetConfig
+type target struct {
+	cfg     *TargetConfig
+	name    string
+	headers map[string]string
+	items   *selector
+	fields  []field
+}
+
+// ScraperSource fetches web pages on an interval and emits the data extracted with CSS
+// selectors and XPath expressions, for the sites offering no API
+type ScraperSource struct {
+	cfg     *SourceConfig
+	slog    *slog.Logger
+	client  *http.Client
+	store   statestore.Store
+	targets []*target
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	c       chan *message.RunnerMessage
+}
+
+func NewSourceConfig() any {
+	return new(SourceConfig)
+}
+
+// NewSource creates a scraper source
+func NewSource(anyCfg any) (connectors.Source, error) {
+	cfg, ok := anyCfg.(*SourceConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+	}
+
+	var st statestore.Store
+	switch cfg.Backend {
+	case backendMemory:
+		st = statestore.NewMemory(&cfg.Memory, cfg.TTL)
+	case backendRedis:
+		if st, err = statestore.NewRedis(cfg.Redis, cfg.TTL, keyPrefix); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported backend: %s", cfg.Backend)
+	}
+
+	s, err := newScraperSource(cfg, client, st)
+	if err != nil {
+		st.Close() //nolint:errcheck
+		return nil, err
+	}
+	return s, nil
+}
+
+func newScraperSource(cfg *SourceConfig, client *http.Client, st statestore.Store) (*ScraperSource, error) {
+	s := &ScraperSource{
+		cfg:    cfg,
+		slog:   slog.Default().With("context", "Scraper Source"),
+		client: client,
+		store:  st,
+	}
+	for i := range cfg.Targets {
+		t, err := compileTarget(&cfg.Targets[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %s: %w", cfg.Targets[i].URL, err)
+		}
+		s.targets = append(s.targets, t)
+	}
+	return s, nil
+}
+
+func compileTarget(cfg *TargetConfig) (*target, error) {
+	t := &target{
+		cfg:     cfg,
+		name:    cfg.Name,
+		headers: make(map[string]string, len(cfg.Headers)),
+	}
+	if t.name == "" {
+		t.name = cfg.URL
+	}
+
+	var err error
+	for k, v := range cfg.Headers {
+		if t.headers[k], err = secrets.Resolve(v); err != nil {
+			return nil, fmt.Errorf("failed to resolve header %s: %w", k, err)
+		}
+	}
+	if cfg.Items != nil {
+		if t.items, err = compileSelector(cfg.Items); err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+	}
+	if t.fields, err = compileFields(cfg.Fields); err != nil {
+		return nil, err
+	}
+	if cfg.ItemKey != "" {
+		if t.items == nil {
+			return nil, errors.New("itemKey requires items")
+		}
+		found := false
+		for _, f := range cfg.Fields {
+			found = found || f.Name == cfg.ItemKey
+		}
+		if !found {
+			return nil, fmt.Errorf("itemKey %s is not a field", cfg.ItemKey)
+		}
+	}
+	return t, nil
+}
+
+func (s *ScraperSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	if s.c != nil {
+		return nil, errors.New("produce already called")
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.c = make(chan *message.RunnerMessage, buffer)
+
+	s.slog.Info("starting scraper", "targets", len(s.targets), "interval", s.cfg.Interval, "changesOnly", s.cfg.ChangesOnly, "backend", s.cfg.Backend)
+
+	s.wg.Add(1)
+	go s.run()
+	return s.c, nil
+}
+
+// run scrapes the targets immediately and then on every interval
+func (s *ScraperSource) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, t := range s.targets {
+			if err := s.scrape(t); err != nil {
+				if s.ctx.Err() != nil {
+					return
+				}
+				s.slog.Error("scrape failed", "target", t.name, "error", err)
+			}
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scrape fetches the page of the target and emits the extracted data
+func (s *ScraperSource) scrape(t *target) error {
+	status, doc, err := s.fetch(t)
+	if err != nil {
+		return err
+	}
+
+	if t.items == nil {
+		return s.emit(t, t.name, status, extract(doc, t.fields))
+	}
+
+	nodes := t.items.nodes(doc)
+	if t.cfg.ItemKey == "" {
+		items := make([]any, len(nodes))
+		for i, n := range nodes {
+			items[i] = extract(n, t.fields)
+		}
+		return s.emit(t, t.name, status, items)
+	}
+
+	for _, n := range nodes {
+		item := extract(n, t.fields)
+		key := ""
+		if v := item[t.cfg.ItemKey]; v != nil {
+			key = fmt.Sprint(v)
+		}
+		if key == "" {
+			s.slog.Debug("item without key skipped", "target", t.name)
+			continue
+		}
+		if err := s.emit(t, t.name+"#"+key, status, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ScraperSource) fetch(t *target) (int, *html.Node, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.cfg.URL, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", s.cfg.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := s.client.Do(req) //nolint:gosec // user-configured endpoint
+	if err != nil {
+		return 0, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, nil, fmt.Errorf("non-2XX status code: %d", res.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, s.cfg.MaxBodySize+1))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read page: %w", err)
+	}
+	if int64(len(body)) > s.cfg.MaxBodySize {
+		return 0, nil, fmt.Errorf("page size exceeds limit %d", s.cfg.MaxBodySize)
+	}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to parse page: %w", err)
+	}
+	return res.StatusCode, doc, nil
+}
+
+// emit stores the extracted data as the state of the key and produces its message, unless
+// unchanged and only the changes are emitted
+func (s *ScraperSource) emit(t *target, key string, status int, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal extracted data: %w", err)
+	}
+
+	prev, err := s.store.Swap(s.ctx, key, data)
+	if err != nil {
+		return fmt.Errorf("failed to update state: %w", err)
+	}
+	state := statusChanged
+	switch {
+	case prev == nil:
+		state = statusNew
+	case string(prev) == string(data):
+		state = statusUnchanged
+	}
+	if state == statusUnchanged && s.cfg.ChangesOnly {
+		return nil
+	}
+
+	msg := &ScraperMessage{
+		key:  key,
+		data: data,
+		metadata: map[string]string{
+			"target":        t.name,
+			"url":           t.cfg.URL,
+			"status":        strconv.Itoa(status),
+			s.cfg.StatusKey: state,
+		},
+	}
+	select {
+	case s.c <- message.NewRunnerMessage(msg):
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *ScraperSource) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+		s.wg.Wait()
+		close(s.c)
+		s.cancel = nil
+	}
+	s.client.CloseIdleConnections()
+	return s.store.Close()
+}
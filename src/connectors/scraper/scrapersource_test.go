@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/statestore"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+const productPage = `<html><head><title>Shop</title></head><body>
+<h1 class="title">  Spring
+  sale </h1>
+<ul id="products">
+  <li data-sku="a1"><a href="/p/a1">Lamp</a> <span class="price">19.90</span></li>
+  <li data-sku="b2"><a href="/p/b2">Desk</a> <span class="price">%s</span></li>
+  <li><a href="/p/none">No sku</a></li>
+</ul>
+</body></html>`
+
+// page serves the product page, its second price being changed by the test
+type page struct {
+	mu    sync.Mutex
+	price string
+}
+
+func (p *page) set(price string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.price = price
+}
+
+func (p *page) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Token") != "secret" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w.Header().Set("Content-Type", "text/html")
+	_, _ = fmt.Fprintf(w, productPage, p.price)
+}
+
+func newTestSource(t *testing.T, opts map[string]any) *ScraperSource {
+	t.Helper()
+	cfg := new(SourceConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("ParseConfig() unexpected error = %v", err)
+	}
+	s, err := newScraperSource(cfg, http.DefaultClient, statestore.NewMemory(&cfg.Memory, cfg.TTL))
+	if err != nil {
+		t.Fatalf("newScraperSource() unexpected error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// scrapeAll scrapes the targets once, returning the produced messages
+func scrapeAll(t *testing.T, s *ScraperSource) []*message.RunnerMessage {
+	t.Helper()
+	s.ctx = context.Background()
+	s.c = make(chan *message.RunnerMessage, 10)
+	for _, tg := range s.targets {
+		if err := s.scrape(tg); err != nil {
+			t.Fatalf("scrape() unexpected error = %v", err)
+		}
+	}
+	close(s.c)
+	var msgs []*message.RunnerMessage
+	for msg := range s.c {
+		msgs = append(msgs, msg)
+	}
+	s.c = nil
+	return msgs
+}
+
+func decode(t *testing.T, msg *message.RunnerMessage) (map[string]string, any) {
+	t.Helper()
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		t.Fatalf("GetMetadataAndData() unexpected error = %v", err)
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("payload %s: %v", data, err)
+	}
+	return meta, v
+}
+
+func TestScraperFields(t *testing.T) {
+	p := &page{price: "120.00"}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	s := newTestSource(t, map[string]any{
+		"targets": []any{map[string]any{
+			"name":    "shop",
+			"url":     srv.URL,
+			"headers": map[string]any{"X-Token": "secret"},
+			"fields": []any{
+				map[string]any{"name": "title", "css": "h1.title"},
+				map[string]any{"name": "links", "css": "#products a", "attr": "href", "multiple": true},
+				map[string]any{"name": "prices", "xpath": "//span[@class='price']", "multiple": true},
+				map[string]any{"name": "skus", "xpath": "//li/@data-sku", "multiple": true},
+				map[string]any{"name": "count", "xpath": "count(//li)"},
+				map[string]any{"name": "missing", "css": ".missing"},
+			},
+		}},
+	})
+
+	msgs := scrapeAll(t, s)
+	if len(msgs) != 1 {
+		t.Fatalf("messages = %d, want 1", len(msgs))
+	}
+	meta, got := decode(t, msgs[0])
+	want := map[string]any{
+		"title":   "Spring sale",
+		"links":   []any{"/p/a1", "/p/b2", "/p/none"},
+		"prices":  []any{"19.90", "120.00"},
+		"skus":    []any{"a1", "b2"},
+		"count":   float64(3),
+		"missing": nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("payload = %v, want %v", got, want)
+	}
+	if meta["target"] != "shop" || meta["url"] != srv.URL || meta["status"] != "200" || meta["eb-scraper-status"] != "new" {
+		t.Errorf("metadata = %v", meta)
+	}
+
+	// Unchanged pages are not emitted
+	if msgs := scrapeAll(t, s); len(msgs) != 0 {
+		t.Errorf("unchanged page messages = %d, want 0", len(msgs))
+	}
+
+	p.set("99.00")
+	msgs = scrapeAll(t, s)
+	if len(msgs) != 1 {
+		t.Fatalf("changed page messages = %d, want 1", len(msgs))
+	}
+	if meta, _ := decode(t, msgs[0]); meta["eb-scraper-status"] != "changed" {
+		t.Errorf("status = %s, want changed", meta["eb-scraper-status"])
+	}
+}
+
+func TestScraperItems(t *testing.T) {
+	p := &page{price: "120.00"}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	fields := []any{
+		map[string]any{"name": "sku", "xpath": "@data-sku"},
+		map[string]any{"name": "name", "css": "a"},
+		map[string]any{"name": "price", "css": ".price"},
+	}
+	s := newTestSource(t, map[string]any{
+		"changesOnly": false,
+		"targets": []any{
+			map[string]any{"name": "list", "url": srv.URL, "headers": map[string]any{"X-Token": "secret"}, "items": map[string]any{"css": "#products li"}, "fields": fields},
+		},
+	})
+	msgs := scrapeAll(t, s)
+	if len(msgs) != 1 {
+		t.Fatalf("messages = %d, want 1", len(msgs))
+	}
+	_, got := decode(t, msgs[0])
+	want := []any{
+		map[string]any{"sku": "a1", "name": "Lamp", "price": "19.90"},
+		map[string]any{"sku": "b2", "name": "Desk", "price": "120.00"},
+		map[string]any{"sku": nil, "name": "No sku", "price": nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("payload = %v, want %v", got, want)
+	}
+	// Without changesOnly the unchanged pages are emitted too
+	msgs = scrapeAll(t, s)
+	if len(msgs) != 1 {
+		t.Fatalf("unchanged page messages = %d, want 1", len(msgs))
+	}
+	if meta, _ := decode(t, msgs[0]); meta["eb-scraper-status"] != "unchanged" {
+		t.Errorf("status = %s, want unchanged", meta["eb-scraper-status"])
+	}
+
+	// With an item key every item is a message, emitted when new or changed
+	s = newTestSource(t, map[string]any{
+		"targets": []any{
+			map[string]any{"name": "list", "url": srv.URL, "headers": map[string]any{"X-Token": "secret"}, "items": map[string]any{"css": "#products li"}, "itemKey": "sku", "fields": fields},
+		},
+	})
+	if msgs := scrapeAll(t, s); len(msgs) != 2 {
+		t.Fatalf("item messages = %d, want 2", len(msgs))
+	}
+	p.set("99.00")
+	msgs = scrapeAll(t, s)
+	if len(msgs) != 1 {
+		t.Fatalf("changed item messages = %d, want 1", len(msgs))
+	}
+	meta, item := decode(t, msgs[0])
+	if item.(map[string]any)["price"] != "99.00" || meta["eb-scraper-status"] != "changed" || string(msgs[0].GetID()) != "list#b2" {
+		t.Errorf("changed item = %v %v %s", item, meta, msgs[0].GetID())
+	}
+}
+
+func TestScraperProduce(t *testing.T) {
+	srv := httptest.NewServer(&page{price: "1"})
+	defer srv.Close()
+
+	s := newTestSource(t, map[string]any{
+		"targets": []any{
+			map[string]any{"url": srv.URL, "fields": []any{map[string]any{"name": "title", "css": "h1"}}},
+			map[string]any{"url": srv.URL + "/ok", "headers": map[string]any{"X-Token": "secret"}, "fields": []any{map[string]any{"name": "title", "css": "h1"}}},
+		},
+	})
+	c, err := s.Produce(1)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+	if _, err := s.Produce(1); err == nil {
+		t.Error("second Produce() expected error")
+	}
+
+	// The forbidden target is logged, the next one scraped
+	select {
+	case msg := <-c:
+		if meta, _ := decode(t, msg); meta["url"] != srv.URL+"/ok" {
+			t.Errorf("url = %s", meta["url"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message produced")
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+}
+
+func TestScraperInvalidConfig(t *testing.T) {
+	field := func(f map[string]any) map[string]any {
+		return map[string]any{"url": "http://localhost", "fields": []any{f}}
+	}
+	for name, tg := range map[string]map[string]any{
+		"css and xpath": field(map[string]any{"name": "a", "css": "a", "xpath": "//a"}),
+		"no selector":   field(map[string]any{"name": "a"}),
+		"invalid css":   field(map[string]any{"name": "a", "css": "a[href"}),
+		"invalid xpath": field(map[string]any{"name": "a", "xpath": "//a[@"}),
+		"key without items": {
+			"url": "http://localhost", "itemKey": "a", "fields": []any{map[string]any{"name": "a", "css": "a"}},
+		},
+		"unknown key": {
+			"url": "http://localhost", "items": map[string]any{"css": "li"}, "itemKey": "b", "fields": []any{map[string]any{"name": "a", "css": "a"}},
+		},
+	} {
+		cfg := new(SourceConfig)
+		if err := utils.ParseConfig(map[string]any{"targets": []any{tg}}, cfg); err != nil {
+			t.Fatalf("%s: ParseConfig() unexpected error = %v", name, err)
+		}
+		if _, err := newScraperSource(cfg, http.DefaultClient, statestore.NewMemory(&cfg.Memory, 0)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
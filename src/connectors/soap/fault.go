@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Fault is a SOAP fault returned by the endpoint
+type Fault struct {
+	// Version is the SOAP version of the envelope
+	Version string
+	// Code is the fault code without prefix: Client, Server, VersionMismatch or MustUnderstand
+	// (SOAP 1.1), Sender, Receiver, DataEncodingUnknown, ... (SOAP 1.2), or an application code
+	Code string
+	// Subcodes are the SOAP 1.2 subcodes, from the outermost
+	Subcodes []string
+	// Reason is the fault string (SOAP 1.1) or the first reason text (SOAP 1.2)
+	Reason string
+	// Actor is the fault actor (SOAP 1.1) or role (SOAP 1.2)
+	Actor string
+	// Detail is the XML content of the fault detail
+	Detail string
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+}
+
+func (f *Fault) Error() string {
+	code := f.Code
+	if len(f.Subcodes) > 0 {
+		code += "/" + strings.Join(f.Subcodes, "/")
+	}
+	return fmt.Sprintf("soap fault %s: %s", code, f.Reason)
+}
+
+// Temporary reports whether the fault is caused by the receiver, so that the same
+// request can succeed when retried; faults of the sender are permanent.
+// SOAP 1.1 dotted codes such as "Server.Busy" are classified by their first part.
+func (f *Fault) Temporary() bool {
+	class, _, _ := strings.Cut(f.Code, ".")
+	return class == "Server" || class == "Receiver"
+}
+
+type innerXML struct {
+	Content string `xml:",innerxml"`
+}
+
+type faultCode12 struct {
+	Value   string       `xml:"Value"`
+	Subcode *faultCode12 `xml:"Subcode"`
+}
+
+// faultXML decodes both the SOAP 1.1 and the SOAP 1.2 faults
+type faultXML struct {
+	Code11   string       `xml:"faultcode"`
+	String11 string       `xml:"faultstring"`
+	Actor11  string       `xml:"faultactor"`
+	Detail11 *innerXML    `xml:"detail"`
+	Code12   *faultCode12 `xml:"Code"`
+	Reason12 []string     `xml:"Reason>Text"`
+	Role12   string       `xml:"Role"`
+	Detail12 *innerXML    `xml:"Detail"`
+}
+
+type responseEnvelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Content string    `xml:",innerxml"`
+		Fault   *faultXML `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+// localName strips the namespace prefix of a QName value
+func localName(qname string) string {
+	if _, local, ok := strings.Cut(strings.TrimSpace(qname), ":"); ok {
+		return local
+	}
+	return strings.TrimSpace(qname)
+}
+
+// parseResponse returns the content of the envelope body, or the fault it holds
+func parseResponse(data []byte, version string) (string, *Fault, error) {
+	var env responseEnvelope
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&env); err != nil {
+		return "", nil, fmt.Errorf("invalid SOAP response: %w", err)
+	}
+	if env.XMLName.Space != envelopeNamespaces[version] {
+		return "", nil, fmt.Errorf("unexpected SOAP envelope namespace %q", env.XMLName.Space)
+	}
+	f := env.Body.Fault
+	if f == nil {
+		return strings.TrimSpace(env.Body.Content), nil, nil
+	}
+
+	fault := &Fault{Version: version}
+	if f.Code12 != nil {
+		fault.Code = localName(f.Code12.Value)
+		for sub := f.Code12.Subcode; sub != nil; sub = sub.Subcode {
+			fault.Subcodes = append(fault.Subcodes, localName(sub.Value))
+		}
+		if len(f.Reason12) > 0 {
+			fault.Reason = strings.TrimSpace(f.Reason12[0])
+		}
+		fault.Actor = f.Role12
+		if f.Detail12 != nil {
+			fault.Detail = strings.TrimSpace(f.Detail12.Content)
+		}
+		return "", fault, nil
+	}
+	fault.Code = localName(f.Code11)
+	fault.Reason = strings.TrimSpace(f.String11)
+	fault.Actor = f.Actor11
+	if f.Detail11 != nil {
+		fault.Detail = strings.TrimSpace(f.Detail11.Content)
+	}
+	return "", fault, nil
+}
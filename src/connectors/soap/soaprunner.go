@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/credentials"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/common/tmplfuncs"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure SOAPRunner implements connectors.Runner
+var _ connectors.Runner = &SOAPRunner{}
+
+const (
+	responseModeBody     = "body"
+	responseModeEnvelope = "envelope"
+)
+
+type RunnerConfig struct {
+	// URL is the endpoint URL (defaults to the address of the WSDL port)
+	URL string `mapstructure:"url" validate:"omitempty,url"`
+	// Version is the SOAP version, "1.1" or "1.2" (defaults to the WSDL binding version, or 1.1)
+	Version string `mapstructure:"version" validate:"omitempty,oneof=1.1 1.2"`
+	// Action is the SOAP action (defaults to the soapAction of the WSDL operation)
+	Action string `mapstructure:"action"`
+	// WSDL is the path of the WSDL 1.1 document describing the operation
+	WSDL string `mapstructure:"wsdl" validate:"omitempty,filepath"`
+	// Operation is the WSDL operation; the JSON payload is encoded as its input element,
+	// in the order of the schema
+	Operation string `mapstructure:"operation" validate:"required_with=WSDL"`
+	// Port selects the WSDL port (defaults to the first SOAP port of the version)
+	Port string `mapstructure:"port"`
+	// Template is the Go template of the body content (with sprig functions and "xml" to escape
+	// text), executed with "data" (decoded JSON payload, or the payload as string) and "metadata".
+	// It takes precedence over the WSDL; without both, the payload is the body content.
+	Template string `mapstructure:"template"`
+	// TemplateFile is the path of the template (alternative to Template)
+	TemplateFile string `mapstructure:"templateFile" validate:"omitempty,filepath"`
+	// Headers are additional HTTP headers
+	Headers map[string]string `mapstructure:"headers"`
+	// WSSecurity adds a WS-Security header with UsernameToken and Timestamp
+	WSSecurity WSSecurityConfig `mapstructure:"wsSecurity"`
+	// Response is the new payload: "body" (the content of the response body) or "envelope"
+	Response string            `mapstructure:"response" default:"body" validate:"oneof=body envelope"`
+	Timeout  time.Duration     `mapstructure:"timeout" default:"30s" validate:"gt=0"`
+	TLS      *tlsconfig.Config `mapstructure:"tls"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+	// MaxResponseSize limits the response size
+	MaxResponseSize int64 `mapstructure:"maxResponseSize" default:"10485760" validate:"gt=0"` // 10MB default
+}
+
+type SOAPRunner struct {
+	cfg      *RunnerConfig
+	slog     *slog.Logger
+	client   *http.Client
+	url      string
+	version  string
+	action   string
+	stub     *stubElement
+	template *template.Template
+	creds    *credentials.Provider
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// funcMap returns the sprig functions without the ones reading the process environment,
+// and the "xml" function escaping text
+func funcMap() map[string]any {
+	fm := tmplfuncs.FuncMap()
+	fm["xml"] = func(v any) string { return escape(fmt.Sprint(v)) }
+	return fm
+}
+
+// NewRunner creates a new instance of SOAPRunner, resolving the operation from the WSDL
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	if cfg.Template != "" && cfg.TemplateFile != "" {
+		return nil, fmt.Errorf("only one of template and templateFile can be set")
+	}
+
+	r := &SOAPRunner{
+		cfg:     cfg,
+		slog:    slog.Default().With("context", "SOAP Runner"),
+		url:     cfg.URL,
+		version: cfg.Version,
+		action:  cfg.Action,
+	}
+
+	if cfg.WSDL != "" {
+		op, err := loadWSDL(cfg.WSDL, cfg.Operation, cfg.Port, cfg.Version)
+		if err != nil {
+			return nil, err
+		}
+		if r.url == "" {
+			r.url = op.location
+		}
+		if r.version == "" {
+			r.version = op.version
+		}
+		if r.action == "" {
+			r.action = op.action
+		}
+		r.stub = op.stub
+	}
+	if r.version == "" {
+		r.version = soap11
+	}
+	if r.url == "" {
+		return nil, fmt.Errorf("url is required when the WSDL does not define the port address")
+	}
+
+	src := cfg.Template
+	if cfg.TemplateFile != "" {
+		content, err := os.ReadFile(cfg.TemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template file: %w", err)
+		}
+		src = string(content)
+	}
+	if src != "" {
+		tpl, err := template.New("soap").Option("missingkey=zero").Funcs(funcMap()).Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
+		r.template = tpl
+	}
+
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	r.client = &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	if cfg.WSSecurity.Enabled && cfg.WSSecurity.Credentials != nil {
+		if r.creds, err = credentials.New(cfg.WSSecurity.Credentials, r.slog); err != nil {
+			return nil, fmt.Errorf("failed to create credentials provider: %w", err)
+		}
+	}
+
+	r.slog.Info("soap runner created",
+		"url", r.url,
+		"version", r.version,
+		"action", r.action,
+		"operation", cfg.Operation,
+		"wsSecurity", cfg.WSSecurity.Enabled,
+	)
+	return r, nil
+}
+
+// body returns the content of the request body
+func (r *SOAPRunner) body(metadata map[string]string, data []byte) (string, error) {
+	switch {
+	case r.template != nil:
+		var payload any
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&payload); err != nil {
+			payload = string(data)
+		}
+		var buf bytes.Buffer
+		if err := r.template.Execute(&buf, map[string]any{"data": payload, "metadata": metadata}); err != nil {
+			return "", fmt.Errorf("failed to render body template: %w", err)
+		}
+		return buf.String(), nil
+	case r.stub != nil:
+		var payload any
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&payload); err != nil {
+			return "", fmt.Errorf("failed to decode JSON payload: %w", err)
+		}
+		if _, ok := payload.(map[string]any); !ok && r.stub.complex {
+			return "", fmt.Errorf("payload must be a JSON object for operation %s", r.cfg.Operation)
+		}
+		return encodeStub(r.stub, payload)
+	default:
+		// The payload is an XML fragment; a leading XML declaration is dropped
+		s := strings.TrimSpace(string(data))
+		if strings.HasPrefix(s, "<?xml") {
+			if end := strings.Index(s, "?>"); end >= 0 {
+				s = strings.TrimSpace(s[end+2:])
+			}
+		}
+		return s, nil
+	}
+}
+
+// newRequest builds the HTTP request of the envelope
+func (r *SOAPRunner) newRequest(envelope []byte) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, r.url, bytes.NewReader(envelope))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range r.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if r.version == soap12 {
+		contentType := "application/soap+xml; charset=utf-8"
+		if r.action != "" {
+			contentType += `; action="` + r.action + `"`
+		}
+		req.Header.Set("Content-Type", contentType)
+	} else {
+		req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+		req.Header.Set("SOAPAction", strconv.Quote(r.action))
+	}
+	return req, nil
+}
+
+// Process sends the payload in a SOAP envelope and replaces it with the response.
+// A fault in the response is returned as a *Fault error.
+func (r *SOAPRunner) Process(msg *message.RunnerMessage) error {
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds limit %d", len(data), r.cfg.MaxInputSize)
+	}
+
+	body, err := r.body(metadata, data)
+	if err != nil {
+		return err
+	}
+	var header string
+	if r.cfg.WSSecurity.Enabled {
+		var creds *credentials.Credentials
+		if r.creds != nil {
+			current := r.creds.Current()
+			creds = &current
+		}
+		if header, err = securityHeader(&r.cfg.WSSecurity, creds, time.Now()); err != nil {
+			return fmt.Errorf("failed to build security header: %w", err)
+		}
+	}
+
+	req, err := r.newRequest(buildEnvelope(r.version, header, body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r.slog.Debug("sending soap request", "url", r.url, "action", r.action, "bodysize", len(body))
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error performing SOAP request: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	resData, err := io.ReadAll(io.LimitReader(res.Body, r.cfg.MaxResponseSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(resData)) > r.cfg.MaxResponseSize {
+		return fmt.Errorf("response size exceeds limit %d", r.cfg.MaxResponseSize)
+	}
+
+	content, fault, err := parseResponse(resData, r.version)
+	if fault != nil {
+		fault.StatusCode = res.StatusCode
+		return fault
+	}
+	if res.StatusCode > 299 {
+		return fmt.Errorf("non-2XX status code: %d", res.StatusCode)
+	}
+	if err != nil {
+		return err
+	}
+
+	if r.cfg.Response == responseModeEnvelope {
+		msg.SetData(resData)
+	} else {
+		msg.SetData([]byte(content))
+	}
+	msg.AddMetadata("eb-status", strconv.Itoa(res.StatusCode))
+	return nil
+}
+
+func (r *SOAPRunner) Close() error {
+	r.slog.Info("closing soap runner")
+	if r.creds != nil {
+		r.creds.Close()
+	}
+	r.client.CloseIdleConnections()
+	return nil
+}
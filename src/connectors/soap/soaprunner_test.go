@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/credentials"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+const quoteWSDL = `<?xml version="1.0"?>
+<definitions xmlns="http://schemas.xmlsoap.org/wsdl/"
+    xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/"
+    xmlns:soap12="http://schemas.xmlsoap.org/wsdl/soap12/"
+    xmlns:xs="http://www.w3.org/2001/XMLSchema"
+    xmlns:tns="urn:example:quotes"
+    targetNamespace="urn:example:quotes">
+  <types>
+    <xs:schema targetNamespace="urn:example:quotes" elementFormDefault="qualified">
+      <xs:complexType name="Instrument">
+        <xs:sequence>
+          <xs:element name="symbol" type="xs:string"/>
+          <xs:element name="market" type="xs:string"/>
+        </xs:sequence>
+      </xs:complexType>
+      <xs:element name="GetQuote">
+        <xs:complexType>
+          <xs:sequence>
+            <xs:element name="instrument" type="tns:Instrument" maxOccurs="unbounded"/>
+            <xs:element name="currency" type="xs:string"/>
+            <xs:element name="depth" type="xs:int"/>
+          </xs:sequence>
+        </xs:complexType>
+      </xs:element>
+    </xs:schema>
+  </types>
+  <message name="GetQuoteInput"><part name="parameters" element="tns:GetQuote"/></message>
+  <portType name="QuotePortType">
+    <operation name="GetQuote"><input message="tns:GetQuoteInput"/></operation>
+  </portType>
+  <binding name="QuoteBinding" type="tns:QuotePortType">
+    <soap:binding style="document" transport="http://schemas.xmlsoap.org/soap/http"/>
+    <operation name="GetQuote">
+      <soap:operation soapAction="urn:example:quotes/GetQuote"/>
+      <input><soap:body use="literal"/></input>
+    </operation>
+  </binding>
+  <binding name="QuoteBinding12" type="tns:QuotePortType">
+    <soap12:binding style="document" transport="http://schemas.xmlsoap.org/soap/http"/>
+    <operation name="GetQuote">
+      <soap12:operation soapAction="urn:example:quotes/GetQuote12"/>
+      <input><soap12:body use="literal"/></input>
+    </operation>
+  </binding>
+  <service name="QuoteService">
+    <port name="QuotePort" binding="tns:QuoteBinding"><soap:address location="http://quotes.example.com/soap"/></port>
+    <port name="QuotePort12" binding="tns:QuoteBinding12"><soap12:address location="http://quotes.example.com/soap12"/></port>
+  </service>
+</definitions>`
+
+type captured struct {
+	header http.Header
+	body   string
+}
+
+// newTestServer answers every request with the status and the response
+func newTestServer(t *testing.T, status int, response string) (*httptest.Server, *captured) {
+	t.Helper()
+	c := new(captured)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		c.header = r.Header.Clone()
+		c.body = string(body)
+		w.WriteHeader(status)
+		w.Write([]byte(response)) //nolint:errcheck,gosec
+	}))
+	t.Cleanup(srv.Close)
+	return srv, c
+}
+
+func writeWSDL(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "quotes.wsdl")
+	if err := os.WriteFile(path, []byte(quoteWSDL), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWSDLStub(t *testing.T) {
+	srv, c := newTestServer(t, http.StatusOK, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+		`<q:GetQuoteResponse xmlns:q="urn:example:quotes"><q:price>12.5</q:price></q:GetQuoteResponse></s:Body></s:Envelope>`)
+	cfg := &RunnerConfig{
+		URL:             srv.URL,
+		WSDL:            writeWSDL(t),
+		Operation:       "GetQuote",
+		Response:        "body",
+		Timeout:         5 * time.Second,
+		MaxInputSize:    1024,
+		MaxResponseSize: 4096,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	// Fields are encoded in the order of the schema, arrays as repeated elements
+	payload := `{"depth": 10, "currency": "EUR & co", "instrument": [{"market": "XMIL", "symbol": "ENI"}, {"symbol": "ENEL", "market": "XMIL"}]}`
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(payload), nil))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+
+	if c.header.Get("SOAPAction") != `"urn:example:quotes/GetQuote"` {
+		t.Errorf("unexpected SOAPAction %q", c.header.Get("SOAPAction"))
+	}
+	if !strings.HasPrefix(c.header.Get("Content-Type"), "text/xml") {
+		t.Errorf("unexpected content type %q", c.header.Get("Content-Type"))
+	}
+	want := `<soap:Body><ns1:GetQuote xmlns:ns1="urn:example:quotes">` +
+		`<ns1:instrument><ns1:symbol>ENI</ns1:symbol><ns1:market>XMIL</ns1:market></ns1:instrument>` +
+		`<ns1:instrument><ns1:symbol>ENEL</ns1:symbol><ns1:market>XMIL</ns1:market></ns1:instrument>` +
+		`<ns1:currency>EUR &amp; co</ns1:currency><ns1:depth>10</ns1:depth></ns1:GetQuote></soap:Body>`
+	if !strings.Contains(c.body, want) {
+		t.Errorf("unexpected envelope:\n%s\nwant body:\n%s", c.body, want)
+	}
+
+	meta, data, _ := msg.GetMetadataAndData()
+	if string(data) != `<q:GetQuoteResponse xmlns:q="urn:example:quotes"><q:price>12.5</q:price></q:GetQuoteResponse>` {
+		t.Errorf("unexpected response body %s", data)
+	}
+	if meta["eb-status"] != "200" {
+		t.Errorf("unexpected status %q", meta["eb-status"])
+	}
+
+	msg = message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"ticker": "ENI"}`), nil))
+	if err := r.Process(msg); err == nil {
+		t.Error("expected error for a field not in the schema")
+	}
+}
+
+func TestWSDLVersion12(t *testing.T) {
+	srv, c := newTestServer(t, http.StatusOK, `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><ok/></env:Body></env:Envelope>`)
+	cfg := &RunnerConfig{
+		URL:             srv.URL,
+		WSDL:            writeWSDL(t),
+		Operation:       "GetQuote",
+		Version:         "1.2",
+		Response:        "envelope",
+		Timeout:         5 * time.Second,
+		MaxInputSize:    1024,
+		MaxResponseSize: 4096,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"currency": "USD"}`), nil))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if ct := c.header.Get("Content-Type"); ct != `application/soap+xml; charset=utf-8; action="urn:example:quotes/GetQuote12"` {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if c.header.Get("SOAPAction") != "" {
+		t.Error("unexpected SOAPAction header with SOAP 1.2")
+	}
+	if !strings.Contains(c.body, `xmlns:soap="http://www.w3.org/2003/05/soap-envelope"`) {
+		t.Errorf("unexpected envelope %s", c.body)
+	}
+	if data, _ := msg.GetData(); !strings.HasPrefix(string(data), "<env:Envelope") {
+		t.Errorf("expected the response envelope, got %s", data)
+	}
+
+	// The port location is the default URL
+	op, err := loadWSDL(writeWSDL(t), "GetQuote", "QuotePort12", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.location != "http://quotes.example.com/soap12" || op.version != soap12 {
+		t.Errorf("unexpected operation %+v", op)
+	}
+}
+
+func TestTemplateAndSecurity(t *testing.T) {
+	srv, c := newTestServer(t, http.StatusOK, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body/></soap:Envelope>`)
+	cfg := &RunnerConfig{
+		URL:      srv.URL,
+		Action:   "Ping",
+		Template: `<p:Ping xmlns:p="urn:ping"><p:id>{{ .data.id | xml }}</p:id><p:src>{{ index .metadata "source" | xml }}</p:src></p:Ping>`,
+		WSSecurity: WSSecurityConfig{
+			Enabled:        true,
+			Credentials:    &credentials.Config{Type: credentials.TypeStatic, Username: "alice", Password: "s3cr3t"},
+			PasswordType:   "PasswordDigest",
+			Timestamp:      true,
+			TimestampTTL:   5 * time.Minute,
+			MustUnderstand: true,
+		},
+		Response:        "body",
+		Timeout:         5 * time.Second,
+		MaxInputSize:    1024,
+		MaxResponseSize: 4096,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`{"id": "<42>"}`), map[string]string{"source": "a&b"}))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+
+	if !strings.Contains(c.body, `<soap:Body><p:Ping xmlns:p="urn:ping"><p:id>&lt;42&gt;</p:id><p:src>a&amp;b</p:src></p:Ping></soap:Body>`) {
+		t.Errorf("unexpected body %s", c.body)
+	}
+	for _, part := range []string{`soap:mustUnderstand="1"`, `<wsu:Timestamp`, `<wsse:Username>alice</wsse:Username>`, `#PasswordDigest">`} {
+		if !strings.Contains(c.body, part) {
+			t.Errorf("missing %s in %s", part, c.body)
+		}
+	}
+	if strings.Contains(c.body, "s3cr3t") {
+		t.Error("the password is sent in clear text with digest")
+	}
+
+	// The digest is computed from the nonce and the creation time of the token
+	m := regexp.MustCompile(`#PasswordDigest">([^<]+)</wsse:Password><wsse:Nonce[^>]*>([^<]+)</wsse:Nonce><wsu:Created>([^<]+)</wsu:Created>`).FindStringSubmatch(c.body)
+	if m == nil {
+		t.Fatalf("unexpected username token in %s", c.body)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(m[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m[1] != passwordDigestValue(nonce, m[3], "s3cr3t") {
+		t.Errorf("unexpected digest %s", m[1])
+	}
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   string
+		response  string
+		code      string
+		subcodes  []string
+		reason    string
+		temporary bool
+	}{
+		{
+			name:    "1.1 client",
+			version: "1.1",
+			response: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+				`<faultcode>soap:Client</faultcode><faultstring>Invalid symbol</faultstring><detail><e:code xmlns:e="urn:e">E12</e:code></detail>` +
+				`</soap:Fault></soap:Body></soap:Envelope>`,
+			code:   "Client",
+			reason: "Invalid symbol",
+		},
+		{
+			name:    "1.1 server dotted",
+			version: "1.1",
+			response: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+				`<faultcode>soap:Server.Busy</faultcode><faultstring>Try later</faultstring></soap:Fault></soap:Body></soap:Envelope>`,
+			code:      "Server.Busy",
+			reason:    "Try later",
+			temporary: true,
+		},
+		{
+			name:    "1.2 receiver",
+			version: "1.2",
+			response: `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><env:Fault>` +
+				`<env:Code><env:Value>env:Receiver</env:Value><env:Subcode><env:Value>q:Timeout</env:Value></env:Subcode></env:Code>` +
+				`<env:Reason><env:Text xml:lang="en">Backend timeout</env:Text></env:Reason></env:Fault></env:Body></env:Envelope>`,
+			code:      "Receiver",
+			subcodes:  []string{"Timeout"},
+			reason:    "Backend timeout",
+			temporary: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newTestServer(t, http.StatusInternalServerError, tt.response)
+			cfg := &RunnerConfig{
+				URL:             srv.URL,
+				Version:         tt.version,
+				Response:        "body",
+				Timeout:         5 * time.Second,
+				MaxInputSize:    1024,
+				MaxResponseSize: 4096,
+			}
+			r, err := NewRunner(cfg)
+			if err != nil {
+				t.Fatalf("failed to create runner: %v", err)
+			}
+			defer func() { _ = r.Close() }()
+			err = r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(`<Ping/>`), nil)))
+
+			var fault *Fault
+			if !errors.As(err, &fault) {
+				t.Fatalf("expected a fault, got %v", err)
+			}
+			if fault.Code != tt.code || fault.Reason != tt.reason || fault.Temporary() != tt.temporary ||
+				fault.StatusCode != http.StatusInternalServerError || strings.Join(fault.Subcodes, ",") != strings.Join(tt.subcodes, ",") {
+				t.Errorf("unexpected fault %+v", fault)
+			}
+		})
+	}
+
+	srv, _ := newTestServer(t, http.StatusBadGateway, "bad gateway")
+	r, err := NewRunner(&RunnerConfig{
+		URL:             srv.URL,
+		Response:        "body",
+		Timeout:         5 * time.Second,
+		MaxInputSize:    1024,
+		MaxResponseSize: 4096,
+	})
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	err = r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(`<Ping/>`), nil)))
+	var fault *Fault
+	if err == nil || errors.As(err, &fault) {
+		t.Errorf("expected a non-fault error, got %v", err)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	wsdl := writeWSDL(t)
+	tests := []struct {
+		name string
+		cfg  *RunnerConfig
+	}{
+		{"missing url", &RunnerConfig{Response: "body", Timeout: time.Second}},
+		{"unknown operation", &RunnerConfig{WSDL: wsdl, Operation: "Missing", Response: "body", Timeout: time.Second}},
+		{"unknown port", &RunnerConfig{WSDL: wsdl, Operation: "GetQuote", Port: "Missing", Response: "body", Timeout: time.Second}},
+		{"invalid template", &RunnerConfig{URL: "http://localhost", Template: "{{ .data", Response: "body", Timeout: time.Second}},
+		{"template and file", &RunnerConfig{URL: "http://localhost", Template: "x", TemplateFile: wsdl, Response: "body", Timeout: time.Second}},
+	}
+	for _, tt := range tests {
+		if _, err := NewRunner(tt.cfg); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
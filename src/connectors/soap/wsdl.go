@@ -0,0 +1,570 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	nsSOAP11 = "http://schemas.xmlsoap.org/wsdl/soap/"
+	nsSOAP12 = "http://schemas.xmlsoap.org/wsdl/soap12/"
+
+	// maxStubDepth bounds the nesting of the request stub, e.g. for recursive schema types
+	maxStubDepth = 32
+)
+
+type wsdlDefinitions struct {
+	TargetNamespace string         `xml:"targetNamespace,attr"`
+	Attrs           []xml.Attr     `xml:",any,attr"`
+	Types           wsdlTypes      `xml:"http://schemas.xmlsoap.org/wsdl/ types"`
+	Messages        []wsdlMessage  `xml:"http://schemas.xmlsoap.org/wsdl/ message"`
+	PortTypes       []wsdlPortType `xml:"http://schemas.xmlsoap.org/wsdl/ portType"`
+	Bindings        []wsdlBinding  `xml:"http://schemas.xmlsoap.org/wsdl/ binding"`
+	Services        []wsdlService  `xml:"http://schemas.xmlsoap.org/wsdl/ service"`
+	namespaces      map[string]string
+}
+
+type wsdlTypes struct {
+	Schemas []xsdSchema `xml:"http://www.w3.org/2001/XMLSchema schema"`
+}
+
+type wsdlMessage struct {
+	Name  string `xml:"name,attr"`
+	Parts []struct {
+		Name    string `xml:"name,attr"`
+		Element string `xml:"element,attr"`
+		Type    string `xml:"type,attr"`
+	} `xml:"http://schemas.xmlsoap.org/wsdl/ part"`
+}
+
+type wsdlPortType struct {
+	Name       string `xml:"name,attr"`
+	Operations []struct {
+		Name  string `xml:"name,attr"`
+		Input struct {
+			Message string `xml:"message,attr"`
+		} `xml:"http://schemas.xmlsoap.org/wsdl/ input"`
+	} `xml:"http://schemas.xmlsoap.org/wsdl/ operation"`
+}
+
+// soapElement is an element of the SOAP 1.1 or 1.2 WSDL binding extensions
+type soapElement struct {
+	XMLName    xml.Name
+	Style      string `xml:"style,attr"`
+	SOAPAction string `xml:"soapAction,attr"`
+	Use        string `xml:"use,attr"`
+	Namespace  string `xml:"namespace,attr"`
+	Location   string `xml:"location,attr"`
+}
+
+// version returns the SOAP version of the extension element, or "" for other bindings
+func (e soapElement) version() string {
+	switch e.XMLName.Space {
+	case nsSOAP11:
+		return soap11
+	case nsSOAP12:
+		return soap12
+	default:
+		return ""
+	}
+}
+
+type wsdlBinding struct {
+	Name       string                 `xml:"name,attr"`
+	Type       string                 `xml:"type,attr"`
+	SOAP       []soapElement          `xml:"binding"`
+	Operations []wsdlBindingOperation `xml:"http://schemas.xmlsoap.org/wsdl/ operation"`
+}
+
+type wsdlBindingOperation struct {
+	Name  string        `xml:"name,attr"`
+	SOAP  []soapElement `xml:"operation"`
+	Input struct {
+		Body []soapElement `xml:"body"`
+	} `xml:"http://schemas.xmlsoap.org/wsdl/ input"`
+}
+
+type wsdlService struct {
+	Name  string `xml:"name,attr"`
+	Ports []struct {
+		Name    string        `xml:"name,attr"`
+		Binding string        `xml:"binding,attr"`
+		Address []soapElement `xml:"address"`
+	} `xml:"http://schemas.xmlsoap.org/wsdl/ port"`
+}
+
+type xsdSchema struct {
+	TargetNamespace    string           `xml:"targetNamespace,attr"`
+	ElementFormDefault string           `xml:"elementFormDefault,attr"`
+	Attrs              []xml.Attr       `xml:",any,attr"`
+	Elements           []xsdElement     `xml:"http://www.w3.org/2001/XMLSchema element"`
+	ComplexTypes       []xsdComplexType `xml:"http://www.w3.org/2001/XMLSchema complexType"`
+}
+
+type xsdElement struct {
+	Name        string          `xml:"name,attr"`
+	Type        string          `xml:"type,attr"`
+	Ref         string          `xml:"ref,attr"`
+	ComplexType *xsdComplexType `xml:"http://www.w3.org/2001/XMLSchema complexType"`
+}
+
+type xsdComplexType struct {
+	Name      string       `xml:"name,attr"`
+	Sequence  []xsdElement `xml:"http://www.w3.org/2001/XMLSchema sequence>element"`
+	All       []xsdElement `xml:"http://www.w3.org/2001/XMLSchema all>element"`
+	Extension *struct {
+		Base     string       `xml:"base,attr"`
+		Sequence []xsdElement `xml:"http://www.w3.org/2001/XMLSchema sequence>element"`
+	} `xml:"http://www.w3.org/2001/XMLSchema complexContent>extension"`
+}
+
+// operation is the SOAP operation resolved from the WSDL
+type operation struct {
+	version  string
+	action   string
+	location string
+	stub     *stubElement
+}
+
+// loadWSDL reads the WSDL and resolves the operation of the port (any SOAP port if empty)
+func loadWSDL(path, opName, port, version string) (*operation, error) {
+	content, err := os.ReadFile(path) //nolint:gosec // path from the runner configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WSDL: %w", err)
+	}
+	return parseWSDL(content, opName, port, version)
+}
+
+func parseWSDL(content []byte, opName, port, version string) (*operation, error) {
+	var defs wsdlDefinitions
+	if err := xml.Unmarshal(content, &defs); err != nil {
+		return nil, fmt.Errorf("invalid WSDL: %w", err)
+	}
+	defs.namespaces = namespaceDecls(defs.Attrs)
+
+	binding, location, err := defs.selectBinding(port, version)
+	if err != nil {
+		return nil, err
+	}
+	bindingVersion, bindingStyle := "", "document"
+	for _, e := range binding.SOAP {
+		if v := e.version(); v != "" {
+			bindingVersion = v
+			if e.Style != "" {
+				bindingStyle = e.Style
+			}
+		}
+	}
+
+	idx := slices.IndexFunc(binding.Operations, func(o wsdlBindingOperation) bool { return o.Name == opName })
+	if idx < 0 {
+		return nil, fmt.Errorf("operation %s not found in binding %s", opName, binding.Name)
+	}
+	bop := binding.Operations[idx]
+
+	op := &operation{version: bindingVersion, location: location}
+	style := bindingStyle
+	for _, e := range bop.SOAP {
+		if e.version() != "" {
+			op.action = e.SOAPAction
+			if e.Style != "" {
+				style = e.Style
+			}
+		}
+	}
+	var body soapElement
+	for _, e := range bop.Input.Body {
+		if e.version() != "" {
+			body = e
+		}
+	}
+	if body.Use == "encoded" {
+		return nil, fmt.Errorf("operation %s uses the unsupported SOAP encoding, only literal is supported", opName)
+	}
+
+	msg, err := defs.inputMessage(binding.Type, opName)
+	if err != nil {
+		return nil, err
+	}
+	schema := newSchemaSet(defs)
+	if style == "rpc" {
+		root := &stubElement{name: xml.Name{Space: body.Namespace, Local: opName}}
+		for _, part := range msg.Parts {
+			child := &stubElement{name: xml.Name{Local: part.Name}}
+			if part.Type != "" {
+				schema.fillType(child, defs.resolve(part.Type, defs.namespaces), 1)
+			}
+			root.children = append(root.children, child)
+		}
+		op.stub = root
+		return op, nil
+	}
+
+	if len(msg.Parts) != 1 || msg.Parts[0].Element == "" {
+		return nil, fmt.Errorf("document operation %s requires a single element part", opName)
+	}
+	if op.stub, err = schema.element(defs.resolve(msg.Parts[0].Element, defs.namespaces)); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// selectBinding returns the SOAP binding of the named port, or of the first SOAP port
+// (of the version, if set), with the port address
+func (d *wsdlDefinitions) selectBinding(port, version string) (*wsdlBinding, string, error) {
+	for _, svc := range d.Services {
+		for _, p := range svc.Ports {
+			if port != "" && p.Name != port {
+				continue
+			}
+			name := d.resolve(p.Binding, d.namespaces).Local
+			for i := range d.Bindings {
+				b := &d.Bindings[i]
+				if b.Name != name {
+					continue
+				}
+				for _, e := range b.SOAP {
+					if v := e.version(); v != "" && (version == "" || version == v || port != "") {
+						location := ""
+						for _, a := range p.Address {
+							location = a.Location
+						}
+						return b, location, nil
+					}
+				}
+			}
+		}
+	}
+	if port != "" {
+		return nil, "", fmt.Errorf("SOAP port %s not found in WSDL", port)
+	}
+	return nil, "", fmt.Errorf("no SOAP %s port found in WSDL", version)
+}
+
+// inputMessage returns the input message of the operation of the port type
+func (d *wsdlDefinitions) inputMessage(portType, opName string) (*wsdlMessage, error) {
+	ptName := d.resolve(portType, d.namespaces).Local
+	for _, pt := range d.PortTypes {
+		if pt.Name != ptName {
+			continue
+		}
+		for _, o := range pt.Operations {
+			if o.Name != opName {
+				continue
+			}
+			msgName := d.resolve(o.Input.Message, d.namespaces).Local
+			for i := range d.Messages {
+				if d.Messages[i].Name == msgName {
+					return &d.Messages[i], nil
+				}
+			}
+			return nil, fmt.Errorf("message %s not found in WSDL", msgName)
+		}
+	}
+	return nil, fmt.Errorf("operation %s not found in port type %s", opName, ptName)
+}
+
+// resolve resolves a QName ("prefix:local") with the namespace declarations
+func (d *wsdlDefinitions) resolve(qname string, namespaces map[string]string) xml.Name {
+	prefix, local, ok := strings.Cut(qname, ":")
+	if !ok {
+		return xml.Name{Space: namespaces[""], Local: qname}
+	}
+	return xml.Name{Space: namespaces[prefix], Local: local}
+}
+
+// namespaceDecls returns the namespace declarations of the attributes by prefix ("" = default)
+func namespaceDecls(attrs []xml.Attr) map[string]string {
+	ns := map[string]string{}
+	for _, a := range attrs {
+		switch {
+		case a.Name.Space == "xmlns":
+			ns[a.Name.Local] = a.Value
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+			ns[""] = a.Value
+		}
+	}
+	return ns
+}
+
+// stubElement is an element of the request stub. The children of complex elements
+// are in the schema order; simple or unknown elements have no children.
+type stubElement struct {
+	name     xml.Name
+	children []*stubElement
+	complex  bool
+	// childSpace is the namespace of the elements without schema (qualified children)
+	childSpace string
+}
+
+// schemaSet indexes the top-level elements and complex types of the WSDL schemas
+type schemaSet struct {
+	defs     wsdlDefinitions
+	elements map[xml.Name]schemaItem[xsdElement]
+	types    map[xml.Name]schemaItem[xsdComplexType]
+}
+
+type schemaItem[T any] struct {
+	item   *T
+	schema *xsdSchema
+	ns     map[string]string
+}
+
+func newSchemaSet(defs wsdlDefinitions) *schemaSet {
+	s := &schemaSet{
+		defs:     defs,
+		elements: map[xml.Name]schemaItem[xsdElement]{},
+		types:    map[xml.Name]schemaItem[xsdComplexType]{},
+	}
+	for i := range defs.Types.Schemas {
+		schema := &defs.Types.Schemas[i]
+		ns := map[string]string{}
+		for k, v := range defs.namespaces {
+			ns[k] = v
+		}
+		for k, v := range namespaceDecls(schema.Attrs) {
+			ns[k] = v
+		}
+		for j := range schema.Elements {
+			e := &schema.Elements[j]
+			s.elements[xml.Name{Space: schema.TargetNamespace, Local: e.Name}] = schemaItem[xsdElement]{item: e, schema: schema, ns: ns}
+		}
+		for j := range schema.ComplexTypes {
+			t := &schema.ComplexTypes[j]
+			s.types[xml.Name{Space: schema.TargetNamespace, Local: t.Name}] = schemaItem[xsdComplexType]{item: t, schema: schema, ns: ns}
+		}
+	}
+	return s
+}
+
+// element returns the stub of a top-level element
+func (s *schemaSet) element(name xml.Name) (*stubElement, error) {
+	it, ok := s.elements[name]
+	if !ok {
+		return nil, fmt.Errorf("element {%s}%s not found in the WSDL schemas", name.Space, name.Local)
+	}
+	stub := &stubElement{name: name}
+	s.fillElement(stub, it, 1)
+	return stub, nil
+}
+
+// fillElement sets the children of the stub from the schema declaration of the element
+func (s *schemaSet) fillElement(stub *stubElement, it schemaItem[xsdElement], depth int) {
+	qualified := it.schema.ElementFormDefault == "qualified"
+	if it.item.ComplexType != nil {
+		s.fillComplex(stub, it.item.ComplexType, it.schema, it.ns, qualified, depth)
+		return
+	}
+	if it.item.Type != "" {
+		s.fillType(stub, s.defs.resolve(it.item.Type, it.ns), depth)
+	}
+}
+
+// fillType sets the children of the stub from a named complex type; simple types have no children
+func (s *schemaSet) fillType(stub *stubElement, name xml.Name, depth int) {
+	it, ok := s.types[name]
+	if !ok {
+		return
+	}
+	s.fillComplex(stub, it.item, it.schema, it.ns, it.schema.ElementFormDefault == "qualified", depth)
+}
+
+func (s *schemaSet) fillComplex(stub *stubElement, ct *xsdComplexType, schema *xsdSchema, ns map[string]string, qualified bool, depth int) {
+	stub.complex = true
+	if qualified {
+		stub.childSpace = schema.TargetNamespace
+	}
+	if depth > maxStubDepth {
+		// Deeper levels are encoded without schema
+		return
+	}
+	var decls []xsdElement
+	if ct.Extension != nil {
+		base := &stubElement{}
+		s.fillType(base, s.defs.resolve(ct.Extension.Base, ns), depth)
+		stub.children = append(stub.children, base.children...)
+		decls = append(decls, ct.Extension.Sequence...)
+	}
+	decls = append(decls, ct.Sequence...)
+	decls = append(decls, ct.All...)
+	for i := range decls {
+		d := &decls[i]
+		if d.Ref != "" {
+			ref := s.defs.resolve(d.Ref, ns)
+			if it, ok := s.elements[ref]; ok {
+				child := &stubElement{name: ref}
+				s.fillElement(child, it, depth+1)
+				stub.children = append(stub.children, child)
+			}
+			continue
+		}
+		child := &stubElement{name: xml.Name{Local: d.Name}}
+		if qualified {
+			child.name.Space = schema.TargetNamespace
+		}
+		s.fillElement(child, schemaItem[xsdElement]{item: d, schema: schema, ns: ns}, depth+1)
+		stub.children = append(stub.children, child)
+	}
+}
+
+// encoder writes the XML of the JSON values, declaring the namespace prefixes on the root
+type encoder struct {
+	b        strings.Builder
+	prefixes map[string]string
+}
+
+// encodeStub encodes the JSON value as the element of the stub
+func encodeStub(stub *stubElement, v any) (string, error) {
+	e := &encoder{prefixes: map[string]string{}}
+	collectNamespaces(stub, e.prefixes, 0)
+	if err := e.element(stub, v, true, 0); err != nil {
+		return "", err
+	}
+	return e.b.String(), nil
+}
+
+func collectNamespaces(stub *stubElement, prefixes map[string]string, depth int) {
+	for _, space := range []string{stub.name.Space, stub.childSpace} {
+		if _, ok := prefixes[space]; space != "" && !ok {
+			prefixes[space] = "ns" + strconv.Itoa(len(prefixes)+1)
+		}
+	}
+	if depth > maxStubDepth {
+		return
+	}
+	for _, c := range stub.children {
+		collectNamespaces(c, prefixes, depth+1)
+	}
+}
+
+func (e *encoder) qname(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return e.prefixes[n.Space] + ":" + n.Local
+}
+
+func (e *encoder) element(stub *stubElement, v any, root bool, depth int) error {
+	if depth > maxStubDepth {
+		return fmt.Errorf("payload nesting exceeds %d levels", maxStubDepth)
+	}
+	// Arrays are encoded as repeated elements
+	if arr, ok := v.([]any); ok {
+		for _, item := range arr {
+			if err := e.element(stub, item, root, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	name := e.qname(stub.name)
+	e.b.WriteString("<" + name)
+	if root {
+		spaces := make([]string, 0, len(e.prefixes))
+		for space := range e.prefixes {
+			spaces = append(spaces, space)
+		}
+		sort.Slice(spaces, func(i, j int) bool { return e.prefixes[spaces[i]] < e.prefixes[spaces[j]] })
+		for _, space := range spaces {
+			e.b.WriteString(" xmlns:" + e.prefixes[space] + `="`)
+			xml.EscapeText(&e.b, []byte(space)) //nolint:errcheck,gosec // strings.Builder does not fail
+			e.b.WriteString(`"`)
+		}
+	}
+
+	switch val := v.(type) {
+	case nil:
+		e.b.WriteString(` xsi:nil="true" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"/>`)
+		return nil
+	case map[string]any:
+		if err := e.attributes(val); err != nil {
+			return err
+		}
+		e.b.WriteString(">")
+		if err := e.children(stub, val, depth); err != nil {
+			return err
+		}
+	default:
+		if stub.complex && len(stub.children) > 0 {
+			return fmt.Errorf("element %s requires an object", stub.name.Local)
+		}
+		e.b.WriteString(">")
+		xml.EscapeText(&e.b, []byte(scalarText(val))) //nolint:errcheck,gosec // strings.Builder does not fail
+	}
+	e.b.WriteString("</" + name + ">")
+	return nil
+}
+
+// attributes writes the "@name" keys of the object as attributes
+func (e *encoder) attributes(obj map[string]any) error {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		if strings.HasPrefix(k, "@") {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if _, ok := obj[k].(map[string]any); ok {
+			return fmt.Errorf("attribute %s requires a scalar value", k)
+		}
+		e.b.WriteString(" " + k[1:] + `="`)
+		xml.EscapeText(&e.b, []byte(scalarText(obj[k]))) //nolint:errcheck,gosec // strings.Builder does not fail
+		e.b.WriteString(`"`)
+	}
+	return nil
+}
+
+// children writes the object fields in the schema order, or sorted when the schema is unknown
+func (e *encoder) children(stub *stubElement, obj map[string]any, depth int) error {
+	if len(stub.children) == 0 {
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			if !strings.HasPrefix(k, "@") {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			child := &stubElement{name: xml.Name{Space: stub.childSpace, Local: k}, childSpace: stub.childSpace}
+			if err := e.element(child, obj[k], false, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for k := range obj {
+		if !strings.HasPrefix(k, "@") && !slices.ContainsFunc(stub.children, func(c *stubElement) bool { return c.name.Local == k }) {
+			return fmt.Errorf("field %s is not an element of %s", k, stub.name.Local)
+		}
+	}
+	for _, c := range stub.children {
+		if v, ok := obj[c.name.Local]; ok {
+			if err := e.element(c, v, false, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func scalarText(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
@@ -1,21 +1,76 @@
 package connectors
 
 import (
+	"time"
+
 	"github.com/sandrolain/events-bridge/src/message"
 )
 
 const NewSourceMethodName = "NewSource"
 const NewSourceConfigName = "NewSourceConfig"
 
+// SourceConfigMigrationsName is the optional plugin function, of type
+// func() []configmigrate.Migration, upgrading the source options of older config versions
+const SourceConfigMigrationsName = "SourceConfigMigrations"
+
+// MultiSourceType is the source type of a bridge merging the messages of several sources
+const MultiSourceType = "multi"
+
 type Source interface {
 	Produce(int) (<-chan *message.RunnerMessage, error)
 	Close() error
 }
 
 type SourceConfig struct {
-	Type   string `yaml:"type" json:"type" validate:"required"`
+	Type string `yaml:"type" json:"type" validate:"required"`
+	// ID identifies an entry of the sources list in the eb-source metadata (default: the source type)
+	ID     string `yaml:"id" json:"id"`
 	Buffer int    `yaml:"buffer" json:"buffer"`
 	Reply  bool   `yaml:"reply" json:"reply"`
 	// Generic options passed to connector plugins. Preferred over typed fields below.
 	Options map[string]any `yaml:"options" json:"options"`
+	// Middleware is the inbound chain applied in order to every produced message, before the runners
+	Middleware []MiddlewareConfig `yaml:"middleware" json:"middleware" validate:"dive"`
+	// ReplyPlan declares when and what a source expecting a synchronous response (e.g. HTTP, CoAP)
+	// replies, instead of replying with the message at the end of the runners
+	ReplyPlan *ReplyPlanConfig `yaml:"replyPlan" json:"replyPlan"`
+}
+
+// ReplyPlanConfig declares the reply of a request/response source, e.g. to acknowledge
+// an HTTP request once it is validated while the message is published to Kafka.
+// Once the reply is sent, later acks and naks of the message are not forwarded to the source.
+type ReplyPlanConfig struct {
+	// When is "received" (after the inbound middleware), "runner" (after AfterRunners runners)
+	// or "completed" (default, after the last runner, i.e. once the target confirmed the delivery)
+	When string `yaml:"when" json:"when" validate:"omitempty,oneof=received runner completed"`
+	// AfterRunners is the number of runners completed before the reply when When is "runner"
+	AfterRunners int `yaml:"afterRunners" json:"afterRunners" validate:"min=0"`
+	// Response is the reply sent at the planned point
+	Response ReplyTemplate `yaml:"response" json:"response"`
+	// Timeout is the maximum time waited for the planned point (0 = no timeout)
+	Timeout time.Duration `yaml:"timeout" json:"timeout" validate:"min=0"`
+	// TimeoutResponse is the reply sent when the timeout expires (default: status 504)
+	TimeoutResponse *ReplyTemplate `yaml:"timeoutResponse" json:"timeoutResponse"`
+	// ErrorResponse is the reply sent when the message fails before the planned point (default: status 500)
+	ErrorResponse *ReplyTemplate `yaml:"errorResponse" json:"errorResponse"`
+}
+
+// ReplyTemplate is a reply rendered with Go templates from "data" (payload as string)
+// and "metadata" of the message
+type ReplyTemplate struct {
+	// Status is the reply status, set as "eb-status" metadata (e.g. "202" for HTTP, "Changed" for CoAP)
+	Status string `yaml:"status" json:"status"`
+	// Body is the reply payload template (empty = no payload)
+	Body string `yaml:"body" json:"body"`
+	// Metadata are the reply metadata templates (e.g. HTTP headers)
+	Metadata map[string]string `yaml:"metadata" json:"metadata"`
+}
+
+// MiddlewareConfig configures a step of the inbound middleware chain of a source,
+// e.g. to authenticate, decompress or deduplicate messages of any source connector.
+type MiddlewareConfig struct {
+	// Type is "sizeLimit", "decompress", "decrypt", "jwt", "hmac", "dedup", "rateLimit" or "remotePayload"
+	Type string `yaml:"type" json:"type" validate:"required,oneof=sizeLimit decompress decrypt jwt hmac dedup rateLimit remotePayload"`
+	// Options are the settings of the middleware type
+	Options map[string]any `yaml:"options" json:"options"`
 }
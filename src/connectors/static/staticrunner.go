@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/tmplfuncs"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure StaticRunner implements connectors.Runner
+var _ connectors.Runner = &StaticRunner{}
+
+const (
+	// statusKey is the metadata key of the reply status of the request/response sources
+	statusKey = "eb-status"
+	// contentTypeKey is the metadata key of the content type, forwarded as header by the HTTP source
+	contentTypeKey = "Content-Type"
+)
+
+type RunnerConfig struct {
+	// Status is the reply status set as "eb-status" metadata (e.g. "200" for HTTP, "Content"
+	// for CoAP); a Go template, empty to leave it unset
+	Status string `mapstructure:"status"`
+	// Body is the Go template of the payload; without Body, BodyFile and JSON the payload is
+	// echoed back unchanged
+	Body string `mapstructure:"body" validate:"excluded_with=BodyFile JSON"`
+	// BodyFile is the path of the payload template (alternative to Body)
+	BodyFile string `mapstructure:"bodyFile" validate:"excluded_with=Body JSON,omitempty,filepath"`
+	// JSON is a fixed JSON payload, e.g. {"status": "ok"} (alternative to Body)
+	JSON any `mapstructure:"json" validate:"excluded_with=Body BodyFile"`
+	// ContentType is set as "Content-Type" metadata; "application/json" by default with JSON
+	ContentType string `mapstructure:"contentType"`
+	// Metadata are the Go templates of the metadata set on the message
+	Metadata map[string]string `mapstructure:"metadata"`
+	// Delay is waited before the response, to simulate the latency of the stubbed system
+	Delay time.Duration `mapstructure:"delay" validate:"min=0"`
+}
+
+type StaticRunner struct {
+	cfg         *RunnerConfig
+	slog        *slog.Logger
+	status      *template.Template
+	body        *template.Template
+	json        []byte
+	contentType string
+	metadata    map[string]*template.Template
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+func parse(name, text string) (*template.Template, error) {
+	tpl, err := template.New(name).Option("missingkey=zero").Funcs(tmplfuncs.FuncMap()).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tpl, nil
+}
+
+// NewRunner creates a new instance of StaticRunner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	r := &StaticRunner{
+		cfg:         cfg,
+		slog:        slog.Default().With("context", "Static Runner"),
+		contentType: cfg.ContentType,
+		metadata:    make(map[string]*template.Template, len(cfg.Metadata)),
+	}
+
+	var err error
+	if cfg.Status != "" {
+		if r.status, err = parse("status", cfg.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	body := cfg.Body
+	if cfg.BodyFile != "" {
+		content, err := os.ReadFile(cfg.BodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body file: %w", err)
+		}
+		body = string(content)
+	}
+	if body != "" {
+		if r.body, err = parse("body", body); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.JSON != nil {
+		if r.json, err = json.Marshal(normalize(cfg.JSON)); err != nil {
+			return nil, fmt.Errorf("invalid json: %w", err)
+		}
+		if r.contentType == "" {
+			r.contentType = "application/json"
+		}
+	}
+
+	for key, text := range cfg.Metadata {
+		if r.metadata[key], err = parse("metadata "+key, text); err != nil {
+			return nil, err
+		}
+	}
+
+	r.slog.Info("static runner created", "status", cfg.Status, "echo", r.body == nil && r.json == nil, "delay", cfg.Delay)
+	return r, nil
+}
+
+// normalize converts the map[any]any of the YAML configurations to map[string]any for
+// the JSON encoding
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = normalize(item)
+		}
+		return m
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			m[k] = normalize(item)
+		}
+		return m
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = normalize(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
+
+// Process sets the response on the message: the payload from the body template or the
+// fixed JSON, or unchanged to echo it, and the status and metadata from their templates.
+// The templates are executed with "data" (the payload as string) and "metadata".
+func (r *StaticRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+
+	if r.cfg.Delay > 0 {
+		time.Sleep(r.cfg.Delay)
+	}
+
+	vars := map[string]any{"data": string(data), "metadata": meta}
+	out := maps.Clone(meta)
+	if out == nil {
+		out = make(map[string]string)
+	}
+	for key, tpl := range r.metadata {
+		if out[key], err = execute(tpl, vars); err != nil {
+			return err
+		}
+	}
+	if r.status != nil {
+		if out[statusKey], err = execute(r.status, vars); err != nil {
+			return err
+		}
+	}
+	if r.contentType != "" {
+		out[contentTypeKey] = r.contentType
+	}
+
+	switch {
+	case r.json != nil:
+		msg.SetData(r.json)
+	case r.body != nil:
+		body, err := execute(r.body, vars)
+		if err != nil {
+			return err
+		}
+		// Not nil, that would restore the source payload
+		msg.SetData(append([]byte{}, body...))
+	}
+	msg.SetMetadata(out)
+	return nil
+}
+
+func execute(tpl *template.Template, vars map[string]any) (string, error) {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", tpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+func (r *StaticRunner) Close() error {
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func TestStaticRunner(t *testing.T) {
+	bodyFile := filepath.Join(t.TempDir(), "health.json")
+	if err := os.WriteFile(bodyFile, []byte(`{"up":true,"from":"{{ index .metadata "host" }}"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		cfg      *RunnerConfig
+		data     string
+		meta     map[string]string
+		want     string
+		wantMeta map[string]string
+	}{
+		{
+			name:     "json",
+			cfg:      &RunnerConfig{Status: "200", JSON: map[string]any{"status": "ok", "checks": []any{map[any]any{"db": true}}}},
+			data:     "ignored",
+			meta:     map[string]string{"x-request-id": "r1"},
+			want:     `{"checks":[{"db":true}],"status":"ok"}`,
+			wantMeta: map[string]string{"eb-status": "200", "Content-Type": "application/json", "x-request-id": "r1"},
+		},
+		{
+			name: "templates",
+			cfg: &RunnerConfig{
+				Status:      `{{ if eq (index .metadata "method") "POST" }}201{{ else }}200{{ end }}`,
+				Body:        `{"id":"{{ index .metadata "x-request-id" }}","echo":{{ .data }},"len":{{ len .data }}}`,
+				ContentType: "application/json",
+				Metadata:    map[string]string{"X-Stub": `{{ upper "yes" }}`},
+			},
+			data:     `{"a":1}`,
+			meta:     map[string]string{"method": "POST", "x-request-id": "r1"},
+			want:     `{"id":"r1","echo":{"a":1},"len":7}`,
+			wantMeta: map[string]string{"eb-status": "201", "X-Stub": "YES", "Content-Type": "application/json"},
+		},
+		{
+			name:     "echo with delay",
+			cfg:      &RunnerConfig{Status: "202", Delay: 20 * time.Millisecond},
+			data:     "ping",
+			meta:     map[string]string{"k": "v"},
+			want:     "ping",
+			wantMeta: map[string]string{"eb-status": "202", "k": "v"},
+		},
+		{
+			// An empty body replies without payload
+			name: "empty body",
+			cfg:  &RunnerConfig{Body: "{{ if false }}x{{ end }}"},
+			data: "ping",
+			want: "",
+		},
+		{
+			name: "body file",
+			cfg:  &RunnerConfig{BodyFile: bodyFile},
+			meta: map[string]string{"host": "h1"},
+			want: `{"up":true,"from":"h1"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRunner(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewRunner() unexpected error = %v", err)
+			}
+			msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(tt.data), tt.meta))
+			start := time.Now()
+			if err := r.Process(msg); err != nil {
+				t.Fatalf("Process() unexpected error = %v", err)
+			}
+			if time.Since(start) < tt.cfg.Delay {
+				t.Error("delay not applied")
+			}
+			meta, out, err := msg.GetMetadataAndData()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("payload = %q, want %q", out, tt.want)
+			}
+			for k, v := range tt.wantMeta {
+				if meta[k] != v {
+					t.Errorf("metadata %s = %q, want %q", k, meta[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestStaticConfigErrors(t *testing.T) {
+	for name, opts := range map[string]map[string]any{
+		"body and json":  {"body": "x", "json": map[string]any{"a": 1}},
+		"body and file":  {"body": "x", "bodyFile": "/tmp/x"},
+		"negative delay": {"delay": "-1s"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := utils.ParseConfig(opts, new(RunnerConfig)); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+
+	for name, opts := range map[string]map[string]any{
+		"status template":   {"status": "{{ .x"},
+		"body template":     {"body": "{{ end }}"},
+		"metadata template": {"metadata": map[string]any{"k": "{{"}},
+		"missing body file": {"bodyFile": filepath.Join(t.TempDir(), "missing")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := new(RunnerConfig)
+			if err := utils.ParseConfig(opts, cfg); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewRunner(cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	r, err := NewRunner(&RunnerConfig{Body: `{{ fail "boom" }}`})
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	msg := message.NewRunnerMessage(testutil.NewAdapter(nil, nil))
+	if err := r.Process(msg); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Process() error = %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package connectors
+
+import (
+	"sync"
+	"time"
+)
+
+// ConnectionState is the state of the connection of a connector to its system
+type ConnectionState string
+
+const (
+	StateConnected    ConnectionState = "connected"
+	StateConnecting   ConnectionState = "connecting"
+	StateDisconnected ConnectionState = "disconnected"
+)
+
+// ConnectorStatus is the health of a connector as reported by the connector itself
+type ConnectorStatus struct {
+	State ConnectionState `json:"state"`
+	// LastError is the most recent connection or delivery error
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitzero"`
+	// LastMessageAt is the time of the most recent message received or delivered
+	LastMessageAt time.Time `json:"lastMessageAt,omitzero"`
+	// Lag is the backlog of the connector (e.g. the consumer lag or the queued messages),
+	// nil where not applicable
+	Lag *int64 `json:"lag,omitempty"`
+}
+
+// StatusReporter is optionally implemented by sources and runners reporting the state of
+// their connection. The bridge aggregates the reports into the readiness probe, the admin
+// status and the metrics.
+type StatusReporter interface {
+	ConnectorStatus() ConnectorStatus
+}
+
+// StatusTracker records the status of a connector and implements StatusReporter,
+// for the connectors to embed. The zero value reports a connecting connector.
+type StatusTracker struct {
+	mu     sync.RWMutex
+	status ConnectorStatus
+}
+
+// Ensure StatusTracker implements StatusReporter
+var _ StatusReporter = (*StatusTracker)(nil)
+
+// SetState records the state of the connection
+func (t *StatusTracker) SetState(state ConnectionState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.State = state
+}
+
+// RecordError records the most recent error, without changing the state
+func (t *StatusTracker) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastError = err.Error()
+	t.status.LastErrorAt = time.Now()
+}
+
+// RecordMessage records the time of a message received or delivered
+func (t *StatusTracker) RecordMessage() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastMessageAt = time.Now()
+}
+
+// SetLag records the backlog of the connector
+func (t *StatusTracker) SetLag(lag int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.Lag = &lag
+}
+
+// ConnectorStatus returns a copy of the recorded status
+func (t *StatusTracker) ConnectorStatus() ConnectorStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	status := t.status
+	if status.State == "" {
+		status.State = StateConnecting
+	}
+	if status.Lag != nil {
+		lag := *status.Lag
+		status.Lag = &lag
+	}
+	return status
+}
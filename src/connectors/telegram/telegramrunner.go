@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sandrolain/events-bridge/src/common/httpretry"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+	"github.com/sandrolain/events-bridge/src/common/tmplfuncs"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"golang.org/x/time/rate"
+)
+
+// Ensure TelegramRunner implements connectors.Runner
+var _ connectors.Runner = &TelegramRunner{}
+
+const (
+	// maxTextLength and maxCaptionLength are the limits of the Bot API, in characters
+	maxTextLength    = 4096
+	maxCaptionLength = 1024
+)
+
+// mediaFields are the methods and file fields of the media types
+var mediaFields = map[string]struct{ method, field string }{
+	"photo":     {"sendPhoto", "photo"},
+	"document":  {"sendDocument", "document"},
+	"audio":     {"sendAudio", "audio"},
+	"video":     {"sendVideo", "video"},
+	"animation": {"sendAnimation", "animation"},
+	"voice":     {"sendVoice", "voice"},
+}
+
+type RunnerConfig struct {
+	// Token is the bot token; supports secret references (env:, file:)
+	Token string `mapstructure:"token" validate:"required"` //nolint:gosec // user-configured credential field
+	// APIURL is the base URL of the Bot API, e.g. of a local Bot API server
+	APIURL string `mapstructure:"apiUrl" default:"https://api.telegram.org" validate:"required,url"`
+	// ChatID is the chat the messages are sent to: a chat id or a @channelusername
+	ChatID string `mapstructure:"chatId" validate:"required_without=ChatIDFromMetadataKey"`
+	// ChatIDFromMetadataKey is the metadata key of the chat id, overriding ChatID
+	ChatIDFromMetadataKey string `mapstructure:"chatIdFromMetadataKey"`
+	// ThreadIDFromMetadataKey is the metadata key of the topic (message thread) of forum chats
+	ThreadIDFromMetadataKey string `mapstructure:"threadIdFromMetadataKey"`
+	// Text is the Go template (with sprig functions) of the text, or of the caption of the
+	// media, executed with "data" (decoded JSON payload, or the payload string) and
+	// "metadata" (empty = the payload)
+	Text string `mapstructure:"text"`
+	// ParseMode formats the text: MarkdownV2, HTML or Markdown (empty = plain text)
+	ParseMode string `mapstructure:"parseMode" validate:"omitempty,oneof=MarkdownV2 HTML Markdown"`
+	// DisableNotification sends the messages silently
+	DisableNotification bool `mapstructure:"disableNotification"`
+	// DisableLinkPreview disables the preview of the links of the text
+	DisableLinkPreview bool `mapstructure:"disableLinkPreview"`
+	// Media sends the messages as media with the text as caption
+	Media *MediaConfig `mapstructure:"media"`
+	// RatePerChat is the messages per second sent to a chat; the messages over the rate wait
+	RatePerChat float64 `mapstructure:"ratePerChat" default:"1" validate:"gt=0"`
+	// BurstPerChat is the messages sent at once to an idle chat
+	BurstPerChat int `mapstructure:"burstPerChat" default:"3" validate:"min=1"`
+	// Rate is the messages per second sent by the bot to all the chats
+	Rate float64 `mapstructure:"rate" default:"30" validate:"gt=0"`
+	// MaxChats bounds the chats with a rate limiter, the least recently used are forgotten
+	MaxChats int `mapstructure:"maxChats" default:"10000" validate:"min=1"`
+	// MessageIDMetadataKey is the metadata key set to the id of the sent message
+	MessageIDMetadataKey string            `mapstructure:"messageIdMetadataKey" default:"eb-telegram-message-id"`
+	Timeout              time.Duration     `mapstructure:"timeout" default:"10s" validate:"gt=0"`
+	TLS                  *tlsconfig.Config `mapstructure:"tls"`
+}
+
+// MediaConfig defines the media attached to the messages
+type MediaConfig struct {
+	// Type is the media type: photo, document, audio, video, animation or voice
+	Type string `mapstructure:"type" validate:"required,oneof=photo document audio video animation voice"`
+	// URLFromMetadataKey is the metadata key of the URL or file id of the media; when empty,
+	// the payload is uploaded as the file. The messages without the key are sent as text.
+	URLFromMetadataKey string `mapstructure:"urlFromMetadataKey"`
+	// FileName is the name of the uploaded file
+	FileName string `mapstructure:"fileName" default:"attachment"`
+	// FileNameFromMetadataKey is the metadata key of the name of the uploaded file, overriding FileName
+	FileNameFromMetadataKey string `mapstructure:"fileNameFromMetadataKey"`
+}
+
+// chatLimiter is the rate limiter of a chat
+type chatLimiter struct {
+	chatID  string
+	limiter *rate.Limiter
+}
+
+// TelegramRunner sends the messages to Telegram chats through the Bot API
+type TelegramRunner struct {
+	cfg     *RunnerConfig
+	slog    *slog.Logger
+	client  *http.Client
+	baseURL string
+	text    *template.Template
+	limiter *rate.Limiter
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu    sync.Mutex
+	chats map[string]*list.Element
+	order *list.List
+}
+
+// apiResponse is the response envelope of the Bot API
+type apiResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	ErrorCode   int    `json:"error_code"`
+	Result      struct {
+		MessageID int64 `json:"message_id"`
+	} `json:"result"`
+	Parameters struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a Telegram runner
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	token, err := secrets.Resolve(cfg.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve token: %w", err)
+	}
+	var text *template.Template
+	if cfg.Text != "" {
+		if text, err = template.New("text").Option("missingkey=zero").Funcs(tmplfuncs.FuncMap()).Parse(cfg.Text); err != nil {
+			return nil, fmt.Errorf("invalid text template: %w", err)
+		}
+	}
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &TelegramRunner{
+		cfg:  cfg,
+		slog: slog.Default().With("context", "Telegram Runner"),
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		baseURL: strings.TrimSuffix(cfg.APIURL, "/") + "/bot" + token + "/",
+		text:    text,
+		limiter: rate.NewLimiter(rate.Limit(cfg.Rate), max(int(cfg.Rate), 1)),
+		ctx:     ctx,
+		cancel:  cancel,
+		chats:   map[string]*list.Element{},
+		order:   list.New(),
+	}
+	r.slog.Info("telegram runner created", "chatId", cfg.ChatID, "chatIdFromMetadataKey", cfg.ChatIDFromMetadataKey)
+	return r, nil
+}
+
+// Process sends the message to its chat
+func (r *TelegramRunner) Process(msg *message.RunnerMessage) error {
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+
+	chatID := r.cfg.ChatID
+	if r.cfg.ChatIDFromMetadataKey != "" && metadata[r.cfg.ChatIDFromMetadataKey] != "" {
+		chatID = metadata[r.cfg.ChatIDFromMetadataKey]
+	}
+	if chatID == "" {
+		return errors.New("no chat id for the message")
+	}
+	text, err := r.renderText(metadata, data)
+	if err != nil {
+		return err
+	}
+
+	fields := map[string]string{"chat_id": chatID}
+	if r.cfg.ThreadIDFromMetadataKey != "" && metadata[r.cfg.ThreadIDFromMetadataKey] != "" {
+		fields["message_thread_id"] = metadata[r.cfg.ThreadIDFromMetadataKey]
+	}
+	if r.cfg.ParseMode != "" {
+		fields["parse_mode"] = r.cfg.ParseMode
+	}
+	if r.cfg.DisableNotification {
+		fields["disable_notification"] = "true"
+	}
+
+	if err := r.wait(chatID); err != nil {
+		return err
+	}
+
+	var res *apiResponse
+	media := r.cfg.Media
+	switch {
+	case media == nil || (media.URLFromMetadataKey != "" && metadata[media.URLFromMetadataKey] == ""):
+		fields["text"] = truncate(text, maxTextLength)
+		if r.cfg.DisableLinkPreview {
+			fields["link_preview_options"] = `{"is_disabled":true}`
+		}
+		res, err = r.call("sendMessage", fields, nil)
+	case media.URLFromMetadataKey != "":
+		fields["caption"] = truncate(text, maxCaptionLength)
+		fields[mediaFields[media.Type].field] = metadata[media.URLFromMetadataKey]
+		res, err = r.call(mediaFields[media.Type].method, fields, nil)
+	default:
+		fields["caption"] = truncate(text, maxCaptionLength)
+		name := media.FileName
+		if media.FileNameFromMetadataKey != "" && metadata[media.FileNameFromMetadataKey] != "" {
+			name = metadata[media.FileNameFromMetadataKey]
+		}
+		res, err = r.call(mediaFields[media.Type].method, fields, &upload{field: mediaFields[media.Type].field, name: name, data: data})
+	}
+	if err != nil {
+		return err
+	}
+
+	if r.cfg.MessageIDMetadataKey != "" {
+		msg.AddMetadata(r.cfg.MessageIDMetadataKey, strconv.FormatInt(res.Result.MessageID, 10))
+	}
+	return nil
+}
+
+// renderText executes the text template, or returns the payload without template
+func (r *TelegramRunner) renderText(metadata map[string]string, data []byte) (string, error) {
+	if r.text == nil {
+		return string(data), nil
+	}
+	var payload any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		payload = string(data)
+	}
+	var b strings.Builder
+	if err := r.text.Execute(&b, map[string]any{"data": payload, "metadata": metadata}); err != nil {
+		return "", fmt.Errorf("failed to render text: %w", err)
+	}
+	return b.String(), nil
+}
+
+// truncate shortens a text to the limit of characters, ending it with an ellipsis
+func truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit-1]) + "…"
+}
+
+// wait blocks until the rates of the bot and of the chat allow a message
+func (r *TelegramRunner) wait(chatID string) error {
+	if err := r.chatLimiter(chatID).Wait(r.ctx); err != nil {
+		return fmt.Errorf("rate limit wait interrupted: %w", err)
+	}
+	if err := r.limiter.Wait(r.ctx); err != nil {
+		return fmt.Errorf("rate limit wait interrupted: %w", err)
+	}
+	return nil
+}
+
+// chatLimiter returns the limiter of the chat, forgetting the least recently used beyond MaxChats
+func (r *TelegramRunner) chatLimiter(chatID string) *rate.Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if el, ok := r.chats[chatID]; ok {
+		r.order.MoveToFront(el)
+		return el.Value.(*chatLimiter).limiter
+	}
+	cl := &chatLimiter{chatID: chatID, limiter: rate.NewLimiter(rate.Limit(r.cfg.RatePerChat), r.cfg.BurstPerChat)}
+	r.chats[chatID] = r.order.PushFront(cl)
+	for r.order.Len() > r.cfg.MaxChats {
+		el := r.order.Back()
+		r.order.Remove(el)
+		delete(r.chats, el.Value.(*chatLimiter).chatID)
+	}
+	return cl.limiter
+}
+
+// upload is a file uploaded with a multipart request
+type upload struct {
+	field string
+	name  string
+	data  []byte
+}
+
+// call invokes a method of the Bot API, with a form body or a multipart body for uploads
+func (r *TelegramRunner) call(method string, fields map[string]string, file *upload) (*apiResponse, error) {
+	var body io.Reader
+	var contentType string
+	if file == nil {
+		form := url.Values{}
+		for k, v := range fields {
+			form.Set(k, v)
+		}
+		body = strings.NewReader(form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	} else {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		for k, v := range fields {
+			if err := w.WriteField(k, v); err != nil {
+				return nil, fmt.Errorf("failed to encode %s: %w", k, err)
+			}
+		}
+		part, err := w.CreateFormFile(file.field, file.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode file: %w", err)
+		}
+		if _, err := part.Write(file.data); err != nil {
+			return nil, fmt.Errorf("failed to encode file: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to encode file: %w", err)
+		}
+		body = &buf
+		contentType = w.FormDataContentType()
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodPost, r.baseURL+method, body)
+	if err != nil {
+		// The error holds the URL with the bot token
+		return nil, fmt.Errorf("failed to create %s request", method)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		// The URL holds the bot token: only the cause is reported
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return nil, fmt.Errorf("error calling %s: %w", method, err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", method, err)
+	}
+	var apiRes apiResponse
+	if err := json.Unmarshal(raw, &apiRes); err != nil {
+		if len(raw) > httpretry.MaxErrorBody {
+			raw = raw[:httpretry.MaxErrorBody]
+		}
+		return nil, fmt.Errorf("invalid %s response: status %d: %s", method, res.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	if !apiRes.OK {
+		err := fmt.Errorf("%s failed: %d: %s", method, apiRes.ErrorCode, apiRes.Description)
+		if apiRes.Parameters.RetryAfter > 0 {
+			return nil, &connectors.RetryAfterError{Delay: time.Duration(apiRes.Parameters.RetryAfter) * time.Second, Err: err}
+		}
+		return nil, err
+	}
+	return &apiRes, nil
+}
+
+// Close interrupts the messages waiting for their rate
+func (r *TelegramRunner) Close() error {
+	r.cancel()
+	r.client.CloseIdleConnections()
+	return nil
+}
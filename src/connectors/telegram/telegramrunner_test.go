@@ -0,0 +1,350 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+// apiCall is a request received by the fake Bot API
+type apiCall struct {
+	path   string
+	fields map[string]string
+	file   string
+	name   string
+}
+
+// fakeAPI is a Bot API server recording the calls and answering with the response function
+type fakeAPI struct {
+	mu      sync.Mutex
+	calls   []apiCall
+	respond func(call apiCall) (int, string)
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := apiCall{path: r.URL.Path, fields: map[string]string{}}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for k, v := range r.MultipartForm.Value {
+			call.fields[k] = v[0]
+		}
+		for _, headers := range r.MultipartForm.File {
+			file, _ := headers[0].Open()
+			data, _ := io.ReadAll(file)
+			call.file, call.name = string(data), headers[0].Filename
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for k, v := range r.PostForm {
+			call.fields[k] = v[0]
+		}
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	f.mu.Unlock()
+
+	status, body := http.StatusOK, `{"ok":true,"result":{"message_id":42}}`
+	if f.respond != nil {
+		status, body = f.respond(call)
+	}
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, body)
+}
+
+func newMessage(data string, meta map[string]string) *message.RunnerMessage {
+	return message.NewRunnerMessage(testutil.NewAdapter([]byte(data), meta))
+}
+
+func TestRunnerConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    map[string]any
+		wantErr bool
+	}{
+		{"chat id", map[string]any{"token": "t", "chatId": "-100"}, false},
+		{"chat id from metadata", map[string]any{"token": "t", "chatIdFromMetadataKey": "chat"}, false},
+		{"missing token", map[string]any{"chatId": "-100"}, true},
+		{"missing chat", map[string]any{"token": "t"}, true},
+		{"invalid parse mode", map[string]any{"token": "t", "chatId": "1", "parseMode": "rst"}, true},
+		{"invalid media", map[string]any{"token": "t", "chatId": "1", "media": map[string]any{"type": "sticker"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := utils.ParseConfig(tt.opts, new(RunnerConfig))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	cfg := &RunnerConfig{
+		Token:                "123:secret",
+		APIURL:               "https://api.telegram.org",
+		ChatID:               "1",
+		Text:                 "{{ .data",
+		RatePerChat:          1,
+		BurstPerChat:         3,
+		Rate:                 30,
+		MaxChats:             10,
+		MessageIDMetadataKey: "eb-telegram-message-id",
+		Timeout:              time.Second,
+	}
+	if _, err := NewRunner(cfg); err == nil {
+		t.Error("NewRunner() expected template error")
+	}
+}
+
+func TestTelegramRunnerText(t *testing.T) {
+	api := &fakeAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	cfg := &RunnerConfig{
+		Token:                   "123:secret",
+		APIURL:                  srv.URL,
+		ChatID:                  "-100",
+		ChatIDFromMetadataKey:   "chat",
+		ThreadIDFromMetadataKey: "topic",
+		Text:                    "*{{ .data.alert }}* on {{ .metadata.host }}",
+		ParseMode:               "MarkdownV2",
+		DisableLinkPreview:      true,
+		RatePerChat:             1,
+		BurstPerChat:            3,
+		Rate:                    30,
+		MaxChats:                10,
+		MessageIDMetadataKey:    "eb-telegram-message-id",
+		Timeout:                 time.Second,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	msg := newMessage(`{"alert":"disk full"}`, map[string]string{"host": "db1", "chat": "777", "topic": "5"})
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if err := r.Process(newMessage(`{"alert":"cpu"}`, map[string]string{"host": "web"})); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+
+	if len(api.calls) != 2 {
+		t.Fatalf("calls = %d, want 2", len(api.calls))
+	}
+	first := api.calls[0]
+	if first.path != "/bot123:secret/sendMessage" {
+		t.Errorf("path = %s", first.path)
+	}
+	if first.fields["chat_id"] != "777" || first.fields["message_thread_id"] != "5" || first.fields["text"] != "*disk full* on db1" ||
+		first.fields["parse_mode"] != "MarkdownV2" || first.fields["link_preview_options"] != `{"is_disabled":true}` {
+		t.Errorf("fields = %v", first.fields)
+	}
+	if api.calls[1].fields["chat_id"] != "-100" {
+		t.Errorf("default chat = %v", api.calls[1].fields)
+	}
+	meta, _ := msg.GetMetadata()
+	if meta["eb-telegram-message-id"] != "42" {
+		t.Errorf("message id metadata = %q", meta["eb-telegram-message-id"])
+	}
+}
+
+func TestTelegramRunnerTruncate(t *testing.T) {
+	api := &fakeAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	cfg := &RunnerConfig{
+		Token:                "123:secret",
+		APIURL:               srv.URL,
+		ChatID:               "1",
+		RatePerChat:          1,
+		BurstPerChat:         3,
+		Rate:                 30,
+		MaxChats:             10,
+		MessageIDMetadataKey: "eb-telegram-message-id",
+		Timeout:              time.Second,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	if err := r.Process(newMessage(strings.Repeat("è", maxTextLength+10), nil)); err != nil {
+		t.Fatal(err)
+	}
+	text := []rune(api.calls[0].fields["text"])
+	if len(text) != maxTextLength || text[len(text)-1] != '…' {
+		t.Errorf("text length = %d", len(text))
+	}
+}
+
+func TestTelegramRunnerMedia(t *testing.T) {
+	api := &fakeAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	cfg := &RunnerConfig{
+		Token:                "123:secret",
+		APIURL:               srv.URL,
+		ChatID:               "1",
+		Text:                 "report {{ .metadata.day }}",
+		Media:                &MediaConfig{Type: "document", FileName: "attachment", FileNameFromMetadataKey: "name"},
+		RatePerChat:          1,
+		BurstPerChat:         3,
+		Rate:                 30,
+		MaxChats:             10,
+		MessageIDMetadataKey: "eb-telegram-message-id",
+		Timeout:              time.Second,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	if err := r.Process(newMessage("a,b\n1,2\n", map[string]string{"day": "monday", "name": "report.csv"})); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	call := api.calls[0]
+	if call.path != "/bot123:secret/sendDocument" || call.file != "a,b\n1,2\n" || call.name != "report.csv" || call.fields["caption"] != "report monday" {
+		t.Errorf("call = %+v", call)
+	}
+
+	// Media from a metadata URL, text for the messages without it
+	api.calls = nil
+	cfg = &RunnerConfig{
+		Token:                "123:secret",
+		APIURL:               srv.URL,
+		ChatID:               "1",
+		Media:                &MediaConfig{Type: "photo", FileName: "attachment", URLFromMetadataKey: "image"},
+		RatePerChat:          1,
+		BurstPerChat:         3,
+		Rate:                 30,
+		MaxChats:             10,
+		MessageIDMetadataKey: "eb-telegram-message-id",
+		Timeout:              time.Second,
+	}
+	photo, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = photo.Close() }()
+	if err := photo.Process(newMessage("camera 3", map[string]string{"image": "https://example.com/snap.jpg"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := photo.Process(newMessage("no snapshot", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if call := api.calls[0]; call.path != "/bot123:secret/sendPhoto" || call.fields["photo"] != "https://example.com/snap.jpg" || call.fields["caption"] != "camera 3" {
+		t.Errorf("photo call = %+v", call)
+	}
+	if call := api.calls[1]; call.path != "/bot123:secret/sendMessage" || call.fields["text"] != "no snapshot" {
+		t.Errorf("text call = %+v", call)
+	}
+}
+
+func TestTelegramRunnerErrors(t *testing.T) {
+	api := &fakeAPI{respond: func(apiCall) (int, string) {
+		return http.StatusTooManyRequests, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 7","parameters":{"retry_after":7}}`
+	}}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	cfg := &RunnerConfig{
+		Token:                "123:secret",
+		APIURL:               srv.URL,
+		ChatID:               "1",
+		RatePerChat:          1,
+		BurstPerChat:         3,
+		Rate:                 30,
+		MaxChats:             10,
+		MessageIDMetadataKey: "eb-telegram-message-id",
+		Timeout:              time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*TelegramRunner)
+	err = r.Process(newMessage("x", nil))
+	if delay, ok := connectors.RetryAfter(err); !ok || delay != 7*time.Second {
+		t.Errorf("Process() error = %v, want retry after 7s", err)
+	}
+
+	api.respond = func(apiCall) (int, string) {
+		return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+	}
+	err = r.Process(newMessage("x", nil))
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("Process() error = %v, want chat not found", err)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error leaks the token: %v", err)
+	}
+
+	// The transport errors don't report the URL holding the token
+	r.baseURL = "http://127.0.0.1:1/bot123:secret/"
+	err = r.Process(newMessage("x", nil))
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("Process() error = %v, want an error without the token", err)
+	}
+}
+
+func TestTelegramRunnerRatePerChat(t *testing.T) {
+	api := &fakeAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	cfg := &RunnerConfig{
+		Token:                 "123:secret",
+		APIURL:                srv.URL,
+		ChatIDFromMetadataKey: "chat",
+		RatePerChat:           10,
+		BurstPerChat:          1,
+		Rate:                  30,
+		MaxChats:              1,
+		MessageIDMetadataKey:  "eb-telegram-message-id",
+		Timeout:               time.Second,
+	}
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = runner.Close() }()
+	r := runner.(*TelegramRunner)
+
+	start := time.Now()
+	for _, chat := range []string{"a", "b", "a"} {
+		if err := r.Process(newMessage("x", map[string]string{"chat": chat})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Every chat has its own rate, and the forgotten chats start again with a full burst
+	if elapsed := time.Since(start); elapsed > 90*time.Millisecond {
+		t.Errorf("elapsed = %v, want the chats limited separately", elapsed)
+	}
+	if len(r.chats) != 1 {
+		t.Errorf("chat limiters = %d, want maxChats", len(r.chats))
+	}
+
+	start = time.Now()
+	for range 2 {
+		if err := r.Process(newMessage("x", map[string]string{"chat": "c"})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("elapsed = %v, want the second message delayed by the chat rate", elapsed)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+)
+
+const (
+	formatCSV  = "csv"
+	formatJSON = "json"
+
+	// maxTableSize bounds the size of the table files and downloads
+	maxTableSize = 64 << 20
+)
+
+// TableConfig is a lookup table: inline entries, a file or a URL of CSV or JSON data.
+// A JSON table is an object of the translations by key, or an array of records; a CSV
+// table has a header row naming the columns.
+type TableConfig struct {
+	// Entries are the inline translations by key
+	Entries map[string]any `mapstructure:"entries"`
+	// File is the path of the table
+	File string `mapstructure:"file"`
+	// URL is the http(s) URL of the table
+	URL string `mapstructure:"url" validate:"omitempty,url"`
+	// Token is the bearer token of the URL (supports env: and file: secrets)
+	Token string `mapstructure:"token"`
+	// Format is "csv" or "json" (default: the extension of the file or URL)
+	Format string `mapstructure:"format" validate:"omitempty,oneof=csv json"`
+	// KeyField is the column or record field of the keys (default: the first CSV column;
+	// required by the JSON arrays)
+	KeyField string `mapstructure:"keyField"`
+	// ValueField is the column or record field of the translations (default: the second
+	// column of the two-column CSV files, the whole record otherwise)
+	ValueField string `mapstructure:"valueField"`
+	// Delimiter is the CSV field delimiter (default: ",")
+	Delimiter string `mapstructure:"delimiter" validate:"omitempty,len=1"`
+	// IgnoreCase matches the keys case-insensitively
+	IgnoreCase bool `mapstructure:"ignoreCase"`
+}
+
+// table holds the entries of a lookup table, replaced on reload
+type table struct {
+	cfg     TableConfig
+	format  string
+	mu      sync.RWMutex
+	entries map[string]any
+	etag    string
+}
+
+func newTable(cfg TableConfig) (*table, error) {
+	sources := 0
+	for _, set := range []bool{cfg.Entries != nil, cfg.File != "", cfg.URL != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, errors.New("exactly one of entries, file or url is required")
+	}
+	t := &table{cfg: cfg, format: cfg.Format}
+	if cfg.URL != "" {
+		parsed, err := url.Parse(cfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid table URL: %w", err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, fmt.Errorf("table URL must use http or https scheme, got %q", parsed.Scheme)
+		}
+		if t.format == "" {
+			t.format = formatOf(parsed.Path)
+		}
+	}
+	if cfg.File != "" && t.format == "" {
+		t.format = formatOf(cfg.File)
+	}
+	if cfg.Entries == nil && t.format == "" {
+		return nil, errors.New("format is required when not given by the extension")
+	}
+	if cfg.Entries != nil {
+		t.entries = t.normalize(cfg.Entries)
+	}
+	return t, nil
+}
+
+// formatOf returns the format of the extension of the name, if known
+func formatOf(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".csv":
+		return formatCSV
+	case ".json":
+		return formatJSON
+	}
+	return ""
+}
+
+// lookup returns the translation of the key
+func (t *table) lookup(key string) (any, bool) {
+	if t.cfg.IgnoreCase {
+		key = strings.ToLower(key)
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	v, ok := t.entries[key]
+	return v, ok
+}
+
+// normalize lowers the keys of the case-insensitive tables
+func (t *table) normalize(entries map[string]any) map[string]any {
+	if !t.cfg.IgnoreCase {
+		return entries
+	}
+	lowered := make(map[string]any, len(entries))
+	for k, v := range entries {
+		lowered[strings.ToLower(k)] = v
+	}
+	return lowered
+}
+
+// load reads the table from its file or URL and replaces its entries
+func (r *TranslateRunner) load(t *table) error {
+	if t.cfg.Entries != nil {
+		return nil
+	}
+
+	var data []byte
+	etag := ""
+	if t.cfg.File != "" {
+		content, err := os.ReadFile(t.cfg.File)
+		if err != nil {
+			return fmt.Errorf("failed to read table file: %w", err)
+		}
+		data = content
+	} else {
+		content, newETag, err := r.fetch(t)
+		if err != nil {
+			return err
+		}
+		if content == nil {
+			// Not modified since the last fetch
+			return nil
+		}
+		data, etag = content, newETag
+	}
+	if len(data) > maxTableSize {
+		return fmt.Errorf("table size exceeds limit %d", maxTableSize)
+	}
+
+	var entries map[string]any
+	var err error
+	if t.format == formatCSV {
+		entries, err = parseCSV(data, t.cfg)
+	} else {
+		entries, err = parseJSON(data, t.cfg)
+	}
+	if err != nil {
+		return err
+	}
+	entries = t.normalize(entries)
+
+	t.mu.Lock()
+	t.entries = entries
+	t.etag = etag
+	t.mu.Unlock()
+	r.slog.Debug("table loaded", "file", t.cfg.File, "url", t.cfg.URL, "entries", len(entries))
+	return nil
+}
+
+// fetch downloads the table, returning nil when not modified
+func (r *TranslateRunner) fetch(t *table) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.cfg.URL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create table request: %w", err)
+	}
+	token, err := secrets.Resolve(t.cfg.Token)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve table token: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	t.mu.RLock()
+	if t.etag != "" {
+		req.Header.Set("If-None-Match", t.etag)
+	}
+	t.mu.RUnlock()
+
+	// URL scheme is validated in newTable; SSRF risk is accepted as this is a user-configured endpoint.
+	resp, err := r.httpClient.Do(req) //nolint:gosec
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch table: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			r.slog.Warn("failed to close response body", "error", closeErr)
+		}
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, "", nil
+	default:
+		return nil, "", fmt.Errorf("unexpected table status code: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTableSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read table: %w", err)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// parseCSV reads the rows of a CSV table with a header row
+func parseCSV(data []byte, cfg TableConfig) (map[string]any, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	if cfg.Delimiter != "" {
+		reader.Comma, _ = utf8.DecodeRuneInString(cfg.Delimiter)
+	}
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV table: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("CSV table has no header row")
+	}
+
+	header := rows[0]
+	keyCol, valueCol := 0, -1
+	if cfg.KeyField != "" {
+		if keyCol = slices.Index(header, cfg.KeyField); keyCol < 0 {
+			return nil, fmt.Errorf("CSV table has no column %q", cfg.KeyField)
+		}
+	}
+	switch {
+	case cfg.ValueField != "":
+		if valueCol = slices.Index(header, cfg.ValueField); valueCol < 0 {
+			return nil, fmt.Errorf("CSV table has no column %q", cfg.ValueField)
+		}
+	case len(header) == 2:
+		valueCol = 1 - keyCol
+	}
+
+	entries := make(map[string]any, len(rows)-1)
+	for _, row := range rows[1:] {
+		if valueCol >= 0 {
+			entries[row[keyCol]] = row[valueCol]
+			continue
+		}
+		record := make(map[string]any, len(header))
+		for i, name := range header {
+			record[name] = row[i]
+		}
+		entries[row[keyCol]] = record
+	}
+	return entries, nil
+}
+
+// parseJSON reads a JSON table: an object of the translations by key, or an array of records
+func parseJSON(data []byte, cfg TableConfig) (map[string]any, error) {
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON table: %w", err)
+	}
+
+	switch v := decoded.(type) {
+	case map[string]any:
+		if cfg.KeyField != "" || cfg.ValueField != "" {
+			return nil, errors.New("keyField and valueField are not supported by the JSON object tables")
+		}
+		return v, nil
+	case []any:
+		if cfg.KeyField == "" {
+			return nil, errors.New("keyField is required by the JSON array tables")
+		}
+		entries := make(map[string]any, len(v))
+		for i, item := range v {
+			record, ok := item.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("JSON table record %d is not an object", i)
+			}
+			key, err := keyString(record[cfg.KeyField])
+			if err != nil {
+				return nil, fmt.Errorf("JSON table record %d: %w", i, err)
+			}
+			if cfg.ValueField == "" {
+				entries[key] = record
+				continue
+			}
+			value, ok := record[cfg.ValueField]
+			if !ok {
+				return nil, fmt.Errorf("JSON table record %d has no field %q", i, cfg.ValueField)
+			}
+			entries[key] = value
+		}
+		return entries, nil
+	default:
+		return nil, errors.New("JSON table must be an object or an array of records")
+	}
+}
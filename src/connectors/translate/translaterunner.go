@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/jsonpath"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure TranslateRunner implements connectors.Runner
+var _ connectors.Runner = &TranslateRunner{}
+
+const (
+	fromData     = "data"
+	fromMetadata = "metadata"
+
+	onMissKeep    = "keep"
+	onMissDrop    = "drop"
+	onMissDefault = "default"
+	onMissError   = "error"
+)
+
+// Field is a message field translated through a table
+type Field struct {
+	// From is the message part of the field: "data" (JSON payload, default) or "metadata"
+	From string `mapstructure:"from" validate:"omitempty,oneof=data metadata"`
+	// Path is the dotted JSON path (e.g. "item.sku") or the metadata key of the looked up value
+	Path string `mapstructure:"path" validate:"required"`
+	// Table is the name of the table
+	Table string `mapstructure:"table" validate:"required"`
+	// Target is the path or metadata key the translation is written to (default: Path)
+	Target string `mapstructure:"target"`
+	// OnMiss is applied to the values missing from the table: "keep" (default, the target is
+	// left unchanged), "drop" (the target is removed), "default" (the target is set to Default)
+	// or "error" (the message fails)
+	OnMiss string `mapstructure:"onMiss" validate:"omitempty,oneof=keep drop default error"`
+	// Default is the translation of the missing values with the "default" policy
+	Default any `mapstructure:"default"`
+}
+
+type RunnerConfig struct {
+	// Tables are the lookup tables by name
+	Tables map[string]TableConfig `mapstructure:"tables" validate:"required,min=1,dive"`
+	// Fields are the translated fields, in order: a field can look up the translation of a previous one
+	Fields []Field `mapstructure:"fields" validate:"required,min=1,dive"`
+	// RefreshInterval reloads the tables of files and URLs periodically (0 = disabled); on
+	// failure the previous entries of the table stay in use
+	RefreshInterval time.Duration `mapstructure:"refreshInterval" default:"0s" validate:"min=0"`
+	// Timeout bounds the download of the tables
+	Timeout time.Duration `mapstructure:"timeout" default:"30s" validate:"gt=0"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+type TranslateRunner struct {
+	cfg        *RunnerConfig
+	slog       *slog.Logger
+	httpClient *http.Client
+	tables     map[string]*table
+	decodeData bool
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a translate runner, loading its tables
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	r := &TranslateRunner{
+		cfg:        cfg,
+		slog:       slog.Default().With("context", "Translate Runner"),
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		tables:     make(map[string]*table, len(cfg.Tables)),
+		stopCh:     make(chan struct{}),
+	}
+	for name, tcfg := range cfg.Tables {
+		t, err := newTable(tcfg)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		r.tables[name] = t
+	}
+	for i := range cfg.Fields {
+		f := &cfg.Fields[i]
+		if r.tables[f.Table] == nil {
+			return nil, fmt.Errorf("field %s: unknown table %q", f.Path, f.Table)
+		}
+		if f.From == "" {
+			f.From = fromData
+		}
+		if f.Target == "" {
+			f.Target = f.Path
+		}
+		if f.OnMiss == "" {
+			f.OnMiss = onMissKeep
+		}
+		if f.OnMiss == onMissDefault && f.Default == nil {
+			return nil, fmt.Errorf("field %s: default is required with the default miss policy", f.Path)
+		}
+		if f.From == fromData {
+			r.decodeData = true
+		}
+	}
+
+	for name, t := range r.tables {
+		if err := r.load(t); err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+	}
+	if cfg.RefreshInterval > 0 {
+		go r.refreshLoop()
+	}
+
+	r.slog.Info("translate runner created",
+		"tables", len(cfg.Tables),
+		"fields", len(cfg.Fields),
+		"refreshInterval", cfg.RefreshInterval,
+	)
+	return r, nil
+}
+
+// refreshLoop periodically reloads the tables of files and URLs in the background
+func (r *TranslateRunner) refreshLoop() {
+	ticker := time.NewTicker(r.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for name, t := range r.tables {
+				if t.cfg.Entries != nil {
+					continue
+				}
+				if err := r.load(t); err != nil {
+					r.slog.Error("table refresh failed", "table", name, "error", err)
+				}
+			}
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// Process translates the fields of the message
+func (r *TranslateRunner) Process(msg *message.RunnerMessage) error {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+
+	var payload map[string]any
+	if r.decodeData {
+		if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+			return fmt.Errorf("payload size %d exceeds limit %d", len(data), r.cfg.MaxInputSize)
+		}
+		if err := json.Unmarshal(data, &payload); err != nil || payload == nil {
+			return errors.New("payload must be a JSON object")
+		}
+	}
+	meta = maps.Clone(meta)
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+
+	for _, f := range r.cfg.Fields {
+		if err := r.translate(f, payload, meta); err != nil {
+			return err
+		}
+	}
+
+	if r.decodeData {
+		out, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		msg.SetData(out)
+	}
+	msg.SetMetadata(meta)
+	return nil
+}
+
+// translate looks up the value of the field and writes its translation to the target
+func (r *TranslateRunner) translate(f Field, payload map[string]any, meta map[string]string) error {
+	var key string
+	var ok bool
+	if f.From == fromMetadata {
+		key, ok = meta[f.Path]
+	} else {
+		var v any
+		if v, ok = jsonpath.Get(payload, f.Path); ok && v != nil {
+			var err error
+			if key, err = keyString(v); err != nil {
+				return fmt.Errorf("field %s: %w", f.Path, err)
+			}
+		}
+	}
+
+	value, found := any(nil), false
+	if ok {
+		value, found = r.tables[f.Table].lookup(key)
+	}
+	if !found {
+		switch f.OnMiss {
+		case onMissKeep:
+			return nil
+		case onMissDrop:
+			if f.From == fromMetadata {
+				delete(meta, f.Target)
+			} else {
+				jsonpath.Delete(payload, f.Target)
+			}
+			return nil
+		case onMissError:
+			return fmt.Errorf("field %s: value %q not found in table %s", f.Path, key, f.Table)
+		}
+		value = f.Default
+	}
+
+	if f.From == fromMetadata {
+		s, err := metadataString(value)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Path, err)
+		}
+		meta[f.Target] = s
+		return nil
+	}
+	if !jsonpath.Set(payload, f.Target, value) {
+		return fmt.Errorf("field %s: target %s is not in an object", f.Path, f.Target)
+	}
+	return nil
+}
+
+// keyString converts a decoded JSON scalar to a lookup key
+func keyString(v any) (string, error) {
+	key, ok := jsonpath.ScalarString(v)
+	if !ok {
+		return "", fmt.Errorf("lookup value must be a scalar, got %T", v)
+	}
+	return key, nil
+}
+
+// metadataString converts a translation to a metadata value: strings are kept, other
+// values are JSON encoded
+func metadataString(v any) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode translation: %w", err)
+	}
+	return string(encoded), nil
+}
+
+func (r *TranslateRunner) Close() error {
+	r.slog.Info("closing translate runner")
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestTranslateRunner(t *testing.T) {
+	families := writeFile(t, "families.csv", "sku,name,family\nA-1,Bolt,hardware\nB-2,Glue,chemicals\n")
+	countries := writeFile(t, "countries.json", `[{"code":"IT","name":"Italy","eu":true},{"code":"US","name":"United States","eu":false}]`)
+	tables := &RunnerConfig{
+		Tables: map[string]TableConfig{
+			"families":  {File: families, KeyField: "sku", ValueField: "family"},
+			"countries": {File: countries, KeyField: "code"},
+			"status":    {Entries: map[string]any{"1": "active", "2": "suspended"}, IgnoreCase: true},
+			"labels":    {Entries: map[string]any{"hardware": "Hardware & Tools"}},
+		},
+		Fields: []Field{
+			{Path: "item.sku", Table: "families", Target: "item.family"},
+			{Path: "item.family", Table: "labels", Target: "item.label"},
+			{Path: "country", Table: "countries", Target: "geo.country"},
+			{Path: "status", Table: "status"},
+			{From: fromMetadata, Path: "x-country", Table: "countries", Target: "x-country-info"},
+		},
+		Timeout: time.Second,
+	}
+	policies := &RunnerConfig{
+		Tables: map[string]TableConfig{"codes": {Entries: map[string]any{"a": "Alpha"}}},
+		Fields: []Field{
+			{Path: "keep", Table: "codes"},
+			{Path: "drop", Table: "codes", OnMiss: onMissDrop},
+			{Path: "fallback", Table: "codes", OnMiss: onMissDefault, Default: "Unknown"},
+			{From: fromMetadata, Path: "code", Table: "codes", Target: "label", OnMiss: onMissDrop},
+		},
+		Timeout: time.Second,
+	}
+
+	tests := []struct {
+		name     string
+		cfg      *RunnerConfig
+		payload  string
+		meta     map[string]string
+		want     string
+		wantMeta map[string]string
+	}{
+		{
+			name:    "tables",
+			cfg:     tables,
+			payload: `{"item":{"sku":"A-1"},"country":"IT","status":2}`,
+			meta:    map[string]string{"x-country": "US"},
+			want: `{"item":{"sku":"A-1","family":"hardware","label":"Hardware & Tools"},"country":"IT",
+				"geo":{"country":{"code":"IT","name":"Italy","eu":true}},"status":"suspended"}`,
+			wantMeta: map[string]string{"x-country": "US", "x-country-info": `{"code":"US","eu":false,"name":"United States"}`},
+		},
+		{
+			name:     "miss policies",
+			cfg:      policies,
+			payload:  `{"keep":"x","drop":"y","fallback":"z"}`,
+			meta:     map[string]string{"code": "q", "label": "stale"},
+			want:     `{"keep":"x","fallback":"Unknown"}`,
+			wantMeta: map[string]string{"code": "q"},
+		},
+		{
+			// The missing fields are misses
+			name:    "missing fields",
+			cfg:     policies,
+			payload: `{"keep":"a"}`,
+			want:    `{"keep":"Alpha","fallback":"Unknown"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRunner(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewRunner() unexpected error = %v", err)
+			}
+			t.Cleanup(func() { _ = r.Close() })
+			msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(tt.payload), tt.meta))
+			if err := r.Process(msg); err != nil {
+				t.Fatalf("Process() unexpected error = %v", err)
+			}
+			meta, data, _ := msg.GetMetadataAndData()
+			var got, want any
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("invalid payload %s: %v", data, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("payload = %s, want %s", data, tt.want)
+			}
+			if !maps.Equal(meta, tt.wantMeta) {
+				t.Errorf("metadata = %v, want %v", meta, tt.wantMeta)
+			}
+		})
+	}
+}
+
+func TestTranslateRunnerErrors(t *testing.T) {
+	r, err := NewRunner(&RunnerConfig{
+		Tables:  map[string]TableConfig{"codes": {Entries: map[string]any{"a": "Alpha"}}},
+		Fields:  []Field{{Path: "code", Table: "codes", OnMiss: onMissError}},
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	for payload, want := range map[string]string{
+		`{"code":"b"}`: `value "b" not found in table codes`,
+		`[1]`:          "JSON object",
+	} {
+		err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(payload), nil)))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Process(%s) error = %v, want %q", payload, err, want)
+		}
+	}
+}
+
+func TestTranslateURLRefresh(t *testing.T) {
+	var mu sync.Mutex
+	table := `{"a":"first"}`
+	etag := `"v1"`
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(table))
+	}))
+	defer srv.Close()
+
+	r, err := NewRunner(&RunnerConfig{
+		Tables:          map[string]TableConfig{"codes": {URL: srv.URL + "/codes", Format: "json", Token: "secret"}},
+		Fields:          []Field{{From: fromMetadata, Path: "code", Table: "codes", Target: "label"}},
+		RefreshInterval: 20 * time.Millisecond,
+		Timeout:         time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	label := func() string {
+		msg := message.NewRunnerMessage(testutil.NewAdapter(nil, map[string]string{"code": "a"}))
+		if err := r.Process(msg); err != nil {
+			t.Fatalf("Process() unexpected error = %v", err)
+		}
+		meta, _ := msg.GetMetadata()
+		return meta["label"]
+	}
+	if got := label(); got != "first" {
+		t.Errorf("label = %q", got)
+	}
+
+	mu.Lock()
+	table, etag = `{"a":"second"}`, `"v2"`
+	mu.Unlock()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if label() == "second" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("table not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A failed reload keeps the previous entries
+	mu.Lock()
+	table, etag = `not json`, `"v3"`
+	mu.Unlock()
+	time.Sleep(60 * time.Millisecond)
+	if got := label(); got != "second" {
+		t.Errorf("label after failed reload = %q", got)
+	}
+}
+
+func TestTableParsing(t *testing.T) {
+	entries, err := parseCSV([]byte("code;label\nA; Alpha\n"), TableConfig{Delimiter: ";"})
+	if err != nil || len(entries) != 1 || entries["A"] != "Alpha" {
+		t.Errorf("parseCSV() = %v, %v", entries, err)
+	}
+	entries, err = parseCSV([]byte("id,a,b\n1,x,y\n"), TableConfig{})
+	if err != nil || entries["1"].(map[string]any)["b"] != "y" {
+		t.Errorf("parseCSV() records = %v, %v", entries, err)
+	}
+	if _, err := parseCSV([]byte("code,label\n"), TableConfig{ValueField: "name"}); err == nil {
+		t.Error("expected missing column error")
+	}
+	if _, err := parseJSON([]byte(`[{"name":"x"}]`), TableConfig{}); err == nil {
+		t.Error("expected missing keyField error")
+	}
+	if _, err := parseJSON([]byte(`"x"`), TableConfig{}); err == nil {
+		t.Error("expected invalid table error")
+	}
+}
+
+func TestTranslateConfigValidation(t *testing.T) {
+	for name, opts := range map[string]map[string]any{
+		"unknown table": {
+			"tables": map[string]any{"a": map[string]any{"entries": map[string]any{}}},
+			"fields": []any{map[string]any{"path": "x", "table": "b"}},
+		},
+		"two sources": {
+			"tables": map[string]any{"a": map[string]any{"entries": map[string]any{}, "file": "a.csv"}},
+			"fields": []any{map[string]any{"path": "x", "table": "a"}},
+		},
+		"unknown format": {
+			"tables": map[string]any{"a": map[string]any{"file": "a.txt"}},
+			"fields": []any{map[string]any{"path": "x", "table": "a"}},
+		},
+		"missing default": {
+			"tables": map[string]any{"a": map[string]any{"entries": map[string]any{}}},
+			"fields": []any{map[string]any{"path": "x", "table": "a", "onMiss": "default"}},
+		},
+		"missing file": {
+			"tables": map[string]any{"a": map[string]any{"file": "/nonexistent/a.csv"}},
+			"fields": []any{map[string]any{"path": "x", "table": "a"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := new(RunnerConfig)
+			if err := utils.ParseConfig(opts, cfg); err != nil {
+				return
+			}
+			if r, err := NewRunner(cfg); err == nil {
+				_ = r.Close()
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sandrolain/events-bridge/src/common"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure ValidateRunner implements connectors.Runner
+var _ connectors.Runner = &ValidateRunner{}
+
+const (
+	onInvalidAnnotate = "annotate"
+	onInvalidFail     = "fail"
+	onInvalidRoute    = "route"
+
+	// wildcard is the path segment matching every element of an array or every value of an object
+	wildcard = "*"
+)
+
+// Violation codes reported in the errors metadata
+const (
+	codeRequired = "required"
+	codeType     = "type"
+	codeFormat   = "format"
+	codePattern  = "pattern"
+	codeRange    = "range"
+	codeLength   = "length"
+	codeEnum     = "enum"
+)
+
+// Rule validates the values at a JSON path
+type Rule struct {
+	// Path is the dotted path of the values (e.g. "user.email"); numeric segments index arrays
+	// and "*" matches every array element or object value (e.g. "items.*.sku")
+	Path string `mapstructure:"path" validate:"required"`
+	// Required reports a violation when the value is missing or null
+	Required bool `mapstructure:"required"`
+	// Type is the JSON type: "string", "number", "integer", "boolean", "object" or "array"
+	Type string `mapstructure:"type" validate:"omitempty,oneof=string number integer boolean object array"`
+	// Format is the format of string values: "email", "url" or "uuid"
+	Format string `mapstructure:"format" validate:"omitempty,oneof=email url uuid"`
+	// Pattern is a regular expression the string values must match
+	Pattern string `mapstructure:"pattern"`
+	// Min and Max are the allowed range of numeric values
+	Min *float64 `mapstructure:"min"`
+	Max *float64 `mapstructure:"max"`
+	// MinLength and MaxLength bound the length of strings (in characters) and arrays
+	MinLength *int `mapstructure:"minLength" validate:"omitempty,min=0"`
+	MaxLength *int `mapstructure:"maxLength" validate:"omitempty,min=0"`
+	// Enum are the allowed values, compared with their string form
+	Enum []string `mapstructure:"enum"`
+	// Message replaces the violation messages of the rule
+	Message string `mapstructure:"message"`
+}
+
+type RunnerConfig struct {
+	// Rules are the validation rules, all of them are checked
+	Rules []Rule `mapstructure:"rules" validate:"required,min=1,dive"`
+	// OnInvalid is the action on invalid payloads: "annotate" (only report), "fail" (the message
+	// fails and is naked) or "route" (set Route in the RouteKey metadata)
+	OnInvalid string `mapstructure:"onInvalid" default:"annotate" validate:"oneof=annotate fail route"`
+	// Route is the routing key of the invalid messages with the "route" action
+	Route string `mapstructure:"route" validate:"required_if=OnInvalid route"`
+	// RouteKey is the metadata key of the routing key, read by targets through their *FromMetadataKey options
+	RouteKey string `mapstructure:"routeKey" default:"eb-routing-key" validate:"required"`
+	// ValidKey is the metadata key set to "true" or "false", e.g. for a filterExpr dropping invalid messages
+	ValidKey string `mapstructure:"validKey" default:"eb-valid" validate:"required"`
+	// ErrorsKey is the metadata key of the JSON list of violations, set on invalid payloads
+	ErrorsKey string `mapstructure:"errorsKey" default:"eb-validation-errors" validate:"required"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+// violation is a failed check of a value
+type violation struct {
+	Path    string `json:"path"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// compiledRule is a rule with its path segments and compiled pattern
+type compiledRule struct {
+	Rule
+	segments []string
+	pattern  *regexp.Regexp
+	enum     map[string]bool
+}
+
+type ValidateRunner struct {
+	cfg      *RunnerConfig
+	rules    []compiledRule
+	validate *validator.Validate
+	slog     *slog.Logger
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a new instance of ValidateRunner, compiling the rule patterns
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	rules := make([]compiledRule, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		cr := compiledRule{Rule: rule, segments: strings.Split(rule.Path, ".")}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern of rule %s: %w", rule.Path, err)
+			}
+			cr.pattern = re
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return nil, fmt.Errorf("invalid range of rule %s: min is greater than max", rule.Path)
+		}
+		if len(rule.Enum) > 0 {
+			cr.enum = make(map[string]bool, len(rule.Enum))
+			for _, v := range rule.Enum {
+				cr.enum[v] = true
+			}
+		}
+		rules[i] = cr
+	}
+
+	log := slog.Default().With("context", "Validate Runner")
+	log.Info("loading validation rules", "rules", len(rules), "onInvalid", cfg.OnInvalid)
+
+	return &ValidateRunner{
+		cfg:      cfg,
+		rules:    rules,
+		validate: validator.New(),
+		slog:     log,
+	}, nil
+}
+
+// Process validates the payload and reports the violations in metadata; the payload is not modified
+func (r *ValidateRunner) Process(msg *message.RunnerMessage) error {
+	data, err := msg.GetData()
+	if err != nil {
+		return fmt.Errorf("failed to get data: %w", err)
+	}
+	if len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds max input size %d", len(data), r.cfg.MaxInputSize)
+	}
+	var payload any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return fmt.Errorf("payload must be JSON: %w", err)
+	}
+
+	var violations []violation
+	for _, rule := range r.rules {
+		violations = append(violations, r.check(payload, rule)...)
+	}
+
+	if len(violations) == 0 {
+		msg.AddMetadata(r.cfg.ValidKey, "true")
+		return nil
+	}
+
+	r.slog.Debug("validation failed", "violations", len(violations))
+	if r.cfg.OnInvalid == onInvalidFail {
+		return fmt.Errorf("invalid payload: %s: %s", violations[0].Path, violations[0].Message)
+	}
+	report, err := json.Marshal(violations)
+	if err != nil {
+		return fmt.Errorf("failed to marshal violations: %w", err)
+	}
+	msg.AddMetadata(r.cfg.ValidKey, "false")
+	msg.AddMetadata(r.cfg.ErrorsKey, string(report))
+	if r.cfg.OnInvalid == onInvalidRoute {
+		msg.AddMetadata(r.cfg.RouteKey, r.cfg.Route)
+	}
+	return nil
+}
+
+// check validates the values matched by the rule path
+func (r *ValidateRunner) check(payload any, rule compiledRule) []violation {
+	var violations []violation
+	report := func(path, code, msg string) {
+		if rule.Message != "" {
+			msg = rule.Message
+		}
+		violations = append(violations, violation{Path: path, Code: code, Message: msg})
+	}
+
+	values := resolve(payload, rule.segments, nil)
+	for _, path := range slices.Sorted(maps.Keys(values)) {
+		v := values[path]
+		if v == nil {
+			if rule.Required {
+				report(path, codeRequired, "value is required")
+			}
+			continue
+		}
+		r.checkValue(path, v, rule, report)
+	}
+	return violations
+}
+
+// checkValue runs the checks of the rule on a present value
+func (r *ValidateRunner) checkValue(path string, v any, rule compiledRule, report func(path, code, msg string)) {
+	if rule.Type != "" && !isType(v, rule.Type) {
+		report(path, codeType, fmt.Sprintf("expected %s, got %s", rule.Type, typeName(v)))
+		return
+	}
+
+	if rule.Format != "" && !r.validFormat(v, rule.Format) {
+		report(path, codeFormat, fmt.Sprintf("invalid %s", rule.Format))
+	}
+	switch val := v.(type) {
+	case string:
+		if rule.pattern != nil && !rule.pattern.MatchString(val) {
+			report(path, codePattern, fmt.Sprintf("does not match %s", rule.Pattern))
+		}
+		checkLength(path, utf8.RuneCountInString(val), rule, report)
+	case json.Number:
+		n, err := val.Float64()
+		if err == nil && ((rule.Min != nil && n < *rule.Min) || (rule.Max != nil && n > *rule.Max)) {
+			report(path, codeRange, fmt.Sprintf("value %s out of range %s", val, common.RangeString(rule.Min, rule.Max)))
+		}
+	case []any:
+		checkLength(path, len(val), rule, report)
+	}
+
+	if rule.enum != nil {
+		var s string
+		switch val := v.(type) {
+		case string:
+			s = val
+		case json.Number:
+			s = val.String()
+		case bool:
+			s = strconv.FormatBool(val)
+		}
+		if !rule.enum[s] {
+			report(path, codeEnum, fmt.Sprintf("value is not one of %s", strings.Join(rule.Enum, ", ")))
+		}
+	}
+}
+
+// validFormat reports whether the value is a string of the format; URLs must be absolute with a host
+func (r *ValidateRunner) validFormat(v any, format string) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if format == "url" {
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	}
+	return r.validate.Var(s, format) == nil
+}
+
+func checkLength(path string, n int, rule compiledRule, report func(path, code, msg string)) {
+	if rule.MinLength != nil && n < *rule.MinLength {
+		report(path, codeLength, fmt.Sprintf("length %d is less than %d", n, *rule.MinLength))
+	}
+	if rule.MaxLength != nil && n > *rule.MaxLength {
+		report(path, codeLength, fmt.Sprintf("length %d is greater than %d", n, *rule.MaxLength))
+	}
+}
+
+// resolve returns the values matched by the path segments by concrete path; a missing
+// value is nil at the path of the first missing segment
+func resolve(v any, segments []string, prefix []string) map[string]any {
+	if len(segments) == 0 {
+		return map[string]any{strings.Join(prefix, "."): v}
+	}
+	seg, rest := segments[0], segments[1:]
+	at := append(prefix[:len(prefix):len(prefix)], seg)
+
+	res := map[string]any{}
+	switch node := v.(type) {
+	case map[string]any:
+		if seg == wildcard {
+			for k, child := range node {
+				for p, val := range resolve(child, rest, append(prefix[:len(prefix):len(prefix)], k)) {
+					res[p] = val
+				}
+			}
+			return res
+		}
+		return resolve(node[seg], rest, at)
+	case []any:
+		if seg == wildcard {
+			for i, child := range node {
+				for p, val := range resolve(child, rest, append(prefix[:len(prefix):len(prefix)], strconv.Itoa(i))) {
+					res[p] = val
+				}
+			}
+			return res
+		}
+		if i, err := strconv.Atoi(seg); err == nil && i >= 0 && i < len(node) {
+			return resolve(node[i], rest, at)
+		}
+	}
+	// The value is missing: a wildcard matches no value
+	if seg == wildcard {
+		return res
+	}
+	res[strings.Join(at, ".")] = nil
+	return res
+}
+
+// isType reports whether the decoded JSON value has the type
+func isType(v any, typ string) bool {
+	switch typ {
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	default:
+		return typeName(v) == typ
+	}
+}
+
+// typeName returns the JSON type of the decoded value
+func typeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		return "null"
+	}
+}
+
+func (r *ValidateRunner) Close() error {
+	return nil
+}
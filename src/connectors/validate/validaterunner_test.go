@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+var orderRules = []Rule{
+	{Path: "id", Required: true, Format: "uuid"},
+	{Path: "customer.email", Required: true, Format: "email"},
+	{Path: "callback", Format: "url"},
+	{Path: "items", Required: true, Type: "array", MinLength: ptr(1)},
+	{Path: "items.*.sku", Required: true, Pattern: "^[A-Z]{3}-[0-9]+$"},
+	{Path: "items.*.qty", Type: "integer", Min: ptr(1.0), Max: ptr(100.0)},
+	{Path: "status", Enum: []string{"new", "paid"}, Message: "unknown status"},
+}
+
+var emailRules = []Rule{{Path: "email", Required: true, Format: "email"}}
+
+func TestValidateRunner(t *testing.T) {
+	tests := []struct {
+		name           string
+		rules          []Rule
+		onInvalid      string
+		payload        string
+		wantMeta       map[string]string
+		wantViolations []string
+		// wantMessage is the message of the last violation
+		wantMessage string
+	}{
+		{
+			name:  "valid payload",
+			rules: orderRules,
+			payload: `{
+				"id": "7c9e6679-7425-40de-944b-e07fc1f90ae7",
+				"customer": {"email": "ada@example.com"},
+				"callback": "https://hooks.example.com/orders",
+				"items": [{"sku": "ABC-1", "qty": 2}, {"sku": "XYZ-22", "qty": 100}],
+				"status": "paid"
+			}`,
+			wantMeta: map[string]string{"eb-valid": "true"},
+		},
+		{
+			name:  "violations report",
+			rules: orderRules,
+			payload: `{
+				"id": "not-a-uuid",
+				"customer": {"email": "ada at example"},
+				"callback": "/relative",
+				"items": [{"sku": "abc", "qty": 0}, {"qty": 1.5}],
+				"status": "lost"
+			}`,
+			wantMeta: map[string]string{"eb-valid": "false"},
+			wantViolations: []string{
+				"id:format",
+				"customer.email:format",
+				"callback:format",
+				"items.0.sku:pattern",
+				"items.1.sku:required",
+				"items.0.qty:range",
+				"items.1.qty:type",
+				"status:enum",
+			},
+			wantMessage: "unknown status",
+		},
+		{
+			name:           "empty array",
+			rules:          orderRules,
+			payload:        `{"items": []}`,
+			wantMeta:       map[string]string{"eb-valid": "false"},
+			wantViolations: []string{"id:required", "customer.email:required", "items:length"},
+		},
+		{
+			name:           "route invalid",
+			rules:          emailRules,
+			onInvalid:      onInvalidRoute,
+			payload:        `{"email": null}`,
+			wantMeta:       map[string]string{"eb-valid": "false", "eb-routing-key": "invalid"},
+			wantViolations: []string{"email:required"},
+		},
+		{
+			// Valid messages are not routed
+			name:      "route valid",
+			rules:     emailRules,
+			onInvalid: onInvalidRoute,
+			payload:   `{"email": "ada@example.com"}`,
+			wantMeta:  map[string]string{"eb-valid": "true", "eb-routing-key": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRunner(&RunnerConfig{
+				Rules:        tt.rules,
+				OnInvalid:    tt.onInvalid,
+				Route:        "invalid",
+				RouteKey:     "eb-routing-key",
+				ValidKey:     "eb-valid",
+				ErrorsKey:    "eb-validation-errors",
+				MaxInputSize: 1024,
+			})
+			if err != nil {
+				t.Fatalf("failed to create runner: %v", err)
+			}
+			msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(tt.payload), nil))
+			if err := r.Process(msg); err != nil {
+				t.Fatalf("process failed: %v", err)
+			}
+			meta, data, err := msg.GetMetadataAndData()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.payload {
+				t.Errorf("payload modified: %s", data)
+			}
+			for k, v := range tt.wantMeta {
+				if meta[k] != v {
+					t.Errorf("metadata %s = %q, want %q", k, meta[k], v)
+				}
+			}
+
+			var violations []violation
+			if report, ok := meta["eb-validation-errors"]; ok {
+				if err := json.Unmarshal([]byte(report), &violations); err != nil {
+					t.Fatalf("invalid report %s: %v", report, err)
+				}
+			}
+			got := make([]string, len(violations))
+			for i, v := range violations {
+				got[i] = v.Path + ":" + v.Code
+			}
+			if strings.Join(got, " ") != strings.Join(tt.wantViolations, " ") {
+				t.Errorf("unexpected violations:\n%v\nwant:\n%v", got, tt.wantViolations)
+			}
+			if tt.wantMessage != "" && violations[len(violations)-1].Message != tt.wantMessage {
+				t.Errorf("expected the custom message, got %q", violations[len(violations)-1].Message)
+			}
+		})
+	}
+}
+
+func TestValidateRunnerFail(t *testing.T) {
+	r, err := NewRunner(&RunnerConfig{
+		Rules: emailRules, OnInvalid: onInvalidFail, RouteKey: "eb-routing-key", ValidKey: "eb-valid", ErrorsKey: "eb-validation-errors", MaxInputSize: 1024,
+	})
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	err = r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(`{}`), nil)))
+	if err == nil || !strings.Contains(err.Error(), "email: value is required") {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+	if err := r.Process(message.NewRunnerMessage(testutil.NewAdapter([]byte(`not json`), nil))); err == nil {
+		t.Error("expected error for a non-JSON payload")
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, opts := range []map[string]any{
+		{},
+		{"rules": []any{map[string]any{"path": "a", "format": "phone"}}},
+		{"rules": []any{map[string]any{"path": "a"}}, "onInvalid": "route"},
+		{"rules": []any{map[string]any{"path": "a", "pattern": "("}}},
+		{"rules": []any{map[string]any{"path": "a", "min": 5, "max": 1}}},
+	} {
+		cfg := new(RunnerConfig)
+		if err := utils.ParseConfig(opts, cfg); err != nil {
+			continue
+		}
+		if _, err := NewRunner(cfg); err == nil {
+			t.Errorf("expected error for %v", opts)
+		}
+	}
+}
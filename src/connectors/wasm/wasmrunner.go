@@ -117,6 +117,9 @@ type RunnerConfig struct {
 	// DataKey is the key name for data payload in json/cbor formats
 	DataKey string `mapstructure:"dataKey" default:"data" validate:"required"`
 
+	// CBOR selects the CBOR encoding profile (e.g. core deterministic) of the cbor format
+	CBOR encdec.CBOROptions `mapstructure:"cbor"`
+
 	// Security enhancements
 
 	// MaxMemoryPages limits the WASM module's memory usage.
@@ -204,7 +207,7 @@ func NewRunner(anyCfg any) (connectors.Runner, error) {
 	log := slog.Default().With("context", "WASM Runner")
 	log.Info("loading wasm module", "path", cfg.Path)
 
-	decoder, err := encdec.NewMessageDecoder(cfg.Format, cfg.MetadataKey, cfg.DataKey)
+	decoder, err := encdec.NewMessageDecoderWithOptions(cfg.Format, cfg.MetadataKey, cfg.DataKey, &cfg.CBOR)
 	if err != nil {
 		return nil, fmt.Errorf("invalid format: %w", err)
 	}
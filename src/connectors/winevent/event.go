@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// levelNames are the names of the standard event levels
+var levelNames = map[int]string{
+	0: "information", // LogAlways
+	1: "critical",
+	2: "error",
+	3: "warning",
+	4: "information",
+	5: "verbose",
+}
+
+// Event is the JSON payload of an event. Data holds the EventData values by name;
+// unnamed values are keyed "param1", "param2", ... by position.
+type Event struct {
+	Provider     string            `json:"provider"`
+	ProviderGUID string            `json:"providerGuid,omitempty"`
+	EventID      uint32            `json:"eventId"`
+	Qualifiers   uint16            `json:"qualifiers,omitempty"`
+	Version      int               `json:"version"`
+	Level        int               `json:"level"`
+	LevelName    string            `json:"levelName"`
+	Task         int               `json:"task"`
+	Opcode       int               `json:"opcode"`
+	Keywords     string            `json:"keywords,omitempty"`
+	TimeCreated  time.Time         `json:"timeCreated"`
+	RecordID     uint64            `json:"recordId"`
+	ActivityID   string            `json:"activityId,omitempty"`
+	ProcessID    uint32            `json:"processId,omitempty"`
+	ThreadID     uint32            `json:"threadId,omitempty"`
+	Channel      string            `json:"channel"`
+	Computer     string            `json:"computer"`
+	UserID       string            `json:"userId,omitempty"`
+	Message      string            `json:"message,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	// UserData is the XML of the provider-defined UserData section
+	UserData string `json:"userData,omitempty"`
+}
+
+// xmlEvent is the XML rendering of an event
+type xmlEvent struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+			GUID string `xml:"Guid,attr"`
+		} `xml:"Provider"`
+		EventID struct {
+			Value      uint32 `xml:",chardata"`
+			Qualifiers uint16 `xml:"Qualifiers,attr"`
+		} `xml:"EventID"`
+		Version     int    `xml:"Version"`
+		Level       int    `xml:"Level"`
+		Task        int    `xml:"Task"`
+		Opcode      int    `xml:"Opcode"`
+		Keywords    string `xml:"Keywords"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		EventRecordID uint64 `xml:"EventRecordID"`
+		Correlation   struct {
+			ActivityID string `xml:"ActivityID,attr"`
+		} `xml:"Correlation"`
+		Execution struct {
+			ProcessID uint32 `xml:"ProcessID,attr"`
+			ThreadID  uint32 `xml:"ThreadID,attr"`
+		} `xml:"Execution"`
+		Channel  string `xml:"Channel"`
+		Computer string `xml:"Computer"`
+		Security struct {
+			UserID string `xml:"UserID,attr"`
+		} `xml:"Security"`
+	} `xml:"System"`
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"EventData"`
+	UserData struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"UserData"`
+}
+
+// parseEvent parses the XML rendering of an event
+func parseEvent(data string) (*Event, error) {
+	var x xmlEvent
+	if err := xml.Unmarshal([]byte(data), &x); err != nil {
+		return nil, fmt.Errorf("invalid event XML: %w", err)
+	}
+	sys := &x.System
+	e := &Event{
+		Provider:     sys.Provider.Name,
+		ProviderGUID: sys.Provider.GUID,
+		EventID:      sys.EventID.Value,
+		Qualifiers:   sys.EventID.Qualifiers,
+		Version:      sys.Version,
+		Level:        sys.Level,
+		LevelName:    levelNames[sys.Level],
+		Task:         sys.Task,
+		Opcode:       sys.Opcode,
+		Keywords:     sys.Keywords,
+		RecordID:     sys.EventRecordID,
+		ActivityID:   sys.Correlation.ActivityID,
+		ProcessID:    sys.Execution.ProcessID,
+		ThreadID:     sys.Execution.ThreadID,
+		Channel:      sys.Channel,
+		Computer:     sys.Computer,
+		UserID:       sys.Security.UserID,
+		UserData:     strings.TrimSpace(x.UserData.Inner),
+	}
+	if e.LevelName == "" {
+		e.LevelName = strconv.Itoa(sys.Level)
+	}
+	if sys.TimeCreated.SystemTime != "" {
+		ts, err := time.Parse(time.RFC3339Nano, sys.TimeCreated.SystemTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event time: %w", err)
+		}
+		e.TimeCreated = ts.UTC()
+	}
+	if len(x.EventData.Data) > 0 {
+		e.Data = make(map[string]string, len(x.EventData.Data))
+		for i, d := range x.EventData.Data {
+			name := d.Name
+			if name == "" {
+				name = "param" + strconv.Itoa(i+1)
+			}
+			e.Data[name] = d.Value
+		}
+	}
+	return e, nil
+}
+
+// bookmarkXML returns the bookmark of a record of a channel, to subscribe after it
+func bookmarkXML(channel string, recordID string) string {
+	var b strings.Builder
+	b.WriteString("<BookmarkList><Bookmark Channel='")
+	_ = xml.EscapeText(&b, []byte(channel))
+	b.WriteString("' RecordId='")
+	b.WriteString(recordID)
+	b.WriteString("' IsCurrent='true'/></BookmarkList>")
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+const testEventXML = `<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'>
+<System>
+<Provider Name='Service Control Manager' Guid='{555908d1-a6d7-4695-8e1e-26931d2012f4}' EventSourceName='Service Control Manager'/>
+<EventID Qualifiers='16384'>7036</EventID>
+<Version>0</Version>
+<Level>4</Level>
+<Task>0</Task>
+<Opcode>0</Opcode>
+<Keywords>0x8080000000000000</Keywords>
+<TimeCreated SystemTime='2023-11-14T22:13:20.1234567Z'/>
+<EventRecordID>4242</EventRecordID>
+<Correlation/>
+<Execution ProcessID='640' ThreadID='7312'/>
+<Channel>System</Channel>
+<Computer>WIN-HOST</Computer>
+<Security/>
+</System>
+<EventData>
+<Data Name='param1'>Windows Update</Data>
+<Data Name='param2'>running</Data>
+<Data>extra</Data>
+</EventData>
+</Event>`
+
+func TestParseEvent(t *testing.T) {
+	e, err := parseEvent(testEventXML)
+	if err != nil {
+		t.Fatalf("parseEvent() unexpected error = %v", err)
+	}
+	if e.Provider != "Service Control Manager" || e.EventID != 7036 || e.Qualifiers != 16384 || e.RecordID != 4242 {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if e.Level != 4 || e.LevelName != "information" || e.Channel != "System" || e.Computer != "WIN-HOST" || e.ProcessID != 640 {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if !e.TimeCreated.Equal(time.Date(2023, 11, 14, 22, 13, 20, 123456700, time.UTC)) {
+		t.Errorf("timeCreated = %v", e.TimeCreated)
+	}
+	if e.Data["param1"] != "Windows Update" || e.Data["param2"] != "running" || e.Data["param3"] != "extra" {
+		t.Errorf("unexpected data %v", e.Data)
+	}
+
+	e, err = parseEvent(`<Event><System><Level>9</Level><EventRecordID>1</EventRecordID></System><UserData><Log xmlns='x'><Path>C:\a</Path></Log></UserData></Event>`)
+	if err != nil {
+		t.Fatalf("parseEvent() unexpected error = %v", err)
+	}
+	if e.LevelName != "9" || e.UserData != `<Log xmlns='x'><Path>C:\a</Path></Log>` || e.Data != nil {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	for _, data := range []string{`not xml`, `<Event><System><TimeCreated SystemTime='yesterday'/></System></Event>`} {
+		if _, err := parseEvent(data); err == nil {
+			t.Errorf("parseEvent(%s) expected error", data)
+		}
+	}
+}
+
+func TestBookmarkXML(t *testing.T) {
+	got := bookmarkXML("App's <log>", "42")
+	var list struct {
+		Bookmark struct {
+			Channel  string `xml:"Channel,attr"`
+			RecordID string `xml:"RecordId,attr"`
+		}
+	}
+	if err := xml.Unmarshal([]byte(got), &list); err != nil {
+		t.Fatalf("invalid bookmark %s: %v", got, err)
+	}
+	if list.Bookmark.Channel != "App's <log>" || list.Bookmark.RecordID != "42" {
+		t.Errorf("unexpected bookmark %s", got)
+	}
+}
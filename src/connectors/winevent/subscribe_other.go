@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+const supported = false
+
+func subscribe(ctx context.Context, sub subscription, emit func(*Event) bool) error {
+	return errors.New("the Windows Event Log is not available on this platform")
+}
@@ -0,0 +1,199 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const supported = true
+
+const (
+	evtSubscribeToFutureEvents      = 1
+	evtSubscribeStartAtOldestRecord = 2
+	evtSubscribeStartAfterBookmark  = 3
+
+	evtRenderEventXML     = 1
+	evtFormatMessageEvent = 1
+
+	// pollInterval bounds the wait for the subscription signal, in milliseconds,
+	// in case a signal is lost between the last read and the reset of the event
+	pollInterval = 1000
+)
+
+var (
+	modwevtapi = windows.NewLazySystemDLL("wevtapi.dll")
+
+	procEvtSubscribe             = modwevtapi.NewProc("EvtSubscribe")
+	procEvtNext                  = modwevtapi.NewProc("EvtNext")
+	procEvtRender                = modwevtapi.NewProc("EvtRender")
+	procEvtClose                 = modwevtapi.NewProc("EvtClose")
+	procEvtCreateBookmark        = modwevtapi.NewProc("EvtCreateBookmark")
+	procEvtOpenPublisherMetadata = modwevtapi.NewProc("EvtOpenPublisherMetadata")
+	procEvtFormatMessage         = modwevtapi.NewProc("EvtFormatMessage")
+)
+
+// evtHandle is an EVT_HANDLE of the Windows Event Log API
+type evtHandle uintptr
+
+func evtClose(h evtHandle) {
+	if h != 0 {
+		_, _, _ = procEvtClose.Call(uintptr(h))
+	}
+}
+
+// subscribe reads the events of a channel with a pull subscription signaled by an event object
+func subscribe(ctx context.Context, sub subscription, emit func(*Event) bool) error {
+	signal, err := windows.CreateEvent(nil, 1, 1, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create signal event: %w", err)
+	}
+	defer windows.CloseHandle(signal) //nolint:errcheck
+
+	channel, err := windows.UTF16PtrFromString(sub.channel.Name)
+	if err != nil {
+		return err
+	}
+	query, err := windows.UTF16PtrFromString(sub.channel.Query)
+	if err != nil {
+		return err
+	}
+
+	var bookmark evtHandle
+	flags := uintptr(evtSubscribeToFutureEvents)
+	switch {
+	case sub.recordID != "":
+		xml, err := windows.UTF16PtrFromString(bookmarkXML(sub.channel.Name, sub.recordID))
+		if err != nil {
+			return err
+		}
+		r1, _, e := procEvtCreateBookmark.Call(uintptr(unsafe.Pointer(xml)))
+		if r1 == 0 {
+			return fmt.Errorf("failed to create bookmark: %w", e)
+		}
+		bookmark = evtHandle(r1)
+		defer evtClose(bookmark)
+		flags = evtSubscribeStartAfterBookmark
+	case sub.startAt == startAtBeginning:
+		flags = evtSubscribeStartAtOldestRecord
+	}
+
+	r1, _, e := procEvtSubscribe.Call(0, uintptr(signal), uintptr(unsafe.Pointer(channel)),
+		uintptr(unsafe.Pointer(query)), uintptr(bookmark), 0, 0, flags)
+	if r1 == 0 {
+		return fmt.Errorf("failed to subscribe to channel %s: %w", sub.channel.Name, e)
+	}
+	subHandle := evtHandle(r1)
+	defer evtClose(subHandle)
+
+	r := &renderer{renderMessage: sub.renderMessage, publishers: map[string]evtHandle{}}
+	defer r.close()
+
+	handles := make([]evtHandle, sub.batchSize)
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if _, err := windows.WaitForSingleObject(signal, pollInterval); err != nil {
+			return fmt.Errorf("failed to wait for events: %w", err)
+		}
+		for {
+			var returned uint32
+			r1, _, e := procEvtNext.Call(uintptr(subHandle), uintptr(len(handles)),
+				uintptr(unsafe.Pointer(&handles[0])), 0, 0, uintptr(unsafe.Pointer(&returned)))
+			if r1 == 0 {
+				if errors.Is(e, windows.ERROR_NO_MORE_ITEMS) {
+					_ = windows.ResetEvent(signal)
+					break
+				}
+				return fmt.Errorf("failed to read events: %w", e)
+			}
+			for i, h := range handles[:returned] {
+				event, err := r.render(h)
+				evtClose(h)
+				if err != nil {
+					return err
+				}
+				if !emit(event) {
+					for _, rest := range handles[i+1 : returned] {
+						evtClose(rest)
+					}
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// renderer renders events as XML and formats their messages
+type renderer struct {
+	renderMessage bool
+	buf           []uint16
+	publishers    map[string]evtHandle
+}
+
+func (r *renderer) render(h evtHandle) (*Event, error) {
+	if r.buf == nil {
+		r.buf = make([]uint16, 4096)
+	}
+	for {
+		var used, props uint32
+		r1, _, e := procEvtRender.Call(0, uintptr(h), evtRenderEventXML, uintptr(len(r.buf)*2),
+			uintptr(unsafe.Pointer(&r.buf[0])), uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&props)))
+		if r1 == 0 {
+			if errors.Is(e, windows.ERROR_INSUFFICIENT_BUFFER) {
+				r.buf = make([]uint16, used/2+1)
+				continue
+			}
+			return nil, fmt.Errorf("failed to render event: %w", e)
+		}
+		event, err := parseEvent(windows.UTF16ToString(r.buf[:used/2]))
+		if err != nil {
+			return nil, err
+		}
+		if r.renderMessage {
+			event.Message = r.formatMessage(h, event.Provider)
+		}
+		return event, nil
+	}
+}
+
+// formatMessage returns the message of the event formatted by its provider, or an empty
+// string when the provider metadata or the message are not available
+func (r *renderer) formatMessage(h evtHandle, provider string) string {
+	pub, ok := r.publishers[provider]
+	if !ok {
+		if name, err := windows.UTF16PtrFromString(provider); err == nil {
+			r1, _, _ := procEvtOpenPublisherMetadata.Call(0, uintptr(unsafe.Pointer(name)), 0, 0, 0)
+			pub = evtHandle(r1)
+		}
+		r.publishers[provider] = pub
+	}
+	if pub == 0 {
+		return ""
+	}
+
+	var used uint32
+	_, _, _ = procEvtFormatMessage.Call(uintptr(pub), uintptr(h), 0, 0, 0, evtFormatMessageEvent, 0, 0, uintptr(unsafe.Pointer(&used)))
+	if used == 0 {
+		return ""
+	}
+	buf := make([]uint16, used)
+	r1, _, _ := procEvtFormatMessage.Call(uintptr(pub), uintptr(h), 0, 0, 0, evtFormatMessageEvent,
+		uintptr(len(buf)), uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&used)))
+	if r1 == 0 {
+		return ""
+	}
+	return windows.UTF16ToString(buf)
+}
+
+func (r *renderer) close() {
+	for _, pub := range r.publishers {
+		evtClose(pub)
+	}
+}
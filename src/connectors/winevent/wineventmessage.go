@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/sandrolain/events-bridge/src/common/checkpoint"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &WinEventMessage{}
+
+// WinEventMessage is an event log record; its ack or nak marks the record as processed
+type WinEventMessage struct {
+	event    *Event
+	position *checkpoint.Position
+}
+
+func (m *WinEventMessage) GetID() []byte {
+	return []byte(m.event.Channel + "/" + strconv.FormatUint(m.event.RecordID, 10))
+}
+
+func (m *WinEventMessage) GetMetadata() (map[string]string, error) {
+	return map[string]string{
+		"channel":   m.event.Channel,
+		"provider":  m.event.Provider,
+		"eventId":   strconv.FormatUint(uint64(m.event.EventID), 10),
+		"level":     strconv.Itoa(m.event.Level),
+		"levelName": m.event.LevelName,
+		"recordId":  strconv.FormatUint(m.event.RecordID, 10),
+		"computer":  m.event.Computer,
+	}, nil
+}
+
+func (m *WinEventMessage) GetData() ([]byte, error) {
+	return json.Marshal(m.event)
+}
+
+func (m *WinEventMessage) Ack(data *message.ReplyData) error {
+	// The event log doesn't support reply
+	m.position.Done()
+	return nil
+}
+
+// Nak marks the record as processed too: a failed event must not block the
+// checkpoint of the following ones
+func (m *WinEventMessage) Nak() error {
+	m.position.Done()
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/checkpoint"
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	startAtEnd       = "end"
+	startAtBeginning = "beginning"
+)
+
+// ChannelConfig is a subscribed event log channel
+type ChannelConfig struct {
+	// Name is the channel (e.g. "System", "Security", "Microsoft-Windows-Sysmon/Operational")
+	Name string `mapstructure:"name" validate:"required"`
+	// Query is the XPath query selecting the events (e.g. "*[System[Level<=3]]"; default all events)
+	Query string `mapstructure:"query"`
+}
+
+// SourceConfig defines the configuration for the Windows Event Log source connector
+type SourceConfig struct {
+	// Channels are the subscribed channels
+	Channels []ChannelConfig `mapstructure:"channels" validate:"required,min=1,dive"`
+	// StartAt is the position read from without checkpoint: "end" (new events only) or "beginning"
+	StartAt string `mapstructure:"startAt" default:"end" validate:"oneof=end beginning"`
+	// RenderMessage adds the message formatted by the event provider to the payload
+	RenderMessage bool `mapstructure:"renderMessage" default:"true"`
+	// BatchSize is the number of events read at once from a subscription
+	BatchSize int `mapstructure:"batchSize" default:"100" validate:"gt=0"`
+	// CheckpointFile stores the record id of the last processed event of each channel,
+	// to resume after it on restart
+	CheckpointFile string `mapstructure:"checkpointFile"`
+	// CheckpointInterval is the interval between checkpoint file writes
+	CheckpointInterval time.Duration `mapstructure:"checkpointInterval" default:"5s" validate:"gt=0"`
+	// RestartDelay is the wait before subscribing again after a subscription error
+	RestartDelay time.Duration `mapstructure:"restartDelay" default:"5s" validate:"gt=0"`
+}
+
+// subscription is the subscription of a channel; recordID is the record the events are read
+// after (empty = StartAt). The events are passed to emit until ctx is done or emit returns false.
+type subscription struct {
+	channel       ChannelConfig
+	recordID      string
+	startAt       string
+	renderMessage bool
+	batchSize     int
+}
+
+// subscribeFunc reads the events of a subscription
+type subscribeFunc func(ctx context.Context, sub subscription, emit func(*Event) bool) error
+
+type WinEventSource struct {
+	cfg        *SourceConfig
+	slog       *slog.Logger
+	subscribe  subscribeFunc
+	checkpoint *checkpoint.File
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	c          chan *message.RunnerMessage
+}
+
+func NewSourceConfig() any {
+	return new(SourceConfig)
+}
+
+// NewSource creates a Windows Event Log source from config
+func NewSource(anyCfg any) (connectors.Source, error) {
+	cfg, ok := anyCfg.(*SourceConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	if !supported {
+		return nil, errors.New("the Windows Event Log source is only supported on Windows")
+	}
+	return newWinEventSource(cfg, subscribe)
+}
+
+func newWinEventSource(cfg *SourceConfig, subscribe subscribeFunc) (*WinEventSource, error) {
+	seen := map[string]bool{}
+	for i, ch := range cfg.Channels {
+		if seen[ch.Name] {
+			return nil, fmt.Errorf("duplicate channel %q", ch.Name)
+		}
+		seen[ch.Name] = true
+		if ch.Query == "" {
+			cfg.Channels[i].Query = "*"
+		}
+	}
+
+	file, err := checkpoint.Open(cfg.CheckpointFile)
+	if err != nil {
+		return nil, err
+	}
+	return &WinEventSource{
+		cfg:        cfg,
+		slog:       slog.Default().With("context", "WinEvent Source"),
+		subscribe:  subscribe,
+		checkpoint: file,
+	}, nil
+}
+
+func (s *WinEventSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	if s.c != nil {
+		return nil, errors.New("produce already called")
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.c = make(chan *message.RunnerMessage, buffer)
+
+	s.slog.Info("starting Windows Event Log source", "channels", len(s.cfg.Channels), "startAt", s.cfg.StartAt)
+
+	for _, ch := range s.cfg.Channels {
+		s.wg.Add(1)
+		go s.run(ch)
+	}
+	s.wg.Add(1)
+	go s.flushLoop()
+	return s.c, nil
+}
+
+// run reads the events of the channel, subscribing again after errors
+func (s *WinEventSource) run(ch ChannelConfig) {
+	defer s.wg.Done()
+	tracker := s.checkpoint.Tracker(ch.Name)
+	sub := subscription{
+		channel:       ch,
+		startAt:       s.cfg.StartAt,
+		renderMessage: s.cfg.RenderMessage,
+		batchSize:     s.cfg.BatchSize,
+	}
+	sub.recordID, _ = s.checkpoint.Get(ch.Name)
+
+	emit := func(e *Event) bool {
+		recordID := strconv.FormatUint(e.RecordID, 10)
+		msg := &WinEventMessage{event: e, position: tracker.Track(recordID)}
+		select {
+		case s.c <- message.NewRunnerMessage(msg):
+			sub.recordID = recordID
+			return true
+		case <-s.ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		err := s.subscribe(s.ctx, sub, emit)
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.slog.Error("channel subscription failed, subscribing again", "channel", ch.Name, "error", err, "delay", s.cfg.RestartDelay)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(s.cfg.RestartDelay):
+		}
+	}
+}
+
+// flushLoop writes the checkpoint file periodically
+func (s *WinEventSource) flushLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.checkpoint.Flush(); err != nil {
+				s.slog.Error("failed to write checkpoint", "error", err)
+			}
+		}
+	}
+}
+
+func (s *WinEventSource) Close() error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	s.wg.Wait()
+	close(s.c)
+	s.cancel = nil
+
+	if err := s.checkpoint.Flush(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+// fakeLog serves the events of each channel to the subscriptions after their record id
+type fakeLog struct {
+	mu     sync.Mutex
+	events map[string][]*Event
+	subs   []subscription
+	fail   bool
+}
+
+func (f *fakeLog) subscribe(ctx context.Context, sub subscription, emit func(*Event) bool) error {
+	f.mu.Lock()
+	f.subs = append(f.subs, sub)
+	fail := f.fail
+	f.fail = false
+	events := f.events[sub.channel.Name]
+	f.mu.Unlock()
+	if fail {
+		return errors.New("channel not found")
+	}
+	for _, e := range events {
+		if sub.recordID != "" && strconv.FormatUint(e.RecordID, 10) <= sub.recordID {
+			continue
+		}
+		if !emit(e) {
+			return nil
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (f *fakeLog) subscriptions() []subscription {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]subscription(nil), f.subs...)
+}
+
+func newTestSource(t *testing.T, opts map[string]any, log *fakeLog) *WinEventSource {
+	t.Helper()
+	cfg := new(SourceConfig)
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("ParseConfig() unexpected error = %v", err)
+	}
+	src, err := newWinEventSource(cfg, log.subscribe)
+	if err != nil {
+		t.Fatalf("newWinEventSource() unexpected error = %v", err)
+	}
+	return src
+}
+
+func receive(t *testing.T, c <-chan *message.RunnerMessage) *message.RunnerMessage {
+	t.Helper()
+	select {
+	case msg := <-c:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a message")
+		return nil
+	}
+}
+
+func TestWinEventSource(t *testing.T) {
+	log := &fakeLog{fail: true, events: map[string][]*Event{
+		"System": {
+			{Channel: "System", Provider: "EventLog", EventID: 6005, RecordID: 10, Level: 4, LevelName: "information"},
+			{Channel: "System", Provider: "Disk", EventID: 7, RecordID: 11, Level: 2, LevelName: "error"},
+		},
+	}}
+	checkpointFile := filepath.Join(t.TempDir(), "winevent.json")
+	opts := map[string]any{
+		"channels":           []any{map[string]any{"name": "System", "query": "*[System[Level<=4]]"}},
+		"startAt":            "beginning",
+		"checkpointFile":     checkpointFile,
+		"checkpointInterval": "1h",
+		"restartDelay":       "10ms",
+	}
+	src := newTestSource(t, opts, log)
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+
+	first, second := receive(t, c), receive(t, c)
+	meta, _ := second.GetMetadata()
+	if meta["channel"] != "System" || meta["provider"] != "Disk" || meta["eventId"] != "7" || meta["levelName"] != "error" || meta["recordId"] != "11" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+	data, _ := first.GetData()
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil || e.EventID != 6005 {
+		t.Errorf("unexpected payload %s", data)
+	}
+
+	subs := log.subscriptions()
+	if len(subs) != 2 || subs[1].startAt != "beginning" || subs[1].channel.Query != "*[System[Level<=4]]" || !subs[1].renderMessage {
+		t.Errorf("unexpected subscriptions %+v", subs)
+	}
+
+	if err := second.Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Ack(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatalf("Close() unexpected error = %v", err)
+	}
+
+	// The new subscription starts after the last processed record
+	log.events["System"] = append(log.events["System"], &Event{Channel: "System", RecordID: 12})
+	src = newTestSource(t, opts, log)
+	c, err = src.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+	meta, _ = receive(t, c).GetMetadata()
+	if meta["recordId"] != "12" {
+		t.Errorf("resumed at record %s, want 12", meta["recordId"])
+	}
+	if subs := log.subscriptions(); subs[len(subs)-1].recordID != "11" {
+		t.Errorf("subscription record id = %q, want 11", subs[len(subs)-1].recordID)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatalf("Close() unexpected error = %v", err)
+	}
+}
+
+func TestWinEventSourceConfigValidation(t *testing.T) {
+	for _, opts := range []map[string]any{
+		{},
+		{"channels": []any{map[string]any{"query": "*"}}},
+		{"channels": []any{map[string]any{"name": "System"}}, "startAt": "now"},
+	} {
+		if err := utils.ParseConfig(opts, new(SourceConfig)); err == nil {
+			t.Errorf("ParseConfig(%v) expected error", opts)
+		}
+	}
+
+	cfg := new(SourceConfig)
+	opts := map[string]any{"channels": []any{map[string]any{"name": "System"}, map[string]any{"name": "System"}}}
+	if err := utils.ParseConfig(opts, cfg); err != nil {
+		t.Fatalf("ParseConfig() unexpected error = %v", err)
+	}
+	if _, err := newWinEventSource(cfg, (&fakeLog{}).subscribe); err == nil {
+		t.Errorf("newWinEventSource() expected error for duplicate channels")
+	}
+	cfg.Channels = cfg.Channels[:1]
+	if _, err := newWinEventSource(cfg, (&fakeLog{}).subscribe); err != nil {
+		t.Fatalf("newWinEventSource() unexpected error = %v", err)
+	}
+	if cfg.Channels[0].Query != "*" {
+		t.Errorf("default query = %q, want *", cfg.Channels[0].Query)
+	}
+}
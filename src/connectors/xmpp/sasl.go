@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xdg-go/scram"
+)
+
+const (
+	mechPlain       = "PLAIN"
+	mechScramSHA1   = "SCRAM-SHA-1"
+	mechScramSHA256 = "SCRAM-SHA-256"
+
+	// scramMinIterations is the minimum PBKDF2 work accepted from the server (RFC 7677)
+	scramMinIterations = 4096
+)
+
+// saslMechanism is a client SASL mechanism
+type saslMechanism interface {
+	Name() string
+	// Start returns the initial response
+	Start() ([]byte, error)
+	// Next returns the response to a challenge
+	Next(challenge []byte) ([]byte, error)
+	// Verify checks the additional data of the success
+	Verify(data []byte) error
+}
+
+func newMechanism(name, username, password string) (saslMechanism, error) {
+	hash := scram.SHA256
+	switch name {
+	case mechPlain:
+		return &plain{username: username, password: password}, nil
+	case mechScramSHA1:
+		hash = scram.SHA1
+	}
+	client, err := hash.NewClient(username, password, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCRAM credentials: %w", err)
+	}
+	return &scramMechanism{name: name, client: client.WithMinIterations(scramMinIterations)}, nil
+}
+
+// plain is the PLAIN mechanism (RFC 4616)
+type plain struct {
+	username string
+	password string
+}
+
+func (p *plain) Name() string { return mechPlain }
+
+func (p *plain) Start() ([]byte, error) {
+	return []byte("\x00" + p.username + "\x00" + p.password), nil
+}
+
+func (p *plain) Next([]byte) ([]byte, error) {
+	return nil, errors.New("unexpected PLAIN challenge")
+}
+
+func (p *plain) Verify([]byte) error { return nil }
+
+// scramMechanism is the SCRAM mechanism (RFC 5802, RFC 7677) without channel binding
+type scramMechanism struct {
+	name   string
+	client *scram.Client
+	conv   *scram.ClientConversation
+}
+
+func (s *scramMechanism) Name() string { return s.name }
+
+func (s *scramMechanism) Start() ([]byte, error) {
+	s.conv = s.client.NewConversation()
+	first, err := s.conv.Step("")
+	return []byte(first), err
+}
+
+func (s *scramMechanism) Next(challenge []byte) ([]byte, error) {
+	if s.conv == nil {
+		return nil, errors.New("SCRAM exchange not started")
+	}
+	// Some servers send the server-final-message as a challenge, answered with an empty response
+	res, err := s.conv.Step(string(challenge))
+	return []byte(res), err
+}
+
+func (s *scramMechanism) Verify(data []byte) error {
+	if s.conv == nil {
+		return errors.New("SCRAM exchange not completed")
+	}
+	if !s.conv.Done() {
+		if _, err := s.conv.Step(string(data)); err != nil {
+			return err
+		}
+	}
+	if !s.conv.Valid() {
+		return errors.New("invalid SCRAM server signature")
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestScramVectors(t *testing.T) {
+	tests := []struct {
+		name        string
+		nonce       string
+		serverFirst string
+		clientFinal string
+		serverFinal string
+	}{
+		{
+			// RFC 5802, section 5
+			name:        mechScramSHA1,
+			nonce:       "fyko+d2lbbFgONRv9qkxdawL",
+			serverFirst: "r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+			clientFinal: "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+			serverFinal: "v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+		},
+		{
+			// RFC 7677, section 3
+			name:        mechScramSHA256,
+			nonce:       "rOprNGfwEbeRWgbNEkqO",
+			serverFirst: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			clientFinal: "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			serverFinal: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := func() saslMechanism {
+				mech, err := newMechanism(tt.name, "user", "pencil")
+				if err != nil {
+					t.Fatal(err)
+				}
+				mech.(*scramMechanism).client.WithNonceGenerator(func() string { return tt.nonce })
+				first, err := mech.Start()
+				if err != nil {
+					t.Fatalf("Start() unexpected error = %v", err)
+				}
+				if string(first) != "n,,n=user,r="+tt.nonce {
+					t.Errorf("client-first = %q", first)
+				}
+				final, err := mech.Next([]byte(tt.serverFirst))
+				if err != nil {
+					t.Fatalf("Next() unexpected error = %v", err)
+				}
+				if string(final) != tt.clientFinal {
+					t.Errorf("client-final = %q, want %q", final, tt.clientFinal)
+				}
+				return mech
+			}
+			if err := start().Verify([]byte(tt.serverFinal)); err != nil {
+				t.Errorf("Verify() unexpected error = %v", err)
+			}
+			if err := start().Verify([]byte("v=AAAA")); err == nil {
+				t.Error("Verify() expected error for a wrong server signature")
+			}
+		})
+	}
+}
+
+func TestScramInvalidChallenge(t *testing.T) {
+	for name, challenge := range map[string]string{
+		"foreign nonce": "r=other,s=QSXCR+Q6sek8bf92,i=4096",
+		"no salt":       "r=abcdef,i=4096",
+		"iterations":    "r=abcdef,s=QSXCR+Q6sek8bf92,i=1024",
+	} {
+		mech, err := newMechanism(mechScramSHA256, "user", "pencil")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mech.(*scramMechanism).client.WithNonceGenerator(func() string { return "abc" })
+		if _, err := mech.Start(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mech.Next([]byte(challenge)); err == nil {
+			t.Errorf("%s: Next() expected error", name)
+		}
+	}
+
+	mech, err := newMechanism(mechScramSHA1, "user", "pencil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mech.Verify([]byte("v=AAAA")); err == nil {
+		t.Error("Verify() expected error before the exchange")
+	}
+}
+
+func TestSelectMechanism(t *testing.T) {
+	offered := []string{mechPlain, mechScramSHA1}
+	if got, _ := selectMechanism(defaultMechanisms, offered, false); got != mechScramSHA1 {
+		t.Errorf("selectMechanism() = %q, want %q", got, mechScramSHA1)
+	}
+	if _, err := selectMechanism(defaultMechanisms, []string{mechPlain}, false); err == nil {
+		t.Error("selectMechanism() expected error for PLAIN without TLS")
+	}
+	if got, _ := selectMechanism([]string{mechPlain}, offered, true); got != mechPlain {
+		t.Errorf("selectMechanism() = %q, want %q", got, mechPlain)
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/common/secrets"
+	"github.com/sandrolain/events-bridge/src/common/tlsconfig"
+)
+
+const (
+	modeClient    = "client"
+	modeComponent = "component"
+)
+
+// xmlNamespace is the namespace of the xml: attributes, such as xml:lang
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+var defaultMechanisms = []string{mechScramSHA256, mechScramSHA1, mechPlain}
+
+// errNotConnected is returned when sending while the session is reconnecting
+var errNotConnected = errors.New("not connected to the XMPP server")
+
+// RoomConfig is a multi-user chat room (XEP-0045) joined on connection
+type RoomConfig struct {
+	// JID is the bare JID of the room (e.g. "alerts@conference.example.org")
+	JID string `mapstructure:"jid" validate:"required"`
+	// Nick is the nickname in the room
+	Nick string `mapstructure:"nick" validate:"required"`
+	// Password of password-protected rooms; supports secret references (env:, file:)
+	Password string `mapstructure:"password"` //nolint:gosec // user-configured credential field
+	// History is the number of history messages requested on join
+	History int `mapstructure:"history" validate:"min=0"`
+}
+
+// ConnectionConfig is the XMPP connection shared by the source and the target
+type ConnectionConfig struct {
+	// Mode is "client" (c2s with SASL authentication) or "component" (XEP-0114 external component)
+	Mode string `mapstructure:"mode" default:"client" validate:"oneof=client component"`
+	// Address is the server address (host:port); clients default to the JID domain on port 5222,
+	// components must set the component port of the server
+	Address string `mapstructure:"address" validate:"required_if=Mode component"`
+	// JID is the client JID (user@domain, optionally with /resource) or the component domain
+	JID string `mapstructure:"jid" validate:"required"`
+	// Password is the client password or the component secret; supports secret references (env:, file:)
+	Password string `mapstructure:"password" validate:"required"` //nolint:gosec // user-configured credential field
+	// From is the sender JID of the stanzas of a component (default: the component domain)
+	From string `mapstructure:"from"`
+	// Security is "starttls" (required STARTTLS, clients only) or "none" (plain TCP, e.g.
+	// components on localhost)
+	Security string `mapstructure:"security" default:"starttls" validate:"oneof=starttls none"`
+	// TLS configures the certificates of the TLS connection (server name defaults to the JID domain)
+	TLS *tlsconfig.Config `mapstructure:"tls"`
+	// Mechanisms are the SASL mechanisms in order of preference (default: SCRAM-SHA-256, SCRAM-SHA-1, PLAIN)
+	Mechanisms []string `mapstructure:"mechanisms" validate:"dive,oneof=SCRAM-SHA-256 SCRAM-SHA-1 PLAIN"`
+	// InsecureAuth allows PLAIN authentication without TLS
+	InsecureAuth bool `mapstructure:"insecureAuth"`
+	// Rooms are the MUC rooms joined on connection
+	Rooms []RoomConfig `mapstructure:"rooms" validate:"dive"`
+	// ConnectTimeout bounds the connection and the stream negotiation
+	ConnectTimeout time.Duration `mapstructure:"connectTimeout" default:"10s" validate:"gt=0"`
+	// WriteTimeout bounds the time to send a stanza
+	WriteTimeout time.Duration `mapstructure:"writeTimeout" default:"10s" validate:"gt=0"`
+	// KeepAlive is the interval of the whitespace keepalives (0 disables them)
+	KeepAlive time.Duration `mapstructure:"keepAlive" default:"60s" validate:"min=0"`
+	// ReconnectDelay is the wait between reconnection attempts
+	ReconnectDelay time.Duration `mapstructure:"reconnectDelay" default:"5s" validate:"gt=0"`
+}
+
+// namespace returns the default namespace of the stanzas
+func (c *ConnectionConfig) namespace() string {
+	if c.Mode == modeComponent {
+		return nsComponent
+	}
+	return nsClient
+}
+
+// domain returns the domain of the server
+func (c *ConnectionConfig) domain() string {
+	return domainPart(c.JID)
+}
+
+// stanza is a message or presence stanza
+type stanza struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	From     string     `xml:"from,attr"`
+	To       string     `xml:"to,attr"`
+	Type     string     `xml:"type,attr"`
+	ID       string     `xml:"id,attr"`
+	Body     string     `xml:"body"`
+	Subject  string     `xml:"subject"`
+	Thread   string     `xml:"thread"`
+	Show     string     `xml:"show"`
+	Status   string     `xml:"status"`
+	Priority string     `xml:"priority"`
+	Delay    *struct {
+		Stamp string `xml:"stamp,attr"`
+	} `xml:"urn:xmpp:delay delay"`
+	Error *conditionElement `xml:"error"`
+	Inner []byte            `xml:",innerxml"`
+}
+
+// raw serializes the stanza with its attributes and original content
+func (s *stanza) raw(ns string) []byte {
+	var b strings.Builder
+	b.WriteString("<" + s.XMLName.Local + " xmlns='" + ns + "'")
+	for _, attr := range [][2]string{{"from", s.From}, {"to", s.To}, {"type", s.Type}, {"id", s.ID}} {
+		if attr[1] != "" {
+			b.WriteString(" " + attr[0] + "='" + xmlEscape(attr[1]) + "'")
+		}
+	}
+	for _, attr := range s.Attrs {
+		switch {
+		case attr.Name.Space == "" && attr.Name.Local != "xmlns":
+			b.WriteString(" " + attr.Name.Local + "='" + xmlEscape(attr.Value) + "'")
+		case attr.Name.Space == xmlNamespace:
+			b.WriteString(" xml:" + attr.Name.Local + "='" + xmlEscape(attr.Value) + "'")
+		}
+	}
+	b.WriteString(">")
+	b.Write(s.Inner)
+	b.WriteString("</" + s.XMLName.Local + ">")
+	return []byte(b.String())
+}
+
+// session keeps a negotiated connection, reconnecting when it drops
+type session struct {
+	cfg       *ConnectionConfig
+	slog      *slog.Logger
+	tlsConfig *tls.Config
+	password  string
+	rooms     []RoomConfig
+	// handler receives the message and presence stanzas; nil discards them
+	handler func(*stanza)
+
+	mu     sync.RWMutex
+	conn   *conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newSession(cfg *ConnectionConfig, logger *slog.Logger, handler func(*stanza)) (*session, error) {
+	if len(cfg.Mechanisms) == 0 {
+		cfg.Mechanisms = defaultMechanisms
+	}
+	if cfg.Mode == modeComponent && cfg.Security == securityStartTLS {
+		// STARTTLS is not defined for components
+		cfg.Security = securityNone
+	}
+
+	password, err := secrets.Resolve(cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve password: %w", err)
+	}
+
+	rooms := make([]RoomConfig, len(cfg.Rooms))
+	for i, room := range cfg.Rooms {
+		if room.Password != "" {
+			if room.Password, err = secrets.Resolve(room.Password); err != nil {
+				return nil, fmt.Errorf("failed to resolve password of room %s: %w", room.JID, err)
+			}
+		}
+		rooms[i] = room
+	}
+
+	tlsConfig, err := tlsconfig.BuildClientConfigIfEnabled(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = cfg.domain()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &session{
+		cfg:       cfg,
+		slog:      logger,
+		tlsConfig: tlsConfig,
+		password:  password,
+		rooms:     rooms,
+		handler:   handler,
+		ctx:       ctx,
+		cancel:    cancel,
+	}, nil
+}
+
+// start connects to the server and keeps the session running in the background
+func (s *session) start() error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	s.wg.Add(1)
+	go s.run(c)
+	return nil
+}
+
+// connect negotiates a stream and sends the initial presence and the room joins
+func (s *session) connect() (*conn, error) {
+	c, err := dial(s.ctx, s.cfg, s.tlsConfig, s.password)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setup(c); err != nil {
+		_ = c.close()
+		return nil, err
+	}
+	s.mu.Lock()
+	s.conn = c
+	s.mu.Unlock()
+	s.slog.Info("connected to XMPP server", "jid", c.jid, "tls", c.tls)
+	return c, nil
+}
+
+func (s *session) setup(c *conn) error {
+	if s.cfg.Mode == modeClient {
+		if err := c.writeRaw("<presence/>"); err != nil {
+			return err
+		}
+	}
+	for _, room := range s.rooms {
+		var b strings.Builder
+		b.WriteString("<x xmlns='" + nsMUC + "'>")
+		b.WriteString("<history maxstanzas='" + strconv.Itoa(room.History) + "'/>")
+		if room.Password != "" {
+			b.WriteString("<password>" + xmlEscape(room.Password) + "</password>")
+		}
+		b.WriteString("</x>")
+		presence := buildStanza("presence", s.from(), bareJID(room.JID)+"/"+room.Nick, "", "", b.String())
+		if err := c.writeRaw(presence); err != nil {
+			return fmt.Errorf("failed to join room %s: %w", room.JID, err)
+		}
+	}
+	return nil
+}
+
+// run reads the stanzas of the connection, reconnecting until the session is closed
+func (s *session) run(c *conn) {
+	defer s.wg.Done()
+	for {
+		err := s.serve(c)
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+		_ = c.raw.Close()
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.slog.Warn("XMPP connection lost, reconnecting", "error", err, "delay", s.cfg.ReconnectDelay)
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(s.cfg.ReconnectDelay):
+			}
+			if c, err = s.connect(); err == nil {
+				metrics.Reconnected("xmpp")
+				break
+			}
+			s.slog.Warn("XMPP reconnection failed", "error", err)
+		}
+	}
+}
+
+// serve dispatches the stanzas of the connection until it fails
+func (s *session) serve(c *conn) error {
+	done := make(chan struct{})
+	defer close(done)
+	if s.cfg.KeepAlive > 0 {
+		go s.keepAlive(c, done)
+	}
+
+	for {
+		start, err := c.next()
+		if err != nil {
+			return err
+		}
+		switch start.Name.Local {
+		case "message", "presence":
+			st := new(stanza)
+			if err := c.dec.DecodeElement(st, &start); err != nil {
+				return err
+			}
+			if s.handler != nil {
+				s.handler(st)
+			}
+		case "iq":
+			var iq struct {
+				From  string `xml:"from,attr"`
+				To    string `xml:"to,attr"`
+				Type  string `xml:"type,attr"`
+				ID    string `xml:"id,attr"`
+				Child *struct {
+					XMLName xml.Name
+				} `xml:",any"`
+			}
+			if err := c.dec.DecodeElement(&iq, &start); err != nil {
+				return err
+			}
+			if err := s.answerIQ(c, iq.Type, iq.ID, iq.From, iq.To, iq.Child != nil && iq.Child.XMLName.Space == nsPing); err != nil {
+				return err
+			}
+		default:
+			if err := c.dec.Skip(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// answerIQ replies to pings (XEP-0199) and rejects the other requests as required by RFC 6120
+func (s *session) answerIQ(c *conn, typ, id, from, to string, ping bool) error {
+	if typ != "get" && typ != "set" {
+		return nil
+	}
+	attrs := fmt.Sprintf(" id='%s'", xmlEscape(id))
+	if from != "" {
+		attrs += fmt.Sprintf(" to='%s'", xmlEscape(from))
+	}
+	if s.cfg.Mode == modeComponent && to != "" {
+		attrs += fmt.Sprintf(" from='%s'", xmlEscape(to))
+	}
+	if ping && typ == "get" {
+		return c.writeRaw("<iq type='result'" + attrs + "/>")
+	}
+	return c.writeRaw("<iq type='error'" + attrs + "><error type='cancel'><service-unavailable xmlns='" + nsStanzas + "'/></error></iq>")
+}
+
+func (s *session) keepAlive(c *conn, done <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.KeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.writeRaw(" "); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// send writes a serialized stanza on the current connection
+func (s *session) send(raw string) error {
+	s.mu.RLock()
+	c := s.conn
+	s.mu.RUnlock()
+	if c == nil {
+		return errNotConnected
+	}
+	if err := c.writeRaw(raw); err != nil {
+		// The read loop notices the broken connection and reconnects
+		_ = c.raw.Close()
+		return fmt.Errorf("failed to send stanza: %w", err)
+	}
+	return nil
+}
+
+// jid returns the JID of the current connection
+func (s *session) jid() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.conn == nil {
+		return ""
+	}
+	return s.conn.jid
+}
+
+// from is the sender of the stanzas: set for components, stamped by the server for clients
+func (s *session) from() string {
+	if s.cfg.Mode != modeComponent {
+		return ""
+	}
+	if s.cfg.From != "" {
+		return s.cfg.From
+	}
+	return s.cfg.JID
+}
+
+// room returns the joined room of a JID
+func (s *session) room(jid string) (RoomConfig, bool) {
+	bare := bareJID(jid)
+	for _, room := range s.rooms {
+		if strings.EqualFold(bareJID(room.JID), bare) {
+			return room, true
+		}
+	}
+	return RoomConfig{}, false
+}
+
+// close leaves the rooms, closes the stream and waits for the read loop
+func (s *session) close() error {
+	s.cancel()
+	s.mu.Lock()
+	c := s.conn
+	s.conn = nil
+	s.mu.Unlock()
+	var err error
+	if c != nil {
+		for _, room := range s.rooms {
+			_ = c.writeRaw(buildStanza("presence", s.from(), bareJID(room.JID)+"/"+room.Nick, "unavailable", "", ""))
+		}
+		err = c.close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+// buildStanza serializes a stanza with the attributes that are set and the serialized content
+func buildStanza(name, from, to, typ, id, content string) string {
+	var b strings.Builder
+	b.WriteString("<" + name)
+	for _, attr := range [][2]string{{"from", from}, {"to", to}, {"type", typ}, {"id", id}} {
+		if attr[1] != "" {
+			b.WriteString(" " + attr[0] + "='" + xmlEscape(attr[1]) + "'")
+		}
+	}
+	if content == "" {
+		b.WriteString("/>")
+		return b.String()
+	}
+	b.WriteString(">" + content + "</" + name + ">")
+	return b.String()
+}
+
+// element serializes a text element, omitted when empty
+func element(name, text string) string {
+	if text == "" {
+		return ""
+	}
+	return "<" + name + ">" + xmlEscape(text) + "</" + name + ">"
+}
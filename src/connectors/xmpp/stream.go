@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // required by the XEP-0114 handshake
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	nsClient    = "jabber:client"
+	nsComponent = "jabber:component:accept"
+	nsStream    = "http://etherx.jabber.org/streams"
+	nsTLS       = "urn:ietf:params:xml:ns:xmpp-tls"
+	nsSASL      = "urn:ietf:params:xml:ns:xmpp-sasl"
+	nsBind      = "urn:ietf:params:xml:ns:xmpp-bind"
+	nsStanzas   = "urn:ietf:params:xml:ns:xmpp-stanzas"
+	nsMUC       = "http://jabber.org/protocol/muc"
+	nsPing      = "urn:xmpp:ping"
+
+	securityStartTLS = "starttls"
+	securityNone     = "none"
+)
+
+// StreamError is a stream level error sent by the server, which closes the stream
+type StreamError struct {
+	Condition string
+	Text      string
+}
+
+func (e *StreamError) Error() string {
+	if e.Text != "" {
+		return fmt.Sprintf("stream error %s: %s", e.Condition, e.Text)
+	}
+	return "stream error " + e.Condition
+}
+
+type streamFeatures struct {
+	StartTLS *struct {
+		Required *struct{} `xml:"required"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	Mechanisms *struct {
+		Mechanism []string `xml:"mechanism"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms"`
+	Bind *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+}
+
+// conditionElement decodes an element whose child name is an error condition
+type conditionElement struct {
+	Conditions []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+	Text string `xml:"text"`
+}
+
+func (c *conditionElement) condition() string {
+	if c == nil {
+		return "undefined-condition"
+	}
+	for _, cond := range c.Conditions {
+		if cond.XMLName.Local != "text" {
+			return cond.XMLName.Local
+		}
+	}
+	return "undefined-condition"
+}
+
+// conn is a negotiated XMPP stream. Writes are serialized, reads must happen on one goroutine.
+type conn struct {
+	raw  net.Conn
+	dec  *xml.Decoder
+	mu   sync.Mutex
+	ns   string
+	jid  string
+	tls  bool
+	id   string
+	idMu sync.Mutex
+	seq  int
+	// writeTimeout bounds the writes after the negotiation
+	writeTimeout time.Duration
+}
+
+// dial opens the connection and negotiates the stream: STARTTLS, SASL and resource binding
+// for clients, the XEP-0114 handshake for components
+func dial(ctx context.Context, cfg *ConnectionConfig, tlsConfig *tls.Config, password string) (*conn, error) {
+	domain := cfg.domain()
+	address := cfg.Address
+	if address == "" {
+		address = net.JoinHostPort(domain, "5222")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	raw, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	c := &conn{raw: raw, ns: cfg.namespace()}
+
+	// Bound the negotiation with the connect timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = raw.SetDeadline(deadline)
+	}
+
+	if cfg.Mode == modeComponent {
+		err = c.handshake(domain, password)
+	} else {
+		err = c.negotiateClient(ctx, cfg, tlsConfig, domain, password)
+	}
+	if err != nil {
+		_ = c.raw.Close()
+		return nil, err
+	}
+
+	_ = c.raw.SetDeadline(time.Time{})
+	c.writeTimeout = cfg.WriteTimeout
+	return c, nil
+}
+
+func (c *conn) startTLS(ctx context.Context, tlsConfig *tls.Config) error {
+	tlsConn := tls.Client(c.raw, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	c.raw = tlsConn
+	c.tls = true
+	return nil
+}
+
+// openStream sends the stream header and reads the header of the server
+func (c *conn) openStream(to string) error {
+	c.dec = xml.NewDecoder(c.raw)
+	header := fmt.Sprintf("<?xml version='1.0'?><stream:stream xmlns='%s' xmlns:stream='%s' to='%s' version='1.0'>",
+		c.ns, nsStream, xmlEscape(to))
+	if err := c.writeRaw(header); err != nil {
+		return fmt.Errorf("failed to open stream: %w", err)
+	}
+	for {
+		tok, err := c.dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to read stream header: %w", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			if start.Name.Space != nsStream || start.Name.Local != "stream" {
+				return fmt.Errorf("unexpected stream header <%s>", start.Name.Local)
+			}
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "id" {
+					c.id = attr.Value
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// next returns the next top-level element of the stream; io.EOF is returned when the
+// server closes the stream and a *StreamError for stream errors
+func (c *conn) next() (xml.StartElement, error) {
+	for {
+		tok, err := c.dec.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == nsStream && t.Name.Local == "error" {
+				var e conditionElement
+				if err := c.dec.DecodeElement(&e, &t); err != nil {
+					return xml.StartElement{}, err
+				}
+				return xml.StartElement{}, &StreamError{Condition: e.condition(), Text: e.Text}
+			}
+			return t, nil
+		case xml.EndElement:
+			return xml.StartElement{}, io.EOF
+		}
+	}
+}
+
+// expect decodes the next element, failing if it is not the named one
+func (c *conn) expect(space, local string, v any) error {
+	start, err := c.next()
+	if err != nil {
+		return err
+	}
+	if start.Name.Space != space || start.Name.Local != local {
+		_ = c.dec.Skip()
+		return fmt.Errorf("unexpected <%s> waiting for <%s>", start.Name.Local, local)
+	}
+	if v == nil {
+		return c.dec.Skip()
+	}
+	return c.dec.DecodeElement(v, &start)
+}
+
+// handshake authenticates a component with the stream id and the shared secret (XEP-0114)
+func (c *conn) handshake(domain, secret string) error {
+	if err := c.openStream(domain); err != nil {
+		return err
+	}
+	if c.id == "" {
+		return errors.New("missing stream id for the component handshake")
+	}
+	digest := sha1.Sum([]byte(c.id + secret)) //nolint:gosec // required by the XEP-0114 handshake
+	if err := c.writeRaw("<handshake>" + hex.EncodeToString(digest[:]) + "</handshake>"); err != nil {
+		return err
+	}
+	if err := c.expect(nsComponent, "handshake", nil); err != nil {
+		return fmt.Errorf("component handshake failed: %w", err)
+	}
+	c.jid = domain
+	return nil
+}
+
+func (c *conn) negotiateClient(ctx context.Context, cfg *ConnectionConfig, tlsConfig *tls.Config, domain, password string) error {
+	if err := c.openStream(domain); err != nil {
+		return err
+	}
+	var features streamFeatures
+	if err := c.expect(nsStream, "features", &features); err != nil {
+		return err
+	}
+
+	if !c.tls && cfg.Security == securityStartTLS {
+		if features.StartTLS == nil {
+			return errors.New("server does not offer STARTTLS")
+		}
+		if err := c.writeRaw("<starttls xmlns='" + nsTLS + "'/>"); err != nil {
+			return err
+		}
+		if err := c.expect(nsTLS, "proceed", nil); err != nil {
+			return fmt.Errorf("STARTTLS refused: %w", err)
+		}
+		if err := c.startTLS(ctx, tlsConfig); err != nil {
+			return err
+		}
+		if err := c.openStream(domain); err != nil {
+			return err
+		}
+		features = streamFeatures{}
+		if err := c.expect(nsStream, "features", &features); err != nil {
+			return err
+		}
+	}
+
+	if features.Mechanisms == nil {
+		return errors.New("server does not offer SASL authentication")
+	}
+	mech, err := selectMechanism(cfg.Mechanisms, features.Mechanisms.Mechanism, c.tls || cfg.InsecureAuth)
+	if err != nil {
+		return err
+	}
+	local, _, _ := strings.Cut(bareJID(cfg.JID), "@")
+	sasl, err := newMechanism(mech, local, password)
+	if err != nil {
+		return err
+	}
+	if err := c.authenticate(sasl); err != nil {
+		return err
+	}
+
+	if err := c.openStream(domain); err != nil {
+		return err
+	}
+	features = streamFeatures{}
+	if err := c.expect(nsStream, "features", &features); err != nil {
+		return err
+	}
+	if features.Bind == nil {
+		return errors.New("server does not offer resource binding")
+	}
+	return c.bind(resourcePart(cfg.JID))
+}
+
+// authenticate runs the SASL exchange of the mechanism
+func (c *conn) authenticate(mech saslMechanism) error {
+	initial, err := mech.Start()
+	if err != nil {
+		return err
+	}
+	if err := c.writeRaw(fmt.Sprintf("<auth xmlns='%s' mechanism='%s'>%s</auth>", nsSASL, mech.Name(), saslData(initial))); err != nil {
+		return err
+	}
+	for {
+		start, err := c.next()
+		if err != nil {
+			return fmt.Errorf("SASL authentication failed: %w", err)
+		}
+		switch start.Name.Local {
+		case "challenge":
+			var data string
+			if err := c.dec.DecodeElement(&data, &start); err != nil {
+				return err
+			}
+			challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+			if err != nil {
+				return fmt.Errorf("invalid SASL challenge: %w", err)
+			}
+			res, err := mech.Next(challenge)
+			if err != nil {
+				_ = c.writeRaw("<abort xmlns='" + nsSASL + "'/>")
+				return err
+			}
+			if err := c.writeRaw(fmt.Sprintf("<response xmlns='%s'>%s</response>", nsSASL, saslData(res))); err != nil {
+				return err
+			}
+		case "success":
+			var data string
+			if err := c.dec.DecodeElement(&data, &start); err != nil {
+				return err
+			}
+			final, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+			if err != nil {
+				return fmt.Errorf("invalid SASL success data: %w", err)
+			}
+			return mech.Verify(final)
+		case "failure":
+			var f conditionElement
+			if err := c.dec.DecodeElement(&f, &start); err != nil {
+				return err
+			}
+			if f.Text != "" {
+				return fmt.Errorf("SASL authentication failed: %s: %s", f.condition(), f.Text)
+			}
+			return fmt.Errorf("SASL authentication failed: %s", f.condition())
+		default:
+			_ = c.dec.Skip()
+			return fmt.Errorf("unexpected <%s> during SASL authentication", start.Name.Local)
+		}
+	}
+}
+
+// saslData encodes SASL data, with "=" for empty data
+func saslData(data []byte) string {
+	if len(data) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// bind binds the resource and stores the full JID assigned by the server
+func (c *conn) bind(resource string) error {
+	payload := "<bind xmlns='" + nsBind + "'/>"
+	if resource != "" {
+		payload = "<bind xmlns='" + nsBind + "'><resource>" + xmlEscape(resource) + "</resource></bind>"
+	}
+	var res struct {
+		Bind struct {
+			JID string `xml:"jid"`
+		} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+	}
+	if err := c.iqSet(payload, &res); err != nil {
+		return fmt.Errorf("resource binding failed: %w", err)
+	}
+	if res.Bind.JID == "" {
+		return errors.New("resource binding failed: missing JID")
+	}
+	c.jid = res.Bind.JID
+	return nil
+}
+
+// iqSet sends an iq set during the negotiation and decodes the result
+func (c *conn) iqSet(payload string, v any) error {
+	id := c.nextID()
+	if err := c.writeRaw(fmt.Sprintf("<iq type='set' id='%s'>%s</iq>", id, payload)); err != nil {
+		return err
+	}
+	var res struct {
+		Type  string           `xml:"type,attr"`
+		ID    string           `xml:"id,attr"`
+		Error conditionElement `xml:"error"`
+		Inner []byte           `xml:",innerxml"`
+	}
+	if err := c.expect(c.ns, "iq", &res); err != nil {
+		return err
+	}
+	if res.ID != id {
+		return fmt.Errorf("unexpected iq response id %q", res.ID)
+	}
+	if res.Type == "error" {
+		return fmt.Errorf("iq error: %s", res.Error.condition())
+	}
+	if v == nil || len(res.Inner) == 0 {
+		return nil
+	}
+	return xml.Unmarshal([]byte("<iq>"+string(res.Inner)+"</iq>"), v)
+}
+
+func (c *conn) nextID() string {
+	c.idMu.Lock()
+	defer c.idMu.Unlock()
+	c.seq++
+	return fmt.Sprintf("eb%d", c.seq)
+}
+
+// writeRaw writes serialized XML to the stream
+func (c *conn) writeRaw(s string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writeTimeout > 0 {
+		_ = c.raw.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	_, err := io.WriteString(c.raw, s)
+	return err
+}
+
+// close closes the stream and the connection
+func (c *conn) close() error {
+	_ = c.writeRaw("</stream:stream>")
+	return c.raw.Close()
+}
+
+// selectMechanism picks the first preferred mechanism offered by the server.
+// PLAIN is only allowed on TLS connections, unless insecure authentication is enabled.
+func selectMechanism(preferred, offered []string, plainAllowed bool) (string, error) {
+	for _, mech := range preferred {
+		if mech == mechPlain && !plainAllowed {
+			continue
+		}
+		if slices.Contains(offered, mech) {
+			return mech, nil
+		}
+	}
+	return "", fmt.Errorf("no supported SASL mechanism among %v", offered)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// bareJID strips the resource of a JID
+func bareJID(jid string) string {
+	bare, _, _ := strings.Cut(jid, "/")
+	return bare
+}
+
+// resourcePart returns the resource of a JID
+func resourcePart(jid string) string {
+	_, resource, _ := strings.Cut(jid, "/")
+	return resource
+}
+
+// domainPart returns the domain of a JID
+func domainPart(jid string) string {
+	bare := bareJID(jid)
+	if i := strings.Index(bare, "@"); i >= 0 {
+		return bare[i+1:]
+	}
+	return bare
+}
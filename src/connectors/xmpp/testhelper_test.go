@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/sha1" //nolint:gosec // XEP-0114 handshake
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testDomain   = "example.org"
+	testPassword = "secret"
+)
+
+// fakeServer is a minimal XMPP server accepting PLAIN clients or XEP-0114 components
+// without TLS, recording the stanzas it receives
+type fakeServer struct {
+	t         *testing.T
+	ln        net.Listener
+	component bool
+	received  chan *stanza
+
+	mu    sync.Mutex
+	conn  net.Conn
+	conns int
+}
+
+func newFakeServer(t *testing.T, component bool) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{t: t, ln: ln, component: component, received: make(chan *stanza, 100)}
+	go s.accept()
+	t.Cleanup(func() {
+		_ = ln.Close()
+		s.mu.Lock()
+		if s.conn != nil {
+			_ = s.conn.Close()
+		}
+		s.mu.Unlock()
+	})
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeServer) accept() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(c)
+	}
+}
+
+// send writes raw XML to the current client connection
+func (s *fakeServer) send(raw string) {
+	s.t.Helper()
+	s.mu.Lock()
+	c := s.conn
+	s.mu.Unlock()
+	if c == nil {
+		s.t.Fatal("no client connected")
+	}
+	if _, err := io.WriteString(c, raw); err != nil {
+		s.t.Fatalf("failed to send: %v", err)
+	}
+}
+
+// drop closes the current client connection
+func (s *fakeServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *fakeServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// next returns the next stanza received from the client
+func (s *fakeServer) next() *stanza {
+	s.t.Helper()
+	select {
+	case st := <-s.received:
+		return st
+	case <-time.After(2 * time.Second):
+		s.t.Fatal("no stanza received")
+		return nil
+	}
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close() //nolint:errcheck
+	w := func(raw string) { _, _ = io.WriteString(c, raw) }
+	dec := xml.NewDecoder(c)
+
+	ns := nsClient
+	if s.component {
+		ns = nsComponent
+	}
+	openStream := func() bool {
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return false
+			}
+			if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "stream" {
+				w(fmt.Sprintf("<?xml version='1.0'?><stream:stream xmlns='%s' xmlns:stream='%s' id='s1' from='%s' version='1.0'>", ns, nsStream, testDomain))
+				return true
+			}
+		}
+	}
+	nextElement := func() (xml.StartElement, bool) {
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return xml.StartElement{}, false
+			}
+			if start, ok := tok.(xml.StartElement); ok {
+				return start, true
+			}
+		}
+	}
+
+	if !openStream() {
+		return
+	}
+	if s.component {
+		start, ok := nextElement()
+		if !ok {
+			return
+		}
+		var handshake string
+		_ = dec.DecodeElement(&handshake, &start)
+		digest := sha1.Sum([]byte("s1" + testPassword)) //nolint:gosec // XEP-0114 handshake
+		if handshake != hex.EncodeToString(digest[:]) {
+			w("<stream:error><not-authorized xmlns='urn:ietf:params:xml:ns:xmpp-streams'/></stream:error></stream:stream>")
+			return
+		}
+		w("<handshake/>")
+	} else {
+		w("<stream:features><mechanisms xmlns='" + nsSASL + "'><mechanism>PLAIN</mechanism></mechanisms></stream:features>")
+		start, ok := nextElement()
+		if !ok {
+			return
+		}
+		var auth string
+		_ = dec.DecodeElement(&auth, &start)
+		creds, _ := base64.StdEncoding.DecodeString(auth)
+		if string(creds) != "\x00user\x00"+testPassword {
+			w("<failure xmlns='" + nsSASL + "'><not-authorized/><text>bad credentials</text></failure>")
+			return
+		}
+		w("<success xmlns='" + nsSASL + "'/>")
+
+		dec = xml.NewDecoder(c)
+		if !openStream() {
+			return
+		}
+		w("<stream:features><bind xmlns='" + nsBind + "'/></stream:features>")
+		start, ok = nextElement()
+		if !ok {
+			return
+		}
+		var iq struct {
+			ID       string `xml:"id,attr"`
+			Resource string `xml:"bind>resource"`
+		}
+		_ = dec.DecodeElement(&iq, &start)
+		w(fmt.Sprintf("<iq type='result' id='%s'><bind xmlns='%s'><jid>user@%s/%s</jid></bind></iq>", iq.ID, nsBind, testDomain, iq.Resource))
+	}
+
+	s.mu.Lock()
+	s.conn = c
+	s.conns++
+	s.mu.Unlock()
+
+	for {
+		start, ok := nextElement()
+		if !ok {
+			return
+		}
+		st := new(stanza)
+		if err := dec.DecodeElement(st, &start); err != nil {
+			return
+		}
+		s.received <- st
+	}
+}
+
+// nextOf returns the next received stanza of the kind, skipping the others
+func (s *fakeServer) nextOf(kind string) *stanza {
+	s.t.Helper()
+	for {
+		if st := s.next(); st.XMLName.Local == kind {
+			return st
+		}
+	}
+}
+
+func innerContains(st *stanza, sub string) bool {
+	return strings.Contains(string(st.Inner), sub)
+}
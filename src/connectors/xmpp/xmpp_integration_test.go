@@ -0,0 +1,223 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	prosodyUser            = "bridge"
+	prosodyDomain          = "localhost"
+	prosodyPassword        = "bridge-password"
+	prosodyRoom            = "events@conference.localhost"
+	prosodyComponent       = "component.localhost"
+	prosodyComponentSecret = "component-secret"
+)
+
+// prosodyConfig accepts the clients without TLS, as the containers have no certificate,
+// with the SCRAM mechanisms of the hashed password storage
+var prosodyConfig = fmt.Sprintf(`
+modules_enabled = { "roster"; "saslauth"; "disco"; "ping" }
+log = { info = "*console" }
+authentication = "internal_hashed"
+c2s_require_encryption = false
+allow_unencrypted_plain_auth = true
+component_interfaces = { "*" }
+
+VirtualHost %[1]q
+
+Component %[2]q "muc"
+	muc_room_locking = false
+
+Component %[3]q
+	component_secret = %[4]q
+`, prosodyDomain, "conference."+prosodyDomain, prosodyComponent, prosodyComponentSecret)
+
+var (
+	prosodyClientAddress    string
+	prosodyComponentAddress string
+)
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "prosody/prosody:0.12",
+		ExposedPorts: []string{"5222/tcp", "5347/tcp"},
+		// The entrypoint registers the user before starting the server
+		Env: map[string]string{"LOCAL": prosodyUser, "DOMAIN": prosodyDomain, "PASSWORD": prosodyPassword},
+		Files: []testcontainers.ContainerFile{{
+			Reader:            strings.NewReader(prosodyConfig),
+			ContainerFilePath: "/etc/prosody/prosody.cfg.lua",
+			FileMode:          0o644,
+		}},
+		WaitingFor: wait.ForAll(wait.ForListeningPort("5222/tcp"), wait.ForListeningPort("5347/tcp")),
+	}
+	prosodyC, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("failed to start Prosody container: %v", err))
+	}
+
+	host, err := prosodyC.Host(ctx)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get Prosody host: %v", err))
+	}
+	clientPort, err := prosodyC.MappedPort(ctx, "5222/tcp")
+	if err != nil {
+		panic(fmt.Sprintf("failed to get Prosody client port: %v", err))
+	}
+	componentPort, err := prosodyC.MappedPort(ctx, "5347/tcp")
+	if err != nil {
+		panic(fmt.Sprintf("failed to get Prosody component port: %v", err))
+	}
+	prosodyClientAddress = fmt.Sprintf("%s:%s", host, clientPort.Port())
+	prosodyComponentAddress = fmt.Sprintf("%s:%s", host, componentPort.Port())
+
+	code := m.Run()
+
+	if err := prosodyC.Terminate(ctx); err != nil {
+		fmt.Printf("failed to terminate Prosody container: %v\n", err)
+	}
+	os.Exit(code)
+}
+
+// prosodyClient returns the connection of the registered user with the resource
+func prosodyClient(resource string, rooms ...RoomConfig) ConnectionConfig {
+	return ConnectionConfig{
+		Mode:           modeClient,
+		Address:        prosodyClientAddress,
+		JID:            prosodyUser + "@" + prosodyDomain + "/" + resource,
+		Password:       prosodyPassword,
+		Security:       securityNone,
+		Mechanisms:     []string{mechScramSHA256, mechScramSHA1},
+		Rooms:          rooms,
+		ConnectTimeout: 10 * time.Second,
+		WriteTimeout:   5 * time.Second,
+		ReconnectDelay: time.Second,
+	}
+}
+
+// startSource starts a source of the connection, returning its messages
+func startSource(t *testing.T, conn ConnectionConfig) *XMPPSource {
+	t.Helper()
+	src, err := NewSource(&SourceConfig{ConnectionConfig: conn, Payload: payloadBody, MessageTimeout: 5 * time.Second})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = src.Close() })
+	_, err = src.Produce(10)
+	require.NoError(t, err)
+	return src.(*XMPPSource)
+}
+
+// receiveFrom waits for a message of the source, failing after the timeout
+func receiveFrom(t *testing.T, src *XMPPSource) (string, map[string]string) {
+	t.Helper()
+	select {
+	case msg := <-src.c:
+		data, err := msg.GetData()
+		require.NoError(t, err)
+		meta, err := msg.GetMetadata()
+		require.NoError(t, err)
+		require.NoError(t, msg.Ack(nil))
+		return string(data), meta
+	case <-time.After(10 * time.Second):
+		t.Fatal("no message received from Prosody")
+		return "", nil
+	}
+}
+
+func TestProsodyClientMessage(t *testing.T) {
+	for _, mech := range []string{mechScramSHA256, mechScramSHA1, mechPlain} {
+		t.Run(mech, func(t *testing.T) {
+			src := startSource(t, prosodyClient("source-"+mech))
+
+			conn := prosodyClient("target-" + mech)
+			conn.Mechanisms = []string{mech}
+			conn.InsecureAuth = true
+			r, err := NewRunner(&RunnerConfig{ConnectionConfig: conn, Kind: kindMessage, To: src.session.jid(), MaxInputSize: 1024})
+			require.NoError(t, err)
+			defer r.Close() //nolint:errcheck
+
+			require.NoError(t, r.Process(newMessage("hello <prosody>", nil)))
+			data, meta := receiveFrom(t, src)
+			assert.Equal(t, "hello <prosody>", data)
+			assert.Equal(t, kindMessage, meta["eb-xmpp-kind"])
+			assert.Equal(t, "chat", meta["eb-xmpp-type"])
+			assert.Equal(t, prosodyUser+"@"+prosodyDomain+"/target-"+mech, meta["eb-xmpp-from"])
+		})
+	}
+}
+
+func TestProsodyRoomMessage(t *testing.T) {
+	src := startSource(t, prosodyClient("room-source", RoomConfig{JID: prosodyRoom, Nick: "source"}))
+
+	conn := prosodyClient("room-target", RoomConfig{JID: prosodyRoom, Nick: "target"})
+	r, err := NewRunner(&RunnerConfig{ConnectionConfig: conn, Kind: kindMessage, To: prosodyRoom, MaxInputSize: 1024})
+	require.NoError(t, err)
+	defer r.Close() //nolint:errcheck
+
+	// The room delivers the messages of the occupants once they joined
+	require.Eventually(t, func() bool {
+		if err := r.Process(newMessage("room event", nil)); err != nil {
+			return false
+		}
+		select {
+		case msg := <-src.c:
+			meta, _ := msg.GetMetadata()
+			data, _ := msg.GetData()
+			_ = msg.Ack(nil)
+			return string(data) == "room event" && meta["eb-xmpp-room"] == prosodyRoom &&
+				meta["eb-xmpp-nick"] == "target" && meta["eb-xmpp-type"] == "groupchat"
+		case <-time.After(time.Second):
+			return false
+		}
+	}, 15*time.Second, 100*time.Millisecond)
+}
+
+func TestProsodyComponentMessage(t *testing.T) {
+	src := startSource(t, prosodyClient("component-source"))
+
+	r, err := NewRunner(&RunnerConfig{
+		ConnectionConfig: ConnectionConfig{
+			Mode:           modeComponent,
+			Address:        prosodyComponentAddress,
+			JID:            prosodyComponent,
+			Password:       prosodyComponentSecret,
+			Security:       securityNone,
+			ConnectTimeout: 10 * time.Second,
+			WriteTimeout:   5 * time.Second,
+			ReconnectDelay: time.Second,
+		},
+		Kind:         kindMessage,
+		To:           src.session.jid(),
+		MaxInputSize: 1024,
+	})
+	require.NoError(t, err)
+	defer r.Close() //nolint:errcheck
+
+	require.NoError(t, r.Process(newMessage("from the component", nil)))
+	data, meta := receiveFrom(t, src)
+	assert.Equal(t, "from the component", data)
+	assert.Equal(t, prosodyComponent, meta["eb-xmpp-from"])
+}
+
+func TestProsodyAuthFailure(t *testing.T) {
+	conn := prosodyClient("wrong")
+	conn.Password = "wrong-password"
+	_, err := NewRunner(&RunnerConfig{ConnectionConfig: conn, Kind: kindMessage, To: prosodyRoom, MaxInputSize: 1024})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not-authorized")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+var _ message.SourceMessage = &XMPPMessage{}
+
+type XMPPMessage struct {
+	id       string
+	data     []byte
+	metadata map[string]string
+	done     chan message.ResponseStatus
+	reply    chan *message.ReplyData
+}
+
+func (m *XMPPMessage) GetID() []byte {
+	return []byte(m.id)
+}
+
+func (m *XMPPMessage) GetMetadata() (map[string]string, error) {
+	return m.metadata, nil
+}
+
+func (m *XMPPMessage) GetData() ([]byte, error) {
+	return m.data, nil
+}
+
+// Ack acknowledges the stanza; reply data is sent back to the sender as a message
+func (m *XMPPMessage) Ack(data *message.ReplyData) error {
+	if data != nil {
+		message.SendReply(m.reply, data)
+	} else {
+		message.SendResponseStatus(m.done, message.ResponseStatusAck)
+	}
+	return nil
+}
+
+func (m *XMPPMessage) Nak() error {
+	message.SendResponseStatus(m.done, message.ResponseStatusNak)
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"unicode/utf8"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure XMPPRunner implements connectors.Runner
+var _ connectors.Runner = &XMPPRunner{}
+
+type RunnerConfig struct {
+	ConnectionConfig `mapstructure:",squash"`
+	// Kind is the stanza sent with the payload: "message" (payload as body) or "presence" (payload as status)
+	Kind string `mapstructure:"kind" default:"message" validate:"oneof=message presence"`
+	// To is the recipient JID: a contact, a room for groupchat messages, or empty for broadcast presence
+	To string `mapstructure:"to" validate:"required_if=Kind message"`
+	// ToFromMetadataKey reads the recipient from message metadata, overriding To
+	ToFromMetadataKey string `mapstructure:"toFromMetadataKey"`
+	// Type is the message type (default: groupchat for the joined rooms, chat otherwise)
+	Type string `mapstructure:"type" validate:"omitempty,oneof=chat normal groupchat headline"`
+	// Subject is the message subject
+	Subject string `mapstructure:"subject"`
+	// SubjectFromMetadataKey reads the subject from message metadata, overriding Subject
+	SubjectFromMetadataKey string `mapstructure:"subjectFromMetadataKey"`
+	// ThreadFromMetadataKey reads the conversation thread from message metadata
+	ThreadFromMetadataKey string `mapstructure:"threadFromMetadataKey"`
+	// Show is the presence availability: away, chat, dnd or xa (empty means available)
+	Show string `mapstructure:"show" validate:"omitempty,oneof=away chat dnd xa"`
+	// ShowFromMetadataKey reads the presence availability from message metadata, overriding Show
+	ShowFromMetadataKey string `mapstructure:"showFromMetadataKey"`
+	// MaxInputSize limits the payload size (servers usually limit stanzas to a few hundred KB)
+	MaxInputSize int `mapstructure:"maxInputSize" default:"262144" validate:"omitempty,gt=0"` // 256KB default
+}
+
+type XMPPRunner struct {
+	cfg     *RunnerConfig
+	slog    *slog.Logger
+	session *session
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates the XMPP runner, connecting to the server
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+
+	r := &XMPPRunner{
+		cfg:  cfg,
+		slog: slog.Default().With("context", "XMPP Runner"),
+	}
+	// Received stanzas are discarded; the session only answers the server pings
+	sess, err := newSession(&cfg.ConnectionConfig, r.slog, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := sess.start(); err != nil {
+		return nil, fmt.Errorf("failed to connect to XMPP server: %w", err)
+	}
+	r.session = sess
+
+	r.slog.Info("XMPP runner created",
+		"mode", cfg.Mode,
+		"jid", cfg.JID,
+		"kind", cfg.Kind,
+		"to", cfg.To,
+		"rooms", len(cfg.Rooms),
+	)
+	return r, nil
+}
+
+// Process sends the payload as the body of a message or the status of a presence
+func (r *XMPPRunner) Process(msg *message.RunnerMessage) error {
+	data, err := msg.GetData()
+	if err != nil {
+		return fmt.Errorf("failed to get data: %w", err)
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds limit %d", len(data), r.cfg.MaxInputSize)
+	}
+	if !utf8.Valid(data) {
+		return fmt.Errorf("payload is not valid UTF-8 text")
+	}
+
+	to := message.ResolveFromMetadata(msg, r.cfg.ToFromMetadataKey, r.cfg.To)
+	id := rand.Text()
+
+	var stanza string
+	if r.cfg.Kind == kindPresence {
+		show := message.ResolveFromMetadata(msg, r.cfg.ShowFromMetadataKey, r.cfg.Show)
+		switch show {
+		case "", "away", "chat", "dnd", "xa":
+		default:
+			return fmt.Errorf("invalid presence show %q", show)
+		}
+		content := element("show", show) + element("status", string(data))
+		stanza = buildStanza(kindPresence, r.session.from(), to, "", id, content)
+	} else {
+		if to == "" {
+			return fmt.Errorf("missing recipient")
+		}
+		typ := r.cfg.Type
+		if typ == "" {
+			typ = "chat"
+			if _, ok := r.session.room(to); ok && resourcePart(to) == "" {
+				typ = "groupchat"
+			}
+		}
+		content := element("subject", message.ResolveFromMetadata(msg, r.cfg.SubjectFromMetadataKey, r.cfg.Subject)) +
+			element("body", string(data)) +
+			element("thread", message.ResolveFromMetadata(msg, r.cfg.ThreadFromMetadataKey, ""))
+		stanza = buildStanza(kindMessage, r.session.from(), to, typ, id, content)
+	}
+
+	r.slog.Debug("sending stanza", "kind", r.cfg.Kind, "to", to, "id", id)
+	if err := r.session.send(stanza); err != nil {
+		return err
+	}
+
+	msg.AddMetadata("eb-xmpp-id", id)
+	if to != "" {
+		msg.AddMetadata("eb-xmpp-to", to)
+	}
+	return nil
+}
+
+func (r *XMPPRunner) Close() error {
+	r.slog.Info("closing XMPP runner")
+	return r.session.close()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+)
+
+func newMessage(data string, metadata map[string]string) *message.RunnerMessage {
+	return message.NewRunnerMessage(testutil.NewAdapter([]byte(data), metadata))
+}
+
+func TestXMPPRunnerComponentMessage(t *testing.T) {
+	srv := newFakeServer(t, true)
+	cfg := &RunnerConfig{
+		ConnectionConfig: ConnectionConfig{
+			Mode:           modeComponent,
+			Address:        srv.addr(),
+			JID:            "bot." + testDomain,
+			Password:       testPassword,
+			Security:       securityNone,
+			InsecureAuth:   true,
+			Rooms:          []RoomConfig{{JID: "ops@conference." + testDomain, Nick: "bridge"}},
+			ConnectTimeout: time.Second,
+			WriteTimeout:   time.Second,
+			ReconnectDelay: 20 * time.Millisecond,
+		},
+		Kind:                  kindMessage,
+		To:                    "alice@example.org",
+		Subject:               "alert",
+		ToFromMetadataKey:     "recipient",
+		ThreadFromMetadataKey: "thread",
+		MaxInputSize:          1024,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	join := srv.nextOf("presence")
+	if join.From != "bot.example.org" || join.To != "ops@conference.example.org/bridge" {
+		t.Errorf("unexpected room join: from=%q to=%q", join.From, join.To)
+	}
+
+	msg := newMessage("disk <full>", map[string]string{"thread": "t9"})
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	st := srv.nextOf("message")
+	if st.From != "bot.example.org" || st.To != "alice@example.org" || st.Type != "chat" {
+		t.Errorf("unexpected attributes: from=%q to=%q type=%q", st.From, st.To, st.Type)
+	}
+	if st.Body != "disk <full>" || st.Subject != "alert" || st.Thread != "t9" {
+		t.Errorf("unexpected content: body=%q subject=%q thread=%q", st.Body, st.Subject, st.Thread)
+	}
+	meta, _ := msg.GetMetadata()
+	if meta["eb-xmpp-id"] != st.ID || meta["eb-xmpp-to"] != "alice@example.org" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+
+	// Joined rooms default to groupchat
+	if err := r.Process(newMessage("hi room", map[string]string{"recipient": "ops@conference.example.org"})); err != nil {
+		t.Fatal(err)
+	}
+	if st := srv.nextOf("message"); st.To != "ops@conference.example.org" || st.Type != "groupchat" {
+		t.Errorf("room message to=%q type=%q", st.To, st.Type)
+	}
+}
+
+func TestXMPPRunnerPresence(t *testing.T) {
+	srv := newFakeServer(t, false)
+	cfg := &RunnerConfig{
+		ConnectionConfig: ConnectionConfig{
+			Mode:           modeClient,
+			Address:        srv.addr(),
+			JID:            "user@" + testDomain + "/bridge",
+			Password:       testPassword,
+			Security:       securityNone,
+			InsecureAuth:   true,
+			ConnectTimeout: time.Second,
+			WriteTimeout:   time.Second,
+			ReconnectDelay: 20 * time.Millisecond,
+		},
+		Kind:                kindPresence,
+		Show:                "away",
+		ShowFromMetadataKey: "show",
+		MaxInputSize:        1024,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	srv.nextOf("presence")
+
+	if err := r.Process(newMessage("in a meeting", nil)); err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	st := srv.nextOf("presence")
+	if st.To != "" || st.Show != "away" || st.Status != "in a meeting" {
+		t.Errorf("unexpected presence: to=%q show=%q status=%q", st.To, st.Show, st.Status)
+	}
+
+	if err := r.Process(newMessage("x", map[string]string{"show": "busy"})); err == nil {
+		t.Error("Process() expected error for an invalid show")
+	}
+}
+
+func TestXMPPRunnerErrors(t *testing.T) {
+	srv := newFakeServer(t, true)
+	cfg := &RunnerConfig{
+		ConnectionConfig: ConnectionConfig{
+			Mode:           modeComponent,
+			Address:        srv.addr(),
+			JID:            "bot." + testDomain,
+			Password:       testPassword,
+			Security:       securityNone,
+			InsecureAuth:   true,
+			Rooms:          []RoomConfig{{JID: "ops@conference." + testDomain, Nick: "bridge"}},
+			ConnectTimeout: time.Second,
+			WriteTimeout:   time.Second,
+			ReconnectDelay: 20 * time.Millisecond,
+		},
+		Kind:              kindMessage,
+		To:                "alice@example.org",
+		ToFromMetadataKey: "recipient",
+		MaxInputSize:      8,
+	}
+	r, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatalf("NewRunner() unexpected error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	if err := r.Process(newMessage("\xff\xfe", nil)); err == nil {
+		t.Error("Process() expected error for invalid UTF-8")
+	}
+	if err := r.Process(newMessage("too long payload", nil)); err == nil {
+		t.Error("Process() expected error for oversized payload")
+	}
+
+	cfg.Password = "wrong"
+	if _, err := NewRunner(cfg); err == nil {
+		t.Error("NewRunner() expected error for a wrong component secret")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const (
+	payloadBody   = "body"
+	payloadStanza = "stanza"
+
+	kindMessage  = "message"
+	kindPresence = "presence"
+)
+
+type SourceConfig struct {
+	ConnectionConfig `mapstructure:",squash"`
+	// Presence also produces the presence stanzas; only messages are produced by default
+	Presence bool `mapstructure:"presence"`
+	// Payload is "body" (message body or presence status) or "stanza" (XML of the whole stanza)
+	Payload string `mapstructure:"payload" default:"body" validate:"oneof=body stanza"`
+	// AllowFrom restricts the senders to these bare JIDs or domains (empty allows every sender)
+	AllowFrom []string `mapstructure:"allowFrom"`
+	// MessageTimeout is the maximum time to wait for the message Ack/Nak or reply
+	MessageTimeout time.Duration `mapstructure:"messageTimeout" default:"10s" validate:"gt=0"`
+}
+
+type XMPPSource struct {
+	cfg     *SourceConfig
+	slog    *slog.Logger
+	c       chan *message.RunnerMessage
+	session *session
+}
+
+func NewSourceConfig() any {
+	return new(SourceConfig)
+}
+
+// NewSource creates the XMPP source
+func NewSource(anyCfg any) (connectors.Source, error) {
+	cfg, ok := anyCfg.(*SourceConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	return &XMPPSource{
+		cfg:  cfg,
+		slog: slog.Default().With("context", "XMPP Source"),
+	}, nil
+}
+
+func (s *XMPPSource) Produce(buffer int) (<-chan *message.RunnerMessage, error) {
+	s.c = make(chan *message.RunnerMessage, buffer)
+
+	s.slog.Info("starting XMPP source",
+		"mode", s.cfg.Mode,
+		"jid", s.cfg.JID,
+		"security", s.cfg.Security,
+		"rooms", len(s.cfg.Rooms),
+		"presence", s.cfg.Presence,
+	)
+
+	sess, err := newSession(&s.cfg.ConnectionConfig, s.slog, s.handle)
+	if err != nil {
+		return nil, err
+	}
+	s.session = sess
+	if err := sess.start(); err != nil {
+		return nil, fmt.Errorf("failed to connect to XMPP server: %w", err)
+	}
+	return s.c, nil
+}
+
+// handle maps a received stanza to a message and sends the replies of the pipeline
+func (s *XMPPSource) handle(st *stanza) {
+	kind := st.XMLName.Local
+	if kind == kindPresence && !s.cfg.Presence {
+		return
+	}
+	if st.Type == "error" {
+		s.slog.Warn("received stanza error", "kind", kind, "from", st.From, "error", st.Error.condition())
+		return
+	}
+	if !s.allowed(st.From) {
+		s.slog.Debug("stanza from a sender not allowed", "from", st.From)
+		return
+	}
+
+	room, inRoom := s.session.room(st.From)
+	nick := ""
+	if inRoom {
+		nick = resourcePart(st.From)
+		if kind == kindMessage && strings.EqualFold(nick, room.Nick) && st.Type == "groupchat" {
+			// Own messages echoed by the room
+			return
+		}
+	}
+
+	data := []byte(st.Body)
+	if kind == kindPresence {
+		data = []byte(st.Status)
+	}
+	if s.cfg.Payload == payloadStanza {
+		data = st.raw(s.cfg.namespace())
+	} else if kind == kindMessage && st.Body == "" {
+		// Chat states and receipts without content
+		return
+	}
+
+	metadata := map[string]string{
+		"eb-xmpp-kind": kind,
+		"eb-xmpp-from": st.From,
+		"eb-xmpp-to":   st.To,
+	}
+	for k, v := range map[string]string{
+		"eb-xmpp-type":    st.Type,
+		"eb-xmpp-id":      st.ID,
+		"eb-xmpp-subject": st.Subject,
+		"eb-xmpp-thread":  st.Thread,
+		"eb-xmpp-show":    st.Show,
+		"eb-xmpp-status":  st.Status,
+	} {
+		if v != "" {
+			metadata[k] = v
+		}
+	}
+	if st.Delay != nil && st.Delay.Stamp != "" {
+		metadata["eb-xmpp-delay"] = st.Delay.Stamp
+	}
+	if inRoom {
+		metadata["eb-xmpp-room"] = bareJID(room.JID)
+		metadata["eb-xmpp-nick"] = nick
+	}
+
+	done := make(chan message.ResponseStatus, 1)
+	reply := make(chan *message.ReplyData, 1)
+	msg := message.NewRunnerMessage(&XMPPMessage{
+		id:       st.ID,
+		data:     data,
+		metadata: metadata,
+		done:     done,
+		reply:    reply,
+	})
+	select {
+	case s.c <- msg:
+	case <-s.session.ctx.Done():
+		return
+	}
+
+	go func() {
+		r, _, timedOut := message.AwaitReplyOrStatus(s.cfg.MessageTimeout, done, reply)
+		if timedOut {
+			s.slog.Warn("timeout waiting for message processing", "from", st.From, "id", st.ID)
+			return
+		}
+		if r != nil && kind == kindMessage {
+			s.sendReply(st, inRoom, r)
+		}
+	}()
+}
+
+// sendReply sends the reply data to the sender of the message, or to the room
+func (s *XMPPSource) sendReply(st *stanza, inRoom bool, r *message.ReplyData) {
+	to, typ := st.From, st.Type
+	if inRoom && st.Type == "groupchat" {
+		to = bareJID(st.From)
+	} else if typ == "" || typ == "groupchat" {
+		typ = "chat"
+	}
+	// Components answer from the address the message was sent to
+	from := ""
+	if s.cfg.Mode == modeComponent {
+		from = st.To
+	}
+	content := element("body", string(r.Data)) + element("thread", st.Thread)
+	if err := s.session.send(buildStanza(kindMessage, from, to, typ, "", content)); err != nil {
+		s.slog.Error("failed to send reply", "to", to, "error", err)
+	}
+}
+
+// allowed checks the sender against the allowed bare JIDs and domains
+func (s *XMPPSource) allowed(from string) bool {
+	if len(s.cfg.AllowFrom) == 0 {
+		return true
+	}
+	bare := bareJID(from)
+	domain := domainPart(from)
+	for _, allowed := range s.cfg.AllowFrom {
+		if strings.EqualFold(allowed, bare) || strings.EqualFold(allowed, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *XMPPSource) Close() error {
+	if s.session != nil {
+		if err := s.session.close(); err != nil {
+			s.slog.Warn("failed to close XMPP stream", "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+func receive(t *testing.T, c <-chan *message.RunnerMessage) *message.RunnerMessage {
+	t.Helper()
+	select {
+	case msg := <-c:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message produced")
+		return nil
+	}
+}
+
+func TestXMPPSourceClient(t *testing.T) {
+	srv := newFakeServer(t, false)
+	cfg := &SourceConfig{
+		ConnectionConfig: ConnectionConfig{
+			Mode:           modeClient,
+			Address:        srv.addr(),
+			JID:            "user@" + testDomain + "/bridge",
+			Password:       testPassword,
+			Security:       securityNone,
+			InsecureAuth:   true,
+			Rooms:          []RoomConfig{{JID: "alerts@conference." + testDomain, Nick: "bot", History: 5}},
+			ConnectTimeout: 10 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			KeepAlive:      time.Minute,
+			ReconnectDelay: 20 * time.Millisecond,
+		},
+		Payload:        payloadBody,
+		MessageTimeout: 10 * time.Second,
+	}
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	defer src.Close() //nolint:errcheck
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+
+	if p := srv.nextOf("presence"); p.To != "" {
+		t.Errorf("initial presence to = %q, want empty", p.To)
+	}
+	join := srv.nextOf("presence")
+	if join.To != "alerts@conference."+testDomain+"/bot" || !innerContains(join, "maxstanzas='5'") {
+		t.Errorf("unexpected room join: to=%q inner=%s", join.To, join.Inner)
+	}
+
+	// Chat states without body are skipped
+	srv.send("<message from='alice@example.org/phone' type='chat'><composing xmlns='http://jabber.org/protocol/chatstates'/></message>")
+	srv.send("<message from='alice@example.org/phone' to='user@example.org/bridge' type='chat' id='m1'><body>hello &amp; bye</body><thread>t1</thread></message>")
+
+	msg := receive(t, c)
+	data, _ := msg.GetData()
+	if string(data) != "hello & bye" {
+		t.Errorf("data = %q", data)
+	}
+	meta, _ := msg.GetMetadata()
+	for k, want := range map[string]string{
+		"eb-xmpp-kind":   "message",
+		"eb-xmpp-from":   "alice@example.org/phone",
+		"eb-xmpp-to":     "user@example.org/bridge",
+		"eb-xmpp-type":   "chat",
+		"eb-xmpp-id":     "m1",
+		"eb-xmpp-thread": "t1",
+	} {
+		if meta[k] != want {
+			t.Errorf("metadata %s = %q, want %q", k, meta[k], want)
+		}
+	}
+
+	if err := msg.Ack(&message.ReplyData{Data: []byte("pong")}); err != nil {
+		t.Fatalf("Ack() unexpected error = %v", err)
+	}
+	reply := srv.nextOf("message")
+	if reply.To != "alice@example.org/phone" || reply.Type != "chat" || reply.Body != "pong" || reply.Thread != "t1" {
+		t.Errorf("unexpected reply: %+v", reply)
+	}
+
+	// Own room echoes are skipped, the other occupants are produced
+	srv.send("<message from='alerts@conference.example.org/bot' type='groupchat'><body>echo</body></message>")
+	srv.send("<message from='alerts@conference.example.org/carol' type='groupchat'><body>disk full</body><delay xmlns='urn:xmpp:delay' stamp='2024-01-01T00:00:00Z'/></message>")
+	msg = receive(t, c)
+	data, _ = msg.GetData()
+	meta, _ = msg.GetMetadata()
+	if string(data) != "disk full" || meta["eb-xmpp-room"] != "alerts@conference.example.org" || meta["eb-xmpp-nick"] != "carol" {
+		t.Errorf("unexpected room message: %q %v", data, meta)
+	}
+	if meta["eb-xmpp-delay"] != "2024-01-01T00:00:00Z" {
+		t.Errorf("metadata eb-xmpp-delay = %q", meta["eb-xmpp-delay"])
+	}
+	if err := msg.Ack(&message.ReplyData{Data: []byte("ok")}); err != nil {
+		t.Fatal(err)
+	}
+	reply = srv.nextOf("message")
+	if reply.To != "alerts@conference.example.org" || reply.Type != "groupchat" {
+		t.Errorf("room reply to=%q type=%q", reply.To, reply.Type)
+	}
+
+	// Presences are skipped by default, pings are answered
+	srv.send("<presence from='alice@example.org/phone'><show>away</show></presence>")
+	srv.send("<iq from='example.org' type='get' id='p1'><ping xmlns='urn:xmpp:ping'/></iq>")
+	if iq := srv.nextOf("iq"); iq.Type != "result" || iq.ID != "p1" {
+		t.Errorf("unexpected ping answer: %+v", iq)
+	}
+	select {
+	case msg := <-c:
+		t.Errorf("unexpected message: %v", msg)
+	default:
+	}
+}
+
+func TestXMPPSourcePresenceAndFilters(t *testing.T) {
+	srv := newFakeServer(t, false)
+	cfg := &SourceConfig{
+		ConnectionConfig: ConnectionConfig{
+			Mode:           modeClient,
+			Address:        srv.addr(),
+			JID:            "user@" + testDomain + "/bridge",
+			Password:       testPassword,
+			Security:       securityNone,
+			InsecureAuth:   true,
+			ConnectTimeout: 10 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			KeepAlive:      time.Minute,
+			ReconnectDelay: 20 * time.Millisecond,
+		},
+		Presence:       true,
+		Payload:        payloadStanza,
+		AllowFrom:      []string{"alice@example.org", "trusted.org"},
+		MessageTimeout: 10 * time.Second,
+	}
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	defer src.Close() //nolint:errcheck
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+	srv.nextOf("presence")
+
+	srv.send("<message from='mallory@example.org/x' type='chat'><body>spam</body></message>")
+	srv.send("<presence from='bob@trusted.org/desk'><show>dnd</show><status>busy</status></presence>")
+
+	msg := receive(t, c)
+	meta, _ := msg.GetMetadata()
+	if meta["eb-xmpp-kind"] != "presence" || meta["eb-xmpp-show"] != "dnd" || meta["eb-xmpp-status"] != "busy" {
+		t.Errorf("unexpected presence metadata: %v", meta)
+	}
+	data, _ := msg.GetData()
+	raw := string(data)
+	if !strings.HasPrefix(raw, "<presence xmlns='jabber:client' from='bob@trusted.org/desk'") || !strings.Contains(raw, "<status>busy</status>") {
+		t.Errorf("unexpected stanza payload: %s", raw)
+	}
+}
+
+func TestXMPPSourceReconnect(t *testing.T) {
+	srv := newFakeServer(t, false)
+	cfg := &SourceConfig{
+		ConnectionConfig: ConnectionConfig{
+			Mode:           modeClient,
+			Address:        srv.addr(),
+			JID:            "user@" + testDomain + "/bridge",
+			Password:       testPassword,
+			Security:       securityNone,
+			InsecureAuth:   true,
+			ConnectTimeout: 10 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			KeepAlive:      time.Minute,
+			ReconnectDelay: 20 * time.Millisecond,
+		},
+		Payload:        payloadBody,
+		MessageTimeout: 10 * time.Second,
+	}
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatalf("NewSource() unexpected error = %v", err)
+	}
+	defer src.Close() //nolint:errcheck
+	c, err := src.Produce(10)
+	if err != nil {
+		t.Fatalf("Produce() unexpected error = %v", err)
+	}
+	srv.nextOf("presence")
+
+	srv.drop()
+	srv.nextOf("presence")
+	if n := srv.connections(); n != 2 {
+		t.Errorf("connections = %d, want 2", n)
+	}
+	srv.send("<message from='alice@example.org/phone' type='chat'><body>again</body></message>")
+	msg := receive(t, c)
+	if data, _ := msg.GetData(); string(data) != "again" {
+		t.Errorf("data = %q", data)
+	}
+}
+
+func TestXMPPSourceAuthFailure(t *testing.T) {
+	srv := newFakeServer(t, false)
+	cfg := &SourceConfig{
+		ConnectionConfig: ConnectionConfig{
+			Mode:           modeClient,
+			Address:        srv.addr(),
+			JID:            "user@" + testDomain + "/bridge",
+			Password:       "wrong",
+			Security:       securityNone,
+			InsecureAuth:   true,
+			ConnectTimeout: 10 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			KeepAlive:      time.Minute,
+			ReconnectDelay: 20 * time.Millisecond,
+		},
+		Payload:        payloadBody,
+		MessageTimeout: 10 * time.Second,
+	}
+	src, err := NewSource(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close() //nolint:errcheck
+	_, err = src.Produce(1)
+	if err == nil || !strings.Contains(err.Error(), "not-authorized") {
+		t.Errorf("Produce() error = %v, want not-authorized", err)
+	}
+}
+
+func TestXMPPSourcePlainRequiresTLS(t *testing.T) {
+	srv := newFakeServer(t, false)
+	cfg := &SourceConfig{
+		ConnectionConfig: ConnectionConfig{
+			Mode:           modeClient,
+			Address:        srv.addr(),
+			JID:            "user@" + testDomain + "/bridge",
+			Password:       testPassword,
+			Security:       securityNone,
+			ConnectTimeout: 10 * time.Second,
+			WriteTimeout:   10 * time.Second,
+			KeepAlive:      time.Minute,
+			ReconnectDelay: 20 * time.Millisecond,
+		},
+		Payload:        payloadBody,
+		MessageTimeout: 10 * time.Second,
+	}
+	src, _ := NewSource(cfg)
+	defer src.Close() //nolint:errcheck
+	if _, err := src.Produce(1); err == nil {
+		t.Error("Produce() expected error for PLAIN without TLS")
+	}
+}
+
+func TestXMPPConfigValidation(t *testing.T) {
+	for _, opts := range []map[string]any{
+		{"password": "x"},
+		{"jid": "user@example.org"},
+		{"jid": "bot.example.org", "password": "x", "mode": "component"},
+		{"jid": "user@example.org", "password": "x", "security": "ssl"},
+		{"jid": "user@example.org", "password": "x", "mechanisms": []string{"DIGEST-MD5"}},
+		{"jid": "user@example.org", "password": "x", "rooms": []map[string]any{{"jid": "room@conference.example.org"}}},
+		{"jid": "user@example.org", "password": "x", "payload": "xml"},
+	} {
+		if err := utils.ParseConfig(opts, new(SourceConfig)); err == nil {
+			t.Errorf("ParseConfig(%v) expected error", opts)
+		}
+	}
+
+	cfg := new(SourceConfig)
+	if err := utils.ParseConfig(map[string]any{"jid": "user@example.org", "password": "x"}, cfg); err != nil {
+		t.Fatalf("ParseConfig() unexpected error = %v", err)
+	}
+	if cfg.Mode != modeClient || cfg.Security != securityStartTLS || cfg.Payload != payloadBody || cfg.ReconnectDelay != 5*time.Second {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cachedStylesheet is a compiled stylesheet shared by the messages using it.
+// An evicted stylesheet is freed when the last message using it releases it.
+type cachedStylesheet struct {
+	name    string
+	sheet   *compiledStylesheet
+	refs    int
+	evicted bool
+}
+
+// stylesheetCache is an LRU cache of compiled stylesheets
+type stylesheetCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+}
+
+func newStylesheetCache(maxEntries int) *stylesheetCache {
+	return &stylesheetCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// acquire returns the cached stylesheet, which must be released after use
+func (c *stylesheetCache) acquire(name string) (*cachedStylesheet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	entry := el.Value.(*cachedStylesheet)
+	entry.refs++
+	return entry, true
+}
+
+// add caches a compiled stylesheet and returns it acquired, evicting the least recently
+// used entry when full. If another message compiled the same stylesheet in the meantime,
+// the cached one is returned and the given one is freed.
+func (c *stylesheetCache) add(name string, sheet *compiledStylesheet) *cachedStylesheet {
+	c.mu.Lock()
+	if el, ok := c.entries[name]; ok {
+		c.order.MoveToFront(el)
+		entry := el.Value.(*cachedStylesheet)
+		entry.refs++
+		c.mu.Unlock()
+		sheet.free()
+		return entry
+	}
+
+	entry := &cachedStylesheet{name: name, sheet: sheet, refs: 1}
+	c.entries[name] = c.order.PushFront(entry)
+	var unused []*compiledStylesheet
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		evicted := oldest.Value.(*cachedStylesheet)
+		delete(c.entries, evicted.name)
+		evicted.evicted = true
+		if evicted.refs == 0 {
+			unused = append(unused, evicted.sheet)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, s := range unused {
+		s.free()
+	}
+	return entry
+}
+
+// release releases a stylesheet returned by acquire or add, freeing it if evicted
+func (c *stylesheetCache) release(entry *cachedStylesheet) {
+	c.mu.Lock()
+	entry.refs--
+	free := entry.evicted && entry.refs == 0
+	c.mu.Unlock()
+
+	if free {
+		entry.sheet.free()
+	}
+}
+
+// close frees the cached stylesheets
+func (c *stylesheetCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		entry := el.Value.(*cachedStylesheet)
+		entry.evicted = true
+		if entry.refs == 0 {
+			entry.sheet.free()
+		}
+	}
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
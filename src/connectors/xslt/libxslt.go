@@ -0,0 +1,330 @@
+//go:build xslt
+
+package main
+
+/*
+#cgo pkg-config: libexslt libxslt libxml-2.0
+#include <stdarg.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <libxml/parser.h>
+#include <libxml/xpath.h>
+#include <libxml/xpathInternals.h>
+#include <libxslt/xslt.h>
+#include <libxslt/xsltInternals.h>
+#include <libxslt/transform.h>
+#include <libxslt/variables.h>
+#include <libxslt/security.h>
+#include <libxslt/xsltutils.h>
+#include <libexslt/exslt.h>
+
+// Documents are parsed without network access and without loading external DTDs
+// or substituting external entities
+#define EB_PARSE_OPTIONS (XML_PARSE_NONET | XML_PARSE_NOWARNING)
+
+// Errors are collected per thread; the Go side locks the goroutine to its thread
+static __thread char eb_err[1024];
+static __thread size_t eb_errlen;
+
+static void eb_collect(void *ctx, const char *msg, ...) {
+	if (eb_errlen >= sizeof(eb_err) - 1) {
+		return;
+	}
+	va_list args;
+	va_start(args, msg);
+	int n = vsnprintf(eb_err + eb_errlen, sizeof(eb_err) - eb_errlen, msg, args);
+	va_end(args);
+	if (n > 0) {
+		eb_errlen += (size_t)n;
+		if (eb_errlen > sizeof(eb_err) - 1) {
+			eb_errlen = sizeof(eb_err) - 1;
+		}
+	}
+}
+
+static void eb_reset_errors(void) {
+	eb_errlen = 0;
+	eb_err[0] = 0;
+	xmlSetGenericErrorFunc(NULL, eb_collect);
+	xsltSetGenericErrorFunc(NULL, eb_collect);
+}
+
+static const char *eb_errors(void) {
+	return eb_err;
+}
+
+static xsltSecurityPrefsPtr eb_sec_strict;
+static xsltSecurityPrefsPtr eb_sec_read;
+
+static xsltSecurityPrefsPtr eb_new_sec(int allowRead) {
+	xsltSecurityPrefsPtr sec = xsltNewSecurityPrefs();
+	xsltSetSecurityPrefs(sec, XSLT_SECPREF_WRITE_FILE, xsltSecurityForbid);
+	xsltSetSecurityPrefs(sec, XSLT_SECPREF_CREATE_DIRECTORY, xsltSecurityForbid);
+	xsltSetSecurityPrefs(sec, XSLT_SECPREF_WRITE_NETWORK, xsltSecurityForbid);
+	xsltSetSecurityPrefs(sec, XSLT_SECPREF_READ_NETWORK, xsltSecurityForbid);
+	if (!allowRead) {
+		xsltSetSecurityPrefs(sec, XSLT_SECPREF_READ_FILE, xsltSecurityForbid);
+	}
+	return sec;
+}
+
+static void eb_init(void) {
+	xmlInitParser();
+	exsltRegisterAll();
+	eb_sec_strict = eb_new_sec(0);
+	eb_sec_read = eb_new_sec(1);
+}
+
+static xmlDocPtr eb_parse(const char *buf, int len, const char *url) {
+	return xmlReadMemory(buf, len, url, NULL, EB_PARSE_OPTIONS);
+}
+
+static xsltStylesheetPtr eb_compile(const char *buf, int len, const char *url) {
+	xmlDocPtr doc = eb_parse(buf, len, url);
+	if (doc == NULL) {
+		return NULL;
+	}
+	xsltStylesheetPtr style = xsltParseStylesheetDoc(doc);
+	if (style == NULL) {
+		xmlFreeDoc(doc);
+		return NULL;
+	}
+	if (style->errors > 0) {
+		xsltFreeStylesheet(style);
+		return NULL;
+	}
+	return style;
+}
+
+static const char *eb_style_method(xsltStylesheetPtr style) {
+	return (const char *)style->method;
+}
+
+static const char *eb_style_media_type(xsltStylesheetPtr style) {
+	return (const char *)style->mediaType;
+}
+
+// eb_transform applies the stylesheet, returning the serialized result in out
+static int eb_transform(xsltStylesheetPtr style, xmlDocPtr doc, const char **params, int allowRead, xmlChar **out, int *outlen) {
+	xsltTransformContextPtr ctxt = xsltNewTransformContext(style, doc);
+	if (ctxt == NULL) {
+		return -1;
+	}
+	xsltSetCtxtSecurityPrefs(allowRead ? eb_sec_read : eb_sec_strict, ctxt);
+	if (params != NULL && xsltQuoteUserParams(ctxt, params) != 0) {
+		xsltFreeTransformContext(ctxt);
+		return -1;
+	}
+	xmlDocPtr res = xsltApplyStylesheetUser(style, doc, NULL, NULL, NULL, ctxt);
+	int failed = res == NULL || ctxt->state == XSLT_STATE_ERROR || ctxt->state == XSLT_STATE_STOPPED;
+	xsltFreeTransformContext(ctxt);
+	if (failed) {
+		if (res != NULL) {
+			xmlFreeDoc(res);
+		}
+		return -1;
+	}
+	*out = NULL;
+	*outlen = 0;
+	int rc = xsltSaveResultToString(out, outlen, res, style);
+	xmlFreeDoc(res);
+	return rc;
+}
+
+// eb_xpath_string evaluates the expression and converts the result with the XPath string() function
+static xmlChar *eb_xpath_string(xmlDocPtr doc, xmlXPathCompExprPtr comp, const char **ns) {
+	xmlXPathContextPtr ctx = xmlXPathNewContext(doc);
+	if (ctx == NULL) {
+		return NULL;
+	}
+	for (int i = 0; ns != NULL && ns[i] != NULL && ns[i + 1] != NULL; i += 2) {
+		xmlXPathRegisterNs(ctx, (const xmlChar *)ns[i], (const xmlChar *)ns[i + 1]);
+	}
+	xmlXPathObjectPtr obj = xmlXPathCompiledEval(comp, ctx);
+	xmlXPathFreeContext(ctx);
+	if (obj == NULL) {
+		return NULL;
+	}
+	xmlChar *s = xmlXPathCastToString(obj);
+	xmlXPathFreeObject(obj);
+	return s;
+}
+
+static void eb_free(void *p) {
+	xmlFree(p);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"unsafe"
+)
+
+const supported = true
+
+func init() {
+	C.eb_init()
+}
+
+// xmlError returns the errors collected by libxml2 and libxslt during the last call,
+// or the fallback message when nothing was reported
+func xmlError(fallback string) error {
+	msg := strings.TrimSpace(C.GoString(C.eb_errors()))
+	if msg == "" {
+		msg = fallback
+	}
+	return errors.New(strings.Join(strings.Fields(msg), " "))
+}
+
+// cStrings returns a NULL-terminated C string array, and the function freeing it
+func cStrings(values []string) (**C.char, func()) {
+	if len(values) == 0 {
+		return nil, func() {}
+	}
+	arr := unsafe.Slice((**C.char)(C.malloc(C.size_t(len(values)+1)*C.size_t(unsafe.Sizeof(uintptr(0))))), len(values)+1)
+	for i, v := range values {
+		arr[i] = C.CString(v)
+	}
+	arr[len(values)] = nil
+	return &arr[0], func() {
+		for i := range values {
+			C.free(unsafe.Pointer(arr[i]))
+		}
+		C.free(unsafe.Pointer(&arr[0]))
+	}
+}
+
+// xmlDoc is a parsed XML document
+type xmlDoc struct {
+	ptr C.xmlDocPtr
+}
+
+// parseXML parses the document
+func parseXML(data []byte) (*xmlDoc, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty document")
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	C.eb_reset_errors()
+	ptr := C.eb_parse((*C.char)(unsafe.Pointer(&data[0])), C.int(len(data)), nil)
+	if ptr == nil {
+		return nil, xmlError("invalid XML document")
+	}
+	return &xmlDoc{ptr: ptr}, nil
+}
+
+func (d *xmlDoc) free() {
+	C.xmlFreeDoc(d.ptr)
+}
+
+// compiledStylesheet is an XSLT 1.0 stylesheet compiled by libxslt. It can be
+// applied concurrently and must be freed once no longer used.
+type compiledStylesheet struct {
+	ptr C.xsltStylesheetPtr
+	// method and mediaType are the attributes of the xsl:output element, if any
+	method    string
+	mediaType string
+}
+
+// compileStylesheet compiles the stylesheet; base is the URI relative imports are resolved against
+func compileStylesheet(data []byte, base string) (*compiledStylesheet, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty stylesheet")
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var url *C.char
+	if base != "" {
+		url = C.CString(base)
+		defer C.free(unsafe.Pointer(url))
+	}
+	C.eb_reset_errors()
+	ptr := C.eb_compile((*C.char)(unsafe.Pointer(&data[0])), C.int(len(data)), url)
+	if ptr == nil {
+		return nil, xmlError("invalid stylesheet")
+	}
+	return &compiledStylesheet{
+		ptr:       ptr,
+		method:    C.GoString(C.eb_style_method(ptr)),
+		mediaType: C.GoString(C.eb_style_media_type(ptr)),
+	}, nil
+}
+
+// transform applies the stylesheet with the string parameters (name, value pairs),
+// returning the serialized result
+func (s *compiledStylesheet) transform(doc *xmlDoc, params []string, allowRead bool) ([]byte, error) {
+	cParams, freeParams := cStrings(params)
+	defer freeParams()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	read := C.int(0)
+	if allowRead {
+		read = 1
+	}
+	var out *C.xmlChar
+	var outLen C.int
+	C.eb_reset_errors()
+	if C.eb_transform(s.ptr, doc.ptr, cParams, read, &out, &outLen) != 0 {
+		return nil, xmlError("transformation failed")
+	}
+	if out == nil {
+		return []byte{}, nil
+	}
+	defer C.eb_free(unsafe.Pointer(out))
+	return C.GoBytes(unsafe.Pointer(out), outLen), nil
+}
+
+func (s *compiledStylesheet) free() {
+	C.xsltFreeStylesheet(s.ptr)
+}
+
+// xpathExpr is a compiled XPath 1.0 expression
+type xpathExpr struct {
+	ptr C.xmlXPathCompExprPtr
+}
+
+// compileXPath compiles the expression
+func compileXPath(expr string) (*xpathExpr, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	cExpr := C.CString(expr)
+	defer C.free(unsafe.Pointer(cExpr))
+	C.eb_reset_errors()
+	ptr := C.xmlXPathCompile((*C.xmlChar)(unsafe.Pointer(cExpr)))
+	if ptr == nil {
+		return nil, xmlError("invalid XPath expression")
+	}
+	return &xpathExpr{ptr: ptr}, nil
+}
+
+// evalString evaluates the expression on the document with the namespace bindings
+// (prefix, URI pairs) and returns the result converted with the XPath string() function
+func (x *xpathExpr) evalString(doc *xmlDoc, namespaces []string) (string, error) {
+	cNamespaces, freeNamespaces := cStrings(namespaces)
+	defer freeNamespaces()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	C.eb_reset_errors()
+	s := C.eb_xpath_string(doc.ptr, x.ptr, cNamespaces)
+	if s == nil {
+		return "", xmlError("XPath evaluation failed")
+	}
+	defer C.eb_free(unsafe.Pointer(s))
+	return C.GoString((*C.char)(unsafe.Pointer(s))), nil
+}
+
+func (x *xpathExpr) free() {
+	C.xmlXPathFreeCompExpr(x.ptr)
+}
@@ -0,0 +1,39 @@
+//go:build !xslt
+
+package main
+
+import "errors"
+
+// Without the xslt build tag the plugin is built without libxslt, so that the module
+// builds and vets without the libxml2 and libxslt headers: the runner can't be created.
+
+const supported = false
+
+var errUnsupported = errors.New("built without libxslt")
+
+type xmlDoc struct{}
+
+func parseXML([]byte) (*xmlDoc, error) { return nil, errUnsupported }
+
+func (d *xmlDoc) free() {}
+
+type compiledStylesheet struct {
+	method    string
+	mediaType string
+}
+
+func compileStylesheet([]byte, string) (*compiledStylesheet, error) { return nil, errUnsupported }
+
+func (s *compiledStylesheet) transform(*xmlDoc, []string, bool) ([]byte, error) {
+	return nil, errUnsupported
+}
+
+func (s *compiledStylesheet) free() {}
+
+type xpathExpr struct{}
+
+func compileXPath(string) (*xpathExpr, error) { return nil, errUnsupported }
+
+func (x *xpathExpr) evalString(*xmlDoc, []string) (string, error) { return "", errUnsupported }
+
+func (x *xpathExpr) free() {}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sandrolain/events-bridge/src/connectors"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+// Ensure XSLTRunner implements connectors.Runner
+var _ connectors.Runner = &XSLTRunner{}
+
+// extractOutput evaluates the Extract expressions on the transformed document
+const extractOutput = "output"
+
+// defaultContentTypes are the content types of the xsl:output methods
+var defaultContentTypes = map[string]string{
+	"xml":  "application/xml",
+	"html": "text/html; charset=utf-8",
+	"text": "text/plain; charset=utf-8",
+}
+
+type RunnerConfig struct {
+	// Stylesheet is the inline XSLT 1.0 stylesheet; its result replaces the payload
+	Stylesheet string `mapstructure:"stylesheet"`
+	// StylesheetFile is the path of the stylesheet (alternative to Stylesheet); relative
+	// xsl:import and xsl:include are resolved against it
+	StylesheetFile string `mapstructure:"stylesheetFile" validate:"omitempty,filepath"`
+	// StylesheetDir is the directory of the stylesheets selected per message by the file
+	// name in the StylesheetKey metadata (alternative to Stylesheet)
+	StylesheetDir string `mapstructure:"stylesheetDir" validate:"omitempty,dirpath"`
+	// StylesheetKey is the metadata key naming the stylesheet file in StylesheetDir
+	StylesheetKey string `mapstructure:"stylesheetKey" default:"eb-xslt-stylesheet"`
+	// CacheSize is the number of compiled stylesheets of StylesheetDir kept in memory
+	CacheSize int `mapstructure:"cacheSize" default:"64" validate:"gt=0"`
+	// Params are the string parameters of the stylesheet (xsl:param)
+	Params map[string]string `mapstructure:"params"`
+	// MetadataParams maps stylesheet parameters to the metadata keys they are read from
+	MetadataParams map[string]string `mapstructure:"metadataParams"`
+	// Extract maps metadata keys to XPath 1.0 expressions; the result of the expression,
+	// converted with the XPath string() function, is stored in the metadata
+	Extract map[string]string `mapstructure:"extract"`
+	// ExtractFrom is the document the expressions are evaluated on: "input" or "output"
+	// (the transformed document)
+	ExtractFrom string `mapstructure:"extractFrom" default:"input" validate:"oneof=input output"`
+	// Namespaces maps the prefixes used in the Extract expressions to namespace URIs
+	Namespaces map[string]string `mapstructure:"namespaces"`
+	// AllowDocument allows the stylesheet document() function to read local files;
+	// network access and writing files are always forbidden
+	AllowDocument bool `mapstructure:"allowDocument" default:"false"`
+	// ContentTypeKey is the metadata key set to the content type of the transformed
+	// document (empty = disabled). The default is forwarded as header by the HTTP runner.
+	ContentTypeKey string `mapstructure:"contentTypeKey" default:"Content-Type"`
+	// ContentType overrides the content type of the xsl:output element
+	ContentType string `mapstructure:"contentType"`
+	// MaxInputSize limits the payload size
+	MaxInputSize int `mapstructure:"maxInputSize" default:"1048576" validate:"omitempty,gt=0"` // 1MB default
+}
+
+// extraction is a compiled Extract entry
+type extraction struct {
+	key  string
+	expr *xpathExpr
+}
+
+type XSLTRunner struct {
+	cfg         *RunnerConfig
+	slog        *slog.Logger
+	stylesheet  *compiledStylesheet
+	cache       *stylesheetCache
+	extractions []extraction
+	namespaces  []string
+}
+
+func NewRunnerConfig() any {
+	return new(RunnerConfig)
+}
+
+// NewRunner creates a new instance of XSLTRunner, compiling the stylesheet and the XPath expressions
+func NewRunner(anyCfg any) (connectors.Runner, error) {
+	cfg, ok := anyCfg.(*RunnerConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type: %T", anyCfg)
+	}
+	if !supported {
+		return nil, errors.New("the XSLT runner requires libxslt: build the plugin with -tags xslt")
+	}
+
+	sources := 0
+	for _, s := range []string{cfg.Stylesheet, cfg.StylesheetFile, cfg.StylesheetDir} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, fmt.Errorf("only one of stylesheet, stylesheetFile and stylesheetDir can be set")
+	}
+	if sources == 0 && len(cfg.Extract) == 0 {
+		return nil, fmt.Errorf("a stylesheet or extract expressions are required")
+	}
+	if sources == 0 && cfg.ExtractFrom == extractOutput {
+		return nil, fmt.Errorf("extractFrom output requires a stylesheet")
+	}
+
+	r := &XSLTRunner{
+		cfg:  cfg,
+		slog: slog.Default().With("context", "XSLT Runner"),
+	}
+
+	var err error
+	switch {
+	case cfg.Stylesheet != "":
+		r.stylesheet, err = compileStylesheet([]byte(cfg.Stylesheet), "")
+	case cfg.StylesheetFile != "":
+		r.stylesheet, err = loadStylesheet(cfg.StylesheetFile)
+	case cfg.StylesheetDir != "":
+		r.cache = newStylesheetCache(cfg.CacheSize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile stylesheet: %w", err)
+	}
+
+	// Expressions are evaluated in a stable order, so that errors are reproducible
+	for _, key := range slices.Sorted(maps.Keys(cfg.Extract)) {
+		expr, err := compileXPath(cfg.Extract[key])
+		if err != nil {
+			r.Close() //nolint:errcheck,gosec
+			return nil, fmt.Errorf("invalid XPath expression for %s: %w", key, err)
+		}
+		r.extractions = append(r.extractions, extraction{key: key, expr: expr})
+	}
+	for _, prefix := range slices.Sorted(maps.Keys(cfg.Namespaces)) {
+		r.namespaces = append(r.namespaces, prefix, cfg.Namespaces[prefix])
+	}
+
+	r.slog.Info("xslt runner created",
+		"stylesheet", describeSource(cfg),
+		"extract", len(r.extractions),
+		"extractFrom", cfg.ExtractFrom,
+	)
+	return r, nil
+}
+
+func describeSource(cfg *RunnerConfig) string {
+	switch {
+	case cfg.StylesheetFile != "":
+		return cfg.StylesheetFile
+	case cfg.StylesheetDir != "":
+		return cfg.StylesheetDir + " (by " + cfg.StylesheetKey + " metadata)"
+	case cfg.Stylesheet != "":
+		return "inline"
+	default:
+		return "none"
+	}
+}
+
+// loadStylesheet reads and compiles a stylesheet file
+func loadStylesheet(path string) (*compiledStylesheet, error) {
+	content, err := os.ReadFile(path) //nolint:gosec // path from the runner configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stylesheet file: %w", err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return compileStylesheet(content, abs)
+}
+
+// acquireStylesheet returns the stylesheet of the message and the function releasing it,
+// or nil when the runner only extracts values
+func (r *XSLTRunner) acquireStylesheet(metadata map[string]string) (*compiledStylesheet, func(), error) {
+	if r.cache == nil {
+		return r.stylesheet, func() {}, nil
+	}
+
+	name := metadata[r.cfg.StylesheetKey]
+	if name == "" {
+		return nil, nil, fmt.Errorf("missing stylesheet name in metadata %s", r.cfg.StylesheetKey)
+	}
+	// The name must be a file of the directory
+	if name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || name == ".." || name == "." {
+		return nil, nil, fmt.Errorf("invalid stylesheet name %q", name)
+	}
+
+	entry, ok := r.cache.acquire(name)
+	if !ok {
+		sheet, err := loadStylesheet(filepath.Join(r.cfg.StylesheetDir, name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("stylesheet %s: %w", name, err)
+		}
+		r.slog.Debug("stylesheet compiled", "name", name)
+		entry = r.cache.add(name, sheet)
+	}
+	return entry.sheet, func() { r.cache.release(entry) }, nil
+}
+
+// params returns the stylesheet parameters as name, value pairs
+func (r *XSLTRunner) params(metadata map[string]string) []string {
+	params := make([]string, 0, 2*(len(r.cfg.Params)+len(r.cfg.MetadataParams)))
+	for _, name := range slices.Sorted(maps.Keys(r.cfg.Params)) {
+		params = append(params, name, r.cfg.Params[name])
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.cfg.MetadataParams)) {
+		if v, ok := metadata[r.cfg.MetadataParams[name]]; ok {
+			params = append(params, name, v)
+		}
+	}
+	return params
+}
+
+// contentType returns the content type of the documents produced by the stylesheet
+func (r *XSLTRunner) contentType(sheet *compiledStylesheet) string {
+	switch {
+	case r.cfg.ContentType != "":
+		return r.cfg.ContentType
+	case sheet.mediaType != "":
+		return sheet.mediaType
+	case defaultContentTypes[sheet.method] != "":
+		return defaultContentTypes[sheet.method]
+	default:
+		return defaultContentTypes["xml"]
+	}
+}
+
+// Process transforms the XML payload with the stylesheet and extracts the configured values to metadata
+func (r *XSLTRunner) Process(msg *message.RunnerMessage) error {
+	metadata, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+	if r.cfg.MaxInputSize > 0 && len(data) > r.cfg.MaxInputSize {
+		return fmt.Errorf("payload size %d exceeds limit %d", len(data), r.cfg.MaxInputSize)
+	}
+
+	doc, err := parseXML(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse XML payload: %w", err)
+	}
+	defer doc.free()
+
+	sheet, release, err := r.acquireStylesheet(metadata)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var result []byte
+	if sheet != nil {
+		if result, err = sheet.transform(doc, r.params(metadata), r.cfg.AllowDocument); err != nil {
+			return fmt.Errorf("failed to transform payload: %w", err)
+		}
+	}
+
+	values := make(map[string]string, len(r.extractions))
+	if len(r.extractions) > 0 {
+		target := doc
+		if r.cfg.ExtractFrom == extractOutput {
+			if target, err = parseXML(result); err != nil {
+				return fmt.Errorf("failed to parse transformed document: %w", err)
+			}
+			defer target.free()
+		}
+		for _, e := range r.extractions {
+			v, err := e.expr.evalString(target, r.namespaces)
+			if err != nil {
+				return fmt.Errorf("failed to extract %s: %w", e.key, err)
+			}
+			values[e.key] = v
+		}
+	}
+
+	// The message is changed only once every step succeeded
+	for k, v := range values {
+		msg.AddMetadata(k, v)
+	}
+	if sheet != nil {
+		msg.SetData(result)
+		if r.cfg.ContentTypeKey != "" {
+			msg.AddMetadata(r.cfg.ContentTypeKey, r.contentType(sheet))
+		}
+	}
+	return nil
+}
+
+// Close frees the compiled stylesheets and expressions
+func (r *XSLTRunner) Close() error {
+	r.slog.Info("closing xslt runner")
+	if r.stylesheet != nil {
+		r.stylesheet.free()
+		r.stylesheet = nil
+	}
+	if r.cache != nil {
+		r.cache.close()
+	}
+	for _, e := range r.extractions {
+		e.expr.free()
+	}
+	r.extractions = nil
+	return nil
+}
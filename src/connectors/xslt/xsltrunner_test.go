@@ -0,0 +1,235 @@
+//go:build xslt
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sandrolain/events-bridge/src/message"
+	"github.com/sandrolain/events-bridge/src/testutil"
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+const orderXML = `<?xml version="1.0"?>
+<ord:order xmlns:ord="urn:example:order" id="A-17">
+  <ord:customer>ACME</ord:customer>
+  <ord:line sku="X1" qty="2" price="10.50"/>
+  <ord:line sku="Y2" qty="1" price="4.00"/>
+</ord:order>`
+
+const invoiceXSL = `<xsl:stylesheet version="1.0"
+    xmlns:xsl="http://www.w3.org/1999/XSL/Transform"
+    xmlns:ord="urn:example:order"
+    exclude-result-prefixes="ord">
+  <xsl:output method="xml" indent="no" omit-xml-declaration="yes"/>
+  <xsl:param name="currency" select="'USD'"/>
+  <xsl:template match="/ord:order">
+    <invoice ref="{@id}" currency="{$currency}">
+      <to><xsl:value-of select="ord:customer"/></to>
+      <xsl:for-each select="ord:line">
+        <item sku="{@sku}"><xsl:value-of select="@qty * @price"/></item>
+      </xsl:for-each>
+    </invoice>
+  </xsl:template>
+</xsl:stylesheet>`
+
+func TestXSLTRunner(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret.xml")
+	if err := os.WriteFile(secret, []byte("<secret>s3cr3t</secret>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		cfg      *RunnerConfig
+		meta     map[string]string
+		want     string
+		wantMeta map[string]string
+	}{
+		{
+			name:     "transform",
+			cfg:      &RunnerConfig{Stylesheet: invoiceXSL, MetadataParams: map[string]string{"currency": "currency"}, ContentTypeKey: "Content-Type"},
+			meta:     map[string]string{"currency": "EUR"},
+			want:     `<invoice ref="A-17" currency="EUR"><to>ACME</to><item sku="X1">21</item><item sku="Y2">4</item></invoice>`,
+			wantMeta: map[string]string{"Content-Type": "application/xml"},
+		},
+		{
+			// Parameters are passed as strings, never evaluated as XPath
+			name: "literal parameters",
+			cfg:  &RunnerConfig{Stylesheet: invoiceXSL, MetadataParams: map[string]string{"currency": "currency"}},
+			meta: map[string]string{"currency": "'; /ord:order"},
+			want: `<invoice ref="A-17" currency="'; /ord:order"><to>ACME</to><item sku="X1">21</item><item sku="Y2">4</item></invoice>`,
+		},
+		{
+			name: "xpath extract",
+			cfg: &RunnerConfig{
+				Extract: map[string]string{
+					"order-id": "/o:order/@id",
+					"customer": "/o:order/o:customer",
+					"total":    "sum(/o:order/o:line/@qty)",
+					"missing":  "/o:order/o:note",
+				},
+				Namespaces:     map[string]string{"o": "urn:example:order"},
+				ContentTypeKey: "Content-Type",
+			},
+			// The payload is untouched without stylesheet
+			want:     orderXML,
+			wantMeta: map[string]string{"order-id": "A-17", "customer": "ACME", "total": "3", "missing": "", "Content-Type": ""},
+		},
+		{
+			name: "extract from output",
+			cfg: &RunnerConfig{
+				Stylesheet:  invoiceXSL,
+				Params:      map[string]string{"currency": "CHF"},
+				Extract:     map[string]string{"currency": "/invoice/@currency", "items": "count(//item)"},
+				ExtractFrom: extractOutput,
+			},
+			want:     `<invoice ref="A-17" currency="CHF"><to>ACME</to><item sku="X1">21</item><item sku="Y2">4</item></invoice>`,
+			wantMeta: map[string]string{"currency": "CHF", "items": "2"},
+		},
+		{
+			name: "document allowed",
+			cfg: &RunnerConfig{Stylesheet: `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:output method="text"/>
+  <xsl:template match="/"><xsl:value-of select="document('` + secret + `')/secret"/></xsl:template>
+</xsl:stylesheet>`, AllowDocument: true},
+			want: "s3cr3t",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRunner(tt.cfg)
+			if err != nil {
+				t.Fatalf("failed to create runner: %v", err)
+			}
+			defer func() { _ = r.Close() }()
+			msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(orderXML), tt.meta))
+			if err := r.Process(msg); err != nil {
+				t.Fatalf("process failed: %v", err)
+			}
+			meta, out, err := msg.GetMetadataAndData()
+			if err != nil {
+				t.Fatalf("failed to get message: %v", err)
+			}
+			if strings.TrimSpace(string(out)) != tt.want {
+				t.Errorf("unexpected document:\n%s\nwant:\n%s", out, tt.want)
+			}
+			for k, v := range tt.wantMeta {
+				if meta[k] != v {
+					t.Errorf("metadata %s = %q, want %q", k, meta[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestStylesheetDir(t *testing.T) {
+	dir := t.TempDir()
+	text := `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:import href="common.xsl"/>
+  <xsl:output method="text"/>
+  <xsl:template match="/"><xsl:call-template name="label"/>: <xsl:value-of select="count(//*)"/></xsl:template>
+</xsl:stylesheet>`
+	common := `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:template name="label">elements</xsl:template>
+</xsl:stylesheet>`
+	for name, content := range map[string]string{"invoice.xsl": invoiceXSL, "count.xsl": text, "common.xsl": common} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewRunner(&RunnerConfig{StylesheetDir: dir, StylesheetKey: "eb-xslt-stylesheet", CacheSize: 1, ContentTypeKey: "Content-Type"})
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(orderXML), map[string]string{"eb-xslt-stylesheet": "count.xsl"}))
+	if err := r.Process(msg); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	meta, out, _ := msg.GetMetadataAndData()
+	if string(out) != "elements: 4" || meta["Content-Type"] != "text/plain; charset=utf-8" {
+		t.Errorf("unexpected result %q %v", out, meta)
+	}
+
+	// Stylesheets are used concurrently while the cache evicts them
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			name := []string{"invoice.xsl", "count.xsl"}[i%2]
+			msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(orderXML), map[string]string{"eb-xslt-stylesheet": name}))
+			if err := r.Process(msg); err != nil {
+				t.Errorf("process %s: %v", name, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	for _, name := range []string{"", "../invoice.xsl", "missing.xsl"} {
+		msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(orderXML), map[string]string{"eb-xslt-stylesheet": name}))
+		if err := r.Process(msg); err == nil {
+			t.Errorf("expected error for stylesheet %q", name)
+		}
+	}
+}
+
+func TestDocumentForbidden(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret.xml")
+	if err := os.WriteFile(secret, []byte("<secret>s3cr3t</secret>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	xsl := `<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:output method="text"/>
+  <xsl:template match="/"><xsl:value-of select="document('` + secret + `')/secret"/></xsl:template>
+</xsl:stylesheet>`
+
+	r, err := NewRunner(&RunnerConfig{Stylesheet: xsl})
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(orderXML), nil))
+	err = r.Process(msg)
+	if data, _ := msg.GetData(); strings.Contains(string(data), "s3cr3t") {
+		t.Fatalf("document() read a local file: %s", data)
+	}
+	if err == nil {
+		t.Error("expected a transformation error")
+	}
+}
+
+func TestInvalidInput(t *testing.T) {
+	r, err := NewRunner(&RunnerConfig{Stylesheet: invoiceXSL})
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	msg := message.NewRunnerMessage(testutil.NewAdapter([]byte(`<order><unclosed></order>`), nil))
+	if err := r.Process(msg); err == nil || !strings.Contains(err.Error(), "failed to parse XML payload") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+
+	for _, opts := range []map[string]any{
+		{},
+		{"stylesheet": "<not-xslt/>"},
+		{"stylesheet": invoiceXSL, "stylesheetDir": t.TempDir()},
+		{"extract": map[string]any{"k": "///"}},
+		{"extract": map[string]any{"k": "/a"}, "extractFrom": "output"},
+	} {
+		cfg := new(RunnerConfig)
+		if err := utils.ParseConfig(opts, cfg); err != nil {
+			t.Fatalf("failed to parse config: %v", err)
+		}
+		if _, err := NewRunner(cfg); err == nil {
+			t.Errorf("expected error for %v", opts)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/sandrolain/events-bridge/src/bridge"
+	"github.com/sandrolain/events-bridge/src/common/encdec"
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/message"
+)
+
+const debugCommand = "debug"
+
+// maxDebugPayload limits the payload printed for every stage
+const maxDebugPayload = 2048
+
+// runDebug runs a captured message through the configured runners, printing the
+// message changes after every stage. The message file uses the JSON message format
+// of the CLI connector: {"metadata": {...}, "data": ...}.
+func runDebug(ctx context.Context, logger *slog.Logger, args []string) error {
+	fs := flag.NewFlagSet(debugCommand, flag.ContinueOnError)
+	msgPath := fs.String("message", "", "captured message file (JSON), or - for stdin")
+	breakpoint := fs.Int("break", -1, "stop after the runner with this index")
+	step := fs.Bool("step", false, "wait for Enter after every runner")
+	// The configuration flags are read by config.LoadConfig
+	fs.String("config-file-path", "", "configuration file path")
+	fs.String("config-content", "", "configuration content")
+	fs.String("config-format", "", "configuration format (yaml, yml, json)")
+	fs.String("profile", "", "configuration profile")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *msgPath == "" {
+		return errors.New("--message is required")
+	}
+
+	msg, err := readDebugMessage(*msgPath)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration file: %w", err)
+	}
+
+	debugger, err := bridge.NewDebugger(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := debugger.Close(); err != nil {
+			logger.Error("failed to close runners", "error", err)
+		}
+	}()
+
+	out := os.Stdout
+	input := bufio.NewReader(os.Stdin)
+	printDebugMessage(out, msg)
+	return debugger.Run(ctx, msg, func(s bridge.Step) bool {
+		printDebugStep(out, s)
+		if s.Index == *breakpoint {
+			fmt.Fprintf(out, "breakpoint reached at runner %d\n", s.Index)
+			return false
+		}
+		if *step && s.Err == nil && !s.Filtered {
+			fmt.Fprint(out, "[Enter] next runner, [q] quit: ")
+			line, err := input.ReadString('\n')
+			if err != nil || strings.TrimSpace(line) == "q" {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// readDebugMessage reads the captured message from a file or stdin
+func readDebugMessage(path string) (*message.RunnerMessage, error) {
+	var content []byte
+	var err error
+	if path == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(path) //nolint:gosec // user-provided debug input
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	return decodeDebugMessage(content)
+}
+
+// decodeDebugMessage decodes a message in the JSON message format of the CLI connector
+func decodeDebugMessage(content []byte) (*message.RunnerMessage, error) {
+	decoder, err := encdec.NewMessageDecoder("json", "metadata", "data")
+	if err != nil {
+		return nil, err
+	}
+	src, err := decoder.DecodeMessage(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode message: %w", err)
+	}
+	return message.NewRunnerMessage(src), nil
+}
+
+func printDebugMessage(w io.Writer, msg *message.RunnerMessage) {
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		fmt.Fprintf(w, "input message: %v\n", err)
+		return
+	}
+	fmt.Fprintln(w, "=== input message")
+	for _, k := range slices.Sorted(maps.Keys(meta)) {
+		fmt.Fprintf(w, "  %s: %s\n", k, meta[k])
+	}
+	fmt.Fprintf(w, "  data: %s\n", truncatePayload(data))
+}
+
+func printDebugStep(w io.Writer, s bridge.Step) {
+	fmt.Fprintf(w, "=== runner %d (%s) in %s\n", s.Index, s.Type, s.Duration)
+	switch {
+	case s.Err != nil:
+		fmt.Fprintf(w, "  error: %v\n", s.Err)
+	case s.Skipped:
+		fmt.Fprintln(w, "  skipped by ifExpr")
+	case s.Filtered:
+		fmt.Fprintln(w, "  filtered out by filterExpr, the message would be dropped")
+	}
+	if s.Diff.Empty() {
+		fmt.Fprintln(w, "  no changes")
+		return
+	}
+	for _, k := range slices.Sorted(maps.Keys(s.Diff.Added)) {
+		fmt.Fprintf(w, "  + %s: %s\n", k, s.Diff.Added[k])
+	}
+	for _, k := range slices.Sorted(maps.Keys(s.Diff.Changed)) {
+		fmt.Fprintf(w, "  ~ %s: %s -> %s\n", k, s.Diff.Changed[k][0], s.Diff.Changed[k][1])
+	}
+	for _, k := range s.Diff.Removed {
+		fmt.Fprintf(w, "  - %s\n", k)
+	}
+	if s.Diff.DataChanged() {
+		fmt.Fprintf(w, "  data: %s\n", truncatePayload(s.Diff.DataBefore))
+		fmt.Fprintf(w, "     -> %s\n", truncatePayload(s.Diff.DataAfter))
+	}
+}
+
+func truncatePayload(data []byte) string {
+	if len(data) > maxDebugPayload {
+		return fmt.Sprintf("%s... (%d bytes)", data[:maxDebugPayload], len(data))
+	}
+	return string(data)
+}
@@ -0,0 +1,197 @@
+package diagnostics
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultLogLines is the number of log records kept when no size is configured
+const DefaultLogLines = 1000
+
+// LogEntry is a log record kept for the diagnostic bundle
+type LogEntry struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"msg"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+}
+
+// logRing is a fixed-size ring buffer of log entries
+type logRing struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	next    int
+	full    bool
+}
+
+func (r *logRing) add(e LogEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) == 0 {
+		return
+	}
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns the entries from the oldest to the most recent
+func (r *logRing) snapshot() []LogEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return slices.Clone(r.entries[:r.next])
+	}
+	return append(slices.Clone(r.entries[r.next:]), r.entries[:r.next]...)
+}
+
+// resize changes the capacity, keeping the most recent entries
+func (r *logRing) resize(size int) {
+	entries := r.snapshot()
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = make([]LogEntry, size)
+	r.next = copy(r.entries, entries) % size
+	r.full = len(entries) == size
+}
+
+// Recorder is a slog handler keeping the most recent log records in memory
+// before passing them to the wrapped handler
+type Recorder struct {
+	next   slog.Handler
+	ring   *logRing
+	attrs  []slog.Attr
+	groups []string
+}
+
+// NewRecorder wraps the handler, keeping the last size records (DefaultLogLines if size <= 0)
+func NewRecorder(next slog.Handler, size int) *Recorder {
+	if size <= 0 {
+		size = DefaultLogLines
+	}
+	return &Recorder{
+		next: next,
+		ring: &logRing{entries: make([]LogEntry, size)},
+	}
+}
+
+// SetSize changes the number of records kept, dropping the oldest ones if needed
+func (h *Recorder) SetSize(size int) {
+	if size <= 0 {
+		size = DefaultLogLines
+	}
+	h.ring.resize(size)
+}
+
+// Entries returns the kept records from the oldest to the most recent
+func (h *Recorder) Entries() []LogEntry {
+	return h.ring.snapshot()
+}
+
+// Enabled implements slog.Handler. Records of level info and above are always kept,
+// even if the wrapped handler discards them.
+func (h *Recorder) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo || h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *Recorder) Handle(ctx context.Context, r slog.Record) error {
+	entry := LogEntry{
+		Time:    r.Time,
+		Level:   r.Level.String(),
+		Message: r.Message,
+	}
+	if len(h.attrs) > 0 || r.NumAttrs() > 0 {
+		entry.Attrs = make(map[string]any, len(h.attrs)+r.NumAttrs())
+		for _, a := range h.attrs {
+			addAttr(entry.Attrs, "", a)
+		}
+		prefix := groupPrefix(h.groups)
+		r.Attrs(func(a slog.Attr) bool {
+			addAttr(entry.Attrs, prefix, a)
+			return true
+		})
+	}
+	h.ring.add(entry)
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h *Recorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := h.clone()
+	c.next = h.next.WithAttrs(attrs)
+	prefix := groupPrefix(h.groups)
+	for _, a := range attrs {
+		c.attrs = append(c.attrs, slog.Attr{Key: prefix + a.Key, Value: a.Value})
+	}
+	return c
+}
+
+// WithGroup implements slog.Handler
+func (h *Recorder) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := h.clone()
+	c.next = h.next.WithGroup(name)
+	c.groups = append(c.groups, name)
+	return c
+}
+
+func (h *Recorder) clone() *Recorder {
+	return &Recorder{
+		next:   h.next,
+		ring:   h.ring,
+		attrs:  slices.Clip(h.attrs),
+		groups: slices.Clip(h.groups),
+	}
+}
+
+func groupPrefix(groups []string) string {
+	prefix := ""
+	for _, g := range groups {
+		prefix += g + "."
+	}
+	return prefix
+}
+
+// addAttr stores the attribute with its group path as key and a JSON-safe value
+func addAttr(m map[string]any, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			addAttr(m, prefix, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	switch v.Kind() {
+	case slog.KindBool:
+		m[prefix+a.Key] = v.Bool()
+	case slog.KindInt64:
+		m[prefix+a.Key] = v.Int64()
+	case slog.KindUint64:
+		m[prefix+a.Key] = v.Uint64()
+	case slog.KindString:
+		m[prefix+a.Key] = v.String()
+	default:
+		// Floats are kept as text as well, since NaN and infinities cannot be encoded in JSON
+		m[prefix+a.Key] = v.String()
+	}
+}
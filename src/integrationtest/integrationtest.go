@@ -0,0 +1,78 @@
+// Package integrationtest runs the services used by the connectors (Kafka, NATS, Redis,
+// PostgreSQL, MongoDB and MQTT) in Docker containers with testcontainers, and starts bridge
+// pipelines against them, for the end-to-end tests of connectors and configurations.
+//
+// The services are available with the integration build tag, like the integration tests
+// of the connectors (go test -tags=integration). The Start functions return the running
+// services, e.g. for the TestMain of a package; the functions named after the services
+// start them for a single test, skip the test when Docker is not available and terminate
+// the containers at the end of the test.
+package integrationtest
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/sandrolain/events-bridge/src/bridge"
+	"github.com/sandrolain/events-bridge/src/config"
+)
+
+// PluginsDirEnv is the environment variable with the directory containing the built
+// "connectors" plugins directory, e.g. the ./bin directory of "task build"
+const PluginsDirEnv = "EB_TEST_PLUGINS_DIR"
+
+// RenderConfig renders a configuration template with the data, e.g. the endpoints of the
+// services: "address: {{ .NATS }}". Missing keys are an error.
+func RenderConfig(tmpl string, data any) (string, error) {
+	t, err := template.New("config").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid config template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render config template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// StartPipeline renders the YAML configuration template with the data, loads it as the
+// bridge configuration and starts the pipeline until the end of the test. The connector
+// plugins are loaded from the directory in EB_TEST_PLUGINS_DIR; the test is skipped when
+// it is not set. The test runs in that directory, so it cannot be parallel.
+func StartPipeline(t *testing.T, tmpl string, data any) *bridge.Supervisor {
+	t.Helper()
+	dir := os.Getenv(PluginsDirEnv)
+	if dir == "" {
+		t.Skipf("%s is not set: build the connector plugins (task build) and set it to the directory containing them", PluginsDirEnv)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "connectors")); err != nil {
+		t.Fatalf("invalid %s: %v", PluginsDirEnv, err)
+	}
+
+	content, err := RenderConfig(tmpl, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.ParseContent(content, "yaml")
+	if err != nil {
+		t.Fatalf("invalid pipeline config: %v", err)
+	}
+
+	// The plugins are loaded from the ./connectors directory
+	t.Chdir(dir)
+	sup := bridge.NewSupervisor(slog.Default(), 0)
+	if err := sup.Start(t.Context(), cfg); err != nil {
+		t.Fatalf("failed to start pipeline: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := sup.Close(); err != nil {
+			t.Logf("failed to close pipeline: %v", err)
+		}
+	})
+	return sup
+}
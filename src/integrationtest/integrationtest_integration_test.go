@@ -0,0 +1,79 @@
+//go:build integration
+
+package integrationtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+)
+
+const natsToRedisConfig = `
+source:
+  type: nats
+  options:
+    address: {{ .NATS }}
+    subject: orders
+runners:
+  - type: redis
+    options:
+      address: {{ .Redis }}
+      channel: orders
+`
+
+func TestNATSToRedisPipeline(t *testing.T) {
+	natsSvc := NATS(t)
+	redisSvc := Redis(t)
+
+	rdb := redis.NewClient(&redis.Options{Addr: redisSvc.Endpoint})
+	t.Cleanup(func() { rdb.Close() }) //nolint:errcheck
+	sub := rdb.Subscribe(t.Context(), "orders")
+	t.Cleanup(func() { sub.Close() }) //nolint:errcheck
+	if _, err := sub.Receive(t.Context()); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	StartPipeline(t, natsToRedisConfig, map[string]string{"NATS": natsSvc.Endpoint, "Redis": redisSvc.Endpoint})
+
+	nc, err := nats.Connect(natsSvc.Endpoint)
+	if err != nil {
+		t.Fatalf("failed to connect to NATS: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	// The source subscribes in the background: publish until the message is forwarded
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(10 * time.Second)
+	for {
+		if err := nc.Publish("orders", []byte(`{"id":1}`)); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+		select {
+		case msg := <-sub.Channel():
+			if msg.Payload != `{"id":1}` {
+				t.Errorf("payload = %s", msg.Payload)
+			}
+			return
+		case <-ticker.C:
+		case <-timeout:
+			t.Fatal("timeout waiting for the message on Redis")
+		}
+	}
+}
+
+func TestServices(t *testing.T) {
+	for name, start := range map[string]func(*testing.T) *Service{
+		"kafka":    Kafka,
+		"postgres": Postgres,
+		"mongo":    Mongo,
+		"mqtt":     MQTT,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if svc := start(t); svc.Endpoint == "" {
+				t.Error("empty endpoint")
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package integrationtest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderConfig(t *testing.T) {
+	tmpl := `
+source:
+  type: nats
+  options:
+    address: {{ .NATS }}
+    subject: orders
+runners:
+  - type: redis
+    options:
+      address: {{ .Redis }}
+      channel: orders
+`
+	got, err := RenderConfig(tmpl, map[string]string{"NATS": "nats://localhost:32768", "Redis": "localhost:32769"})
+	if err != nil {
+		t.Fatalf("RenderConfig() unexpected error = %v", err)
+	}
+	if !strings.Contains(got, "address: nats://localhost:32768\n") || !strings.Contains(got, "address: localhost:32769\n") {
+		t.Errorf("RenderConfig() = %s", got)
+	}
+
+	if _, err := RenderConfig(tmpl, map[string]string{"NATS": "nats://localhost:32768"}); err == nil {
+		t.Error("RenderConfig() expected error for a missing key")
+	}
+	if _, err := RenderConfig("address: {{ .NATS", nil); err == nil {
+		t.Error("RenderConfig() expected error for an invalid template")
+	}
+}
+
+func TestStartPipelineSkipsWithoutPlugins(t *testing.T) {
+	t.Setenv(PluginsDirEnv, "")
+	var skipped bool
+	t.Run("pipeline", func(t *testing.T) {
+		defer func() { skipped = t.Skipped() }()
+		StartPipeline(t, "", nil)
+	})
+	if !skipped {
+		t.Error("StartPipeline() expected to skip the test without plugins")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -9,8 +10,21 @@ import (
 	"time"
 
 	"github.com/lmittmann/tint"
+	"github.com/sandrolain/events-bridge/src/admin"
 	"github.com/sandrolain/events-bridge/src/bridge"
+	"github.com/sandrolain/events-bridge/src/common/metrics"
+	"github.com/sandrolain/events-bridge/src/common/procmon"
+	"github.com/sandrolain/events-bridge/src/common/tracing"
 	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/diagnostics"
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	// logRecorder keeps the most recent log records for the diagnostic bundles
+	logRecorder *diagnostics.Recorder
+	// reporter writes the diagnostic bundles; nil when diagnostics are not configured
+	reporter *diagnostics.Reporter
 )
 
 func main() {
@@ -18,8 +32,34 @@ func main() {
 	ctx, cancel := setupSignalHandling()
 	defer cancel()
 
+	// Print the build metadata of the bridge and of the connector plugins
+	if len(os.Args) > 1 && os.Args[1] == versionCommand {
+		if err := runVersion(os.Stdout, os.Args[2:]); err != nil {
+			fatal(setupLogging(os.Stderr), err, "version failed")
+		}
+		return
+	}
+
+	// Debug a captured message, logging to stderr to keep the stages output readable
+	if len(os.Args) > 1 && os.Args[1] == debugCommand {
+		logger := setupLogging(os.Stderr)
+		if err := runDebug(ctx, logger, os.Args[2:]); err != nil {
+			fatal(logger, err, "debug failed")
+		}
+		return
+	}
+
+	// Run the fixtures of a runner, printing the results to stdout for CI
+	if len(os.Args) > 1 && os.Args[1] == testRunnerCommand {
+		logger := setupLogging(os.Stderr)
+		if err := runTestRunner(ctx, logger, os.Args[2:]); err != nil {
+			fatal(logger, err, "runner test failed")
+		}
+		return
+	}
+
 	// Setup logging
-	logger := setupLogging()
+	logger := setupLogging(os.Stdout)
 
 	// Load configuration
 	cfg, err := config.LoadConfig()
@@ -27,28 +67,128 @@ func main() {
 		fatal(logger, err, "failed to load configuration file")
 	}
 
-	// Create events bridge
-	evBridge, err := bridge.NewEventsBridge(cfg, logger)
-	if err != nil {
-		fatal(logger, err, "failed to create events bridge")
+	logVersion(logger, cfg)
+
+	// Setup the diagnostic bundles written on shutdown and crash
+	if cfg.Diagnostics != nil {
+		if reporter, err = diagnostics.NewReporter(*cfg.Diagnostics, logRecorder, logger); err != nil {
+			fatal(logger, err, "failed to setup diagnostics")
+		}
+		defer func() {
+			if err := reporter.Close(); err != nil {
+				logger.Error("failed to close diagnostics", "error", err)
+			}
+		}()
+		defer reporter.Recover()
+		if err := reporter.SetConfig(cfg); err != nil {
+			logger.Warn("configuration not included in diagnostic bundles", "error", err)
+		}
+	}
+
+	// Export the traces of the messages if configured. The tracer is stopped after the
+	// supervisor is closed, so that the spans of the drained messages are exported too.
+	if cfg.Tracing != nil {
+		stop, err := startTracing(*cfg.Tracing, logger.With("component", "tracing"))
+		if err != nil {
+			fatal(logger, err, "failed to setup tracing")
+		}
+		defer stop()
+	}
+
+	// Create and start the events bridge pipeline
+	var drainTimeout time.Duration
+	if cfg.Admin != nil {
+		drainTimeout = cfg.Admin.DrainTimeout
+	}
+	supervisor := bridge.NewSupervisor(logger, drainTimeout)
+	status := func() any {
+		return map[string]any{
+			"pipelines": supervisor.Status(),
+			"processes": procmon.Snapshot(),
+		}
+	}
+	reporter.SetStatus(status)
+	setupDiagnosticSignals(ctx, logger, status)
+	if err := supervisor.Start(ctx, cfg); err != nil {
+		fatal(logger, err, "failed to start events bridge")
 	}
 	defer func() {
-		if err := evBridge.Close(); err != nil {
+		if err := supervisor.Close(); err != nil {
 			logger.Error("failed to close bridge", "error", err)
 		}
 	}()
 
-	// Run the bridge
-	if err := evBridge.Run(ctx); err != nil && err != context.Canceled {
+	// Start the admin API if configured
+	if cfg.Admin != nil {
+		adminServer := admin.NewServer(*cfg.Admin, supervisor, logger)
+		go func() {
+			if err := adminServer.Run(ctx); err != nil {
+				logger.Error("admin API stopped with error", "error", err)
+			}
+		}()
+	}
+
+	// Start the metrics endpoint if configured
+	if cfg.Metrics != nil {
+		path := cfg.Metrics.Path
+		if path == "" {
+			path = metrics.DefaultPath
+		}
+		go func() {
+			if err := metrics.Run(ctx, cfg.Metrics.Address, path, logger.With("component", "metrics")); err != nil {
+				logger.Error("metrics endpoint stopped with error", "error", err)
+			}
+		}()
+	}
+
+	// Run until shutdown signal or failure of the active pipeline
+	if err := supervisor.Wait(ctx); err != nil && err != context.Canceled {
 		fatal(logger, err, "bridge stopped with error")
 	}
 
-	// Monitor for shutdown signal
-	<-ctx.Done()
 	logger.Info("shutdown signal received, cleaning up resources")
+	reporter.Shutdown()
 	logger.Info("graceful shutdown completed")
 }
 
+// startTracing sets the process-wide tracer and starts its exporter; the returned function
+// exports the spans still queued and stops it
+func startTracing(cfg config.TracingConfig, logger *slog.Logger) (stop func(), err error) {
+	ratio := 1.0
+	if cfg.SampleRatio != nil {
+		ratio = *cfg.SampleRatio
+	}
+	tracer, err := tracing.New(tracing.Config{
+		Endpoint:    cfg.Endpoint,
+		ServiceName: cfg.ServiceName,
+		SampleRatio: ratio,
+		Headers:     cfg.Headers,
+		BatchSize:   cfg.BatchSize,
+		Interval:    cfg.ExportInterval,
+		Timeout:     cfg.Timeout,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+	tracing.SetDefault(tracer)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("tracing error", "error", err)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tracer.Run(ctx)
+	}()
+	logger.Info("tracing enabled", "endpoint", cfg.Endpoint, "sampleRatio", ratio)
+	return func() {
+		tracing.SetDefault(nil)
+		cancel()
+		<-done
+	}, nil
+}
+
 // setupSignalHandling configures signal handling for graceful shutdown
 func setupSignalHandling() (context.Context, context.CancelFunc) {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -64,17 +204,24 @@ func setupSignalHandling() (context.Context, context.CancelFunc) {
 	return ctx, cancel
 }
 
-// setupLogging configures the global logger with custom options
-func setupLogging() *slog.Logger {
-	logger := slog.New(tint.NewHandler(os.Stdout, &tint.Options{
-		Level:      slog.LevelDebug,
+// setupLogging configures the global logger with custom options.
+// The level starts at debug and is toggled with SIGUSR1.
+func setupLogging(w io.Writer) *slog.Logger {
+	logLevel.Set(slog.LevelDebug)
+	logRecorder = diagnostics.NewRecorder(tint.NewHandler(w, &tint.Options{
+		Level:      logLevel,
 		TimeFormat: time.Kitchen,
-	}))
+	}), diagnostics.DefaultLogLines)
+	logger := slog.New(logRecorder)
 	slog.SetDefault(logger)
 	return logger.With("context", "main")
 }
 
 func fatal(l *slog.Logger, err error, log string) {
 	slog.Error(log, "error", err)
+	reporter.Report("fatal", err)
+	if err := reporter.Close(); err != nil {
+		slog.Error("failed to close diagnostics", "error", err)
+	}
 	os.Exit(1)
 }
@@ -0,0 +1,96 @@
+package message
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/common"
+)
+
+// MetaErrors is the metadata key holding the JSON array of the error records of the message
+const MetaErrors = "eb-errors"
+
+// ErrorRecord is a structured record of a processing failure, carried in the message
+// metadata so that the consumers of dead-letter or audit targets can triage failures
+// without parsing log lines.
+type ErrorRecord struct {
+	// Stage is the pipeline stage that failed (e.g. "runner[1]")
+	Stage string `json:"stage"`
+	// Code is the machine-readable error code, if the error provides one
+	Code string `json:"code,omitempty"`
+	// Message is the error message
+	Message string `json:"message"`
+	// Retryable reports whether processing the message again may succeed
+	Retryable bool `json:"retryable"`
+	// Timestamp is the time of the failure
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// CodedError is implemented by errors with a machine-readable code
+type CodedError interface {
+	error
+	ErrorCode() string
+}
+
+// RetryableError is implemented by errors that tell whether a retry may succeed
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+// NewErrorRecord returns the record of an error of the stage. The code and the retryable
+// flag are taken from the first errors of the chain implementing CodedError and RetryableError.
+func NewErrorRecord(stage string, err error) ErrorRecord {
+	rec := ErrorRecord{Stage: stage, Timestamp: time.Now().UTC()}
+	if err == nil {
+		return rec
+	}
+	rec.Message = err.Error()
+	var coded CodedError
+	if errors.As(err, &coded) {
+		rec.Code = coded.ErrorCode()
+	}
+	var retryable RetryableError
+	if errors.As(err, &retryable) {
+		rec.Retryable = retryable.Retryable()
+	}
+	return rec
+}
+
+// AttachError appends an error record to the message metadata
+func (m *RunnerMessage) AttachError(rec ErrorRecord) {
+	m.metaMx.Lock()
+	defer m.metaMx.Unlock()
+	if m.metadata == nil {
+		// Keep the source metadata, which the local metadata would otherwise hide
+		meta, _ := m.original.GetMetadata()
+		m.metadata = common.CopyMap(meta, nil)
+	}
+	records, _ := parseErrorRecords(m.metadata[MetaErrors])
+	records = append(records, rec)
+	if raw, err := json.Marshal(records); err == nil {
+		m.metadata[MetaErrors] = string(raw)
+	}
+}
+
+// GetErrors returns the error records attached to the message
+func (m *RunnerMessage) GetErrors() ([]ErrorRecord, error) {
+	meta, err := m.GetMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return parseErrorRecords(meta[MetaErrors])
+}
+
+func parseErrorRecords(raw string) ([]ErrorRecord, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var records []ErrorRecord
+	if err := json.Unmarshal([]byte(raw), &records); err != nil {
+		return nil, fmt.Errorf("invalid %s metadata: %w", MetaErrors, err)
+	}
+	return records, nil
+}
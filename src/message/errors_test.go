@@ -0,0 +1,51 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type codedError struct{}
+
+func (codedError) Error() string     { return "quota exceeded" }
+func (codedError) ErrorCode() string { return "quota" }
+func (codedError) Retryable() bool   { return true }
+
+func TestNewErrorRecord(t *testing.T) {
+	rec := NewErrorRecord("runner[0]", fmt.Errorf("publish: %w", codedError{}))
+	if rec.Stage != "runner[0]" || rec.Code != "quota" || !rec.Retryable || rec.Message != "publish: quota exceeded" || rec.Timestamp.IsZero() {
+		t.Errorf("record = %+v", rec)
+	}
+	rec = NewErrorRecord("runner[1]", errors.New("boom"))
+	if rec.Code != "" || rec.Retryable || rec.Message != "boom" {
+		t.Errorf("record = %+v", rec)
+	}
+}
+
+func TestRunnerMessageAttachError(t *testing.T) {
+	msg := NewRunnerMessage(&stubSourceMessage{data: []byte("x"), metadata: map[string]string{"source": "s"}})
+	if records, err := msg.GetErrors(); err != nil || records != nil {
+		t.Fatalf("GetErrors() = %v, %v", records, err)
+	}
+	msg.AttachError(NewErrorRecord("runner[0]", errors.New("first")))
+	msg.AttachError(NewErrorRecord("runner[1]", codedError{}))
+
+	records, err := msg.GetErrors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Message != "first" || records[1].Code != "quota" {
+		t.Errorf("records = %+v", records)
+	}
+	// The source metadata is kept and the records survive a clone
+	meta, _ := msg.Clone().GetMetadata()
+	if meta["source"] != "s" || meta[MetaErrors] == "" {
+		t.Errorf("metadata = %v", meta)
+	}
+
+	msg.AddMetadata(MetaErrors, "not json")
+	if _, err := msg.GetErrors(); err == nil {
+		t.Error("expected error for invalid records")
+	}
+}
@@ -3,8 +3,10 @@ package message
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/sandrolain/events-bridge/src/common"
+	"github.com/sandrolain/events-bridge/src/common/tracing"
 )
 
 type SourceMessage interface {
@@ -17,18 +19,21 @@ type SourceMessage interface {
 
 func NewRunnerMessage(original SourceMessage) *RunnerMessage {
 	return &RunnerMessage{
-		original: original,
+		original:  original,
+		ingressAt: time.Now(),
 	}
 }
 
 var _ SourceMessage = (*RunnerMessage)(nil)
 
 type RunnerMessage struct {
-	original SourceMessage
-	data     []byte
-	metadata map[string]string
-	metaMx   sync.Mutex
-	dataMx   sync.Mutex
+	original  SourceMessage
+	data      []byte
+	metadata  map[string]string
+	ingressAt time.Time
+	trace     tracing.SpanContext
+	metaMx    sync.Mutex
+	dataMx    sync.Mutex
 }
 
 func (m *RunnerMessage) GetID() []byte {
@@ -39,6 +44,50 @@ func (m *RunnerMessage) GetOriginal() SourceMessage {
 	return m.original
 }
 
+// GetIngressTime returns the time at which the source handed the message to the bridge.
+func (m *RunnerMessage) GetIngressTime() time.Time {
+	return m.ingressAt
+}
+
+// SetIngressTime overrides the ingress timestamp, e.g. when the source knows
+// the time at which the event was originally received.
+func (m *RunnerMessage) SetIngressTime(t time.Time) {
+	m.ingressAt = t
+}
+
+// GetTraceContext returns the span context of the message span, the zero value when
+// the message is not traced.
+func (m *RunnerMessage) GetTraceContext() tracing.SpanContext {
+	return m.trace
+}
+
+// SetTraceContext sets the span context of the message span, the parent of the spans of
+// the runners processing it.
+func (m *RunnerMessage) SetTraceContext(c tracing.SpanContext) {
+	m.trace = c
+}
+
+// Clone returns a copy of the message sharing the same original source message.
+// Data and metadata are copied so that the clone can be modified independently.
+func (m *RunnerMessage) Clone() *RunnerMessage {
+	clone := &RunnerMessage{
+		original:  m.original,
+		ingressAt: m.ingressAt,
+		trace:     m.trace,
+	}
+	m.metaMx.Lock()
+	if m.metadata != nil {
+		clone.metadata = common.CopyMap(m.metadata, nil)
+	}
+	m.metaMx.Unlock()
+	m.dataMx.Lock()
+	if m.data != nil {
+		clone.data = append([]byte(nil), m.data...)
+	}
+	m.dataMx.Unlock()
+	return clone
+}
+
 func (m *RunnerMessage) SetFromSourceMessage(msg SourceMessage) error {
 	meta, err := msg.GetMetadata()
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"sync"
 	"testing"
+	"time"
 )
 
 const (
@@ -618,3 +619,58 @@ func TestRunnerMessageMetadataIsolation(t *testing.T) {
 		t.Fatalf("expected local metadata in runner, got %#v", runnerMeta)
 	}
 }
+
+// TestRunnerMessageIngressTime tests that new messages are stamped with an ingress time
+func TestRunnerMessageIngressTime(t *testing.T) {
+	t.Parallel()
+
+	before := time.Now()
+	msg := NewRunnerMessage(&stubSourceMessage{})
+	after := time.Now()
+
+	ingress := msg.GetIngressTime()
+	if ingress.Before(before) || ingress.After(after) {
+		t.Fatalf("unexpected ingress time %v, expected between %v and %v", ingress, before, after)
+	}
+
+	custom := before.Add(-time.Minute)
+	msg.SetIngressTime(custom)
+	if !msg.GetIngressTime().Equal(custom) {
+		t.Fatalf("expected ingress time %v, got %v", custom, msg.GetIngressTime())
+	}
+}
+
+// TestRunnerMessageClone tests that clones are independent copies sharing the original
+func TestRunnerMessageClone(t *testing.T) {
+	t.Parallel()
+
+	original := &stubSourceMessage{id: []byte("id"), data: []byte("src")}
+	msg := NewRunnerMessage(original)
+	msg.SetData([]byte("data"))
+	msg.AddMetadata("key", testValueString)
+
+	clone := msg.Clone()
+	clone.SetData([]byte("changed"))
+	clone.AddMetadata("key", "changed")
+
+	data, err := msg.GetData()
+	if err != nil {
+		t.Fatalf(errMsgUnexpectedError, err)
+	}
+	if string(data) != "data" {
+		t.Fatalf("clone modified original data: %q", data)
+	}
+	meta, err := msg.GetMetadata()
+	if err != nil {
+		t.Fatalf(errMsgUnexpectedError, err)
+	}
+	if meta["key"] != testValueString {
+		t.Fatalf("clone modified original metadata: %#v", meta)
+	}
+	if clone.GetOriginal() != msg.GetOriginal() {
+		t.Fatal("expected clone to share the original source message")
+	}
+	if !clone.GetIngressTime().Equal(msg.GetIngressTime()) {
+		t.Fatal("expected clone to keep the ingress time")
+	}
+}
@@ -46,3 +46,25 @@ func SendReply(ch chan *ReplyData, reply *ReplyData) {
 	}
 	ch <- reply
 }
+
+// PayloadReferrer is implemented by source messages whose payload is kept in a remote store
+// and fetched on the first read.
+type PayloadReferrer interface {
+	// PayloadRef returns the reference of the payload while it has not been fetched.
+	PayloadRef() (string, bool)
+}
+
+// PayloadRef returns the reference of the remote payload of the message while it has been
+// neither fetched nor replaced, so that a target can pass the reference instead of the bytes.
+func PayloadRef(msg *RunnerMessage) (string, bool) {
+	msg.dataMx.Lock()
+	replaced := msg.data != nil
+	msg.dataMx.Unlock()
+	if replaced {
+		return "", false
+	}
+	if r, ok := msg.original.(PayloadReferrer); ok {
+		return r.PayloadRef()
+	}
+	return "", false
+}
@@ -177,3 +177,27 @@ func TestAwaitReplyOrStatusTimeout(t *testing.T) {
 		t.Fatal("expected nil status on timeout")
 	}
 }
+
+type mockReferrerMessage struct {
+	mockSourceMessage
+	ref string
+}
+
+func (m *mockReferrerMessage) PayloadRef() (string, bool) {
+	return m.ref, m.ref != ""
+}
+
+func TestPayloadRef(t *testing.T) {
+	msg := NewRunnerMessage(&mockReferrerMessage{ref: "s3://bucket/key"})
+	if ref, ok := PayloadRef(msg); !ok || ref != "s3://bucket/key" {
+		t.Errorf("expected reference, got %q %v", ref, ok)
+	}
+
+	msg.SetData([]byte("replaced"))
+	if _, ok := PayloadRef(msg); ok {
+		t.Error("expected no reference after the payload is replaced")
+	}
+	if _, ok := PayloadRef(NewRunnerMessage(&mockSourceMessage{})); ok {
+		t.Error("expected no reference for a plain source message")
+	}
+}
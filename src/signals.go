@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime/pprof"
+	"time"
+)
+
+// logLevel is the level of the global logger, switched between debug and info at runtime
+var logLevel = new(slog.LevelVar)
+
+// dumpState writes the pipeline state and the goroutine stacks, to inspect a possibly
+// wedged bridge without attaching a debugger
+func dumpState(w io.Writer, status func() any) error {
+	data, err := json.MarshalIndent(status(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "=== events-bridge state at %s ===\n%s\n=== goroutines ===\n", time.Now().Format(time.RFC3339), data); err != nil {
+		return err
+	}
+	return pprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// toggleDebugLogging switches the log level between debug and info
+func toggleDebugLogging(logger *slog.Logger) {
+	level := slog.LevelDebug
+	if logLevel.Level() == slog.LevelDebug {
+		level = slog.LevelInfo
+	}
+	logLevel.Set(level)
+	logger.Info("log level changed", "level", level.String())
+}
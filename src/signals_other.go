@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// setupDiagnosticSignals is not supported on platforms without SIGQUIT and SIGUSR1
+func setupDiagnosticSignals(context.Context, *slog.Logger, func() any) {}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// setupDiagnosticSignals handles the live diagnostics signals until the context is done:
+// SIGQUIT dumps the pipeline state and the goroutine stacks to stderr (and writes a
+// diagnostic bundle when diagnostics are configured) without stopping the bridge,
+// SIGUSR1 toggles the debug logging.
+func setupDiagnosticSignals(ctx context.Context, logger *slog.Logger, status func() any) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGQUIT, syscall.SIGUSR1)
+
+	go func() {
+		defer signal.Stop(sigChan)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-sigChan:
+				switch sig {
+				case syscall.SIGQUIT:
+					logger.Info("received signal, dumping pipeline state to stderr", "signal", sig.String())
+					if err := dumpState(os.Stderr, status); err != nil {
+						logger.Error("failed to dump pipeline state", "error", err)
+					}
+					reporter.Report("signal", nil)
+				case syscall.SIGUSR1:
+					toggleDebugLogging(logger)
+				}
+			}
+		}
+	}()
+}
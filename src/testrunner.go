@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/bridge"
+	"github.com/sandrolain/events-bridge/src/config"
+	"github.com/sandrolain/events-bridge/src/connectors"
+)
+
+const testRunnerCommand = "test-runner"
+
+const (
+	fixtureInputSuffix    = ".input.json"
+	fixtureExpectedSuffix = ".expected.json"
+)
+
+// fixtureExpectation is the expected outcome of a fixture. Only the metadata keys listed
+// are compared, a null value expecting the key to be missing; the data is compared when
+// present, as JSON when both payloads are JSON.
+type fixtureExpectation struct {
+	Metadata map[string]*string `json:"metadata"`
+	Data     json.RawMessage    `json:"data"`
+	// Filtered expects the message to be dropped by the runner filterExpr
+	Filtered bool `json:"filtered"`
+	// Error expects the runner to fail with an error containing this text
+	Error string `json:"error"`
+}
+
+// runTestRunner runs the fixtures of a directory through a single runner and reports
+// the differences from the expected outputs. Every fixture is a pair of files in the
+// JSON message format of the CLI connector: <name>.input.json and <name>.expected.json.
+func runTestRunner(ctx context.Context, logger *slog.Logger, args []string) error {
+	fs := flag.NewFlagSet(testRunnerCommand, flag.ContinueOnError)
+	runnerPath := fs.String("runner", "", "runner configuration file (YAML or JSON)")
+	fixturesDir := fs.String("fixtures", ".", "directory of the input/expected fixture pairs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *runnerPath == "" {
+		return errors.New("--runner is required")
+	}
+
+	runnerCfg, err := config.ParseRunnerFile(*runnerPath)
+	if err != nil {
+		return fmt.Errorf("failed to load runner configuration: %w", err)
+	}
+	names, err := listFixtures(*fixturesDir)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no *%s fixtures found in %s", fixtureInputSuffix, *fixturesDir)
+	}
+
+	debugger, err := bridge.NewDebugger(&config.Config{Runners: []connectors.RunnerConfig{*runnerCfg}}, logger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := debugger.Close(); err != nil {
+			logger.Error("failed to close runner", "error", err)
+		}
+	}()
+
+	out := os.Stdout
+	failed := 0
+	for _, name := range names {
+		start := time.Now()
+		diffs, err := runFixture(ctx, debugger, filepath.Join(*fixturesDir, name))
+		if err != nil {
+			diffs = []string{err.Error()}
+		}
+		status := "PASS"
+		if len(diffs) > 0 {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(out, "%s %s (%s)\n", status, name, time.Since(start).Round(time.Microsecond))
+		for _, d := range diffs {
+			fmt.Fprintf(out, "  %s\n", d)
+		}
+	}
+
+	fmt.Fprintf(out, "%d passed, %d failed\n", len(names)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d fixtures failed", failed, len(names))
+	}
+	return nil
+}
+
+// listFixtures returns the sorted names of the fixtures of a directory
+func listFixtures(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), fixtureInputSuffix); ok && !e.IsDir() {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// runFixture runs the input of a fixture through the runner and returns the differences
+// from the expected outcome
+func runFixture(ctx context.Context, debugger *bridge.Debugger, base string) ([]string, error) {
+	msg, err := readDebugMessage(base + fixtureInputSuffix)
+	if err != nil {
+		return nil, err
+	}
+	expectedPath := base + fixtureExpectedSuffix
+	content, err := os.ReadFile(expectedPath) //nolint:gosec // user-provided test fixture
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expected output: %w", err)
+	}
+	var want fixtureExpectation
+	if err := json.Unmarshal(content, &want); err != nil {
+		return nil, fmt.Errorf("failed to decode expected output: %w", err)
+	}
+
+	var step bridge.Step
+	if err := debugger.Run(ctx, msg, func(s bridge.Step) bool {
+		step = s
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case want.Error != "":
+		if step.Err == nil {
+			return []string{fmt.Sprintf("error: none, want %q", want.Error)}, nil
+		}
+		if !strings.Contains(step.Err.Error(), want.Error) {
+			return []string{fmt.Sprintf("error: %q, want %q", step.Err, want.Error)}, nil
+		}
+		return nil, nil
+	case step.Err != nil:
+		return []string{fmt.Sprintf("error: %v", step.Err)}, nil
+	case step.Filtered != want.Filtered:
+		return []string{fmt.Sprintf("filtered: %t, want %t", step.Filtered, want.Filtered)}, nil
+	}
+
+	meta, data, err := msg.GetMetadataAndData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata and data: %w", err)
+	}
+
+	var diffs []string
+	for _, k := range slices.Sorted(maps.Keys(want.Metadata)) {
+		got, ok := meta[k]
+		switch wantValue := want.Metadata[k]; {
+		case wantValue == nil && ok:
+			diffs = append(diffs, fmt.Sprintf("metadata %s: %q, want missing", k, got))
+		case wantValue != nil && !ok:
+			diffs = append(diffs, fmt.Sprintf("metadata %s: missing, want %q", k, *wantValue))
+		case wantValue != nil && got != *wantValue:
+			diffs = append(diffs, fmt.Sprintf("metadata %s: %q, want %q", k, got, *wantValue))
+		}
+	}
+
+	if want.Data != nil {
+		// The expected payload is decoded as the input one, e.g. objects encoded as JSON
+		expected, err := decodeDebugMessage(append(append([]byte(`{"data":`), want.Data...), '}'))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode expected data: %w", err)
+		}
+		wantData, err := expected.GetData()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get expected data: %w", err)
+		}
+		if !payloadEqual(data, wantData) {
+			diffs = append(diffs, fmt.Sprintf("data: %s", truncatePayload(data)), fmt.Sprintf("want: %s", truncatePayload(wantData)))
+		}
+	}
+	return diffs, nil
+}
+
+// payloadEqual compares two payloads as JSON values when both are JSON, byte by byte otherwise
+func payloadEqual(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) == nil && json.Unmarshal(b, &vb) == nil {
+		return reflect.DeepEqual(va, vb)
+	}
+	return bytes.Equal(a, b)
+}
@@ -2,16 +2,22 @@ package utils
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	goplugin "plugin"
+	"strings"
 
 	"github.com/creasty/defaults"
 	"github.com/go-playground/validator/v10"
 	"github.com/go-viper/mapstructure/v2"
+	"github.com/sandrolain/events-bridge/src/common/configmigrate"
 )
 
-func LoadPluginAndConfig[R any](relPath string, method string, configMethod string, options map[string]any) (res R, err error) {
+// LoadPluginAndConfig opens the plugin, parses the options into the config returned by
+// configMethod and passes it to the constructor method. With strict the options matching
+// no config field are rejected.
+func LoadPluginAndConfig[R any](relPath string, method string, configMethod string, options map[string]any, strict bool) (res R, err error) {
 	exePath, e := os.Executable()
 	if e != nil {
 		err = fmt.Errorf("failed to get executable path: %w", e)
@@ -49,7 +55,16 @@ func LoadPluginAndConfig[R any](relPath string, method string, configMethod stri
 		return res, fmt.Errorf("failed to find constructor for %s: %w", method, err)
 	}
 
-	err = ParseConfig(options, config)
+	options, err = migrateOptions(p, relPath, configMethod, options)
+	if err != nil {
+		return res, fmt.Errorf("failed to migrate config for %s: %w", method, err)
+	}
+
+	if strict {
+		err = ParseConfigStrict(options, config)
+	} else {
+		err = ParseConfig(options, config)
+	}
 	if err != nil {
 		return res, fmt.Errorf("failed to parse config for %s: %w", method, err)
 	}
@@ -65,8 +80,63 @@ func LoadPluginAndConfig[R any](relPath string, method string, configMethod stri
 
 type NewConfigMethodFunc = func() any
 type NewConstructorMethodFunc[R any] = func(any) (R, error)
+type ConfigMigrationsFunc = func() []configmigrate.Migration
+
+// ConfigMigrationsMethod returns the name of the optional plugin function declaring
+// the migrations of the options of a config constructor, e.g. RunnerConfigMigrations
+// for NewRunnerConfig
+func ConfigMigrationsMethod(configMethod string) string {
+	return strings.TrimPrefix(configMethod, "New") + "Migrations"
+}
+
+// migrateOptions upgrades the options with the migrations declared by the plugin,
+// logging the deprecated options found
+func migrateOptions(p *goplugin.Plugin, relPath string, configMethod string, options map[string]any) (map[string]any, error) {
+	migrationsMethod := ConfigMigrationsMethod(configMethod)
+	var migrations []configmigrate.Migration
+	if sym, e := p.Lookup(migrationsMethod); e == nil {
+		fn, ok := sym.(ConfigMigrationsFunc)
+		if !ok {
+			return nil, fmt.Errorf("plugin has invalid signature for %s", migrationsMethod)
+		}
+		migrations = fn()
+	}
+
+	// Without migrations the version key is still accepted and removed
+	migrated, deprecations, err := configmigrate.Apply(options, migrations)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deprecations {
+		slog.Default().Warn("deprecated connector option",
+			"plugin", filepath.Base(relPath),
+			"option", d.Option,
+			"replacement", d.Replacement,
+			"version", d.Version,
+			"message", d.Message,
+		)
+	}
+	return migrated, nil
+}
 
 func ParseConfig(opts map[string]any, res any) (err error) {
+	return parseConfig(opts, res, false)
+}
+
+// ParseConfigStrict is ParseConfig rejecting the options matching no field of res, with
+// the closest field names as suggestions
+func ParseConfigStrict(opts map[string]any, res any) (err error) {
+	return parseConfig(opts, res, true)
+}
+
+func parseConfig(opts map[string]any, res any, strict bool) (err error) {
+	if strict {
+		if e := CheckUnknownOptions(opts, res, "mapstructure"); e != nil {
+			err = fmt.Errorf("failed to decode options: %w", e)
+			return
+		}
+	}
+
 	if e := defaults.Set(res); e != nil {
 		err = fmt.Errorf("failed to set default values: %w", e)
 		return
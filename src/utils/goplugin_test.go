@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/sandrolain/events-bridge/src/connectors"
 	"github.com/sandrolain/events-bridge/src/utils"
 )
 
@@ -25,7 +26,7 @@ func skipIfPluginNotAvailable(t *testing.T) {
 }
 
 func TestLoadPluginMissingFile(t *testing.T) {
-	value, err := utils.LoadPluginAndConfig[int]("/non/existent/plugin.so", "Constructor", "NewConfig", nil)
+	value, err := utils.LoadPluginAndConfig[int]("/non/existent/plugin.so", "Constructor", "NewConfig", nil, false)
 	if err == nil {
 		t.Fatal("expected error when plugin file is missing")
 	}
@@ -46,7 +47,7 @@ func TestLoadPluginAndConfigMissingConfigMethod(t *testing.T) {
 	}
 
 	pluginPath := getTestPluginPath()
-	_, err := utils.LoadPluginAndConfig[Runner](pluginPath, "NewRunner", "NonExistentConfig", nil)
+	_, err := utils.LoadPluginAndConfig[Runner](pluginPath, "NewRunner", "NonExistentConfig", nil, false)
 	if err == nil {
 		t.Fatal("expected error when config method is missing")
 	}
@@ -64,7 +65,7 @@ func TestLoadPluginAndConfigInvalidConfigSignature(t *testing.T) {
 	}
 
 	pluginPath := getTestPluginPath()
-	_, err := utils.LoadPluginAndConfig[Runner](pluginPath, "NewRunner", "InvalidConfig", nil)
+	_, err := utils.LoadPluginAndConfig[Runner](pluginPath, "NewRunner", "InvalidConfig", nil, false)
 	if err == nil {
 		t.Fatal("expected error when config has invalid signature")
 	}
@@ -82,7 +83,7 @@ func TestLoadPluginAndConfigMissingMethod(t *testing.T) {
 	}
 
 	pluginPath := getTestPluginPath()
-	_, err := utils.LoadPluginAndConfig[Runner](pluginPath, "NonExistentMethod", "NewConfig", nil)
+	_, err := utils.LoadPluginAndConfig[Runner](pluginPath, "NonExistentMethod", "NewConfig", nil, false)
 	if err == nil {
 		t.Fatal("expected error when method is missing")
 	}
@@ -100,7 +101,7 @@ func TestLoadPluginAndConfigInvalidMethodSignature(t *testing.T) {
 	}
 
 	pluginPath := getTestPluginPath()
-	_, err := utils.LoadPluginAndConfig[Runner](pluginPath, "NewInvalidRunner", "NewConfig", nil)
+	_, err := utils.LoadPluginAndConfig[Runner](pluginPath, "NewInvalidRunner", "NewConfig", nil, false)
 	if err == nil {
 		t.Fatal("expected error when method has invalid signature")
 	}
@@ -122,7 +123,7 @@ func TestLoadPluginAndConfigParseConfigError(t *testing.T) {
 		"value": "not-a-number",
 	}
 
-	_, err := utils.LoadPluginAndConfig[Runner](pluginPath, "NewRunner", "NewConfig", opts)
+	_, err := utils.LoadPluginAndConfig[Runner](pluginPath, "NewRunner", "NewConfig", opts, false)
 	if err == nil {
 		t.Fatal("expected error when config parsing fails")
 	}
@@ -131,6 +132,15 @@ func TestLoadPluginAndConfigParseConfigError(t *testing.T) {
 	}
 }
 
+func TestConfigMigrationsMethod(t *testing.T) {
+	if got := utils.ConfigMigrationsMethod(connectors.NewSourceConfigName); got != connectors.SourceConfigMigrationsName {
+		t.Errorf("ConfigMigrationsMethod() = %q, want %q", got, connectors.SourceConfigMigrationsName)
+	}
+	if got := utils.ConfigMigrationsMethod(connectors.NewRunnerConfigName); got != connectors.RunnerConfigMigrationsName {
+		t.Errorf("ConfigMigrationsMethod() = %q, want %q", got, connectors.RunnerConfigMigrationsName)
+	}
+}
+
 func TestParseConfig(t *testing.T) {
 	t.Run("success with defaults", func(t *testing.T) {
 		type TestConfig struct {
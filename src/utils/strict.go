@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// UnknownOptionsError lists the options of a configuration that match no field of its
+// struct, e.g. misspelled connector options
+type UnknownOptionsError struct {
+	Options []UnknownOption
+}
+
+// UnknownOption is an option matching no field, with the closest field names
+type UnknownOption struct {
+	// Path is the dotted path of the option, with the indexes of lists and maps in brackets
+	Path string
+	// Suggestions are the field names close to the option
+	Suggestions []string
+}
+
+func (e *UnknownOptionsError) Error() string {
+	parts := make([]string, len(e.Options))
+	for i, o := range e.Options {
+		parts[i] = fmt.Sprintf("unknown option %q", o.Path)
+		if len(o.Suggestions) > 0 {
+			parts[i] += fmt.Sprintf(" (did you mean %q?)", o.Suggestions[0])
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// CheckUnknownOptions returns an UnknownOptionsError when opts has keys matching no field of
+// the struct res points to, at any depth. The keys match the names of the tag
+// case-insensitively, as mapstructure does; maps and untyped fields accept any key.
+func CheckUnknownOptions(opts map[string]any, res any, tag string) error {
+	var unknown []UnknownOption
+	collectUnknown(opts, reflect.TypeOf(res), tag, "", &unknown)
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Path < unknown[j].Path })
+	return &UnknownOptionsError{Options: unknown}
+}
+
+// collectUnknown walks the decoded value along its target type
+func collectUnknown(v any, t reflect.Type, tag string, path string, unknown *[]UnknownOption) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		fields, remain := structFields(t, tag)
+		if remain {
+			return
+		}
+		for key, value := range m {
+			idx := slices.IndexFunc(fields, func(f structField) bool { return strings.EqualFold(f.name, key) })
+			if idx < 0 {
+				names := make([]string, len(fields))
+				for i, f := range fields {
+					names[i] = f.name
+				}
+				*unknown = append(*unknown, UnknownOption{Path: joinPath(path, key), Suggestions: suggest(key, names)})
+				continue
+			}
+			collectUnknown(value, fields[idx].typ, tag, joinPath(path, key), unknown)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := v.([]any)
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			collectUnknown(item, t.Elem(), tag, fmt.Sprintf("%s[%d]", path, i), unknown)
+		}
+	case reflect.Map:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		for key, value := range m {
+			collectUnknown(value, t.Elem(), tag, fmt.Sprintf("%s[%s]", path, key), unknown)
+		}
+	}
+}
+
+// structField is a field decoded from a key
+type structField struct {
+	name string
+	typ  reflect.Type
+}
+
+// structFields returns the decoded fields of the struct, those of the squashed embedded
+// structs included, and whether a field collects the remaining keys
+func structFields(t reflect.Type, tag string) ([]structField, bool) {
+	var fields []structField
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" {
+			continue
+		}
+		if slices.Contains(strings.Split(opts, ","), "remain") {
+			return nil, true
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && (slices.Contains(strings.Split(opts, ","), "squash") || (f.Anonymous && name == "")) {
+			embedded, remain := structFields(ft, tag)
+			if remain {
+				return nil, true
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, structField{name: name, typ: f.Type})
+	}
+	return fields, false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// suggest returns the names close to the key, closest first
+func suggest(key string, names []string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	lower := strings.ToLower(key)
+	maxDistance := max(1, len(key)/3)
+	for _, name := range names {
+		if d := editDistance(lower, strings.ToLower(name)); d <= maxDistance {
+			candidates = append(candidates, candidate{name, d})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+	res := make([]string, len(candidates))
+	for i, c := range candidates {
+		res[i] = c.name
+	}
+	return res
+}
+
+// editDistance returns the optimal string alignment distance of the strings: the
+// Levenshtein distance counting the transposition of adjacent characters as one edit
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
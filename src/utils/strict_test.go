@@ -0,0 +1,78 @@
+package utils_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sandrolain/events-bridge/src/utils"
+)
+
+type strictTestServer struct {
+	Host string `mapstructure:"host"`
+}
+
+type strictTestBase struct {
+	Address string `mapstructure:"address"`
+}
+
+type strictTestConfig struct {
+	strictTestBase `mapstructure:",squash"`
+	Subject        string                       `mapstructure:"subject" validate:"required"`
+	Timeout        time.Duration                `mapstructure:"timeout" default:"5s"`
+	Servers        []strictTestServer           `mapstructure:"servers"`
+	Routes         map[string]*strictTestServer `mapstructure:"routes"`
+	Headers        map[string]string            `mapstructure:"headers"`
+	Extra          any                          `mapstructure:"extra"`
+}
+
+func TestParseConfigStrict(t *testing.T) {
+	valid := map[string]any{
+		"address": "localhost:4222",
+		"Subject": "events",
+		"servers": []any{map[string]any{"host": "a"}},
+		"routes":  map[string]any{"main": map[string]any{"host": "b"}},
+		"headers": map[string]any{"x-any": "1"},
+		"extra":   map[string]any{"free": "form"},
+	}
+	cfg := new(strictTestConfig)
+	if err := utils.ParseConfigStrict(valid, cfg); err != nil {
+		t.Fatalf("ParseConfigStrict() unexpected error = %v", err)
+	}
+	if cfg.Address != "localhost:4222" || cfg.Subject != "events" || cfg.Timeout != 5*time.Second {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	invalid := map[string]any{
+		"subjetc": "events",
+		"servers": []any{map[string]any{"hots": "a"}},
+		"routes":  map[string]any{"main": map[string]any{"port": 1}},
+	}
+	err := utils.ParseConfigStrict(invalid, new(strictTestConfig))
+	var unknown *utils.UnknownOptionsError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("ParseConfigStrict() error = %v, want UnknownOptionsError", err)
+	}
+	want := []utils.UnknownOption{
+		{Path: "routes[main].port"},
+		{Path: "servers[0].hots", Suggestions: []string{"host"}},
+		{Path: "subjetc", Suggestions: []string{"subject"}},
+	}
+	if len(unknown.Options) != len(want) {
+		t.Fatalf("unknown options = %+v", unknown.Options)
+	}
+	for i, o := range unknown.Options {
+		if o.Path != want[i].Path || len(o.Suggestions) != len(want[i].Suggestions) ||
+			(len(o.Suggestions) > 0 && o.Suggestions[0] != want[i].Suggestions[0]) {
+			t.Errorf("unknown option %d = %+v, want %+v", i, o, want[i])
+		}
+	}
+	if got := unknown.Error(); got != `unknown option "routes[main].port"; unknown option "servers[0].hots" (did you mean "host"?); unknown option "subjetc" (did you mean "subject"?)` {
+		t.Errorf("Error() = %s", got)
+	}
+
+	// Without strict the unknown options are ignored
+	if err := utils.ParseConfig(map[string]any{"subject": "a", "subjetc": "b"}, new(strictTestConfig)); err != nil {
+		t.Errorf("ParseConfig() unexpected error = %v", err)
+	}
+}
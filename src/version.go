@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+
+	"github.com/sandrolain/events-bridge/src/bridge"
+	"github.com/sandrolain/events-bridge/src/common/version"
+	"github.com/sandrolain/events-bridge/src/config"
+)
+
+const versionCommand = "--version"
+
+// maxShortHash is the length of the commits and hashes printed by --version
+const maxShortHash = 12
+
+// runVersion prints the build metadata of the bridge and of the connector plugins,
+// as text or as the JSON report of the admin API
+func runVersion(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet(versionCommand, flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the JSON report")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	connectors, err := version.Connectors(bridge.ConnectorsDir)
+	if err != nil {
+		return err
+	}
+	report := version.Report{Info: version.Get(), Connectors: connectors}
+	if *asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	fmt.Fprintf(out, "events-bridge %s\n", describe(report.Info))
+	if len(report.Connectors) == 0 {
+		fmt.Fprintf(out, "no connector plugins in %s\n", bridge.ConnectorsDir)
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONNECTOR\tVERSION\tSHA256")
+	for _, c := range report.Connectors {
+		if c.Error != "" {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, c.Error, short(c.SHA256))
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, describe(c.Info), short(c.SHA256))
+	}
+	return tw.Flush()
+}
+
+// describe formats the version, the commit and the build date of a build
+func describe(info version.Info) string {
+	s := info.Version
+	if info.Commit != "" {
+		s += " (" + short(info.Commit)
+		if info.Modified {
+			s += ", modified"
+		}
+		s += ")"
+	}
+	if info.Date != "" {
+		s += " " + info.Date
+	}
+	if info.GoVersion != "" {
+		s += " " + info.GoVersion
+	}
+	if info.Platform != "" {
+		s += " " + info.Platform
+	}
+	return s
+}
+
+func short(hash string) string {
+	if len(hash) > maxShortHash {
+		return hash[:maxShortHash]
+	}
+	return hash
+}
+
+// logVersion logs the build metadata, the connector plugins and the features enabled by
+// the configuration at startup
+func logVersion(logger *slog.Logger, cfg *config.Config) {
+	info := version.Get()
+	connectors, err := version.Connectors(bridge.ConnectorsDir)
+	if err != nil {
+		logger.Warn("failed to list the connector plugins", "error", err)
+	}
+	plugins := make([]string, 0, len(connectors))
+	for _, c := range connectors {
+		plugins = append(plugins, c.Name+"@"+c.Version)
+	}
+	logger.Info("events bridge starting",
+		"version", info.Version,
+		"commit", short(info.Commit),
+		"date", info.Date,
+		"goVersion", info.GoVersion,
+		"connectors", plugins,
+		"features", cfg.Features(),
+	)
+}